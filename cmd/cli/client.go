@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client calls the relay admin API
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newClient(baseURL, token string) *client {
+	return &client{
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/admin/api",
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// provider mirrors the relay's provider JSON; unknown fields are kept so updates do not drop them
+type provider struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	APIURL          string `json:"apiUrl"`
+	APIKey          string `json:"apiKey"`
+	Enabled         bool   `json:"enabled"`
+	Level           int    `json:"level,omitempty"`
+	Suspended       bool   `json:"suspended,omitempty"`
+	SuspendedReason string `json:"suspendedReason,omitempty"`
+
+	raw map[string]json.RawMessage
+}
+
+func (p *provider) UnmarshalJSON(data []byte) error {
+	type plain provider
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &p.raw)
+}
+
+func (p provider) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(p.raw)+8)
+	for key, value := range p.raw {
+		fields[key] = value
+	}
+	fields["id"] = p.ID
+	fields["name"] = p.Name
+	fields["apiUrl"] = p.APIURL
+	fields["apiKey"] = p.APIKey
+	fields["enabled"] = p.Enabled
+	if p.Level != 0 {
+		fields["level"] = p.Level
+	}
+	return json.Marshal(fields)
+}
+
+// request sends a JSON request and decodes a JSON response into out (if not nil)
+func (c *client) request(method, path string, body, out interface{}) error {
+	resp, err := c.do(c.http, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends the request and turns non-2xx responses into errors
+func (c *client) do(httpClient *http.Client, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("unauthorized: set --token or AILURUS_TOKEN")
+		}
+		if apiErr.Error == "" {
+			apiErr.Error = resp.Status
+		}
+		return nil, fmt.Errorf("%s", apiErr.Error)
+	}
+	return resp, nil
+}
+
+func (c *client) listProviders(platform string) ([]provider, error) {
+	var result struct {
+		Providers []provider `json:"providers"`
+	}
+	err := c.request(http.MethodGet, "/providers/"+url.PathEscape(platform), nil, &result)
+	return result.Providers, err
+}
+
+// findProvider resolves a provider name (case-insensitive)
+func (c *client) findProvider(platform, name string) (provider, error) {
+	providers, err := c.listProviders(platform)
+	if err != nil {
+		return provider{}, err
+	}
+	for _, p := range providers {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return provider{}, fmt.Errorf("provider %q not found on platform %s", name, platform)
+}
+
+// providerPath returns /providers/<platform>/<id><suffix>
+func providerPath(platform string, id int, suffix string) string {
+	return fmt.Sprintf("/providers/%s/%d%s", url.PathEscape(platform), id, suffix)
+}
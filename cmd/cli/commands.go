@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func runProviders(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ailurus providers list|add|enable|disable")
+	}
+	switch args[0] {
+	case "list", "ls":
+		return providersList(c, args[1:])
+	case "add":
+		return providersAdd(c, args[1:])
+	case "enable":
+		return providersSetEnabled(c, args[1:], true)
+	case "disable":
+		return providersSetEnabled(c, args[1:], false)
+	}
+	return fmt.Errorf("unknown providers command %q", args[0])
+}
+
+func providersList(c *client, args []string) error {
+	fs := flag.NewFlagSet("providers list", flag.ExitOnError)
+	platform := platformFlag(fs)
+	parseArgs(fs, args)
+
+	providers, err := c.listProviders(*platform)
+	if err != nil {
+		return err
+	}
+	if len(providers) == 0 {
+		fmt.Printf("No providers configured for %s\n", *platform)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tLEVEL\tSTATE\tURL\tKEY")
+	for _, p := range providers {
+		state := "enabled"
+		switch {
+		case p.Suspended:
+			state = "suspended"
+		case !p.Enabled:
+			state = "disabled"
+		}
+		level := p.Level
+		if level == 0 {
+			level = 1
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", p.ID, p.Name, level, state, p.APIURL, p.APIKey)
+	}
+	return w.Flush()
+}
+
+func providersAdd(c *client, args []string) error {
+	fs := flag.NewFlagSet("providers add", flag.ExitOnError)
+	platform := platformFlag(fs)
+	name := fs.String("name", "", "provider name")
+	apiURL := fs.String("api-url", "", "upstream base URL")
+	apiKey := fs.String("api-key", "", "upstream API key")
+	level := fs.Int("level", 0, "priority group, lower is tried first (1-10)")
+	disabled := fs.Bool("disabled", false, "add the provider disabled")
+	parseArgs(fs, args)
+	if *name == "" || *apiURL == "" {
+		return fmt.Errorf("usage: ailurus providers add -p platform --name NAME --api-url URL [--api-key KEY] [--level N]")
+	}
+
+	var created provider
+	body := provider{Name: *name, APIURL: *apiURL, APIKey: *apiKey, Level: *level, Enabled: !*disabled}
+	if err := c.request(http.MethodPost, "/providers/"+url.PathEscape(*platform), body, &created); err != nil {
+		return err
+	}
+	fmt.Printf("Added %s/%s (id %d)\n", *platform, created.Name, created.ID)
+	return nil
+}
+
+func providersSetEnabled(c *client, args []string, enabled bool) error {
+	command := "providers disable"
+	if enabled {
+		command = "providers enable"
+	}
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	platform := platformFlag(fs)
+	name, err := requireName(parseArgs(fs, args), command)
+	if err != nil {
+		return err
+	}
+
+	p, err := c.findProvider(*platform, name)
+	if err != nil {
+		return err
+	}
+	// The masked key is sent back unchanged; the relay keeps the stored key
+	p.Enabled = enabled
+	if err := c.request(http.MethodPut, providerPath(*platform, p.ID, ""), p, nil); err != nil {
+		return err
+	}
+	state := "disabled"
+	if enabled {
+		state = "enabled"
+	}
+	fmt.Printf("%s/%s %s\n", *platform, p.Name, state)
+	return nil
+}
+
+// logEntry is the subset of a request log printed by `logs tail`
+type logEntry struct {
+	CreatedAt    string  `json:"created_at"`
+	Platform     string  `json:"platform"`
+	Provider     string  `json:"provider"`
+	Model        string  `json:"model"`
+	HttpCode     int     `json:"http_code"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	DurationSec  float64 `json:"duration_sec"`
+	TotalCost    float64 `json:"total_cost"`
+	ErrorType    string  `json:"error_type"`
+	ErrorMessage string  `json:"error_message"`
+}
+
+func runLogs(c *client, args []string) error {
+	if len(args) == 0 || args[0] != "tail" {
+		return fmt.Errorf("usage: ailurus logs tail [--errors] [-p platform] [--provider NAME] [--model PATTERN]")
+	}
+	fs := flag.NewFlagSet("logs tail", flag.ExitOnError)
+	platform := fs.String("platform", "", "only this platform")
+	fs.StringVar(platform, "p", "", "shorthand for --platform")
+	providerName := fs.String("provider", "", "only this provider")
+	model := fs.String("model", "", "only models matching the pattern (e.g. claude-*)")
+	errorsOnly := fs.Bool("errors", false, "only failed requests")
+	parseArgs(fs, args[1:])
+
+	query := url.Values{}
+	if *platform != "" {
+		query.Set("platform", *platform)
+	}
+	if *providerName != "" {
+		query.Set("provider", *providerName)
+	}
+	if *model != "" {
+		query.Set("model", *model)
+	}
+	if *errorsOnly {
+		query.Set("errors_only", "true")
+	}
+
+	// The stream stays open until interrupted, so no client timeout
+	resp, err := c.do(&http.Client{}, http.MethodGet, "/logs/tail?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fmt.Fprintln(os.Stderr, "Streaming request logs, press Ctrl+C to stop")
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue // heartbeat
+		}
+		var log logEntry
+		if err := json.Unmarshal([]byte(line), &log); err != nil {
+			continue
+		}
+		fmt.Printf("%s  %-10s %-20s %-28s %3d  %6d/%-6d %6.2fs  $%.4f",
+			log.CreatedAt, log.Platform, log.Provider, log.Model, log.HttpCode,
+			log.InputTokens, log.OutputTokens, log.DurationSec, log.TotalCost)
+		if log.ErrorType != "" || log.ErrorMessage != "" {
+			fmt.Printf("  [%s] %s", log.ErrorType, log.ErrorMessage)
+		}
+		fmt.Println()
+	}
+	return scanner.Err()
+}
+
+func runStats(c *client, args []string) error {
+	period := "today"
+	if len(args) > 0 {
+		period = args[0]
+	}
+	var stats struct {
+		TotalRequests     int            `json:"total_requests"`
+		TotalTokens       int            `json:"total_tokens"`
+		TotalInputTokens  int            `json:"total_input_tokens"`
+		TotalOutputTokens int            `json:"total_output_tokens"`
+		TotalCost         float64        `json:"total_cost"`
+		SuccessRate       float64        `json:"success_rate"`
+		AvgDuration       float64        `json:"avg_duration_sec"`
+		ByProvider        map[string]int `json:"by_provider"`
+		ByModel           map[string]int `json:"by_model"`
+	}
+	if err := c.request(http.MethodGet, "/metrics?period="+url.QueryEscape(period), nil, &stats); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(w, "Period\t%s\n", period)
+	fmt.Fprintf(w, "Requests\t%d\n", stats.TotalRequests)
+	fmt.Fprintf(w, "Tokens\t%d (in %d / out %d)\n", stats.TotalTokens, stats.TotalInputTokens, stats.TotalOutputTokens)
+	fmt.Fprintf(w, "Cost\t$%.4f\n", stats.TotalCost)
+	fmt.Fprintf(w, "Success rate\t%.1f%%\n", stats.SuccessRate)
+	fmt.Fprintf(w, "Avg duration\t%.2fs\n", stats.AvgDuration)
+	printCounts(w, "By provider", stats.ByProvider)
+	printCounts(w, "By model", stats.ByModel)
+	return w.Flush()
+}
+
+// printCounts prints a breakdown sorted by count, largest first
+func printCounts(w *tabwriter.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Fprintf(w, "\n%s\t\n", title)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s\t%d\n", key, counts[key])
+	}
+}
+
+func runTestProvider(c *client, args []string) error {
+	fs := flag.NewFlagSet("test-provider", flag.ExitOnError)
+	platform := platformFlag(fs)
+	name, err := requireName(parseArgs(fs, args), "test-provider")
+	if err != nil {
+		return err
+	}
+	p, err := c.findProvider(*platform, name)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		OK        bool   `json:"ok"`
+		HTTPCode  int    `json:"http_code"`
+		LatencyMs int64  `json:"latency_ms"`
+		Error     string `json:"error"`
+	}
+	if err := c.request(http.MethodPost, providerPath(*platform, p.ID, "/test"), nil, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		if result.HTTPCode == 0 {
+			return fmt.Errorf("%s/%s failed after %dms: %s", *platform, p.Name, result.LatencyMs, result.Error)
+		}
+		return fmt.Errorf("%s/%s failed after %dms: HTTP %d %s", *platform, p.Name, result.LatencyMs, result.HTTPCode, result.Error)
+	}
+	fmt.Printf("%s/%s OK (HTTP %d, %dms)\n", *platform, p.Name, result.HTTPCode, result.LatencyMs)
+	return nil
+}
+
+func runSwitch(c *client, args []string) error {
+	fs := flag.NewFlagSet("switch", flag.ExitOnError)
+	platform := platformFlag(fs)
+	name, err := requireName(parseArgs(fs, args), "switch")
+	if err != nil {
+		return err
+	}
+	p, err := c.findProvider(*platform, name)
+	if err != nil {
+		return err
+	}
+	if err := c.request(http.MethodPost, providerPath(*platform, p.ID, "/switch"), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Switched %s to %s\n", *platform, p.Name)
+	return nil
+}
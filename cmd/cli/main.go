@@ -0,0 +1,103 @@
+// Ailurus CLI - manage a running relay / gateway from the terminal through its admin API (/admin/api)
+//
+// Build: go build -o ailurus ./cmd/cli
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const usage = `Usage: ailurus [--url URL] [--token TOKEN] <command> [options]
+
+Commands:
+  providers list [-p platform]                  List providers (API keys masked)
+  providers add -p platform --name NAME --api-url URL [--api-key KEY] [--level N]
+  providers enable <name> [-p platform]         Enable a provider
+  providers disable <name> [-p platform]        Disable a provider
+  logs tail [--errors] [-p platform] [--provider NAME] [--model PATTERN]
+  stats [today|week|month|all]                  Request / token / cost summary
+  test-provider <name> [-p platform]            Check the provider's URL and credentials
+  switch <name> [-p platform]                   Make the provider the preferred one
+
+Platforms: claude (default), codex, gemini-cli, picoclaw
+
+Environment:
+  AILURUS_URL     relay address (default http://127.0.0.1:18100)
+  AILURUS_TOKEN   admin token (ADMIN_TOKEN of the gateway); not needed on localhost without a token
+`
+
+func main() {
+	global := flag.NewFlagSet("ailurus", flag.ExitOnError)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	baseURL := global.String("url", getEnv("AILURUS_URL", "http://127.0.0.1:18100"), "relay address")
+	token := global.String("token", getEnv("AILURUS_TOKEN", os.Getenv("ADMIN_TOKEN")), "admin token")
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	client := newClient(*baseURL, *token)
+	var err error
+	switch args[0] {
+	case "providers":
+		err = runProviders(client, args[1:])
+	case "logs":
+		err = runLogs(client, args[1:])
+	case "stats":
+		err = runStats(client, args[1:])
+	case "test-provider":
+		err = runTestProvider(client, args[1:])
+	case "switch":
+		err = runSwitch(client, args[1:])
+	case "help", "-h", "--help":
+		global.Usage()
+	default:
+		err = fmt.Errorf("unknown command %q (see ailurus help)", args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses flags that may appear before or after positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// platformFlag registers -p / --platform
+func platformFlag(fs *flag.FlagSet) *string {
+	platform := fs.String("platform", "claude", "platform: claude, codex, gemini-cli, picoclaw")
+	fs.StringVar(platform, "p", "claude", "shorthand for --platform")
+	return platform
+}
+
+// requireName returns the single positional argument
+func requireName(positional []string, command string) (string, error) {
+	if len(positional) != 1 || strings.TrimSpace(positional[0]) == "" {
+		return "", fmt.Errorf("usage: ailurus %s <name> [-p platform]", command)
+	}
+	return positional[0], nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// dashboardAssets 内置 Web 控制台（纯静态页面，通过 /admin/api 读取数据）
+//
+//go:embed dashboard
+var dashboardAssets embed.FS
+
+func dashboardFS() fs.FS {
+	sub, err := fs.Sub(dashboardAssets, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,339 @@
+// Code Switch Gateway dashboard: reads everything from /admin/api with the admin token.
+(function () {
+  'use strict'
+
+  const API = '/admin/api'
+  const TOKEN_KEY = 'codeswitch.adminToken'
+  const LIVE_LIMIT = 200
+
+  const $ = (id) => document.getElementById(id)
+  let token = localStorage.getItem(TOKEN_KEY) || ''
+  let activeTab = 'status'
+  let logsPage = 1
+  let liveAbort = null
+
+  function showError(message) {
+    const el = $('error')
+    el.textContent = message || ''
+    el.hidden = !message
+  }
+
+  async function api(path, options = {}) {
+    const headers = Object.assign({ 'Content-Type': 'application/json' }, options.headers || {})
+    if (token) headers.Authorization = 'Bearer ' + token
+    const resp = await fetch(API + path, Object.assign({}, options, { headers }))
+    if (resp.status === 401) throw new Error('Unauthorized: check the admin token')
+    if (resp.status === 204) return null
+    const data = await resp.json().catch(() => ({}))
+    if (!resp.ok) throw new Error(data.error || resp.statusText)
+    return data
+  }
+
+  function escapeHtml(value) {
+    return String(value == null ? '' : value).replace(/[&<>"']/g, (ch) => ({
+      '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'
+    })[ch])
+  }
+
+  function formatNumber(value) {
+    return Number(value || 0).toLocaleString()
+  }
+
+  function formatBytes(value) {
+    let n = Number(value || 0)
+    const units = ['B', 'KB', 'MB', 'GB', 'TB']
+    let i = 0
+    while (n >= 1024 && i < units.length - 1) {
+      n /= 1024
+      i++
+    }
+    return (i === 0 ? n : n.toFixed(1)) + ' ' + units[i]
+  }
+
+  function formatDuration(sec) {
+    sec = Math.floor(sec || 0)
+    const d = Math.floor(sec / 86400)
+    const h = Math.floor((sec % 86400) / 3600)
+    const m = Math.floor((sec % 3600) / 60)
+    return d > 0 ? `${d}d ${h}h` : h > 0 ? `${h}h ${m}m` : `${m}m ${sec % 60}s`
+  }
+
+  function statusBadge(code, errorType) {
+    const cls = code >= 500 || errorType ? 'err' : code >= 400 ? 'warn' : 'ok'
+    return `<span class="badge ${cls}">${escapeHtml(code || errorType || '-')}</span>`
+  }
+
+  function logRow(log) {
+    const tokens = (log.input_tokens || 0) + (log.output_tokens || 0)
+    return `<tr>
+      <td>${escapeHtml(log.created_at || new Date().toLocaleTimeString())}</td>
+      <td>${escapeHtml(log.platform)}</td>
+      <td>${escapeHtml(log.provider)}</td>
+      <td>${escapeHtml(log.model)}</td>
+      <td>${statusBadge(log.http_code, log.error_type)}</td>
+      <td>${formatNumber(tokens)}</td>
+      <td>${Number(log.duration_sec || 0).toFixed(2)}s</td>
+      <td>$${Number(log.total_cost || 0).toFixed(4)}</td>
+    </tr>`
+  }
+
+  // ---- Status ----
+  async function loadStatus() {
+    const [status, metrics] = await Promise.all([api('/status'), api('/metrics?period=today')])
+    $('version').textContent = 'v' + status.version
+    $('m-uptime').textContent = formatDuration(status.uptime_sec)
+    $('m-requests').textContent = formatNumber(metrics.total_requests)
+    $('m-tokens').textContent = formatNumber(metrics.total_tokens)
+    $('m-cost').textContent = '$' + Number(metrics.total_cost || 0).toFixed(2)
+    $('m-success').textContent = Number(metrics.success_rate || 0).toFixed(1) + '%'
+    $('m-duration').textContent = Number(metrics.avg_duration_sec || 0).toFixed(2) + 's'
+    $('m-transfer').textContent = formatBytes(metrics.request_bytes) + ' / ' + formatBytes(metrics.response_bytes)
+    $('m-transfer').title = 'sent / received (upstream request and response bodies)'
+
+    $('status-rows').innerHTML = status.providers.map((p) => {
+      let state = '<span class="badge ok">ready</span>'
+      if (p.suspended) state = `<span class="badge err" title="${escapeHtml(p.suspendedReason)}">suspended</span>`
+      else if (!p.enabled) state = '<span class="badge">disabled</span>'
+      else if (p.cooldownSec > 0) state = `<span class="badge warn">cooldown ${p.cooldownSec}s</span>`
+      else if (!p.ready) state = '<span class="badge warn">not configured</span>'
+      const rl = p.rateLimit ? `${formatNumber(p.rateLimit.requestsRemaining)} / ${formatNumber(p.rateLimit.requestsLimit)} req` : '<span class="muted">-</span>'
+      const action = p.suspended ? 'resume' : 'suspend'
+      return `<tr>
+        <td>${escapeHtml(p.platform)}</td>
+        <td>${escapeHtml(p.name)}</td>
+        <td class="url">${escapeHtml(p.apiUrl)}</td>
+        <td>${state}</td>
+        <td>${rl}</td>
+        <td><button data-action="${action}" data-platform="${escapeHtml(p.platform)}" data-id="${p.id}">${action}</button></td>
+      </tr>`
+    }).join('')
+  }
+
+  $('status-rows').addEventListener('click', async (event) => {
+    const btn = event.target.closest('button[data-action]')
+    if (!btn) return
+    try {
+      await api(`/providers/${btn.dataset.platform}/${btn.dataset.id}/${btn.dataset.action}`, { method: 'POST' })
+      await loadStatus()
+    } catch (err) {
+      showError(err.message)
+    }
+  })
+
+  // ---- Live tail (NDJSON stream; EventSource cannot send the Authorization header) ----
+  async function startLive() {
+    stopLive()
+    const params = new URLSearchParams()
+    if ($('live-platform').value) params.set('platform', $('live-platform').value)
+    if ($('live-errors').checked) params.set('errors_only', 'true')
+    liveAbort = new AbortController()
+    $('live-toggle').textContent = 'Stop'
+    try {
+      const resp = await fetch(`${API}/logs/tail?${params}`, {
+        headers: token ? { Authorization: 'Bearer ' + token } : {},
+        signal: liveAbort.signal
+      })
+      if (!resp.ok) throw new Error(resp.status === 401 ? 'Unauthorized: check the admin token' : resp.statusText)
+      const reader = resp.body.getReader()
+      const decoder = new TextDecoder()
+      let buffer = ''
+      for (;;) {
+        const { value, done } = await reader.read()
+        if (done) break
+        buffer += decoder.decode(value, { stream: true })
+        let idx
+        while ((idx = buffer.indexOf('\n')) >= 0) {
+          const line = buffer.slice(0, idx).trim()
+          buffer = buffer.slice(idx + 1)
+          if (!line) continue
+          const rows = $('live-rows')
+          rows.insertAdjacentHTML('afterbegin', logRow(JSON.parse(line)))
+          while (rows.children.length > LIVE_LIMIT) rows.removeChild(rows.lastChild)
+        }
+      }
+    } catch (err) {
+      if (err.name !== 'AbortError') showError(err.message)
+    } finally {
+      $('live-toggle').textContent = 'Start'
+      liveAbort = null
+    }
+  }
+
+  function stopLive() {
+    if (liveAbort) liveAbort.abort()
+  }
+
+  $('live-toggle').addEventListener('click', () => (liveAbort ? stopLive() : startLive()))
+  $('live-clear').addEventListener('click', () => { $('live-rows').innerHTML = '' })
+
+  // ---- Log search ----
+  async function loadLogs() {
+    const params = new URLSearchParams()
+    for (const [key, value] of new FormData($('logs-form'))) {
+      if (value) params.set(key, value)
+    }
+    params.set('page', logsPage)
+    params.set('page_size', 50)
+    const result = await api('/logs?' + params)
+    $('logs-rows').innerHTML = (result.logs || []).map(logRow).join('')
+    $('logs-page').textContent = `${result.page} / ${Math.max(result.total_pages, 1)} (${formatNumber(result.total)})`
+    $('logs-prev').disabled = result.page <= 1
+    $('logs-next').disabled = result.page >= result.total_pages
+  }
+
+  $('logs-form').addEventListener('submit', (event) => {
+    event.preventDefault()
+    logsPage = 1
+    loadLogs().catch((err) => showError(err.message))
+  })
+  $('logs-prev').addEventListener('click', () => { logsPage--; loadLogs().catch((err) => showError(err.message)) })
+  $('logs-next').addEventListener('click', () => { logsPage++; loadLogs().catch((err) => showError(err.message)) })
+
+  // ---- Providers ----
+  let providers = []
+
+  async function loadProviders() {
+    const result = await api('/providers/' + $('providers-platform').value)
+    providers = result.providers || []
+    $('providers-rows').innerHTML = providers.map((p) => `<tr>
+      <td>${p.id}</td>
+      <td>${escapeHtml(p.name)}</td>
+      <td class="url">${escapeHtml(p.apiUrl)}</td>
+      <td><code>${escapeHtml(p.apiKey)}</code></td>
+      <td>${p.level || 1}</td>
+      <td>${p.enabled ? '<span class="badge ok">on</span>' : '<span class="badge">off</span>'}</td>
+      <td>
+        <button data-edit="${p.id}">Edit</button>
+        <button data-delete="${p.id}">Delete</button>
+      </td>
+    </tr>`).join('')
+  }
+
+  function openProviderForm(provider) {
+    const form = $('provider-form')
+    form.hidden = false
+    $('provider-form-title').textContent = provider ? 'Edit ' + provider.name : 'New provider'
+    form.elements.id.value = provider ? provider.id : ''
+    form.elements.name.value = provider ? provider.name : ''
+    form.elements.name.disabled = !!provider
+    form.elements.apiUrl.value = provider ? provider.apiUrl : ''
+    form.elements.apiKey.value = provider ? provider.apiKey : ''
+    form.elements.level.value = provider && provider.level ? provider.level : ''
+    form.elements.enabled.checked = provider ? provider.enabled : true
+  }
+
+  $('providers-platform').addEventListener('change', () => loadProviders().catch((err) => showError(err.message)))
+  $('providers-new').addEventListener('click', () => openProviderForm(null))
+  $('provider-cancel').addEventListener('click', () => { $('provider-form').hidden = true })
+
+  $('providers-rows').addEventListener('click', async (event) => {
+    const edit = event.target.closest('button[data-edit]')
+    const del = event.target.closest('button[data-delete]')
+    if (edit) {
+      openProviderForm(providers.find((p) => String(p.id) === edit.dataset.edit))
+      return
+    }
+    if (del && confirm('Delete this provider?')) {
+      try {
+        await api(`/providers/${$('providers-platform').value}/${del.dataset.delete}`, { method: 'DELETE' })
+        await loadProviders()
+      } catch (err) {
+        showError(err.message)
+      }
+    }
+  })
+
+  $('provider-form').addEventListener('submit', async (event) => {
+    event.preventDefault()
+    const form = event.target
+    const id = form.elements.id.value
+    // keep fields the form does not show (model mapping, extra headers, ...)
+    const base = id ? Object.assign({}, providers.find((p) => String(p.id) === id)) : {}
+    const payload = Object.assign(base, {
+      name: form.elements.name.value.trim(),
+      apiUrl: form.elements.apiUrl.value.trim(),
+      apiKey: form.elements.apiKey.value.trim(),
+      level: Number(form.elements.level.value) || 0,
+      enabled: form.elements.enabled.checked
+    })
+    const platform = $('providers-platform').value
+    try {
+      if (id) {
+        await api(`/providers/${platform}/${id}`, { method: 'PUT', body: JSON.stringify(payload) })
+      } else {
+        await api(`/providers/${platform}`, { method: 'POST', body: JSON.stringify(payload) })
+      }
+      form.hidden = true
+      await loadProviders()
+    } catch (err) {
+      showError(err.message)
+    }
+  })
+
+  // ---- Security events ----
+  async function loadSecurity() {
+    const [access, bans, result] = await Promise.all([api('/ip-access'), api('/security/bans'), api('/security/events?limit=200')])
+    const allow = (access.allowList || []).join(', ') || 'any'
+    const deny = (access.denyList || []).join(', ') || 'none'
+    $('ip-access-summary').textContent = `Allow: ${allow} · Deny: ${deny}`
+    $('ban-rows').innerHTML = (bans.bans || []).map((b) => `<tr>
+      <td>${escapeHtml(b.ip)}</td>
+      <td>${escapeHtml(b.reason)}</td>
+      <td>${b.strikes}</td>
+      <td>${escapeHtml(new Date(b.until).toLocaleString())}</td>
+      <td><button data-unban="${escapeHtml(b.ip)}">Unban</button></td>
+    </tr>`).join('')
+    $('security-rows').innerHTML = (result.events || []).map((e) => `<tr>
+      <td>${escapeHtml(e.created_at)}</td>
+      <td><span class="badge err">${escapeHtml(e.type)}</span></td>
+      <td>${escapeHtml(e.client_ip)}</td>
+      <td class="url">${escapeHtml(e.method)} ${escapeHtml(e.path)}</td>
+      <td class="url">${escapeHtml(e.user_agent)}</td>
+      <td>${escapeHtml(e.detail)}</td>
+    </tr>`).join('')
+  }
+
+  async function clearBans(ip) {
+    try {
+      await api('/security/bans' + (ip ? '/' + encodeURIComponent(ip) : ''), { method: 'DELETE' })
+      await loadSecurity()
+    } catch (err) {
+      showError(err.message)
+    }
+  }
+
+  $('ban-rows').addEventListener('click', (event) => {
+    const btn = event.target.closest('button[data-unban]')
+    if (btn) clearBans(btn.dataset.unban)
+  })
+  $('bans-clear-all').addEventListener('click', () => { if (confirm('Clear all bans?')) clearBans('') })
+
+  // ---- Tabs & refresh ----
+  function refresh() {
+    showError('')
+    const loaders = { status: loadStatus, logs: loadLogs, providers: loadProviders, security: loadSecurity }
+    const loader = loaders[activeTab]
+    if (loader) loader().catch((err) => showError(err.message))
+  }
+
+  document.querySelectorAll('nav button').forEach((btn) => {
+    btn.addEventListener('click', () => {
+      activeTab = btn.dataset.tab
+      document.querySelectorAll('nav button').forEach((b) => b.classList.toggle('active', b === btn))
+      document.querySelectorAll('section').forEach((s) => { s.hidden = s.id !== 'tab-' + activeTab })
+      if (activeTab !== 'live') stopLive()
+      refresh()
+    })
+  })
+
+  $('token').value = token
+  $('token-form').addEventListener('submit', (event) => {
+    event.preventDefault()
+    token = $('token').value.trim()
+    localStorage.setItem(TOKEN_KEY, token)
+    refresh()
+  })
+
+  setInterval(() => { if (activeTab === 'status') refresh() }, 5000)
+  refresh()
+})()
@@ -5,27 +5,80 @@ package main
 import (
 	"codeswitch/services"
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
 func main() {
+	doctor := flag.Bool("doctor", false, "check the environment (port, database, config, providers, disk, clock) and exit")
+	migrate := flag.String("migrate", "", "run a schema migration command (status, up, down) against ~/.code-switch/app.db and exit")
+	migrateSteps := flag.Int("migrate-steps", 1, "number of migrations to roll back with -migrate down")
+	migrateDryRun := flag.Bool("dry-run", false, "with -migrate up/down, print the pending migrations without applying them")
+	flag.Parse()
+
+	// Schema migration commands run before any service opens (and auto-migrates) the database
+	if *migrate != "" {
+		os.Exit(runMigrate(*migrate, *migrateSteps, *migrateDryRun))
+	}
+
 	// Get configuration from environment
 	port := getEnv("GATEWAY_PORT", "18100")
 	newAPIEnabled := getEnv("NEW_API_ENABLED", "false") == "true"
 	newAPIURL := getEnv("NEW_API_URL", "")
 	newAPIToken := getEnv("NEW_API_TOKEN", "")
 	enableBodyLog := getEnv("ENABLE_BODY_LOG", "false") == "true"
+	maxBodyMB, _ := strconv.Atoi(getEnv("MAX_REQUEST_BODY_MB", "0"))
+	providerEventWebhook := getEnv("PROVIDER_EVENT_WEBHOOK", "")
+	stickyRetrySec, _ := strconv.Atoi(getEnv("STICKY_RETRY_MAX_WAIT_SEC", "0"))
+	configPath := getEnv("GATEWAY_CONFIG", "")
+	readOnly := getEnv("GATEWAY_READ_ONLY", "false") == "true"
 
 	log.Printf("[Gateway] Starting AI Provider Gateway Service")
 	log.Printf("[Gateway] Port: %s", port)
 	log.Printf("[Gateway] NEW-API Enabled: %v", newAPIEnabled)
 
+	// Read-only mode never writes to the home directory (request logs are kept in memory)
+	services.SetReadOnlyMode(readOnly)
+	if readOnly {
+		log.Printf("[Gateway] Read-only mode enabled")
+		if configPath == "" {
+			log.Fatalf("[Gateway] GATEWAY_READ_ONLY requires GATEWAY_CONFIG")
+		}
+	}
+
+	// Rebuild a corrupted database (e.g. after power loss) before anything opens it
+	if !readOnly {
+		home, _ := os.UserHomeDir()
+		services.CheckDatabaseIntegrity(filepath.Join(home, ".code-switch", "app.db"))
+	}
+
 	// Initialize services
 	providerService := services.NewProviderService()
+
+	// Provider API keys referenced by vault entry ID (apiKeyRef)
+	if !readOnly {
+		if vault, err := services.NewSuiStore(); err != nil {
+			log.Printf("[Gateway] Vault unavailable, apiKeyRef entries will not resolve: %v", err)
+		} else {
+			providerService.SetSecretVault(vault)
+		}
+	}
+
+	// Declarative provider config (providers.yaml / providers.json) instead of ~/.code-switch
+	if configPath != "" {
+		if err := loadGatewayConfig(providerService, configPath); err != nil {
+			log.Fatalf("[Gateway] Failed to load %s: %v", configPath, err)
+		}
+	}
+
 	providerRelay := services.NewProviderRelayService(providerService, ":"+port)
 
 	// Configure options
@@ -34,6 +87,141 @@ func main() {
 		log.Printf("[Gateway] Body logging enabled")
 	}
 
+	providerRelay.SetMaxRequestBodySize(int64(maxBodyMB) << 20)
+	log.Printf("[Gateway] Max request body: %d MB", providerRelay.MaxRequestBodySize()>>20)
+
+	// Provider suspend/resume notifications
+	providerRelay.SetProviderEventWebhook(providerEventWebhook)
+
+	// Live tail of request logs at /v1/logs/tail (localhost only unless a token is set)
+	providerRelay.SetLogTailToken(getEnv("LOG_TAIL_TOKEN", ""))
+
+	// Admin API at /admin/api (localhost only unless a token is set) and optional web dashboard at /dashboard
+	providerRelay.SetAdminToken(getEnv("ADMIN_TOKEN", ""))
+	if getEnv("DASHBOARD_ENABLED", "false") == "true" {
+		providerRelay.SetDashboardFS(dashboardFS())
+		log.Printf("[Gateway] Web dashboard enabled at /dashboard")
+	}
+
+	// Share round-robin counters, cooldowns, rate limits, circuit states and sticky routes across replicas
+	var sharedState *services.RedisSharedState
+	if redisURL := getEnv("REDIS_URL", ""); redisURL != "" {
+		store, err := services.NewRedisSharedState(redisURL, getEnv("REDIS_KEY_PREFIX", services.DefaultSharedStatePrefix))
+		if err != nil {
+			log.Fatalf("[Gateway] %v", err)
+		}
+		sharedState = store
+		providerRelay.SetSharedStateStore(store)
+		log.Printf("[Gateway] Shared state enabled (Redis)")
+	}
+
+	// Wait and retry the same provider on 429/529 instead of failing over
+	providerRelay.SetStickyRetryMaxWait(time.Duration(stickyRetrySec) * time.Second)
+
+	// Keep consuming streams carrying an Idempotency-Key for this long after the client disconnects,
+	// so a reconnect with the same key resumes delivery (0 = cancel the upstream request immediately)
+	providerRelay.SetStreamResumeWindow(time.Duration(getEnvInt("STREAM_RESUME_SEC")) * time.Second)
+
+	// Public read-only status page at /status and /status.json: uptime, error rate and provider availability, no costs or prompts
+	providerRelay.SetPublicStatusPage(getEnv("STATUS_PAGE_ENABLED", "false") == "true")
+
+	// Record a per-phase latency breakdown for requests slower than this (0 = profiler off), see /admin/api/slow-requests
+	providerRelay.SetSlowRequestThreshold(time.Duration(getEnvInt("SLOW_REQUEST_THRESHOLD_MS")) * time.Millisecond)
+
+	// Maximum number of requests /v1/batch runs at once (0 = default 4); a batch may ask for fewer
+	providerRelay.SetBatchConcurrency(getEnvInt("BATCH_CONCURRENCY"))
+
+	// What to do when the log queues are full: drop (default), block (bounded wait) or spool (disk, replayed later)
+	providerRelay.SetLogOverflowPolicy(services.LogOverflowPolicy{
+		Mode:      getEnv("LOG_OVERFLOW_POLICY", services.LogOverflowDrop),
+		MaxWaitMs: getEnvInt("LOG_OVERFLOW_MAX_WAIT_MS"),
+	})
+
+	// Time zone for "today" and hourly/daily statistics buckets (IANA name, default: server local time)
+	if err := services.SetStatsTimezone(os.Getenv("STATS_TIMEZONE")); err != nil {
+		log.Fatalf("[Gateway] %v", err)
+	}
+
+	// Upstream timeouts (seconds, 0 = default); providers may override them
+	providerRelay.SetTimeoutSettings(services.TimeoutSettings{
+		ConnectSec:     getEnvInt("UPSTREAM_CONNECT_TIMEOUT_SEC"),
+		ReadSec:        getEnvInt("UPSTREAM_READ_TIMEOUT_SEC"),
+		TotalSec:       getEnvInt("UPSTREAM_TIMEOUT_SEC"),
+		StreamTotalSec: getEnvInt("UPSTREAM_STREAM_TIMEOUT_SEC"),
+		MaxClientSec:   getEnvInt("MAX_CLIENT_TIMEOUT_SEC"),
+	})
+
+	// Inbound IP allow/deny lists (CIDR or single IP); denied attempts appear under /admin/api/security/events
+	err := providerRelay.SetIPAccessConfig(services.IPAccessConfig{
+		AllowList:      splitEnvList("IP_ALLOW_LIST"),
+		DenyList:       splitEnvList("IP_DENY_LIST"),
+		TrustedProxies: splitEnvList("TRUSTED_PROXIES"),
+	})
+	if err != nil {
+		log.Fatalf("[Gateway] IP access: %v", err)
+	}
+
+	// Per-IP abuse protection: requests per minute, concurrent requests (streams included) and
+	// temporary bans after repeated auth failures or limit hits; bans are listed at /admin/api/security/bans
+	err = providerRelay.SetAbuseConfig(services.AbuseConfig{
+		RequestsPerMinute: getEnvInt("ABUSE_REQUESTS_PER_MINUTE"),
+		MaxConcurrent:     getEnvInt("ABUSE_MAX_CONCURRENT"),
+		BanAfterStrikes:   getEnvInt("ABUSE_BAN_AFTER_STRIKES"),
+		BanDurationSec:    getEnvInt("ABUSE_BAN_DURATION_SEC"),
+	})
+	if err != nil {
+		log.Fatalf("[Gateway] abuse protection: %v", err)
+	}
+
+	// HTTPS listener with optional client certificate auth (mTLS); TLS_CLIENT_AUTH is off, optional or require.
+	// Certificate CN/SAN becomes the user identity for request logs, per-identity limits and admin access
+	err = providerRelay.SetMTLSConfig(services.MTLSConfig{
+		CertFile:          getEnv("TLS_CERT_FILE", ""),
+		KeyFile:           getEnv("TLS_KEY_FILE", ""),
+		ClientCAFile:      getEnv("TLS_CLIENT_CA_FILE", ""),
+		ClientAuth:        getEnv("TLS_CLIENT_AUTH", services.MTLSClientAuthOff),
+		IdentityMap:       splitEnvMap("TLS_IDENTITY_MAP"),
+		AdminIdentities:   splitEnvList("TLS_ADMIN_IDENTITIES"),
+		RequestsPerMinute: getEnvInt("TLS_IDENTITY_REQUESTS_PER_MINUTE"),
+	})
+	if err != nil {
+		log.Fatalf("[Gateway] TLS: %v", err)
+	}
+	if cfg := providerRelay.GetMTLSConfig(); cfg.CertFile != "" {
+		log.Printf("[Gateway] TLS enabled, client certificate auth: %s", cfg.ClientAuth)
+	}
+
+	// CORS for browser clients (web playgrounds, extensions); disabled unless origins are set
+	if origins := splitEnvList("CORS_ALLOWED_ORIGINS"); len(origins) > 0 {
+		err := providerRelay.SetCORSConfig(services.CORSConfig{
+			Enabled:          true,
+			AllowedOrigins:   origins,
+			AllowedHeaders:   splitEnvList("CORS_ALLOWED_HEADERS"),
+			AllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		})
+		if err != nil {
+			log.Fatalf("[Gateway] CORS: %v", err)
+		}
+		log.Printf("[Gateway] CORS enabled for %s", strings.Join(origins, ", "))
+	}
+
+	// Chaos mode for resilience testing (debug only): fake upstream at /__chaos
+	if rate, err := strconv.ParseFloat(getEnv("CHAOS_FAULT_RATE", "0"), 64); err == nil && rate > 0 {
+		providerRelay.SetChaosConfig(services.ChaosConfig{
+			Enabled:       true,
+			FaultRate:     rate,
+			LatencyMinMs:  500,
+			LatencyMaxMs:  5000,
+			RetryAfterSec: 1,
+		})
+		log.Printf("[Gateway] Chaos mode enabled (fault rate %.2f), upstream: %s", rate, providerRelay.ChaosProvider().APIURL)
+	}
+
+	// OAuth subscription tokens (logged in via the desktop app); refreshing them writes to the home directory
+	if !readOnly {
+		providerRelay.SetOAuthService(services.NewOAuthService())
+	}
+
 	// Configure NEW-API mode
 	if newAPIEnabled && newAPIURL != "" && newAPIToken != "" {
 		providerRelay.SetNewAPIConfig(newAPIURL, newAPIToken)
@@ -42,13 +230,30 @@ func main() {
 	}
 
 	// Initialize sync integration (optional)
-	syncSettingsService := services.NewSyncSettingsService()
-	services.InitSyncIntegration(syncSettingsService)
-	if si := services.GetSyncIntegration(); si != nil {
-		providerRelay.SetSyncIntegration(si)
-		if si.IsEnabled() {
-			log.Printf("[Gateway] Multi-device sync enabled")
+	var syncSettingsService *services.SyncSettingsService
+	if !readOnly {
+		syncSettingsService = services.NewSyncSettingsService()
+		services.InitSyncIntegration(syncSettingsService)
+		services.RegisterSyncAppliers(syncSettingsService, providerService, nil)
+		if si := services.GetSyncIntegration(); si != nil {
+			providerRelay.SetSyncIntegration(si)
+			if si.IsEnabled() {
+				log.Printf("[Gateway] Multi-device sync enabled")
+			}
+		}
+	}
+
+	// gRPC management / log streaming API (same admin token as /admin/api), disabled unless a port is set
+	if grpcPort := getEnv("GRPC_PORT", ""); grpcPort != "" {
+		if err := providerRelay.StartGRPC(":" + grpcPort); err != nil {
+			log.Fatalf("[Gateway] Failed to start gRPC server: %v", err)
 		}
+		log.Printf("[Gateway] gRPC API enabled on port %s", grpcPort)
+	}
+
+	// Self-diagnostics: print the report and exit non-zero when a check fails
+	if *doctor {
+		os.Exit(runDoctor(providerRelay))
 	}
 
 	// Run data migrations
@@ -63,10 +268,27 @@ func main() {
 
 	log.Printf("[Gateway] Service started on port %s", port)
 
-	// Wait for shutdown signal
+	// Wait for shutdown signal; SIGHUP reloads the provider config file
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case <-quit:
+			break wait
+		case <-reload:
+			if configPath == "" {
+				log.Printf("[Gateway] SIGHUP ignored: GATEWAY_CONFIG is not set")
+				continue
+			}
+			// Keep serving the previous providers when the new file is invalid
+			if err := loadGatewayConfig(providerService, configPath); err != nil {
+				log.Printf("[Gateway] Reload failed, keeping previous config: %v", err)
+			}
+		}
+	}
 
 	log.Printf("[Gateway] Shutting down...")
 
@@ -78,17 +300,140 @@ func main() {
 		log.Printf("[Gateway] Error stopping relay: %v", err)
 	}
 
-	if err := syncSettingsService.ServiceShutdown(); err != nil {
-		log.Printf("[Gateway] Error stopping sync: %v", err)
+	if syncSettingsService != nil {
+		if err := syncSettingsService.ServiceShutdown(); err != nil {
+			log.Printf("[Gateway] Error stopping sync: %v", err)
+		}
+	}
+
+	if sharedState != nil {
+		if err := sharedState.Close(); err != nil {
+			log.Printf("[Gateway] Error closing Redis: %v", err)
+		}
 	}
 
 	<-ctx.Done()
 	log.Printf("[Gateway] Service stopped")
 }
 
+// loadGatewayConfig reads the declarative provider file and swaps it in atomically
+func loadGatewayConfig(providerService *services.ProviderService, path string) error {
+	cfg, err := services.LoadGatewayConfig(path)
+	if err != nil {
+		return err
+	}
+	providerService.UseStaticProviders(cfg.Providers)
+	total := 0
+	for _, list := range cfg.Providers {
+		total += len(list)
+	}
+	log.Printf("[Gateway] Loaded %d providers from %s", total, path)
+	return nil
+}
+
+// runDoctor prints the environment report and returns the process exit code
+func runDoctor(providerRelay *services.ProviderRelayService) int {
+	report := providerRelay.Doctor()
+	for _, check := range report.Checks {
+		fmt.Printf("%-6s %-12s %s\n", "["+strings.ToUpper(check.Status)+"]", check.Name, check.Message)
+		for _, detail := range check.Details {
+			fmt.Printf("%20s- %s\n", "", detail)
+		}
+		if check.Fix != "" {
+			fmt.Printf("%20sfix: %s\n", "", check.Fix)
+		}
+	}
+	fmt.Printf("\nOverall: %s\n", strings.ToUpper(report.Status))
+	if report.Status == services.DoctorFail {
+		return 1
+	}
+	return 0
+}
+
+// runMigrate prints the schema migration status or applies / rolls back migrations, returning the exit code
+func runMigrate(action string, steps int, dryRun bool) int {
+	db, err := services.OpenAppDatabase()
+	if err != nil {
+		log.Printf("[Gateway] Failed to open database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	var report services.MigrationReport
+	switch action {
+	case "status":
+		statuses, err := services.SchemaMigrationStatuses(db)
+		if err != nil {
+			log.Printf("[Gateway] Failed to read schema version: %v", err)
+			return 1
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Unknown {
+				state = "unknown"
+			} else if status.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d  %-20s %-8s %s\n", status.Version, status.Name, state, status.AppliedAt)
+		}
+		return 0
+	case "up":
+		report, err = services.MigrateSchema(db, services.MigrateOptions{DryRun: dryRun})
+	case "down":
+		report, err = services.RollbackSchema(db, steps, dryRun)
+	default:
+		log.Printf("[Gateway] Unknown -migrate command %q (expected status, up or down)", action)
+		return 2
+	}
+
+	prefix := ""
+	if report.DryRun {
+		prefix = "[DRY-RUN] would "
+	}
+	for _, step := range report.Steps {
+		fmt.Printf("%s%s %04d_%s\n", prefix, step.Direction, step.Version, step.Name)
+		if report.DryRun && step.SQL != "" {
+			fmt.Println(step.SQL)
+		}
+	}
+	if err != nil {
+		log.Printf("[Gateway] Migration failed: %v", err)
+		return 1
+	}
+	fmt.Printf("Schema version: %d\n", report.Version)
+	return 0
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// splitEnvList reads a comma-separated list, skipping empty entries
+func splitEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// splitEnvMap reads comma-separated key=value pairs, e.g. "CN=alice,ops@example.com=ops"
+func splitEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range splitEnvList(key) {
+		if k, v, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(k) != "" {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
+
+func getEnvInt(key string) int {
+	value, _ := strconv.Atoi(getEnv(key, "0"))
+	return value
+}
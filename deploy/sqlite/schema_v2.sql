@@ -91,6 +91,7 @@ CREATE TABLE IF NOT EXISTS proxy_control (
     proxy_mode TEXT DEFAULT 'shared', -- 'shared' (18100), 'dedicated' (独立端口)
     proxy_port INTEGER,               -- dedicated 模式的端口
     intercept_domains TEXT,           -- JSON array: ["api.anthropic.com", ...]
+    rules TEXT,                       -- JSON: 允许模型、时间窗口、每日花费上限、路径黑白名单
 
     -- 统计
     total_requests INTEGER DEFAULT 0,
@@ -108,6 +109,30 @@ INSERT OR IGNORE INTO proxy_control (app_name, proxy_enabled) VALUES
     ('gemini', 1),
     ('picoclaw', 1);
 
+-- 规则命中统计（按应用 + 规则计数被拦截的请求）
+CREATE TABLE IF NOT EXISTS proxy_rule_hits (
+    app_name TEXT NOT NULL,
+    rule TEXT NOT NULL,               -- 'model_not_allowed', 'outside_time_window', 'daily_cost_exceeded', ...
+    hits INTEGER DEFAULT 0,
+    last_hit_at DATETIME,
+    PRIMARY KEY (app_name, rule)
+);
+
+-- 出站内容策略违规记录（只记录规则名与次数，不含命中内容）
+CREATE TABLE IF NOT EXISTS guardrail_violations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_name TEXT,
+    platform TEXT,
+    model TEXT,
+    request_path TEXT,
+    client_ip TEXT,
+    action TEXT,                      -- 'warn', 'redact', 'block'
+    patterns TEXT,                    -- 命中的规则名，逗号分隔
+    matches INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_guardrail_violations_app ON guardrail_violations(app_name, created_at);
+
 -- ============================================================
 -- 4. Proxy Live Backup (配置热备份)
 -- ============================================================
@@ -3,6 +3,8 @@ export type AutomationCard = {
   name: string
   apiUrl: string
   apiKey: string
+  // 保险库条目 ID：设置后 apiKey 从保险库解析，配置文件不保存明文
+  apiKeyRef?: string
   officialSite: string
   icon: string
   tint: string
@@ -14,6 +16,62 @@ export type AutomationCard = {
   modelMapping?: Record<string, string>
   // 优先级分组：1-10，数字越小优先级越高
   level?: number
+  // 自定义请求头模板与固定请求体参数，支持 {{apiKey}} / {{model}} / {{provider}}
+  extraHeaders?: Record<string, string>
+  extraBody?: Record<string, unknown>
+  // 上游超时（秒），未设置的项使用全局配置
+  timeouts?: {
+    connectSec?: number
+    readSec?: number
+    totalSec?: number
+    streamTotalSec?: number
+  }
+  // 单次请求 token 上限，未设置的项使用平台默认值；onExceed: reject（默认）/ truncate
+  tokenLimits?: {
+    maxInputTokens?: number
+    maxOutputTokens?: number
+    onExceed?: 'reject' | 'truncate'
+  }
+  // 灰度：试用期内只接收 percent% 的流量，按错误率 / 耗时自动转正或停用
+  canary?: {
+    percent: number
+    startedAt?: number
+    durationMinutes?: number
+    minRequests?: number
+    maxErrorRateDelta?: number
+    maxLatencyRatio?: number
+  }
+  // 服务等级目标：延迟分位数目标与错误率上限，按滚动窗口计算错误预算，消耗过快时通知
+  slo?: {
+    latencySec?: number
+    latencyPercentile?: number
+    maxErrorRate?: number
+    windowDays?: number
+    burnRateAlert?: number
+  }
+  // JSON 模式保证：validate 校验输出并修复 / 重试，enforce 用于不支持 response_format 的 provider
+  jsonMode?: '' | 'validate' | 'enforce'
+  jsonModeRetries?: number
+  // 推理内容处理：passthrough 原样返回，strip 移除，tags 转换为正文中的 <thinking> 标签
+  reasoningPolicy?: '' | 'passthrough' | 'strip' | 'tags'
+  // 接口格式：openai 表示只提供 Chat Completions，anthropic 表示只提供 Messages，与客户端协议不同时自动转换
+  apiFormat?: '' | 'anthropic' | 'openai'
+  // 并发上限：超出时排队，interactive 请求优先于 batch，0 或未设置表示不限制
+  maxConcurrent?: number
+  // 能力声明：未设置的能力视为支持；图片超出限制时自动缩放并重新编码
+  capabilities?: {
+    vision?: boolean
+    tools?: boolean
+    jsonMode?: boolean
+    reasoning?: boolean
+    // 原生支持 /v1/completions，未设置时转换为 Chat 请求
+    completions?: boolean
+    maxImageBytes?: number
+    maxImageDimension?: number
+  }
+  // 网关因连续认证失败自动挂起（与手动禁用独立）
+  suspended?: boolean
+  suspendedReason?: string
 }
 
 export const automationCardGroups: Record<'claude' | 'codex' | 'gemini-cli' | 'picoclaw', AutomationCard[]> = {
@@ -9,6 +9,7 @@ import SyncPage from '../components/Sync/Index.vue'
 const routes = [
   { path: '/', component: MainPage },
   { path: '/logs', component: LogsPage },
+  { path: '/transcript/:id', component: () => import('../components/Logs/Transcript.vue') },
   { path: '/settings', component: GeneralPage },
   { path: '/mcp', component: McpPage },
   { path: '/skill', component: SkillPage },
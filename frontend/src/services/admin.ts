@@ -5,6 +5,29 @@
 
 import { syncServiceClient } from './sync'
 
+// ===== Common Types =====
+
+// 管理后台角色：viewer 只读，operator 可执行运维操作，admin 可管理角色
+export type AdminRole = '' | 'viewer' | 'operator' | 'admin'
+
+// 列表接口统一的分页与排序参数
+export interface ListParams {
+  page?: number
+  page_size?: number
+  sort?: string
+  order?: 'asc' | 'desc'
+}
+
+function toQuery(params?: object): URLSearchParams {
+  const query = new URLSearchParams()
+  Object.entries(params || {}).forEach(([key, value]) => {
+    if (value !== undefined && value !== '') {
+      query.set(key, String(value))
+    }
+  })
+  return query
+}
+
 // ===== User Management Types =====
 
 export interface AdminUser {
@@ -12,6 +35,7 @@ export interface AdminUser {
   username: string
   email?: string
   is_admin: boolean
+  role?: AdminRole
   is_disabled: boolean
   created_at: string
   last_login_at?: string
@@ -90,6 +114,7 @@ export interface SessionListResponse {
   total: number
   page: number
   page_size: number
+  total_pages: number
 }
 
 export interface SessionDetailResponse {
@@ -121,6 +146,7 @@ export interface AuditLogListResponse {
   total: number
   page: number
   page_size: number
+  total_pages: number
 }
 
 // ===== Alert Types =====
@@ -162,25 +188,21 @@ export interface AlertRuleListResponse {
 }
 
 export interface AlertHistoryListResponse {
-  alerts: AlertHistory[]
+  history: AlertHistory[]
   total: number
+  page: number
+  page_size: number
+  total_pages: number
 }
 
 // ===== User Management API =====
 
-export async function listUsers(params?: {
-  page?: number
-  page_size?: number
+export async function listUsers(params?: ListParams & {
   search?: string
   disabled?: boolean
+  role?: AdminRole
 }): Promise<UserListResponse> {
-  const query = new URLSearchParams()
-  if (params?.page) query.set('page', String(params.page))
-  if (params?.page_size) query.set('page_size', String(params.page_size))
-  if (params?.search) query.set('search', params.search)
-  if (params?.disabled !== undefined) query.set('disabled', String(params.disabled))
-
-  return syncServiceClient.fetch(`/api/v1/admin/users?${query}`)
+  return syncServiceClient.fetch(`/api/v1/admin/users?${toQuery(params)}`)
 }
 
 export async function getUser(userId: string): Promise<UserDetailResponse> {
@@ -202,21 +224,19 @@ export async function setUserAdmin(userId: string, isAdmin: boolean): Promise<{
   })
 }
 
+export async function setUserRole(userId: string, role: AdminRole): Promise<{ message: string; role: AdminRole }> {
+  return syncServiceClient.fetch(`/api/v1/admin/users/${userId}/role`, {
+    method: 'POST',
+    body: JSON.stringify({ role })
+  })
+}
+
 // ===== Session Management API =====
 
-export async function listSessions(params?: {
+export async function listSessions(params?: ListParams & {
   user_id?: string
-  status?: string
-  page?: number
-  page_size?: number
 }): Promise<SessionListResponse> {
-  const query = new URLSearchParams()
-  if (params?.user_id) query.set('user_id', params.user_id)
-  if (params?.status) query.set('status', params.status)
-  if (params?.page) query.set('page', String(params.page))
-  if (params?.page_size) query.set('page_size', String(params.page_size))
-
-  return syncServiceClient.fetch(`/api/v1/admin/sessions?${query}`)
+  return syncServiceClient.fetch(`/api/v1/admin/sessions?${toQuery(params)}`)
 }
 
 export async function getSessionDetail(sessionId: string): Promise<SessionDetailResponse> {
@@ -229,24 +249,15 @@ export async function deleteSession(sessionId: string): Promise<{ message: strin
 
 // ===== Audit Log API =====
 
-export async function listAuditLogs(params?: {
+export async function listAuditLogs(params?: ListParams & {
   user_id?: string
   action?: string
   resource_type?: string
   result?: string
   start_time?: string
   end_time?: string
-  page?: number
-  page_size?: number
 }): Promise<AuditLogListResponse> {
-  const query = new URLSearchParams()
-  Object.entries(params || {}).forEach(([key, value]) => {
-    if (value !== undefined && value !== '') {
-      query.set(key, String(value))
-    }
-  })
-
-  return syncServiceClient.fetch(`/api/v1/admin/audit-logs?${query}`)
+  return syncServiceClient.fetch(`/api/v1/admin/audit-logs?${toQuery(params)}`)
 }
 
 // ===== Alert Management API =====
@@ -273,21 +284,12 @@ export async function deleteAlertRule(ruleId: string): Promise<{ message: string
   return syncServiceClient.fetch(`/api/v1/admin/alert-rules/${ruleId}`, { method: 'DELETE' })
 }
 
-export async function listAlertHistory(params?: {
+export async function listAlertHistory(params?: ListParams & {
   rule_id?: string
   severity?: string
   status?: string
-  page?: number
-  page_size?: number
 }): Promise<AlertHistoryListResponse> {
-  const query = new URLSearchParams()
-  Object.entries(params || {}).forEach(([key, value]) => {
-    if (value !== undefined && value !== '') {
-      query.set(key, String(value))
-    }
-  })
-
-  return syncServiceClient.fetch(`/api/v1/admin/alert-history?${query}`)
+  return syncServiceClient.fetch(`/api/v1/admin/alert-history?${toQuery(params)}`)
 }
 
 // ===== Extend syncServiceClient with fetch method =====
@@ -130,6 +130,7 @@ export interface BillingConfig {
   // Lago
   lago_api_url: string
   lago_api_key: string
+  lago_webhook_secret: string
   // Payment
   alipay_app_id: string
   alipay_private_key: string
@@ -146,6 +147,12 @@ export interface BillingConfig {
   // Subscription
   grace_period_hours: number
   require_subscription: boolean
+  // Invoices
+  invoice_prefix: string
+  invoice_company_name: string
+  invoice_company_address: string
+  invoice_tax_id: string
+  invoice_tax_rate: number
 }
 
 export interface BillingStatus {
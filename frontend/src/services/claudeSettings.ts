@@ -26,3 +26,190 @@ export const enableProxy = async (platform: Platform): Promise<void> => {
 export const disableProxy = async (platform: Platform): Promise<void> => {
   await callByPlatform(platform, 'DisableProxy')
 }
+
+// Claude Code settings profiles (~/.claude/settings.json)
+export type ClaudePermissions = {
+  allow?: string[]
+  deny?: string[]
+  ask?: string[]
+  defaultMode?: string
+  additionalDirectories?: string[]
+}
+
+export type ClaudeSettingsProfile = {
+  name: string
+  description?: string
+  model?: string
+  env?: Record<string, string>
+  permissions?: ClaudePermissions
+  statusLine?: { type: string; command?: string; padding?: number }
+  extra?: Record<string, unknown>  // hooks 等其他 settings.json 字段
+  updated_at: number
+}
+
+export type ClaudeSettingsBackup = {
+  id: string
+  created_at: number
+  profile: string          // 覆盖该快照时应用的 profile
+  active_profile: string   // 快照时生效的 profile
+}
+
+export type ClaudeProfileList = {
+  active: string
+  profiles: ClaudeSettingsProfile[]
+  backups: ClaudeSettingsBackup[]
+}
+
+const claudeSettingsService = serviceNames.claude
+
+export const fetchClaudeProfiles = async (): Promise<ClaudeProfileList> => {
+  return Call.ByName(`${claudeSettingsService}.ListProfiles`)
+}
+
+export const saveClaudeProfile = async (profile: ClaudeSettingsProfile): Promise<void> => {
+  await Call.ByName(`${claudeSettingsService}.SaveProfile`, profile)
+}
+
+export const captureClaudeProfile = async (name: string, description = ''): Promise<ClaudeSettingsProfile> => {
+  return Call.ByName(`${claudeSettingsService}.CaptureProfile`, name, description)
+}
+
+export const applyClaudeProfile = async (name: string): Promise<void> => {
+  await Call.ByName(`${claudeSettingsService}.ApplyProfile`, name)
+}
+
+export const deleteClaudeProfile = async (name: string): Promise<void> => {
+  await Call.ByName(`${claudeSettingsService}.DeleteProfile`, name)
+}
+
+// id 为空时回滚到最近一次应用 profile 之前的 settings.json
+export const rollbackClaudeSettings = async (id = ''): Promise<void> => {
+  await Call.ByName(`${claudeSettingsService}.RollbackSettings`, id)
+}
+
+// Codex config.toml (~/.codex/config.toml)
+export type CodexSchema = 'legacy' | 'current'
+
+export type CodexProfile = {
+  model?: string
+  model_provider?: string
+  model_reasoning_effort?: string
+  approval_policy?: string
+  sandbox_mode?: string
+}
+
+export type CodexMCPServer = {
+  command?: string           // stdio 服务
+  args?: string[]
+  env?: Record<string, string>
+  url?: string               // streamable HTTP 服务，仅 current schema
+  bearer_token_env_var?: string
+  startup_timeout_sec?: number
+  tool_timeout_sec?: number
+  enabled?: boolean
+}
+
+export type CodexConfig = {
+  model?: string
+  model_provider?: string
+  model_reasoning_effort?: string
+  approval_policy?: string   // untrusted / on-failure / on-request / never
+  sandbox_mode?: string      // read-only / workspace-write / danger-full-access
+  sandbox_workspace_write?: {
+    writable_roots?: string[]
+    network_access: boolean
+    exclude_tmpdir_env_var: boolean
+    exclude_slash_tmp: boolean
+  }
+  profile?: string
+  profiles?: Record<string, CodexProfile>
+  mcp_servers?: Record<string, CodexMCPServer>
+}
+
+export type CodexConfigIssue = {
+  field: string
+  message: string
+  severity: 'error' | 'warning'
+}
+
+export type CodexConfigPreview = {
+  schema: CodexSchema
+  base_hash: string
+  content: string
+  diff: string
+  changed: boolean
+  issues: CodexConfigIssue[]
+}
+
+const codexSettingsService = serviceNames.codex
+
+export const fetchCodexConfig = async (): Promise<CodexConfig> => {
+  return Call.ByName(`${codexSettingsService}.GetConfig`)
+}
+
+export const detectCodexSchema = async (): Promise<CodexSchema> => {
+  return Call.ByName(`${codexSettingsService}.DetectConfigSchema`)
+}
+
+export const validateCodexConfig = async (config: CodexConfig, schema: CodexSchema | '' = ''): Promise<CodexConfigIssue[]> => {
+  return Call.ByName(`${codexSettingsService}.ValidateConfig`, config, schema)
+}
+
+// 预览写入后的 config.toml 与 diff，不修改文件
+export const previewCodexConfig = async (config: CodexConfig, schema: CodexSchema | '' = ''): Promise<CodexConfigPreview> => {
+  return Call.ByName(`${codexSettingsService}.PreviewConfig`, config, schema)
+}
+
+// baseHash 取自 previewCodexConfig，预览后文件被修改时拒绝写入
+export const saveCodexConfig = async (config: CodexConfig, baseHash: string, schema: CodexSchema | '' = ''): Promise<void> => {
+  await Call.ByName(`${codexSettingsService}.SaveConfig`, config, schema, baseHash)
+}
+
+// Gemini CLI (~/.gemini/settings.json 与 ~/.gemini/.env)
+export type GeminiCLISettings = {
+  auth_mode: string          // oauth-personal / gemini-api-key / vertex-ai / cloud-shell
+  base_url: string           // GOOGLE_GEMINI_BASE_URL，为空时移除
+  telemetry_enabled: boolean
+  usage_statistics_enabled: boolean
+  schema: '' | 'flat' | 'nested'
+}
+
+export type GeminiExtension = {
+  name: string
+  version: string
+  path: string
+  enabled: boolean
+  mcp_servers: string[]
+  context_file?: string
+}
+
+export type GeminiCLICompatibility = {
+  installed: boolean
+  binary_path: string
+  version: string
+  settings_schema: string
+  expected_schema: string
+  warnings: string[]
+}
+
+const geminiSettingsService = serviceNames['gemini-cli']
+
+export const fetchGeminiSettings = async (): Promise<GeminiCLISettings> => {
+  return Call.ByName(`${geminiSettingsService}.GetSettings`)
+}
+
+export const updateGeminiSettings = async (settings: GeminiCLISettings): Promise<void> => {
+  await Call.ByName(`${geminiSettingsService}.UpdateSettings`, settings)
+}
+
+export const fetchGeminiExtensions = async (): Promise<GeminiExtension[]> => {
+  return Call.ByName(`${geminiSettingsService}.ListExtensions`)
+}
+
+export const setGeminiExtensionEnabled = async (name: string, enabled: boolean): Promise<void> => {
+  await Call.ByName(`${geminiSettingsService}.SetExtensionEnabled`, name, enabled)
+}
+
+export const checkGeminiCompatibility = async (): Promise<GeminiCLICompatibility> => {
+  return Call.ByName(`${geminiSettingsService}.CheckCompatibility`)
+}
@@ -0,0 +1,20 @@
+import { Call } from '@wailsio/runtime'
+
+export type DebugServerStatus = {
+  enabled: boolean
+  addr?: string
+}
+
+export const fetchDebugServerStatus = async (): Promise<DebugServerStatus> => {
+  const data = await Call.ByName('codeswitch/services.DiagnosticsService.GetDebugServerStatus')
+  return data ?? { enabled: false }
+}
+
+export const setDebugServerEnabled = async (enabled: boolean): Promise<DebugServerStatus> => {
+  return Call.ByName('codeswitch/services.DiagnosticsService.SetDebugServerEnabled', enabled)
+}
+
+// 生成诊断包（包含数秒的 CPU profile），返回 zip 文件路径
+export const captureDiagnosticsBundle = async (): Promise<string> => {
+  return Call.ByName('codeswitch/services.DiagnosticsService.CaptureDiagnosticsBundle')
+}
@@ -8,6 +8,7 @@ export interface GatewayConfig {
   newApiEnabled: boolean
   newApiUrl: string
   newApiToken: string
+  newApiAutoDisable: boolean
 }
 
 export interface UserInfo {
@@ -31,6 +32,46 @@ export interface ConnectionStatus {
   error?: string
 }
 
+// NewAPIService types (see services/newapiservice.go)
+export interface NewAPIBalance {
+  userId: number
+  username: string
+  quota: number
+  usedQuota: number
+  requestCount: number
+  balanceUsd: number
+  usedUsd: number
+  exhausted: boolean
+  checkedAt: number
+}
+
+export interface NewAPIChannel {
+  id: number
+  name: string
+  type: number
+  status: number
+  statusText: 'enabled' | 'manually_disabled' | 'auto_disabled' | 'unknown'
+  models: string
+  group: string
+  priority: number
+  balance: number
+  usedQuota: number
+  responseTime: number
+  testTime: number
+}
+
+export interface NewAPIOverview {
+  enabled: boolean
+  url: string
+  balance?: NewAPIBalance
+  channels: NewAPIChannel[]
+  balanceError?: string
+  channelsError?: string
+  autoDisable: boolean
+  autoDisabledAt?: number
+  autoDisableNote?: string
+}
+
 // Backend AppSettings type (snake_case)
 interface BackendAppSettings {
   show_heatmap: boolean
@@ -40,6 +81,7 @@ interface BackendAppSettings {
   new_api_enabled: boolean
   new_api_url: string
   new_api_token: string
+  new_api_auto_disable: boolean
 }
 
 /**
@@ -52,6 +94,7 @@ export async function getGatewayConfig(): Promise<GatewayConfig> {
       newApiEnabled: settings?.new_api_enabled || false,
       newApiUrl: settings?.new_api_url || 'http://api.lurus.cn',
       newApiToken: settings?.new_api_token || '',
+      newApiAutoDisable: settings?.new_api_auto_disable || false,
     }
   } catch (error) {
     console.error('[Gateway] Failed to get config:', error)
@@ -70,6 +113,7 @@ export async function setGatewayConfig(config: GatewayConfig): Promise<void> {
       new_api_enabled: config.newApiEnabled,
       new_api_url: config.newApiUrl,
       new_api_token: config.newApiToken,
+      new_api_auto_disable: config.newApiAutoDisable,
     })
   } catch (error) {
     console.error('[Gateway] Failed to save config:', error)
@@ -92,3 +136,27 @@ export async function testConnection(url: string, token: string): Promise<Connec
     }
   }
 }
+
+/**
+ * Get NEW-API balance and channel overview. Balance and channel errors are reported per section.
+ */
+export async function getNewAPIOverview(): Promise<NewAPIOverview> {
+  try {
+    return await Call.ByName('codeswitch/services.NewAPIService.GetOverview')
+  } catch (error) {
+    console.error('[Gateway] Failed to get NEW-API overview:', error)
+    throw error
+  }
+}
+
+/**
+ * Check the NEW-API balance now; switches back to local providers when exhausted and auto-disable is on.
+ */
+export async function checkNewAPIBalance(): Promise<NewAPIBalance> {
+  try {
+    return await Call.ByName('codeswitch/services.NewAPIService.CheckBalanceNow')
+  } catch (error) {
+    console.error('[Gateway] Failed to check NEW-API balance:', error)
+    throw error
+  }
+}
@@ -0,0 +1,44 @@
+import { Call } from '@wailsio/runtime'
+
+export type GuardrailAction = 'off' | 'warn' | 'redact' | 'block'
+
+export type GuardrailPattern = {
+  name: string
+  regex: string                   // RE2 正则
+  apps?: string[]                 // 仅对这些应用生效，空表示全部
+}
+
+export type GuardrailPolicy = {
+  enabled: boolean
+  builtin_secrets: boolean        // 内置密钥规则（AWS / 私钥 / GitHub / Slack / Google / LLM Key）
+  patterns?: GuardrailPattern[]
+  default_action: GuardrailAction
+  app_actions?: Record<string, GuardrailAction>
+  webhook_url?: string
+}
+
+export type GuardrailViolation = {
+  id: number
+  app_name: string
+  platform: string
+  model: string
+  request_path: string
+  client_ip: string
+  action: GuardrailAction
+  patterns: string                // 命中的规则名，逗号分隔（不含命中内容）
+  matches: number
+  created_at: string
+}
+
+export const fetchGuardrailPolicy = async (): Promise<GuardrailPolicy> => {
+  return Call.ByName('codeswitch/services.ProviderRelayService.GetGuardrailPolicy')
+}
+
+export const saveGuardrailPolicy = async (policy: GuardrailPolicy): Promise<void> => {
+  return Call.ByName('codeswitch/services.ProviderRelayService.SetGuardrailPolicy', policy)
+}
+
+export const fetchGuardrailViolations = async (app = '', limit = 100): Promise<GuardrailViolation[]> => {
+  const violations = await Call.ByName('codeswitch/services.ProviderRelayService.ListGuardrailViolations', app, limit)
+  return violations ?? []
+}
@@ -1,9 +1,14 @@
-import { Call } from '@wailsio/runtime'
+import { Call, Events } from '@wailsio/runtime'
 
 export type RequestLog = {
   id: number
   trace_id?: string              // 全局追踪 ID (Ailurus PaaS 增强)
   request_id?: string            // 客户端请求 ID
+  conversation_id?: string       // 会话 ID（请求头 / Claude Code 会话 / 内容指纹）
+  project?: string               // 成本归属项目（X-CS-Project）
+  tags?: string                  // 成本归属标签，逗号分隔（X-CS-Tags）
+  api_key_id?: string            // 客户端 Key 的哈希标识（key_xxx），不含原始 Key
+  app_name?: string              // 调用方应用（客户端指纹识别：claude / codex / cursor / cline / opencode / script ...）
   platform: string
   model: string
   provider: string
@@ -15,6 +20,9 @@ export type RequestLog = {
   reasoning_tokens: number
   is_stream?: boolean | number
   duration_sec?: number
+  ttfb_sec?: number              // 上游响应头到达时间
+  ttft_sec?: number              // 首 token 时间（仅流式）
+  tokens_per_sec?: number        // 流式输出吞吐
   user_agent?: string            // 用户代理（识别 TUI/GUI）
   client_ip?: string             // 客户端 IP
   user_id?: string               // 用户标识（多租户）
@@ -23,6 +31,10 @@ export type RequestLog = {
   error_type?: string            // 错误类型（network/auth/rate_limit/server）
   error_message?: string         // 错误详细信息
   provider_error_code?: string   // 供应商错误码
+  json_repair?: string           // JSON 模式保证：repaired / retried:N / failed
+  prompt_compression?: string    // 提示词压缩：策略与压缩前后的估算 token 数
+  request_bytes?: number         // 发送给上游的请求体字节数
+  response_bytes?: number        // 从上游读取的响应体字节数
   created_at: string
   total_cost?: number
   input_cost?: number
@@ -47,6 +59,207 @@ export const fetchRequestLogs = async (query: RequestLogQuery = {}): Promise<Req
   return Call.ByName('codeswitch/services.LogService.ListRequestLogs', platform, provider, limit)
 }
 
+// 订阅新写入的请求日志（live tail），返回取消订阅函数
+export const subscribeRequestLogs = (handler: (log: RequestLog) => void): (() => void) => {
+  return Events.On('request-log:new', (event: { data: unknown }) => {
+    const payload = Array.isArray(event.data) ? event.data[0] : event.data
+    if (payload) handler(payload as RequestLog)
+  })
+}
+
+export type ConversationSummary = {
+  conversation_id: string
+  platform: string
+  first_at: string
+  last_at: string
+  requests: number
+  input_tokens: number
+  output_tokens: number
+  cache_tokens: number
+  total_cost: number
+  errors: number
+  models: string[]
+  providers: string[]
+}
+
+export const fetchConversations = async (platform = '', limit = 50): Promise<ConversationSummary[]> => {
+  return Call.ByName('codeswitch/services.LogService.ListConversations', platform, limit)
+}
+
+// 会话内请求按时间正序返回
+export const fetchConversationLogs = async (conversationId: string): Promise<RequestLog[]> => {
+  return Call.ByName('codeswitch/services.LogService.GetConversationLogs', conversationId)
+}
+
+// 会话记录：由 body 日志还原的对话轮次
+export type TranscriptToolCall = {
+  id?: string
+  name: string
+  arguments: string
+}
+
+export type TranscriptTurn = {
+  role: 'system' | 'user' | 'assistant' | 'tool'
+  text?: string
+  tool_calls?: TranscriptToolCall[]
+  tool_call_id?: string
+  trace_id?: string
+  model?: string
+  provider?: string
+  created_at?: string
+  input_tokens?: number
+  output_tokens?: number
+  cost?: number
+  error?: string
+}
+
+export type Transcript = {
+  conversation_id: string
+  platform: string
+  first_at: string
+  last_at: string
+  requests: number
+  missing_bodies: number
+  input_tokens: number
+  output_tokens: number
+  total_cost: number
+  turns: TranscriptTurn[]
+}
+
+export type TranscriptExportFormat = 'markdown' | 'json'
+
+export const fetchTranscript = async (conversationId: string): Promise<Transcript> => {
+  return Call.ByName('codeswitch/services.TranscriptService.GetTranscript', conversationId)
+}
+
+// 导出到 ~/.code-switch/exports，返回文件路径
+export const exportTranscript = async (conversationId: string, format: TranscriptExportFormat): Promise<string> => {
+  return Call.ByName('codeswitch/services.TranscriptService.ExportTranscript', conversationId, format)
+}
+
+// 在独立窗口中打开会话记录
+export const openTranscriptWindow = async (conversationId: string): Promise<void> => {
+  await Call.ByName('main.AppService.OpenTranscriptWindow', conversationId)
+}
+
+// 日志过滤条件（与 ProviderRelayService.QueryLogs 的 LogFilter 一致）
+export type LogFilter = {
+  platform?: string
+  model?: string
+  provider?: string
+  conversation_id?: string
+  project?: string
+  tag?: string
+  app_name?: string
+  start_time?: string
+  end_time?: string
+  min_cost?: number
+  max_cost?: number
+  has_error?: boolean | null
+}
+
+export type LogViewerPreset = {
+  name: string
+  filter: LogFilter
+}
+
+// 日志窗口偏好：显示的列（RequestLog 字段名，按顺序）与命名过滤预设
+export type LogViewerSettings = {
+  columns: string[]
+  presets: LogViewerPreset[]
+}
+
+// 日志窗口深链接，如从通知打开某个 trace
+export type LogViewerLink = {
+  trace_id?: string
+  conversation_id?: string
+  platform?: string
+  provider?: string
+  errors_only?: boolean
+}
+
+export const fetchLogViewerSettings = async (): Promise<LogViewerSettings> => {
+  return Call.ByName('codeswitch/services.LogService.GetLogViewerSettings')
+}
+
+export const saveLogViewerColumns = async (columns: string[]): Promise<LogViewerSettings> => {
+  return Call.ByName('codeswitch/services.LogService.SetLogViewerColumns', columns)
+}
+
+// 同名预设被覆盖
+export const saveLogViewerPreset = async (preset: LogViewerPreset): Promise<LogViewerSettings> => {
+  return Call.ByName('codeswitch/services.LogService.SaveLogViewerPreset', preset)
+}
+
+export const deleteLogViewerPreset = async (name: string): Promise<LogViewerSettings> => {
+  return Call.ByName('codeswitch/services.LogService.DeleteLogViewerPreset', name)
+}
+
+// 增量获取 id 大于 afterId 的日志（按 id 正序），用于补齐窗口失焦期间错过的 request-log:new 事件
+export const fetchLogsSince = async (filter: LogFilter, afterId: number, limit = 100): Promise<RequestLog[]> => {
+  return Call.ByName('codeswitch/services.ProviderRelayService.QueryLogsSince', filter, afterId, limit)
+}
+
+export type LogDetail = {
+  log: RequestLog
+  request_body?: string
+  response_body?: string
+}
+
+export const fetchLogDetail = async (traceId: string): Promise<LogDetail> => {
+  return Call.ByName('codeswitch/services.ProviderRelayService.GetLogDetail', traceId)
+}
+
+// 在新的日志窗口中打开，按链接过滤并定位 trace
+export const openLogsWindow = async (link: LogViewerLink = {}): Promise<void> => {
+  await Call.ByName('main.AppService.OpenLogsWindow', link)
+}
+
+export type AttributionStat = {
+  key: string
+  total_requests: number
+  input_tokens: number
+  output_tokens: number
+  cache_tokens: number
+  cost_total: number
+}
+
+// 按项目（project）或标签（tag）聚合的用量
+export const fetchAttributionStats = async (
+  dimension: 'project' | 'tag' | 'app',
+  platform = '',
+  days = 30,
+): Promise<AttributionStat[]> => {
+  return Call.ByName('codeswitch/services.LogService.AttributionStats', dimension, platform, days)
+}
+
+export type LogExportFormat = 'json' | 'csv' | 'parquet' | 'sqlite'
+
+export type LogExportProgress = {
+  path: string
+  format: LogExportFormat
+  rows: number
+  total: number
+  done: boolean
+  error?: string
+}
+
+// 流式导出日志（无行数上限），返回导出文件路径
+export const exportLogs = async (
+  filter: { platform?: string; provider?: string },
+  format: LogExportFormat,
+  gzip = false,
+): Promise<string> => {
+  return Call.ByName('codeswitch/services.ProviderRelayService.ExportLogsWithOptions', filter, { format, gzip })
+}
+
+export const subscribeLogExportProgress = (handler: (progress: LogExportProgress) => void): (() => void) => {
+  return Events.On('log-export:progress', (event: { data: unknown }) => {
+    const payload = Array.isArray(event.data) ? event.data[0] : event.data
+    if (payload) handler(payload as LogExportProgress)
+  })
+}
+
 export const fetchLogProviders = async (platform = ''): Promise<string[]> => {
   return Call.ByName('codeswitch/services.LogService.ListProviders', platform)
 }
@@ -60,6 +273,8 @@ export type LogStatsSeries = {
   cache_create_tokens: number
   cache_read_tokens: number
   total_cost: number
+  request_bytes: number
+  response_bytes: number
 }
 
 export type LogStats = {
@@ -74,6 +289,8 @@ export type LogStats = {
   cost_output: number
   cost_cache_create: number
   cost_cache_read: number
+  request_bytes: number
+  response_bytes: number
   series: LogStatsSeries[]
 }
 
@@ -93,6 +310,8 @@ export type ProviderDailyStat = {
   cache_create_tokens: number
   cache_read_tokens: number
   cost_total: number
+  request_bytes: number
+  response_bytes: number
 }
 
 export const fetchProviderDailyStats = async (
@@ -134,6 +353,45 @@ export type CostAnalysis = {
   cost_trend: DailyCostPoint[]
   trend_direction: 'up' | 'down' | 'stable'
   trend_percentage: number
+  prompt_cache: PromptCacheAnalysis
+}
+
+// Anthropic prompt cache 命中分析与优化建议
+export type PromptCacheConversation = {
+  conversation_id: string
+  requests: number
+  input_tokens: number
+  cache_read_tokens: number
+  cache_create_tokens: number
+  hit_ratio: number
+  creation_ratio: number
+  cache_control: boolean
+  system_changes: number
+  tools_changes: number
+  expired_reuses: number
+  estimated_savings: number
+}
+
+export type PromptCacheAdvice = {
+  kind: 'no_cache_control' | 'system_prompt_changes' | 'tools_change' | 'cache_expired'
+  conversation_id?: string
+  message: string
+  requests: number
+  estimated_savings: number
+}
+
+export type PromptCacheAnalysis = {
+  requests: number
+  inspected_bodies: number
+  cache_control_requests: number
+  input_tokens: number
+  cache_read_tokens: number
+  cache_create_tokens: number
+  hit_ratio: number
+  creation_ratio: number
+  estimated_savings: number
+  conversations: PromptCacheConversation[]
+  recommendations: PromptCacheAdvice[]
 }
 
 export const fetchCostAnalysis = async (
@@ -143,6 +401,75 @@ export const fetchCostAnalysis = async (
   return Call.ByName('codeswitch/services.LogService.CostAnalysis', platform, days)
 }
 
+// Provider 故障记录（熔断 / 挂起 / 全部失败）
+export type IncidentCause = 'circuit_open' | 'suspended' | 'all_failed'
+
+export type ProviderIncident = {
+  id: number
+  platform: string
+  provider: string
+  cause: IncidentCause
+  started_at: number
+  ended_at?: number
+  duration_sec: number
+  affected_requests: number
+  error_samples?: string[]
+}
+
+export type IncidentMarker = {
+  day: string
+  count: number
+  providers: string[]
+}
+
+export const fetchProviderIncidents = async (platform = '', days = 30): Promise<ProviderIncident[]> => {
+  const data = await Call.ByName('codeswitch/services.LogService.ListProviderIncidents', platform, days)
+  return data ?? []
+}
+
+export const fetchIncidentMarkers = async (platform = '', days = 7): Promise<IncidentMarker[]> => {
+  const data = await Call.ByName('codeswitch/services.LogService.GetIncidentMarkers', platform, days)
+  return data ?? []
+}
+
+// 慢请求剖析：超过阈值的请求各阶段耗时（秒）
+export type SlowRequest = {
+  id: number
+  trace_id: string
+  platform: string
+  provider: string
+  model: string
+  http_code: number
+  is_stream: boolean
+  attempts: number
+  total_sec: number
+  queue_wait_sec: number
+  selection_sec: number
+  failover_sec: number
+  ttfb_sec: number
+  streaming_sec: number
+  log_enqueue_sec: number
+  created_at: string
+}
+
+export const fetchSlowRequests = async (limit = 20): Promise<SlowRequest[]> => {
+  const data = await Call.ByName('codeswitch/services.LogService.ListSlowRequests', limit)
+  return data ?? []
+}
+
+export type DashboardSnapshotFormat = 'png' | 'pdf'
+
+export type DashboardSnapshotOptions = {
+  format?: DashboardSnapshotFormat
+  days?: number
+  platform?: string
+}
+
+// 统计快照（每日花费、provider 分布、请求热力图）保存到 ~/.code-switch/exports，返回文件路径
+export const exportDashboardSnapshot = async (options: DashboardSnapshotOptions = {}): Promise<string> => {
+  return Call.ByName('codeswitch/services.LogService.ExportDashboardSnapshot', options)
+}
+
 // 性能与可靠性分析
 export type ProviderReliabilityStat = {
   provider: string
@@ -151,7 +478,43 @@ export type ProviderReliabilityStat = {
   fail_count: number
   success_rate: number
   avg_duration: number
+  avg_ttft: number
+  avg_tokens_per_sec: number
+  avg_quality_score: number
+  quality_samples: number
   error_types: Record<string, number>
+  slo?: ProviderSLOStatus
+}
+
+// Provider SLO 达标情况与错误预算（按 SLO 自身的滚动窗口计算）
+export type SLOObjective = {
+  kind: 'error_rate' | 'latency'
+  target: number
+  observed: number
+  met: boolean
+  budget_remaining: number
+  burn_rate: number
+}
+
+export type ProviderSLOStatus = {
+  platform: string
+  provider: string
+  slo: {
+    latencySec?: number
+    latencyPercentile?: number
+    maxErrorRate?: number
+    windowDays?: number
+    burnRateAlert?: number
+  }
+  requests: number
+  compliant: boolean
+  fast_burn: boolean
+  objectives: SLOObjective[]
+}
+
+export const fetchProviderSLOs = async (platform = ''): Promise<ProviderSLOStatus[]> => {
+  const data = await Call.ByName('codeswitch/services.LogService.GetProviderSLOs', platform)
+  return data ?? []
 }
 
 export type PerformanceAnalysis = {
@@ -161,6 +524,16 @@ export type PerformanceAnalysis = {
   duration_avg: number
   duration_min: number
   duration_max: number
+  ttfb_p50: number
+  ttfb_p95: number
+  ttfb_p99: number
+  ttft_p50: number
+  ttft_p95: number
+  ttft_p99: number
+  ttft_avg: number
+  tokens_per_sec_p50: number
+  tokens_per_sec_p95: number
+  tokens_per_sec_avg: number
   error_distribution: Record<string, number>
   total_errors: number
   error_rate: number
@@ -183,8 +556,41 @@ export type RequestLogBody = {
   body_size_bytes: number
   created_at: string
   expires_at: string
+  response_spilled: boolean
+  truncated: boolean
 }
 
 export const fetchRequestLogBody = async (traceId: string): Promise<RequestLogBody | null> => {
   return Call.ByName('codeswitch/services.LogService.GetRequestLogBody', traceId)
 }
+
+// 大响应体分段读取（落盘的响应体仅在 response_body 中保留预览）
+export type RequestLogBodyRange = {
+  trace_id: string
+  offset: number
+  length: number
+  total_size: number
+  data: string
+  eof: boolean
+}
+
+export const fetchRequestLogBodyRange = async (
+  traceId: string,
+  offset = 0,
+  length = 0,
+): Promise<RequestLogBodyRange> => {
+  return Call.ByName('codeswitch/services.LogService.GetRequestLogBodyRange', traceId, offset, length)
+}
+
+// Body 日志存储占用与请求体去重效果
+export type BodyStorageStats = {
+  bodies: number
+  body_bytes: number
+  stored_bytes: number
+  blobs: number
+  blob_references: number
+}
+
+export const fetchBodyStorageStats = async (): Promise<BodyStorageStats> => {
+  return Call.ByName('codeswitch/services.LogService.GetBodyStorageStats')
+}
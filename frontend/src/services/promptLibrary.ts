@@ -0,0 +1,104 @@
+import { Call } from '@wailsio/runtime'
+
+export type PromptVariable = {
+  name: string
+  description?: string
+  default?: string
+  required?: boolean
+}
+
+export type PromptVersion = {
+  version: number
+  system?: string
+  template: string
+  variables?: PromptVariable[]
+  updated_at: number
+}
+
+export type PromptTemplate = {
+  id: string
+  name: string
+  description?: string
+  tags?: string[]
+  endpoint?: string
+  model?: string
+  max_tokens?: number
+  system?: string
+  template: string
+  variables?: PromptVariable[]
+  version: number
+  updated_at: number
+  history?: PromptVersion[]
+}
+
+export type RenderedPrompt = {
+  endpoint: string
+  system?: string
+  text: string
+  body: string
+}
+
+export type PromptSendResult = {
+  rendered: RenderedPrompt
+  result: {
+    status: number
+    trace_id?: string
+    provider?: string
+    model?: string
+    attempts: number
+    input_tokens: number
+    output_tokens: number
+    cost: number
+    duration_ms: number
+    body?: unknown
+    error?: string
+  }
+}
+
+export type PromptImportResult = {
+  added: number
+  updated: number
+  skipped: number
+}
+
+const method = (name: string) => `codeswitch/services.PromptLibraryService.${name}`
+
+export const fetchPrompts = async (tag = ''): Promise<PromptTemplate[]> => {
+  const data = await Call.ByName(method('ListPrompts'), tag)
+  return data ?? []
+}
+
+export const fetchPromptTags = async (): Promise<string[]> => {
+  const data = await Call.ByName(method('ListPromptTags'))
+  return data ?? []
+}
+
+export const savePrompt = async (prompt: Partial<PromptTemplate>): Promise<PromptTemplate> => {
+  return Call.ByName(method('SavePrompt'), prompt)
+}
+
+export const deletePrompt = async (id: string): Promise<void> => {
+  await Call.ByName(method('DeletePrompt'), id)
+}
+
+export const restorePromptVersion = async (id: string, version: number): Promise<PromptTemplate> => {
+  return Call.ByName(method('RestorePromptVersion'), id, version)
+}
+
+// model 为空时使用模板的默认模型
+export const renderPrompt = async (id: string, vars: Record<string, string>, model = ''): Promise<RenderedPrompt> => {
+  return Call.ByName(method('RenderPrompt'), id, vars, model)
+}
+
+export const sendPrompt = async (id: string, vars: Record<string, string>, model = ''): Promise<PromptSendResult> => {
+  return Call.ByName(method('SendPrompt'), id, vars, model)
+}
+
+// ids 为空时导出全部模板，返回 JSON 文本
+export const exportPrompts = async (ids: string[] = []): Promise<string> => {
+  return Call.ByName(method('ExportPrompts'), ids)
+}
+
+export const importPrompts = async (data: string, overwrite = false): Promise<PromptImportResult> => {
+  return Call.ByName(method('ImportPrompts'), data, overwrite)
+}
@@ -9,3 +9,387 @@ export const isRoundRobinEnabled = async (): Promise<boolean> => {
 export const setRoundRobinEnabled = async (enabled: boolean): Promise<void> => {
   await Call.ByName(`${serviceName}.SetRoundRobinEnabled`, enabled)
 }
+
+// provider 组（复合 provider）：组内按 strategy 路由，models 命中或应用规则指定时使用
+export type ProviderGroupStrategy = 'priority' | 'round_robin' | 'weighted' | 'random'
+
+export type ProviderGroup = {
+  name: string
+  members: string[]
+  strategy?: ProviderGroupStrategy
+  weights?: Record<string, number>
+  models?: string[]
+  disabled?: boolean
+}
+
+export const fetchProviderGroups = async (platform: string): Promise<ProviderGroup[]> => {
+  return Call.ByName(`${serviceName}.GetProviderGroups`, platform)
+}
+
+export const saveProviderGroups = async (platform: string, groups: ProviderGroup[]): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetProviderGroups`, platform, groups)
+}
+
+export type CanaryConfig = {
+  percent: number
+  startedAt?: number
+  durationMinutes?: number
+  minRequests?: number
+  maxErrorRateDelta?: number
+  maxLatencyRatio?: number
+}
+
+export type CanaryStats = {
+  requests: number
+  errors: number
+  error_rate: number
+  avg_duration_ms: number
+}
+
+export type CanaryReport = {
+  platform: string
+  provider: string
+  config: CanaryConfig
+  ends_at: number
+  canary: CanaryStats
+  incumbent: CanaryStats
+  decision: 'pending' | 'promote' | 'fail'
+  reason?: string
+}
+
+export const fetchCanaryReports = async (platform: string): Promise<CanaryReport[]> => {
+  return Call.ByName(`${serviceName}.GetCanaryReports`, platform)
+}
+
+export const startCanary = async (platform: string, provider: string, config: CanaryConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.StartCanary`, platform, provider, config)
+}
+
+export const evaluateCanaries = async (): Promise<CanaryReport[]> => {
+  return Call.ByName(`${serviceName}.EvaluateCanaries`)
+}
+
+export type QualityRuleType = 'regex' | 'json_tool_calls' | 'llm_judge'
+
+export type QualityRule = {
+  name: string
+  type: QualityRuleType
+  pattern?: string
+  must_not_match?: boolean
+  platforms?: string[]
+  models?: string[]
+  sample_rate?: number
+  disabled?: boolean
+  judge_platform?: string
+  judge_provider?: string
+  judge_model?: string
+  judge_prompt?: string
+}
+
+export type QualityConfig = {
+  enabled: boolean
+  sample_rate?: number
+  max_response_bytes?: number
+  min_score?: number
+  min_samples?: number
+  rules: QualityRule[]
+}
+
+export type QualitySummary = {
+  provider: string
+  model: string
+  hook: string
+  samples: number
+  avg_score: number
+}
+
+export const fetchQualityConfig = async (): Promise<QualityConfig> => {
+  return Call.ByName(`${serviceName}.GetQualityConfig`)
+}
+
+export const saveQualityConfig = async (config: QualityConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetQualityConfig`, config)
+}
+
+export const fetchQualitySummary = async (platform: string, days: number): Promise<QualitySummary[]> => {
+  return Call.ByName(`${serviceName}.GetQualitySummary`, platform, days)
+}
+
+// 提示词压缩：超出上下文窗口时丢弃最早的对话或用廉价模型总结
+export type PromptCompressionConfig = {
+  enabled: boolean
+  strategy?: 'drop_oldest' | 'summarize'
+  platforms?: string[]
+  context_windows?: Record<string, number>
+  default_context_window?: number
+  reserve_output_tokens?: number
+  keep_recent_messages?: number
+  summary_platform?: string
+  summary_provider?: string
+  summary_model?: string
+  summary_prompt?: string
+  summary_max_tokens?: number
+}
+
+export const fetchPromptCompressionConfig = async (): Promise<PromptCompressionConfig> => {
+  return Call.ByName(`${serviceName}.GetPromptCompressionConfig`)
+}
+
+export const savePromptCompressionConfig = async (config: PromptCompressionConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetPromptCompressionConfig`, config)
+}
+
+// 推理内容处理：客户端规则优先，其次 provider 的 reasoningPolicy，最后是平台默认值
+export type ReasoningPolicy = 'passthrough' | 'strip' | 'tags'
+
+export type ReasoningConfig = {
+  platforms?: Record<string, ReasoningPolicy>
+  clients?: Record<string, ReasoningPolicy>
+}
+
+export const fetchReasoningConfig = async (): Promise<ReasoningConfig> => {
+  return Call.ByName(`${serviceName}.GetReasoningConfig`)
+}
+
+export const saveReasoningConfig = async (config: ReasoningConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetReasoningConfig`, config)
+}
+
+// 模型默认参数：客户端未指定时注入，每个参数取最具体的匹配规则（provider > 精确模型 > 通配模型 > 平台）
+export type ModelDefaultRule = {
+  platform?: string
+  model?: string
+  provider?: string
+  temperature?: number
+  top_p?: number
+  max_tokens?: number
+  reasoning_effort?: 'low' | 'medium' | 'high'
+}
+
+export type ModelDefaultsConfig = {
+  rules: ModelDefaultRule[]
+}
+
+export const fetchModelDefaults = async (): Promise<ModelDefaultsConfig> => {
+  return Call.ByName(`${serviceName}.GetModelDefaults`)
+}
+
+export const saveModelDefaults = async (config: ModelDefaultsConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetModelDefaults`, config)
+}
+
+// 请求优先级：X-CS-Priority 请求头或 API Key 归属规则标记 interactive / batch，
+// provider 并发已满时 interactive 优先获得名额，batch 最多占用 batchShare% 的名额
+export type PriorityClass = 'interactive' | 'batch'
+
+export type PriorityConfig = {
+  defaultClass: PriorityClass
+  batchShare: number
+  maxWaitMs: number
+}
+
+export type PriorityClassStats = {
+  class: PriorityClass
+  requests: number
+  queued: number
+  timeouts: number
+  waiting: number
+  active: number
+  avgWaitMs: number
+  maxWaitMs: number
+  avgDurationMs: number
+  p95DurationMs: number
+}
+
+export const fetchPriorityConfig = async (): Promise<PriorityConfig> => {
+  return Call.ByName(`${serviceName}.GetPriorityConfig`)
+}
+
+export const savePriorityConfig = async (config: PriorityConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetPriorityConfig`, config)
+}
+
+export const fetchPriorityStats = async (): Promise<PriorityClassStats[]> => {
+  return Call.ByName(`${serviceName}.GetPriorityStats`)
+}
+
+// 中继插件：~/.code-switch/plugins 目录下的可执行文件，拦截转发的请求与响应
+export type PluginConfig = {
+  disabled?: string[]
+  timeout_ms?: number
+  fail_closed?: boolean
+}
+
+export type PluginStatus = {
+  file: string
+  path: string
+  name?: string
+  version?: string
+  hooks?: Array<'request' | 'response'>
+  platforms?: string[]
+  enabled: boolean
+  running: boolean
+  error?: string
+}
+
+export const fetchPlugins = async (): Promise<PluginStatus[]> => {
+  return Call.ByName(`${serviceName}.GetPlugins`)
+}
+
+export const reloadPlugins = async (): Promise<PluginStatus[]> => {
+  return Call.ByName(`${serviceName}.ReloadPlugins`)
+}
+
+export const fetchPluginConfig = async (): Promise<PluginConfig> => {
+  return Call.ByName(`${serviceName}.GetPluginConfig`)
+}
+
+export const savePluginConfig = async (config: PluginConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetPluginConfig`, config)
+}
+
+export const setPluginEnabled = async (file: string, enabled: boolean): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetPluginEnabled`, file, enabled)
+}
+
+// 请求脚本：~/.code-switch/scripts/<平台>.lua 中的 on_request(req) 在路由前改写请求或指定 provider
+export type ScriptConfig = {
+  disabled?: string[]
+  timeout_ms?: number
+  max_steps?: number
+  max_memory_mb?: number
+}
+
+export type ScriptStatus = {
+  platform: string
+  path: string
+  enabled: boolean
+  updated_at: number
+  error?: string
+}
+
+export type ScriptTestRequest = {
+  source?: string
+  body: string
+  headers?: Record<string, string>
+  path?: string
+}
+
+export type ScriptTestResult = {
+  body: string
+  body_changed: boolean
+  headers: Record<string, string>
+  provider?: string
+  rejected: boolean
+  reject_status?: number
+  reject_message?: string
+  logs: string[]
+  steps: number
+  duration_ms: number
+  error?: string
+}
+
+export const fetchRequestScripts = async (): Promise<ScriptStatus[]> => {
+  return Call.ByName(`${serviceName}.GetRequestScripts`)
+}
+
+export const fetchRequestScript = async (platform: string): Promise<string> => {
+  return Call.ByName(`${serviceName}.GetRequestScript`, platform)
+}
+
+export const saveRequestScript = async (platform: string, source: string): Promise<void> => {
+  await Call.ByName(`${serviceName}.SaveRequestScript`, platform, source)
+}
+
+export const testRequestScript = async (platform: string, req: ScriptTestRequest): Promise<ScriptTestResult> => {
+  return Call.ByName(`${serviceName}.TestRequestScript`, platform, req)
+}
+
+export const fetchScriptConfig = async (): Promise<ScriptConfig> => {
+  return Call.ByName(`${serviceName}.GetScriptConfig`)
+}
+
+export const saveScriptConfig = async (config: ScriptConfig): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetScriptConfig`, config)
+}
+
+export const setScriptEnabled = async (platform: string, enabled: boolean): Promise<void> => {
+  await Call.ByName(`${serviceName}.SetScriptEnabled`, platform, enabled)
+}
+
+// 日志数据库（app.db）大小与碎片统计，设置页展示
+export type DatabaseStats = {
+  path: string
+  size_bytes: number
+  wal_bytes: number
+  page_size: number
+  page_count: number
+  free_pages: number
+  fragmentation_percent: number
+  auto_vacuum: 'none' | 'full' | 'incremental'
+  pending_deleted_rows: number
+  last_maintenance_at?: string
+  last_reclaimed_bytes: number
+}
+
+export const fetchDatabaseStats = async (): Promise<DatabaseStats> => {
+  return Call.ByName(`${serviceName}.GetDatabaseStats`)
+}
+
+export const runDatabaseMaintenance = async (): Promise<DatabaseStats> => {
+  return Call.ByName(`${serviceName}.RunDatabaseMaintenance`)
+}
+
+// 用户模型覆盖文件（~/.code-switch/model-overrides/*.json）
+export type ModelOverrideFile = {
+  name: string
+  path: string
+  models: string[]
+  updated_at: number
+  error?: string
+}
+
+export type ModelOverrideStatus = {
+  dir: string
+  files: ModelOverrideFile[]
+  models: string[]
+  loaded_at: number
+}
+
+export type ModelInfo = {
+  model: string
+  context_window: number
+  max_output_tokens: number
+  vision?: boolean
+  tools?: boolean
+  json_mode?: boolean
+  reasoning?: boolean
+  input_cost_per_token: number
+  output_cost_per_token: number
+  overridden: boolean
+}
+
+export const fetchModelOverrides = async (): Promise<ModelOverrideStatus> => {
+  return Call.ByName(`${serviceName}.GetModelOverrides`)
+}
+
+export const reloadModelOverrides = async (): Promise<ModelOverrideStatus> => {
+  return Call.ByName(`${serviceName}.ReloadModelOverrides`)
+}
+
+export const fetchModelInfo = async (model: string): Promise<ModelInfo> => {
+  return Call.ByName(`${serviceName}.GetModelInfo`, model)
+}
+
+// 幂等键：携带 Idempotency-Key 的重试直接返回已有响应，不重复调用上游计费
+export type IdempotencyStats = {
+  cached: number
+  inFlight: number
+  replayed: number
+  attached: number
+  conflicts: number
+}
+
+export const fetchIdempotencyStats = async (): Promise<IdempotencyStats> => {
+  return Call.ByName(`${serviceName}.GetIdempotencyStats`)
+}
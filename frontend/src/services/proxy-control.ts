@@ -1,4 +1,19 @@
-import { GetProxyConfigs, GetProxyStats, ToggleProxy } from '../../wailsjs/go/services/ProviderRelayService'
+import { GetProxyConfigs, GetProxyStats, ToggleProxy, UpdateProxyRules } from '../../wailsjs/go/services/ProviderRelayService'
+
+export interface ProxyTimeWindow {
+  days?: number[] // 0=Sunday ... 6=Saturday, empty = every day
+  start: string // HH:MM
+  end: string // HH:MM, before start wraps past midnight
+}
+
+export interface ProxyRules {
+  allowed_models?: string[]
+  time_windows?: ProxyTimeWindow[]
+  max_daily_cost?: number
+  blocked_paths?: string[]
+  allowed_paths?: string[]
+  provider_group?: string     // route the app to this provider group
+}
 
 export interface ProxyControlConfig {
   app_name: string
@@ -6,6 +21,7 @@ export interface ProxyControlConfig {
   proxy_mode: string
   proxy_port?: number
   intercept_domains?: string[]
+  rules?: ProxyRules
   total_requests: number
   last_request_at?: string
   last_toggled_at?: string
@@ -17,6 +33,8 @@ export interface ProxyControlStats {
   enabled: boolean
   total_requests: number
   last_request_at?: string
+  rule_hits?: Record<string, number>
+  daily_cost: number
 }
 
 export interface ProxyConfigsResponse {
@@ -63,5 +81,19 @@ export const proxyControlApi = {
       console.error(`Failed to toggle proxy for ${appName}:`, error)
       throw new Error(`Failed to ${enabled ? 'enable' : 'disable'} proxy for ${appName}`)
     }
+  },
+
+  /**
+   * Replace the request rules of an application
+   * @param appName - Application name
+   * @param rules - Rules to apply, an empty object removes all restrictions
+   */
+  async updateRules(appName: string, rules: ProxyRules): Promise<void> {
+    try {
+      await UpdateProxyRules(appName, rules)
+    } catch (error) {
+      console.error(`Failed to update proxy rules for ${appName}:`, error)
+      throw new Error(`Failed to update proxy rules for ${appName}`)
+    }
   }
 }
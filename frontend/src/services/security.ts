@@ -0,0 +1,45 @@
+import { Call } from '@wailsio/runtime'
+
+export type SecurityEvent = {
+  id: number
+  type: string                    // ip_denied
+  client_ip: string
+  method: string
+  path: string
+  user_agent: string
+  detail: string                  // 拒绝原因：deny list / not in allow list
+  created_at: string
+}
+
+export type IPAccessConfig = {
+  allowList?: string[]            // CIDR 或单个 IP，为空时不限制来源
+  denyList?: string[]             // 优先于允许名单
+  trustedProxies?: string[]       // 来自这些地址的请求按 X-Forwarded-For 判断来源
+}
+
+export const fetchIPAccessConfig = async (): Promise<IPAccessConfig> => {
+  return Call.ByName('codeswitch/services.ProviderRelayService.GetIPAccessConfig')
+}
+
+export const fetchSecurityEvents = async (type = '', limit = 100): Promise<SecurityEvent[]> => {
+  const events = await Call.ByName('codeswitch/services.ProviderRelayService.ListSecurityEvents', type, limit)
+  return events ?? []
+}
+
+export type IPBan = {
+  ip: string
+  reason: string                  // request rate limit exceeded / too many concurrent requests / repeated authentication failures
+  strikes: number
+  createdAt: string
+  until: string
+}
+
+export const fetchIPBans = async (): Promise<IPBan[]> => {
+  const bans = await Call.ByName('codeswitch/services.ProviderRelayService.ListIPBans')
+  return bans ?? []
+}
+
+// ip 为空时解除全部封禁
+export const clearIPBan = async (ip = ''): Promise<number> => {
+  return Call.ByName('codeswitch/services.ProviderRelayService.ClearIPBan', ip)
+}
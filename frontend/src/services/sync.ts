@@ -8,6 +8,8 @@ import {
   UpdateSettings as WailsUpdateSettings,
   GetStatus as WailsGetStatus,
   TestConnection as WailsTestConnection,
+  GetConflicts as WailsGetConflicts,
+  ResolveConflict as WailsResolveConflict,
 } from '../../bindings/codeswitch/services/syncsettingsservice'
 
 // ===== 类型定义 =====
@@ -21,11 +23,65 @@ export interface SyncSettings {
   device_id: string
   device_name: string
   access_token?: string
+  scopes: SyncScopes
+  device_overrides?: Record<string, Partial<SyncScopes>>
+}
+
+// 同步类别开关，provider_api_keys 仅在 providers 开启时生效
+export interface SyncScopes {
+  providers: boolean
+  provider_api_keys: boolean
+  app_settings: boolean
+  usage_stats: boolean
+  request_logs: boolean
+  skills: boolean
+  mcp: boolean
+}
+
+export const defaultSyncScopes = (): SyncScopes => ({
+  providers: true,
+  provider_api_keys: false,
+  app_settings: true,
+  usage_stats: true,
+  request_logs: false,
+  skills: true,
+  mcp: true,
+})
+
+// 本设备实际生效的同步类别：全局设置叠加设备覆盖项
+export function effectiveSyncScopes(settings: SyncSettings): SyncScopes {
+  return {
+    ...defaultSyncScopes(),
+    ...settings.scopes,
+    ...(settings.device_overrides?.[settings.device_id] ?? {}),
+  }
 }
 
 export interface SyncStatus {
   enabled: boolean
   connected: boolean
+  scopes?: string[]
+  outbox_pending?: number // 离线期间积压、等待重放的事件数
+}
+
+// 多设备并发修改同一字段产生的冲突
+export interface SyncConflict {
+  id: string
+  scope: string
+  key: string
+  fields: string[]
+  base?: Record<string, unknown>
+  local: Record<string, unknown>
+  remote: Record<string, unknown>
+  remote_device: string
+  detected_at: string
+}
+
+export type ConflictSide = 'local' | 'remote'
+
+export interface ConflictResolution {
+  keep: ConflictSide
+  fields?: Record<string, ConflictSide>
 }
 
 export interface SystemStatus {
@@ -156,6 +212,26 @@ export async function testNATSConnection(natsUrl: string): Promise<{ success: bo
   }
 }
 
+export async function getSyncConflicts(): Promise<SyncConflict[]> {
+  try {
+    const conflicts = await WailsGetConflicts()
+    return (conflicts || []) as SyncConflict[]
+  } catch (error) {
+    console.error('Failed to get sync conflicts:', error)
+    return []
+  }
+}
+
+export async function resolveSyncConflict(id: string, resolution: ConflictResolution): Promise<boolean> {
+  try {
+    await WailsResolveConflict(id, resolution)
+    return true
+  } catch (error) {
+    console.error('Failed to resolve sync conflict:', error)
+    return false
+  }
+}
+
 // ===== 远程 Sync Service API =====
 
 class SyncServiceClient {
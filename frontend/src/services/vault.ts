@@ -0,0 +1,51 @@
+import { Call } from '@wailsio/runtime'
+
+const vaultService = 'codeswitch/services.SuiStore'
+
+export type VaultEntryKind = 'api_key' | 'note'
+
+export type VaultEntry = {
+  id: string
+  name: string
+  kind: VaultEntryKind
+  tags: string[]
+  description?: string
+  secret?: string   // 仅 getVaultEntry 返回；更新时留空表示保留原值
+  preview?: string  // 列表中的掩码
+  created_at: number
+  updated_at: number
+}
+
+export const fetchVaultEntries = async (query = '', tag = ''): Promise<VaultEntry[]> => {
+  return Call.ByName(`${vaultService}.ListVaultEntries`, query, tag)
+}
+
+export const fetchVaultTags = async (): Promise<string[]> => {
+  return Call.ByName(`${vaultService}.ListVaultTags`)
+}
+
+export const getVaultEntry = async (id: string): Promise<VaultEntry> => {
+  return Call.ByName(`${vaultService}.GetVaultEntry`, id)
+}
+
+export const saveVaultEntry = async (entry: Partial<VaultEntry> & { name: string }): Promise<VaultEntry> => {
+  return Call.ByName(`${vaultService}.SaveVaultEntry`, entry)
+}
+
+export const deleteVaultEntry = async (id: string): Promise<void> => {
+  await Call.ByName(`${vaultService}.DeleteVaultEntry`, id)
+}
+
+// 导出内容使用口令加密，可在其他设备导入
+export const exportVault = async (passphrase: string): Promise<string> => {
+  return Call.ByName(`${vaultService}.ExportVault`, passphrase)
+}
+
+export const importVault = async (data: string, passphrase: string, overwrite = false): Promise<number> => {
+  return Call.ByName(`${vaultService}.ImportVault`, data, passphrase, overwrite)
+}
+
+// 将平台下明文保存的 provider API Key 迁移到保险库
+export const moveProviderKeysToVault = async (platform: string): Promise<number> => {
+  return Call.ByName('codeswitch/services.ProviderService.MoveAPIKeysToVault', platform)
+}
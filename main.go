@@ -9,16 +9,21 @@ import (
 	"database/sql"
 	"embed"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
 	"github.com/wailsapp/wails/v3/pkg/events"
 	"github.com/wailsapp/wails/v3/pkg/services/dock"
+	"github.com/wailsapp/wails/v3/pkg/services/notifications"
 	_ "modernc.org/sqlite"
 )
 
@@ -42,6 +47,15 @@ func (a *AppService) SetApp(app *application.App) {
 }
 
 func (a *AppService) OpenSecondWindow() {
+	a.openLogsWindow("/#/logs")
+}
+
+// OpenLogsWindow opens a logs window filtered by the link, focusing link.TraceID when set.
+func (a *AppService) OpenLogsWindow(link services.LogViewerLink) {
+	a.openLogsWindow(link.URL())
+}
+
+func (a *AppService) openLogsWindow(route string) {
 	if a.App == nil {
 		fmt.Println("[ERROR] app not initialized")
 		return
@@ -60,7 +74,32 @@ func (a *AppService) OpenSecondWindow() {
 			Backdrop:                application.MacBackdropTransparent,
 		},
 		BackgroundColour: application.NewRGB(27, 38, 54),
-		URL:              "/#/logs",
+		URL:              route,
+	})
+	win.Center()
+}
+
+// OpenTranscriptWindow opens the transcript viewer for a conversation in its own window.
+func (a *AppService) OpenTranscriptWindow(conversationID string) {
+	if a.App == nil {
+		fmt.Println("[ERROR] app not initialized")
+		return
+	}
+	name := fmt.Sprintf("transcript-%d", time.Now().UnixNano())
+	win := a.App.Window.NewWithOptions(application.WebviewWindowOptions{
+		Title:     "Transcript",
+		Name:      name,
+		Width:     900,
+		Height:    800,
+		MinWidth:  600,
+		MinHeight: 300,
+		Mac: application.MacWindow{
+			InvisibleTitleBarHeight: 50,
+			TitleBar:                application.MacTitleBarHidden,
+			Backdrop:                application.MacBackdropTransparent,
+		},
+		BackgroundColour: application.NewRGB(27, 38, 54),
+		URL:              "/#/transcript/" + url.PathEscape(conversationID),
 	})
 	win.Center()
 }
@@ -69,6 +108,27 @@ func (a *AppService) OpenSecondWindow() {
 // and starts a goroutine that emits a time-based event every second. It subsequently runs the application and
 // logs any error that might occur.
 func main() {
+	// 单实例：已有实例运行时唤起其主窗口后退出，避免重复启动转发服务、托盘图标与崩溃恢复
+	instanceLock, lockErr := services.AcquireInstanceLock()
+	// 安装更新后重新启动时，旧进程可能仍在退出
+	for i := 0; i < 50 && errors.Is(lockErr, services.ErrInstanceRunning) && services.IsUpdateRelaunch(); i++ {
+		time.Sleep(200 * time.Millisecond)
+		instanceLock, lockErr = services.AcquireInstanceLock()
+	}
+	if errors.Is(lockErr, services.ErrInstanceRunning) {
+		if err := services.NotifyRunningInstance(os.Args[1:]); err != nil {
+			log.Printf("[SingleInstance] failed to activate the running instance: %v", err)
+		}
+		log.Printf("[SingleInstance] another instance is already running, exiting")
+		return
+	} else if lockErr != nil {
+		log.Printf("[SingleInstance] failed to acquire instance lock: %v", lockErr)
+	}
+
+	// 崩溃报告：记录日志并捕获 panic / 进程崩溃，上次运行崩溃时生成报告
+	crashReports := services.NewCrashReportService(AppVersion)
+	crashReports.Install()
+
 	appservice := &AppService{}
 
 	// 初始化配置恢复服务 (Phase 4)
@@ -77,6 +137,8 @@ func main() {
 
 	// Get database connection for recovery service
 	dbPath := filepath.Join(configDir, "app.db")
+	// 断电等原因导致数据库损坏时，在打开前重建并隔离损坏的文件
+	dbRepair := services.CheckDatabaseIntegrity(dbPath)
 	db, dbErr := sql.Open("sqlite", dbPath+"?cache=shared&mode=rwc&_busy_timeout=5000")
 	if dbErr != nil {
 		log.Printf("[Recovery] Failed to open database: %v", dbErr)
@@ -106,6 +168,9 @@ func main() {
 		// 处理错误，比如日志或退出
 	}
 	providerService := services.NewProviderService()
+	if errt == nil {
+		providerService.SetSecretVault(suiService)
+	}
 	providerRelay := services.NewProviderRelayService(providerService, ":18100")
 	claudeSettings := services.NewClaudeSettingsService(providerRelay.Addr())
 	codexSettings := services.NewCodexSettingsService(providerRelay.Addr())
@@ -113,7 +178,9 @@ func main() {
 	picoClawSettings := services.NewPicoClawSettingsService(providerRelay.Addr())
 	cliCenterService := services.NewCLICenterService(claudeSettings, codexSettings, geminiCliSettings, picoClawSettings, providerRelay.Addr())
 	logService := services.NewLogService()
+	transcriptService := services.NewTranscriptService(logService)
 	autoStartService := services.NewAutoStartService()
+	hotkeyService := services.NewHotkeyService()
 	appSettings := services.NewAppSettingsService(autoStartService)
 	mcpService := services.NewMCPService()
 	skillService := services.NewSkillService()
@@ -124,6 +191,7 @@ func main() {
 	// 初始化同步服务（多端同步功能）
 	syncSettingsService := services.NewSyncSettingsService()
 	services.InitSyncIntegration(syncSettingsService)
+	services.RegisterSyncAppliers(syncSettingsService, providerService, appSettings)
 
 	// Initialize K3s cluster management service (Admin Gateway)
 	clusterService := cluster.NewClusterService()
@@ -135,6 +203,8 @@ func main() {
 
 	// Initialize Distributor service (AI Evangelist Mode)
 	distributorService := distributor.NewDistributorService()
+	diagnosticsService := services.NewDiagnosticsService(AppVersion, providerRelay, crashReports, appSettings)
+	promptLibraryService := services.NewPromptLibraryService(providerRelay)
 	if si := services.GetSyncIntegration(); si != nil {
 		providerRelay.SetSyncIntegration(si)
 		if si.IsEnabled() {
@@ -150,6 +220,77 @@ func main() {
 			log.Printf("[Ailurus PaaS] Body logging enabled from config")
 		}
 
+		// 请求体大小上限
+		providerRelay.SetMaxRequestBodySize(int64(settings.MaxRequestBodyMB) << 20)
+
+		// provider 挂起 / 恢复事件 webhook
+		providerRelay.SetProviderEventWebhook(settings.ProviderEventWebhook)
+
+		// 429/529 时排队重试同一 provider，保留 prompt cache
+		providerRelay.SetStickyRetryMaxWait(time.Duration(settings.StickyRetryMaxWaitSec) * time.Second)
+
+		// 客户端断开后继续接收可续传的流式响应
+		providerRelay.SetStreamResumeWindow(time.Duration(settings.StreamResumeSec) * time.Second)
+
+		// 公开只读状态页
+		providerRelay.SetPublicStatusPage(settings.PublicStatusPage)
+
+		// 慢请求剖析
+		providerRelay.SetSlowRequestThreshold(time.Duration(settings.SlowRequestThresholdMs) * time.Millisecond)
+
+		// /v1/batch 批量请求并发上限
+		providerRelay.SetBatchConcurrency(settings.BatchConcurrency)
+
+		// 达到花费预算后改用兜底（本地）provider
+		if settings.LocalFallbackOnBudget {
+			providerRelay.SetBudgetFallback(settings.DailyBudgetUSD, settings.MonthlyBudgetUSD)
+		}
+
+		// 本机调试端口（pprof / expvar）
+		if err := diagnosticsService.ApplyDebugServer(settings.DebugServerEnabled, settings.DebugServerPort); err != nil {
+			log.Printf("[Diagnostics] %v", err)
+		}
+
+		// 浏览器客户端跨域访问
+		if err := providerRelay.SetCORSConfig(settings.CORS()); err != nil {
+			log.Printf("[CORS] %v, cross-origin access disabled", err)
+		}
+
+		// 入站 IP 允许 / 拒绝名单
+		if err := providerRelay.SetIPAccessConfig(settings.IPAccess()); err != nil {
+			log.Printf("[IPAccess] %v, inbound IP filtering disabled", err)
+		}
+
+		// 按来源 IP 的请求频率 / 并发限制与临时封禁
+		if err := providerRelay.SetAbuseConfig(settings.Abuse()); err != nil {
+			log.Printf("[Abuse] %v, abuse protection disabled", err)
+		}
+
+		// HTTPS 监听与客户端证书认证
+		if err := providerRelay.SetMTLSConfig(settings.MTLS()); err != nil {
+			log.Printf("[mTLS] %v, relay listens on plain HTTP", err)
+		}
+
+		// 日志队列写满时的策略
+		providerRelay.SetLogOverflowPolicy(services.LogOverflowPolicy{
+			Mode:      settings.LogOverflowPolicy,
+			MaxWaitMs: settings.LogOverflowMaxWaitMs,
+		})
+
+		// 统计分桶时区（默认本机时区）
+		if err := services.SetStatsTimezone(settings.StatsTimezone); err != nil {
+			log.Printf("[Stats] %v, falling back to local time zone", err)
+		}
+
+		// 上游超时（provider 未单独配置时生效）
+		providerRelay.SetTimeoutSettings(services.TimeoutSettings{
+			ConnectSec:     settings.UpstreamConnectTimeoutSec,
+			ReadSec:        settings.UpstreamReadTimeoutSec,
+			TotalSec:       settings.UpstreamTimeoutSec,
+			StreamTotalSec: settings.UpstreamStreamTimeoutSec,
+			MaxClientSec:   settings.MaxClientTimeoutSec,
+		})
+
 		// NEW-API 统一网关配置
 		if settings.NewAPIEnabled && settings.NewAPIURL != "" && settings.NewAPIToken != "" {
 			providerRelay.SetNewAPIConfig(settings.NewAPIURL, settings.NewAPIToken)
@@ -158,10 +299,23 @@ func main() {
 		}
 	}
 
+	// OAuth 订阅账号（Claude Max / ChatGPT）登录
+	oauthService := services.NewOAuthService()
+	providerRelay.SetOAuthService(oauthService)
+
+	// NEW-API 余额与渠道查询
+	newAPIService := services.NewNewAPIService(providerRelay, appSettings)
+
+	// 桌面通知：provider 故障 / 预算 / 转发服务异常 / 导出完成；需在转发服务启动前订阅
+	notificationService := services.NewNotificationService(appSettings)
+	notificationService.Watch(providerRelay)
+	nativeNotifications := notifications.New()
+
 	// 执行数据迁移（将 Google Gemini 从 Codex 迁移到 Gemini-CLI）
 	providerRelay.RunMigrations()
 
 	go func() {
+		defer services.RecoverPanic("relay start")
 		if err := providerRelay.Start(); err != nil {
 			log.Printf("provider relay start error: %v", err)
 		}
@@ -187,18 +341,27 @@ func main() {
 			application.NewService(picoClawSettings),
 			application.NewService(cliCenterService),
 			application.NewService(logService),
+			application.NewService(transcriptService),
 			application.NewService(appSettings),
+			application.NewService(hotkeyService),
+			application.NewService(notificationService),
+			application.NewService(nativeNotifications),
+			application.NewService(newAPIService),
+			application.NewService(oauthService),
 			application.NewService(mcpService),
 			application.NewService(skillService),
 			application.NewService(importService),
 			application.NewService(dockService),
 			application.NewService(versionService),
+			application.NewService(crashReports),
 			application.NewService(syncSettingsService),
 			application.NewService(clusterService),
 			application.NewService(membershipService),
 			application.NewService(monitoringService),
 			application.NewService(agentService),
 			application.NewService(distributorService),
+			application.NewService(diagnosticsService),
+			application.NewService(promptLibraryService),
 		},
 		Assets: application.AssetOptions{
 			Handler: application.AssetFileServerFS(assets),
@@ -209,6 +372,8 @@ func main() {
 	})
 
 	app.OnShutdown(func() {
+		_ = hotkeyService.Stop()
+		versionService.updater.StopAutoCheck()
 		_ = providerRelay.Stop()
 		_ = syncSettingsService.ServiceShutdown()
 
@@ -220,6 +385,14 @@ func main() {
 				log.Printf("[Recovery] Normal shutdown completed")
 			}
 		}
+
+		// 释放单实例锁后安装已下载的更新，重新启动的新版本可立即获取锁
+		if instanceLock != nil {
+			instanceLock.Release()
+		}
+		if err := versionService.updater.ApplyStagedUpdate(); err != nil {
+			log.Printf("[Update] failed to install update: %v", err)
+		}
 	})
 
 	// Create a new window with the necessary options.
@@ -299,14 +472,36 @@ func main() {
 	}
 
 	trayMenu := application.NewMenu()
-	trayMenu.Add("显示主窗口").OnClick(func(ctx *application.Context) {
-		showMainWindow(true)
-	})
-	trayMenu.Add("退出").OnClick(func(ctx *application.Context) {
-		app.Quit()
-	})
+	var refreshTrayMenu func()
+	buildTrayMenu := func() {
+		trayMenu.Add("显示主窗口").OnClick(func(ctx *application.Context) {
+			showMainWindow(true)
+		})
+		trayMenu.AddSeparator()
+		// 按平台快速固定 provider
+		addProviderMenus(trayMenu, providerService, providerRelay, refreshTrayMenu)
+		trayMenu.AddSeparator()
+		trayMenu.Add("退出").OnClick(func(ctx *application.Context) {
+			app.Quit()
+		})
+	}
+	var trayMenuMu sync.Mutex
+	refreshTrayMenu = func() {
+		trayMenuMu.Lock()
+		defer trayMenuMu.Unlock()
+		trayMenu.Clear()
+		buildTrayMenu()
+		trayMenu.Update()
+	}
+	buildTrayMenu()
 	systray.SetMenu(trayMenu)
 
+	// 打开菜单前刷新，使 provider 列表与主窗口中的修改保持一致
+	systray.OnRightClick(func() {
+		refreshTrayMenu()
+		systray.OpenMenu()
+	})
+
 	systray.OnClick(func() {
 		if !mainWindow.IsVisible() {
 			showMainWindow(true)
@@ -317,8 +512,103 @@ func main() {
 		}
 	})
 
+	// 全局快捷键：显示主窗口 / 暂停或恢复转发 / 切换固定的 provider
+	hotkeyService.OnAction(services.HotkeyActionShowWindow, func(services.HotkeyBinding) {
+		showMainWindow(true)
+	})
+	hotkeyService.OnAction(services.HotkeyActionToggleProxy, func(services.HotkeyBinding) {
+		paused := !providerRelay.IsRelayPaused()
+		providerRelay.SetRelayPaused(paused)
+		app.Event.Emit("relay:paused", paused)
+	})
+	hotkeyService.OnAction(services.HotkeyActionCycleProvider, func(binding services.HotkeyBinding) {
+		if _, err := providerRelay.CyclePinnedProvider(binding.Platform); err != nil {
+			log.Printf("[Hotkey] failed to switch %s provider: %v", binding.Platform, err)
+		}
+	})
+	// Carbon / Win32 快捷键需在应用事件循环启动后注册；启动后开始发送系统通知
+	app.Event.OnApplicationEvent(events.Common.ApplicationStarted, func(event *application.ApplicationEvent) {
+		_ = hotkeyService.Start()
+		// 托盘图标角标与提示随转发状态更新
+		go watchTrayStatus(systray, providerRelay)
+		// 后台定时检查更新
+		versionService.updater.StartAutoCheck()
+		// 上次运行崩溃或出现 panic 时在界面中提示
+		if reports, err := crashReports.GetUnseenCrashReports(); err == nil && len(reports) > 0 {
+			app.Event.Emit("crash-report:pending", reports)
+		}
+		// 数据库在本次启动时被修复，提示丢失的数据
+		if dbRepair.Corrupted {
+			app.Event.Emit("recovery:database", dbRepair)
+		}
+		// 再次启动应用时显示并聚焦主窗口
+		if instanceLock != nil {
+			instanceLock.OnActivate(func([]string) {
+				showMainWindow(true)
+			})
+		}
+		// 系统通知需在应用启动后发送，macOS 首次使用时请求授权
+		go func() {
+			if authorized, err := nativeNotifications.RequestNotificationAuthorization(); err != nil || !authorized {
+				log.Printf("[Notification] notifications not authorized: %v", err)
+			}
+			notificationService.SetSender(func(n services.Notification) error {
+				data := map[string]interface{}{"category": n.Category}
+				if n.Link != nil {
+					data["link"] = n.Link.URL()
+				}
+				return nativeNotifications.SendNotification(notifications.NotificationOptions{
+					ID:    n.ID,
+					Title: n.Title,
+					Body:  n.Body,
+					Data:  data,
+				})
+			})
+			// 点击带链接的通知时在新的日志窗口中打开对应请求
+			nativeNotifications.OnNotificationResponse(func(result notifications.NotificationResult) {
+				if result.Error != nil {
+					return
+				}
+				if route, ok := result.Response.UserInfo["link"].(string); ok && strings.HasPrefix(route, "/#/logs") {
+					appservice.openLogsWindow(route)
+				}
+			})
+		}()
+	})
+
 	appservice.SetApp(app)
 
+	// provider 挂起 / 恢复事件推送到前端
+	providerRelay.OnProviderEvent(func(event services.ProviderEvent) {
+		app.Event.Emit(event.Type, event)
+		// 挂起 / 恢复 / 固定状态变化时同步托盘菜单
+		refreshTrayMenu()
+	})
+
+	// 新写入的请求日志推送到日志窗口（live tail）
+	providerRelay.OnRequestLog(func(log services.ReqeustLog) {
+		app.Event.Emit("request-log:new", log)
+	})
+
+	// 日志队列溢出（丢弃 / 暂存磁盘）时在界面中提示
+	providerRelay.OnLogOverflow(func(event services.LogOverflowEvent) {
+		app.Event.Emit("log-queue:overflow", event)
+	})
+
+	// 日志导出进度
+	providerRelay.OnLogExportProgress(func(progress services.LogExportProgress) {
+		app.Event.Emit("log-export:progress", progress)
+	})
+
+	// 更新下载进度与自动检查发现的新版本
+	versionService.updater.OnProgress(func(progress services.UpdateProgress) {
+		app.Event.Emit("update:progress", progress)
+	})
+	versionService.updater.OnUpdateAvailable(func(info services.UpdateInfo) {
+		app.Event.Emit("update:available", info)
+	})
+	versionService.quit = app.Quit
+
 	// Create a goroutine that emits an event containing the current time every second.
 	// The frontend can listen to this event and update the UI accordingly.
 	go func() {
@@ -0,0 +1,3 @@
+module github.com/aspect-code/codeswitch/pkg/invoicepdf
+
+go 1.24
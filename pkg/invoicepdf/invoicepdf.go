@@ -0,0 +1,331 @@
+// Package invoicepdf renders invoices as PDF documents.
+//
+// It is shared by the desktop billing service and the sync-service admin API, which keep
+// their own invoice models and convert them to Invoice. The package depends only on the
+// standard library so that both modules can require it through a local replace directive.
+package invoicepdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Invoice is the printable content of an invoice; amounts are in cents of Currency
+type Invoice struct {
+	Number        string
+	SellerName    string
+	SellerAddress string
+	SellerTaxID   string
+	BillTo        []string // lines under "Bill to", e.g. customer name and user ID
+	Details       []string // lines under "Details", e.g. payment method and reference
+	Currency      string
+	Lines         []Line
+	SubtotalCents int64
+	TaxRate       float64 // percent
+	TaxCents      int64
+	TotalCents    int64
+	PaidAt        *time.Time
+	IssuedAt      time.Time
+}
+
+// Line is a single invoice line item
+type Line struct {
+	Description string
+	Quantity    int
+	UnitCents   int64
+	AmountCents int64
+}
+
+// A4 page size in points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+)
+
+type pdfFont int
+
+const (
+	pdfRegular pdfFont = iota
+	pdfBold
+)
+
+// pdfDocument is a minimal uncompressed PDF writer for invoices.
+// Latin text uses the standard Helvetica fonts; anything else is drawn with the
+// non-embedded Adobe-GB1 font STSong-Light, which every conforming reader provides.
+type pdfDocument struct {
+	pages []*bytes.Buffer
+}
+
+func (d *pdfDocument) addPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+}
+
+func (d *pdfDocument) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.addPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// text draws s with its baseline starting at (x, y), measured from the bottom-left corner
+func (d *pdfDocument) text(x, y, size float64, font pdfFont, s string) {
+	if s == "" {
+		return
+	}
+	name, operand := "F1", "("+pdfEscape(s)+")"
+	if font == pdfBold {
+		name = "F2"
+	}
+	if !pdfIsLatin(s) {
+		name, operand = "F3", "<"+pdfUCS2(s)+">"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %.2f Tf %.2f %.2f Td %s Tj ET\n", name, size, x, y, operand)
+}
+
+// textRight draws s so that it ends at x
+func (d *pdfDocument) textRight(x, y, size float64, font pdfFont, s string) {
+	d.text(x-pdfTextWidth(s, size), y, size, font, s)
+}
+
+func (d *pdfDocument) line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.page(), "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// fillRect fills a rectangle with a gray level between 0 (black) and 1 (white)
+func (d *pdfDocument) fillRect(x, y, w, h, gray float64) {
+	fmt.Fprintf(d.page(), "q %.2f g %.2f %.2f %.2f %.2f re f Q\n", gray, x, y, w, h)
+}
+
+// bytes serializes the document: catalog, page tree, fonts, then a page and content stream per page
+func (d *pdfDocument) bytes() []byte {
+	if len(d.pages) == 0 {
+		d.addPage()
+	}
+	const fixedObjects = 7
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // page tree, filled in below
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [6 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light" +
+			" /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >>" +
+			" /FontDescriptor 7 0 R /DW 1000 /W [1 95 500] >>",
+		"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880]" +
+			" /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+	}
+	kids := make([]string, len(d.pages))
+	for i, content := range d.pages {
+		pageID := fixedObjects + 2*i + 1
+		kids[i] = fmt.Sprintf("%d 0 R", pageID)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f]"+
+				" /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, pageID+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfIsLatin reports whether s can be drawn with the WinAnsi Helvetica fonts (printable ASCII)
+func pdfIsLatin(s string) bool {
+	for _, r := range s {
+		if r < 32 || r > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
+
+// pdfUCS2 hex-encodes s for the UniGB-UCS2-H CMap; characters outside the BMP become '?'
+func pdfUCS2(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > 0xFFFF || utf16.IsSurrogate(r) {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// helveticaWidths glyph widths of printable ASCII (32-126) in 1/1000 em, from the Helvetica AFM.
+// Helvetica-Bold differs only slightly and shares the digits, so amounts line up in both.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// pdfTextWidth returns the width of s in points at the given font size
+func pdfTextWidth(s string, size float64) float64 {
+	units := 0
+	latin := pdfIsLatin(s)
+	for _, r := range s {
+		switch {
+		case latin:
+			units += helveticaWidths[r-32]
+		case r < 128:
+			units += 500 // STSong-Light half-width glyphs
+		default:
+			units += 1000
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// pdfTruncate shortens s with "..." so that it fits within width points
+func pdfTruncate(s string, size, width float64) string {
+	if pdfTextWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimSpace(string(runes)) + "..."
+		if pdfTextWidth(candidate, size) <= width {
+			return candidate
+		}
+	}
+	return "..."
+}
+
+// Render lays out an invoice on A4 pages
+func Render(invoice *Invoice) []byte {
+	const (
+		left     = 50.0
+		right    = pdfPageWidth - 50
+		qtyX     = 360.0
+		unitX    = 460.0
+		rowStep  = 18.0
+		minRowsY = 150.0
+		descSize = 10.0
+		descMax  = qtyX - left - 50
+	)
+	var doc pdfDocument
+	date := func(t time.Time) string { return t.Format("2006-01-02") }
+
+	// Header: seller on the left, invoice number and dates on the right
+	y := pdfPageHeight - 60
+	doc.text(left, y, 16, pdfBold, invoice.SellerName)
+	doc.textRight(right, y, 20, pdfBold, "INVOICE")
+	y -= 20
+	doc.text(left, y, 9, pdfRegular, invoice.SellerAddress)
+	doc.textRight(right, y, 10, pdfRegular, "No. "+invoice.Number)
+	y -= 14
+	if invoice.SellerTaxID != "" {
+		doc.text(left, y, 9, pdfRegular, "Tax ID: "+invoice.SellerTaxID)
+	}
+	doc.textRight(right, y, 10, pdfRegular, "Issued: "+date(invoice.IssuedAt))
+	if invoice.PaidAt != nil {
+		y -= 14
+		doc.textRight(right, y, 10, pdfRegular, "Paid: "+date(*invoice.PaidAt))
+	}
+	y -= 16
+	doc.line(left, y, right, y, 1)
+
+	// Customer and payment details
+	y -= 22
+	doc.text(left, y, 10, pdfBold, "Bill to")
+	doc.text(330, y, 10, pdfBold, "Details")
+	billTo, details := invoice.BillTo, invoice.Details
+	for i := 0; i < len(billTo) || i < len(details); i++ {
+		y -= 14
+		if i < len(billTo) {
+			doc.text(left, y, 9, pdfRegular, pdfTruncate(billTo[i], 9, 270))
+		}
+		if i < len(details) {
+			doc.text(330, y, 9, pdfRegular, pdfTruncate(details[i], 9, right-330))
+		}
+	}
+
+	// Line items, continued on new pages when they do not fit
+	tableHeader := func() {
+		doc.fillRect(left, y-6, right-left, 20, 0.92)
+		doc.text(left+5, y, 9, pdfBold, "Description")
+		doc.textRight(qtyX, y, 9, pdfBold, "Qty")
+		doc.textRight(unitX, y, 9, pdfBold, "Unit price")
+		doc.textRight(right-5, y, 9, pdfBold, "Amount")
+	}
+	y -= 36
+	tableHeader()
+	for _, line := range invoice.Lines {
+		y -= rowStep + 4
+		if y < minRowsY {
+			doc.addPage()
+			y = pdfPageHeight - 60
+			tableHeader()
+			y -= rowStep + 4
+		}
+		doc.text(left+5, y, descSize, pdfRegular, pdfTruncate(line.Description, descSize, descMax))
+		doc.textRight(qtyX, y, descSize, pdfRegular, strconv.Itoa(line.Quantity))
+		doc.textRight(unitX, y, descSize, pdfRegular, FormatAmount(line.UnitCents, invoice.Currency))
+		doc.textRight(right-5, y, descSize, pdfRegular, FormatAmount(line.AmountCents, invoice.Currency))
+	}
+	y -= 12
+	doc.line(left, y, right, y, 0.5)
+
+	// Totals
+	totals := []struct {
+		label string
+		cents int64
+		font  pdfFont
+	}{
+		{"Subtotal", invoice.SubtotalCents, pdfRegular},
+		{"Tax (" + strconv.FormatFloat(invoice.TaxRate, 'f', -1, 64) + "%)", invoice.TaxCents, pdfRegular},
+		{"Total", invoice.TotalCents, pdfBold},
+	}
+	for _, total := range totals {
+		y -= rowStep
+		doc.textRight(unitX, y, 10, total.font, total.label)
+		doc.textRight(right-5, y, 10, total.font, FormatAmount(total.cents, invoice.Currency))
+	}
+
+	doc.text(left, 60, 8, pdfRegular, "All amounts in "+invoice.Currency+"; prices include tax.")
+	doc.text(left, 48, 8, pdfRegular, "This invoice was generated electronically and is valid without a signature.")
+	return doc.bytes()
+}
+
+// FormatAmount formats cents with thousands separators, e.g. "CNY 1,234.56"
+func FormatAmount(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	units := strconv.FormatInt(cents/100, 10)
+	var grouped strings.Builder
+	for i, digit := range units {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return fmt.Sprintf("%s %s%s.%02d", currency, sign, grouped.String(), cents%100)
+}
@@ -0,0 +1,121 @@
+package invoicepdf
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkPDFStructure verifies the xref table points at every object and stream lengths are exact
+func checkPDFStructure(t *testing.T, data []byte) {
+	t.Helper()
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("missing startxref trailer")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("empty xref table")
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj"; !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %.20q", i+1, data[offset:])
+		}
+	}
+	for _, loc := range regexp.MustCompile(`/Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(data, -1) {
+		length, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		if !bytes.HasPrefix(data[loc[1]+length:], []byte("endstream")) {
+			t.Fatal("stream length does not match its content")
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	paidAt := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	invoice := &Invoice{
+		Number:        "INV-2026-000042",
+		SellerName:    "代码切换科技",
+		SellerTaxID:   "91330100MA2XXXXX",
+		BillTo:        []string{"alice", "User ID: u1"},
+		Details:       []string{"Payment method: WeChat Pay", "Reference: CS20261018"},
+		Currency:      "CNY",
+		Lines:         []Line{{Description: "Credits recharge (Pro)", Quantity: 1, UnitCents: 123456, AmountCents: 123456}},
+		SubtotalCents: 116468,
+		TaxRate:       6,
+		TaxCents:      6988,
+		TotalCents:    123456,
+		PaidAt:        &paidAt,
+		IssuedAt:      paidAt,
+	}
+
+	data := Render(invoice)
+	checkPDFStructure(t, data)
+	for _, want := range []string{
+		"(No. INV-2026-000042)",
+		"(CNY 1,234.56)",
+		"(Tax \\(6%\\))",
+		"(Payment method: WeChat Pay)",
+		"(User ID: u1)",
+		"<4EE378015207636279D16280>", // 代码切换科技 in UCS-2
+		"/BaseFont /STSong-Light",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("pdf does not contain %s", want)
+		}
+	}
+	if !bytes.Contains(data, []byte("/Count 1 >>")) {
+		t.Error("a single line invoice should fit on one page")
+	}
+
+	// Long invoices continue on further pages
+	for i := 0; i < 40; i++ {
+		invoice.Lines = append(invoice.Lines, invoice.Lines[0])
+	}
+	data = Render(invoice)
+	checkPDFStructure(t, data)
+	if !bytes.Contains(data, []byte("/Count 2 >>")) {
+		t.Error("41 lines should take two pages")
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	cases := map[int64]string{
+		0:         "CNY 0.00",
+		5:         "CNY 0.05",
+		2990:      "CNY 29.90",
+		123456:    "CNY 1,234.56",
+		123456789: "CNY 1,234,567.89",
+		-2990:     "CNY -29.90",
+	}
+	for cents, want := range cases {
+		if got := FormatAmount(cents, "CNY"); got != want {
+			t.Errorf("FormatAmount(%d) = %q, want %q", cents, got, want)
+		}
+	}
+}
+
+func TestPDFText(t *testing.T) {
+	if got := pdfEscape(`a(b)\c`); got != `a\(b\)\\c` {
+		t.Errorf("pdfEscape = %q", got)
+	}
+	if got := pdfUCS2("A发😀"); got != "004153D1003F" {
+		t.Errorf("pdfUCS2 = %q", got)
+	}
+	// Helvetica: "0" is 556 units
+	if got := pdfTextWidth("00", 10); got != 11.12 {
+		t.Errorf("width = %v, want 11.12", got)
+	}
+	long := strings.Repeat("Subscription renewal ", 10)
+	short := pdfTruncate(long, 10, 100)
+	if !strings.HasSuffix(short, "...") || pdfTextWidth(short, 10) > 100 {
+		t.Errorf("pdfTruncate = %q", short)
+	}
+}
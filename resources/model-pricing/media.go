@@ -0,0 +1,86 @@
+package modelpricing
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MediaUsage 描述一次图片 / 语音请求的用量。
+type MediaUsage struct {
+	Images     int     // 生成图片数量
+	Size       string  // 图片尺寸，如 1024x1024
+	Quality    string  // 图片质量，如 standard / hd
+	Seconds    float64 // 音频时长（转写 / 翻译）
+	Characters int     // 输入字符数（语音合成）
+}
+
+// CalculateMediaCost 按张 / 按像素 / 按秒 / 按字符计算多媒体请求费用（美元）。
+func (s *Service) CalculateMediaCost(model string, usage MediaUsage) CostBreakdown {
+	if s == nil || model == "" {
+		return CostBreakdown{}
+	}
+
+	entry, hasPricing := s.mediaPricing(model, usage)
+	breakdown := CostBreakdown{HasPricing: hasPricing}
+	if entry == nil {
+		return breakdown
+	}
+
+	if usage.Images > 0 {
+		images := float64(usage.Images)
+		if entry.OutputCostPerImage > 0 {
+			breakdown.OutputCost = images * entry.OutputCostPerImage
+		} else if pixels := parseImagePixels(usage.Size); pixels > 0 {
+			breakdown.InputCost = images * float64(pixels) * entry.InputCostPerPixel
+		}
+	}
+	if usage.Seconds > 0 {
+		breakdown.InputCost += usage.Seconds * entry.InputCostPerSecond
+	}
+	if usage.Characters > 0 {
+		breakdown.InputCost += float64(usage.Characters) * entry.InputCostPerCharacter
+	}
+
+	breakdown.TotalCost = breakdown.InputCost + breakdown.OutputCost
+	if breakdown.TotalCost > 0 {
+		breakdown.HasPricing = true
+	}
+	return breakdown
+}
+
+// mediaPricing 图片模型价格按 "质量/尺寸/模型" 存储，优先匹配最具体的键。
+func (s *Service) mediaPricing(model string, usage MediaUsage) (*PricingEntry, bool) {
+	if usage.Images > 0 {
+		size := strings.ReplaceAll(strings.ToLower(usage.Size), "x", "-x-")
+		if size == "" {
+			size = "1024-x-1024"
+		}
+		quality := strings.ToLower(usage.Quality)
+		if quality == "" || quality == "auto" {
+			quality = "standard"
+		}
+		s.mu.RLock()
+		for _, key := range []string{quality + "/" + size + "/" + model, size + "/" + model} {
+			if entry, ok := s.pricingMap[key]; ok {
+				s.mu.RUnlock()
+				return entry, true
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return s.getPricing(model)
+}
+
+// parseImagePixels 解析 "1024x1536" 形式的尺寸为像素数。
+func parseImagePixels(size string) int64 {
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) != 2 {
+		return 1024 * 1024
+	}
+	w, errW := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	h, errH := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	if errW != nil || errH != nil {
+		return 1024 * 1024
+	}
+	return w * h
+}
@@ -0,0 +1,185 @@
+package modelpricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TokenCount 兼容以数字或数字字符串给出的 token 数，其他取值（如说明文字）视为 0。
+type TokenCount int
+
+// UnmarshalJSON 实现 json.Unmarshaler。
+func (t *TokenCount) UnmarshalJSON(data []byte) error {
+	var number float64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*t = TokenCount(number)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(text)); err == nil {
+			*t = TokenCount(n)
+			return nil
+		}
+	}
+	*t = 0
+	return nil
+}
+
+// ModelInfo 模型的上下文窗口、能力标记与单价（内置数据与用户覆盖合并后的结果）。
+type ModelInfo struct {
+	Model              string  `json:"model"`
+	ContextWindow      int     `json:"context_window"`
+	MaxOutputTokens    int     `json:"max_output_tokens"`
+	Vision             *bool   `json:"vision,omitempty"`
+	Tools              *bool   `json:"tools,omitempty"`
+	JSONMode           *bool   `json:"json_mode,omitempty"`
+	Reasoning          *bool   `json:"reasoning,omitempty"`
+	InputCostPerToken  float64 `json:"input_cost_per_token"`
+	OutputCostPerToken float64 `json:"output_cost_per_token"`
+	Overridden         bool    `json:"overridden"`
+}
+
+// inheritModelInfo 沿用 from 中本条目未设置的上下文窗口与能力标记。
+func (e *PricingEntry) inheritModelInfo(from *PricingEntry) {
+	if e.MaxInputTokens == 0 {
+		e.MaxInputTokens = from.MaxInputTokens
+	}
+	if e.MaxOutputTokens == 0 {
+		e.MaxOutputTokens = from.MaxOutputTokens
+	}
+	if e.SupportsVision == nil {
+		e.SupportsVision = from.SupportsVision
+	}
+	if e.SupportsFunctionCalling == nil {
+		e.SupportsFunctionCalling = from.SupportsFunctionCalling
+	}
+	if e.SupportsResponseSchema == nil {
+		e.SupportsResponseSchema = from.SupportsResponseSchema
+	}
+	if e.SupportsReasoning == nil {
+		e.SupportsReasoning = from.SupportsReasoning
+	}
+}
+
+// SetOverrides 替换用户覆盖层：每个模型的字段合并到同名（或规范化后同名）的内置条目之上，
+// 内置数据中没有的模型直接新增。传入空集合即清除全部覆盖。
+func (s *Service) SetOverrides(overrides map[string]json.RawMessage) error {
+	if s == nil {
+		return nil
+	}
+	layer := make(map[string]*PricingEntry, len(overrides))
+	normalized := make(map[string]string, len(overrides))
+	s.mu.RLock()
+	for model, raw := range overrides {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			s.mu.RUnlock()
+			return fmt.Errorf("model %s: %w", model, err)
+		}
+		var entry PricingEntry
+		if base := s.baseEntryLocked(model); base != nil {
+			entry = *base
+		}
+		// 覆盖了输入单价但未指定缓存单价时按新输入单价重新推算
+		if _, ok := fields["input_cost_per_token"]; ok {
+			if _, set := fields["cache_creation_input_token_cost"]; !set {
+				entry.CacheCreationInputTokenCost = 0
+			}
+			if _, set := fields["cache_read_input_token_cost"]; !set {
+				entry.CacheReadInputTokenCost = 0
+			}
+		}
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			s.mu.RUnlock()
+			return fmt.Errorf("model %s: %w", model, err)
+		}
+		ensureCachePricing(&entry)
+		layer[model] = &entry
+		normalized[normalizeName(model)] = model
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	s.overrides = layer
+	s.overrideNormalized = normalized
+	s.mu.Unlock()
+	s.clearLookupCache()
+	return nil
+}
+
+// OverriddenModels 返回当前被用户覆盖的模型名。
+func (s *Service) OverriddenModels() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	models := make([]string, 0, len(s.overrides))
+	for model := range s.overrides {
+		models = append(models, model)
+	}
+	return models
+}
+
+// ModelInfo 按模型名（精确、去除区域 / provider 前缀或规范化后匹配，不做模糊匹配）查找模型数据。
+func (s *Service) ModelInfo(model string) (ModelInfo, bool) {
+	if s == nil || model == "" {
+		return ModelInfo{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry := s.overrideEntryLocked(model)
+	overridden := entry != nil
+	if entry == nil {
+		entry = s.baseEntryLocked(model)
+	}
+	if entry == nil {
+		return ModelInfo{}, false
+	}
+	return ModelInfo{
+		Model:              model,
+		ContextWindow:      int(entry.MaxInputTokens),
+		MaxOutputTokens:    int(entry.MaxOutputTokens),
+		Vision:             entry.SupportsVision,
+		Tools:              entry.SupportsFunctionCalling,
+		JSONMode:           entry.SupportsResponseSchema,
+		Reasoning:          entry.SupportsReasoning,
+		InputCostPerToken:  entry.InputCostPerToken,
+		OutputCostPerToken: entry.OutputCostPerToken,
+		Overridden:         overridden,
+	}, true
+}
+
+// overrideEntryLocked 在覆盖层中查找模型，调用方需持有读锁。
+func (s *Service) overrideEntryLocked(model string) *PricingEntry {
+	if len(s.overrides) == 0 {
+		return nil
+	}
+	return strictLookup(s.overrides, s.overrideNormalized, model)
+}
+
+// baseEntryLocked 在内置数据与运行时登记的价格中查找模型，调用方需持有读锁。
+func (s *Service) baseEntryLocked(model string) *PricingEntry {
+	return strictLookup(s.pricingMap, s.normalized, model)
+}
+
+// strictLookup 精确、去除区域 / provider 前缀或规范化后匹配。
+func strictLookup(entries map[string]*PricingEntry, normalized map[string]string, model string) *PricingEntry {
+	if entry, ok := entries[model]; ok {
+		return entry
+	}
+	withoutRegion := stripRegionPrefix(model)
+	if entry, ok := entries[withoutRegion]; ok {
+		return entry
+	}
+	if entry, ok := entries[strings.TrimPrefix(withoutRegion, "anthropic.")]; ok {
+		return entry
+	}
+	if key, ok := normalized[normalizeName(model)]; ok {
+		return entries[key]
+	}
+	return nil
+}
@@ -20,11 +20,16 @@ var (
 
 // Service 提供模型价格相关的计算能力。
 type Service struct {
+	mu           sync.RWMutex // 保护 pricingMap / normalized（运行时可注册价格）
 	pricingMap   map[string]*PricingEntry
 	normalized   map[string]string
 	ephemeral1h  map[string]float64
 	longContexts map[string]LongContextPricing
 	lookupCache  sync.Map // 缓存模型名到 pricing entry 的映射
+
+	// 用户覆盖文件合并后的条目，优先于内置数据与运行时登记的价格
+	overrides          map[string]*PricingEntry
+	overrideNormalized map[string]string
 }
 
 // PricingEntry 映射 JSON 内的字段。
@@ -38,6 +43,21 @@ type PricingEntry struct {
 	InputCostPerTokenAbove200k          float64 `json:"input_cost_per_token_above_200k_tokens"`
 	InputCostPerTokenAbove128k          float64 `json:"input_cost_per_token_above_128k_tokens"`
 	OutputCostPerTokenAbove200k         float64 `json:"output_cost_per_token_above_200k_tokens"`
+
+	// 多媒体计费（图片 / 语音）
+	InputCostPerPixel     float64 `json:"input_cost_per_pixel"`
+	OutputCostPerImage    float64 `json:"output_cost_per_image"`
+	InputCostPerSecond    float64 `json:"input_cost_per_second"`
+	OutputCostPerSecond   float64 `json:"output_cost_per_second"`
+	InputCostPerCharacter float64 `json:"input_cost_per_character"`
+
+	// 上下文窗口与能力标记；未声明的能力为 nil
+	MaxInputTokens          TokenCount `json:"max_input_tokens"`
+	MaxOutputTokens         TokenCount `json:"max_output_tokens"`
+	SupportsVision          *bool      `json:"supports_vision,omitempty"`
+	SupportsFunctionCalling *bool      `json:"supports_function_calling,omitempty"`
+	SupportsResponseSchema  *bool      `json:"supports_response_schema,omitempty"`
+	SupportsReasoning       *bool      `json:"supports_reasoning,omitempty"`
 }
 
 // UsageSnapshot 描述一次请求的 token 用量。
@@ -156,6 +176,15 @@ func (s *Service) getPricing(model string) (*PricingEntry, bool) {
 		return cached.(*PricingEntry), true
 	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// 用户覆盖优先
+	if entry := s.overrideEntryLocked(model); entry != nil {
+		s.lookupCache.Store(model, entry)
+		return entry, true
+	}
+
 	// 精确匹配
 	if entry, ok := s.pricingMap[model]; ok {
 		s.lookupCache.Store(model, entry)
@@ -206,6 +235,31 @@ func (s *Service) getPricing(model string) (*PricingEntry, bool) {
 	return nil, false
 }
 
+// RegisterPricing 在运行时注册或覆盖模型单价（如聚合平台同步的上游价格）。
+func (s *Service) RegisterPricing(model string, entry PricingEntry) {
+	if s == nil || model == "" {
+		return
+	}
+	ensureCachePricing(&entry)
+	s.mu.Lock()
+	if existing, ok := s.pricingMap[model]; ok {
+		// 上游价格不含上下文窗口与能力标记，沿用已有数据
+		entry.inheritModelInfo(existing)
+	}
+	s.pricingMap[model] = &entry
+	s.normalized[normalizeName(model)] = model
+	s.mu.Unlock()
+	s.clearLookupCache()
+}
+
+// clearLookupCache 价格变化后清空查找缓存，避免命中旧的模糊匹配结果。
+func (s *Service) clearLookupCache() {
+	s.lookupCache.Range(func(key, _ any) bool {
+		s.lookupCache.Delete(key)
+		return true
+	})
+}
+
 func (s *Service) longContextTier(model string, usage UsageSnapshot) (LongContextPricing, bool) {
 	totalInput := usage.InputTokens + usage.CacheCreateTokens + usage.CacheReadTokens
 	if strings.Contains(strings.ToLower(model), "[1m]") && totalInput > 200000 && len(s.longContexts) > 0 {
@@ -74,6 +74,10 @@ for asset in "${ASSETS[@]}"; do
   echo "  asset: $asset"
 done
 
+# 应用内自动更新依据 SHA256SUMS 校验下载的安装包
+(cd bin && shasum -a 256 $(for asset in "${ASSETS[@]}"; do basename "$asset"; done) > SHA256SUMS)
+ASSETS+=("bin/SHA256SUMS")
+
 # gh release create "$TAG" "${ASSETS[@]}" \
 #   --title "$TAG" \
 #   --notes-file "$NOTES"
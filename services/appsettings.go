@@ -21,11 +21,129 @@ type AppSettings struct {
 	ShowHomeTitle bool `json:"show_home_title"`
 	AutoStart     bool `json:"auto_start"`
 	EnableBodyLog bool `json:"enable_body_log"` // 上下行日志开关
+	// 请求体大小上限（MB），0 表示使用默认值 32MB
+	MaxRequestBodyMB int `json:"max_request_body_mb"`
+	// provider 状态事件（自动挂起 / 恢复）推送地址
+	ProviderEventWebhook string `json:"provider_event_webhook"`
+	// provider 返回 429/529 时排队重试同一 provider 的最长等待秒数，0 表示直接切换 provider
+	StickyRetryMaxWaitSec int `json:"sticky_retry_max_wait_sec"`
+	// 携带 Idempotency-Key 的流式请求在客户端断开后继续接收响应的秒数，重连时从断点续传；0 表示关闭
+	StreamResumeSec int `json:"stream_resume_sec"`
+	// 上游超时（秒），0 表示使用默认值；provider 可单独覆盖
+	UpstreamConnectTimeoutSec int `json:"upstream_connect_timeout_sec"`
+	UpstreamReadTimeoutSec    int `json:"upstream_read_timeout_sec"`
+	UpstreamTimeoutSec        int `json:"upstream_timeout_sec"`
+	UpstreamStreamTimeoutSec  int `json:"upstream_stream_timeout_sec"`
+	// 客户端通过 X-Request-Timeout 申请超时的上限（秒），0 表示默认 30 分钟
+	MaxClientTimeoutSec int `json:"max_client_timeout_sec"`
+	// 日志队列写满时的策略：drop（丢弃）/ block（有限等待）/ spool（暂存磁盘，数据库追上后回放）
+	LogOverflowPolicy string `json:"log_overflow_policy"`
+	// block 策略的最长等待毫秒数，0 表示默认 200ms
+	LogOverflowMaxWaitMs int `json:"log_overflow_max_wait_ms"`
+	// 统计分桶（今日 / 按小时 / 按天）使用的时区，IANA 名称；空表示本机时区
+	StatsTimezone string `json:"stats_timezone"`
+	// 公开只读状态页 /status 与 /status.json（运行时长、错误率、provider 可用性历史，不含花费与请求内容），默认关闭
+	PublicStatusPage bool `json:"public_status_page"`
+	// 慢请求剖析阈值（毫秒）：总耗时超过阈值的请求记录各阶段耗时，0 表示关闭
+	SlowRequestThresholdMs int `json:"slow_request_threshold_ms"`
+	// /v1/batch 批量请求的最大并发，0 表示默认 4
+	BatchConcurrency int `json:"batch_concurrency"`
+	// 仅监听 127.0.0.1 的调试端口（pprof 与 expvar），默认关闭；端口为 0 时使用 6060
+	DebugServerEnabled bool `json:"debug_server_enabled"`
+	DebugServerPort    int  `json:"debug_server_port"`
 
 	// NEW-API 统一网关配置
 	NewAPIEnabled bool   `json:"new_api_enabled"` // 是否启用 new-api 统一网关模式
 	NewAPIURL     string `json:"new_api_url"`     // new-api 服务地址，默认 http://localhost:3000
 	NewAPIToken   string `json:"new_api_token"`   // new-api API Token (sk-xxx)
+	// 余额耗尽时自动关闭 new-api 模式，回退到本地 provider
+	NewAPIAutoDisable bool `json:"new_api_auto_disable"`
+
+	// 花费预算（美元），0 表示不设预算；达到 80% / 100% 时发送桌面通知
+	DailyBudgetUSD   float64 `json:"daily_budget_usd"`
+	MonthlyBudgetUSD float64 `json:"monthly_budget_usd"`
+	// 达到今日或本月预算后跳过常规 provider，只使用兜底 provider（如本地模型）；转发服务重启后生效
+	LocalFallbackOnBudget bool `json:"local_fallback_on_budget"`
+	// 按类别关闭桌面通知：provider_outage / budget / gateway / export / storage
+	NotificationMutes map[string]bool `json:"notification_mutes"`
+	// 日志数据库（app.db）超过该大小（MB）时发送通知，0 表示不提醒
+	DBSizeWarnMB int `json:"db_size_warn_mb"`
+
+	// 崩溃报告：用户同意后自动上传到 Sentry 兼容的 DSN；未同意时只保存在本地，可手动上传
+	CrashReportUpload bool   `json:"crash_report_upload"`
+	CrashReportDSN    string `json:"crash_report_dsn"`
+
+	// 浏览器客户端跨域访问（CORS），默认关闭；来源支持 "*" 与 https://*.example.com，
+	// 请求头为空时允许预检请求声明的全部请求头
+	CORSEnabled          bool     `json:"cors_enabled"`
+	CORSAllowedOrigins   []string `json:"cors_allowed_origins"`
+	CORSAllowedHeaders   []string `json:"cors_allowed_headers"`
+	CORSAllowCredentials bool     `json:"cors_allow_credentials"`
+
+	// 入站 IP 访问控制（CIDR 或单个 IP），拒绝名单优先；允许名单为空时不限制来源
+	IPAllowList []string `json:"ip_allow_list"`
+	IPDenyList  []string `json:"ip_deny_list"`
+	// 可信反向代理网段，来自这些地址的请求按 X-Forwarded-For 判断来源
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// 按来源 IP 的滥用防护（0 表示不限制）：每分钟请求数、同时进行中的请求数，
+	// 10 分钟内认证失败或超限达到次数后临时封禁（封禁时长 0 表示 15 分钟）
+	AbuseRequestsPerMinute int `json:"abuse_requests_per_minute"`
+	AbuseMaxConcurrent     int `json:"abuse_max_concurrent"`
+	AbuseBanAfterStrikes   int `json:"abuse_ban_after_strikes"`
+	AbuseBanDurationSec    int `json:"abuse_ban_duration_sec"`
+
+	// 转发服务 HTTPS 监听与客户端证书认证（mTLS），证书为空时使用 HTTP；
+	// 客户端认证 off / optional / require，证书 CN 或 SAN 可映射为用户标识，用于日志归属与按身份限流
+	TLSCertFile                  string            `json:"tls_cert_file"`
+	TLSKeyFile                   string            `json:"tls_key_file"`
+	TLSClientCAFile              string            `json:"tls_client_ca_file"`
+	TLSClientAuth                string            `json:"tls_client_auth"`
+	TLSIdentityMap               map[string]string `json:"tls_identity_map"`
+	TLSAdminIdentities           []string          `json:"tls_admin_identities"`
+	TLSIdentityRequestsPerMinute int               `json:"tls_identity_requests_per_minute"`
+}
+
+// CORS 转发服务的跨域访问配置
+func (s AppSettings) CORS() CORSConfig {
+	return CORSConfig{
+		Enabled:          s.CORSEnabled,
+		AllowedOrigins:   s.CORSAllowedOrigins,
+		AllowedHeaders:   s.CORSAllowedHeaders,
+		AllowCredentials: s.CORSAllowCredentials,
+	}
+}
+
+// IPAccess 转发服务的入站 IP 访问控制配置
+func (s AppSettings) IPAccess() IPAccessConfig {
+	return IPAccessConfig{
+		AllowList:      s.IPAllowList,
+		DenyList:       s.IPDenyList,
+		TrustedProxies: s.TrustedProxies,
+	}
+}
+
+// MTLS 转发服务的 TLS 与客户端证书认证配置
+func (s AppSettings) MTLS() MTLSConfig {
+	return MTLSConfig{
+		CertFile:          s.TLSCertFile,
+		KeyFile:           s.TLSKeyFile,
+		ClientCAFile:      s.TLSClientCAFile,
+		ClientAuth:        s.TLSClientAuth,
+		IdentityMap:       s.TLSIdentityMap,
+		AdminIdentities:   s.TLSAdminIdentities,
+		RequestsPerMinute: s.TLSIdentityRequestsPerMinute,
+	}
+}
+
+// Abuse 转发服务的滥用防护配置
+func (s AppSettings) Abuse() AbuseConfig {
+	return AbuseConfig{
+		RequestsPerMinute: s.AbuseRequestsPerMinute,
+		MaxConcurrent:     s.AbuseMaxConcurrent,
+		BanAfterStrikes:   s.AbuseBanAfterStrikes,
+		BanDurationSec:    s.AbuseBanDurationSec,
+	}
 }
 
 type AppSettingsService struct {
@@ -59,6 +177,7 @@ func (as *AppSettingsService) defaultSettings() AppSettings {
 		ShowHeatmap:   true,
 		ShowHomeTitle: true,
 		AutoStart:     autoStartEnabled,
+		DBSizeWarnMB:  DefaultDBSizeWarnMB,
 		// NEW-API 默认配置
 		NewAPIEnabled: false,                      // 默认禁用，需要用户手动开启
 		NewAPIURL:     "http://api.lurus.cn",      // 生产环境地址
@@ -78,6 +197,24 @@ func (as *AppSettingsService) SaveAppSettings(settings AppSettings) (AppSettings
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
+	// 统计时区立即生效，无效的时区名直接拒绝
+	if err := SetStatsTimezone(settings.StatsTimezone); err != nil {
+		return settings, err
+	}
+	// 跨域来源、IP 名单格式错误时拒绝保存（转发服务重启后生效）
+	if err := settings.CORS().Validate(); err != nil {
+		return settings, err
+	}
+	if err := settings.IPAccess().Validate(); err != nil {
+		return settings, err
+	}
+	if err := settings.Abuse().Validate(); err != nil {
+		return settings, err
+	}
+	if err := settings.MTLS().Validate(); err != nil {
+		return settings, err
+	}
+
 	// 同步开机自启动状态
 	if as.autoStartService != nil {
 		if settings.AutoStart {
@@ -94,9 +231,33 @@ func (as *AppSettingsService) SaveAppSettings(settings AppSettings) (AppSettings
 	if err := as.saveLocked(settings); err != nil {
 		return settings, err
 	}
+	GetSyncIntegration().OnScopedDocs(syncScopeAppSettings, map[string]interface{}{appSettingsSyncKey: settings})
 	return settings, nil
 }
 
+// appSettingsSyncKey 应用设置整体作为一个同步文档，按字段合并
+const appSettingsSyncKey = "app"
+
+// applySyncedSettings 写回其他设备同步来的应用设置，远端没有的字段保留本地值
+func (as *AppSettingsService) applySyncedSettings(key string, data map[string]interface{}) error {
+	if key != appSettingsSyncKey {
+		return fmt.Errorf("unknown app settings key: %s", key)
+	}
+	current, err := as.GetAppSettings()
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return err
+	}
+	_, err = as.SaveAppSettings(current)
+	return err
+}
+
 func (as *AppSettingsService) loadLocked() (AppSettings, error) {
 	settings := as.defaultSettings()
 	data, err := os.ReadFile(as.path)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 )
 
@@ -16,6 +17,7 @@ type BillingManagerConfig struct {
 	Auth         *AuthConfig         `json:"auth"`
 	Billing      *BillingConfig      `json:"billing"`
 	Subscription *SubscriptionConfig `json:"subscription"`
+	Invoice      *InvoiceConfig      `json:"invoice,omitempty"`
 }
 
 // BillingManager orchestrates all billing-related services
@@ -23,9 +25,10 @@ type BillingManager struct {
 	config *BillingManagerConfig
 
 	// Services
-	casdoor *CasdoorService
-	lago    *LagoService
-	payment *PaymentService
+	casdoor  *CasdoorService
+	lago     *LagoService
+	payment  *PaymentService
+	invoices *InvoiceService
 
 	// Middleware
 	authMiddleware         *AuthMiddleware
@@ -72,6 +75,18 @@ func (m *BillingManager) Initialize(config *BillingManagerConfig) error {
 		}
 	}
 
+	// Initialize Invoice service (issues invoices for payments and Lago renewals)
+	if m.payment != nil || m.lago != nil {
+		var err error
+		m.invoices, err = NewInvoiceService(config.Invoice)
+		if err != nil {
+			return fmt.Errorf("failed to initialize invoice service: %w", err)
+		}
+		if m.payment != nil {
+			m.payment.SetInvoiceService(m.invoices)
+		}
+	}
+
 	// Initialize Auth middleware (requires Casdoor)
 	if m.casdoor != nil {
 		m.authMiddleware = NewAuthMiddleware(m.casdoor, config.Auth)
@@ -108,6 +123,7 @@ func (m *BillingManager) InitializeFromFile(configPath string) error {
 
 // InitializeFromEnv loads configuration from environment variables
 func (m *BillingManager) InitializeFromEnv() error {
+	taxRate, _ := strconv.ParseFloat(os.Getenv("INVOICE_TAX_RATE"), 64)
 	config := &BillingManagerConfig{
 		Casdoor: &CasdoorConfig{
 			Endpoint:     os.Getenv("CASDOOR_ENDPOINT"),
@@ -134,6 +150,17 @@ func (m *BillingManager) InitializeFromEnv() error {
 			WechatPrivateKey: os.Getenv("WECHAT_PRIVATE_KEY"),
 			NotifyURL:        os.Getenv("PAYMENT_NOTIFY_URL"),
 			ReturnURL:        os.Getenv("PAYMENT_RETURN_URL"),
+
+			StripeSecretKey:     os.Getenv("STRIPE_SECRET_KEY"),
+			StripeWebhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+			StripeCurrency:      os.Getenv("STRIPE_CURRENCY"),
+		},
+		Invoice: &InvoiceConfig{
+			Prefix:         os.Getenv("INVOICE_PREFIX"),
+			CompanyName:    os.Getenv("INVOICE_COMPANY_NAME"),
+			CompanyAddress: os.Getenv("INVOICE_COMPANY_ADDRESS"),
+			TaxID:          os.Getenv("INVOICE_TAX_ID"),
+			TaxRate:        taxRate,
 		},
 		Auth:    DefaultAuthConfig(),
 		Billing: DefaultBillingConfig(),
@@ -167,6 +194,13 @@ func (m *BillingManager) Payment() *PaymentService {
 	return m.payment
 }
 
+// Invoices returns the Invoice service
+func (m *BillingManager) Invoices() *InvoiceService {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.invoices
+}
+
 // AuthMiddleware returns the authentication middleware
 func (m *BillingManager) AuthMiddleware() *AuthMiddleware {
 	m.mu.RLock()
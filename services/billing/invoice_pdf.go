@@ -0,0 +1,40 @@
+package billing
+
+import (
+	"github.com/aspect-code/codeswitch/pkg/invoicepdf"
+)
+
+var invoicePaymentMethods = map[PaymentMethod]string{
+	PaymentMethodAlipay: "Alipay",
+	PaymentMethodWechat: "WeChat Pay",
+	PaymentMethodStripe: "Stripe",
+}
+
+// renderInvoicePDF renders an invoice with the layout shared with the sync service
+func renderInvoicePDF(invoice *Invoice) []byte {
+	doc := &invoicepdf.Invoice{
+		Number:        invoice.Number,
+		SellerName:    invoice.SellerName,
+		SellerAddress: invoice.SellerAddress,
+		SellerTaxID:   invoice.SellerTaxID,
+		BillTo:        []string{"User ID: " + invoice.UserID},
+		Currency:      invoice.Currency,
+		Lines:         make([]invoicepdf.Line, len(invoice.Lines)),
+		SubtotalCents: invoice.SubtotalCents,
+		TaxRate:       invoice.TaxRate,
+		TaxCents:      invoice.TaxCents,
+		TotalCents:    invoice.TotalCents,
+		PaidAt:        invoice.PaidAt,
+		IssuedAt:      invoice.IssuedAt,
+	}
+	if method := invoicePaymentMethods[invoice.PaymentMethod]; method != "" {
+		doc.Details = append(doc.Details, "Payment method: "+method)
+	}
+	if invoice.Reference != "" {
+		doc.Details = append(doc.Details, "Reference: "+invoice.Reference)
+	}
+	for i, line := range invoice.Lines {
+		doc.Lines[i] = invoicepdf.Line(line)
+	}
+	return invoicepdf.Render(doc)
+}
@@ -0,0 +1,40 @@
+package billing
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRenderInvoicePDF(t *testing.T) {
+	paidAt := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	invoice := &Invoice{
+		Number:        "INV-2026-000042",
+		UserID:        "u1",
+		SellerName:    "代码切换科技",
+		Currency:      "CNY",
+		Lines:         []InvoiceLine{{Description: "Credits recharge (Pro)", Quantity: 1, UnitCents: 123456, AmountCents: 123456}},
+		SubtotalCents: 116468,
+		TaxRate:       6,
+		TaxCents:      6988,
+		TotalCents:    123456,
+		PaymentMethod: PaymentMethodWechat,
+		Reference:     "CS20261018",
+		PaidAt:        &paidAt,
+		IssuedAt:      paidAt,
+	}
+
+	data := renderInvoicePDF(invoice)
+	for _, want := range []string{
+		"(No. INV-2026-000042)",
+		"(User ID: u1)",
+		"(Payment method: WeChat Pay)",
+		"(Reference: CS20261018)",
+		"(Credits recharge \\(Pro\\))",
+		"(CNY 1,234.56)",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("pdf does not contain %s", want)
+		}
+	}
+}
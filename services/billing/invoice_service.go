@@ -0,0 +1,343 @@
+package billing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvoiceNotFound the invoice does not exist
+var ErrInvoiceNotFound = errors.New("invoice not found")
+
+// InvoiceConfig invoice issuer configuration
+type InvoiceConfig struct {
+	Prefix         string  `json:"prefix,omitempty"`          // Number prefix, default INV
+	CompanyName    string  `json:"company_name"`              // Seller printed in the header
+	CompanyAddress string  `json:"company_address,omitempty"` // Seller address
+	TaxID          string  `json:"tax_id,omitempty"`          // Seller tax ID
+	TaxRate        float64 `json:"tax_rate,omitempty"`        // Percent, included in prices
+	Dir            string  `json:"dir,omitempty"`             // Storage directory, default ~/.code-switch/invoices
+}
+
+// InvoiceKind what an invoice was issued for
+type InvoiceKind string
+
+const (
+	InvoiceKindPayment      InvoiceKind = "payment"
+	InvoiceKindSubscription InvoiceKind = "subscription"
+)
+
+// InvoiceLine an invoice line item, amounts include tax
+type InvoiceLine struct {
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitCents   int64  `json:"unit_cents"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// Invoice an issued invoice; the PDF is stored next to the index
+type Invoice struct {
+	ID            string        `json:"id"`
+	Number        string        `json:"number"`
+	Kind          InvoiceKind   `json:"kind"`
+	Source        string        `json:"source"` // order:<id> or lago:<id>, one invoice per source
+	UserID        string        `json:"user_id"`
+	SellerName    string        `json:"seller_name"`
+	SellerAddress string        `json:"seller_address,omitempty"`
+	SellerTaxID   string        `json:"seller_tax_id,omitempty"`
+	Currency      string        `json:"currency"`
+	Lines         []InvoiceLine `json:"lines"`
+	SubtotalCents int64         `json:"subtotal_cents"`
+	TaxRate       float64       `json:"tax_rate"`
+	TaxCents      int64         `json:"tax_cents"`
+	TotalCents    int64         `json:"total_cents"`
+	PaymentMethod PaymentMethod `json:"payment_method,omitempty"`
+	Reference     string        `json:"reference,omitempty"` // Order ID or Lago invoice number
+	PaidAt        *time.Time    `json:"paid_at,omitempty"`
+	IssuedAt      time.Time     `json:"issued_at"`
+}
+
+// invoiceIndex is the on-disk index: numbering sequences and invoice metadata
+type invoiceIndex struct {
+	Sequences map[string]int64 `json:"sequences"`
+	Invoices  []*Invoice       `json:"invoices"`
+}
+
+// InvoiceService issues numbered PDF invoices for completed payments and subscription renewals
+type InvoiceService struct {
+	config *InvoiceConfig
+	dir    string
+	mu     sync.Mutex
+	index  invoiceIndex
+}
+
+// NewInvoiceService creates an invoice service and loads the existing index
+func NewInvoiceService(config *InvoiceConfig) (*InvoiceService, error) {
+	if config == nil {
+		config = &InvoiceConfig{}
+	}
+	dir := config.Dir
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".code-switch", "invoices")
+	}
+
+	s := &InvoiceService{
+		config: config,
+		dir:    dir,
+		index:  invoiceIndex{Sequences: make(map[string]int64)},
+	}
+	data, err := os.ReadFile(s.indexPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read invoice index: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.index); err != nil {
+			return nil, fmt.Errorf("failed to parse invoice index: %w", err)
+		}
+		if s.index.Sequences == nil {
+			s.index.Sequences = make(map[string]int64)
+		}
+	}
+	return s, nil
+}
+
+// IssueForOrder issues the invoice of a paid recharge order.
+// Issuing again returns the invoice that already exists.
+func (s *InvoiceService) IssueForOrder(order *PaymentOrder) (*Invoice, error) {
+	if order.Status != PaymentStatusPaid && order.Status != PaymentStatusRefunded {
+		return nil, fmt.Errorf("order %s is not paid", order.OrderID)
+	}
+	description := order.Description
+	if description == "" {
+		description = fmt.Sprintf("Credits recharge (%d credits)", order.Credits)
+	}
+
+	invoice := s.newInvoice(InvoiceKindPayment, order.UserID, order.Currency, order.Amount, description)
+	invoice.Source = "order:" + order.OrderID
+	invoice.PaymentMethod = order.Method
+	invoice.Reference = order.OrderID
+	invoice.PaidAt = order.PaidAt
+	return s.issue(invoice)
+}
+
+// IssueForLagoInvoice issues the invoice of a paid Lago subscription invoice (a renewal).
+// Lago already computed the taxes, so its amounts are used as they are.
+func (s *InvoiceService) IssueForLagoInvoice(userID string, lago *LagoInvoice) (*Invoice, error) {
+	if lago.PaymentStatus != "succeeded" {
+		return nil, fmt.Errorf("lago invoice %s is not paid", lago.LagoID)
+	}
+	currency := lago.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+
+	invoice := s.newInvoice(InvoiceKindSubscription, userID, currency, lago.TotalAmount, "Subscription renewal")
+	invoice.Source = "lago:" + lago.LagoID
+	invoice.Reference = lago.Number
+	if lago.TaxAmount > 0 && lago.TaxAmount < lago.TotalAmount {
+		invoice.TaxCents = lago.TaxAmount
+		invoice.SubtotalCents = lago.TotalAmount - lago.TaxAmount
+		invoice.TaxRate = math.Round(float64(invoice.TaxCents)/float64(invoice.SubtotalCents)*10000) / 100
+	}
+	if issued, err := time.Parse("2006-01-02", lago.IssuingDate); err == nil {
+		invoice.PaidAt = &issued
+	}
+	return s.issue(invoice)
+}
+
+// SyncLagoInvoices issues invoices for the user's paid subscription invoices in Lago
+func (s *InvoiceService) SyncLagoInvoices(userID string, lago *LagoService) error {
+	invoices, err := lago.GetCustomerInvoices(userID, 50)
+	if err != nil {
+		return err
+	}
+	for _, inv := range invoices {
+		if inv.InvoiceType != "subscription" || inv.Status != "finalized" || inv.PaymentStatus != "succeeded" || inv.TotalAmount <= 0 {
+			continue
+		}
+		if _, err := s.IssueForLagoInvoice(userID, inv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newInvoice builds a single line invoice; prices include tax, so the tax is split out of the total
+func (s *InvoiceService) newInvoice(kind InvoiceKind, userID, currency string, totalCents int64, description string) *Invoice {
+	taxRate := s.config.TaxRate
+	if taxRate < 0 {
+		taxRate = 0
+	}
+	taxCents := int64(math.Round(float64(totalCents) * taxRate / (100 + taxRate)))
+
+	seller := s.config.CompanyName
+	if seller == "" {
+		seller = "CodeSwitch"
+	}
+	if currency == "" {
+		currency = "CNY"
+	}
+
+	return &Invoice{
+		ID:            uuid.New().String(),
+		Kind:          kind,
+		UserID:        userID,
+		SellerName:    seller,
+		SellerAddress: s.config.CompanyAddress,
+		SellerTaxID:   s.config.TaxID,
+		Currency:      strings.ToUpper(currency),
+		Lines: []InvoiceLine{{
+			Description: description,
+			Quantity:    1,
+			UnitCents:   totalCents,
+			AmountCents: totalCents,
+		}},
+		SubtotalCents: totalCents - taxCents,
+		TaxRate:       taxRate,
+		TaxCents:      taxCents,
+		TotalCents:    totalCents,
+		IssuedAt:      time.Now(),
+	}
+}
+
+// issue numbers, renders and stores an invoice unless its source was already invoiced.
+// The sequence is only committed together with the index, so numbers have no gaps.
+func (s *InvoiceService) issue(invoice *Invoice) (*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.index.Invoices {
+		if existing.Source == invoice.Source {
+			return existing, nil
+		}
+	}
+
+	prefix := strings.TrimSpace(s.config.Prefix)
+	if prefix == "" {
+		prefix = "INV"
+	}
+	scope := fmt.Sprintf("%s-%d", prefix, invoice.IssuedAt.Year())
+	seq := s.index.Sequences[scope] + 1
+	invoice.Number = fmt.Sprintf("%s-%06d", scope, seq)
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create invoice directory: %w", err)
+	}
+	if err := os.WriteFile(s.pdfPath(invoice.ID), renderInvoicePDF(invoice), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write invoice pdf: %w", err)
+	}
+
+	s.index.Sequences[scope] = seq
+	s.index.Invoices = append(s.index.Invoices, invoice)
+	if err := s.saveIndex(); err != nil {
+		s.index.Sequences[scope] = seq - 1
+		s.index.Invoices = s.index.Invoices[:len(s.index.Invoices)-1]
+		os.Remove(s.pdfPath(invoice.ID))
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// saveIndex writes the index through a temporary file so a crash never leaves it truncated
+func (s *InvoiceService) saveIndex() error {
+	data, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal invoice index: %w", err)
+	}
+	tmp := s.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write invoice index: %w", err)
+	}
+	return os.Rename(tmp, s.indexPath())
+}
+
+// List returns the user's invoices, newest first
+func (s *InvoiceService) List(userID string) []*Invoice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*Invoice, 0)
+	for _, invoice := range s.index.Invoices {
+		if invoice.UserID == userID {
+			result = append(result, invoice)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].IssuedAt.After(result[j].IssuedAt)
+	})
+	return result
+}
+
+// Get returns an invoice by ID
+func (s *InvoiceService) Get(id string) (*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, invoice := range s.index.Invoices {
+		if invoice.ID == id {
+			return invoice, nil
+		}
+	}
+	return nil, ErrInvoiceNotFound
+}
+
+// PDF returns the invoice document, re-rendering it if the file was lost
+func (s *InvoiceService) PDF(id string) (*Invoice, []byte, error) {
+	invoice, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(s.pdfPath(id))
+	if os.IsNotExist(err) {
+		return invoice, renderInvoicePDF(invoice), nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read invoice pdf: %w", err)
+	}
+	return invoice, data, nil
+}
+
+func (s *InvoiceService) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+func (s *InvoiceService) pdfPath(id string) string {
+	return filepath.Join(s.dir, id+".pdf")
+}
+
+// SetInvoiceService enables invoices for completed payments; call it before serving requests
+func (s *PaymentService) SetInvoiceService(invoices *InvoiceService) {
+	s.invoices = invoices
+}
+
+// IssueMissingInvoices issues invoices for the user's paid orders that do not have one yet
+func (s *PaymentService) IssueMissingInvoices(userID string) error {
+	if s.invoices == nil {
+		return nil
+	}
+	var firstErr error
+	s.orders.Range(func(_, value any) bool {
+		order := value.(*PaymentOrder)
+		if order.UserID != userID || (order.Status != PaymentStatusPaid && order.Status != PaymentStatusRefunded) {
+			return true
+		}
+		if _, err := s.invoices.IssueForOrder(order); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return true
+	})
+	return firstErr
+}
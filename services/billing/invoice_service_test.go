@@ -0,0 +1,177 @@
+package billing
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestInvoiceService(t *testing.T, dir string) *InvoiceService {
+	t.Helper()
+	s, err := NewInvoiceService(&InvoiceConfig{
+		Prefix:      "CS",
+		CompanyName: "CodeSwitch Ltd.",
+		TaxRate:     6,
+		Dir:         dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func paidOrder(id, userID string, amount int64) *PaymentOrder {
+	paidAt := time.Now()
+	return &PaymentOrder{
+		OrderID:  id,
+		UserID:   userID,
+		Amount:   amount,
+		Currency: "CNY",
+		Credits:  amount * 10,
+		Method:   PaymentMethodAlipay,
+		Status:   PaymentStatusPaid,
+		PaidAt:   &paidAt,
+	}
+}
+
+func TestIssueForOrder(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestInvoiceService(t, dir)
+
+	invoice, err := s.IssueForOrder(paidOrder("CS1", "u1", 10600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	year := time.Now().Year()
+	if want := "CS-" + strconv.Itoa(year) + "-000001"; invoice.Number != want {
+		t.Errorf("number = %s, want %s", invoice.Number, want)
+	}
+	// 6% included in 106.00
+	if invoice.TaxCents != 600 || invoice.SubtotalCents != 10000 || invoice.TotalCents != 10600 {
+		t.Errorf("amounts = %d + %d = %d", invoice.SubtotalCents, invoice.TaxCents, invoice.TotalCents)
+	}
+	if invoice.SellerName != "CodeSwitch Ltd." || invoice.Kind != InvoiceKindPayment || invoice.Reference != "CS1" {
+		t.Errorf("invoice = %+v", invoice)
+	}
+
+	// Issuing again returns the same invoice
+	again, err := s.IssueForOrder(paidOrder("CS1", "u1", 10600))
+	if err != nil || again.ID != invoice.ID {
+		t.Fatalf("reissue = %+v, %v", again, err)
+	}
+	second, err := s.IssueForOrder(paidOrder("CS2", "u1", 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(second.Number, "-000002") {
+		t.Errorf("second number = %s", second.Number)
+	}
+
+	if _, err := s.IssueForOrder(&PaymentOrder{OrderID: "CS3", Status: PaymentStatusPending}); err == nil {
+		t.Error("pending orders must not be invoiced")
+	}
+
+	// Numbering and invoices survive a restart
+	reloaded := newTestInvoiceService(t, dir)
+	if got := reloaded.List("u1"); len(got) != 2 {
+		t.Fatalf("reloaded %d invoices, want 2", len(got))
+	}
+	third, err := reloaded.IssueForOrder(paidOrder("CS4", "u2", 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(third.Number, "-000003") {
+		t.Errorf("number after restart = %s", third.Number)
+	}
+	if got := reloaded.List("u2"); len(got) != 1 || got[0].ID != third.ID {
+		t.Errorf("u2 invoices = %v", got)
+	}
+}
+
+func TestIssueForLagoInvoice(t *testing.T) {
+	s := newTestInvoiceService(t, t.TempDir())
+
+	lago := &LagoInvoice{
+		LagoID:        "lago-1",
+		Number:        "LAGO-202610-001",
+		InvoiceType:   "subscription",
+		IssuingDate:   "2026-10-01",
+		Status:        "finalized",
+		PaymentStatus: "succeeded",
+		Currency:      "usd",
+		TotalAmount:   1100,
+		TaxAmount:     100,
+	}
+	invoice, err := s.IssueForLagoInvoice("u1", lago)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Lago's own tax figures win over the configured rate
+	if invoice.Currency != "USD" || invoice.TaxCents != 100 || invoice.SubtotalCents != 1000 || invoice.TaxRate != 10 {
+		t.Errorf("invoice = %+v", invoice)
+	}
+	if invoice.Kind != InvoiceKindSubscription || invoice.Reference != "LAGO-202610-001" {
+		t.Errorf("invoice = %+v", invoice)
+	}
+	if invoice.PaidAt == nil || invoice.PaidAt.Format("2006-01-02") != "2026-10-01" {
+		t.Errorf("paid at = %v", invoice.PaidAt)
+	}
+
+	lago.PaymentStatus = "pending"
+	lago.LagoID = "lago-2"
+	if _, err := s.IssueForLagoInvoice("u1", lago); err == nil {
+		t.Error("unpaid Lago invoices must not be invoiced")
+	}
+}
+
+func TestInvoicePDFFile(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestInvoiceService(t, dir)
+	invoice, err := s.IssueForOrder(paidOrder("CS1", "u1", 2990))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, data, err := s.PDF(invoice.ID)
+	if err != nil || got.ID != invoice.ID || !bytes.HasPrefix(data, []byte("%PDF-1.4")) {
+		t.Fatalf("pdf: %v", err)
+	}
+
+	// A lost document is rendered again from the index
+	if err := os.Remove(filepath.Join(dir, invoice.ID+".pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := s.PDF(invoice.ID); err != nil || !bytes.Contains(data, []byte(invoice.Number)) {
+		t.Fatalf("re-rendered pdf: %v", err)
+	}
+
+	if _, _, err := s.PDF("missing"); err != ErrInvoiceNotFound {
+		t.Errorf("error = %v, want ErrInvoiceNotFound", err)
+	}
+}
+
+func TestCompletePaymentIssuesInvoice(t *testing.T) {
+	s := newTestPaymentService(t, pendingOrder("CS7"))
+	invoices := newTestInvoiceService(t, t.TempDir())
+	s.SetInvoiceService(invoices)
+
+	if err := s.completePayment(&PaymentCallback{OrderID: "CS7", TradeNo: "T7", Amount: 2990, Status: PaymentStatusPaid}); err != nil {
+		t.Fatal(err)
+	}
+	list := invoices.List("u1")
+	if len(list) != 1 || list[0].Reference != "CS7" || list[0].PaymentMethod != PaymentMethodWechat {
+		t.Fatalf("invoices = %+v", list)
+	}
+
+	// Nothing is issued twice
+	if err := s.IssueMissingInvoices("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(invoices.List("u1")); n != 1 {
+		t.Errorf("%d invoices after IssueMissingInvoices, want 1", n)
+	}
+}
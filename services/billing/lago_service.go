@@ -95,6 +95,8 @@ type LagoEvent struct {
 type LagoInvoice struct {
 	LagoID       string `json:"lago_id"`
 	Number       string `json:"number"`
+	InvoiceType  string `json:"invoice_type"` // subscription, add_on, credit, one_off
+	IssuingDate  string `json:"issuing_date"` // YYYY-MM-DD
 	Status       string `json:"status"`
 	PaymentStatus string `json:"payment_status"`
 	Currency     string `json:"currency"`
@@ -0,0 +1,146 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrOrderNotFound the payment order does not exist
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderHasNoQRCode the order was not created with a QR code payment method
+	ErrOrderHasNoQRCode = errors.New("order has no qr code")
+	// ErrPaymentMismatch a payment callback's amount or currency differs from its order
+	ErrPaymentMismatch = errors.New("payment does not match order")
+)
+
+// updateOrder stores a modified copy of an order and wakes its long-poll waiters.
+// Stored orders are never changed in place, because waiters read them without a lock.
+func (s *PaymentService) updateOrder(order *PaymentOrder, update func(*PaymentOrder)) *PaymentOrder {
+	updated := *order
+	update(&updated)
+	s.orders.Store(updated.OrderID, &updated)
+	s.notifyOrderChanged(updated.OrderID)
+	return &updated
+}
+
+// transitionOrder atomically stores a modified copy of an order that is still in status from.
+// It returns the replaced and stored orders, or nil ones if the order has already left from.
+// Waiters are not woken; callers notify once the transition is final.
+func (s *PaymentService) transitionOrder(orderID string, from PaymentStatus, update func(*PaymentOrder)) (prev, updated *PaymentOrder, err error) {
+	for {
+		order, err := s.GetOrder(orderID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if order.Status != from {
+			return nil, nil, nil
+		}
+		next := *order
+		update(&next)
+		if s.orders.CompareAndSwap(orderID, order, &next) {
+			return order, &next, nil
+		}
+	}
+}
+
+// notifyOrderChanged wakes long-poll waiters of an order after its status changed
+func (s *PaymentService) notifyOrderChanged(orderID string) {
+	s.waitersMu.Lock()
+	defer s.waitersMu.Unlock()
+
+	if ch, ok := s.waiters[orderID]; ok {
+		close(ch)
+		delete(s.waiters, orderID)
+	}
+}
+
+// orderWaiter returns the channel closed on the next status change of an order
+func (s *PaymentService) orderWaiter(orderID string) <-chan struct{} {
+	s.waitersMu.Lock()
+	defer s.waitersMu.Unlock()
+
+	ch, ok := s.waiters[orderID]
+	if !ok {
+		ch = make(chan struct{})
+		s.waiters[orderID] = ch
+	}
+	return ch
+}
+
+// WaitOrderStatus long-polls an order until its status differs from known (pending when empty),
+// the order expires unpaid, or ctx is done. It returns the latest stored order in every case.
+func (s *PaymentService) WaitOrderStatus(ctx context.Context, orderID string, known PaymentStatus) (*PaymentOrder, error) {
+	if known == "" {
+		known = PaymentStatusPending
+	}
+
+	for {
+		// Register before checking so a change between the check and the wait is not missed
+		changed := s.orderWaiter(orderID)
+
+		order, err := s.GetOrder(orderID)
+		if err != nil {
+			return nil, err
+		}
+		if order.Status != known {
+			return order, nil
+		}
+
+		// Unpaid orders past their expiry will not change anymore
+		wait := time.Until(order.ExpiredAt)
+		if order.Status == PaymentStatusPending && wait <= 0 {
+			return order, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			return order, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return order, nil
+		}
+	}
+}
+
+// OrderQRCode renders the QR code of a WeChat native or Alipay precreate order.
+// It returns the image and its content type.
+func (s *PaymentService) OrderQRCode(orderID string, format QRCodeFormat, size int) ([]byte, string, error) {
+	order, err := s.GetOrder(orderID)
+	if err != nil {
+		return nil, "", err
+	}
+	if order.QRCode == "" {
+		return nil, "", ErrOrderHasNoQRCode
+	}
+
+	if size <= 0 {
+		size = DefaultQRCodeSize
+	}
+	if size > MaxQRCodeSize {
+		size = MaxQRCodeSize
+	}
+
+	code, err := EncodeQRCode(order.QRCode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case QRCodeFormatPNG, "":
+		data, err := code.PNG(size)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, "image/png", nil
+	case QRCodeFormatSVG:
+		return code.SVG(size), "image/svg+xml", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported qr code format: %s", format)
+	}
+}
@@ -0,0 +1,232 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestPaymentService(t *testing.T, orders ...*PaymentOrder) *PaymentService {
+	t.Helper()
+	s, err := NewPaymentService(&PaymentConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range orders {
+		s.orders.Store(order.OrderID, order)
+	}
+	return s
+}
+
+func pendingOrder(id string) *PaymentOrder {
+	return &PaymentOrder{
+		OrderID:   id,
+		UserID:    "u1",
+		Amount:    2990,
+		Method:    PaymentMethodWechat,
+		Status:    PaymentStatusPending,
+		QRCode:    "weixin://wxpay/bizpayurl?pr=Qk8tHBUzz",
+		CreatedAt: time.Now(),
+		ExpiredAt: time.Now().Add(30 * time.Minute),
+	}
+}
+
+func TestWaitOrderStatusWakesOnCallback(t *testing.T) {
+	s := newTestPaymentService(t, pendingOrder("CS1"))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := s.completePayment(&PaymentCallback{OrderID: "CS1", TradeNo: "T1", Amount: 2990, Status: PaymentStatusPaid}); err != nil {
+			t.Errorf("completePayment: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	order, err := s.WaitOrderStatus(ctx, "CS1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != PaymentStatusPaid || order.TradeNo != "T1" || order.PaidAt == nil {
+		t.Fatalf("order = %+v, want paid", order)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("waiter was not woken by the callback")
+	}
+}
+
+// newFakeLago returns a Lago service counting wallet top-up attempts; the first failTopUps attempts fail
+func newFakeLago(t *testing.T, failTopUps int32) (*LagoService, *atomic.Int32) {
+	t.Helper()
+	var topUps atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/wallets":
+			fmt.Fprint(w, `{"wallets":[{"lago_id":"w1"}]}`)
+		case "/api/v1/wallet_transactions":
+			if topUps.Add(1) <= failTopUps {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			fmt.Fprint(w, `{"wallet_transaction":{"lago_id":"wt1"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewLagoService(&LagoConfig{APIURL: server.URL, APIKey: "lago_test"}), &topUps
+}
+
+func TestCompletePaymentCreditsOnce(t *testing.T) {
+	s := newTestPaymentService(t, pendingOrder("CS8"))
+	lago, topUps := newFakeLago(t, 0)
+	s.lagoService = lago
+
+	// Duplicate deliveries racing each other top up the wallet once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.completePayment(&PaymentCallback{OrderID: "CS8", TradeNo: "T8", Amount: 2990, Status: PaymentStatusPaid}); err != nil {
+				t.Errorf("completePayment: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := topUps.Load(); n != 1 {
+		t.Fatalf("%d wallet top-ups, want 1", n)
+	}
+	if order, _ := s.GetOrder("CS8"); order.Status != PaymentStatusPaid || order.TradeNo != "T8" {
+		t.Fatalf("order = %+v, want paid", order)
+	}
+}
+
+func TestCompletePaymentReleasesFailedTopUp(t *testing.T) {
+	s := newTestPaymentService(t, pendingOrder("CS9"))
+	lago, topUps := newFakeLago(t, 1)
+	s.lagoService = lago
+	callback := &PaymentCallback{OrderID: "CS9", TradeNo: "T9", Amount: 2990, Status: PaymentStatusPaid}
+
+	// A failed top-up leaves the order pending so the provider's retry can settle it
+	if err := s.completePayment(callback); err == nil {
+		t.Fatal("expected top-up error")
+	}
+	if order, _ := s.GetOrder("CS9"); order.Status != PaymentStatusPending || order.PaidAt != nil {
+		t.Fatalf("order after failed top-up = %+v", order)
+	}
+	if err := s.completePayment(callback); err != nil {
+		t.Fatal(err)
+	}
+	if order, _ := s.GetOrder("CS9"); order.Status != PaymentStatusPaid || topUps.Load() != 2 {
+		t.Fatalf("order after retry = %+v, %d top-ups", order, topUps.Load())
+	}
+}
+
+func TestCompletePaymentRejectsMismatch(t *testing.T) {
+	order := pendingOrder("CS10")
+	order.Currency = "CNY"
+	closed := pendingOrder("CS11")
+	closed.Status = PaymentStatusCancelled
+	s := newTestPaymentService(t, order, closed)
+	lago, topUps := newFakeLago(t, 0)
+	s.lagoService = lago
+
+	for name, callback := range map[string]*PaymentCallback{
+		"amount":   {OrderID: "CS10", Amount: 1, Status: PaymentStatusPaid},
+		"currency": {OrderID: "CS10", Amount: 2990, Currency: "USD", Status: PaymentStatusPaid},
+	} {
+		if err := s.completePayment(callback); !errors.Is(err, ErrPaymentMismatch) {
+			t.Errorf("%s: error = %v, want ErrPaymentMismatch", name, err)
+		}
+	}
+	if err := s.completePayment(&PaymentCallback{OrderID: "CS10", Amount: 2990, Currency: "cny", Status: PaymentStatusPaid}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed orders are not reopened by a late payment
+	if err := s.completePayment(&PaymentCallback{OrderID: "CS11", Amount: 2990, Status: PaymentStatusPaid}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetOrder("CS11"); got.Status != PaymentStatusCancelled {
+		t.Errorf("closed order status = %s", got.Status)
+	}
+	if n := topUps.Load(); n != 1 {
+		t.Errorf("%d wallet top-ups, want 1", n)
+	}
+}
+
+func TestWaitOrderStatusReturnsImmediately(t *testing.T) {
+	paid := pendingOrder("CS2")
+	paid.Status = PaymentStatusPaid
+	expired := pendingOrder("CS3")
+	expired.ExpiredAt = time.Now().Add(-time.Minute)
+	s := newTestPaymentService(t, paid, expired)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The client already knows "pending", so a paid order is reported at once
+	if order, err := s.WaitOrderStatus(ctx, "CS2", PaymentStatusPending); err != nil || order.Status != PaymentStatusPaid {
+		t.Fatalf("paid order: %+v, %v", order, err)
+	}
+	// Expired unpaid orders will not change, no point waiting
+	start := time.Now()
+	if order, err := s.WaitOrderStatus(ctx, "CS3", ""); err != nil || order.Status != PaymentStatusPending {
+		t.Fatalf("expired order: %+v, %v", order, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expired order should not block")
+	}
+
+	if _, err := s.WaitOrderStatus(ctx, "missing", ""); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("missing order error = %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestWaitOrderStatusTimeout(t *testing.T) {
+	s := newTestPaymentService(t, pendingOrder("CS4"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	order, err := s.WaitOrderStatus(ctx, "CS4", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != PaymentStatusPending {
+		t.Errorf("status = %s, want pending", order.Status)
+	}
+}
+
+func TestOrderQRCode(t *testing.T) {
+	noQR := pendingOrder("CS6")
+	noQR.QRCode = ""
+	s := newTestPaymentService(t, pendingOrder("CS5"), noQR)
+
+	data, contentType, err := s.OrderQRCode("CS5", QRCodeFormatPNG, 0)
+	if err != nil || contentType != "image/png" || len(data) == 0 {
+		t.Fatalf("png: %q, %v", contentType, err)
+	}
+	data, contentType, err = s.OrderQRCode("CS5", QRCodeFormatSVG, 5000)
+	if err != nil || contentType != "image/svg+xml" {
+		t.Fatalf("svg: %q, %v", contentType, err)
+	}
+	if want := `width="1024"`; !bytes.Contains(data, []byte(want)) {
+		t.Errorf("svg size should be clamped to %s", want)
+	}
+
+	if _, _, err := s.OrderQRCode("CS5", "gif", 0); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+	if _, _, err := s.OrderQRCode("CS6", QRCodeFormatPNG, 0); !errors.Is(err, ErrOrderHasNoQRCode) {
+		t.Errorf("error = %v, want ErrOrderHasNoQRCode", err)
+	}
+}
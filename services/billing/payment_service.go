@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +31,13 @@ type PaymentConfig struct {
 	WechatSerialNo  string `json:"wechat_serial_no"`
 	WechatPrivateKey string `json:"wechat_private_key"`
 
+	// Stripe (international users)
+	StripeSecretKey      string `json:"stripe_secret_key"`
+	StripeWebhookSecret  string `json:"stripe_webhook_secret"`
+	StripeCurrency       string `json:"stripe_currency,omitempty"`         // ISO currency code, default usd
+	StripeCreditsPerUnit int64  `json:"stripe_credits_per_unit,omitempty"` // Credits per minor currency unit, default same as CNY (10)
+	StripeAPIURL         string `json:"stripe_api_url,omitempty"`          // API base URL override
+
 	// Callback URLs
 	NotifyURL string `json:"notify_url"` // Payment callback URL
 	ReturnURL string `json:"return_url"` // Redirect URL after payment
@@ -40,6 +49,7 @@ type PaymentMethod string
 const (
 	PaymentMethodAlipay PaymentMethod = "alipay"
 	PaymentMethodWechat PaymentMethod = "wechat"
+	PaymentMethodStripe PaymentMethod = "stripe"
 )
 
 // PaymentStatus represents payment status
@@ -67,6 +77,7 @@ type PaymentOrder struct {
 	PayURL        string        `json:"pay_url,omitempty"`        // Payment URL (for web)
 	QRCode        string        `json:"qr_code,omitempty"`        // QR code content
 	PrepayID      string        `json:"prepay_id,omitempty"`      // WeChat prepay ID
+	SessionID     string        `json:"session_id,omitempty"`     // Stripe checkout session ID
 	CreatedAt     time.Time     `json:"created_at"`
 	PaidAt        *time.Time    `json:"paid_at,omitempty"`
 	ExpiredAt     time.Time     `json:"expired_at"`
@@ -78,6 +89,7 @@ type PaymentCallback struct {
 	OrderID   string        `json:"order_id"`
 	TradeNo   string        `json:"trade_no"`
 	Amount    int64         `json:"amount"`
+	Currency  string        `json:"currency,omitempty"` // Empty when the provider does not report it
 	Status    PaymentStatus `json:"status"`
 	RawData   string        `json:"raw_data,omitempty"`
 }
@@ -87,11 +99,19 @@ type PaymentService struct {
 	config       *PaymentConfig
 	alipayClient *alipay.Client
 	wechatClient *wechat.ClientV3
+	stripeClient *stripeClient
 	lagoService  *LagoService
 	mu           sync.RWMutex
 
 	// Order storage (in production, use database)
 	orders sync.Map // map[orderID]*PaymentOrder
+
+	// Long-poll waiters, closed when an order's status changes
+	waitersMu sync.Mutex
+	waiters   map[string]chan struct{}
+
+	// Issues an invoice for every completed payment, optional
+	invoices *InvoiceService
 }
 
 // NewPaymentService creates a new payment service
@@ -99,6 +119,7 @@ func NewPaymentService(config *PaymentConfig, lagoService *LagoService) (*Paymen
 	s := &PaymentService{
 		config:      config,
 		lagoService: lagoService,
+		waiters:     make(map[string]chan struct{}),
 	}
 
 	// Initialize Alipay client
@@ -125,6 +146,11 @@ func NewPaymentService(config *PaymentConfig, lagoService *LagoService) (*Paymen
 		s.wechatClient = client
 	}
 
+	// Initialize Stripe client
+	if config.StripeSecretKey != "" {
+		s.stripeClient = newStripeClient(config)
+	}
+
 	return s, nil
 }
 
@@ -144,12 +170,18 @@ func (s *PaymentService) CreateRechargeOrder(userID string, amount int64, method
 
 	// Calculate credits (1 CNY = 1000 credits)
 	credits := amount * 10 // amount is in cents, 1 cent = 10 credits
+	currency := "CNY"
+	if method == PaymentMethodStripe {
+		// Stripe amounts are in the minor unit of the configured currency
+		currency = strings.ToUpper(config.stripeCurrency())
+		credits = amount * config.stripeCreditsPerUnit()
+	}
 
 	order := &PaymentOrder{
 		OrderID:     generateOrderID(),
 		UserID:      userID,
 		Amount:      amount,
-		Currency:    "CNY",
+		Currency:    currency,
 		Credits:     credits,
 		Method:      method,
 		Status:      PaymentStatusPending,
@@ -169,6 +201,8 @@ func (s *PaymentService) CreateRechargeOrder(userID string, amount int64, method
 		err = s.createAlipayOrder(order, config)
 	case PaymentMethodWechat:
 		err = s.createWechatOrder(order, config)
+	case PaymentMethodStripe:
+		err = s.createStripeOrder(order, config)
 	default:
 		return nil, fmt.Errorf("unsupported payment method: %s", method)
 	}
@@ -193,15 +227,18 @@ func (s *PaymentService) createAlipayOrder(order *PaymentOrder, config *PaymentC
 	bm.Set("subject", order.Description)
 	bm.Set("out_trade_no", order.OrderID)
 	bm.Set("total_amount", fmt.Sprintf("%.2f", float64(order.Amount)/100))
-	bm.Set("product_code", "FAST_INSTANT_TRADE_PAY")
+	bm.Set("notify_url", config.NotifyURL)
+	bm.Set("timeout_express", "30m")
 
-	// Create page pay (web payment)
-	payURL, err := s.alipayClient.TradePagePay(context.Background(), bm)
+	// Create precreate order (QR code), so the desktop app can render the checkout itself
+	resp, err := s.alipayClient.TradePrecreate(context.Background(), bm)
 	if err != nil {
 		return fmt.Errorf("failed to create alipay order: %w", err)
 	}
 
-	order.PayURL = payURL
+	// qr.alipay.com links also open the Alipay cashier when visited in a browser
+	order.QRCode = resp.Response.QrCode
+	order.PayURL = resp.Response.QrCode
 
 	return nil
 }
@@ -243,7 +280,7 @@ func (s *PaymentService) GetOrder(orderID string) (*PaymentOrder, error) {
 	if v, ok := s.orders.Load(orderID); ok {
 		return v.(*PaymentOrder), nil
 	}
-	return nil, fmt.Errorf("order not found: %s", orderID)
+	return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, orderID)
 }
 
 // HandleAlipayCallback handles Alipay payment callback
@@ -272,7 +309,7 @@ func (s *PaymentService) HandleAlipayCallback(params map[string]string) (*Paymen
 	if totalAmount, ok := params["total_amount"]; ok {
 		var amount float64
 		fmt.Sscanf(totalAmount, "%f", &amount)
-		callback.Amount = int64(amount * 100)
+		callback.Amount = int64(math.Round(amount * 100))
 	}
 
 	// Map status
@@ -301,7 +338,8 @@ type WechatNotifyResult struct {
 	TransactionId string `json:"transaction_id"`
 	TradeState    string `json:"trade_state"`
 	Amount        struct {
-		Total int `json:"total"`
+		Total    int    `json:"total"`
+		Currency string `json:"currency"`
 	} `json:"amount"`
 }
 
@@ -327,10 +365,11 @@ func (s *PaymentService) HandleWechatCallback(notifyReq *wechat.V3NotifyReq) (*P
 	}
 
 	callback := &PaymentCallback{
-		Method:  PaymentMethodWechat,
-		OrderID: result.OutTradeNo,
-		TradeNo: result.TransactionId,
-		Amount:  int64(result.Amount.Total),
+		Method:   PaymentMethodWechat,
+		OrderID:  result.OutTradeNo,
+		TradeNo:  result.TransactionId,
+		Amount:   int64(result.Amount.Total),
+		Currency: result.Amount.Currency,
 	}
 
 	// Map status
@@ -355,51 +394,77 @@ func (s *PaymentService) HandleWechatCallback(notifyReq *wechat.V3NotifyReq) (*P
 	return callback, nil
 }
 
-// completePayment completes a successful payment
+// completePayment completes a successful payment. The pending → paid transition is claimed
+// before the wallet is topped up, so duplicate or concurrent deliveries credit the order once.
 func (s *PaymentService) completePayment(callback *PaymentCallback) error {
-	// Get order
 	order, err := s.GetOrder(callback.OrderID)
 	if err != nil {
 		return err
 	}
 
-	// Check if already processed
-	if order.Status == PaymentStatusPaid {
+	// Only pending orders are settled; paid ones are duplicates, closed ones are not reopened
+	if order.Status != PaymentStatusPending {
 		return nil
 	}
+	if callback.Amount != order.Amount {
+		return fmt.Errorf("%w: order %s paid %d, expected %d", ErrPaymentMismatch, order.OrderID, callback.Amount, order.Amount)
+	}
+	if callback.Currency != "" && !strings.EqualFold(callback.Currency, order.Currency) {
+		return fmt.Errorf("%w: order %s paid in %s, expected %s", ErrPaymentMismatch, order.OrderID, callback.Currency, order.Currency)
+	}
 
-	// Update order status
 	now := time.Now()
-	order.Status = PaymentStatusPaid
-	order.TradeNo = callback.TradeNo
-	order.PaidAt = &now
+	pending, order, err := s.transitionOrder(callback.OrderID, PaymentStatusPending, func(o *PaymentOrder) {
+		o.Status = PaymentStatusPaid
+		o.TradeNo = callback.TradeNo
+		o.PaidAt = &now
+	})
+	if err != nil || order == nil {
+		// Another delivery settled or closed the order in the meantime
+		return err
+	}
 
 	// Add credits to Lago wallet
 	if s.lagoService != nil && s.lagoService.IsEnabled() {
-		// Get user's wallet
-		wallets, err := s.lagoService.GetCustomerWallets(order.UserID)
-		if err != nil {
-			return fmt.Errorf("failed to get wallets: %w", err)
+		if err := s.topUpOrderCredits(order); err != nil {
+			// Release the claim so the provider's retry can settle the order
+			s.orders.CompareAndSwap(order.OrderID, order, pending)
+			return err
 		}
+	}
+	s.notifyOrderChanged(order.OrderID)
 
-		if len(wallets) == 0 {
-			return fmt.Errorf("no wallet found for user: %s", order.UserID)
+	// The payment is complete even if its invoice fails; it is retried when the user lists invoices
+	if s.invoices != nil {
+		if _, err := s.invoices.IssueForOrder(order); err != nil {
+			fmt.Printf("[Billing] Failed to issue invoice for order %s: %v\n", order.OrderID, err)
 		}
+	}
 
-		// Top up wallet with paid credits
-		_, err = s.lagoService.TopUpWallet(
-			wallets[0].LagoID,
-			fmt.Sprintf("%d", order.Credits),
-			"0", // No granted credits
-		)
-		if err != nil {
-			return fmt.Errorf("failed to top up wallet: %w", err)
-		}
+	return nil
+}
+
+// topUpOrderCredits adds an order's credits to the user's first Lago wallet
+func (s *PaymentService) topUpOrderCredits(order *PaymentOrder) error {
+	// Get user's wallet
+	wallets, err := s.lagoService.GetCustomerWallets(order.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get wallets: %w", err)
 	}
 
-	// Store updated order
-	s.orders.Store(order.OrderID, order)
+	if len(wallets) == 0 {
+		return fmt.Errorf("no wallet found for user: %s", order.UserID)
+	}
 
+	// Top up wallet with paid credits
+	_, err = s.lagoService.TopUpWallet(
+		wallets[0].LagoID,
+		fmt.Sprintf("%d", order.Credits),
+		"0", // No granted credits
+	)
+	if err != nil {
+		return fmt.Errorf("failed to top up wallet: %w", err)
+	}
 	return nil
 }
 
@@ -423,16 +488,15 @@ func (s *PaymentService) QueryAlipayOrder(orderID string) (*PaymentOrder, error)
 	}
 
 	// Update status based on response
-	switch resp.Response.TradeStatus {
-	case "TRADE_SUCCESS", "TRADE_FINISHED":
-		order.Status = PaymentStatusPaid
-		order.TradeNo = resp.Response.TradeNo
-	case "TRADE_CLOSED":
-		order.Status = PaymentStatusCancelled
-	}
-
-	s.orders.Store(orderID, order)
-	return order, nil
+	return s.updateOrder(order, func(o *PaymentOrder) {
+		switch resp.Response.TradeStatus {
+		case "TRADE_SUCCESS", "TRADE_FINISHED":
+			o.Status = PaymentStatusPaid
+			o.TradeNo = resp.Response.TradeNo
+		case "TRADE_CLOSED":
+			o.Status = PaymentStatusCancelled
+		}
+	}), nil
 }
 
 // QueryWechatOrder queries WeChat order status
@@ -452,16 +516,15 @@ func (s *PaymentService) QueryWechatOrder(orderID string) (*PaymentOrder, error)
 	}
 
 	// Update status based on response
-	switch resp.Response.TradeState {
-	case "SUCCESS":
-		order.Status = PaymentStatusPaid
-		order.TradeNo = resp.Response.TransactionId
-	case "CLOSED", "REVOKED":
-		order.Status = PaymentStatusCancelled
-	}
-
-	s.orders.Store(orderID, order)
-	return order, nil
+	return s.updateOrder(order, func(o *PaymentOrder) {
+		switch resp.Response.TradeState {
+		case "SUCCESS":
+			o.Status = PaymentStatusPaid
+			o.TradeNo = resp.Response.TransactionId
+		case "CLOSED", "REVOKED":
+			o.Status = PaymentStatusCancelled
+		}
+	}), nil
 }
 
 // RefundOrder refunds a paid order
@@ -482,6 +545,8 @@ func (s *PaymentService) RefundOrder(orderID, reason string) error {
 		return s.refundAlipay(order, refundID, reason)
 	case PaymentMethodWechat:
 		return s.refundWechat(order, refundID, reason)
+	case PaymentMethodStripe:
+		return s.refundStripe(order, refundID, reason)
 	default:
 		return fmt.Errorf("unsupported payment method")
 	}
@@ -503,8 +568,7 @@ func (s *PaymentService) refundAlipay(order *PaymentOrder, refundID, reason stri
 		return fmt.Errorf("failed to refund: %w", err)
 	}
 
-	order.Status = PaymentStatusRefunded
-	s.orders.Store(order.OrderID, order)
+	s.updateOrder(order, func(o *PaymentOrder) { o.Status = PaymentStatusRefunded })
 
 	return nil
 }
@@ -529,8 +593,7 @@ func (s *PaymentService) refundWechat(order *PaymentOrder, refundID, reason stri
 		return fmt.Errorf("failed to refund: %w", err)
 	}
 
-	order.Status = PaymentStatusRefunded
-	s.orders.Store(order.OrderID, order)
+	s.updateOrder(order, func(o *PaymentOrder) { o.Status = PaymentStatusRefunded })
 
 	return nil
 }
@@ -562,6 +625,10 @@ func (s *PaymentService) UpdateConfig(config *PaymentConfig) error {
 		s.wechatClient = client
 	}
 
+	if config.StripeSecretKey != "" {
+		s.stripeClient = newStripeClient(config)
+	}
+
 	return nil
 }
 
@@ -574,3 +641,8 @@ func (s *PaymentService) IsAlipayEnabled() bool {
 func (s *PaymentService) IsWechatEnabled() bool {
 	return s.wechatClient != nil
 }
+
+// IsStripeEnabled checks if Stripe is configured
+func (s *PaymentService) IsStripeEnabled() bool {
+	return s.stripeClient != nil
+}
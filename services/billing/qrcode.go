@@ -0,0 +1,562 @@
+package billing
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// QR code rendering for checkout (WeChat native code_url / Alipay precreate qr_code).
+// Payment QR contents are short URLs, so the encoder only implements byte mode
+// with error correction level M for versions 1-10 (up to 213 bytes).
+
+// QRCodeFormat output image format
+type QRCodeFormat string
+
+const (
+	QRCodeFormatPNG QRCodeFormat = "png"
+	QRCodeFormatSVG QRCodeFormat = "svg"
+)
+
+const (
+	qrMaxVersion = 10
+	qrQuietZone  = 4 // Modules of light border required around the symbol
+
+	// DefaultQRCodeSize default rendered image width in pixels
+	DefaultQRCodeSize = 256
+	// MaxQRCodeSize upper bound for the requested image width
+	MaxQRCodeSize = 1024
+)
+
+// qrBlockGroup a group of error correction blocks with the same data length
+type qrBlockGroup struct {
+	blocks        int
+	dataCodewords int
+}
+
+// qrVersionInfo block structure of a version at error correction level M
+type qrVersionInfo struct {
+	eccPerBlock int
+	groups      []qrBlockGroup
+	alignment   []int
+}
+
+var qrVersions = [qrMaxVersion + 1]qrVersionInfo{
+	1:  {10, []qrBlockGroup{{1, 16}}, nil},
+	2:  {16, []qrBlockGroup{{1, 28}}, []int{6, 18}},
+	3:  {26, []qrBlockGroup{{1, 44}}, []int{6, 22}},
+	4:  {18, []qrBlockGroup{{2, 32}}, []int{6, 26}},
+	5:  {24, []qrBlockGroup{{2, 43}}, []int{6, 30}},
+	6:  {16, []qrBlockGroup{{4, 27}}, []int{6, 34}},
+	7:  {18, []qrBlockGroup{{4, 31}}, []int{6, 22, 38}},
+	8:  {22, []qrBlockGroup{{2, 38}, {2, 39}}, []int{6, 24, 42}},
+	9:  {22, []qrBlockGroup{{3, 36}, {2, 37}}, []int{6, 26, 46}},
+	10: {26, []qrBlockGroup{{4, 43}, {1, 44}}, []int{6, 28, 50}},
+}
+
+func (v qrVersionInfo) dataCodewords() int {
+	total := 0
+	for _, g := range v.groups {
+		total += g.blocks * g.dataCodewords
+	}
+	return total
+}
+
+// QRCode an encoded QR symbol
+type QRCode struct {
+	Version int
+	Size    int // Modules per side, excluding the quiet zone
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// EncodeQRCode encodes content as a QR code using the smallest version that fits
+func EncodeQRCode(content string) (*QRCode, error) {
+	data := []byte(content)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("qr code content is empty")
+	}
+
+	version := 0
+	for v := 1; v <= qrMaxVersion; v++ {
+		if 4+qrCountBits(v)+len(data)*8 <= qrVersions[v].dataCodewords()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("qr code content too long: %d bytes", len(data))
+	}
+
+	q := &QRCode{Version: version, Size: version*4 + 17}
+	q.modules = make([][]bool, q.Size)
+	q.isFunction = make([][]bool, q.Size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.Size)
+		q.isFunction[i] = make([]bool, q.Size)
+	}
+
+	q.drawFunctionPatterns()
+	q.drawCodewords(qrAddECCAndInterleave(version, qrEncodeData(version, data)))
+
+	// Pick the mask with the lowest penalty; applying a mask twice undoes it
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(bestMask)
+	q.drawFormatBits(bestMask)
+
+	return q, nil
+}
+
+// Dark reports whether the module at (x, y) is dark
+func (q *QRCode) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// PNG renders the code as a PNG image roughly size pixels wide, including the quiet zone
+func (q *QRCode) PNG(size int) ([]byte, error) {
+	scale := q.moduleScale(size)
+	width := (q.Size + 2*qrQuietZone) * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			px, py := (x+qrQuietZone)*scale, (y+qrQuietZone)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(px+dx, py+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode qr code png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as an SVG document size pixels wide, including the quiet zone
+func (q *QRCode) SVG(size int) []byte {
+	if size <= 0 {
+		size = DefaultQRCodeSize
+	}
+	dim := q.Size + 2*qrQuietZone
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", size, size, dim, dim)
+	buf.WriteString(`<rect width="100%" height="100%" fill="#FFFFFF"/>` + "\n")
+	buf.WriteString(`<path d="`)
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&buf, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	buf.WriteString(`" fill="#000000"/>` + "\n")
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// moduleScale pixels per module so the image is close to, but not larger than, size
+func (q *QRCode) moduleScale(size int) int {
+	if size <= 0 {
+		size = DefaultQRCodeSize
+	}
+	scale := size / (q.Size + 2*qrQuietZone)
+	if scale < 1 {
+		scale = 1
+	}
+	return scale
+}
+
+// ===== Data encoding =====
+
+// qrCountBits length of the byte mode character count indicator
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+type qrBitBuffer struct {
+	data []byte
+	bits int
+}
+
+func (b *qrBitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if b.bits%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+		if (value>>i)&1 != 0 {
+			b.data[b.bits/8] |= 0x80 >> (b.bits % 8)
+		}
+		b.bits++
+	}
+}
+
+// qrEncodeData builds the data codewords: mode, count, payload, terminator and padding
+func qrEncodeData(version int, data []byte) []byte {
+	capacity := qrVersions[version].dataCodewords() * 8
+
+	var buf qrBitBuffer
+	buf.append(0x4, 4) // Byte mode
+	buf.append(len(data), qrCountBits(version))
+	for _, b := range data {
+		buf.append(int(b), 8)
+	}
+
+	terminator := capacity - buf.bits
+	if terminator > 4 {
+		terminator = 4
+	}
+	buf.append(0, terminator)
+	if rem := buf.bits % 8; rem != 0 {
+		buf.append(0, 8-rem)
+	}
+	for pad := 0xEC; buf.bits < capacity; pad ^= 0xEC ^ 0x11 {
+		buf.append(pad, 8)
+	}
+	return buf.data
+}
+
+// qrAddECCAndInterleave splits data into blocks, appends Reed-Solomon codewords and interleaves them
+func qrAddECCAndInterleave(version int, data []byte) []byte {
+	info := qrVersions[version]
+	divisor := qrReedSolomonDivisor(info.eccPerBlock)
+
+	var dataBlocks, eccBlocks [][]byte
+	offset, maxData := 0, 0
+	for _, g := range info.groups {
+		for i := 0; i < g.blocks; i++ {
+			block := data[offset : offset+g.dataCodewords]
+			offset += g.dataCodewords
+			dataBlocks = append(dataBlocks, block)
+			eccBlocks = append(eccBlocks, qrReedSolomonRemainder(block, divisor))
+			if len(block) > maxData {
+				maxData = len(block)
+			}
+		}
+	}
+
+	result := make([]byte, 0, len(data)+len(eccBlocks)*info.eccPerBlock)
+	for i := 0; i < maxData; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.eccPerBlock; i++ {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// qrReedSolomonDivisor generator polynomial of the given degree, leading coefficient omitted
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrGFMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrGFMultiply(root, 0x02)
+	}
+	return result
+}
+
+func qrReedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= qrGFMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// qrGFMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func qrGFMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// ===== Module placement =====
+
+func (q *QRCode) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.isFunction[y][x] = true
+}
+
+func (q *QRCode) drawFunctionPatterns() {
+	// Timing patterns
+	for i := 0; i < q.Size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with separators
+	q.drawFinderPattern(3, 3)
+	q.drawFinderPattern(q.Size-4, 3)
+	q.drawFinderPattern(3, q.Size-4)
+
+	// Alignment patterns, except where they would overlap the finders
+	positions := qrVersions[q.Version].alignment
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			q.drawAlignmentPattern(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is chosen
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+func (q *QRCode) drawFinderPattern(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= q.Size || y < 0 || y >= q.Size {
+				continue
+			}
+			dist := max(qrAbs(dx), qrAbs(dy))
+			q.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (q *QRCode) drawAlignmentPattern(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			q.setFunction(cx+dx, cy+dy, max(qrAbs(dx), qrAbs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M and the given mask
+func (q *QRCode) drawFormatBits(mask int) {
+	const eccLevelM = 0 // Format bits of error correction level M
+	data := eccLevelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	// Around the top-left finder
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, qrBit(bits, i))
+	}
+	q.setFunction(8, 7, qrBit(bits, 6))
+	q.setFunction(8, 8, qrBit(bits, 7))
+	q.setFunction(7, 8, qrBit(bits, 8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, qrBit(bits, i))
+	}
+
+	// Split between the other two finders
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.Size-1-i, 8, qrBit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.Size-15+i, qrBit(bits, i))
+	}
+	q.setFunction(8, q.Size-8, true) // Always dark
+}
+
+// drawVersion draws the version information blocks (versions 7 and up)
+func (q *QRCode) drawVersion() {
+	if q.Version < 7 {
+		return
+	}
+	rem := q.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := qrBit(bits, i)
+		a, b := q.Size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order, skipping function modules
+func (q *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.Size; vert++ {
+			y := vert
+			if upward {
+				y = q.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if q.isFunction[y][x] || i >= len(data)*8 {
+					continue
+				}
+				q.modules[y][x] = qrBit(int(data[i/8]), 7-i%8)
+				i++
+			}
+		}
+	}
+	// Remainder bits stay light
+}
+
+func (q *QRCode) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol per the mask evaluation rules of ISO/IEC 18004
+func (q *QRCode) penalty() int {
+	result := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+
+	for _, vertical := range []bool{false, true} {
+		at := func(line, pos int) bool {
+			if vertical {
+				return q.modules[pos][line]
+			}
+			return q.modules[line][pos]
+		}
+		for line := 0; line < q.Size; line++ {
+			// Rule 1: runs of five or more same-colored modules
+			run := 1
+			for pos := 1; pos < q.Size; pos++ {
+				if at(line, pos) == at(line, pos-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				result += run - 2
+			}
+
+			// Rule 3: finder-like patterns
+			for pos := 0; pos+11 <= q.Size; pos++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, dark := range pattern {
+						if at(line, pos+k) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						result += 40
+					}
+				}
+			}
+		}
+	}
+
+	// Rule 2: 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.Size && y+1 < q.Size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+
+	// Rule 4: balance of dark and light modules
+	total := q.Size * q.Size
+	k := (qrAbs(dark*20-total*10)+total-1)/total - 1
+	result += k * 10
+	return result
+}
+
+func qrBit(value, i int) bool {
+	return (value>>i)&1 != 0
+}
+
+func qrAbs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
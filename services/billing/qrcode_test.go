@@ -0,0 +1,265 @@
+package billing
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// decodeQRCode reads a symbol back: format bits, unmasking, de-interleaving,
+// Reed-Solomon check and byte mode payload
+func decodeQRCode(t *testing.T, q *QRCode) string {
+	t.Helper()
+
+	// Format bits from the copy around the top-left finder
+	bits := 0
+	set := func(i int, dark bool) {
+		if dark {
+			bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(i, q.Dark(8, i))
+	}
+	set(6, q.Dark(8, 7))
+	set(7, q.Dark(8, 8))
+	set(8, q.Dark(7, 8))
+	for i := 9; i < 15; i++ {
+		set(i, q.Dark(14-i, 8))
+	}
+	// The second copy must match
+	other := 0
+	for i := 0; i < 8; i++ {
+		if q.Dark(q.Size-1-i, 8) {
+			other |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if q.Dark(8, q.Size-15+i) {
+			other |= 1 << i
+		}
+	}
+	if bits != other {
+		t.Fatalf("format copies differ: %015b vs %015b", bits, other)
+	}
+	format := bits ^ 0x5412
+	if level := format >> 13; level != 0 {
+		t.Fatalf("error correction level bits = %02b, want 00 (M)", level)
+	}
+	mask := (format >> 10) & 7
+
+	// Rebuild the function pattern layout, then read the data modules in zigzag order
+	ref := &QRCode{Version: q.Version, Size: q.Size}
+	ref.modules = make([][]bool, q.Size)
+	ref.isFunction = make([][]bool, q.Size)
+	for i := range ref.modules {
+		ref.modules[i] = make([]bool, q.Size)
+		ref.isFunction[i] = make([]bool, q.Size)
+	}
+	ref.drawFunctionPatterns()
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if !ref.isFunction[y][x] {
+				ref.modules[y][x] = q.modules[y][x]
+			}
+		}
+	}
+	ref.applyMask(mask)
+
+	info := qrVersions[q.Version]
+	blocks := 0
+	for _, g := range info.groups {
+		blocks += g.blocks
+	}
+	total := info.dataCodewords() + blocks*info.eccPerBlock
+	raw := make([]byte, total)
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.Size; vert++ {
+			y := vert
+			if upward {
+				y = q.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if ref.isFunction[y][x] || i >= total*8 {
+					continue
+				}
+				if ref.modules[y][x] {
+					raw[i/8] |= 0x80 >> (i % 8)
+				}
+				i++
+			}
+		}
+	}
+
+	// De-interleave and verify every block is a valid Reed-Solomon codeword
+	var lengths []int
+	for _, g := range info.groups {
+		for k := 0; k < g.blocks; k++ {
+			lengths = append(lengths, g.dataCodewords)
+		}
+	}
+	blockData := make([][]byte, len(lengths))
+	pos := 0
+	for k := 0; k < lengths[len(lengths)-1]; k++ {
+		for b, n := range lengths {
+			if k < n {
+				blockData[b] = append(blockData[b], raw[pos])
+				pos++
+			}
+		}
+	}
+	blockECC := make([][]byte, len(lengths))
+	for k := 0; k < info.eccPerBlock; k++ {
+		for b := range lengths {
+			blockECC[b] = append(blockECC[b], raw[pos])
+			pos++
+		}
+	}
+	divisor := qrReedSolomonDivisor(info.eccPerBlock)
+	var data []byte
+	for b := range lengths {
+		codeword := append(append([]byte{}, blockData[b]...), blockECC[b]...)
+		for _, r := range qrReedSolomonRemainder(codeword, divisor) {
+			if r != 0 {
+				t.Fatalf("block %d is not a valid Reed-Solomon codeword", b)
+			}
+		}
+		data = append(data, blockData[b]...)
+	}
+
+	// Byte mode segment
+	reader := bitReader{data: data}
+	if mode := reader.read(4); mode != 0x4 {
+		t.Fatalf("mode = %04b, want 0100 (byte)", mode)
+	}
+	count := reader.read(qrCountBits(q.Version))
+	out := make([]byte, count)
+	for k := range out {
+		out[k] = byte(reader.read(8))
+	}
+	return string(out)
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(r.data[r.pos/8]>>(7-r.pos%8))&1
+		r.pos++
+	}
+	return v
+}
+
+func TestEncodeQRCodeRoundTrip(t *testing.T) {
+	cases := []struct {
+		content string
+		version int
+	}{
+		{"hello", 1},
+		{"weixin://wxpay/bizpayurl?pr=Qk8tHBUzz", 3},
+		{"https://qr.alipay.com/bax03431ljhokirwl38f00a7", 4},
+		{strings.Repeat("a", 150), 8},
+		{strings.Repeat("b", 213), 10},
+	}
+
+	for _, tc := range cases {
+		q, err := EncodeQRCode(tc.content)
+		if err != nil {
+			t.Fatalf("EncodeQRCode(%d bytes): %v", len(tc.content), err)
+		}
+		if q.Version != tc.version || q.Size != tc.version*4+17 {
+			t.Errorf("%d bytes: version %d size %d, want version %d", len(tc.content), q.Version, q.Size, tc.version)
+		}
+		if got := decodeQRCode(t, q); got != tc.content {
+			t.Errorf("decoded %q, want %q", got, tc.content)
+		}
+	}
+}
+
+func TestEncodeQRCodeFunctionPatterns(t *testing.T) {
+	q, err := EncodeQRCode(strings.Repeat("x", 120)) // Version 7 carries version information
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Version != 7 {
+		t.Fatalf("version = %d, want 7", q.Version)
+	}
+
+	// Finder pattern rows: dark ring, light ring, 3x3 dark core, then the light separator
+	want := []string{"#######.", "#.....#.", "#.###.#.", "#.###.#.", "#.###.#.", "#.....#.", "#######.", "........"}
+	for y, row := range want {
+		for x, c := range row {
+			if q.Dark(x, y) != (c == '#') || q.Dark(q.Size-1-x, y) != (c == '#') || q.Dark(x, q.Size-1-y) != (c == '#') {
+				t.Fatalf("finder module (%d,%d) wrong", x, y)
+			}
+		}
+	}
+	if !q.Dark(8, q.Size-8) {
+		t.Error("dark module missing")
+	}
+
+	// Version 7 information is 000111 110010 010100
+	const versionBits = 0x07C94
+	for i := 0; i < 18; i++ {
+		dark := (versionBits>>i)&1 != 0
+		a, b := q.Size-11+i%3, i/3
+		if q.Dark(a, b) != dark || q.Dark(b, a) != dark {
+			t.Fatalf("version bit %d wrong", i)
+		}
+	}
+}
+
+func TestEncodeQRCodeErrors(t *testing.T) {
+	if _, err := EncodeQRCode(""); err == nil {
+		t.Error("expected error for empty content")
+	}
+	if _, err := EncodeQRCode(strings.Repeat("c", 214)); err == nil {
+		t.Error("expected error for content beyond version 10")
+	}
+}
+
+func TestQRCodeRendering(t *testing.T) {
+	q, err := EncodeQRCode("weixin://wxpay/bizpayurl?pr=Qk8tHBUzz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := q.PNG(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid png: %v", err)
+	}
+	// 29 modules + 8 quiet zone = 37, 6 px per module
+	if w := img.Bounds().Dx(); w != 37*6 {
+		t.Errorf("png width = %d, want %d", w, 37*6)
+	}
+	// Top-left finder corner is dark, the quiet zone light
+	if r, _, _, _ := img.At(4*6, 4*6).RGBA(); r != 0 {
+		t.Error("finder corner should be dark")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("quiet zone should be light")
+	}
+
+	svg := string(q.SVG(300))
+	if !strings.Contains(svg, `width="300"`) || !strings.Contains(svg, `viewBox="0 0 37 37"`) {
+		t.Errorf("unexpected svg header: %.200s", svg)
+	}
+	if !strings.Contains(svg, "M4,4h1v1h-1z") {
+		t.Error("svg should contain the finder corner module")
+	}
+}
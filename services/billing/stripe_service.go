@@ -0,0 +1,356 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStripeAPIURL   = "https://api.stripe.com"
+	defaultStripeCurrency = "usd"
+
+	// stripeWebhookTolerance maximum age of a webhook signature timestamp
+	stripeWebhookTolerance = 5 * time.Minute
+	// stripeCheckoutTTL Stripe requires checkout sessions to stay open at least 30 minutes
+	stripeCheckoutTTL = time.Hour
+)
+
+// ErrStripeSignature the Stripe-Signature header did not verify
+var ErrStripeSignature = errors.New("invalid stripe signature")
+
+// StripeCheckoutSession represents a Stripe Checkout session
+type StripeCheckoutSession struct {
+	ID                string            `json:"id"`
+	URL               string            `json:"url"`
+	Status            string            `json:"status"`         // open, complete, expired
+	PaymentStatus     string            `json:"payment_status"` // paid, unpaid, no_payment_required
+	PaymentIntent     string            `json:"payment_intent"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+// StripeRefund represents a Stripe refund
+type StripeRefund struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	Amount        int64  `json:"amount"`
+	PaymentIntent string `json:"payment_intent"`
+}
+
+// StripeEvent represents a Stripe webhook event
+type StripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// stripeClient is a minimal client for the Stripe REST API (form-encoded requests, JSON responses)
+type stripeClient struct {
+	apiURL     string
+	secretKey  string
+	httpClient *http.Client
+}
+
+func newStripeClient(config *PaymentConfig) *stripeClient {
+	apiURL := config.StripeAPIURL
+	if apiURL == "" {
+		apiURL = defaultStripeAPIURL
+	}
+	return &stripeClient{
+		apiURL:    strings.TrimRight(apiURL, "/"),
+		secretKey: config.StripeSecretKey,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// doRequest performs a form-encoded POST to the Stripe API and decodes the JSON response
+func (c *stripeClient) doRequest(endpoint string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequest("POST", c.apiURL+"/v1/"+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		// Retries with the same key return the original result instead of charging twice
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("stripe error (status %d, %s): %s", resp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+		}
+		return fmt.Errorf("stripe error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// createCheckoutSession creates a hosted checkout page for a one-off order
+func (c *stripeClient) createCheckoutSession(order *PaymentOrder, successURL, cancelURL string) (*StripeCheckoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", successURL)
+	form.Set("cancel_url", cancelURL)
+	form.Set("client_reference_id", order.OrderID)
+	form.Set("expires_at", strconv.FormatInt(order.ExpiredAt.Unix(), 10))
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(order.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(order.Amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", order.Description)
+	form.Set("metadata[order_id]", order.OrderID)
+	form.Set("metadata[user_id]", order.UserID)
+
+	session := new(StripeCheckoutSession)
+	if err := c.doRequest("checkout/sessions", form, order.OrderID, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// refund refunds a payment intent in full
+func (c *stripeClient) refund(paymentIntentID string, amount int64, refundID, orderID, reason string) (*StripeRefund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", paymentIntentID)
+	form.Set("amount", strconv.FormatInt(amount, 10))
+	form.Set("metadata[order_id]", orderID)
+	if reason != "" {
+		// Stripe's reason field only accepts a fixed set of values, free text goes to metadata
+		form.Set("metadata[reason]", reason)
+	}
+
+	refund := new(StripeRefund)
+	if err := c.doRequest("refunds", form, refundID, refund); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// verifyStripeSignature checks a Stripe-Signature header ("t=<unix>,v1=<hex hmac>,...")
+// against the payload and endpoint secret, rejecting timestamps outside the tolerance
+func verifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrStripeSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStripeSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > stripeWebhookTolerance || age < -stripeWebhookTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrStripeSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	// Several v1 signatures are sent while the endpoint secret is being rolled
+	for _, sig := range signatures {
+		if decoded, err := hex.DecodeString(sig); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrStripeSignature
+}
+
+func (c *PaymentConfig) stripeCurrency() string {
+	if c.StripeCurrency == "" {
+		return defaultStripeCurrency
+	}
+	return strings.ToLower(c.StripeCurrency)
+}
+
+func (c *PaymentConfig) stripeCreditsPerUnit() int64 {
+	if c.StripeCreditsPerUnit <= 0 {
+		return 10
+	}
+	return c.StripeCreditsPerUnit
+}
+
+// createStripeOrder creates a Stripe Checkout session for the order
+func (s *PaymentService) createStripeOrder(order *PaymentOrder, config *PaymentConfig) error {
+	if s.stripeClient == nil {
+		return fmt.Errorf("stripe client not configured")
+	}
+	if config.ReturnURL == "" {
+		return fmt.Errorf("return_url is required for stripe checkout")
+	}
+
+	order.ExpiredAt = order.CreatedAt.Add(stripeCheckoutTTL)
+	successURL := withQuery(config.ReturnURL, "order_id", order.OrderID)
+	session, err := s.stripeClient.createCheckoutSession(order, successURL, config.ReturnURL)
+	if err != nil {
+		return fmt.Errorf("failed to create stripe checkout session: %w", err)
+	}
+
+	order.SessionID = session.ID
+	order.PayURL = session.URL
+
+	return nil
+}
+
+// HandleStripeWebhook verifies a Stripe webhook and applies checkout session events.
+// Orders are settled by checkout.session.* events only; payment_intent.* and other
+// event types are acknowledged without changes, so one payment cannot settle an order twice.
+func (s *PaymentService) HandleStripeWebhook(payload []byte, signature string) (*PaymentCallback, error) {
+	s.mu.RLock()
+	secret := s.config.StripeWebhookSecret
+	s.mu.RUnlock()
+
+	if s.stripeClient == nil || secret == "" {
+		return nil, fmt.Errorf("stripe webhook not configured")
+	}
+	if err := verifyStripeSignature(payload, signature, secret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event StripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid stripe event: %w", err)
+	}
+
+	callback := &PaymentCallback{
+		Method:  PaymentMethodStripe,
+		RawData: event.ID,
+	}
+
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded",
+		"checkout.session.async_payment_failed", "checkout.session.expired":
+		var session StripeCheckoutSession
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return nil, fmt.Errorf("invalid checkout session: %w", err)
+		}
+		callback.OrderID = session.ClientReferenceID
+		callback.TradeNo = session.PaymentIntent
+		callback.Amount = session.AmountTotal
+		callback.Currency = session.Currency
+		switch {
+		case session.PaymentStatus == "paid":
+			callback.Status = PaymentStatusPaid
+		case event.Type == "checkout.session.async_payment_failed":
+			callback.Status = PaymentStatusFailed
+		case event.Type == "checkout.session.expired":
+			callback.Status = PaymentStatusCancelled
+		default:
+			// Delayed payment methods complete later with async_payment_succeeded
+			callback.Status = PaymentStatusPending
+		}
+
+	default:
+		return callback, nil
+	}
+
+	// Sessions not created by CreateRechargeOrder carry no order
+	if callback.OrderID == "" {
+		return callback, nil
+	}
+
+	switch callback.Status {
+	case PaymentStatusPaid:
+		if err := s.completePayment(callback); err != nil {
+			return nil, err
+		}
+	case PaymentStatusFailed, PaymentStatusCancelled:
+		if err := s.closePendingOrder(callback.OrderID, callback.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	return callback, nil
+}
+
+// closePendingOrder marks a still pending order as failed or cancelled
+func (s *PaymentService) closePendingOrder(orderID string, status PaymentStatus) error {
+	_, closed, err := s.transitionOrder(orderID, PaymentStatusPending, func(o *PaymentOrder) { o.Status = status })
+	if err != nil || closed == nil {
+		return err
+	}
+	s.notifyOrderChanged(orderID)
+	return nil
+}
+
+func (s *PaymentService) refundStripe(order *PaymentOrder, refundID, reason string) error {
+	if s.stripeClient == nil {
+		return fmt.Errorf("stripe client not configured")
+	}
+	if order.TradeNo == "" {
+		return fmt.Errorf("order has no stripe payment intent")
+	}
+
+	_, err := s.stripeClient.refund(order.TradeNo, order.Amount, refundID, order.OrderID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to refund: %w", err)
+	}
+
+	s.updateOrder(order, func(o *PaymentOrder) { o.Status = PaymentStatusRefunded })
+
+	return nil
+}
+
+// withQuery appends a query parameter to a URL, leaving it unchanged if it cannot be parsed
+func withQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
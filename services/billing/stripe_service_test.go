@@ -0,0 +1,201 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testStripeWebhookSecret = "whsec_test"
+
+func signStripePayload(payload string, at time.Time) string {
+	ts := fmt.Sprintf("%d", at.Unix())
+	mac := hmac.New(sha256.New, []byte(testStripeWebhookSecret))
+	mac.Write([]byte(ts + "." + payload))
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newStripeTestService returns a payment service talking to a fake Stripe API that records requests
+func newStripeTestService(t *testing.T) (*PaymentService, *[]url.Values) {
+	t.Helper()
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(401)
+			fmt.Fprint(w, `{"error":{"type":"invalid_request_error","message":"bad key"}}`)
+			return
+		}
+		r.ParseForm()
+		form := r.PostForm
+		form.Set("_path", r.URL.Path)
+		form.Set("_idempotency", r.Header.Get("Idempotency-Key"))
+		requests = append(requests, form)
+
+		switch r.URL.Path {
+		case "/v1/checkout/sessions":
+			fmt.Fprint(w, `{"id":"cs_test_1","url":"https://checkout.stripe.com/c/pay/cs_test_1","status":"open","payment_status":"unpaid"}`)
+		case "/v1/refunds":
+			fmt.Fprintf(w, `{"id":"re_1","status":"succeeded","amount":%s,"payment_intent":%q}`, form.Get("amount"), form.Get("payment_intent"))
+		default:
+			w.WriteHeader(404)
+			fmt.Fprint(w, `{"error":{"type":"invalid_request_error","message":"not found"}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := NewPaymentService(&PaymentConfig{
+		StripeSecretKey:     "sk_test",
+		StripeWebhookSecret: testStripeWebhookSecret,
+		StripeCurrency:      "EUR",
+		StripeAPIURL:        server.URL,
+		ReturnURL:           "https://app.example.com/billing?tab=wallet",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, &requests
+}
+
+func TestStripeCheckoutAndWebhook(t *testing.T) {
+	s, requests := newStripeTestService(t)
+	if !s.IsStripeEnabled() {
+		t.Fatal("stripe should be enabled")
+	}
+
+	order, err := s.CreateRechargeOrder("u1", 1000, PaymentMethodStripe, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.PayURL != "https://checkout.stripe.com/c/pay/cs_test_1" || order.SessionID != "cs_test_1" {
+		t.Errorf("order = %+v", order)
+	}
+	if order.Currency != "EUR" || order.Credits != 10000 {
+		t.Errorf("currency %s credits %d", order.Currency, order.Credits)
+	}
+	if order.ExpiredAt.Sub(order.CreatedAt) < 30*time.Minute {
+		t.Error("stripe checkout must stay open at least 30 minutes")
+	}
+
+	form := (*requests)[0]
+	checks := map[string]string{
+		"_path":                                  "/v1/checkout/sessions",
+		"_idempotency":                           order.OrderID,
+		"mode":                                   "payment",
+		"client_reference_id":                    order.OrderID,
+		"line_items[0][price_data][currency]":    "eur",
+		"line_items[0][price_data][unit_amount]": "1000",
+		"cancel_url":                             "https://app.example.com/billing?tab=wallet",
+		// The intent carries no order, so payment_intent.* events cannot settle it a second time
+		"payment_intent_data[metadata][order_id]": "",
+	}
+	for key, want := range checks {
+		if got := form.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if !strings.Contains(form.Get("success_url"), "order_id="+order.OrderID) {
+		t.Errorf("success_url = %q", form.Get("success_url"))
+	}
+
+	// checkout.session.completed pays the order
+	payload := fmt.Sprintf(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_test_1","client_reference_id":%q,"payment_intent":"pi_1","payment_status":"paid","amount_total":1000,"currency":"eur"}}}`, order.OrderID)
+	callback, err := s.HandleStripeWebhook([]byte(payload), signStripePayload(payload, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Status != PaymentStatusPaid {
+		t.Errorf("callback status = %s", callback.Status)
+	}
+	paid, _ := s.GetOrder(order.OrderID)
+	if paid.Status != PaymentStatusPaid || paid.TradeNo != "pi_1" || paid.PaidAt == nil {
+		t.Fatalf("order = %+v, want paid", paid)
+	}
+
+	// payment_intent.* events are acknowledged without settling anything
+	payload = fmt.Sprintf(`{"id":"evt_2","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount_received":1000,"metadata":{"order_id":%q}}}}`, order.OrderID)
+	callback, err = s.HandleStripeWebhook([]byte(payload), signStripePayload(payload, time.Now()))
+	if err != nil || callback.OrderID != "" || callback.Status != "" {
+		t.Fatalf("payment intent callback = %+v, %v", callback, err)
+	}
+
+	// Refund goes to the payment intent with the refund ID as idempotency key
+	if err := s.RefundOrder(order.OrderID, "customer request"); err != nil {
+		t.Fatal(err)
+	}
+	refund := (*requests)[1]
+	if refund.Get("_path") != "/v1/refunds" || refund.Get("payment_intent") != "pi_1" || refund.Get("amount") != "1000" {
+		t.Errorf("refund request = %v", refund)
+	}
+	if refund.Get("metadata[reason]") != "customer request" || refund.Get("_idempotency") == "" {
+		t.Errorf("refund request = %v", refund)
+	}
+	if refunded, _ := s.GetOrder(order.OrderID); refunded.Status != PaymentStatusRefunded {
+		t.Errorf("status = %s, want refunded", refunded.Status)
+	}
+}
+
+func TestStripeWebhookFailureAndUnknownEvents(t *testing.T) {
+	s, _ := newStripeTestService(t)
+	order, err := s.CreateRechargeOrder("u1", 500, PaymentMethodStripe, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := `{"id":"evt_3","type":"customer.created","data":{"object":{"id":"cus_1"}}}`
+	if _, err := s.HandleStripeWebhook([]byte(payload), signStripePayload(payload, time.Now())); err != nil {
+		t.Fatalf("unrelated events should be acknowledged: %v", err)
+	}
+
+	// A checkout paid with the wrong amount is rejected so Stripe retries and the order stays pending
+	payload = fmt.Sprintf(`{"id":"evt_4","type":"checkout.session.completed","data":{"object":{"id":"cs_test_1","client_reference_id":%q,"payment_intent":"pi_2","payment_status":"paid","amount_total":50,"currency":"eur"}}}`, order.OrderID)
+	if _, err := s.HandleStripeWebhook([]byte(payload), signStripePayload(payload, time.Now())); !errors.Is(err, ErrPaymentMismatch) {
+		t.Fatalf("error = %v, want ErrPaymentMismatch", err)
+	}
+
+	payload = fmt.Sprintf(`{"id":"evt_5","type":"checkout.session.async_payment_failed","data":{"object":{"id":"cs_test_1","client_reference_id":%q,"payment_intent":"pi_2","payment_status":"unpaid","amount_total":500,"currency":"eur"}}}`, order.OrderID)
+	if _, err := s.HandleStripeWebhook([]byte(payload), signStripePayload(payload, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	if failed, _ := s.GetOrder(order.OrderID); failed.Status != PaymentStatusFailed {
+		t.Errorf("status = %s, want failed", failed.Status)
+	}
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1"}`)
+	now := time.Now()
+	valid := signStripePayload(string(payload), now)
+
+	if err := verifyStripeSignature(payload, valid, testStripeWebhookSecret, now); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	// Secret rotation: any matching v1 signature is accepted
+	rotated := valid + ",v1=" + strings.Repeat("0", 64)
+	if err := verifyStripeSignature(payload, rotated, testStripeWebhookSecret, now); err != nil {
+		t.Errorf("rotated signature rejected: %v", err)
+	}
+
+	cases := map[string]struct {
+		payload []byte
+		header  string
+		now     time.Time
+	}{
+		"tampered": {[]byte(`{"id":"evt_2"}`), valid, now},
+		"stale":    {payload, valid, now.Add(10 * time.Minute)},
+		"missing":  {payload, "", now},
+		"no v1":    {payload, "t=123", now},
+	}
+	for name, tc := range cases {
+		if err := verifyStripeSignature(tc.payload, tc.header, testStripeWebhookSecret, tc.now); !errors.Is(err, ErrStripeSignature) {
+			t.Errorf("%s: error = %v, want ErrStripeSignature", name, err)
+		}
+	}
+}
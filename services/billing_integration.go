@@ -1,15 +1,30 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"time"
 
 	"codeswitch/services/billing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-pay/gopay/wechat/v3"
+)
+
+const (
+	// defaultOrderPollTimeout default wait of the order status long-poll
+	defaultOrderPollTimeout = 25 * time.Second
+	// maxOrderPollTimeout upper bound for the requested wait
+	maxOrderPollTimeout = 60 * time.Second
+	// maxStripeWebhookBody limits Stripe event payloads read into memory
+	maxStripeWebhookBody = 1 << 20
 )
 
 // BillingIntegration integrates billing services into the Gateway
@@ -542,6 +557,60 @@ func (bi *BillingIntegration) RegisterBillingRoutes(router gin.IRouter) {
 				"balance": balance,
 			})
 		})
+
+		// List the user's invoices; paid orders and Lago renewals without one are invoiced first
+		billingGroup.GET("/invoices", func(c *gin.Context) {
+			bi.mu.RLock()
+			manager := bi.manager
+			bi.mu.RUnlock()
+
+			if manager == nil || manager.Invoices() == nil {
+				c.JSON(503, gin.H{"error": "Invoice service not configured"})
+				return
+			}
+
+			userID := billing.GetUserID(c)
+			if userID == "" {
+				c.JSON(401, gin.H{"error": "User not authenticated"})
+				return
+			}
+
+			// Best effort: issued invoices are still listed when a provider is unreachable
+			if payment := manager.Payment(); payment != nil {
+				if err := payment.IssueMissingInvoices(userID); err != nil {
+					fmt.Printf("[Billing] Failed to issue missing invoices for %s: %v\n", userID, err)
+				}
+			}
+			if lago := manager.Lago(); lago != nil && lago.IsEnabled() {
+				if err := manager.Invoices().SyncLagoInvoices(userID, lago); err != nil {
+					fmt.Printf("[Billing] Failed to sync Lago invoices for %s: %v\n", userID, err)
+				}
+			}
+
+			c.JSON(200, gin.H{"invoices": manager.Invoices().List(userID)})
+		})
+
+		// Download an invoice as PDF
+		billingGroup.GET("/invoices/:id/pdf", func(c *gin.Context) {
+			bi.mu.RLock()
+			manager := bi.manager
+			bi.mu.RUnlock()
+
+			if manager == nil || manager.Invoices() == nil {
+				c.JSON(503, gin.H{"error": "Invoice service not configured"})
+				return
+			}
+
+			invoice, data, err := manager.Invoices().PDF(c.Param("id"))
+			// Other users' invoices are reported as missing so invoice IDs cannot be probed
+			if err != nil || invoice.UserID != billing.GetUserID(c) {
+				c.JSON(404, gin.H{"error": "Invoice not found"})
+				return
+			}
+
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+			c.Data(200, "application/pdf", data)
+		})
 	}
 
 	// Payment routes
@@ -561,7 +630,7 @@ func (bi *BillingIntegration) RegisterBillingRoutes(router gin.IRouter) {
 
 			var req struct {
 				Amount      int64  `json:"amount"`
-				Method      string `json:"method"` // "alipay" or "wechat"
+				Method      string `json:"method"` // "alipay", "wechat" or "stripe"
 				Description string `json:"description"`
 			}
 			if err := c.ShouldBindJSON(&req); err != nil {
@@ -576,6 +645,8 @@ func (bi *BillingIntegration) RegisterBillingRoutes(router gin.IRouter) {
 				method = billing.PaymentMethodAlipay
 			case "wechat":
 				method = billing.PaymentMethodWechat
+			case "stripe":
+				method = billing.PaymentMethodStripe
 			default:
 				c.JSON(400, gin.H{"error": "Invalid payment method"})
 				return
@@ -589,6 +660,80 @@ func (bi *BillingIntegration) RegisterBillingRoutes(router gin.IRouter) {
 
 			c.JSON(200, order)
 		})
+
+		// Render the order's payment QR code (?format=png|svg&size=256)
+		paymentGroup.GET("/orders/:id/qrcode", func(c *gin.Context) {
+			payment := bi.paymentService()
+			if payment == nil {
+				c.JSON(503, gin.H{"error": "Payment service not configured"})
+				return
+			}
+
+			order, ok := userOrder(c, payment)
+			if !ok {
+				return
+			}
+
+			size, _ := strconv.Atoi(c.Query("size"))
+			format := billing.QRCodeFormat(c.DefaultQuery("format", string(billing.QRCodeFormatPNG)))
+			data, contentType, err := payment.OrderQRCode(order.OrderID, format, size)
+			if err != nil {
+				if errors.Is(err, billing.ErrOrderHasNoQRCode) {
+					c.JSON(409, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(400, gin.H{"error": "Failed to render QR code", "details": err.Error()})
+				return
+			}
+
+			c.Header("Cache-Control", "private, max-age=300")
+			c.Data(200, contentType, data)
+		})
+
+		// Long-poll the order status until it changes from ?status (default pending),
+		// the order expires or ?timeout seconds pass
+		paymentGroup.GET("/orders/:id/status", func(c *gin.Context) {
+			payment := bi.paymentService()
+			if payment == nil {
+				c.JSON(503, gin.H{"error": "Payment service not configured"})
+				return
+			}
+
+			order, ok := userOrder(c, payment)
+			if !ok {
+				return
+			}
+
+			timeout := defaultOrderPollTimeout
+			if v := c.Query("timeout"); v != "" {
+				seconds, err := strconv.Atoi(v)
+				if err != nil || seconds < 0 {
+					c.JSON(400, gin.H{"error": "Invalid timeout"})
+					return
+				}
+				timeout = time.Duration(seconds) * time.Second
+				if timeout > maxOrderPollTimeout {
+					timeout = maxOrderPollTimeout
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+			defer cancel()
+
+			current, err := payment.WaitOrderStatus(ctx, order.OrderID, billing.PaymentStatus(c.Query("status")))
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to get order status", "details": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"order_id":   current.OrderID,
+				"status":     current.Status,
+				"paid_at":    current.PaidAt,
+				"expired_at": current.ExpiredAt,
+				"expired":    current.Status == billing.PaymentStatusPending && time.Now().After(current.ExpiredAt),
+			})
+		})
 	}
 
 	// Payment callbacks (public, webhook endpoints)
@@ -638,12 +783,71 @@ func (bi *BillingIntegration) RegisterBillingRoutes(router gin.IRouter) {
 				return
 			}
 
-			// WeChat Pay V3 notification handling would go here
-			// This requires parsing the encrypted notification body
-			// For now, return success placeholder
+			notifyReq, err := wechat.V3ParseNotify(c.Request)
+			if err != nil {
+				c.JSON(400, gin.H{"code": "FAIL", "message": "Invalid notification"})
+				return
+			}
+
+			// WeChat retries on non-2xx responses
+			if _, err := manager.Payment().HandleWechatCallback(notifyReq); err != nil {
+				c.JSON(500, gin.H{"code": "FAIL", "message": err.Error()})
+				return
+			}
+
 			c.JSON(200, gin.H{"code": "SUCCESS", "message": "OK"})
 		})
+
+		// Stripe webhook; Stripe retries on non-2xx responses
+		callbackGroup.POST("/stripe/webhook", func(c *gin.Context) {
+			payment := bi.paymentService()
+			if payment == nil || !payment.IsStripeEnabled() {
+				c.JSON(503, gin.H{"error": "Stripe not configured"})
+				return
+			}
+
+			payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxStripeWebhookBody))
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Invalid request"})
+				return
+			}
+
+			if _, err := payment.HandleStripeWebhook(payload, c.GetHeader("Stripe-Signature")); err != nil {
+				if errors.Is(err, billing.ErrStripeSignature) {
+					c.JSON(400, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{"received": true})
+		})
+	}
+}
+
+// paymentService returns the payment service, nil when payment is not configured
+func (bi *BillingIntegration) paymentService() *billing.PaymentService {
+	bi.mu.RLock()
+	manager := bi.manager
+	bi.mu.RUnlock()
+
+	if manager == nil {
+		return nil
+	}
+	return manager.Payment()
+}
+
+// userOrder loads the order named by the :id route param and checks it belongs to the caller.
+// It writes the error response and returns false when the order is not accessible.
+func userOrder(c *gin.Context, payment *billing.PaymentService) (*billing.PaymentOrder, bool) {
+	order, err := payment.GetOrder(c.Param("id"))
+	// Other users' orders are reported as missing so order IDs cannot be probed
+	if err != nil || order.UserID != billing.GetUserID(c) {
+		c.JSON(404, gin.H{"error": "Order not found"})
+		return nil, false
 	}
+	return order, true
 }
 
 // ============================================================
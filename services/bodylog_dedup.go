@@ -0,0 +1,271 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/tidwall/gjson"
+)
+
+// Body 日志请求体去重：Agent 循环每轮都会重发几乎相同的系统提示词、工具定义与完整历史消息。
+// 写入时把请求体中较大的系统提示词 / 工具定义 / 单条消息拆到按内容哈希寻址的 body_blobs 表（引用计数），
+// request_log_body.request_body 中原位置替换为 {"$cs_blob":"<sha256>"} 占位，读取时按 blob_refs 还原为原始字节
+
+const (
+	bodyBlobTable = "body_blobs"
+	// bodyBlobMinBytes 小于该大小的片段不拆分，避免占位与查询开销超过节省的空间
+	bodyBlobMinBytes = 1024
+	// bodyBlobMarkerKey 占位对象的键名；原始请求体包含该字符串时不做拆分，保证还原无歧义
+	bodyBlobMarkerKey = `"$cs_blob"`
+)
+
+// bodyBlobFields 整体拆分的顶层字段（Anthropic system/tools、Responses instructions、Gemini systemInstruction）
+var bodyBlobFields = []string{"system", "tools", "instructions", "systemInstruction"}
+
+// bodyBlobArrays 按元素拆分的顶层消息数组（Anthropic / Chat messages、Responses input、Gemini contents）
+var bodyBlobArrays = []string{"messages", "input", "contents"}
+
+// bodyBlobSegment 请求体中待拆分的片段
+type bodyBlobSegment struct {
+	start int
+	end   int
+	hash  string
+}
+
+func bodyBlobMarker(hash string) string {
+	return `{` + bodyBlobMarkerKey + `:"` + hash + `"}`
+}
+
+// splitBodyBlobs 拆分请求体：返回替换占位后的请求体、哈希到内容的映射与去重后的引用列表（有序）
+func splitBodyBlobs(body string) (string, map[string]string, []string) {
+	if len(body) < bodyBlobMinBytes || strings.Contains(body, bodyBlobMarkerKey) || !gjson.Valid(body) {
+		return body, nil, nil
+	}
+	var segments []bodyBlobSegment
+	add := func(value gjson.Result) {
+		raw := value.Raw
+		if len(raw) < bodyBlobMinBytes || value.Index <= 0 || value.Index+len(raw) > len(body) || body[value.Index:value.Index+len(raw)] != raw {
+			return
+		}
+		sum := sha256.Sum256([]byte(raw))
+		segments = append(segments, bodyBlobSegment{start: value.Index, end: value.Index + len(raw), hash: hex.EncodeToString(sum[:])})
+	}
+	for _, field := range bodyBlobFields {
+		add(gjson.Get(body, field))
+	}
+	for _, field := range bodyBlobArrays {
+		value := gjson.Get(body, field)
+		if !value.IsArray() {
+			continue
+		}
+		value.ForEach(func(_, item gjson.Result) bool {
+			add(item)
+			return true
+		})
+	}
+	if len(segments) == 0 {
+		return body, nil, nil
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start < segments[j].start })
+
+	var b strings.Builder
+	blobs := make(map[string]string, len(segments))
+	refs := make([]string, 0, len(segments))
+	last := 0
+	for _, seg := range segments {
+		if seg.start < last {
+			continue
+		}
+		b.WriteString(body[last:seg.start])
+		b.WriteString(bodyBlobMarker(seg.hash))
+		if _, ok := blobs[seg.hash]; !ok {
+			blobs[seg.hash] = body[seg.start:seg.end]
+			refs = append(refs, seg.hash)
+		}
+		last = seg.end
+	}
+	b.WriteString(body[last:])
+	return b.String(), blobs, refs
+}
+
+// joinBodyBlobs 用 blob 内容替换占位，还原原始请求体；缺失的 blob 保留占位
+func joinBodyBlobs(stored string, blobs map[string]string) string {
+	if len(blobs) == 0 {
+		return stored
+	}
+	pairs := make([]string, 0, len(blobs)*2)
+	for hash, content := range blobs {
+		pairs = append(pairs, bodyBlobMarker(hash), content)
+	}
+	return strings.NewReplacer(pairs...).Replace(stored)
+}
+
+// ensureBodyBlobTables 创建 blob 表并为 request_log_body 补充引用列
+func ensureBodyBlobTables(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + bodyBlobTable + ` (
+		hash TEXT PRIMARY KEY,
+		content TEXT NOT NULL,
+		size_bytes INTEGER NOT NULL DEFAULT 0,
+		ref_count INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+	return ensureBodyLogColumn(db, "blob_refs", "TEXT DEFAULT ''")
+}
+
+// writeBodyLogWithBlobs 在一个事务中写入 blob（已存在时引用计数加一）与 Body 日志
+func writeBodyLogWithBlobs(bodyLog *RequestLogBody, stored string, blobs map[string]string, refs []string) error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, hash := range refs {
+		content := blobs[hash]
+		if _, err := tx.Exec(`INSERT INTO `+bodyBlobTable+` (hash, content, size_bytes, ref_count) VALUES (?, ?, ?, 1)
+			ON CONFLICT(hash) DO UPDATE SET ref_count = ref_count + 1`, hash, content, len(content)); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO request_log_body
+		(trace_id, request_body, response_body, response_body_path, truncated, body_size_bytes, blob_refs, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		bodyLog.TraceID, stored, bodyLog.ResponseBody, bodyLog.ResponseBodyPath, boolToInt(bodyLog.Truncated),
+		bodyLog.BodySizeBytes, strings.Join(refs, " "),
+		bodyLog.CreatedAt.Format("2006-01-02 15:04:05"), bodyLog.ExpiresAt.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteBodyLogs 在同一事务中删除满足条件的 Body 日志并释放其引用的 blob，
+// 删除与释放基于同一次条件求值，提交后再清理对应的落盘文件
+func deleteBodyLogs(db *sql.DB, where string, args ...any) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("DELETE FROM request_log_body WHERE "+where+" RETURNING blob_refs, response_body_path", args...)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	var spilled []string
+	released := make(map[string]int)
+	for rows.Next() {
+		var refs, path string
+		if err := rows.Scan(&refs, &path); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted++
+		for _, hash := range strings.Fields(refs) {
+			released[hash]++
+		}
+		if path != "" {
+			spilled = append(spilled, path)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for hash, count := range released {
+		if _, err := tx.Exec("UPDATE "+bodyBlobTable+" SET ref_count = ref_count - ? WHERE hash = ?", count, hash); err != nil {
+			return 0, err
+		}
+	}
+	if len(released) > 0 {
+		if _, err := tx.Exec("DELETE FROM " + bodyBlobTable + " WHERE ref_count <= 0"); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	removeSpilledBodies(spilled)
+	return deleted, nil
+}
+
+// bodyBlobResolver 读取时还原请求体；同一批查询中重复引用的 blob 只读取一次
+type bodyBlobResolver struct {
+	db    *sql.DB
+	cache map[string]string
+}
+
+func newBodyBlobResolver(db *sql.DB) *bodyBlobResolver {
+	return &bodyBlobResolver{db: db, cache: make(map[string]string)}
+}
+
+// expand 按引用列表还原请求体；refs 为空时原样返回
+func (r *bodyBlobResolver) expand(stored, refs string) string {
+	hashes := strings.Fields(refs)
+	if len(hashes) == 0 {
+		return stored
+	}
+	blobs := make(map[string]string, len(hashes))
+	for _, hash := range hashes {
+		content, ok := r.cache[hash]
+		if !ok {
+			if err := r.db.QueryRow("SELECT content FROM "+bodyBlobTable+" WHERE hash = ?", hash).Scan(&content); err != nil {
+				fmt.Printf("[BodyLog] 读取 blob %s 失败: %v\n", hash, err)
+				continue
+			}
+			r.cache[hash] = content
+		}
+		blobs[hash] = content
+	}
+	return joinBodyBlobs(stored, blobs)
+}
+
+// BodyStorageStats Body 日志存储与去重统计
+type BodyStorageStats struct {
+	Bodies         int64 `json:"bodies"`          // Body 日志条数
+	BodyBytes      int64 `json:"body_bytes"`      // 还原后的请求 + 响应体总字节数
+	StoredBytes    int64 `json:"stored_bytes"`    // 实际存储的字节数（占位后的请求体、响应体与 blob）
+	Blobs          int64 `json:"blobs"`           // 去重后的 blob 数量
+	BlobReferences int64 `json:"blob_references"` // blob 被引用的总次数
+}
+
+// GetBodyStorageStats 返回 Body 日志的存储占用与去重效果
+func (ls *LogService) GetBodyStorageStats() (BodyStorageStats, error) {
+	var stats BodyStorageStats
+	db, err := analyticsDB()
+	if err != nil {
+		return stats, err
+	}
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(body_size_bytes), 0),
+		COALESCE(SUM(LENGTH(CAST(request_body AS BLOB)) + LENGTH(CAST(response_body AS BLOB))), 0)
+		FROM request_log_body`).Scan(&stats.Bodies, &stats.BodyBytes, &stats.StoredBytes)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return BodyStorageStats{}, nil
+		}
+		return stats, err
+	}
+	var blobBytes int64
+	err = db.QueryRow("SELECT COUNT(*), COALESCE(SUM(size_bytes), 0), COALESCE(SUM(ref_count), 0) FROM "+bodyBlobTable).
+		Scan(&stats.Blobs, &blobBytes, &stats.BlobReferences)
+	if err != nil && !isNoSuchTableErr(err) {
+		return stats, err
+	}
+	stats.StoredBytes += blobBytes
+	return stats, nil
+}
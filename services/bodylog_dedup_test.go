@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dedupTestBody(turn int) string {
+	system := strings.Repeat("You are a coding agent. ", 100)
+	tools := `[{"name":"read_file","description":"` + strings.Repeat("read a file ", 120) + `"}]`
+	history := `{"role":"user","content":"` + strings.Repeat("initial task ", 120) + `"}`
+	return fmt.Sprintf(`{"model":"claude","system":%q,"tools":%s,"messages":[%s,{"role":"user","content":"turn %d"}]}`, system, tools, history, turn)
+}
+
+func TestSplitBodyBlobsRoundTrip(t *testing.T) {
+	body := dedupTestBody(1)
+	stored, blobs, refs := splitBodyBlobs(body)
+	if len(refs) != 3 {
+		t.Fatalf("refs = %d, want 3 (system, tools, first message)", len(refs))
+	}
+	if len(stored) >= 1024 || !strings.Contains(stored, `"turn 1"`) {
+		t.Fatalf("stored body not reduced: %d bytes %s", len(stored), stored)
+	}
+	if got := joinBodyBlobs(stored, blobs); got != body {
+		t.Fatalf("round trip mismatch:\n%s", got)
+	}
+
+	// 小请求体、非 JSON 与已包含占位键的请求体保持原样
+	for _, raw := range []string{`{"messages":[]}`, strings.Repeat("x", 4096), `{"system":"` + bodyBlobMarkerKey + strings.Repeat("y", 2048) + `"}`} {
+		if got, _, refs := splitBodyBlobs(raw); got != raw || refs != nil {
+			t.Errorf("body split unexpectedly: %.40s", raw)
+		}
+	}
+}
+
+func TestBodyLogDedupStorage(t *testing.T) {
+	db := openAnalyticsDB(t, "dedup.db")
+
+	now := time.Now().UTC()
+	for i := 1; i <= 3; i++ {
+		expires := now.Add(time.Hour)
+		if i == 1 {
+			expires = now.Add(-time.Hour)
+		}
+		body := dedupTestBody(i)
+		if err := writeBodyLog(&RequestLogBody{
+			TraceID:       fmt.Sprintf("trace-%d", i),
+			RequestBody:   body,
+			ResponseBody:  `{"ok":true}`,
+			BodySizeBytes: int64(len(body) + 11),
+			CreatedAt:     now,
+			ExpiresAt:     expires,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ls := &LogService{}
+	stats, err := ls.GetBodyStorageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Bodies != 3 || stats.Blobs != 3 || stats.BlobReferences != 9 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.StoredBytes*2 >= stats.BodyBytes {
+		t.Fatalf("dedup saved too little: stored %d of %d", stats.StoredBytes, stats.BodyBytes)
+	}
+
+	result, err := ls.GetRequestLogBody("trace-2")
+	if err != nil || result == nil {
+		t.Fatalf("GetRequestLogBody: %v %v", result, err)
+	}
+	if result.RequestBody != dedupTestBody(2) {
+		t.Fatalf("restored body mismatch:\n%s", result.RequestBody)
+	}
+
+	// 过期清理只减少引用计数，仍被引用的 blob 保留
+	(&ProviderRelayService{}).cleanupExpiredBodyLogs()
+	var blobs, refs int
+	db.QueryRow("SELECT COUNT(*), COALESCE(SUM(ref_count), 0) FROM "+bodyBlobTable).Scan(&blobs, &refs)
+	if blobs != 3 || refs != 6 {
+		t.Fatalf("after expiry: blobs=%d refs=%d", blobs, refs)
+	}
+	result, _ = ls.GetRequestLogBody("trace-3")
+	if result == nil || result.RequestBody != dedupTestBody(3) {
+		t.Fatal("surviving body not restored after cleanup")
+	}
+
+	if n, err := deleteBodyLogs(db, "1 = 1"); err != nil || n != 2 {
+		t.Fatalf("deleteBodyLogs = %d, %v", n, err)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM " + bodyBlobTable).Scan(&blobs)
+	if blobs != 0 {
+		t.Fatalf("unreferenced blobs left: %d", blobs)
+	}
+}
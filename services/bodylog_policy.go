@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BodyLogPolicy Body 日志采样与过滤策略
+// 过滤条件为空时不限制；include 与 exclude 同时命中时以 exclude 为准
+type BodyLogPolicy struct {
+	// SampleRate 采样比例 (0, 1]，0 表示全量记录
+	SampleRate float64 `json:"sample_rate"`
+	// ErrorsOnly 仅记录失败请求（HTTP >= 400 或网络错误）
+	ErrorsOnly bool `json:"errors_only"`
+	// KeepErrors 失败请求不参与采样，始终记录
+	KeepErrors bool `json:"keep_errors"`
+
+	IncludePlatforms []string `json:"include_platforms,omitempty"`
+	ExcludePlatforms []string `json:"exclude_platforms,omitempty"`
+	IncludeModels    []string `json:"include_models,omitempty"` // 支持通配符，如 claude-*
+	ExcludeModels    []string `json:"exclude_models,omitempty"`
+	IncludeUsers     []string `json:"include_users,omitempty"` // 匹配 X-User-ID
+	ExcludeUsers     []string `json:"exclude_users,omitempty"`
+}
+
+// bodyLogDecision 单个请求的 Body 日志决策
+// capture 决定是否捕获；请求结束后再由 keep 根据结果决定是否落库
+type bodyLogDecision struct {
+	capture    bool
+	sampled    bool
+	errorsOnly bool
+	keepErrors bool
+}
+
+// bodyLogPolicyStore 当前生效的策略
+type bodyLogPolicyStore struct {
+	mu     sync.RWMutex
+	policy BodyLogPolicy
+}
+
+// SetBodyLogPolicy 更新 Body 日志采样与过滤策略
+func (prs *ProviderRelayService) SetBodyLogPolicy(policy BodyLogPolicy) {
+	if policy.SampleRate < 0 {
+		policy.SampleRate = 0
+	}
+	if policy.SampleRate > 1 {
+		policy.SampleRate = 1
+	}
+	prs.bodyLogPolicy.mu.Lock()
+	prs.bodyLogPolicy.policy = policy
+	prs.bodyLogPolicy.mu.Unlock()
+}
+
+// GetBodyLogPolicy 获取当前生效的 Body 日志策略
+func (prs *ProviderRelayService) GetBodyLogPolicy() BodyLogPolicy {
+	prs.bodyLogPolicy.mu.RLock()
+	defer prs.bodyLogPolicy.mu.RUnlock()
+	return prs.bodyLogPolicy.policy
+}
+
+// loadBodyLogPolicy 启动时从 llm-log-settings.json 恢复策略
+func (prs *ProviderRelayService) loadBodyLogPolicy() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".code-switch", "llm-log-settings.json"))
+	if err != nil {
+		return
+	}
+	var config LLMLogConfig
+	if err := json.Unmarshal(data, &config); err == nil {
+		prs.SetBodyLogPolicy(config.BodyPolicy)
+	}
+}
+
+// decideBodyLog 请求开始时判断是否需要捕获 Body
+func (prs *ProviderRelayService) decideBodyLog(platform, model, userID string) bodyLogDecision {
+	if !prs.IsBodyLogEnabled() {
+		return bodyLogDecision{}
+	}
+	policy := prs.GetBodyLogPolicy()
+
+	if !matchBodyLogFilter(platform, policy.IncludePlatforms, policy.ExcludePlatforms) ||
+		!matchBodyLogFilter(model, policy.IncludeModels, policy.ExcludeModels) ||
+		!matchBodyLogFilter(userID, policy.IncludeUsers, policy.ExcludeUsers) {
+		return bodyLogDecision{}
+	}
+
+	sampled := policy.SampleRate <= 0 || policy.SampleRate >= 1 || rand.Float64() < policy.SampleRate
+	decision := bodyLogDecision{
+		sampled:    sampled,
+		errorsOnly: policy.ErrorsOnly,
+		keepErrors: policy.KeepErrors,
+	}
+	// 未命中采样时，只有需要保留失败请求才继续捕获
+	decision.capture = sampled || policy.KeepErrors
+	return decision
+}
+
+// keep 请求结束后判断是否写入 Body 日志
+func (d bodyLogDecision) keep(requestLog *ReqeustLog) bool {
+	if !d.capture {
+		return false
+	}
+	failed := requestLog != nil && (requestLog.HttpCode == 0 || requestLog.HttpCode >= 400 || requestLog.ErrorType != "")
+	if d.errorsOnly && !failed {
+		return false
+	}
+	if d.sampled {
+		return true
+	}
+	return d.keepErrors && failed
+}
+
+// matchBodyLogFilter 判断值是否通过 include / exclude 过滤
+func matchBodyLogFilter(value string, include, exclude []string) bool {
+	for _, pattern := range exclude {
+		if matchBodyLogPattern(pattern, value) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if matchBodyLogPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchBodyLogPattern(pattern, value string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if strings.Contains(pattern, "*") {
+		return matchWildcard(pattern, value)
+	}
+	return strings.EqualFold(pattern, value)
+}
@@ -0,0 +1,55 @@
+package services
+
+import "testing"
+
+func TestDecideBodyLogFilters(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.SetBodyLogEnabled(true)
+	prs.SetBodyLogPolicy(BodyLogPolicy{
+		IncludePlatforms: []string{"claude"},
+		ExcludeModels:    []string{"claude-3-haiku*"},
+		ExcludeUsers:     []string{"ci-bot"},
+	})
+
+	cases := []struct {
+		platform, model, user string
+		want                  bool
+	}{
+		{"claude", "claude-sonnet-4", "alice", true},
+		{"codex", "gpt-5", "alice", false},
+		{"claude", "claude-3-haiku-20240307", "alice", false},
+		{"claude", "claude-sonnet-4", "ci-bot", false},
+	}
+	for _, tc := range cases {
+		if got := prs.decideBodyLog(tc.platform, tc.model, tc.user).capture; got != tc.want {
+			t.Errorf("decideBodyLog(%s, %s, %s) = %v, want %v", tc.platform, tc.model, tc.user, got, tc.want)
+		}
+	}
+}
+
+func TestDecideBodyLogDisabled(t *testing.T) {
+	prs := &ProviderRelayService{}
+	if prs.decideBodyLog("claude", "claude-sonnet-4", "").capture {
+		t.Error("body log should not be captured when disabled")
+	}
+}
+
+func TestBodyLogDecisionKeep(t *testing.T) {
+	ok := &ReqeustLog{HttpCode: 200}
+	failed := &ReqeustLog{HttpCode: 529}
+
+	errorsOnly := bodyLogDecision{capture: true, sampled: true, errorsOnly: true}
+	if errorsOnly.keep(ok) || !errorsOnly.keep(failed) {
+		t.Error("errors-only mode should keep failures only")
+	}
+
+	unsampled := bodyLogDecision{capture: true, sampled: false, keepErrors: true}
+	if unsampled.keep(ok) || !unsampled.keep(failed) {
+		t.Error("unsampled request should be kept only when it failed")
+	}
+
+	sampled := bodyLogDecision{capture: true, sampled: true}
+	if !sampled.keep(ok) {
+		t.Error("sampled request should be kept")
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// bodySpillThreshold 响应体超过该大小后转存到临时文件
+	bodySpillThreshold = 1 << 20
+	// bodySpillMaxBytes 单个响应体最多落盘的字节数，超出部分丢弃并标记截断
+	bodySpillMaxBytes int64 = 512 << 20
+	// bodySpillPreviewBytes 落盘后数据库中保留的响应体预览长度
+	bodySpillPreviewBytes = 64 << 10
+	// bodyLogTTL Body 日志保留时长
+	bodyLogTTL = 7 * 24 * time.Hour
+)
+
+// bodySpillDir 返回落盘响应体的存放目录
+func bodySpillDir() string {
+	if IsReadOnlyMode() {
+		return filepath.Join(os.TempDir(), "code-switch-body-spill")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".code-switch", "body-spill")
+}
+
+// bodyCapture 响应体捕获器：小响应保存在内存，超过阈值后转存到按 trace_id 命名的文件
+type bodyCapture struct {
+	traceID   string
+	buf       bytes.Buffer
+	file      *os.File
+	path      string
+	size      int64
+	truncated bool
+}
+
+func newBodyCapture(traceID string) *bodyCapture {
+	return &bodyCapture{traceID: traceID}
+}
+
+// Write 写入响应数据；落盘失败时退化为截断的内存缓冲，不影响主请求
+func (bc *bodyCapture) Write(p []byte) (int, error) {
+	n := len(p)
+	if bc.truncated {
+		return n, nil
+	}
+	if bc.size+int64(len(p)) > bodySpillMaxBytes {
+		p = p[:bodySpillMaxBytes-bc.size]
+		bc.truncated = true
+	}
+
+	if bc.file == nil && bc.buf.Len()+len(p) > bodySpillThreshold {
+		if err := bc.spill(); err != nil {
+			fmt.Printf("[BodyLog] 响应体落盘失败 (trace_id=%s): %v\n", bc.traceID, err)
+			bc.truncated = true
+			return n, nil
+		}
+	}
+
+	if bc.file != nil {
+		if _, err := bc.file.Write(p); err != nil {
+			fmt.Printf("[BodyLog] 写入落盘文件失败 (trace_id=%s): %v\n", bc.traceID, err)
+			bc.truncated = true
+			return n, nil
+		}
+	} else {
+		bc.buf.Write(p)
+	}
+	bc.size += int64(len(p))
+	return n, nil
+}
+
+// WriteByte 实现 io.ByteWriter
+func (bc *bodyCapture) WriteByte(b byte) error {
+	_, err := bc.Write([]byte{b})
+	return err
+}
+
+// spill 将已缓冲的数据写入临时文件，后续数据直接追加到文件
+func (bc *bodyCapture) spill() error {
+	dir := bodySpillDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, bc.traceID+".resp")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(bc.buf.Bytes()); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	bc.file = file
+	bc.path = path
+	return nil
+}
+
+// Len 已捕获的字节数
+func (bc *bodyCapture) Len() int {
+	return int(bc.size)
+}
+
+// String 返回内存中的响应体；已落盘时返回文件开头的预览
+func (bc *bodyCapture) String() string {
+	if bc.file == nil {
+		return bc.buf.String()
+	}
+	preview := bc.buf.Bytes()
+	if len(preview) > bodySpillPreviewBytes {
+		preview = preview[:bodySpillPreviewBytes]
+	}
+	return string(preview)
+}
+
+// finish 关闭落盘文件并返回文件路径（未落盘时为空）
+func (bc *bodyCapture) finish() string {
+	if bc.file != nil {
+		bc.file.Close()
+		bc.file = nil
+		bc.buf.Truncate(min(bc.buf.Len(), bodySpillPreviewBytes))
+	}
+	return bc.path
+}
+
+// discard 丢弃捕获内容并删除落盘文件（请求未命中 Body 日志策略时调用）
+func (bc *bodyCapture) discard() {
+	if path := bc.finish(); path != "" {
+		os.Remove(path)
+	}
+}
+
+// enqueueBodyLog 构造 Body 日志并发送到写入队列
+func (prs *ProviderRelayService) enqueueBodyLog(traceID string, requestBody []byte, capture *bodyCapture) {
+	if len(requestBody) == 0 && capture.Len() == 0 {
+		return
+	}
+	preview := capture.String()
+	path := capture.finish()
+	bodyLog := &RequestLogBody{
+		TraceID:          traceID,
+		RequestBody:      string(requestBody),
+		ResponseBody:     preview,
+		ResponseBodyPath: path,
+		BodySizeBytes:    int64(len(requestBody)) + int64(capture.Len()),
+		Truncated:        capture.truncated,
+		CreatedAt:        time.Now(),
+		ExpiresAt:        time.Now().Add(bodyLogTTL),
+	}
+	select {
+	case prs.bodyLogQueue <- bodyLog:
+	default:
+		prs.overflowBodyLog(bodyLog)
+	}
+}
+
+// ensureBodyLogColumn 为 request_log_body 表补充新列
+func ensureBodyLogColumn(db *sql.DB, column string, definition string) error {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('request_log_body') WHERE name = '%s'", column)
+	var count int
+	if err := db.QueryRow(query).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		alter := fmt.Sprintf("ALTER TABLE request_log_body ADD COLUMN %s %s", column, definition)
+		if _, err := db.Exec(alter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSpilledBodies 删除已从数据库移除的 Body 日志对应的落盘文件
+func removeSpilledBodies(paths []string) {
+	dir := bodySpillDir()
+	for _, path := range paths {
+		// 只删除落盘目录内的文件，防止数据库被篡改后误删其他文件
+		if filepath.Dir(filepath.Clean(path)) != dir {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[BodyLog] 删除落盘文件失败 %s: %v\n", path, err)
+		}
+	}
+}
+
+// RequestLogBodyRange 响应体分段读取结果
+type RequestLogBodyRange struct {
+	TraceID   string `json:"trace_id"`
+	Offset    int64  `json:"offset"`
+	Length    int64  `json:"length"`
+	TotalSize int64  `json:"total_size"`
+	Data      string `json:"data"`
+	EOF       bool   `json:"eof"`
+}
+
+// maxBodyRangeLength 单次分段读取的最大字节数
+const maxBodyRangeLength int64 = 4 << 20
+
+// GetRequestLogBodyRange 分段读取响应体，支持落盘的大响应
+// length<=0 时读取默认长度（最多 4MB）
+func (ls *LogService) GetRequestLogBodyRange(traceID string, offset int64, length int64) (*RequestLogBodyRange, error) {
+	if traceID == "" {
+		return nil, fmt.Errorf("trace_id is required")
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must be >= 0")
+	}
+	if length <= 0 || length > maxBodyRangeLength {
+		length = maxBodyRangeLength
+	}
+
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+	var responseBody, path sql.NullString
+	err = db.QueryRow(
+		"SELECT response_body, response_body_path FROM request_log_body WHERE trace_id = ? LIMIT 1",
+		traceID,
+	).Scan(&responseBody, &path)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.ReaderAt
+	var total int64
+	if path.String != "" {
+		file, err := os.Open(path.String)
+		if err != nil {
+			return nil, fmt.Errorf("落盘响应体不可用: %w", err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		reader, total = file, info.Size()
+	} else {
+		reader, total = strings.NewReader(responseBody.String), int64(len(responseBody.String))
+	}
+
+	result := &RequestLogBodyRange{TraceID: traceID, Offset: offset, TotalSize: total}
+	if offset >= total {
+		result.EOF = true
+		return result, nil
+	}
+	if remaining := total - offset; length > remaining {
+		length = remaining
+	}
+	buf := make([]byte, length)
+	n, err := reader.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	result.Data = string(buf[:n])
+	result.Length = int64(n)
+	result.EOF = offset+int64(n) >= total
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestBodyCaptureKeepsSmallBodiesInMemory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	capture := newBodyCapture("trace-small")
+	capture.Write([]byte("hello"))
+	if capture.String() != "hello" || capture.Len() != 5 {
+		t.Fatalf("unexpected capture: %q (%d)", capture.String(), capture.Len())
+	}
+	if path := capture.finish(); path != "" {
+		t.Fatalf("small body should not spill, got %s", path)
+	}
+}
+
+func TestBodyCaptureSpillsLargeBodies(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	chunk := bytes.Repeat([]byte("x"), 512<<10)
+	capture := newBodyCapture("trace-large")
+	for i := 0; i < 4; i++ {
+		capture.Write(chunk)
+	}
+	if capture.Len() != 4*len(chunk) {
+		t.Fatalf("Len = %d, want %d", capture.Len(), 4*len(chunk))
+	}
+
+	preview := capture.String()
+	path := capture.finish()
+	if path == "" {
+		t.Fatal("large body should spill to disk")
+	}
+	if len(preview) != bodySpillPreviewBytes {
+		t.Errorf("preview length = %d, want %d", len(preview), bodySpillPreviewBytes)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("spill file missing: %v", err)
+	}
+	if info.Size() != int64(4*len(chunk)) {
+		t.Errorf("spill file size = %d, want %d", info.Size(), 4*len(chunk))
+	}
+}
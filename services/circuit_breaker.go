@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -63,6 +65,12 @@ type CircuitBreaker struct {
 	halfOpenMutex sync.Mutex
 	halfOpenTest  bool // Only allow one test request in half-open state
 
+	// Optional store shared across gateway replicas (open circuits are visible to every replica)
+	shared SharedStateStore
+
+	// Optional callback invoked on every state transition (used for incident history)
+	onStateChange func(providerName, oldState, newState string)
+
 	mu sync.RWMutex
 }
 
@@ -142,8 +150,8 @@ func (cb *CircuitBreaker) AllowRequest() bool {
 
 	switch state {
 	case StateClosed:
-		// Circuit is closed, allow all requests
-		return true
+		// Circuit is closed, allow all requests unless another replica opened it
+		return !cb.adoptSharedOpen()
 
 	case StateOpen:
 		// Check if recovery timeout has elapsed
@@ -265,9 +273,70 @@ func (cb *CircuitBreaker) setState(newState string) {
 		// Log state transition
 		fmt.Printf("[CircuitBreaker] Provider %s (ID=%d): %s → %s\n",
 			cb.providerName, cb.providerID, oldState, newState)
+
+		cb.publishSharedState(newState)
+
+		if cb.onStateChange != nil {
+			cb.onStateChange(cb.providerName, oldState, newState)
+		}
+	}
+}
+
+// sharedKey returns the shared state key of this circuit
+func (cb *CircuitBreaker) sharedKey() string {
+	return "circuit:" + strconv.Itoa(cb.providerID)
+}
+
+// publishSharedState shares open / closed transitions with other replicas
+func (cb *CircuitBreaker) publishSharedState(state string) {
+	if cb.shared == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+	defer cancel()
+
+	var err error
+	switch state {
+	case StateOpen:
+		openedAt := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		err = cb.shared.Set(ctx, cb.sharedKey(), openedAt, cb.config.RecoveryTimeout)
+	case StateClosed:
+		err = cb.shared.Delete(ctx, cb.sharedKey())
+	}
+	if err != nil {
+		fmt.Printf("[CircuitBreaker] Failed to publish shared state: %v\n", err)
 	}
 }
 
+// adoptSharedOpen opens the local circuit when another replica has opened it within the recovery timeout
+func (cb *CircuitBreaker) adoptSharedOpen() bool {
+	if cb.shared == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+	defer cancel()
+
+	value, ok, err := cb.shared.Get(ctx, cb.sharedKey())
+	if err != nil || !ok {
+		return false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+	openedAt := time.UnixMilli(ms)
+	if time.Since(openedAt) > cb.config.RecoveryTimeout {
+		return false
+	}
+
+	cb.circuitOpenTime.Store(openedAt)
+	if cb.state.CompareAndSwap(StateClosed, StateOpen) {
+		fmt.Printf("[CircuitBreaker] Provider %s (ID=%d): closed → open (shared)\n",
+			cb.providerName, cb.providerID)
+	}
+	return true
+}
+
 // updateDB persists circuit breaker state to database
 func (cb *CircuitBreaker) updateDB() {
 	if cb.db == nil || !cb.config.UpdateDB {
@@ -370,6 +439,8 @@ type CircuitBreakerManager struct {
 	breakers map[int]*CircuitBreaker
 	db       *sql.DB
 	config   CircuitBreakerConfig
+	shared   SharedStateStore
+	onStateChange func(providerName, oldState, newState string)
 	mu       sync.RWMutex
 }
 
@@ -402,11 +473,35 @@ func (m *CircuitBreakerManager) GetCircuitBreaker(providerID int, providerName s
 	}
 
 	cb = NewCircuitBreaker(providerID, providerName, m.db, m.config)
+	cb.shared = m.shared
+	cb.onStateChange = m.onStateChange
 	m.breakers[providerID] = cb
 
 	return cb
 }
 
+// SetSharedState shares circuit states across gateway replicas; nil keeps them per-process
+func (m *CircuitBreakerManager) SetSharedState(store SharedStateStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shared = store
+	for _, cb := range m.breakers {
+		cb.shared = store
+	}
+}
+
+// OnStateChange registers a callback invoked whenever a circuit changes state
+func (m *CircuitBreakerManager) OnStateChange(handler func(providerName, oldState, newState string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onStateChange = handler
+	for _, cb := range m.breakers {
+		cb.onStateChange = handler
+	}
+}
+
 // GetAllMetrics returns metrics for all circuit breakers
 func (m *CircuitBreakerManager) GetAllMetrics() []CircuitBreakerMetrics {
 	m.mu.RLock()
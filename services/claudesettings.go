@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 const (
@@ -22,6 +23,7 @@ type ClaudeProxyStatus struct {
 
 type ClaudeSettingsService struct {
 	relayAddr string
+	profileMu sync.Mutex
 }
 
 func NewClaudeSettingsService(relayAddr string) *ClaudeSettingsService {
@@ -69,17 +71,23 @@ func (css *ClaudeSettingsService) EnableProxy() error {
 			return err
 		}
 	}
-	settings := claudeSettingsFile{
-		Env: map[string]string{
-			"ANTHROPIC_AUTH_TOKEN": claudeAuthTokenValue,
-			"ANTHROPIC_BASE_URL":   css.baseURL(),
-		},
+	// Keep model, permissions and the rest of the user's settings; only the connection is replaced
+	settings, _, err := css.readSettingsMap()
+	if err != nil {
+		settings = map[string]json.RawMessage{}
+	}
+	env := map[string]string{}
+	if raw, ok := settings["env"]; ok {
+		_ = json.Unmarshal(raw, &env)
 	}
-	payload, err := json.MarshalIndent(settings, "", "  ")
+	env["ANTHROPIC_AUTH_TOKEN"] = claudeAuthTokenValue
+	env["ANTHROPIC_BASE_URL"] = css.baseURL()
+	rawEnv, err := json.Marshal(env)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(settingsPath, payload, 0o600)
+	settings["env"] = rawEnv
+	return writeJSONMap(settingsPath, settings)
 }
 
 func (css *ClaudeSettingsService) DisableProxy() error {
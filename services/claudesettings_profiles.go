@@ -0,0 +1,548 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	claudeProfilesFileName   = "claude-profiles.json"
+	claudeHistoryDirName     = "claude-settings-history"
+	claudeHistoryMaxEntries  = 20
+	claudeProxyAuthTokenKey  = "ANTHROPIC_AUTH_TOKEN"
+	claudeProxyBaseURLKey    = "ANTHROPIC_BASE_URL"
+	claudeSettingsModelKey   = "model"
+	claudeSettingsEnvKey     = "env"
+	claudeSettingsPermsKey   = "permissions"
+	claudeSettingsStatusLine = "statusLine"
+)
+
+var claudeProfileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.-]{0,63}$`)
+
+// ClaudePermissions mirrors the permissions block of ~/.claude/settings.json
+type ClaudePermissions struct {
+	Allow                 []string `json:"allow,omitempty"`
+	Deny                  []string `json:"deny,omitempty"`
+	Ask                   []string `json:"ask,omitempty"`
+	DefaultMode           string   `json:"defaultMode,omitempty"`
+	AdditionalDirectories []string `json:"additionalDirectories,omitempty"`
+}
+
+// ClaudeStatusLine mirrors the statusLine block of ~/.claude/settings.json
+type ClaudeStatusLine struct {
+	Type    string `json:"type"`
+	Command string `json:"command,omitempty"`
+	Padding int    `json:"padding,omitempty"`
+}
+
+// ClaudeSettingsProfile is a named Claude Code setup that can be applied to settings.json.
+// Keys without a dedicated field (hooks, includeCoAuthoredBy, ...) are kept in Extra.
+type ClaudeSettingsProfile struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description,omitempty"`
+	Model       string                     `json:"model,omitempty"`
+	Env         map[string]string          `json:"env,omitempty"`
+	Permissions *ClaudePermissions         `json:"permissions,omitempty"`
+	StatusLine  *ClaudeStatusLine          `json:"statusLine,omitempty"`
+	Extra       map[string]json.RawMessage `json:"extra,omitempty"`
+	UpdatedAt   int64                      `json:"updated_at"`
+}
+
+// ClaudeSettingsBackup is a snapshot of settings.json taken before a profile was applied
+type ClaudeSettingsBackup struct {
+	ID            string `json:"id"`
+	CreatedAt     int64  `json:"created_at"`
+	Profile       string `json:"profile"`        // Profile that was applied over this snapshot
+	ActiveProfile string `json:"active_profile"` // Profile that was active when the snapshot was taken
+}
+
+// ClaudeProfileList is returned to the frontend
+type ClaudeProfileList struct {
+	Active   string                  `json:"active"`
+	Profiles []ClaudeSettingsProfile `json:"profiles"`
+	Backups  []ClaudeSettingsBackup  `json:"backups"`
+}
+
+type claudeProfileStore struct {
+	Active   string                  `json:"active"`
+	Profiles []ClaudeSettingsProfile `json:"profiles"`
+}
+
+// claudeHistoryEntry is the on-disk form of a backup; Missing means settings.json did not exist
+type claudeHistoryEntry struct {
+	ClaudeSettingsBackup
+	Missing bool   `json:"missing,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ListProfiles returns all profiles, the active one and the available rollback points
+func (css *ClaudeSettingsService) ListProfiles() (ClaudeProfileList, error) {
+	css.profileMu.Lock()
+	defer css.profileMu.Unlock()
+
+	store, err := css.loadProfiles()
+	if err != nil {
+		return ClaudeProfileList{}, err
+	}
+	entries, err := css.historyEntries()
+	if err != nil {
+		return ClaudeProfileList{}, err
+	}
+	backups := make([]ClaudeSettingsBackup, 0, len(entries))
+	for _, entry := range entries {
+		backups = append(backups, entry.ClaudeSettingsBackup)
+	}
+	return ClaudeProfileList{Active: store.Active, Profiles: store.Profiles, Backups: backups}, nil
+}
+
+// SaveProfile creates or replaces a profile
+func (css *ClaudeSettingsService) SaveProfile(profile ClaudeSettingsProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if !claudeProfileNamePattern.MatchString(profile.Name) {
+		return fmt.Errorf("invalid profile name %q", profile.Name)
+	}
+	for key := range profile.Extra {
+		switch key {
+		case claudeSettingsModelKey, claudeSettingsEnvKey, claudeSettingsPermsKey, claudeSettingsStatusLine:
+			return fmt.Errorf("extra key %q must be set through its own field", key)
+		}
+	}
+	if profile.StatusLine != nil && profile.StatusLine.Type == "" {
+		profile.StatusLine.Type = "command"
+	}
+	profile.UpdatedAt = time.Now().Unix()
+
+	css.profileMu.Lock()
+	defer css.profileMu.Unlock()
+
+	store, err := css.loadProfiles()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range store.Profiles {
+		if store.Profiles[i].Name == profile.Name {
+			store.Profiles[i] = profile
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		store.Profiles = append(store.Profiles, profile)
+	}
+	return css.saveProfiles(store)
+}
+
+// DeleteProfile removes a profile; settings.json is left untouched
+func (css *ClaudeSettingsService) DeleteProfile(name string) error {
+	css.profileMu.Lock()
+	defer css.profileMu.Unlock()
+
+	store, err := css.loadProfiles()
+	if err != nil {
+		return err
+	}
+	kept := store.Profiles[:0]
+	for _, p := range store.Profiles {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == len(store.Profiles) {
+		return fmt.Errorf("profile %q not found", name)
+	}
+	store.Profiles = kept
+	if store.Active == name {
+		store.Active = ""
+	}
+	return css.saveProfiles(store)
+}
+
+// CaptureProfile saves the current settings.json as a profile.
+// The proxy connection written by EnableProxy is not part of a profile and is left out.
+func (css *ClaudeSettingsService) CaptureProfile(name, description string) (ClaudeSettingsProfile, error) {
+	current, _, err := css.readSettingsMap()
+	if err != nil {
+		return ClaudeSettingsProfile{}, err
+	}
+	profile, err := profileFromSettings(current)
+	if err != nil {
+		return ClaudeSettingsProfile{}, err
+	}
+	css.stripProxyEnv(profile.Env)
+	profile.Name = name
+	profile.Description = description
+	if err := css.SaveProfile(profile); err != nil {
+		return ClaudeSettingsProfile{}, err
+	}
+	return profile, nil
+}
+
+// ApplyProfile backs up settings.json and replaces it with the profile.
+// When the proxy is enabled it stays enabled, and the profile also becomes the settings restored by DisableProxy.
+func (css *ClaudeSettingsService) ApplyProfile(name string) error {
+	css.profileMu.Lock()
+	defer css.profileMu.Unlock()
+
+	store, err := css.loadProfiles()
+	if err != nil {
+		return err
+	}
+	var profile *ClaudeSettingsProfile
+	for i := range store.Profiles {
+		if store.Profiles[i].Name == name {
+			profile = &store.Profiles[i]
+			break
+		}
+	}
+	if profile == nil {
+		return fmt.Errorf("profile %q not found", name)
+	}
+
+	status, err := css.ProxyStatus()
+	if err != nil {
+		return err
+	}
+	if err := css.snapshotSettings(name, store.Active); err != nil {
+		return err
+	}
+
+	settings, err := settingsFromProfile(*profile)
+	if err != nil {
+		return err
+	}
+	settingsPath, backupPath, err := css.paths()
+	if err != nil {
+		return err
+	}
+	if status.Enabled {
+		if err := writeJSONMap(backupPath, settings); err != nil {
+			return err
+		}
+		env := map[string]string{}
+		for k, v := range profile.Env {
+			env[k] = v
+		}
+		env[claudeProxyAuthTokenKey] = claudeAuthTokenValue
+		env[claudeProxyBaseURLKey] = css.baseURL()
+		raw, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+		settings[claudeSettingsEnvKey] = raw
+	}
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
+		return err
+	}
+	if err := writeJSONMap(settingsPath, settings); err != nil {
+		return err
+	}
+
+	store.Active = name
+	return css.saveProfiles(store)
+}
+
+// RollbackSettings restores settings.json from a backup (the latest one when id is empty)
+// and removes that backup and every newer one
+func (css *ClaudeSettingsService) RollbackSettings(id string) error {
+	css.profileMu.Lock()
+	defer css.profileMu.Unlock()
+
+	entries, err := css.historyEntries()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("no settings backup to roll back to")
+	}
+	idx := 0
+	if id != "" {
+		idx = -1
+		for i, entry := range entries {
+			if entry.ID == id {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("backup %q not found", id)
+		}
+	}
+	target := entries[idx]
+
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return err
+	}
+	if target.Missing {
+		if err := os.Remove(settingsPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else if err := os.WriteFile(settingsPath, []byte(target.Content), 0o600); err != nil {
+		return err
+	}
+
+	dir, err := css.historyDir()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries[:idx+1] {
+		os.Remove(filepath.Join(dir, entry.ID+".json"))
+	}
+
+	store, err := css.loadProfiles()
+	if err != nil {
+		return err
+	}
+	store.Active = target.ActiveProfile
+	return css.saveProfiles(store)
+}
+
+// snapshotSettings stores the current settings.json in the history directory and prunes old snapshots
+func (css *ClaudeSettingsService) snapshotSettings(profile, active string) error {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	entry := claudeHistoryEntry{ClaudeSettingsBackup: ClaudeSettingsBackup{
+		ID:            fmt.Sprintf("%d", now.UnixNano()),
+		CreatedAt:     now.Unix(),
+		Profile:       profile,
+		ActiveProfile: active,
+	}}
+	content, err := os.ReadFile(settingsPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		entry.Missing = true
+	case err != nil:
+		return err
+	default:
+		// Stored verbatim so a hand-edited file that no longer parses can be restored too
+		entry.Content = string(content)
+	}
+
+	dir, err := css.historyDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, entry.ID+".json"), data, 0o600); err != nil {
+		return err
+	}
+
+	entries, err := css.historyEntries()
+	if err != nil {
+		return err
+	}
+	for i := claudeHistoryMaxEntries; i < len(entries); i++ {
+		os.Remove(filepath.Join(dir, entries[i].ID+".json"))
+	}
+	return nil
+}
+
+// historyEntries returns the backups, newest first
+func (css *ClaudeSettingsService) historyEntries() ([]claudeHistoryEntry, error) {
+	dir, err := css.historyDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := make([]claudeHistoryEntry, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		var entry claudeHistoryEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.ID == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if len(entries[i].ID) != len(entries[j].ID) {
+			return len(entries[i].ID) > len(entries[j].ID)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+func (css *ClaudeSettingsService) loadProfiles() (claudeProfileStore, error) {
+	var store claudeProfileStore
+	path, err := css.profilesPath()
+	if err != nil {
+		return store, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return claudeProfileStore{Profiles: []ClaudeSettingsProfile{}}, nil
+		}
+		return store, err
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return store, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if store.Profiles == nil {
+		store.Profiles = []ClaudeSettingsProfile{}
+	}
+	return store, nil
+}
+
+func (css *ClaudeSettingsService) saveProfiles(store claudeProfileStore) error {
+	path, err := css.profilesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Profiles may carry API keys in env
+	return os.WriteFile(path, data, 0o600)
+}
+
+func (css *ClaudeSettingsService) profilesPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", claudeProfilesFileName), nil
+}
+
+func (css *ClaudeSettingsService) historyDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", claudeHistoryDirName), nil
+}
+
+// readSettingsMap reads settings.json as raw top-level keys; a missing file yields an empty map
+func (css *ClaudeSettingsService) readSettingsMap() (map[string]json.RawMessage, bool, error) {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return nil, false, err
+	}
+	settings := map[string]json.RawMessage{}
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return settings, false, nil
+		}
+		return nil, false, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return settings, true, nil
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, true, fmt.Errorf("parse %s: %w", settingsPath, err)
+	}
+	return settings, true, nil
+}
+
+// stripProxyEnv removes the connection written by EnableProxy
+func (css *ClaudeSettingsService) stripProxyEnv(env map[string]string) {
+	if strings.EqualFold(env[claudeProxyAuthTokenKey], claudeAuthTokenValue) {
+		delete(env, claudeProxyAuthTokenKey)
+	}
+	if strings.EqualFold(env[claudeProxyBaseURLKey], css.baseURL()) {
+		delete(env, claudeProxyBaseURLKey)
+	}
+}
+
+// profileFromSettings splits settings.json into the typed fields and Extra
+func profileFromSettings(settings map[string]json.RawMessage) (ClaudeSettingsProfile, error) {
+	profile := ClaudeSettingsProfile{Env: map[string]string{}, Extra: map[string]json.RawMessage{}}
+	for key, raw := range settings {
+		var err error
+		switch key {
+		case claudeSettingsModelKey:
+			err = json.Unmarshal(raw, &profile.Model)
+		case claudeSettingsEnvKey:
+			err = json.Unmarshal(raw, &profile.Env)
+		case claudeSettingsPermsKey:
+			err = json.Unmarshal(raw, &profile.Permissions)
+		case claudeSettingsStatusLine:
+			err = json.Unmarshal(raw, &profile.StatusLine)
+		default:
+			profile.Extra[key] = raw
+		}
+		if err != nil {
+			return profile, fmt.Errorf("settings.json %s: %w", key, err)
+		}
+	}
+	return profile, nil
+}
+
+// settingsFromProfile builds the settings.json content of a profile
+func settingsFromProfile(profile ClaudeSettingsProfile) (map[string]json.RawMessage, error) {
+	settings := make(map[string]json.RawMessage, len(profile.Extra)+4)
+	for key, raw := range profile.Extra {
+		settings[key] = raw
+	}
+	set := func(key string, value any) error {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		settings[key] = raw
+		return nil
+	}
+	if profile.Model != "" {
+		if err := set(claudeSettingsModelKey, profile.Model); err != nil {
+			return nil, err
+		}
+	}
+	if len(profile.Env) > 0 {
+		if err := set(claudeSettingsEnvKey, profile.Env); err != nil {
+			return nil, err
+		}
+	}
+	if profile.Permissions != nil {
+		if err := set(claudeSettingsPermsKey, profile.Permissions); err != nil {
+			return nil, err
+		}
+	}
+	if profile.StatusLine != nil {
+		if err := set(claudeSettingsStatusLine, profile.StatusLine); err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
+
+func writeJSONMap(path string, value map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readClaudeSettings(t *testing.T, path string) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read settings: %v", err)
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("Failed to parse settings: %v", err)
+	}
+	return settings
+}
+
+func TestClaudeSettingsProfiles_ApplyAndRollback(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	settingsPath := filepath.Join(home, ".claude", "settings.json")
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	original := `{"model":"opus","env":{"DISABLE_TELEMETRY":"1"},"hooks":{"Stop":[]},"permissions":{"allow":["Bash(git status)"]}}`
+	if err := os.WriteFile(settingsPath, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	css := NewClaudeSettingsService(":18100")
+	work, err := css.CaptureProfile("work", "company setup")
+	if err != nil {
+		t.Fatalf("CaptureProfile failed: %v", err)
+	}
+	if work.Model != "opus" || work.Permissions == nil || len(work.Permissions.Allow) != 1 || work.Extra["hooks"] == nil {
+		t.Fatalf("captured profile = %+v", work)
+	}
+
+	experiment := ClaudeSettingsProfile{
+		Name:        "experiment",
+		Model:       "sonnet",
+		Env:         map[string]string{"MAX_THINKING_TOKENS": "8000"},
+		Permissions: &ClaudePermissions{DefaultMode: "acceptEdits"},
+		StatusLine:  &ClaudeStatusLine{Command: "~/.claude/statusline.sh"},
+	}
+	if err := css.SaveProfile(experiment); err != nil {
+		t.Fatalf("SaveProfile failed: %v", err)
+	}
+	if err := css.SaveProfile(ClaudeSettingsProfile{Name: "../escape"}); err == nil {
+		t.Fatal("invalid name should be rejected")
+	}
+	if err := css.SaveProfile(ClaudeSettingsProfile{Name: "x", Extra: map[string]json.RawMessage{"model": []byte(`"a"`)}}); err == nil {
+		t.Fatal("typed keys in extra should be rejected")
+	}
+
+	if err := css.ApplyProfile("experiment"); err != nil {
+		t.Fatalf("ApplyProfile failed: %v", err)
+	}
+	settings := readClaudeSettings(t, settingsPath)
+	if settings["model"] != "sonnet" || settings["hooks"] != nil {
+		t.Fatalf("settings after apply = %v", settings)
+	}
+	if statusLine, _ := settings["statusLine"].(map[string]any); statusLine["type"] != "command" {
+		t.Fatalf("statusLine = %v", settings["statusLine"])
+	}
+
+	list, err := css.ListProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Active != "experiment" || len(list.Profiles) != 2 || len(list.Backups) != 1 || list.Backups[0].Profile != "experiment" {
+		t.Fatalf("list = %+v", list)
+	}
+
+	if err := css.RollbackSettings(""); err != nil {
+		t.Fatalf("RollbackSettings failed: %v", err)
+	}
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Fatalf("rollback content = %s", data)
+	}
+	list, _ = css.ListProfiles()
+	if list.Active != "" || len(list.Backups) != 0 {
+		t.Fatalf("list after rollback = %+v", list)
+	}
+	if err := css.RollbackSettings(""); err == nil {
+		t.Fatal("rollback without backups should fail")
+	}
+}
+
+func TestClaudeSettingsProfiles_KeepProxyEnabled(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	settingsPath := filepath.Join(home, ".claude", "settings.json")
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(settingsPath, []byte(`{"model":"opus","env":{"FOO":"bar"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	css := NewClaudeSettingsService(":18100")
+	if err := css.EnableProxy(); err != nil {
+		t.Fatal(err)
+	}
+	// Enabling the proxy keeps the rest of the settings
+	settings := readClaudeSettings(t, settingsPath)
+	env, _ := settings["env"].(map[string]any)
+	if settings["model"] != "opus" || env["FOO"] != "bar" || env["ANTHROPIC_BASE_URL"] != "http://127.0.0.1:18100" {
+		t.Fatalf("settings after EnableProxy = %v", settings)
+	}
+
+	// The proxy connection is not captured into a profile
+	profile, err := css.CaptureProfile("personal", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := profile.Env["ANTHROPIC_AUTH_TOKEN"]; ok || profile.Env["FOO"] != "bar" {
+		t.Fatalf("captured env = %v", profile.Env)
+	}
+
+	if err := css.SaveProfile(ClaudeSettingsProfile{Name: "work", Model: "sonnet"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := css.ApplyProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := css.ProxyStatus()
+	if err != nil || !status.Enabled {
+		t.Fatalf("proxy should stay enabled: %+v, %v", status, err)
+	}
+
+	// Disabling the proxy restores the applied profile rather than the pre-proxy settings
+	if err := css.DisableProxy(); err != nil {
+		t.Fatal(err)
+	}
+	settings = readClaudeSettings(t, settingsPath)
+	if settings["model"] != "sonnet" || settings["env"] != nil {
+		t.Fatalf("settings after DisableProxy = %v", settings)
+	}
+}
+
+func TestClaudeSettingsProfiles_RollbackMissingFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	settingsPath := filepath.Join(home, ".claude", "settings.json")
+
+	css := NewClaudeSettingsService(":18100")
+	if err := css.SaveProfile(ClaudeSettingsProfile{Name: "fresh", Model: "haiku"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := css.ApplyProfile("fresh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(settingsPath); err != nil {
+		t.Fatalf("settings.json not written: %v", err)
+	}
+	if err := css.RollbackSettings(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(settingsPath); !os.IsNotExist(err) {
+		t.Fatalf("settings.json should be removed again, stat err = %v", err)
+	}
+	if err := css.DeleteProfile("fresh"); err != nil {
+		t.Fatal(err)
+	}
+	if err := css.DeleteProfile("fresh"); err == nil {
+		t.Fatal("deleting a missing profile should fail")
+	}
+}
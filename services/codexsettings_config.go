@@ -0,0 +1,575 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	codexPreviousConfigName = "cc-studio.prev.config.toml"
+
+	// Known config.toml schemas. Legacy Codex releases only support stdio MCP servers with
+	// startup_timeout_ms and have no on-request approval policy; current releases add
+	// streamable HTTP servers, second-based timeouts and per-server enabled flags.
+	CodexSchemaLegacy  = "legacy"
+	CodexSchemaCurrent = "current"
+)
+
+// CodexConfig is the structured part of ~/.codex/config.toml managed from the app.
+// Keys not listed here are preserved when the file is written.
+type CodexConfig struct {
+	Model                 string                      `json:"model,omitempty"`
+	ModelProvider         string                      `json:"model_provider,omitempty"`
+	ModelReasoningEffort  string                      `json:"model_reasoning_effort,omitempty"`
+	ApprovalPolicy        string                      `json:"approval_policy,omitempty"`
+	SandboxMode           string                      `json:"sandbox_mode,omitempty"`
+	SandboxWorkspaceWrite *CodexSandboxWorkspaceWrite `json:"sandbox_workspace_write,omitempty"`
+	Profile               string                      `json:"profile,omitempty"` // Profile used when codex starts without --profile
+	Profiles              map[string]CodexProfile     `json:"profiles,omitempty"`
+	MCPServers            map[string]CodexMCPServer   `json:"mcp_servers,omitempty"`
+}
+
+// CodexSandboxWorkspaceWrite mirrors [sandbox_workspace_write]
+type CodexSandboxWorkspaceWrite struct {
+	WritableRoots       []string `json:"writable_roots,omitempty"`
+	NetworkAccess       bool     `json:"network_access"`
+	ExcludeTmpdirEnvVar bool     `json:"exclude_tmpdir_env_var"`
+	ExcludeSlashTmp     bool     `json:"exclude_slash_tmp"`
+}
+
+// CodexProfile mirrors a [profiles.<name>] table
+type CodexProfile struct {
+	Model                string `json:"model,omitempty"`
+	ModelProvider        string `json:"model_provider,omitempty"`
+	ModelReasoningEffort string `json:"model_reasoning_effort,omitempty"`
+	ApprovalPolicy       string `json:"approval_policy,omitempty"`
+	SandboxMode          string `json:"sandbox_mode,omitempty"`
+}
+
+// CodexMCPServer mirrors a [mcp_servers.<name>] table; either Command (stdio) or URL (streamable HTTP) is set
+type CodexMCPServer struct {
+	Command           string            `json:"command,omitempty"`
+	Args              []string          `json:"args,omitempty"`
+	Env               map[string]string `json:"env,omitempty"`
+	URL               string            `json:"url,omitempty"`
+	BearerTokenEnvVar string            `json:"bearer_token_env_var,omitempty"`
+	StartupTimeoutSec int               `json:"startup_timeout_sec,omitempty"`
+	ToolTimeoutSec    int               `json:"tool_timeout_sec,omitempty"`
+	Enabled           *bool             `json:"enabled,omitempty"`
+}
+
+// CodexConfigIssue is a validation finding; errors block writing, warnings do not
+type CodexConfigIssue struct {
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"` // error / warning
+}
+
+// CodexConfigPreview is the result of rendering a config without writing it
+type CodexConfigPreview struct {
+	Schema   string             `json:"schema"`
+	BaseHash string             `json:"base_hash"` // Hash of the current file, pass it to SaveConfig
+	Content  string             `json:"content"`
+	Diff     string             `json:"diff"`
+	Changed  bool               `json:"changed"`
+	Issues   []CodexConfigIssue `json:"issues"`
+}
+
+type codexSchema struct {
+	approvalPolicies []string
+	sandboxModes     []string
+	remoteMCP        bool
+}
+
+var codexSchemas = map[string]codexSchema{
+	CodexSchemaLegacy: {
+		approvalPolicies: []string{"untrusted", "on-failure", "never"},
+		sandboxModes:     []string{"read-only", "workspace-write", "danger-full-access"},
+	},
+	CodexSchemaCurrent: {
+		approvalPolicies: []string{"untrusted", "on-failure", "on-request", "never"},
+		sandboxModes:     []string{"read-only", "workspace-write", "danger-full-access"},
+		remoteMCP:        true,
+	},
+}
+
+var (
+	codexReasoningEfforts = []string{"minimal", "low", "medium", "high"}
+	codexTableKeyPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// GetConfig reads the managed part of config.toml; a missing file yields an empty config
+func (css *CodexSettingsService) GetConfig() (CodexConfig, error) {
+	raw, _, err := css.readRawConfig()
+	if err != nil {
+		return CodexConfig{}, err
+	}
+	return codexConfigFromRaw(raw), nil
+}
+
+// DetectConfigSchema guesses the schema the current file was written for
+func (css *CodexSettingsService) DetectConfigSchema() (string, error) {
+	raw, _, err := css.readRawConfig()
+	if err != nil {
+		return "", err
+	}
+	return detectCodexSchema(raw), nil
+}
+
+// ValidateConfig checks a config against a schema (empty = current)
+func (css *CodexSettingsService) ValidateConfig(cfg CodexConfig, schema string) []CodexConfigIssue {
+	return validateCodexConfig(cfg, schema)
+}
+
+// PreviewConfig renders cfg over the current file and returns a unified diff without writing anything
+func (css *CodexSettingsService) PreviewConfig(cfg CodexConfig, schema string) (CodexConfigPreview, error) {
+	raw, content, err := css.readRawConfig()
+	if err != nil {
+		return CodexConfigPreview{}, err
+	}
+	if schema == "" {
+		schema = detectCodexSchema(raw)
+	}
+	preview := CodexConfigPreview{
+		Schema:   schema,
+		BaseHash: hashCodexConfig(content),
+		Issues:   validateCodexConfig(cfg, schema),
+	}
+	rendered, err := renderCodexConfig(raw, cfg, schema)
+	if err != nil {
+		return preview, err
+	}
+	preview.Content = string(rendered)
+	preview.Changed = preview.Content != string(content)
+	preview.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(content)),
+		B:        difflib.SplitLines(preview.Content),
+		FromFile: "config.toml",
+		ToFile:   "config.toml (new)",
+		Context:  3,
+	})
+	return preview, err
+}
+
+// SaveConfig validates and writes cfg. baseHash comes from PreviewConfig; when the file changed
+// since the preview the write is refused so edits made outside the app are not lost.
+func (css *CodexSettingsService) SaveConfig(cfg CodexConfig, schema, baseHash string) error {
+	raw, content, err := css.readRawConfig()
+	if err != nil {
+		return err
+	}
+	if baseHash != "" && baseHash != hashCodexConfig(content) {
+		return errors.New("config.toml changed since the preview, preview again before saving")
+	}
+	if schema == "" {
+		schema = detectCodexSchema(raw)
+	}
+	for _, issue := range validateCodexConfig(cfg, schema) {
+		if issue.Severity == "error" {
+			return fmt.Errorf("%s: %s", issue.Field, issue.Message)
+		}
+	}
+	rendered, err := renderCodexConfig(raw, cfg, schema)
+	if err != nil {
+		return err
+	}
+
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
+		return err
+	}
+	if len(content) > 0 {
+		if err := os.WriteFile(filepath.Join(filepath.Dir(settingsPath), codexPreviousConfigName), content, 0o600); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(settingsPath, rendered, 0o600)
+}
+
+// readRawConfig returns config.toml as a generic map together with its raw content
+func (css *CodexSettingsService) readRawConfig() (map[string]any, []byte, error) {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw := make(map[string]any)
+	content, err := os.ReadFile(settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return raw, nil, nil
+		}
+		return nil, nil, err
+	}
+	if err := toml.Unmarshal(content, &raw); err != nil {
+		return nil, content, fmt.Errorf("parse config.toml: %w", err)
+	}
+	if raw == nil {
+		raw = make(map[string]any)
+	}
+	return raw, content, nil
+}
+
+func hashCodexConfig(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// detectCodexSchema treats files using startup_timeout_ms MCP entries as legacy
+func detectCodexSchema(raw map[string]any) string {
+	servers, _ := raw["mcp_servers"].(map[string]any)
+	for _, value := range servers {
+		entry, _ := value.(map[string]any)
+		if _, ok := entry["startup_timeout_ms"]; ok {
+			return CodexSchemaLegacy
+		}
+	}
+	return CodexSchemaCurrent
+}
+
+func validateCodexConfig(cfg CodexConfig, schemaName string) []CodexConfigIssue {
+	issues := []CodexConfigIssue{}
+	add := func(severity, field, format string, args ...any) {
+		issues = append(issues, CodexConfigIssue{Field: field, Message: fmt.Sprintf(format, args...), Severity: severity})
+	}
+	if schemaName == "" {
+		schemaName = CodexSchemaCurrent
+	}
+	schema, ok := codexSchemas[schemaName]
+	if !ok {
+		add("error", "schema", "unknown schema %q", schemaName)
+		return issues
+	}
+
+	checkEnum := func(field, value string, allowed []string) {
+		if value != "" && !containsFold(allowed, value) {
+			add("error", field, "%q is not one of %s", value, strings.Join(allowed, ", "))
+		}
+	}
+	checkEnum("approval_policy", cfg.ApprovalPolicy, schema.approvalPolicies)
+	checkEnum("sandbox_mode", cfg.SandboxMode, schema.sandboxModes)
+	checkEnum("model_reasoning_effort", cfg.ModelReasoningEffort, codexReasoningEfforts)
+	if cfg.SandboxMode == "danger-full-access" && cfg.ApprovalPolicy == "never" {
+		add("warning", "sandbox_mode", "danger-full-access with approval_policy never lets Codex run any command without asking")
+	}
+	if cfg.SandboxWorkspaceWrite != nil && cfg.SandboxMode != "" && cfg.SandboxMode != "workspace-write" {
+		add("warning", "sandbox_workspace_write", "only used when sandbox_mode is workspace-write")
+	}
+
+	for _, name := range sortedCodexKeys(cfg.Profiles) {
+		profile := cfg.Profiles[name]
+		field := "profiles." + name
+		if !codexTableKeyPattern.MatchString(name) {
+			add("error", field, "profile names may only contain letters, digits, - and _")
+		}
+		checkEnum(field+".approval_policy", profile.ApprovalPolicy, schema.approvalPolicies)
+		checkEnum(field+".sandbox_mode", profile.SandboxMode, schema.sandboxModes)
+		checkEnum(field+".model_reasoning_effort", profile.ModelReasoningEffort, codexReasoningEfforts)
+	}
+	if cfg.Profile != "" {
+		if _, ok := cfg.Profiles[cfg.Profile]; !ok {
+			add("error", "profile", "profile %q is not defined", cfg.Profile)
+		}
+	}
+
+	for _, name := range sortedCodexKeys(cfg.MCPServers) {
+		server := cfg.MCPServers[name]
+		field := "mcp_servers." + name
+		if !codexTableKeyPattern.MatchString(name) {
+			add("error", field, "server names may only contain letters, digits, - and _")
+		}
+		switch {
+		case server.Command == "" && server.URL == "":
+			add("error", field, "either command or url is required")
+		case server.Command != "" && server.URL != "":
+			add("error", field, "command and url are mutually exclusive")
+		case server.URL != "":
+			if !schema.remoteMCP {
+				add("error", field+".url", "streamable HTTP servers are not supported by the %s schema", schemaName)
+			} else if u, err := url.Parse(server.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("error", field+".url", "invalid url %q", server.URL)
+			}
+		}
+		if server.StartupTimeoutSec < 0 || server.ToolTimeoutSec < 0 {
+			add("error", field, "timeouts must not be negative")
+		}
+		if !schema.remoteMCP && (server.ToolTimeoutSec > 0 || server.Enabled != nil || server.BearerTokenEnvVar != "") {
+			add("warning", field, "tool_timeout_sec, enabled and bearer_token_env_var are ignored by the %s schema", schemaName)
+		}
+	}
+	return issues
+}
+
+// codexConfigFromRaw extracts the managed keys from a parsed config.toml
+func codexConfigFromRaw(raw map[string]any) CodexConfig {
+	cfg := CodexConfig{
+		Model:                tomlString(raw, "model"),
+		ModelProvider:        tomlString(raw, "model_provider"),
+		ModelReasoningEffort: tomlString(raw, "model_reasoning_effort"),
+		ApprovalPolicy:       tomlString(raw, "approval_policy"),
+		SandboxMode:          tomlString(raw, "sandbox_mode"),
+		Profile:              tomlString(raw, "profile"),
+	}
+	if sww, ok := raw["sandbox_workspace_write"].(map[string]any); ok {
+		cfg.SandboxWorkspaceWrite = &CodexSandboxWorkspaceWrite{
+			WritableRoots:       tomlStrings(sww, "writable_roots"),
+			NetworkAccess:       tomlBool(sww, "network_access"),
+			ExcludeTmpdirEnvVar: tomlBool(sww, "exclude_tmpdir_env_var"),
+			ExcludeSlashTmp:     tomlBool(sww, "exclude_slash_tmp"),
+		}
+	}
+	if profiles, ok := raw["profiles"].(map[string]any); ok {
+		cfg.Profiles = make(map[string]CodexProfile, len(profiles))
+		for name, value := range profiles {
+			p, _ := value.(map[string]any)
+			cfg.Profiles[name] = CodexProfile{
+				Model:                tomlString(p, "model"),
+				ModelProvider:        tomlString(p, "model_provider"),
+				ModelReasoningEffort: tomlString(p, "model_reasoning_effort"),
+				ApprovalPolicy:       tomlString(p, "approval_policy"),
+				SandboxMode:          tomlString(p, "sandbox_mode"),
+			}
+		}
+	}
+	if servers, ok := raw["mcp_servers"].(map[string]any); ok {
+		cfg.MCPServers = make(map[string]CodexMCPServer, len(servers))
+		for name, value := range servers {
+			s, _ := value.(map[string]any)
+			server := CodexMCPServer{
+				Command:           tomlString(s, "command"),
+				Args:              tomlStrings(s, "args"),
+				URL:               tomlString(s, "url"),
+				BearerTokenEnvVar: tomlString(s, "bearer_token_env_var"),
+				StartupTimeoutSec: tomlInt(s, "startup_timeout_sec"),
+				ToolTimeoutSec:    tomlInt(s, "tool_timeout_sec"),
+			}
+			if ms := tomlInt(s, "startup_timeout_ms"); ms > 0 && server.StartupTimeoutSec == 0 {
+				server.StartupTimeoutSec = (ms + 999) / 1000
+			}
+			if enabled, ok := s["enabled"].(bool); ok {
+				server.Enabled = &enabled
+			}
+			if env, ok := s["env"].(map[string]any); ok {
+				server.Env = make(map[string]string, len(env))
+				for k, v := range env {
+					server.Env[k] = fmt.Sprint(v)
+				}
+			}
+			cfg.MCPServers[name] = server
+		}
+	}
+	return cfg
+}
+
+// renderCodexConfig applies cfg on top of the existing file; unmanaged keys, including unknown
+// keys inside managed tables, are kept
+func renderCodexConfig(raw map[string]any, cfg CodexConfig, schema string) ([]byte, error) {
+	out := make(map[string]any, len(raw))
+	for k, v := range raw {
+		out[k] = v
+	}
+	setTomlString(out, "model", cfg.Model)
+	setTomlString(out, "model_provider", cfg.ModelProvider)
+	setTomlString(out, "model_reasoning_effort", cfg.ModelReasoningEffort)
+	setTomlString(out, "approval_policy", cfg.ApprovalPolicy)
+	setTomlString(out, "sandbox_mode", cfg.SandboxMode)
+	setTomlString(out, "profile", cfg.Profile)
+
+	if cfg.SandboxWorkspaceWrite == nil {
+		delete(out, "sandbox_workspace_write")
+	} else {
+		sww := cloneTomlTable(out["sandbox_workspace_write"])
+		sww["network_access"] = cfg.SandboxWorkspaceWrite.NetworkAccess
+		sww["exclude_tmpdir_env_var"] = cfg.SandboxWorkspaceWrite.ExcludeTmpdirEnvVar
+		sww["exclude_slash_tmp"] = cfg.SandboxWorkspaceWrite.ExcludeSlashTmp
+		setTomlList(sww, "writable_roots", cfg.SandboxWorkspaceWrite.WritableRoots)
+		out["sandbox_workspace_write"] = sww
+	}
+
+	if len(cfg.Profiles) == 0 {
+		delete(out, "profiles")
+	} else {
+		existing, _ := out["profiles"].(map[string]any)
+		profiles := make(map[string]any, len(cfg.Profiles))
+		for name, profile := range cfg.Profiles {
+			p := cloneTomlTable(existing[name])
+			setTomlString(p, "model", profile.Model)
+			setTomlString(p, "model_provider", profile.ModelProvider)
+			setTomlString(p, "model_reasoning_effort", profile.ModelReasoningEffort)
+			setTomlString(p, "approval_policy", profile.ApprovalPolicy)
+			setTomlString(p, "sandbox_mode", profile.SandboxMode)
+			profiles[name] = p
+		}
+		out["profiles"] = profiles
+	}
+
+	if len(cfg.MCPServers) == 0 {
+		delete(out, "mcp_servers")
+	} else {
+		existing, _ := out["mcp_servers"].(map[string]any)
+		servers := make(map[string]any, len(cfg.MCPServers))
+		for name, server := range cfg.MCPServers {
+			s := cloneTomlTable(existing[name])
+			setTomlString(s, "command", server.Command)
+			setTomlList(s, "args", server.Args)
+			setTomlString(s, "url", server.URL)
+			if len(server.Env) == 0 {
+				delete(s, "env")
+			} else {
+				s["env"] = server.Env
+			}
+			if schema == CodexSchemaLegacy {
+				delete(s, "startup_timeout_sec")
+				setTomlInt(s, "startup_timeout_ms", server.StartupTimeoutSec*1000)
+			} else {
+				delete(s, "startup_timeout_ms")
+				setTomlInt(s, "startup_timeout_sec", server.StartupTimeoutSec)
+				setTomlInt(s, "tool_timeout_sec", server.ToolTimeoutSec)
+				setTomlString(s, "bearer_token_env_var", server.BearerTokenEnvVar)
+				if server.Enabled == nil {
+					delete(s, "enabled")
+				} else {
+					s["enabled"] = *server.Enabled
+				}
+			}
+			servers[name] = s
+		}
+		out["mcp_servers"] = servers
+	}
+
+	data, err := toml.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return stripEmptyTomlHeaders(data, "model_providers", "profiles", "mcp_servers"), nil
+}
+
+// stripEmptyTomlHeaders removes parent headers such as [profiles] that only contain sub-tables
+func stripEmptyTomlHeaders(data []byte, tables ...string) []byte {
+	headers := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		headers["["+t+"]"] = true
+	}
+	lines := strings.Split(string(data), "\n")
+	result := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if headers[strings.TrimSpace(line)] && nextTomlLineIsHeader(lines[i+1:]) {
+			continue
+		}
+		result = append(result, line)
+	}
+	return []byte(strings.Join(result, "\n"))
+}
+
+func nextTomlLineIsHeader(lines []string) bool {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		return strings.HasPrefix(trimmed, "[")
+	}
+	return true
+}
+
+func cloneTomlTable(value any) map[string]any {
+	table := make(map[string]any)
+	if existing, ok := value.(map[string]any); ok {
+		for k, v := range existing {
+			table[k] = v
+		}
+	}
+	return table
+}
+
+func setTomlString(table map[string]any, key, value string) {
+	if value == "" {
+		delete(table, key)
+		return
+	}
+	table[key] = value
+}
+
+func setTomlInt(table map[string]any, key string, value int) {
+	if value <= 0 {
+		delete(table, key)
+		return
+	}
+	table[key] = value
+}
+
+func setTomlList(table map[string]any, key string, values []string) {
+	if len(values) == 0 {
+		delete(table, key)
+		return
+	}
+	table[key] = values
+}
+
+func tomlString(table map[string]any, key string) string {
+	if value, ok := table[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func tomlBool(table map[string]any, key string) bool {
+	value, _ := table[key].(bool)
+	return value
+}
+
+func tomlInt(table map[string]any, key string) int {
+	switch value := table[key].(type) {
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return 0
+}
+
+func tomlStrings(table map[string]any, key string) []string {
+	items, _ := table[key].([]any)
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedCodexKeys is used to keep issue order stable for the UI
+func sortedCodexKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
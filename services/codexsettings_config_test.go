@@ -0,0 +1,170 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestCodexConfig_PreviewAndSave(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".codex", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	original := `model = "gpt-5"
+approval_policy = "on-failure"
+hide_agent_reasoning = true
+
+[mcp_servers.docs]
+command = "npx"
+args = ["-y", "docs-mcp"]
+custom_flag = "keep"
+`
+	if err := os.WriteFile(configPath, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	css := NewCodexSettingsService(":18100")
+	cfg, err := css.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+	if cfg.Model != "gpt-5" || cfg.ApprovalPolicy != "on-failure" || len(cfg.MCPServers["docs"].Args) != 2 {
+		t.Fatalf("config = %+v", cfg)
+	}
+
+	cfg.SandboxMode = "workspace-write"
+	cfg.SandboxWorkspaceWrite = &CodexSandboxWorkspaceWrite{NetworkAccess: true}
+	cfg.Profiles = map[string]CodexProfile{"fast": {Model: "gpt-5-mini", ModelReasoningEffort: "low"}}
+	cfg.Profile = "fast"
+	cfg.MCPServers["search"] = CodexMCPServer{URL: "https://mcp.example.com/mcp", ToolTimeoutSec: 30}
+
+	preview, err := css.PreviewConfig(cfg, "")
+	if err != nil {
+		t.Fatalf("PreviewConfig failed: %v", err)
+	}
+	if !preview.Changed || len(preview.Issues) != 0 || preview.Schema != CodexSchemaCurrent {
+		t.Fatalf("preview = %+v", preview)
+	}
+	if !strings.Contains(preview.Diff, `+sandbox_mode = 'workspace-write'`) && !strings.Contains(preview.Diff, `+sandbox_mode = "workspace-write"`) {
+		t.Fatalf("diff missing sandbox_mode:\n%s", preview.Diff)
+	}
+	if strings.Contains(preview.Content, "[profiles]\n") || strings.Contains(preview.Content, "[mcp_servers]\n") {
+		t.Fatalf("empty parent headers kept:\n%s", preview.Content)
+	}
+	// Nothing is written by a preview
+	if data, _ := os.ReadFile(configPath); string(data) != original {
+		t.Fatal("preview modified config.toml")
+	}
+
+	if err := css.SaveConfig(cfg, "", "stale"); err == nil {
+		t.Fatal("save with a stale hash should fail")
+	}
+	if err := css.SaveConfig(cfg, "", preview.BaseHash); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written map[string]any
+	if err := toml.Unmarshal(data, &written); err != nil {
+		t.Fatalf("written config is invalid TOML: %v\n%s", err, data)
+	}
+	if written["hide_agent_reasoning"] != true || written["profile"] != "fast" {
+		t.Fatalf("written = %v", written)
+	}
+	docs := written["mcp_servers"].(map[string]any)["docs"].(map[string]any)
+	if docs["custom_flag"] != "keep" {
+		t.Fatalf("unknown server key dropped: %v", docs)
+	}
+	previous, err := os.ReadFile(filepath.Join(home, ".codex", codexPreviousConfigName))
+	if err != nil || string(previous) != original {
+		t.Fatalf("previous config not kept: %v", err)
+	}
+
+	reloaded, err := css.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.MCPServers["search"].URL != "https://mcp.example.com/mcp" || reloaded.Profiles["fast"].Model != "gpt-5-mini" {
+		t.Fatalf("reloaded = %+v", reloaded)
+	}
+}
+
+func TestCodexConfig_Validate(t *testing.T) {
+	css := NewCodexSettingsService(":18100")
+	cfg := CodexConfig{
+		ApprovalPolicy: "on-request",
+		Profile:        "missing",
+		MCPServers: map[string]CodexMCPServer{
+			"remote": {URL: "https://mcp.example.com"},
+			"empty":  {},
+		},
+	}
+
+	hasError := func(issues []CodexConfigIssue, field string) bool {
+		for _, issue := range issues {
+			if issue.Field == field && issue.Severity == "error" {
+				return true
+			}
+		}
+		return false
+	}
+
+	current := css.ValidateConfig(cfg, "")
+	if hasError(current, "approval_policy") || hasError(current, "mcp_servers.remote.url") {
+		t.Fatalf("current schema issues = %+v", current)
+	}
+	if !hasError(current, "profile") || !hasError(current, "mcp_servers.empty") {
+		t.Fatalf("expected profile and empty server errors: %+v", current)
+	}
+
+	legacy := css.ValidateConfig(cfg, CodexSchemaLegacy)
+	if !hasError(legacy, "approval_policy") || !hasError(legacy, "mcp_servers.remote.url") {
+		t.Fatalf("legacy schema issues = %+v", legacy)
+	}
+	if !hasError(css.ValidateConfig(cfg, "v9"), "schema") {
+		t.Fatal("unknown schema should be reported")
+	}
+}
+
+func TestCodexConfig_LegacyTimeouts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".codex", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte("[mcp_servers.fs]\ncommand = \"mcp-fs\"\nstartup_timeout_ms = 20000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	css := NewCodexSettingsService(":18100")
+	schema, err := css.DetectConfigSchema()
+	if err != nil || schema != CodexSchemaLegacy {
+		t.Fatalf("schema = %q, %v", schema, err)
+	}
+	cfg, err := css.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cfg.MCPServers["fs"]
+	if server.StartupTimeoutSec != 20 {
+		t.Fatalf("startup timeout = %d", server.StartupTimeoutSec)
+	}
+	server.StartupTimeoutSec = 45
+	cfg.MCPServers["fs"] = server
+	if err := css.SaveConfig(cfg, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(data), "startup_timeout_ms = 45000") || strings.Contains(string(data), "startup_timeout_sec") {
+		t.Fatalf("legacy timeout not kept:\n%s", data)
+	}
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 崩溃来源
+const (
+	CrashSourcePanic = "panic" // 已恢复的 panic
+	CrashSourceFatal = "fatal" // 进程崩溃，下次启动时从运行时崩溃输出中收集
+)
+
+const (
+	crashLogTailLines = 200
+	maxCrashReports   = 50
+	// maxSessionLogSize session.log 超过该大小时只保留最近的日志
+	maxSessionLogSize = 512 << 10
+	maxCrashStackSize = 64 << 10
+	crashOutputFile   = "runtime-crash.log"
+	crashSessionLog   = "session.log"
+)
+
+var crashReportIDPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// 日志中可能出现的密钥：Bearer / Basic 凭据、sk-xxx、key=value 形式的凭据
+var crashSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`\b(sk|pk|rk)-[A-Za-z0-9_-]{8,}`),
+	regexp.MustCompile(`(?i)("?(?:api[_-]?key|token|secret|password|dsn)"?\s*[:=]\s*"?)[^\s",}]+`),
+}
+
+// crashSecretKey 配置摘要中需要隐藏值的字段
+var crashSecretKey = regexp.MustCompile(`(?i)(key|token|secret|password|auth|dsn|cookie|webhook)`)
+
+// CrashReport 崩溃报告，保存在 ~/.code-switch/crash-reports/<id>.json
+type CrashReport struct {
+	ID         string         `json:"id"`
+	CreatedAt  string         `json:"created_at"`
+	Source     string         `json:"source"`
+	Context    string         `json:"context,omitempty"` // panic 发生的位置
+	Message    string         `json:"message"`
+	Stack      string         `json:"stack"`
+	Version    string         `json:"version"`
+	OS         string         `json:"os"`
+	Arch       string         `json:"arch"`
+	GoVersion  string         `json:"go_version"`
+	LogTail    []string       `json:"log_tail"`
+	Config     map[string]any `json:"config"` // 已去除密钥的配置摘要
+	Seen       bool           `json:"seen"`
+	UploadedAt string         `json:"uploaded_at,omitempty"`
+}
+
+// CrashReportService 捕获 panic 与进程崩溃并生成本地崩溃报告；
+// 只有在用户同意（设置中开启上传，或手动上传单个报告）后才会发送到配置的 Sentry 兼容地址
+type CrashReportService struct {
+	dir     string
+	version string
+	client  *http.Client
+	logs    *crashLogBuffer
+
+	mu sync.Mutex
+}
+
+// crashReporter 已安装的崩溃报告服务，供 RecoverPanic / ReportPanic 使用
+var crashReporter atomic.Pointer[CrashReportService]
+
+func NewCrashReportService(version string) *CrashReportService {
+	home, _ := os.UserHomeDir()
+	return &CrashReportService{
+		dir:     filepath.Join(home, ".code-switch", "crash-reports"),
+		version: version,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		logs:    &crashLogBuffer{},
+	}
+}
+
+// Install 收集上次运行的崩溃输出，并开始记录日志与捕获本次运行的崩溃；应在启动时尽早调用
+func (cs *CrashReportService) Install() {
+	if err := os.MkdirAll(cs.dir, 0700); err != nil {
+		log.Printf("[CrashReport] failed to create %s: %v", cs.dir, err)
+		return
+	}
+	cs.collectPreviousRun()
+
+	if f, err := os.OpenFile(filepath.Join(cs.dir, crashSessionLog), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err == nil {
+		cs.logs.file = f
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, cs.logs))
+	cs.captureStdout()
+
+	// 未恢复的 panic 与 fatal error 由运行时写入该文件，下次启动时生成报告
+	if f, err := os.OpenFile(filepath.Join(cs.dir, crashOutputFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err == nil {
+		if err := debug.SetCrashOutput(f, debug.CrashOptions{}); err != nil {
+			log.Printf("[CrashReport] failed to set crash output: %v", err)
+		}
+		f.Close()
+	}
+	crashReporter.Store(cs)
+}
+
+// captureStdout 将标准输出同时写入日志缓冲（服务层日志使用 fmt.Printf）
+func (cs *CrashReportService) captureStdout() {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	original := os.Stdout
+	os.Stdout = w
+	go func() {
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				// GUI 程序在 Windows 上可能没有控制台，写入失败时忽略
+				_, _ = original.Write(buf[:n])
+				_, _ = cs.logs.Write(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// collectPreviousRun 上次运行崩溃时，根据运行时崩溃输出与 session.log 生成报告
+func (cs *CrashReportService) collectPreviousRun() {
+	data, err := os.ReadFile(filepath.Join(cs.dir, crashOutputFile))
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return
+	}
+	var tail []string
+	if session, err := os.ReadFile(filepath.Join(cs.dir, crashSessionLog)); err == nil {
+		tail = strings.Split(strings.TrimRight(string(session), "\n"), "\n")
+		if len(tail) > crashLogTailLines {
+			tail = tail[len(tail)-crashLogTailLines:]
+		}
+	}
+
+	message := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			message = line
+			break
+		}
+	}
+	report := cs.newReport(CrashSourceFatal, "", message, data, tail)
+	if err := cs.saveReport(report); err != nil {
+		log.Printf("[CrashReport] failed to save crash report: %v", err)
+		return
+	}
+	_ = os.Remove(filepath.Join(cs.dir, crashOutputFile))
+	cs.autoUpload(report)
+}
+
+func (cs *CrashReportService) newReport(source, context, message string, stack []byte, tail []string) CrashReport {
+	if len(stack) > maxCrashStackSize {
+		stack = stack[:maxCrashStackSize]
+	}
+	now := time.Now()
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return CrashReport{
+		ID:        now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		CreatedAt: now.Format(time.RFC3339),
+		Source:    source,
+		Context:   context,
+		Message:   redactSecrets(message),
+		Stack:     string(stack),
+		Version:   cs.version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		LogTail:   tail,
+		Config:    crashConfigSummary(),
+	}
+}
+
+func (cs *CrashReportService) saveReport(report CrashReport) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := os.MkdirAll(cs.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(cs.dir, report.ID+".json"), data, 0600); err != nil {
+		return err
+	}
+
+	// 只保留最近的报告
+	reports, err := cs.loadReportsLocked()
+	if err != nil {
+		return nil
+	}
+	for _, old := range reports[min(len(reports), maxCrashReports):] {
+		_ = os.Remove(filepath.Join(cs.dir, old.ID+".json"))
+	}
+	return nil
+}
+
+// loadReportsLocked 读取全部报告，按时间倒序
+func (cs *CrashReportService) loadReportsLocked() ([]CrashReport, error) {
+	entries, err := os.ReadDir(cs.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []CrashReport{}, nil
+		}
+		return nil, err
+	}
+	reports := []CrashReport{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(cs.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var report CrashReport
+		if err := json.Unmarshal(data, &report); err != nil || report.ID == "" {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID > reports[j].ID })
+	return reports, nil
+}
+
+// ListCrashReports 获取全部崩溃报告，最新的在前
+func (cs *CrashReportService) ListCrashReports() ([]CrashReport, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.loadReportsLocked()
+}
+
+// GetUnseenCrashReports 获取用户尚未查看的崩溃报告，启动时在界面中提示
+func (cs *CrashReportService) GetUnseenCrashReports() ([]CrashReport, error) {
+	reports, err := cs.ListCrashReports()
+	if err != nil {
+		return nil, err
+	}
+	unseen := []CrashReport{}
+	for _, report := range reports {
+		if !report.Seen {
+			unseen = append(unseen, report)
+		}
+	}
+	return unseen, nil
+}
+
+// MarkCrashReportsSeen 将全部崩溃报告标记为已查看
+func (cs *CrashReportService) MarkCrashReportsSeen() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	reports, err := cs.loadReportsLocked()
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		if report.Seen {
+			continue
+		}
+		report.Seen = true
+		if err := cs.writeReportLocked(report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCrashReport 删除崩溃报告
+func (cs *CrashReportService) DeleteCrashReport(id string) error {
+	if !crashReportIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid crash report id %q", id)
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := os.Remove(filepath.Join(cs.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (cs *CrashReportService) writeReportLocked(report CrashReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cs.dir, report.ID+".json"), data, 0600)
+}
+
+// reportPanic 为已恢复的 panic 生成报告
+func (cs *CrashReportService) reportPanic(context string, recovered any, stack []byte) {
+	report := cs.newReport(CrashSourcePanic, context, fmt.Sprintf("panic: %v", recovered), stack, cs.logs.tail())
+	if err := cs.saveReport(report); err != nil {
+		log.Printf("[CrashReport] failed to save crash report: %v", err)
+		return
+	}
+	go cs.autoUpload(report)
+}
+
+// ReportPanic 记录已恢复的 panic；未安装崩溃报告服务时只输出日志
+func ReportPanic(context string, recovered any, stack []byte) {
+	fmt.Printf("[CrashReport] recovered panic in %s: %v\n%s\n", context, recovered, stack)
+	if cs := crashReporter.Load(); cs != nil {
+		cs.reportPanic(context, recovered, stack)
+	}
+}
+
+// RecoverPanic 用于 defer：恢复 panic 并生成崩溃报告，避免后台 goroutine 的 panic 导致整个应用退出
+func RecoverPanic(context string) {
+	if recovered := recover(); recovered != nil {
+		ReportPanic(context, recovered, debug.Stack())
+	}
+}
+
+// crashRecoveryMiddleware 转发服务 handler panic 时生成崩溃报告并返回 500
+func crashRecoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				// 客户端断开等情况由 gin 默认的 Recovery 处理
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				ReportPanic(fmt.Sprintf("relay %s %s", c.Request.Method, c.FullPath()), recovered, debug.Stack())
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			}
+		}()
+		c.Next()
+	}
+}
+
+// crashConfigSummary 配置摘要：应用设置（隐藏密钥）与各平台 provider 数量，不包含 provider 名称与地址
+func crashConfigSummary() map[string]any {
+	summary := map[string]any{}
+	if settings, err := NewAppSettingsService(nil).GetAppSettings(); err == nil {
+		if data, err := json.Marshal(settings); err == nil {
+			var values map[string]any
+			if json.Unmarshal(data, &values) == nil {
+				summary["app_settings"] = redactConfigValues(values)
+			}
+		}
+	}
+
+	providers := map[string]map[string]int{}
+	providerService := NewProviderService()
+	for _, kind := range []string{"claude", "codex", "gemini-cli", "picoclaw"} {
+		list, err := providerService.LoadProviders(kind)
+		if err != nil {
+			continue
+		}
+		enabled := 0
+		for _, provider := range list {
+			if provider.Enabled {
+				enabled++
+			}
+		}
+		providers[kind] = map[string]int{"total": len(list), "enabled": enabled}
+	}
+	summary["providers"] = providers
+	return summary
+}
+
+// redactConfigValues 隐藏字段名包含 key / token / secret 等的非空值
+func redactConfigValues(values map[string]any) map[string]any {
+	for key, value := range values {
+		switch v := value.(type) {
+		case map[string]any:
+			values[key] = redactConfigValues(v)
+		case string:
+			if v != "" && crashSecretKey.MatchString(key) {
+				values[key] = "[redacted]"
+			}
+		}
+	}
+	return values
+}
+
+// redactSecrets 隐藏日志中的密钥
+func redactSecrets(line string) string {
+	line = crashSecretPatterns[0].ReplaceAllString(line, "$1 [redacted]")
+	line = crashSecretPatterns[1].ReplaceAllString(line, "$1-[redacted]")
+	return crashSecretPatterns[2].ReplaceAllString(line, "${1}[redacted]")
+}
+
+// crashLogBuffer 保留最近的日志行（已去除密钥），同时写入 session.log 以便进程崩溃后读取
+type crashLogBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+	file    *os.File
+	size    int64
+}
+
+func (b *crashLogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := append(b.partial, p...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		b.appendLine(redactSecrets(strings.TrimRight(string(data[:idx]), "\r")))
+		data = data[idx+1:]
+	}
+	if len(data) > 4096 {
+		b.appendLine(redactSecrets(string(data)))
+		data = nil
+	}
+	b.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (b *crashLogBuffer) appendLine(line string) {
+	b.lines = append(b.lines, line)
+	if len(b.lines) > crashLogTailLines {
+		b.lines = append([]string(nil), b.lines[len(b.lines)-crashLogTailLines:]...)
+	}
+	if b.file == nil {
+		return
+	}
+	n, _ := b.file.WriteString(line + "\n")
+	b.size += int64(n)
+	if b.size > maxSessionLogSize {
+		// 只保留最近的日志行
+		content := strings.Join(b.lines, "\n") + "\n"
+		if err := b.file.Truncate(0); err == nil {
+			_, _ = b.file.Seek(0, io.SeekStart)
+			n, _ := b.file.WriteString(content)
+			b.size = int64(n)
+		}
+	}
+}
+
+func (b *crashLogBuffer) tail() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.lines...)
+}
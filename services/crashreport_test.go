@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestCrashReportService(t *testing.T, settings AppSettings) *CrashReportService {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if _, err := NewAppSettingsService(nil).SaveAppSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	cs := NewCrashReportService("v0.1.8")
+	crashReporter.Store(cs)
+	t.Cleanup(func() { crashReporter.Store(nil) })
+	return cs
+}
+
+func TestRedactSecrets(t *testing.T) {
+	cases := map[string]string{
+		"Authorization: Bearer abc.def-123":      "Authorization: Bearer [redacted]",
+		"using key sk-ant-api03-abcdefghijkl":    "using key sk-[redacted]",
+		`{"api_key":"secret-value","model":"x"}`: `{"api_key":"[redacted]","model":"x"}`,
+		"token=abc123 status=200":                "token=[redacted] status=200",
+		"authorization: Basic dXNlcjpwYXNz":      "authorization: Basic [redacted]",
+		"input_tokens: 100":                      "input_tokens: 100",
+	}
+	for input, want := range cases {
+		if got := redactSecrets(input); got != want {
+			t.Fatalf("redactSecrets(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestCrashReportCapture(t *testing.T) {
+	cs := newTestCrashReportService(t, AppSettings{NewAPIToken: "sk-live-token-123456", NewAPIURL: "http://localhost:3000"})
+	cs.logs.Write([]byte("[INFO] relay started\nforwarding with sk-abcdefghijklmnop\n"))
+
+	func() {
+		defer RecoverPanic("background sync")
+		panic("boom")
+	}()
+
+	reports, err := cs.ListCrashReports()
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("expected one report, got %v (%v)", reports, err)
+	}
+	report := reports[0]
+	if report.Source != CrashSourcePanic || report.Context != "background sync" || report.Message != "panic: boom" ||
+		!strings.Contains(report.Stack, "TestCrashReportCapture") {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if len(report.LogTail) != 2 || report.LogTail[1] != "forwarding with sk-[redacted]" {
+		t.Fatalf("expected redacted log tail, got %v", report.LogTail)
+	}
+	settings := report.Config["app_settings"].(map[string]any)
+	if settings["new_api_token"] != "[redacted]" || settings["new_api_url"] != "http://localhost:3000" {
+		t.Fatalf("expected secrets stripped from config summary, got %v", settings)
+	}
+
+	// 转发服务 handler 的 panic 返回 500 并生成报告
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(crashRecoveryMiddleware())
+	router.GET("/v1/models", func(*gin.Context) { panic("handler failed") })
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+
+	// 上次运行崩溃：运行时崩溃输出与 session.log 在下次启动时生成报告
+	os.MkdirAll(cs.dir, 0700)
+	os.WriteFile(filepath.Join(cs.dir, crashOutputFile), []byte("\nfatal error: concurrent map writes\n\ngoroutine 1 [running]:\n"), 0600)
+	os.WriteFile(filepath.Join(cs.dir, crashSessionLog), []byte("line 1\nline 2\n"), 0600)
+	cs.collectPreviousRun()
+	if _, err := os.Stat(filepath.Join(cs.dir, crashOutputFile)); !os.IsNotExist(err) {
+		t.Fatal("expected crash output to be consumed")
+	}
+
+	unseen, err := cs.GetUnseenCrashReports()
+	if err != nil || len(unseen) != 3 {
+		t.Fatalf("expected 3 unseen reports, got %d (%v)", len(unseen), err)
+	}
+	var fatal *CrashReport
+	for i := range unseen {
+		if unseen[i].Source == CrashSourceFatal {
+			fatal = &unseen[i]
+		}
+	}
+	if fatal == nil || fatal.Message != "fatal error: concurrent map writes" || len(fatal.LogTail) != 2 {
+		t.Fatalf("unexpected fatal report: %+v", fatal)
+	}
+
+	if err := cs.MarkCrashReportsSeen(); err != nil {
+		t.Fatal(err)
+	}
+	if unseen, _ := cs.GetUnseenCrashReports(); len(unseen) != 0 {
+		t.Fatalf("expected no unseen reports, got %d", len(unseen))
+	}
+	if err := cs.DeleteCrashReport("../app"); err == nil {
+		t.Fatal("expected invalid id to be rejected")
+	}
+	if err := cs.DeleteCrashReport(fatal.ID); err != nil {
+		t.Fatal(err)
+	}
+	if reports, _ := cs.ListCrashReports(); len(reports) != 2 {
+		t.Fatalf("expected 2 reports after delete, got %d", len(reports))
+	}
+}
+
+func TestCrashReportUploadRequiresConsent(t *testing.T) {
+	requests := make(chan *http.Request, 4)
+	bodies := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- string(body)
+	}))
+	defer server.Close()
+	dsn := strings.Replace(server.URL, "http://", "http://pubkey@", 1) + "/42"
+
+	cs := newTestCrashReportService(t, AppSettings{CrashReportDSN: dsn})
+	report := cs.newReport(CrashSourcePanic, "test", "panic: boom", []byte("stack"), nil)
+	if err := cs.saveReport(report); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未同意自动上传时不发送
+	cs.autoUpload(report)
+	if len(requests) != 0 {
+		t.Fatal("report must not be uploaded without consent")
+	}
+
+	// 用户手动上传
+	if err := cs.UploadCrashReport(report.ID); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req.URL.Path != "/api/42/envelope/" || !strings.Contains(req.Header.Get("X-Sentry-Auth"), "sentry_key=pubkey") {
+		t.Fatalf("unexpected upload request: %s %v", req.URL.Path, req.Header)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(<-bodies))
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	var event map[string]any
+	if len(lines) != 3 || json.Unmarshal([]byte(lines[2]), &event) != nil || event["message"] != "panic: boom" {
+		t.Fatalf("unexpected envelope: %v", lines)
+	}
+	if reports, _ := cs.ListCrashReports(); reports[0].UploadedAt == "" {
+		t.Fatal("expected upload time to be recorded")
+	}
+
+	// 同意后自动上传
+	if _, err := NewAppSettingsService(nil).SaveAppSettings(AppSettings{CrashReportDSN: dsn, CrashReportUpload: true}); err != nil {
+		t.Fatal(err)
+	}
+	cs.autoUpload(report)
+	if len(requests) != 1 {
+		t.Fatal("expected report to be uploaded after consent")
+	}
+
+	if _, err := parseSentryDSN("not a dsn"); err == nil {
+		t.Fatal("expected invalid DSN to be rejected")
+	}
+}
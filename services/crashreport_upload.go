@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sentryDSN 解析后的 Sentry DSN：https://<public_key>@<host>/<project_id>
+type sentryDSN struct {
+	raw       string
+	publicKey string
+	endpoint  string
+}
+
+func parseSentryDSN(raw string) (sentryDSN, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User == nil {
+		return sentryDSN{}, fmt.Errorf("invalid crash report DSN")
+	}
+	path := strings.TrimRight(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	projectID := path[idx+1:]
+	if projectID == "" || u.User.Username() == "" {
+		return sentryDSN{}, fmt.Errorf("invalid crash report DSN")
+	}
+	return sentryDSN{
+		raw:       strings.TrimSpace(raw),
+		publicKey: u.User.Username(),
+		endpoint:  fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:idx], projectID),
+	}, nil
+}
+
+// crashUploadSettings 读取上传设置：consent 为用户是否同意自动上传
+func crashUploadSettings() (dsn string, consent bool) {
+	settings, err := NewAppSettingsService(nil).GetAppSettings()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(settings.CrashReportDSN), settings.CrashReportUpload
+}
+
+// autoUpload 用户已同意自动上传时发送新生成的报告
+func (cs *CrashReportService) autoUpload(report CrashReport) {
+	dsn, consent := crashUploadSettings()
+	if !consent || dsn == "" {
+		return
+	}
+	if err := cs.upload(report, dsn); err != nil {
+		log.Printf("[CrashReport] failed to upload crash report %s: %v", report.ID, err)
+	}
+}
+
+// UploadCrashReport 由用户手动发送单个崩溃报告到设置中配置的地址
+func (cs *CrashReportService) UploadCrashReport(id string) error {
+	if !crashReportIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid crash report id %q", id)
+	}
+	dsn, _ := crashUploadSettings()
+	if dsn == "" {
+		return fmt.Errorf("crash report upload endpoint is not configured")
+	}
+
+	cs.mu.Lock()
+	data, err := os.ReadFile(filepath.Join(cs.dir, id+".json"))
+	cs.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	var report CrashReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return err
+	}
+	return cs.upload(report, dsn)
+}
+
+// upload 以 Sentry envelope 格式发送报告，成功后记录上传时间
+func (cs *CrashReportService) upload(report CrashReport, rawDSN string) error {
+	dsn, err := parseSentryDSN(rawDSN)
+	if err != nil {
+		return err
+	}
+	body, err := sentryEnvelope(report, dsn)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, dsn.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=ailurus-paas/%s", dsn.publicKey, cs.version))
+	resp, err := cs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload failed: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	report.UploadedAt = time.Now().Format(time.RFC3339)
+	if _, err := os.Stat(filepath.Join(cs.dir, report.ID+".json")); err != nil {
+		// 上传期间报告已被删除
+		return nil
+	}
+	return cs.writeReportLocked(report)
+}
+
+// sentryEnvelope 生成 Sentry envelope：envelope 头、item 头与 event 各占一行
+func sentryEnvelope(report CrashReport, dsn sentryDSN) ([]byte, error) {
+	eventID := strings.ReplaceAll(report.ID, "-", "")
+	eventID = (eventID + strings.Repeat("0", 32))[:32]
+	level := "error"
+	if report.Source == CrashSourceFatal {
+		level = "fatal"
+	}
+	timestamp := report.CreatedAt
+	if timestamp == "" {
+		timestamp = time.Now().Format(time.RFC3339)
+	}
+
+	event, err := json.Marshal(map[string]any{
+		"event_id":  eventID,
+		"timestamp": timestamp,
+		"platform":  "go",
+		"level":     level,
+		"release":   report.Version,
+		"logger":    "ailurus-paas",
+		"message":   report.Message,
+		"exception": map[string]any{
+			"values": []map[string]any{{"type": report.Source, "value": report.Message}},
+		},
+		"tags": map[string]string{"source": report.Source, "context": report.Context},
+		"contexts": map[string]any{
+			"os":      map[string]string{"name": report.OS},
+			"device":  map[string]string{"arch": report.Arch},
+			"runtime": map[string]string{"name": "go", "version": report.GoVersion},
+		},
+		"extra": map[string]any{
+			"stack":    report.Stack,
+			"log_tail": report.LogTail,
+			"config":   report.Config,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	header, _ := json.Marshal(map[string]string{
+		"event_id": eventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+		"dsn":      dsn.raw,
+	})
+	itemHeader, _ := json.Marshal(map[string]any{"type": "event", "length": len(event)})
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(itemHeader)
+	buf.WriteByte('\n')
+	buf.Write(event)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 数据库维护：定期检查 app.db 的大小与碎片（空闲页占比），日志清理删除较多记录或空闲页过多时
+// 通过 incremental_vacuum 回收空间（首次会转换为增量 auto_vacuum 并完整 VACUUM 一次），并执行 PRAGMA optimize。
+// 每次检查后广播统计，超过设置的大小时由通知服务提醒用户
+
+const (
+	dbMaintenanceInterval = 30 * time.Minute
+	// dbReclaimDeletedRows 累计删除的日志条数达到该值后回收空间
+	dbReclaimDeletedRows = 5000
+	// dbReclaimFreeRatio 空闲页占比达到该值时回收空间
+	dbReclaimFreeRatio = 0.2
+	// DefaultDBSizeWarnMB 默认的数据库大小提醒阈值
+	DefaultDBSizeWarnMB = 1024
+)
+
+// DatabaseStats app.db 的存储占用与碎片统计
+type DatabaseStats struct {
+	Path      string `json:"path"`       // 数据库文件路径，只读模式（内存库）为空
+	SizeBytes int64  `json:"size_bytes"` // 主文件大小
+	WALBytes  int64  `json:"wal_bytes"`  // WAL 文件大小
+	PageSize  int64  `json:"page_size"`
+	PageCount int64  `json:"page_count"`
+	FreePages int64  `json:"free_pages"`
+	// 空闲页占比（%），即回收后可缩小的比例
+	FragmentationPercent float64 `json:"fragmentation_percent"`
+	AutoVacuum           string  `json:"auto_vacuum"` // none / full / incremental
+	// 上次回收空间以来日志清理删除的记录数
+	PendingDeletedRows int64  `json:"pending_deleted_rows"`
+	LastMaintenanceAt  string `json:"last_maintenance_at,omitempty"`
+	LastReclaimedBytes int64  `json:"last_reclaimed_bytes"`
+}
+
+// TotalBytes 主文件与 WAL 文件的总大小
+func (s DatabaseStats) TotalBytes() int64 {
+	return s.SizeBytes + s.WALBytes
+}
+
+// dbMaintenanceState 维护任务状态与统计订阅者
+type dbMaintenanceState struct {
+	// mu 串行化维护，避免手动触发与定时任务同时 VACUUM
+	mu            sync.Mutex
+	deletedRows   int64 // 原子操作
+	lastAt        time.Time
+	lastReclaimed int64
+
+	handlersMu sync.Mutex
+	handlers   []func(DatabaseStats)
+}
+
+// OnDatabaseStats 订阅每次维护后的数据库统计
+func (prs *ProviderRelayService) OnDatabaseStats(handler func(DatabaseStats)) {
+	prs.dbMaintenance.handlersMu.Lock()
+	prs.dbMaintenance.handlers = append(prs.dbMaintenance.handlers, handler)
+	prs.dbMaintenance.handlersMu.Unlock()
+}
+
+// noteLogDeletion 记录日志清理删除的条数，累计较多时下次维护回收空间
+func (prs *ProviderRelayService) noteLogDeletion(rows int64) {
+	if rows > 0 {
+		atomic.AddInt64(&prs.dbMaintenance.deletedRows, rows)
+	}
+}
+
+// GetDatabaseStats 返回 app.db 的大小与碎片统计
+func (prs *ProviderRelayService) GetDatabaseStats() (DatabaseStats, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return DatabaseStats{}, err
+	}
+	stats, err := readDatabaseStats(db)
+	if err != nil {
+		return stats, err
+	}
+	prs.fillMaintenanceState(&stats)
+	return stats, nil
+}
+
+// RunDatabaseMaintenance 立即回收空闲页并优化数据库，返回维护后的统计
+func (prs *ProviderRelayService) RunDatabaseMaintenance() (DatabaseStats, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return DatabaseStats{}, err
+	}
+	return prs.maintainDatabase(db, true)
+}
+
+func (prs *ProviderRelayService) fillMaintenanceState(stats *DatabaseStats) {
+	stats.PendingDeletedRows = atomic.LoadInt64(&prs.dbMaintenance.deletedRows)
+	prs.dbMaintenance.mu.Lock()
+	if !prs.dbMaintenance.lastAt.IsZero() {
+		stats.LastMaintenanceAt = prs.dbMaintenance.lastAt.Format(time.RFC3339)
+	}
+	stats.LastReclaimedBytes = prs.dbMaintenance.lastReclaimed
+	prs.dbMaintenance.mu.Unlock()
+}
+
+// startDatabaseMaintenanceTask 定期检查数据库大小并按需回收空间
+func (prs *ProviderRelayService) startDatabaseMaintenanceTask() {
+	ticker := time.NewTicker(dbMaintenanceInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		db, err := xdb.DB("default")
+		if err != nil {
+			continue
+		}
+		if _, err := prs.maintainDatabase(db, false); err != nil {
+			fmt.Printf("[DB] 数据库维护失败: %v\n", err)
+		}
+	}
+}
+
+// maintainDatabase 删除较多或空闲页过多（force 时无条件）时回收空间，随后优化查询计划并广播统计
+func (prs *ProviderRelayService) maintainDatabase(db *sql.DB, force bool) (DatabaseStats, error) {
+	state := &prs.dbMaintenance
+	state.mu.Lock()
+	before, err := readDatabaseStats(db)
+	if err != nil {
+		state.mu.Unlock()
+		return before, err
+	}
+
+	deleted := atomic.LoadInt64(&state.deletedRows)
+	fragmented := before.PageCount > 0 && float64(before.FreePages)/float64(before.PageCount) >= dbReclaimFreeRatio
+	if before.Path != "" && before.FreePages > 0 && (force || deleted >= dbReclaimDeletedRows || fragmented) {
+		if err := reclaimDatabaseSpace(db, before.AutoVacuum); err != nil {
+			state.mu.Unlock()
+			return before, err
+		}
+		atomic.AddInt64(&state.deletedRows, -deleted)
+	}
+	if _, err := db.Exec("PRAGMA optimize"); err != nil {
+		fmt.Printf("[DB] PRAGMA optimize 失败: %v\n", err)
+	}
+
+	after, err := readDatabaseStats(db)
+	if err != nil {
+		state.mu.Unlock()
+		return after, err
+	}
+	state.lastAt = time.Now()
+	state.lastReclaimed = 0
+	if reclaimed := before.TotalBytes() - after.TotalBytes(); reclaimed > 0 {
+		state.lastReclaimed = reclaimed
+		fmt.Printf("[DB] 已回收 %.1f MB 数据库空间\n", float64(reclaimed)/(1<<20))
+	}
+	state.mu.Unlock()
+	prs.fillMaintenanceState(&after)
+
+	state.handlersMu.Lock()
+	handlers := append([]func(DatabaseStats){}, state.handlers...)
+	state.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(after)
+	}
+	return after, nil
+}
+
+// reclaimDatabaseSpace 回收空闲页：已是增量模式时执行 incremental_vacuum，否则切换模式并完整 VACUUM 一次
+func reclaimDatabaseSpace(db *sql.DB, autoVacuum string) error {
+	// auto_vacuum 与 VACUUM 需在同一连接上执行
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if autoVacuum == "incremental" {
+		// incremental_vacuum 每步释放一页，需读完结果集才会回收全部空闲页
+		rows, err := conn.QueryContext(ctx, "PRAGMA incremental_vacuum")
+		if err != nil {
+			return fmt.Errorf("incremental vacuum: %w", err)
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("incremental vacuum: %w", err)
+		}
+	} else {
+		if _, err := conn.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+			return fmt.Errorf("vacuum: %w", err)
+		}
+	}
+	// 把 WAL 中的变更写回主文件并截断 WAL，文件大小才会真正缩小
+	if _, err := conn.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("wal checkpoint: %w", err)
+	}
+	return nil
+}
+
+// readDatabaseStats 读取页数、空闲页与文件大小
+func readDatabaseStats(db *sql.DB) (DatabaseStats, error) {
+	var stats DatabaseStats
+	rows, err := db.Query("PRAGMA database_list")
+	if err != nil {
+		return stats, err
+	}
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		if name == "main" {
+			stats.Path = file
+		}
+	}
+	rows.Close()
+
+	var autoVacuum int
+	for _, pragma := range []struct {
+		name string
+		dest any
+	}{
+		{"page_size", &stats.PageSize},
+		{"page_count", &stats.PageCount},
+		{"freelist_count", &stats.FreePages},
+		{"auto_vacuum", &autoVacuum},
+	} {
+		if err := db.QueryRow("PRAGMA " + pragma.name).Scan(pragma.dest); err != nil {
+			return stats, fmt.Errorf("PRAGMA %s: %w", pragma.name, err)
+		}
+	}
+	switch autoVacuum {
+	case 1:
+		stats.AutoVacuum = "full"
+	case 2:
+		stats.AutoVacuum = "incremental"
+	default:
+		stats.AutoVacuum = "none"
+	}
+	if stats.PageCount > 0 {
+		stats.FragmentationPercent = float64(stats.FreePages) * 100 / float64(stats.PageCount)
+	}
+
+	if stats.Path != "" {
+		if info, err := os.Stat(stats.Path); err == nil {
+			stats.SizeBytes = info.Size()
+		}
+		if info, err := os.Stat(stats.Path + "-wal"); err == nil {
+			stats.WALBytes = info.Size()
+		}
+	} else {
+		stats.SizeBytes = stats.PageSize * stats.PageCount
+	}
+	return stats, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDatabaseMaintenanceReclaimsSpace(t *testing.T) {
+	db := openTestRelayDB(t, "maintenance.db")
+	fill := func() {
+		t.Helper()
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS filler (id INTEGER PRIMARY KEY, data TEXT)"); err != nil {
+			t.Fatal(err)
+		}
+		tx, _ := db.Begin()
+		for i := 0; i < 500; i++ {
+			if _, err := tx.Exec("INSERT INTO filler (data) VALUES (?)", strings.Repeat("x", 4096)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("DELETE FROM filler"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fill()
+
+	prs := &ProviderRelayService{}
+	var observed []DatabaseStats
+	prs.OnDatabaseStats(func(stats DatabaseStats) { observed = append(observed, stats) })
+
+	before, err := prs.GetDatabaseStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Path == "" || before.FreePages == 0 || before.FragmentationPercent < 50 || before.AutoVacuum != "none" {
+		t.Fatalf("stats before maintenance = %+v", before)
+	}
+
+	// 首次回收：切换为增量 auto_vacuum 并完整 VACUUM
+	prs.noteLogDeletion(500)
+	after, err := prs.maintainDatabase(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.FreePages != 0 || after.AutoVacuum != "incremental" || after.PendingDeletedRows != 0 {
+		t.Fatalf("stats after maintenance = %+v", after)
+	}
+	if after.TotalBytes() >= before.TotalBytes() || after.LastReclaimedBytes == 0 || after.LastMaintenanceAt == "" {
+		t.Fatalf("space not reclaimed: before %d, after %+v", before.TotalBytes(), after)
+	}
+	if len(observed) != 1 || observed[0].FreePages != 0 {
+		t.Fatalf("observed = %+v", observed)
+	}
+
+	// 之后的回收使用 incremental_vacuum
+	fill()
+	if stats, _ := readDatabaseStats(db); stats.FreePages == 0 {
+		t.Fatal("expected free pages after second deletion")
+	}
+	after, err = prs.RunDatabaseMaintenance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.FreePages != 0 || after.AutoVacuum != "incremental" {
+		t.Fatalf("stats after incremental vacuum = %+v", after)
+	}
+
+	// 没有空闲页时只优化，不回收
+	after, err = prs.maintainDatabase(db, false)
+	if err != nil || after.LastReclaimedBytes != 0 || len(observed) != 3 {
+		t.Fatalf("idle maintenance: %+v, %v, observed %d", after, err, len(observed))
+	}
+}
+
+func TestNotificationDatabaseSize(t *testing.T) {
+	ns, now := newTestNotificationService(t, AppSettings{DBSizeWarnMB: 100})
+	recorder := &notificationRecorder{}
+	ns.SetSender(recorder.send)
+
+	ns.handleDatabaseStats(DatabaseStats{SizeBytes: 60 << 20, WALBytes: 10 << 20})
+	if titles := recorder.titles(); len(titles) != 0 {
+		t.Fatalf("notified below limit: %v", titles)
+	}
+	ns.handleDatabaseStats(DatabaseStats{SizeBytes: 95 << 20, WALBytes: 10 << 20})
+	ns.handleDatabaseStats(DatabaseStats{SizeBytes: 120 << 20})
+	if titles := recorder.titles(); len(titles) != 1 || titles[0] != "日志数据库过大" {
+		t.Fatalf("expected one size warning, got %v", titles)
+	}
+
+	// 每天最多提醒一次
+	*now = now.AddDate(0, 0, 1)
+	ns.handleDatabaseStats(DatabaseStats{SizeBytes: 120 << 20})
+	if titles := recorder.titles(); len(titles) != 2 {
+		t.Fatalf("expected warning on the next day, got %v", titles)
+	}
+}
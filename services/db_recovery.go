@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// dbRepairReportFile stores the outcome of the last integrity check that found a problem
+	dbRepairReportFile = "db-repair.json"
+	// dbQuarantineDir keeps corrupted database files for manual inspection
+	dbQuarantineDir = "quarantine"
+	// dbSalvageBatch is the number of rows copied per statement when salvaging a table
+	dbSalvageBatch = 1000
+)
+
+// sqliteCLI is used for `.recover` when installed; otherwise tables are salvaged row by row
+var sqliteCLI = "sqlite3"
+
+// DatabaseTableRecovery describes how many rows of a table survived a repair.
+// Lost is -1 when the original row count could not be read.
+type DatabaseTableRecovery struct {
+	Name      string `json:"name"`
+	Rows      int64  `json:"rows"`
+	Recovered int64  `json:"recovered"`
+	Lost      int64  `json:"lost"`
+}
+
+// DatabaseRepairReport is the result of the startup integrity check
+type DatabaseRepairReport struct {
+	CheckedAt      string                  `json:"checked_at"`
+	Checkpointed   bool                    `json:"checkpointed"`
+	Corrupted      bool                    `json:"corrupted"`
+	Problems       []string                `json:"problems,omitempty"`
+	Repaired       bool                    `json:"repaired"`
+	Method         string                  `json:"method,omitempty"`
+	QuarantinePath string                  `json:"quarantine_path,omitempty"`
+	Tables         []DatabaseTableRecovery `json:"tables,omitempty"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+// LostRows returns the number of rows known to be lost during repair
+func (r *DatabaseRepairReport) LostRows() int64 {
+	var lost int64
+	for _, table := range r.Tables {
+		if table.Lost > 0 {
+			lost += table.Lost
+		}
+	}
+	return lost
+}
+
+// CheckDatabaseIntegrity checkpoints the WAL and runs PRAGMA quick_check on dbPath.
+// A corrupted database is rebuilt into a fresh file, the old files are moved to
+// quarantine/ and the report is saved next to the database. Must run before the
+// database is opened by anything else.
+func CheckDatabaseIntegrity(dbPath string) *DatabaseRepairReport {
+	report := &DatabaseRepairReport{CheckedAt: time.Now().Format(time.RFC3339)}
+	if _, err := os.Stat(dbPath); err != nil {
+		// Fresh install, nothing to check
+		return report
+	}
+
+	problems, checkpointed, err := quickCheckDatabase(dbPath)
+	report.Checkpointed = checkpointed
+	if err == nil && len(problems) == 0 {
+		return report
+	}
+	report.Corrupted = true
+	report.Problems = problems
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+	}
+	fmt.Printf("[Recovery] Database integrity check failed: %s\n", strings.Join(report.Problems, "; "))
+
+	if err := repairDatabase(dbPath, report); err != nil {
+		report.Error = err.Error()
+		fmt.Printf("[Recovery] ❌ Database repair failed: %v\n", err)
+	} else {
+		fmt.Printf("[Recovery] ✓ Database rebuilt via %s, %d row(s) lost, corrupted file moved to %s\n",
+			report.Method, report.LostRows(), report.QuarantinePath)
+	}
+
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		if err := os.WriteFile(filepath.Join(filepath.Dir(dbPath), dbRepairReportFile), data, 0644); err != nil {
+			fmt.Printf("[Recovery] Failed to save database repair report: %v\n", err)
+		}
+	}
+	return report
+}
+
+// GetDatabaseRepairReport returns the last database repair report, or nil if none was recorded
+func (cr *ConfigRecovery) GetDatabaseRepairReport() (*DatabaseRepairReport, error) {
+	data, err := os.ReadFile(filepath.Join(cr.configDir, dbRepairReportFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var report DatabaseRepairReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse database repair report: %w", err)
+	}
+	return &report, nil
+}
+
+// quickCheckDatabase merges the WAL into the main file and returns the quick_check problems
+func quickCheckDatabase(dbPath string) (problems []string, checkpointed bool, err error) {
+	db, err := sql.Open("sqlite", dbPath+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, false, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if _, err := os.Stat(dbPath + "-wal"); err == nil {
+		var busy, logFrames, checkpointedFrames int
+		if err := db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointedFrames); err == nil && busy == 0 {
+			checkpointed = true
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, "PRAGMA quick_check")
+	if err != nil {
+		return nil, checkpointed, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return problems, checkpointed, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, checkpointed, rows.Err()
+}
+
+// repairDatabase rebuilds dbPath into a fresh file and swaps it in, keeping the old files in quarantine
+func repairDatabase(dbPath string, report *DatabaseRepairReport) error {
+	rebuilt := dbPath + ".recovering"
+	removeDatabaseFiles(rebuilt)
+
+	rowCounts := countTableRows(dbPath)
+	report.Method = "salvage"
+	var err error
+	if cli, lookErr := exec.LookPath(sqliteCLI); sqliteCLI != "" && lookErr == nil {
+		report.Method = "sqlite3 .recover"
+		if err = recoverWithCLI(cli, dbPath, rebuilt); err != nil {
+			// Fall back to copying whatever rows are still readable
+			fmt.Printf("[Recovery] sqlite3 .recover unavailable, salvaging rows instead: %v\n", err)
+			removeDatabaseFiles(rebuilt)
+			report.Method = "salvage"
+		}
+	}
+	if report.Method == "salvage" {
+		err = salvageDatabase(dbPath, rebuilt)
+	}
+	if err != nil {
+		// Start over with an empty database; the app recreates its tables on startup
+		removeDatabaseFiles(rebuilt)
+		report.Method = "reset"
+		fmt.Printf("[Recovery] Nothing could be salvaged (%v), starting with an empty database\n", err)
+	}
+
+	if report.Method != "reset" {
+		if problems, _, err := quickCheckDatabase(rebuilt); err != nil || len(problems) > 0 {
+			removeDatabaseFiles(rebuilt)
+			return fmt.Errorf("rebuilt database is still corrupted: %v %v", problems, err)
+		}
+		recovered := countTableRows(rebuilt)
+		for name, rows := range rowCounts {
+			table := DatabaseTableRecovery{Name: name, Rows: rows, Recovered: recovered[name], Lost: -1}
+			if rows >= 0 {
+				table.Lost = max(rows-table.Recovered, 0)
+			}
+			report.Tables = append(report.Tables, table)
+		}
+	} else {
+		for name, rows := range rowCounts {
+			report.Tables = append(report.Tables, DatabaseTableRecovery{Name: name, Rows: rows, Lost: rows})
+		}
+	}
+
+	sort.Slice(report.Tables, func(i, j int) bool { return report.Tables[i].Name < report.Tables[j].Name })
+
+	quarantine, err := quarantineDatabase(dbPath)
+	if err != nil {
+		removeDatabaseFiles(rebuilt)
+		return err
+	}
+	report.QuarantinePath = quarantine
+	if report.Method != "reset" {
+		if err := os.Rename(rebuilt, dbPath); err != nil {
+			return fmt.Errorf("failed to move rebuilt database into place: %w", err)
+		}
+	}
+	report.Repaired = true
+	return nil
+}
+
+// recoverWithCLI pipes `sqlite3 <db> .recover` into a new database
+func recoverWithCLI(cli, dbPath, rebuilt string) error {
+	dump := exec.Command(cli, dbPath, ".recover")
+	restore := exec.Command(cli, rebuilt)
+	pipe, err := dump.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	restore.Stdin = pipe
+	var dumpErr, restoreErr strings.Builder
+	dump.Stderr = &dumpErr
+	restore.Stderr = &restoreErr
+	if err := restore.Start(); err != nil {
+		return err
+	}
+	if err := dump.Run(); err != nil {
+		restore.Wait()
+		return fmt.Errorf(".recover failed: %v %s", err, strings.TrimSpace(dumpErr.String()))
+	}
+	if err := restore.Wait(); err != nil {
+		return fmt.Errorf("restore failed: %v %s", err, strings.TrimSpace(restoreErr.String()))
+	}
+	return nil
+}
+
+// salvageDatabase copies the schema and every readable row into a new database.
+// Rows are copied in rowid batches; a failing batch is retried row by row so a
+// corrupted page only loses the rows stored on it.
+func salvageDatabase(dbPath, rebuilt string) error {
+	db, err := sql.Open("sqlite", dbPath+"?_busy_timeout=5000")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// ATTACH is per connection
+	db.SetMaxOpenConns(1)
+
+	type schemaEntry struct{ kind, name, sql string }
+	rows, err := db.Query(`SELECT type, name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 ELSE 2 END`)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+	var schema []schemaEntry
+	for rows.Next() {
+		var entry schemaEntry
+		if err := rows.Scan(&entry.kind, &entry.name, &entry.sql); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read schema: %w", err)
+		}
+		schema = append(schema, entry)
+	}
+	rows.Close()
+
+	target, err := sql.Open("sqlite", rebuilt)
+	if err != nil {
+		return err
+	}
+	for _, entry := range schema {
+		if _, err := target.Exec(entry.sql); err != nil {
+			fmt.Printf("[Recovery] Skipping %s %s: %v\n", entry.kind, entry.name, err)
+		}
+	}
+	target.Close()
+
+	if _, err := db.Exec("ATTACH DATABASE ? AS recovered", rebuilt); err != nil {
+		return err
+	}
+	defer db.Exec("DETACH DATABASE recovered")
+
+	for _, entry := range schema {
+		if entry.kind != "table" {
+			continue
+		}
+		table := quoteIdent(entry.name)
+		if _, err := db.Exec(fmt.Sprintf("INSERT INTO recovered.%s SELECT * FROM main.%s", table, table)); err == nil {
+			continue
+		}
+		db.Exec(fmt.Sprintf("DELETE FROM recovered.%s", table))
+
+		var maxRowID sql.NullInt64
+		if err := db.QueryRow(fmt.Sprintf("SELECT max(rowid) FROM main.%s", table)).Scan(&maxRowID); err != nil || !maxRowID.Valid {
+			// WITHOUT ROWID table or unreadable root page
+			continue
+		}
+		insert := fmt.Sprintf("INSERT OR IGNORE INTO recovered.%s SELECT * FROM main.%s WHERE rowid BETWEEN ? AND ?", table, table)
+		for start := int64(0); start <= maxRowID.Int64; start += dbSalvageBatch {
+			end := start + dbSalvageBatch - 1
+			if _, err := db.Exec(insert, start, end); err == nil {
+				continue
+			}
+			for id := start; id <= end; id++ {
+				db.Exec(insert, id, id)
+			}
+		}
+	}
+	return nil
+}
+
+// countTableRows returns the row count of each user table, -1 when unreadable
+func countTableRows(dbPath string) map[string]int64 {
+	counts := make(map[string]int64)
+	db, err := sql.Open("sqlite", dbPath+"?_busy_timeout=5000")
+	if err != nil {
+		return counts
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return counts
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			names = append(names, name)
+		}
+	}
+	rows.Close()
+	for _, name := range names {
+		var count int64
+		if err := db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s", quoteIdent(name))).Scan(&count); err != nil {
+			count = -1
+		}
+		counts[name] = count
+	}
+	return counts
+}
+
+// quarantineDatabase moves the database and its WAL/SHM files to quarantine/ and returns the new path
+func quarantineDatabase(dbPath string) (string, error) {
+	dir := filepath.Join(filepath.Dir(dbPath), dbQuarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	target := filepath.Join(dir, fmt.Sprintf("%s.%s.corrupt", filepath.Base(dbPath), time.Now().Format("20060102-150405")))
+	if err := os.Rename(dbPath, target); err != nil {
+		return "", fmt.Errorf("failed to quarantine database: %w", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + suffix); err == nil {
+			os.Rename(dbPath+suffix, target+suffix)
+		}
+	}
+	return target, nil
+}
+
+func removeDatabaseFiles(path string) {
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		os.Remove(path + suffix)
+	}
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
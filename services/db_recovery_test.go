@@ -0,0 +1,107 @@
+package services
+
+import (
+	"database/sql"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// createCorruptedDatabase writes a table spanning many pages and overwrites one page in the middle
+func createCorruptedDatabase(t *testing.T, dbPath string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE request_log (id INTEGER PRIMARY KEY, model TEXT, payload TEXT);
+		CREATE INDEX idx_request_log_model ON request_log(model);
+		CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	tx, _ := db.Begin()
+	for i := 0; i < 2000; i++ {
+		tx.Exec("INSERT INTO request_log (model, payload) VALUES (?, ?)", "claude", strings.Repeat("x", 200))
+	}
+	tx.Exec("INSERT INTO app_settings VALUES ('theme', 'dark')")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var pageSize int64
+	db.QueryRow("PRAGMA page_size").Scan(&pageSize)
+	db.Close()
+
+	f, err := os.OpenFile(dbPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	page := info.Size() / pageSize / 2
+	if _, err := f.WriteAt([]byte(strings.Repeat("\xff", int(pageSize))), page*pageSize); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckDatabaseIntegrity(t *testing.T) {
+	methods := map[string]string{"salvage": ""}
+	if _, err := exec.LookPath("sqlite3"); err == nil {
+		methods["sqlite3 .recover"] = "sqlite3"
+	}
+	for method, cli := range methods {
+		t.Run(method, func(t *testing.T) {
+			old := sqliteCLI
+			sqliteCLI = cli
+			defer func() { sqliteCLI = old }()
+
+			dir := t.TempDir()
+			dbPath := filepath.Join(dir, "app.db")
+			createCorruptedDatabase(t, dbPath)
+
+			report := CheckDatabaseIntegrity(dbPath)
+			// 部分 sqlite3 构建不支持 .recover，此时回退到逐行复制
+			if !report.Corrupted || !report.Repaired || (report.Method != method && report.Method != "salvage") || report.Error != "" {
+				t.Fatalf("unexpected report: %+v", report)
+			}
+			if _, err := os.Stat(report.QuarantinePath); err != nil || filepath.Dir(report.QuarantinePath) != filepath.Join(dir, dbQuarantineDir) {
+				t.Fatalf("expected corrupted file in quarantine, got %q (%v)", report.QuarantinePath, err)
+			}
+
+			// 修复后的数据库完整，未损坏的数据保留
+			if healthy := CheckDatabaseIntegrity(dbPath); healthy.Corrupted {
+				t.Fatalf("expected rebuilt database to pass quick_check: %+v", healthy)
+			}
+			db, _ := sql.Open("sqlite", dbPath)
+			defer db.Close()
+			var theme string
+			var logs int64
+			db.QueryRow("SELECT value FROM app_settings WHERE key = 'theme'").Scan(&theme)
+			db.QueryRow("SELECT count(*) FROM request_log").Scan(&logs)
+			if theme != "dark" || logs == 0 || logs >= 2000 {
+				t.Fatalf("expected partial request_log and intact settings, got theme=%q logs=%d", theme, logs)
+			}
+
+			// 报告通过 Recovery 读取
+			saved, err := NewConfigRecovery(nil, dir).GetDatabaseRepairReport()
+			if err != nil || saved == nil || saved.QuarantinePath != report.QuarantinePath {
+				t.Fatalf("expected saved report, got %+v (%v)", saved, err)
+			}
+			if report.LostRows() == 0 {
+				t.Fatalf("expected lost rows to be reported: %+v", report.Tables)
+			}
+		})
+	}
+
+	// 数据库不存在或完好时不生成报告
+	dir := t.TempDir()
+	if report := CheckDatabaseIntegrity(filepath.Join(dir, "app.db")); report.Corrupted {
+		t.Fatal("missing database must not be reported as corrupted")
+	}
+	if report, _ := NewConfigRecovery(nil, dir).GetDatabaseRepairReport(); report != nil {
+		t.Fatal("expected no repair report")
+	}
+}
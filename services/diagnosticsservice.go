@@ -0,0 +1,357 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 运行时诊断：可在设置中开启仅监听 127.0.0.1 的调试端口（net/http/pprof 与 expvar），
+// 并可一键生成诊断包（CPU / 堆 / goroutine profile、运行时统计、最近日志、去除密钥的配置摘要），
+// 保存在 ~/.code-switch/diagnostics/ 下，便于附在问题反馈中
+
+const (
+	// DefaultDebugServerPort 调试端口默认值
+	DefaultDebugServerPort = 6060
+	// diagnosticsCPUProfile 诊断包中 CPU profile 的采样时长
+	diagnosticsCPUProfile = 5 * time.Second
+	// maxDiagnosticsBundles 保留的诊断包数量
+	maxDiagnosticsBundles = 5
+	// diagnosticsSlowRequests 诊断包中附带的最慢请求数
+	diagnosticsSlowRequests = 20
+)
+
+// DebugServerStatus 调试端口状态
+type DebugServerStatus struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr,omitempty"` // 实际监听地址，如 127.0.0.1:6060
+}
+
+// RuntimeStats 运行时统计，调试端口的 /debug/vars 中以 codeswitch 字段输出
+type RuntimeStats struct {
+	Version      string                 `json:"version"`
+	GoVersion    string                 `json:"go_version"`
+	OS           string                 `json:"os"`
+	Arch         string                 `json:"arch"`
+	UptimeSec    int64                  `json:"uptime_sec"`
+	Goroutines   int                    `json:"goroutines"`
+	HeapAlloc    uint64                 `json:"heap_alloc"`
+	HeapInuse    uint64                 `json:"heap_inuse"`
+	HeapObjects  uint64                 `json:"heap_objects"`
+	Sys          uint64                 `json:"sys"`
+	NumGC        uint32                 `json:"num_gc"`
+	LastGCPause  float64                `json:"last_gc_pause_ms"`
+	GCCPUPercent float64                `json:"gc_cpu_percent"`
+	LogQueue     *LogQueueStats         `json:"log_queue,omitempty"`
+	Priority     []PriorityClassStats   `json:"priority,omitempty"`
+	DBPools      map[string]DBPoolStats `json:"db_pools,omitempty"`
+}
+
+// DiagnosticsService 调试端口与诊断包
+type DiagnosticsService struct {
+	version  string
+	relay    *ProviderRelayService
+	crash    *CrashReportService
+	settings *AppSettingsService
+	dir      string
+	started  time.Time
+
+	// cpuProfile 诊断包 CPU profile 时长，测试中缩短
+	cpuProfile time.Duration
+
+	mu     sync.Mutex
+	server *http.Server
+	addr   string
+}
+
+// activeDiagnostics expvar 输出使用的诊断服务（expvar 变量只能注册一次）
+var (
+	activeDiagnostics     atomic.Pointer[DiagnosticsService]
+	publishDiagnosticVars sync.Once
+)
+
+func NewDiagnosticsService(version string, relay *ProviderRelayService, crash *CrashReportService, settings *AppSettingsService) *DiagnosticsService {
+	home, _ := os.UserHomeDir()
+	ds := &DiagnosticsService{
+		version:    version,
+		relay:      relay,
+		crash:      crash,
+		settings:   settings,
+		dir:        filepath.Join(home, ".code-switch", "diagnostics"),
+		started:    time.Now(),
+		cpuProfile: diagnosticsCPUProfile,
+	}
+	activeDiagnostics.Store(ds)
+	publishDiagnosticVars.Do(func() {
+		expvar.Publish("codeswitch", expvar.Func(func() any {
+			if ds := activeDiagnostics.Load(); ds != nil {
+				return ds.GetRuntimeStats()
+			}
+			return nil
+		}))
+	})
+	return ds
+}
+
+// GetRuntimeStats 当前 goroutine、内存、GC 与日志队列统计
+func (ds *DiagnosticsService) GetRuntimeStats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := RuntimeStats{
+		Version:      ds.version,
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		UptimeSec:    int64(time.Since(ds.started).Seconds()),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapInuse:    mem.HeapInuse,
+		HeapObjects:  mem.HeapObjects,
+		Sys:          mem.Sys,
+		NumGC:        mem.NumGC,
+		GCCPUPercent: mem.GCCPUFraction * 100,
+	}
+	if mem.NumGC > 0 {
+		stats.LastGCPause = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
+	}
+	if ds.relay != nil {
+		queue := ds.relay.GetLogQueueStats()
+		stats.LogQueue = &queue
+		stats.Priority = ds.relay.GetPriorityStats()
+	}
+	stats.DBPools = dbPoolStats()
+	return stats
+}
+
+// GetDebugServerStatus 调试端口是否开启及监听地址
+func (ds *DiagnosticsService) GetDebugServerStatus() DebugServerStatus {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return DebugServerStatus{Enabled: ds.server != nil, Addr: ds.addr}
+}
+
+// SetDebugServerEnabled 开启 / 关闭调试端口并保存到设置
+func (ds *DiagnosticsService) SetDebugServerEnabled(enabled bool) (DebugServerStatus, error) {
+	port := DefaultDebugServerPort
+	if ds.settings != nil {
+		settings, err := ds.settings.GetAppSettings()
+		if err != nil {
+			return ds.GetDebugServerStatus(), err
+		}
+		if settings.DebugServerPort > 0 {
+			port = settings.DebugServerPort
+		}
+		if err := ds.ApplyDebugServer(enabled, port); err != nil {
+			return ds.GetDebugServerStatus(), err
+		}
+		settings.DebugServerEnabled = enabled
+		if _, err := ds.settings.SaveAppSettings(settings); err != nil {
+			return ds.GetDebugServerStatus(), err
+		}
+		return ds.GetDebugServerStatus(), nil
+	}
+	err := ds.ApplyDebugServer(enabled, port)
+	return ds.GetDebugServerStatus(), err
+}
+
+// ApplyDebugServer 按设置启动或停止调试端口，port 为 0 时使用默认端口；端口变化时重新监听
+func (ds *DiagnosticsService) ApplyDebugServer(enabled bool, port int) error {
+	if port <= 0 {
+		port = DefaultDebugServerPort
+	}
+	if port > 65535 {
+		return fmt.Errorf("invalid debug server port %d", port)
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	if ds.server != nil {
+		if enabled && ds.addr == addr {
+			return nil
+		}
+		_ = ds.server.Close()
+		ds.server, ds.addr = nil, ""
+	}
+	if !enabled {
+		return nil
+	}
+	return ds.listenLocked(addr)
+}
+
+func (ds *DiagnosticsService) listenLocked(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("debug server: %w", err)
+	}
+	ds.addr = listener.Addr().String()
+	ds.server = &http.Server{
+		Handler:           debugHostGuard(ds.addr, newDebugMux()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	server := ds.server
+	go func() {
+		defer RecoverPanic("debug server")
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("[Diagnostics] 调试端口异常退出: %v\n", err)
+		}
+	}()
+	fmt.Printf("[Diagnostics] 调试端口已开启: http://%s/debug/pprof/\n", ds.addr)
+	return nil
+}
+
+func newDebugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// debugHostGuard 只接受以本机地址访问的请求，防止网页通过 DNS rebinding 读取调试端口
+func debugHostGuard(addr string, next http.Handler) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, reqPort, err := net.SplitHostPort(r.Host)
+		if err != nil || reqPort != port || (host != "127.0.0.1" && host != "localhost") {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CaptureDiagnosticsBundle 生成诊断包并返回 zip 文件路径；CPU profile 采样期间会阻塞数秒
+func (ds *DiagnosticsService) CaptureDiagnosticsBundle() (string, error) {
+	if err := os.MkdirAll(ds.dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(ds.dir, "diagnostics-"+time.Now().Format("20060102-150405")+".zip")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	zw := zip.NewWriter(file)
+	writeErr := ds.writeBundle(zw)
+	if err := zw.Close(); writeErr == nil {
+		writeErr = err
+	}
+	if err := file.Close(); writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		_ = os.Remove(path)
+		return "", writeErr
+	}
+	ds.pruneBundles()
+	return path, nil
+}
+
+func (ds *DiagnosticsService) writeBundle(zw *zip.Writer) error {
+	var notes []string
+	add := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	addJSON := func(name string, value any) error {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, data)
+	}
+
+	// CPU profile 同一时间只能有一个，调试端口正在采样时跳过
+	var cpu bytes.Buffer
+	if err := runtimepprof.StartCPUProfile(&cpu); err != nil {
+		notes = append(notes, "cpu profile skipped: "+err.Error())
+	} else {
+		time.Sleep(ds.cpuProfile)
+		runtimepprof.StopCPUProfile()
+		if err := add("cpu.pprof", cpu.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, profile := range []struct {
+		name, file string
+		debug      int
+	}{
+		{"heap", "heap.pprof", 0},
+		{"allocs", "allocs.pprof", 0},
+		{"goroutine", "goroutines.txt", 2},
+		{"block", "block.pprof", 0},
+		{"mutex", "mutex.pprof", 0},
+	} {
+		var buf bytes.Buffer
+		if p := runtimepprof.Lookup(profile.name); p != nil {
+			if err := p.WriteTo(&buf, profile.debug); err != nil {
+				notes = append(notes, profile.name+" profile failed: "+err.Error())
+				continue
+			}
+		}
+		if err := add(profile.file, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := addJSON("runtime.json", ds.GetRuntimeStats()); err != nil {
+		return err
+	}
+	if ds.relay != nil {
+		if err := addJSON("relay-status.json", ds.relay.GetRelayStatus()); err != nil {
+			return err
+		}
+	}
+	if err := addJSON("config.json", crashConfigSummary()); err != nil {
+		return err
+	}
+	if slow, err := querySlowRequests(diagnosticsSlowRequests); err == nil {
+		if err := addJSON("slow-requests.json", slow); err != nil {
+			return err
+		}
+	}
+	if ds.crash != nil {
+		if err := add("logs.txt", []byte(strings.Join(ds.crash.logs.tail(), "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	if len(notes) > 0 {
+		return add("NOTES.txt", []byte(strings.Join(notes, "\n")+"\n"))
+	}
+	return nil
+}
+
+// pruneBundles 只保留最近的诊断包
+func (ds *DiagnosticsService) pruneBundles() {
+	matches, err := filepath.Glob(filepath.Join(ds.dir, "diagnostics-*.zip"))
+	if err != nil || len(matches) <= maxDiagnosticsBundles {
+		return
+	}
+	sort.Strings(matches)
+	for _, old := range matches[:len(matches)-maxDiagnosticsBundles] {
+		_ = os.Remove(old)
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugServer(t *testing.T) {
+	ds := NewDiagnosticsService("test", &ProviderRelayService{}, nil, nil)
+	ds.mu.Lock()
+	err := ds.listenLocked("127.0.0.1:0")
+	ds.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.ApplyDebugServer(false, 0)
+
+	status := ds.GetDebugServerStatus()
+	if !status.Enabled || !strings.HasPrefix(status.Addr, "127.0.0.1:") {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	resp, err := http.Get("http://" + status.Addr + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vars struct {
+		Codeswitch RuntimeStats `json:"codeswitch"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&vars)
+	resp.Body.Close()
+	if err != nil || vars.Codeswitch.Goroutines == 0 || vars.Codeswitch.LogQueue == nil {
+		t.Fatalf("expected runtime stats in expvar output, got %+v (%v)", vars.Codeswitch, err)
+	}
+
+	// 非本机 Host 头的请求（DNS rebinding）被拒绝
+	req, _ := http.NewRequest(http.MethodGet, "http://"+status.Addr+"/debug/pprof/", nil)
+	req.Host = "attacker.example.com"
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected foreign host to be rejected, got %d", resp.StatusCode)
+	}
+
+	if err := ds.ApplyDebugServer(false, 0); err != nil || ds.GetDebugServerStatus().Enabled {
+		t.Fatalf("expected debug server to stop, err = %v", err)
+	}
+	if _, err := http.Get("http://" + status.Addr + "/debug/vars"); err == nil {
+		t.Fatal("debug port should be closed")
+	}
+}
+
+func TestCaptureDiagnosticsBundle(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	crash := NewCrashReportService("test")
+	_, _ = crash.logs.Write([]byte("[Relay] upstream failed with token=sk-abcdefghijklmnop\n"))
+	ds := NewDiagnosticsService("test", &ProviderRelayService{startTime: time.Now()}, crash, nil)
+	ds.cpuProfile = 10 * time.Millisecond
+
+	path, err := ds.CaptureDiagnosticsBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	files := map[string]string{}
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	for _, name := range []string{"heap.pprof", "goroutines.txt", "runtime.json", "config.json", "slow-requests.json", "logs.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+	if _, ok := files["cpu.pprof"]; !ok && files["NOTES.txt"] == "" {
+		t.Error("expected a cpu profile or a note explaining why it was skipped")
+	}
+	if !strings.Contains(files["goroutines.txt"], "goroutine") {
+		t.Error("expected goroutine dump")
+	}
+	if logs := files["logs.txt"]; !strings.Contains(logs, "upstream failed") || strings.Contains(logs, "abcdefghijklmnop") {
+		t.Fatalf("expected redacted recent logs, got %q", logs)
+	}
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 自检结果状态
+const (
+	DoctorOK   = "ok"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+	DoctorSkip = "skip"
+)
+
+const (
+	// doctorProbeTimeout 单个 provider 可达性探测超时
+	doctorProbeTimeout = 5 * time.Second
+	// doctorProbeConcurrency 同时探测的 provider 数
+	doctorProbeConcurrency = 8
+	// 日志所在磁盘的剩余空间阈值
+	doctorDiskWarnBytes = 1 << 30
+	doctorDiskFailBytes = 200 << 20
+	// 本机时钟与上游 Date 头的偏差阈值
+	doctorClockWarnSkew = time.Minute
+	doctorClockFailSkew = 5 * time.Minute
+)
+
+// DoctorCheck 单项自检结果，Fix 为可直接执行的修复建议
+type DoctorCheck struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Fix     string   `json:"fix,omitempty"`
+	Details []string `json:"details,omitempty"`
+}
+
+// DoctorReport 环境自检报告，Status 为所有检查项中最严重的状态
+type DoctorReport struct {
+	Status      string        `json:"status"`
+	GeneratedAt string        `json:"generated_at"`
+	Checks      []DoctorCheck `json:"checks"`
+}
+
+// doctorProbe provider 可达性探测结果
+type doctorProbe struct {
+	label   string
+	err     error
+	latency time.Duration
+	date    time.Time
+}
+
+// Doctor 运行启动自检：端口、数据库、配置文件、CLI 客户端配置、provider 可达性、磁盘空间与时钟偏差
+func (prs *ProviderRelayService) Doctor() DoctorReport {
+	probes := prs.probeProviders()
+	checks := []DoctorCheck{
+		prs.doctorPort(),
+		doctorDatabase(),
+		prs.doctorConfigFiles(),
+		prs.doctorCLIConfigs(),
+		doctorProviders(probes),
+		doctorDiskSpace(),
+		doctorClockSkew(probes),
+	}
+
+	report := DoctorReport{Status: DoctorOK, GeneratedAt: time.Now().Format(time.RFC3339), Checks: checks}
+	for _, check := range checks {
+		if check.Status == DoctorFail || (check.Status == DoctorWarn && report.Status == DoctorOK) {
+			report.Status = check.Status
+		}
+	}
+	return report
+}
+
+// doctorPort 转发服务运行中视为端口正常，否则尝试监听判断端口是否被占用
+func (prs *ProviderRelayService) doctorPort() DoctorCheck {
+	check := DoctorCheck{Name: "port", Status: DoctorOK}
+	if atomic.LoadUint32(&prs.status.running) == 1 {
+		check.Message = fmt.Sprintf("relay is listening on %s", prs.addr)
+		return check
+	}
+	ln, err := net.Listen("tcp", prs.addr)
+	if err != nil {
+		check.Status = DoctorFail
+		check.Message = fmt.Sprintf("%s is not available: %v", prs.addr, err)
+		check.Fix = fmt.Sprintf("stop the process using port %s (e.g. `lsof -i :%s` / `netstat -ano`) or choose another port", relayPort(prs.addr), relayPort(prs.addr))
+		return check
+	}
+	ln.Close()
+	check.Message = fmt.Sprintf("%s is free", prs.addr)
+	return check
+}
+
+func relayPort(addr string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		return port
+	}
+	return strings.TrimPrefix(addr, ":")
+}
+
+// doctorDatabase 对 SQLite 执行 PRAGMA quick_check
+func doctorDatabase() DoctorCheck {
+	check := DoctorCheck{Name: "database", Status: DoctorOK}
+	db, err := xdb.DB("default")
+	if err != nil || db == nil {
+		check.Status = DoctorFail
+		check.Message = "database not initialized"
+		check.Fix = "check that ~/.code-switch is writable and restart"
+		return check
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, "PRAGMA quick_check")
+	if err != nil {
+		check.Status = DoctorFail
+		check.Message = fmt.Sprintf("quick_check failed: %v", err)
+		check.Fix = "close other processes using ~/.code-switch/app.db and retry"
+		return check
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err == nil && line != "ok" {
+			check.Details = append(check.Details, line)
+		}
+	}
+	if len(check.Details) > 0 {
+		check.Status = DoctorFail
+		check.Message = fmt.Sprintf("integrity check reported %d problem(s)", len(check.Details))
+		check.Fix = "quit the app, back up ~/.code-switch/app.db and recover it with `sqlite3 app.db .recover | sqlite3 app-recovered.db`"
+		return check
+	}
+	check.Message = "integrity check passed"
+	return check
+}
+
+// doctorConfigFiles 检查 ~/.code-switch 下的 JSON 配置文件能否解析，以及启用的 provider 配置是否完整
+func (prs *ProviderRelayService) doctorConfigFiles() DoctorCheck {
+	check := DoctorCheck{Name: "config", Status: DoctorOK}
+	home, _ := os.UserHomeDir()
+	files, _ := filepath.Glob(filepath.Join(home, ".code-switch", "*.json"))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			check.Details = append(check.Details, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+			continue
+		}
+		if len(strings.TrimSpace(string(data))) > 0 && !json.Valid(data) {
+			check.Details = append(check.Details, fmt.Sprintf("%s: invalid JSON", filepath.Base(path)))
+		}
+	}
+	if len(check.Details) > 0 {
+		check.Status = DoctorFail
+		check.Message = fmt.Sprintf("%d config file(s) cannot be parsed", len(check.Details))
+		check.Fix = "fix or delete the listed files in ~/.code-switch (restore from Settings > Backups if available)"
+		return check
+	}
+
+	if warnings := prs.validateConfig(); len(warnings) > 0 {
+		check.Status = DoctorWarn
+		check.Message = fmt.Sprintf("%d config file(s) valid, %d provider warning(s)", len(files), len(warnings))
+		check.Details = warnings
+		check.Fix = "review the listed providers in the provider settings"
+		return check
+	}
+	check.Message = fmt.Sprintf("%d config file(s) valid", len(files))
+	return check
+}
+
+// doctorCLIConfigs 检查已安装的 CLI 客户端是否指向本转发服务
+func (prs *ProviderRelayService) doctorCLIConfigs() DoctorCheck {
+	check := DoctorCheck{Name: "cli_clients", Status: DoctorOK}
+	clients := []struct {
+		name   string
+		dir    string
+		status func() (ClaudeProxyStatus, error)
+	}{
+		{"Claude Code", claudeSettingsDir, NewClaudeSettingsService(prs.addr).ProxyStatus},
+		{"Codex", codexSettingsDir, NewCodexSettingsService(prs.addr).ProxyStatus},
+		{"PicoClaw", picoClawSettingsDir, NewPicoClawSettingsService(prs.addr).ProxyStatus},
+	}
+
+	home, _ := os.UserHomeDir()
+	var enabled, notRouted []string
+	for _, client := range clients {
+		if _, err := os.Stat(filepath.Join(home, client.dir)); err != nil {
+			continue
+		}
+		status, err := client.status()
+		switch {
+		case err != nil:
+			notRouted = append(notRouted, fmt.Sprintf("%s: %v", client.name, err))
+		case status.Enabled:
+			enabled = append(enabled, client.name)
+		default:
+			notRouted = append(notRouted, fmt.Sprintf("%s does not point at %s", client.name, status.BaseURL))
+		}
+	}
+
+	switch {
+	case len(notRouted) > 0:
+		check.Status = DoctorWarn
+		check.Message = fmt.Sprintf("%d of %d installed client(s) bypass the relay", len(notRouted), len(enabled)+len(notRouted))
+		check.Details = notRouted
+		check.Fix = "enable the proxy for these clients in the CLI center (their original config is backed up)"
+	case len(enabled) == 0:
+		check.Status = DoctorSkip
+		check.Message = "no CLI client config found"
+	default:
+		check.Message = "routed through the relay: " + strings.Join(enabled, ", ")
+	}
+	return check
+}
+
+// probeProviders 并发探测所有启用 provider 的 API 地址，任何 HTTP 响应都视为可达
+func (prs *ProviderRelayService) probeProviders() []doctorProbe {
+	type target struct{ label, url string }
+	var targets []target
+	seen := make(map[string]bool)
+	for _, kind := range adminPlatforms {
+		providers, err := prs.providerService.LoadProviders(kind)
+		if err != nil {
+			continue
+		}
+		for _, p := range providers {
+			if !p.Enabled || p.Suspended || p.APIURL == "" || seen[kind+"/"+p.Name] {
+				continue
+			}
+			seen[kind+"/"+p.Name] = true
+			targets = append(targets, target{label: kind + "/" + p.Name, url: strings.TrimSuffix(p.APIURL, "/") + "/"})
+		}
+	}
+
+	client := &http.Client{Timeout: doctorProbeTimeout}
+	probes := make([]doctorProbe, len(targets))
+	sem := make(chan struct{}, doctorProbeConcurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			probe := doctorProbe{label: t.label}
+			start := time.Now()
+			resp, err := client.Get(t.url)
+			probe.latency = time.Since(start)
+			if err != nil {
+				probe.err = err
+			} else {
+				resp.Body.Close()
+				if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+					// 以请求中点估算服务端时间
+					probe.date = date.Add(-probe.latency / 2)
+				}
+			}
+			probes[i] = probe
+		}(i, t)
+	}
+	wg.Wait()
+	return probes
+}
+
+func doctorProviders(probes []doctorProbe) DoctorCheck {
+	check := DoctorCheck{Name: "providers", Status: DoctorOK}
+	if len(probes) == 0 {
+		check.Status = DoctorFail
+		check.Message = "no enabled provider"
+		check.Fix = "add and enable at least one provider"
+		return check
+	}
+	reachable := 0
+	for _, probe := range probes {
+		if probe.err != nil {
+			check.Details = append(check.Details, fmt.Sprintf("%s: %v", probe.label, probe.err))
+			continue
+		}
+		reachable++
+	}
+	check.Message = fmt.Sprintf("%d of %d provider(s) reachable", reachable, len(probes))
+	switch {
+	case reachable == 0:
+		check.Status = DoctorFail
+		check.Fix = "check network / proxy settings (HTTPS_PROXY) and the provider API URLs"
+	case reachable < len(probes):
+		check.Status = DoctorWarn
+		check.Fix = "check the API URL of the unreachable providers or disable them"
+	}
+	return check
+}
+
+// doctorDiskSpace 检查日志与数据库所在磁盘的剩余空间
+func doctorDiskSpace() DoctorCheck {
+	check := DoctorCheck{Name: "disk", Status: DoctorOK}
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".code-switch")
+	if _, err := os.Stat(dir); err != nil {
+		dir = home
+	}
+	free, err := diskFreeBytes(dir)
+	if err != nil {
+		check.Status = DoctorSkip
+		check.Message = fmt.Sprintf("cannot read free space: %v", err)
+		return check
+	}
+	check.Message = fmt.Sprintf("%.1f GB free for logs in %s", float64(free)/(1<<30), dir)
+	switch {
+	case free < doctorDiskFailBytes:
+		check.Status = DoctorFail
+		check.Fix = "free disk space or clean up old request logs (Logs > Cleanup)"
+	case free < doctorDiskWarnBytes:
+		check.Status = DoctorWarn
+		check.Fix = "consider cleaning up old request logs or disabling body logging"
+	}
+	return check
+}
+
+// doctorClockSkew 以上游响应的 Date 头估算本机时钟偏差（取中位数）
+func doctorClockSkew(probes []doctorProbe) DoctorCheck {
+	check := DoctorCheck{Name: "clock", Status: DoctorOK}
+	var skews []time.Duration
+	now := time.Now()
+	for _, probe := range probes {
+		if !probe.date.IsZero() {
+			skews = append(skews, now.Sub(probe.date))
+		}
+	}
+	if len(skews) == 0 {
+		check.Status = DoctorSkip
+		check.Message = "no upstream Date header to compare with"
+		return check
+	}
+	sort.Slice(skews, func(i, j int) bool { return skews[i] < skews[j] })
+	skew := skews[len(skews)/2]
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	// Date 头精度为秒
+	check.Message = fmt.Sprintf("local clock differs from upstream by %s", skew.Round(time.Second))
+	switch {
+	case abs >= doctorClockFailSkew:
+		check.Status = DoctorFail
+		check.Fix = "enable automatic time sync; a wrong clock breaks TLS and OAuth token refresh"
+	case abs >= doctorClockWarnSkew:
+		check.Status = DoctorWarn
+		check.Fix = "enable automatic time sync (NTP)"
+	}
+	return check
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDoctor(t *testing.T) {
+	openTestRelayDB(t, "doctor.db")
+	home := os.Getenv("HOME")
+
+	// 上游时钟比本机快 10 分钟
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(10*time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	os.MkdirAll(filepath.Join(home, ".code-switch"), 0755)
+	os.WriteFile(filepath.Join(home, ".code-switch", "app.json"), []byte(`{"enable_body_log": true`), 0644)
+	os.MkdirAll(filepath.Join(home, ".claude"), 0755)
+
+	// 端口已被占用
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	providerService := NewProviderService()
+	providerService.UseStaticProviders(map[string][]Provider{
+		"claude": {
+			{Name: "up", APIURL: upstream.URL, APIKey: "k", Enabled: true, SupportedModels: map[string]bool{"m": true}},
+			{Name: "down", APIURL: "http://127.0.0.1:1", APIKey: "k", Enabled: true, SupportedModels: map[string]bool{"m": true}},
+			{Name: "off", APIURL: "http://127.0.0.1:1", Enabled: false},
+		},
+	})
+	prs := &ProviderRelayService{providerService: providerService, addr: ln.Addr().String()}
+
+	report := prs.Doctor()
+	checks := make(map[string]DoctorCheck)
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+	want := map[string]string{
+		"port":        DoctorFail,
+		"database":    DoctorOK,
+		"config":      DoctorFail,
+		"cli_clients": DoctorWarn,
+		"providers":   DoctorWarn,
+		"disk":        checks["disk"].Status,
+		"clock":       DoctorFail,
+	}
+	for name, status := range want {
+		if checks[name].Status != status {
+			t.Errorf("%s: expected %s, got %+v", name, status, checks[name])
+		}
+	}
+	if report.Status != DoctorFail {
+		t.Fatalf("expected overall fail, got %s", report.Status)
+	}
+	if len(checks["providers"].Details) != 1 || checks["providers"].Message != "1 of 2 provider(s) reachable" {
+		t.Fatalf("unexpected provider check: %+v", checks["providers"])
+	}
+	for name, check := range checks {
+		if check.Status == DoctorFail && check.Fix == "" {
+			t.Errorf("%s: failed check must include a fix", name)
+		}
+	}
+
+	// 修复后端口可用、配置文件可以解析
+	ln.Close()
+	os.WriteFile(filepath.Join(home, ".code-switch", "app.json"), []byte(`{"enable_body_log": true}`), 0644)
+	if check := prs.doctorPort(); check.Status != DoctorOK {
+		t.Fatalf("expected free port, got %+v", check)
+	}
+	// 其余平台没有启用的 provider 仅给出警告
+	if check := prs.doctorConfigFiles(); check.Status != DoctorWarn || len(check.Details) != 3 {
+		t.Fatalf("expected valid config with provider warnings, got %+v", check)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package services
+
+import "syscall"
+
+// diskFreeBytes 当前用户可用的磁盘剩余空间
+func diskFreeBytes(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
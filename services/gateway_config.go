@@ -0,0 +1,207 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 独立网关（cmd/gateway）的声明式配置：从 providers.yaml / providers.json 加载 provider，
+// 便于容器部署；密钥等敏感值可通过 ${ENV} 引用环境变量
+
+// GatewayConfig 声明式网关配置
+type GatewayConfig struct {
+	Providers map[string][]Provider `json:"providers"`
+}
+
+// envRefPattern 匹配 ${VAR} 与 ${VAR:-default}
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// readOnlyMode 只读模式：不在用户目录创建或修改任何文件（数据库改用内存库）
+var readOnlyMode atomic.Bool
+
+// SetReadOnlyMode 开启 / 关闭只读模式，需在创建 ProviderRelayService 之前调用
+func SetReadOnlyMode(enabled bool) {
+	readOnlyMode.Store(enabled)
+}
+
+// IsReadOnlyMode 是否处于只读模式
+func IsReadOnlyMode() bool {
+	return readOnlyMode.Load()
+}
+
+// normalizeProviderKind 统一平台别名，未知平台返回空字符串
+func normalizeProviderKind(kind string) string {
+	switch strings.ToLower(kind) {
+	case "claude", "claude-code", "claude_code":
+		return "claude"
+	case "codex":
+		return "codex"
+	case "gemini-cli", "gemini_cli", "gemini":
+		return "gemini-cli"
+	case "picoclaw", "pico-claw", "pico_claw":
+		return "picoclaw"
+	}
+	return ""
+}
+
+// LoadGatewayConfig 读取并解析配置文件（按扩展名识别 YAML / JSON），展开环境变量引用
+func LoadGatewayConfig(path string) (*GatewayConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+
+	missing := make(map[string]bool)
+	raw = expandEnvRefs(raw, missing)
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("配置引用了未设置的环境变量: %s", strings.Join(names, ", "))
+	}
+	return parseGatewayConfig(raw)
+}
+
+// expandEnvRefs 递归展开字符串值中的 ${VAR}，只处理值不处理键，避免密钥中的特殊字符破坏 YAML 结构
+func expandEnvRefs(value interface{}, missing map[string]bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		return envRefPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			m := envRefPattern.FindStringSubmatch(ref)
+			if val, ok := os.LookupEnv(m[1]); ok && val != "" {
+				return val
+			}
+			if m[2] != "" {
+				return m[3]
+			}
+			missing[m[1]] = true
+			return ""
+		})
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = expandEnvRefs(item, missing)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandEnvRefs(item, missing)
+		}
+	}
+	return value
+}
+
+// parseGatewayConfig 将通用结构转为 GatewayConfig（字段名与 provider JSON 文件一致）
+func parseGatewayConfig(raw interface{}) (*GatewayConfig, error) {
+	root, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("配置根节点必须是对象")
+	}
+	platforms, _ := root["providers"].(map[string]interface{})
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("配置中没有 providers")
+	}
+
+	cfg := &GatewayConfig{Providers: make(map[string][]Provider)}
+	for key, list := range platforms {
+		kind := normalizeProviderKind(key)
+		if kind == "" {
+			return nil, fmt.Errorf("未知平台: %s", key)
+		}
+		items, ok := list.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("平台 %s 的 providers 必须是数组", key)
+		}
+		seen := make(map[string]bool)
+		for i, item := range items {
+			fields, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s[%d] 必须是对象", key, i)
+			}
+			// 声明式配置中未写 enabled 的 provider 默认启用
+			if _, ok := fields["enabled"]; !ok {
+				fields["enabled"] = true
+			}
+			data, err := json.Marshal(fields)
+			if err != nil {
+				return nil, err
+			}
+			var provider Provider
+			if err := json.Unmarshal(data, &provider); err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", key, i, err)
+			}
+			provider.Name = strings.TrimSpace(provider.Name)
+			if provider.Name == "" {
+				return nil, fmt.Errorf("%s[%d] 缺少 name", key, i)
+			}
+			if seen[provider.Name] {
+				return nil, fmt.Errorf("%s 中 provider 名称重复: %s", key, provider.Name)
+			}
+			seen[provider.Name] = true
+			if provider.ID == 0 {
+				provider.ID = i + 1
+			}
+			if errs := provider.ValidateConfiguration(); len(errs) > 0 {
+				return nil, fmt.Errorf("[%s/%s] %s", kind, provider.Name, strings.Join(errs, "; "))
+			}
+			if issues := schemaErrors(provider.modelSchemaIssues(fmt.Sprintf("%s[%d]", key, i))); len(issues) > 0 {
+				return nil, fmt.Errorf("[%s/%s] %s", kind, provider.Name, issues[0])
+			}
+			cfg.Providers[kind] = append(cfg.Providers[kind], provider)
+		}
+	}
+	return cfg, nil
+}
+
+// UseStaticProviders 切换为内存中的 provider 列表（声明式配置），之后不再读写 ~/.code-switch 下的 provider 文件；
+// 运行时的修改（挂起、管理 API 编辑等）只保存在内存中，重新加载配置后丢弃
+func (ps *ProviderService) UseStaticProviders(providers map[string][]Provider) {
+	static := make(map[string][]Provider, len(providers))
+	for kind, list := range providers {
+		if kind = normalizeProviderKind(kind); kind != "" {
+			static[kind] = append([]Provider(nil), list...)
+		}
+	}
+	ps.staticMu.Lock()
+	ps.static = static
+	ps.staticMu.Unlock()
+}
+
+// staticProviders 声明式配置模式下返回内存中的列表副本
+func (ps *ProviderService) staticProviders(kind string) ([]Provider, bool) {
+	ps.staticMu.RLock()
+	defer ps.staticMu.RUnlock()
+	if ps.static == nil {
+		return nil, false
+	}
+	return append([]Provider(nil), ps.static[normalizeProviderKind(kind)]...), true
+}
+
+// saveStaticProviders 声明式配置模式下只更新内存
+func (ps *ProviderService) saveStaticProviders(kind string, providers []Provider) bool {
+	ps.staticMu.Lock()
+	defer ps.staticMu.Unlock()
+	if ps.static == nil {
+		return false
+	}
+	ps.static[normalizeProviderKind(kind)] = append([]Provider(nil), providers...)
+	return true
+}
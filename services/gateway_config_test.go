@@ -0,0 +1,92 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeGatewayConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadGatewayConfigYAMLWithEnv(t *testing.T) {
+	t.Setenv("GW_TEST_KEY", "sk-from-env: #not-a-comment")
+	path := writeGatewayConfig(t, "providers.yaml", `
+providers:
+  claude-code:
+    - name: primary
+      apiUrl: https://api.anthropic.com
+      apiKey: ${GW_TEST_KEY}
+    - name: backup
+      apiUrl: ${GW_TEST_UNSET_URL:-https://backup.example.com}
+      apiKey: fixed
+      enabled: false
+      level: 2
+`)
+	cfg, err := LoadGatewayConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := cfg.Providers["claude"]
+	if len(providers) != 2 {
+		t.Fatalf("expected 2 claude providers, got %+v", cfg.Providers)
+	}
+	if providers[0].APIKey != "sk-from-env: #not-a-comment" || !providers[0].Enabled || providers[0].ID != 1 {
+		t.Fatalf("unexpected primary %+v", providers[0])
+	}
+	if providers[1].APIURL != "https://backup.example.com" || providers[1].Enabled || providers[1].Level != 2 {
+		t.Fatalf("unexpected backup %+v", providers[1])
+	}
+}
+
+func TestLoadGatewayConfigErrors(t *testing.T) {
+	cases := map[string]string{
+		"missing env":    `{"providers":{"codex":[{"name":"a","apiUrl":"https://x","apiKey":"${GW_TEST_MISSING}"}]}}`,
+		"unknown kind":   `{"providers":{"cursor":[{"name":"a"}]}}`,
+		"duplicate name": `{"providers":{"codex":[{"name":"a"},{"name":"a"}]}}`,
+		"no providers":   `{}`,
+	}
+	for name, content := range cases {
+		if _, err := LoadGatewayConfig(writeGatewayConfig(t, "providers.json", content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	_, err := LoadGatewayConfig(writeGatewayConfig(t, "providers.json", cases["missing env"]))
+	if err == nil || !strings.Contains(err.Error(), "GW_TEST_MISSING") {
+		t.Fatalf("error should name the missing variable, got %v", err)
+	}
+}
+
+func TestStaticProvidersStayInMemory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	ps := NewProviderService()
+	ps.UseStaticProviders(map[string][]Provider{
+		"claude": {{ID: 1, Name: "primary", APIURL: "https://api.anthropic.com", APIKey: "sk", Enabled: true}},
+	})
+	providers, err := ps.LoadProviders("claude_code")
+	if err != nil || len(providers) != 1 {
+		t.Fatalf("unexpected providers %+v (%v)", providers, err)
+	}
+	providers[0].Suspended = true
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, _ := ps.LoadProviders("claude"); !reloaded[0].Suspended {
+		t.Fatal("runtime change should be kept in memory")
+	}
+	if codex, err := ps.LoadProviders("codex"); err != nil || len(codex) != 0 {
+		t.Fatalf("unconfigured platform should be empty, got %+v (%v)", codex, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".code-switch")); !os.IsNotExist(err) {
+		t.Fatalf("static providers must not touch the home directory (stat err: %v)", err)
+	}
+}
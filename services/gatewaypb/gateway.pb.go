@@ -0,0 +1,1562 @@
+// 网关的 gRPC 管理 / 流式接口，与 HTTP 管理 API（/admin/api）共用管理令牌
+//
+// 修改后重新生成：
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative gateway.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: gateway.proto
+
+package gatewaypb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetMetricsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// today（默认）、week、month、all
+	Period        string `protobuf:"bytes,1,opt,name=period,proto3" json:"period,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsRequest) Reset() {
+	*x = GetMetricsRequest{}
+	mi := &file_gateway_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsRequest) ProtoMessage() {}
+
+func (x *GetMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsRequest.ProtoReflect.Descriptor instead.
+func (*GetMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetMetricsRequest) GetPeriod() string {
+	if x != nil {
+		return x.Period
+	}
+	return ""
+}
+
+type MetricsSnapshot struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Period            string                 `protobuf:"bytes,1,opt,name=period,proto3" json:"period,omitempty"`
+	Version           string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	UptimeSec         int64                  `protobuf:"varint,3,opt,name=uptime_sec,json=uptimeSec,proto3" json:"uptime_sec,omitempty"`
+	TotalRequests     int64                  `protobuf:"varint,4,opt,name=total_requests,json=totalRequests,proto3" json:"total_requests,omitempty"`
+	TotalTokens       int64                  `protobuf:"varint,5,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	TotalInputTokens  int64                  `protobuf:"varint,6,opt,name=total_input_tokens,json=totalInputTokens,proto3" json:"total_input_tokens,omitempty"`
+	TotalOutputTokens int64                  `protobuf:"varint,7,opt,name=total_output_tokens,json=totalOutputTokens,proto3" json:"total_output_tokens,omitempty"`
+	TotalCost         float64                `protobuf:"fixed64,8,opt,name=total_cost,json=totalCost,proto3" json:"total_cost,omitempty"`
+	SuccessRate       float64                `protobuf:"fixed64,9,opt,name=success_rate,json=successRate,proto3" json:"success_rate,omitempty"`
+	AvgDurationSec    float64                `protobuf:"fixed64,10,opt,name=avg_duration_sec,json=avgDurationSec,proto3" json:"avg_duration_sec,omitempty"`
+	ByPlatform        map[string]int64       `protobuf:"bytes,11,rep,name=by_platform,json=byPlatform,proto3" json:"by_platform,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	ByModel           map[string]int64       `protobuf:"bytes,12,rep,name=by_model,json=byModel,proto3" json:"by_model,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	ByProvider        map[string]int64       `protobuf:"bytes,13,rep,name=by_provider,json=byProvider,proto3" json:"by_provider,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *MetricsSnapshot) Reset() {
+	*x = MetricsSnapshot{}
+	mi := &file_gateway_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsSnapshot) ProtoMessage() {}
+
+func (x *MetricsSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsSnapshot.ProtoReflect.Descriptor instead.
+func (*MetricsSnapshot) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MetricsSnapshot) GetPeriod() string {
+	if x != nil {
+		return x.Period
+	}
+	return ""
+}
+
+func (x *MetricsSnapshot) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *MetricsSnapshot) GetUptimeSec() int64 {
+	if x != nil {
+		return x.UptimeSec
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetTotalRequests() int64 {
+	if x != nil {
+		return x.TotalRequests
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetTotalTokens() int64 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetTotalInputTokens() int64 {
+	if x != nil {
+		return x.TotalInputTokens
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetTotalOutputTokens() int64 {
+	if x != nil {
+		return x.TotalOutputTokens
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetTotalCost() float64 {
+	if x != nil {
+		return x.TotalCost
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetSuccessRate() float64 {
+	if x != nil {
+		return x.SuccessRate
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetAvgDurationSec() float64 {
+	if x != nil {
+		return x.AvgDurationSec
+	}
+	return 0
+}
+
+func (x *MetricsSnapshot) GetByPlatform() map[string]int64 {
+	if x != nil {
+		return x.ByPlatform
+	}
+	return nil
+}
+
+func (x *MetricsSnapshot) GetByModel() map[string]int64 {
+	if x != nil {
+		return x.ByModel
+	}
+	return nil
+}
+
+func (x *MetricsSnapshot) GetByProvider() map[string]int64 {
+	if x != nil {
+		return x.ByProvider
+	}
+	return nil
+}
+
+type Provider struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Platform string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Id       int32                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	Name     string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	ApiUrl   string                 `protobuf:"bytes,4,opt,name=api_url,json=apiUrl,proto3" json:"api_url,omitempty"`
+	// 响应中为掩码
+	ApiKey  string `protobuf:"bytes,5,opt,name=api_key,json=apiKey,proto3" json:"api_key,omitempty"`
+	Enabled bool   `protobuf:"varint,6,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	// 优先级分组，数字越小优先级越高
+	Level           int32             `protobuf:"varint,7,opt,name=level,proto3" json:"level,omitempty"`
+	ProviderType    string            `protobuf:"bytes,8,opt,name=provider_type,json=providerType,proto3" json:"provider_type,omitempty"`
+	AuthType        string            `protobuf:"bytes,9,opt,name=auth_type,json=authType,proto3" json:"auth_type,omitempty"`
+	FallbackOnly    bool              `protobuf:"varint,10,opt,name=fallback_only,json=fallbackOnly,proto3" json:"fallback_only,omitempty"`
+	SupportedModels []string          `protobuf:"bytes,11,rep,name=supported_models,json=supportedModels,proto3" json:"supported_models,omitempty"`
+	ModelMapping    map[string]string `protobuf:"bytes,12,rep,name=model_mapping,json=modelMapping,proto3" json:"model_mapping,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// 以下为运行时状态，写入时忽略
+	Suspended       bool   `protobuf:"varint,13,opt,name=suspended,proto3" json:"suspended,omitempty"`
+	SuspendedReason string `protobuf:"bytes,14,opt,name=suspended_reason,json=suspendedReason,proto3" json:"suspended_reason,omitempty"`
+	Ready           bool   `protobuf:"varint,15,opt,name=ready,proto3" json:"ready,omitempty"`
+	CooldownMs      int64  `protobuf:"varint,16,opt,name=cooldown_ms,json=cooldownMs,proto3" json:"cooldown_ms,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Provider) Reset() {
+	*x = Provider{}
+	mi := &file_gateway_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Provider) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Provider) ProtoMessage() {}
+
+func (x *Provider) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Provider.ProtoReflect.Descriptor instead.
+func (*Provider) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Provider) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *Provider) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Provider) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Provider) GetApiUrl() string {
+	if x != nil {
+		return x.ApiUrl
+	}
+	return ""
+}
+
+func (x *Provider) GetApiKey() string {
+	if x != nil {
+		return x.ApiKey
+	}
+	return ""
+}
+
+func (x *Provider) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+func (x *Provider) GetLevel() int32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *Provider) GetProviderType() string {
+	if x != nil {
+		return x.ProviderType
+	}
+	return ""
+}
+
+func (x *Provider) GetAuthType() string {
+	if x != nil {
+		return x.AuthType
+	}
+	return ""
+}
+
+func (x *Provider) GetFallbackOnly() bool {
+	if x != nil {
+		return x.FallbackOnly
+	}
+	return false
+}
+
+func (x *Provider) GetSupportedModels() []string {
+	if x != nil {
+		return x.SupportedModels
+	}
+	return nil
+}
+
+func (x *Provider) GetModelMapping() map[string]string {
+	if x != nil {
+		return x.ModelMapping
+	}
+	return nil
+}
+
+func (x *Provider) GetSuspended() bool {
+	if x != nil {
+		return x.Suspended
+	}
+	return false
+}
+
+func (x *Provider) GetSuspendedReason() string {
+	if x != nil {
+		return x.SuspendedReason
+	}
+	return ""
+}
+
+func (x *Provider) GetReady() bool {
+	if x != nil {
+		return x.Ready
+	}
+	return false
+}
+
+func (x *Provider) GetCooldownMs() int64 {
+	if x != nil {
+		return x.CooldownMs
+	}
+	return 0
+}
+
+type ListProvidersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// claude、codex、gemini-cli、picoclaw
+	Platform      string `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListProvidersRequest) Reset() {
+	*x = ListProvidersRequest{}
+	mi := &file_gateway_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListProvidersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListProvidersRequest) ProtoMessage() {}
+
+func (x *ListProvidersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListProvidersRequest.ProtoReflect.Descriptor instead.
+func (*ListProvidersRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListProvidersRequest) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+type ListProvidersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Providers     []*Provider            `protobuf:"bytes,1,rep,name=providers,proto3" json:"providers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListProvidersResponse) Reset() {
+	*x = ListProvidersResponse{}
+	mi := &file_gateway_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListProvidersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListProvidersResponse) ProtoMessage() {}
+
+func (x *ListProvidersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListProvidersResponse.ProtoReflect.Descriptor instead.
+func (*ListProvidersResponse) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListProvidersResponse) GetProviders() []*Provider {
+	if x != nil {
+		return x.Providers
+	}
+	return nil
+}
+
+type CreateProviderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Provider      *Provider              `protobuf:"bytes,1,opt,name=provider,proto3" json:"provider,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateProviderRequest) Reset() {
+	*x = CreateProviderRequest{}
+	mi := &file_gateway_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateProviderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateProviderRequest) ProtoMessage() {}
+
+func (x *CreateProviderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateProviderRequest.ProtoReflect.Descriptor instead.
+func (*CreateProviderRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CreateProviderRequest) GetProvider() *Provider {
+	if x != nil {
+		return x.Provider
+	}
+	return nil
+}
+
+type UpdateProviderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Provider      *Provider              `protobuf:"bytes,1,opt,name=provider,proto3" json:"provider,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateProviderRequest) Reset() {
+	*x = UpdateProviderRequest{}
+	mi := &file_gateway_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateProviderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateProviderRequest) ProtoMessage() {}
+
+func (x *UpdateProviderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateProviderRequest.ProtoReflect.Descriptor instead.
+func (*UpdateProviderRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpdateProviderRequest) GetProvider() *Provider {
+	if x != nil {
+		return x.Provider
+	}
+	return nil
+}
+
+type DeleteProviderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Platform      string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Id            int32                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteProviderRequest) Reset() {
+	*x = DeleteProviderRequest{}
+	mi := &file_gateway_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteProviderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteProviderRequest) ProtoMessage() {}
+
+func (x *DeleteProviderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteProviderRequest.ProtoReflect.Descriptor instead.
+func (*DeleteProviderRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteProviderRequest) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *DeleteProviderRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteProviderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteProviderResponse) Reset() {
+	*x = DeleteProviderResponse{}
+	mi := &file_gateway_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteProviderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteProviderResponse) ProtoMessage() {}
+
+func (x *DeleteProviderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteProviderResponse.ProtoReflect.Descriptor instead.
+func (*DeleteProviderResponse) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{8}
+}
+
+type SuspendProviderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Platform      string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Id            int32                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SuspendProviderRequest) Reset() {
+	*x = SuspendProviderRequest{}
+	mi := &file_gateway_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SuspendProviderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SuspendProviderRequest) ProtoMessage() {}
+
+func (x *SuspendProviderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SuspendProviderRequest.ProtoReflect.Descriptor instead.
+func (*SuspendProviderRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SuspendProviderRequest) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *SuspendProviderRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *SuspendProviderRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ResumeProviderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Platform      string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Id            int32                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeProviderRequest) Reset() {
+	*x = ResumeProviderRequest{}
+	mi := &file_gateway_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeProviderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeProviderRequest) ProtoMessage() {}
+
+func (x *ResumeProviderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeProviderRequest.ProtoReflect.Descriptor instead.
+func (*ResumeProviderRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ResumeProviderRequest) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *ResumeProviderRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type StreamLogsRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Platform string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Provider string                 `protobuf:"bytes,2,opt,name=provider,proto3" json:"provider,omitempty"`
+	// 支持通配符，如 claude-*
+	Model         string `protobuf:"bytes,3,opt,name=model,proto3" json:"model,omitempty"`
+	ErrorsOnly    bool   `protobuf:"varint,4,opt,name=errors_only,json=errorsOnly,proto3" json:"errors_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamLogsRequest) Reset() {
+	*x = StreamLogsRequest{}
+	mi := &file_gateway_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamLogsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamLogsRequest) ProtoMessage() {}
+
+func (x *StreamLogsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamLogsRequest.ProtoReflect.Descriptor instead.
+func (*StreamLogsRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StreamLogsRequest) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *StreamLogsRequest) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *StreamLogsRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *StreamLogsRequest) GetErrorsOnly() bool {
+	if x != nil {
+		return x.ErrorsOnly
+	}
+	return false
+}
+
+type RequestLog struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	TraceId           string                 `protobuf:"bytes,1,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	ConversationId    string                 `protobuf:"bytes,2,opt,name=conversation_id,json=conversationId,proto3" json:"conversation_id,omitempty"`
+	Project           string                 `protobuf:"bytes,3,opt,name=project,proto3" json:"project,omitempty"`
+	ApiKeyId          string                 `protobuf:"bytes,4,opt,name=api_key_id,json=apiKeyId,proto3" json:"api_key_id,omitempty"`
+	Platform          string                 `protobuf:"bytes,5,opt,name=platform,proto3" json:"platform,omitempty"`
+	Model             string                 `protobuf:"bytes,6,opt,name=model,proto3" json:"model,omitempty"`
+	Provider          string                 `protobuf:"bytes,7,opt,name=provider,proto3" json:"provider,omitempty"`
+	HttpCode          int32                  `protobuf:"varint,8,opt,name=http_code,json=httpCode,proto3" json:"http_code,omitempty"`
+	InputTokens       int64                  `protobuf:"varint,9,opt,name=input_tokens,json=inputTokens,proto3" json:"input_tokens,omitempty"`
+	OutputTokens      int64                  `protobuf:"varint,10,opt,name=output_tokens,json=outputTokens,proto3" json:"output_tokens,omitempty"`
+	CacheCreateTokens int64                  `protobuf:"varint,11,opt,name=cache_create_tokens,json=cacheCreateTokens,proto3" json:"cache_create_tokens,omitempty"`
+	CacheReadTokens   int64                  `protobuf:"varint,12,opt,name=cache_read_tokens,json=cacheReadTokens,proto3" json:"cache_read_tokens,omitempty"`
+	ReasoningTokens   int64                  `protobuf:"varint,13,opt,name=reasoning_tokens,json=reasoningTokens,proto3" json:"reasoning_tokens,omitempty"`
+	IsStream          bool                   `protobuf:"varint,14,opt,name=is_stream,json=isStream,proto3" json:"is_stream,omitempty"`
+	DurationSec       float64                `protobuf:"fixed64,15,opt,name=duration_sec,json=durationSec,proto3" json:"duration_sec,omitempty"`
+	RequestPath       string                 `protobuf:"bytes,16,opt,name=request_path,json=requestPath,proto3" json:"request_path,omitempty"`
+	ErrorType         string                 `protobuf:"bytes,17,opt,name=error_type,json=errorType,proto3" json:"error_type,omitempty"`
+	ErrorMessage      string                 `protobuf:"bytes,18,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	TotalCost         float64                `protobuf:"fixed64,19,opt,name=total_cost,json=totalCost,proto3" json:"total_cost,omitempty"`
+	// UTC，格式 2006-01-02 15:04:05
+	CreatedAt     string `protobuf:"bytes,20,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequestLog) Reset() {
+	*x = RequestLog{}
+	mi := &file_gateway_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestLog) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestLog) ProtoMessage() {}
+
+func (x *RequestLog) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestLog.ProtoReflect.Descriptor instead.
+func (*RequestLog) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RequestLog) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+func (x *RequestLog) GetConversationId() string {
+	if x != nil {
+		return x.ConversationId
+	}
+	return ""
+}
+
+func (x *RequestLog) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *RequestLog) GetApiKeyId() string {
+	if x != nil {
+		return x.ApiKeyId
+	}
+	return ""
+}
+
+func (x *RequestLog) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *RequestLog) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *RequestLog) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *RequestLog) GetHttpCode() int32 {
+	if x != nil {
+		return x.HttpCode
+	}
+	return 0
+}
+
+func (x *RequestLog) GetInputTokens() int64 {
+	if x != nil {
+		return x.InputTokens
+	}
+	return 0
+}
+
+func (x *RequestLog) GetOutputTokens() int64 {
+	if x != nil {
+		return x.OutputTokens
+	}
+	return 0
+}
+
+func (x *RequestLog) GetCacheCreateTokens() int64 {
+	if x != nil {
+		return x.CacheCreateTokens
+	}
+	return 0
+}
+
+func (x *RequestLog) GetCacheReadTokens() int64 {
+	if x != nil {
+		return x.CacheReadTokens
+	}
+	return 0
+}
+
+func (x *RequestLog) GetReasoningTokens() int64 {
+	if x != nil {
+		return x.ReasoningTokens
+	}
+	return 0
+}
+
+func (x *RequestLog) GetIsStream() bool {
+	if x != nil {
+		return x.IsStream
+	}
+	return false
+}
+
+func (x *RequestLog) GetDurationSec() float64 {
+	if x != nil {
+		return x.DurationSec
+	}
+	return 0
+}
+
+func (x *RequestLog) GetRequestPath() string {
+	if x != nil {
+		return x.RequestPath
+	}
+	return ""
+}
+
+func (x *RequestLog) GetErrorType() string {
+	if x != nil {
+		return x.ErrorType
+	}
+	return ""
+}
+
+func (x *RequestLog) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+func (x *RequestLog) GetTotalCost() float64 {
+	if x != nil {
+		return x.TotalCost
+	}
+	return 0
+}
+
+func (x *RequestLog) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+type ExplainRouteRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Platform string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	// 为空时不按模型过滤
+	Model         string `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainRouteRequest) Reset() {
+	*x = ExplainRouteRequest{}
+	mi := &file_gateway_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainRouteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainRouteRequest) ProtoMessage() {}
+
+func (x *ExplainRouteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainRouteRequest.ProtoReflect.Descriptor instead.
+func (*ExplainRouteRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ExplainRouteRequest) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *ExplainRouteRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+type RouteCandidate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 尝试顺序，从 1 开始（轮询模式下实际起点随计数器变化）
+	Order int32  `protobuf:"varint,1,opt,name=order,proto3" json:"order,omitempty"`
+	Name  string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Level int32  `protobuf:"varint,3,opt,name=level,proto3" json:"level,omitempty"`
+	// 模型映射后实际发送给上游的模型名
+	EffectiveModel string `protobuf:"bytes,4,opt,name=effective_model,json=effectiveModel,proto3" json:"effective_model,omitempty"`
+	// 仅在其他 provider 全部失败后尝试
+	Fallback bool `protobuf:"varint,5,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	// 上游额度即将耗尽，已移到末尾
+	RateLimited bool `protobuf:"varint,6,opt,name=rate_limited,json=rateLimited,proto3" json:"rate_limited,omitempty"`
+	// 剩余冷却时间（全部 provider 冷却时仍会按冷却结束先后尝试）
+	CooldownMs    int64 `protobuf:"varint,7,opt,name=cooldown_ms,json=cooldownMs,proto3" json:"cooldown_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RouteCandidate) Reset() {
+	*x = RouteCandidate{}
+	mi := &file_gateway_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RouteCandidate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RouteCandidate) ProtoMessage() {}
+
+func (x *RouteCandidate) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RouteCandidate.ProtoReflect.Descriptor instead.
+func (*RouteCandidate) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RouteCandidate) GetOrder() int32 {
+	if x != nil {
+		return x.Order
+	}
+	return 0
+}
+
+func (x *RouteCandidate) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *RouteCandidate) GetLevel() int32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *RouteCandidate) GetEffectiveModel() string {
+	if x != nil {
+		return x.EffectiveModel
+	}
+	return ""
+}
+
+func (x *RouteCandidate) GetFallback() bool {
+	if x != nil {
+		return x.Fallback
+	}
+	return false
+}
+
+func (x *RouteCandidate) GetRateLimited() bool {
+	if x != nil {
+		return x.RateLimited
+	}
+	return false
+}
+
+func (x *RouteCandidate) GetCooldownMs() int64 {
+	if x != nil {
+		return x.CooldownMs
+	}
+	return 0
+}
+
+type SkippedProvider struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// disabled、not_configured、suspended、invalid_config、model_unsupported、cooldown
+	Reason        string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	Detail        string `protobuf:"bytes,3,opt,name=detail,proto3" json:"detail,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SkippedProvider) Reset() {
+	*x = SkippedProvider{}
+	mi := &file_gateway_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SkippedProvider) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SkippedProvider) ProtoMessage() {}
+
+func (x *SkippedProvider) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SkippedProvider.ProtoReflect.Descriptor instead.
+func (*SkippedProvider) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *SkippedProvider) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SkippedProvider) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *SkippedProvider) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+type ExplainRouteResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Platform string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Model    string                 `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	// priority 或 round_robin
+	Mode string `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	// NEW-API 统一网关模式下请求先发往 NEW-API，失败后才按下列顺序尝试
+	NewApiEnabled bool               `protobuf:"varint,4,opt,name=new_api_enabled,json=newApiEnabled,proto3" json:"new_api_enabled,omitempty"`
+	Candidates    []*RouteCandidate  `protobuf:"bytes,5,rep,name=candidates,proto3" json:"candidates,omitempty"`
+	Skipped       []*SkippedProvider `protobuf:"bytes,6,rep,name=skipped,proto3" json:"skipped,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainRouteResponse) Reset() {
+	*x = ExplainRouteResponse{}
+	mi := &file_gateway_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainRouteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainRouteResponse) ProtoMessage() {}
+
+func (x *ExplainRouteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainRouteResponse.ProtoReflect.Descriptor instead.
+func (*ExplainRouteResponse) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ExplainRouteResponse) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *ExplainRouteResponse) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *ExplainRouteResponse) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *ExplainRouteResponse) GetNewApiEnabled() bool {
+	if x != nil {
+		return x.NewApiEnabled
+	}
+	return false
+}
+
+func (x *ExplainRouteResponse) GetCandidates() []*RouteCandidate {
+	if x != nil {
+		return x.Candidates
+	}
+	return nil
+}
+
+func (x *ExplainRouteResponse) GetSkipped() []*SkippedProvider {
+	if x != nil {
+		return x.Skipped
+	}
+	return nil
+}
+
+var File_gateway_proto protoreflect.FileDescriptor
+
+const file_gateway_proto_rawDesc = "" +
+	"\n" +
+	"\rgateway.proto\x12\x15codeswitch.gateway.v1\"+\n" +
+	"\x11GetMetricsRequest\x12\x16\n" +
+	"\x06period\x18\x01 \x01(\tR\x06period\"\xb2\x06\n" +
+	"\x0fMetricsSnapshot\x12\x16\n" +
+	"\x06period\x18\x01 \x01(\tR\x06period\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x12\x1d\n" +
+	"\n" +
+	"uptime_sec\x18\x03 \x01(\x03R\tuptimeSec\x12%\n" +
+	"\x0etotal_requests\x18\x04 \x01(\x03R\rtotalRequests\x12!\n" +
+	"\ftotal_tokens\x18\x05 \x01(\x03R\vtotalTokens\x12,\n" +
+	"\x12total_input_tokens\x18\x06 \x01(\x03R\x10totalInputTokens\x12.\n" +
+	"\x13total_output_tokens\x18\a \x01(\x03R\x11totalOutputTokens\x12\x1d\n" +
+	"\n" +
+	"total_cost\x18\b \x01(\x01R\ttotalCost\x12!\n" +
+	"\fsuccess_rate\x18\t \x01(\x01R\vsuccessRate\x12(\n" +
+	"\x10avg_duration_sec\x18\n" +
+	" \x01(\x01R\x0eavgDurationSec\x12W\n" +
+	"\vby_platform\x18\v \x03(\v26.codeswitch.gateway.v1.MetricsSnapshot.ByPlatformEntryR\n" +
+	"byPlatform\x12N\n" +
+	"\bby_model\x18\f \x03(\v23.codeswitch.gateway.v1.MetricsSnapshot.ByModelEntryR\abyModel\x12W\n" +
+	"\vby_provider\x18\r \x03(\v26.codeswitch.gateway.v1.MetricsSnapshot.ByProviderEntryR\n" +
+	"byProvider\x1a=\n" +
+	"\x0fByPlatformEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\x1a:\n" +
+	"\fByModelEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\x1a=\n" +
+	"\x0fByProviderEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"\xd7\x04\n" +
+	"\bProvider\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x17\n" +
+	"\aapi_url\x18\x04 \x01(\tR\x06apiUrl\x12\x17\n" +
+	"\aapi_key\x18\x05 \x01(\tR\x06apiKey\x12\x18\n" +
+	"\aenabled\x18\x06 \x01(\bR\aenabled\x12\x14\n" +
+	"\x05level\x18\a \x01(\x05R\x05level\x12#\n" +
+	"\rprovider_type\x18\b \x01(\tR\fproviderType\x12\x1b\n" +
+	"\tauth_type\x18\t \x01(\tR\bauthType\x12#\n" +
+	"\rfallback_only\x18\n" +
+	" \x01(\bR\ffallbackOnly\x12)\n" +
+	"\x10supported_models\x18\v \x03(\tR\x0fsupportedModels\x12V\n" +
+	"\rmodel_mapping\x18\f \x03(\v21.codeswitch.gateway.v1.Provider.ModelMappingEntryR\fmodelMapping\x12\x1c\n" +
+	"\tsuspended\x18\r \x01(\bR\tsuspended\x12)\n" +
+	"\x10suspended_reason\x18\x0e \x01(\tR\x0fsuspendedReason\x12\x14\n" +
+	"\x05ready\x18\x0f \x01(\bR\x05ready\x12\x1f\n" +
+	"\vcooldown_ms\x18\x10 \x01(\x03R\n" +
+	"cooldownMs\x1a?\n" +
+	"\x11ModelMappingEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"2\n" +
+	"\x14ListProvidersRequest\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\"V\n" +
+	"\x15ListProvidersResponse\x12=\n" +
+	"\tproviders\x18\x01 \x03(\v2\x1f.codeswitch.gateway.v1.ProviderR\tproviders\"T\n" +
+	"\x15CreateProviderRequest\x12;\n" +
+	"\bprovider\x18\x01 \x01(\v2\x1f.codeswitch.gateway.v1.ProviderR\bprovider\"T\n" +
+	"\x15UpdateProviderRequest\x12;\n" +
+	"\bprovider\x18\x01 \x01(\v2\x1f.codeswitch.gateway.v1.ProviderR\bprovider\"C\n" +
+	"\x15DeleteProviderRequest\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x05R\x02id\"\x18\n" +
+	"\x16DeleteProviderResponse\"\\\n" +
+	"\x16SuspendProviderRequest\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x05R\x02id\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"C\n" +
+	"\x15ResumeProviderRequest\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x05R\x02id\"\x82\x01\n" +
+	"\x11StreamLogsRequest\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x1a\n" +
+	"\bprovider\x18\x02 \x01(\tR\bprovider\x12\x14\n" +
+	"\x05model\x18\x03 \x01(\tR\x05model\x12\x1f\n" +
+	"\verrors_only\x18\x04 \x01(\bR\n" +
+	"errorsOnly\"\xa7\x05\n" +
+	"\n" +
+	"RequestLog\x12\x19\n" +
+	"\btrace_id\x18\x01 \x01(\tR\atraceId\x12'\n" +
+	"\x0fconversation_id\x18\x02 \x01(\tR\x0econversationId\x12\x18\n" +
+	"\aproject\x18\x03 \x01(\tR\aproject\x12\x1c\n" +
+	"\n" +
+	"api_key_id\x18\x04 \x01(\tR\bapiKeyId\x12\x1a\n" +
+	"\bplatform\x18\x05 \x01(\tR\bplatform\x12\x14\n" +
+	"\x05model\x18\x06 \x01(\tR\x05model\x12\x1a\n" +
+	"\bprovider\x18\a \x01(\tR\bprovider\x12\x1b\n" +
+	"\thttp_code\x18\b \x01(\x05R\bhttpCode\x12!\n" +
+	"\finput_tokens\x18\t \x01(\x03R\vinputTokens\x12#\n" +
+	"\routput_tokens\x18\n" +
+	" \x01(\x03R\foutputTokens\x12.\n" +
+	"\x13cache_create_tokens\x18\v \x01(\x03R\x11cacheCreateTokens\x12*\n" +
+	"\x11cache_read_tokens\x18\f \x01(\x03R\x0fcacheReadTokens\x12)\n" +
+	"\x10reasoning_tokens\x18\r \x01(\x03R\x0freasoningTokens\x12\x1b\n" +
+	"\tis_stream\x18\x0e \x01(\bR\bisStream\x12!\n" +
+	"\fduration_sec\x18\x0f \x01(\x01R\vdurationSec\x12!\n" +
+	"\frequest_path\x18\x10 \x01(\tR\vrequestPath\x12\x1d\n" +
+	"\n" +
+	"error_type\x18\x11 \x01(\tR\terrorType\x12#\n" +
+	"\rerror_message\x18\x12 \x01(\tR\ferrorMessage\x12\x1d\n" +
+	"\n" +
+	"total_cost\x18\x13 \x01(\x01R\ttotalCost\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x14 \x01(\tR\tcreatedAt\"G\n" +
+	"\x13ExplainRouteRequest\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\"\xd9\x01\n" +
+	"\x0eRouteCandidate\x12\x14\n" +
+	"\x05order\x18\x01 \x01(\x05R\x05order\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05level\x18\x03 \x01(\x05R\x05level\x12'\n" +
+	"\x0feffective_model\x18\x04 \x01(\tR\x0eeffectiveModel\x12\x1a\n" +
+	"\bfallback\x18\x05 \x01(\bR\bfallback\x12!\n" +
+	"\frate_limited\x18\x06 \x01(\bR\vrateLimited\x12\x1f\n" +
+	"\vcooldown_ms\x18\a \x01(\x03R\n" +
+	"cooldownMs\"U\n" +
+	"\x0fSkippedProvider\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x12\x16\n" +
+	"\x06detail\x18\x03 \x01(\tR\x06detail\"\x8d\x02\n" +
+	"\x14ExplainRouteResponse\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12\x12\n" +
+	"\x04mode\x18\x03 \x01(\tR\x04mode\x12&\n" +
+	"\x0fnew_api_enabled\x18\x04 \x01(\bR\rnewApiEnabled\x12E\n" +
+	"\n" +
+	"candidates\x18\x05 \x03(\v2%.codeswitch.gateway.v1.RouteCandidateR\n" +
+	"candidates\x12@\n" +
+	"\askipped\x18\x06 \x03(\v2&.codeswitch.gateway.v1.SkippedProviderR\askipped2\x97\a\n" +
+	"\x0eGatewayService\x12^\n" +
+	"\n" +
+	"GetMetrics\x12(.codeswitch.gateway.v1.GetMetricsRequest\x1a&.codeswitch.gateway.v1.MetricsSnapshot\x12j\n" +
+	"\rListProviders\x12+.codeswitch.gateway.v1.ListProvidersRequest\x1a,.codeswitch.gateway.v1.ListProvidersResponse\x12_\n" +
+	"\x0eCreateProvider\x12,.codeswitch.gateway.v1.CreateProviderRequest\x1a\x1f.codeswitch.gateway.v1.Provider\x12_\n" +
+	"\x0eUpdateProvider\x12,.codeswitch.gateway.v1.UpdateProviderRequest\x1a\x1f.codeswitch.gateway.v1.Provider\x12m\n" +
+	"\x0eDeleteProvider\x12,.codeswitch.gateway.v1.DeleteProviderRequest\x1a-.codeswitch.gateway.v1.DeleteProviderResponse\x12a\n" +
+	"\x0fSuspendProvider\x12-.codeswitch.gateway.v1.SuspendProviderRequest\x1a\x1f.codeswitch.gateway.v1.Provider\x12_\n" +
+	"\x0eResumeProvider\x12,.codeswitch.gateway.v1.ResumeProviderRequest\x1a\x1f.codeswitch.gateway.v1.Provider\x12[\n" +
+	"\n" +
+	"StreamLogs\x12(.codeswitch.gateway.v1.StreamLogsRequest\x1a!.codeswitch.gateway.v1.RequestLog0\x01\x12g\n" +
+	"\fExplainRoute\x12*.codeswitch.gateway.v1.ExplainRouteRequest\x1a+.codeswitch.gateway.v1.ExplainRouteResponseB\x1fZ\x1dcodeswitch/services/gatewaypbb\x06proto3"
+
+var (
+	file_gateway_proto_rawDescOnce sync.Once
+	file_gateway_proto_rawDescData []byte
+)
+
+func file_gateway_proto_rawDescGZIP() []byte {
+	file_gateway_proto_rawDescOnce.Do(func() {
+		file_gateway_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_gateway_proto_rawDesc), len(file_gateway_proto_rawDesc)))
+	})
+	return file_gateway_proto_rawDescData
+}
+
+var file_gateway_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_gateway_proto_goTypes = []any{
+	(*GetMetricsRequest)(nil),      // 0: codeswitch.gateway.v1.GetMetricsRequest
+	(*MetricsSnapshot)(nil),        // 1: codeswitch.gateway.v1.MetricsSnapshot
+	(*Provider)(nil),               // 2: codeswitch.gateway.v1.Provider
+	(*ListProvidersRequest)(nil),   // 3: codeswitch.gateway.v1.ListProvidersRequest
+	(*ListProvidersResponse)(nil),  // 4: codeswitch.gateway.v1.ListProvidersResponse
+	(*CreateProviderRequest)(nil),  // 5: codeswitch.gateway.v1.CreateProviderRequest
+	(*UpdateProviderRequest)(nil),  // 6: codeswitch.gateway.v1.UpdateProviderRequest
+	(*DeleteProviderRequest)(nil),  // 7: codeswitch.gateway.v1.DeleteProviderRequest
+	(*DeleteProviderResponse)(nil), // 8: codeswitch.gateway.v1.DeleteProviderResponse
+	(*SuspendProviderRequest)(nil), // 9: codeswitch.gateway.v1.SuspendProviderRequest
+	(*ResumeProviderRequest)(nil),  // 10: codeswitch.gateway.v1.ResumeProviderRequest
+	(*StreamLogsRequest)(nil),      // 11: codeswitch.gateway.v1.StreamLogsRequest
+	(*RequestLog)(nil),             // 12: codeswitch.gateway.v1.RequestLog
+	(*ExplainRouteRequest)(nil),    // 13: codeswitch.gateway.v1.ExplainRouteRequest
+	(*RouteCandidate)(nil),         // 14: codeswitch.gateway.v1.RouteCandidate
+	(*SkippedProvider)(nil),        // 15: codeswitch.gateway.v1.SkippedProvider
+	(*ExplainRouteResponse)(nil),   // 16: codeswitch.gateway.v1.ExplainRouteResponse
+	nil,                            // 17: codeswitch.gateway.v1.MetricsSnapshot.ByPlatformEntry
+	nil,                            // 18: codeswitch.gateway.v1.MetricsSnapshot.ByModelEntry
+	nil,                            // 19: codeswitch.gateway.v1.MetricsSnapshot.ByProviderEntry
+	nil,                            // 20: codeswitch.gateway.v1.Provider.ModelMappingEntry
+}
+var file_gateway_proto_depIdxs = []int32{
+	17, // 0: codeswitch.gateway.v1.MetricsSnapshot.by_platform:type_name -> codeswitch.gateway.v1.MetricsSnapshot.ByPlatformEntry
+	18, // 1: codeswitch.gateway.v1.MetricsSnapshot.by_model:type_name -> codeswitch.gateway.v1.MetricsSnapshot.ByModelEntry
+	19, // 2: codeswitch.gateway.v1.MetricsSnapshot.by_provider:type_name -> codeswitch.gateway.v1.MetricsSnapshot.ByProviderEntry
+	20, // 3: codeswitch.gateway.v1.Provider.model_mapping:type_name -> codeswitch.gateway.v1.Provider.ModelMappingEntry
+	2,  // 4: codeswitch.gateway.v1.ListProvidersResponse.providers:type_name -> codeswitch.gateway.v1.Provider
+	2,  // 5: codeswitch.gateway.v1.CreateProviderRequest.provider:type_name -> codeswitch.gateway.v1.Provider
+	2,  // 6: codeswitch.gateway.v1.UpdateProviderRequest.provider:type_name -> codeswitch.gateway.v1.Provider
+	14, // 7: codeswitch.gateway.v1.ExplainRouteResponse.candidates:type_name -> codeswitch.gateway.v1.RouteCandidate
+	15, // 8: codeswitch.gateway.v1.ExplainRouteResponse.skipped:type_name -> codeswitch.gateway.v1.SkippedProvider
+	0,  // 9: codeswitch.gateway.v1.GatewayService.GetMetrics:input_type -> codeswitch.gateway.v1.GetMetricsRequest
+	3,  // 10: codeswitch.gateway.v1.GatewayService.ListProviders:input_type -> codeswitch.gateway.v1.ListProvidersRequest
+	5,  // 11: codeswitch.gateway.v1.GatewayService.CreateProvider:input_type -> codeswitch.gateway.v1.CreateProviderRequest
+	6,  // 12: codeswitch.gateway.v1.GatewayService.UpdateProvider:input_type -> codeswitch.gateway.v1.UpdateProviderRequest
+	7,  // 13: codeswitch.gateway.v1.GatewayService.DeleteProvider:input_type -> codeswitch.gateway.v1.DeleteProviderRequest
+	9,  // 14: codeswitch.gateway.v1.GatewayService.SuspendProvider:input_type -> codeswitch.gateway.v1.SuspendProviderRequest
+	10, // 15: codeswitch.gateway.v1.GatewayService.ResumeProvider:input_type -> codeswitch.gateway.v1.ResumeProviderRequest
+	11, // 16: codeswitch.gateway.v1.GatewayService.StreamLogs:input_type -> codeswitch.gateway.v1.StreamLogsRequest
+	13, // 17: codeswitch.gateway.v1.GatewayService.ExplainRoute:input_type -> codeswitch.gateway.v1.ExplainRouteRequest
+	1,  // 18: codeswitch.gateway.v1.GatewayService.GetMetrics:output_type -> codeswitch.gateway.v1.MetricsSnapshot
+	4,  // 19: codeswitch.gateway.v1.GatewayService.ListProviders:output_type -> codeswitch.gateway.v1.ListProvidersResponse
+	2,  // 20: codeswitch.gateway.v1.GatewayService.CreateProvider:output_type -> codeswitch.gateway.v1.Provider
+	2,  // 21: codeswitch.gateway.v1.GatewayService.UpdateProvider:output_type -> codeswitch.gateway.v1.Provider
+	8,  // 22: codeswitch.gateway.v1.GatewayService.DeleteProvider:output_type -> codeswitch.gateway.v1.DeleteProviderResponse
+	2,  // 23: codeswitch.gateway.v1.GatewayService.SuspendProvider:output_type -> codeswitch.gateway.v1.Provider
+	2,  // 24: codeswitch.gateway.v1.GatewayService.ResumeProvider:output_type -> codeswitch.gateway.v1.Provider
+	12, // 25: codeswitch.gateway.v1.GatewayService.StreamLogs:output_type -> codeswitch.gateway.v1.RequestLog
+	16, // 26: codeswitch.gateway.v1.GatewayService.ExplainRoute:output_type -> codeswitch.gateway.v1.ExplainRouteResponse
+	18, // [18:27] is the sub-list for method output_type
+	9,  // [9:18] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_gateway_proto_init() }
+func file_gateway_proto_init() {
+	if File_gateway_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gateway_proto_rawDesc), len(file_gateway_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_gateway_proto_goTypes,
+		DependencyIndexes: file_gateway_proto_depIdxs,
+		MessageInfos:      file_gateway_proto_msgTypes,
+	}.Build()
+	File_gateway_proto = out.File
+	file_gateway_proto_goTypes = nil
+	file_gateway_proto_depIdxs = nil
+}
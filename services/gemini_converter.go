@@ -17,6 +17,7 @@ type GeminiContent struct {
 // GeminiPart Gemini内容部分
 type GeminiPart struct {
 	Text             string                 `json:"text,omitempty"`
+	Thought          bool                   `json:"thought,omitempty"` // 思考摘要（thinkingConfig.includeThoughts）
 	ThoughtSignature string                 `json:"thoughtSignature,omitempty"`
 	FunctionCall     *GeminiFunctionCall    `json:"functionCall,omitempty"`
 	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
@@ -229,9 +230,13 @@ func (gc *GeminiConverter) ConvertGeminiToOpenAI(geminiResp *GeminiResponse, mod
 		"model":   model,
 		"choices": []interface{}{},
 		"usage": map[string]interface{}{
-			"prompt_tokens":     geminiResp.UsageMetadata.PromptTokenCount,
-			"completion_tokens": geminiResp.UsageMetadata.CandidatesTokenCount,
+			"prompt_tokens": geminiResp.UsageMetadata.PromptTokenCount,
+			// 思考 token 不计入 candidatesTokenCount，按 OpenAI 的口径计入 completion_tokens
+			"completion_tokens": geminiResp.UsageMetadata.CandidatesTokenCount + geminiResp.UsageMetadata.ThoughtsTokenCount,
 			"total_tokens":      geminiResp.UsageMetadata.TotalTokenCount,
+			"completion_tokens_details": map[string]interface{}{
+				"reasoning_tokens": geminiResp.UsageMetadata.ThoughtsTokenCount,
+			},
 		},
 	}
 
@@ -244,11 +249,15 @@ func (gc *GeminiConverter) ConvertGeminiToOpenAI(geminiResp *GeminiResponse, mod
 		"role": "assistant",
 	}
 
-	// 提取文本内容和tool_calls
-	var textContent string
+	// 提取文本内容、思考内容和tool_calls
+	var textContent, reasoningContent string
 	var toolCalls []interface{}
 
 	for _, part := range candidate.Content.Parts {
+		if part.Thought {
+			reasoningContent += part.Text
+			continue
+		}
 		if part.Text != "" {
 			textContent += part.Text
 		}
@@ -271,6 +280,10 @@ func (gc *GeminiConverter) ConvertGeminiToOpenAI(geminiResp *GeminiResponse, mod
 		message["content"] = textContent
 	}
 
+	if reasoningContent != "" {
+		message["reasoning_content"] = reasoningContent
+	}
+
 	if len(toolCalls) > 0 {
 		message["tool_calls"] = toolCalls
 	}
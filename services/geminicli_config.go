@@ -0,0 +1,537 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Gemini CLI 的 settings.json 格式：0.3.0 起改为嵌套结构（security.auth.selectedType 等）
+const (
+	GeminiSettingsFlat   = "flat"
+	GeminiSettingsNested = "nested"
+
+	geminiNestedSettingsVersion = "0.3.0"
+	geminiBaseURLEnvKey         = "GOOGLE_GEMINI_BASE_URL"
+	geminiAPIKeyEnvKey          = "GEMINI_API_KEY"
+	geminiRelayAPIKey           = "code-switch"
+)
+
+// 已知的认证方式；只有 gemini-api-key 会使用 GOOGLE_GEMINI_BASE_URL
+var geminiAuthModes = []string{"oauth-personal", "gemini-api-key", "vertex-ai", "cloud-shell"}
+
+// geminiRelayActions 中转 /v1beta/models/{model}:{action} 支持的操作（见 geminiNativeHandler）
+var geminiRelayActions = []string{"generateContent", "streamGenerateContent"}
+
+// geminiCLIActions Gemini CLI 会调用的操作：countTokens 用于上下文压缩，embedContent 用于记忆检索
+var geminiCLIActions = []string{"generateContent", "streamGenerateContent", "countTokens", "embedContent"}
+
+// geminiBinary 可在测试中替换
+var geminiBinary = "gemini"
+
+// GeminiCLISettings ~/.gemini/settings.json 与 ~/.gemini/.env 中由本应用管理的部分
+type GeminiCLISettings struct {
+	AuthMode               string `json:"auth_mode"`
+	BaseURL                string `json:"base_url"` // 写入 .env 的 GOOGLE_GEMINI_BASE_URL，为空时移除
+	TelemetryEnabled       bool   `json:"telemetry_enabled"`
+	UsageStatisticsEnabled bool   `json:"usage_statistics_enabled"`
+	Schema                 string `json:"schema"` // flat / nested，读取时按文件内容判断
+}
+
+// GeminiExtension ~/.gemini/extensions 下的一个扩展
+type GeminiExtension struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Path        string   `json:"path"`
+	Enabled     bool     `json:"enabled"`
+	MCPServers  []string `json:"mcp_servers"`
+	ContextFile string   `json:"context_file,omitempty"`
+}
+
+// GeminiCLICompatibility gemini 命令的版本检查结果
+type GeminiCLICompatibility struct {
+	Installed      bool     `json:"installed"`
+	BinaryPath     string   `json:"binary_path"`
+	Version        string   `json:"version"`
+	SettingsSchema string   `json:"settings_schema"`
+	ExpectedSchema string   `json:"expected_schema"`
+	Warnings       []string `json:"warnings"`
+}
+
+func geminiConfigDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".gemini"), nil
+}
+
+// readGeminiSettings 读取 settings.json，文件不存在时返回空 map
+func readGeminiSettings() (map[string]any, string, error) {
+	dir, err := geminiConfigDir()
+	if err != nil {
+		return nil, "", err
+	}
+	path := filepath.Join(dir, "settings.json")
+	settings := make(map[string]any)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return settings, path, nil
+		}
+		return nil, path, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return settings, path, nil
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, path, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	return settings, path, nil
+}
+
+// detectGeminiSettingsSchema 出现嵌套的 security / privacy / general 等对象时视为 nested 格式
+func detectGeminiSettingsSchema(settings map[string]any) string {
+	for _, key := range []string{"security", "privacy", "general", "ui", "model"} {
+		if _, ok := settings[key].(map[string]any); ok {
+			return GeminiSettingsNested
+		}
+	}
+	for _, key := range []string{"selectedAuthType", "usageStatisticsEnabled", "theme"} {
+		if _, ok := settings[key]; ok {
+			return GeminiSettingsFlat
+		}
+	}
+	return ""
+}
+
+// GetSettings 读取认证方式、中转地址与遥测开关
+func (s *GeminiCLISettingsService) GetSettings() (GeminiCLISettings, error) {
+	settings, _, err := readGeminiSettings()
+	if err != nil {
+		return GeminiCLISettings{}, err
+	}
+	result := GeminiCLISettings{
+		Schema:                 detectGeminiSettingsSchema(settings),
+		UsageStatisticsEnabled: true, // Gemini CLI 默认开启使用统计
+	}
+	if result.Schema == GeminiSettingsNested {
+		result.AuthMode, _ = nestedValue(settings, "security", "auth", "selectedType").(string)
+		if v, ok := nestedValue(settings, "privacy", "usageStatisticsEnabled").(bool); ok {
+			result.UsageStatisticsEnabled = v
+		}
+	} else {
+		result.AuthMode, _ = settings["selectedAuthType"].(string)
+		if v, ok := settings["usageStatisticsEnabled"].(bool); ok {
+			result.UsageStatisticsEnabled = v
+		}
+	}
+	result.TelemetryEnabled, _ = nestedValue(settings, "telemetry", "enabled").(bool)
+
+	env, err := readGeminiEnv()
+	if err != nil {
+		return result, err
+	}
+	result.BaseURL = env[geminiBaseURLEnvKey]
+	return result, nil
+}
+
+// UpdateSettings 写入 settings.json（保留其他字段与原有格式）和 .env 中的中转地址
+func (s *GeminiCLISettingsService) UpdateSettings(update GeminiCLISettings) error {
+	if update.AuthMode != "" && !containsFold(geminiAuthModes, update.AuthMode) {
+		return fmt.Errorf("不支持的认证方式 %q，可选: %s", update.AuthMode, strings.Join(geminiAuthModes, ", "))
+	}
+	if update.BaseURL != "" && !strings.HasPrefix(update.BaseURL, "http://") && !strings.HasPrefix(update.BaseURL, "https://") {
+		return fmt.Errorf("中转地址必须以 http:// 或 https:// 开头")
+	}
+	settings, path, err := readGeminiSettings()
+	if err != nil {
+		return err
+	}
+
+	schema := update.Schema
+	if schema == "" {
+		schema = detectGeminiSettingsSchema(settings)
+	}
+	if schema == "" {
+		schema = GeminiSettingsNested
+	}
+	if schema == GeminiSettingsNested {
+		setNestedValue(settings, update.AuthMode, "security", "auth", "selectedType")
+		setNestedValue(settings, update.UsageStatisticsEnabled, "privacy", "usageStatisticsEnabled")
+		delete(settings, "selectedAuthType")
+		delete(settings, "usageStatisticsEnabled")
+	} else {
+		if update.AuthMode == "" {
+			delete(settings, "selectedAuthType")
+		} else {
+			settings["selectedAuthType"] = update.AuthMode
+		}
+		settings["usageStatisticsEnabled"] = update.UsageStatisticsEnabled
+	}
+	setNestedValue(settings, update.TelemetryEnabled, "telemetry", "enabled")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+
+	env := map[string]string{geminiBaseURLEnvKey: update.BaseURL}
+	// 通过中转访问时 Gemini CLI 仍要求存在 API Key，未配置时写入占位值
+	if update.BaseURL != "" && strings.EqualFold(update.AuthMode, "gemini-api-key") {
+		current, err := readGeminiEnv()
+		if err != nil {
+			return err
+		}
+		if current[geminiAPIKeyEnvKey] == "" {
+			env[geminiAPIKeyEnvKey] = geminiRelayAPIKey
+		}
+	}
+	return writeGeminiEnv(env)
+}
+
+// ListExtensions 列出已安装的扩展及其启用状态
+func (s *GeminiCLISettingsService) ListExtensions() ([]GeminiExtension, error) {
+	dir, err := geminiConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	settings, _, err := readGeminiSettings()
+	if err != nil {
+		return nil, err
+	}
+	disabled := disabledGeminiExtensions(settings)
+
+	extensionsDir := filepath.Join(dir, "extensions")
+	entries, err := os.ReadDir(extensionsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []GeminiExtension{}, nil
+		}
+		return nil, err
+	}
+	extensions := make([]GeminiExtension, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(extensionsDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(path, "gemini-extension.json"))
+		if err != nil {
+			continue
+		}
+		var manifest struct {
+			Name            string                     `json:"name"`
+			Version         string                     `json:"version"`
+			MCPServers      map[string]json.RawMessage `json:"mcpServers"`
+			ContextFileName any                        `json:"contextFileName"`
+		}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			fmt.Printf("[GeminiCLI] 解析扩展 %s 失败: %v\n", entry.Name(), err)
+			continue
+		}
+		if manifest.Name == "" {
+			manifest.Name = entry.Name()
+		}
+		ext := GeminiExtension{
+			Name:       manifest.Name,
+			Version:    manifest.Version,
+			Path:       path,
+			Enabled:    !disabled[manifest.Name],
+			MCPServers: make([]string, 0, len(manifest.MCPServers)),
+		}
+		for name := range manifest.MCPServers {
+			ext.MCPServers = append(ext.MCPServers, name)
+		}
+		sort.Strings(ext.MCPServers)
+		switch v := manifest.ContextFileName.(type) {
+		case string:
+			ext.ContextFile = v
+		case []any:
+			if len(v) > 0 {
+				ext.ContextFile, _ = v[0].(string)
+			}
+		}
+		extensions = append(extensions, ext)
+	}
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i].Name < extensions[j].Name })
+	return extensions, nil
+}
+
+// SetExtensionEnabled 启用或禁用扩展（settings.json 的 extensions.disabled 列表）
+func (s *GeminiCLISettingsService) SetExtensionEnabled(name string, enabled bool) error {
+	extensions, err := s.ListExtensions()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, ext := range extensions {
+		if ext.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("扩展 %s 未安装", name)
+	}
+
+	settings, path, err := readGeminiSettings()
+	if err != nil {
+		return err
+	}
+	disabled := disabledGeminiExtensions(settings)
+	if enabled {
+		delete(disabled, name)
+	} else {
+		disabled[name] = true
+	}
+	list := make([]string, 0, len(disabled))
+	for n := range disabled {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	if len(list) == 0 {
+		if ext, ok := settings["extensions"].(map[string]any); ok {
+			delete(ext, "disabled")
+			if len(ext) == 0 {
+				delete(settings, "extensions")
+			}
+		}
+	} else {
+		setNestedValue(settings, list, "extensions", "disabled")
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// CheckCompatibility 检查 gemini 命令的版本、settings.json 格式与中转支持的接口
+func (s *GeminiCLISettingsService) CheckCompatibility() (GeminiCLICompatibility, error) {
+	result := GeminiCLICompatibility{Warnings: []string{}}
+	settings, _, err := readGeminiSettings()
+	if err != nil {
+		return result, err
+	}
+	result.SettingsSchema = detectGeminiSettingsSchema(settings)
+
+	path, err := exec.LookPath(geminiBinary)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "未找到 gemini 命令，请先安装 Gemini CLI")
+	} else {
+		result.Installed = true
+		result.BinaryPath = path
+		result.Version, err = geminiCLIVersion(path)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("无法获取 gemini 版本: %v", err))
+		}
+	}
+
+	if result.Version != "" {
+		result.ExpectedSchema = GeminiSettingsFlat
+		if compareVersion(result.Version, geminiNestedSettingsVersion) >= 0 {
+			result.ExpectedSchema = GeminiSettingsNested
+		}
+		if result.SettingsSchema != "" && result.SettingsSchema != result.ExpectedSchema {
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"Gemini CLI %s 使用 %s 格式的 settings.json，当前文件为 %s 格式，部分设置可能不生效",
+				result.Version, result.ExpectedSchema, result.SettingsSchema))
+		}
+	}
+
+	current, _ := s.GetSettings()
+	if current.BaseURL != "" {
+		if !strings.EqualFold(current.AuthMode, "gemini-api-key") {
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"已设置 %s，但认证方式为 %q，只有 gemini-api-key 模式会经过中转", geminiBaseURLEnvKey, current.AuthMode))
+		}
+		var missing []string
+		for _, action := range geminiCLIActions {
+			if !containsFold(geminiRelayActions, action) {
+				missing = append(missing, action)
+			}
+		}
+		if len(missing) > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"中转未实现 %s 接口，Gemini CLI 的上下文压缩与记忆检索请求会失败", strings.Join(missing, " / ")))
+		}
+	}
+	return result, nil
+}
+
+var geminiVersionPattern = regexp.MustCompile(`\d+\.\d+\.\d+(?:-[0-9A-Za-z.]+)?`)
+
+// geminiCLIVersion 执行 gemini --version 并提取版本号
+func geminiCLIVersion(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	version := geminiVersionPattern.FindString(string(output))
+	if version == "" {
+		return "", fmt.Errorf("无法识别的版本输出: %s", strings.TrimSpace(string(output)))
+	}
+	return version, nil
+}
+
+func disabledGeminiExtensions(settings map[string]any) map[string]bool {
+	disabled := make(map[string]bool)
+	list, _ := nestedValue(settings, "extensions", "disabled").([]any)
+	for _, item := range list {
+		if name, ok := item.(string); ok {
+			disabled[name] = true
+		}
+	}
+	return disabled
+}
+
+func nestedValue(m map[string]any, keys ...string) any {
+	var current any = m
+	for _, key := range keys {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = obj[key]
+	}
+	return current
+}
+
+// setNestedValue 按路径写入值，空字符串表示删除
+func setNestedValue(m map[string]any, value any, keys ...string) {
+	current := m
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			current[key] = next
+		}
+		current = next
+	}
+	last := keys[len(keys)-1]
+	if s, ok := value.(string); ok && s == "" {
+		delete(current, last)
+		return
+	}
+	current[last] = value
+}
+
+func geminiEnvPath() (string, error) {
+	dir, err := geminiConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ".env"), nil
+}
+
+// readGeminiEnv 解析 ~/.gemini/.env 中的 KEY=VALUE 行
+func readGeminiEnv() (map[string]string, error) {
+	path, err := geminiEnvPath()
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return env, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := parseGeminiEnvLine(scanner.Text())
+		if ok {
+			env[key] = value
+		}
+	}
+	return env, scanner.Err()
+}
+
+func parseGeminiEnvLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	line = strings.TrimPrefix(line, "export ")
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+	value = strings.TrimSpace(value)
+	value = strings.Trim(value, `"'`)
+	return strings.TrimSpace(key), value, true
+}
+
+// writeGeminiEnv 更新 .env 中的指定变量，空值表示删除；其他行原样保留
+func writeGeminiEnv(updates map[string]string) error {
+	path, err := geminiEnvPath()
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if data, err := os.ReadFile(path); err == nil {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	pending := make(map[string]string, len(updates))
+	for k, v := range updates {
+		pending[k] = v
+	}
+	result := make([]string, 0, len(lines)+len(updates))
+	for _, line := range lines {
+		key, _, ok := parseGeminiEnvLine(line)
+		if value, managed := pending[key]; ok && managed {
+			delete(pending, key)
+			if value != "" {
+				result = append(result, key+"="+value)
+			}
+			continue
+		}
+		result = append(result, line)
+	}
+	keys := make([]string, 0, len(pending))
+	for k := range pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if pending[key] != "" {
+			result = append(result, key+"="+pending[key])
+		}
+	}
+
+	content := strings.Join(result, "\n")
+	if strings.TrimSpace(content) == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content+"\n"), 0o600)
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeGeminiTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeminiCLISettings_UpdateKeepsOtherKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	settingsPath := filepath.Join(home, ".gemini", "settings.json")
+	envPath := filepath.Join(home, ".gemini", ".env")
+	writeGeminiTestFile(t, settingsPath, `{"selectedAuthType":"oauth-personal","theme":"GitHub"}`)
+	writeGeminiTestFile(t, envPath, "# mine\nFOO=bar\n")
+
+	s := NewGeminiCLISettingsService()
+	current, err := s.GetSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Schema != GeminiSettingsFlat || current.AuthMode != "oauth-personal" || !current.UsageStatisticsEnabled {
+		t.Fatalf("settings = %+v", current)
+	}
+
+	if err := s.UpdateSettings(GeminiCLISettings{AuthMode: "bogus"}); err == nil {
+		t.Fatal("unknown auth mode should be rejected")
+	}
+	update := GeminiCLISettings{AuthMode: "gemini-api-key", BaseURL: "http://127.0.0.1:18100"}
+	if err := s.UpdateSettings(update); err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(settingsPath)
+	var written map[string]any
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if written["theme"] != "GitHub" || written["selectedAuthType"] != "gemini-api-key" || written["usageStatisticsEnabled"] != false {
+		t.Fatalf("settings.json = %s", data)
+	}
+	env, _ := os.ReadFile(envPath)
+	for _, want := range []string{"# mine", "FOO=bar", "GOOGLE_GEMINI_BASE_URL=http://127.0.0.1:18100", "GEMINI_API_KEY=code-switch"} {
+		if !strings.Contains(string(env), want) {
+			t.Fatalf(".env missing %q:\n%s", want, env)
+		}
+	}
+
+	// Clearing the base URL removes only that variable
+	update.BaseURL = ""
+	if err := s.UpdateSettings(update); err != nil {
+		t.Fatal(err)
+	}
+	env, _ = os.ReadFile(envPath)
+	if strings.Contains(string(env), "GOOGLE_GEMINI_BASE_URL") || !strings.Contains(string(env), "FOO=bar") {
+		t.Fatalf(".env after clear:\n%s", env)
+	}
+}
+
+func TestGeminiCLISettings_NestedSchema(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	settingsPath := filepath.Join(home, ".gemini", "settings.json")
+	writeGeminiTestFile(t, settingsPath, `{"security":{"auth":{"selectedType":"oauth-personal"}},"privacy":{"usageStatisticsEnabled":false}}`)
+
+	s := NewGeminiCLISettingsService()
+	current, err := s.GetSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Schema != GeminiSettingsNested || current.UsageStatisticsEnabled {
+		t.Fatalf("settings = %+v", current)
+	}
+	current.AuthMode = "gemini-api-key"
+	current.TelemetryEnabled = true
+	if err := s.UpdateSettings(current); err != nil {
+		t.Fatal(err)
+	}
+	settings, _, err := readGeminiSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nestedValue(settings, "security", "auth", "selectedType") != "gemini-api-key" || nestedValue(settings, "telemetry", "enabled") != true {
+		t.Fatalf("settings = %v", settings)
+	}
+	if _, ok := settings["selectedAuthType"]; ok {
+		t.Fatal("flat key written into nested settings")
+	}
+}
+
+func TestGeminiCLISettings_Extensions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	extDir := filepath.Join(home, ".gemini", "extensions")
+	writeGeminiTestFile(t, filepath.Join(extDir, "search", "gemini-extension.json"),
+		`{"name":"search","version":"1.2.0","mcpServers":{"web":{"command":"web-mcp"}},"contextFileName":"SEARCH.md"}`)
+	writeGeminiTestFile(t, filepath.Join(extDir, "broken", "gemini-extension.json"), `{`)
+
+	s := NewGeminiCLISettingsService()
+	exts, err := s.ListExtensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 1 || exts[0].Name != "search" || !exts[0].Enabled || exts[0].MCPServers[0] != "web" || exts[0].ContextFile != "SEARCH.md" {
+		t.Fatalf("extensions = %+v", exts)
+	}
+
+	if err := s.SetExtensionEnabled("search", false); err != nil {
+		t.Fatal(err)
+	}
+	exts, _ = s.ListExtensions()
+	if exts[0].Enabled {
+		t.Fatal("extension should be disabled")
+	}
+	if err := s.SetExtensionEnabled("search", true); err != nil {
+		t.Fatal(err)
+	}
+	settings, _, _ := readGeminiSettings()
+	if _, ok := settings["extensions"]; ok {
+		t.Fatalf("empty extensions table kept: %v", settings)
+	}
+	if err := s.SetExtensionEnabled("missing", false); err == nil {
+		t.Fatal("unknown extension should be rejected")
+	}
+}
+
+func TestGeminiCLISettings_CheckCompatibility(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the gemini binary")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	bin := filepath.Join(t.TempDir(), "gemini")
+	writeGeminiTestFile(t, bin, "#!/bin/sh\necho 0.2.1\n")
+	if err := os.Chmod(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	original := geminiBinary
+	geminiBinary = bin
+	t.Cleanup(func() { geminiBinary = original })
+
+	writeGeminiTestFile(t, filepath.Join(home, ".gemini", "settings.json"), `{"security":{"auth":{"selectedType":"oauth-personal"}}}`)
+	writeGeminiTestFile(t, filepath.Join(home, ".gemini", ".env"), "GOOGLE_GEMINI_BASE_URL=http://127.0.0.1:18100\n")
+
+	s := NewGeminiCLISettingsService()
+	result, err := s.CheckCompatibility()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Installed || result.Version != "0.2.1" || result.ExpectedSchema != GeminiSettingsFlat {
+		t.Fatalf("result = %+v", result)
+	}
+	// Schema mismatch, non api-key auth and unsupported relay actions
+	if len(result.Warnings) != 3 {
+		t.Fatalf("warnings = %v", result.Warnings)
+	}
+
+	geminiBinary = filepath.Join(t.TempDir(), "missing-gemini")
+	result, _ = s.CheckCompatibility()
+	if result.Installed || len(result.Warnings) == 0 {
+		t.Fatalf("missing binary result = %+v", result)
+	}
+}
@@ -0,0 +1,153 @@
+//go:build darwin
+
+package services
+
+/*
+#cgo LDFLAGS: -framework Carbon
+#include <Carbon/Carbon.h>
+#include <dispatch/dispatch.h>
+#include <pthread.h>
+
+extern void goHotkeyPressed(UInt32 id);
+
+static OSStatus hotkeyEventHandler(EventHandlerCallRef next, EventRef event, void *data) {
+	EventHotKeyID hotkeyID;
+	if (GetEventParameter(event, kEventParamDirectObject, typeEventHotKeyID, NULL, sizeof(hotkeyID), NULL, &hotkeyID) == noErr) {
+		goHotkeyPressed(hotkeyID.id);
+	}
+	return noErr;
+}
+
+// Carbon 热键需在主线程注册与注销
+static void runOnMainThread(dispatch_block_t block) {
+	if (pthread_main_np()) {
+		block();
+	} else {
+		dispatch_sync(dispatch_get_main_queue(), block);
+	}
+}
+
+static OSStatus registerHotkey(UInt32 id, UInt32 keyCode, UInt32 modifiers, EventHotKeyRef *ref) {
+	__block OSStatus status = noErr;
+	runOnMainThread(^{
+		static int handlerInstalled = 0;
+		if (!handlerInstalled) {
+			EventTypeSpec spec = { kEventClassKeyboard, kEventHotKeyPressed };
+			InstallApplicationEventHandler(&hotkeyEventHandler, 1, &spec, NULL, NULL);
+			handlerInstalled = 1;
+		}
+		EventHotKeyID hotkeyID = { 0x41494C53, id }; // 'AILS'
+		status = RegisterEventHotKey(keyCode, modifiers, hotkeyID, GetApplicationEventTarget(), 0, ref);
+	});
+	return status;
+}
+
+static OSStatus unregisterHotkey(EventHotKeyRef ref) {
+	__block OSStatus status = noErr;
+	runOnMainThread(^{
+		status = UnregisterEventHotKey(ref);
+	});
+	return status;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	darwinHotkeyMu      sync.Mutex
+	darwinHotkeyRefs    = make(map[int]C.EventHotKeyRef)
+	darwinHotkeyOnPress func(id int)
+)
+
+//export goHotkeyPressed
+func goHotkeyPressed(id C.UInt32) {
+	darwinHotkeyMu.Lock()
+	onPress := darwinHotkeyOnPress
+	darwinHotkeyMu.Unlock()
+	if onPress != nil {
+		go onPress(int(id))
+	}
+}
+
+// darwinHotkeyBackend 使用 Carbon RegisterEventHotKey，无需辅助功能权限
+type darwinHotkeyBackend struct{}
+
+func newHotkeyBackend(onPress func(id int)) hotkeyBackend {
+	darwinHotkeyMu.Lock()
+	darwinHotkeyOnPress = onPress
+	darwinHotkeyMu.Unlock()
+	return darwinHotkeyBackend{}
+}
+
+// Carbon 修饰键位
+const (
+	carbonCmdKey     = 1 << 8
+	carbonShiftKey   = 1 << 9
+	carbonOptionKey  = 1 << 11
+	carbonControlKey = 1 << 12
+
+	// eventHotKeyExistsErr 快捷键已被其他程序注册
+	eventHotKeyExistsErr = -9878
+)
+
+func (darwinHotkeyBackend) Register(id int, chord hotkeyChord) error {
+	keyCode, ok := darwinKeyCodes[chord.key]
+	if !ok {
+		return fmt.Errorf("unsupported key %q", chord.key)
+	}
+	var mods C.UInt32
+	if chord.mods&hotkeyModCtrl != 0 {
+		mods |= carbonControlKey
+	}
+	if chord.mods&hotkeyModAlt != 0 {
+		mods |= carbonOptionKey
+	}
+	if chord.mods&hotkeyModShift != 0 {
+		mods |= carbonShiftKey
+	}
+	if chord.mods&hotkeyModSuper != 0 {
+		mods |= carbonCmdKey
+	}
+
+	var ref C.EventHotKeyRef
+	status := C.registerHotkey(C.UInt32(id), C.UInt32(keyCode), mods, &ref)
+	switch {
+	case status == eventHotKeyExistsErr:
+		return errHotkeyInUse
+	case status != 0:
+		return fmt.Errorf("RegisterEventHotKey failed: %d", int(status))
+	}
+	darwinHotkeyMu.Lock()
+	darwinHotkeyRefs[id] = ref
+	darwinHotkeyMu.Unlock()
+	return nil
+}
+
+func (darwinHotkeyBackend) Unregister(id int) error {
+	darwinHotkeyMu.Lock()
+	ref, ok := darwinHotkeyRefs[id]
+	delete(darwinHotkeyRefs, id)
+	darwinHotkeyMu.Unlock()
+	if !ok {
+		return nil
+	}
+	if status := C.unregisterHotkey(ref); status != 0 {
+		return fmt.Errorf("UnregisterEventHotKey failed: %d", int(status))
+	}
+	return nil
+}
+
+// darwinKeyCodes 按键名对应的 macOS 虚拟键码（kVK_*）
+var darwinKeyCodes = map[string]int{
+	"A": 0x00, "S": 0x01, "D": 0x02, "F": 0x03, "H": 0x04, "G": 0x05, "Z": 0x06, "X": 0x07,
+	"C": 0x08, "V": 0x09, "B": 0x0B, "Q": 0x0C, "W": 0x0D, "E": 0x0E, "R": 0x0F, "Y": 0x10,
+	"T": 0x11, "1": 0x12, "2": 0x13, "3": 0x14, "4": 0x15, "6": 0x16, "5": 0x17, "9": 0x19,
+	"7": 0x1A, "8": 0x1C, "0": 0x1D, "O": 0x1F, "U": 0x20, "I": 0x22, "P": 0x23, "L": 0x25,
+	"J": 0x26, "K": 0x28, "N": 0x2D, "M": 0x2E, "Space": 0x31,
+	"F1": 0x7A, "F2": 0x78, "F3": 0x63, "F4": 0x76, "F5": 0x60, "F6": 0x61,
+	"F7": 0x62, "F8": 0x64, "F9": 0x65, "F10": 0x6D, "F11": 0x67, "F12": 0x6F,
+}
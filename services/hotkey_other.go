@@ -0,0 +1,8 @@
+//go:build !windows && !darwin
+
+package services
+
+// Linux 等系统暂无全局快捷键实现（Wayland 不允许应用注册全局快捷键），配置仍可保存
+func newHotkeyBackend(func(id int)) hotkeyBackend {
+	return unsupportedHotkeyBackend{}
+}
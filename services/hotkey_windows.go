@@ -0,0 +1,165 @@
+//go:build windows
+
+package services
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	hotkeyUser32               = syscall.NewLazyDLL("user32.dll")
+	hotkeyKernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procRegisterHotKey         = hotkeyUser32.NewProc("RegisterHotKey")
+	procUnregisterHotKey       = hotkeyUser32.NewProc("UnregisterHotKey")
+	procGetMessageW            = hotkeyUser32.NewProc("GetMessageW")
+	procPeekMessageW           = hotkeyUser32.NewProc("PeekMessageW")
+	procPostThreadMessageW     = hotkeyUser32.NewProc("PostThreadMessageW")
+	procHotkeyGetCurrentThread = hotkeyKernel32.NewProc("GetCurrentThreadId")
+)
+
+const (
+	winModAlt      = 0x0001
+	winModControl  = 0x0002
+	winModShift    = 0x0004
+	winModWin      = 0x0008
+	winModNoRepeat = 0x4000
+
+	wmHotkey = 0x0312
+	// wmHotkeyCall 唤醒消息循环执行排队的注册 / 注销调用
+	wmHotkeyCall = 0x8000 + 1 // WM_APP + 1
+	pmNoRemove   = 0x0000
+
+	errorHotkeyAlreadyRegistered = 1409
+)
+
+// winMsg 对应 Win32 MSG 结构
+type winMsg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	ptX     int32
+	ptY     int32
+}
+
+// windowsHotkeyBackend RegisterHotKey 的热键属于调用线程，注册、注销与消息循环都在同一个锁定的系统线程上执行
+type windowsHotkeyBackend struct {
+	once     sync.Once
+	threadID uintptr
+	calls    chan func()
+	onPress  func(id int)
+}
+
+func newHotkeyBackend(onPress func(id int)) hotkeyBackend {
+	return &windowsHotkeyBackend{calls: make(chan func(), 16), onPress: onPress}
+}
+
+// start 启动消息循环线程
+func (b *windowsHotkeyBackend) start() {
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		var msg winMsg
+		// 先创建线程消息队列，PostThreadMessage 才能投递成功
+		procPeekMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0, pmNoRemove)
+		b.threadID, _, _ = procHotkeyGetCurrentThread.Call()
+		close(ready)
+
+		for {
+			ret, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+			if int32(ret) <= 0 {
+				return
+			}
+			switch msg.message {
+			case wmHotkey:
+				go b.onPress(int(msg.wParam))
+			case wmHotkeyCall:
+				for drained := false; !drained; {
+					select {
+					case call := <-b.calls:
+						call()
+					default:
+						drained = true
+					}
+				}
+			}
+		}
+	}()
+	<-ready
+}
+
+// run 在消息循环线程上执行 fn 并等待完成
+func (b *windowsHotkeyBackend) run(fn func()) {
+	b.once.Do(b.start)
+	done := make(chan struct{})
+	b.calls <- func() {
+		fn()
+		close(done)
+	}
+	procPostThreadMessageW.Call(b.threadID, wmHotkeyCall, 0, 0)
+	<-done
+}
+
+func (b *windowsHotkeyBackend) Register(id int, chord hotkeyChord) error {
+	vk, ok := windowsVirtualKey(chord.key)
+	if !ok {
+		return fmt.Errorf("unsupported key %q", chord.key)
+	}
+	mods := uintptr(winModNoRepeat)
+	if chord.mods&hotkeyModCtrl != 0 {
+		mods |= winModControl
+	}
+	if chord.mods&hotkeyModAlt != 0 {
+		mods |= winModAlt
+	}
+	if chord.mods&hotkeyModShift != 0 {
+		mods |= winModShift
+	}
+	if chord.mods&hotkeyModSuper != 0 {
+		mods |= winModWin
+	}
+
+	var err error
+	b.run(func() {
+		ret, _, callErr := procRegisterHotKey.Call(0, uintptr(id), mods, vk)
+		if ret == 0 {
+			if errno, ok := callErr.(syscall.Errno); ok && errno == errorHotkeyAlreadyRegistered {
+				err = errHotkeyInUse
+			} else {
+				err = callErr
+			}
+		}
+	})
+	return err
+}
+
+func (b *windowsHotkeyBackend) Unregister(id int) error {
+	var err error
+	b.run(func() {
+		if ret, _, callErr := procUnregisterHotKey.Call(0, uintptr(id)); ret == 0 {
+			err = callErr
+		}
+	})
+	return err
+}
+
+// windowsVirtualKey 按键名转换为 Win32 虚拟键码
+func windowsVirtualKey(key string) (uintptr, bool) {
+	switch {
+	case len(key) == 1:
+		// 字母与数字的虚拟键码即其 ASCII 码
+		return uintptr(key[0]), true
+	case key == "Space":
+		return 0x20, true
+	case isFunctionKey(key):
+		var n int
+		fmt.Sscanf(key[1:], "%d", &n)
+		return uintptr(0x70 + n - 1), true // VK_F1 = 0x70
+	}
+	return 0, false
+}
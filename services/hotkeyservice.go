@@ -0,0 +1,409 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// 快捷键动作
+const (
+	HotkeyActionShowWindow    = "show_window"
+	HotkeyActionToggleProxy   = "toggle_proxy"
+	HotkeyActionCycleProvider = "cycle_provider"
+)
+
+var (
+	// errHotkeyUnsupported 当前系统没有全局快捷键后端
+	errHotkeyUnsupported = errors.New("global hotkeys are not supported on this platform")
+	// errHotkeyInUse 快捷键已被其他程序注册
+	errHotkeyInUse = errors.New("hotkey is already registered by another application")
+)
+
+// hotkeyModifier 修饰键位
+type hotkeyModifier uint8
+
+const (
+	hotkeyModCtrl hotkeyModifier = 1 << iota
+	hotkeyModAlt
+	hotkeyModShift
+	hotkeyModSuper // macOS 的 Cmd、Windows 的 Win 键
+)
+
+// hotkeyChord 解析后的快捷键组合，key 为规范化的按键名（A、1、F5、Space）
+type hotkeyChord struct {
+	mods hotkeyModifier
+	key  string
+}
+
+// String 返回规范化的快捷键字符串，用于冲突比较与展示
+func (c hotkeyChord) String() string {
+	parts := make([]string, 0, 5)
+	if c.mods&hotkeyModCtrl != 0 {
+		parts = append(parts, "Ctrl")
+	}
+	if c.mods&hotkeyModAlt != 0 {
+		parts = append(parts, "Alt")
+	}
+	if c.mods&hotkeyModShift != 0 {
+		parts = append(parts, "Shift")
+	}
+	if c.mods&hotkeyModSuper != 0 {
+		parts = append(parts, "Super")
+	}
+	return strings.Join(append(parts, c.key), "+")
+}
+
+// hotkeyBackend 各系统的全局快捷键注册实现，按键触发时以注册 ID 回调
+type hotkeyBackend interface {
+	Register(id int, chord hotkeyChord) error
+	Unregister(id int) error
+}
+
+// unsupportedHotkeyBackend 没有全局快捷键实现的系统
+type unsupportedHotkeyBackend struct{}
+
+func (unsupportedHotkeyBackend) Register(int, hotkeyChord) error { return errHotkeyUnsupported }
+func (unsupportedHotkeyBackend) Unregister(int) error            { return nil }
+
+// HotkeyBinding 快捷键配置；Accelerator 形如 CmdOrCtrl+Shift+A
+type HotkeyBinding struct {
+	Action      string `json:"action"`
+	Accelerator string `json:"accelerator"`
+	Enabled     bool   `json:"enabled"`
+	Platform    string `json:"platform,omitempty"` // cycle_provider 切换的平台，默认 claude
+}
+
+// HotkeyStatus 快捷键配置及注册结果
+type HotkeyStatus struct {
+	HotkeyBinding
+	Registered bool   `json:"registered"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DefaultHotkeyBindings 默认快捷键
+func DefaultHotkeyBindings() []HotkeyBinding {
+	return []HotkeyBinding{
+		{Action: HotkeyActionShowWindow, Accelerator: "CmdOrCtrl+Shift+A", Enabled: true},
+		{Action: HotkeyActionToggleProxy, Accelerator: "CmdOrCtrl+Shift+P", Enabled: true},
+		{Action: HotkeyActionCycleProvider, Accelerator: "CmdOrCtrl+Shift+N", Enabled: true, Platform: "claude"},
+	}
+}
+
+// reservedHotkeys 各系统保留的常用快捷键，注册后会覆盖系统行为
+var reservedHotkeys = map[string][]string{
+	"darwin":  {"Super+Q", "Super+W", "Super+H", "Super+M", "Super+Tab", "Super+Space", "Super+A", "Super+C", "Super+V", "Super+X", "Super+Z"},
+	"windows": {"Ctrl+A", "Ctrl+C", "Ctrl+V", "Ctrl+X", "Ctrl+Z", "Alt+Tab", "Alt+F4", "Super+D", "Super+L", "Super+E", "Super+R"},
+	"linux":   {"Ctrl+A", "Ctrl+C", "Ctrl+V", "Ctrl+X", "Ctrl+Z", "Alt+Tab", "Alt+F4", "Super+L"},
+}
+
+// HotkeyService 全局快捷键：显示主窗口、暂停 / 恢复转发、切换固定的 provider
+type HotkeyService struct {
+	mu       sync.Mutex
+	bindings []HotkeyBinding
+	status   map[string]HotkeyStatus
+	handlers map[string]func(HotkeyBinding)
+	backend  hotkeyBackend
+	started  bool
+}
+
+func NewHotkeyService() *HotkeyService {
+	hs := &HotkeyService{
+		bindings: DefaultHotkeyBindings(),
+		status:   make(map[string]HotkeyStatus),
+		handlers: make(map[string]func(HotkeyBinding)),
+	}
+	hs.backend = newHotkeyBackend(hs.trigger)
+	hs.loadBindings()
+	return hs
+}
+
+// hotkeyConfigPath 快捷键配置文件
+func hotkeyConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "hotkeys.json"), nil
+}
+
+// loadBindings 从 hotkeys.json 恢复配置，缺少的动作使用默认值
+func (hs *HotkeyService) loadBindings() {
+	path, err := hotkeyConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var saved []HotkeyBinding
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Printf("[Hotkey] 读取快捷键配置失败: %v\n", err)
+		return
+	}
+	hs.bindings = mergeHotkeyBindings(saved)
+}
+
+// mergeHotkeyBindings 按默认动作顺序合并配置，忽略未知动作
+func mergeHotkeyBindings(bindings []HotkeyBinding) []HotkeyBinding {
+	byAction := make(map[string]HotkeyBinding, len(bindings))
+	for _, b := range bindings {
+		byAction[b.Action] = b
+	}
+	merged := DefaultHotkeyBindings()
+	for i, def := range merged {
+		if b, ok := byAction[def.Action]; ok {
+			b.Accelerator = strings.TrimSpace(b.Accelerator)
+			if b.Action == HotkeyActionCycleProvider && b.Platform == "" {
+				b.Platform = def.Platform
+			}
+			merged[i] = b
+		}
+	}
+	return merged
+}
+
+// OnAction 设置快捷键触发时执行的动作
+func (hs *HotkeyService) OnAction(action string, handler func(HotkeyBinding)) {
+	hs.mu.Lock()
+	hs.handlers[action] = handler
+	hs.mu.Unlock()
+}
+
+// IsSupported 当前系统是否支持全局快捷键
+func (hs *HotkeyService) IsSupported() bool {
+	_, unsupported := hs.backend.(unsupportedHotkeyBackend)
+	return !unsupported
+}
+
+// Start 注册所有已启用的快捷键，需在应用启动完成后调用
+func (hs *HotkeyService) Start() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.started = true
+	hs.registerLocked()
+	return nil
+}
+
+// Stop 注销所有快捷键
+func (hs *HotkeyService) Stop() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.unregisterLocked()
+	hs.started = false
+	return nil
+}
+
+// GetHotkeys 获取快捷键配置及注册状态
+func (hs *HotkeyService) GetHotkeys() []HotkeyStatus {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	result := make([]HotkeyStatus, 0, len(hs.bindings))
+	for _, b := range hs.bindings {
+		status, ok := hs.status[b.Action]
+		if !ok {
+			status = HotkeyStatus{HotkeyBinding: b}
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// CheckHotkeyConflict 检查快捷键是否可用于指定动作，返回冲突说明，空字符串表示无冲突
+func (hs *HotkeyService) CheckHotkeyConflict(action, accelerator string) string {
+	hs.mu.Lock()
+	bindings := append([]HotkeyBinding(nil), hs.bindings...)
+	hs.mu.Unlock()
+
+	for i := range bindings {
+		if bindings[i].Action == action {
+			bindings[i].Accelerator = accelerator
+			bindings[i].Enabled = true
+		}
+	}
+	if err := validateHotkeyBindings(bindings, runtime.GOOS); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// SetHotkeys 保存快捷键配置并重新注册；存在冲突时不做修改
+func (hs *HotkeyService) SetHotkeys(bindings []HotkeyBinding) ([]HotkeyStatus, error) {
+	merged := mergeHotkeyBindings(bindings)
+	if err := validateHotkeyBindings(merged, runtime.GOOS); err != nil {
+		return nil, err
+	}
+
+	path, err := hotkeyConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+
+	hs.mu.Lock()
+	hs.unregisterLocked()
+	hs.bindings = merged
+	if hs.started {
+		hs.registerLocked()
+	}
+	hs.mu.Unlock()
+	return hs.GetHotkeys(), nil
+}
+
+// ResetHotkeys 恢复默认快捷键
+func (hs *HotkeyService) ResetHotkeys() ([]HotkeyStatus, error) {
+	return hs.SetHotkeys(DefaultHotkeyBindings())
+}
+
+// registerLocked 注册已启用的快捷键，注册结果记录到 status；调用方持有 hs.mu
+func (hs *HotkeyService) registerLocked() {
+	hs.status = make(map[string]HotkeyStatus, len(hs.bindings))
+	for i, b := range hs.bindings {
+		status := HotkeyStatus{HotkeyBinding: b}
+		if b.Enabled {
+			chord, err := parseAccelerator(b.Accelerator, runtime.GOOS)
+			if err == nil {
+				err = hs.backend.Register(i+1, chord)
+			}
+			if err != nil {
+				status.Error = err.Error()
+				fmt.Printf("[Hotkey] 注册快捷键 %s (%s) 失败: %v\n", b.Accelerator, b.Action, err)
+			} else {
+				status.Registered = true
+			}
+		}
+		hs.status[b.Action] = status
+	}
+}
+
+// unregisterLocked 注销已注册的快捷键；调用方持有 hs.mu
+func (hs *HotkeyService) unregisterLocked() {
+	for i, b := range hs.bindings {
+		if hs.status[b.Action].Registered {
+			if err := hs.backend.Unregister(i + 1); err != nil {
+				fmt.Printf("[Hotkey] 注销快捷键 %s 失败: %v\n", b.Accelerator, err)
+			}
+		}
+	}
+	hs.status = make(map[string]HotkeyStatus)
+}
+
+// trigger 后端回调：按注册 ID 执行对应动作
+func (hs *HotkeyService) trigger(id int) {
+	hs.mu.Lock()
+	if id < 1 || id > len(hs.bindings) {
+		hs.mu.Unlock()
+		return
+	}
+	binding := hs.bindings[id-1]
+	handler := hs.handlers[binding.Action]
+	hs.mu.Unlock()
+
+	if handler != nil {
+		handler(binding)
+	}
+}
+
+// validateHotkeyBindings 检查快捷键格式、系统保留快捷键以及动作之间的重复
+func validateHotkeyBindings(bindings []HotkeyBinding, goos string) error {
+	reserved := make(map[string]bool)
+	for _, r := range reservedHotkeys[goos] {
+		reserved[r] = true
+	}
+	used := make(map[string]string)
+	for _, b := range bindings {
+		if !b.Enabled {
+			continue
+		}
+		chord, err := parseAccelerator(b.Accelerator, goos)
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.Action, err)
+		}
+		key := chord.String()
+		if reserved[key] {
+			return fmt.Errorf("%s: %s is reserved by the system", b.Action, b.Accelerator)
+		}
+		if other, ok := used[key]; ok {
+			return fmt.Errorf("%s: %s is already used by %s", b.Action, b.Accelerator, other)
+		}
+		used[key] = b.Action
+	}
+	return nil
+}
+
+// parseAccelerator 解析快捷键字符串；CmdOrCtrl 在 macOS 上为 Cmd，其他系统为 Ctrl
+func parseAccelerator(accelerator, goos string) (hotkeyChord, error) {
+	var chord hotkeyChord
+	parts := strings.Split(accelerator, "+")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if i == len(parts)-1 {
+			key, ok := normalizeHotkeyKey(part)
+			if !ok {
+				return hotkeyChord{}, fmt.Errorf("unsupported key %q in %q", part, accelerator)
+			}
+			chord.key = key
+			break
+		}
+		switch strings.ToLower(part) {
+		case "cmdorctrl", "commandorcontrol":
+			if goos == "darwin" {
+				chord.mods |= hotkeyModSuper
+			} else {
+				chord.mods |= hotkeyModCtrl
+			}
+		case "ctrl", "control":
+			chord.mods |= hotkeyModCtrl
+		case "alt", "option":
+			chord.mods |= hotkeyModAlt
+		case "shift":
+			chord.mods |= hotkeyModShift
+		case "cmd", "command", "super", "meta", "win":
+			chord.mods |= hotkeyModSuper
+		default:
+			return hotkeyChord{}, fmt.Errorf("unsupported modifier %q in %q", part, accelerator)
+		}
+	}
+	// 全局快捷键至少需要一个修饰键（功能键除外），避免吞掉普通输入
+	if chord.mods == 0 && !isFunctionKey(chord.key) {
+		return hotkeyChord{}, fmt.Errorf("%q needs at least one modifier", accelerator)
+	}
+	return chord, nil
+}
+
+// isFunctionKey F1-F12
+func isFunctionKey(key string) bool {
+	return len(key) > 1 && key[0] == 'F' && key[1] >= '1' && key[1] <= '9'
+}
+
+// normalizeHotkeyKey 支持字母、数字、F1-F12 与 Space
+func normalizeHotkeyKey(key string) (string, bool) {
+	upper := strings.ToUpper(key)
+	switch {
+	case len(upper) == 1 && (upper[0] >= 'A' && upper[0] <= 'Z' || upper[0] >= '0' && upper[0] <= '9'):
+		return upper, true
+	case upper == "SPACE":
+		return "Space", true
+	case len(upper) >= 2 && upper[0] == 'F':
+		var n int
+		if _, err := fmt.Sscanf(upper[1:], "%d", &n); err == nil && n >= 1 && n <= 12 && fmt.Sprint(n) == upper[1:] {
+			return upper, true
+		}
+	}
+	return "", false
+}
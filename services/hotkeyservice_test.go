@@ -0,0 +1,140 @@
+package services
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeHotkeyBackend 记录注册的快捷键，taken 中的组合模拟被其他程序占用
+type fakeHotkeyBackend struct {
+	registered map[int]string
+	taken      map[string]bool
+}
+
+func (b *fakeHotkeyBackend) Register(id int, chord hotkeyChord) error {
+	if b.taken[chord.String()] {
+		return errHotkeyInUse
+	}
+	b.registered[id] = chord.String()
+	return nil
+}
+
+func (b *fakeHotkeyBackend) Unregister(id int) error {
+	delete(b.registered, id)
+	return nil
+}
+
+func TestParseAccelerator(t *testing.T) {
+	cases := []struct {
+		accelerator, goos, want string
+	}{
+		{"CmdOrCtrl+Shift+A", "darwin", "Shift+Super+A"},
+		{"CmdOrCtrl+Shift+a", "windows", "Ctrl+Shift+A"},
+		{"Option+Control+space", "darwin", "Ctrl+Alt+Space"},
+		{"F5", "linux", "F5"},
+		{"Alt+F12", "windows", "Alt+F12"},
+	}
+	for _, tc := range cases {
+		chord, err := parseAccelerator(tc.accelerator, tc.goos)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.accelerator, err)
+		}
+		if chord.String() != tc.want {
+			t.Fatalf("%s on %s: got %s, want %s", tc.accelerator, tc.goos, chord, tc.want)
+		}
+	}
+	for _, bad := range []string{"A", "F", "Ctrl+F13", "Hyper+A", "Ctrl+Shift+", "Ctrl+Enter"} {
+		if _, err := parseAccelerator(bad, "windows"); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestValidateHotkeyBindingsConflicts(t *testing.T) {
+	bindings := DefaultHotkeyBindings()
+	if err := validateHotkeyBindings(bindings, "darwin"); err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+
+	bindings[1].Accelerator = "Cmd+Shift+A" // 与 show_window 的 CmdOrCtrl+Shift+A 在 macOS 上相同
+	err := validateHotkeyBindings(bindings, "darwin")
+	if err == nil || !strings.Contains(err.Error(), HotkeyActionShowWindow) {
+		t.Fatalf("expected duplicate conflict, got %v", err)
+	}
+	// Windows 上 Cmd 为 Win 键，不与 Ctrl 冲突
+	if err := validateHotkeyBindings(bindings, "windows"); err != nil {
+		t.Fatalf("unexpected conflict on windows: %v", err)
+	}
+
+	bindings = DefaultHotkeyBindings()
+	bindings[0].Accelerator = "CmdOrCtrl+Q"
+	if err := validateHotkeyBindings(bindings, "darwin"); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Fatalf("expected reserved shortcut error, got %v", err)
+	}
+	// 禁用的快捷键不参与检查
+	bindings[0].Enabled = false
+	if err := validateHotkeyBindings(bindings, "darwin"); err != nil {
+		t.Fatalf("disabled binding should be ignored: %v", err)
+	}
+}
+
+func TestHotkeyServiceRegisterAndPersist(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	backend := &fakeHotkeyBackend{registered: make(map[int]string), taken: map[string]bool{}}
+	hs := NewHotkeyService()
+	hs.backend = backend
+
+	var triggered []string
+	hs.OnAction(HotkeyActionCycleProvider, func(b HotkeyBinding) { triggered = append(triggered, b.Platform) })
+
+	if err := hs.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.registered) != 3 {
+		t.Fatalf("expected 3 registered hotkeys, got %v", backend.registered)
+	}
+
+	// 被其他程序占用的快捷键记录错误，其余正常注册
+	taken, _ := parseAccelerator("CmdOrCtrl+Alt+P", runtime.GOOS)
+	backend.taken[taken.String()] = true
+	bindings := DefaultHotkeyBindings()
+	bindings[1].Accelerator = "CmdOrCtrl+Alt+P"
+	bindings[2].Platform = "codex"
+	status, err := hs.SetHotkeys(bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status[0].Registered || status[1].Registered || status[1].Error != errHotkeyInUse.Error() || !status[2].Registered {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if len(backend.registered) != 2 {
+		t.Fatalf("expected 2 registered hotkeys after update, got %v", backend.registered)
+	}
+
+	hs.trigger(3)
+	if len(triggered) != 1 || triggered[0] != "codex" {
+		t.Fatalf("expected cycle_provider for codex, got %v", triggered)
+	}
+
+	if msg := hs.CheckHotkeyConflict(HotkeyActionShowWindow, "CmdOrCtrl+Shift+N"); !strings.Contains(msg, HotkeyActionCycleProvider) {
+		t.Fatalf("expected conflict with cycle_provider, got %q", msg)
+	}
+	if _, err := hs.SetHotkeys([]HotkeyBinding{{Action: HotkeyActionShowWindow, Accelerator: "CmdOrCtrl+Shift+N", Enabled: true}}); err == nil {
+		t.Fatal("expected SetHotkeys to reject conflicting bindings")
+	}
+
+	// 重启后读取已保存的配置
+	restored := NewHotkeyService()
+	got := restored.GetHotkeys()
+	if got[1].Accelerator != "CmdOrCtrl+Alt+P" || got[2].Platform != "codex" {
+		t.Fatalf("expected saved bindings, got %+v", got)
+	}
+
+	if err := hs.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.registered) != 0 {
+		t.Fatalf("expected all hotkeys unregistered, got %v", backend.registered)
+	}
+}
@@ -34,7 +34,7 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 	if limit > 1000 {
 		limit = 1000
 	}
-	model := xdb.New("request_log")
+	model := analyticsModel("request_log")
 	options := []xdb.Option{
 		xdb.OrderByDesc("id"),
 		xdb.Limit(limit),
@@ -53,6 +53,10 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 	for _, record := range records {
 		logEntry := ReqeustLog{
 			ID:                record.GetInt64("id"),
+			ConversationID:    record.GetString("conversation_id"),
+			Project:           record.GetString("project"),
+			Tags:              record.GetString("tags"),
+			AppName:           record.GetString("app_name"),
 			Platform:          record.GetString("platform"),
 			Model:             record.GetString("model"),
 			Provider:          record.GetString("provider"),
@@ -65,6 +69,11 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 			CreatedAt:         record.GetString("created_at"),
 			IsStream:          record.GetBool("is_stream"),
 			DurationSec:       record.GetFloat64("duration_sec"),
+			TTFBSec:           record.GetFloat64("ttfb_sec"),
+			TTFTSec:           record.GetFloat64("ttft_sec"),
+			TokensPerSec:      record.GetFloat64("tokens_per_sec"),
+			RequestBytes:      record.GetInt64("request_bytes"),
+			ResponseBytes:     record.GetInt64("response_bytes"),
 		}
 		ls.decorateCost(&logEntry)
 		logs = append(logs, logEntry)
@@ -73,7 +82,7 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 }
 
 func (ls *LogService) ListProviders(platform string) ([]string, error) {
-	model := xdb.New("request_log")
+	model := analyticsModel("request_log")
 	options := []xdb.Option{
 		xdb.Field("DISTINCT provider as provider"),
 		xdb.WhereNotEq("provider", ""),
@@ -104,34 +113,33 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 	if totalHours <= 0 {
 		totalHours = 24
 	}
-	rangeStart := startOfHour(time.Now())
+	loc := statsLocation()
+	rangeStart := startOfHour(statsNow())
 	if totalHours > 1 {
 		rangeStart = rangeStart.Add(-time.Duration(totalHours-1) * time.Hour)
 	}
 
-	db, err := xdb.DB("default")
+	db, err := analyticsDB()
 	if err != nil {
 		return nil, err
 	}
 
-	// 使用 SQL GROUP BY 按小时聚合，替代 Go 手动聚合
-	// strftime('%m-%d %H', created_at) 将时间格式化为 "月-日 时" 格式
+	// 完整小时读汇总表，当前小时回退到原始日志；SQL 按 UTC 桶聚合，再按统计时区的 "月-日 时" 归并
+	source, args := statsUsageSource(db, rangeStart, rollupOpenEnd)
 	query := `
 		SELECT
-			strftime('%m-%d %H', created_at) as hour_bucket,
-			COUNT(*) as total_requests,
+			bucket,
+			SUM(requests) as total_requests,
 			COALESCE(SUM(input_tokens), 0) as input_tokens,
 			COALESCE(SUM(output_tokens), 0) as output_tokens,
 			COALESCE(SUM(reasoning_tokens), 0) as reasoning_tokens,
 			COALESCE(SUM(total_cost), 0) as total_cost
-		FROM request_log
-		WHERE created_at >= ?
-		GROUP BY strftime('%m-%d %H', created_at)
-		ORDER BY created_at DESC
-		LIMIT ?
+		FROM ` + source + `
+		WHERE bucket IS NOT NULL
+		GROUP BY bucket
 	`
 
-	rows, err := db.Query(query, rangeStart.Format(timeLayout), totalHours)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		if isNoSuchTableErr(err) {
 			return []HeatmapStat{}, nil
@@ -140,11 +148,13 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 	}
 	defer rows.Close()
 
-	stats := make([]HeatmapStat, 0)
+	buckets := make(map[string]*HeatmapStat)
+	latest := make(map[string]time.Time)
 	for rows.Next() {
+		var hour string
 		var stat HeatmapStat
 		err := rows.Scan(
-			&stat.Day,
+			&hour,
 			&stat.TotalRequests,
 			&stat.InputTokens,
 			&stat.OutputTokens,
@@ -154,55 +164,92 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 		if err != nil {
 			return nil, err
 		}
-		stats = append(stats, stat)
+		hourTime, ok := parseRollupTime(hour)
+		if !ok {
+			continue
+		}
+		stat.Day = hourTime.In(loc).Format("01-02 15")
+		bucket := buckets[stat.Day]
+		if bucket == nil {
+			bucket = &HeatmapStat{Day: stat.Day}
+			buckets[stat.Day] = bucket
+		}
+		bucket.TotalRequests += stat.TotalRequests
+		bucket.InputTokens += stat.InputTokens
+		bucket.OutputTokens += stat.OutputTokens
+		bucket.ReasoningTokens += stat.ReasoningTokens
+		bucket.TotalCost += stat.TotalCost
+		if hourTime.After(latest[stat.Day]) {
+			latest[stat.Day] = hourTime
+		}
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
+	// 最近的小时在前，最多 totalHours 个
+	stats := make([]HeatmapStat, 0, len(buckets))
+	for _, bucket := range buckets {
+		stats = append(stats, *bucket)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return latest[stats[i].Day].After(latest[stats[j].Day])
+	})
+	if len(stats) > totalHours {
+		stats = stats[:totalHours]
+	}
+
 	return stats, nil
 }
 
 func (ls *LogService) StatsSince(platform string) (LogStats, error) {
-	const seriesHours = 24
+	// 统计时区的今天；夏令时切换日为 23 或 25 个小时
+	seriesStart := startOfDay(statsNow())
+	seriesEnd := nextStartOfDay(seriesStart)
+	seriesHours := int(seriesEnd.Sub(seriesStart) / time.Hour)
 
 	stats := LogStats{
 		Series: make([]LogStatsSeries, 0, seriesHours),
 	}
-	now := time.Now()
-	model := xdb.New("request_log")
-	seriesStart := startOfDay(now)
-	seriesEnd := seriesStart.Add(seriesHours * time.Hour)
-	queryStart := seriesStart.Add(-24 * time.Hour)
-	summaryStart := seriesStart
-	options := []xdb.Option{
-		xdb.WhereGte("created_at", queryStart.Format(timeLayout)),
-		xdb.Field(
-			"input_tokens",
-			"output_tokens",
-			"reasoning_tokens",
-			"cache_create_tokens",
-			"cache_read_tokens",
-			"input_cost",
-			"output_cost",
-			"cache_create_cost",
-			"cache_read_cost",
-			"total_cost",
-			"created_at",
-		),
-		xdb.OrderByAsc("created_at"),
+
+	db, err := analyticsDB()
+	if err != nil {
+		return stats, err
 	}
+	// 已结束的小时读汇总表，当前小时回退到原始日志
+	source, args := statsUsageSource(db, seriesStart, seriesEnd)
+	query := `
+		SELECT
+			bucket,
+			SUM(requests),
+			SUM(input_tokens),
+			SUM(output_tokens),
+			SUM(reasoning_tokens),
+			SUM(cache_create_tokens),
+			SUM(cache_read_tokens),
+			SUM(input_cost),
+			SUM(output_cost),
+			SUM(cache_create_cost),
+			SUM(cache_read_cost),
+			SUM(total_cost),
+			SUM(request_bytes),
+			SUM(response_bytes)
+		FROM ` + source + `
+		WHERE bucket IS NOT NULL`
 	if platform != "" {
-		options = append(options, xdb.WhereEq("platform", platform))
+		query += " AND platform = ?"
+		args = append(args, platform)
 	}
-	records, err := model.Selects(options...)
+	query += " GROUP BY bucket"
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+		if isNoSuchTableErr(err) {
 			return stats, nil
 		}
 		return stats, err
 	}
+	defer rows.Close()
 
 	seriesBuckets := make([]*LogStatsSeries, seriesHours)
 	for i := 0; i < seriesHours; i++ {
@@ -212,67 +259,67 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 		}
 	}
 
-	for _, record := range records {
-		createdAt, hasTime := parseCreatedAt(record)
-		dayKey := dayFromTimestamp(record.GetString("created_at"))
-		isToday := dayKey == seriesStart.Format("2006-01-02")
-
-		if hasTime {
-			if createdAt.Before(seriesStart) || !createdAt.Before(seriesEnd) {
-				continue
-			}
-		} else {
-			if !isToday {
-				continue
-			}
-			createdAt = seriesStart
-		}
-
-		bucketIndex := 0
-		if hasTime {
-			bucketIndex = int(createdAt.Sub(seriesStart) / time.Hour)
-			if bucketIndex < 0 {
-				bucketIndex = 0
-			}
-			if bucketIndex >= seriesHours {
-				bucketIndex = seriesHours - 1
-			}
+	for rows.Next() {
+		var hour string
+		var row LogStatsSeries
+		var inputCost, outputCost, cacheCreateCost, cacheReadCost float64
+		if err := rows.Scan(
+			&hour,
+			&row.TotalRequests,
+			&row.InputTokens,
+			&row.OutputTokens,
+			&row.ReasoningTokens,
+			&row.CacheCreateTokens,
+			&row.CacheReadTokens,
+			&inputCost,
+			&outputCost,
+			&cacheCreateCost,
+			&cacheReadCost,
+			&row.TotalCost,
+			&row.RequestBytes,
+			&row.ResponseBytes,
+		); err != nil {
+			return stats, err
 		}
-		bucket := seriesBuckets[bucketIndex]
-		input := record.GetInt("input_tokens")
-		output := record.GetInt("output_tokens")
-		reasoning := record.GetInt("reasoning_tokens")
-		cacheCreate := record.GetInt("cache_create_tokens")
-		cacheRead := record.GetInt("cache_read_tokens")
-		// 直接读取数据库中已存储的价格，避免重复计算
-		inputCost := record.GetFloat64("input_cost")
-		outputCost := record.GetFloat64("output_cost")
-		cacheCreateCost := record.GetFloat64("cache_create_cost")
-		cacheReadCost := record.GetFloat64("cache_read_cost")
-		totalCost := record.GetFloat64("total_cost")
-
-		bucket.TotalRequests++
-		bucket.InputTokens += int64(input)
-		bucket.OutputTokens += int64(output)
-		bucket.ReasoningTokens += int64(reasoning)
-		bucket.CacheCreateTokens += int64(cacheCreate)
-		bucket.CacheReadTokens += int64(cacheRead)
-		bucket.TotalCost += totalCost
-
-		if createdAt.IsZero() || createdAt.Before(summaryStart) {
+		// 汇总桶为 UTC 时间，按与今天零点的绝对时长换算小时序号
+		hourTime, ok := parseRollupTime(hour)
+		if !ok {
 			continue
 		}
-		stats.TotalRequests++
-		stats.InputTokens += int64(input)
-		stats.OutputTokens += int64(output)
-		stats.ReasoningTokens += int64(reasoning)
-		stats.CacheCreateTokens += int64(cacheCreate)
-		stats.CacheReadTokens += int64(cacheRead)
+		bucketIndex := int(hourTime.Sub(seriesStart) / time.Hour)
+		if bucketIndex < 0 {
+			bucketIndex = 0
+		}
+		if bucketIndex >= seriesHours {
+			bucketIndex = seriesHours - 1
+		}
+		bucket := seriesBuckets[bucketIndex]
+		bucket.TotalRequests += row.TotalRequests
+		bucket.InputTokens += row.InputTokens
+		bucket.OutputTokens += row.OutputTokens
+		bucket.ReasoningTokens += row.ReasoningTokens
+		bucket.CacheCreateTokens += row.CacheCreateTokens
+		bucket.CacheReadTokens += row.CacheReadTokens
+		bucket.TotalCost += row.TotalCost
+		bucket.RequestBytes += row.RequestBytes
+		bucket.ResponseBytes += row.ResponseBytes
+
+		stats.TotalRequests += row.TotalRequests
+		stats.InputTokens += row.InputTokens
+		stats.OutputTokens += row.OutputTokens
+		stats.ReasoningTokens += row.ReasoningTokens
+		stats.CacheCreateTokens += row.CacheCreateTokens
+		stats.CacheReadTokens += row.CacheReadTokens
 		stats.CostInput += inputCost
 		stats.CostOutput += outputCost
 		stats.CostCacheCreate += cacheCreateCost
 		stats.CostCacheRead += cacheReadCost
-		stats.CostTotal += totalCost
+		stats.CostTotal += row.TotalCost
+		stats.RequestBytes += row.RequestBytes
+		stats.ResponseBytes += row.ResponseBytes
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
 	}
 
 	for i := 0; i < seriesHours; i++ {
@@ -290,10 +337,15 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 }
 
 func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat, error) {
-	start := startOfDay(time.Now())
-	end := start.Add(24 * time.Hour)
+	return ls.ProviderDailyStatsByProject(platform, "")
+}
+
+// ProviderDailyStatsByProject 今日各 provider 用量，可按成本归属项目过滤
+func (ls *LogService) ProviderDailyStatsByProject(platform string, project string) ([]ProviderDailyStat, error) {
+	start := startOfDay(statsNow())
+	end := nextStartOfDay(start)
 
-	db, err := xdb.DB("default")
+	db, err := analyticsDB()
 	if err != nil {
 		return nil, err
 	}
@@ -310,16 +362,22 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 			COALESCE(SUM(reasoning_tokens), 0) as reasoning_tokens,
 			COALESCE(SUM(cache_create_tokens), 0) as cache_create_tokens,
 			COALESCE(SUM(cache_read_tokens), 0) as cache_read_tokens,
-			COALESCE(SUM(total_cost), 0) as cost_total
+			COALESCE(SUM(total_cost), 0) as cost_total,
+			COALESCE(SUM(request_bytes), 0) as request_bytes,
+			COALESCE(SUM(response_bytes), 0) as response_bytes
 		FROM request_log
 		WHERE created_at >= ? AND created_at < ?
 	`
-	args := []interface{}{start.Format(timeLayout), end.Format(timeLayout)}
+	args := []interface{}{start.UTC().Format(timeLayout), end.UTC().Format(timeLayout)}
 
 	if platform != "" {
 		query += " AND platform = ?"
 		args = append(args, platform)
 	}
+	if project != "" {
+		query += " AND project = ?"
+		args = append(args, project)
+	}
 
 	query += `
 		GROUP BY COALESCE(NULLIF(TRIM(provider), ''), '(unknown)')
@@ -349,6 +407,8 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 			&stat.CacheCreateTokens,
 			&stat.CacheReadTokens,
 			&stat.CostTotal,
+			&stat.RequestBytes,
+			&stat.ResponseBytes,
 		)
 		if err != nil {
 			return nil, err
@@ -491,6 +551,8 @@ type LogStats struct {
 	CostOutput        float64          `json:"cost_output"`
 	CostCacheCreate   float64          `json:"cost_cache_create"`
 	CostCacheRead     float64          `json:"cost_cache_read"`
+	RequestBytes      int64            `json:"request_bytes"`
+	ResponseBytes     int64            `json:"response_bytes"`
 	Series            []LogStatsSeries `json:"series"`
 }
 
@@ -506,6 +568,8 @@ type ProviderDailyStat struct {
 	CacheCreateTokens int64   `json:"cache_create_tokens"`
 	CacheReadTokens   int64   `json:"cache_read_tokens"`
 	CostTotal         float64 `json:"cost_total"`
+	RequestBytes      int64   `json:"request_bytes"`
+	ResponseBytes     int64   `json:"response_bytes"`
 }
 
 type LogStatsSeries struct {
@@ -517,6 +581,8 @@ type LogStatsSeries struct {
 	CacheCreateTokens int64   `json:"cache_create_tokens"`
 	CacheReadTokens   int64   `json:"cache_read_tokens"`
 	TotalCost         float64 `json:"total_cost"`
+	RequestBytes      int64   `json:"request_bytes"`
+	ResponseBytes     int64   `json:"response_bytes"`
 }
 
 // CostAnalysis 成本深度分析结构
@@ -532,6 +598,8 @@ type CostAnalysis struct {
 	CostTrend            []DailyCostPoint `json:"cost_trend"`
 	TrendDirection       string           `json:"trend_direction"`
 	TrendPercentage      float64          `json:"trend_percentage"`
+	// Anthropic prompt cache 命中分析与优化建议
+	PromptCache PromptCacheAnalysis `json:"prompt_cache"`
 }
 
 type DailyCostPoint struct {
@@ -548,6 +616,16 @@ type PerformanceAnalysis struct {
 	DurationAvg         float64                   `json:"duration_avg"`
 	DurationMin         float64                   `json:"duration_min"`
 	DurationMax         float64                   `json:"duration_max"`
+	TTFBP50             float64                   `json:"ttfb_p50"`
+	TTFBP95             float64                   `json:"ttfb_p95"`
+	TTFBP99             float64                   `json:"ttfb_p99"`
+	TTFTP50             float64                   `json:"ttft_p50"`
+	TTFTP95             float64                   `json:"ttft_p95"`
+	TTFTP99             float64                   `json:"ttft_p99"`
+	TTFTAvg             float64                   `json:"ttft_avg"`
+	TokensPerSecP50     float64                   `json:"tokens_per_sec_p50"`
+	TokensPerSecP95     float64                   `json:"tokens_per_sec_p95"`
+	TokensPerSecAvg     float64                   `json:"tokens_per_sec_avg"`
 	ErrorDistribution   map[string]int64          `json:"error_distribution"`
 	TotalErrors         int64                     `json:"total_errors"`
 	ErrorRate           float64                   `json:"error_rate"`
@@ -555,13 +633,18 @@ type PerformanceAnalysis struct {
 }
 
 type ProviderReliabilityStat struct {
-	Provider      string           `json:"provider"`
-	TotalRequests int64            `json:"total_requests"`
-	SuccessCount  int64            `json:"success_count"`
-	FailCount     int64            `json:"fail_count"`
-	SuccessRate   float64          `json:"success_rate"`
-	AvgDuration   float64          `json:"avg_duration"`
-	ErrorTypes    map[string]int64 `json:"error_types"`
+	Provider        string           `json:"provider"`
+	TotalRequests   int64            `json:"total_requests"`
+	SuccessCount    int64            `json:"success_count"`
+	FailCount       int64            `json:"fail_count"`
+	SuccessRate     float64          `json:"success_rate"`
+	AvgDuration     float64          `json:"avg_duration"`
+	AvgTTFT         float64          `json:"avg_ttft"`           // 仅统计流式请求
+	AvgTokensPerSec float64          `json:"avg_tokens_per_sec"` // 仅统计流式请求
+	AvgQualityScore float64          `json:"avg_quality_score"` // 响应质量评分的平均分（0-1）
+	QualitySamples  int64            `json:"quality_samples"`
+	ErrorTypes      map[string]int64 `json:"error_types"`
+	SLO             *ProviderSLOStatus `json:"slo,omitempty"` // 设置了 SLO 时的达标情况与错误预算
 }
 
 // CostAnalysis 返回成本深度分析数据
@@ -574,53 +657,86 @@ func (ls *LogService) CostAnalysis(platform string, days int) (CostAnalysis, err
 		CostTrend: make([]DailyCostPoint, 0, days),
 	}
 
-	now := time.Now()
-	startDate := startOfDay(now).Add(-time.Duration(days-1) * 24 * time.Hour)
+	loc := statsLocation()
+	startDate := startOfDay(statsNow()).AddDate(0, 0, -(days - 1))
 
-	model := xdb.New("request_log")
-	options := []xdb.Option{
-		xdb.WhereGte("created_at", startDate.Format(timeLayout)),
-		xdb.Field(
-			"input_cost",
-			"output_cost",
-			"cache_create_cost",
-			"cache_read_cost",
-			"total_cost",
-			"cache_read_tokens",
-			"input_tokens",
-			"created_at",
-		),
+	db, err := analyticsDB()
+	if err != nil {
+		return result, err
 	}
+
+	// 使用 SQL GROUP BY 按 UTC 小时聚合（已结束的小时读汇总表），再按统计时区归并到自然日
+	source, args := statsUsageSource(db, startDate, rollupOpenEnd)
+	query := `
+		SELECT
+			bucket,
+			COALESCE(SUM(requests), 0) as requests,
+			COALESCE(SUM(total_cost), 0) as total_cost,
+			COALESCE(SUM(input_cost), 0) as input_cost,
+			COALESCE(SUM(output_cost), 0) as output_cost,
+			COALESCE(SUM(cache_create_cost), 0) as cache_create_cost,
+			COALESCE(SUM(cache_read_cost), 0) as cache_read_cost,
+			COALESCE(SUM(cache_read_tokens), 0) as cache_read_tokens,
+			COALESCE(SUM(input_tokens), 0) as input_tokens
+		FROM ` + source + `
+		WHERE bucket IS NOT NULL`
 	if platform != "" {
-		options = append(options, xdb.WhereEq("platform", platform))
+		query += " AND platform = ?"
+		args = append(args, platform)
 	}
+	query += " GROUP BY bucket"
 
-	records, err := model.Selects(options...)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+		if isNoSuchTableErr(err) {
 			return result, nil
 		}
 		return result, err
 	}
+	defer rows.Close()
 
 	var totalInputCost, totalOutputCost, totalCacheCreateCost, totalCacheReadCost float64
 	var totalCacheReadTokens, totalInputTokens int64
 	dailyMap := make(map[string]*DailyCostPoint)
 
-	for _, record := range records {
-		totalInputCost += record.GetFloat64("input_cost")
-		totalOutputCost += record.GetFloat64("output_cost")
-		totalCacheCreateCost += record.GetFloat64("cache_create_cost")
-		totalCacheReadCost += record.GetFloat64("cache_read_cost")
-		totalCacheReadTokens += int64(record.GetInt("cache_read_tokens"))
-		totalInputTokens += int64(record.GetInt("input_tokens"))
-
-		dayKey := dayFromTimestamp(record.GetString("created_at"))
+	for rows.Next() {
+		var hour string
+		var point DailyCostPoint
+		var inputCost, outputCost, cacheCreateCost, cacheReadCost float64
+		var cacheReadTokens, inputTokens int64
+		if err := rows.Scan(
+			&hour,
+			&point.Requests,
+			&point.TotalCost,
+			&inputCost,
+			&outputCost,
+			&cacheCreateCost,
+			&cacheReadCost,
+			&cacheReadTokens,
+			&inputTokens,
+		); err != nil {
+			return result, err
+		}
+		totalInputCost += inputCost
+		totalOutputCost += outputCost
+		totalCacheCreateCost += cacheCreateCost
+		totalCacheReadCost += cacheReadCost
+		totalCacheReadTokens += cacheReadTokens
+		totalInputTokens += inputTokens
+
+		hourTime, ok := parseRollupTime(hour)
+		if !ok {
+			continue
+		}
+		dayKey := hourTime.In(loc).Format("2006-01-02")
 		if dailyMap[dayKey] == nil {
 			dailyMap[dayKey] = &DailyCostPoint{Day: dayKey}
 		}
-		dailyMap[dayKey].TotalCost += record.GetFloat64("total_cost")
-		dailyMap[dayKey].Requests++
+		dailyMap[dayKey].TotalCost += point.TotalCost
+		dailyMap[dayKey].Requests += point.Requests
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
 	}
 
 	totalCost := totalInputCost + totalOutputCost + totalCacheCreateCost + totalCacheReadCost
@@ -641,9 +757,14 @@ func (ls *LogService) CostAnalysis(platform string, days int) (CostAnalysis, err
 		}
 	}
 
+	promptCache, err := analyzePromptCache(db, platform, startDate)
+	if err != nil && !isNoSuchTableErr(err) {
+		return result, err
+	}
+	result.PromptCache = promptCache
+
 	for i := 0; i < days; i++ {
-		dayTime := startDate.Add(time.Duration(i) * 24 * time.Hour)
-		dayKey := dayTime.Format("2006-01-02")
+		dayKey := startDate.AddDate(0, 0, i).Format("2006-01-02")
 		point := dailyMap[dayKey]
 		if point == nil {
 			point = &DailyCostPoint{Day: dayKey}
@@ -697,15 +818,18 @@ func (ls *LogService) PerformanceAnalysis(platform string, days int) (Performanc
 		ProviderReliability: make([]ProviderReliabilityStat, 0),
 	}
 
-	startDate := startOfDay(time.Now()).Add(-time.Duration(days-1) * 24 * time.Hour)
+	startDate := startOfDay(statsNow()).AddDate(0, 0, -(days - 1))
 
-	model := xdb.New("request_log")
+	model := analyticsModel("request_log")
 	options := []xdb.Option{
-		xdb.WhereGte("created_at", startDate.Format(timeLayout)),
+		xdb.WhereGte("created_at", startDate.UTC().Format(timeLayout)),
 		xdb.Field(
 			"provider",
 			"http_code",
 			"duration_sec",
+			"ttfb_sec",
+			"ttft_sec",
+			"tokens_per_sec",
 			"error_type",
 		),
 	}
@@ -722,7 +846,14 @@ func (ls *LogService) PerformanceAnalysis(platform string, days int) (Performanc
 	}
 
 	durations := make([]float64, 0, len(records))
+	var ttfbs, ttfts, throughputs []float64
 	providerMap := make(map[string]*ProviderReliabilityStat)
+	// 各 provider 的 TTFT / 吞吐样本（只计非零值）
+	type streamSamples struct {
+		ttftSum, tpsSum float64
+		ttftN, tpsN     int
+	}
+	providerStream := make(map[string]*streamSamples)
 	var totalRequests int64
 
 	for _, record := range records {
@@ -732,6 +863,18 @@ func (ls *LogService) PerformanceAnalysis(platform string, days int) (Performanc
 		if duration > 0 {
 			durations = append(durations, duration)
 		}
+		ttfb := record.GetFloat64("ttfb_sec")
+		if ttfb > 0 {
+			ttfbs = append(ttfbs, ttfb)
+		}
+		ttft := record.GetFloat64("ttft_sec")
+		if ttft > 0 {
+			ttfts = append(ttfts, ttft)
+		}
+		tps := record.GetFloat64("tokens_per_sec")
+		if tps > 0 {
+			throughputs = append(throughputs, tps)
+		}
 
 		httpCode := record.GetInt("http_code")
 		errorType := record.GetString("error_type")
@@ -765,6 +908,21 @@ func (ls *LogService) PerformanceAnalysis(platform string, days int) (Performanc
 		if duration > 0 {
 			stat.AvgDuration = (stat.AvgDuration*float64(stat.TotalRequests-1) + duration) / float64(stat.TotalRequests)
 		}
+		if ttft > 0 || tps > 0 {
+			samples := providerStream[provider]
+			if samples == nil {
+				samples = &streamSamples{}
+				providerStream[provider] = samples
+			}
+			if ttft > 0 {
+				samples.ttftSum += ttft
+				samples.ttftN++
+			}
+			if tps > 0 {
+				samples.tpsSum += tps
+				samples.tpsN++
+			}
+		}
 	}
 
 	if len(durations) > 0 {
@@ -783,14 +941,59 @@ func (ls *LogService) PerformanceAnalysis(platform string, days int) (Performanc
 		result.DurationAvg = sum / float64(n)
 	}
 
+	if len(ttfbs) > 0 {
+		sort.Float64s(ttfbs)
+		result.TTFBP50 = percentile(ttfbs, 0.50)
+		result.TTFBP95 = percentile(ttfbs, 0.95)
+		result.TTFBP99 = percentile(ttfbs, 0.99)
+	}
+	if len(ttfts) > 0 {
+		sort.Float64s(ttfts)
+		result.TTFTP50 = percentile(ttfts, 0.50)
+		result.TTFTP95 = percentile(ttfts, 0.95)
+		result.TTFTP99 = percentile(ttfts, 0.99)
+		result.TTFTAvg = average(ttfts)
+	}
+	if len(throughputs) > 0 {
+		sort.Float64s(throughputs)
+		result.TokensPerSecP50 = percentile(throughputs, 0.50)
+		result.TokensPerSecP95 = percentile(throughputs, 0.95)
+		result.TokensPerSecAvg = average(throughputs)
+	}
+
 	if totalRequests > 0 {
 		result.ErrorRate = float64(result.TotalErrors) / float64(totalRequests)
 	}
 
-	for _, stat := range providerMap {
+	qualityByProvider := providerQualityAverages(platform, startDate)
+	// SLO 按各自的滚动窗口计算，与分析的天数无关；同名 provider 取第一个平台的结果
+	sloByProvider := make(map[string]ProviderSLOStatus)
+	if statuses, err := computeProviderSLOStatuses(NewProviderService(), platform); err == nil {
+		for _, status := range statuses {
+			if _, ok := sloByProvider[status.Provider]; !ok {
+				sloByProvider[status.Provider] = status
+			}
+		}
+	}
+	for provider, stat := range providerMap {
 		if stat.TotalRequests > 0 {
 			stat.SuccessRate = float64(stat.SuccessCount) / float64(stat.TotalRequests)
 		}
+		if slo, ok := sloByProvider[provider]; ok {
+			stat.SLO = &slo
+		}
+		if quality, ok := qualityByProvider[provider]; ok {
+			stat.AvgQualityScore = quality.score
+			stat.QualitySamples = int64(quality.samples)
+		}
+		if samples := providerStream[provider]; samples != nil {
+			if samples.ttftN > 0 {
+				stat.AvgTTFT = samples.ttftSum / float64(samples.ttftN)
+			}
+			if samples.tpsN > 0 {
+				stat.AvgTokensPerSec = samples.tpsSum / float64(samples.tpsN)
+			}
+		}
 		result.ProviderReliability = append(result.ProviderReliability, *stat)
 	}
 
@@ -801,6 +1004,17 @@ func (ls *LogService) PerformanceAnalysis(platform string, days int) (Performanc
 	return result, nil
 }
 
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
 func percentile(sorted []float64, p float64) float64 {
 	if len(sorted) == 0 {
 		return 0
@@ -824,6 +1038,9 @@ type RequestLogBodyResult struct {
 	BodySizeBytes int64  `json:"body_size_bytes"`
 	CreatedAt     string `json:"created_at"`
 	ExpiresAt     string `json:"expires_at"`
+	// 响应体已落盘时 ResponseBody 仅为预览，完整内容通过 GetRequestLogBodyRange 分段读取
+	ResponseSpilled bool `json:"response_spilled"`
+	Truncated       bool `json:"truncated"`
 }
 
 // GetRequestLogBody 根据 trace_id 获取请求/响应体
@@ -832,13 +1049,14 @@ func (ls *LogService) GetRequestLogBody(traceID string) (*RequestLogBodyResult,
 		return nil, errors.New("trace_id is required")
 	}
 
-	db, err := xdb.DB("default")
+	db, err := analyticsDB()
 	if err != nil {
 		return nil, err
 	}
 
 	query := `
-		SELECT id, trace_id, request_body, response_body, body_size_bytes, created_at, expires_at
+		SELECT id, trace_id, request_body, response_body, body_size_bytes, created_at, expires_at,
+		       COALESCE(response_body_path, ''), COALESCE(truncated, 0), COALESCE(blob_refs, '')
 		FROM request_log_body
 		WHERE trace_id = ?
 		LIMIT 1
@@ -847,6 +1065,8 @@ func (ls *LogService) GetRequestLogBody(traceID string) (*RequestLogBodyResult,
 	row := db.QueryRow(query, traceID)
 	var result RequestLogBodyResult
 	var requestBody, responseBody, createdAt, expiresAt sql.NullString
+	var responseBodyPath, blobRefs string
+	var truncated int
 	err = row.Scan(
 		&result.ID,
 		&result.TraceID,
@@ -855,6 +1075,9 @@ func (ls *LogService) GetRequestLogBody(traceID string) (*RequestLogBodyResult,
 		&result.BodySizeBytes,
 		&createdAt,
 		&expiresAt,
+		&responseBodyPath,
+		&truncated,
+		&blobRefs,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -863,10 +1086,12 @@ func (ls *LogService) GetRequestLogBody(traceID string) (*RequestLogBodyResult,
 		return nil, err
 	}
 
-	result.RequestBody = requestBody.String
+	result.RequestBody = newBodyBlobResolver(db).expand(requestBody.String, blobRefs)
 	result.ResponseBody = responseBody.String
 	result.CreatedAt = createdAt.String
 	result.ExpiresAt = expiresAt.String
+	result.ResponseSpilled = responseBodyPath != ""
+	result.Truncated = truncated == 1
 
 	return &result, nil
 }
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// openTestRelayDB 在临时 HOME 下初始化独立的 default 库，不建表
+func openTestRelayDB(tb testing.TB, name string) *sql.DB {
+	tb.Helper()
+	home := tb.TempDir()
+	tb.Setenv("HOME", home)
+	if err := xdb.Inits([]xdb.Config{{
+		Name:        "default",
+		Driver:      "sqlite",
+		DSN:         filepath.Join(home, name) + "?cache=shared&mode=rwc&_busy_timeout=5000",
+		MaxOpenConn: 1,
+		MaxIdleConn: 1,
+	}}); err != nil {
+		tb.Fatal(err)
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// openAnalyticsDB 初始化独立的 default 库并建表
+func openAnalyticsDB(tb testing.TB, name string) *sql.DB {
+	tb.Helper()
+	db := openTestRelayDB(tb, name)
+	if err := ensureRequestLogTable(); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// seedAnalyticsLogs 用递归 CTE 批量生成 rows 条日志，均匀分布在最近 days 天、3 个平台
+func seedAnalyticsLogs(tb testing.TB, rows, days int) {
+	tb.Helper()
+	db, _ := xdb.DB("default")
+	_, err := db.Exec(`WITH RECURSIVE seq(n) AS (SELECT 0 UNION ALL SELECT n + 1 FROM seq WHERE n + 1 < ?)
+		INSERT INTO request_log (platform, provider, model, http_code, input_tokens, output_tokens, cache_read_tokens,
+			input_cost, output_cost, cache_read_cost, total_cost, duration_sec, created_at)
+		SELECT CASE n % 3 WHEN 0 THEN 'claude' WHEN 1 THEN 'codex' ELSE 'gemini-cli' END, 'p' || (n % 5), 'm' || (n % 7),
+			CASE WHEN n % 20 = 0 THEN 500 ELSE 200 END, 100, 50, 20, 0.3, 0.6, 0.02, 0.92, 1.5,
+			strftime('%Y-%m-%d %H:%M:%S', 'now', '-' || (n % (? * 1440)) || ' minutes')
+		FROM seq`, rows, days)
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestCostAnalysis(t *testing.T) {
+	openAnalyticsDB(t, "cost.db")
+	seedAnalyticsLogs(t, 3000, 3)
+	db, _ := xdb.DB("default")
+
+	ls := NewLogService()
+	before, err := ls.CostAnalysis("claude", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := refreshRequestLogRollups(db, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ls.CostAnalysis("claude", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 汇总前后结果一致，且与原始表的合计吻合
+	var requests int64
+	for i, point := range after.CostTrend {
+		if point.Requests != before.CostTrend[i].Requests {
+			t.Fatalf("trend differs after rollup on %s: %d vs %d", point.Day, point.Requests, before.CostTrend[i].Requests)
+		}
+		requests += point.Requests
+	}
+	var want int64
+	db.QueryRow("SELECT count(*) FROM request_log WHERE platform = 'claude'").Scan(&want)
+	if len(after.CostTrend) != 7 || requests != want {
+		t.Fatalf("expected %d requests in a 7-day trend, got %d in %d days", want, requests, len(after.CostTrend))
+	}
+	if after.InputCostRatio < 0.32 || after.InputCostRatio > 0.34 || after.CacheSavedCost <= 0 || after.DailyAvgCost <= 0 {
+		t.Fatalf("unexpected cost analysis: %+v", after)
+	}
+}
+
+// costAnalysisInMemory 旧实现：逐行加载到 Go 中累加，作为基准对照
+func costAnalysisInMemory(platform string, start time.Time) (float64, int) {
+	records, _ := xdb.New("request_log").Selects(
+		xdb.WhereGte("created_at", start.Format(timeLayout)),
+		xdb.WhereEq("platform", platform),
+		xdb.Field("input_cost", "output_cost", "cache_create_cost", "cache_read_cost", "total_cost", "cache_read_tokens", "input_tokens", "created_at"),
+	)
+	daily := make(map[string]float64)
+	var total float64
+	for _, record := range records {
+		total += record.GetFloat64("input_cost") + record.GetFloat64("output_cost")
+		daily[dayFromTimestamp(record.GetString("created_at"))] += record.GetFloat64("total_cost")
+	}
+	return total, len(daily)
+}
+
+// go test ./services/ -run '^$' -bench 'CostAnalysis|StatsSince' -benchtime 5x
+func BenchmarkCostAnalysis(b *testing.B) {
+	openAnalyticsDB(b, "bench.db")
+	seedAnalyticsLogs(b, 1_000_000, 30)
+	db, _ := xdb.DB("default")
+	ls := NewLogService()
+	start := startOfDay(time.Now()).AddDate(0, 0, -29)
+
+	b.Run("in-memory", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			costAnalysisInMemory("claude", start)
+		}
+	})
+	b.Run("group-by", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ls.CostAnalysis("claude", 30); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	if err := refreshRequestLogRollups(db, time.Now()); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("rollup", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ls.CostAnalysis("claude", 30); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkStatsSince(b *testing.B) {
+	openAnalyticsDB(b, "bench.db")
+	seedAnalyticsLogs(b, 1_000_000, 30)
+	db, _ := xdb.DB("default")
+	ls := NewLogService()
+
+	b.Run("group-by", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ls.StatsSince("claude"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	if err := refreshRequestLogRollups(db, time.Now()); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("rollup", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ls.StatsSince("claude"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
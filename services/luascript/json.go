@@ -0,0 +1,262 @@
+package luascript
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// maxJSONDepth 编码时的最大嵌套深度，同时用于发现循环引用
+const maxJSONDepth = 128
+
+// jsonState 记录解码得到的表的键顺序与数组标记，使重新编码的结果保持原始 JSON 的结构：
+// 对象按原始键顺序输出（新增的键按名称排在后面），解码自数组或经 json.array 标记的表总是编码为数组
+type jsonState struct {
+	null   *lua.LUserData
+	keys   map[*lua.LTable][]string
+	arrays map[*lua.LTable]bool
+}
+
+func (j *jsonState) init(L *lua.LState) {
+	j.null = L.NewUserData()
+	mt := L.NewTable()
+	mt.RawSetString("__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString("null"))
+		return 1
+	}))
+	j.null.Metatable = mt
+	j.keys = make(map[*lua.LTable][]string)
+	j.arrays = make(map[*lua.LTable]bool)
+}
+
+// jsonModule 脚本中的 json 库：decode、encode、array 与表示 JSON null 的 json.null
+func (s *State) jsonModule(L *lua.LState) *lua.LTable {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"decode": func(L *lua.LState) int {
+			str := L.CheckString(1)
+			if s.guard.over(len(str) * 2) {
+				s.guard.stop(ErrMemoryLimit)
+				L.RaiseError("%s", ErrMemoryLimit.Error())
+			}
+			v, err := s.DecodeJSON([]byte(str))
+			if err != nil {
+				L.RaiseError("json.decode: %v", err)
+			}
+			L.Push(v)
+			return 1
+		},
+		"encode": func(L *lua.LState) int {
+			data, err := s.EncodeJSON(L.Get(1))
+			if err != nil {
+				L.RaiseError("json.encode: %v", err)
+			}
+			L.Push(lua.LString(data))
+			return 1
+		},
+		// array 标记表编码为 JSON 数组（空表默认编码为对象）
+		"array": func(L *lua.LState) int {
+			t, ok := L.Get(1).(*lua.LTable)
+			if !ok {
+				if L.Get(1) != lua.LNil {
+					L.ArgError(1, "table expected")
+				}
+				t = L.NewTable()
+			}
+			s.json.arrays[t] = true
+			L.Push(t)
+			return 1
+		},
+	})
+	mod.RawSetString("null", s.json.null)
+	return mod
+}
+
+// DecodeJSON 把 JSON 解码为 Lua 值：对象与数组为表，null 为 json.null
+func (s *State) DecodeJSON(data []byte) (lua.LValue, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := s.decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the top-level value")
+	}
+	return v, nil
+}
+
+func (s *State) decodeValue(dec *json.Decoder) (lua.LValue, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch x := tok.(type) {
+	case nil:
+		return s.json.null, nil
+	case bool:
+		return lua.LBool(x), nil
+	case string:
+		return lua.LString(x), nil
+	case json.Number:
+		n, err := strconv.ParseFloat(string(x), 64)
+		if err != nil {
+			return nil, err
+		}
+		return lua.LNumber(n), nil
+	}
+
+	t := s.L.NewTable()
+	if tok == json.Delim('[') {
+		s.json.arrays[t] = true
+		for i := 1; dec.More(); i++ {
+			v, err := s.decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			t.RawSetInt(i, v)
+		}
+	} else {
+		var keys []string
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := tok.(string)
+			v, err := s.decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			if t.RawGetString(key) == lua.LNil {
+				keys = append(keys, key)
+			}
+			t.RawSetString(key, v)
+		}
+		s.json.keys[t] = keys
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// EncodeJSON 把 Lua 值编码为 JSON
+func (s *State) EncodeJSON(v lua.LValue) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.encodeValue(&buf, v, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *State) encodeValue(buf *bytes.Buffer, v lua.LValue, depth int) error {
+	if depth > maxJSONDepth {
+		return fmt.Errorf("nesting deeper than %d (cyclic table?)", maxJSONDepth)
+	}
+	switch x := v.(type) {
+	case *lua.LNilType:
+		buf.WriteString("null")
+	case lua.LBool:
+		buf.WriteString(strconv.FormatBool(bool(x)))
+	case lua.LNumber:
+		f := float64(x)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("cannot encode %v", f)
+		}
+		data, _ := json.Marshal(f)
+		buf.Write(data)
+	case lua.LString:
+		writeJSONString(buf, string(x))
+	case *lua.LUserData:
+		if x != s.json.null {
+			return fmt.Errorf("cannot encode userdata")
+		}
+		buf.WriteString("null")
+	case *lua.LTable:
+		if n, ok := s.arrayLength(x); ok {
+			buf.WriteByte('[')
+			for i := 1; i <= n; i++ {
+				if i > 1 {
+					buf.WriteByte(',')
+				}
+				if err := s.encodeValue(buf, x.RawGetInt(i), depth+1); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+			return nil
+		}
+		buf.WriteByte('{')
+		for i, key := range s.objectKeys(x) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, key.String())
+			buf.WriteByte(':')
+			if err := s.encodeValue(buf, x.RawGet(key), depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot encode %s", TypeName(v))
+	}
+	return nil
+}
+
+// arrayLength 表是否编码为数组：解码自数组或经 json.array 标记，或只有 1..n 的连续整数键
+func (s *State) arrayLength(t *lua.LTable) (int, bool) {
+	if s.json.arrays[t] {
+		return t.Len(), true
+	}
+	if _, decoded := s.json.keys[t]; decoded {
+		return 0, false
+	}
+	count := 0
+	integerKeys := true
+	t.ForEach(func(k, _ lua.LValue) {
+		count++
+		if n, ok := k.(lua.LNumber); !ok || float64(n) != math.Trunc(float64(n)) || n < 1 {
+			integerKeys = false
+		}
+	})
+	if count == 0 || !integerKeys || t.Len() != count {
+		return 0, false
+	}
+	return count, true
+}
+
+// objectKeys 对象的键：原有的键保持解码时的顺序，其余键按名称排序
+func (s *State) objectKeys(t *lua.LTable) []lua.LValue {
+	keys := make([]lua.LValue, 0, len(s.json.keys[t]))
+	seen := make(map[string]bool)
+	for _, key := range s.json.keys[t] {
+		if t.RawGetString(key) != lua.LNil {
+			keys = append(keys, lua.LString(key))
+			seen[key] = true
+		}
+	}
+	var rest []lua.LValue
+	t.ForEach(func(k, _ lua.LValue) {
+		if str, ok := k.(lua.LString); !ok || !seen[string(str)] {
+			rest = append(rest, k)
+		}
+	})
+	sort.Slice(rest, func(i, j int) bool { return rest[i].String() < rest[j].String() })
+	return append(keys, rest...)
+}
+
+// writeJSONString 编码字符串，不转义 HTML 字符
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode 追加的换行
+}
@@ -0,0 +1,381 @@
+// Package luascript 在 gopher-lua（Lua 5.1）之上为请求改写脚本提供沙箱。
+//
+// 脚本只能使用 base、string、table、math 标准库，以及 os.time / os.clock 与 json 扩展；
+// load、loadstring、dofile、require、setfenv、string.dump 等可触及宿主环境或字节码的函数均被移除。
+// 单次执行受 Limits 限制：步数按虚拟机指令计数，内存按当前调用帧中的字符串与表大小估算。
+// 资源限制错误与宿主函数返回的错误会终止脚本，pcall 无法吞掉。
+package luascript
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// 资源限制错误，不能被脚本中的 pcall 捕获
+var (
+	ErrStepLimit   = errors.New("script exceeded the instruction limit")
+	ErrTimeout     = errors.New("script exceeded the time limit")
+	ErrMemoryLimit = errors.New("script exceeded the memory limit")
+)
+
+const (
+	// callStackSize 最大调用深度
+	callStackSize = 200
+	// registryMaxSize 寄存器栈的最大槽位数
+	registryMaxSize = 256 * 1024
+	// checkInterval 每执行多少条指令检查一次超时与内存
+	checkInterval = 256
+	// tableSlotSize 估算内存时每个表元素占用的字节数
+	tableSlotSize = 16
+)
+
+// Limits 单次执行的资源限制，0 表示不限制
+type Limits struct {
+	MaxSteps  int           // 最大执行步数（虚拟机指令数）
+	Timeout   time.Duration // 最长执行时间
+	MaxMemory int           // 字符串与表占用字节数的估算上限
+}
+
+// Script 编译后的脚本，可以在多个 State 中复用
+type Script struct {
+	proto *lua.FunctionProto
+}
+
+// Compile 编译脚本源码，语法错误包含行号
+func Compile(name, source string) (*Script, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{proto: proto}, nil
+}
+
+// State 一次脚本执行的沙箱环境，不能并发使用
+type State struct {
+	L      *lua.LState
+	guard  *guard
+	start  time.Time
+	output []string
+	json   jsonState
+}
+
+// NewState 创建沙箱环境；Timeout 从创建时开始计算
+func NewState(limits Limits) *State {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   callStackSize,
+		RegistryMaxSize: registryMaxSize,
+	})
+	s := &State{L: L, start: time.Now()}
+	s.guard = newGuard(s, limits)
+	s.json.init(L)
+
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"collectgarbage", "dofile", "getfenv", "load", "loadfile", "loadstring", "module", "newproxy", "require", "setfenv", "_printregs"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	if str, ok := L.GetGlobal(lua.StringLibName).(*lua.LTable); ok {
+		str.RawSetString("dump", lua.LNil)
+		str.RawSetString("rep", L.NewFunction(s.strRep))
+	}
+	if tbl, ok := L.GetGlobal(lua.TabLibName).(*lua.LTable); ok {
+		if concat, ok := tbl.RawGetString("concat").(*lua.LFunction); ok {
+			tbl.RawSetString("concat", L.NewFunction(s.tableConcat(concat.GFunction)))
+		}
+	}
+	L.SetGlobal("print", L.NewFunction(s.print))
+	L.SetGlobal("os", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"time":  osTime,
+		"clock": s.osClock,
+	}))
+	L.SetGlobal("json", s.jsonModule(L))
+	L.SetContext(s.guard)
+	return s
+}
+
+// Close 释放虚拟机
+func (s *State) Close() {
+	s.L.Close()
+}
+
+// Output 脚本 print 输出的行
+func (s *State) Output() []string {
+	return s.output
+}
+
+// Steps 已执行的步数
+func (s *State) Steps() int {
+	return s.guard.steps
+}
+
+// NewTable 创建空表
+func (s *State) NewTable() *lua.LTable {
+	return s.L.NewTable()
+}
+
+// Register 注册全局函数；fn 返回的错误终止脚本（pcall 无法捕获），Run / Call 原样返回该错误
+func (s *State) Register(name string, fn func(args []lua.LValue) ([]lua.LValue, error)) {
+	s.L.SetGlobal(name, s.L.NewFunction(func(L *lua.LState) int {
+		args := make([]lua.LValue, L.GetTop())
+		for i := range args {
+			args[i] = L.Get(i + 1)
+		}
+		rets, err := fn(args)
+		if err != nil {
+			s.guard.stop(err)
+			L.RaiseError("%s", err.Error())
+		}
+		for _, v := range rets {
+			L.Push(v)
+		}
+		return len(rets)
+	}))
+}
+
+// Run 执行脚本的顶层代码，返回 return 的值
+func (s *State) Run(script *Script) ([]lua.LValue, error) {
+	return s.call(s.L.NewFunctionFromProto(script.proto))
+}
+
+// Call 调用全局函数；函数不存在时 found 为 false
+func (s *State) Call(name string, args ...lua.LValue) ([]lua.LValue, bool, error) {
+	fn, ok := s.L.GetGlobal(name).(*lua.LFunction)
+	if !ok {
+		return nil, false, nil
+	}
+	rets, err := s.call(fn, args...)
+	return rets, true, err
+}
+
+func (s *State) call(fn *lua.LFunction, args ...lua.LValue) ([]lua.LValue, error) {
+	if s.guard.err != nil {
+		return nil, s.guard.err
+	}
+	top := s.L.GetTop()
+	s.L.Push(fn)
+	for _, arg := range args {
+		s.L.Push(arg)
+	}
+	err := s.L.PCall(len(args), lua.MultRet, nil)
+	if s.guard.err != nil {
+		s.L.SetTop(top)
+		return nil, s.guard.err
+	}
+	if err != nil {
+		s.L.SetTop(top)
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) && apiErr.Object != nil {
+			return nil, errors.New(apiErr.Object.String())
+		}
+		return nil, err
+	}
+	rets := make([]lua.LValue, s.L.GetTop()-top)
+	for i := range rets {
+		rets[i] = s.L.Get(top + 1 + i)
+	}
+	s.L.SetTop(top)
+	return rets, nil
+}
+
+// print 输出写入 Output，不写标准输出
+func (s *State) print(L *lua.LState) int {
+	parts := make([]string, L.GetTop())
+	for i := range parts {
+		parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+	line := strings.Join(parts, "\t")
+	s.guard.output += len(line)
+	if s.guard.over(s.guard.output) {
+		s.guard.stop(ErrMemoryLimit)
+		L.RaiseError("%s", ErrMemoryLimit.Error())
+	}
+	s.output = append(s.output, line)
+	return 0
+}
+
+// strRep 在分配前检查结果长度，避免一次调用就超出内存上限
+func (s *State) strRep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	sep := L.OptString(3, "")
+	if n <= 0 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	if unit := len(str) + len(sep); unit > 0 && (n > math.MaxInt32/unit || s.guard.over(unit*n-len(sep))) {
+		s.guard.stop(ErrMemoryLimit)
+		L.RaiseError("%s", ErrMemoryLimit.Error())
+	}
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = str
+	}
+	L.Push(lua.LString(strings.Join(parts, sep)))
+	return 1
+}
+
+// tableConcat 在调用 table.concat 前按整张表估算结果长度
+func (s *State) tableConcat(concat lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		t := L.CheckTable(1)
+		sep := L.OptString(2, "")
+		size := 0
+		for i := 1; i <= t.Len(); i++ {
+			size += len(lua.LVAsString(t.RawGetInt(i))) + len(sep)
+		}
+		if s.guard.over(size) {
+			s.guard.stop(ErrMemoryLimit)
+			L.RaiseError("%s", ErrMemoryLimit.Error())
+		}
+		return concat(L)
+	}
+}
+
+// osTime 当前 Unix 时间（秒）
+func osTime(L *lua.LState) int {
+	L.Push(lua.LNumber(time.Now().Unix()))
+	return 1
+}
+
+// osClock 本次执行已用时间（秒）
+func (s *State) osClock(L *lua.LState) int {
+	L.Push(lua.LNumber(time.Since(s.start).Seconds()))
+	return 1
+}
+
+// guard 作为 LState 的 context：gopher-lua 每执行一条指令调用一次 Done()，
+// 借此计数步数并定期检查超时与内存；超限后 Done() 返回已关闭的 channel，虚拟机以 Err() 中止执行
+type guard struct {
+	state    *State
+	limits   Limits
+	deadline time.Time
+	steps    int
+	next     int // 下次检查超时与内存时的步数
+	output   int // print 输出的字节数
+	err      error
+	stopped  chan struct{}
+}
+
+func newGuard(s *State, limits Limits) *guard {
+	g := &guard{state: s, limits: limits, stopped: make(chan struct{})}
+	close(g.stopped)
+	if limits.Timeout > 0 {
+		g.deadline = s.start.Add(limits.Timeout)
+	}
+	return g
+}
+
+// stop 记录第一个终止原因
+func (g *guard) stop(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// over 估算的内存是否超过上限
+func (g *guard) over(size int) bool {
+	return g.limits.MaxMemory > 0 && size > g.limits.MaxMemory
+}
+
+func (g *guard) Done() <-chan struct{} {
+	if g.err != nil {
+		return g.stopped
+	}
+	g.steps++
+	if g.limits.MaxSteps > 0 && g.steps > g.limits.MaxSteps {
+		g.stop(ErrStepLimit)
+	} else if g.steps >= g.next {
+		g.check()
+	}
+	if g.err != nil {
+		return g.stopped
+	}
+	return nil
+}
+
+// check 检查超时与内存，并安排下次检查：估算内存离上限越近检查越频繁，
+// 避免 s = s .. s 这类每步翻倍的增长在两次检查之间越过上限太多
+func (g *guard) check() {
+	if !g.deadline.IsZero() && time.Now().After(g.deadline) {
+		g.stop(ErrTimeout)
+		return
+	}
+	interval := checkInterval
+	if g.limits.MaxMemory > 0 {
+		used := g.memory()
+		if g.over(used) {
+			g.stop(ErrMemoryLimit)
+			return
+		}
+		interval = min(interval, max(1, bits.Len(uint(g.limits.MaxMemory/(used+1)))-1))
+	}
+	g.next = g.steps + interval
+}
+
+// memory 估算当前调用帧中字符串与表占用的字节数
+func (g *guard) memory() int {
+	if g.limits.MaxMemory <= 0 {
+		return 0
+	}
+	L := g.state.L
+	total := g.output
+	for i := 1; i <= L.GetTop(); i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			total += len(v)
+		case *lua.LTable:
+			total += v.Len() * tableSlotSize
+		}
+	}
+	return total
+}
+
+func (g *guard) Err() error {
+	return g.err
+}
+
+func (g *guard) Deadline() (time.Time, bool) {
+	return g.deadline, !g.deadline.IsZero()
+}
+
+func (g *guard) Value(key any) any {
+	return nil
+}
+
+// TypeName Lua 类型名
+func TypeName(v lua.LValue) string {
+	if v == nil {
+		return lua.LTNil.String()
+	}
+	return v.Type().String()
+}
+
+// ToString 按 Lua tostring 的规则转换为字符串
+func ToString(v lua.LValue) string {
+	if v == nil {
+		return "nil"
+	}
+	return v.String()
+}
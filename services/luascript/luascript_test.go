@@ -0,0 +1,173 @@
+package luascript
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func run(t *testing.T, source string) []lua.LValue {
+	t.Helper()
+	sc, err := Compile("test", source)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	s := NewState(Limits{MaxSteps: 100000})
+	defer s.Close()
+	rets, err := s.Run(sc)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return rets
+}
+
+func joined(rets []lua.LValue) string {
+	parts := make([]string, len(rets))
+	for i, v := range rets {
+		parts[i] = ToString(v)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestSandboxLibraries(t *testing.T) {
+	cases := []struct {
+		source string
+		want   string
+	}{
+		{"return type(load), type(loadstring), type(dofile), type(require), type(setfenv)", "nil nil nil nil nil"},
+		{"return type(io), type(debug), type(coroutine), type(package), type(string.dump)", "nil nil nil nil nil"},
+		{"return type(os.execute), type(os.getenv), type(os.time()), type(os.clock())", "nil nil number number"},
+		{`return ("x"):rep(3, "-"), string.format("%s=%d", "k", 42), ("Hello"):upper()`, "x-x-x k=42 HELLO"},
+		{"return table.concat({1, 2, 3}, ','), math.floor(2.5), select('#', 1, 2)", "1,2,3 2 2"},
+		{`return json.encode({a = 1, b = {true, json.null}}), tostring(json.null)`, `{"a":1,"b":[true,null]} null`},
+	}
+	for _, tc := range cases {
+		if got := joined(run(t, tc.source)); got != tc.want {
+			t.Errorf("%q = %q, want %q", tc.source, got, tc.want)
+		}
+	}
+}
+
+func TestPrintCapturesOutput(t *testing.T) {
+	sc, _ := Compile("print", `print("a", 1, nil) print(json.null)`)
+	s := NewState(Limits{})
+	defer s.Close()
+	if _, err := s.Run(sc); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Output(); len(got) != 2 || got[0] != "a\t1\tnil" || got[1] != "null" {
+		t.Fatalf("output = %q", got)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `{"model":"gpt-4","messages":[{"role":"user","content":"<hi>"}],"stream":false,"n":null,"tools":[]}`
+	s := NewState(Limits{})
+	defer s.Close()
+	root, err := s.DecodeJSON([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := s.EncodeJSON(root); err != nil || string(out) != input {
+		t.Fatalf("round trip = %s, %v", out, err)
+	}
+
+	s.L.SetGlobal("body", root)
+	sc, _ := Compile("edit", `body.model = "claude" body.messages[1].content = "hi" body.n = nil body.extra = json.array()`)
+	if _, err := s.Run(sc); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := s.EncodeJSON(root)
+	want := `{"model":"claude","messages":[{"role":"user","content":"hi"}],"stream":false,"tools":[],"extra":[]}`
+	if string(out) != want {
+		t.Fatalf("encoded = %s", out)
+	}
+
+	if _, err := s.DecodeJSON([]byte(`{"a":1} x`)); err == nil {
+		t.Fatal("expected trailing data error")
+	}
+	cyclic, _ := Compile("cyclic", "local t = {} t.self = t return json.encode(t)")
+	if _, err := s.Run(cyclic); err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Fatalf("cyclic err = %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	loop, _ := Compile("loop", "while true do end")
+	if _, err := NewState(Limits{MaxSteps: 1000}).Run(loop); !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("step limit err = %v", err)
+	}
+	start := time.Now()
+	if _, err := NewState(Limits{Timeout: 20 * time.Millisecond}).Run(loop); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("timeout err = %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("timeout not enforced promptly")
+	}
+	grow, _ := Compile("grow", `local s = "x" while true do s = s .. s end`)
+	if _, err := NewState(Limits{MaxMemory: 1 << 20}).Run(grow); !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("memory limit err = %v", err)
+	}
+	rep, _ := Compile("rep", `return ("x"):rep(1e9)`)
+	if _, err := NewState(Limits{MaxMemory: 1 << 20}).Run(rep); !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("string.rep err = %v", err)
+	}
+	join, _ := Compile("join", `local s, t = ("x"):rep(4096), {} for i = 1, 512 do t[i] = s end return table.concat(t)`)
+	if _, err := NewState(Limits{MaxMemory: 1 << 20}).Run(join); !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("table.concat err = %v", err)
+	}
+	recurse, _ := Compile("recurse", "local function f() return 1 + f() end return f()")
+	if _, err := NewState(Limits{}).Run(recurse); err == nil {
+		t.Fatal("expected stack overflow error")
+	}
+
+	// pcall 不能吞掉资源限制错误
+	guarded, _ := Compile("guarded", "pcall(function() while true do end end) return 'escaped'")
+	if _, err := NewState(Limits{MaxSteps: 1000}).Run(guarded); !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("pcall err = %v", err)
+	}
+}
+
+func TestRegisterAbort(t *testing.T) {
+	errStop := errors.New("stop")
+	s := NewState(Limits{})
+	defer s.Close()
+	s.Register("halt", func(args []lua.LValue) ([]lua.LValue, error) {
+		if len(args) > 0 && args[0] == lua.LTrue {
+			return nil, errStop
+		}
+		return []lua.LValue{lua.LString("ok")}, nil
+	})
+	sc, _ := Compile("abort", `
+		function entry(flag)
+			assert(halt(false) == "ok")
+			pcall(halt, flag)
+			return "escaped"
+		end`)
+	if _, err := s.Run(sc); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := s.Call("entry", lua.LTrue); !found || !errors.Is(err, errStop) {
+		t.Fatalf("call = %v, %v", found, err)
+	}
+	if _, found, _ := s.Call("missing"); found {
+		t.Fatal("missing function reported as found")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Compile("bad", "local x = = 1"); err == nil || !strings.Contains(err.Error(), "line:1") {
+		t.Fatalf("syntax err = %v", err)
+	}
+	sc, _ := Compile("rt", "local t = nil\n\nreturn t.x")
+	if _, err := NewState(Limits{}).Run(sc); err == nil || !strings.Contains(err.Error(), "rt:3:") {
+		t.Fatalf("runtime err = %v", err)
+	}
+	rets := run(t, `local ok, msg = pcall(error, "boom", 0) return ok, msg`)
+	if rets[0] != lua.LFalse || rets[1] != lua.LString("boom") {
+		t.Fatalf("pcall = %v", rets)
+	}
+}
@@ -217,6 +217,7 @@ func (ms *MCPService) SaveServers(servers []MCPServer) error {
 	if err := ms.syncGeminiServers(normalized); err != nil {
 		return err
 	}
+	GetSyncIntegration().OnScopedChange(syncScopeMCP, normalized)
 	return nil
 }
 
@@ -109,6 +109,9 @@ func MigratePicoClawProxyControl() {
 
 // 在 ProviderRelayService 启动时调用此函数
 func (prs *ProviderRelayService) RunMigrations() {
+	if IsReadOnlyMode() {
+		return
+	}
 	if err := MigrateGeminiProvider(); err != nil {
 		xlog.Error("[Migration] 迁移失败: %v", err)
 	}
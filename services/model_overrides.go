@@ -0,0 +1,232 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+)
+
+// 模型覆盖：~/.code-switch/model-overrides/*.json 中定义的模型（与内置价格表相同的 LiteLLM 字段，
+// 如 input_cost_per_token、max_input_tokens、supports_vision）按字段合并到内置数据之上，不存在的模型直接新增。
+// 新模型发布当天即可计费、参与上下文压缩与能力过滤；文件按名称顺序合并，后面的文件优先，修改后自动重新加载
+
+// modelOverrideReloadInterval 检查覆盖文件是否修改的间隔
+const modelOverrideReloadInterval = 5 * time.Second
+
+// ModelOverrideFile 单个覆盖文件的加载状态
+type ModelOverrideFile struct {
+	Name      string   `json:"name"`
+	Path      string   `json:"path"`
+	Models    []string `json:"models"`
+	UpdatedAt int64    `json:"updated_at"`
+	Error     string   `json:"error,omitempty"` // 解析失败时整个文件被忽略
+}
+
+// ModelOverrideStatus 覆盖目录与已生效的模型
+type ModelOverrideStatus struct {
+	Dir      string              `json:"dir"`
+	Files    []ModelOverrideFile `json:"files"`
+	Models   []string            `json:"models"`
+	LoadedAt int64               `json:"loaded_at"`
+}
+
+// modelOverrideStore 已加载的覆盖状态；signature 为目录中文件名、大小与修改时间的摘要
+type modelOverrideStore struct {
+	mu        sync.Mutex
+	signature string
+	status    ModelOverrideStatus
+}
+
+func modelOverridesDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "model-overrides"), nil
+}
+
+// modelOverrideFiles 按名称排序的覆盖文件与目录摘要
+func modelOverrideFiles(dir string) ([]os.DirEntry, string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var files []os.DirEntry
+	var signature strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		files = append(files, entry)
+		if info, err := entry.Info(); err == nil {
+			fmt.Fprintf(&signature, "%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, signature.String(), nil
+}
+
+// parseModelOverrideFile 解析覆盖文件：顶层为模型名到字段的对象，context_window 可作为 max_input_tokens 的别名
+func parseModelOverrideFile(data []byte) (map[string]map[string]json.RawMessage, error) {
+	var models map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &models); err != nil {
+		return nil, err
+	}
+	for model, fields := range models {
+		if strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("empty model name")
+		}
+		if window, ok := fields["context_window"]; ok {
+			if _, set := fields["max_input_tokens"]; !set {
+				fields["max_input_tokens"] = window
+			}
+			delete(fields, "context_window")
+		}
+		// 提前检查字段类型，避免一个错误的文件影响其他文件
+		raw, _ := json.Marshal(fields)
+		var entry modelpricing.PricingEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("model %s: %w", model, err)
+		}
+	}
+	return models, nil
+}
+
+// loadModelOverrides 读取目录中的全部覆盖文件，按文件顺序逐字段合并
+func loadModelOverrides(dir string, files []os.DirEntry) (map[string]json.RawMessage, []ModelOverrideFile) {
+	merged := make(map[string]map[string]json.RawMessage)
+	statuses := make([]ModelOverrideFile, 0, len(files))
+	for _, entry := range files {
+		status := ModelOverrideFile{Name: entry.Name(), Path: filepath.Join(dir, entry.Name()), Models: []string{}}
+		if info, err := entry.Info(); err == nil {
+			status.UpdatedAt = info.ModTime().Unix()
+		}
+		data, err := os.ReadFile(status.Path)
+		if err == nil {
+			var models map[string]map[string]json.RawMessage
+			if models, err = parseModelOverrideFile(data); err == nil {
+				for model, fields := range models {
+					if merged[model] == nil {
+						merged[model] = make(map[string]json.RawMessage, len(fields))
+					}
+					for key, value := range fields {
+						merged[model][key] = value
+					}
+					status.Models = append(status.Models, model)
+				}
+				sort.Strings(status.Models)
+			}
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+
+	overrides := make(map[string]json.RawMessage, len(merged))
+	for model, fields := range merged {
+		raw, _ := json.Marshal(fields)
+		overrides[model] = raw
+	}
+	return overrides, statuses
+}
+
+// reloadModelOverrides 覆盖文件有变化（或 force）时重新加载并应用到价格服务
+func (prs *ProviderRelayService) reloadModelOverrides(force bool) error {
+	dir, err := modelOverridesDir()
+	if err != nil {
+		return err
+	}
+	files, signature, err := modelOverrideFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	store := &prs.modelOverrides
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !force && store.status.LoadedAt != 0 && signature == store.signature {
+		return nil
+	}
+
+	overrides, statuses := loadModelOverrides(dir, files)
+	if prs.pricingService != nil {
+		if err := prs.pricingService.SetOverrides(overrides); err != nil {
+			return err
+		}
+	}
+	models := make([]string, 0, len(overrides))
+	for model := range overrides {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	if len(models) > 0 || store.signature != "" {
+		fmt.Printf("[ModelOverrides] 已加载 %d 个文件中的 %d 个模型覆盖\n", len(files), len(models))
+	}
+	for _, status := range statuses {
+		if status.Error != "" {
+			fmt.Printf("[ModelOverrides] 已忽略 %s: %s\n", status.Name, status.Error)
+		}
+	}
+	store.signature = signature
+	store.status = ModelOverrideStatus{Dir: dir, Files: statuses, Models: models, LoadedAt: time.Now().Unix()}
+	return nil
+}
+
+// startModelOverrideWatchTask 定期检查覆盖文件，修改后重新加载
+func (prs *ProviderRelayService) startModelOverrideWatchTask() {
+	ticker := time.NewTicker(modelOverrideReloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := prs.reloadModelOverrides(false); err != nil {
+			fmt.Printf("[ModelOverrides] 加载失败: %v\n", err)
+		}
+	}
+}
+
+// GetModelOverrides 返回覆盖目录、各文件的加载状态与已生效的模型
+func (prs *ProviderRelayService) GetModelOverrides() ModelOverrideStatus {
+	prs.modelOverrides.mu.Lock()
+	defer prs.modelOverrides.mu.Unlock()
+	status := prs.modelOverrides.status
+	if status.Dir == "" {
+		status.Dir, _ = modelOverridesDir()
+	}
+	if status.Files == nil {
+		status.Files = []ModelOverrideFile{}
+	}
+	if status.Models == nil {
+		status.Models = []string{}
+	}
+	return status
+}
+
+// ReloadModelOverrides 立即重新加载覆盖文件
+func (prs *ProviderRelayService) ReloadModelOverrides() (ModelOverrideStatus, error) {
+	if err := prs.reloadModelOverrides(true); err != nil {
+		return prs.GetModelOverrides(), err
+	}
+	return prs.GetModelOverrides(), nil
+}
+
+// GetModelInfo 查询模型的上下文窗口、能力与单价（内置数据与覆盖文件合并后）
+func (prs *ProviderRelayService) GetModelInfo(model string) (modelpricing.ModelInfo, error) {
+	info, ok := prs.pricingService.ModelInfo(model)
+	if !ok {
+		return info, fmt.Errorf("unknown model: %s", model)
+	}
+	return info, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+)
+
+func TestModelOverridesMergeAndReload(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".code-switch", "model-overrides")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// 确保修改时间变化，即使在同一时间粒度内重写
+		stamp := time.Now().Add(time.Duration(len(content)) * time.Second)
+		os.Chtimes(path, stamp, stamp)
+	}
+	write("10-launch.json", `{
+		"acme-frontier-1": {"input_cost_per_token": 0.000002, "output_cost_per_token": 0.00001, "context_window": 400000, "supports_vision": false},
+		"gpt-4o": {"input_cost_per_token": 0.000001}
+	}`)
+	write("20-fix.json", `{"acme-frontier-1": {"output_cost_per_token": 0.000008}}`)
+	write("30-broken.json", `{"acme-other": {"input_cost_per_token": "cheap"}}`)
+
+	pricing, err := modelpricing.NewService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, _ := pricing.ModelInfo("gpt-4o")
+	prs := &ProviderRelayService{pricingService: pricing}
+	if err := prs.reloadModelOverrides(true); err != nil {
+		t.Fatal(err)
+	}
+
+	status := prs.GetModelOverrides()
+	if !reflect.DeepEqual(status.Models, []string{"acme-frontier-1", "gpt-4o"}) || len(status.Files) != 3 {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.Files[2].Error == "" || len(status.Files[2].Models) != 0 {
+		t.Fatalf("broken file not reported: %+v", status.Files[2])
+	}
+
+	// 新模型：后面的文件逐字段覆盖，context_window 作为 max_input_tokens 的别名
+	info, err := prs.GetModelInfo("acme-frontier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Overridden || info.ContextWindow != 400000 || info.OutputCostPerToken != 0.000008 || info.Vision == nil || *info.Vision {
+		t.Fatalf("new model info = %+v", info)
+	}
+	cost := pricing.CalculateCost("acme-frontier-1", modelpricing.UsageSnapshot{InputTokens: 1000, OutputTokens: 1000, CacheReadTokens: 1000})
+	if !cost.HasPricing || cost.TotalCost < 0.010199 || cost.TotalCost > 0.010201 {
+		t.Fatalf("new model cost = %+v", cost)
+	}
+
+	// 已有模型：只替换覆盖的字段，缓存单价按新输入单价重新推算
+	info, _ = prs.GetModelInfo("gpt-4o")
+	if info.InputCostPerToken != 0.000001 || info.ContextWindow != embedded.ContextWindow || info.OutputCostPerToken != embedded.OutputCostPerToken {
+		t.Fatalf("merged gpt-4o = %+v (embedded %+v)", info, embedded)
+	}
+	if cost := pricing.CalculateCost("gpt-4o", modelpricing.UsageSnapshot{CacheReadTokens: 1000}); cost.CacheReadCost < 0.0000999 || cost.CacheReadCost > 0.0001001 {
+		t.Fatalf("cache read cost = %v", cost.CacheReadCost)
+	}
+
+	// 模型数据标记为不支持、provider 未声明时跳过该 provider；provider 声明支持时以 provider 为准
+	required := []string{CapabilityVision}
+	if missing := prs.providerMissingCapabilities(Provider{Name: "acme"}, "acme-frontier-1", required); !reflect.DeepEqual(missing, required) {
+		t.Fatalf("missing = %v", missing)
+	}
+	vision := true
+	declared := Provider{Name: "acme", Capabilities: &ProviderCapabilities{Vision: &vision}}
+	if missing := prs.providerMissingCapabilities(declared, "acme-frontier-1", required); len(missing) != 0 {
+		t.Fatalf("declared provider missing = %v", missing)
+	}
+	if missing := prs.providerMissingCapabilities(Provider{Name: "acme"}, "unknown-model", required); len(missing) != 0 {
+		t.Fatalf("unknown model missing = %v", missing)
+	}
+
+	// 文件修改后重新加载；删除后恢复内置数据
+	write("20-fix.json", `{"acme-frontier-1": {"output_cost_per_token": 0.000006, "supports_vision": true}}`)
+	if err := prs.reloadModelOverrides(false); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := prs.GetModelInfo("acme-frontier-1"); info.OutputCostPerToken != 0.000006 || !*info.Vision {
+		t.Fatalf("reloaded info = %+v", info)
+	}
+	for _, name := range []string{"10-launch.json", "20-fix.json", "30-broken.json"} {
+		os.Remove(filepath.Join(dir, name))
+	}
+	if _, err := prs.ReloadModelOverrides(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prs.GetModelInfo("acme-frontier-1"); err == nil {
+		t.Fatal("removed override still active")
+	}
+	if info, _ := prs.GetModelInfo("gpt-4o"); info.Overridden || info.InputCostPerToken != embedded.InputCostPerToken {
+		t.Fatalf("gpt-4o after removal = %+v", info)
+	}
+}
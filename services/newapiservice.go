@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// newAPIQuotaPerUnit NEW-API 内部额度单位：500000 quota = 1 USD
+const newAPIQuotaPerUnit = 500000.0
+
+// newAPIBalanceCheckInterval 余额巡检间隔
+const newAPIBalanceCheckInterval = 5 * time.Minute
+
+// NewAPIBalance NEW-API 账户余额信息
+type NewAPIBalance struct {
+	UserID       int     `json:"userId"`
+	Username     string  `json:"username"`
+	Quota        int64   `json:"quota"`        // 剩余额度（NEW-API 原始单位）
+	UsedQuota    int64   `json:"usedQuota"`    // 已用额度
+	RequestCount int64   `json:"requestCount"` // 累计请求数
+	BalanceUSD   float64 `json:"balanceUsd"`   // 剩余额度折算美元
+	UsedUSD      float64 `json:"usedUsd"`      // 已用额度折算美元
+	Exhausted    bool    `json:"exhausted"`    // 余额是否已耗尽
+	CheckedAt    int64   `json:"checkedAt"`
+}
+
+// NewAPIChannel NEW-API 渠道信息（需要管理员 Token）
+type NewAPIChannel struct {
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	Type         int     `json:"type"`
+	Status       int     `json:"status"`     // 1=启用 2=手动禁用 3=自动禁用
+	StatusText   string  `json:"statusText"` // enabled / manually_disabled / auto_disabled
+	Models       string  `json:"models"`
+	Group        string  `json:"group"`
+	Priority     int64   `json:"priority"`
+	Balance      float64 `json:"balance"`
+	UsedQuota    int64   `json:"usedQuota"`
+	ResponseTime int     `json:"responseTime"` // 最近一次测速耗时（毫秒）
+	TestTime     int64   `json:"testTime"`
+}
+
+// NewAPIOverview 余额 + 渠道概览，供 GUI 一次性拉取
+type NewAPIOverview struct {
+	Enabled         bool            `json:"enabled"`
+	URL             string          `json:"url"`
+	Balance         *NewAPIBalance  `json:"balance,omitempty"`
+	Channels        []NewAPIChannel `json:"channels"`
+	BalanceError    string          `json:"balanceError,omitempty"`
+	ChannelsError   string          `json:"channelsError,omitempty"`
+	AutoDisable     bool            `json:"autoDisable"`
+	AutoDisabledAt  int64           `json:"autoDisabledAt,omitempty"`
+	AutoDisableNote string          `json:"autoDisableNote,omitempty"`
+}
+
+// NewAPIService NEW-API 余额与渠道查询服务 (Wails 绑定)
+type NewAPIService struct {
+	relay       *ProviderRelayService
+	appSettings *AppSettingsService
+	client      *http.Client
+
+	mu             sync.Mutex
+	lastBalance    *NewAPIBalance
+	autoDisabledAt time.Time
+	cancel         context.CancelFunc
+}
+
+// NewNewAPIService 创建 NEW-API 查询服务
+func NewNewAPIService(relay *ProviderRelayService, appSettings *AppSettingsService) *NewAPIService {
+	return &NewAPIService{
+		relay:       relay,
+		appSettings: appSettings,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ServiceName Wails 服务名
+func (s *NewAPIService) ServiceName() string {
+	return "NewAPIService"
+}
+
+// ServiceStartup Wails 启动回调：启动余额巡检
+func (s *NewAPIService) ServiceStartup(ctx context.Context) error {
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	go s.monitorBalance(monitorCtx)
+	return nil
+}
+
+// ServiceShutdown Wails 关闭回调
+func (s *NewAPIService) ServiceShutdown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	return nil
+}
+
+// --- 前端 API ---
+
+// GetBalance 查询当前 Token 对应账户的剩余额度
+func (s *NewAPIService) GetBalance() (*NewAPIBalance, error) {
+	url, token, _ := s.relay.GetNewAPIConfig()
+	if url == "" || token == "" {
+		return nil, fmt.Errorf("NEW-API 未配置 URL 或 Token")
+	}
+
+	body, err := s.get(url, token, "/api/user/self", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	data := gjson.GetBytes(body, "data")
+	quota := data.Get("quota").Int()
+	used := data.Get("used_quota").Int()
+	balance := &NewAPIBalance{
+		UserID:       int(data.Get("id").Int()),
+		Username:     data.Get("username").String(),
+		Quota:        quota,
+		UsedQuota:    used,
+		RequestCount: data.Get("request_count").Int(),
+		BalanceUSD:   float64(quota) / newAPIQuotaPerUnit,
+		UsedUSD:      float64(used) / newAPIQuotaPerUnit,
+		Exhausted:    quota <= 0,
+		CheckedAt:    time.Now().Unix(),
+	}
+
+	s.mu.Lock()
+	s.lastBalance = balance
+	s.mu.Unlock()
+	return balance, nil
+}
+
+// ListChannels 列出 NEW-API 渠道及其状态（需要管理员权限的 Token）
+func (s *NewAPIService) ListChannels() ([]NewAPIChannel, error) {
+	url, token, _ := s.relay.GetNewAPIConfig()
+	if url == "" || token == "" {
+		return nil, fmt.Errorf("NEW-API 未配置 URL 或 Token")
+	}
+
+	// 管理接口要求携带 New-Api-User 头，先从余额缓存中取用户 ID
+	userID := 0
+	s.mu.Lock()
+	if s.lastBalance != nil {
+		userID = s.lastBalance.UserID
+	}
+	s.mu.Unlock()
+	if userID == 0 {
+		if balance, err := s.GetBalance(); err == nil {
+			userID = balance.UserID
+		}
+	}
+
+	body, err := s.get(url, token, "/api/channel/?p=0&page_size=100", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 新版本返回 data.items，旧版本直接返回 data 数组
+	items := gjson.GetBytes(body, "data.items")
+	if !items.Exists() {
+		items = gjson.GetBytes(body, "data")
+	}
+
+	channels := make([]NewAPIChannel, 0)
+	for _, item := range items.Array() {
+		status := int(item.Get("status").Int())
+		channels = append(channels, NewAPIChannel{
+			ID:           int(item.Get("id").Int()),
+			Name:         item.Get("name").String(),
+			Type:         int(item.Get("type").Int()),
+			Status:       status,
+			StatusText:   newAPIChannelStatusText(status),
+			Models:       item.Get("models").String(),
+			Group:        item.Get("group").String(),
+			Priority:     item.Get("priority").Int(),
+			Balance:      item.Get("balance").Float(),
+			UsedQuota:    item.Get("used_quota").Int(),
+			ResponseTime: int(item.Get("response_time").Int()),
+			TestTime:     item.Get("test_time").Int(),
+		})
+	}
+	return channels, nil
+}
+
+// GetOverview 一次性返回余额与渠道信息，单项失败不影响其他项
+func (s *NewAPIService) GetOverview() NewAPIOverview {
+	url, _, enabled := s.relay.GetNewAPIConfig()
+	overview := NewAPIOverview{
+		Enabled:  enabled,
+		URL:      url,
+		Channels: []NewAPIChannel{},
+	}
+
+	if balance, err := s.GetBalance(); err != nil {
+		overview.BalanceError = err.Error()
+	} else {
+		overview.Balance = balance
+	}
+	if channels, err := s.ListChannels(); err != nil {
+		overview.ChannelsError = err.Error()
+	} else {
+		overview.Channels = channels
+	}
+
+	if settings, err := s.appSettings.GetAppSettings(); err == nil {
+		overview.AutoDisable = settings.NewAPIAutoDisable
+	}
+	s.mu.Lock()
+	if !s.autoDisabledAt.IsZero() {
+		overview.AutoDisabledAt = s.autoDisabledAt.Unix()
+		overview.AutoDisableNote = "NEW-API 余额耗尽，已自动切换回本地 provider"
+	}
+	s.mu.Unlock()
+	return overview
+}
+
+// CheckBalanceNow 立即执行一次余额检查（余额耗尽且开启自动关闭时切回本地 provider）
+func (s *NewAPIService) CheckBalanceNow() (*NewAPIBalance, error) {
+	balance, err := s.GetBalance()
+	if err != nil {
+		return nil, err
+	}
+	s.applyAutoDisable(balance)
+	return balance, nil
+}
+
+// monitorBalance 周期性检查余额
+func (s *NewAPIService) monitorBalance(ctx context.Context) {
+	ticker := time.NewTicker(newAPIBalanceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.relay.IsNewAPIEnabled() {
+				continue
+			}
+			if _, err := s.CheckBalanceNow(); err != nil {
+				fmt.Printf("[NEW-API] 余额检查失败: %v\n", err)
+			}
+		}
+	}
+}
+
+// applyAutoDisable 余额耗尽时关闭 NEW-API 模式并持久化
+func (s *NewAPIService) applyAutoDisable(balance *NewAPIBalance) {
+	if balance == nil || !balance.Exhausted || !s.relay.IsNewAPIEnabled() {
+		return
+	}
+
+	settings, err := s.appSettings.GetAppSettings()
+	if err != nil || !settings.NewAPIAutoDisable {
+		return
+	}
+
+	s.relay.SetNewAPIEnabled(false)
+	settings.NewAPIEnabled = false
+	if _, err := s.appSettings.SaveAppSettings(settings); err != nil {
+		fmt.Printf("[NEW-API] 保存设置失败: %v\n", err)
+	}
+
+	s.mu.Lock()
+	s.autoDisabledAt = time.Now()
+	s.mu.Unlock()
+	fmt.Printf("[NEW-API] 余额已耗尽 (quota=%d)，已自动关闭 NEW-API 模式并回退到本地 provider\n", balance.Quota)
+}
+
+// get 调用 NEW-API 管理接口并校验 success 字段
+func (s *NewAPIService) get(baseURL, token, path string, userID int) ([]byte, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(baseURL, "/")+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if userID > 0 {
+		req.Header.Set("New-Api-User", strconv.Itoa(userID))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("连接 NEW-API 失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var envelope struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if !envelope.Success {
+		return nil, fmt.Errorf("NEW-API 返回失败: %s", envelope.Message)
+	}
+	return body, nil
+}
+
+func newAPIChannelStatusText(status int) string {
+	switch status {
+	case 1:
+		return "enabled"
+	case 2:
+		return "manually_disabled"
+	case 3:
+		return "auto_disabled"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newAPITestServer 模拟 NEW-API 的 /api/user/self 与 /api/channel/ 管理接口
+func newAPITestServer(t *testing.T, quota int64, channels string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"success":false,"message":"unauthorized"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/user/self":
+			fmt.Fprintf(w, `{"success":true,"data":{"id":7,"username":"alice","quota":%d,"used_quota":250000,"request_count":42}}`, quota)
+		case "/api/channel/":
+			if r.Header.Get("New-Api-User") != "7" {
+				w.Write([]byte(`{"success":false,"message":"未提供 New-Api-User"}`))
+				return
+			}
+			w.Write([]byte(channels))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestNewAPIService(t *testing.T, url, token string) *NewAPIService {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	relay := &ProviderRelayService{}
+	relay.SetNewAPIConfig(url, token)
+	relay.SetNewAPIEnabled(true)
+	return NewNewAPIService(relay, NewAppSettingsService(nil))
+}
+
+func TestNewAPIGetBalance(t *testing.T) {
+	srv := newAPITestServer(t, 1000000, "")
+	s := newTestNewAPIService(t, srv.URL+"/", "sk-test")
+
+	balance, err := s.GetBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.UserID != 7 || balance.Username != "alice" || balance.BalanceUSD != 2 || balance.UsedUSD != 0.5 ||
+		balance.RequestCount != 42 || balance.Exhausted {
+		t.Fatalf("balance = %+v", balance)
+	}
+
+	if _, err := newTestNewAPIService(t, srv.URL, "sk-wrong").GetBalance(); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Fatalf("unauthorized err = %v", err)
+	}
+	if _, err := newTestNewAPIService(t, "", "").GetBalance(); err == nil {
+		t.Fatal("expected error without configuration")
+	}
+}
+
+func TestNewAPIListChannels(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"paged response", `{"success":true,"data":{"items":[{"id":1,"name":"openai","status":1,"priority":10,"response_time":320},{"id":2,"name":"claude","status":3}],"total":2}}`},
+		{"legacy array response", `{"success":true,"data":[{"id":1,"name":"openai","status":1,"priority":10,"response_time":320},{"id":2,"name":"claude","status":3}]}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newAPITestServer(t, 1, tc.body)
+			// 没有余额缓存时先查询用户 ID，再携带 New-Api-User 请求渠道列表
+			channels, err := newTestNewAPIService(t, srv.URL, "sk-test").ListChannels()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(channels) != 2 || channels[0].Name != "openai" || channels[0].StatusText != "enabled" ||
+				channels[0].Priority != 10 || channels[0].ResponseTime != 320 || channels[1].StatusText != "auto_disabled" {
+				t.Fatalf("channels = %+v", channels)
+			}
+		})
+	}
+}
+
+func TestNewAPIOverviewReportsErrorsPerSection(t *testing.T) {
+	srv := newAPITestServer(t, 1000, `{"success":false,"message":"权限不足"}`)
+	overview := newTestNewAPIService(t, srv.URL, "sk-test").GetOverview()
+	if !overview.Enabled || overview.Balance == nil || overview.BalanceError != "" {
+		t.Fatalf("balance section = %+v", overview)
+	}
+	if !strings.Contains(overview.ChannelsError, "权限不足") || overview.Channels == nil || len(overview.Channels) != 0 {
+		t.Fatalf("channels section = %+v", overview)
+	}
+}
+
+func TestNewAPIAutoDisableWhenExhausted(t *testing.T) {
+	srv := newAPITestServer(t, 0, "")
+	s := newTestNewAPIService(t, srv.URL, "sk-test")
+
+	// 未开启自动关闭时保持 NEW-API 模式
+	if _, err := s.CheckBalanceNow(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.relay.IsNewAPIEnabled() {
+		t.Fatal("NEW-API disabled without auto-disable")
+	}
+
+	if _, err := s.appSettings.SaveAppSettings(AppSettings{NewAPIEnabled: true, NewAPIAutoDisable: true}); err != nil {
+		t.Fatal(err)
+	}
+	balance, err := s.CheckBalanceNow()
+	if err != nil || !balance.Exhausted {
+		t.Fatalf("balance = %+v, %v", balance, err)
+	}
+	if s.relay.IsNewAPIEnabled() {
+		t.Fatal("NEW-API still enabled after the balance ran out")
+	}
+	settings, err := s.appSettings.GetAppSettings()
+	if err != nil || settings.NewAPIEnabled {
+		t.Fatalf("persisted settings = %+v, %v", settings, err)
+	}
+	if overview := s.GetOverview(); overview.AutoDisabledAt == 0 || overview.AutoDisableNote == "" || !overview.AutoDisable {
+		t.Fatalf("overview = %+v", overview)
+	}
+}
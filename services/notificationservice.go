@@ -0,0 +1,336 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 桌面通知类别，可在设置中按类别静音
+const (
+	NotificationCategoryProviderOutage = "provider_outage"
+	NotificationCategoryBudget         = "budget"
+	NotificationCategoryGateway        = "gateway"
+	NotificationCategoryExport         = "export"
+	NotificationCategoryStorage        = "storage"
+)
+
+const (
+	// notificationCooldown 同一事件的最短通知间隔，避免故障期间反复弹出
+	notificationCooldown = 10 * time.Minute
+	// longExportThreshold 耗时超过该时长的导出完成后才通知
+	longExportThreshold = 10 * time.Second
+	// budgetCheckDelay 合并短时间内的多条请求日志后再统计花费
+	budgetCheckDelay = 5 * time.Second
+	// maxPendingNotifications 应用启动前最多缓存的通知数
+	maxPendingNotifications = 20
+)
+
+// budgetThresholds 预算通知阈值，从高到低
+var budgetThresholds = []int{100, 80}
+
+// Notification 一条桌面通知
+type Notification struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	// 点击通知时在日志窗口中打开的位置
+	Link *LogViewerLink `json:"link,omitempty"`
+}
+
+// NotificationService 将 provider 故障、预算超限、转发服务异常与长时间导出完成等事件推送为系统通知
+type NotificationService struct {
+	appSettings *AppSettingsService
+
+	mu            sync.Mutex
+	send          func(Notification) error
+	pending       []Notification
+	lastSent      map[string]time.Time
+	budgetAlerts  map[string]bool
+	exportStarted map[string]time.Time
+
+	budgetCheckPending uint32
+	now                func() time.Time
+	spendSince         func(time.Time) (float64, error)
+}
+
+func NewNotificationService(appSettings *AppSettingsService) *NotificationService {
+	return &NotificationService{
+		appSettings:   appSettings,
+		lastSent:      make(map[string]time.Time),
+		budgetAlerts:  make(map[string]bool),
+		exportStarted: make(map[string]time.Time),
+		now:           time.Now,
+		spendSince:    requestLogSpendSince,
+	}
+}
+
+// SetSender 设置系统通知的发送实现，并发送应用启动前缓存的通知
+func (ns *NotificationService) SetSender(send func(Notification) error) {
+	ns.mu.Lock()
+	ns.send = send
+	pending := ns.pending
+	ns.pending = nil
+	ns.mu.Unlock()
+
+	for _, n := range pending {
+		ns.deliver(send, n)
+	}
+}
+
+// Watch 订阅转发服务的事件
+func (ns *NotificationService) Watch(prs *ProviderRelayService) {
+	prs.OnProviderEvent(ns.handleProviderEvent)
+	prs.OnServerError(ns.handleServerError)
+	prs.OnLogExportProgress(ns.handleExportProgress)
+	prs.OnRequestLog(ns.handleRequestLog)
+	prs.OnLogOverflow(ns.handleLogOverflow)
+	prs.OnDatabaseStats(ns.handleDatabaseStats)
+}
+
+// SendTestNotification 发送一条测试通知，用于设置页检查系统通知权限
+func (ns *NotificationService) SendTestNotification(category string) error {
+	ns.mu.Lock()
+	send := ns.send
+	ns.mu.Unlock()
+	if send == nil {
+		return fmt.Errorf("notifications are not available yet")
+	}
+	return send(Notification{
+		ID:       fmt.Sprintf("test-%d", ns.now().UnixNano()),
+		Category: category,
+		Title:    "Ailurus PaaS",
+		Body:     "桌面通知已开启",
+	})
+}
+
+// isMuted 该类别是否在设置中被静音
+func (ns *NotificationService) isMuted(category string) bool {
+	if ns.appSettings == nil {
+		return false
+	}
+	settings, err := ns.appSettings.GetAppSettings()
+	if err != nil {
+		return false
+	}
+	return settings.NotificationMutes[category]
+}
+
+// notify 发送通知；key 相同的通知在冷却时间内只发送一次
+func (ns *NotificationService) notify(category, key, title, body string) {
+	ns.notifyWithLink(category, key, title, body, nil)
+}
+
+// notifyWithLink 发送可点击打开日志窗口的通知
+func (ns *NotificationService) notifyWithLink(category, key, title, body string, link *LogViewerLink) {
+	if ns.isMuted(category) {
+		return
+	}
+	now := ns.now()
+	n := Notification{
+		ID:       fmt.Sprintf("%s-%d", category, now.UnixNano()),
+		Category: category,
+		Title:    title,
+		Body:     body,
+		Link:     link,
+	}
+
+	ns.mu.Lock()
+	if last, ok := ns.lastSent[key]; ok && now.Sub(last) < notificationCooldown {
+		ns.mu.Unlock()
+		return
+	}
+	ns.lastSent[key] = now
+	send := ns.send
+	if send == nil {
+		// 应用尚未启动（例如启动时端口被占用），启动后补发
+		if len(ns.pending) < maxPendingNotifications {
+			ns.pending = append(ns.pending, n)
+		}
+		ns.mu.Unlock()
+		return
+	}
+	ns.mu.Unlock()
+	ns.deliver(send, n)
+}
+
+func (ns *NotificationService) deliver(send func(Notification) error, n Notification) {
+	if err := send(n); err != nil {
+		fmt.Printf("[Notification] 发送通知失败 (%s): %v\n", n.Category, err)
+	}
+}
+
+func (ns *NotificationService) handleProviderEvent(event ProviderEvent) {
+	// 点击通知查看该 provider 的失败请求；全部失败时定位到最后一次尝试
+	link := &LogViewerLink{Platform: event.Platform, Provider: event.Provider, ErrorsOnly: true}
+	switch event.Type {
+	case ProviderEventSuspended:
+		ns.notifyWithLink(NotificationCategoryProviderOutage, event.Type+":"+providerKey(event.Platform, event.Provider),
+			fmt.Sprintf("Provider %s 已挂起", event.Provider),
+			fmt.Sprintf("%s 平台的 %s 连续认证失败，已暂停使用：%s", event.Platform, event.Provider, event.Reason), link)
+	case ProviderEventAllFailed:
+		link.TraceID = event.TraceID
+		ns.notifyWithLink(NotificationCategoryProviderOutage, event.Type+":"+event.Platform,
+			fmt.Sprintf("%s 平台的 provider 全部不可用", event.Platform),
+			event.Reason, link)
+	case ProviderEventCanaryFailed:
+		ns.notifyWithLink(NotificationCategoryProviderOutage, event.Type+":"+providerKey(event.Platform, event.Provider),
+			fmt.Sprintf("Provider %s 灰度失败", event.Provider),
+			fmt.Sprintf("%s 平台的 %s 在灰度期间表现不达标，已自动停用：%s", event.Platform, event.Provider, event.Reason), link)
+	case ProviderEventSLOBurn:
+		ns.notifyWithLink(NotificationCategoryProviderOutage, event.Type+":"+providerKey(event.Platform, event.Provider),
+			fmt.Sprintf("Provider %s 错误预算消耗过快", event.Provider),
+			fmt.Sprintf("%s 平台的 %s：%s", event.Platform, event.Provider, event.Reason), link)
+	case ProviderEventCanaryPromoted:
+		ns.notify(NotificationCategoryProviderOutage, event.Type+":"+providerKey(event.Platform, event.Provider),
+			fmt.Sprintf("Provider %s 灰度通过", event.Provider),
+			fmt.Sprintf("%s 平台的 %s 已转正，按完整权重参与路由：%s", event.Platform, event.Provider, event.Reason))
+	}
+}
+
+func (ns *NotificationService) handleServerError(err error) {
+	ns.notify(NotificationCategoryGateway, "gateway:"+err.Error(), "转发服务异常", err.Error())
+}
+
+// handleLogOverflow 日志被丢弃时提醒用户使用量 / 成本统计不完整
+func (ns *NotificationService) handleLogOverflow(event LogOverflowEvent) {
+	if event.Action != "dropped" {
+		return
+	}
+	ns.notify(NotificationCategoryGateway, "log-overflow:"+event.Queue, "请求日志被丢弃",
+		fmt.Sprintf("日志队列已满，已丢弃 %d 条日志，使用量与成本统计可能不完整。可在设置中将溢出策略改为暂存到磁盘。", event.Dropped))
+}
+
+// handleDatabaseStats 数据库超过设置的大小时提醒清理日志，每天最多一次
+func (ns *NotificationService) handleDatabaseStats(stats DatabaseStats) {
+	if ns.appSettings == nil {
+		return
+	}
+	settings, err := ns.appSettings.GetAppSettings()
+	if err != nil || settings.DBSizeWarnMB <= 0 {
+		return
+	}
+	limit := int64(settings.DBSizeWarnMB) << 20
+	if stats.TotalBytes() < limit {
+		return
+	}
+	ns.notify(NotificationCategoryStorage, "db-size:"+ns.now().Format("2006-01-02"), "日志数据库过大",
+		fmt.Sprintf("app.db 已占用 %.1f MB，超过设置的 %d MB。可缩短日志保留天数或关闭 Body 日志。",
+			float64(stats.TotalBytes())/(1<<20), settings.DBSizeWarnMB))
+}
+
+func (ns *NotificationService) handleExportProgress(progress LogExportProgress) {
+	ns.mu.Lock()
+	started, ok := ns.exportStarted[progress.Path]
+	if !ok {
+		started = ns.now()
+		ns.exportStarted[progress.Path] = started
+	}
+	if progress.Done {
+		delete(ns.exportStarted, progress.Path)
+	}
+	ns.mu.Unlock()
+
+	if !progress.Done {
+		return
+	}
+	name := filepath.Base(progress.Path)
+	if progress.Error != "" {
+		ns.notify(NotificationCategoryExport, "export:"+progress.Path, "日志导出失败", fmt.Sprintf("%s：%s", name, progress.Error))
+		return
+	}
+	if ns.now().Sub(started) >= longExportThreshold {
+		ns.notify(NotificationCategoryExport, "export:"+progress.Path, "日志导出完成",
+			fmt.Sprintf("已导出 %d 条日志到 %s", progress.Rows, name))
+	}
+}
+
+// handleRequestLog 产生花费的请求写入后延迟统计预算，合并突发请求
+func (ns *NotificationService) handleRequestLog(log ReqeustLog) {
+	if log.TotalCost <= 0 {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&ns.budgetCheckPending, 0, 1) {
+		return
+	}
+	time.AfterFunc(budgetCheckDelay, func() {
+		atomic.StoreUint32(&ns.budgetCheckPending, 0)
+		ns.checkBudgets()
+	})
+}
+
+// checkBudgets 统计今日 / 本月花费，首次越过 80% / 100% 阈值时通知
+func (ns *NotificationService) checkBudgets() {
+	if ns.appSettings == nil || ns.isMuted(NotificationCategoryBudget) {
+		return
+	}
+	settings, err := ns.appSettings.GetAppSettings()
+	if err != nil {
+		return
+	}
+
+	now := ns.now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	periods := []struct {
+		name   string
+		key    string
+		start  time.Time
+		budget float64
+	}{
+		{"今日", "daily:" + dayStart.Format("2006-01-02"), dayStart, settings.DailyBudgetUSD},
+		{"本月", "monthly:" + monthStart.Format("2006-01"), monthStart, settings.MonthlyBudgetUSD},
+	}
+
+	for _, period := range periods {
+		if period.budget <= 0 {
+			continue
+		}
+		spent, err := ns.spendSince(period.start)
+		if err != nil {
+			fmt.Printf("[Notification] 统计花费失败: %v\n", err)
+			return
+		}
+		for _, threshold := range budgetThresholds {
+			if spent < period.budget*float64(threshold)/100 {
+				continue
+			}
+			alertKey := fmt.Sprintf("%s:%d", period.key, threshold)
+			ns.mu.Lock()
+			alerted := ns.budgetAlerts[alertKey]
+			// 越过更高阈值时不再补发较低阈值的通知
+			for _, lower := range budgetThresholds {
+				if lower <= threshold {
+					ns.budgetAlerts[fmt.Sprintf("%s:%d", period.key, lower)] = true
+				}
+			}
+			ns.mu.Unlock()
+			if !alerted {
+				ns.notify(NotificationCategoryBudget, alertKey,
+					fmt.Sprintf("%s花费已达预算的 %d%%", period.name, threshold),
+					fmt.Sprintf("已花费 $%.2f / 预算 $%.2f", spent, period.budget))
+			}
+			break
+		}
+	}
+}
+
+// requestLogSpendSince 统计指定时间以来的请求花费
+func requestLogSpendSince(since time.Time) (float64, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return 0, err
+	}
+	var spent float64
+	err = db.QueryRow(`SELECT COALESCE(SUM(total_cost), 0) FROM request_log WHERE created_at >= ?`,
+		since.UTC().Format(timeLayout)).Scan(&spent)
+	if err != nil && isNoSuchTableErr(err) {
+		return 0, nil
+	}
+	return spent, err
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type notificationRecorder struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (r *notificationRecorder) send(n Notification) error {
+	r.mu.Lock()
+	r.sent = append(r.sent, n)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *notificationRecorder) titles() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	titles := make([]string, 0, len(r.sent))
+	for _, n := range r.sent {
+		titles = append(titles, n.Title)
+	}
+	return titles
+}
+
+func newTestNotificationService(t *testing.T, settings AppSettings) (*NotificationService, *time.Time) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	appSettings := NewAppSettingsService(nil)
+	if _, err := appSettings.SaveAppSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	ns := NewNotificationService(appSettings)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	ns.now = func() time.Time { return now }
+	return ns, &now
+}
+
+func TestNotificationPendingMuteAndCooldown(t *testing.T) {
+	ns, now := newTestNotificationService(t, AppSettings{
+		NotificationMutes: map[string]bool{NotificationCategoryExport: true},
+	})
+
+	// 应用启动前的通知缓存到设置发送实现后补发
+	ns.handleServerError(errors.New("relay failed to listen on :18100: address already in use"))
+	recorder := &notificationRecorder{}
+	ns.SetSender(recorder.send)
+	if titles := recorder.titles(); len(titles) != 1 || titles[0] != "转发服务异常" {
+		t.Fatalf("expected pending gateway notification, got %v", titles)
+	}
+
+	suspended := ProviderEvent{Type: ProviderEventSuspended, Platform: "claude", Provider: "relay", Reason: "401"}
+	ns.handleProviderEvent(suspended)
+	ns.handleProviderEvent(suspended)
+	ns.handleProviderEvent(ProviderEvent{Type: ProviderEventResumed, Platform: "claude", Provider: "relay"})
+	if titles := recorder.titles(); len(titles) != 2 {
+		t.Fatalf("expected duplicate outage to be suppressed, got %v", titles)
+	}
+	*now = now.Add(notificationCooldown)
+	ns.handleProviderEvent(suspended)
+	if titles := recorder.titles(); len(titles) != 3 {
+		t.Fatalf("expected outage notification after cooldown, got %v", titles)
+	}
+
+	// export 类别已静音
+	ns.handleExportProgress(LogExportProgress{Path: "/tmp/logs.csv"})
+	ns.handleExportProgress(LogExportProgress{Path: "/tmp/logs.csv", Done: true, Error: "disk full"})
+	if titles := recorder.titles(); len(titles) != 3 {
+		t.Fatalf("expected muted export notification to be dropped, got %v", titles)
+	}
+}
+
+func TestNotificationLongExport(t *testing.T) {
+	ns, now := newTestNotificationService(t, AppSettings{})
+	recorder := &notificationRecorder{}
+	ns.SetSender(recorder.send)
+
+	ns.handleExportProgress(LogExportProgress{Path: "/tmp/quick.csv"})
+	ns.handleExportProgress(LogExportProgress{Path: "/tmp/quick.csv", Rows: 10, Done: true})
+
+	ns.handleExportProgress(LogExportProgress{Path: "/tmp/big.parquet", Total: 500000})
+	*now = now.Add(longExportThreshold)
+	ns.handleExportProgress(LogExportProgress{Path: "/tmp/big.parquet", Rows: 500000, Total: 500000, Done: true})
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.sent) != 1 || !strings.Contains(recorder.sent[0].Body, "big.parquet") {
+		t.Fatalf("expected only the long export to notify, got %+v", recorder.sent)
+	}
+}
+
+func TestNotificationBudgetThresholds(t *testing.T) {
+	ns, _ := newTestNotificationService(t, AppSettings{DailyBudgetUSD: 10, MonthlyBudgetUSD: 100})
+	recorder := &notificationRecorder{}
+	ns.SetSender(recorder.send)
+
+	var daily, monthly float64
+	ns.spendSince = func(since time.Time) (float64, error) {
+		if since.Day() == 1 {
+			return monthly, nil
+		}
+		return daily, nil
+	}
+
+	daily, monthly = 5, 5
+	ns.checkBudgets()
+	daily, monthly = 8.5, 8.5
+	ns.checkBudgets()
+	ns.checkBudgets()
+	daily, monthly = 12, 12
+	ns.checkBudgets()
+
+	titles := recorder.titles()
+	if len(titles) != 2 || titles[0] != "今日花费已达预算的 80%" || titles[1] != "今日花费已达预算的 100%" {
+		t.Fatalf("unexpected budget notifications: %v", titles)
+	}
+
+	// 直接越过 100% 时只发送一条
+	daily, monthly = 12, 150
+	ns.checkBudgets()
+	titles = recorder.titles()
+	if len(titles) != 3 || titles[2] != "本月花费已达预算的 100%" {
+		t.Fatalf("unexpected monthly notifications: %v", titles)
+	}
+}
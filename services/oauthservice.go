@@ -0,0 +1,481 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"golang.org/x/sync/singleflight"
+)
+
+// AuthTypeOAuth provider 使用 OAuth 访问令牌（订阅账号）而非静态 API Key
+const AuthTypeOAuth = "oauth"
+
+// oauthRefreshSkew 令牌在过期前多久触发刷新
+const oauthRefreshSkew = 5 * time.Minute
+
+// oauthPendingTTL 登录流程（state）有效期
+const oauthPendingTTL = 15 * time.Minute
+
+// OAuthVendor 描述一个 OAuth 提供方的端点与参数
+type OAuthVendor struct {
+	Name         string
+	AuthorizeURL string
+	TokenURL     string
+	ClientID     string
+	RedirectURI  string
+	Scopes       string
+	// JSONTokenRequest 为 true 时令牌接口使用 JSON 请求体，否则使用表单
+	JSONTokenRequest bool
+}
+
+// oauthVendors 内置的订阅账号 OAuth 提供方
+var oauthVendors = map[string]OAuthVendor{
+	"anthropic": {
+		Name:             "anthropic",
+		AuthorizeURL:     "https://claude.ai/oauth/authorize",
+		TokenURL:         "https://console.anthropic.com/v1/oauth/token",
+		ClientID:         "9d1c250a-e61b-44d9-88ed-5944d1962f5e",
+		RedirectURI:      "https://console.anthropic.com/oauth/code/callback",
+		Scopes:           "org:create_api_key user:profile user:inference",
+		JSONTokenRequest: true,
+	},
+	"openai": {
+		Name:         "openai",
+		AuthorizeURL: "https://auth.openai.com/oauth/authorize",
+		TokenURL:     "https://auth.openai.com/oauth/token",
+		ClientID:     "app_EMoamEEZ73f0CkXaXp7hrann",
+		RedirectURI:  "http://localhost:1455/auth/callback",
+		Scopes:       "openid profile email offline_access",
+	},
+}
+
+// OAuthToken 持久化的 OAuth 令牌
+type OAuthToken struct {
+	Vendor       string `json:"vendor"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresAt    int64  `json:"expiresAt"` // Unix 秒
+	AccountID    string `json:"accountId,omitempty"`
+	Email        string `json:"email,omitempty"`
+	UpdatedAt    int64  `json:"updatedAt"`
+}
+
+// OAuthLoginStart 登录流程第一步的返回值
+type OAuthLoginStart struct {
+	AuthURL string `json:"authUrl"`
+	State   string `json:"state"`
+}
+
+// OAuthStatus provider 的 OAuth 登录状态（不包含令牌本身）
+type OAuthStatus struct {
+	Key       string `json:"key"`
+	Vendor    string `json:"vendor"`
+	LoggedIn  bool   `json:"loggedIn"`
+	ExpiresAt int64  `json:"expiresAt"`
+	Email     string `json:"email,omitempty"`
+}
+
+type oauthPendingLogin struct {
+	key       string
+	vendor    string
+	verifier  string
+	createdAt time.Time
+}
+
+// OAuthService 订阅账号 OAuth 登录、令牌存储与自动刷新 (Wails 绑定)
+type OAuthService struct {
+	path       string
+	client     *http.Client
+	mu         sync.Mutex
+	tokens     map[string]*OAuthToken
+	pending    map[string]*oauthPendingLogin
+	refreshing singleflight.Group
+}
+
+// NewOAuthService 创建 OAuth 服务，令牌保存在 ~/.code-switch/oauth-tokens.json
+func NewOAuthService() *OAuthService {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	svc := &OAuthService{
+		path:    filepath.Join(home, ".code-switch", "oauth-tokens.json"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		tokens:  make(map[string]*OAuthToken),
+		pending: make(map[string]*oauthPendingLogin),
+	}
+	if err := svc.load(); err != nil {
+		fmt.Printf("[OAuth] 加载令牌失败: %v\n", err)
+	}
+	return svc
+}
+
+// --- 前端 API ---
+
+// StartLogin 生成带 PKCE 的授权链接，前端在浏览器中打开
+func (s *OAuthService) StartLogin(kind, providerName, vendor string) (*OAuthLoginStart, error) {
+	v, ok := oauthVendors[vendor]
+	if !ok {
+		return nil, fmt.Errorf("不支持的 OAuth 提供方: %s", vendor)
+	}
+
+	verifier, err := randomURLSafe(32)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomURLSafe(16)
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", v.ClientID)
+	params.Set("redirect_uri", v.RedirectURI)
+	params.Set("scope", v.Scopes)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+	params.Set("state", state)
+	if vendor == "anthropic" {
+		params.Set("code", "true")
+	}
+
+	s.mu.Lock()
+	s.pending[state] = &oauthPendingLogin{
+		key:       providerKey(kind, providerName),
+		vendor:    vendor,
+		verifier:  verifier,
+		createdAt: time.Now(),
+	}
+	for st, p := range s.pending {
+		if time.Since(p.createdAt) > oauthPendingTTL {
+			delete(s.pending, st)
+		}
+	}
+	s.mu.Unlock()
+
+	return &OAuthLoginStart{
+		AuthURL: v.AuthorizeURL + "?" + params.Encode(),
+		State:   state,
+	}, nil
+}
+
+// CompleteLogin 使用授权码换取令牌
+// code 可以是授权码本身、"code#state" 形式（Anthropic 页面展示），或完整的回调 URL
+func (s *OAuthService) CompleteLogin(state, code string) (*OAuthStatus, error) {
+	code, state = parseOAuthCode(code, state)
+
+	s.mu.Lock()
+	pending, ok := s.pending[state]
+	if ok {
+		delete(s.pending, state)
+	}
+	s.mu.Unlock()
+	if !ok || time.Since(pending.createdAt) > oauthPendingTTL {
+		return nil, fmt.Errorf("登录会话不存在或已过期，请重新发起登录")
+	}
+
+	v := oauthVendors[pending.vendor]
+	token, err := s.requestToken(v, map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"state":         state,
+		"client_id":     v.ClientID,
+		"redirect_uri":  v.RedirectURI,
+		"code_verifier": pending.verifier,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.tokens[pending.key] = token
+	err = s.saveLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[OAuth] %s 登录成功 (vendor=%s)\n", pending.key, pending.vendor)
+	status := s.statusFor(pending.key, token)
+	return &status, nil
+}
+
+// Logout 删除 provider 的 OAuth 令牌
+func (s *OAuthService) Logout(kind, providerName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, providerKey(kind, providerName))
+	return s.saveLocked()
+}
+
+// GetStatus 查询 provider 的登录状态
+func (s *OAuthService) GetStatus(kind, providerName string) OAuthStatus {
+	key := providerKey(kind, providerName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusFor(key, s.tokens[key])
+}
+
+// ListStatus 列出所有已登录的 OAuth 账号
+func (s *OAuthService) ListStatus() []OAuthStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]OAuthStatus, 0, len(s.tokens))
+	for key, token := range s.tokens {
+		result = append(result, s.statusFor(key, token))
+	}
+	return result
+}
+
+// --- 中继使用 ---
+
+// AccessToken 返回有效的访问令牌，即将过期时自动刷新。
+// 刷新请求在锁外进行，同一账号的并发请求共享一次刷新，其他账号与状态查询不受阻塞
+func (s *OAuthService) AccessToken(kind, providerName string) (*OAuthToken, error) {
+	key := providerKey(kind, providerName)
+	token, err := s.currentToken(key, providerName)
+	if err != nil || !oauthNeedsRefresh(token) {
+		return token, err
+	}
+	refreshed, err, _ := s.refreshing.Do(key, func() (interface{}, error) {
+		return s.refreshToken(key, providerName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *refreshed.(*OAuthToken)
+	return &copied, nil
+}
+
+// currentToken 返回已保存令牌的副本
+func (s *OAuthService) currentToken(key, providerName string) (*OAuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[key]
+	if !ok || token.AccessToken == "" {
+		return nil, fmt.Errorf("provider %s 尚未完成 OAuth 登录", providerName)
+	}
+	copied := *token
+	return &copied, nil
+}
+
+// oauthNeedsRefresh 令牌是否即将过期
+func oauthNeedsRefresh(token *OAuthToken) bool {
+	return token.ExpiresAt > 0 && time.Until(time.Unix(token.ExpiresAt, 0)) < oauthRefreshSkew
+}
+
+// refreshToken 刷新令牌并保存；开始前重新检查过期时间，令牌可能已被上一次刷新更新
+func (s *OAuthService) refreshToken(key, providerName string) (*OAuthToken, error) {
+	token, err := s.currentToken(key, providerName)
+	if err != nil || !oauthNeedsRefresh(token) {
+		return token, err
+	}
+	if token.RefreshToken == "" {
+		return nil, fmt.Errorf("provider %s 的 OAuth 令牌已过期且无法刷新，请重新登录", providerName)
+	}
+	v, ok := oauthVendors[token.Vendor]
+	if !ok {
+		return nil, fmt.Errorf("未知的 OAuth 提供方: %s", token.Vendor)
+	}
+	refreshed, err := s.requestToken(v, map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": token.RefreshToken,
+		"client_id":     v.ClientID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("刷新 OAuth 令牌失败: %w", err)
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	if refreshed.AccountID == "" {
+		refreshed.AccountID = token.AccountID
+	}
+	if refreshed.Email == "" {
+		refreshed.Email = token.Email
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 刷新期间账号可能已登出或重新登录，此时保留当前令牌
+	current, ok := s.tokens[key]
+	if !ok {
+		return nil, fmt.Errorf("provider %s 尚未完成 OAuth 登录", providerName)
+	}
+	if current.AccessToken != token.AccessToken {
+		copied := *current
+		return &copied, nil
+	}
+	s.tokens[key] = refreshed
+	if err := s.saveLocked(); err != nil {
+		fmt.Printf("[OAuth] 保存刷新后的令牌失败: %v\n", err)
+	}
+	fmt.Printf("[OAuth] %s 令牌已刷新\n", key)
+	copied := *refreshed
+	return &copied, nil
+}
+
+// requestToken 调用令牌接口（授权码兑换或刷新）
+func (s *OAuthService) requestToken(v OAuthVendor, params map[string]string) (*OAuthToken, error) {
+	var body io.Reader
+	contentType := "application/x-www-form-urlencoded"
+	if v.JSONTokenRequest {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	} else {
+		form := url.Values{}
+		for k, val := range params {
+			form.Set(k, val)
+		}
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest("POST", v.TokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("令牌接口返回 HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	accessToken := gjson.GetBytes(respBody, "access_token").String()
+	if accessToken == "" {
+		return nil, fmt.Errorf("令牌接口未返回 access_token")
+	}
+	token := &OAuthToken{
+		Vendor:       v.Name,
+		AccessToken:  accessToken,
+		RefreshToken: gjson.GetBytes(respBody, "refresh_token").String(),
+		AccountID:    gjson.GetBytes(respBody, "account.uuid").String(),
+		Email:        gjson.GetBytes(respBody, "account.email_address").String(),
+		UpdatedAt:    time.Now().Unix(),
+	}
+	if expiresIn := gjson.GetBytes(respBody, "expires_in").Int(); expiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second).Unix()
+	}
+	if idToken := gjson.GetBytes(respBody, "id_token").String(); idToken != "" {
+		claims := decodeJWTClaims(idToken)
+		if token.Email == "" {
+			token.Email = gjson.GetBytes(claims, "email").String()
+		}
+		if token.AccountID == "" {
+			token.AccountID = gjson.GetBytes(claims, `https://api\.openai\.com/auth.chatgpt_account_id`).String()
+		}
+	}
+	return token, nil
+}
+
+func (s *OAuthService) statusFor(key string, token *OAuthToken) OAuthStatus {
+	status := OAuthStatus{Key: key}
+	if token == nil {
+		return status
+	}
+	status.Vendor = token.Vendor
+	status.LoggedIn = token.AccessToken != ""
+	status.ExpiresAt = token.ExpiresAt
+	status.Email = token.Email
+	return status
+}
+
+func (s *OAuthService) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, &s.tokens)
+}
+
+func (s *OAuthService) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// parseOAuthCode 兼容 "code#state" 与完整回调 URL 两种粘贴格式
+func parseOAuthCode(code, state string) (string, string) {
+	code = strings.TrimSpace(code)
+	if strings.Contains(code, "code=") {
+		if u, err := url.Parse(code); err == nil {
+			q := u.Query()
+			if st := q.Get("state"); st != "" {
+				state = st
+			}
+			return q.Get("code"), state
+		}
+	}
+	if idx := strings.Index(code, "#"); idx >= 0 {
+		if st := code[idx+1:]; st != "" {
+			state = st
+		}
+		code = code[:idx]
+	}
+	return code, state
+}
+
+func randomURLSafe(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeJWTClaims 解析 JWT 的 payload（不校验签名，仅用于读取账号信息）
+func decodeJWTClaims(token string) []byte {
+	parts := strings.Split(token, ".")
+	if len(parts) < 2 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	return payload
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseOAuthCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		state     string
+		wantCode  string
+		wantState string
+	}{
+		{"纯授权码", "abc123", "s1", "abc123", "s1"},
+		{"code#state 格式", "abc123#s2", "s1", "abc123", "s2"},
+		{"完整回调 URL", "http://localhost:1455/auth/callback?code=xyz&state=s3", "", "xyz", "s3"},
+		{"带空白", "  abc123#s4 \n", "", "abc123", "s4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, state := parseOAuthCode(tt.code, tt.state)
+			if code != tt.wantCode || state != tt.wantState {
+				t.Errorf("parseOAuthCode(%q, %q) = (%q, %q), want (%q, %q)",
+					tt.code, tt.state, code, state, tt.wantCode, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestApplyProviderAuth_OAuthMergesBetaHeader(t *testing.T) {
+	oauth := &OAuthService{
+		tokens: map[string]*OAuthToken{
+			"claude/max": {Vendor: "anthropic", AccessToken: "sk-ant-oat-test"},
+		},
+		pending: map[string]*oauthPendingLogin{},
+	}
+	prs := &ProviderRelayService{oauthService: oauth}
+
+	headers := map[string]string{
+		"X-Api-Key":      "client-key",
+		"Anthropic-Beta": "prompt-caching-2024-07-31",
+	}
+	provider := Provider{Name: "max", AuthType: AuthTypeOAuth}
+	if err := prs.applyProviderAuth("claude", provider, headers); err != nil {
+		t.Fatalf("applyProviderAuth failed: %v", err)
+	}
+
+	if headers["Authorization"] != "Bearer sk-ant-oat-test" {
+		t.Errorf("Authorization = %q", headers["Authorization"])
+	}
+	if _, ok := headers["X-Api-Key"]; ok {
+		t.Errorf("x-api-key should be removed for OAuth providers")
+	}
+	if got := headers["anthropic-beta"]; got != "prompt-caching-2024-07-31,"+anthropicOAuthBeta {
+		t.Errorf("anthropic-beta = %q", got)
+	}
+}
+
+func TestApplyProviderAuth_NotLoggedIn(t *testing.T) {
+	prs := &ProviderRelayService{oauthService: &OAuthService{tokens: map[string]*OAuthToken{}}}
+	err := prs.applyProviderAuth("claude", Provider{Name: "max", AuthType: AuthTypeOAuth}, map[string]string{})
+	if err == nil {
+		t.Fatal("expected error for provider without OAuth token")
+	}
+}
+
+func TestAccessTokenRefreshesOutsideLock(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"fresh","expires_in":3600}`))
+	}))
+	defer server.Close()
+	oauthVendors["test"] = OAuthVendor{Name: "test", TokenURL: server.URL, ClientID: "c"}
+	defer delete(oauthVendors, "test")
+
+	svc := &OAuthService{
+		path:   filepath.Join(t.TempDir(), "oauth-tokens.json"),
+		client: server.Client(),
+		tokens: map[string]*OAuthToken{
+			"claude/max":   {Vendor: "test", AccessToken: "stale", RefreshToken: "r", Email: "a@b.c", ExpiresAt: time.Now().Unix()},
+			"claude/other": {Vendor: "test", AccessToken: "valid"},
+		},
+		pending: map[string]*oauthPendingLogin{},
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 5)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := svc.AccessToken("claude", "max")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tokens[i] = token.AccessToken
+		}(i)
+	}
+
+	// 刷新进行中时，其他账号与状态查询不被阻塞
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&calls) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if token, err := svc.AccessToken("claude", "other"); err != nil || token.AccessToken != "valid" {
+			t.Errorf("other account = %v, %v", token, err)
+		}
+		svc.GetStatus("claude", "max")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("token refresh blocked unrelated calls")
+	}
+
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("token endpoint called %d times, want 1", n)
+	}
+	for _, token := range tokens {
+		if token != "fresh" {
+			t.Fatalf("tokens = %v", tokens)
+		}
+	}
+	if saved := svc.tokens["claude/max"]; saved.RefreshToken != "r" || saved.Email != "a@b.c" {
+		t.Errorf("refreshed token lost fields: %+v", saved)
+	}
+	// 已刷新的令牌不再请求令牌接口
+	if _, err := svc.AccessToken("claude", "max"); err != nil || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("unexpected refresh: %v calls=%d", err, calls)
+	}
+}
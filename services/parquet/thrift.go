@@ -0,0 +1,103 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol 类型标识（仅实现 Parquet 元数据用到的部分）
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// compactWriter Thrift compact protocol 编码器
+type compactWriter struct {
+	buf       bytes.Buffer
+	lastField []int16
+}
+
+func newCompactWriter() *compactWriter {
+	return &compactWriter{lastField: []int16{0}}
+}
+
+func (w *compactWriter) varint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	w.buf.Write(tmp[:n])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (w *compactWriter) fieldHeader(id int16, typ byte) {
+	last := w.lastField[len(w.lastField)-1]
+	if delta := id - last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(zigzag(int64(id)))
+	}
+	w.lastField[len(w.lastField)-1] = id
+}
+
+func (w *compactWriter) i32Field(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *compactWriter) i64Field(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *compactWriter) stringField(id int16, v string) {
+	w.fieldHeader(id, thriftBinary)
+	w.varint(uint64(len(v)))
+	w.buf.WriteString(v)
+}
+
+// listHeader 写入列表头，元素随后按顺序写入
+func (w *compactWriter) listHeader(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		w.buf.WriteByte(0xF0 | elemType)
+		w.varint(uint64(size))
+	}
+}
+
+func (w *compactWriter) listI32(v int32) {
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *compactWriter) listString(v string) {
+	w.varint(uint64(len(v)))
+	w.buf.WriteString(v)
+}
+
+// beginStruct 开始一个嵌套结构（字段或列表元素）
+func (w *compactWriter) beginStruct() {
+	w.lastField = append(w.lastField, 0)
+}
+
+// structField 以字段形式开始嵌套结构
+func (w *compactWriter) structField(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.beginStruct()
+}
+
+// endStruct 写入 STOP 并回到外层结构
+func (w *compactWriter) endStruct() {
+	w.buf.WriteByte(0)
+	w.lastField = w.lastField[:len(w.lastField)-1]
+}
+
+func (w *compactWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
@@ -0,0 +1,360 @@
+// Package parquet 提供最小化的 Parquet 文件写入实现（PLAIN 编码、REQUIRED 扁平列），
+// 用于日志导出，无需引入完整的 Arrow / Parquet 依赖
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ColumnType 列类型
+type ColumnType int
+
+const (
+	Int64 ColumnType = iota
+	Double
+	String
+	Bool
+)
+
+// Parquet 物理类型、编码与压缩标识
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	convertedUTF8 = 0
+	repRequired   = 0
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecUncompressed = 0
+	codecGzip         = 2
+
+	pageData = 0
+)
+
+const magic = "PAR1"
+
+// DefaultRowGroupSize 每个行组的默认行数，导出时按行组分块写入，内存占用与总行数无关
+const DefaultRowGroupSize = 10000
+
+// Column 列定义
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Options 写入选项
+type Options struct {
+	RowGroupSize int  // 每个行组的行数，<=0 使用 DefaultRowGroupSize
+	Gzip         bool // 使用 GZIP 压缩数据页（文件本身仍是标准 Parquet）
+	CreatedBy    string
+}
+
+type columnChunkMeta struct {
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroupMeta struct {
+	numRows   int64
+	totalSize int64
+	columns   []columnChunkMeta
+}
+
+// Writer 按行写入 Parquet 文件，满一个行组时落盘
+type Writer struct {
+	w         io.Writer
+	offset    int64
+	schema    []Column
+	opts      Options
+	buffers   [][]any
+	buffered  int
+	numRows   int64
+	rowGroups []rowGroupMeta
+	closed    bool
+}
+
+// NewWriter 创建 Writer 并写入文件头
+func NewWriter(w io.Writer, schema []Column, opts Options) (*Writer, error) {
+	if len(schema) == 0 {
+		return nil, errors.New("parquet: empty schema")
+	}
+	if opts.RowGroupSize <= 0 {
+		opts.RowGroupSize = DefaultRowGroupSize
+	}
+	pw := &Writer{w: w, schema: schema, opts: opts, buffers: make([][]any, len(schema))}
+	if err := pw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *Writer) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	return err
+}
+
+// Write 追加一行，值的顺序与 schema 一致
+func (pw *Writer) Write(row []any) error {
+	if pw.closed {
+		return errors.New("parquet: writer closed")
+	}
+	if len(row) != len(pw.schema) {
+		return fmt.Errorf("parquet: row has %d values, schema has %d columns", len(row), len(pw.schema))
+	}
+	for i, v := range row {
+		pw.buffers[i] = append(pw.buffers[i], v)
+	}
+	pw.buffered++
+	if pw.buffered >= pw.opts.RowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+// NumRows 已写入的行数
+func (pw *Writer) NumRows() int64 {
+	return pw.numRows + int64(pw.buffered)
+}
+
+// flushRowGroup 将缓冲的行写成一个行组
+func (pw *Writer) flushRowGroup() error {
+	if pw.buffered == 0 {
+		return nil
+	}
+	group := rowGroupMeta{numRows: int64(pw.buffered)}
+	for i, col := range pw.schema {
+		values, err := encodePlain(col.Type, pw.buffers[i])
+		if err != nil {
+			return fmt.Errorf("parquet: column %s: %w", col.Name, err)
+		}
+		page := values
+		if pw.opts.Gzip {
+			if page, err = gzipBytes(values); err != nil {
+				return err
+			}
+		}
+		header := pageHeader(len(values), len(page), pw.buffered)
+
+		meta := columnChunkMeta{
+			offset:           pw.offset,
+			numValues:        int64(pw.buffered),
+			uncompressedSize: int64(len(header) + len(values)),
+			compressedSize:   int64(len(header) + len(page)),
+		}
+		if err := pw.write(header); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		group.totalSize += meta.uncompressedSize
+		group.columns = append(group.columns, meta)
+		pw.buffers[i] = pw.buffers[i][:0]
+	}
+	pw.rowGroups = append(pw.rowGroups, group)
+	pw.numRows += int64(pw.buffered)
+	pw.buffered = 0
+	return nil
+}
+
+// Close 写入剩余行与文件尾元数据，不关闭底层 io.Writer
+func (pw *Writer) Close() error {
+	if pw.closed {
+		return nil
+	}
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+	pw.closed = true
+	footer := pw.fileMetadata()
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	if err := pw.write(size[:]); err != nil {
+		return err
+	}
+	return pw.write([]byte(magic))
+}
+
+func physicalType(t ColumnType) int32 {
+	switch t {
+	case Double:
+		return typeDouble
+	case String:
+		return typeByteArray
+	case Bool:
+		return typeBoolean
+	default:
+		return typeInt64
+	}
+}
+
+func (pw *Writer) codec() int32 {
+	if pw.opts.Gzip {
+		return codecGzip
+	}
+	return codecUncompressed
+}
+
+// fileMetadata 编码 FileMetaData
+func (pw *Writer) fileMetadata() []byte {
+	w := newCompactWriter()
+	w.i32Field(1, 1) // version
+
+	w.listHeader(2, thriftStruct, len(pw.schema)+1)
+	w.beginStruct()
+	w.stringField(4, "schema")
+	w.i32Field(5, int32(len(pw.schema)))
+	w.endStruct()
+	for _, col := range pw.schema {
+		w.beginStruct()
+		w.i32Field(1, physicalType(col.Type))
+		w.i32Field(3, repRequired)
+		w.stringField(4, col.Name)
+		if col.Type == String {
+			w.i32Field(6, convertedUTF8)
+		}
+		w.endStruct()
+	}
+
+	w.i64Field(3, pw.numRows)
+
+	w.listHeader(4, thriftStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		w.beginStruct()
+		w.listHeader(1, thriftStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			col := pw.schema[i]
+			w.beginStruct()
+			w.i64Field(2, chunk.offset)
+			w.structField(3)
+			w.i32Field(1, physicalType(col.Type))
+			w.listHeader(2, thriftI32, 1)
+			w.listI32(encodingPlain)
+			w.listHeader(3, thriftBinary, 1)
+			w.listString(col.Name)
+			w.i32Field(4, pw.codec())
+			w.i64Field(5, chunk.numValues)
+			w.i64Field(6, chunk.uncompressedSize)
+			w.i64Field(7, chunk.compressedSize)
+			w.i64Field(9, chunk.offset)
+			w.endStruct() // ColumnMetaData
+			w.endStruct() // ColumnChunk
+		}
+		w.i64Field(2, group.totalSize)
+		w.i64Field(3, group.numRows)
+		w.endStruct()
+	}
+
+	createdBy := pw.opts.CreatedBy
+	if createdBy == "" {
+		createdBy = "code-switch"
+	}
+	w.stringField(6, createdBy)
+	w.endStruct()
+	return w.bytes()
+}
+
+// pageHeader 编码 DATA_PAGE 的 PageHeader
+func pageHeader(uncompressed, compressed, numValues int) []byte {
+	w := newCompactWriter()
+	w.i32Field(1, pageData)
+	w.i32Field(2, int32(uncompressed))
+	w.i32Field(3, int32(compressed))
+	w.structField(5)
+	w.i32Field(1, int32(numValues))
+	w.i32Field(2, encodingPlain)
+	w.i32Field(3, encodingRLE)
+	w.i32Field(4, encodingRLE)
+	w.endStruct()
+	w.endStruct()
+	return w.bytes()
+}
+
+// encodePlain 按 PLAIN 编码一列的值；REQUIRED 列无需定义 / 重复级别
+func encodePlain(t ColumnType, values []any) ([]byte, error) {
+	var buf bytes.Buffer
+	var scratch [8]byte
+	switch t {
+	case Bool:
+		packed := make([]byte, (len(values)+7)/8)
+		for i, v := range values {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("expected bool, got %T", v)
+			}
+			if b {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		buf.Write(packed)
+	case Int64:
+		for _, v := range values {
+			n, ok := toInt64(v)
+			if !ok {
+				return nil, fmt.Errorf("expected integer, got %T", v)
+			}
+			binary.LittleEndian.PutUint64(scratch[:], uint64(n))
+			buf.Write(scratch[:])
+		}
+	case Double:
+		for _, v := range values {
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("expected float64, got %T", v)
+			}
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(f))
+			buf.Write(scratch[:])
+		}
+	case String:
+		for _, v := range values {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected string, got %T", v)
+			}
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(s)))
+			buf.Write(scratch[:4])
+			buf.WriteString(s)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
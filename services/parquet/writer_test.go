@@ -0,0 +1,177 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// compactReader 测试用的 Thrift compact 解码器，把结构解码为 field id -> value
+type compactReader struct {
+	r *bytes.Reader
+}
+
+func (cr *compactReader) varint(t *testing.T) uint64 {
+	v, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		t.Fatalf("read varint: %v", err)
+	}
+	return v
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (cr *compactReader) value(t *testing.T, typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return unzigzag(cr.varint(t))
+	case thriftBinary:
+		n := cr.varint(t)
+		b := make([]byte, n)
+		io.ReadFull(cr.r, b)
+		return string(b)
+	case thriftList:
+		h, _ := cr.r.ReadByte()
+		size := int(h >> 4)
+		if size == 15 {
+			size = int(cr.varint(t))
+		}
+		items := make([]any, size)
+		for i := range items {
+			items[i] = cr.value(t, h&0x0F)
+		}
+		return items
+	case thriftStruct:
+		return cr.structValue(t)
+	}
+	t.Fatalf("unsupported thrift type %d", typ)
+	return nil
+}
+
+func (cr *compactReader) structValue(t *testing.T) map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		h, err := cr.r.ReadByte()
+		if err != nil {
+			t.Fatalf("read field header: %v", err)
+		}
+		if h == 0 {
+			return fields
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(unzigzag(cr.varint(t)))
+		}
+		last = id
+		fields[id] = cr.value(t, h&0x0F)
+	}
+}
+
+func readFooter(t *testing.T, data []byte) map[int16]any {
+	if string(data[:4]) != magic || string(data[len(data)-4:]) != magic {
+		t.Fatal("missing PAR1 magic")
+	}
+	size := binary.LittleEndian.Uint32(data[len(data)-8 : len(data)-4])
+	footer := data[len(data)-8-int(size) : len(data)-8]
+	return (&compactReader{r: bytes.NewReader(footer)}).structValue(t)
+}
+
+// readColumn 读取指定行组、列的数据页内容（已解压）
+func readColumn(t *testing.T, data []byte, meta map[int16]any, group, column int) []byte {
+	rowGroups := meta[4].([]any)
+	chunk := rowGroups[group].(map[int16]any)[1].([]any)[column].(map[int16]any)
+	colMeta := chunk[3].(map[int16]any)
+	offset := colMeta[9].(int64)
+
+	r := bytes.NewReader(data[offset:])
+	header := (&compactReader{r: r}).structValue(t)
+	page := make([]byte, header[3].(int64))
+	io.ReadFull(r, page)
+	if colMeta[4].(int64) == codecGzip {
+		zr, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			t.Fatalf("gzip page: %v", err)
+		}
+		page, _ = io.ReadAll(zr)
+	}
+	if int64(len(page)) != header[2].(int64) {
+		t.Fatalf("uncompressed size mismatch: %d vs %d", len(page), header[2])
+	}
+	return page
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		var buf bytes.Buffer
+		schema := []Column{{"id", Int64}, {"model", String}, {"cost", Double}, {"stream", Bool}}
+		w, err := NewWriter(&buf, schema, Options{RowGroupSize: 2, Gzip: gz})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := [][]any{
+			{int64(1), "claude-sonnet", 0.5, true},
+			{2, "gpt-5", 1.25, false},
+			{int64(3), "", 0.0, true},
+		}
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data := buf.Bytes()
+		meta := readFooter(t, data)
+		if meta[3].(int64) != 3 {
+			t.Fatalf("expected 3 rows, got %v", meta[3])
+		}
+		if groups := meta[4].([]any); len(groups) != 2 {
+			t.Fatalf("expected 2 row groups, got %d", len(groups))
+		}
+		schemaElems := meta[2].([]any)
+		if len(schemaElems) != 5 || schemaElems[2].(map[int16]any)[4] != "model" {
+			t.Fatalf("unexpected schema %v", schemaElems)
+		}
+
+		ids := readColumn(t, data, meta, 0, 0)
+		if binary.LittleEndian.Uint64(ids[8:]) != 2 {
+			t.Fatalf("unexpected id column %v", ids)
+		}
+		models := readColumn(t, data, meta, 0, 1)
+		if n := binary.LittleEndian.Uint32(models); string(models[4:4+n]) != "claude-sonnet" {
+			t.Fatalf("unexpected string column %q", models)
+		}
+		costs := readColumn(t, data, meta, 0, 2)
+		if math.Float64frombits(binary.LittleEndian.Uint64(costs[8:])) != 1.25 {
+			t.Fatalf("unexpected double column %v", costs)
+		}
+		flags := readColumn(t, data, meta, 0, 3)
+		if flags[0] != 0b01 {
+			t.Fatalf("unexpected bool column %08b", flags[0])
+		}
+	}
+}
+
+func TestWriterRejectsMismatchedRow(t *testing.T) {
+	w, err := NewWriter(io.Discard, []Column{{"id", Int64}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]any{int64(1), "extra"}); err == nil {
+		t.Fatal("expected error for mismatched row")
+	}
+	if err := w.Write([]any{"not a number"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("expected type error on flush")
+	}
+}
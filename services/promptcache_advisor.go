@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// Anthropic prompt cache 价格倍数（相对基础输入价格）：5 分钟 TTL 写入 / 1 小时 TTL 写入 / 命中读取
+	cacheWriteMultiplier   = 1.25
+	cacheWrite1hMultiplier = 2.0
+	cacheReadMultiplier    = 0.1
+	// cacheMinPrefixTokens 可缓存前缀的最小长度（Sonnet / Opus），更短的请求不建议加 cache_control
+	cacheMinPrefixTokens = 1024
+	// cacheDefaultTTL 默认缓存 TTL，两次请求间隔超过它时缓存已过期
+	cacheDefaultTTL = 5 * time.Minute
+	// promptCacheMaxRequests 每次分析最多读取的最近请求数（请求体逐行流式处理，不整体加载）
+	promptCacheMaxRequests = 2000
+	// promptCacheMaxConversations 返回的会话明细条数
+	promptCacheMaxConversations = 20
+)
+
+// PromptCacheAnalysis Anthropic prompt cache 使用分析：命中 / 写入比例、按会话明细与优化建议。
+// 请求体相关的检查（cache_control、系统提示词 / tools 变化）需要开启 Body 日志
+type PromptCacheAnalysis struct {
+	Requests             int64                     `json:"requests"`
+	InspectedBodies      int64                     `json:"inspected_bodies"`
+	CacheControlRequests int64                     `json:"cache_control_requests"`
+	InputTokens          int64                     `json:"input_tokens"`
+	CacheReadTokens      int64                     `json:"cache_read_tokens"`
+	CacheCreateTokens    int64                     `json:"cache_create_tokens"`
+	HitRatio             float64                   `json:"hit_ratio"`
+	CreationRatio        float64                   `json:"creation_ratio"`
+	EstimatedSavings     float64                   `json:"estimated_savings"`
+	Conversations        []PromptCacheConversation `json:"conversations"`
+	Recommendations      []PromptCacheAdvice       `json:"recommendations"`
+}
+
+// PromptCacheConversation 单个会话的缓存命中情况
+type PromptCacheConversation struct {
+	ConversationID    string  `json:"conversation_id"`
+	Requests          int64   `json:"requests"`
+	InputTokens       int64   `json:"input_tokens"`
+	CacheReadTokens   int64   `json:"cache_read_tokens"`
+	CacheCreateTokens int64   `json:"cache_create_tokens"`
+	HitRatio          float64 `json:"hit_ratio"`
+	CreationRatio     float64 `json:"creation_ratio"`
+	CacheControl      bool    `json:"cache_control"`
+	SystemChanges     int     `json:"system_changes"`
+	ToolsChanges      int     `json:"tools_changes"`
+	ExpiredReuses     int     `json:"expired_reuses"`
+	EstimatedSavings  float64 `json:"estimated_savings"`
+}
+
+// PromptCacheAdvice 一条优化建议；ConversationID 为空表示整体建议
+type PromptCacheAdvice struct {
+	Kind             string  `json:"kind"` // no_cache_control / system_prompt_changes / tools_change / cache_expired
+	ConversationID   string  `json:"conversation_id,omitempty"`
+	Message          string  `json:"message"`
+	Requests         int     `json:"requests"`
+	EstimatedSavings float64 `json:"estimated_savings"`
+}
+
+// promptCacheConversationState 按请求顺序累积的会话状态
+type promptCacheConversationState struct {
+	stat        PromptCacheConversation
+	bodies      int
+	lastSystem  [32]byte
+	lastTools   [32]byte
+	lastAt      time.Time
+	minPrefix   int64
+	inputPrice  float64
+	systemWaste float64
+	toolsWaste  float64
+	firstCreate float64
+	expiredCost float64
+}
+
+// promptCacheRecord 参与分析的一条请求
+type promptCacheRecord struct {
+	conversationID, createdAt, body, blobRefs string
+	input, cacheCreate, cacheRead             int64
+	inputCost, cacheCreateCost                float64
+}
+
+// analyzePromptCache 分析 since 之后最近的 Claude 请求
+func analyzePromptCache(db *sql.DB, platform string, since time.Time) (PromptCacheAnalysis, error) {
+	result := PromptCacheAnalysis{
+		Conversations:   make([]PromptCacheConversation, 0),
+		Recommendations: make([]PromptCacheAdvice, 0),
+	}
+
+	filter := "created_at >= ? AND (platform = 'claude' OR model LIKE 'claude%')"
+	args := []any{since.UTC().Format(timeLayout)}
+	if platform != "" {
+		filter += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query := `
+		SELECT COALESCE(l.conversation_id, ''), l.created_at,
+			COALESCE(l.input_tokens, 0), COALESCE(l.cache_create_tokens, 0), COALESCE(l.cache_read_tokens, 0),
+			COALESCE(l.input_cost, 0), COALESCE(l.cache_create_cost, 0),
+			COALESCE(b.request_body, ''), COALESCE(b.blob_refs, '')
+		FROM request_log l
+		LEFT JOIN request_log_body b ON b.trace_id = l.trace_id
+		WHERE l.id IN (SELECT id FROM request_log WHERE ` + filter + ` ORDER BY id DESC LIMIT ?)
+		ORDER BY l.conversation_id, l.id`
+	rows, err := db.Query(query, append(args, promptCacheMaxRequests)...)
+	if err != nil {
+		return result, err
+	}
+	// 先读完结果集再还原去重的请求体，避免遍历结果集时占用连接再查询 blob
+	var records []promptCacheRecord
+	for rows.Next() {
+		var r promptCacheRecord
+		if err := rows.Scan(&r.conversationID, &r.createdAt, &r.input, &r.cacheCreate, &r.cacheRead, &r.inputCost, &r.cacheCreateCost, &r.body, &r.blobRefs); err != nil {
+			rows.Close()
+			return result, err
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	blobs := newBodyBlobResolver(db)
+	conversations := make(map[string]*promptCacheConversationState)
+	order := make([]string, 0)
+	for _, r := range records {
+		conversationID, createdAt, body := r.conversationID, r.createdAt, blobs.expand(r.body, r.blobRefs)
+		input, cacheCreate, cacheRead := r.input, r.cacheCreate, r.cacheRead
+		inputCost, cacheCreateCost := r.inputCost, r.cacheCreateCost
+		result.Requests++
+		result.InputTokens += input
+		result.CacheReadTokens += cacheRead
+		result.CacheCreateTokens += cacheCreate
+		if conversationID == "" {
+			continue
+		}
+
+		state := conversations[conversationID]
+		if state == nil {
+			state = &promptCacheConversationState{
+				stat: PromptCacheConversation{ConversationID: conversationID},
+			}
+			conversations[conversationID] = state
+			order = append(order, conversationID)
+		}
+		first := state.stat.Requests == 0
+		state.stat.Requests++
+		state.stat.InputTokens += input
+		state.stat.CacheReadTokens += cacheRead
+		state.stat.CacheCreateTokens += cacheCreate
+		if input > 0 && inputCost > 0 {
+			state.inputPrice = inputCost / float64(input)
+		}
+		if prefix := input + cacheRead + cacheCreate; first || prefix < state.minPrefix {
+			state.minPrefix = prefix
+		}
+		if first {
+			state.firstCreate = cacheCreateCost
+		}
+
+		// 距上次请求超过默认 TTL 且重新写入缓存：缓存已过期
+		at, hasTime := parseRollupTime(createdAt)
+		if hasTime && !first && !state.lastAt.IsZero() && at.Sub(state.lastAt) > cacheDefaultTTL && cacheCreate > 0 && cacheRead == 0 {
+			state.stat.ExpiredReuses++
+			state.expiredCost += cacheCreateCost
+		}
+		if hasTime {
+			state.lastAt = at
+		}
+
+		if body == "" {
+			continue
+		}
+		result.InspectedBodies++
+		raw := []byte(body)
+		if bytes.Contains(raw, []byte(`"cache_control"`)) {
+			result.CacheControlRequests++
+			state.stat.CacheControl = true
+		}
+		// 截断的请求体可能缺少 system / tools，缺失时不参与比较
+		parsed := gjson.ParseBytes(raw)
+		if system := parsed.Get("system"); system.Exists() {
+			hash := sha256.Sum256([]byte(system.Raw))
+			if state.bodies > 0 && state.lastSystem != ([32]byte{}) && hash != state.lastSystem {
+				state.stat.SystemChanges++
+				state.systemWaste += cacheCreateCost
+			}
+			state.lastSystem = hash
+		}
+		if tools := parsed.Get("tools"); tools.Exists() {
+			hash := sha256.Sum256([]byte(tools.Raw))
+			if state.bodies > 0 && state.lastTools != ([32]byte{}) && hash != state.lastTools {
+				state.stat.ToolsChanges++
+				state.toolsWaste += cacheCreateCost
+			}
+			state.lastTools = hash
+		}
+		state.bodies++
+	}
+
+	result.HitRatio, result.CreationRatio = cacheRatios(result.InputTokens, result.CacheReadTokens, result.CacheCreateTokens)
+	// 缓存写入后改为命中读取可节省的比例
+	rewriteSaving := 1 - cacheReadMultiplier/cacheWriteMultiplier
+	var noCacheControl PromptCacheAdvice
+	for _, id := range order {
+		state := conversations[id]
+		stat := &state.stat
+		stat.HitRatio, stat.CreationRatio = cacheRatios(stat.InputTokens, stat.CacheReadTokens, stat.CacheCreateTokens)
+		if stat.Requests < 2 {
+			continue
+		}
+
+		// 多轮长请求未使用 cache_control：重复前缀按命中价格计费可节省的金额（扣除首次写入溢价）
+		if state.bodies > 0 && !stat.CacheControl && stat.CacheReadTokens == 0 && state.minPrefix >= cacheMinPrefixTokens && state.inputPrice > 0 {
+			prefixCost := float64(state.minPrefix) * state.inputPrice
+			saving := float64(stat.Requests-1)*prefixCost*(1-cacheReadMultiplier) - prefixCost*(cacheWriteMultiplier-1)
+			if saving > 0 {
+				stat.EstimatedSavings += saving
+				noCacheControl.Requests += int(stat.Requests)
+				noCacheControl.EstimatedSavings += saving
+			}
+		}
+		if stat.SystemChanges > 0 && stat.SystemChanges*2 >= state.bodies-1 {
+			saving := state.systemWaste * rewriteSaving
+			stat.EstimatedSavings += saving
+			result.Recommendations = append(result.Recommendations, PromptCacheAdvice{
+				Kind:             "system_prompt_changes",
+				ConversationID:   id,
+				Message:          fmt.Sprintf("system prompt changed in %d of %d requests, breaking the cache; move dynamic content (dates, file lists) after the last cache breakpoint", stat.SystemChanges, state.bodies),
+				Requests:         stat.SystemChanges,
+				EstimatedSavings: saving,
+			})
+		}
+		if stat.ToolsChanges > 0 && stat.ToolsChanges*2 >= state.bodies-1 {
+			saving := state.toolsWaste * rewriteSaving
+			stat.EstimatedSavings += saving
+			result.Recommendations = append(result.Recommendations, PromptCacheAdvice{
+				Kind:             "tools_change",
+				ConversationID:   id,
+				Message:          fmt.Sprintf("tool definitions changed in %d of %d requests; keep the tools list and order stable to reuse the cached prefix", stat.ToolsChanges, state.bodies),
+				Requests:         stat.ToolsChanges,
+				EstimatedSavings: saving,
+			})
+		}
+		// 1 小时 TTL：过期后的重写改为命中，代价是首次写入价格更高
+		if stat.ExpiredReuses > 0 {
+			saving := state.expiredCost*rewriteSaving - state.firstCreate*(cacheWrite1hMultiplier/cacheWriteMultiplier-1)
+			if saving > 0 {
+				stat.EstimatedSavings += saving
+				result.Recommendations = append(result.Recommendations, PromptCacheAdvice{
+					Kind:             "cache_expired",
+					ConversationID:   id,
+					Message:          fmt.Sprintf("cache expired %d times between requests more than 5 minutes apart; use \"ttl\": \"1h\" on the cache breakpoint", stat.ExpiredReuses),
+					Requests:         stat.ExpiredReuses,
+					EstimatedSavings: saving,
+				})
+			}
+		}
+		result.EstimatedSavings += stat.EstimatedSavings
+		result.Conversations = append(result.Conversations, *stat)
+	}
+	if noCacheControl.Requests > 0 {
+		noCacheControl.Kind = "no_cache_control"
+		noCacheControl.Message = fmt.Sprintf("%d requests in multi-turn conversations resend a prefix of %d+ tokens without cache_control; add a cache breakpoint after the system prompt and tools", noCacheControl.Requests, cacheMinPrefixTokens)
+		result.Recommendations = append(result.Recommendations, noCacheControl)
+	}
+
+	sort.SliceStable(result.Recommendations, func(i, j int) bool {
+		return result.Recommendations[i].EstimatedSavings > result.Recommendations[j].EstimatedSavings
+	})
+	sort.SliceStable(result.Conversations, func(i, j int) bool {
+		if result.Conversations[i].EstimatedSavings != result.Conversations[j].EstimatedSavings {
+			return result.Conversations[i].EstimatedSavings > result.Conversations[j].EstimatedSavings
+		}
+		return result.Conversations[i].Requests > result.Conversations[j].Requests
+	})
+	if len(result.Conversations) > promptCacheMaxConversations {
+		result.Conversations = result.Conversations[:promptCacheMaxConversations]
+	}
+	return result, nil
+}
+
+// cacheRatios 命中比例与写入比例，分母为全部输入 token（未缓存 + 命中 + 写入）
+func cacheRatios(input, cacheRead, cacheCreate int64) (float64, float64) {
+	total := input + cacheRead + cacheCreate
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(cacheRead) / float64(total), float64(cacheCreate) / float64(total)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestPromptCacheAdvisor(t *testing.T) {
+	openAnalyticsDB(t, "promptcache.db")
+	db, _ := xdb.DB("default")
+
+	start := time.Now().UTC().Add(-3 * time.Hour)
+	n := 0
+	insert := func(conversation string, at time.Time, input, create, read int64, body string) {
+		t.Helper()
+		n++
+		traceID := fmt.Sprintf("t%d", n)
+		// 基础输入价格 $3 / MTok
+		if _, err := db.Exec(`INSERT INTO request_log (trace_id, conversation_id, platform, model, http_code, input_tokens, cache_create_tokens, cache_read_tokens, input_cost, cache_create_cost, created_at)
+			VALUES (?, ?, 'claude', 'claude-sonnet-4', 200, ?, ?, ?, ?, ?, ?)`,
+			traceID, conversation, input, create, read, float64(input)*3e-6, float64(create)*3.75e-6, at.Format(timeLayout)); err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			db.Exec("INSERT INTO request_log_body (trace_id, request_body) VALUES (?, ?)", traceID, body)
+		}
+	}
+
+	// 每次请求系统提示词都带时间戳，缓存每次重写
+	for i := 0; i < 4; i++ {
+		body := fmt.Sprintf(`{"system":[{"type":"text","text":"now=%d","cache_control":{"type":"ephemeral"}}],"tools":[{"name":"read"}],"messages":[]}`, i)
+		insert("volatile", start.Add(time.Duration(i)*time.Minute), 10, 5000, 0, body)
+	}
+	// 未使用 cache_control 的多轮长对话
+	for i := 0; i < 3; i++ {
+		insert("plain", start.Add(time.Duration(i)*time.Minute), 8000+int64(i)*500, 0, 0, `{"system":"you are helpful","messages":[]}`)
+	}
+	// 间隔超过 5 分钟，缓存过期后重新写入
+	insert("slow", start, 10, 6000, 0, `{"system":[{"type":"text","text":"s","cache_control":{"type":"ephemeral"}}],"messages":[]}`)
+	insert("slow", start.Add(2*time.Minute), 10, 0, 6000, "")
+	insert("slow", start.Add(20*time.Minute), 10, 6000, 0, "")
+	insert("slow", start.Add(40*time.Minute), 10, 6000, 0, "")
+	// 其他平台不参与分析
+	db.Exec("INSERT INTO request_log (conversation_id, platform, model, input_tokens, created_at) VALUES ('codex', 'codex', 'gpt-5', 99999, ?)", start.Format(timeLayout))
+
+	result, err := NewLogService().CostAnalysis("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := result.PromptCache
+	if cache.Requests != 11 || cache.InspectedBodies != 8 || cache.CacheControlRequests != 5 || cache.HitRatio <= 0 {
+		t.Fatalf("unexpected prompt cache summary: %+v", cache)
+	}
+
+	advice := make(map[string]PromptCacheAdvice)
+	for _, a := range cache.Recommendations {
+		advice[a.Kind] = a
+		if a.EstimatedSavings <= 0 {
+			t.Fatalf("expected positive savings for %+v", a)
+		}
+	}
+	if a := advice["system_prompt_changes"]; a.ConversationID != "volatile" || a.Requests != 3 {
+		t.Fatalf("expected volatile system prompt to be flagged, got %+v", cache.Recommendations)
+	}
+	if _, ok := advice["tools_change"]; ok {
+		t.Fatal("stable tools must not be flagged")
+	}
+	if a := advice["no_cache_control"]; a.Requests != 3 {
+		t.Fatalf("expected uncached conversation to be flagged, got %+v", cache.Recommendations)
+	}
+	if a := advice["cache_expired"]; a.ConversationID != "slow" || a.Requests != 2 {
+		t.Fatalf("expected expired cache to be flagged, got %+v", cache.Recommendations)
+	}
+	if len(cache.Conversations) != 3 || cache.Conversations[0].EstimatedSavings < cache.Conversations[2].EstimatedSavings {
+		t.Fatalf("expected conversations ordered by savings, got %+v", cache.Conversations)
+	}
+}
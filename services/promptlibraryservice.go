@@ -0,0 +1,528 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/sjson"
+)
+
+// 提示词库：保存带变量的命名提示词模板（标签、版本历史），渲染后经网关发送，
+// 支持导入 / 导出以便团队共享。与 Skills 互补，用于不需要打包成 skill 的日常提示词。
+//
+// 模板变量写作 {{name}}；声明过的变量可设置默认值与是否必填，未声明但出现在模板中的变量视为必填。
+
+const (
+	promptLibraryFile = "prompt-library.json"
+	// promptHistoryMax 每个模板保留的历史版本数
+	promptHistoryMax = 20
+	// promptExportKind 导出文件标识
+	promptExportKind = "code-switch-prompts"
+)
+
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// PromptVariable 模板变量
+type PromptVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptVersion 模板的历史版本
+type PromptVersion struct {
+	Version   int              `json:"version"`
+	System    string           `json:"system,omitempty"`
+	Template  string           `json:"template"`
+	Variables []PromptVariable `json:"variables,omitempty"`
+	UpdatedAt int64            `json:"updated_at"`
+}
+
+// PromptTemplate 命名提示词模板
+type PromptTemplate struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Tags        []string         `json:"tags,omitempty"`
+	Endpoint    string           `json:"endpoint,omitempty"` // 发送使用的网关端点，默认 /v1/chat/completions
+	Model       string           `json:"model,omitempty"`
+	MaxTokens   int              `json:"max_tokens,omitempty"`
+	System      string           `json:"system,omitempty"`
+	Template    string           `json:"template"`
+	Variables   []PromptVariable `json:"variables,omitempty"`
+	Version     int              `json:"version"`
+	UpdatedAt   int64            `json:"updated_at"`
+	History     []PromptVersion  `json:"history,omitempty"` // 旧版本，最新的在前
+}
+
+// RenderedPrompt 渲染结果：替换变量后的文本与可直接发送到网关的请求体
+type RenderedPrompt struct {
+	Endpoint string `json:"endpoint"`
+	System   string `json:"system,omitempty"`
+	Text     string `json:"text"`
+	Body     string `json:"body"`
+}
+
+// PromptSendResult 发送结果
+type PromptSendResult struct {
+	Rendered RenderedPrompt  `json:"rendered"`
+	Result   BatchItemResult `json:"result"`
+}
+
+// PromptImportResult 导入统计
+type PromptImportResult struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+type promptLibraryStore struct {
+	Prompts []PromptTemplate `json:"prompts"`
+}
+
+// promptExport 导出文件格式（不含历史版本）
+type promptExport struct {
+	Kind       string           `json:"kind"`
+	ExportedAt string           `json:"exported_at"`
+	Prompts    []PromptTemplate `json:"prompts"`
+}
+
+// PromptLibraryService 提示词库
+type PromptLibraryService struct {
+	relay *ProviderRelayService
+	path  string
+	mu    sync.Mutex
+}
+
+func NewPromptLibraryService(relay *ProviderRelayService) *PromptLibraryService {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return &PromptLibraryService{
+		relay: relay,
+		path:  filepath.Join(home, ".code-switch", promptLibraryFile),
+	}
+}
+
+// ListPrompts 按名称排序列出模板，tag 非空时只返回带该标签的模板
+func (pls *PromptLibraryService) ListPrompts(tag string) ([]PromptTemplate, error) {
+	pls.mu.Lock()
+	defer pls.mu.Unlock()
+	store, err := pls.load()
+	if err != nil {
+		return nil, err
+	}
+	prompts := make([]PromptTemplate, 0, len(store.Prompts))
+	for _, p := range store.Prompts {
+		if tag == "" || slices.Contains(p.Tags, tag) {
+			prompts = append(prompts, p)
+		}
+	}
+	sort.Slice(prompts, func(i, j int) bool { return strings.ToLower(prompts[i].Name) < strings.ToLower(prompts[j].Name) })
+	return prompts, nil
+}
+
+// ListPromptTags 所有模板使用过的标签
+func (pls *PromptLibraryService) ListPromptTags() ([]string, error) {
+	prompts, err := pls.ListPrompts("")
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, p := range prompts {
+		for _, tag := range p.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// GetPrompt 按 ID 获取模板
+func (pls *PromptLibraryService) GetPrompt(id string) (PromptTemplate, error) {
+	pls.mu.Lock()
+	defer pls.mu.Unlock()
+	store, err := pls.load()
+	if err != nil {
+		return PromptTemplate{}, err
+	}
+	if i := store.index(id); i >= 0 {
+		return store.Prompts[i], nil
+	}
+	return PromptTemplate{}, fmt.Errorf("提示词 %s 不存在", id)
+}
+
+// SavePrompt 新建或更新模板；模板正文、system 或变量变化时版本号加一并保留旧版本
+func (pls *PromptLibraryService) SavePrompt(prompt PromptTemplate) (PromptTemplate, error) {
+	if err := normalizePrompt(&prompt); err != nil {
+		return PromptTemplate{}, err
+	}
+	pls.mu.Lock()
+	defer pls.mu.Unlock()
+	store, err := pls.load()
+	if err != nil {
+		return PromptTemplate{}, err
+	}
+	if i := store.nameIndex(prompt.Name); i >= 0 && store.Prompts[i].ID != prompt.ID {
+		return PromptTemplate{}, fmt.Errorf("已存在名为 %q 的提示词", prompt.Name)
+	}
+
+	saved := store.upsert(prompt, time.Now().Unix())
+	if err := pls.save(store); err != nil {
+		return PromptTemplate{}, err
+	}
+	return saved, nil
+}
+
+// DeletePrompt 删除模板
+func (pls *PromptLibraryService) DeletePrompt(id string) error {
+	pls.mu.Lock()
+	defer pls.mu.Unlock()
+	store, err := pls.load()
+	if err != nil {
+		return err
+	}
+	i := store.index(id)
+	if i < 0 {
+		return fmt.Errorf("提示词 %s 不存在", id)
+	}
+	store.Prompts = slices.Delete(store.Prompts, i, i+1)
+	return pls.save(store)
+}
+
+// RestorePromptVersion 以历史版本的内容生成一个新版本
+func (pls *PromptLibraryService) RestorePromptVersion(id string, version int) (PromptTemplate, error) {
+	pls.mu.Lock()
+	defer pls.mu.Unlock()
+	store, err := pls.load()
+	if err != nil {
+		return PromptTemplate{}, err
+	}
+	i := store.index(id)
+	if i < 0 {
+		return PromptTemplate{}, fmt.Errorf("提示词 %s 不存在", id)
+	}
+	prompt := store.Prompts[i]
+	for _, old := range prompt.History {
+		if old.Version == version {
+			prompt.System, prompt.Template, prompt.Variables = old.System, old.Template, old.Variables
+			saved := store.upsert(prompt, time.Now().Unix())
+			return saved, pls.save(store)
+		}
+	}
+	return PromptTemplate{}, fmt.Errorf("提示词 %s 没有版本 %d", prompt.Name, version)
+}
+
+// RenderPrompt 用变量渲染模板并组装网关请求体；model 为空时使用模板的默认模型
+func (pls *PromptLibraryService) RenderPrompt(id string, vars map[string]string, model string) (RenderedPrompt, error) {
+	prompt, err := pls.GetPrompt(id)
+	if err != nil {
+		return RenderedPrompt{}, err
+	}
+	return prompt.Render(vars, model)
+}
+
+// SendPrompt 渲染模板并经网关发送（走正常的路由、故障转移与计费）
+func (pls *PromptLibraryService) SendPrompt(id string, vars map[string]string, model string) (PromptSendResult, error) {
+	rendered, err := pls.RenderPrompt(id, vars, model)
+	if err != nil {
+		return PromptSendResult{}, err
+	}
+	if pls.relay == nil {
+		return PromptSendResult{}, errors.New("relay is not running")
+	}
+	result, err := pls.relay.sendInProcess(rendered.Endpoint, []byte(rendered.Body))
+	if err != nil {
+		return PromptSendResult{}, err
+	}
+	return PromptSendResult{Rendered: rendered, Result: result}, nil
+}
+
+// ExportPrompts 导出模板（ids 为空时导出全部），不含历史版本
+func (pls *PromptLibraryService) ExportPrompts(ids []string) (string, error) {
+	prompts, err := pls.ListPrompts("")
+	if err != nil {
+		return "", err
+	}
+	out := promptExport{Kind: promptExportKind, ExportedAt: time.Now().UTC().Format(time.RFC3339), Prompts: []PromptTemplate{}}
+	for _, p := range prompts {
+		if len(ids) == 0 || slices.Contains(ids, p.ID) {
+			p.History = nil
+			out.Prompts = append(out.Prompts, p)
+		}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	return string(data), err
+}
+
+// ImportPrompts 导入模板：按 ID（其次按名称）匹配已有模板，overwrite 为 false 时跳过已存在的模板；
+// 内容有变化的覆盖会生成新版本
+func (pls *PromptLibraryService) ImportPrompts(data string, overwrite bool) (PromptImportResult, error) {
+	var in promptExport
+	if err := json.Unmarshal([]byte(data), &in); err != nil {
+		return PromptImportResult{}, fmt.Errorf("导入文件格式错误: %w", err)
+	}
+	if in.Kind != promptExportKind {
+		return PromptImportResult{}, fmt.Errorf("不是提示词库导出文件（kind=%q）", in.Kind)
+	}
+	for i := range in.Prompts {
+		if err := normalizePrompt(&in.Prompts[i]); err != nil {
+			return PromptImportResult{}, fmt.Errorf("prompts[%d]: %w", i, err)
+		}
+	}
+
+	pls.mu.Lock()
+	defer pls.mu.Unlock()
+	store, err := pls.load()
+	if err != nil {
+		return PromptImportResult{}, err
+	}
+	var result PromptImportResult
+	now := time.Now().Unix()
+	for _, prompt := range in.Prompts {
+		existing := store.index(prompt.ID)
+		if existing < 0 {
+			existing = store.nameIndex(prompt.Name)
+		}
+		switch {
+		case existing < 0:
+			prompt.Version, prompt.History = 0, nil
+			store.upsert(prompt, now)
+			result.Added++
+		case overwrite:
+			prompt.ID = store.Prompts[existing].ID
+			store.upsert(prompt, now)
+			result.Updated++
+		default:
+			result.Skipped++
+		}
+	}
+	if result.Added+result.Updated > 0 {
+		if err := pls.save(store); err != nil {
+			return PromptImportResult{}, err
+		}
+	}
+	return result, nil
+}
+
+// Render 替换变量并组装请求体
+func (p PromptTemplate) Render(vars map[string]string, model string) (RenderedPrompt, error) {
+	if model == "" {
+		model = p.Model
+	}
+	if model == "" {
+		return RenderedPrompt{}, fmt.Errorf("提示词 %s 未设置模型", p.Name)
+	}
+	values := map[string]string{}
+	var missing []string
+	for _, v := range p.allVariables() {
+		value, ok := vars[v.Name]
+		if !ok || value == "" {
+			value = v.Default
+		}
+		if value == "" && v.Required {
+			missing = append(missing, v.Name)
+		}
+		values[v.Name] = value
+	}
+	if len(missing) > 0 {
+		return RenderedPrompt{}, fmt.Errorf("缺少变量: %s", strings.Join(missing, ", "))
+	}
+
+	rendered := RenderedPrompt{
+		Endpoint: p.Endpoint,
+		System:   substitutePromptVariables(p.System, values),
+		Text:     substitutePromptVariables(p.Template, values),
+	}
+	body, err := promptRequestBody(rendered.Endpoint, model, rendered.System, rendered.Text, p.MaxTokens)
+	if err != nil {
+		return RenderedPrompt{}, err
+	}
+	rendered.Body = string(body)
+	return rendered, nil
+}
+
+// allVariables 声明的变量加上模板中出现但未声明的变量（视为必填）
+func (p PromptTemplate) allVariables() []PromptVariable {
+	vars := slices.Clone(p.Variables)
+	for _, name := range PromptTemplateVariables(p.System + "\n" + p.Template) {
+		if !slices.ContainsFunc(vars, func(v PromptVariable) bool { return v.Name == name }) {
+			vars = append(vars, PromptVariable{Name: name, Required: true})
+		}
+	}
+	return vars
+}
+
+// PromptTemplateVariables 按出现顺序列出模板中的变量名（去重）
+func PromptTemplateVariables(text string) []string {
+	var names []string
+	for _, match := range promptVariablePattern.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+func substitutePromptVariables(text string, values map[string]string) string {
+	return promptVariablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := promptVariablePattern.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// promptRequestBody 按端点格式组装请求体，system 放在各 API 对应的位置
+func promptRequestBody(endpoint, model, system, text string, maxTokens int) ([]byte, error) {
+	if system != "" && endpoint == "/v1/completions" {
+		text = system + "\n\n" + text
+	}
+	body := batchPromptBody(endpoint, model, text, maxTokens)
+	if system == "" {
+		return body, nil
+	}
+	switch endpoint {
+	case "/v1/completions":
+		return body, nil
+	case "/v1/messages":
+		return sjson.SetBytes(body, "system", system)
+	case "/responses":
+		return sjson.SetBytes(body, "instructions", system)
+	default:
+		return sjson.SetBytes(body, "messages", []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": text},
+		})
+	}
+}
+
+// normalizePrompt 校验并整理模板字段
+func normalizePrompt(p *PromptTemplate) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("提示词名称不能为空")
+	}
+	if strings.TrimSpace(p.Template) == "" {
+		return fmt.Errorf("提示词 %s 的模板内容为空", p.Name)
+	}
+	if p.Endpoint == "" {
+		p.Endpoint = "/v1/chat/completions"
+	}
+	if !batchEndpoints[p.Endpoint] {
+		return fmt.Errorf("提示词 %s 的端点 %q 不受支持", p.Name, p.Endpoint)
+	}
+
+	var tags []string
+	for _, tag := range p.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	p.Tags = tags
+
+	seen := map[string]bool{}
+	for i := range p.Variables {
+		name := strings.TrimSpace(p.Variables[i].Name)
+		if !promptVariablePattern.MatchString("{{" + name + "}}") {
+			return fmt.Errorf("提示词 %s 的变量名 %q 无效", p.Name, p.Variables[i].Name)
+		}
+		if seen[name] {
+			return fmt.Errorf("提示词 %s 的变量 %s 重复", p.Name, name)
+		}
+		seen[name] = true
+		p.Variables[i].Name = name
+	}
+	return nil
+}
+
+func (s *promptLibraryStore) index(id string) int {
+	if id == "" {
+		return -1
+	}
+	return slices.IndexFunc(s.Prompts, func(p PromptTemplate) bool { return p.ID == id })
+}
+
+func (s *promptLibraryStore) nameIndex(name string) int {
+	return slices.IndexFunc(s.Prompts, func(p PromptTemplate) bool { return strings.EqualFold(p.Name, name) })
+}
+
+// upsert 写入模板：新模板从版本 1 开始；已有模板的内容变化时把当前版本移入历史
+func (s *promptLibraryStore) upsert(prompt PromptTemplate, now int64) PromptTemplate {
+	prompt.UpdatedAt = now
+	i := s.index(prompt.ID)
+	if i < 0 {
+		if prompt.ID == "" {
+			prompt.ID = uuid.NewString()
+		}
+		prompt.Version, prompt.History = 1, nil
+		s.Prompts = append(s.Prompts, prompt)
+		return prompt
+	}
+
+	current := s.Prompts[i]
+	prompt.Version, prompt.History = current.Version, current.History
+	if current.Template != prompt.Template || current.System != prompt.System || !slices.Equal(current.Variables, prompt.Variables) {
+		prompt.History = append([]PromptVersion{{
+			Version:   current.Version,
+			System:    current.System,
+			Template:  current.Template,
+			Variables: current.Variables,
+			UpdatedAt: current.UpdatedAt,
+		}}, prompt.History...)
+		if len(prompt.History) > promptHistoryMax {
+			prompt.History = prompt.History[:promptHistoryMax]
+		}
+		prompt.Version++
+	}
+	s.Prompts[i] = prompt
+	return prompt
+}
+
+func (pls *PromptLibraryService) load() (*promptLibraryStore, error) {
+	store := &promptLibraryStore{}
+	data, err := os.ReadFile(pls.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", promptLibraryFile, err)
+	}
+	return store, nil
+}
+
+func (pls *PromptLibraryService) save(store *promptLibraryStore) error {
+	if IsReadOnlyMode() {
+		return errors.New("只读模式下不能修改提示词库")
+	}
+	if err := os.MkdirAll(filepath.Dir(pls.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := pls.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, pls.path)
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func newTestPromptLibrary(t *testing.T, relay *ProviderRelayService) *PromptLibraryService {
+	t.Helper()
+	return &PromptLibraryService{relay: relay, path: filepath.Join(t.TempDir(), promptLibraryFile)}
+}
+
+func TestPromptLibraryVersions(t *testing.T) {
+	pls := newTestPromptLibrary(t, nil)
+	saved, err := pls.SavePrompt(PromptTemplate{
+		Name:      "review",
+		Tags:      []string{"code", " code ", ""},
+		Model:     "gpt",
+		Template:  "Review {{lang}} code:\n{{code}}",
+		Variables: []PromptVariable{{Name: "lang", Default: "Go"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID == "" || saved.Version != 1 || len(saved.Tags) != 1 || saved.Endpoint != "/v1/chat/completions" {
+		t.Fatalf("unexpected saved prompt %+v", saved)
+	}
+	if _, err := pls.SavePrompt(PromptTemplate{Name: "Review", Template: "x"}); err == nil {
+		t.Fatal("expected duplicate name error")
+	}
+
+	// 仅修改描述不产生新版本
+	saved.Description = "code review"
+	if saved, err = pls.SavePrompt(saved); err != nil || saved.Version != 1 {
+		t.Fatalf("description edit: %+v %v", saved, err)
+	}
+	saved.Template = "Review this {{lang}} change:\n{{code}}"
+	if saved, err = pls.SavePrompt(saved); err != nil || saved.Version != 2 || len(saved.History) != 1 {
+		t.Fatalf("template edit: %+v %v", saved, err)
+	}
+
+	restored, err := pls.RestorePromptVersion(saved.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Version != 3 || restored.Template != "Review {{lang}} code:\n{{code}}" || len(restored.History) != 2 {
+		t.Fatalf("unexpected restored prompt %+v", restored)
+	}
+	if _, err := pls.RestorePromptVersion(saved.ID, 9); err == nil {
+		t.Fatal("expected unknown version error")
+	}
+
+	if prompts, _ := pls.ListPrompts("code"); len(prompts) != 1 {
+		t.Fatalf("expected 1 tagged prompt, got %d", len(prompts))
+	}
+	if prompts, _ := pls.ListPrompts("other"); len(prompts) != 0 {
+		t.Fatalf("expected no prompts for unknown tag, got %d", len(prompts))
+	}
+	if err := pls.DeletePrompt(saved.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pls.GetPrompt(saved.ID); err == nil {
+		t.Fatal("expected deleted prompt to be gone")
+	}
+}
+
+func TestPromptRender(t *testing.T) {
+	p := PromptTemplate{
+		Name:      "review",
+		Endpoint:  "/v1/chat/completions",
+		Model:     "gpt",
+		System:    "You review {{lang}}.",
+		Template:  "Review {{ lang }} code:\n{{code}}",
+		Variables: []PromptVariable{{Name: "lang", Default: "Go"}},
+	}
+	if _, err := p.Render(nil, ""); err == nil || !strings.Contains(err.Error(), "code") {
+		t.Fatalf("expected missing variable error, got %v", err)
+	}
+	rendered, err := p.Render(map[string]string{"code": "x := 1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Text != "Review Go code:\nx := 1" || rendered.System != "You review Go." {
+		t.Fatalf("unexpected render %+v", rendered)
+	}
+	body := gjson.Parse(rendered.Body)
+	if body.Get("model").String() != "gpt" || body.Get("messages.0.role").String() != "system" || body.Get("messages.1.content").String() != rendered.Text {
+		t.Fatalf("unexpected chat body %s", rendered.Body)
+	}
+
+	p.Endpoint = "/v1/messages"
+	rendered, err = p.Render(map[string]string{"code": "y", "lang": "Rust"}, "claude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := gjson.Parse(rendered.Body); body.Get("system").String() != "You review Rust." || body.Get("model").String() != "claude" || body.Get("messages.#").Int() != 1 {
+		t.Fatalf("unexpected messages body %s", rendered.Body)
+	}
+
+	if got := PromptTemplateVariables("{{a}} {{ b }} {{a}}"); strings.Join(got, ",") != "a,b" {
+		t.Fatalf("unexpected variables %v", got)
+	}
+}
+
+func TestPromptExportImport(t *testing.T) {
+	src := newTestPromptLibrary(t, nil)
+	a, _ := src.SavePrompt(PromptTemplate{Name: "a", Template: "one {{x}}"})
+	a.Template = "two {{x}}"
+	a, _ = src.SavePrompt(a)
+	src.SavePrompt(PromptTemplate{Name: "b", Template: "b"})
+
+	data, err := src.ExportPrompts(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(data, "history") {
+		t.Fatal("export should not include history")
+	}
+
+	dst := newTestPromptLibrary(t, nil)
+	dst.SavePrompt(PromptTemplate{Name: "A", Template: "local"})
+	res, err := dst.ImportPrompts(data, false)
+	if err != nil || res != (PromptImportResult{Added: 1, Skipped: 1}) {
+		t.Fatalf("import without overwrite: %+v %v", res, err)
+	}
+	res, err = dst.ImportPrompts(data, true)
+	if err != nil || res != (PromptImportResult{Updated: 2}) {
+		t.Fatalf("import with overwrite: %+v %v", res, err)
+	}
+	prompts, _ := dst.ListPrompts("")
+	if len(prompts) != 2 || prompts[0].Template != "two {{x}}" || prompts[0].Version != 2 || prompts[0].History[0].Template != "local" {
+		t.Fatalf("unexpected imported prompts %+v", prompts)
+	}
+
+	if _, err := dst.ImportPrompts(`{"kind":"other","prompts":[]}`, true); err == nil {
+		t.Fatal("expected kind error")
+	}
+	if _, err := dst.ImportPrompts(`{"kind":"code-switch-prompts","prompts":[{"name":"x"}]}`, true); err == nil {
+		t.Fatal("expected validation error for empty template")
+	}
+}
+
+func TestSendPrompt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		if c.GetHeader(headerPriority) != PriorityInteractive {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unexpected priority"})
+			return
+		}
+		recordBatchAttempt(c, &ReqeustLog{Provider: "a", Model: "m", InputTokens: 3, OutputTokens: 2, TotalCost: 0.001})
+		c.JSON(http.StatusOK, gin.H{"echo": gjson.GetBytes(body, "messages.0.content").String()})
+	})
+	relay := &ProviderRelayService{server: &http.Server{Handler: router}}
+
+	pls := newTestPromptLibrary(t, relay)
+	p, err := pls.SavePrompt(PromptTemplate{Name: "hello", Model: "m", Template: "hello {{who}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := pls.SendPrompt(p.ID, map[string]string{"who": "world"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := out.Result; r.Status != http.StatusOK || r.Provider != "a" || r.InputTokens != 3 || gjson.GetBytes(r.Body, "echo").String() != "hello world" {
+		t.Fatalf("unexpected send result %+v", r)
+	}
+
+	if _, err := newTestPromptLibrary(t, &ProviderRelayService{}).SendPrompt(p.ID, nil, ""); err == nil {
+		t.Fatal("expected error for unknown prompt")
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ProviderTypeAzure Azure OpenAI 服务（api-key 认证 + 部署名路由）
+const ProviderTypeAzure = "azure"
+
+const (
+	// azureDefaultAPIVersion Chat Completions 默认 api-version
+	azureDefaultAPIVersion = "2024-10-21"
+	// azureResponsesAPIVersion Responses API 需要 preview 版本
+	azureResponsesAPIVersion = "2025-04-01-preview"
+)
+
+// IsAzure 判断 provider 是否为 Azure OpenAI
+func (p *Provider) IsAzure() bool {
+	return p.ProviderType == ProviderTypeAzure
+}
+
+// AzureDeployment 返回模型对应的 Azure 部署名
+// 支持精确和通配符匹配，未配置映射时部署名与模型名相同
+func (p *Provider) AzureDeployment(model string) string {
+	if deployment, ok := p.AzureDeployments[model]; ok && deployment != "" {
+		return deployment
+	}
+	for pattern, deployment := range p.AzureDeployments {
+		if matchWildcard(pattern, model) {
+			return applyWildcardMapping(pattern, deployment, model)
+		}
+	}
+	return model
+}
+
+// azureAPIVersion 返回请求使用的 api-version
+func (p *Provider) azureAPIVersion(endpoint string) string {
+	if p.AzureAPIVersion != "" {
+		return p.AzureAPIVersion
+	}
+	if isResponsesEndpoint(endpoint) {
+		return azureResponsesAPIVersion
+	}
+	return azureDefaultAPIVersion
+}
+
+// buildAzureRequest 将 OpenAI 风格的端点改写为 Azure 端点
+// Chat Completions: {base}/openai/deployments/{deployment}/chat/completions?api-version=...
+// Responses API:    {base}/openai/responses?api-version=...，请求体中的 model 改为部署名
+func buildAzureRequest(provider Provider, endpoint, model string, bodyBytes []byte) (string, []byte, error) {
+	base := strings.TrimSuffix(provider.APIURL, "/")
+	// 兼容用户直接填写到 /openai 的地址
+	base = strings.TrimSuffix(base, "/openai")
+	deployment := provider.AzureDeployment(model)
+	if deployment == "" {
+		return "", nil, fmt.Errorf("Azure provider %s 未找到模型 %s 对应的部署", provider.Name, model)
+	}
+
+	var targetURL string
+	if isResponsesEndpoint(endpoint) {
+		targetURL = base + "/openai/responses"
+		if model != "" && deployment != model {
+			modified, err := ReplaceModelInRequestBody(bodyBytes, deployment)
+			if err != nil {
+				return "", nil, err
+			}
+			bodyBytes = modified
+		}
+	} else {
+		action := strings.TrimPrefix(endpoint, "/v1")
+		targetURL = fmt.Sprintf("%s/openai/deployments/%s%s", base, url.PathEscape(deployment), joinURL("", action))
+	}
+	return targetURL, bodyBytes, nil
+}
+
+func isResponsesEndpoint(endpoint string) bool {
+	return strings.HasSuffix(endpoint, "/responses")
+}
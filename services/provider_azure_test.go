@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestBuildAzureRequest(t *testing.T) {
+	provider := Provider{
+		Name:         "azure-east",
+		APIURL:       "https://my-res.openai.azure.com/",
+		ProviderType: ProviderTypeAzure,
+		AzureDeployments: map[string]string{
+			"gpt-4o":  "prod-gpt4o",
+			"gpt-5-*": "gpt5-*",
+		},
+	}
+	body := []byte(`{"model":"gpt-4o","messages":[]}`)
+
+	t.Run("chat completions 使用部署路径", func(t *testing.T) {
+		url, out, err := buildAzureRequest(provider, "/v1/chat/completions", "gpt-4o", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != "https://my-res.openai.azure.com/openai/deployments/prod-gpt4o/chat/completions" {
+			t.Errorf("unexpected url: %s", url)
+		}
+		if string(out) != string(body) {
+			t.Errorf("chat body should be untouched, got %s", out)
+		}
+	})
+
+	t.Run("responses 改写 model 为部署名", func(t *testing.T) {
+		respBody := []byte(`{"model":"gpt-5-codex","input":"hi"}`)
+		url, out, err := buildAzureRequest(provider, "/responses", "gpt-5-codex", respBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != "https://my-res.openai.azure.com/openai/responses" {
+			t.Errorf("unexpected url: %s", url)
+		}
+		if got := gjson.GetBytes(out, "model").String(); got != "gpt5-codex" {
+			t.Errorf("model = %s, want gpt5-codex", got)
+		}
+	})
+
+	t.Run("未映射时部署名等于模型名", func(t *testing.T) {
+		if got := provider.AzureDeployment("o3-mini"); got != "o3-mini" {
+			t.Errorf("AzureDeployment = %s", got)
+		}
+	})
+
+	t.Run("api-version 默认值", func(t *testing.T) {
+		if v := provider.azureAPIVersion("/responses"); v != azureResponsesAPIVersion {
+			t.Errorf("responses api-version = %s", v)
+		}
+		if v := provider.azureAPIVersion("/v1/chat/completions"); v != azureDefaultAPIVersion {
+			t.Errorf("chat api-version = %s", v)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/tidwall/gjson"
+)
+
+// catalogSyncInterval 聚合平台模型目录同步间隔
+const catalogSyncInterval = 6 * time.Hour
+
+// ModelCatalogEntry 聚合平台返回的单个模型
+type ModelCatalogEntry struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name,omitempty"`
+	ContextLength   int64   `json:"contextLength,omitempty"`
+	InputPrice      float64 `json:"inputPrice"`  // 每 token 美元
+	OutputPrice     float64 `json:"outputPrice"` // 每 token 美元
+	CacheReadPrice  float64 `json:"cacheReadPrice,omitempty"`
+	CacheWritePrice float64 `json:"cacheWritePrice,omitempty"`
+}
+
+// ProviderCatalog 某个 provider 的模型目录快照
+type ProviderCatalog struct {
+	Kind     string              `json:"kind"`
+	Provider string              `json:"provider"`
+	SyncedAt int64               `json:"syncedAt"`
+	Models   []ModelCatalogEntry `json:"models"`
+}
+
+var catalogFileMu sync.Mutex
+
+func catalogFilePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "model-catalog.json"), nil
+}
+
+func loadCatalogs() (map[string]*ProviderCatalog, error) {
+	path, err := catalogFilePath()
+	if err != nil {
+		return nil, err
+	}
+	catalogs := make(map[string]*ProviderCatalog)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return catalogs, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return catalogs, nil
+	}
+	if err := json.Unmarshal(data, &catalogs); err != nil {
+		return nil, err
+	}
+	return catalogs, nil
+}
+
+func saveCatalog(catalog *ProviderCatalog) error {
+	if IsReadOnlyMode() {
+		return nil
+	}
+	catalogFileMu.Lock()
+	defer catalogFileMu.Unlock()
+
+	catalogs, err := loadCatalogs()
+	if err != nil {
+		return err
+	}
+	catalogs[providerKey(catalog.Kind, catalog.Provider)] = catalog
+
+	path, err := catalogFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(catalogs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// FetchModelCatalog 拉取聚合平台（OpenRouter / SiliconFlow / DeepInfra 等）的 /models 列表
+func FetchModelCatalog(provider Provider) ([]ModelCatalogEntry, error) {
+	base := strings.TrimSuffix(provider.APIURL, "/")
+	modelsURL := base + "/models"
+	if !strings.HasSuffix(base, "/v1") && !strings.Contains(base, "/api/v1") && !strings.Contains(base, "/openai") {
+		modelsURL = base + "/v1/models"
+	}
+
+	req, err := http.NewRequest("GET", modelsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if provider.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	}
+	body, err := doGetBody(&http.Client{Timeout: 30 * time.Second}, req)
+	if err != nil {
+		return nil, fmt.Errorf("拉取模型目录失败 (%s): %w", modelsURL, err)
+	}
+
+	entries := make([]ModelCatalogEntry, 0)
+	for _, m := range gjson.GetBytes(body, "data").Array() {
+		entry := ModelCatalogEntry{
+			ID:            m.Get("id").String(),
+			Name:          m.Get("name").String(),
+			ContextLength: m.Get("context_length").Int(),
+		}
+		if entry.ID == "" {
+			continue
+		}
+		switch {
+		case m.Get("pricing").Exists():
+			// OpenRouter: pricing.prompt / pricing.completion 为每 token 单价（字符串）
+			entry.InputPrice = m.Get("pricing.prompt").Float()
+			entry.OutputPrice = m.Get("pricing.completion").Float()
+			entry.CacheReadPrice = m.Get("pricing.input_cache_read").Float()
+			entry.CacheWritePrice = m.Get("pricing.input_cache_write").Float()
+		case m.Get("metadata.pricing").Exists():
+			// DeepInfra: metadata.pricing.input_tokens 为每百万 token 单价
+			entry.InputPrice = m.Get("metadata.pricing.input_tokens").Float() / 1e6
+			entry.OutputPrice = m.Get("metadata.pricing.output_tokens").Float() / 1e6
+			if entry.ContextLength == 0 {
+				entry.ContextLength = m.Get("metadata.context_length").Int()
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("模型目录为空")
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// SyncProviderCatalog 同步指定 provider 的模型目录并刷新 supportedModels
+// 已有的通配符白名单与映射目标会被保留
+func (ps *ProviderService) SyncProviderCatalog(kind, providerName string) (*ProviderCatalog, error) {
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range providers {
+		if providers[i].Name != providerName {
+			continue
+		}
+		entries, err := FetchModelCatalog(providers[i])
+		if err != nil {
+			return nil, err
+		}
+
+		supported := make(map[string]bool, len(entries))
+		for model := range providers[i].SupportedModels {
+			if strings.Contains(model, "*") {
+				supported[model] = true
+			}
+		}
+		for _, target := range providers[i].ModelMapping {
+			if target != "" {
+				supported[target] = true
+			}
+		}
+		for _, entry := range entries {
+			supported[entry.ID] = true
+		}
+		providers[i].SupportedModels = supported
+		if err := ps.SaveProviders(kind, providers); err != nil {
+			return nil, err
+		}
+
+		catalog := &ProviderCatalog{
+			Kind:     kind,
+			Provider: providerName,
+			SyncedAt: time.Now().Unix(),
+			Models:   entries,
+		}
+		if err := saveCatalog(catalog); err != nil {
+			return nil, err
+		}
+		fmt.Printf("[Catalog] %s/%s 同步完成：%d 个模型\n", kind, providerName, len(entries))
+		return catalog, nil
+	}
+	return nil, fmt.Errorf("provider %s 不存在", providerName)
+}
+
+// GetProviderCatalog 返回本地缓存的模型目录
+func (ps *ProviderService) GetProviderCatalog(kind, providerName string) (*ProviderCatalog, error) {
+	catalogs, err := loadCatalogs()
+	if err != nil {
+		return nil, err
+	}
+	catalog, ok := catalogs[providerKey(kind, providerName)]
+	if !ok {
+		return nil, fmt.Errorf("provider %s 尚未同步模型目录", providerName)
+	}
+	return catalog, nil
+}
+
+// SyncModelCatalogs 同步所有开启 catalogSync 的 provider，并登记上游价格
+func (prs *ProviderRelayService) SyncModelCatalogs() (map[string]int, error) {
+	result := make(map[string]int)
+	var lastErr error
+	for _, kind := range []string{"claude", "codex", "gemini-cli", "picoclaw"} {
+		providers, err := prs.providerService.LoadProviders(kind)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, p := range providers {
+			if !p.CatalogSync || !p.Enabled {
+				continue
+			}
+			catalog, err := prs.providerService.SyncProviderCatalog(kind, p.Name)
+			if err != nil {
+				fmt.Printf("[Catalog] %s/%s 同步失败: %v\n", kind, p.Name, err)
+				lastErr = err
+				continue
+			}
+			prs.registerCatalogPricing(catalog)
+			result[providerKey(kind, p.Name)] = len(catalog.Models)
+		}
+	}
+	return result, lastErr
+}
+
+// registerCatalogPricing 将目录中的上游价格登记到价格服务
+func (prs *ProviderRelayService) registerCatalogPricing(catalog *ProviderCatalog) {
+	if prs.pricingService == nil || catalog == nil {
+		return
+	}
+	for _, m := range catalog.Models {
+		if m.InputPrice <= 0 && m.OutputPrice <= 0 {
+			continue
+		}
+		prs.pricingService.RegisterPricing(m.ID, modelpricing.PricingEntry{
+			InputCostPerToken:           m.InputPrice,
+			OutputCostPerToken:          m.OutputPrice,
+			CacheReadInputTokenCost:     m.CacheReadPrice,
+			CacheCreationInputTokenCost: m.CacheWritePrice,
+		})
+	}
+}
+
+// startCatalogSyncTask 启动时加载已缓存的目录价格，并定期重新同步
+func (prs *ProviderRelayService) startCatalogSyncTask() {
+	if catalogs, err := loadCatalogs(); err == nil {
+		for _, catalog := range catalogs {
+			prs.registerCatalogPricing(catalog)
+		}
+	}
+
+	ticker := time.NewTicker(catalogSyncInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := prs.SyncModelCatalogs(); err != nil {
+			fmt.Printf("[Catalog] 定期同步存在失败: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	modelpricing "codeswitch/resources/model-pricing"
+)
+
+func TestFetchModelCatalog(t *testing.T) {
+	cases := []struct {
+		name    string
+		base    string // 追加在测试服务器地址后的 APIURL 路径
+		path    string // 期望请求的路径
+		body    string
+		want    []ModelCatalogEntry
+		wantErr bool
+	}{
+		{
+			name: "openrouter pricing per token",
+			base: "/api/v1",
+			path: "/api/v1/models",
+			body: `{"data":[
+				{"id":"z-ai/glm-4.6","name":"GLM 4.6","context_length":200000,"pricing":{"prompt":"0.0000006","completion":"0.0000022","input_cache_read":"0.00000011"}},
+				{"id":"anthropic/claude-sonnet-4","pricing":{"prompt":"0.000003","completion":"0.000015","input_cache_read":"0.0000003","input_cache_write":"0.00000375"}}]}`,
+			want: []ModelCatalogEntry{
+				{ID: "anthropic/claude-sonnet-4", InputPrice: 0.000003, OutputPrice: 0.000015, CacheReadPrice: 0.0000003, CacheWritePrice: 0.00000375},
+				{ID: "z-ai/glm-4.6", Name: "GLM 4.6", ContextLength: 200000, InputPrice: 0.0000006, OutputPrice: 0.0000022, CacheReadPrice: 0.00000011},
+			},
+		},
+		{
+			name: "deepinfra pricing per million tokens",
+			base: "/v1/openai",
+			path: "/v1/openai/models",
+			body: `{"data":[{"id":"meta-llama/Llama-3.3-70B","metadata":{"context_length":131072,"pricing":{"input_tokens":2,"output_tokens":8}}}]}`,
+			want: []ModelCatalogEntry{
+				{ID: "meta-llama/Llama-3.3-70B", ContextLength: 131072, InputPrice: 2e-6, OutputPrice: 8e-6},
+			},
+		},
+		{
+			name: "no pricing, v1 appended",
+			base: "",
+			path: "/v1/models",
+			body: `{"data":[{"id":"Qwen/Qwen3-32B"},{"id":""}]}`,
+			want: []ModelCatalogEntry{{ID: "Qwen/Qwen3-32B"}},
+		},
+		{
+			name:    "empty catalog",
+			base:    "/v1",
+			path:    "/v1/models",
+			body:    `{"data":[]}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tc.path {
+					t.Errorf("path = %s, want %s", r.URL.Path, tc.path)
+				}
+				if r.Header.Get("Authorization") != "Bearer k" {
+					t.Errorf("authorization = %q", r.Header.Get("Authorization"))
+				}
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			got, err := FetchModelCatalog(Provider{APIURL: srv.URL + tc.base, APIKey: "k"})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("entries = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSyncProviderCatalogMergesOverrides(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"id":"openai/gpt-5","pricing":{"prompt":"0.00000125","completion":"0.00001"}},{"id":"qwen/qwen3-coder"}]}`))
+	}))
+	defer srv.Close()
+
+	ps := NewProviderService()
+	err := ps.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "router", Enabled: true, APIURL: srv.URL + "/api/v1", APIKey: "k",
+			SupportedModels: map[string]bool{"anthropic/*": true, "retired-model": true, "openai/gpt-5-codex": true},
+			ModelMapping:    map[string]string{"gpt-5-codex": "openai/gpt-5-codex"}},
+		{ID: 2, Name: "other", Enabled: true, APIURL: "http://127.0.0.1:1", APIKey: "k",
+			SupportedModels: map[string]bool{"m": true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ps.GetProviderCatalog("codex", "router"); err == nil {
+		t.Fatal("expected error before the first sync")
+	}
+	catalog, err := ps.SyncProviderCatalog("codex", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Models) != 2 || catalog.Kind != "codex" || catalog.SyncedAt == 0 {
+		t.Fatalf("catalog = %+v", catalog)
+	}
+	if _, err := ps.SyncProviderCatalog("codex", "missing"); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+
+	providers, err := ps.LoadProviders("codex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 通配符与映射目标保留，目录中没有的精确模型被移除
+	want := map[string]bool{"anthropic/*": true, "openai/gpt-5-codex": true, "openai/gpt-5": true, "qwen/qwen3-coder": true}
+	if !reflect.DeepEqual(providers[0].SupportedModels, want) {
+		t.Fatalf("supportedModels = %v", providers[0].SupportedModels)
+	}
+	if !reflect.DeepEqual(providers[1].SupportedModels, map[string]bool{"m": true}) {
+		t.Fatalf("other provider changed: %v", providers[1].SupportedModels)
+	}
+
+	cached, err := ps.GetProviderCatalog("codex", "router")
+	if err != nil || !reflect.DeepEqual(cached, catalog) {
+		t.Fatalf("cached catalog = %+v, %v", cached, err)
+	}
+}
+
+func TestRegisterCatalogPricing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	pricing, err := modelpricing.NewService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prs := &ProviderRelayService{pricingService: pricing}
+	prs.registerCatalogPricing(&ProviderCatalog{Models: []ModelCatalogEntry{
+		{ID: "acme/router-model", InputPrice: 0.000002, OutputPrice: 0.00001, CacheReadPrice: 0.0000002},
+		{ID: "acme/free-model"},
+	}})
+
+	cases := []struct {
+		model       string
+		usage       modelpricing.UsageSnapshot
+		wantPricing bool
+		wantTotal   float64
+	}{
+		{"acme/router-model", modelpricing.UsageSnapshot{InputTokens: 1000, OutputTokens: 100}, true, 0.003},
+		{"acme/router-model", modelpricing.UsageSnapshot{InputTokens: 1000, CacheReadTokens: 1000}, true, 0.0022},
+		{"acme/free-model", modelpricing.UsageSnapshot{InputTokens: 1000}, false, 0},
+	}
+	for _, tc := range cases {
+		cost := pricing.CalculateCost(tc.model, tc.usage)
+		if cost.HasPricing != tc.wantPricing || cost.TotalCost < tc.wantTotal-1e-9 || cost.TotalCost > tc.wantTotal+1e-9 {
+			t.Errorf("%s %+v: cost = %+v", tc.model, tc.usage, cost)
+		}
+	}
+
+	// 空目录与未配置价格服务时不应 panic
+	prs.registerCatalogPricing(nil)
+	(&ProviderRelayService{}).registerCatalogPricing(&ProviderCatalog{Models: []ModelCatalogEntry{{ID: "x", InputPrice: 1}}})
+}
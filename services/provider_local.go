@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// ProviderTypeLocal 本地模型服务（Ollama / LM Studio 等 OpenAI 兼容端点）
+const ProviderTypeLocal = "local"
+
+// IsLocal 判断 provider 是否为本地模型服务
+func (p *Provider) IsLocal() bool {
+	return p.ProviderType == ProviderTypeLocal
+}
+
+// partitionFallbackProviders 拆分常规 provider 与兜底 provider，保持原有顺序
+func partitionFallbackProviders(providers []Provider) ([]Provider, []Provider) {
+	primary := make([]Provider, 0, len(providers))
+	fallback := make([]Provider, 0)
+	for _, p := range providers {
+		if p.FallbackOnly {
+			fallback = append(fallback, p)
+		} else {
+			primary = append(primary, p)
+		}
+	}
+	return primary, fallback
+}
+
+// budgetCheckInterval 预算花费的缓存时间，避免每个请求都统计请求日志
+const budgetCheckInterval = 30 * time.Second
+
+// budgetFallbackState 达到花费预算后只使用兜底 provider
+type budgetFallbackState struct {
+	mu        sync.Mutex
+	daily     float64 // 每日预算（美元），0 表示不限
+	monthly   float64 // 每月预算（美元），0 表示不限
+	exceeded  bool
+	checkedAt time.Time
+	// spendSince 统计指定时间以来的花费，测试时替换
+	spendSince func(since time.Time) (float64, error)
+}
+
+// SetBudgetFallback 设置触发兜底 provider 的每日 / 每月预算（美元），均为 0 时关闭
+func (prs *ProviderRelayService) SetBudgetFallback(daily, monthly float64) {
+	prs.budgetFallback.mu.Lock()
+	defer prs.budgetFallback.mu.Unlock()
+	prs.budgetFallback.daily = daily
+	prs.budgetFallback.monthly = monthly
+	prs.budgetFallback.checkedAt = time.Time{}
+}
+
+// budgetExceeded 今日或本月花费是否已达到预算；统计失败时视为未超出
+func (prs *ProviderRelayService) budgetExceeded() bool {
+	b := &prs.budgetFallback
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.daily <= 0 && b.monthly <= 0 {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(b.checkedAt) < budgetCheckInterval {
+		return b.exceeded
+	}
+	spendSince := b.spendSince
+	if spendSince == nil {
+		spendSince = requestLogSpendSince
+	}
+	periods := []struct {
+		start  time.Time
+		budget float64
+	}{
+		{time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), b.daily},
+		{time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), b.monthly},
+	}
+	b.exceeded = false
+	for _, period := range periods {
+		if period.budget <= 0 {
+			continue
+		}
+		spent, err := spendSince(period.start)
+		if err != nil {
+			fmt.Printf("[Budget] 统计花费失败: %v\n", err)
+			break
+		}
+		if spent >= period.budget {
+			b.exceeded = true
+			break
+		}
+	}
+	b.checkedAt = now
+	return b.exceeded
+}
+
+// applyBudgetFallback 达到花费预算且存在兜底 provider 时跳过常规 provider，直接使用兜底 provider
+func (prs *ProviderRelayService) applyBudgetFallback(active, fallback []Provider) []Provider {
+	if len(active) == 0 || len(fallback) == 0 || !prs.budgetExceeded() {
+		return active
+	}
+	fmt.Printf("[INFO] 已达到花费预算，跳过 %d 个常规 provider，使用兜底 provider\n", len(active))
+	return nil
+}
+
+// LocalModelInfo 本地模型服务发现的模型
+type LocalModelInfo struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size,omitempty"`   // 模型文件大小（Ollama 提供）
+	Family string `json:"family,omitempty"` // 模型家族（Ollama 提供）
+}
+
+// LocalModelDiscovery 本地模型服务探测结果
+type LocalModelDiscovery struct {
+	Server string           `json:"server"` // ollama / openai-compatible
+	Models []LocalModelInfo `json:"models"`
+}
+
+// DiscoverLocalModels 探测本地模型服务并列出可用模型
+// 优先尝试 Ollama 原生 /api/tags，失败后回退到 OpenAI 兼容的 /v1/models（LM Studio、llama.cpp 等）
+func (ps *ProviderService) DiscoverLocalModels(apiURL string) (*LocalModelDiscovery, error) {
+	base := strings.TrimSuffix(strings.TrimSpace(apiURL), "/")
+	if base == "" {
+		return nil, fmt.Errorf("API 地址不能为空")
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	ollamaBase := strings.TrimSuffix(base, "/v1")
+	if body, err := localGet(client, ollamaBase+"/api/tags"); err == nil && gjson.GetBytes(body, "models").IsArray() {
+		result := &LocalModelDiscovery{Server: "ollama", Models: []LocalModelInfo{}}
+		for _, m := range gjson.GetBytes(body, "models").Array() {
+			result.Models = append(result.Models, LocalModelInfo{
+				ID:     m.Get("name").String(),
+				Size:   m.Get("size").Int(),
+				Family: m.Get("details.family").String(),
+			})
+		}
+		sortLocalModels(result.Models)
+		return result, nil
+	}
+
+	modelsURL := base + "/models"
+	if !strings.HasSuffix(base, "/v1") {
+		modelsURL = base + "/v1/models"
+	}
+	body, err := localGet(client, modelsURL)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接本地模型服务 %s: %w", base, err)
+	}
+	result := &LocalModelDiscovery{Server: "openai-compatible", Models: []LocalModelInfo{}}
+	for _, m := range gjson.GetBytes(body, "data").Array() {
+		result.Models = append(result.Models, LocalModelInfo{ID: m.Get("id").String()})
+	}
+	sortLocalModels(result.Models)
+	return result, nil
+}
+
+// SyncLocalProviderModels 使用探测结果刷新本地 provider 的 supportedModels
+func (ps *ProviderService) SyncLocalProviderModels(kind string, providerName string) ([]string, error) {
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range providers {
+		if providers[i].Name != providerName {
+			continue
+		}
+		if !providers[i].IsLocal() {
+			return nil, fmt.Errorf("provider %s 不是本地模型服务", providerName)
+		}
+		discovery, err := ps.DiscoverLocalModels(providers[i].APIURL)
+		if err != nil {
+			return nil, err
+		}
+		models := make([]string, 0, len(discovery.Models))
+		supported := make(map[string]bool, len(discovery.Models))
+		for _, m := range discovery.Models {
+			models = append(models, m.ID)
+			supported[m.ID] = true
+		}
+		providers[i].SupportedModels = supported
+		if err := ps.SaveProviders(kind, providers); err != nil {
+			return nil, err
+		}
+		return models, nil
+	}
+	return nil, fmt.Errorf("provider %s 不存在", providerName)
+}
+
+func localGet(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doGetBody(client, req)
+}
+
+// doGetBody 执行请求并在 200 时返回响应体
+func doGetBody(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+func sortLocalModels(models []LocalModelInfo) {
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPartitionFallbackProviders(t *testing.T) {
+	providers := []Provider{
+		{Name: "cloud-a"},
+		{Name: "ollama", ProviderType: ProviderTypeLocal, FallbackOnly: true},
+		{Name: "cloud-b"},
+	}
+	primary, fallback := partitionFallbackProviders(providers)
+	if len(primary) != 2 || primary[0].Name != "cloud-a" || primary[1].Name != "cloud-b" {
+		t.Errorf("unexpected primary: %+v", primary)
+	}
+	if len(fallback) != 1 || fallback[0].Name != "ollama" {
+		t.Errorf("unexpected fallback: %+v", fallback)
+	}
+}
+
+func TestBudgetFallback(t *testing.T) {
+	active := []Provider{{Name: "cloud"}}
+	fallback := []Provider{{Name: "ollama", ProviderType: ProviderTypeLocal, FallbackOnly: true}}
+	today := 0.0
+	calls := 0
+	prs := &ProviderRelayService{}
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	prs.budgetFallback.spendSince = func(since time.Time) (float64, error) {
+		calls++
+		if since.Before(dayStart) {
+			return today + 40, nil // 本月更早的花费
+		}
+		return today, nil
+	}
+
+	// 未设置预算时不统计花费
+	if got := prs.applyBudgetFallback(active, fallback); len(got) != 1 || calls != 0 {
+		t.Fatalf("disabled: active=%v calls=%d", got, calls)
+	}
+
+	prs.SetBudgetFallback(5, 100)
+	today = 1
+	if got := prs.applyBudgetFallback(active, fallback); len(got) != 1 {
+		t.Fatalf("under budget: active=%v", got)
+	}
+
+	// 结果在 budgetCheckInterval 内缓存
+	today = 6
+	if got := prs.applyBudgetFallback(active, fallback); len(got) != 1 || calls != 2 {
+		t.Fatalf("cached: active=%v calls=%d", got, calls)
+	}
+
+	prs.budgetFallback.checkedAt = time.Time{}
+	if got := prs.applyBudgetFallback(active, fallback); len(got) != 0 {
+		t.Fatalf("daily budget reached: active=%v", got)
+	}
+	// 没有兜底 provider 时仍使用常规 provider
+	if got := prs.applyBudgetFallback(active, nil); len(got) != 1 {
+		t.Fatalf("no fallback: active=%v", got)
+	}
+
+	// 只设置月预算
+	prs.SetBudgetFallback(0, 10)
+	today = 0
+	calls = 0
+	got := prs.applyBudgetFallback(active, fallback)
+	if now.Day() != 1 && len(got) != 0 {
+		t.Fatalf("monthly budget reached: active=%v", got)
+	}
+	if calls != 1 {
+		t.Fatalf("monthly only: calls=%d", calls)
+	}
+}
+
+func TestLocalProviderHasCredentialsWithoutKey(t *testing.T) {
+	p := Provider{Name: "lmstudio", ProviderType: ProviderTypeLocal}
+	if !p.HasCredentials() {
+		t.Error("local provider should not require an API key")
+	}
+}
+
+func TestDiscoverLocalModels(t *testing.T) {
+	t.Run("Ollama /api/tags", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/tags" {
+				w.Write([]byte(`{"models":[{"name":"qwen2.5-coder:7b","size":123,"details":{"family":"qwen2"}},{"name":"llama3.2:3b"}]}`))
+				return
+			}
+			http.NotFound(w, r)
+		}))
+		defer srv.Close()
+
+		result, err := NewProviderService().DiscoverLocalModels(srv.URL + "/v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Server != "ollama" || len(result.Models) != 2 || result.Models[0].ID != "llama3.2:3b" {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("OpenAI 兼容 /v1/models", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/models" {
+				w.Write([]byte(`{"data":[{"id":"lmstudio-community/qwen"}]}`))
+				return
+			}
+			http.NotFound(w, r)
+		}))
+		defer srv.Close()
+
+		result, err := NewProviderService().DiscoverLocalModels(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Server != "openai-compatible" || len(result.Models) != 1 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Provider 配置的结构校验：在 json.Unmarshal 之前逐字段检查类型，并检查 modelMapping /
+// supportedModels 中会被静默忽略或匹配异常的写法（空模型名、首尾空格、多个通配符等），
+// 给出文件行号、字段路径与修改建议。加载时作为 validateConfig 警告输出，保存时 error 级别的问题阻止保存
+
+// 结构问题级别
+const (
+	SchemaSeverityError   = "error"
+	SchemaSeverityWarning = "warning"
+)
+
+// SchemaIssue 一个配置结构问题
+type SchemaIssue struct {
+	File       string `json:"file,omitempty"`
+	Line       int    `json:"line,omitempty"`   // 从 1 开始，0 表示无法定位
+	Column     int    `json:"column,omitempty"` // 从 1 开始
+	Path       string `json:"path"`             // 如 providers[0].modelMapping["claude-*"]
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (i SchemaIssue) String() string {
+	var b strings.Builder
+	if i.File != "" {
+		b.WriteString(i.File)
+		if i.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", i.Line, i.Column)
+		}
+		b.WriteString(" ")
+	}
+	if i.Path != "" {
+		b.WriteString(i.Path + ": ")
+	}
+	b.WriteString(i.Message)
+	if i.Suggestion != "" {
+		b.WriteString("（建议：" + i.Suggestion + "）")
+	}
+	return b.String()
+}
+
+// schemaErrors 只保留 error 级别的问题
+func schemaErrors(issues []SchemaIssue) []SchemaIssue {
+	var result []SchemaIssue
+	for _, issue := range issues {
+		if issue.Severity == SchemaSeverityError {
+			result = append(result, issue)
+		}
+	}
+	return result
+}
+
+// providerFieldTypes Provider 的 JSON 字段名与类型
+var providerFieldTypes = sync.OnceValue(func() map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	t := reflect.TypeOf(Provider{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" || name == "" {
+			continue
+		}
+		fields[name] = field.Type
+	}
+	return fields
+})
+
+// ValidateProviderSchema 校验 provider 配置文件内容（{"providers": [...]}），file 仅用于错误信息
+func ValidateProviderSchema(file string, data []byte) []SchemaIssue {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	var issues []SchemaIssue
+	add := func(path, severity, message, suggestion string, offset int64) {
+		line, col := jsonLineColumn(data, offset)
+		issues = append(issues, SchemaIssue{File: file, Line: line, Column: col, Path: path,
+			Severity: severity, Message: message, Suggestion: suggestion})
+	}
+
+	offsets, err := jsonPathOffsets(data)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		offset := int64(-1)
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+		}
+		add("", SchemaSeverityError, "JSON 格式错误: "+err.Error(), "检查该位置附近缺失或多余的逗号、引号与括号", offset)
+		return issues
+	}
+	offsetOf := func(path string) int64 {
+		if offset, ok := offsets[path]; ok {
+			return offset
+		}
+		return -1
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		add("", SchemaSeverityError, "顶层必须是对象", `使用 {"providers": [...]} 格式`, 0)
+		return issues
+	}
+	rawProviders, ok := envelope["providers"]
+	if !ok {
+		add("", SchemaSeverityError, "缺少 providers 字段", `使用 {"providers": [...]} 格式`, 0)
+		return issues
+	}
+	var providers []json.RawMessage
+	if err := json.Unmarshal(rawProviders, &providers); err != nil {
+		add("providers", SchemaSeverityError, "providers 必须是数组", `使用 "providers": [{...}, {...}]`, offsetOf("providers"))
+		return issues
+	}
+
+	fieldTypes := providerFieldTypes()
+	for i, raw := range providers {
+		base := fmt.Sprintf("providers[%d]", i)
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			add(base, SchemaSeverityError, "provider 必须是对象", "", offsetOf(base))
+			continue
+		}
+		typeOK := true
+		for _, name := range slices.Sorted(maps.Keys(fields)) {
+			value := fields[name]
+			path := base + "." + name
+			fieldType, known := fieldTypes[name]
+			if !known {
+				suggestion := ""
+				if guess := closestFieldName(name, fieldTypes); guess != "" {
+					suggestion = fmt.Sprintf("是否应为 %q", guess)
+				}
+				add(path, SchemaSeverityWarning, fmt.Sprintf("未知字段 %q，将被忽略", name), suggestion, offsetOf(path))
+				continue
+			}
+			if err := json.Unmarshal(value, reflect.New(fieldType).Interface()); err != nil {
+				typeOK = false
+				add(path, SchemaSeverityError, fmt.Sprintf("类型错误，应为 %s", describeSchemaType(fieldType)),
+					schemaTypeSuggestion(name, value), offsetOf(path))
+			}
+		}
+		if !typeOK {
+			continue
+		}
+		var provider Provider
+		if err := json.Unmarshal(raw, &provider); err != nil {
+			add(base, SchemaSeverityError, err.Error(), "", offsetOf(base))
+			continue
+		}
+		for _, issue := range provider.modelSchemaIssues(base) {
+			issue.File = file
+			issue.Line, issue.Column = jsonLineColumn(data, offsetOf(issue.Path))
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// modelSchemaIssues 检查 modelMapping / supportedModels 中的可疑写法，base 为字段路径前缀（可为空）
+func (p *Provider) modelSchemaIssues(base string) []SchemaIssue {
+	var issues []SchemaIssue
+	add := func(path, severity, message, suggestion string) {
+		issues = append(issues, SchemaIssue{Path: path, Severity: severity, Message: message, Suggestion: suggestion})
+	}
+	checkModelName := func(path, model string) {
+		switch trimmed := strings.TrimSpace(model); {
+		case trimmed == "":
+			add(path, SchemaSeverityError, "模型名为空", "删除该条目或填写模型名")
+		case trimmed != model:
+			add(path, SchemaSeverityError, fmt.Sprintf("模型名 %q 包含首尾空白，请求中的模型名永远无法匹配", model), fmt.Sprintf("改为 %q", trimmed))
+		case strings.Count(model, "*") > 1:
+			add(path, SchemaSeverityError, fmt.Sprintf("模型名 %q 包含多个通配符，只支持一个 '*'", model), "拆分为多条只含一个 '*' 的规则")
+		}
+	}
+
+	for _, model := range slices.Sorted(maps.Keys(p.SupportedModels)) {
+		path := schemaChildPath(schemaChildPath(base, "supportedModels"), model)
+		checkModelName(path, model)
+		if !p.SupportedModels[model] {
+			add(path, SchemaSeverityWarning, fmt.Sprintf("%q 的值为 false，该条目不会生效", model), "改为 true 或删除该条目")
+		}
+	}
+	for _, external := range slices.Sorted(maps.Keys(p.ModelMapping)) {
+		path := schemaChildPath(schemaChildPath(base, "modelMapping"), external)
+		internal := p.ModelMapping[external]
+		checkModelName(path, external)
+		checkModelName(path, internal)
+		if strings.Contains(internal, "*") && !strings.Contains(external, "*") {
+			add(path, SchemaSeverityError, fmt.Sprintf("映射目标 %q 含通配符，但来源 %q 不含，'*' 会被原样发送给上游", internal, external),
+				"来源与目标同时使用 '*'，或目标写完整模型名")
+		}
+	}
+	return issues
+}
+
+// validateProviderSchemaFile 读取并校验 kind 对应的 provider 配置文件，文件不存在时返回 nil
+func validateProviderSchemaFile(kind string) []SchemaIssue {
+	path, err := providerFilePath(kind)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return ValidateProviderSchema(filepath.Base(path), data)
+}
+
+// providerSchemaError 加载失败时优先返回带行号与建议的结构错误
+func providerSchemaError(file string, data []byte, err error) error {
+	issues := schemaErrors(ValidateProviderSchema(file, data))
+	if len(issues) == 0 {
+		return err
+	}
+	messages := make([]string, len(issues))
+	for i, issue := range issues {
+		messages[i] = issue.String()
+	}
+	return fmt.Errorf("配置结构错误：\n  - %s", strings.Join(messages, "\n  - "))
+}
+
+// ValidateProviderConfigSchema 校验各平台 provider 配置文件的结构；声明式配置模式下不读取文件，跳过
+func (ps *ProviderService) ValidateProviderConfigSchema() []SchemaIssue {
+	issues := []SchemaIssue{}
+	for _, kind := range []string{"claude", "codex", "gemini-cli", "picoclaw"} {
+		if _, static := ps.staticProviders(kind); static {
+			continue
+		}
+		issues = append(issues, validateProviderSchemaFile(kind)...)
+	}
+	return issues
+}
+
+// jsonPathOffsets 返回每个 JSON 值（对象字段为字段名）在文本中的起始偏移
+func jsonPathOffsets(data []byte) (map[string]int64, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	offsets := map[string]int64{}
+	next := func() int64 {
+		offset := dec.InputOffset()
+		for offset < int64(len(data)) && strings.IndexByte(" \t\r\n:,", data[offset]) >= 0 {
+			offset++
+		}
+		return offset
+	}
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		if _, ok := offsets[path]; !ok {
+			offsets[path] = next()
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+		for i := 0; dec.More(); i++ {
+			var child string
+			if delim == '{' {
+				offset := next()
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := keyTok.(string)
+				child = schemaChildPath(path, key)
+				offsets[child] = offset
+			} else {
+				child = fmt.Sprintf("%s[%d]", path, i)
+			}
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("JSON 末尾存在多余内容")
+	}
+	return offsets, nil
+}
+
+// schemaChildPath 字段路径：普通字段用 .name，模型映射等以模型名为键的对象用 ["name"]
+func schemaChildPath(parent, key string) string {
+	if parent == "modelMapping" || parent == "supportedModels" ||
+		strings.HasSuffix(parent, ".modelMapping") || strings.HasSuffix(parent, ".supportedModels") {
+		return parent + "[" + strconv.Quote(key) + "]"
+	}
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// jsonLineColumn 偏移转换为行号与列号（从 1 开始），offset < 0 时返回 0
+func jsonLineColumn(data []byte, offset int64) (int, int) {
+	if offset < 0 {
+		return 0, 0
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len([]rune(string(before[bytes.LastIndexByte(before, '\n')+1:]))) + 1
+	return line, column
+}
+
+func describeSchemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return describeSchemaType(t.Elem())
+	case reflect.String:
+		return "字符串"
+	case reflect.Bool:
+		return "布尔值 true / false"
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return "整数"
+	case reflect.Float64, reflect.Float32:
+		return "数字"
+	case reflect.Map:
+		return fmt.Sprintf("对象（值为%s）", describeSchemaType(t.Elem()))
+	case reflect.Slice:
+		return "数组"
+	case reflect.Struct:
+		return "对象"
+	case reflect.Interface:
+		return "任意 JSON 值"
+	}
+	return t.String()
+}
+
+// schemaTypeSuggestion 常见类型错误的修改建议
+func schemaTypeSuggestion(field string, value json.RawMessage) string {
+	switch field {
+	case "supportedModels":
+		var list []string
+		if json.Unmarshal(value, &list) == nil && len(list) > 0 {
+			return fmt.Sprintf(`写成对象，如 {%q: true}`, list[0])
+		}
+		return `写成 {"模型名": true} 形式的对象`
+	case "modelMapping":
+		var pairs map[string]any
+		if json.Unmarshal(value, &pairs) == nil {
+			return "映射目标必须是字符串模型名"
+		}
+		return `写成 {"请求中的模型": "上游模型"} 形式的对象`
+	}
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		return "去掉值两侧的引号"
+	}
+	return ""
+}
+
+// closestFieldName 找到与未知字段最接近的已知字段（忽略大小写，编辑距离不超过 2）
+func closestFieldName(name string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	lower := strings.ToLower(name)
+	for known := range fields {
+		if d := editDistance(lower, strings.ToLower(known)); d < bestDist || (d == bestDist && known < best) {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateProviderSchema(t *testing.T) {
+	data := []byte(`{
+  "providers": [
+    {
+      "name": "a",
+      "apiUrl": "https://a.example.com",
+      "enabled": "true",
+      "supportedModels": ["claude-sonnet-4"]
+    },
+    {
+      "name": "b",
+      "modelMaping": {"x": "y"},
+      "supportedModels": {"claude-*-*": true, "claude-haiku": false},
+      "modelMapping": {" claude-3 ": "claude-haiku", "opus": "anthropic/*"}
+    }
+  ]
+}`)
+	issues := ValidateProviderSchema("claude-code.json", data)
+	byPath := map[string]SchemaIssue{}
+	for _, issue := range issues {
+		byPath[issue.Path] = issue
+	}
+
+	enabled := byPath["providers[0].enabled"]
+	if enabled.Severity != SchemaSeverityError || enabled.Line != 6 || enabled.Column != 7 || enabled.Suggestion == "" {
+		t.Fatalf("unexpected enabled issue %+v", enabled)
+	}
+	supported := byPath["providers[0].supportedModels"]
+	if supported.Line != 7 || !strings.Contains(supported.Suggestion, `{"claude-sonnet-4": true}`) {
+		t.Fatalf("unexpected supportedModels issue %+v", supported)
+	}
+	if typo := byPath["providers[1].modelMaping"]; typo.Severity != SchemaSeverityWarning || !strings.Contains(typo.Suggestion, `"modelMapping"`) {
+		t.Fatalf("expected typo suggestion, got %+v", typo)
+	}
+	if wildcard := byPath[`providers[1].supportedModels["claude-*-*"]`]; wildcard.Severity != SchemaSeverityError || wildcard.Line != 12 {
+		t.Fatalf("unexpected wildcard issue %+v", wildcard)
+	}
+	if disabled := byPath[`providers[1].supportedModels["claude-haiku"]`]; disabled.Severity != SchemaSeverityWarning {
+		t.Fatalf("expected false entry warning, got %+v", disabled)
+	}
+	if space := byPath[`providers[1].modelMapping[" claude-3 "]`]; space.Line != 13 || !strings.Contains(space.Suggestion, `"claude-3"`) {
+		t.Fatalf("unexpected whitespace issue %+v", space)
+	}
+	if target := byPath[`providers[1].modelMapping["opus"]`]; target.Severity != SchemaSeverityError {
+		t.Fatalf("expected wildcard target error, got %+v", target)
+	}
+	if len(issues) != 7 {
+		t.Fatalf("expected 7 issues, got %d: %+v", len(issues), issues)
+	}
+
+	broken := ValidateProviderSchema("codex.json", []byte("{\n  \"providers\": [\n    {\"name\": \"a\",}\n  ]\n}"))
+	if len(broken) != 1 || broken[0].Line != 3 || !strings.HasPrefix(broken[0].String(), "codex.json:3:") {
+		t.Fatalf("expected syntax error on line 3, got %+v", broken)
+	}
+	if issues := ValidateProviderSchema("x.json", []byte(`{"providers": [{"name": "ok", "modelMapping": {"claude-*": "anthropic/claude-*"}}]}`)); len(issues) != 0 {
+		t.Fatalf("valid config should have no issues, got %+v", issues)
+	}
+}
+
+func TestProviderSchemaOnLoadAndSave(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	ps := NewProviderService()
+
+	err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "a", Enabled: true, ModelMapping: map[string]string{"opus ": "claude-opus"}}})
+	if err == nil || !strings.Contains(err.Error(), `modelMapping["opus "]`) {
+		t.Fatalf("expected save to be blocked with the field path, got %v", err)
+	}
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "a", Enabled: true, SupportedModels: map[string]bool{"claude-haiku": false}}}); err != nil {
+		t.Fatalf("warnings should not block saving: %v", err)
+	}
+
+	prs := &ProviderRelayService{providerService: ps}
+	if warnings := strings.Join(prs.validateConfig(), "\n"); !strings.Contains(warnings, `claude-code.json:`) || !strings.Contains(warnings, "claude-haiku") {
+		t.Fatalf("expected schema warning in validateConfig, got %s", warnings)
+	}
+
+	path := filepath.Join(home, ".code-switch", "codex.json")
+	if err := os.WriteFile(path, []byte("{\n  \"providers\": [\n    {\"name\": \"a\", \"supportedModels\": [\"gpt-5\"]}\n  ]\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ps.LoadProviders("codex")
+	if err == nil || !strings.Contains(err.Error(), "codex.json:3:19 providers[0].supportedModels") {
+		t.Fatalf("expected located load error, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// expandProviderTemplate 替换请求头模板中的变量
+// 支持 {{apiKey}}、{{model}}、{{provider}}
+func expandProviderTemplate(tmpl string, provider Provider, model string) string {
+	if !strings.Contains(tmpl, "{{") {
+		return tmpl
+	}
+	return strings.NewReplacer(
+		"{{apiKey}}", provider.APIKey,
+		"{{model}}", model,
+		"{{provider}}", provider.Name,
+	).Replace(tmpl)
+}
+
+// applyExtraHeaders 写入 provider 自定义请求头（在认证头之后应用，可覆盖默认值）
+// 模板值为空字符串时删除该请求头
+func applyExtraHeaders(provider Provider, model string, headers map[string]string) {
+	for name, tmpl := range provider.ExtraHeaders {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		deleteHeader(headers, name)
+		if value := expandProviderTemplate(tmpl, provider, model); value != "" {
+			headers[name] = value
+		}
+	}
+}
+
+// applyExtraBody 以 JSON Merge Patch (RFC 7386) 方式合并 provider 固定请求体参数
+// 字符串值同样支持变量替换；patch 中的 null 表示删除字段
+func applyExtraBody(provider Provider, model string, body []byte) ([]byte, error) {
+	if len(provider.ExtraBody) == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var target map[string]interface{}
+	if err := decoder.Decode(&target); err != nil {
+		return nil, fmt.Errorf("解析请求体失败: %w", err)
+	}
+
+	patch := expandPatchTemplates(provider.ExtraBody, provider, model).(map[string]interface{})
+	merged := mergePatch(target, patch)
+	return json.Marshal(merged)
+}
+
+// mergePatch 按 RFC 7386 合并 patch 到 target
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
+
+// expandPatchTemplates 递归替换 patch 中字符串值的模板变量，返回新的副本
+func expandPatchTemplates(value interface{}, provider Provider, model string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = expandPatchTemplates(item, provider, model)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = expandPatchTemplates(item, provider, model)
+		}
+		return out
+	case string:
+		return expandProviderTemplate(v, provider, model)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestApplyExtraHeaders(t *testing.T) {
+	provider := Provider{
+		Name:   "openrouter",
+		APIKey: "sk-or",
+		ExtraHeaders: map[string]string{
+			"HTTP-Referer":    "https://code-switch.local",
+			"X-Title":         "{{provider}} / {{model}}",
+			"X-Dashscope-Key": "{{apiKey}}",
+			"Accept":          "",
+		},
+	}
+	headers := map[string]string{"accept": "application/json", "Authorization": "Bearer sk-or"}
+	applyExtraHeaders(provider, "gpt-5", headers)
+
+	if headers["X-Title"] != "openrouter / gpt-5" {
+		t.Errorf("X-Title = %q", headers["X-Title"])
+	}
+	if headers["X-Dashscope-Key"] != "sk-or" {
+		t.Errorf("X-Dashscope-Key = %q", headers["X-Dashscope-Key"])
+	}
+	if getHeader(headers, "Accept") != "" {
+		t.Error("empty template should remove header")
+	}
+	if headers["Authorization"] != "Bearer sk-or" {
+		t.Error("unrelated headers should be preserved")
+	}
+}
+
+func TestApplyExtraBody(t *testing.T) {
+	provider := Provider{
+		Name: "dashscope",
+		ExtraBody: map[string]interface{}{
+			"enable_thinking": false,
+			"metadata":        map[string]interface{}{"source": "{{provider}}", "drop": nil},
+			"temperature":     nil,
+		},
+	}
+	body := []byte(`{"model":"qwen3","temperature":0.7,"max_tokens":12345678901,"metadata":{"drop":1,"keep":true}}`)
+	patched, err := applyExtraBody(provider, "qwen3", body)
+	if err != nil {
+		t.Fatalf("applyExtraBody: %v", err)
+	}
+
+	result := gjson.ParseBytes(patched)
+	if result.Get("temperature").Exists() {
+		t.Error("null patch value should delete field")
+	}
+	if result.Get("enable_thinking").Bool() || !result.Get("enable_thinking").Exists() {
+		t.Error("enable_thinking should be set to false")
+	}
+	if result.Get("metadata.source").String() != "dashscope" || !result.Get("metadata.keep").Bool() || result.Get("metadata.drop").Exists() {
+		t.Errorf("unexpected metadata: %s", result.Get("metadata").Raw)
+	}
+	if result.Get("max_tokens").Raw != "12345678901" {
+		t.Errorf("number precision lost: %s", result.Get("max_tokens").Raw)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -41,12 +42,106 @@ type ProviderRelayService struct {
 	rrCounter uint64
 	// 轮询模式开关：true=Round-Robin，false=按优先级顺序
 	roundRobinEnabled uint32
+	// 暂停转发开关：暂停时代理请求直接返回 503，原子操作
+	relayPaused uint32
 	// 日志写入队列，避免并发写入竞争
 	logWriteQueue chan *ReqeustLog
+	// 日志写入队列的入队 / 丢弃 / 写入计数
+	logQueue logQueueCounters
+	// 日志队列写满时的策略（丢弃 / 等待 / 暂存磁盘）与溢出事件订阅者
+	logOverflow logOverflowStore
 	// Body 日志开关：控制是否存储请求/响应体
 	bodyLogEnabled uint32
 	// Body 日志写入队列，独立于主日志队列
 	bodyLogQueue chan *RequestLogBody
+	// 请求体大小上限（字节），原子操作
+	maxRequestBodyBytes int64
+	// Body 日志采样与过滤策略
+	bodyLogPolicy bodyLogPolicyStore
+	// provider 状态事件订阅者（挂起 / 恢复）
+	providerEvents providerEventBus
+	// 转发服务启动 / 关闭失败的订阅者
+	serverErrors serverErrorHub
+	// 连续认证失败计数，用于自动挂起
+	authFailures authFailureTracker
+	// 上游限流额度（anthropic-ratelimit-* / x-ratelimit-*）
+	rateLimits rateLimitTracker
+	// 429/529 后的 provider 冷却状态
+	cooldowns cooldownTracker
+	// 同一 provider 排队重试的最长等待时间（纳秒），原子操作
+	stickyRetryMaxWait int64
+	// 全局上游超时配置
+	timeoutSettings timeoutSettingsStore
+	// 各平台默认的单次请求 token 上限
+	tokenLimits tokenLimitStore
+	// 混沌测试配置（调试用）
+	chaos chaosConfigStore
+	// 请求日志 live tail 订阅者
+	logTail logTailHub
+	// 按客户端 API Key 的成本归属规则
+	attribution attributionStore
+	// 出站提示词内容策略（密钥 / 敏感数据扫描）
+	guardrails guardrailStore
+	// 日志导出进度回调
+	logExport logExportHub
+	// 管理 API 令牌与内置控制台资源
+	admin adminStore
+	// 健康检查的依赖探测缓存
+	health healthCache
+	// 多副本共享状态（Redis），未配置时使用进程内状态
+	shared sharedStateHolder
+	// 达到花费预算后改用兜底 provider
+	budgetFallback budgetFallbackState
+	// gRPC 管理 / 流式接口
+	grpc grpcStore
+	// 各平台固定使用的 provider（托盘快速切换）
+	pins pinStore
+	// 各平台的 provider 组（复合 provider）
+	providerGroups providerGroupStore
+	// 响应质量评分配置、钩子与各 provider 的滚动平均分
+	quality qualityState
+	// 超出上下文窗口时的提示词压缩配置
+	compression compressionStore
+	// 中继插件与进程内拦截器
+	plugins pluginStore
+	// 按平台的请求脚本配置与编译缓存
+	scripts scriptStore
+	// 推理内容处理策略（按平台 / 客户端）
+	reasoning reasoningStore
+	// 客户端未指定时注入的模型默认参数
+	modelDefaults modelDefaultsStore
+	// 请求优先级（interactive / batch）与按 provider 的并发排队
+	priority priorityStore
+	// Idempotency-Key 对应的进行中请求与已缓存的响应
+	idempotency idempotencyStore
+	// 公开状态页开关与可用性历史缓存
+	publicStatus publicStatusStore
+	// 慢请求剖析阈值（time.Duration），0 表示关闭
+	slowRequestThreshold int64
+	// /v1/batch 最大并发，0 表示默认值
+	batchConcurrency int64
+	// 进行中的 provider 故障（熔断 / 挂起 / 全部失败）
+	incidents incidentTracker
+	// 错误预算快速消耗中的 provider（避免重复告警）
+	sloAlerts sloAlertStore
+	// 浏览器客户端跨域访问配置
+	cors corsStore
+	// 入站 IP 允许 / 拒绝名单
+	ipAccess ipAccessStore
+	// 按来源 IP 的请求频率 / 并发限制与临时封禁
+	abuse abuseStore
+	// TLS 监听与客户端证书认证
+	mtls mtlsStore
+	// 最近请求的结果，用于托盘图标状态
+	status relayStatusTracker
+	// 首字节 / 首 token 时间与流式吞吐直方图
+	latency latencyHistograms
+	// 按平台累计的上游传输字节数
+	transfer transferCounters
+	// 数据库大小检查与空间回收
+	dbMaintenance dbMaintenanceState
+	// 用户模型覆盖文件（价格 / 上下文窗口 / 能力）
+	modelOverrides modelOverrideStore
 	// 同步集成：用于多端同步功能
 	syncIntegration *SyncIntegration
 
@@ -63,6 +158,9 @@ type ProviderRelayService struct {
 
 	// Config Recovery (Phase 4)
 	configRecovery *ConfigRecovery
+
+	// OAuth 订阅账号令牌（authType=oauth 的 provider 使用）
+	oauthService *OAuthService
 }
 
 func NewProviderRelayService(providerService *ProviderService, addr string) *ProviderRelayService {
@@ -71,13 +169,20 @@ func NewProviderRelayService(providerService *ProviderService, addr string) *Pro
 	}
 
 	home, _ := os.UserHomeDir()
-	const sqliteOptions = "?cache=shared&mode=rwc&_busy_timeout=5000&_journal_mode=WAL"
+	// modernc 驱动只识别 _pragma 参数，busy_timeout 需以 _pragma 形式设置才会作用于连接池中的每个连接
+	const sqliteOptions = "?cache=shared&mode=rwc&_busy_timeout=5000&_journal_mode=WAL&_pragma=busy_timeout(5000)"
+	dbPath := filepath.Join(home, ".code-switch", "app.db")
+	dsn := dbPath + sqliteOptions
+	if IsReadOnlyMode() {
+		// 只读模式：请求日志只保存在内存库中，进程退出即丢弃
+		dsn = "file:code-switch?mode=memory&cache=shared&_busy_timeout=5000"
+	}
 
 	if err := xdb.Inits([]xdb.Config{
 		{
 			Name:   "default",
 			Driver: "sqlite",
-			DSN:    filepath.Join(home, ".code-switch", "app.db"+sqliteOptions),
+			DSN:    dsn,
 			// 使用写入队列后，减少连接池避免资源浪费
 			// 1 个写入线程 + 几个并发查询足够
 			MaxOpenConn: 5,
@@ -87,6 +192,11 @@ func NewProviderRelayService(providerService *ProviderService, addr string) *Pro
 		fmt.Printf("初始化数据库失败: %v\n", err)
 	} else if err := ensureRequestLogTable(); err != nil {
 		fmt.Printf("初始化 request_log 表失败: %v\n", err)
+	} else if !IsReadOnlyMode() {
+		// 日志查询 / 统计使用独立的只读连接池，避免与写入队列争用连接
+		if err := initAnalyticsDB(dbPath); err != nil {
+			fmt.Printf("初始化只读查询连接池失败（回退到主连接池）: %v\n", err)
+		}
 	}
 
 	// 初始化价格计算服务
@@ -106,7 +216,7 @@ func NewProviderRelayService(providerService *ProviderService, addr string) *Pro
 
 	// 初始化配置恢复服务 (Phase 4)
 	var cr *ConfigRecovery
-	if db, dbErr := xdb.DB("default"); dbErr == nil && db != nil {
+	if db, dbErr := xdb.DB("default"); dbErr == nil && db != nil && !IsReadOnlyMode() {
 		cr = NewConfigRecovery(db, filepath.Join(home, ".code-switch"))
 		fmt.Printf("[Recovery] 配置恢复服务已初始化\n")
 	}
@@ -126,12 +236,61 @@ func NewProviderRelayService(providerService *ProviderService, addr string) *Pro
 	// 启动单个 goroutine 处理所有日志写入，避免写锁竞争
 	go prs.processLogWriteQueue()
 
+	// 合并用户模型覆盖文件，文件修改后自动重新加载
+	if err := prs.reloadModelOverrides(true); err != nil {
+		fmt.Printf("[ModelOverrides] 加载失败: %v\n", err)
+	}
+	go prs.startModelOverrideWatchTask()
+
+	// 恢复 Body 日志采样与过滤策略
+	prs.loadBodyLogPolicy()
+
+	// 恢复成本归属规则
+	prs.loadAttributionRules()
+	// 恢复出站内容策略
+	prs.loadGuardrailPolicy()
+	// 恢复各平台默认 token 上限
+	prs.loadTokenLimitDefaults()
+	prs.loadPinnedProviders()
+	prs.loadProviderGroups()
+	// 恢复响应质量评分规则
+	prs.loadQualityConfig()
+	prs.loadCompressionConfig()
+	// 拉起插件目录中的中继插件
+	prs.loadPluginConfig()
+	prs.loadScriptConfig()
+	prs.loadReasoningConfig()
+	prs.loadModelDefaults()
+	prs.loadPriorityConfig()
+	go prs.startPlugins()
+
 	// 启动 Body 日志写入队列处理
 	go prs.processBodyLogQueue()
 
+	// 回放队列写满时暂存到磁盘的日志
+	go prs.startLogSpoolReplay()
+
 	// 启动过期 Body 日志清理任务
 	go prs.startBodyLogCleanupTask()
 
+	// 增量维护用量汇总表
+	go prs.startRollupTask()
+
+	// 定期检查数据库大小，清理大量日志后回收空间
+	go prs.startDatabaseMaintenanceTask()
+
+	// 聚合平台模型目录同步（OpenRouter / SiliconFlow / DeepInfra）
+	go prs.startCatalogSyncTask()
+
+	// 定期重新验证因认证失败挂起的 provider
+	go prs.startSuspendProbeTask()
+
+	// 定期评估灰度 provider，自动转正或停用
+	go prs.startCanaryEvalTask()
+
+	// 定期检查 provider SLO 的错误预算消耗速度
+	go prs.startSLOEvalTask()
+
 	// 初始化 Lurus-API 集成 (从配置文件)
 	if err := prs.lurusIntegration.Initialize(); err != nil {
 		fmt.Printf("[Lurus] 初始化失败: %v\n", err)
@@ -151,23 +310,63 @@ func (prs *ProviderRelayService) Start() error {
 	}
 
 	router := gin.Default()
+	// handler panic 时生成崩溃报告
+	router.Use(crashRecoveryMiddleware())
 	prs.registerRoutes(router)
 
+	tlsConfig := prs.serverTLSConfig()
 	prs.server = &http.Server{
-		Addr:    prs.addr,
-		Handler: router,
+		Addr:      prs.addr,
+		Handler:   router,
+		TLSConfig: tlsConfig,
 	}
 
-	fmt.Printf("provider relay server listening on %s\n", prs.addr)
+	if tlsConfig != nil {
+		fmt.Printf("provider relay server listening on %s (TLS, client auth: %s)\n", prs.addr, prs.GetMTLSConfig().ClientAuth)
+	} else {
+		fmt.Printf("provider relay server listening on %s\n", prs.addr)
+	}
 
 	go func() {
-		if err := prs.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		prs.setRelayRunning(true)
+		defer prs.setRelayRunning(false)
+		var err error
+		if tlsConfig != nil {
+			// 证书已在 TLSConfig 中加载
+			err = prs.server.ListenAndServeTLS("", "")
+		} else {
+			err = prs.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			fmt.Printf("provider relay server error: %v\n", err)
+			prs.emitServerError(fmt.Errorf("relay failed to listen on %s: %w", prs.addr, err))
 		}
 	}()
 	return nil
 }
 
+// serverErrorHub 转发服务错误订阅者
+type serverErrorHub struct {
+	mu       sync.Mutex
+	handlers []func(error)
+}
+
+// OnServerError 订阅转发服务启动 / 关闭失败
+func (prs *ProviderRelayService) OnServerError(handler func(error)) {
+	prs.serverErrors.mu.Lock()
+	prs.serverErrors.handlers = append(prs.serverErrors.handlers, handler)
+	prs.serverErrors.mu.Unlock()
+}
+
+func (prs *ProviderRelayService) emitServerError(err error) {
+	prs.serverErrors.mu.Lock()
+	handlers := append([]func(error){}, prs.serverErrors.handlers...)
+	prs.serverErrors.mu.Unlock()
+	for _, handler := range handlers {
+		handler(err)
+	}
+}
+
 // validateConfig 验证所有 provider 的配置
 // 返回警告列表（非阻塞性错误）
 func (prs *ProviderRelayService) validateConfig() []string {
@@ -180,6 +379,13 @@ func (prs *ProviderRelayService) validateConfig() []string {
 			continue
 		}
 
+		// 配置文件结构：未知字段、可疑的模型名等（类型错误已在加载失败的信息中给出）
+		if _, static := prs.providerService.staticProviders(kind); !static {
+			for _, issue := range validateProviderSchemaFile(kind) {
+				warnings = append(warnings, fmt.Sprintf("[%s] %s", kind, issue))
+			}
+		}
+
 		enabledCount := 0
 		for _, p := range providers {
 			if !p.Enabled {
@@ -212,6 +418,8 @@ func (prs *ProviderRelayService) validateConfig() []string {
 }
 
 func (prs *ProviderRelayService) Stop() error {
+	prs.stopGRPC()
+	prs.stopPlugins()
 	if prs.server == nil {
 		return nil
 	}
@@ -224,7 +432,11 @@ func (prs *ProviderRelayService) Stop() error {
 	close(prs.bodyLogQueue)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return prs.server.Shutdown(ctx)
+	if err := prs.server.Shutdown(ctx); err != nil {
+		prs.emitServerError(fmt.Errorf("relay failed to shut down: %w", err))
+		return err
+	}
+	return nil
 }
 
 // ============================================================
@@ -248,86 +460,6 @@ func (prs *ProviderRelayService) SetLurusEnabled(enabled bool) {
 	}
 }
 
-// processLogWriteQueue 处理日志写入队列，批量写入降低锁占用时间
-func (prs *ProviderRelayService) processLogWriteQueue() {
-	const batchSize = 10
-	const batchTimeout = 100 * time.Millisecond
-
-	fmt.Printf("[Ailurus PaaS] 日志写入队列已启动 (batch_size=%d, timeout=%v)\n", batchSize, batchTimeout)
-
-	batch := make([]*ReqeustLog, 0, batchSize)
-	ticker := time.NewTicker(batchTimeout)
-	defer ticker.Stop()
-
-	flushBatch := func() {
-		if len(batch) == 0 {
-			return
-		}
-
-		// 批量写入，减少锁占用次数
-		fmt.Printf("[Ailurus PaaS] 批量写入 %d 条日志到数据库\n", len(batch))
-		successCount := 0
-		for _, log := range batch {
-			if _, err := xdb.New("request_log").Insert(xdb.Record{
-				"trace_id":            log.TraceID,
-				"request_id":          log.RequestID,
-				"platform":            log.Platform,
-				"model":               log.Model,
-				"provider":            log.Provider,
-				"http_code":           log.HttpCode,
-				"input_tokens":        log.InputTokens,
-				"output_tokens":       log.OutputTokens,
-				"cache_create_tokens": log.CacheCreateTokens,
-				"cache_read_tokens":   log.CacheReadTokens,
-				"reasoning_tokens":    log.ReasoningTokens,
-				"is_stream":           boolToInt(log.IsStream),
-				"duration_sec":        log.DurationSec,
-				"user_agent":          log.UserAgent,
-				"client_ip":           log.ClientIP,
-				"user_id":             log.UserID,
-				"request_method":      log.RequestMethod,
-				"request_path":        log.RequestPath,
-				"error_type":          log.ErrorType,
-				"error_message":       log.ErrorMessage,
-				"provider_error_code": log.ProviderErrorCode,
-				"input_cost":          log.InputCost,
-				"output_cost":         log.OutputCost,
-				"cache_create_cost":   log.CacheCreateCost,
-				"cache_read_cost":     log.CacheReadCost,
-				"ephemeral_5m_cost":   log.Ephemeral5mCost,
-				"ephemeral_1h_cost":   log.Ephemeral1hCost,
-				"total_cost":          log.TotalCost,
-			}); err != nil {
-				fmt.Printf("[Ailurus PaaS] 写入 request_log 失败 (trace_id=%s): %v\n", log.TraceID, err)
-			} else {
-				successCount++
-			}
-		}
-		fmt.Printf("[Ailurus PaaS] 批量写入完成：%d/%d 成功\n", successCount, len(batch))
-		batch = batch[:0]
-	}
-
-	for {
-		select {
-		case log, ok := <-prs.logWriteQueue:
-			if !ok {
-				// 队列关闭，刷新剩余批次
-				fmt.Printf("[Ailurus PaaS] 日志写入队列关闭，刷新剩余 %d 条日志\n", len(batch))
-				flushBatch()
-				fmt.Printf("[Ailurus PaaS] 日志写入队列已停止\n")
-				return
-			}
-			batch = append(batch, log)
-			if len(batch) >= batchSize {
-				flushBatch()
-			}
-		case <-ticker.C:
-			// 定时刷新，避免日志积压
-			flushBatch()
-		}
-	}
-}
-
 func (prs *ProviderRelayService) Addr() string {
 	return prs.addr
 }
@@ -351,6 +483,37 @@ func (prs *ProviderRelayService) SetRoundRobinEnabled(enabled bool) {
 	fmt.Printf("[INFO] 负载均衡模式已切换为：%s\n", mode)
 }
 
+// IsRelayPaused 获取暂停转发开关状态
+func (prs *ProviderRelayService) IsRelayPaused() bool {
+	return atomic.LoadUint32(&prs.relayPaused) == 1
+}
+
+// SetRelayPaused 暂停 / 恢复代理转发，暂停期间客户端请求返回 503
+func (prs *ProviderRelayService) SetRelayPaused(paused bool) {
+	var val uint32 = 0
+	if paused {
+		val = 1
+	}
+	atomic.StoreUint32(&prs.relayPaused, val)
+	status := "已恢复"
+	if paused {
+		status = "已暂停"
+	}
+	fmt.Printf("[INFO] 代理转发%s\n", status)
+}
+
+// rejectIfRelayPaused 转发已暂停时返回 503
+func (prs *ProviderRelayService) rejectIfRelayPaused(c *gin.Context) bool {
+	if !prs.IsRelayPaused() {
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": "relay is paused",
+		"type":  "relay_paused",
+	})
+	return true
+}
+
 // IsBodyLogEnabled 获取 Body 日志开关状态
 func (prs *ProviderRelayService) IsBodyLogEnabled() bool {
 	return atomic.LoadUint32(&prs.bodyLogEnabled) == 1
@@ -446,6 +609,15 @@ func (prs *ProviderRelayService) ToggleProxy(appName string, enabled bool) error
 	return prs.proxyController.ToggleProxy(appName, enabled)
 }
 
+// UpdateProxyRules replaces the request rules of an application
+func (prs *ProviderRelayService) UpdateProxyRules(appName string, rules ProxyRules) error {
+	if prs.proxyController == nil {
+		return fmt.Errorf("proxy controller not initialized")
+	}
+
+	return prs.proxyController.SetRules(appName, &rules)
+}
+
 // GetBackupHistory returns backup history for a specific type (Phase 4)
 func (prs *ProviderRelayService) GetBackupHistory(backupType string, limit int) ([]BackupRecord, error) {
 	if prs.configRecovery == nil {
@@ -473,19 +645,21 @@ func (prs *ProviderRelayService) CleanupOldBackups(keepCount int) error {
 	return prs.configRecovery.CleanupOldBackups(keepCount)
 }
 
+// GetDatabaseRepairReport returns the last startup database repair report, nil if the database was never repaired
+func (prs *ProviderRelayService) GetDatabaseRepairReport() (*DatabaseRepairReport, error) {
+	if prs.configRecovery == nil {
+		return nil, fmt.Errorf("config recovery not initialized")
+	}
+
+	return prs.configRecovery.GetDatabaseRepairReport()
+}
+
 // processBodyLogQueue 处理 Body 日志写入队列
 func (prs *ProviderRelayService) processBodyLogQueue() {
 	fmt.Printf("[Ailurus PaaS] Body 日志写入队列已启动\n")
 
 	for bodyLog := range prs.bodyLogQueue {
-		if _, err := xdb.New("request_log_body").Insert(xdb.Record{
-			"trace_id":        bodyLog.TraceID,
-			"request_body":    bodyLog.RequestBody,
-			"response_body":   bodyLog.ResponseBody,
-			"body_size_bytes": bodyLog.BodySizeBytes,
-			"created_at":      bodyLog.CreatedAt.Format("2006-01-02 15:04:05"),
-			"expires_at":      bodyLog.ExpiresAt.Format("2006-01-02 15:04:05"),
-		}); err != nil {
+		if err := writeBodyLog(bodyLog); err != nil {
 			fmt.Printf("[Ailurus PaaS] 写入 request_log_body 失败 (trace_id=%s): %v\n", bodyLog.TraceID, err)
 		}
 	}
@@ -493,6 +667,24 @@ func (prs *ProviderRelayService) processBodyLogQueue() {
 	fmt.Printf("[Ailurus PaaS] Body 日志写入队列已停止\n")
 }
 
+func writeBodyLog(bodyLog *RequestLogBody) error {
+	// 较大的系统提示词 / 工具定义 / 消息拆分到 body_blobs 去重存储
+	if stored, blobs, refs := splitBodyBlobs(bodyLog.RequestBody); len(refs) > 0 {
+		return writeBodyLogWithBlobs(bodyLog, stored, blobs, refs)
+	}
+	_, err := xdb.New("request_log_body").Insert(xdb.Record{
+		"trace_id":           bodyLog.TraceID,
+		"request_body":       bodyLog.RequestBody,
+		"response_body":      bodyLog.ResponseBody,
+		"response_body_path": bodyLog.ResponseBodyPath,
+		"truncated":          boolToInt(bodyLog.Truncated),
+		"body_size_bytes":    bodyLog.BodySizeBytes,
+		"created_at":         bodyLog.CreatedAt.Format("2006-01-02 15:04:05"),
+		"expires_at":         bodyLog.ExpiresAt.Format("2006-01-02 15:04:05"),
+	})
+	return err
+}
+
 // startBodyLogCleanupTask 启动过期 Body 日志清理任务
 func (prs *ProviderRelayService) startBodyLogCleanupTask() {
 	// 启动时先清理一次
@@ -514,13 +706,13 @@ func (prs *ProviderRelayService) cleanupExpiredBodyLogs() {
 		return
 	}
 
-	result, err := db.Exec("DELETE FROM request_log_body WHERE expires_at < datetime('now')")
+	deleted, err := deleteBodyLogs(db, "expires_at < datetime('now')")
 	if err != nil {
 		fmt.Printf("[Ailurus PaaS] 清理过期 Body 日志失败: %v\n", err)
 		return
 	}
 
-	deleted, _ := result.RowsAffected()
+	prs.noteLogDeletion(deleted)
 	if deleted > 0 {
 		fmt.Printf("[Ailurus PaaS] 已清理 %d 条过期 Body 日志\n", deleted)
 	}
@@ -534,7 +726,7 @@ func (prs *ProviderRelayService) countEnabledProviders(platform string) int {
 	}
 	count := 0
 	for _, p := range providers {
-		if p.Enabled && p.APIURL != "" && p.APIKey != "" {
+		if p.Enabled && !p.Suspended && p.APIURL != "" && p.HasCredentials() {
 			count++
 		}
 	}
@@ -542,62 +734,29 @@ func (prs *ProviderRelayService) countEnabledProviders(platform string) int {
 }
 
 func (prs *ProviderRelayService) registerRoutes(router gin.IRouter) {
-	// Ailurus PaaS 健康检查端点（增强版）
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":    "healthy",
-			"service":   "Ailurus PaaS Gateway",
-			"version":   AppVersion,
-			"timestamp": time.Now().Unix(),
-		})
-	})
+	// 入站 IP 允许 / 拒绝名单（未配置时放行全部）
+	router.Use(prs.ipAccessMiddleware())
 
-	// Readiness 检查（检查供应商可用性）
-	router.GET("/readiness", func(c *gin.Context) {
-		claudeProviders, _ := prs.providerService.LoadProviders("claude")
-		codexProviders, _ := prs.providerService.LoadProviders("codex")
-		geminiProviders, _ := prs.providerService.LoadProviders("gemini-cli")
-		picoClawProviders, _ := prs.providerService.LoadProviders("picoclaw")
+	// 浏览器客户端跨域访问（默认关闭）；需在其他中间件之前处理预检请求
+	router.Use(prs.corsMiddleware())
 
-		claudeReady := 0
-		codexReady := 0
-		geminiReady := 0
-		picoClawReady := 0
-		for _, p := range claudeProviders {
-			if p.Enabled && p.APIURL != "" && p.APIKey != "" {
-				claudeReady++
-			}
-		}
-		for _, p := range codexProviders {
-			if p.Enabled && p.APIURL != "" && p.APIKey != "" {
-				codexReady++
-			}
-		}
-		for _, p := range geminiProviders {
-			if p.Enabled && p.APIURL != "" && p.APIKey != "" {
-				geminiReady++
-			}
-		}
-		for _, p := range picoClawProviders {
-			if p.Enabled && p.APIURL != "" && p.APIKey != "" {
-				picoClawReady++
-			}
-		}
+	// 按来源 IP 的请求频率 / 并发限制，认证失败或超限过多时临时封禁（默认关闭）
+	router.Use(prs.abuseMiddleware())
 
-		ready := claudeReady > 0 || codexReady > 0 || geminiReady > 0 || picoClawReady > 0
-		status := http.StatusOK
-		if !ready {
-			status = http.StatusServiceUnavailable
-		}
+	// 客户端证书身份识别与按身份限流（仅 TLS 监听且校验通过时）
+	router.Use(prs.mtlsMiddleware())
 
-		c.JSON(status, gin.H{
-			"ready":              ready,
-			"claude_providers":   claudeReady,
-			"codex_providers":    codexReady,
-			"picoclaw_providers": picoClawReady,
-			"timestamp":          time.Now().Unix(),
-		})
-	})
+	// 请求体大小限制与 gzip/deflate 解压
+	router.Use(prs.requestBodyMiddleware())
+
+	// 健康检查：/livez 存活（不受上游故障影响）、/health 综合状态、/readiness 就绪，?verbose=1 输出各项依赖检查
+	router.GET("/livez", prs.livezHandler)
+	router.GET("/health", prs.healthHandler)
+	router.GET("/readiness", prs.readinessHandler)
+
+	// 公开只读状态页（默认关闭）：网关运行时长、错误率与 provider 可用性历史，不含花费与请求内容
+	router.GET("/status", prs.publicStatusHTMLHandler)
+	router.GET("/status.json", prs.publicStatusJSONHandler)
 
 	// Prometheus Metrics 导出端点
 	router.GET("/metrics", func(c *gin.Context) {
@@ -618,6 +777,54 @@ ailurus_paas_providers_total{platform="codex",status="enabled"} %d
 ailurus_paas_providers_total{platform="picoclaw",status="enabled"} %d
 `, AppVersion, time.Since(prs.startTime).Seconds(), prs.countEnabledProviders("claude"), prs.countEnabledProviders("codex"), prs.countEnabledProviders("picoclaw"))
 
+		queue := prs.GetLogQueueStats()
+		metrics += fmt.Sprintf(`
+# HELP ailurus_paas_log_queue_depth Request logs waiting to be written
+# TYPE ailurus_paas_log_queue_depth gauge
+ailurus_paas_log_queue_depth %d
+
+# HELP ailurus_paas_log_queue_capacity Request log queue capacity
+# TYPE ailurus_paas_log_queue_capacity gauge
+ailurus_paas_log_queue_capacity %d
+
+# HELP ailurus_paas_log_batch_size Current adaptive request log batch size
+# TYPE ailurus_paas_log_batch_size gauge
+ailurus_paas_log_batch_size %d
+
+# HELP ailurus_paas_log_dropped_total Request logs dropped because the queue was full
+# TYPE ailurus_paas_log_dropped_total counter
+ailurus_paas_log_dropped_total %d
+
+# HELP ailurus_paas_log_written_total Request logs written to the database
+# TYPE ailurus_paas_log_written_total counter
+ailurus_paas_log_written_total %d
+
+# HELP ailurus_paas_log_write_failed_total Request logs that failed to be written
+# TYPE ailurus_paas_log_write_failed_total counter
+ailurus_paas_log_write_failed_total %d
+
+# HELP ailurus_paas_log_spooled_total Request logs spooled to disk because the queue was full
+# TYPE ailurus_paas_log_spooled_total counter
+ailurus_paas_log_spooled_total %d
+
+# HELP ailurus_paas_log_replayed_total Spooled logs replayed into the database
+# TYPE ailurus_paas_log_replayed_total counter
+ailurus_paas_log_replayed_total %d
+
+# HELP ailurus_paas_log_spool_bytes Size of spooled logs waiting for replay
+# TYPE ailurus_paas_log_spool_bytes gauge
+ailurus_paas_log_spool_bytes %d
+
+# HELP ailurus_paas_body_log_dropped_total Body logs dropped because the queue was full
+# TYPE ailurus_paas_body_log_dropped_total counter
+ailurus_paas_body_log_dropped_total %d
+`, queue.Depth, queue.Capacity, queue.BatchSize, queue.Dropped, queue.Written, queue.Failed,
+			queue.Spooled, queue.Replayed, queue.SpoolBytes, queue.BodyDropped)
+		metrics += prs.latencyMetrics()
+		metrics += prs.priorityMetrics()
+		metrics += prs.idempotencyMetrics()
+		metrics += prs.transferMetrics()
+
 		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(metrics))
 	})
 
@@ -635,6 +842,7 @@ ailurus_paas_providers_total{platform="picoclaw",status="enabled"} %d
 		router.POST("/responses", prs.lurusIntegration.WrapWithQuotaCheck(prs.proxyHandler("codex", "/responses")))
 		router.POST("/v1/chat/completions", prs.lurusIntegration.WrapWithQuotaCheck(prs.proxyHandler("codex", "/v1/chat/completions")))
 		router.POST("/chat/completions", prs.lurusIntegration.WrapWithQuotaCheck(prs.proxyHandler("codex", "/chat/completions")))
+		router.POST("/v1/completions", prs.lurusIntegration.WrapWithQuotaCheck(prs.legacyCompletionsHandler()))
 		router.POST("/v1beta/models/*modelAction", prs.lurusIntegration.WrapWithQuotaCheck(prs.geminiNativeHandler()))
 		// PicoClaw routes (OpenAI-compatible via /pc/ prefix)
 		router.POST("/pc/v1/chat/completions", prs.lurusIntegration.WrapWithQuotaCheck(prs.proxyHandler("picoclaw", "/v1/chat/completions")))
@@ -645,12 +853,36 @@ ailurus_paas_providers_total{platform="picoclaw",status="enabled"} %d
 		router.POST("/responses", prs.proxyHandler("codex", "/responses"))
 		router.POST("/v1/chat/completions", prs.proxyHandler("codex", "/v1/chat/completions"))
 		router.POST("/chat/completions", prs.proxyHandler("codex", "/chat/completions"))
+		router.POST("/v1/completions", prs.legacyCompletionsHandler())
 		router.POST("/v1beta/models/*modelAction", prs.geminiNativeHandler())
 		// PicoClaw routes (OpenAI-compatible via /pc/ prefix)
 		router.POST("/pc/v1/chat/completions", prs.proxyHandler("picoclaw", "/v1/chat/completions"))
 		router.POST("/pc/chat/completions", prs.proxyHandler("picoclaw", "/chat/completions"))
 	}
 
+	// 批量请求：在网关内按并发上限执行一组对话请求，返回逐条结果与汇总花费
+	if handler, ok := router.(http.Handler); ok {
+		router.POST("/v1/batch", prs.batchRequestHandler(handler))
+	}
+
+	// Anthropic count_tokens / Message Batches API
+	prs.registerAnthropicRoutes(router)
+
+	// 图片生成 / 语音合成 / 语音转写
+	prs.registerMediaRoutes(router)
+
+	// 请求日志 live tail（NDJSON / SSE）
+	router.GET("/v1/logs/tail", prs.logTailHandler())
+
+	// OpenAI 兼容的用量查询接口
+	prs.registerUsageRoutes(router)
+
+	// 管理 API 与内置 Web 控制台
+	prs.registerAdminRoutes(router)
+
+	// 混沌测试用的内置假上游（调试用，默认关闭）
+	prs.registerChaosRoutes(router)
+
 	// 注册 Lurus-API 相关路由 (认证、配额、订阅)
 	if prs.lurusIntegration != nil {
 		prs.lurusIntegration.RegisterLurusRoutes(router)
@@ -659,6 +891,10 @@ ailurus_paas_providers_total{platform="picoclaw",status="enabled"} %d
 
 func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if prs.rejectIfRelayPaused(c) {
+			return
+		}
+		defer prs.beginRequestProfile(c)()
 		var bodyBytes []byte
 		if c.Request.Body != nil {
 			data, err := io.ReadAll(c.Request.Body)
@@ -670,6 +906,25 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 		}
 
+		// 幂等键：重试时返回已有响应，不再重复调用上游
+		finishIdempotent, handled := prs.beginIdempotentRequest(c, kind, endpoint, bodyBytes)
+		if handled {
+			return
+		}
+		defer finishIdempotent()
+
+		// 请求脚本：先于内容策略执行，脚本改写后的内容同样会被扫描
+		bodyBytes, scriptProvider, blocked := prs.applyRequestScript(c, kind, bodyBytes)
+		if blocked {
+			return
+		}
+
+		// 出站内容策略：在请求体被同步或转发之前扫描密钥与敏感数据
+		bodyBytes, blocked = prs.applyGuardrails(c, kind, gjson.GetBytes(bodyBytes, "model").String(), bodyBytes)
+		if blocked {
+			return
+		}
+
 		// 同步集成：发布用户消息事件
 		if prs.syncIntegration != nil {
 			prs.syncIntegration.OnUserMessage(c, bodyBytes)
@@ -683,6 +938,11 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			fmt.Printf("[WARN] 请求未指定模型名，无法执行模型智能降级\n")
 		}
 
+		// 按应用的代理开关与请求规则（模型、时间窗口、路径、每日花费）拦截
+		if prs.rejectByProxyRules(c, bodyBytes, requestedModel) {
+			return
+		}
+
 		// NEW-API 统一网关模式：直接转发到 new-api
 		if prs.IsNewAPIEnabled() && prs.newAPIURL != "" && prs.newAPIToken != "" {
 			fmt.Printf("[Ailurus PaaS] NEW-API 模式: 转发到 %s (model=%s, stream=%v)\n",
@@ -705,9 +965,19 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 		active := make([]Provider, 0, len(providers))
 		skippedCount := 0
+		var limitErr error
+		var capErr error
+		requiredCaps := detectRequiredCapabilities(bodyBytes)
 		for _, provider := range providers {
 			// 基础过滤：enabled、URL、APIKey
-			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
+			if !provider.Enabled || provider.APIURL == "" || !provider.HasCredentials() {
+				continue
+			}
+
+			// 认证连续失败被自动挂起的 provider，等待重新验证通过后恢复
+			if provider.Suspended {
+				fmt.Printf("[INFO] Provider %s 已因认证失败挂起，已跳过\n", provider.Name)
+				skippedCount++
 				continue
 			}
 
@@ -725,10 +995,34 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				continue
 			}
 
+			// 能力过滤：请求包含图片 / 工具 / JSON 模式 / 推理时跳过不具备该能力的 provider
+			if missing := prs.providerMissingCapabilities(provider, requestedModel, requiredCaps); len(missing) > 0 {
+				fmt.Printf("[INFO] Provider %s 不支持能力 %v，已跳过\n", provider.Name, missing)
+				capErr = &capabilityError{required: requiredCaps}
+				skippedCount++
+				continue
+			}
+
+			// token 上限：超限（且不允许截断）的 provider 跳过
+			if _, err := prs.enforceTokenLimits(kind, provider, bodyBytes); err != nil {
+				fmt.Printf("[INFO] %v，已跳过\n", err)
+				limitErr = err
+				skippedCount++
+				continue
+			}
+
 			active = append(active, provider)
 		}
 
 		if len(active) == 0 {
+			if limitErr != nil {
+				writeTokenLimitError(c, limitErr)
+				return
+			}
+			if capErr != nil {
+				writeCapabilityError(c, capErr)
+				return
+			}
 			if requestedModel != "" {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount),
@@ -739,19 +1033,40 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			return
 		}
 
+		// provider 组：按应用规则或模型路由到组内成员，组内策略决定顺序（取代优先级排序与全局轮询）
+		active, group, groupErr := prs.applyProviderGroup(c, kind, requestedModel, bodyBytes, active)
+		if groupErr != nil {
+			writeProviderGroupError(c, groupErr)
+			return
+		}
+
 		// 按优先级排序（Level 小的优先）
-		sort.SliceStable(active, func(i, j int) bool {
-			levelI := active[i].Level
-			levelJ := active[j].Level
-			// Level 为 0 时视为默认值 1
-			if levelI == 0 {
-				levelI = 1
-			}
-			if levelJ == 0 {
-				levelJ = 1
-			}
-			return levelI < levelJ
-		})
+		if group == nil {
+			sort.SliceStable(active, func(i, j int) bool {
+				levelI := active[i].Level
+				levelJ := active[j].Level
+				// Level 为 0 时视为默认值 1
+				if levelI == 0 {
+					levelI = 1
+				}
+				if levelJ == 0 {
+					levelJ = 1
+				}
+				return levelI < levelJ
+			})
+		}
+		// 上游额度即将耗尽的 provider 移到最后，仅作兜底
+		// 跳过 429/529 冷却中的 provider，避免紧接着再次请求
+		active = prs.applyCooldowns(kind, active)
+		active = prs.deprioritizeRateLimited(kind, active)
+		// 自适应路由：响应质量评分持续偏低的 provider 仅作兜底
+		active = prs.deprioritizeLowQuality(kind, active)
+		// 灰度 provider 只接收配置比例的流量，命中时优先尝试
+		active, canaryHit := prs.applyCanary(kind, active)
+		// 请求脚本指定的 provider 优先尝试
+		active, scriptHit := preferScriptProvider(kind, active, scriptProvider)
+		// 托盘中固定了 provider 时只使用该 provider
+		active = prs.applyPinnedProvider(kind, active)
 
 		fmt.Printf("[INFO] 找到 %d 个可用的 provider（已过滤 %d 个）：", len(active), skippedCount)
 		for _, p := range active {
@@ -763,12 +1078,30 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		}
 		fmt.Println()
 
+		// 兜底 provider（如本地模型）不参与轮询，仅在其他 provider 全部失败后尝试
+		active, fallback := partitionFallbackProviders(active)
+		// 达到花费预算时只使用兜底 provider
+		active = prs.applyBudgetFallback(active, fallback)
+		totalCandidates := len(active) + len(fallback)
+
 		// 根据轮询模式决定起始索引
 		var startIdx int
-		if prs.IsRoundRobinEnabled() {
-			// Round-Robin 模式：使用计数器轮询
-			startIdx = int(atomic.AddUint64(&prs.rrCounter, 1)-1) % len(active)
-			fmt.Printf("[INFO] Round-Robin 模式：从第 %d 个 provider 开始（%s）\n", startIdx+1, active[startIdx].Name)
+		var conversationID string
+		roundRobin := prs.IsRoundRobinEnabled() && group == nil && !canaryHit && !scriptHit
+		if len(active) == 0 {
+			fmt.Printf("[INFO] 仅有兜底 provider 可用，直接使用兜底 provider（%s）\n", fallback[0].Name)
+		} else if roundRobin {
+			// Round-Robin 模式：使用计数器轮询（多副本共享计数器）；配置共享存储时同一会话优先使用上次成功的 provider
+			if prs.sharedState() != nil {
+				conversationID = conversationIDFor(c, bodyBytes)
+			}
+			startIdx = int(prs.nextRoundRobin(kind) % uint64(len(active)))
+			if idx := stickyIndex(active, prs.stickyProvider(kind, conversationID)); idx >= 0 {
+				startIdx = idx
+				fmt.Printf("[INFO] Round-Robin 模式：会话粘滞到 %s\n", active[startIdx].Name)
+			} else {
+				fmt.Printf("[INFO] Round-Robin 模式：从第 %d 个 provider 开始（%s）\n", startIdx+1, active[startIdx].Name)
+			}
 		} else {
 			// 优先级模式：从第一个（优先级最高的）开始
 			startIdx = 0
@@ -778,12 +1111,21 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		query := flattenQuery(c.Request.URL.Query())
 		clientHeaders := cloneHeaders(c.Request.Header)
 
+		// 请求优先级：provider 并发已满时 interactive 先于 batch 获得名额
+		priorityClass := prs.requestPriority(c)
+		defer prs.observePriorityRequest(priorityClass, time.Now())
+
 		var lastErr error
 		attemptCount := 0
 		// 从 startIdx 开始轮询，遍历所有 provider
-		for j := 0; j < len(active); j++ {
-			i := (startIdx + j) % len(active)
-			provider := active[i]
+		for j := 0; j < totalCandidates; j++ {
+			var provider Provider
+			if j < len(active) {
+				provider = active[(startIdx+j)%len(active)]
+			} else {
+				provider = fallback[j-len(active)]
+				fmt.Printf("[INFO]   启用兜底 provider: %s\n", provider.Name)
+			}
 			attemptCount++
 
 			effectiveModel := provider.GetEffectiveModel(requestedModel)
@@ -800,16 +1142,50 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				}
 				currentBodyBytes = modifiedBody
 			}
+			// 补上客户端未指定的默认参数（temperature / top_p / max_tokens / reasoning effort）
+			currentBodyBytes = prs.applyModelDefaults(kind, provider, requestedModel, effectiveModel, currentBodyBytes)
+			// 超出目标模型上下文窗口时按配置压缩提示词
+			currentBodyBytes = prs.compressPromptFor(c, kind, provider, effectiveModel, currentBodyBytes)
+			// 按 provider 的 token 上限截断输入、限制最大输出
+			if limited, err := prs.enforceTokenLimits(kind, provider, currentBodyBytes); err == nil {
+				currentBodyBytes = limited
+			}
+			// 按 provider 的图片限制缩放请求中的图片
+			currentBodyBytes = adaptImagesForProvider(provider, currentBodyBytes)
 
 			fmt.Printf("[INFO]   [%d/%d] Provider: %s | Model: %s\n",
-				j+1, len(active), provider.Name, effectiveModel)
+				j+1, totalCandidates, provider.Name, effectiveModel)
+
+			queueStart := time.Now()
+			releaseSlot, err := prs.acquirePrioritySlot(c.Request.Context(), kind, provider, priorityClass)
+			profileQueueWait(c, queueStart)
+			if err != nil {
+				fmt.Printf("[WARN]   ✗ 跳过: %s | %v\n", provider.Name, err)
+				lastErr = err
+				continue
+			}
 
 			startTime := time.Now()
 			ok, err := prs.forwardRequest(c, kind, provider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
+			// 粘性重试：冷却时间较短时等待后重试同一 provider，保留 prompt cache
+			if !ok {
+				if wait, retry := prs.stickyRetryDelay(kind, provider.Name); retry {
+					fmt.Printf("[INFO]   Provider %s 限流，等待 %.1fs 后重试同一 provider\n", provider.Name, wait.Seconds())
+					if waitWithContext(c.Request.Context(), wait) {
+						attemptCount++
+						ok, err = prs.forwardRequest(c, kind, provider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
+					}
+				}
+			}
 			duration := time.Since(startTime)
+			releaseSlot()
 
 			if ok {
 				fmt.Printf("[INFO]   ✓ 成功: %s | 耗时: %.2fs\n", provider.Name, duration.Seconds())
+				prs.resolvePlatformIncident(kind)
+				if roundRobin && j < len(active) {
+					prs.rememberStickyProvider(kind, conversationID, provider.Name)
+				}
 				return
 			}
 
@@ -820,14 +1196,21 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			fmt.Printf("[WARN]   ✗ 失败: %s | 错误: %s | 耗时: %.2fs\n",
 				provider.Name, errorMsg, duration.Seconds())
 			lastErr = err
+			// 客户端已断开，不再尝试其他 provider
+			if c.Request.Context().Err() != nil {
+				return
+			}
 		}
 
-		message := fmt.Sprintf("所有 %d 个 provider 均失败（共尝试 %d 次）", len(active), attemptCount)
+		summary := fmt.Sprintf("所有 %d 个 provider 均失败（共尝试 %d 次）", totalCandidates, attemptCount)
+		message := summary
 		if lastErr != nil {
 			message = fmt.Sprintf("%s: %s", message, lastErr.Error())
 		}
 		xlog.Error("all is error")
-		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		prs.emitProviderEvent(ProviderEvent{Type: ProviderEventAllFailed, Platform: kind, Reason: message, TraceID: c.Writer.Header().Get("X-Trace-ID")})
+		// 按客户端协议返回标准错误体，状态码沿用最后一个上游错误
+		writeRelayError(c, errorSchemaFor(kind, endpoint), summary, lastErr)
 	}
 }
 
@@ -842,6 +1225,28 @@ func (prs *ProviderRelayService) forwardRequest(
 	isStream bool,
 	model string,
 ) (bool, error) {
+	// 旧版文本补全：只支持 Chat 的 provider 转换请求，并把响应转换回文本补全格式
+	endpoint, bodyBytes, restoreCompletion, err := adaptLegacyCompletion(c, provider, endpoint, bodyBytes, isStream)
+	if err != nil {
+		return false, err
+	}
+	defer restoreCompletion()
+
+	// 协议转换：provider 的 apiFormat 与客户端协议不同时转换请求，并把响应（含流式工具调用）转换回客户端协议
+	endpoint, bodyBytes, restoreProtocol, err := adaptProviderProtocol(c, provider, endpoint, bodyBytes, isStream, model)
+	if err != nil {
+		return false, err
+	}
+	defer restoreProtocol()
+
+	// 推理内容处理：按客户端 / provider / 平台策略移除推理内容或转换为 <thinking> 标签
+	restoreReasoning := prs.applyReasoningPolicy(c, kind, provider, endpoint, bodyBytes, isStream)
+	defer restoreReasoning()
+
+	// 响应规范化：统一 finish_reason / stop_reason 与 2xx 响应中的错误体
+	restoreNormalization := applyResponseNormalization(c, endpoint, isStream)
+	defer restoreNormalization()
+
 	// Google Gemini 特殊处理：使用原生API而不是OpenAI兼容端点
 	isGemini := strings.Contains(strings.ToLower(provider.APIURL), "generativelanguage.googleapis.com")
 
@@ -861,11 +1266,27 @@ func (prs *ProviderRelayService) forwardRequest(
 		}
 		query["key"] = provider.APIKey
 		fmt.Printf("[Ailurus PaaS] Gemini使用原生API: %s\n", targetURL)
+	} else if provider.IsAzure() {
+		// Azure OpenAI：部署名路由 + api-version 查询参数
+		azureURL, azureBody, err := buildAzureRequest(provider, endpoint, model, bodyBytes)
+		if err != nil {
+			return false, err
+		}
+		targetURL = azureURL
+		bodyBytes = azureBody
+		if query == nil {
+			query = make(map[string]string)
+		}
+		query["api-version"] = provider.azureAPIVersion(endpoint)
 	} else {
 		targetURL = joinURL(provider.APIURL, endpoint)
 	}
 
 	headers := cloneMap(clientHeaders)
+	// 超时申请头与成本归属头仅供网关使用，不转发上游
+	deleteHeader(headers, headerRequestTimeout)
+	deleteHeader(headers, headerProject)
+	deleteHeader(headers, headerTags)
 	needsStreamConversion := false
 	actualStream := isStream
 
@@ -899,17 +1320,57 @@ func (prs *ProviderRelayService) forwardRequest(
 		}
 	}
 
+	// provider 固定请求体参数（JSON Merge Patch）
+	if len(provider.ExtraBody) > 0 {
+		patched, err := applyExtraBody(provider, model, bodyBytes)
+		if err != nil {
+			return false, err
+		}
+		bodyBytes = patched
+	}
+
+	// JSON 模式保证：按 provider 配置注入指令；流式 Chat 请求改为非流式，校验后再模拟流式返回
+	jsonMode := detectJSONMode(provider, endpoint, bodyBytes)
+	if jsonMode != nil && !isGemini {
+		prepared, err := prepareJSONModeBody(jsonMode, bodyBytes)
+		if err != nil {
+			return false, err
+		}
+		bodyBytes = prepared
+		if isStream && !jsonMode.responses {
+			if unstreamed, err := disableUpstreamStream(bodyBytes); err == nil {
+				bodyBytes = unstreamed
+				needsStreamConversion = true
+				actualStream = false
+			}
+		}
+	}
+
 	// Authorization header设置
 	if !isGemini {
-		// 其他provider使用Bearer token
-		headers["Authorization"] = fmt.Sprintf("Bearer %s", provider.APIKey)
+		// 其他provider按认证方式设置（API Key 使用 Bearer token，OAuth 使用订阅令牌）
+		if err := prs.applyProviderAuth(kind, provider, headers); err != nil {
+			return false, err
+		}
+		applyUpstreamFormatHeaders(c, provider, headers)
 	}
 	// Gemini使用URL参数，不需要Authorization header
 
+	// provider 自定义请求头模板（如 OpenRouter 的 HTTP-Referer）
+	applyExtraHeaders(provider, model, headers)
+
 	if _, ok := headers["Accept"]; !ok {
 		headers["Accept"] = "application/json"
 	}
 
+	// 中继插件：请求拦截器可改写请求体与请求头，或直接拒绝请求
+	bodyBytes, rejection := prs.runRequestInterceptors(kind, provider.Name, model, endpoint, bodyBytes, headers)
+	if rejection != nil {
+		// 已向客户端返回拒绝结果，不再尝试其他 provider
+		c.JSON(rejection.Status, gin.H{"error": rejection.Message, "type": "plugin_rejected"})
+		return true, nil
+	}
+
 	// Ailurus PaaS 增强日志：自动记录追踪信息
 	traceID := generateTraceID()
 
@@ -918,28 +1379,37 @@ func (prs *ProviderRelayService) forwardRequest(
 		prs.syncIntegration.OnRequestStart(c, kind, model, provider.Name, isStream, traceID)
 	}
 
-	// Body 日志捕获（仅在开关开启时）
-	shouldLogBody := prs.IsBodyLogEnabled()
-	var responseBuffer bytes.Buffer
+	// Body 日志捕获（仅在开关开启且命中采样/过滤策略时）
+	bodyDecision := prs.decideBodyLog(kind, model, requestUserID(c))
+	shouldLogBody := bodyDecision.capture
+	responseBuffer := newBodyCapture(traceID)
+	// 响应质量评分（命中采样时缓存响应，请求成功后异步评分）
+	quality := prs.newQualityCapture()
 
 	requestLog := &ReqeustLog{
-		TraceID:       traceID,
-		RequestID:     c.GetHeader("X-Request-ID"), // 兼容客户端传入的请求 ID
-		Platform:      kind,
-		Provider:      provider.Name,
-		Model:         model,
-		IsStream:      isStream, // 记录客户端的原始流式请求意图
-		UserAgent:     c.GetHeader("User-Agent"),
-		ClientIP:      getClientIP(c),
-		UserID:        c.GetHeader("X-User-ID"), // 支持多租户场景
-		RequestMethod: c.Request.Method,
-		RequestPath:   c.Request.URL.Path,
-	}
+		TraceID:        traceID,
+		RequestID:      c.GetHeader("X-Request-ID"), // 兼容客户端传入的请求 ID
+		ConversationID: conversationIDFor(c, bodyBytes),
+		Platform:       kind,
+		Provider:       provider.Name,
+		Model:          model,
+		IsStream:       isStream, // 记录客户端的原始流式请求意图
+		UserAgent:      c.GetHeader("User-Agent"),
+		ClientIP:       getClientIP(c),
+		UserID:         requestUserID(c), // 支持多租户场景；客户端证书身份优先
+		RequestMethod:  c.Request.Method,
+		RequestPath:    c.Request.URL.Path,
+	}
+	requestLog.Project, requestLog.Tags = prs.resolveAttribution(c)
+	requestLog.APIKeyID = clientKeyID(c)
+	requestLog.AppName = clientFingerprintFor(c, bodyBytes).App
+	requestLog.PromptCompression = c.GetString(ctxKeyPromptCompression)
 
 	// 将 Trace ID 添加到响应头，方便客户端关联日志
 	c.Header("X-Trace-ID", traceID)
 
 	start := time.Now()
+	c.Set(ctxKeyUpstreamStart, start)
 	defer func() {
 		requestLog.DurationSec = time.Since(start).Seconds()
 
@@ -949,8 +1419,11 @@ func (prs *ProviderRelayService) forwardRequest(
 			// 错误消息将在下面的错误处理中填充
 		}
 
-		// 计算价格（在插入数据库前）
-		if prs.pricingService != nil {
+		// 连续认证失败自动挂起
+		prs.trackAuthResult(kind, provider, requestLog.HttpCode)
+
+		// 计算价格（在插入数据库前），本地模型不计费
+		if prs.pricingService != nil && !provider.IsLocal() {
 			costBreakdown := prs.pricingService.CalculateCost(requestLog.Model, modelpricing.UsageSnapshot{
 				InputTokens:       requestLog.InputTokens,
 				OutputTokens:      requestLog.OutputTokens,
@@ -966,60 +1439,47 @@ func (prs *ProviderRelayService) forwardRequest(
 			requestLog.TotalCost = costBreakdown.TotalCost
 		}
 
-		// 发送到写入队列，由单个 goroutine 顺序处理
-		// 使用 select 避免阻塞
-		select {
-		case prs.logWriteQueue <- requestLog:
-			// 成功入队
-		default:
-			// 队列满，丢弃日志并记录警告
-			fmt.Printf("[WARN] 日志队列已满，丢弃日志 (trace_id=%s)\n", requestLog.TraceID)
-		}
+		// 发送到写入队列，由单个 goroutine 批量写入；队列满时丢弃，不阻塞请求
+		enqueueStart := time.Now()
+		prs.enqueueRequestLog(requestLog)
+		profileUpstreamAttempt(c, requestLog, start, time.Since(enqueueStart))
+		recordBatchAttempt(c, requestLog)
+		prs.submitQualitySample(quality, bodyBytes, requestLog)
 
 		// Body 日志：仅在开关开启且有数据时发送
 		fmt.Printf("[DEBUG Body Log] shouldLogBody=%v, bodyBytes=%d, responseBuffer=%d, traceID=%s\n",
 			shouldLogBody, len(bodyBytes), responseBuffer.Len(), traceID)
-		if shouldLogBody && (len(bodyBytes) > 0 || responseBuffer.Len() > 0) {
-			bodyLog := &RequestLogBody{
-				TraceID:       traceID,
-				RequestBody:   string(bodyBytes),
-				ResponseBody:  responseBuffer.String(),
-				BodySizeBytes: int64(len(bodyBytes) + responseBuffer.Len()),
-				CreatedAt:     time.Now(),
-				ExpiresAt:     time.Now().Add(7 * 24 * time.Hour), // 7 天过期
-			}
-			select {
-			case prs.bodyLogQueue <- bodyLog:
-				fmt.Printf("[DEBUG] Body log queued for trace_id=%s\n", traceID)
-			default:
-				fmt.Printf("[WARN] Body log queue full, dropped trace_id=%s\n", traceID)
-			}
+		if shouldLogBody && bodyDecision.keep(requestLog) {
+			prs.enqueueBodyLog(traceID, bodyBytes, responseBuffer)
 		} else {
+			responseBuffer.discard()
 			fmt.Printf("[DEBUG] Body log skipped for trace_id=%s\n", traceID)
 		}
 	}()
 
 	// 创建带超时的 HTTP 客户端
-	// 对于流式响应，超时应该更长，因为响应是增量传输的
-	timeout := 60 * time.Second
-	if isStream {
-		timeout = 300 * time.Second // 流式响应 5 分钟超时
-	}
-
-	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-		},
-	}
+	// 超时优先级：provider 配置 > 全局配置 > 默认值（非流式 60s，流式 5 分钟），
+	// 客户端可通过 X-Request-Timeout 申请更长的总超时
+	timeouts := prs.resolveTimeouts(provider, isStream, c.Request.Header)
+	httpClient := newUpstreamClient(timeouts)
+	// 可续传的流式请求在客户端断开后继续接收响应（最长为 resume window）
+	upstreamCtx, cancelUpstream := withUpstreamDeadline(upstreamParentContext(c, actualStream), timeouts)
+	defer cancelUpstream(nil)
+	defer prs.watchClientDisconnect(c, actualStream, traceID, cancelUpstream)()
 
 	fmt.Printf("[Ailurus PaaS] 发送请求 (trace_id=%s, provider=%s, model=%s, stream=%v, timeout=%v)\n",
-		traceID, provider.Name, model, isStream, timeout)
+		traceID, provider.Name, model, isStream, timeouts.total)
 
-	// 创建 HTTP 请求
-	httpReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(bodyBytes))
+	// 创建 HTTP 请求（客户端压缩上传的大请求体重新压缩后转发）
+	upstreamBody, upstreamEncoding := bodyBytes, ""
+	if !isGemini {
+		upstreamBody, upstreamEncoding = compressForUpstream(c, bodyBytes)
+	}
+	if upstreamEncoding != "" {
+		headers["Content-Encoding"] = upstreamEncoding
+	}
+	requestLog.RequestBytes = int64(len(upstreamBody))
+	httpReq, err := http.NewRequestWithContext(upstreamCtx, "POST", targetURL, bytes.NewReader(upstreamBody))
 	if err != nil {
 		requestLog.HttpCode = 0
 		requestLog.ErrorType = "network_error"
@@ -1046,15 +1506,40 @@ func (prs *ProviderRelayService) forwardRequest(
 	resp, err := httpClient.Do(httpReq)
 	if err != nil {
 		requestLog.HttpCode = 0
-		requestLog.ErrorType = "network_error"
+		requestLog.ErrorType = classifyRequestError(upstreamCtx, err)
 		requestLog.ErrorMessage = err.Error()
-		fmt.Printf("[Ailurus PaaS] 请求失败 (trace_id=%s): %v\n", traceID, err)
+		fmt.Printf("[Ailurus PaaS] 请求失败 (trace_id=%s, error_type=%s): %v\n", traceID, requestLog.ErrorType, err)
 		return false, err
 	}
+	requestLog.TTFBSec = time.Since(start).Seconds()
+	resp.Body = newIdleTimeoutReader(resp.Body, timeouts.read, cancelUpstream)
+	countResponseBytes(resp, requestLog)
 	defer resp.Body.Close()
 
+	// JSON 模式保证：输出不合法时本地修复，无法修复则重新请求上游
+	if jsonMode != nil && !isGemini && !actualStream && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		resend := func() (*http.Response, error) {
+			retryReq := httpReq.Clone(upstreamCtx)
+			retryReq.Body = io.NopCloser(bytes.NewReader(upstreamBody))
+			requestLog.RequestBytes += int64(len(upstreamBody))
+			retryResp, err := httpClient.Do(retryReq)
+			countResponseBytes(retryResp, requestLog)
+			return retryResp, err
+		}
+		resp, requestLog.JSONRepair = enforceJSONResponse(jsonMode, resp, resend)
+		if requestLog.JSONRepair != "" {
+			fmt.Printf("[JSONMode] trace_id=%s 结果: %s\n", traceID, requestLog.JSONRepair)
+		}
+	}
+	// 中继插件：响应拦截器可改写成功的非流式响应
+	if !actualStream && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		resp = prs.runResponseInterceptors(kind, provider.Name, model, resp)
+	}
+
 	status := resp.StatusCode
 	requestLog.HttpCode = status
+	rateLimit, hasRateLimit := prs.recordRateLimit(kind, provider.Name, status, resp.Header)
+	prs.updateCooldown(kind, provider.Name, status, resp.Header)
 
 	fmt.Printf("[Ailurus PaaS] 收到响应 (trace_id=%s, status=%d)\n", traceID, status)
 
@@ -1065,6 +1550,10 @@ func (prs *ProviderRelayService) forwardRequest(
 				c.Writer.Header().Add(key, value)
 			}
 		}
+		// 统一输出 x-ratelimit-* 头，供客户端自我限速
+		if hasRateLimit {
+			writeRateLimitHeaders(c.Writer.Header(), rateLimit)
+		}
 		c.Writer.WriteHeader(status)
 
 		fmt.Printf("[Ailurus PaaS] 开始流式传输 (trace_id=%s)\n", traceID)
@@ -1088,14 +1577,16 @@ func (prs *ProviderRelayService) forwardRequest(
 					// 写入客户端
 					if _, writeErr := c.Writer.Write(processedData); writeErr != nil {
 						fmt.Printf("[Ailurus PaaS] 写入客户端失败 (trace_id=%s): %v\n", traceID, writeErr)
+						c.Set(ctxKeyStreamIncomplete, true)
 						return false, writeErr
 					}
 					c.Writer.(http.Flusher).Flush()
 
-					// Body 日志：捕获响应数据（限制 10MB 防止内存溢出）
-					if shouldLogBody && responseBuffer.Len() < 10*1024*1024 {
+					// Body 日志：捕获响应数据（超过阈值自动落盘）
+					if shouldLogBody {
 						responseBuffer.Write(processedData)
 					}
+					quality.write(processedData)
 
 					if !shouldContinue {
 						break
@@ -1105,7 +1596,10 @@ func (prs *ProviderRelayService) forwardRequest(
 					break
 				}
 				if readErr != nil {
-					fmt.Printf("[Ailurus PaaS] 读取响应失败 (trace_id=%s): %v\n", traceID, readErr)
+					requestLog.ErrorType = classifyRequestError(upstreamCtx, readErr)
+					requestLog.ErrorMessage = readErr.Error()
+					fmt.Printf("[Ailurus PaaS] 读取响应失败 (trace_id=%s, error_type=%s): %v\n", traceID, requestLog.ErrorType, readErr)
+					c.Set(ctxKeyStreamIncomplete, true)
 					return false, readErr
 				}
 			}
@@ -1113,7 +1607,9 @@ func (prs *ProviderRelayService) forwardRequest(
 			// Gemini 特殊处理：读取非流式响应，转换格式，提取usage，然后模拟流式返回
 			respData, readErr := io.ReadAll(resp.Body)
 			if readErr != nil {
-				fmt.Printf("[Ailurus PaaS] 读取响应失败 (trace_id=%s): %v\n", traceID, readErr)
+				requestLog.ErrorType = classifyRequestError(upstreamCtx, readErr)
+				requestLog.ErrorMessage = readErr.Error()
+				fmt.Printf("[Ailurus PaaS] 读取响应失败 (trace_id=%s, error_type=%s): %v\n", traceID, requestLog.ErrorType, readErr)
 				return false, readErr
 			}
 
@@ -1132,6 +1628,8 @@ func (prs *ProviderRelayService) forwardRequest(
 				// 从Gemini响应提取token统计
 				requestLog.InputTokens = geminiResp.UsageMetadata.PromptTokenCount
 				requestLog.OutputTokens = geminiResp.UsageMetadata.CandidatesTokenCount
+				requestLog.OutputTokens += geminiResp.UsageMetadata.ThoughtsTokenCount
+				requestLog.ReasoningTokens = geminiResp.UsageMetadata.ThoughtsTokenCount
 				fmt.Printf("[DEBUG] Gemini原生响应token统计 (trace_id=%s): in=%d, out=%d\n",
 					traceID, requestLog.InputTokens, requestLog.OutputTokens)
 
@@ -1152,17 +1650,15 @@ func (prs *ProviderRelayService) forwardRequest(
 				}
 			} else {
 				// 非Gemini，使用原有解析逻辑
-				parserFn := ClaudeCodeParseTokenUsageFromResponse
-				if kind == "codex" {
-					parserFn = CodexParseTokenUsageFromResponse
-				}
+				parserFn := usageParserFor(c, kind)
 				parserFn(respStr, requestLog)
 			}
 
 			// 捕获原始响应
-			if shouldLogBody && len(respData) <= 10*1024*1024 {
+			if shouldLogBody {
 				responseBuffer.Write(respData)
 			}
+			quality.write(respData)
 
 			// 将响应转换为SSE流式格式返回给客户端
 			if err := prs.simulateStreamResponse(c, respStr, traceID); err != nil {
@@ -1173,7 +1669,9 @@ func (prs *ProviderRelayService) forwardRequest(
 			// 非流式响应
 			respData, readErr := io.ReadAll(resp.Body)
 			if readErr != nil {
-				fmt.Printf("[Ailurus PaaS] 读取响应失败 (trace_id=%s): %v\n", traceID, readErr)
+				requestLog.ErrorType = classifyRequestError(upstreamCtx, readErr)
+				requestLog.ErrorMessage = readErr.Error()
+				fmt.Printf("[Ailurus PaaS] 读取响应失败 (trace_id=%s, error_type=%s): %v\n", traceID, requestLog.ErrorType, readErr)
 				return false, readErr
 			}
 
@@ -1211,6 +1709,8 @@ func (prs *ProviderRelayService) forwardRequest(
 				// 从 Gemini 响应提取 token 统计
 				requestLog.InputTokens = geminiResp.UsageMetadata.PromptTokenCount
 				requestLog.OutputTokens = geminiResp.UsageMetadata.CandidatesTokenCount
+				requestLog.OutputTokens += geminiResp.UsageMetadata.ThoughtsTokenCount
+				requestLog.ReasoningTokens = geminiResp.UsageMetadata.ThoughtsTokenCount
 				fmt.Printf("[DEBUG] Gemini原生响应token统计 (trace_id=%s): in=%d, out=%d\n",
 					traceID, requestLog.InputTokens, requestLog.OutputTokens)
 
@@ -1233,24 +1733,18 @@ func (prs *ProviderRelayService) forwardRequest(
 				}
 			} else {
 				// 非 Gemini，解析原始响应的 usage
-				parserFn := ClaudeCodeParseTokenUsageFromResponse
-				if kind == "codex" {
-					parserFn = CodexParseTokenUsageFromResponse
-				}
+				parserFn := usageParserFor(c, kind)
 				parserFn(respStr, requestLog)
 				fmt.Printf("[DEBUG] 非流式响应 token 统计 (trace_id=%s): in=%d, out=%d\n",
 					traceID, requestLog.InputTokens, requestLog.OutputTokens)
 				finalData = respData
 			}
 
-			// 捕获响应数据（限制 10MB）
+			// 捕获响应数据（超过阈值自动落盘）
 			if shouldLogBody {
-				if len(respData) <= 10*1024*1024 {
-					responseBuffer.Write(respData) // 记录原始响应
-				} else {
-					responseBuffer.Write(respData[:10*1024*1024])
-				}
+				responseBuffer.Write(respData) // 记录原始响应
 			}
+			quality.write(respData)
 
 			// 写入客户端（转换后的数据）
 			if _, writeErr := c.Writer.Write(finalData); writeErr != nil {
@@ -1299,7 +1793,7 @@ func (prs *ProviderRelayService) forwardRequest(
 		)
 	}
 
-	return false, fmt.Errorf("upstream status %d: %s", status, string(respBody))
+	return false, &upstreamStatusError{Status: status, Body: respBody}
 }
 
 func cloneHeaders(header http.Header) map[string]string {
@@ -1414,6 +1908,7 @@ func ensureRequestLogTable() error {
 	return ensureRequestLogTableWithDB(db)
 }
 
+// ensureRequestLogTableWithDB 将数据库表结构迁移到最新版本（迁移列表见 schema_migrations.go）
 func ensureRequestLogTableWithDB(db *sql.DB) error {
 	if _, err := db.Exec("PRAGMA busy_timeout=5000"); err != nil {
 		return err
@@ -1422,6 +1917,18 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 		return err
 	}
 
+	report, err := MigrateSchema(db, MigrateOptions{})
+	if err != nil {
+		return err
+	}
+	if len(report.Steps) > 0 {
+		fmt.Printf("[Migration] 已应用 %d 个表结构迁移，当前版本 %d\n", len(report.Steps), report.Version)
+	}
+	return nil
+}
+
+// migrateRequestLogBaseline 迁移 1：request_log / request_log_body 及其补列和索引（可重复执行，兼容旧库）
+func migrateRequestLogBaseline(db *sql.DB) error {
 	const createTableSQL = `CREATE TABLE IF NOT EXISTS request_log (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		trace_id TEXT,
@@ -1461,6 +1968,11 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 	if err := ensureRequestLogColumn(db, "duration_sec", "REAL DEFAULT 0"); err != nil {
 		return err
 	}
+	for _, column := range []string{"ttfb_sec", "ttft_sec", "tokens_per_sec"} {
+		if err := ensureRequestLogColumn(db, column, "REAL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
 
 	// Ailurus PaaS 增强字段 - 追踪和监控
 	if err := ensureRequestLogColumn(db, "trace_id", "TEXT"); err != nil {
@@ -1469,6 +1981,21 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 	if err := ensureRequestLogColumn(db, "request_id", "TEXT"); err != nil {
 		return err
 	}
+	if err := ensureRequestLogColumn(db, "conversation_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "project", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "tags", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "api_key_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "app_name", "TEXT"); err != nil {
+		return err
+	}
 	if err := ensureRequestLogColumn(db, "user_agent", "TEXT"); err != nil {
 		return err
 	}
@@ -1493,6 +2020,20 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 	if err := ensureRequestLogColumn(db, "provider_error_code", "TEXT"); err != nil {
 		return err
 	}
+	// JSON 模式保证的处理结果（repaired / retried:N / failed）
+	if err := ensureRequestLogColumn(db, "json_repair", "TEXT"); err != nil {
+		return err
+	}
+	// 超出上下文窗口时的提示词压缩记录
+	if err := ensureRequestLogColumn(db, "prompt_compression", "TEXT"); err != nil {
+		return err
+	}
+	// 上游传输字节数（与 Body 日志开关无关）
+	for _, column := range []string{"request_bytes", "response_bytes"} {
+		if err := ensureRequestLogColumn(db, column, "INTEGER DEFAULT 0"); err != nil {
+			return err
+		}
+	}
 
 	// 价格字段 - 用于性能优化，避免重复计算
 	if err := ensureRequestLogColumn(db, "input_cost", "REAL DEFAULT 0"); err != nil {
@@ -1525,6 +2066,9 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_created_at ON request_log(created_at)",
 		"CREATE INDEX IF NOT EXISTS idx_http_code ON request_log(http_code)",
 		"CREATE INDEX IF NOT EXISTS idx_user_id ON request_log(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_conversation_id ON request_log(conversation_id)",
+		"CREATE INDEX IF NOT EXISTS idx_project_created_at ON request_log(project, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_app_name_created_at ON request_log(app_name, created_at)",
 		// 复合索引优化聚合查询（provider/platform/model + created_at）
 		"CREATE INDEX IF NOT EXISTS idx_provider_created_at ON request_log(provider, created_at)",
 		"CREATE INDEX IF NOT EXISTS idx_platform_created_at ON request_log(platform, created_at)",
@@ -1550,6 +2094,16 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 		return err
 	}
 
+	if err := ensureBodyLogColumn(db, "response_body_path", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureBodyLogColumn(db, "truncated", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureBodyBlobTables(db); err != nil {
+		return err
+	}
+
 	// 创建 body 表索引
 	bodyIndexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_body_trace_id ON request_log_body(trace_id)",
@@ -1568,11 +2122,8 @@ func ReqeustLogHook(c *gin.Context, kind string, usage *ReqeustLog) func(data []
 	return func(data []byte) (bool, []byte) {
 		payload := strings.TrimSpace(string(data))
 
-		parserFn := ClaudeCodeParseTokenUsageFromResponse
-		if kind == "codex" {
-			parserFn = CodexParseTokenUsageFromResponse
-		}
-		parseEventPayload(payload, parserFn, usage)
+		parseEventPayload(payload, usageParserFor(c, kind), usage)
+		markFirstToken(c, usage, payload)
 
 		return true, data
 	}
@@ -1590,9 +2141,14 @@ func parseEventPayload(payload string, parser func(string, *ReqeustLog), usage *
 
 type ReqeustLog struct {
 	ID                int64   `json:"id"`
-	TraceID           string  `json:"trace_id"`   // 全局追踪 ID (UUID)
-	RequestID         string  `json:"request_id"` // 客户端请求 ID
-	Platform          string  `json:"platform"`   // claude code or codex
+	TraceID           string  `json:"trace_id"`        // 全局追踪 ID (UUID)
+	RequestID         string  `json:"request_id"`      // 客户端请求 ID
+	ConversationID    string  `json:"conversation_id"` // 会话 ID（请求头 / Claude Code 会话 UUID / 内容指纹）
+	Project           string  `json:"project"`         // 成本归属项目（X-CS-Project 或 Key 默认值）
+	Tags              string  `json:"tags"`            // 成本归属标签，逗号分隔
+	APIKeyID          string  `json:"api_key_id"`      // 客户端 Key 的哈希标识
+	AppName           string  `json:"app_name"`        // 调用方应用（客户端指纹识别，如 claude / cursor / script）
+	Platform          string  `json:"platform"`        // claude code or codex
 	Model             string  `json:"model"`
 	Provider          string  `json:"provider"` // provider name
 	HttpCode          int     `json:"http_code"`
@@ -1603,6 +2159,9 @@ type ReqeustLog struct {
 	ReasoningTokens   int     `json:"reasoning_tokens"`
 	IsStream          bool    `json:"is_stream"`
 	DurationSec       float64 `json:"duration_sec"`
+	TTFBSec           float64 `json:"ttfb_sec"`            // 上游响应头到达时间
+	TTFTSec           float64 `json:"ttft_sec"`            // 首个输出 token 到达时间（仅流式）
+	TokensPerSec      float64 `json:"tokens_per_sec"`      // 首 token 之后的输出吞吐（仅流式）
 	UserAgent         string  `json:"user_agent"`          // 用户代理（识别 TUI/GUI 客户端）
 	ClientIP          string  `json:"client_ip"`           // 客户端 IP
 	UserID            string  `json:"user_id"`             // 用户标识（多租户）
@@ -1611,6 +2170,10 @@ type ReqeustLog struct {
 	ErrorType         string  `json:"error_type"`          // 错误类型（network/auth/rate_limit/server/etc）
 	ErrorMessage      string  `json:"error_message"`       // 错误详细信息
 	ProviderErrorCode string  `json:"provider_error_code"` // 供应商错误码
+	JSONRepair        string  `json:"json_repair"`         // JSON 模式保证：repaired / retried:N / failed
+	PromptCompression string  `json:"prompt_compression"`  // 提示词压缩：策略与压缩前后的估算 token 数
+	RequestBytes      int64   `json:"request_bytes"`       // 发送给上游的请求体字节数
+	ResponseBytes     int64   `json:"response_bytes"`      // 从上游读取的响应体字节数，原子累加
 	CreatedAt         string  `json:"created_at"`
 	InputCost         float64 `json:"input_cost"`
 	OutputCost        float64 `json:"output_cost"`
@@ -1631,6 +2194,10 @@ type RequestLogBody struct {
 	BodySizeBytes int64     `json:"body_size_bytes"`
 	CreatedAt     time.Time `json:"created_at"`
 	ExpiresAt     time.Time `json:"expires_at"`
+	// 大响应落盘后的文件路径，ResponseBody 仅保留开头预览
+	ResponseBodyPath string `json:"response_body_path,omitempty"`
+	// 超过落盘上限被截断
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // claude code usage parser
@@ -1642,6 +2209,16 @@ func ClaudeCodeParseTokenUsageFromResponse(data string, usage *ReqeustLog) {
 
 	usage.InputTokens += int(gjson.Get(data, "usage.input_tokens").Int())
 	usage.OutputTokens += int(gjson.Get(data, "usage.output_tokens").Int())
+
+	// Anthropic 的思考 token 已计入 output_tokens 但不单独返回，按思考内容估算
+	if gjson.Get(data, "delta.type").String() == "thinking_delta" {
+		usage.ReasoningTokens += estimateTextTokens(gjson.Get(data, "delta.thinking").String())
+	}
+	for _, block := range gjson.Get(data, "content").Array() {
+		if block.Get("type").String() == "thinking" {
+			usage.ReasoningTokens += estimateTextTokens(block.Get("thinking").String())
+		}
+	}
 }
 
 // codex usage parser - 支持多种格式
@@ -1670,6 +2247,10 @@ func CodexParseTokenUsageFromResponse(data string, usage *ReqeustLog) {
 	usage.InputTokens += int(gjson.Get(data, "usageMetadata.promptTokenCount").Int())
 	usage.OutputTokens += int(gjson.Get(data, "usageMetadata.candidatesTokenCount").Int())
 	usage.CacheReadTokens += int(gjson.Get(data, "usageMetadata.cachedContentTokenCount").Int())
+	// Gemini 的思考 token 不计入 candidatesTokenCount，但按输出计费
+	thoughts := int(gjson.Get(data, "usageMetadata.thoughtsTokenCount").Int())
+	usage.OutputTokens += thoughts
+	usage.ReasoningTokens += thoughts
 
 	// DeepSeek 推理 tokens（在 completion_tokens_details 中）
 	usage.ReasoningTokens += int(gjson.Get(data, "usage.completion_tokens_details.reasoning_tokens").Int())
@@ -1792,6 +2373,10 @@ func (prs *ProviderRelayService) simulateStreamResponse(c *gin.Context, respStr
 // 支持 /v1beta/models/{model}:generateContent 和 /v1beta/models/{model}:streamGenerateContent
 func (prs *ProviderRelayService) geminiNativeHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if prs.rejectIfRelayPaused(c) {
+			return
+		}
+		defer prs.beginRequestProfile(c)()
 		// 从 URL 路径提取模型名和操作（如 gemini-2.5-pro:generateContent）
 		modelAction := strings.TrimPrefix(c.Param("modelAction"), "/")
 
@@ -1832,6 +2417,25 @@ func (prs *ProviderRelayService) geminiNativeHandler() gin.HandlerFunc {
 			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 		}
 
+		// 幂等键
+		finishIdempotent, handled := prs.beginIdempotentRequest(c, "gemini-cli", modelAction, bodyBytes)
+		if handled {
+			return
+		}
+		defer finishIdempotent()
+
+		// 请求脚本
+		bodyBytes, scriptProvider, blocked := prs.applyRequestScript(c, "gemini-cli", bodyBytes)
+		if blocked {
+			return
+		}
+
+		// 出站内容策略
+		bodyBytes, blocked = prs.applyGuardrails(c, "gemini-cli", model, bodyBytes)
+		if blocked {
+			return
+		}
+
 		// NEW-API 统一网关模式：转换格式并转发到 new-api
 		if prs.IsNewAPIEnabled() && prs.newAPIURL != "" && prs.newAPIToken != "" {
 			fmt.Printf("[Gemini Native] NEW-API 模式: 转发到 %s (model=%s, stream=%v)\n",
@@ -1858,11 +2462,19 @@ func (prs *ProviderRelayService) geminiNativeHandler() gin.HandlerFunc {
 		// 过滤出支持该模型的 active providers
 		active := make([]Provider, 0, len(providers))
 		skippedCount := 0
+		var limitErr error
+		var capErr error
+		requiredCaps := detectRequiredCapabilities(bodyBytes)
 		for _, provider := range providers {
 			fmt.Printf("[DEBUG] 检查 provider: %s (enabled=%v)\n", provider.Name, provider.Enabled)
-			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
+			if !provider.Enabled || provider.APIURL == "" || !provider.HasCredentials() {
 				fmt.Printf("[DEBUG] Provider %s 被跳过: enabled=%v, hasURL=%v, hasKey=%v\n",
-					provider.Name, provider.Enabled, provider.APIURL != "", provider.APIKey != "")
+					provider.Name, provider.Enabled, provider.APIURL != "", provider.HasCredentials())
+				continue
+			}
+			if provider.Suspended {
+				fmt.Printf("[DEBUG] Provider %s 已因认证失败挂起，已跳过\n", provider.Name)
+				skippedCount++
 				continue
 			}
 			if errs := provider.ValidateConfiguration(); len(errs) > 0 {
@@ -1877,18 +2489,63 @@ func (prs *ProviderRelayService) geminiNativeHandler() gin.HandlerFunc {
 				skippedCount++
 				continue
 			}
+			if missing := prs.providerMissingCapabilities(provider, model, requiredCaps); len(missing) > 0 {
+				fmt.Printf("[INFO] Provider %s 不支持能力 %v，已跳过\n", provider.Name, missing)
+				capErr = &capabilityError{required: requiredCaps}
+				skippedCount++
+				continue
+			}
+			if _, err := prs.enforceTokenLimits("gemini-cli", provider, bodyBytes); err != nil {
+				fmt.Printf("[INFO] %v，已跳过\n", err)
+				limitErr = err
+				skippedCount++
+				continue
+			}
 			active = append(active, provider)
 		}
 
 		if len(active) == 0 {
+			if limitErr != nil {
+				writeTokenLimitError(c, limitErr)
+				return
+			}
+			if capErr != nil {
+				writeCapabilityError(c, capErr)
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'", model),
 			})
 			return
 		}
 
-		// 使用第一个匹配的 provider
+		// provider 组内按组策略选择
+		active, _, groupErr := prs.applyProviderGroup(c, "gemini-cli", model, bodyBytes, active)
+		if groupErr != nil {
+			writeProviderGroupError(c, groupErr)
+			return
+		}
+
+		// 使用第一个匹配的 provider（灰度按比例分流，脚本指定的优先，已固定时使用固定的 provider）
+		active, _ = prs.applyCanary("gemini-cli", active)
+		active, _ = preferScriptProvider("gemini-cli", active, scriptProvider)
+		active = prs.applyPinnedProvider("gemini-cli", active)
 		provider := active[0]
+		priorityClass := prs.requestPriority(c)
+		defer prs.observePriorityRequest(priorityClass, time.Now())
+		queueStart := time.Now()
+		releaseSlot, err := prs.acquirePrioritySlot(c.Request.Context(), "gemini-cli", provider, priorityClass)
+		profileQueueWait(c, queueStart)
+		if err != nil {
+			writeRelayError(c, errorSchemaGoogle, "request failed", err)
+			return
+		}
+		defer releaseSlot()
+		bodyBytes = prs.applyModelDefaults("gemini-cli", provider, model, provider.ModelMapping[model], bodyBytes)
+		if limited, err := prs.enforceTokenLimits("gemini-cli", provider, bodyBytes); err == nil {
+			bodyBytes = limited
+		}
+		bodyBytes = adaptImagesForProvider(provider, bodyBytes)
 
 		// 应用模型映射
 		mappedModel := model
@@ -1900,6 +2557,7 @@ func (prs *ProviderRelayService) geminiNativeHandler() gin.HandlerFunc {
 		}
 
 		fmt.Printf("[Gemini Native] 使用 provider: %s (model=%s)\n", provider.Name, mappedModel)
+		bodyBytes = prs.compressPromptFor(c, "gemini-cli", provider, mappedModel, bodyBytes)
 
 		// 构建目标 URL（Gemini 原生格式）
 		action := "generateContent"
@@ -1931,7 +2589,7 @@ func (prs *ProviderRelayService) geminiNativeHandler() gin.HandlerFunc {
 
 			if resp.StatusCode != 200 {
 				body, _ := io.ReadAll(resp.Body)
-				c.JSON(resp.StatusCode, gin.H{"error": string(body)})
+				c.JSON(resp.StatusCode, normalizedErrorBody(errorSchemaGoogle, parseUpstreamError(resp.StatusCode, body)))
 				return
 			}
 
@@ -1984,7 +2642,7 @@ func (prs *ProviderRelayService) geminiNativeHandler() gin.HandlerFunc {
 		)
 
 		if !success && err != nil {
-			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("request failed: %v", err)})
+			writeRelayError(c, errorSchemaGoogle, "request failed", err)
 			return
 		}
 	}
@@ -2026,24 +2684,32 @@ func (prs *ProviderRelayService) forwardToNewAPI(
 
 	// 初始化请求日志
 	requestLog := &ReqeustLog{
-		TraceID:       traceID,
-		RequestID:     c.GetHeader("X-Request-ID"),
-		Platform:      kind,
-		Provider:      "new-api", // 标记为 new-api 统一网关
-		Model:         model,
-		IsStream:      isStream,
-		UserAgent:     c.GetHeader("User-Agent"),
-		ClientIP:      getClientIP(c),
-		UserID:        c.GetHeader("X-User-ID"),
-		RequestMethod: c.Request.Method,
-		RequestPath:   c.Request.URL.Path,
-	}
+		TraceID:        traceID,
+		RequestID:      c.GetHeader("X-Request-ID"),
+		ConversationID: conversationIDFor(c, bodyBytes),
+		Platform:       kind,
+		Provider:       "new-api", // 标记为 new-api 统一网关
+		Model:          model,
+		IsStream:       isStream,
+		UserAgent:      c.GetHeader("User-Agent"),
+		ClientIP:       getClientIP(c),
+		UserID:         requestUserID(c),
+		RequestMethod:  c.Request.Method,
+		RequestPath:    c.Request.URL.Path,
+	}
+	requestLog.Project, requestLog.Tags = prs.resolveAttribution(c)
+	requestLog.APIKeyID = clientKeyID(c)
+	requestLog.AppName = clientFingerprintFor(c, bodyBytes).App
 
 	// Body 日志捕获
-	shouldLogBody := prs.IsBodyLogEnabled()
-	var responseBuffer bytes.Buffer
+	bodyDecision := prs.decideBodyLog(requestLog.Platform, model, requestLog.UserID)
+	shouldLogBody := bodyDecision.capture
+	responseBuffer := newBodyCapture(traceID)
+	// 响应质量评分（命中采样时缓存响应，请求成功后异步评分）
+	quality := prs.newQualityCapture()
 
 	start := time.Now()
+	c.Set(ctxKeyUpstreamStart, start)
 	defer func() {
 		requestLog.DurationSec = time.Since(start).Seconds()
 
@@ -2065,50 +2731,33 @@ func (prs *ProviderRelayService) forwardToNewAPI(
 		}
 
 		// 发送到写入队列
-		select {
-		case prs.logWriteQueue <- requestLog:
-		default:
-			fmt.Printf("[WARN] 日志队列已满，丢弃日志 (trace_id=%s)\n", requestLog.TraceID)
-		}
+		enqueueStart := time.Now()
+		prs.enqueueRequestLog(requestLog)
+		profileUpstreamAttempt(c, requestLog, start, time.Since(enqueueStart))
+		recordBatchAttempt(c, requestLog)
+		prs.submitQualitySample(quality, bodyBytes, requestLog)
 
 		// Body 日志
-		if shouldLogBody && (len(bodyBytes) > 0 || responseBuffer.Len() > 0) {
-			bodyLog := &RequestLogBody{
-				TraceID:       traceID,
-				RequestBody:   string(bodyBytes),
-				ResponseBody:  responseBuffer.String(),
-				BodySizeBytes: int64(len(bodyBytes) + responseBuffer.Len()),
-				CreatedAt:     time.Now(),
-				ExpiresAt:     time.Now().Add(7 * 24 * time.Hour),
-			}
-			select {
-			case prs.bodyLogQueue <- bodyLog:
-			default:
-				fmt.Printf("[WARN] Body log queue full, dropped trace_id=%s\n", traceID)
-			}
+		if shouldLogBody && bodyDecision.keep(requestLog) {
+			prs.enqueueBodyLog(traceID, bodyBytes, responseBuffer)
+		} else {
+			responseBuffer.discard()
 		}
 	}()
 
 	// 创建 HTTP 客户端
-	timeout := 60 * time.Second
-	if isStream {
-		timeout = 300 * time.Second
-	}
-
-	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-		},
-	}
+	// NEW-API 网关使用全局超时配置
+	timeouts := prs.resolveTimeouts(Provider{}, isStream, c.Request.Header)
+	httpClient := newUpstreamClient(timeouts)
+	upstreamCtx, cancelUpstream := withUpstreamDeadline(c.Request.Context(), timeouts)
+	defer cancelUpstream(nil)
 
 	fmt.Printf("[Ailurus PaaS] NEW-API 请求 (trace_id=%s, url=%s, model=%s, stream=%v)\n",
 		traceID, targetURL, model, isStream)
 
 	// 创建请求
-	httpReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(bodyBytes))
+	requestLog.RequestBytes = int64(len(bodyBytes))
+	httpReq, err := http.NewRequestWithContext(upstreamCtx, "POST", targetURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		requestLog.HttpCode = 0
 		requestLog.ErrorType = "network_error"
@@ -2125,7 +2774,7 @@ func (prs *ProviderRelayService) forwardToNewAPI(
 	if ua := c.GetHeader("User-Agent"); ua != "" {
 		httpReq.Header.Set("X-Original-User-Agent", ua)
 	}
-	if userID := c.GetHeader("X-User-ID"); userID != "" {
+	if userID := requestUserID(c); userID != "" {
 		httpReq.Header.Set("X-User-ID", userID)
 	}
 
@@ -2133,11 +2782,13 @@ func (prs *ProviderRelayService) forwardToNewAPI(
 	resp, err := httpClient.Do(httpReq)
 	if err != nil {
 		requestLog.HttpCode = 0
-		requestLog.ErrorType = "network_error"
+		requestLog.ErrorType = classifyRequestError(upstreamCtx, err)
 		requestLog.ErrorMessage = err.Error()
 		fmt.Printf("[Ailurus PaaS] NEW-API 请求失败 (trace_id=%s): %v\n", traceID, err)
 		return false, err
 	}
+	requestLog.TTFBSec = time.Since(start).Seconds()
+	countResponseBytes(resp, requestLog)
 	defer resp.Body.Close()
 
 	status := resp.StatusCode
@@ -2175,9 +2826,10 @@ func (prs *ProviderRelayService) forwardToNewAPI(
 					}
 					c.Writer.(http.Flusher).Flush()
 
-					if shouldLogBody && responseBuffer.Len() < 10*1024*1024 {
+					if shouldLogBody {
 						responseBuffer.Write(processedData)
 					}
+					quality.write(processedData)
 
 					if !shouldContinue {
 						break
@@ -2206,9 +2858,10 @@ func (prs *ProviderRelayService) forwardToNewAPI(
 			parserFn(respStr, requestLog)
 
 			// 捕获响应
-			if shouldLogBody && len(respData) <= 10*1024*1024 {
+			if shouldLogBody {
 				responseBuffer.Write(respData)
 			}
+			quality.write(respData)
 
 			// 写入客户端
 			if _, writeErr := c.Writer.Write(respData); writeErr != nil {
@@ -2495,22 +3148,29 @@ func (prs *ProviderRelayService) forwardGeminiToNewAPI(
 
 	// 初始化请求日志
 	requestLog := &ReqeustLog{
-		TraceID:       traceID,
-		RequestID:     c.GetHeader("X-Request-ID"),
-		Platform:      "gemini-cli",
-		Provider:      "new-api",
-		Model:         model,
-		IsStream:      isStream,
-		UserAgent:     c.GetHeader("User-Agent"),
-		ClientIP:      getClientIP(c),
-		UserID:        c.GetHeader("X-User-ID"),
-		RequestMethod: c.Request.Method,
-		RequestPath:   c.Request.URL.Path,
-	}
+		TraceID:        traceID,
+		RequestID:      c.GetHeader("X-Request-ID"),
+		ConversationID: conversationIDFor(c, bodyBytes),
+		Platform:       "gemini-cli",
+		Provider:       "new-api",
+		Model:          model,
+		IsStream:       isStream,
+		UserAgent:      c.GetHeader("User-Agent"),
+		ClientIP:       getClientIP(c),
+		UserID:         requestUserID(c),
+		RequestMethod:  c.Request.Method,
+		RequestPath:    c.Request.URL.Path,
+	}
+	requestLog.Project, requestLog.Tags = prs.resolveAttribution(c)
+	requestLog.APIKeyID = clientKeyID(c)
+	requestLog.AppName = clientFingerprintFor(c, bodyBytes).App
 
 	// Body 日志捕获
-	shouldLogBody := prs.IsBodyLogEnabled()
-	var responseBuffer bytes.Buffer
+	bodyDecision := prs.decideBodyLog(requestLog.Platform, model, requestLog.UserID)
+	shouldLogBody := bodyDecision.capture
+	responseBuffer := newBodyCapture(traceID)
+	// 响应质量评分（命中采样时缓存响应，请求成功后异步评分）
+	quality := prs.newQualityCapture()
 
 	start := time.Now()
 	defer func() {
@@ -2534,47 +3194,30 @@ func (prs *ProviderRelayService) forwardGeminiToNewAPI(
 		}
 
 		// 发送到写入队列
-		select {
-		case prs.logWriteQueue <- requestLog:
-		default:
-			fmt.Printf("[WARN] 日志队列已满，丢弃日志 (trace_id=%s)\n", requestLog.TraceID)
-		}
+		enqueueStart := time.Now()
+		prs.enqueueRequestLog(requestLog)
+		profileUpstreamAttempt(c, requestLog, start, time.Since(enqueueStart))
+		recordBatchAttempt(c, requestLog)
+		prs.submitQualitySample(quality, bodyBytes, requestLog)
 
 		// Body 日志
-		if shouldLogBody && (len(bodyBytes) > 0 || responseBuffer.Len() > 0) {
-			bodyLog := &RequestLogBody{
-				TraceID:       traceID,
-				RequestBody:   string(bodyBytes),
-				ResponseBody:  responseBuffer.String(),
-				BodySizeBytes: int64(len(bodyBytes) + responseBuffer.Len()),
-				CreatedAt:     time.Now(),
-				ExpiresAt:     time.Now().Add(7 * 24 * time.Hour),
-			}
-			select {
-			case prs.bodyLogQueue <- bodyLog:
-			default:
-				fmt.Printf("[WARN] Body log queue full, dropped trace_id=%s\n", traceID)
-			}
+		if shouldLogBody && bodyDecision.keep(requestLog) {
+			prs.enqueueBodyLog(traceID, bodyBytes, responseBuffer)
+		} else {
+			responseBuffer.discard()
 		}
 	}()
 
 	// 创建 HTTP 客户端
-	timeout := 60 * time.Second
-	if isStream {
-		timeout = 300 * time.Second
-	}
-
-	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     90 * time.Second,
-		},
-	}
+	// NEW-API 网关使用全局超时配置
+	timeouts := prs.resolveTimeouts(Provider{}, isStream, c.Request.Header)
+	httpClient := newUpstreamClient(timeouts)
+	upstreamCtx, cancelUpstream := withUpstreamDeadline(c.Request.Context(), timeouts)
+	defer cancelUpstream(nil)
 
 	// 创建请求
-	req, err := http.NewRequest("POST", targetURL, bytes.NewReader(openAIBody))
+	requestLog.RequestBytes = int64(len(openAIBody))
+	req, err := http.NewRequestWithContext(upstreamCtx, "POST", targetURL, bytes.NewReader(openAIBody))
 	if err != nil {
 		return false, fmt.Errorf("create request failed: %v", err)
 	}
@@ -2586,11 +3229,13 @@ func (prs *ProviderRelayService) forwardGeminiToNewAPI(
 	// 发送请求
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		requestLog.ErrorType = "network_error"
+		requestLog.ErrorType = classifyRequestError(upstreamCtx, err)
 		requestLog.ErrorMessage = err.Error()
 		return false, fmt.Errorf("request failed: %v", err)
 	}
+	countResponseBytes(resp, requestLog)
 	defer resp.Body.Close()
+	requestLog.TTFBSec = time.Since(start).Seconds()
 
 	status := resp.StatusCode
 	requestLog.HttpCode = status
@@ -2644,12 +3289,17 @@ func (prs *ProviderRelayService) forwardGeminiToNewAPI(
 					if err != nil {
 						continue
 					}
+					if requestLog.TTFTSec == 0 && hasOutputToken("data: "+string(data)) {
+						requestLog.TTFTSec = time.Since(start).Seconds()
+					}
 
 					// 记录 Body
 					if shouldLogBody {
 						responseBuffer.Write(geminiChunk)
 						responseBuffer.WriteByte('\n')
 					}
+					quality.write(geminiChunk)
+					quality.write([]byte{'\n'})
 
 					// 提取 token 统计
 					if usage := gjson.GetBytes(data, "usage"); usage.Exists() {
@@ -2697,6 +3347,7 @@ func (prs *ProviderRelayService) forwardGeminiToNewAPI(
 		if shouldLogBody {
 			responseBuffer.Write(geminiResp)
 		}
+		quality.write(geminiResp)
 
 		// 提取 token 统计
 		if usage := gjson.GetBytes(respBody, "usage"); usage.Exists() {
@@ -2736,22 +3387,29 @@ type LLMLogConfig struct {
 	RetentionDays   int    `json:"retention_days"`    // Retention period in days (0 = forever)
 	MaxFileSizeMB   int    `json:"max_file_size_mb"`  // Max file size in MB
 	AutoCleanup     bool   `json:"auto_cleanup"`      // Whether to auto cleanup old logs
+
+	// Body 日志采样与过滤（仅在 SaveFullContent 开启时生效）
+	BodyPolicy BodyLogPolicy `json:"body_policy"`
 }
 
 // LogFilter represents filters for querying logs
 type LogFilter struct {
-	Platform  string  `json:"platform"`   // claude, codex, gemini-cli
-	Model     string  `json:"model"`      // Model name filter
-	Provider  string  `json:"provider"`   // Provider name filter
-	StartTime string  `json:"start_time"` // ISO 8601 format
-	EndTime   string  `json:"end_time"`   // ISO 8601 format
-	MinCost   float64 `json:"min_cost"`   // Minimum cost filter
-	MaxCost   float64 `json:"max_cost"`   // Maximum cost filter
-	HasError  *bool   `json:"has_error"`  // Filter by error status
-	Page      int     `json:"page"`       // Page number (1-based)
-	PageSize  int     `json:"page_size"`  // Items per page
-	SortBy    string  `json:"sort_by"`    // Sort field
-	SortOrder string  `json:"sort_order"` // asc or desc
+	Platform       string  `json:"platform"`        // claude, codex, gemini-cli
+	Model          string  `json:"model"`           // Model name filter
+	Provider       string  `json:"provider"`        // Provider name filter
+	ConversationID string  `json:"conversation_id"` // Conversation filter
+	Project        string  `json:"project"`         // Cost attribution project filter
+	Tag            string  `json:"tag"`             // Cost attribution tag filter
+	AppName        string  `json:"app_name"`        // Client application filter
+	StartTime      string  `json:"start_time"`      // ISO 8601 format
+	EndTime        string  `json:"end_time"`        // ISO 8601 format
+	MinCost        float64 `json:"min_cost"`        // Minimum cost filter
+	MaxCost        float64 `json:"max_cost"`        // Maximum cost filter
+	HasError       *bool   `json:"has_error"`       // Filter by error status
+	Page           int     `json:"page"`            // Page number (1-based)
+	PageSize       int     `json:"page_size"`       // Items per page
+	SortBy         string  `json:"sort_by"`         // Sort field
+	SortOrder      string  `json:"sort_order"`      // asc or desc
 }
 
 // LogQueryResult represents the result of a log query
@@ -2772,17 +3430,23 @@ type LogDetail struct {
 
 // LogStatistics represents usage statistics
 type LogStatistics struct {
-	TotalRequests     int            `json:"total_requests"`
-	TotalTokens       int            `json:"total_tokens"`
-	TotalInputTokens  int            `json:"total_input_tokens"`
-	TotalOutputTokens int            `json:"total_output_tokens"`
-	TotalCost         float64        `json:"total_cost"`
-	SuccessRate       float64        `json:"success_rate"`
-	AvgDuration       float64        `json:"avg_duration_sec"`
-	ByPlatform        map[string]int `json:"by_platform"`
-	ByModel           map[string]int `json:"by_model"`
-	ByProvider        map[string]int `json:"by_provider"`
-	Period            string         `json:"period"` // today, week, month, all
+	TotalRequests     int                `json:"total_requests"`
+	TotalTokens       int                `json:"total_tokens"`
+	TotalInputTokens  int                `json:"total_input_tokens"`
+	TotalOutputTokens int                `json:"total_output_tokens"`
+	TotalCost         float64            `json:"total_cost"`
+	SuccessRate       float64            `json:"success_rate"`
+	AvgDuration       float64            `json:"avg_duration_sec"`
+	RequestBytes      int64              `json:"request_bytes"`  // 发送给上游的请求体字节数
+	ResponseBytes     int64              `json:"response_bytes"` // 从上游读取的响应体字节数
+	ByPlatform        map[string]int     `json:"by_platform"`
+	ByModel           map[string]int     `json:"by_model"`
+	ByProvider        map[string]int     `json:"by_provider"`
+	ByProject         map[string]int     `json:"by_project"`
+	CostByProject     map[string]float64 `json:"cost_by_project"`
+	ByApp             map[string]int     `json:"by_app"`
+	CostByApp         map[string]float64 `json:"cost_by_app"`
+	Period            string             `json:"period"` // today, week, month, all
 }
 
 // GetLLMLogConfig returns the current LLM log configuration
@@ -2797,6 +3461,7 @@ func (prs *ProviderRelayService) GetLLMLogConfig() LLMLogConfig {
 		RetentionDays:   7,
 		MaxFileSizeMB:   10,
 		AutoCleanup:     true,
+		BodyPolicy:      prs.GetBodyLogPolicy(),
 	}
 
 	// Try to load from file
@@ -2815,6 +3480,7 @@ func (prs *ProviderRelayService) SetLLMLogConfig(config LLMLogConfig) error {
 
 	// Update body log enabled status
 	prs.SetBodyLogEnabled(config.SaveFullContent)
+	prs.SetBodyLogPolicy(config.BodyPolicy)
 
 	// Save to file
 	data, err := json.MarshalIndent(config, "", "  ")
@@ -2848,47 +3514,10 @@ func (prs *ProviderRelayService) QueryLogs(filter LogFilter) (*LogQueryResult, e
 	}
 
 	// Build query
-	where := "1=1"
-	args := make([]interface{}, 0)
-
-	if filter.Platform != "" {
-		where += " AND platform = ?"
-		args = append(args, filter.Platform)
-	}
-	if filter.Model != "" {
-		where += " AND model LIKE ?"
-		args = append(args, "%"+filter.Model+"%")
-	}
-	if filter.Provider != "" {
-		where += " AND provider = ?"
-		args = append(args, filter.Provider)
-	}
-	if filter.StartTime != "" {
-		where += " AND created_at >= ?"
-		args = append(args, filter.StartTime)
-	}
-	if filter.EndTime != "" {
-		where += " AND created_at <= ?"
-		args = append(args, filter.EndTime)
-	}
-	if filter.MinCost > 0 {
-		where += " AND total_cost >= ?"
-		args = append(args, filter.MinCost)
-	}
-	if filter.MaxCost > 0 {
-		where += " AND total_cost <= ?"
-		args = append(args, filter.MaxCost)
-	}
-	if filter.HasError != nil {
-		if *filter.HasError {
-			where += " AND http_code >= 400"
-		} else {
-			where += " AND http_code < 400"
-		}
-	}
+	where, args := buildLogFilterWhere(filter)
 
 	// Count total
-	db, err := xdb.DB("default")
+	db, err := analyticsDB()
 	if err != nil {
 		return nil, err
 	}
@@ -2909,18 +3538,12 @@ func (prs *ProviderRelayService) QueryLogs(filter LogFilter) (*LogQueryResult, e
 	}
 
 	querySQL := fmt.Sprintf(`
-		SELECT id, trace_id, request_id, platform, model, provider, http_code,
-		       input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
-		       reasoning_tokens, is_stream, duration_sec, user_agent, client_ip,
-		       user_id, request_method, request_path, error_type, error_message,
-		       provider_error_code, input_cost, output_cost, cache_create_cost,
-		       cache_read_cost, ephemeral_5m_cost, ephemeral_1h_cost, total_cost,
-		       created_at
+		SELECT %s
 		FROM request_log
 		WHERE %s
 		ORDER BY %s
 		LIMIT ? OFFSET ?
-	`, where, orderBy)
+	`, requestLogColumns, where, orderBy)
 
 	args = append(args, filter.PageSize, offset)
 	rows, err := db.Query(querySQL, args...)
@@ -2931,20 +3554,10 @@ func (prs *ProviderRelayService) QueryLogs(filter LogFilter) (*LogQueryResult, e
 
 	logs := make([]ReqeustLog, 0)
 	for rows.Next() {
-		var log ReqeustLog
-		var isStream int
-		if err := rows.Scan(
-			&log.ID, &log.TraceID, &log.RequestID, &log.Platform, &log.Model, &log.Provider,
-			&log.HttpCode, &log.InputTokens, &log.OutputTokens, &log.CacheCreateTokens,
-			&log.CacheReadTokens, &log.ReasoningTokens, &isStream, &log.DurationSec,
-			&log.UserAgent, &log.ClientIP, &log.UserID, &log.RequestMethod, &log.RequestPath,
-			&log.ErrorType, &log.ErrorMessage, &log.ProviderErrorCode, &log.InputCost,
-			&log.OutputCost, &log.CacheCreateCost, &log.CacheReadCost, &log.Ephemeral5mCost,
-			&log.Ephemeral1hCost, &log.TotalCost, &log.CreatedAt,
-		); err != nil {
+		log, err := scanRequestLog(rows)
+		if err != nil {
 			continue
 		}
-		log.IsStream = isStream == 1
 		logs = append(logs, log)
 	}
 
@@ -2959,6 +3572,103 @@ func (prs *ProviderRelayService) QueryLogs(filter LogFilter) (*LogQueryResult, e
 	}, nil
 }
 
+// buildLogFilterWhere builds the WHERE clause (without the keyword) and args for a LogFilter
+func buildLogFilterWhere(filter LogFilter) (string, []interface{}) {
+	where := "1=1"
+	args := make([]interface{}, 0)
+
+	if filter.Platform != "" {
+		where += " AND platform = ?"
+		args = append(args, filter.Platform)
+	}
+	if filter.Model != "" {
+		where += " AND model LIKE ?"
+		args = append(args, "%"+filter.Model+"%")
+	}
+	if filter.Provider != "" {
+		where += " AND provider = ?"
+		args = append(args, filter.Provider)
+	}
+	if filter.ConversationID != "" {
+		where += " AND conversation_id = ?"
+		args = append(args, filter.ConversationID)
+	}
+	if filter.Project != "" {
+		where += " AND project = ?"
+		args = append(args, filter.Project)
+	}
+	if filter.Tag != "" {
+		where += " AND " + tagMatchClause()
+		args = append(args, tagMatchArg(filter.Tag))
+	}
+	if filter.AppName != "" {
+		where += " AND app_name = ?"
+		args = append(args, filter.AppName)
+	}
+	if filter.StartTime != "" {
+		where += " AND created_at >= ?"
+		args = append(args, filter.StartTime)
+	}
+	if filter.EndTime != "" {
+		where += " AND created_at <= ?"
+		args = append(args, filter.EndTime)
+	}
+	if filter.MinCost > 0 {
+		where += " AND total_cost >= ?"
+		args = append(args, filter.MinCost)
+	}
+	if filter.MaxCost > 0 {
+		where += " AND total_cost <= ?"
+		args = append(args, filter.MaxCost)
+	}
+	if filter.HasError != nil {
+		if *filter.HasError {
+			where += " AND http_code >= 400"
+		} else {
+			where += " AND http_code < 400"
+		}
+	}
+
+	return where, args
+}
+
+// requestLogColumns is the column list scanned by scanRequestLog
+const requestLogColumns = `id, COALESCE(trace_id, ''), COALESCE(request_id, ''), COALESCE(conversation_id, ''), COALESCE(project, ''), COALESCE(tags, ''), COALESCE(api_key_id, ''), COALESCE(app_name, ''),
+		       COALESCE(platform, ''), COALESCE(model, ''), COALESCE(provider, ''), COALESCE(http_code, 0),
+		       COALESCE(input_tokens, 0), COALESCE(output_tokens, 0), COALESCE(cache_create_tokens, 0), COALESCE(cache_read_tokens, 0),
+		       COALESCE(reasoning_tokens, 0), COALESCE(is_stream, 0), COALESCE(duration_sec, 0),
+		       COALESCE(ttfb_sec, 0), COALESCE(ttft_sec, 0), COALESCE(tokens_per_sec, 0), COALESCE(user_agent, ''), COALESCE(client_ip, ''),
+		       COALESCE(user_id, ''), COALESCE(request_method, ''), COALESCE(request_path, ''),
+		       COALESCE(error_type, ''), COALESCE(error_message, ''), COALESCE(provider_error_code, ''), COALESCE(json_repair, ''), COALESCE(prompt_compression, ''),
+		       COALESCE(request_bytes, 0), COALESCE(response_bytes, 0),
+		       COALESCE(input_cost, 0), COALESCE(output_cost, 0), COALESCE(cache_create_cost, 0),
+		       COALESCE(cache_read_cost, 0), COALESCE(ephemeral_5m_cost, 0), COALESCE(ephemeral_1h_cost, 0), COALESCE(total_cost, 0),
+		       COALESCE(created_at, '')`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRequestLog scans a row selected with requestLogColumns
+func scanRequestLog(row rowScanner) (ReqeustLog, error) {
+	var log ReqeustLog
+	var isStream int
+	err := row.Scan(
+		&log.ID, &log.TraceID, &log.RequestID, &log.ConversationID, &log.Project, &log.Tags, &log.APIKeyID, &log.AppName, &log.Platform, &log.Model, &log.Provider,
+		&log.HttpCode, &log.InputTokens, &log.OutputTokens, &log.CacheCreateTokens,
+		&log.CacheReadTokens, &log.ReasoningTokens, &isStream, &log.DurationSec,
+		&log.TTFBSec, &log.TTFTSec, &log.TokensPerSec,
+		&log.UserAgent, &log.ClientIP, &log.UserID, &log.RequestMethod, &log.RequestPath,
+		&log.ErrorType, &log.ErrorMessage, &log.ProviderErrorCode, &log.JSONRepair, &log.PromptCompression,
+		&log.RequestBytes, &log.ResponseBytes, &log.InputCost,
+		&log.OutputCost, &log.CacheCreateCost, &log.CacheReadCost, &log.Ephemeral5mCost,
+		&log.Ephemeral1hCost, &log.TotalCost, &log.CreatedAt,
+	)
+	log.IsStream = isStream == 1
+	return log, err
+}
+
 // GetLogDetail returns detailed information about a single log entry
 func (prs *ProviderRelayService) GetLogDetail(traceID string) (*LogDetail, error) {
 	db, err := xdb.DB("default")
@@ -2968,41 +3678,26 @@ func (prs *ProviderRelayService) GetLogDetail(traceID string) (*LogDetail, error
 
 	// Query main log
 	querySQL := `
-		SELECT id, trace_id, request_id, platform, model, provider, http_code,
-		       input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
-		       reasoning_tokens, is_stream, duration_sec, user_agent, client_ip,
-		       user_id, request_method, request_path, error_type, error_message,
-		       provider_error_code, input_cost, output_cost, cache_create_cost,
-		       cache_read_cost, ephemeral_5m_cost, ephemeral_1h_cost, total_cost,
-		       created_at
+		SELECT ` + requestLogColumns + `
 		FROM request_log
 		WHERE trace_id = ?
 		LIMIT 1
 	`
 
-	var log ReqeustLog
-	var isStream int
-	if err := db.QueryRow(querySQL, traceID).Scan(
-		&log.ID, &log.TraceID, &log.RequestID, &log.Platform, &log.Model, &log.Provider,
-		&log.HttpCode, &log.InputTokens, &log.OutputTokens, &log.CacheCreateTokens,
-		&log.CacheReadTokens, &log.ReasoningTokens, &isStream, &log.DurationSec,
-		&log.UserAgent, &log.ClientIP, &log.UserID, &log.RequestMethod, &log.RequestPath,
-		&log.ErrorType, &log.ErrorMessage, &log.ProviderErrorCode, &log.InputCost,
-		&log.OutputCost, &log.CacheCreateCost, &log.CacheReadCost, &log.Ephemeral5mCost,
-		&log.Ephemeral1hCost, &log.TotalCost, &log.CreatedAt,
-	); err != nil {
+	log, err := scanRequestLog(db.QueryRow(querySQL, traceID))
+	if err != nil {
 		return nil, err
 	}
-	log.IsStream = isStream == 1
 
 	detail := &LogDetail{Log: log}
 
 	// Query body if available
-	bodySQL := "SELECT request_body, response_body FROM request_log_body WHERE trace_id = ? LIMIT 1"
+	bodySQL := "SELECT request_body, response_body, COALESCE(blob_refs, '') FROM request_log_body WHERE trace_id = ? LIMIT 1"
 	var reqBody, respBody sql.NullString
-	if err := db.QueryRow(bodySQL, traceID).Scan(&reqBody, &respBody); err == nil {
+	var blobRefs string
+	if err := db.QueryRow(bodySQL, traceID).Scan(&reqBody, &respBody, &blobRefs); err == nil {
 		if reqBody.Valid {
-			detail.RequestBody = reqBody.String
+			detail.RequestBody = newBodyBlobResolver(db).expand(reqBody.String, blobRefs)
 		}
 		if respBody.Valid {
 			detail.ResponseBody = respBody.String
@@ -3019,51 +3714,57 @@ func (prs *ProviderRelayService) GetLogStatistics(period string) (*LogStatistics
 		return nil, err
 	}
 
-	// Determine time range
-	var timeFilter string
+	// Determine time range (request_log stores UTC timestamps; "today" follows the stats time zone)
+	now := time.Now().UTC()
+	var start time.Time
 	switch period {
 	case "today":
-		timeFilter = "AND date(created_at) = date('now')"
+		start = startOfDay(statsNow())
 	case "week":
-		timeFilter = "AND created_at >= datetime('now', '-7 days')"
+		start = now.AddDate(0, 0, -7)
 	case "month":
-		timeFilter = "AND created_at >= datetime('now', '-30 days')"
+		start = now.AddDate(0, 0, -30)
 	default:
-		timeFilter = ""
 		period = "all"
 	}
+	// Read completed hours from the rollup tables and only the rest from raw rows
+	source, args := requestLogUsageSource(db, start, rollupOpenEnd, true)
 
 	stats := &LogStatistics{
-		Period:     period,
-		ByPlatform: make(map[string]int),
-		ByModel:    make(map[string]int),
-		ByProvider: make(map[string]int),
+		Period:        period,
+		ByPlatform:    make(map[string]int),
+		ByModel:       make(map[string]int),
+		ByProvider:    make(map[string]int),
+		ByProject:     make(map[string]int),
+		CostByProject: make(map[string]float64),
+		ByApp:         make(map[string]int),
+		CostByApp:     make(map[string]float64),
 	}
 
 	// Aggregate statistics
-	aggSQL := fmt.Sprintf(`
+	aggSQL := `
 		SELECT
-			COUNT(*) as total_requests,
+			COALESCE(SUM(requests), 0) as total_requests,
 			COALESCE(SUM(input_tokens + output_tokens), 0) as total_tokens,
 			COALESCE(SUM(input_tokens), 0) as total_input_tokens,
 			COALESCE(SUM(output_tokens), 0) as total_output_tokens,
 			COALESCE(SUM(total_cost), 0) as total_cost,
-			COALESCE(AVG(duration_sec), 0) as avg_duration,
-			COALESCE(SUM(CASE WHEN http_code < 400 THEN 1 ELSE 0 END) * 100.0 / NULLIF(COUNT(*), 0), 0) as success_rate
-		FROM request_log
-		WHERE 1=1 %s
-	`, timeFilter)
+			COALESCE(SUM(duration_sum) / NULLIF(SUM(duration_count), 0), 0) as avg_duration,
+			COALESCE(SUM(success_requests) * 100.0 / NULLIF(SUM(requests), 0), 0) as success_rate,
+			COALESCE(SUM(request_bytes), 0) as request_bytes,
+			COALESCE(SUM(response_bytes), 0) as response_bytes
+		FROM ` + source
 
-	if err := db.QueryRow(aggSQL).Scan(
+	if err := db.QueryRow(aggSQL, args...).Scan(
 		&stats.TotalRequests, &stats.TotalTokens, &stats.TotalInputTokens,
 		&stats.TotalOutputTokens, &stats.TotalCost, &stats.AvgDuration, &stats.SuccessRate,
+		&stats.RequestBytes, &stats.ResponseBytes,
 	); err != nil {
 		return nil, err
 	}
 
 	// Group by platform
-	platformSQL := fmt.Sprintf("SELECT platform, COUNT(*) FROM request_log WHERE 1=1 %s GROUP BY platform", timeFilter)
-	platformRows, err := db.Query(platformSQL)
+	platformRows, err := db.Query("SELECT platform, SUM(requests) FROM "+source+" GROUP BY platform", args...)
 	if err == nil {
 		defer platformRows.Close()
 		for platformRows.Next() {
@@ -3076,8 +3777,7 @@ func (prs *ProviderRelayService) GetLogStatistics(period string) (*LogStatistics
 	}
 
 	// Group by model (top 10)
-	modelSQL := fmt.Sprintf("SELECT model, COUNT(*) as cnt FROM request_log WHERE 1=1 %s GROUP BY model ORDER BY cnt DESC LIMIT 10", timeFilter)
-	modelRows, err := db.Query(modelSQL)
+	modelRows, err := db.Query("SELECT model, SUM(requests) as cnt FROM "+source+" GROUP BY model ORDER BY cnt DESC LIMIT 10", args...)
 	if err == nil {
 		defer modelRows.Close()
 		for modelRows.Next() {
@@ -3090,8 +3790,7 @@ func (prs *ProviderRelayService) GetLogStatistics(period string) (*LogStatistics
 	}
 
 	// Group by provider
-	providerSQL := fmt.Sprintf("SELECT provider, COUNT(*) FROM request_log WHERE 1=1 %s GROUP BY provider", timeFilter)
-	providerRows, err := db.Query(providerSQL)
+	providerRows, err := db.Query("SELECT provider, SUM(requests) FROM "+source+" GROUP BY provider", args...)
 	if err == nil {
 		defer providerRows.Close()
 		for providerRows.Next() {
@@ -3103,67 +3802,42 @@ func (prs *ProviderRelayService) GetLogStatistics(period string) (*LogStatistics
 		}
 	}
 
-	return stats, nil
-}
-
-// ExportLogs exports logs to a file
-func (prs *ProviderRelayService) ExportLogs(filter LogFilter, format string) (string, error) {
-	// Query all matching logs (ignore pagination for export)
-	filter.Page = 1
-	filter.PageSize = 10000 // Max export limit
-
-	result, err := prs.QueryLogs(filter)
-	if err != nil {
-		return "", err
-	}
-
-	// Determine export path
-	home, _ := os.UserHomeDir()
-	exportDir := filepath.Join(home, ".code-switch", "exports")
-	if err := os.MkdirAll(exportDir, 0755); err != nil {
-		return "", err
-	}
-
-	timestamp := time.Now().Format("20060102_150405")
-	var exportPath string
-	var data []byte
-
-	switch format {
-	case "csv":
-		exportPath = filepath.Join(exportDir, fmt.Sprintf("llm_logs_%s.csv", timestamp))
-		data = prs.logsToCSV(result.Logs)
-	default: // json
-		exportPath = filepath.Join(exportDir, fmt.Sprintf("llm_logs_%s.json", timestamp))
-		data, err = json.MarshalIndent(result.Logs, "", "  ")
-		if err != nil {
-			return "", err
+	// Group by attribution project (requests without project are reported as "(none)")
+	projectRows, err := db.Query("SELECT COALESCE(NULLIF(project, ''), '(none)'), SUM(requests), COALESCE(SUM(total_cost), 0) FROM "+source+" GROUP BY 1", args...)
+	if err == nil {
+		defer projectRows.Close()
+		for projectRows.Next() {
+			var project string
+			var count int
+			var cost float64
+			if projectRows.Scan(&project, &count, &cost) == nil {
+				stats.ByProject[project] = count
+				stats.CostByProject[project] = cost
+			}
 		}
 	}
 
-	if err := os.WriteFile(exportPath, data, 0644); err != nil {
-		return "", err
+	// Group by client application (logs written before fingerprinting are reported as "unknown")
+	appRows, err := db.Query("SELECT COALESCE(NULLIF(app_name, ''), 'unknown'), SUM(requests), COALESCE(SUM(total_cost), 0) FROM "+source+" GROUP BY 1", args...)
+	if err == nil {
+		defer appRows.Close()
+		for appRows.Next() {
+			var app string
+			var count int
+			var cost float64
+			if appRows.Scan(&app, &count, &cost) == nil {
+				stats.ByApp[app] = count
+				stats.CostByApp[app] = cost
+			}
+		}
 	}
 
-	return exportPath, nil
+	return stats, nil
 }
 
-// logsToCSV converts logs to CSV format
-func (prs *ProviderRelayService) logsToCSV(logs []ReqeustLog) []byte {
-	var buf bytes.Buffer
-
-	// Header
-	buf.WriteString("ID,TraceID,Platform,Model,Provider,HttpCode,InputTokens,OutputTokens,TotalCost,DurationSec,CreatedAt,ErrorType\n")
-
-	// Data rows
-	for _, log := range logs {
-		buf.WriteString(fmt.Sprintf("%d,%s,%s,%s,%s,%d,%d,%d,%.6f,%.3f,%s,%s\n",
-			log.ID, log.TraceID, log.Platform, log.Model, log.Provider,
-			log.HttpCode, log.InputTokens, log.OutputTokens, log.TotalCost,
-			log.DurationSec, log.CreatedAt, log.ErrorType,
-		))
-	}
-
-	return buf.Bytes()
+// ExportLogs exports all logs matching the filter to a file (json or csv)
+func (prs *ProviderRelayService) ExportLogs(filter LogFilter, format string) (string, error) {
+	return prs.ExportLogsWithOptions(filter, LogExportOptions{Format: format})
 }
 
 // CleanupOldLogs removes logs older than the specified retention period
@@ -3178,25 +3852,27 @@ func (prs *ProviderRelayService) CleanupOldLogs(retentionDays int) (int, error)
 	}
 
 	// Delete from request_log_body first (foreign key consideration)
-	bodySQL := fmt.Sprintf("DELETE FROM request_log_body WHERE created_at < datetime('now', '-%d days')", retentionDays)
-	bodyResult, err := db.Exec(bodySQL)
+	bodyDeleted, err := deleteBodyLogs(db, "created_at < datetime('now', ?)", fmt.Sprintf("-%d days", retentionDays))
 	if err != nil {
-		fmt.Printf("[LLM Log] Failed to cleanup body logs: %v\n", err)
-	} else {
-		bodyDeleted, _ := bodyResult.RowsAffected()
-		if bodyDeleted > 0 {
-			fmt.Printf("[LLM Log] Cleaned up %d body log entries\n", bodyDeleted)
-		}
+		return 0, fmt.Errorf("cleanup body logs: %w", err)
+	}
+	prs.noteLogDeletion(bodyDeleted)
+	if bodyDeleted > 0 {
+		fmt.Printf("[LLM Log] Cleaned up %d body log entries\n", bodyDeleted)
 	}
 
 	// Delete from request_log
-	logSQL := fmt.Sprintf("DELETE FROM request_log WHERE created_at < datetime('now', '-%d days')", retentionDays)
-	logResult, err := db.Exec(logSQL)
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
+	logResult, err := db.Exec("DELETE FROM request_log WHERE created_at < ?", cutoff.Format(timeLayout))
 	if err != nil {
 		return 0, err
 	}
+	if err := pruneRollups(db, cutoff); err != nil {
+		fmt.Printf("[LLM Log] Failed to prune usage rollups: %v\n", err)
+	}
 
 	deleted, _ := logResult.RowsAffected()
+	prs.noteLogDeletion(deleted)
 	if deleted > 0 {
 		fmt.Printf("[LLM Log] Cleaned up %d log entries older than %d days\n", deleted, retentionDays)
 	}
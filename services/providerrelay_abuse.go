@@ -0,0 +1,318 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 滥用防护：共享网关上按来源 IP 限制每分钟请求数与同时进行中的请求（含流式），
+// 短时间内多次认证失败或超限的来源临时封禁。状态只保存在本进程内存中，回环地址不受限制
+
+const (
+	// SecurityEventIPBanned 来源 IP 被临时封禁的安全事件类型
+	SecurityEventIPBanned = "ip_banned"
+
+	// abuseStrikeWindow 累计违规次数的时间窗口
+	abuseStrikeWindow = 10 * time.Minute
+	// defaultBanDuration 未配置封禁时长时的默认值
+	defaultBanDuration = 15 * time.Minute
+	// abuseSweepInterval 清理空闲来源记录的间隔
+	abuseSweepInterval = time.Minute
+
+	// ctxKeyAuthFailed 鉴权失败的请求由处理函数标记，计入违规次数
+	ctxKeyAuthFailed = "codeswitch.auth_failed"
+)
+
+// AbuseConfig 按来源 IP 的滥用防护配置；全部为 0 时关闭
+type AbuseConfig struct {
+	RequestsPerMinute int `json:"requestsPerMinute"` // 每分钟请求数上限
+	MaxConcurrent     int `json:"maxConcurrent"`     // 同时进行中的请求（含流式）上限
+	BanAfterStrikes   int `json:"banAfterStrikes"`   // 10 分钟内认证失败或超限达到该次数后临时封禁，0 不封禁
+	BanDurationSec    int `json:"banDurationSec"`    // 封禁时长，0 表示 15 分钟
+}
+
+// IPBan 临时封禁记录
+type IPBan struct {
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	Strikes   int       `json:"strikes"`
+	CreatedAt time.Time `json:"createdAt"`
+	Until     time.Time `json:"until"`
+}
+
+// abuseClient 单个来源的计数
+type abuseClient struct {
+	windowStart time.Time // 当前分钟窗口的开始时间
+	requests    int
+	active      int
+	strikes     []time.Time
+}
+
+// abuseStore 滥用防护配置与各来源状态
+type abuseStore struct {
+	mu        sync.Mutex
+	config    AbuseConfig
+	clients   map[string]*abuseClient
+	bans      map[string]IPBan
+	lastSweep time.Time
+}
+
+// Validate 检查配置取值
+func (cfg AbuseConfig) Validate() error {
+	if cfg.RequestsPerMinute < 0 || cfg.MaxConcurrent < 0 || cfg.BanAfterStrikes < 0 || cfg.BanDurationSec < 0 {
+		return fmt.Errorf("abuse protection limits must not be negative")
+	}
+	return nil
+}
+
+func (cfg AbuseConfig) enabled() bool {
+	return cfg.RequestsPerMinute > 0 || cfg.MaxConcurrent > 0 || cfg.BanAfterStrikes > 0
+}
+
+func (cfg AbuseConfig) banDuration() time.Duration {
+	if cfg.BanDurationSec > 0 {
+		return time.Duration(cfg.BanDurationSec) * time.Second
+	}
+	return defaultBanDuration
+}
+
+// SetAbuseConfig 更新滥用防护配置，立即生效；已有的封禁保留
+func (prs *ProviderRelayService) SetAbuseConfig(cfg AbuseConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	prs.abuse.mu.Lock()
+	prs.abuse.config = cfg
+	prs.abuse.mu.Unlock()
+	return nil
+}
+
+// GetAbuseConfig 获取滥用防护配置
+func (prs *ProviderRelayService) GetAbuseConfig() AbuseConfig {
+	prs.abuse.mu.Lock()
+	defer prs.abuse.mu.Unlock()
+	return prs.abuse.config
+}
+
+// ListIPBans 返回仍然有效的封禁，按到期时间倒序
+func (prs *ProviderRelayService) ListIPBans() []IPBan {
+	now := time.Now()
+	prs.abuse.mu.Lock()
+	defer prs.abuse.mu.Unlock()
+	bans := make([]IPBan, 0, len(prs.abuse.bans))
+	for _, ban := range prs.abuse.bans {
+		if ban.Until.After(now) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Until.After(bans[j].Until) })
+	return bans
+}
+
+// ClearIPBan 解除封禁并清空违规计数；ip 为空时解除全部封禁，返回解除的数量
+func (prs *ProviderRelayService) ClearIPBan(ip string) int {
+	prs.abuse.mu.Lock()
+	defer prs.abuse.mu.Unlock()
+	if ip == "" {
+		cleared := len(prs.abuse.bans)
+		prs.abuse.bans = nil
+		for _, client := range prs.abuse.clients {
+			client.strikes = nil
+		}
+		return cleared
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+	if client := prs.abuse.clients[ip]; client != nil {
+		client.strikes = nil
+	}
+	if _, ok := prs.abuse.bans[ip]; !ok {
+		return 0
+	}
+	delete(prs.abuse.bans, ip)
+	return 1
+}
+
+// markAuthFailure 标记本次请求鉴权失败，计入来源的违规次数
+func markAuthFailure(c *gin.Context) {
+	c.Set(ctxKeyAuthFailed, true)
+}
+
+// clientLocked 返回来源的计数，必要时开启新的分钟窗口；调用方持有锁
+func (s *abuseStore) clientLocked(ip string, now time.Time) *abuseClient {
+	if s.clients == nil {
+		s.clients = make(map[string]*abuseClient)
+	}
+	client := s.clients[ip]
+	if client == nil {
+		client = &abuseClient{windowStart: now}
+		s.clients[ip] = client
+	}
+	if now.Sub(client.windowStart) >= time.Minute {
+		client.windowStart = now
+		client.requests = 0
+	}
+	return client
+}
+
+// sweepLocked 清理过期封禁与空闲来源，防止大量来源时无限增长；调用方持有锁
+func (s *abuseStore) sweepLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < abuseSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for ip, ban := range s.bans {
+		if !ban.Until.After(now) {
+			delete(s.bans, ip)
+		}
+	}
+	for ip, client := range s.clients {
+		if client.active == 0 && now.Sub(client.windowStart) >= time.Minute &&
+			(len(client.strikes) == 0 || now.Sub(client.strikes[len(client.strikes)-1]) >= abuseStrikeWindow) {
+			delete(s.clients, ip)
+		}
+	}
+}
+
+// strikeLocked 记录一次违规，达到阈值时封禁并返回封禁记录；调用方持有锁
+func (s *abuseStore) strikeLocked(ip, reason string, now time.Time) (IPBan, bool) {
+	if s.config.BanAfterStrikes <= 0 {
+		return IPBan{}, false
+	}
+	client := s.clientLocked(ip, now)
+	recent := client.strikes[:0]
+	for _, t := range client.strikes {
+		if now.Sub(t) < abuseStrikeWindow {
+			recent = append(recent, t)
+		}
+	}
+	client.strikes = append(recent, now)
+	if len(client.strikes) < s.config.BanAfterStrikes {
+		return IPBan{}, false
+	}
+	ban := IPBan{
+		IP:        ip,
+		Reason:    reason,
+		Strikes:   len(client.strikes),
+		CreatedAt: now,
+		Until:     now.Add(s.config.banDuration()),
+	}
+	if s.bans == nil {
+		s.bans = make(map[string]IPBan)
+	}
+	s.bans[ip] = ban
+	client.strikes = nil
+	return ban, true
+}
+
+// recordBan 输出日志并写入安全事件
+func recordBan(c *gin.Context, ban IPBan) {
+	fmt.Printf("[Abuse] 临时封禁 %s 至 %s（%s，违规 %d 次）\n", ban.IP, ban.Until.Format(time.RFC3339), ban.Reason, ban.Strikes)
+	go recordSecurityEvent(SecurityEvent{
+		Type:      SecurityEventIPBanned,
+		ClientIP:  ban.IP,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		UserAgent: c.Request.UserAgent(),
+		Detail:    fmt.Sprintf("%s, %d strikes, until %s", ban.Reason, ban.Strikes, ban.Until.Format(time.RFC3339)),
+	})
+}
+
+func abortWithRetryAfter(c *gin.Context, status int, wait time.Duration, message string) {
+	sec := int(wait.Seconds() + 0.999)
+	if sec < 1 {
+		sec = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(sec))
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
+
+// abuseMiddleware 按来源 IP 执行封禁、每分钟请求数与并发限制，并统计鉴权失败
+func (prs *ProviderRelayService) abuseMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := prs.accessClientIP(c.Request)
+		if ip == nil || ip.IsLoopback() {
+			c.Next()
+			return
+		}
+		key := ip.String()
+		now := time.Now()
+
+		store := &prs.abuse
+		store.mu.Lock()
+		store.sweepLocked(now)
+		if ban, ok := store.bans[key]; ok && ban.Until.After(now) {
+			store.mu.Unlock()
+			abortWithRetryAfter(c, http.StatusForbidden, ban.Until.Sub(now), "temporarily banned: "+ban.Reason)
+			return
+		}
+		cfg := store.config
+		if !cfg.enabled() {
+			store.mu.Unlock()
+			c.Next()
+			return
+		}
+		client := store.clientLocked(key, now)
+		reason := ""
+		var wait time.Duration
+		switch {
+		case cfg.RequestsPerMinute > 0 && client.requests >= cfg.RequestsPerMinute:
+			reason = "request rate limit exceeded"
+			wait = client.windowStart.Add(time.Minute).Sub(now)
+		case cfg.MaxConcurrent > 0 && client.active >= cfg.MaxConcurrent:
+			reason = "too many concurrent requests"
+			wait = time.Second
+		}
+		if reason != "" {
+			ban, banned := store.strikeLocked(key, reason, now)
+			store.mu.Unlock()
+			if banned {
+				recordBan(c, ban)
+				abortWithRetryAfter(c, http.StatusForbidden, ban.Until.Sub(now), "temporarily banned: "+reason)
+				return
+			}
+			abortWithRetryAfter(c, http.StatusTooManyRequests, wait, reason)
+			return
+		}
+		client.requests++
+		client.active++
+		store.mu.Unlock()
+
+		defer func() {
+			store.mu.Lock()
+			client.active--
+			var ban IPBan
+			banned := false
+			if c.GetBool(ctxKeyAuthFailed) {
+				ban, banned = store.strikeLocked(key, "repeated authentication failures", time.Now())
+			}
+			store.mu.Unlock()
+			if banned {
+				recordBan(c, ban)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// ===== 管理接口 =====
+
+func (prs *ProviderRelayService) adminListBansHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"bans": prs.ListIPBans(), "config": prs.GetAbuseConfig()})
+}
+
+func (prs *ProviderRelayService) adminClearBanHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"cleared": prs.ClearIPBan(c.Param("ip"))})
+}
+
+func (prs *ProviderRelayService) adminClearAllBansHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"cleared": prs.ClearIPBan("")})
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAbuseTestRouter(t *testing.T, cfg AbuseConfig) (*ProviderRelayService, *gin.Engine) {
+	t.Helper()
+	prs := &ProviderRelayService{}
+	if err := prs.SetAbuseConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(prs.abuseMiddleware())
+	router.POST("/v1/messages", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.GET("/admin", func(c *gin.Context) {
+		markAuthFailure(c)
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+	return prs, router
+}
+
+func abuseRequest(router *gin.Engine, method, path, remote string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remote
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAbuseRateLimitAndBan(t *testing.T) {
+	prs, router := newAbuseTestRouter(t, AbuseConfig{RequestsPerMinute: 2, BanAfterStrikes: 2, BanDurationSec: 60})
+	const client = "203.0.113.7:5000"
+
+	for i := 0; i < 2; i++ {
+		if w := abuseRequest(router, http.MethodPost, "/v1/messages", client); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, w.Code)
+		}
+	}
+	w := abuseRequest(router, http.MethodPost, "/v1/messages", client)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("over limit: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// 第二次超限达到封禁阈值
+	if w := abuseRequest(router, http.MethodPost, "/v1/messages", client); w.Code != http.StatusForbidden {
+		t.Fatalf("second strike: status %d", w.Code)
+	}
+	bans := prs.ListIPBans()
+	if len(bans) != 1 || bans[0].IP != "203.0.113.7" || bans[0].Reason != "request rate limit exceeded" {
+		t.Fatalf("bans = %+v", bans)
+	}
+	if w := abuseRequest(router, http.MethodPost, "/v1/messages", client); w.Code != http.StatusForbidden || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("banned client: status %d", w.Code)
+	}
+
+	// 其他来源与本机不受影响
+	if w := abuseRequest(router, http.MethodPost, "/v1/messages", "198.51.100.1:5000"); w.Code != http.StatusOK {
+		t.Fatalf("other client: status %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := abuseRequest(router, http.MethodPost, "/v1/messages", "127.0.0.1:5000"); w.Code != http.StatusOK {
+			t.Fatalf("loopback: status %d", w.Code)
+		}
+	}
+
+	if cleared := prs.ClearIPBan("203.0.113.7"); cleared != 1 {
+		t.Fatalf("cleared = %d", cleared)
+	}
+	if len(prs.ListIPBans()) != 0 {
+		t.Fatal("ban not cleared")
+	}
+	// 解除封禁后仍受本分钟的频率限制
+	if w := abuseRequest(router, http.MethodPost, "/v1/messages", client); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("after unban: status %d", w.Code)
+	}
+}
+
+func TestAbuseAuthFailuresBan(t *testing.T) {
+	prs, router := newAbuseTestRouter(t, AbuseConfig{BanAfterStrikes: 3})
+	const client = "[2001:db8::1]:5000"
+	for i := 0; i < 3; i++ {
+		if w := abuseRequest(router, http.MethodGet, "/admin", client); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d", i, w.Code)
+		}
+	}
+	if w := abuseRequest(router, http.MethodPost, "/v1/messages", client); w.Code != http.StatusForbidden {
+		t.Fatalf("after auth failures: status %d", w.Code)
+	}
+	bans := prs.ListIPBans()
+	if len(bans) != 1 || bans[0].IP != "2001:db8::1" || bans[0].Until.Sub(bans[0].CreatedAt) != defaultBanDuration {
+		t.Fatalf("bans = %+v", bans)
+	}
+	if cleared := prs.ClearIPBan(""); cleared != 1 {
+		t.Fatalf("clear all = %d", cleared)
+	}
+	if w := abuseRequest(router, http.MethodPost, "/v1/messages", client); w.Code != http.StatusOK {
+		t.Fatalf("after clear: status %d", w.Code)
+	}
+}
+
+func TestAbuseConcurrencyLimit(t *testing.T) {
+	prs := &ProviderRelayService{}
+	if err := prs.SetAbuseConfig(AbuseConfig{MaxConcurrent: 1}); err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(prs.abuseMiddleware())
+	router.POST("/v1/messages", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/v1/models", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	const client = "203.0.113.8:5000"
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		abuseRequest(router, http.MethodPost, "/v1/messages", client)
+	}()
+	<-started
+	if w := abuseRequest(router, http.MethodGet, "/v1/models", client); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("concurrent request: status %d", w.Code)
+	}
+	close(release)
+	wg.Wait()
+	if w := abuseRequest(router, http.MethodGet, "/v1/models", client); w.Code != http.StatusOK {
+		t.Fatalf("after stream finished: status %d", w.Code)
+	}
+}
+
+func TestAbuseConfigValidate(t *testing.T) {
+	if err := (AbuseConfig{RequestsPerMinute: -1}).Validate(); err == nil {
+		t.Fatal("negative limit accepted")
+	}
+	prs, router := newAbuseTestRouter(t, AbuseConfig{})
+	for i := 0; i < 10; i++ {
+		if w := abuseRequest(router, http.MethodGet, "/admin", "203.0.113.9:5000"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("disabled: status %d", w.Code)
+		}
+	}
+	if len(prs.ListIPBans()) != 0 {
+		t.Fatal("banned while disabled")
+	}
+}
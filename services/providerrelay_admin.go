@@ -0,0 +1,576 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理 API 与内置 Web 控制台，供无桌面端的服务器部署观察流量、维护 provider
+const (
+	adminAPIPrefix   = "/admin/api"
+	dashboardPrefix  = "/dashboard"
+	adminTokenHeader = "X-Admin-Token"
+)
+
+// adminPlatforms 管理 API 支持的平台
+var adminPlatforms = []string{"claude", "codex", "gemini-cli", "picoclaw"}
+
+// adminStore 管理令牌与控制台静态资源
+type adminStore struct {
+	mu        sync.RWMutex
+	token     string
+	dashboard fs.FS
+}
+
+// SetAdminToken 设置管理令牌；为空时管理 API 仅对本机开放
+func (prs *ProviderRelayService) SetAdminToken(token string) {
+	prs.admin.mu.Lock()
+	prs.admin.token = strings.TrimSpace(token)
+	prs.admin.mu.Unlock()
+}
+
+// SetDashboardFS 设置内置控制台的静态资源（根目录需包含 index.html），为 nil 时不提供 /dashboard
+func (prs *ProviderRelayService) SetDashboardFS(assets fs.FS) {
+	prs.admin.mu.Lock()
+	prs.admin.dashboard = assets
+	prs.admin.mu.Unlock()
+}
+
+// authorizeAdmin 校验 Authorization: Bearer <token> 或 X-Admin-Token；授权的客户端证书身份免令牌
+func (prs *ProviderRelayService) authorizeAdmin(c *gin.Context) bool {
+	if prs.isAdminIdentity(c) {
+		return true
+	}
+	given := c.GetHeader(adminTokenHeader)
+	if given == "" {
+		given = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	return prs.checkAdminToken(given, net.ParseIP(c.RemoteIP()))
+}
+
+// checkAdminToken 比对管理令牌；未设置令牌时仅允许本机访问
+func (prs *ProviderRelayService) checkAdminToken(given string, remoteIP net.IP) bool {
+	prs.admin.mu.RLock()
+	token := prs.admin.token
+	prs.admin.mu.RUnlock()
+	if token == "" {
+		return remoteIP != nil && remoteIP.IsLoopback()
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func (prs *ProviderRelayService) adminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !prs.authorizeAdmin(c) {
+			markAuthFailure(c)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin token required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerAdminRoutes 注册管理 API 与控制台静态资源
+func (prs *ProviderRelayService) registerAdminRoutes(router gin.IRouter) {
+	api := router.Group(adminAPIPrefix, prs.adminAuthMiddleware())
+	api.GET("/status", prs.adminStatusHandler)
+	api.GET("/metrics", prs.adminMetricsHandler)
+	api.GET("/logs", prs.adminLogsHandler)
+	api.GET("/logs/tail", prs.streamLogTail)
+	api.GET("/logs/:traceId", prs.adminLogDetailHandler)
+	api.GET("/providers/:kind", prs.adminListProvidersHandler)
+	api.POST("/providers/:kind", prs.adminCreateProviderHandler)
+	api.PUT("/providers/:kind/:id", prs.adminUpdateProviderHandler)
+	api.DELETE("/providers/:kind/:id", prs.adminDeleteProviderHandler)
+	api.POST("/providers/:kind/:id/suspend", prs.adminSuspendProviderHandler)
+	api.POST("/providers/:kind/:id/resume", prs.adminResumeProviderHandler)
+	api.POST("/providers/:kind/:id/test", prs.adminTestProviderHandler)
+	api.POST("/providers/:kind/:id/switch", prs.adminSwitchProviderHandler)
+	api.GET("/guardrails", prs.adminGetGuardrailsHandler)
+	api.PUT("/guardrails", prs.adminUpdateGuardrailsHandler)
+	api.GET("/guardrails/violations", prs.adminGuardrailViolationsHandler)
+	api.GET("/provider-groups/:kind", prs.adminGetProviderGroupsHandler)
+	api.PUT("/provider-groups/:kind", prs.adminUpdateProviderGroupsHandler)
+	api.GET("/canaries/:kind", prs.adminGetCanariesHandler)
+	api.POST("/canaries/:kind/:name", prs.adminStartCanaryHandler)
+	api.POST("/canaries/evaluate", prs.adminEvaluateCanariesHandler)
+	api.GET("/slo", prs.adminSLOHandler)
+	api.GET("/quality", prs.adminGetQualityConfigHandler)
+	api.PUT("/quality", prs.adminUpdateQualityConfigHandler)
+	api.GET("/quality/summary", prs.adminQualitySummaryHandler)
+	api.GET("/compression", prs.adminGetCompressionConfigHandler)
+	api.PUT("/compression", prs.adminUpdateCompressionConfigHandler)
+	api.GET("/reasoning", prs.adminGetReasoningConfigHandler)
+	api.PUT("/reasoning", prs.adminUpdateReasoningConfigHandler)
+	api.GET("/model-defaults", prs.adminGetModelDefaultsHandler)
+	api.PUT("/model-defaults", prs.adminUpdateModelDefaultsHandler)
+	api.GET("/priority", prs.adminGetPriorityConfigHandler)
+	api.PUT("/priority", prs.adminUpdatePriorityConfigHandler)
+	api.GET("/priority/stats", prs.adminPriorityStatsHandler)
+	api.GET("/stats/snapshot", prs.adminStatsSnapshotHandler)
+	api.GET("/incidents", prs.adminIncidentsHandler)
+	api.GET("/slow-requests", prs.adminSlowRequestsHandler)
+	api.GET("/ip-access", prs.adminGetIPAccessHandler)
+	api.GET("/mtls", prs.adminGetMTLSHandler)
+	api.GET("/security/events", prs.adminSecurityEventsHandler)
+	api.GET("/security/bans", prs.adminListBansHandler)
+	api.DELETE("/security/bans", prs.adminClearAllBansHandler)
+	api.DELETE("/security/bans/:ip", prs.adminClearBanHandler)
+	api.GET("/plugins", prs.adminGetPluginsHandler)
+	api.POST("/plugins/reload", prs.adminReloadPluginsHandler)
+	api.GET("/scripts", prs.adminGetScriptsHandler)
+	api.GET("/scripts/:kind", prs.adminGetScriptHandler)
+	api.PUT("/scripts/:kind", prs.adminSaveScriptHandler)
+	api.POST("/scripts/:kind/test", prs.adminTestScriptHandler)
+
+	prs.admin.mu.RLock()
+	assets := prs.admin.dashboard
+	prs.admin.mu.RUnlock()
+	if assets == nil {
+		return
+	}
+	// 静态资源不含数据，无需鉴权；页面内通过管理令牌调用 /admin/api
+	fileServer := http.StripPrefix(dashboardPrefix, http.FileServer(http.FS(assets)))
+	router.GET(dashboardPrefix, func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, dashboardPrefix+"/")
+	})
+	router.GET(dashboardPrefix+"/*filepath", func(c *gin.Context) {
+		fileServer.ServeHTTP(c.Writer, c.Request)
+	})
+}
+
+// AdminProviderStatus 控制台展示的 provider 状态（不含密钥）
+type AdminProviderStatus struct {
+	Platform        string          `json:"platform"`
+	ID              int             `json:"id"`
+	Name            string          `json:"name"`
+	APIURL          string          `json:"apiUrl"`
+	Enabled         bool            `json:"enabled"`
+	Ready           bool            `json:"ready"`
+	Suspended       bool            `json:"suspended"`
+	SuspendedReason string          `json:"suspendedReason,omitempty"`
+	CooldownSec     int             `json:"cooldownSec,omitempty"`
+	Level           int             `json:"level,omitempty"`
+	RateLimit       *RateLimitState `json:"rateLimit,omitempty"`
+}
+
+func (prs *ProviderRelayService) adminStatusHandler(c *gin.Context) {
+	rateLimits := prs.GetRateLimitStatus()
+	providers := make([]AdminProviderStatus, 0)
+	for _, kind := range adminPlatforms {
+		list, err := prs.providerService.LoadProviders(kind)
+		if err != nil {
+			continue
+		}
+		for _, p := range list {
+			status := AdminProviderStatus{
+				Platform:        kind,
+				ID:              p.ID,
+				Name:            p.Name,
+				APIURL:          p.APIURL,
+				Enabled:         p.Enabled,
+				Ready:           p.Enabled && !p.Suspended && p.APIURL != "" && p.HasCredentials(),
+				Suspended:       p.Suspended,
+				SuspendedReason: p.SuspendedReason,
+				CooldownSec:     int(prs.cooldownRemaining(kind, p.Name).Seconds()),
+				Level:           p.Level,
+			}
+			if state, ok := rateLimits[providerKey(kind, p.Name)]; ok {
+				status.RateLimit = &state
+			}
+			providers = append(providers, status)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"version":    AppVersion,
+		"uptime_sec": int64(time.Since(prs.startTime).Seconds()),
+		"addr":       prs.addr,
+		"providers":  providers,
+	})
+}
+
+func (prs *ProviderRelayService) adminMetricsHandler(c *gin.Context) {
+	period := c.DefaultQuery("period", "today")
+	stats, err := prs.GetLogStatistics(period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func (prs *ProviderRelayService) adminLogsHandler(c *gin.Context) {
+	filter := LogFilter{
+		Platform:       c.Query("platform"),
+		Model:          c.Query("model"),
+		Provider:       c.Query("provider"),
+		ConversationID: c.Query("conversation_id"),
+		Project:        c.Query("project"),
+		Tag:            c.Query("tag"),
+		AppName:        c.Query("app_name"),
+		StartTime:      c.Query("start_time"),
+		EndTime:        c.Query("end_time"),
+		SortBy:         c.Query("sort_by"),
+		SortOrder:      c.Query("sort_order"),
+	}
+	filter.Page, _ = strconv.Atoi(c.Query("page"))
+	filter.PageSize, _ = strconv.Atoi(c.Query("page_size"))
+	if v := c.Query("has_error"); v != "" {
+		hasError, err := strconv.ParseBool(v)
+		if err == nil {
+			filter.HasError = &hasError
+		}
+	}
+	result, err := prs.QueryLogs(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (prs *ProviderRelayService) adminLogDetailHandler(c *gin.Context) {
+	detail, err := prs.GetLogDetail(c.Param("traceId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, detail)
+}
+
+// maskAPIKey 仅保留首尾各 4 位
+func maskAPIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+var (
+	errProviderNotFound = errors.New("provider not found")
+	errProviderExists   = errors.New("provider already exists")
+)
+
+// isAdminPlatform 是否为管理 API 支持的平台
+func isAdminPlatform(kind string) bool {
+	for _, platform := range adminPlatforms {
+		if platform == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// findProvider 按 id 查找 provider
+func (prs *ProviderRelayService) findProvider(kind string, id int) (Provider, error) {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return Provider{}, err
+	}
+	for _, p := range providers {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Provider{}, errProviderNotFound
+}
+
+// createProvider 新增 provider，id 自动分配为当前最大值 + 1
+func (prs *ProviderRelayService) createProvider(kind string, provider Provider) (Provider, error) {
+	provider.Name = strings.TrimSpace(provider.Name)
+	if provider.Name == "" {
+		return Provider{}, errors.New("provider name is required")
+	}
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return Provider{}, err
+	}
+	nextID := 1
+	for _, p := range providers {
+		if p.Name == provider.Name {
+			return Provider{}, fmt.Errorf("%w: %s", errProviderExists, provider.Name)
+		}
+		if p.ID >= nextID {
+			nextID = p.ID + 1
+		}
+	}
+	provider.ID = nextID
+	if err := prs.providerService.SaveProviders(kind, append(providers, provider)); err != nil {
+		return Provider{}, err
+	}
+	return provider, nil
+}
+
+// updateProvider 按 id 更新 provider，apply 基于原配置返回新配置；id 与名称不可修改，
+// 列表接口返回的是掩码，密钥为空或仍为掩码时保留原值
+func (prs *ProviderRelayService) updateProvider(kind string, id int, apply func(existing Provider) Provider) (Provider, error) {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return Provider{}, err
+	}
+	for i, existing := range providers {
+		if existing.ID != id {
+			continue
+		}
+		provider := apply(existing)
+		provider.ID = existing.ID
+		provider.Name = existing.Name
+		if provider.APIKey == "" || provider.APIKey == maskAPIKey(existing.APIKey) {
+			provider.APIKey = existing.APIKey
+		}
+		providers[i] = provider
+		if err := prs.providerService.SaveProviders(kind, providers); err != nil {
+			return Provider{}, err
+		}
+		return provider, nil
+	}
+	return Provider{}, errProviderNotFound
+}
+
+// deleteProvider 按 id 删除 provider
+func (prs *ProviderRelayService) deleteProvider(kind string, id int) error {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return err
+	}
+	for i, p := range providers {
+		if p.ID == id {
+			return prs.providerService.SaveProviders(kind, append(providers[:i], providers[i+1:]...))
+		}
+	}
+	return errProviderNotFound
+}
+
+// adminPlatform 校验路径中的平台参数
+func adminPlatform(c *gin.Context) (string, bool) {
+	kind := c.Param("kind")
+	if !isAdminPlatform(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown platform: " + kind})
+		return "", false
+	}
+	return kind, true
+}
+
+// adminProviderID 解析路径中的 provider id
+func adminProviderID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid provider id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// adminError 按错误类型返回状态码，其余错误使用 fallback
+func adminError(c *gin.Context, err error, fallback int) {
+	code := fallback
+	switch {
+	case errors.Is(err, errProviderNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, errProviderExists):
+		code = http.StatusConflict
+	}
+	c.JSON(code, gin.H{"error": err.Error()})
+}
+
+func (prs *ProviderRelayService) adminListProvidersHandler(c *gin.Context) {
+	kind, ok := adminPlatform(c)
+	if !ok {
+		return
+	}
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	masked := make([]Provider, len(providers))
+	for i, p := range providers {
+		p.APIKey = maskAPIKey(p.APIKey)
+		masked[i] = p
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": masked})
+}
+
+func (prs *ProviderRelayService) adminCreateProviderHandler(c *gin.Context) {
+	kind, ok := adminPlatform(c)
+	if !ok {
+		return
+	}
+	var provider Provider
+	if err := c.ShouldBindJSON(&provider); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	provider, err := prs.createProvider(kind, provider)
+	if err != nil {
+		adminError(c, err, http.StatusBadRequest)
+		return
+	}
+	provider.APIKey = maskAPIKey(provider.APIKey)
+	c.JSON(http.StatusCreated, provider)
+}
+
+func (prs *ProviderRelayService) adminUpdateProviderHandler(c *gin.Context) {
+	kind, ok := adminPlatform(c)
+	if !ok {
+		return
+	}
+	id, ok := adminProviderID(c)
+	if !ok {
+		return
+	}
+	var provider Provider
+	if err := c.ShouldBindJSON(&provider); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	provider, err := prs.updateProvider(kind, id, func(Provider) Provider { return provider })
+	if err != nil {
+		adminError(c, err, http.StatusBadRequest)
+		return
+	}
+	provider.APIKey = maskAPIKey(provider.APIKey)
+	c.JSON(http.StatusOK, provider)
+}
+
+func (prs *ProviderRelayService) adminDeleteProviderHandler(c *gin.Context) {
+	kind, ok := adminPlatform(c)
+	if !ok {
+		return
+	}
+	id, ok := adminProviderID(c)
+	if !ok {
+		return
+	}
+	if err := prs.deleteProvider(kind, id); err != nil {
+		adminError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (prs *ProviderRelayService) adminSuspendProviderHandler(c *gin.Context) {
+	prs.adminToggleSuspend(c, true)
+}
+
+func (prs *ProviderRelayService) adminResumeProviderHandler(c *gin.Context) {
+	prs.adminToggleSuspend(c, false)
+}
+
+func (prs *ProviderRelayService) adminToggleSuspend(c *gin.Context, suspend bool) {
+	kind, ok := adminPlatform(c)
+	if !ok {
+		return
+	}
+	id, ok := adminProviderID(c)
+	if !ok {
+		return
+	}
+	provider, err := prs.findProvider(kind, id)
+	if err == nil {
+		if suspend {
+			err = prs.SuspendProvider(kind, provider.Name, "suspended via admin API")
+		} else {
+			err = prs.ResumeProvider(kind, provider.Name)
+		}
+	}
+	if err != nil {
+		adminError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ProviderTestResult provider 连通性测试结果
+type ProviderTestResult struct {
+	OK        bool   `json:"ok"`
+	HTTPCode  int    `json:"http_code,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// testProvider 请求 provider 的 /models 端点，验证地址与凭据是否可用
+func (prs *ProviderRelayService) testProvider(kind string, provider Provider) ProviderTestResult {
+	start := time.Now()
+	code, err := prs.probeProviderAuth(kind, provider)
+	result := ProviderTestResult{HTTPCode: code, LatencyMs: time.Since(start).Milliseconds()}
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case code >= http.StatusOK && code < http.StatusMultipleChoices:
+		result.OK = true
+	default:
+		result.Error = http.StatusText(code)
+	}
+	return result
+}
+
+// switchProvider 将 provider 设为首选：启用并移到列表最前，优先级分组设为 1（同级按列表顺序尝试）
+func (prs *ProviderRelayService) switchProvider(kind string, id int) (Provider, error) {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return Provider{}, err
+	}
+	for i, p := range providers {
+		if p.ID != id {
+			continue
+		}
+		p.Enabled = true
+		p.Level = 1
+		reordered := append([]Provider{p}, providers[:i]...)
+		reordered = append(reordered, providers[i+1:]...)
+		if err := prs.providerService.SaveProviders(kind, reordered); err != nil {
+			return Provider{}, err
+		}
+		return p, nil
+	}
+	return Provider{}, errProviderNotFound
+}
+
+func (prs *ProviderRelayService) adminTestProviderHandler(c *gin.Context) {
+	kind, ok := adminPlatform(c)
+	if !ok {
+		return
+	}
+	id, ok := adminProviderID(c)
+	if !ok {
+		return
+	}
+	provider, err := prs.findProvider(kind, id)
+	if err != nil {
+		adminError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, prs.testProvider(kind, provider))
+}
+
+func (prs *ProviderRelayService) adminSwitchProviderHandler(c *gin.Context) {
+	kind, ok := adminPlatform(c)
+	if !ok {
+		return
+	}
+	id, ok := adminProviderID(c)
+	if !ok {
+		return
+	}
+	provider, err := prs.switchProvider(kind, id)
+	if err != nil {
+		adminError(c, err, http.StatusInternalServerError)
+		return
+	}
+	provider.APIKey = maskAPIKey(provider.APIKey)
+	c.JSON(http.StatusOK, provider)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAdminTestRouter(t *testing.T, token string) (*ProviderRelayService, *gin.Engine) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	prs.SetAdminToken(token)
+	prs.SetDashboardFS(fstest.MapFS{"index.html": {Data: []byte("<html>dashboard</html>")}})
+	router := gin.New()
+	prs.registerUsageRoutes(router)
+	prs.registerAdminRoutes(router)
+	return prs, router
+}
+
+func adminRequest(router *gin.Engine, method, target, token string, body any) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.RemoteAddr = "198.51.100.7:4000"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	_, router := newAdminTestRouter(t, "s3cret")
+	if rec := adminRequest(router, http.MethodGet, "/admin/api/providers/claude", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec := adminRequest(router, http.MethodGet, "/admin/api/providers/claude", "wrong", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong token, got %d", rec.Code)
+	}
+	if rec := adminRequest(router, http.MethodGet, "/admin/api/providers/claude", "s3cret", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with token, got %d", rec.Code)
+	}
+	// 控制台静态资源本身不鉴权
+	rec := adminRequest(router, http.MethodGet, "/dashboard/", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "dashboard") {
+		t.Fatalf("expected dashboard index, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminProviderCRUDMasksKeys(t *testing.T) {
+	prs, router := newAdminTestRouter(t, "s3cret")
+
+	rec := adminRequest(router, http.MethodPost, "/admin/api/providers/claude", "s3cret",
+		Provider{Name: "relay-a", APIURL: "https://a.example.com", APIKey: "sk-abcdefgh12345678", Enabled: true})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var created Provider
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.ID != 1 || created.APIKey != "sk-a****5678" {
+		t.Fatalf("unexpected created provider %+v", created)
+	}
+	if rec := adminRequest(router, http.MethodPost, "/admin/api/providers/claude", "s3cret", Provider{Name: "relay-a"}); rec.Code != http.StatusConflict {
+		t.Fatalf("expected conflict for duplicate name, got %d", rec.Code)
+	}
+
+	// 回传掩码时保留原密钥
+	created.APIURL = "https://b.example.com"
+	if rec := adminRequest(router, http.MethodPut, "/admin/api/providers/claude/1", "s3cret", created); rec.Code != http.StatusOK {
+		t.Fatalf("update failed: %d %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := prs.providerService.LoadProviders("claude")
+	if len(stored) != 1 || stored[0].APIKey != "sk-abcdefgh12345678" || stored[0].APIURL != "https://b.example.com" {
+		t.Fatalf("unexpected stored provider %+v", stored)
+	}
+
+	if rec := adminRequest(router, http.MethodDelete, "/admin/api/providers/claude/1", "s3cret", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete failed: %d", rec.Code)
+	}
+	if rec := adminRequest(router, http.MethodDelete, "/admin/api/providers/claude/1", "s3cret", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rec.Code)
+	}
+	if rec := adminRequest(router, http.MethodGet, "/admin/api/providers/unknown", "s3cret", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown platform, got %d", rec.Code)
+	}
+}
+
+func TestAdminSwitchAndTestProvider(t *testing.T) {
+	prs, router := newAdminTestRouter(t, "s3cret")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer upstream.Close()
+
+	prs.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "a", APIURL: upstream.URL, APIKey: "sk-good", Enabled: true, Level: 1},
+		{ID: 2, Name: "b", APIURL: upstream.URL, APIKey: "sk-bad", Enabled: false, Level: 3},
+	})
+
+	var result ProviderTestResult
+	rec := adminRequest(router, http.MethodPost, "/admin/api/providers/codex/1/test", "s3cret", nil)
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if rec.Code != http.StatusOK || !result.OK || result.HTTPCode != http.StatusOK {
+		t.Fatalf("expected passing test, got %d %+v", rec.Code, result)
+	}
+	rec = adminRequest(router, http.MethodPost, "/admin/api/providers/codex/2/test", "s3cret", nil)
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result.OK || result.HTTPCode != http.StatusUnauthorized {
+		t.Fatalf("expected failing test, got %+v", result)
+	}
+
+	if rec := adminRequest(router, http.MethodPost, "/admin/api/providers/codex/2/switch", "s3cret", nil); rec.Code != http.StatusOK {
+		t.Fatalf("switch failed: %d %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := prs.providerService.LoadProviders("codex")
+	if stored[0].Name != "b" || !stored[0].Enabled || stored[0].Level != 1 || stored[1].Name != "a" {
+		t.Fatalf("switched provider should be first, got %+v", stored)
+	}
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// anthropicPassthroughTimeout Anthropic 辅助端点（count_tokens / batches）的请求超时
+const anthropicPassthroughTimeout = 60 * time.Second
+
+// batchProviderIndex 记录 batch ID 与创建它的 provider，后续查询需路由回同一 provider
+var batchProviderIndex sync.Map
+
+// registerAnthropicRoutes 注册 Anthropic 专有端点：count_tokens 与 Message Batches API
+func (prs *ProviderRelayService) registerAnthropicRoutes(router gin.IRouter) {
+	router.POST("/v1/messages/count_tokens", prs.countTokensHandler())
+
+	router.POST("/v1/messages/batches", prs.createBatchHandler())
+	router.GET("/v1/messages/batches", prs.listBatchesHandler())
+	router.GET("/v1/messages/batches/:id", prs.batchHandler(""))
+	router.GET("/v1/messages/batches/:id/results", prs.batchHandler("/results"))
+	router.POST("/v1/messages/batches/:id/cancel", prs.batchHandler("/cancel"))
+	router.DELETE("/v1/messages/batches/:id", prs.batchHandler(""))
+}
+
+// anthropicProviders 返回可处理 Anthropic 原生端点的 claude provider（按 Level 排序）
+// 本地模型服务与 Azure 不支持这些端点，直接跳过
+func (prs *ProviderRelayService) anthropicProviders(model string) ([]Provider, error) {
+	providers, err := prs.providerService.LoadProviders("claude")
+	if err != nil {
+		return nil, err
+	}
+	active := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		if !p.Enabled || p.Suspended || p.APIURL == "" || !p.HasCredentials() || p.IsLocal() || p.IsAzure() {
+			continue
+		}
+		if model != "" && !p.IsModelSupported(model) {
+			continue
+		}
+		active = append(active, p)
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		return max(active[i].Level, 1) < max(active[j].Level, 1)
+	})
+	return active, nil
+}
+
+// forwardAnthropic 向 provider 透传请求，返回上游状态码、响应头与响应体
+func (prs *ProviderRelayService) forwardAnthropic(
+	c *gin.Context,
+	provider Provider,
+	method string,
+	endpoint string,
+	bodyBytes []byte,
+) (int, http.Header, []byte, error) {
+	headers := cloneHeaders(c.Request.Header)
+	deleteHeader(headers, "Content-Length")
+	deleteHeader(headers, "Accept-Encoding")
+	if err := prs.applyProviderAuth("claude", provider, headers); err != nil {
+		return 0, nil, nil, err
+	}
+
+	var body io.Reader
+	if len(bodyBytes) > 0 {
+		body = bytes.NewReader(bodyBytes)
+	}
+	req, err := http.NewRequest(method, joinURL(provider.APIURL, endpoint), body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.URL.RawQuery = c.Request.URL.RawQuery
+
+	resp, err := (&http.Client{Timeout: anthropicPassthroughTimeout}).Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, respData, nil
+}
+
+// writeUpstream 将上游响应原样写回客户端
+func writeUpstream(c *gin.Context, status int, header http.Header, body []byte) {
+	for key, values := range header {
+		if key == "Content-Length" || key == "Content-Encoding" || key == "Transfer-Encoding" {
+			continue
+		}
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+	c.Writer.WriteHeader(status)
+	c.Writer.Write(body)
+}
+
+// isUnsupportedEndpoint 判断上游是否不支持该端点（第三方中转常见）
+func isUnsupportedEndpoint(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented
+}
+
+// countTokensHandler 转发 count_tokens；所有 provider 均不支持时在本地估算
+func (prs *ProviderRelayService) countTokensHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		model := gjson.GetBytes(bodyBytes, "model").String()
+
+		providers, err := prs.anthropicProviders(model)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
+			return
+		}
+
+		for _, provider := range providers {
+			payload := bodyBytes
+			if effective := provider.GetEffectiveModel(model); effective != model && model != "" {
+				if modified, err := ReplaceModelInRequestBody(bodyBytes, effective); err == nil {
+					payload = modified
+				}
+			}
+			status, header, respData, err := prs.forwardAnthropic(c, provider, http.MethodPost, "/v1/messages/count_tokens", payload)
+			if err != nil {
+				fmt.Printf("[CountTokens] Provider %s 请求失败: %v\n", provider.Name, err)
+				continue
+			}
+			if isUnsupportedEndpoint(status) || status >= http.StatusInternalServerError {
+				fmt.Printf("[CountTokens] Provider %s 不可用 (status=%d)，尝试下一个\n", provider.Name, status)
+				continue
+			}
+			c.Header("X-Token-Count-Source", "upstream")
+			writeUpstream(c, status, header, respData)
+			return
+		}
+
+		c.Header("X-Token-Count-Source", "estimated")
+		c.JSON(http.StatusOK, gin.H{"input_tokens": EstimateMessageTokens(bodyBytes)})
+	}
+}
+
+// createBatchHandler 创建 batch，并记录 batch ID 所属的 provider
+func (prs *ProviderRelayService) createBatchHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		providers, err := prs.anthropicProviders("")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
+			return
+		}
+
+		var lastErr error
+		for _, provider := range providers {
+			status, header, respData, err := prs.forwardAnthropic(c, provider, http.MethodPost, "/v1/messages/batches", bodyBytes)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if isUnsupportedEndpoint(status) || status >= http.StatusInternalServerError {
+				lastErr = fmt.Errorf("provider %s status %d", provider.Name, status)
+				continue
+			}
+			if id := gjson.GetBytes(respData, "id").String(); id != "" {
+				batchProviderIndex.Store(id, provider.Name)
+				fmt.Printf("[Batches] 创建 batch %s (provider=%s)\n", id, provider.Name)
+			}
+			writeUpstream(c, status, header, respData)
+			return
+		}
+
+		message := "没有支持 Message Batches API 的 provider"
+		if lastErr != nil {
+			message = fmt.Sprintf("%s: %s", message, lastErr.Error())
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": message})
+	}
+}
+
+// listBatchesHandler 列出首个支持 Batches API 的 provider 上的 batch
+func (prs *ProviderRelayService) listBatchesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		providers, err := prs.anthropicProviders("")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
+			return
+		}
+		for _, provider := range providers {
+			status, header, respData, err := prs.forwardAnthropic(c, provider, http.MethodGet, "/v1/messages/batches", nil)
+			if err != nil || isUnsupportedEndpoint(status) {
+				continue
+			}
+			writeUpstream(c, status, header, respData)
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "没有支持 Message Batches API 的 provider"})
+	}
+}
+
+// batchHandler 查询 / 取消 / 删除 batch 及获取结果
+// 优先路由到创建该 batch 的 provider；重启后索引丢失时依次尝试所有 provider
+func (prs *ProviderRelayService) batchHandler(suffix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batchID := c.Param("id")
+		endpoint := "/v1/messages/batches/" + batchID + suffix
+
+		providers, err := prs.anthropicProviders("")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
+			return
+		}
+		if owner, ok := batchProviderIndex.Load(batchID); ok {
+			sort.SliceStable(providers, func(i, j int) bool {
+				return providers[i].Name == owner.(string) && providers[j].Name != owner.(string)
+			})
+		}
+
+		for _, provider := range providers {
+			status, header, respData, err := prs.forwardAnthropic(c, provider, c.Request.Method, endpoint, nil)
+			if err != nil || isUnsupportedEndpoint(status) {
+				continue
+			}
+			batchProviderIndex.Store(batchID, provider.Name)
+			writeUpstream(c, status, header, respData)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("batch %s 不存在", batchID)})
+	}
+}
+
+// EstimateMessageTokens 在本地粗略估算 Messages 请求的输入 token 数
+// 英文约 4 字符 / token，CJK 字符约 1 字符 / token；另计每条消息的结构开销
+func EstimateMessageTokens(body []byte) int {
+	total := estimateValueTokens(gjson.GetBytes(body, "system"))
+	total += estimateValueTokens(gjson.GetBytes(body, "tools"))
+	messages := gjson.GetBytes(body, "messages").Array()
+	for _, msg := range messages {
+		total += estimateValueTokens(msg.Get("content"))
+	}
+	return total + len(messages)*4
+}
+
+// estimateImageTokens 图片等二进制内容按固定开销计算，不计入 base64 字符
+const estimateImageTokens = 1600
+
+// estimateValueTokens 估算 JSON 值中全部文本的 token 数
+func estimateValueTokens(v gjson.Result) int {
+	total := 0
+	switch {
+	case v.IsObject():
+		v.ForEach(func(key, value gjson.Result) bool {
+			switch key.String() {
+			case "source": // Anthropic
+				if value.Get("type").String() == "base64" {
+					total += estimateImageTokens
+					return true
+				}
+			case "inlineData", "inline_data": // Gemini
+				total += estimateImageTokens
+				return true
+			case "image_url": // OpenAI
+				if strings.HasPrefix(value.Get("url").String(), "data:") || strings.HasPrefix(value.String(), "data:") {
+					total += estimateImageTokens
+					return true
+				}
+			}
+			total += estimateValueTokens(value)
+			return true
+		})
+	case v.IsArray():
+		for _, item := range v.Array() {
+			total += estimateValueTokens(item)
+		}
+	case v.Type == gjson.String:
+		total += estimateTextTokens(v.String())
+	}
+	return total
+}
+
+// estimateTextTokens 估算单段文本的 token 数
+func estimateTextTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < unicode.MaxASCII {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
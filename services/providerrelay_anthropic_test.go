@@ -0,0 +1,31 @@
+package services
+
+import "testing"
+
+func TestEstimateTextTokens(t *testing.T) {
+	if got := estimateTextTokens("hello world!"); got != 3 {
+		t.Errorf("ascii estimate = %d, want 3", got)
+	}
+	if got := estimateTextTokens("你好世界"); got != 4 {
+		t.Errorf("cjk estimate = %d, want 4", got)
+	}
+}
+
+func TestEstimateMessageTokens(t *testing.T) {
+	body := []byte(`{
+		"model": "claude-sonnet-4",
+		"system": "abcdabcd",
+		"messages": [
+			{"role": "user", "content": "abcdabcdabcd"},
+			{"role": "user", "content": [
+				{"type": "text", "text": "abcd"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAAA"}}
+			]}
+		]
+	}`)
+	// system 2 + 消息文本 3 + 1 + type 字段 (text 1 + image 2) + 图片 1600 + 结构开销 8
+	got := EstimateMessageTokens(body)
+	if got != 2+3+1+1+2+1600+8 {
+		t.Errorf("EstimateMessageTokens = %d", got)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// anthropicOAuthBeta 使用订阅账号 OAuth 令牌访问 Anthropic API 时必须携带的 beta 标记
+const anthropicOAuthBeta = "oauth-2025-04-20"
+
+// SetOAuthService 设置 OAuth 服务，用于订阅账号类 provider 的请求签名
+func (prs *ProviderRelayService) SetOAuthService(oauth *OAuthService) {
+	prs.oauthService = oauth
+}
+
+// applyProviderAuth 根据 provider 的认证方式写入认证相关请求头
+func (prs *ProviderRelayService) applyProviderAuth(kind string, provider Provider, headers map[string]string) error {
+	switch provider.AuthType {
+	case AuthTypeOAuth:
+		if prs.oauthService == nil {
+			return fmt.Errorf("provider %s 使用 OAuth 认证，但 OAuth 服务未初始化", provider.Name)
+		}
+		token, err := prs.oauthService.AccessToken(kind, provider.Name)
+		if err != nil {
+			return err
+		}
+
+		// 订阅令牌不能与客户端传入的 API Key 混用
+		deleteHeader(headers, "x-api-key")
+		headers["Authorization"] = "Bearer " + token.AccessToken
+
+		switch token.Vendor {
+		case "anthropic":
+			beta := mergeBetaHeader(getHeader(headers, "anthropic-beta"), anthropicOAuthBeta)
+			deleteHeader(headers, "anthropic-beta")
+			headers["anthropic-beta"] = beta
+		case "openai":
+			if token.AccountID != "" {
+				headers["chatgpt-account-id"] = token.AccountID
+			}
+		}
+	default:
+		if provider.IsLocal() && provider.APIKey == "" {
+			// 本地模型服务通常无需认证
+			deleteHeader(headers, "Authorization")
+			return nil
+		}
+		if provider.IsAzure() {
+			// Azure OpenAI 使用 api-key 头而非 Bearer token
+			deleteHeader(headers, "Authorization")
+			headers["api-key"] = provider.APIKey
+			return nil
+		}
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", provider.APIKey)
+	}
+	return nil
+}
+
+// getHeader 大小写不敏感地读取请求头
+func getHeader(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// deleteHeader 大小写不敏感地删除请求头
+func deleteHeader(headers map[string]string, name string) {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			delete(headers, k)
+		}
+	}
+}
+
+// mergeBetaHeader 合并逗号分隔的 beta 标记，避免重复
+func mergeBetaHeader(existing, beta string) string {
+	if existing == "" {
+		return beta
+	}
+	for _, item := range strings.Split(existing, ",") {
+		if strings.TrimSpace(item) == beta {
+			return existing
+		}
+	}
+	return existing + "," + beta
+}
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 日志队列写满时的处理策略
+const (
+	// LogOverflowDrop 丢弃日志（默认）
+	LogOverflowDrop = "drop"
+	// LogOverflowBlock 请求结束时等待队列腾出空间，超时后丢弃
+	LogOverflowBlock = "block"
+	// LogOverflowSpool 暂存到磁盘，数据库追上后回放
+	LogOverflowSpool = "spool"
+)
+
+const (
+	// defaultLogOverflowWait block 策略的默认最长等待时间
+	defaultLogOverflowWait = 200 * time.Millisecond
+	// logSpoolReplayInterval 检查并回放磁盘暂存日志的间隔
+	logSpoolReplayInterval = 5 * time.Second
+	// logOverflowEventInterval 同一队列的溢出事件最短推送间隔
+	logOverflowEventInterval = 10 * time.Second
+
+	requestLogSpoolFile = "request_log.jsonl"
+	bodyLogSpoolFile    = "request_log_body.jsonl"
+)
+
+// LogOverflowPolicy 日志队列溢出策略
+type LogOverflowPolicy struct {
+	Mode string `json:"mode"`
+	// block 策略的最长等待毫秒数，0 表示默认 200ms
+	MaxWaitMs int `json:"max_wait_ms"`
+}
+
+// LogOverflowEvent 日志队列溢出事件，Action 为 dropped 时使用量 / 成本数据不完整
+type LogOverflowEvent struct {
+	Queue   string `json:"queue"`
+	Action  string `json:"action"`
+	Policy  string `json:"policy"`
+	Dropped uint64 `json:"dropped"`
+	Spooled uint64 `json:"spooled"`
+	Time    string `json:"time"`
+}
+
+// logOverflowStore 溢出策略、磁盘暂存文件锁与溢出事件订阅者
+type logOverflowStore struct {
+	mu       sync.RWMutex
+	policy   LogOverflowPolicy
+	handlers []func(LogOverflowEvent)
+	lastSent map[string]time.Time
+	// 保护暂存文件的追加与回放
+	spoolMu sync.Mutex
+}
+
+// logSpoolDir 返回日志暂存目录
+func logSpoolDir() string {
+	if IsReadOnlyMode() {
+		return filepath.Join(os.TempDir(), "code-switch-log-spool")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".code-switch", "log-spool")
+}
+
+// normalizeLogOverflowPolicy 未知策略按 drop 处理
+func normalizeLogOverflowPolicy(policy LogOverflowPolicy) LogOverflowPolicy {
+	switch policy.Mode {
+	case LogOverflowBlock, LogOverflowSpool:
+	default:
+		policy.Mode = LogOverflowDrop
+	}
+	if policy.MaxWaitMs < 0 {
+		policy.MaxWaitMs = 0
+	}
+	return policy
+}
+
+// SetLogOverflowPolicy 设置日志队列溢出策略
+func (prs *ProviderRelayService) SetLogOverflowPolicy(policy LogOverflowPolicy) {
+	policy = normalizeLogOverflowPolicy(policy)
+	prs.logOverflow.mu.Lock()
+	prs.logOverflow.policy = policy
+	prs.logOverflow.mu.Unlock()
+}
+
+// GetLogOverflowPolicy 获取日志队列溢出策略
+func (prs *ProviderRelayService) GetLogOverflowPolicy() LogOverflowPolicy {
+	prs.logOverflow.mu.RLock()
+	defer prs.logOverflow.mu.RUnlock()
+	return normalizeLogOverflowPolicy(prs.logOverflow.policy)
+}
+
+// OnLogOverflow 订阅日志队列溢出事件（已按队列限频）
+func (prs *ProviderRelayService) OnLogOverflow(handler func(LogOverflowEvent)) {
+	prs.logOverflow.mu.Lock()
+	prs.logOverflow.handlers = append(prs.logOverflow.handlers, handler)
+	prs.logOverflow.mu.Unlock()
+}
+
+func (prs *ProviderRelayService) emitLogOverflow(queue, action string) {
+	now := time.Now()
+	key := queue + ":" + action
+	prs.logOverflow.mu.Lock()
+	if last, ok := prs.logOverflow.lastSent[key]; ok && now.Sub(last) < logOverflowEventInterval {
+		prs.logOverflow.mu.Unlock()
+		return
+	}
+	if prs.logOverflow.lastSent == nil {
+		prs.logOverflow.lastSent = make(map[string]time.Time)
+	}
+	prs.logOverflow.lastSent[key] = now
+	handlers := append([]func(LogOverflowEvent){}, prs.logOverflow.handlers...)
+	policy := normalizeLogOverflowPolicy(prs.logOverflow.policy)
+	prs.logOverflow.mu.Unlock()
+
+	event := LogOverflowEvent{Queue: queue, Action: action, Policy: policy.Mode, Time: now.Format(time.RFC3339)}
+	if queue == "body_log" {
+		event.Dropped = atomic.LoadUint64(&prs.logQueue.bodyDropped)
+		event.Spooled = atomic.LoadUint64(&prs.logQueue.bodySpooled)
+	} else {
+		event.Dropped = atomic.LoadUint64(&prs.logQueue.dropped)
+		event.Spooled = atomic.LoadUint64(&prs.logQueue.spooled)
+	}
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// overflowWait block 策略下的等待时间，其余策略返回 0
+func (prs *ProviderRelayService) overflowWait(policy LogOverflowPolicy) time.Duration {
+	if policy.Mode != LogOverflowBlock {
+		return 0
+	}
+	if policy.MaxWaitMs > 0 {
+		return time.Duration(policy.MaxWaitMs) * time.Millisecond
+	}
+	return defaultLogOverflowWait
+}
+
+// overflowRequestLog 请求日志队列已满：按策略等待、暂存到磁盘或丢弃
+func (prs *ProviderRelayService) overflowRequestLog(log *ReqeustLog) bool {
+	policy := prs.GetLogOverflowPolicy()
+	if wait := prs.overflowWait(policy); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case prs.logWriteQueue <- log:
+			atomic.AddUint64(&prs.logQueue.blocked, 1)
+			atomic.AddUint64(&prs.logQueue.enqueued, 1)
+			return true
+		case <-timer.C:
+		}
+	}
+	if policy.Mode == LogOverflowSpool {
+		// 回放时保留原始请求时间
+		if log.CreatedAt == "" {
+			log.CreatedAt = time.Now().UTC().Format(timeLayout)
+		}
+		err := prs.appendLogSpool(requestLogSpoolFile, log)
+		if err == nil {
+			atomic.AddUint64(&prs.logQueue.spooled, 1)
+			prs.emitLogOverflow("request_log", "spooled")
+			return true
+		}
+		fmt.Printf("[WARN] 日志暂存到磁盘失败 (trace_id=%s): %v\n", log.TraceID, err)
+	}
+
+	dropped := atomic.AddUint64(&prs.logQueue.dropped, 1)
+	fmt.Printf("[WARN] 日志队列已满，丢弃日志 (trace_id=%s, 累计丢弃 %d 条)\n", log.TraceID, dropped)
+	prs.emitLogOverflow("request_log", "dropped")
+	return false
+}
+
+// overflowBodyLog Body 日志队列已满：按策略等待、暂存到磁盘或丢弃
+func (prs *ProviderRelayService) overflowBodyLog(bodyLog *RequestLogBody) bool {
+	policy := prs.GetLogOverflowPolicy()
+	if wait := prs.overflowWait(policy); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case prs.bodyLogQueue <- bodyLog:
+			atomic.AddUint64(&prs.logQueue.blocked, 1)
+			return true
+		case <-timer.C:
+		}
+	}
+	if policy.Mode == LogOverflowSpool {
+		err := prs.appendLogSpool(bodyLogSpoolFile, bodyLog)
+		if err == nil {
+			atomic.AddUint64(&prs.logQueue.bodySpooled, 1)
+			prs.emitLogOverflow("body_log", "spooled")
+			return true
+		}
+		fmt.Printf("[WARN] Body 日志暂存到磁盘失败 (trace_id=%s): %v\n", bodyLog.TraceID, err)
+	}
+
+	atomic.AddUint64(&prs.logQueue.bodyDropped, 1)
+	fmt.Printf("[WARN] Body log queue full, dropped trace_id=%s\n", bodyLog.TraceID)
+	if bodyLog.ResponseBodyPath != "" {
+		os.Remove(bodyLog.ResponseBodyPath)
+	}
+	prs.emitLogOverflow("body_log", "dropped")
+	return false
+}
+
+// appendLogSpool 以 JSON Lines 追加到暂存文件
+func (prs *ProviderRelayService) appendLogSpool(name string, record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	prs.logOverflow.spoolMu.Lock()
+	defer prs.logOverflow.spoolMu.Unlock()
+	return appendSpoolLines(filepath.Join(logSpoolDir(), name), append(line, '\n'))
+}
+
+func appendSpoolLines(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// startLogSpoolReplay 定期在队列空闲时回放磁盘暂存的日志（含上次运行遗留的暂存）
+func (prs *ProviderRelayService) startLogSpoolReplay() {
+	ticker := time.NewTicker(logSpoolReplayInterval)
+	defer ticker.Stop()
+	for {
+		prs.replayLogSpool()
+		<-ticker.C
+	}
+}
+
+// replayLogSpool 队列占用低于 1/4 时把暂存日志直接写入数据库，写入失败的部分重新暂存
+func (prs *ProviderRelayService) replayLogSpool() {
+	if len(prs.logWriteQueue)*4 < cap(prs.logWriteQueue) {
+		prs.replaySpoolFile(requestLogSpoolFile, func(lines [][]byte) error {
+			batch := make([]*ReqeustLog, 0, len(lines))
+			for _, line := range lines {
+				var log ReqeustLog
+				if err := json.Unmarshal(line, &log); err == nil {
+					batch = append(batch, &log)
+				}
+			}
+			if err := prs.writeRequestLogs(batch); err != nil {
+				return err
+			}
+			atomic.AddUint64(&prs.logQueue.replayed, uint64(len(batch)))
+			return nil
+		})
+	}
+	if len(prs.bodyLogQueue)*4 < cap(prs.bodyLogQueue) {
+		prs.replaySpoolFile(bodyLogSpoolFile, func(lines [][]byte) error {
+			for i, line := range lines {
+				var bodyLog RequestLogBody
+				if err := json.Unmarshal(line, &bodyLog); err != nil {
+					continue
+				}
+				if err := writeBodyLog(&bodyLog); err != nil {
+					// 当前及之后的记录重新暂存
+					return &spoolReplayError{done: i, err: err}
+				}
+				atomic.AddUint64(&prs.logQueue.replayed, 1)
+			}
+			return nil
+		})
+	}
+}
+
+// spoolReplayError 回放中途失败，done 为已写入的行数
+type spoolReplayError struct {
+	done int
+	err  error
+}
+
+func (e *spoolReplayError) Error() string { return e.err.Error() }
+
+// replaySpoolFile 将暂存文件改名后分批回放；中途失败时把未写入的行追加回暂存文件
+func (prs *ProviderRelayService) replaySpoolFile(name string, write func(lines [][]byte) error) {
+	path := filepath.Join(logSpoolDir(), name)
+	replaying := path + ".replaying"
+
+	prs.logOverflow.spoolMu.Lock()
+	if _, err := os.Stat(replaying); err != nil {
+		// 没有上次中断的回放时，取出当前暂存文件
+		if err := os.Rename(path, replaying); err != nil {
+			prs.logOverflow.spoolMu.Unlock()
+			return
+		}
+	}
+	prs.logOverflow.spoolMu.Unlock()
+
+	f, err := os.Open(replaying)
+	if err != nil {
+		return
+	}
+	reader := bufio.NewReader(f)
+	var pending [][]byte
+	total := 0
+	for {
+		lines, readErr := readSpoolBatch(reader, logBatchMax)
+		if len(lines) > 0 {
+			if err := write(lines); err != nil {
+				done := 0
+				var partial *spoolReplayError
+				if errors.As(err, &partial) {
+					done = partial.done
+				}
+				pending = append(pending, lines[done:]...)
+				rest, _ := io.ReadAll(reader)
+				f.Close()
+				prs.requeueSpool(path, replaying, pending, rest)
+				fmt.Printf("[Ailurus PaaS] 回放暂存日志 %s 中断，剩余日志已重新暂存: %v\n", name, err)
+				return
+			}
+			total += len(lines)
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	f.Close()
+	os.Remove(replaying)
+	if total > 0 {
+		fmt.Printf("[Ailurus PaaS] 已回放 %d 条暂存日志 (%s)\n", total, name)
+	}
+}
+
+// requeueSpool 把未写入的行放回暂存文件并删除回放文件
+func (prs *ProviderRelayService) requeueSpool(path, replaying string, pending [][]byte, rest []byte) {
+	var buf bytes.Buffer
+	for _, line := range pending {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.Write(rest)
+
+	prs.logOverflow.spoolMu.Lock()
+	defer prs.logOverflow.spoolMu.Unlock()
+	if err := appendSpoolLines(path, buf.Bytes()); err != nil {
+		// 保留回放文件，下次继续
+		fmt.Printf("[WARN] 重新暂存日志失败: %v\n", err)
+		return
+	}
+	os.Remove(replaying)
+}
+
+// readSpoolBatch 读取最多 n 行非空记录
+func readSpoolBatch(reader *bufio.Reader, n int) ([][]byte, error) {
+	var lines [][]byte
+	for len(lines) < n {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+	return lines, nil
+}
+
+// logSpoolBytes 尚未回放的暂存日志大小
+func logSpoolBytes() int64 {
+	var total int64
+	for _, name := range []string{requestLogSpoolFile, bodyLogSpoolFile} {
+		for _, path := range []string{name, name + ".replaying"} {
+			if info, err := os.Stat(filepath.Join(logSpoolDir(), path)); err == nil {
+				total += info.Size()
+			}
+		}
+	}
+	return total
+}
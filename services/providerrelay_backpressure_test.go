@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestLogOverflowPolicies(t *testing.T) {
+	openAnalyticsDB(t, "overflow.db")
+
+	prs := &ProviderRelayService{logWriteQueue: make(chan *ReqeustLog, 1), bodyLogQueue: make(chan *RequestLogBody, 1)}
+	var events []LogOverflowEvent
+	prs.OnLogOverflow(func(event LogOverflowEvent) { events = append(events, event) })
+	prs.enqueueRequestLog(&ReqeustLog{TraceID: "queued"})
+
+	// 默认丢弃并推送溢出事件（限频）
+	if prs.enqueueRequestLog(&ReqeustLog{TraceID: "d1"}) || prs.enqueueRequestLog(&ReqeustLog{TraceID: "d2"}) {
+		t.Fatal("expected logs to be dropped")
+	}
+	if stats := prs.GetLogQueueStats(); stats.Policy != LogOverflowDrop || stats.Dropped != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(events) != 1 || events[0].Action != "dropped" || events[0].Dropped != 1 {
+		t.Fatalf("expected one throttled overflow event, got %+v", events)
+	}
+
+	// block：等待写入协程腾出空间
+	prs.SetLogOverflowPolicy(LogOverflowPolicy{Mode: LogOverflowBlock, MaxWaitMs: 2000})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-prs.logWriteQueue
+	}()
+	if !prs.enqueueRequestLog(&ReqeustLog{TraceID: "blocked"}) {
+		t.Fatal("expected log to be queued after waiting")
+	}
+	if stats := prs.GetLogQueueStats(); stats.Blocked != 1 || stats.Dropped != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// spool：暂存到磁盘，队列空闲后按原始时间回放
+	prs.SetLogOverflowPolicy(LogOverflowPolicy{Mode: LogOverflowSpool})
+	createdAt := time.Now().Add(-time.Hour).UTC().Format(timeLayout)
+	if !prs.enqueueRequestLog(&ReqeustLog{TraceID: "spooled", Platform: "claude", TotalCost: 1.5, CreatedAt: createdAt}) {
+		t.Fatal("expected log to be spooled")
+	}
+	prs.enqueueBodyLog("spooled", []byte(`{"model":"m"}`), newBodyCapture("spooled"))
+	if !prs.overflowBodyLog(&RequestLogBody{TraceID: "spooled-body", RequestBody: "{}", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}) {
+		t.Fatal("expected body log to be spooled")
+	}
+	stats := prs.GetLogQueueStats()
+	if stats.Spooled != 1 || stats.BodySpooled != 1 || stats.SpoolBytes == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// 队列仍然满时不回放
+	prs.replayLogSpool()
+	if _, err := os.Stat(filepath.Join(logSpoolDir(), requestLogSpoolFile)); err != nil {
+		t.Fatal("expected spool to be kept while the queue is busy")
+	}
+	<-prs.logWriteQueue
+	<-prs.bodyLogQueue
+	prs.replayLogSpool()
+
+	db, _ := xdb.DB("default")
+	var gotCreatedAt string
+	var cost float64
+	if err := db.QueryRow("SELECT created_at, total_cost FROM request_log WHERE trace_id = 'spooled'").Scan(&gotCreatedAt, &cost); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(strings.Replace(gotCreatedAt, "T", " ", 1), createdAt) || cost != 1.5 {
+		t.Fatalf("expected replayed log with original time, got %s / %f", gotCreatedAt, cost)
+	}
+	var bodies int
+	db.QueryRow("SELECT count(*) FROM request_log_body WHERE trace_id = 'spooled-body'").Scan(&bodies)
+	if bodies != 1 {
+		t.Fatalf("expected replayed body log, got %d", bodies)
+	}
+	if stats := prs.GetLogQueueStats(); stats.Replayed != 2 || stats.SpoolBytes != 0 {
+		t.Fatalf("unexpected stats after replay: %+v", stats)
+	}
+}
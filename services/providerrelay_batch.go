@@ -0,0 +1,434 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 批量请求：POST /v1/batch 接收一组对话请求，在网关内按并发上限逐个走完整的代理链路
+// （路由、故障转移、限流、日志与计费），返回每个请求的状态与汇总花费，便于脚本化评测。
+// 子请求默认标记为 batch 优先级，不会挤占交互式请求的并发名额。
+
+const (
+	// defaultBatchConcurrency 未配置时的最大并发
+	defaultBatchConcurrency = 4
+	// batchMaxRequests 单次批量请求的最大条数
+	batchMaxRequests = 500
+	// batchErrorPreview 失败响应非 JSON 时保留的错误文本长度
+	batchErrorPreview = 512
+)
+
+// batchEndpoints 批量请求允许的子请求端点（不含 /v1/batch 自身，避免递归）
+var batchEndpoints = map[string]bool{
+	"/v1/messages":            true,
+	"/v1/chat/completions":    true,
+	"/chat/completions":       true,
+	"/responses":              true,
+	"/v1/completions":         true,
+	"/pc/v1/chat/completions": true,
+	"/pc/chat/completions":    true,
+}
+
+// BatchRequest /v1/batch 请求体
+type BatchRequest struct {
+	Endpoint    string             `json:"endpoint"`    // 子请求默认端点，默认 /v1/chat/completions
+	Model       string             `json:"model"`       // prompt 简写使用的模型
+	MaxTokens   int                `json:"max_tokens"`  // prompt 简写使用的 max_tokens，/v1/messages 未设置时为 1024
+	Concurrency int                `json:"concurrency"` // 并发数，不超过网关配置的上限
+	Stream      bool               `json:"stream"`      // true 时每完成一个请求输出一行 NDJSON
+	Requests    []BatchRequestItem `json:"requests"`
+}
+
+// BatchRequestItem 单个子请求：完整请求体 body，或只给 prompt 由网关组装
+type BatchRequestItem struct {
+	CustomID string          `json:"custom_id,omitempty"`
+	Endpoint string          `json:"endpoint,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Prompt   string          `json:"prompt,omitempty"`
+}
+
+// BatchItemResult 单个子请求的结果
+type BatchItemResult struct {
+	Index        int             `json:"index"`
+	CustomID     string          `json:"custom_id,omitempty"`
+	Status       int             `json:"status"`
+	TraceID      string          `json:"trace_id,omitempty"`
+	Provider     string          `json:"provider,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	Attempts     int             `json:"attempts"` // 上游尝试次数（含故障转移）
+	InputTokens  int             `json:"input_tokens"`
+	OutputTokens int             `json:"output_tokens"`
+	Cost         float64         `json:"cost"`
+	DurationMs   int64           `json:"duration_ms"`
+	Body         json.RawMessage `json:"body,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// BatchSummary 批量请求汇总
+type BatchSummary struct {
+	Total        int     `json:"total"`
+	Succeeded    int     `json:"succeeded"`
+	Failed       int     `json:"failed"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	DurationMs   int64   `json:"duration_ms"`
+}
+
+func (s *BatchSummary) add(result BatchItemResult) {
+	s.Total++
+	if result.Status >= 200 && result.Status < 300 {
+		s.Succeeded++
+	} else {
+		s.Failed++
+	}
+	s.InputTokens += result.InputTokens
+	s.OutputTokens += result.OutputTokens
+	s.Cost += result.Cost
+}
+
+// SetBatchConcurrency 设置 /v1/batch 的最大并发，<=0 使用默认值 4
+func (prs *ProviderRelayService) SetBatchConcurrency(n int) {
+	if n <= 0 {
+		n = defaultBatchConcurrency
+	}
+	atomic.StoreInt64(&prs.batchConcurrency, int64(n))
+}
+
+// BatchConcurrency 当前 /v1/batch 的最大并发
+func (prs *ProviderRelayService) BatchConcurrency() int {
+	if n := atomic.LoadInt64(&prs.batchConcurrency); n > 0 {
+		return int(n)
+	}
+	return defaultBatchConcurrency
+}
+
+// batchUsageKey 子请求 context 中的用量累加器
+type batchUsageKey struct{}
+
+// batchItemUsage 子请求各次上游尝试的用量（故障转移时累加花费）
+type batchItemUsage struct {
+	mu       sync.Mutex
+	attempts int
+	provider string
+	model    string
+	input    int
+	output   int
+	cost     float64
+}
+
+// recordBatchAttempt 在请求日志入队时调用，记录批量子请求的用量；非批量请求直接返回
+func recordBatchAttempt(c *gin.Context, log *ReqeustLog) {
+	if c == nil || c.Request == nil || log == nil {
+		return
+	}
+	usage, ok := c.Request.Context().Value(batchUsageKey{}).(*batchItemUsage)
+	if !ok {
+		return
+	}
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	usage.attempts++
+	usage.provider = log.Provider
+	usage.model = log.Model
+	usage.input += log.InputTokens
+	usage.output += log.OutputTokens
+	usage.cost += log.TotalCost
+}
+
+// batchRequestHandler 处理 POST /v1/batch；handler 为完整的网关路由，子请求经过与普通请求相同的中间件与代理逻辑
+func (prs *ProviderRelayService) batchRequestHandler(handler http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if prs.rejectIfRelayPaused(c) {
+			return
+		}
+		var req BatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch request: " + err.Error()})
+			return
+		}
+		bodies, err := req.itemBodies()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		concurrency := prs.BatchConcurrency()
+		if req.Concurrency > 0 && req.Concurrency < concurrency {
+			concurrency = req.Concurrency
+		}
+		fmt.Printf("[Batch] 开始执行 %d 个请求 (concurrency=%d)\n", len(bodies), concurrency)
+
+		start := time.Now()
+		results := make(chan BatchItemResult)
+		go func() {
+			sem := make(chan struct{}, concurrency)
+			var wg sync.WaitGroup
+			for i, body := range bodies {
+				sem <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					result := runBatchItem(c.Request, handler, i, body.endpoint, body.data)
+					result.Index = i
+					result.CustomID = req.Requests[i].CustomID
+					results <- result
+				}()
+			}
+			wg.Wait()
+			close(results)
+		}()
+
+		if req.Stream {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+		}
+		var summary BatchSummary
+		collected := make([]BatchItemResult, 0, len(bodies))
+		for result := range results {
+			summary.add(result)
+			if req.Stream {
+				writeBatchLine(c, gin.H{"type": "result", "result": result})
+				continue
+			}
+			collected = append(collected, result)
+		}
+		summary.DurationMs = time.Since(start).Milliseconds()
+		fmt.Printf("[Batch] 完成 %d 个请求：成功 %d，失败 %d，花费 $%.6f (%dms)\n",
+			summary.Total, summary.Succeeded, summary.Failed, summary.Cost, summary.DurationMs)
+
+		if req.Stream {
+			writeBatchLine(c, gin.H{"type": "summary", "summary": summary})
+			return
+		}
+		sort.Slice(collected, func(i, j int) bool { return collected[i].Index < collected[j].Index })
+		c.JSON(http.StatusOK, gin.H{"object": "batch_result", "results": collected, "summary": summary})
+	}
+}
+
+func writeBatchLine(c *gin.Context, v any) {
+	data, _ := json.Marshal(v)
+	c.Writer.Write(append(data, '\n'))
+	c.Writer.Flush()
+}
+
+type batchItemBody struct {
+	endpoint string
+	data     []byte
+}
+
+// itemBodies 校验并组装各子请求的端点与请求体；子请求一律以非流式执行
+func (req BatchRequest) itemBodies() ([]batchItemBody, error) {
+	if len(req.Requests) == 0 {
+		return nil, fmt.Errorf("requests is empty")
+	}
+	if len(req.Requests) > batchMaxRequests {
+		return nil, fmt.Errorf("too many requests: %d (max %d)", len(req.Requests), batchMaxRequests)
+	}
+	defaultEndpoint := req.Endpoint
+	if defaultEndpoint == "" {
+		defaultEndpoint = "/v1/chat/completions"
+	}
+
+	bodies := make([]batchItemBody, len(req.Requests))
+	for i, item := range req.Requests {
+		endpoint := item.Endpoint
+		if endpoint == "" {
+			endpoint = defaultEndpoint
+		}
+		if !batchEndpoints[endpoint] {
+			return nil, fmt.Errorf("requests[%d]: unsupported endpoint %q", i, endpoint)
+		}
+
+		data := []byte(item.Body)
+		switch {
+		case len(bytes.TrimSpace(data)) > 0:
+			if !gjson.ValidBytes(data) || !gjson.ParseBytes(data).IsObject() {
+				return nil, fmt.Errorf("requests[%d]: body must be a JSON object", i)
+			}
+		case item.Prompt != "":
+			if req.Model == "" {
+				return nil, fmt.Errorf("requests[%d]: model is required when using prompt", i)
+			}
+			data = batchPromptBody(endpoint, req.Model, item.Prompt, req.MaxTokens)
+		default:
+			return nil, fmt.Errorf("requests[%d]: body or prompt is required", i)
+		}
+		if gjson.GetBytes(data, "stream").Bool() {
+			data, _ = sjson.SetBytes(data, "stream", false)
+		}
+		bodies[i] = batchItemBody{endpoint: endpoint, data: data}
+	}
+	return bodies, nil
+}
+
+// batchPromptBody 按端点格式把单个 prompt 组装为请求体
+func batchPromptBody(endpoint, model, prompt string, maxTokens int) []byte {
+	body := map[string]any{"model": model}
+	switch endpoint {
+	case "/responses":
+		body["input"] = prompt
+	case "/v1/completions":
+		body["prompt"] = prompt
+	default:
+		body["messages"] = []map[string]string{{"role": "user", "content": prompt}}
+	}
+	if maxTokens <= 0 && endpoint == "/v1/messages" {
+		// Anthropic Messages API 要求 max_tokens
+		maxTokens = 1024
+	}
+	if maxTokens > 0 {
+		key := "max_tokens"
+		if endpoint == "/responses" {
+			key = "max_output_tokens"
+		}
+		body[key] = maxTokens
+	}
+	data, _ := json.Marshal(body)
+	return data
+}
+
+// sendInProcess 在网关内执行一个应用内发起的请求（如提示词库），结果格式与批量子请求相同
+func (prs *ProviderRelayService) sendInProcess(endpoint string, body []byte) (BatchItemResult, error) {
+	if prs.server == nil || prs.server.Handler == nil {
+		return BatchItemResult{}, errors.New("relay is not running")
+	}
+	if !batchEndpoints[endpoint] {
+		return BatchItemResult{}, fmt.Errorf("unsupported endpoint %q", endpoint)
+	}
+	parent, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return BatchItemResult{}, err
+	}
+	parent.RemoteAddr = "127.0.0.1:0"
+	parent.Header.Set(headerPriority, PriorityInteractive)
+	return runBatchItem(parent, prs.server.Handler, 0, endpoint, body), nil
+}
+
+// batchItemIdempotencyKey 由批量请求的 Idempotency-Key 派生每个子请求的 Key：
+// 各子请求的请求体不同，共用同一个 Key 会互相冲突（422）或重放其他子请求的响应；
+// 用同一 Key 重试整个批量请求时，已成功的子请求直接重放，不会重复计费
+func batchItemIdempotencyKey(key string, index int) string {
+	derived := fmt.Sprintf("%s#batch-%d", key, index)
+	if len(derived) > maxIdempotencyKeyLength {
+		sum := sha256.Sum256([]byte(derived))
+		derived = hex.EncodeToString(sum[:])
+	}
+	return derived
+}
+
+// runBatchItem 以父请求的身份（请求头、来源地址、TLS 客户端证书）执行一个子请求
+func runBatchItem(parent *http.Request, handler http.Handler, index int, endpoint string, body []byte) BatchItemResult {
+	usage := &batchItemUsage{}
+	ctx := context.WithValue(parent.Context(), batchUsageKey{}, usage)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return BatchItemResult{Status: http.StatusInternalServerError, Error: err.Error()}
+	}
+	req.Header = parent.Header.Clone()
+	// 父请求体已由中间件解压，子请求体是明文 JSON；响应也不压缩，便于内联到结果中
+	// 断点续传偏移针对的是整个批量响应，对子请求没有意义
+	for _, name := range []string{"Content-Length", "Content-Encoding", "Accept-Encoding", headerResumeOffset} {
+		req.Header.Del(name)
+	}
+	if key := strings.TrimSpace(req.Header.Get(headerIdempotencyKey)); key != "" {
+		req.Header.Set(headerIdempotencyKey, batchItemIdempotencyKey(key, index))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if req.Header.Get(headerPriority) == "" {
+		req.Header.Set(headerPriority, PriorityBatch)
+	}
+	req.Host = parent.Host
+	req.RemoteAddr = parent.RemoteAddr
+	req.TLS = parent.TLS
+
+	start := time.Now()
+	recorder := newBatchResponseRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	result := BatchItemResult{
+		Status:       recorder.status,
+		TraceID:      recorder.header.Get("X-Trace-ID"),
+		Provider:     usage.provider,
+		Model:        usage.model,
+		Attempts:     usage.attempts,
+		InputTokens:  usage.input,
+		OutputTokens: usage.output,
+		Cost:         usage.cost,
+		DurationMs:   time.Since(start).Milliseconds(),
+	}
+	data := recorder.body.Bytes()
+	if gjson.ValidBytes(data) {
+		result.Body = json.RawMessage(data)
+	}
+	if result.Status < 200 || result.Status >= 300 {
+		result.Error = batchErrorMessage(data)
+	}
+	return result
+}
+
+// batchErrorMessage 提取上游 / 网关错误信息（OpenAI、Anthropic 与网关自身的错误格式）
+func batchErrorMessage(data []byte) string {
+	for _, path := range []string{"error.message", "error", "message"} {
+		if v := gjson.GetBytes(data, path); v.Type == gjson.String && v.String() != "" {
+			return v.String()
+		}
+	}
+	text := strings.TrimSpace(string(data))
+	if len(text) > batchErrorPreview {
+		text = text[:batchErrorPreview] + "..."
+	}
+	if text == "" {
+		text = "request failed"
+	}
+	return text
+}
+
+// batchResponseRecorder 缓存子请求的响应（实现 http.Flusher，供流式写入路径使用）
+type batchResponseRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newBatchResponseRecorder() *batchResponseRecorder {
+	return &batchResponseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *batchResponseRecorder) Header() http.Header { return r.header }
+
+func (r *batchResponseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+func (r *batchResponseRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(data)
+}
+
+func (r *batchResponseRecorder) Flush() {}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func newBatchTestRouter(t *testing.T) (*gin.Engine, *int32) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	prs.SetBatchConcurrency(2)
+	router := gin.New()
+	var active, peak int32
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		if n := atomic.AddInt32(&active, 1); n > atomic.LoadInt32(&peak) {
+			atomic.StoreInt32(&peak, n)
+		}
+		defer atomic.AddInt32(&active, -1)
+		time.Sleep(20 * time.Millisecond)
+
+		body, _ := io.ReadAll(c.Request.Body)
+		if gjson.GetBytes(body, "stream").Bool() || c.GetHeader(headerPriority) != PriorityBatch || c.GetHeader("Authorization") != "Bearer k" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unexpected sub-request"})
+			return
+		}
+		c.Header("X-Trace-ID", "trace-"+gjson.GetBytes(body, "messages.0.content").String())
+		if gjson.GetBytes(body, "messages.0.content").String() == "fail" {
+			// 第一个 provider 失败后故障转移，仍然失败
+			recordBatchAttempt(c, &ReqeustLog{Provider: "a", Model: "m", TotalCost: 0.001})
+			recordBatchAttempt(c, &ReqeustLog{Provider: "b", Model: "m", TotalCost: 0})
+			c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": "all providers failed"}})
+			return
+		}
+		recordBatchAttempt(c, &ReqeustLog{Provider: "a", Model: "m", InputTokens: 10, OutputTokens: 5, TotalCost: 0.002})
+		c.JSON(http.StatusOK, gin.H{"choices": []gin.H{{"message": gin.H{"content": "ok"}}}})
+	})
+	router.POST("/v1/batch", prs.batchRequestHandler(router))
+	return router, &peak
+}
+
+func postBatch(router http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer k")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBatchRequest(t *testing.T) {
+	router, peak := newBatchTestRouter(t)
+	w := postBatch(router, `{"model":"m","concurrency":10,"requests":[
+		{"custom_id":"one","prompt":"1"},
+		{"custom_id":"two","body":{"model":"m","stream":true,"messages":[{"role":"user","content":"2"}]}},
+		{"custom_id":"bad","prompt":"fail"},
+		{"prompt":"4"}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []BatchItemResult `json:"results"`
+		Summary BatchSummary      `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 4 || resp.Results[1].CustomID != "two" || resp.Results[1].Status != http.StatusOK || resp.Results[1].TraceID != "trace-2" {
+		t.Fatalf("unexpected results %+v", resp.Results)
+	}
+	if ok := resp.Results[0]; ok.Provider != "a" || ok.Attempts != 1 || ok.InputTokens != 10 || gjson.GetBytes(ok.Body, "choices.0.message.content").String() != "ok" {
+		t.Fatalf("unexpected success result %+v", ok)
+	}
+	if bad := resp.Results[2]; bad.Status != http.StatusBadGateway || bad.Error != "all providers failed" || bad.Attempts != 2 || bad.Provider != "b" {
+		t.Fatalf("unexpected failure result %+v", bad)
+	}
+	s := resp.Summary
+	if s.Total != 4 || s.Succeeded != 3 || s.Failed != 1 || s.InputTokens != 30 || s.Cost < 0.0069 || s.Cost > 0.0071 {
+		t.Fatalf("unexpected summary %+v", s)
+	}
+	if got := atomic.LoadInt32(peak); got > 2 {
+		t.Fatalf("concurrency should be capped at 2, peak %d", got)
+	}
+
+	for _, body := range []string{
+		`{"requests":[]}`,
+		`{"requests":[{"prompt":"x"}]}`,
+		`{"model":"m","requests":[{"endpoint":"/v1/batch","prompt":"x"}]}`,
+		`{"requests":[{"body":[1,2]}]}`,
+	} {
+		if w := postBatch(router, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestBatchRequestStream(t *testing.T) {
+	router, _ := newBatchTestRouter(t)
+	w := postBatch(router, `{"model":"m","stream":true,"requests":[{"prompt":"1"},{"prompt":"fail"}]}`)
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("content type %q", ct)
+	}
+	var types []string
+	scanner := bufio.NewScanner(w.Body)
+	var last gjson.Result
+	for scanner.Scan() {
+		last = gjson.Parse(scanner.Text())
+		types = append(types, last.Get("type").String())
+	}
+	if strings.Join(types, ",") != "result,result,summary" || last.Get("summary.failed").Int() != 1 {
+		t.Fatalf("unexpected stream %v / %s", types, last.Raw)
+	}
+}
+
+func TestBatchPromptBody(t *testing.T) {
+	if got := string(batchPromptBody("/v1/messages", "claude", "hi", 0)); got != `{"max_tokens":1024,"messages":[{"content":"hi","role":"user"}],"model":"claude"}` {
+		t.Fatalf("messages body %s", got)
+	}
+	if got := string(batchPromptBody("/responses", "gpt", "hi", 50)); got != `{"input":"hi","max_output_tokens":50,"model":"gpt"}` {
+		t.Fatalf("responses body %s", got)
+	}
+}
+
+func TestBatchRequestIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	var calls int32
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		finish, handled := prs.beginIdempotentRequest(c, "codex", "/v1/chat/completions", body)
+		if handled {
+			return
+		}
+		defer finish()
+		atomic.AddInt32(&calls, 1)
+		if c.GetHeader(headerResumeOffset) != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resume offset leaked into sub-request"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"echo": gjson.GetBytes(body, "messages.0.content").String()})
+	})
+	router.POST("/v1/batch", prs.batchRequestHandler(router))
+
+	send := func() []BatchItemResult {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`{"model":"m","requests":[{"prompt":"1"},{"prompt":"2"},{"prompt":"1"}]}`))
+		req.Header.Set(headerIdempotencyKey, "batch-key")
+		req.Header.Set(headerResumeOffset, "10")
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Results []BatchItemResult `json:"results"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Results
+	}
+
+	// 每个子请求使用各自派生的 Key，不会因请求体不同而冲突，也不会重放其他子请求的响应
+	results := send()
+	for i, want := range []string{"1", "2", "1"} {
+		if r := results[i]; r.Status != http.StatusOK || gjson.GetBytes(r.Body, "echo").String() != want {
+			t.Fatalf("item %d: %+v", i, r)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 upstream calls, got %d", got)
+	}
+
+	// 用同一 Key 重试整个批量请求时，各子请求重放自己的响应
+	results = send()
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("retry should replay cached items, upstream calls %d", got)
+	}
+	if len(results) != 3 || gjson.GetBytes(results[1].Body, "echo").String() != "2" {
+		t.Fatalf("unexpected replayed results %+v", results)
+	}
+
+	if a, b := batchItemIdempotencyKey("k", 0), batchItemIdempotencyKey("k", 1); a == b {
+		t.Fatal("derived keys must differ per item")
+	}
+	if long := batchItemIdempotencyKey(strings.Repeat("x", maxIdempotencyKeyLength), 7); len(long) > maxIdempotencyKeyLength {
+		t.Fatalf("derived key too long: %d", len(long))
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultMaxRequestBodyBytes 默认请求体上限（32MB），足够容纳带图片的长上下文请求
+	defaultMaxRequestBodyBytes int64 = 32 << 20
+	// upstreamGzipThreshold 客户端使用压缩上传时，超过该大小的请求体转发上游时重新压缩
+	upstreamGzipThreshold = 256 << 10
+	// ctxKeyRequestEncoding 记录客户端原始 Content-Encoding
+	ctxKeyRequestEncoding = "codeswitch.request_encoding"
+)
+
+// SetMaxRequestBodySize 设置请求体大小上限（字节），<=0 时使用默认值
+func (prs *ProviderRelayService) SetMaxRequestBodySize(limit int64) {
+	if limit <= 0 {
+		limit = defaultMaxRequestBodyBytes
+	}
+	atomic.StoreInt64(&prs.maxRequestBodyBytes, limit)
+}
+
+// MaxRequestBodySize 获取当前请求体大小上限（字节）
+func (prs *ProviderRelayService) MaxRequestBodySize() int64 {
+	if limit := atomic.LoadInt64(&prs.maxRequestBodyBytes); limit > 0 {
+		return limit
+	}
+	return defaultMaxRequestBodyBytes
+}
+
+// requestBodyMiddleware 限制请求体大小并解压 gzip/deflate 请求体
+// 超限请求在读取到上限后立即中断，不会完整缓冲到内存；解压后的大小同样受上限约束，防止压缩炸弹
+func (prs *ProviderRelayService) requestBodyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		limit := prs.MaxRequestBodySize()
+		if c.Request.ContentLength > limit {
+			abortBodyTooLarge(c, limit)
+			return
+		}
+
+		raw, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+		c.Request.Body.Close()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if int64(len(raw)) > limit {
+			abortBodyTooLarge(c, limit)
+			return
+		}
+
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+		if encoding != "" && encoding != "identity" {
+			decoded, err := decodeRequestBody(encoding, raw, limit)
+			if err == errBodyTooLarge {
+				abortBodyTooLarge(c, limit)
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set(ctxKeyRequestEncoding, encoding)
+			c.Request.Header.Del("Content-Encoding")
+			raw = decoded
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+		c.Request.ContentLength = int64(len(raw))
+		c.Request.Header.Set("Content-Length", fmt.Sprint(len(raw)))
+		c.Next()
+	}
+}
+
+var errBodyTooLarge = fmt.Errorf("request body too large")
+
+// decodeRequestBody 按 Content-Encoding 解压请求体，解压结果不得超过 limit
+func decodeRequestBody(encoding string, data []byte, limit int64) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		// HTTP 的 deflate 实际多为 zlib 封装，少数客户端发送裸 deflate 流
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(data)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %s", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解压请求体失败: %w", err)
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压请求体失败: %w", err)
+	}
+	if int64(len(decoded)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return decoded, nil
+}
+
+// abortBodyTooLarge 返回 413，错误格式同时兼容 Anthropic 与 OpenAI 客户端
+func abortBodyTooLarge(c *gin.Context, limit int64) {
+	fmt.Printf("[BodyLimit] 拒绝超限请求 %s (limit=%dMB, ip=%s)\n", c.Request.URL.Path, limit>>20, c.ClientIP())
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "request_too_large",
+			"message": fmt.Sprintf("request body exceeds the %d MB limit", limit>>20),
+		},
+	})
+}
+
+// compressForUpstream 客户端以 gzip 上传且请求体较大时，转发上游前重新压缩
+// 返回待发送的请求体及需要设置的 Content-Encoding（为空表示不压缩）
+func compressForUpstream(c *gin.Context, body []byte) ([]byte, string) {
+	if c == nil || len(body) < upstreamGzipThreshold {
+		return body, ""
+	}
+	if enc := c.GetString(ctxKeyRequestEncoding); enc != "gzip" && enc != "x-gzip" {
+		return body, ""
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return body, ""
+	}
+	if err := writer.Close(); err != nil || buf.Len() >= len(body) {
+		return body, ""
+	}
+	return buf.Bytes(), "gzip"
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newBodyLimitRouter(prs *ProviderRelayService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(prs.requestBodyMiddleware())
+	router.POST("/echo", func(c *gin.Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(data))
+	})
+	return router
+}
+
+func TestRequestBodyMiddlewareRejectsOversizedBody(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.SetMaxRequestBodySize(1024)
+	router := newBodyLimitRouter(prs)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("a", 2048)))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+}
+
+func TestRequestBodyMiddlewareDecompressesGzip(t *testing.T) {
+	prs := &ProviderRelayService{}
+	router := newBodyLimitRouter(prs)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"model":"claude-sonnet-4"}`))
+	zw.Close()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/echo", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"model":"claude-sonnet-4"}` {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRequestBodyMiddlewareRejectsGzipBomb(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.SetMaxRequestBodySize(1024)
+	router := newBodyLimitRouter(prs)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(bytes.Repeat([]byte("a"), 64*1024))
+	zw.Close()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/echo", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// 灰度默认值
+const (
+	defaultCanaryDurationMinutes = 24 * 60
+	defaultCanaryMinRequests     = 20
+	defaultCanaryErrorRateDelta  = 0.05
+	defaultCanaryLatencyRatio    = 1.5
+	// canaryEvalInterval 灰度评估间隔
+	canaryEvalInterval = 5 * time.Minute
+)
+
+// 灰度事件类型
+const (
+	ProviderEventCanaryPromoted = "provider.canary_promoted"
+	ProviderEventCanaryFailed   = "provider.canary_failed"
+)
+
+// 灰度评估结论
+const (
+	CanaryDecisionPending = "pending"
+	CanaryDecisionPromote = "promote"
+	CanaryDecisionFail    = "fail"
+)
+
+// CanaryConfig 新 provider 的灰度配置：试用期内只接收 Percent% 的匹配流量，
+// 与同平台的在任 provider 比较错误率与平均耗时，到期后自动转正，超出阈值时自动停用
+type CanaryConfig struct {
+	Percent           int     `json:"percent"`                     // 分配给该 provider 的流量比例，1-99
+	StartedAt         int64   `json:"startedAt,omitempty"`         // 灰度开始时间（Unix 秒），保存时自动填写
+	DurationMinutes   int     `json:"durationMinutes,omitempty"`   // 试用期，默认 24 小时
+	MinRequests       int     `json:"minRequests,omitempty"`       // 做出判定所需的最少请求数，默认 20
+	MaxErrorRateDelta float64 `json:"maxErrorRateDelta,omitempty"` // 错误率最多比在任 provider 高多少（0.05 = 5 个百分点）
+	MaxLatencyRatio   float64 `json:"maxLatencyRatio,omitempty"`   // 平均耗时最多为在任 provider 的多少倍，默认 1.5
+}
+
+// Validate 检查流量比例与阈值
+func (c CanaryConfig) Validate() error {
+	if c.Percent < 1 || c.Percent > 99 {
+		return fmt.Errorf("percent must be between 1 and 99")
+	}
+	if c.DurationMinutes < 0 || c.MinRequests < 0 || c.MaxErrorRateDelta < 0 {
+		return fmt.Errorf("durationMinutes, minRequests and maxErrorRateDelta must not be negative")
+	}
+	if c.MaxLatencyRatio != 0 && c.MaxLatencyRatio < 1 {
+		return fmt.Errorf("maxLatencyRatio must be at least 1")
+	}
+	return nil
+}
+
+// withDefaults 填充未设置的阈值
+func (c CanaryConfig) withDefaults() CanaryConfig {
+	if c.DurationMinutes == 0 {
+		c.DurationMinutes = defaultCanaryDurationMinutes
+	}
+	if c.MinRequests == 0 {
+		c.MinRequests = defaultCanaryMinRequests
+	}
+	if c.MaxErrorRateDelta == 0 {
+		c.MaxErrorRateDelta = defaultCanaryErrorRateDelta
+	}
+	if c.MaxLatencyRatio == 0 {
+		c.MaxLatencyRatio = defaultCanaryLatencyRatio
+	}
+	return c
+}
+
+// stampCanaryStart 为新开启灰度的 provider 填写开始时间，返回副本避免修改调用方的数据
+func stampCanaryStart(providers []Provider) []Provider {
+	result := make([]Provider, len(providers))
+	copy(result, providers)
+	now := time.Now().Unix()
+	for i := range result {
+		if result[i].Canary != nil && result[i].Canary.StartedAt == 0 {
+			canary := *result[i].Canary
+			canary.StartedAt = now
+			result[i].Canary = &canary
+		}
+	}
+	return result
+}
+
+// applyCanary 按灰度比例分流：命中时灰度 provider 排在首位且返回 true（调用方不再轮询），
+// 未命中时移除灰度 provider；只剩灰度 provider 可用时原样返回
+func (prs *ProviderRelayService) applyCanary(kind string, active []Provider) ([]Provider, bool) {
+	canaries := make([]Provider, 0)
+	incumbents := make([]Provider, 0, len(active))
+	for _, p := range active {
+		if p.Canary != nil {
+			canaries = append(canaries, p)
+		} else {
+			incumbents = append(incumbents, p)
+		}
+	}
+	if len(canaries) == 0 || len(incumbents) == 0 {
+		return active, false
+	}
+
+	roll := rand.Intn(100)
+	for _, p := range canaries {
+		if roll < p.Canary.Percent {
+			fmt.Printf("[Canary] %s/%s 命中灰度流量（%d%%）\n", kind, p.Name, p.Canary.Percent)
+			return append([]Provider{p}, incumbents...), true
+		}
+		roll -= p.Canary.Percent
+	}
+	return incumbents, false
+}
+
+// CanaryStats 灰度期间的请求统计
+type CanaryStats struct {
+	Requests      int     `json:"requests"`
+	Errors        int     `json:"errors"`
+	ErrorRate     float64 `json:"error_rate"`
+	AvgDurationMs float64 `json:"avg_duration_ms"` // 仅统计成功请求
+}
+
+// CanaryReport 单个灰度 provider 的评估结果
+type CanaryReport struct {
+	Platform  string       `json:"platform"`
+	Provider  string       `json:"provider"`
+	Config    CanaryConfig `json:"config"`
+	EndsAt    int64        `json:"ends_at"`
+	Canary    CanaryStats  `json:"canary"`
+	Incumbent CanaryStats  `json:"incumbent"` // 同平台其他非灰度 provider 的合计
+	Decision  string       `json:"decision"`
+	Reason    string       `json:"reason,omitempty"`
+}
+
+// evaluateCanary 比较灰度与在任 provider：样本足够且超出阈值时立即判定失败，试用期结束且样本足够时转正
+func evaluateCanary(cfg CanaryConfig, canary, incumbent CanaryStats, now time.Time) (string, string) {
+	cfg = cfg.withDefaults()
+	if canary.Requests >= cfg.MinRequests {
+		if canary.ErrorRate > incumbent.ErrorRate+cfg.MaxErrorRateDelta {
+			return CanaryDecisionFail, fmt.Sprintf("错误率 %.1f%% 高于在任 provider 的 %.1f%%（允许 +%.1f%%）",
+				canary.ErrorRate*100, incumbent.ErrorRate*100, cfg.MaxErrorRateDelta*100)
+		}
+		if incumbent.AvgDurationMs > 0 && canary.AvgDurationMs > incumbent.AvgDurationMs*cfg.MaxLatencyRatio {
+			return CanaryDecisionFail, fmt.Sprintf("平均耗时 %.0fms 超过在任 provider %.0fms 的 %.1f 倍",
+				canary.AvgDurationMs, incumbent.AvgDurationMs, cfg.MaxLatencyRatio)
+		}
+	}
+	endsAt := time.Unix(cfg.StartedAt, 0).Add(time.Duration(cfg.DurationMinutes) * time.Minute)
+	if now.Before(endsAt) {
+		return CanaryDecisionPending, ""
+	}
+	if canary.Requests < cfg.MinRequests {
+		return CanaryDecisionPending, fmt.Sprintf("试用期已结束，但仅有 %d/%d 个请求，继续观察", canary.Requests, cfg.MinRequests)
+	}
+	return CanaryDecisionPromote, fmt.Sprintf("%d 个请求，错误率 %.1f%%", canary.Requests, canary.ErrorRate*100)
+}
+
+// queryCanaryStats 统计平台自 since 起各 provider 的请求数、错误数与成功请求的平均耗时
+func queryCanaryStats(kind string, since time.Time) (map[string]CanaryStats, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	const failed = "(http_code < 200 OR http_code >= 500 OR http_code IN (401, 403, 429))"
+	rows, err := db.Query(`SELECT provider, COUNT(*),
+		SUM(CASE WHEN `+failed+` THEN 1 ELSE 0 END),
+		AVG(CASE WHEN `+failed+` THEN NULL ELSE duration_sec END)
+		FROM request_log WHERE platform = ? AND created_at >= ? GROUP BY provider`,
+		kind, since.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]CanaryStats)
+	for rows.Next() {
+		var (
+			provider string
+			s        CanaryStats
+			avg      sql.NullFloat64
+		)
+		if err := rows.Scan(&provider, &s.Requests, &s.Errors, &avg); err != nil {
+			return nil, err
+		}
+		s.AvgDurationMs = avg.Float64 * 1000
+		stats[provider] = s
+	}
+	return stats, rows.Err()
+}
+
+// combineCanaryStats 合并多个 provider 的统计
+func combineCanaryStats(items []CanaryStats) CanaryStats {
+	var total CanaryStats
+	var durationSum float64
+	var successes int
+	for _, s := range items {
+		total.Requests += s.Requests
+		total.Errors += s.Errors
+		ok := s.Requests - s.Errors
+		durationSum += s.AvgDurationMs * float64(ok)
+		successes += ok
+	}
+	if total.Requests > 0 {
+		total.ErrorRate = float64(total.Errors) / float64(total.Requests)
+	}
+	if successes > 0 {
+		total.AvgDurationMs = durationSum / float64(successes)
+	}
+	return total
+}
+
+// GetCanaryReports 评估平台上所有灰度中的 provider（不做变更）
+func (prs *ProviderRelayService) GetCanaryReports(kind string) ([]CanaryReport, error) {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]CanaryReport, 0)
+	for _, p := range providers {
+		if p.Canary == nil || !p.Enabled {
+			continue
+		}
+		cfg := p.Canary.withDefaults()
+		stats, err := queryCanaryStats(kind, time.Unix(cfg.StartedAt, 0))
+		if err != nil {
+			return nil, err
+		}
+		incumbents := make([]CanaryStats, 0, len(providers))
+		for _, other := range providers {
+			if other.Name != p.Name && other.Canary == nil {
+				incumbents = append(incumbents, stats[other.Name])
+			}
+		}
+		report := CanaryReport{
+			Platform:  kind,
+			Provider:  p.Name,
+			Config:    cfg,
+			EndsAt:    cfg.StartedAt + int64(cfg.DurationMinutes)*60,
+			Canary:    combineCanaryStats([]CanaryStats{stats[p.Name]}),
+			Incumbent: combineCanaryStats(incumbents),
+		}
+		report.Decision, report.Reason = evaluateCanary(cfg, report.Canary, report.Incumbent, time.Now())
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// EvaluateCanaries 评估所有平台的灰度 provider：转正的清除灰度配置，失败的自动停用，并推送事件通知。
+// 返回已做出判定的结果
+func (prs *ProviderRelayService) EvaluateCanaries() []CanaryReport {
+	decided := make([]CanaryReport, 0)
+	for _, kind := range []string{"claude", "codex", "gemini-cli", "picoclaw"} {
+		reports, err := prs.GetCanaryReports(kind)
+		if err != nil {
+			fmt.Printf("[Canary] 评估 %s 失败: %v\n", kind, err)
+			continue
+		}
+		for _, report := range reports {
+			if report.Decision == CanaryDecisionPending {
+				continue
+			}
+			if err := prs.finishCanary(report); err != nil {
+				fmt.Printf("[Canary] 更新 %s/%s 失败: %v\n", kind, report.Provider, err)
+				continue
+			}
+			decided = append(decided, report)
+		}
+	}
+	return decided
+}
+
+// finishCanary 应用评估结论：转正时以完整权重参与路由，失败时停用
+func (prs *ProviderRelayService) finishCanary(report CanaryReport) error {
+	providers, err := prs.providerService.LoadProviders(report.Platform)
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range providers {
+		if providers[i].Name != report.Provider || providers[i].Canary == nil {
+			continue
+		}
+		providers[i].Canary = nil
+		if report.Decision == CanaryDecisionFail {
+			providers[i].Enabled = false
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("provider %s 不在灰度中", report.Provider)
+	}
+	if err := prs.providerService.SaveProviders(report.Platform, providers); err != nil {
+		return err
+	}
+
+	event := ProviderEvent{Type: ProviderEventCanaryPromoted, Platform: report.Platform, Provider: report.Provider, Reason: report.Reason}
+	if report.Decision == CanaryDecisionFail {
+		event.Type = ProviderEventCanaryFailed
+		fmt.Printf("[Canary] %s/%s 灰度失败，已停用: %s\n", report.Platform, report.Provider, report.Reason)
+	} else {
+		fmt.Printf("[Canary] %s/%s 灰度通过，已转正: %s\n", report.Platform, report.Provider, report.Reason)
+	}
+	prs.emitProviderEvent(event)
+	return nil
+}
+
+// StartCanary 为 provider 开启灰度（重新开启时从当前时间重新计算试用期）
+func (prs *ProviderRelayService) StartCanary(kind, providerName string, cfg CanaryConfig) error {
+	cfg.StartedAt = time.Now().Unix()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return err
+	}
+	for i := range providers {
+		if providers[i].Name == providerName {
+			providers[i].Canary = &cfg
+			providers[i].Enabled = true
+			return prs.providerService.SaveProviders(kind, providers)
+		}
+	}
+	return fmt.Errorf("provider %s 不存在", providerName)
+}
+
+// startCanaryEvalTask 定期评估灰度 provider
+func (prs *ProviderRelayService) startCanaryEvalTask() {
+	ticker := time.NewTicker(canaryEvalInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		prs.EvaluateCanaries()
+	}
+}
+
+func (prs *ProviderRelayService) adminGetCanariesHandler(c *gin.Context) {
+	reports, err := prs.GetCanaryReports(c.Param("kind"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"canaries": reports})
+}
+
+func (prs *ProviderRelayService) adminStartCanaryHandler(c *gin.Context) {
+	var cfg CanaryConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	name := strings.TrimSpace(c.Param("name"))
+	if err := prs.StartCanary(c.Param("kind"), name, cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (prs *ProviderRelayService) adminEvaluateCanariesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"decided": prs.EvaluateCanaries()})
+}
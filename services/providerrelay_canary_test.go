@@ -0,0 +1,136 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestCanaryConfigValidate(t *testing.T) {
+	invalid := []CanaryConfig{
+		{Percent: 0},
+		{Percent: 100},
+		{Percent: 10, MinRequests: -1},
+		{Percent: 10, MaxLatencyRatio: 0.5},
+	}
+	for i, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("case %d: expected validation error", i)
+		}
+	}
+	if err := (CanaryConfig{Percent: 10}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyCanarySplitsTraffic(t *testing.T) {
+	prs := &ProviderRelayService{}
+	active := []Provider{
+		{Name: "incumbent"},
+		{Name: "new", Canary: &CanaryConfig{Percent: 20}},
+	}
+	hits := 0
+	for i := 0; i < 2000; i++ {
+		routed, hit := prs.applyCanary("claude", active)
+		if hit {
+			hits++
+			if routed[0].Name != "new" || len(routed) != 2 {
+				t.Fatalf("canary hit order = %+v", routed)
+			}
+		} else if len(routed) != 1 || routed[0].Name != "incumbent" {
+			t.Fatalf("canary miss should drop the canary: %+v", routed)
+		}
+	}
+	if hits < 250 || hits > 550 {
+		t.Fatalf("canary received %d/2000 requests, want about 20%%", hits)
+	}
+
+	// Only canaries left: keep them instead of failing the request
+	routed, hit := prs.applyCanary("claude", active[1:])
+	if hit || len(routed) != 1 {
+		t.Fatalf("canary-only list = %+v, hit = %v", routed, hit)
+	}
+}
+
+func TestEvaluateCanaryDecision(t *testing.T) {
+	start := time.Now().Add(-2 * time.Hour)
+	cfg := CanaryConfig{Percent: 10, StartedAt: start.Unix(), DurationMinutes: 60, MinRequests: 10}
+	incumbent := CanaryStats{Requests: 100, Errors: 2, ErrorRate: 0.02, AvgDurationMs: 1000}
+
+	if d, _ := evaluateCanary(cfg, CanaryStats{Requests: 20, Errors: 5, ErrorRate: 0.25, AvgDurationMs: 900}, incumbent, time.Now()); d != CanaryDecisionFail {
+		t.Fatalf("high error rate decision = %s", d)
+	}
+	if d, _ := evaluateCanary(cfg, CanaryStats{Requests: 20, AvgDurationMs: 2000}, incumbent, time.Now()); d != CanaryDecisionFail {
+		t.Fatalf("slow canary decision = %s", d)
+	}
+	if d, _ := evaluateCanary(cfg, CanaryStats{Requests: 20, AvgDurationMs: 1100}, incumbent, time.Now()); d != CanaryDecisionPromote {
+		t.Fatalf("healthy canary decision = %s", d)
+	}
+	if d, reason := evaluateCanary(cfg, CanaryStats{Requests: 3}, incumbent, time.Now()); d != CanaryDecisionPending || reason == "" {
+		t.Fatalf("insufficient samples decision = %s (%s)", d, reason)
+	}
+	// Still in probation: healthy canaries keep waiting
+	if d, _ := evaluateCanary(cfg, CanaryStats{Requests: 20, AvgDurationMs: 1100}, incumbent, start.Add(30*time.Minute)); d != CanaryDecisionPending {
+		t.Fatalf("probation decision = %s", d)
+	}
+}
+
+func TestEvaluateCanariesDisablesFailingProvider(t *testing.T) {
+	openAnalyticsDB(t, "canary.db")
+
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	events := make(chan ProviderEvent, 1)
+	prs.OnProviderEvent(func(e ProviderEvent) { events <- e })
+	if err := prs.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "incumbent", APIURL: "https://a.example.com", APIKey: "k", Enabled: true},
+		{ID: 2, Name: "new", APIURL: "https://b.example.com", APIKey: "k", Enabled: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := prs.StartCanary("claude", "new", CanaryConfig{Percent: 10, MinRequests: 5}); err != nil {
+		t.Fatal(err)
+	}
+	providers, _ := prs.providerService.LoadProviders("claude")
+	if providers[1].Canary == nil || providers[1].Canary.StartedAt == 0 {
+		t.Fatalf("canary not started: %+v", providers[1].Canary)
+	}
+
+	db, _ := xdb.DB("default")
+	now := time.Now().UTC().Format(timeLayout)
+	for i := 0; i < 10; i++ {
+		code := 200
+		if i%2 == 0 {
+			code = 502
+		}
+		if _, err := db.Exec(`INSERT INTO request_log (platform, provider, model, http_code, duration_sec, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			"claude", "new", "claude-sonnet-4", code, 1.0, now); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO request_log (platform, provider, model, http_code, duration_sec, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			"claude", "incumbent", "claude-sonnet-4", 200, 1.0, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, err := prs.GetCanaryReports("claude")
+	if err != nil || len(reports) != 1 || reports[0].Canary.Requests != 10 || reports[0].Incumbent.ErrorRate != 0 {
+		t.Fatalf("reports = %+v, err = %v", reports, err)
+	}
+	decided := prs.EvaluateCanaries()
+	if len(decided) != 1 || decided[0].Decision != CanaryDecisionFail {
+		t.Fatalf("decided = %+v", decided)
+	}
+	providers, _ = prs.providerService.LoadProviders("claude")
+	if providers[1].Enabled || providers[1].Canary != nil {
+		t.Fatalf("failed canary should be disabled: %+v", providers[1])
+	}
+	select {
+	case e := <-events:
+		if e.Type != ProviderEventCanaryFailed || e.Provider != "new" {
+			t.Fatalf("event = %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no canary event emitted")
+	}
+}
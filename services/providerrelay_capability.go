@@ -0,0 +1,401 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 请求可能需要的 provider 能力
+const (
+	CapabilityVision    = "vision"
+	CapabilityTools     = "tools"
+	CapabilityJSONMode  = "json_mode"
+	CapabilityReasoning = "reasoning"
+)
+
+// imageJPEGQualities 图片超过大小上限时依次尝试的 JPEG 质量
+var imageJPEGQualities = []int{85, 70, 55, 40}
+
+// ProviderCapabilities provider 支持的能力，未设置的项视为支持（兼容未声明能力的旧配置）
+type ProviderCapabilities struct {
+	Vision    *bool `json:"vision,omitempty"`
+	Tools     *bool `json:"tools,omitempty"`
+	JSONMode  *bool `json:"jsonMode,omitempty"`
+	Reasoning *bool `json:"reasoning,omitempty"`
+	// 原生支持旧版 /v1/completions；与其他能力不同，未设置时视为不支持，请求转换为 Chat 格式
+	Completions *bool `json:"completions,omitempty"`
+
+	// 图片限制：超出时等比缩小并重新编码为 JPEG（支持 PNG / JPEG / GIF，其他格式原样转发）
+	MaxImageBytes     int `json:"maxImageBytes,omitempty"`     // base64 解码后的字节数
+	MaxImageDimension int `json:"maxImageDimension,omitempty"` // 最长边像素
+}
+
+// Validate 检查图片限制
+func (pc ProviderCapabilities) Validate() error {
+	if pc.MaxImageBytes < 0 || pc.MaxImageDimension < 0 {
+		return fmt.Errorf("image limits must not be negative")
+	}
+	return nil
+}
+
+// capabilityError 没有 provider 具备请求所需的能力
+type capabilityError struct {
+	required []string
+}
+
+func (e *capabilityError) Error() string {
+	return fmt.Sprintf("没有可用的 provider 支持请求所需的能力: %s", strings.Join(e.required, ", "))
+}
+
+// writeCapabilityError 所需能力无 provider 支持时返回给客户端
+func writeCapabilityError(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "type": "capability_unsupported"})
+}
+
+// supports provider 是否具备指定能力；配置了 JSON 模式保证的 provider 由网关补足 json_mode
+func (p Provider) supports(capability string) bool {
+	if capability == CapabilityJSONMode && p.JSONMode != JSONModeNative {
+		return true
+	}
+	flag := p.Capabilities.flag(capability)
+	return flag == nil || *flag
+}
+
+// flag 能力的声明值，未声明时为 nil
+func (pc *ProviderCapabilities) flag(capability string) *bool {
+	if pc == nil {
+		return nil
+	}
+	switch capability {
+	case CapabilityVision:
+		return pc.Vision
+	case CapabilityTools:
+		return pc.Tools
+	case CapabilityJSONMode:
+		return pc.JSONMode
+	case CapabilityReasoning:
+		return pc.Reasoning
+	}
+	return nil
+}
+
+// missingCapabilities 返回 provider 不具备的所需能力
+func (p Provider) missingCapabilities(required []string) []string {
+	var missing []string
+	for _, capability := range required {
+		if !p.supports(capability) {
+			missing = append(missing, capability)
+		}
+	}
+	return missing
+}
+
+// providerMissingCapabilities provider 不具备的所需能力；provider 未声明的能力再参考模型数据
+// （内置价格表与用户覆盖文件）中对实际发送模型明确标记为不支持的项
+func (prs *ProviderRelayService) providerMissingCapabilities(provider Provider, model string, required []string) []string {
+	missing := provider.missingCapabilities(required)
+	if len(missing) > 0 || len(required) == 0 || model == "" {
+		return missing
+	}
+	info, ok := prs.pricingService.ModelInfo(provider.GetEffectiveModel(model))
+	if !ok {
+		return nil
+	}
+	for _, capability := range required {
+		if provider.Capabilities.flag(capability) != nil {
+			continue
+		}
+		var modelFlag *bool
+		switch capability {
+		case CapabilityVision:
+			modelFlag = info.Vision
+		case CapabilityTools:
+			modelFlag = info.Tools
+		case CapabilityJSONMode:
+			// 网关补足 JSON 模式的 provider 不依赖模型能力
+			if provider.JSONMode != JSONModeNative {
+				continue
+			}
+			modelFlag = info.JSONMode
+		case CapabilityReasoning:
+			modelFlag = info.Reasoning
+		}
+		if modelFlag != nil && !*modelFlag {
+			missing = append(missing, capability)
+		}
+	}
+	return missing
+}
+
+// detectRequiredCapabilities 从请求体识别所需能力（Anthropic Messages / OpenAI Chat / Responses / Gemini）
+func detectRequiredCapabilities(body []byte) []string {
+	if len(body) == 0 || !gjson.ValidBytes(body) {
+		return nil
+	}
+	req := gjson.ParseBytes(body)
+	required := make([]string, 0, 4)
+	if len(imageLocations(body)) > 0 || hasImageURL(req) {
+		required = append(required, CapabilityVision)
+	}
+	if len(req.Get("tools").Array()) > 0 {
+		required = append(required, CapabilityTools)
+	}
+	formatType := req.Get("response_format.type").String()
+	if formatType == "" {
+		formatType = req.Get("text.format.type").String()
+	}
+	if formatType == "json_object" || formatType == "json_schema" || req.Get("generationConfig.responseMimeType").String() == "application/json" {
+		required = append(required, CapabilityJSONMode)
+	}
+	if req.Get("thinking.type").String() == "enabled" || req.Get("reasoning_effort").Exists() ||
+		req.Get("reasoning.effort").Exists() || req.Get("generationConfig.thinkingConfig").Exists() {
+		required = append(required, CapabilityReasoning)
+	}
+	sort.Strings(required)
+	return required
+}
+
+// hasImageURL 以 URL（非 base64）引用的图片，无法本地缩放但同样需要 vision 能力
+func hasImageURL(req gjson.Result) bool {
+	found := false
+	visit := func(_, part gjson.Result) bool {
+		switch part.Get("type").String() {
+		case "image_url", "input_image", "image":
+			found = true
+		}
+		if part.Get("fileData").Exists() && strings.HasPrefix(part.Get("fileData.mimeType").String(), "image/") {
+			found = true
+		}
+		return !found
+	}
+	for _, list := range []string{"messages", "input", "contents"} {
+		req.Get(list).ForEach(func(_, msg gjson.Result) bool {
+			msg.Get("content").ForEach(visit)
+			msg.Get("parts").ForEach(visit)
+			return !found
+		})
+	}
+	return found
+}
+
+// imageLocation 请求体中一张 base64 图片的位置
+type imageLocation struct {
+	dataPath  string // base64 数据（或 data URI）所在路径
+	mimePath  string // 单独保存媒体类型的路径，data URI 时为空
+	mediaType string
+	data      string // 纯 base64 数据
+}
+
+// imageLocations 查找请求体中的 base64 图片
+func imageLocations(body []byte) []imageLocation {
+	req := gjson.ParseBytes(body)
+	var locations []imageLocation
+	addDataURI := func(path, uri string) {
+		if mediaType, data, ok := parseImageDataURI(uri); ok {
+			locations = append(locations, imageLocation{dataPath: path, mediaType: mediaType, data: data})
+		}
+	}
+	for _, list := range []string{"messages", "input"} {
+		req.Get(list).ForEach(func(i, msg gjson.Result) bool {
+			msg.Get("content").ForEach(func(j, part gjson.Result) bool {
+				base := fmt.Sprintf("%s.%d.content.%d", list, i.Int(), j.Int())
+				switch part.Get("type").String() {
+				case "image": // Anthropic
+					if part.Get("source.type").String() == "base64" {
+						locations = append(locations, imageLocation{
+							dataPath:  base + ".source.data",
+							mimePath:  base + ".source.media_type",
+							mediaType: part.Get("source.media_type").String(),
+							data:      part.Get("source.data").String(),
+						})
+					}
+				case "image_url": // OpenAI Chat
+					addDataURI(base+".image_url.url", part.Get("image_url.url").String())
+				case "input_image": // OpenAI Responses
+					addDataURI(base+".image_url", part.Get("image_url").String())
+				}
+				return true
+			})
+			return true
+		})
+	}
+	req.Get("contents").ForEach(func(i, content gjson.Result) bool { // Gemini
+		content.Get("parts").ForEach(func(j, part gjson.Result) bool {
+			for _, key := range []string{"inlineData", "inline_data"} {
+				inline := part.Get(key)
+				mimeKey := "mimeType"
+				if !inline.Get(mimeKey).Exists() {
+					mimeKey = "mime_type"
+				}
+				if inline.Exists() && strings.HasPrefix(inline.Get(mimeKey).String(), "image/") {
+					base := fmt.Sprintf("contents.%d.parts.%d.%s", i.Int(), j.Int(), key)
+					locations = append(locations, imageLocation{
+						dataPath:  base + ".data",
+						mimePath:  base + "." + mimeKey,
+						mediaType: inline.Get(mimeKey).String(),
+						data:      inline.Get("data").String(),
+					})
+				}
+			}
+			return true
+		})
+		return true
+	})
+	return locations
+}
+
+// parseImageDataURI 解析 data:image/png;base64,... 形式的图片
+func parseImageDataURI(uri string) (string, string, bool) {
+	if !strings.HasPrefix(uri, "data:image/") {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(header, ";base64"), data, true
+}
+
+// adaptImagesForProvider 按 provider 的图片限制缩小 / 重新编码请求中的图片；无需处理或处理失败的图片原样保留
+func adaptImagesForProvider(provider Provider, body []byte) []byte {
+	caps := provider.Capabilities
+	if caps == nil || (caps.MaxImageBytes <= 0 && caps.MaxImageDimension <= 0) || !gjson.ValidBytes(body) {
+		return body
+	}
+	for _, loc := range imageLocations(body) {
+		raw, err := base64.StdEncoding.DecodeString(loc.data)
+		if err != nil {
+			continue
+		}
+		resized, mediaType, changed, err := fitImage(raw, caps.MaxImageBytes, caps.MaxImageDimension)
+		if err != nil {
+			fmt.Printf("[Image] provider %s 的图片无法缩放，原样转发: %v\n", provider.Name, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		encoded := base64.StdEncoding.EncodeToString(resized)
+		value := encoded
+		if loc.mimePath == "" {
+			value = "data:" + mediaType + ";base64," + encoded
+		}
+		updated, err := sjson.SetBytes(body, loc.dataPath, value)
+		if err != nil {
+			continue
+		}
+		if loc.mimePath != "" {
+			if updated, err = sjson.SetBytes(updated, loc.mimePath, mediaType); err != nil {
+				continue
+			}
+		}
+		fmt.Printf("[Image] 为 provider %s 缩放图片: %d -> %d 字节 (%s -> %s)\n", provider.Name, len(raw), len(resized), loc.mediaType, mediaType)
+		body = updated
+	}
+	return body
+}
+
+// fitImage 将图片缩小到最长边不超过 maxDimension、大小不超过 maxBytes（0 表示不限制）。
+// 返回新图片、媒体类型以及是否发生了变化
+func fitImage(raw []byte, maxBytes, maxDimension int) ([]byte, string, bool, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", false, err
+	}
+	longest := cfg.Width
+	if cfg.Height > longest {
+		longest = cfg.Height
+	}
+	tooLarge := maxDimension > 0 && longest > maxDimension
+	tooHeavy := maxBytes > 0 && len(raw) > maxBytes
+	if !tooLarge && !tooHeavy {
+		return raw, "", false, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", false, err
+	}
+	scale := 1.0
+	if tooLarge {
+		scale = float64(maxDimension) / float64(longest)
+	}
+	for attempt := 0; attempt < 6; attempt++ {
+		scaled := resizeImage(src, scale)
+		for _, quality := range imageJPEGQualities {
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality}); err != nil {
+				return nil, "", false, err
+			}
+			if maxBytes <= 0 || buf.Len() <= maxBytes {
+				return buf.Bytes(), "image/jpeg", true, nil
+			}
+		}
+		scale *= 0.75
+	}
+	return nil, "", false, fmt.Errorf("无法压缩到 %d 字节以内", maxBytes)
+}
+
+// resizeImage 按比例缩放（区域平均），透明部分以白色填充
+func resizeImage(src image.Image, scale float64) *image.RGBA {
+	bounds := src.Bounds()
+	width := int(float64(bounds.Dx())*scale + 0.5)
+	height := int(float64(bounds.Dy())*scale + 0.5)
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, src, bounds.Min, draw.Over)
+	if width >= bounds.Dx() && height >= bounds.Dy() {
+		return flat
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xRatio := float64(bounds.Dx()) / float64(width)
+	yRatio := float64(bounds.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + int(float64(y)*yRatio)
+		y1 := bounds.Min.Y + int(float64(y+1)*yRatio)
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + int(float64(x)*xRatio)
+			x1 := bounds.Min.X + int(float64(x+1)*xRatio)
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					offset := flat.PixOffset(sx, sy)
+					r += uint32(flat.Pix[offset])
+					g += uint32(flat.Pix[offset+1])
+					b += uint32(flat.Pix[offset+2])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255})
+		}
+	}
+	return dst
+}
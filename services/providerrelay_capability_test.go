@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestDetectRequiredCapabilities(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"plain", `{"messages":[{"role":"user","content":"hi"}]}`, []string{}},
+		{"anthropic image", `{"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAAA"}}]}]}`, []string{CapabilityVision}},
+		{"openai image url", `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://x/y.png"}}]}],"tools":[{"type":"function"}]}`, []string{CapabilityTools, CapabilityVision}},
+		{"responses json", `{"input":[{"role":"user","content":[{"type":"input_text","text":"hi"}]}],"text":{"format":{"type":"json_object"}},"reasoning":{"effort":"high"}}`, []string{CapabilityJSONMode, CapabilityReasoning}},
+		{"anthropic thinking", `{"messages":[],"thinking":{"type":"enabled","budget_tokens":1024}}`, []string{CapabilityReasoning}},
+		{"gemini inline image", `{"contents":[{"parts":[{"inlineData":{"mimeType":"image/jpeg","data":"AAAA"}}]}]}`, []string{CapabilityVision}},
+	}
+	for _, tc := range cases {
+		got := detectRequiredCapabilities([]byte(tc.body))
+		if len(got) == 0 && len(tc.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMissingCapabilities(t *testing.T) {
+	no := false
+	required := []string{CapabilityJSONMode, CapabilityVision}
+
+	if missing := (Provider{}).missingCapabilities(required); len(missing) != 0 {
+		t.Fatalf("undeclared capabilities should be assumed: %v", missing)
+	}
+	textOnly := Provider{Capabilities: &ProviderCapabilities{Vision: &no, JSONMode: &no}}
+	if missing := textOnly.missingCapabilities(required); !reflect.DeepEqual(missing, required) {
+		t.Fatalf("missing = %v", missing)
+	}
+	// JSON 模式由网关保证时不再要求原生支持
+	textOnly.JSONMode = JSONModeEnforce
+	if missing := textOnly.missingCapabilities(required); !reflect.DeepEqual(missing, []string{CapabilityVision}) {
+		t.Fatalf("missing with enforced json mode = %v", missing)
+	}
+	if err := (ProviderCapabilities{MaxImageBytes: -1}).Validate(); err == nil {
+		t.Fatal("negative image limit should be rejected")
+	}
+}
+
+func testPNG(t *testing.T, width, height int) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func decodedSize(t *testing.T, data string) (image.Config, int) {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("expected jpeg: %v", err)
+	}
+	return cfg, len(raw)
+}
+
+func TestAdaptImagesForProvider(t *testing.T) {
+	data := testPNG(t, 400, 200)
+	anthropic := []byte(`{"messages":[{"role":"user","content":[{"type":"text","text":"look"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + data + `"}}]}]}`)
+	openai := []byte(`{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,` + data + `"}}]}]}`)
+	gemini := []byte(`{"contents":[{"parts":[{"inlineData":{"mimeType":"image/png","data":"` + data + `"}}]}]}`)
+
+	// 未配置限制时原样转发
+	if out := adaptImagesForProvider(Provider{}, anthropic); !bytes.Equal(out, anthropic) {
+		t.Fatal("body should be unchanged without image limits")
+	}
+
+	provider := Provider{Name: "small", Capabilities: &ProviderCapabilities{MaxImageDimension: 100, MaxImageBytes: 20000}}
+
+	out := adaptImagesForProvider(provider, anthropic)
+	if gjson.GetBytes(out, "messages.0.content.1.source.media_type").String() != "image/jpeg" {
+		t.Fatalf("media type not updated: %s", gjson.GetBytes(out, "messages.0.content.1.source.media_type"))
+	}
+	cfg, size := decodedSize(t, gjson.GetBytes(out, "messages.0.content.1.source.data").String())
+	if cfg.Width != 100 || cfg.Height != 50 || size > 20000 {
+		t.Fatalf("anthropic image = %dx%d, %d bytes", cfg.Width, cfg.Height, size)
+	}
+
+	out = adaptImagesForProvider(provider, openai)
+	mediaType, encoded, ok := parseImageDataURI(gjson.GetBytes(out, "messages.0.content.0.image_url.url").String())
+	if !ok || mediaType != "image/jpeg" {
+		t.Fatalf("openai data uri = %s", gjson.GetBytes(out, "messages.0.content.0.image_url.url"))
+	}
+	if cfg, _ = decodedSize(t, encoded); cfg.Width != 100 {
+		t.Fatalf("openai image width = %d", cfg.Width)
+	}
+
+	out = adaptImagesForProvider(provider, gemini)
+	if gjson.GetBytes(out, "contents.0.parts.0.inlineData.mimeType").String() != "image/jpeg" {
+		t.Fatalf("gemini body = %.200s", out)
+	}
+
+	// 已满足限制的图片不做处理
+	roomy := Provider{Capabilities: &ProviderCapabilities{MaxImageDimension: 1000}}
+	if out := adaptImagesForProvider(roomy, anthropic); !bytes.Equal(out, anthropic) {
+		t.Fatal("image within limits should be unchanged")
+	}
+}
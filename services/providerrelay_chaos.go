@@ -0,0 +1,337 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 混沌测试：在网关内置一个假的上游（/__chaos），按比例注入延迟、429/500、断连与截断的 SSE 流，
+// 用于在真实故障之前验证 agent 与网关故障切换的行为。仅用于调试，默认关闭，配置不落盘。
+
+// 故障类型（也可由客户端通过 X-Chaos-Fault 请求头强制指定）
+const (
+	ChaosFaultLatency     = "latency"
+	ChaosFaultRateLimit   = "rate_limit"
+	ChaosFaultServerError = "server_error"
+	ChaosFaultDisconnect  = "disconnect"
+	ChaosFaultTruncate    = "truncate"
+)
+
+const (
+	chaosRoutePrefix   = "/__chaos"
+	headerChaosFault   = "X-Chaos-Fault"
+	chaosResponseText  = "This is a simulated response from the chaos provider."
+	chaosChunkInterval = 20 * time.Millisecond
+)
+
+// ChaosConfig 混沌测试配置
+type ChaosConfig struct {
+	Enabled bool `json:"enabled"`
+	// FaultRate 注入故障的请求比例 [0, 1]
+	FaultRate float64 `json:"fault_rate"`
+	// 延迟故障的随机区间（毫秒）
+	LatencyMinMs int `json:"latency_min_ms"`
+	LatencyMaxMs int `json:"latency_max_ms"`
+	// 各类故障的权重，全部为 0 时等概率选择
+	LatencyWeight     int `json:"latency_weight"`
+	RateLimitWeight   int `json:"rate_limit_weight"`
+	ServerErrorWeight int `json:"server_error_weight"`
+	DisconnectWeight  int `json:"disconnect_weight"`
+	TruncateWeight    int `json:"truncate_weight"`
+	// 429 响应携带的 Retry-After（秒），0 表示不携带
+	RetryAfterSec int `json:"retry_after_sec"`
+}
+
+// chaosConfigStore 当前生效的混沌配置
+type chaosConfigStore struct {
+	mu     sync.RWMutex
+	config ChaosConfig
+}
+
+// SetChaosConfig 更新混沌测试配置
+func (prs *ProviderRelayService) SetChaosConfig(config ChaosConfig) {
+	if config.FaultRate < 0 {
+		config.FaultRate = 0
+	}
+	if config.FaultRate > 1 {
+		config.FaultRate = 1
+	}
+	if config.LatencyMaxMs < config.LatencyMinMs {
+		config.LatencyMaxMs = config.LatencyMinMs
+	}
+	prs.chaos.mu.Lock()
+	prs.chaos.config = config
+	prs.chaos.mu.Unlock()
+	if config.Enabled {
+		fmt.Printf("[Chaos] 混沌模式已开启 (fault_rate=%.2f)，仅用于调试\n", config.FaultRate)
+	}
+}
+
+// GetChaosConfig 获取混沌测试配置
+func (prs *ProviderRelayService) GetChaosConfig() ChaosConfig {
+	prs.chaos.mu.RLock()
+	defer prs.chaos.mu.RUnlock()
+	return prs.chaos.config
+}
+
+// ChaosProvider 返回指向内置混沌上游的 provider 模板（本地类型，无需 API Key、不计费）
+func (prs *ProviderRelayService) ChaosProvider() Provider {
+	host := prs.addr
+	if strings.HasPrefix(host, ":") {
+		host = "127.0.0.1" + host
+	}
+	return Provider{
+		Name:         "chaos",
+		APIURL:       "http://" + host + chaosRoutePrefix,
+		ProviderType: ProviderTypeLocal,
+		Enabled:      true,
+		Level:        1,
+	}
+}
+
+// registerChaosRoutes 注册内置混沌上游
+func (prs *ProviderRelayService) registerChaosRoutes(router gin.IRouter) {
+	router.POST(chaosRoutePrefix+"/*path", prs.chaosHandler())
+}
+
+// chaosHandler 模拟 Anthropic Messages / OpenAI Chat Completions / Responses 上游
+func (prs *ProviderRelayService) chaosHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config := prs.GetChaosConfig()
+		if !config.Enabled {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chaos mode is disabled"})
+			return
+		}
+
+		body, _ := c.GetRawData()
+		path := c.Param("path")
+		format := chaosResponseFormat(path)
+		if format == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unsupported chaos endpoint: " + path})
+			return
+		}
+		isStream := gjson.GetBytes(body, "stream").Bool()
+		model := gjson.GetBytes(body, "model").String()
+
+		fault := strings.TrimSpace(c.GetHeader(headerChaosFault))
+		if fault == "" {
+			fault = config.pickFault()
+		}
+		if fault != "" {
+			fmt.Printf("[Chaos] 注入故障 %s (path=%s, stream=%v)\n", fault, path, isStream)
+		}
+
+		switch fault {
+		case ChaosFaultLatency:
+			wait := time.Duration(config.LatencyMinMs) * time.Millisecond
+			if spread := config.LatencyMaxMs - config.LatencyMinMs; spread > 0 {
+				wait += time.Duration(rand.IntN(spread+1)) * time.Millisecond
+			}
+			if !waitWithContext(c.Request.Context(), wait) {
+				return
+			}
+		case ChaosFaultRateLimit:
+			if config.RetryAfterSec > 0 {
+				c.Header("Retry-After", strconv.Itoa(config.RetryAfterSec))
+			}
+			c.JSON(http.StatusTooManyRequests, chaosError(format, "rate_limit_error", "chaos: rate limited"))
+			return
+		case ChaosFaultServerError:
+			c.JSON(http.StatusInternalServerError, chaosError(format, "api_error", "chaos: internal server error"))
+			return
+		case ChaosFaultDisconnect:
+			abortConnection(c)
+			return
+		}
+
+		truncate := fault == ChaosFaultTruncate
+		if isStream {
+			writeChaosStream(c, format, model, truncate)
+			return
+		}
+		data, _ := json.Marshal(chaosMessage(format, model))
+		c.Writer.Header().Set("Content-Type", "application/json")
+		c.Writer.WriteHeader(http.StatusOK)
+		if truncate {
+			c.Writer.Write(data[:len(data)/2])
+			c.Writer.Flush()
+			abortConnection(c)
+			return
+		}
+		c.Writer.Write(data)
+	}
+}
+
+// pickFault 按比例与权重选择故障，返回空字符串表示正常响应
+func (config ChaosConfig) pickFault() string {
+	if config.FaultRate <= 0 || rand.Float64() >= config.FaultRate {
+		return ""
+	}
+	faults := []string{ChaosFaultLatency, ChaosFaultRateLimit, ChaosFaultServerError, ChaosFaultDisconnect, ChaosFaultTruncate}
+	weights := []int{config.LatencyWeight, config.RateLimitWeight, config.ServerErrorWeight, config.DisconnectWeight, config.TruncateWeight}
+	total := 0
+	for _, w := range weights {
+		total += max(w, 0)
+	}
+	if total == 0 {
+		return faults[rand.IntN(len(faults))]
+	}
+	n := rand.IntN(total)
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if n < w {
+			return faults[i]
+		}
+		n -= w
+	}
+	return ""
+}
+
+// chaosResponseFormat 根据上游路径判断响应格式
+func chaosResponseFormat(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/messages"):
+		return "anthropic"
+	case strings.HasSuffix(path, "/chat/completions"):
+		return "chat"
+	case strings.HasSuffix(path, "/responses"):
+		return "responses"
+	}
+	return ""
+}
+
+// abortConnection 直接关闭底层连接，模拟上游断连
+func abortConnection(c *gin.Context) {
+	c.Abort()
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		// 无法接管连接（如 HTTP/2），退化为中止 handler
+		panic(http.ErrAbortHandler)
+	}
+	conn.Close()
+}
+
+func chaosError(format, errType, message string) gin.H {
+	if format == "anthropic" {
+		return gin.H{"type": "error", "error": gin.H{"type": errType, "message": message}}
+	}
+	return gin.H{"error": gin.H{"type": errType, "message": message}}
+}
+
+func chaosUsage() (int, int) {
+	return 10, len(strings.Fields(chaosResponseText))
+}
+
+// chaosMessage 构造非流式响应
+func chaosMessage(format, model string) gin.H {
+	input, output := chaosUsage()
+	id := "chaos-" + generateTraceID()
+	switch format {
+	case "anthropic":
+		return gin.H{
+			"id": id, "type": "message", "role": "assistant", "model": model,
+			"content":     []gin.H{{"type": "text", "text": chaosResponseText}},
+			"stop_reason": "end_turn",
+			"usage":       gin.H{"input_tokens": input, "output_tokens": output},
+		}
+	case "responses":
+		return gin.H{
+			"id": id, "object": "response", "status": "completed", "model": model,
+			"output": []gin.H{{
+				"type": "message", "role": "assistant",
+				"content": []gin.H{{"type": "output_text", "text": chaosResponseText}},
+			}},
+			"usage": gin.H{"input_tokens": input, "output_tokens": output, "total_tokens": input + output},
+		}
+	default:
+		return gin.H{
+			"id": id, "object": "chat.completion", "created": time.Now().Unix(), "model": model,
+			"choices": []gin.H{{
+				"index":         0,
+				"message":       gin.H{"role": "assistant", "content": chaosResponseText},
+				"finish_reason": "stop",
+			}},
+			"usage": gin.H{"prompt_tokens": input, "completion_tokens": output, "total_tokens": input + output},
+		}
+	}
+}
+
+// writeChaosStream 输出 SSE 流；truncate 时在内容中途断开连接，不发送结束事件
+func writeChaosStream(c *gin.Context, format, model string, truncate bool) {
+	input, output := chaosUsage()
+	id := "chaos-" + generateTraceID()
+	words := strings.SplitAfter(chaosResponseText, " ")
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	send := func(event string, payload gin.H) bool {
+		data, _ := json.Marshal(payload)
+		if event != "" {
+			fmt.Fprintf(c.Writer, "event: %s\n", event)
+		}
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+		return waitWithContext(c.Request.Context(), chaosChunkInterval)
+	}
+
+	switch format {
+	case "anthropic":
+		send("message_start", gin.H{"type": "message_start", "message": gin.H{
+			"id": id, "type": "message", "role": "assistant", "model": model, "content": []gin.H{},
+			"usage": gin.H{"input_tokens": input, "output_tokens": 0},
+		}})
+		send("content_block_start", gin.H{"type": "content_block_start", "index": 0, "content_block": gin.H{"type": "text", "text": ""}})
+	case "responses":
+		send("response.created", gin.H{"type": "response.created", "response": gin.H{"id": id, "status": "in_progress", "model": model}})
+	}
+
+	for i, word := range words {
+		if truncate && i == len(words)/2 {
+			abortConnection(c)
+			return
+		}
+		var ok bool
+		switch format {
+		case "anthropic":
+			ok = send("content_block_delta", gin.H{"type": "content_block_delta", "index": 0, "delta": gin.H{"type": "text_delta", "text": word}})
+		case "responses":
+			ok = send("response.output_text.delta", gin.H{"type": "response.output_text.delta", "output_index": 0, "content_index": 0, "delta": word})
+		default:
+			ok = send("", gin.H{"id": id, "object": "chat.completion.chunk", "model": model,
+				"choices": []gin.H{{"index": 0, "delta": gin.H{"content": word}}}})
+		}
+		if !ok {
+			return
+		}
+	}
+
+	switch format {
+	case "anthropic":
+		send("content_block_stop", gin.H{"type": "content_block_stop", "index": 0})
+		send("message_delta", gin.H{"type": "message_delta", "delta": gin.H{"stop_reason": "end_turn"}, "usage": gin.H{"output_tokens": output}})
+		send("message_stop", gin.H{"type": "message_stop"})
+	case "responses":
+		completed := chaosMessage(format, model)
+		completed["id"] = id
+		send("response.completed", gin.H{"type": "response.completed", "response": completed})
+	default:
+		send("", gin.H{"id": id, "object": "chat.completion.chunk", "model": model,
+			"choices": []gin.H{{"index": 0, "delta": gin.H{}, "finish_reason": "stop"}},
+			"usage":   gin.H{"prompt_tokens": input, "completion_tokens": output, "total_tokens": input + output}})
+		fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestChaosHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	router := gin.New()
+	prs.registerChaosRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	post := func(path, body, fault string) (*http.Response, []byte, error) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+chaosRoutePrefix+path, strings.NewReader(body))
+		if fault != "" {
+			req.Header.Set(headerChaosFault, fault)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		return resp, data, err
+	}
+
+	if resp, _, err := post("/v1/messages", `{"model":"claude"}`, ""); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("disabled chaos should 404, got %v %v", resp, err)
+	}
+
+	prs.SetChaosConfig(ChaosConfig{Enabled: true, RetryAfterSec: 2})
+
+	resp, data, err := post("/v1/messages", `{"model":"claude-test"}`, "")
+	if err != nil || resp.StatusCode != http.StatusOK || gjson.GetBytes(data, "model").String() != "claude-test" {
+		t.Fatalf("normal response: %v %s", err, data)
+	}
+
+	resp, data, err = post("/v1/chat/completions", `{"model":"gpt","stream":true}`, "")
+	if err != nil || !strings.HasSuffix(strings.TrimSpace(string(data)), "data: [DONE]") {
+		t.Fatalf("stream response: %v %s", err, data)
+	}
+
+	resp, _, err = post("/responses", `{"model":"gpt"}`, ChaosFaultRateLimit)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("rate limit fault: %v %v", resp, err)
+	}
+
+	if _, _, err := post("/v1/messages", `{"model":"claude"}`, ChaosFaultDisconnect); err == nil {
+		t.Error("disconnect fault should fail the request")
+	}
+
+	_, data, err = post("/v1/messages", `{"model":"claude","stream":true}`, ChaosFaultTruncate)
+	if err == nil || strings.Contains(string(data), "message_stop") {
+		t.Errorf("truncated stream should end early, err=%v data=%s", err, data)
+	}
+}
+
+func TestChaosPickFault(t *testing.T) {
+	config := ChaosConfig{FaultRate: 1, ServerErrorWeight: 3}
+	for i := 0; i < 20; i++ {
+		if fault := config.pickFault(); fault != ChaosFaultServerError {
+			t.Fatalf("pickFault = %q", fault)
+		}
+	}
+	if fault := (ChaosConfig{}).pickFault(); fault != "" {
+		t.Errorf("zero fault rate should not inject, got %q", fault)
+	}
+}
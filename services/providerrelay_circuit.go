@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,7 +20,9 @@ type ProviderRelayServiceWithCircuitBreaker struct {
 	circuitBreakerManager *CircuitBreakerManager
 	providerServiceV2     *ProviderServiceV2
 	db                    *sql.DB
-	mu                    sync.RWMutex
+	// Platform each provider was last selected for, used to attribute circuit incidents
+	circuitPlatforms sync.Map
+	mu               sync.RWMutex
 }
 
 // NewProviderRelayServiceWithCircuitBreaker creates a new service with circuit breaker support
@@ -38,12 +39,19 @@ func NewProviderRelayServiceWithCircuitBreaker(
 	cbConfig := DefaultCircuitBreakerConfig()
 	cbManager := NewCircuitBreakerManager(db, cbConfig)
 
-	return &ProviderRelayServiceWithCircuitBreaker{
+	svc := &ProviderRelayServiceWithCircuitBreaker{
 		ProviderRelayService:  baseService,
 		circuitBreakerManager: cbManager,
 		providerServiceV2:     providerServiceV2,
 		db:                    db,
 	}
+	// Record circuit open / close transitions as provider incidents
+	cbManager.OnStateChange(func(providerName, oldState, newState string) {
+		platform, _ := svc.circuitPlatforms.Load(providerName)
+		kind, _ := platform.(string)
+		baseService.trackCircuitTransition(kind, providerName, oldState, newState)
+	})
+	return svc
 }
 
 // selectProviderWithCircuitBreaker selects a provider considering circuit breaker state
@@ -67,7 +75,7 @@ func (prs *ProviderRelayServiceWithCircuitBreaker) selectProviderWithCircuitBrea
 		// Filter enabled providers
 		active := make([]Provider, 0, len(providers))
 		for _, p := range providers {
-			if p.Enabled && p.APIURL != "" && p.APIKey != "" {
+			if p.Enabled && !p.Suspended && p.APIURL != "" && p.HasCredentials() {
 				active = append(active, p)
 			}
 		}
@@ -93,6 +101,7 @@ func (prs *ProviderRelayServiceWithCircuitBreaker) selectProviderWithCircuitBrea
 	// Filter providers by circuit breaker state
 	healthyCandidates := make([]Provider, 0)
 	for _, p := range candidates {
+		prs.circuitPlatforms.Store(p.Name, kind)
 		cb := prs.circuitBreakerManager.GetCircuitBreaker(p.ID, p.Name)
 		if cb.AllowRequest() {
 			healthyCandidates = append(healthyCandidates, p)
@@ -109,8 +118,8 @@ func (prs *ProviderRelayServiceWithCircuitBreaker) selectProviderWithCircuitBrea
 	// Select provider using round-robin or priority
 	var selected Provider
 	if prs.ProviderRelayService.IsRoundRobinEnabled() {
-		// Round-robin selection
-		idx := int(atomic.AddUint64(&prs.ProviderRelayService.rrCounter, 1)-1) % len(healthyCandidates)
+		// Round-robin selection (counter shared across replicas when a shared state store is set)
+		idx := int(prs.ProviderRelayService.nextRoundRobin(kind) % uint64(len(healthyCandidates)))
 		selected = healthyCandidates[idx]
 	} else {
 		// Priority-based selection (lowest priority level first)
@@ -150,7 +159,7 @@ func (prs *ProviderRelayServiceWithCircuitBreaker) executeRequestWithCircuitBrea
 
 		// Execute request
 		client := &http.Client{
-			Timeout: prs.getHTTPTimeout(isStream),
+			Timeout: prs.getHTTPTimeout(provider, isStream),
 		}
 
 		var execErr error
@@ -179,12 +188,9 @@ func (prs *ProviderRelayServiceWithCircuitBreaker) executeRequestWithCircuitBrea
 	return resp, nil
 }
 
-// getHTTPTimeout returns appropriate timeout based on request type
-func (prs *ProviderRelayServiceWithCircuitBreaker) getHTTPTimeout(isStream bool) time.Duration {
-	if isStream {
-		return 300 * time.Second // 5 minutes for streaming
-	}
-	return 60 * time.Second // 1 minute for non-streaming
+// getHTTPTimeout returns the configured total timeout for the provider and request type
+func (prs *ProviderRelayServiceWithCircuitBreaker) getHTTPTimeout(provider *Provider, isStream bool) time.Duration {
+	return prs.resolveTimeouts(*provider, isStream, nil).total
 }
 
 // handleProxyRequestWithCircuitBreaker handles a proxy request with circuit breaker support
@@ -318,3 +324,9 @@ func isSystemHeader(key string) bool {
 	}
 	return false
 }
+
+// SetSharedStateStore shares round-robin counters, cooldowns, rate limits, sticky routes and circuit states across replicas
+func (prs *ProviderRelayServiceWithCircuitBreaker) SetSharedStateStore(store SharedStateStore) {
+	prs.ProviderRelayService.SetSharedStateStore(store)
+	prs.circuitBreakerManager.SetSharedState(store)
+}
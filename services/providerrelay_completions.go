@@ -0,0 +1,250 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 旧版文本补全（/v1/completions）：声明原生支持的 provider 直接透传；
+// 其他 provider 把 prompt 转换为一条 user 消息走 Chat Completions，再把响应（含流式）转换回 text_completion 格式。
+// 用量按 Chat 响应中的 usage 正常记录
+
+const legacyCompletionsEndpoint = "/v1/completions"
+
+// legacyCompletionFields 转换为 Chat 请求时去掉的旧版专有字段
+var legacyCompletionFields = []string{"prompt", "suffix", "echo", "logprobs", "best_of"}
+
+// supportsLegacyCompletions provider 是否原生支持 /v1/completions；未声明时视为只支持 Chat
+func (p Provider) supportsLegacyCompletions() bool {
+	return p.Capabilities != nil && p.Capabilities.Completions != nil && *p.Capabilities.Completions
+}
+
+// legacyCompletionsHandler 校验请求后走 codex 平台的正常转发流程
+func (prs *ProviderRelayService) legacyCompletionsHandler() gin.HandlerFunc {
+	proxy := prs.proxyHandler("codex", legacyCompletionsEndpoint)
+	return func(c *gin.Context) {
+		body, err := readRequestBody(c)
+		if err != nil || !gjson.ValidBytes(body) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if prompt := gjson.GetBytes(body, "prompt"); !prompt.Exists() || prompt.Type == gjson.Null {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "prompt is required", "type": "invalid_request_error"})
+			return
+		}
+		proxy(c)
+	}
+}
+
+// readRequestBody 读取请求体并放回，供后续处理再次读取
+func readRequestBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(c.Request.Body); err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// legacyPrompt 取出单个文本 prompt；批量 prompt 与 token 数组无法转换为一条对话
+func legacyPrompt(body []byte) (string, error) {
+	prompt := gjson.GetBytes(body, "prompt")
+	switch {
+	case prompt.Type == gjson.String:
+		return prompt.String(), nil
+	case prompt.IsArray():
+		items := prompt.Array()
+		if len(items) == 1 && items[0].Type == gjson.String {
+			return items[0].String(), nil
+		}
+		if len(items) > 1 {
+			return "", fmt.Errorf("batched prompts are not supported by chat-only providers")
+		}
+	}
+	return "", fmt.Errorf("token array prompts are not supported by chat-only providers")
+}
+
+// completionToChatRequest 把文本补全请求转换为 Chat Completions 请求；其余参数（max_tokens、stop、temperature 等）原样保留
+func completionToChatRequest(body []byte) ([]byte, error) {
+	prompt, err := legacyPrompt(body)
+	if err != nil {
+		return nil, err
+	}
+	if gjson.GetBytes(body, "suffix").String() != "" {
+		return nil, fmt.Errorf("suffix is not supported by chat-only providers")
+	}
+	if gjson.GetBytes(body, "echo").Bool() {
+		return nil, fmt.Errorf("echo is not supported by chat-only providers")
+	}
+	converted := body
+	for _, field := range legacyCompletionFields {
+		if converted, err = sjson.DeleteBytes(converted, field); err != nil {
+			return nil, err
+		}
+	}
+	return sjson.SetBytes(converted, "messages", []map[string]string{{"role": "user", "content": prompt}})
+}
+
+// chatToCompletionResponse 把 Chat Completions 响应（或流式块）转换为 text_completion 格式；
+// 流式块只有 role 等没有文本、结束原因与用量的内容时返回 nil，调用方跳过
+func chatToCompletionResponse(data []byte, chunk bool) []byte {
+	resp := gjson.ParseBytes(data)
+	out := []byte(`{}`)
+	id := resp.Get("id").String()
+	if strings.HasPrefix(id, "chatcmpl-") {
+		id = "cmpl-" + strings.TrimPrefix(id, "chatcmpl-")
+	}
+	out, _ = sjson.SetBytes(out, "id", id)
+	out, _ = sjson.SetBytes(out, "object", "text_completion")
+	out, _ = sjson.SetBytes(out, "created", resp.Get("created").Int())
+	out, _ = sjson.SetBytes(out, "model", resp.Get("model").String())
+
+	contentPath := "message.content"
+	if chunk {
+		contentPath = "delta.content"
+	}
+	choices := make([]map[string]interface{}, 0, len(resp.Get("choices").Array()))
+	meaningful := false
+	for _, choice := range resp.Get("choices").Array() {
+		text := choice.Get(contentPath).String()
+		finish := choice.Get("finish_reason")
+		var finishReason interface{}
+		if finish.Exists() && finish.Type != gjson.Null {
+			finishReason = finish.String()
+		}
+		if text != "" || finishReason != nil {
+			meaningful = true
+		}
+		choices = append(choices, map[string]interface{}{
+			"text":          text,
+			"index":         choice.Get("index").Int(),
+			"logprobs":      nil,
+			"finish_reason": finishReason,
+		})
+	}
+	out, _ = sjson.SetBytes(out, "choices", choices)
+	if usage := resp.Get("usage"); usage.Exists() && usage.Type != gjson.Null {
+		out, _ = sjson.SetRawBytes(out, "usage", []byte(usage.Raw))
+		meaningful = true
+	}
+	if chunk && !meaningful {
+		return nil
+	}
+	return out
+}
+
+// completionResponseWriter 把写给客户端的 Chat 响应转换为文本补全格式；非 2xx 响应原样透传
+type completionResponseWriter struct {
+	gin.ResponseWriter
+	stream   bool
+	buffered bytes.Buffer // 非流式：完整响应；流式：未完成的 SSE 行
+}
+
+func (w *completionResponseWriter) converting() bool {
+	status := w.ResponseWriter.Status()
+	return status >= http.StatusOK && status < http.StatusMultipleChoices
+}
+
+func (w *completionResponseWriter) WriteHeader(code int) {
+	if code >= http.StatusOK && code < http.StatusMultipleChoices {
+		// 转换后长度变化，去掉上游的 Content-Length
+		w.ResponseWriter.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *completionResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *completionResponseWriter) Write(data []byte) (int, error) {
+	if !w.converting() {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buffered.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	// 流式：逐行转换完整的 SSE 行，不完整的行留到下次写入
+	pending := w.buffered.Bytes()
+	last := bytes.LastIndexByte(pending, '\n')
+	if last < 0 {
+		return len(data), nil
+	}
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(pending[:last+1], []byte("\n")) {
+		out.Write(convertCompletionSSELine(line))
+	}
+	rest := append([]byte(nil), pending[last+1:]...)
+	w.buffered.Reset()
+	w.buffered.Write(rest)
+	if out.Len() > 0 {
+		if _, err := w.ResponseWriter.Write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// convertCompletionSSELine 转换一行 SSE：data 中的 Chat 块转换为文本补全块，其余行原样保留
+func convertCompletionSSELine(line []byte) []byte {
+	trimmed := bytes.TrimRight(line, "\r\n")
+	if !bytes.HasPrefix(trimmed, []byte("data:")) {
+		return line
+	}
+	payload := bytes.TrimSpace(bytes.TrimPrefix(trimmed, []byte("data:")))
+	if !gjson.ValidBytes(payload) || !gjson.GetBytes(payload, "choices").Exists() && !gjson.GetBytes(payload, "usage").Exists() {
+		return line
+	}
+	converted := chatToCompletionResponse(payload, true)
+	if converted == nil {
+		return nil
+	}
+	return append(append([]byte("data: "), converted...), line[len(trimmed):]...)
+}
+
+// finish 写出缓冲的内容：非流式响应整体转换，流式响应写出最后一行
+func (w *completionResponseWriter) finish() {
+	if w.buffered.Len() == 0 {
+		return
+	}
+	data := w.buffered.Bytes()
+	if w.stream {
+		w.ResponseWriter.Write(convertCompletionSSELine(data))
+	} else if gjson.ValidBytes(data) && gjson.GetBytes(data, "choices").Exists() {
+		w.ResponseWriter.Write(chatToCompletionResponse(data, false))
+	} else {
+		w.ResponseWriter.Write(data)
+	}
+	w.buffered.Reset()
+}
+
+// adaptLegacyCompletion 对只支持 Chat 的 provider 转换本次尝试的请求，并临时替换 c.Writer 转换响应；
+// 返回的 restore 在本次尝试结束后调用
+func adaptLegacyCompletion(c *gin.Context, provider Provider, endpoint string, body []byte, stream bool) (string, []byte, func(), error) {
+	if endpoint != legacyCompletionsEndpoint || provider.supportsLegacyCompletions() {
+		return endpoint, body, func() {}, nil
+	}
+	converted, err := completionToChatRequest(body)
+	if err != nil {
+		return endpoint, body, func() {}, err
+	}
+	original := c.Writer
+	writer := &completionResponseWriter{ResponseWriter: original, stream: stream}
+	c.Writer = writer
+	restore := func() {
+		writer.finish()
+		c.Writer = original
+	}
+	return "/v1/chat/completions", converted, restore, nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func runLegacyCompletion(t *testing.T, provider Provider, body string, upstreamReply string, contentType string) (*httptest.ResponseRecorder, string, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	var upstreamPath, upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamPath, upstreamBody = r.URL.Path, string(data)
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(upstreamReply))
+	}))
+	t.Cleanup(upstream.Close)
+
+	prs := &ProviderRelayService{logWriteQueue: make(chan *ReqeustLog, 1)}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, legacyCompletionsEndpoint, strings.NewReader(body))
+	provider.APIURL, provider.APIKey = upstream.URL, "k"
+	stream := gjson.Get(body, "stream").Bool()
+	ok, err := prs.forwardRequest(c, "codex", provider, legacyCompletionsEndpoint, nil, map[string]string{}, []byte(body), stream, "m")
+	if !ok || err != nil {
+		t.Fatalf("forwardRequest = %v, %v", ok, err)
+	}
+	log := <-prs.logWriteQueue
+	if log.InputTokens != 3 || log.OutputTokens != 2 {
+		t.Fatalf("usage = %d/%d", log.InputTokens, log.OutputTokens)
+	}
+	return w, upstreamPath, upstreamBody
+}
+
+func TestLegacyCompletionConvertedToChat(t *testing.T) {
+	reply := `{"id":"chatcmpl-1","object":"chat.completion","created":7,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"world"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`
+	w, path, body := runLegacyCompletion(t, Provider{Name: "p"}, `{"model":"m","prompt":"hello","max_tokens":5,"logprobs":1}`, reply, "application/json")
+	if path != "/v1/chat/completions" {
+		t.Fatalf("upstream path = %s", path)
+	}
+	if body != `{"model":"m","max_tokens":5,"messages":[{"content":"hello","role":"user"}]}` {
+		t.Fatalf("upstream body = %s", body)
+	}
+	got := gjson.Parse(w.Body.String())
+	if got.Get("object").String() != "text_completion" || got.Get("id").String() != "cmpl-1" ||
+		got.Get("choices.0.text").String() != "world" || got.Get("choices.0.finish_reason").String() != "stop" ||
+		got.Get("usage.total_tokens").Int() != 5 {
+		t.Fatalf("client got %s", w.Body.String())
+	}
+}
+
+func TestLegacyCompletionStreamConverted(t *testing.T) {
+	reply := "data: {\"id\":\"chatcmpl-2\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-2\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-2\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"length\"}],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2}}\n\n" +
+		"data: [DONE]\n\n"
+	w, _, _ := runLegacyCompletion(t, Provider{Name: "p"}, `{"model":"m","prompt":["hello"],"stream":true}`, reply, "text/event-stream")
+	out := w.Body.String()
+	if strings.Contains(out, "delta") || strings.Contains(out, `"role"`) {
+		t.Fatalf("chat chunks leaked: %s", out)
+	}
+	if !strings.Contains(out, `"text":"Hi"`) || !strings.Contains(out, `"finish_reason":"length"`) || !strings.Contains(out, "data: [DONE]") {
+		t.Fatalf("client got %s", out)
+	}
+}
+
+func TestLegacyCompletionNativePassthrough(t *testing.T) {
+	native := true
+	reply := `{"id":"cmpl-3","object":"text_completion","choices":[{"text":"x","index":0}],"usage":{"prompt_tokens":3,"completion_tokens":2}}`
+	w, path, body := runLegacyCompletion(t, Provider{Name: "p", Capabilities: &ProviderCapabilities{Completions: &native}}, `{"model":"m","prompt":"hello","echo":true}`, reply, "application/json")
+	if path != legacyCompletionsEndpoint || body != `{"model":"m","prompt":"hello","echo":true}` || w.Body.String() != reply {
+		t.Fatalf("passthrough: path=%s body=%s client=%s", path, body, w.Body.String())
+	}
+}
+
+func TestCompletionToChatRequestRejectsUnsupported(t *testing.T) {
+	for _, body := range []string{
+		`{"prompt":["a","b"]}`,
+		`{"prompt":[1,2,3]}`,
+		`{"prompt":"a","suffix":"b"}`,
+		`{"prompt":"a","echo":true}`,
+	} {
+		if _, err := completionToChatRequest([]byte(body)); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 提示词压缩：估算的输入超过目标模型的上下文窗口时（可选开启），按保留策略丢弃最早的对话，
+// 或调用配置的廉价模型把较早的对话总结为一段摘要，并在 request_log.prompt_compression 中记录
+
+// 压缩策略
+const (
+	CompressionDropOldest = "drop_oldest" // 丢弃最早的对话（默认）
+	CompressionSummarize  = "summarize"   // 用廉价模型总结被丢弃的对话，失败时退回 drop_oldest
+)
+
+const (
+	// defaultCompressionKeepRecent 未配置时始终保留的最近对话条数
+	defaultCompressionKeepRecent = 4
+	// defaultCompressionReserveOutput 请求未指定最大输出时为输出预留的 token 数
+	defaultCompressionReserveOutput = 4096
+	// defaultCompressionSummaryTokens 摘要的最大 token 数
+	defaultCompressionSummaryTokens = 1024
+	// compressionSummaryInputLimit 发给摘要模型的对话最大字符数
+	compressionSummaryInputLimit = 60000
+)
+
+// ctxKeyPromptCompression 当前尝试的压缩记录，由 forwardRequest 写入请求日志
+const ctxKeyPromptCompression = "codeswitch.prompt_compression"
+
+const defaultSummaryPrompt = `Summarize the following earlier part of a conversation between a user and an AI assistant. Keep every fact, decision, file name, identifier, code detail and open task that later messages may depend on. Be concise and reply with the summary only.
+
+%s`
+
+const compressionSummaryHeader = "Summary of the earlier conversation (older messages were compressed to fit the context window):\n\n"
+
+// PromptCompressionConfig 提示词压缩配置
+type PromptCompressionConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Strategy  string   `json:"strategy,omitempty"`  // drop_oldest / summarize
+	Platforms []string `json:"platforms,omitempty"` // 为空时适用所有平台
+
+	// 上下文窗口：按模型配置（支持 * 通配符），未配置时使用模型目录中的 context_length，再退回默认值
+	ContextWindows       map[string]int `json:"context_windows,omitempty"`
+	DefaultContextWindow int            `json:"default_context_window,omitempty"` // 0 表示窗口未知时不压缩
+	ReserveOutputTokens  int            `json:"reserve_output_tokens,omitempty"`  // 为输出预留，未设置时取请求的最大输出
+
+	// 保留策略：system 消息与最近 N 条对话不会被压缩
+	KeepRecentMessages int `json:"keep_recent_messages,omitempty"`
+
+	// summarize 策略：摘要使用的 provider（平台默认与请求相同）、模型与提示词（含一个 %s：对话内容）
+	SummaryPlatform  string `json:"summary_platform,omitempty"`
+	SummaryProvider  string `json:"summary_provider,omitempty"`
+	SummaryModel     string `json:"summary_model,omitempty"`
+	SummaryPrompt    string `json:"summary_prompt,omitempty"`
+	SummaryMaxTokens int    `json:"summary_max_tokens,omitempty"`
+}
+
+// compressionStore 提示词压缩配置
+type compressionStore struct {
+	mu     sync.RWMutex
+	config PromptCompressionConfig
+}
+
+// Validate 检查压缩配置
+func (cfg PromptCompressionConfig) Validate() error {
+	switch cfg.Strategy {
+	case "", CompressionDropOldest:
+	case CompressionSummarize:
+		if cfg.SummaryProvider == "" || cfg.SummaryModel == "" {
+			return fmt.Errorf("summarize strategy requires summary_provider and summary_model")
+		}
+	default:
+		return fmt.Errorf("invalid strategy %q, want drop_oldest or summarize", cfg.Strategy)
+	}
+	if cfg.DefaultContextWindow < 0 || cfg.ReserveOutputTokens < 0 || cfg.KeepRecentMessages < 0 || cfg.SummaryMaxTokens < 0 {
+		return fmt.Errorf("token and message counts must not be negative")
+	}
+	for pattern, window := range cfg.ContextWindows {
+		if strings.TrimSpace(pattern) == "" || window <= 0 {
+			return fmt.Errorf("context window for %q must be a positive token count", pattern)
+		}
+	}
+	return nil
+}
+
+// compressionConfigPath 压缩配置文件
+func compressionConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "prompt-compression.json"), nil
+}
+
+// GetPromptCompressionConfig 获取提示词压缩配置
+func (prs *ProviderRelayService) GetPromptCompressionConfig() PromptCompressionConfig {
+	prs.compression.mu.RLock()
+	defer prs.compression.mu.RUnlock()
+	return prs.compression.config
+}
+
+// SetPromptCompressionConfig 更新提示词压缩配置，持久化到 prompt-compression.json
+func (prs *ProviderRelayService) SetPromptCompressionConfig(cfg PromptCompressionConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	path, err := compressionConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.compression.mu.Lock()
+	prs.compression.config = cfg
+	prs.compression.mu.Unlock()
+	return nil
+}
+
+// loadCompressionConfig 启动时从 prompt-compression.json 恢复
+func (prs *ProviderRelayService) loadCompressionConfig() {
+	path, err := compressionConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cfg PromptCompressionConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("[Compression] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("[Compression] 配置无效，已停用: %v\n", err)
+		return
+	}
+	prs.compression.mu.Lock()
+	prs.compression.config = cfg
+	prs.compression.mu.Unlock()
+}
+
+// contextWindowFor 目标模型的上下文窗口：配置（精确匹配优先，其次最长的通配符）> 模型目录 > 价格表与模型覆盖文件 > 默认值
+func contextWindowFor(cfg PromptCompressionConfig, kind string, provider Provider, model string) int {
+	if window, ok := cfg.ContextWindows[model]; ok {
+		return window
+	}
+	patterns := make([]string, 0, len(cfg.ContextWindows))
+	for pattern := range cfg.ContextWindows {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "*") && matchWildcard(pattern, model) {
+			return cfg.ContextWindows[pattern]
+		}
+	}
+	if catalogs, err := loadCatalogs(); err == nil {
+		if catalog := catalogs[providerKey(kind, provider.Name)]; catalog != nil {
+			for _, entry := range catalog.Models {
+				if entry.ID == model && entry.ContextLength > 0 {
+					return int(entry.ContextLength)
+				}
+			}
+		}
+	}
+	if pricing, err := modelpricing.DefaultService(); err == nil {
+		if info, ok := pricing.ModelInfo(model); ok && info.ContextWindow > 0 {
+			return info.ContextWindow
+		}
+	}
+	return cfg.DefaultContextWindow
+}
+
+// compressPromptFor 按压缩配置处理发往 provider 的请求体，并把本次尝试的压缩记录写入 gin context
+func (prs *ProviderRelayService) compressPromptFor(c *gin.Context, kind string, provider Provider, model string, body []byte) []byte {
+	compressed, note := prs.compressPrompt(kind, provider, model, body)
+	c.Set(ctxKeyPromptCompression, note)
+	return compressed
+}
+
+// compressPrompt 估算输入超过上下文窗口（减去输出预留）时压缩请求体，返回新请求体与压缩记录；
+// 无需或无法压缩时原样返回，记录为空
+func (prs *ProviderRelayService) compressPrompt(kind string, provider Provider, model string, body []byte) ([]byte, string) {
+	cfg := prs.GetPromptCompressionConfig()
+	if !cfg.Enabled || len(body) == 0 || !gjson.ValidBytes(body) {
+		return body, ""
+	}
+	if len(cfg.Platforms) > 0 && !containsFold(cfg.Platforms, kind) {
+		return body, ""
+	}
+	window := contextWindowFor(cfg, kind, provider, model)
+	if window <= 0 {
+		return body, ""
+	}
+	reserve := cfg.ReserveOutputTokens
+	if reserve <= 0 {
+		if _, requested := requestedOutputTokens(body); requested > 0 {
+			reserve = requested
+		} else {
+			reserve = defaultCompressionReserveOutput
+		}
+	}
+	budget := window - reserve
+	estimate := EstimateRequestTokens(body)
+	if budget <= 0 || estimate <= budget {
+		return body, ""
+	}
+	keepRecent := cfg.KeepRecentMessages
+	if keepRecent <= 0 {
+		keepRecent = defaultCompressionKeepRecent
+	}
+
+	if cfg.Strategy == CompressionSummarize {
+		summaryTokens := cfg.SummaryMaxTokens
+		if summaryTokens <= 0 {
+			summaryTokens = defaultCompressionSummaryTokens
+		}
+		trimmed, dropped, _ := dropOldestMessages(body, budget-summaryTokens, keepRecent)
+		if len(dropped) > 0 {
+			withSummary, err := prs.summarizeInto(cfg, kind, trimmed, dropped, summaryTokens)
+			if err == nil {
+				remaining := EstimateRequestTokens(withSummary)
+				fmt.Printf("[Compression] Provider %s: 输入约 %d tokens 超过 %s 的窗口 %d，总结 %d 条对话后约 %d tokens\n",
+					provider.Name, estimate, model, window, len(dropped), remaining)
+				return withSummary, fmt.Sprintf("%s: %d messages, ~%d -> ~%d tokens", CompressionSummarize, len(dropped), estimate, remaining)
+			}
+			fmt.Printf("[Compression] 总结对话失败，改为丢弃最早的对话: %v\n", err)
+		}
+	}
+
+	trimmed, dropped, remaining := dropOldestMessages(body, budget, keepRecent)
+	if len(dropped) == 0 {
+		return body, ""
+	}
+	fmt.Printf("[Compression] Provider %s: 输入约 %d tokens 超过 %s 的窗口 %d，丢弃 %d 条最早的对话后约 %d tokens\n",
+		provider.Name, estimate, model, window, len(dropped), remaining)
+	return trimmed, fmt.Sprintf("%s: %d messages, ~%d -> ~%d tokens", CompressionDropOldest, len(dropped), estimate, remaining)
+}
+
+// dropOldestMessages 从最早的对话开始丢弃，直到估算值不超过 budget；
+// system 消息与最近 keepRecent 条对话不丢弃，剩余对话不以助手回复 / 工具结果开头。
+// 返回新请求体、被丢弃的对话（按原顺序）与剩余估算值
+func dropOldestMessages(body []byte, budget, keepRecent int) ([]byte, []gjson.Result, int) {
+	field, items := conversationItems(body)
+	estimate := EstimateRequestTokens(body)
+	if field == "" {
+		return body, nil, estimate
+	}
+	protected := len(items) - keepRecent // 下标 >= protected 的对话不丢弃
+	if protected < 0 {
+		protected = 0
+	}
+
+	result := body
+	kept := items
+	var dropped []gjson.Result
+	for estimate > budget {
+		drop := -1
+		for i := 0; i < len(kept) && i < protected-len(dropped); i++ {
+			if !isPinnedMessage(kept[i]) {
+				drop = i
+				break
+			}
+		}
+		if drop < 0 {
+			break
+		}
+		dropped = append(dropped, kept[drop])
+		kept = append(append([]gjson.Result{}, kept[:drop]...), kept[drop+1:]...)
+		for drop < len(kept) && drop < protected-len(dropped) && isOrphanMessage(kept[drop]) {
+			dropped = append(dropped, kept[drop])
+			kept = append(append([]gjson.Result{}, kept[:drop]...), kept[drop+1:]...)
+		}
+
+		updated, err := setConversationItems(body, field, kept)
+		if err != nil {
+			break
+		}
+		result = updated
+		estimate = EstimateRequestTokens(result)
+	}
+	return result, dropped, estimate
+}
+
+// summarizeInto 总结被丢弃的对话并把摘要放入已截断的请求体
+func (prs *ProviderRelayService) summarizeInto(cfg PromptCompressionConfig, kind string, body []byte, dropped []gjson.Result, maxTokens int) ([]byte, error) {
+	summary, err := prs.summarizeMessages(cfg, kind, dropped, maxTokens)
+	if err != nil {
+		return nil, err
+	}
+	if summary == "" {
+		return nil, fmt.Errorf("摘要模型返回空内容")
+	}
+	return insertConversationSummary(kind, body, summary)
+}
+
+// summarizeMessages 请求摘要模型总结被丢弃的对话
+func (prs *ProviderRelayService) summarizeMessages(cfg PromptCompressionConfig, kind string, messages []gjson.Result, maxTokens int) (string, error) {
+	platform := cfg.SummaryPlatform
+	if platform == "" {
+		platform = kind
+	}
+	template := cfg.SummaryPrompt
+	if template == "" {
+		template = defaultSummaryPrompt
+	}
+	transcript := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if text := messageText(msg); text != "" {
+			transcript = append(transcript, fmt.Sprintf("[%s]\n%s", messageRole(msg), text))
+		}
+	}
+	if len(transcript) == 0 {
+		return "", fmt.Errorf("被丢弃的对话没有文本内容")
+	}
+	prompt := fmt.Sprintf(template, truncateRunes(strings.Join(transcript, "\n\n"), compressionSummaryInputLimit))
+	return prs.completeWithProvider(platform, cfg.SummaryProvider, cfg.SummaryModel, prompt, maxTokens, 60*time.Second)
+}
+
+// messageRole 对话的角色（Responses 的工具调用条目没有 role）
+func messageRole(msg gjson.Result) string {
+	if role := msg.Get("role").String(); role != "" {
+		return role
+	}
+	if t := msg.Get("type").String(); t != "" {
+		return t
+	}
+	return "user"
+}
+
+// messageText 提取对话中的文本、工具调用参数与工具结果（各协议）
+func messageText(msg gjson.Result) string {
+	var parts []string
+	appendPart := func(part gjson.Result) {
+		switch {
+		case part.Type == gjson.String:
+			parts = append(parts, part.String())
+		case part.Get("text").Exists():
+			parts = append(parts, part.Get("text").String())
+		case part.Get("input").Exists():
+			parts = append(parts, part.Get("input").Raw)
+		case part.Get("functionCall").Exists():
+			parts = append(parts, part.Get("functionCall").Raw)
+		case part.Get("functionResponse").Exists():
+			parts = append(parts, part.Get("functionResponse").Raw)
+		case part.Get("content").Exists():
+			parts = append(parts, messageText(part))
+		}
+	}
+	content := msg.Get("content")
+	if content.IsArray() {
+		content.ForEach(func(_, part gjson.Result) bool {
+			appendPart(part)
+			return true
+		})
+	} else if content.Exists() {
+		appendPart(content)
+	}
+	msg.Get("parts").ForEach(func(_, part gjson.Result) bool {
+		appendPart(part)
+		return true
+	})
+	msg.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+		parts = append(parts, call.Get("function.name").String()+" "+call.Get("function.arguments").String())
+		return true
+	})
+	for _, field := range []string{"arguments", "output"} {
+		if v := msg.Get(field); v.Exists() {
+			parts = append(parts, v.String())
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+// insertConversationSummary 把摘要放入请求的系统级指令：Anthropic system、Responses instructions、
+// Gemini systemInstruction，OpenAI Chat 在开头的 system 消息之后插入一条 system 消息
+func insertConversationSummary(kind string, body []byte, summary string) ([]byte, error) {
+	text := compressionSummaryHeader + summary
+	field, items := conversationItems(body)
+	switch {
+	case field == "contents":
+		key := "systemInstruction"
+		if gjson.GetBytes(body, "system_instruction").Exists() {
+			key = "system_instruction"
+		}
+		return sjson.SetBytes(body, key+".parts.-1", map[string]string{"text": text})
+	case field == "input":
+		instructions := strings.TrimSpace(gjson.GetBytes(body, "instructions").String())
+		if instructions != "" {
+			instructions += "\n\n"
+		}
+		return sjson.SetBytes(body, "instructions", instructions+text)
+	case kind == "claude":
+		system := gjson.GetBytes(body, "system")
+		if system.IsArray() {
+			return sjson.SetBytes(body, "system.-1", map[string]string{"type": "text", "text": text})
+		}
+		if current := strings.TrimSpace(system.String()); current != "" {
+			text = current + "\n\n" + text
+		}
+		return sjson.SetBytes(body, "system", text)
+	}
+
+	insertAt := 0
+	for insertAt < len(items) && isPinnedMessage(items[insertAt]) {
+		insertAt++
+	}
+	message, err := json.Marshal(map[string]string{"role": "system", "content": text})
+	if err != nil {
+		return nil, err
+	}
+	updated := append(append([]gjson.Result{}, items[:insertAt]...), gjson.ParseBytes(message))
+	updated = append(updated, items[insertAt:]...)
+	return setConversationItems(body, field, updated)
+}
+
+func (prs *ProviderRelayService) adminGetCompressionConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.GetPromptCompressionConfig())
+}
+
+func (prs *ProviderRelayService) adminUpdateCompressionConfigHandler(c *gin.Context) {
+	var cfg PromptCompressionConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := prs.SetPromptCompressionConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prs.GetPromptCompressionConfig())
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// longConversation 构造 system + n 条交替对话，每条约 200 tokens
+func longConversation(n int) []byte {
+	messages := []map[string]string{{"role": "system", "content": "be helpful"}}
+	for i := 0; i < n; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages = append(messages, map[string]string{"role": role, "content": strings.Repeat("word ", 200) + string(rune('a'+i))})
+	}
+	body, _ := json.Marshal(map[string]interface{}{"model": "small-model", "max_tokens": 100, "messages": messages})
+	return body
+}
+
+func TestPromptCompressionConfigValidate(t *testing.T) {
+	invalid := []PromptCompressionConfig{
+		{Strategy: "unknown"},
+		{Strategy: CompressionSummarize},
+		{ContextWindows: map[string]int{"m": 0}},
+		{KeepRecentMessages: -1},
+	}
+	for i, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("case %d: expected validation error", i)
+		}
+	}
+
+	cfg := PromptCompressionConfig{ContextWindows: map[string]int{"gpt-*": 1000, "gpt-4o*": 2000, "gpt-4o-mini": 3000}, DefaultContextWindow: 500}
+	for model, want := range map[string]int{"gpt-4o-mini": 3000, "gpt-4o-2024": 2000, "gpt-3.5": 1000, "other": 500} {
+		if got := contextWindowFor(cfg, "codex", Provider{Name: "p"}, model); got != want {
+			t.Fatalf("window(%s) = %d, want %d", model, got, want)
+		}
+	}
+}
+
+func TestCompressPromptDropOldest(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{}
+	body := longConversation(10)
+
+	// 未开启时原样转发
+	if out, note := prs.compressPrompt("codex", Provider{Name: "p"}, "small-model", body); note != "" || string(out) != string(body) {
+		t.Fatal("compression should be opt-in")
+	}
+
+	if err := prs.SetPromptCompressionConfig(PromptCompressionConfig{
+		Enabled:            true,
+		ContextWindows:     map[string]int{"small-model": 1200},
+		KeepRecentMessages: 3,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	out, note := prs.compressPrompt("codex", Provider{Name: "p"}, "small-model", body)
+	if !strings.HasPrefix(note, CompressionDropOldest) {
+		t.Fatalf("note = %q", note)
+	}
+	messages := gjson.GetBytes(out, "messages").Array()
+	if messages[0].Get("role").String() != "system" || messages[1].Get("role").String() != "user" {
+		t.Fatalf("system message must be kept and conversation must start with a user turn: %s", out)
+	}
+	if !strings.HasSuffix(messages[len(messages)-1].Get("content").String(), "j") || len(messages) < 4 {
+		t.Fatalf("recent messages must be kept: %d messages", len(messages))
+	}
+	if EstimateRequestTokens(out) > 1200-100 {
+		t.Fatalf("compressed estimate %d exceeds the budget", EstimateRequestTokens(out))
+	}
+
+	// 保留策略无法满足窗口时保留最近的对话，交由上游处理
+	prs.compression.config.KeepRecentMessages = 10
+	if _, note := prs.compressPrompt("codex", Provider{Name: "p"}, "small-model", body); note != "" {
+		t.Fatalf("nothing should be dropped when all messages are retained: %q", note)
+	}
+}
+
+func TestCompressPromptSummarize(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		prompt = gjson.GetBytes(body, "messages.0.content").String()
+		if gjson.GetBytes(body, "model").String() != "cheap" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"user asked about a, b and c"}}]}`))
+	}))
+	defer server.Close()
+
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	if err := prs.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "summarizer", APIURL: server.URL, APIKey: "k", Enabled: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := PromptCompressionConfig{
+		Enabled:          true,
+		Strategy:         CompressionSummarize,
+		ContextWindows:   map[string]int{"small-model": 1500},
+		SummaryProvider:  "summarizer",
+		SummaryModel:     "cheap",
+		SummaryMaxTokens: 100,
+	}
+	if err := prs.SetPromptCompressionConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	out := prs.compressPromptFor(c, "codex", Provider{Name: "p"}, "small-model", longConversation(10))
+	if note := c.GetString(ctxKeyPromptCompression); !strings.HasPrefix(note, CompressionSummarize) {
+		t.Fatalf("note = %q", note)
+	}
+	if !strings.Contains(prompt, "[user]") || !strings.Contains(prompt, "word word") {
+		t.Fatalf("summary prompt = %.200s", prompt)
+	}
+	messages := gjson.GetBytes(out, "messages").Array()
+	if messages[1].Get("role").String() != "system" || !strings.Contains(messages[1].Get("content").String(), "user asked about a, b and c") {
+		t.Fatalf("summary message missing: %s", out)
+	}
+
+	// 摘要失败时退回丢弃最早的对话
+	cfg.SummaryModel = "broken"
+	if err := prs.SetPromptCompressionConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, note := prs.compressPrompt("codex", Provider{Name: "p"}, "small-model", longConversation(10)); !strings.HasPrefix(note, CompressionDropOldest) {
+		t.Fatalf("fallback note = %q", note)
+	}
+}
+
+func TestInsertConversationSummary(t *testing.T) {
+	anthropic, _ := insertConversationSummary("claude", []byte(`{"system":"rules","messages":[]}`), "S")
+	if !strings.HasPrefix(gjson.GetBytes(anthropic, "system").String(), "rules\n\n") {
+		t.Fatalf("anthropic = %s", anthropic)
+	}
+	blocks, _ := insertConversationSummary("claude", []byte(`{"system":[{"type":"text","text":"rules"}],"messages":[]}`), "S")
+	if gjson.GetBytes(blocks, "system.#").Int() != 2 {
+		t.Fatalf("anthropic blocks = %s", blocks)
+	}
+	responses, _ := insertConversationSummary("codex", []byte(`{"input":[{"role":"user","content":"hi"}]}`), "S")
+	if !strings.HasSuffix(gjson.GetBytes(responses, "instructions").String(), "S") {
+		t.Fatalf("responses = %s", responses)
+	}
+	gemini, _ := insertConversationSummary("gemini-cli", []byte(`{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`), "S")
+	if !strings.HasSuffix(gjson.GetBytes(gemini, "systemInstruction.parts.0.text").String(), "S") {
+		t.Fatalf("gemini = %s", gemini)
+	}
+}
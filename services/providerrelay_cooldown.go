@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// cooldownBaseDelay 上游未给出 Retry-After 时的首次冷却时长
+	cooldownBaseDelay = time.Second
+	// cooldownMaxDelay 指数退避的冷却上限
+	cooldownMaxDelay = 60 * time.Second
+	// cooldownMaxRetryAfter Retry-After 的采信上限，防止异常值把 provider 长时间屏蔽
+	cooldownMaxRetryAfter = 10 * time.Minute
+	// cooldownJitter 退避抖动比例，避免多个客户端在同一时刻集中重试
+	cooldownJitter = 0.2
+	// StatusOverloaded Anthropic 过载状态码
+	StatusOverloaded = 529
+)
+
+// providerCooldown 单个 provider 的冷却状态
+type providerCooldown struct {
+	until   time.Time
+	strikes int
+}
+
+// cooldownTracker 按 provider 记录 429/529 后的冷却时间
+type cooldownTracker struct {
+	mu      sync.Mutex
+	entries map[string]providerCooldown
+}
+
+// SetStickyRetryMaxWait 设置同一 provider 排队重试的最长等待时间，<=0 关闭
+// 开启后 provider 返回 429/529 且冷却时间不超过该值时，等待后重试同一 provider，
+// 而不是立即切换（切换 provider 会丢失 prompt cache）
+func (prs *ProviderRelayService) SetStickyRetryMaxWait(wait time.Duration) {
+	if wait < 0 {
+		wait = 0
+	}
+	atomic.StoreInt64(&prs.stickyRetryMaxWait, int64(wait))
+}
+
+// StickyRetryMaxWait 获取同一 provider 排队重试的最长等待时间
+func (prs *ProviderRelayService) StickyRetryMaxWait() time.Duration {
+	return time.Duration(atomic.LoadInt64(&prs.stickyRetryMaxWait))
+}
+
+// isCooldownStatus 判断状态码是否需要冷却：429、529，以及带 Retry-After 的 503
+func isCooldownStatus(status int, header http.Header) bool {
+	switch status {
+	case http.StatusTooManyRequests, StatusOverloaded:
+		return true
+	case http.StatusServiceUnavailable:
+		return header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// parseRetryAfter 解析 Retry-After，支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// cooldownDelay 计算冷却时长：优先采信 Retry-After（只向后抖动，不早于上游要求），
+// 否则按连续失败次数指数退避并加入 ±20% 抖动
+func cooldownDelay(strikes int, retryAfter time.Duration, hasRetryAfter bool) time.Duration {
+	if hasRetryAfter {
+		if retryAfter > cooldownMaxRetryAfter {
+			retryAfter = cooldownMaxRetryAfter
+		}
+		return retryAfter + time.Duration(rand.Float64()*cooldownJitter/2*float64(retryAfter))
+	}
+	delay := cooldownBaseDelay
+	for i := 1; i < strikes && delay < cooldownMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > cooldownMaxDelay {
+		delay = cooldownMaxDelay
+	}
+	factor := 1 + cooldownJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+// updateCooldown 根据上游响应更新 provider 冷却状态：成功时清除，429/529 时延长
+func (prs *ProviderRelayService) updateCooldown(kind, providerName string, status int, header http.Header) {
+	key := providerKey(kind, providerName)
+	success := status >= http.StatusOK && status < http.StatusMultipleChoices
+	if !success && !isCooldownStatus(status, header) {
+		return
+	}
+
+	if success {
+		prs.cooldowns.mu.Lock()
+		delete(prs.cooldowns.entries, key)
+		prs.cooldowns.mu.Unlock()
+		prs.sharedDelete(sharedCooldownKey(key))
+		return
+	}
+
+	// 多副本共享冷却时，连续失败次数取各副本中的最大值
+	var shared sharedCooldown
+	hasShared := prs.sharedGetJSON(sharedCooldownKey(key), &shared)
+
+	prs.cooldowns.mu.Lock()
+	if prs.cooldowns.entries == nil {
+		prs.cooldowns.entries = make(map[string]providerCooldown)
+	}
+	now := time.Now()
+	entry := prs.cooldowns.entries[key]
+	if hasShared && shared.Strikes > entry.strikes {
+		entry.strikes = shared.Strikes
+	}
+	entry.strikes++
+	retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), now)
+	delay := cooldownDelay(entry.strikes, retryAfter, ok)
+	entry.until = now.Add(delay)
+	prs.cooldowns.entries[key] = entry
+	prs.cooldowns.mu.Unlock()
+
+	// 冷却结束后继续保留一段时间，使下一次失败仍能累加退避次数
+	prs.sharedSetJSON(sharedCooldownKey(key), sharedCooldown{UntilMs: entry.until.UnixMilli(), Strikes: entry.strikes}, delay+cooldownMaxDelay)
+
+	fmt.Printf("[Cooldown] Provider %s 返回 %d，冷却 %.1fs（第 %d 次）\n", key, status, delay.Seconds(), entry.strikes)
+}
+
+// cooldownRemaining 返回 provider 剩余冷却时间，共享存储中其他副本设置的冷却同样生效
+func (prs *ProviderRelayService) cooldownRemaining(kind, providerName string) time.Duration {
+	key := providerKey(kind, providerName)
+	prs.cooldowns.mu.Lock()
+	entry := prs.cooldowns.entries[key]
+	prs.cooldowns.mu.Unlock()
+	until := entry.until
+	var shared sharedCooldown
+	if prs.sharedGetJSON(sharedCooldownKey(key), &shared) {
+		if sharedUntil := time.UnixMilli(shared.UntilMs); sharedUntil.After(until) {
+			until = sharedUntil
+		}
+	}
+	if until.IsZero() {
+		return 0
+	}
+	return max(time.Until(until), 0)
+}
+
+// applyCooldowns 跳过冷却中的 provider；若全部处于冷却，按冷却结束时间从早到晚返回全部 provider
+func (prs *ProviderRelayService) applyCooldowns(kind string, providers []Provider) []Provider {
+	ready := make([]Provider, 0, len(providers))
+	remaining := make(map[string]time.Duration)
+	for _, p := range providers {
+		if wait := prs.cooldownRemaining(kind, p.Name); wait > 0 {
+			remaining[p.Name] = wait
+			fmt.Printf("[INFO] Provider %s 冷却中（剩余 %.1fs），已跳过\n", p.Name, wait.Seconds())
+			continue
+		}
+		ready = append(ready, p)
+	}
+	if len(ready) > 0 {
+		return ready
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		return remaining[providers[i].Name] < remaining[providers[j].Name]
+	})
+	return providers
+}
+
+// stickyRetryDelay 返回重试同一 provider 前需要等待的时间；未开启或冷却过长时返回 false
+func (prs *ProviderRelayService) stickyRetryDelay(kind, providerName string) (time.Duration, bool) {
+	maxWait := prs.StickyRetryMaxWait()
+	if maxWait <= 0 {
+		return 0, false
+	}
+	wait := prs.cooldownRemaining(kind, providerName)
+	if wait <= 0 || wait > maxWait {
+		return 0, false
+	}
+	return wait, true
+}
+
+// waitWithContext 等待指定时间，客户端断开时提前返回 false
+func waitWithContext(ctx context.Context, wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
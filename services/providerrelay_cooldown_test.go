@@ -0,0 +1,67 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCooldownDelayBackoff(t *testing.T) {
+	for strikes, base := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: cooldownMaxDelay} {
+		delay := cooldownDelay(strikes, 0, false)
+		low := time.Duration(float64(base) * (1 - cooldownJitter))
+		high := time.Duration(float64(base) * (1 + cooldownJitter))
+		if delay < low || delay > high {
+			t.Errorf("strikes=%d delay=%v, want within [%v, %v]", strikes, delay, low, high)
+		}
+	}
+
+	// Retry-After 只向后抖动，不得早于上游要求
+	if delay := cooldownDelay(1, 10*time.Second, true); delay < 10*time.Second || delay > 11*time.Second {
+		t.Errorf("retry-after delay = %v", delay)
+	}
+	if delay := cooldownDelay(1, time.Hour, true); delay > cooldownMaxRetryAfter*11/10 {
+		t.Errorf("retry-after should be capped, got %v", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if d, ok := parseRetryAfter("2.5", now); !ok || d != 2500*time.Millisecond {
+		t.Errorf("seconds: %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter("Wed, 01 Jan 2025 00:00:30 GMT", now); !ok || d != 30*time.Second {
+		t.Errorf("http date: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Error("invalid value should not parse")
+	}
+}
+
+func TestCooldownSkipsAndStickyRetry(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.updateCooldown("claude", "a", StatusOverloaded, http.Header{"Retry-After": []string{"2"}})
+	prs.updateCooldown("claude", "b", http.StatusInternalServerError, http.Header{})
+
+	providers := prs.applyCooldowns("claude", []Provider{{Name: "a"}, {Name: "b"}})
+	if len(providers) != 1 || providers[0].Name != "b" {
+		t.Fatalf("cooling provider should be skipped, got %+v", providers)
+	}
+
+	if _, retry := prs.stickyRetryDelay("claude", "a"); retry {
+		t.Error("sticky retry should be disabled by default")
+	}
+	prs.SetStickyRetryMaxWait(5 * time.Second)
+	if wait, retry := prs.stickyRetryDelay("claude", "a"); !retry || wait <= 0 {
+		t.Errorf("expected sticky retry, got %v %v", wait, retry)
+	}
+	prs.SetStickyRetryMaxWait(time.Second)
+	if _, retry := prs.stickyRetryDelay("claude", "a"); retry {
+		t.Error("cooldown longer than max wait should fail over")
+	}
+
+	prs.updateCooldown("claude", "a", http.StatusOK, http.Header{})
+	if prs.cooldownRemaining("claude", "a") != 0 {
+		t.Error("success should clear cooldown")
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 跨域访问：Web playground、浏览器扩展等浏览器客户端直接调用转发服务与管理接口时需要 CORS 响应头。
+// 默认关闭，由应用设置（桌面端）或环境变量（网关）开启
+
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	// corsExposedHeaders 允许浏览器脚本读取的响应头
+	corsExposedHeaders = "X-Trace-ID, Retry-After, X-Token-Count-Source, X-CS-Guardrail"
+	// corsMaxAge 预检结果缓存秒数
+	corsMaxAge = "600"
+)
+
+// CORSConfig 跨域访问配置
+type CORSConfig struct {
+	Enabled bool `json:"enabled"`
+	// 允许的来源：完整来源（https://example.com、chrome-extension://<id>）、"*" 或 https://*.example.com
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// 允许的请求头；为空时允许预检请求声明的全部请求头（浏览器版 SDK 会附带 x-stainless-* 等头）
+	AllowedHeaders   []string `json:"allowedHeaders"`
+	AllowCredentials bool     `json:"allowCredentials"`
+}
+
+// corsStore 跨域访问配置
+type corsStore struct {
+	mu     sync.RWMutex
+	config CORSConfig
+}
+
+// Validate 检查来源格式；允许携带凭据时不能放行任意来源
+func (cfg CORSConfig) Validate() error {
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				return fmt.Errorf("allowCredentials cannot be combined with origin *")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("invalid origin %q, want scheme://host[:port]", origin)
+		}
+		if strings.Contains(strings.TrimPrefix(u.Host, "*."), "*") {
+			return fmt.Errorf("invalid origin %q, only a leading *. wildcard is supported", origin)
+		}
+	}
+	return nil
+}
+
+// allowsOrigin 来源是否在允许列表中
+func (cfg CORSConfig) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range cfg.AllowedOrigins {
+		allowed = strings.TrimSuffix(strings.ToLower(allowed), "/")
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// https://*.example.com 匹配任意子域名，不匹配 example.com 本身
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if ok && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) &&
+			len(origin) > len(scheme)+len("://.")+len(host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg CORSConfig) allowsAnyOrigin() bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCORSConfig 更新跨域访问配置，立即生效
+func (prs *ProviderRelayService) SetCORSConfig(cfg CORSConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	prs.cors.mu.Lock()
+	prs.cors.config = cfg
+	prs.cors.mu.Unlock()
+	return nil
+}
+
+// GetCORSConfig 获取跨域访问配置
+func (prs *ProviderRelayService) GetCORSConfig() CORSConfig {
+	prs.cors.mu.RLock()
+	defer prs.cors.mu.RUnlock()
+	return prs.cors.config
+}
+
+// corsMiddleware 为允许的来源添加 CORS 响应头并直接响应预检请求；
+// 未开启或不是跨域请求时不做任何处理
+func (prs *ProviderRelayService) corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		cfg := prs.GetCORSConfig()
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !cfg.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		if cfg.allowsAnyOrigin() && !cfg.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		if len(cfg.AllowedHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+		} else if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		header.Set("Access-Control-Max-Age", corsMaxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
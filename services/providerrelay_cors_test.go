@@ -0,0 +1,175 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSTestRouter(t *testing.T, cfg CORSConfig) *gin.Engine {
+	t.Helper()
+	prs := &ProviderRelayService{}
+	if err := prs.SetCORSConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(prs.corsMiddleware())
+	router.POST("/v1/messages", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	return router
+}
+
+func TestCORSConfigValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  CORSConfig
+		ok   bool
+	}{
+		{"exact and wildcard", CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.example.com", "chrome-extension://abcdef", "http://localhost:5173"}}, true},
+		{"any origin", CORSConfig{AllowedOrigins: []string{"*"}}, true},
+		{"any origin with credentials", CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, false},
+		{"missing scheme", CORSConfig{AllowedOrigins: []string{"example.com"}}, false},
+		{"path", CORSConfig{AllowedOrigins: []string{"https://example.com/app"}}, false},
+		{"inner wildcard", CORSConfig{AllowedOrigins: []string{"https://a.*.example.com"}}, false},
+	}
+	for _, tc := range cases {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestCORSAllowsOrigin(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://App.example.com/", "https://*.example.org"}}
+	cases := map[string]bool{
+		"https://app.example.com":     true,
+		"http://app.example.com":      false,
+		"https://a.example.org":       true,
+		"https://a.b.example.org":     true,
+		"https://example.org":         false,
+		"https://evilexample.org":     false,
+		"https://a.example.org.evil":  false,
+		"https://other.example.com":   false,
+		"chrome-extension://abcdefgh": false,
+	}
+	for origin, want := range cases {
+		if got := cfg.allowsOrigin(origin); got != want {
+			t.Errorf("allowsOrigin(%s) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	cases := []struct {
+		name        string
+		cfg         CORSConfig
+		method      string
+		origin      string
+		reqHeaders  string
+		wantStatus  int
+		wantOrigin  string
+		wantHeaders string
+		wantCreds   string
+	}{
+		{
+			name:       "disabled",
+			cfg:        CORSConfig{AllowedOrigins: []string{"*"}},
+			method:     http.MethodPost,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "any origin",
+			cfg:        CORSConfig{Enabled: true, AllowedOrigins: []string{"*"}},
+			method:     http.MethodPost,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "*",
+		},
+		{
+			name:        "preflight echoes requested headers",
+			cfg:         CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example.com"}},
+			method:      http.MethodOptions,
+			origin:      "https://app.example.com",
+			reqHeaders:  "content-type, x-api-key, anthropic-version",
+			wantStatus:  http.StatusNoContent,
+			wantOrigin:  "https://app.example.com",
+			wantHeaders: "content-type, x-api-key, anthropic-version",
+		},
+		{
+			name:        "preflight with configured headers and credentials",
+			cfg:         CORSConfig{Enabled: true, AllowedOrigins: []string{"https://*.example.com"}, AllowedHeaders: []string{"Content-Type", "Authorization"}, AllowCredentials: true},
+			method:      http.MethodOptions,
+			origin:      "https://app.example.com",
+			reqHeaders:  "x-other",
+			wantStatus:  http.StatusNoContent,
+			wantOrigin:  "https://app.example.com",
+			wantHeaders: "Content-Type, Authorization",
+			wantCreds:   "true",
+		},
+		{
+			name:       "preflight from disallowed origin",
+			cfg:        CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.net",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "request from disallowed origin passes without headers",
+			cfg:        CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodPost,
+			origin:     "https://evil.example.net",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newCORSTestRouter(t, tc.cfg)
+			req := httptest.NewRequest(tc.method, "/v1/messages", nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			if tc.reqHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tc.reqHeaders)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tc.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); got != tc.wantHeaders {
+				t.Errorf("Allow-Headers = %q, want %q", got, tc.wantHeaders)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tc.wantCreds {
+				t.Errorf("Allow-Credentials = %q, want %q", got, tc.wantCreds)
+			}
+			if tc.wantOrigin != "" && tc.method != http.MethodOptions && w.Header().Get("Access-Control-Expose-Headers") == "" {
+				t.Error("Expose-Headers missing")
+			}
+		})
+	}
+}
+
+func TestCORSCoversAdminRoutes(t *testing.T) {
+	prs := &ProviderRelayService{}
+	if err := prs.SetCORSConfig(CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	prs.registerRoutes(router)
+
+	req := httptest.NewRequest(http.MethodOptions, adminAPIPrefix+"/status", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Fatalf("admin preflight: status=%d headers=%v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 路由解释：按 proxyHandler 的过滤与排序规则，说明请求会依次尝试哪些 provider 以及其余 provider 被跳过的原因
+
+// provider 被跳过的原因
+const (
+	routeSkipDisabled         = "disabled"
+	routeSkipNotConfigured    = "not_configured"
+	routeSkipSuspended        = "suspended"
+	routeSkipInvalidConfig    = "invalid_config"
+	routeSkipModelUnsupported = "model_unsupported"
+	routeSkipCooldown         = "cooldown"
+	routeSkipPinned           = "pinned"
+	routeSkipNotInGroup       = "not_in_group"
+)
+
+// 路由模式
+const (
+	routeModePriority   = "priority"
+	routeModeRoundRobin = "round_robin"
+)
+
+// RouteCandidate 参与本次路由的 provider
+type RouteCandidate struct {
+	Order          int    `json:"order"`
+	Name           string `json:"name"`
+	Level          int    `json:"level"`
+	EffectiveModel string `json:"effective_model"`
+	Fallback       bool   `json:"fallback"`
+	RateLimited    bool   `json:"rate_limited"`
+	CooldownMs     int64  `json:"cooldown_ms,omitempty"`
+	CanaryPercent  int    `json:"canary_percent,omitempty"` // 灰度中的 provider 只接收该比例的流量
+}
+
+// RouteSkip 被跳过的 provider
+type RouteSkip struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// RouteExplanation 路由解释结果
+type RouteExplanation struct {
+	Platform      string           `json:"platform"`
+	Model         string           `json:"model"`
+	Mode          string           `json:"mode"`
+	NewAPIEnabled bool             `json:"new_api_enabled"`
+	Pinned        string           `json:"pinned,omitempty"`
+	Group         string           `json:"group,omitempty"` // 命中的 provider 组，此时 Mode 为组的策略
+	Candidates    []RouteCandidate `json:"candidates"`
+	Skipped       []RouteSkip      `json:"skipped"`
+}
+
+// providerLevel 返回优先级分组，0 视为默认值 1
+func providerLevel(p Provider) int {
+	if p.Level == 0 {
+		return 1
+	}
+	return p.Level
+}
+
+// ExplainRoute 说明指定平台 / 模型的请求的 provider 尝试顺序；轮询模式下实际起点随计数器变化
+func (prs *ProviderRelayService) ExplainRoute(kind, model string) (*RouteExplanation, error) {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RouteExplanation{
+		Platform:      kind,
+		Model:         model,
+		Mode:          routeModePriority,
+		NewAPIEnabled: prs.IsNewAPIEnabled() && prs.newAPIURL != "" && prs.newAPIToken != "",
+		Candidates:    []RouteCandidate{},
+		Skipped:       []RouteSkip{},
+	}
+	if prs.IsRoundRobinEnabled() {
+		result.Mode = routeModeRoundRobin
+	}
+
+	active := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		skip := RouteSkip{Name: p.Name}
+		errs := p.ValidateConfiguration()
+		switch {
+		case !p.Enabled:
+			skip.Reason = routeSkipDisabled
+		case p.APIURL == "" || !p.HasCredentials():
+			skip.Reason = routeSkipNotConfigured
+		case p.Suspended:
+			skip.Reason, skip.Detail = routeSkipSuspended, p.SuspendedReason
+		case len(errs) > 0:
+			skip.Reason, skip.Detail = routeSkipInvalidConfig, strings.Join(errs, "; ")
+		case model != "" && !p.IsModelSupported(model):
+			skip.Reason = routeSkipModelUnsupported
+		default:
+			active = append(active, p)
+			continue
+		}
+		result.Skipped = append(result.Skipped, skip)
+	}
+
+	// 模型命中 provider 组时只保留组内成员（按应用指定的组需要请求上下文，这里不解释）；
+	// 非 priority 策略的实际顺序每次请求不同，这里按成员顺序列出
+	if group := prs.resolveProviderGroup(kind, model, ""); group != nil {
+		result.Group, result.Mode = group.Name, group.Strategy
+		members := groupMembers(group, active)
+		inGroup := make(map[string]bool, len(members))
+		for _, p := range members {
+			inGroup[p.Name] = true
+		}
+		for _, p := range active {
+			if !inGroup[p.Name] {
+				result.Skipped = append(result.Skipped, RouteSkip{Name: p.Name, Reason: routeSkipNotInGroup, Detail: group.Name})
+			}
+		}
+		active = members
+	} else {
+		sort.SliceStable(active, func(i, j int) bool {
+			return providerLevel(active[i]) < providerLevel(active[j])
+		})
+	}
+
+	// 冷却中的 provider 被跳过；全部冷却时按冷却结束先后全部尝试
+	cooldowns := make(map[string]int64, len(active))
+	ready := make([]Provider, 0, len(active))
+	for _, p := range active {
+		if wait := prs.cooldownRemaining(kind, p.Name); wait > 0 {
+			cooldowns[p.Name] = wait.Milliseconds()
+			continue
+		}
+		ready = append(ready, p)
+	}
+	if len(ready) == 0 {
+		ready = active
+		sort.SliceStable(ready, func(i, j int) bool {
+			return cooldowns[ready[i].Name] < cooldowns[ready[j].Name]
+		})
+	} else {
+		for _, p := range active {
+			if ms, ok := cooldowns[p.Name]; ok {
+				result.Skipped = append(result.Skipped, RouteSkip{
+					Name:   p.Name,
+					Reason: routeSkipCooldown,
+					Detail: fmt.Sprintf("%.1fs remaining", float64(ms)/1000),
+				})
+			}
+		}
+	}
+
+	rateLimited := make(map[string]bool)
+	for _, p := range ready {
+		if prs.isRateLimitExhausted(kind, p.Name) {
+			rateLimited[p.Name] = true
+		}
+	}
+	ready = prs.deprioritizeRateLimited(kind, ready)
+
+	// 固定 provider 可用时其余 provider 不参与路由
+	if pinned := prs.applyPinnedProvider(kind, ready); len(pinned) == 1 && pinned[0].Name == prs.GetPinnedProvider(kind) {
+		result.Pinned = pinned[0].Name
+		for _, p := range ready {
+			if p.Name != result.Pinned {
+				result.Skipped = append(result.Skipped, RouteSkip{Name: p.Name, Reason: routeSkipPinned})
+			}
+		}
+		ready = pinned
+	}
+
+	primary, fallback := partitionFallbackProviders(ready)
+	for i, p := range append(primary, fallback...) {
+		candidate := RouteCandidate{
+			Order:          i + 1,
+			Name:           p.Name,
+			Level:          providerLevel(p),
+			EffectiveModel: p.GetEffectiveModel(model),
+			Fallback:       i >= len(primary),
+			RateLimited:    rateLimited[p.Name],
+			CooldownMs:     cooldowns[p.Name],
+		}
+		if p.Canary != nil {
+			candidate.CanaryPercent = p.Canary.Percent
+		}
+		result.Candidates = append(result.Candidates, candidate)
+	}
+	return result, nil
+}
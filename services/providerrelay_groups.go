@@ -0,0 +1,313 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// provider 组内的路由策略
+const (
+	GroupStrategyPriority   = "priority"    // 按成员顺序依次尝试（默认）
+	GroupStrategyRoundRobin = "round_robin" // 每次请求轮换起始成员
+	GroupStrategyWeighted   = "weighted"    // 按权重随机选择首个成员，其余按权重降序兜底
+	GroupStrategyRandom     = "random"      // 随机顺序
+)
+
+// ProviderGroup 将多个 provider 组合为一个命名的复合 provider（如 cheap-pool、high-quality）。
+// 模型匹配 Models 的请求，或应用代理规则指定了该组的请求，只在组内成员间路由
+type ProviderGroup struct {
+	Name     string         `json:"name"`
+	Members  []string       `json:"members"`            // provider 名称，priority 策略下按此顺序尝试
+	Strategy string         `json:"strategy,omitempty"` // priority / round_robin / weighted / random
+	Weights  map[string]int `json:"weights,omitempty"`  // weighted 策略的成员权重，未设置为 1
+	Models   []string       `json:"models,omitempty"`   // 路由到该组的模型，支持 * 通配符
+	Disabled bool           `json:"disabled,omitempty"`
+}
+
+// providerGroupStore 各平台的 provider 组（平台 -> 组列表，按模型匹配时按顺序取第一个）
+type providerGroupStore struct {
+	mu     sync.RWMutex
+	groups map[string][]ProviderGroup
+}
+
+// providerGroupError 请求路由到的组内没有可用成员
+type providerGroupError struct {
+	group string
+}
+
+func (e *providerGroupError) Error() string {
+	return fmt.Sprintf("provider 组 %s 中没有可用的 provider", e.group)
+}
+
+// writeProviderGroupError 组内成员全部不可用时返回给客户端
+func writeProviderGroupError(c *gin.Context, err error) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "type": "provider_group_unavailable"})
+}
+
+// providerGroupConfigPath provider 组配置文件
+func providerGroupConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "provider-groups.json"), nil
+}
+
+// GetProviderGroups 获取平台的 provider 组
+func (prs *ProviderRelayService) GetProviderGroups(kind string) []ProviderGroup {
+	prs.providerGroups.mu.RLock()
+	defer prs.providerGroups.mu.RUnlock()
+	return append([]ProviderGroup{}, prs.providerGroups.groups[kind]...)
+}
+
+// SetProviderGroups 更新平台的 provider 组，持久化到 provider-groups.json
+func (prs *ProviderRelayService) SetProviderGroups(kind string, groups []ProviderGroup) error {
+	kind = strings.TrimSpace(kind)
+	if kind == "" {
+		return fmt.Errorf("platform is required")
+	}
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		known[p.Name] = true
+	}
+
+	seen := make(map[string]bool, len(groups))
+	normalized := make([]ProviderGroup, 0, len(groups))
+	for _, group := range groups {
+		group.Name = strings.TrimSpace(group.Name)
+		if err := group.Validate(); err != nil {
+			return err
+		}
+		if seen[group.Name] {
+			return fmt.Errorf("provider 组 %s 重复", group.Name)
+		}
+		seen[group.Name] = true
+		for _, member := range group.Members {
+			if !known[member] {
+				return fmt.Errorf("provider 组 %s 的成员 %s 不存在", group.Name, member)
+			}
+		}
+		if group.Strategy == "" {
+			group.Strategy = GroupStrategyPriority
+		}
+		normalized = append(normalized, group)
+	}
+
+	prs.providerGroups.mu.Lock()
+	defer prs.providerGroups.mu.Unlock()
+	all := make(map[string][]ProviderGroup, len(prs.providerGroups.groups)+1)
+	for k, v := range prs.providerGroups.groups {
+		all[k] = v
+	}
+	if len(normalized) == 0 {
+		delete(all, kind)
+	} else {
+		all[kind] = normalized
+	}
+
+	path, err := providerGroupConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.providerGroups.groups = all
+	return nil
+}
+
+// loadProviderGroups 启动时从 provider-groups.json 恢复
+func (prs *ProviderRelayService) loadProviderGroups() {
+	path, err := providerGroupConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var groups map[string][]ProviderGroup
+	if err := json.Unmarshal(data, &groups); err != nil {
+		fmt.Printf("[ProviderGroup] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	prs.providerGroups.mu.Lock()
+	prs.providerGroups.groups = groups
+	prs.providerGroups.mu.Unlock()
+}
+
+// Validate 检查组名、成员、策略与权重
+func (g ProviderGroup) Validate() error {
+	if g.Name == "" {
+		return fmt.Errorf("provider 组名称不能为空")
+	}
+	if len(g.Members) == 0 {
+		return fmt.Errorf("provider 组 %s 至少需要一个成员", g.Name)
+	}
+	members := make(map[string]bool, len(g.Members))
+	for _, member := range g.Members {
+		if members[member] {
+			return fmt.Errorf("provider 组 %s 的成员 %s 重复", g.Name, member)
+		}
+		members[member] = true
+	}
+	switch g.Strategy {
+	case "", GroupStrategyPriority, GroupStrategyRoundRobin, GroupStrategyWeighted, GroupStrategyRandom:
+	default:
+		return fmt.Errorf("provider 组 %s 的策略 %q 无效", g.Name, g.Strategy)
+	}
+	for member, weight := range g.Weights {
+		if !members[member] {
+			return fmt.Errorf("provider 组 %s 的权重对应的 %s 不是成员", g.Name, member)
+		}
+		if weight < 0 {
+			return fmt.Errorf("provider 组 %s 的权重不能为负数", g.Name)
+		}
+	}
+	return nil
+}
+
+// resolveProviderGroup 确定请求使用的组：应用代理规则指定的组优先，其次是 Models 匹配请求模型的第一个组
+func (prs *ProviderRelayService) resolveProviderGroup(kind, model, appName string) *ProviderGroup {
+	groups := prs.GetProviderGroups(kind)
+	if len(groups) == 0 {
+		return nil
+	}
+	if prs.proxyController != nil && appName != "" {
+		if rules := prs.proxyController.GetRules(appName); rules != nil && rules.ProviderGroup != "" {
+			for i := range groups {
+				if groups[i].Name == rules.ProviderGroup && !groups[i].Disabled {
+					return &groups[i]
+				}
+			}
+			fmt.Printf("[WARN] 应用 %s 指定的 provider 组 %s 在平台 %s 不存在或已停用，按模型路由\n", appName, rules.ProviderGroup, kind)
+		}
+	}
+	if model == "" {
+		return nil
+	}
+	for i := range groups {
+		if groups[i].Disabled {
+			continue
+		}
+		for _, pattern := range groups[i].Models {
+			if matchWildcard(pattern, model) {
+				return &groups[i]
+			}
+		}
+	}
+	return nil
+}
+
+// applyProviderGroup 将候选 provider 限制为组内成员，并按组的策略排序。
+// 未命中任何组时原样返回 nil 组；命中但成员全部不可用时返回 providerGroupError
+func (prs *ProviderRelayService) applyProviderGroup(c *gin.Context, kind, model string, body []byte, active []Provider) ([]Provider, *ProviderGroup, error) {
+	appName := ""
+	if prs.proxyController != nil {
+		appName = clientFingerprintFor(c, body).App
+	}
+	group := prs.resolveProviderGroup(kind, model, appName)
+	if group == nil {
+		return active, nil, nil
+	}
+	members := groupMembers(group, active)
+	if len(members) == 0 {
+		return nil, group, &providerGroupError{group: group.Name}
+	}
+	fmt.Printf("[INFO] 路由到 provider 组 %s（%s，%d/%d 个成员可用）\n", group.Name, group.Strategy, len(members), len(group.Members))
+	return prs.orderGroupMembers(kind, group, members), group, nil
+}
+
+// groupMembers 按组内成员顺序返回 active 中属于该组的 provider
+func groupMembers(group *ProviderGroup, active []Provider) []Provider {
+	byName := make(map[string]Provider, len(active))
+	for _, p := range active {
+		byName[p.Name] = p
+	}
+	members := make([]Provider, 0, len(group.Members))
+	for _, name := range group.Members {
+		if p, ok := byName[name]; ok {
+			members = append(members, p)
+		}
+	}
+	return members
+}
+
+// orderGroupMembers 按组策略确定成员的尝试顺序
+func (prs *ProviderRelayService) orderGroupMembers(kind string, group *ProviderGroup, members []Provider) []Provider {
+	switch group.Strategy {
+	case GroupStrategyRoundRobin:
+		start := int(prs.nextRoundRobin("group:"+kind+"/"+group.Name) % uint64(len(members)))
+		return append(append([]Provider{}, members[start:]...), members[:start]...)
+	case GroupStrategyRandom:
+		shuffled := append([]Provider{}, members...)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		return shuffled
+	case GroupStrategyWeighted:
+		weight := func(p Provider) int {
+			if w, ok := group.Weights[p.Name]; ok {
+				return w
+			}
+			return 1
+		}
+		total := 0
+		for _, p := range members {
+			total += weight(p)
+		}
+		ordered := append([]Provider{}, members...)
+		sort.SliceStable(ordered, func(i, j int) bool { return weight(ordered[i]) > weight(ordered[j]) })
+		if total <= 0 {
+			return ordered
+		}
+		pick := rand.Intn(total)
+		for i, p := range ordered {
+			if pick < weight(p) {
+				first := ordered[i]
+				return append([]Provider{first}, append(append([]Provider{}, ordered[:i]...), ordered[i+1:]...)...)
+			}
+			pick -= weight(p)
+		}
+		return ordered
+	}
+	return members
+}
+
+func (prs *ProviderRelayService) adminGetProviderGroupsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"groups": prs.GetProviderGroups(c.Param("kind"))})
+}
+
+func (prs *ProviderRelayService) adminUpdateProviderGroupsHandler(c *gin.Context) {
+	var req struct {
+		Groups []ProviderGroup `json:"groups"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	kind := c.Param("kind")
+	if err := prs.SetProviderGroups(kind, req.Groups); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": prs.GetProviderGroups(kind)})
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupGroupTest(t *testing.T) (*ProviderRelayService, []Provider) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{providerService: NewProviderService(), startTime: time.Now()}
+	providers := []Provider{
+		{ID: 1, Name: "official", APIURL: "https://a.example.com", APIKey: "k", Enabled: true, Level: 1},
+		{ID: 2, Name: "reseller-a", APIURL: "https://b.example.com", APIKey: "k", Enabled: true, Level: 2},
+		{ID: 3, Name: "reseller-b", APIURL: "https://c.example.com", APIKey: "k", Enabled: true, Level: 3},
+	}
+	if err := prs.providerService.SaveProviders("claude", providers); err != nil {
+		t.Fatal(err)
+	}
+	return prs, providers
+}
+
+func TestProviderGroupsValidateAndPersist(t *testing.T) {
+	prs, _ := setupGroupTest(t)
+
+	invalid := [][]ProviderGroup{
+		{{Name: "", Members: []string{"official"}}},
+		{{Name: "empty"}},
+		{{Name: "unknown", Members: []string{"missing"}}},
+		{{Name: "dup", Members: []string{"official", "official"}}},
+		{{Name: "bad", Members: []string{"official"}, Strategy: "fastest"}},
+		{{Name: "w", Members: []string{"official"}, Weights: map[string]int{"reseller-a": 2}}},
+		{{Name: "x", Members: []string{"official"}}, {Name: "x", Members: []string{"reseller-a"}}},
+	}
+	for i, groups := range invalid {
+		if err := prs.SetProviderGroups("claude", groups); err == nil {
+			t.Fatalf("case %d: expected validation error", i)
+		}
+	}
+
+	groups := []ProviderGroup{{Name: "cheap-pool", Members: []string{"reseller-b", "reseller-a"}, Models: []string{"claude-haiku-*"}}}
+	if err := prs.SetProviderGroups("claude", groups); err != nil {
+		t.Fatal(err)
+	}
+	restarted := &ProviderRelayService{providerService: prs.providerService}
+	restarted.loadProviderGroups()
+	got := restarted.GetProviderGroups("claude")
+	if len(got) != 1 || got[0].Strategy != GroupStrategyPriority || got[0].Members[0] != "reseller-b" {
+		t.Fatalf("reloaded groups = %+v", got)
+	}
+	if err := restarted.SetProviderGroups("claude", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(restarted.GetProviderGroups("claude")) != 0 {
+		t.Fatal("groups should be cleared")
+	}
+}
+
+func TestApplyProviderGroupByModel(t *testing.T) {
+	prs, providers := setupGroupTest(t)
+	if err := prs.SetProviderGroups("claude", []ProviderGroup{
+		{Name: "cheap-pool", Members: []string{"reseller-b", "reseller-a"}, Models: []string{"claude-haiku-*"}},
+		{Name: "rotating", Members: []string{"official", "reseller-a", "reseller-b"}, Strategy: GroupStrategyRoundRobin, Models: []string{"claude-sonnet-*"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	routed, group, err := prs.applyProviderGroup(c, "claude", "claude-haiku-4-5", nil, providers)
+	if err != nil || group == nil || group.Name != "cheap-pool" {
+		t.Fatalf("group = %+v, err = %v", group, err)
+	}
+	if len(routed) != 2 || routed[0].Name != "reseller-b" || routed[1].Name != "reseller-a" {
+		t.Fatalf("priority order = %+v", routed)
+	}
+
+	// Models outside every group keep the normal routing
+	routed, group, err = prs.applyProviderGroup(c, "claude", "claude-opus-4", nil, providers)
+	if err != nil || group != nil || len(routed) != 3 {
+		t.Fatalf("ungrouped model: group=%v routed=%d err=%v", group, len(routed), err)
+	}
+
+	// Round robin rotates the first member between requests
+	first, _, _ := prs.applyProviderGroup(c, "claude", "claude-sonnet-4-5", nil, providers)
+	second, _, _ := prs.applyProviderGroup(c, "claude", "claude-sonnet-4-5", nil, providers)
+	if first[0].Name == second[0].Name || len(first) != 3 {
+		t.Fatalf("round robin did not rotate: %s then %s", first[0].Name, second[0].Name)
+	}
+
+	// No member available
+	if _, _, err := prs.applyProviderGroup(c, "claude", "claude-haiku-4-5", nil, providers[:1]); err == nil {
+		t.Fatal("expected error when no group member is available")
+	}
+
+	explain, err := prs.ExplainRoute("claude", "claude-haiku-4-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explain.Group != "cheap-pool" || len(explain.Candidates) != 2 || explain.Candidates[0].Name != "reseller-b" ||
+		len(explain.Skipped) != 1 || explain.Skipped[0].Reason != routeSkipNotInGroup {
+		t.Fatalf("explanation = %+v", explain)
+	}
+}
+
+func TestOrderGroupMembersWeighted(t *testing.T) {
+	prs := &ProviderRelayService{}
+	members := []Provider{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	group := &ProviderGroup{Name: "w", Members: []string{"a", "b", "c"}, Strategy: GroupStrategyWeighted, Weights: map[string]int{"a": 0, "b": 5, "c": 0}}
+	for i := 0; i < 20; i++ {
+		ordered := prs.orderGroupMembers("claude", group, members)
+		if len(ordered) != 3 || ordered[0].Name != "b" {
+			t.Fatalf("weighted order = %+v", ordered)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeswitch/services/gatewaypb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC 管理 / 流式接口（定义见 gatewaypb/gateway.proto），与 HTTP 管理 API 共用管理令牌，供自动化脚本与 CLI 使用
+
+// grpcStopTimeout 优雅关闭的等待时间，超时后强制断开（日志流不会自行结束）
+const grpcStopTimeout = 5 * time.Second
+
+// grpcStore gRPC 服务实例
+type grpcStore struct {
+	mu     sync.Mutex
+	server *grpc.Server
+}
+
+// grpcGatewayServer 实现 gatewaypb.GatewayServiceServer
+type grpcGatewayServer struct {
+	gatewaypb.UnimplementedGatewayServiceServer
+	prs *ProviderRelayService
+}
+
+// NewGRPCServer 创建注册了 GatewayService 的 gRPC 服务，所有调用需通过管理令牌校验
+func (prs *ProviderRelayService) NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := prs.authorizeGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := prs.authorizeGRPC(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	gatewaypb.RegisterGatewayServiceServer(server, &grpcGatewayServer{prs: prs})
+	return server
+}
+
+// StartGRPC 在 addr 上启动 gRPC 服务（非阻塞），Stop 时一并关闭
+func (prs *ProviderRelayService) StartGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := prs.NewGRPCServer()
+	prs.grpc.mu.Lock()
+	prs.grpc.server = server
+	prs.grpc.mu.Unlock()
+
+	fmt.Printf("provider relay gRPC server listening on %s\n", lis.Addr())
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			fmt.Printf("provider relay gRPC server error: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// stopGRPC 优雅关闭 gRPC 服务
+func (prs *ProviderRelayService) stopGRPC() {
+	prs.grpc.mu.Lock()
+	server := prs.grpc.server
+	prs.grpc.server = nil
+	prs.grpc.mu.Unlock()
+	if server == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grpcStopTimeout):
+		server.Stop()
+	}
+}
+
+// authorizeGRPC 校验 metadata 中的 authorization: Bearer <token> 或 x-admin-token
+func (prs *ProviderRelayService) authorizeGRPC(ctx context.Context) error {
+	var given string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(strings.ToLower(adminTokenHeader)); len(values) > 0 {
+			given = values[0]
+		} else if values := md.Get("authorization"); len(values) > 0 {
+			given = strings.TrimPrefix(values[0], "Bearer ")
+		}
+	}
+	var remoteIP net.IP
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, ok := p.Addr.(*net.TCPAddr); ok {
+			remoteIP = addr.IP
+		}
+	}
+	if !prs.checkAdminToken(given, remoteIP) {
+		return status.Error(codes.Unauthenticated, "admin token required")
+	}
+	return nil
+}
+
+// grpcError 将内部错误转换为 gRPC 状态码
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, errProviderNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errProviderExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// grpcPlatform 校验平台参数
+func grpcPlatform(kind string) error {
+	if !isAdminPlatform(kind) {
+		return status.Error(codes.InvalidArgument, "unknown platform: "+kind)
+	}
+	return nil
+}
+
+func (s *grpcGatewayServer) GetMetrics(_ context.Context, req *gatewaypb.GetMetricsRequest) (*gatewaypb.MetricsSnapshot, error) {
+	period := req.GetPeriod()
+	if period == "" {
+		period = "today"
+	}
+	stats, err := s.prs.GetLogStatistics(period)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	toInt64Map := func(m map[string]int) map[string]int64 {
+		result := make(map[string]int64, len(m))
+		for key, value := range m {
+			result[key] = int64(value)
+		}
+		return result
+	}
+	return &gatewaypb.MetricsSnapshot{
+		Period:            period,
+		Version:           AppVersion,
+		UptimeSec:         int64(time.Since(s.prs.startTime).Seconds()),
+		TotalRequests:     int64(stats.TotalRequests),
+		TotalTokens:       int64(stats.TotalTokens),
+		TotalInputTokens:  int64(stats.TotalInputTokens),
+		TotalOutputTokens: int64(stats.TotalOutputTokens),
+		TotalCost:         stats.TotalCost,
+		SuccessRate:       stats.SuccessRate,
+		AvgDurationSec:    stats.AvgDuration,
+		ByPlatform:        toInt64Map(stats.ByPlatform),
+		ByModel:           toInt64Map(stats.ByModel),
+		ByProvider:        toInt64Map(stats.ByProvider),
+	}, nil
+}
+
+// providerToProto 转换为 protobuf 消息（密钥掩码，附带运行时状态）
+func (s *grpcGatewayServer) providerToProto(kind string, p Provider) *gatewaypb.Provider {
+	models := make([]string, 0, len(p.SupportedModels))
+	for model, ok := range p.SupportedModels {
+		if ok {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return &gatewaypb.Provider{
+		Platform:        kind,
+		Id:              int32(p.ID),
+		Name:            p.Name,
+		ApiUrl:          p.APIURL,
+		ApiKey:          maskAPIKey(p.APIKey),
+		Enabled:         p.Enabled,
+		Level:           int32(p.Level),
+		ProviderType:    p.ProviderType,
+		AuthType:        p.AuthType,
+		FallbackOnly:    p.FallbackOnly,
+		SupportedModels: models,
+		ModelMapping:    p.ModelMapping,
+		Suspended:       p.Suspended,
+		SuspendedReason: p.SuspendedReason,
+		Ready:           p.Enabled && !p.Suspended && p.APIURL != "" && p.HasCredentials(),
+		CooldownMs:      s.prs.cooldownRemaining(kind, p.Name).Milliseconds(),
+	}
+}
+
+// applyProtoProvider 将消息中的可写字段合并到 provider，其余配置保持不变
+func applyProtoProvider(p Provider, msg *gatewaypb.Provider) Provider {
+	p.Name = msg.GetName()
+	p.APIURL = msg.GetApiUrl()
+	p.APIKey = msg.GetApiKey()
+	p.Enabled = msg.GetEnabled()
+	p.Level = int(msg.GetLevel())
+	p.ProviderType = msg.GetProviderType()
+	p.AuthType = msg.GetAuthType()
+	p.FallbackOnly = msg.GetFallbackOnly()
+	p.SupportedModels = nil
+	if models := msg.GetSupportedModels(); len(models) > 0 {
+		p.SupportedModels = make(map[string]bool, len(models))
+		for _, model := range models {
+			p.SupportedModels[model] = true
+		}
+	}
+	p.ModelMapping = msg.GetModelMapping()
+	return p
+}
+
+func (s *grpcGatewayServer) ListProviders(_ context.Context, req *gatewaypb.ListProvidersRequest) (*gatewaypb.ListProvidersResponse, error) {
+	kind := req.GetPlatform()
+	if err := grpcPlatform(kind); err != nil {
+		return nil, err
+	}
+	providers, err := s.prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &gatewaypb.ListProvidersResponse{Providers: make([]*gatewaypb.Provider, 0, len(providers))}
+	for _, p := range providers {
+		resp.Providers = append(resp.Providers, s.providerToProto(kind, p))
+	}
+	return resp, nil
+}
+
+func (s *grpcGatewayServer) CreateProvider(_ context.Context, req *gatewaypb.CreateProviderRequest) (*gatewaypb.Provider, error) {
+	kind := req.GetProvider().GetPlatform()
+	if err := grpcPlatform(kind); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.GetProvider().GetName()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "provider name is required")
+	}
+	provider, err := s.prs.createProvider(kind, applyProtoProvider(Provider{}, req.GetProvider()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return s.providerToProto(kind, provider), nil
+}
+
+func (s *grpcGatewayServer) UpdateProvider(_ context.Context, req *gatewaypb.UpdateProviderRequest) (*gatewaypb.Provider, error) {
+	msg := req.GetProvider()
+	kind := msg.GetPlatform()
+	if err := grpcPlatform(kind); err != nil {
+		return nil, err
+	}
+	provider, err := s.prs.updateProvider(kind, int(msg.GetId()), func(existing Provider) Provider {
+		return applyProtoProvider(existing, msg)
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return s.providerToProto(kind, provider), nil
+}
+
+func (s *grpcGatewayServer) DeleteProvider(_ context.Context, req *gatewaypb.DeleteProviderRequest) (*gatewaypb.DeleteProviderResponse, error) {
+	if err := grpcPlatform(req.GetPlatform()); err != nil {
+		return nil, err
+	}
+	if err := s.prs.deleteProvider(req.GetPlatform(), int(req.GetId())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &gatewaypb.DeleteProviderResponse{}, nil
+}
+
+func (s *grpcGatewayServer) SuspendProvider(_ context.Context, req *gatewaypb.SuspendProviderRequest) (*gatewaypb.Provider, error) {
+	reason := req.GetReason()
+	if reason == "" {
+		reason = "suspended via gRPC API"
+	}
+	return s.toggleSuspend(req.GetPlatform(), int(req.GetId()), func(name string) error {
+		return s.prs.SuspendProvider(req.GetPlatform(), name, reason)
+	})
+}
+
+func (s *grpcGatewayServer) ResumeProvider(_ context.Context, req *gatewaypb.ResumeProviderRequest) (*gatewaypb.Provider, error) {
+	return s.toggleSuspend(req.GetPlatform(), int(req.GetId()), func(name string) error {
+		return s.prs.ResumeProvider(req.GetPlatform(), name)
+	})
+}
+
+// toggleSuspend 挂起 / 恢复 provider 并返回最新状态
+func (s *grpcGatewayServer) toggleSuspend(kind string, id int, apply func(name string) error) (*gatewaypb.Provider, error) {
+	if err := grpcPlatform(kind); err != nil {
+		return nil, err
+	}
+	provider, err := s.prs.findProvider(kind, id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := apply(provider.Name); err != nil {
+		return nil, grpcError(err)
+	}
+	if provider, err = s.prs.findProvider(kind, id); err != nil {
+		return nil, grpcError(err)
+	}
+	return s.providerToProto(kind, provider), nil
+}
+
+func (s *grpcGatewayServer) StreamLogs(req *gatewaypb.StreamLogsRequest, stream gatewaypb.GatewayService_StreamLogsServer) error {
+	logs, cancel := s.prs.SubscribeRequestLogs(LogTailFilter{
+		Platform:   req.GetPlatform(),
+		Provider:   req.GetProvider(),
+		Model:      req.GetModel(),
+		ErrorsOnly: req.GetErrorsOnly(),
+	})
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case log, ok := <-logs:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(requestLogToProto(log)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// requestLogToProto 转换请求日志（不含客户端 IP、User-Agent 等信息）
+func requestLogToProto(log ReqeustLog) *gatewaypb.RequestLog {
+	return &gatewaypb.RequestLog{
+		TraceId:           log.TraceID,
+		ConversationId:    log.ConversationID,
+		Project:           log.Project,
+		ApiKeyId:          log.APIKeyID,
+		Platform:          log.Platform,
+		Model:             log.Model,
+		Provider:          log.Provider,
+		HttpCode:          int32(log.HttpCode),
+		InputTokens:       int64(log.InputTokens),
+		OutputTokens:      int64(log.OutputTokens),
+		CacheCreateTokens: int64(log.CacheCreateTokens),
+		CacheReadTokens:   int64(log.CacheReadTokens),
+		ReasoningTokens:   int64(log.ReasoningTokens),
+		IsStream:          log.IsStream,
+		DurationSec:       log.DurationSec,
+		RequestPath:       log.RequestPath,
+		ErrorType:         log.ErrorType,
+		ErrorMessage:      log.ErrorMessage,
+		TotalCost:         log.TotalCost,
+		CreatedAt:         log.CreatedAt,
+	}
+}
+
+func (s *grpcGatewayServer) ExplainRoute(_ context.Context, req *gatewaypb.ExplainRouteRequest) (*gatewaypb.ExplainRouteResponse, error) {
+	if err := grpcPlatform(req.GetPlatform()); err != nil {
+		return nil, err
+	}
+	explanation, err := s.prs.ExplainRoute(req.GetPlatform(), req.GetModel())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &gatewaypb.ExplainRouteResponse{
+		Platform:      explanation.Platform,
+		Model:         explanation.Model,
+		Mode:          explanation.Mode,
+		NewApiEnabled: explanation.NewAPIEnabled,
+	}
+	for _, c := range explanation.Candidates {
+		resp.Candidates = append(resp.Candidates, &gatewaypb.RouteCandidate{
+			Order:          int32(c.Order),
+			Name:           c.Name,
+			Level:          int32(c.Level),
+			EffectiveModel: c.EffectiveModel,
+			Fallback:       c.Fallback,
+			RateLimited:    c.RateLimited,
+			CooldownMs:     c.CooldownMs,
+		})
+	}
+	for _, skip := range explanation.Skipped {
+		resp.Skipped = append(resp.Skipped, &gatewaypb.SkippedProvider{
+			Name:   skip.Name,
+			Reason: skip.Reason,
+			Detail: skip.Detail,
+		})
+	}
+	return resp, nil
+}
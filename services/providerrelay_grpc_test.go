@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"codeswitch/services/gatewaypb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newGRPCTestClient(t *testing.T) (*ProviderRelayService, gatewaypb.GatewayServiceClient) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{providerService: NewProviderService(), startTime: time.Now()}
+	prs.SetAdminToken("s3cret")
+
+	lis := bufconn.Listen(1 << 20)
+	server := prs.NewGRPCServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return prs, gatewaypb.NewGatewayServiceClient(conn)
+}
+
+func grpcAuth(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer s3cret")
+}
+
+func TestGRPCRequiresAdminToken(t *testing.T) {
+	_, client := newGRPCTestClient(t)
+	_, err := client.ListProviders(context.Background(), &gatewaypb.ListProvidersRequest{Platform: "claude"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+	_, err = client.ListProviders(grpcAuth(context.Background()), &gatewaypb.ListProvidersRequest{Platform: "unknown"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for unknown platform, got %v", err)
+	}
+}
+
+func TestGRPCProviderManagement(t *testing.T) {
+	_, client := newGRPCTestClient(t)
+	ctx := grpcAuth(context.Background())
+
+	created, err := client.CreateProvider(ctx, &gatewaypb.CreateProviderRequest{Provider: &gatewaypb.Provider{
+		Platform: "claude", Name: "relay", ApiUrl: "https://relay.example.com", ApiKey: "sk-1234567890abcdef", Enabled: true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id != 1 || created.ApiKey != "sk-1****cdef" || !created.Ready {
+		t.Fatalf("unexpected created provider: %+v", created)
+	}
+	if _, err := client.CreateProvider(ctx, &gatewaypb.CreateProviderRequest{Provider: &gatewaypb.Provider{
+		Platform: "claude", Name: "relay", ApiUrl: "https://other.example.com",
+	}}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists, got %v", err)
+	}
+
+	// 掩码密钥保留原值
+	updated, err := client.UpdateProvider(ctx, &gatewaypb.UpdateProviderRequest{Provider: &gatewaypb.Provider{
+		Platform: "claude", Id: 1, ApiUrl: "https://relay2.example.com", ApiKey: created.ApiKey, Enabled: true, Level: 2,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "relay" || updated.Level != 2 || updated.ApiKey != created.ApiKey {
+		t.Fatalf("unexpected updated provider: %+v", updated)
+	}
+
+	suspended, err := client.SuspendProvider(ctx, &gatewaypb.SuspendProviderRequest{Platform: "claude", Id: 1, Reason: "maintenance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !suspended.Suspended || suspended.SuspendedReason != "maintenance" || suspended.Ready {
+		t.Fatalf("expected suspended provider, got %+v", suspended)
+	}
+	if resumed, err := client.ResumeProvider(ctx, &gatewaypb.ResumeProviderRequest{Platform: "claude", Id: 1}); err != nil || resumed.Suspended {
+		t.Fatalf("resume failed: %v %+v", err, resumed)
+	}
+
+	if _, err := client.DeleteProvider(ctx, &gatewaypb.DeleteProviderRequest{Platform: "claude", Id: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteProvider(ctx, &gatewaypb.DeleteProviderRequest{Platform: "claude", Id: 1}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	list, err := client.ListProviders(ctx, &gatewaypb.ListProvidersRequest{Platform: "claude"})
+	if err != nil || len(list.Providers) != 0 {
+		t.Fatalf("expected empty list, got %v %+v", err, list)
+	}
+}
+
+func TestGRPCStreamLogs(t *testing.T) {
+	prs, client := newGRPCTestClient(t)
+	ctx, cancel := context.WithTimeout(grpcAuth(context.Background()), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamLogs(ctx, &gatewaypb.StreamLogsRequest{Platform: "codex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 等待订阅建立后再发布
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		prs.logTail.mu.Lock()
+		n := len(prs.logTail.subscribers)
+		prs.logTail.mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	prs.publishRequestLog(&ReqeustLog{Platform: "claude", Model: "skipped"})
+	prs.publishRequestLog(&ReqeustLog{Platform: "codex", Model: "gpt-5", Provider: "p", HttpCode: 200, InputTokens: 12})
+
+	log, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Model != "gpt-5" || log.InputTokens != 12 || log.CreatedAt == "" {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+}
+
+func TestExplainRoute(t *testing.T) {
+	prs, client := newGRPCTestClient(t)
+	providers := []Provider{
+		{ID: 1, Name: "off", APIURL: "https://a.example.com", APIKey: "k", Enabled: false},
+		{ID: 2, Name: "low", APIURL: "https://b.example.com", APIKey: "k", Enabled: true, Level: 2},
+		{ID: 3, Name: "high", APIURL: "https://c.example.com", APIKey: "k", Enabled: true, Level: 1,
+			SupportedModels: map[string]bool{"openai/gpt-5": true}, ModelMapping: map[string]string{"gpt-5": "openai/gpt-5"}},
+		{ID: 4, Name: "cooling", APIURL: "https://d.example.com", APIKey: "k", Enabled: true},
+		{ID: 5, Name: "local", APIURL: "http://localhost:11434", APIKey: "k", Enabled: true, FallbackOnly: true},
+		{ID: 6, Name: "mini-only", APIURL: "https://e.example.com", APIKey: "k", Enabled: true,
+			SupportedModels: map[string]bool{"gpt-5-mini": true}},
+	}
+	if err := prs.providerService.SaveProviders("codex", providers); err != nil {
+		t.Fatal(err)
+	}
+	prs.updateCooldown("codex", "cooling", http.StatusTooManyRequests, http.Header{"Retry-After": []string{"30"}})
+
+	resp, err := client.ExplainRoute(grpcAuth(context.Background()), &gatewaypb.ExplainRouteRequest{Platform: "codex", Model: "gpt-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, c := range resp.Candidates {
+		order = append(order, c.Name)
+	}
+	if len(order) != 3 || order[0] != "high" || order[1] != "low" || order[2] != "local" {
+		t.Fatalf("unexpected order: %v", order)
+	}
+	if resp.Candidates[0].EffectiveModel != "openai/gpt-5" || !resp.Candidates[2].Fallback || resp.Mode != routeModePriority {
+		t.Fatalf("unexpected candidates: %+v", resp.Candidates)
+	}
+	reasons := make(map[string]string)
+	for _, skip := range resp.Skipped {
+		reasons[skip.Name] = skip.Reason
+	}
+	if reasons["off"] != routeSkipDisabled || reasons["cooling"] != routeSkipCooldown || reasons["mini-only"] != routeSkipModelUnsupported {
+		t.Fatalf("unexpected skip reasons: %v", reasons)
+	}
+}
@@ -0,0 +1,492 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// GuardrailAction 出站提示词命中内容规则后的处理方式
+type GuardrailAction string
+
+const (
+	GuardrailActionOff    GuardrailAction = "off"    // 不扫描
+	GuardrailActionWarn   GuardrailAction = "warn"   // 放行，记录违规并告警
+	GuardrailActionRedact GuardrailAction = "redact" // 把命中内容替换为 [REDACTED:规则名] 后放行
+	GuardrailActionBlock  GuardrailAction = "block"  // 拒绝请求
+)
+
+// GuardrailEventViolation webhook 告警事件类型
+const GuardrailEventViolation = "guardrail.violation"
+
+// guardrailScanLimit 超过该大小的请求体只扫描开头部分，避免正则拖慢大请求
+const guardrailScanLimit = 8 << 20
+
+// GuardrailPattern 一条内容规则（RE2 正则）
+type GuardrailPattern struct {
+	Name  string   `json:"name"`
+	Regex string   `json:"regex"`
+	Apps  []string `json:"apps,omitempty"` // 仅对这些应用生效，空表示全部应用
+}
+
+// GuardrailPolicy 出站内容策略：扫描发往上游的提示词，防止密钥、内网地址、客户数据泄露
+type GuardrailPolicy struct {
+	Enabled bool `json:"enabled"`
+	// BuiltinSecrets 启用内置密钥规则（云厂商 Access Key、私钥、GitHub / Slack / LLM API Token）
+	BuiltinSecrets bool               `json:"builtin_secrets"`
+	Patterns       []GuardrailPattern `json:"patterns,omitempty"`
+	// DefaultAction 未单独配置的应用使用的动作，空表示 warn
+	DefaultAction GuardrailAction `json:"default_action"`
+	// AppActions 按应用覆盖动作，如 {"cursor": "block", "script": "off"}
+	AppActions map[string]GuardrailAction `json:"app_actions,omitempty"`
+	// WebhookURL 违规事件以 JSON POST 推送的地址
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// builtinGuardrailPatterns 内置密钥规则
+var builtinGuardrailPatterns = []GuardrailPattern{
+	{Name: "aws_access_key", Regex: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "private_key", Regex: `-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY( BLOCK)?-----`},
+	{Name: "github_token", Regex: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`},
+	{Name: "slack_token", Regex: `\bxox[abposr]-[A-Za-z0-9-]{10,}\b`},
+	{Name: "google_api_key", Regex: `\bAIza[0-9A-Za-z_-]{35}\b`},
+	{Name: "llm_api_key", Regex: `\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{32,}\b`},
+}
+
+// GuardrailHit 单条规则的命中次数，不包含命中内容本身
+type GuardrailHit struct {
+	Pattern string `json:"pattern"`
+	Matches int    `json:"matches"`
+}
+
+// GuardrailViolation 违规记录
+type GuardrailViolation struct {
+	ID          int64           `json:"id"`
+	AppName     string          `json:"app_name"`
+	Platform    string          `json:"platform"`
+	Model       string          `json:"model"`
+	RequestPath string          `json:"request_path"`
+	ClientIP    string          `json:"client_ip"`
+	Action      GuardrailAction `json:"action"`
+	Patterns    string          `json:"patterns"` // 命中的规则名，逗号分隔
+	Matches     int             `json:"matches"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+// GuardrailAlert 推送到 webhook 的违规事件
+type GuardrailAlert struct {
+	Type      string          `json:"type"`
+	App       string          `json:"app"`
+	Platform  string          `json:"platform"`
+	Model     string          `json:"model,omitempty"`
+	Action    GuardrailAction `json:"action"`
+	Hits      []GuardrailHit  `json:"hits"`
+	ClientIP  string          `json:"client_ip,omitempty"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+type compiledGuardrailPattern struct {
+	name string
+	re   *regexp.Regexp
+	apps []string
+}
+
+// guardrailStore 当前生效的策略与编译后的规则
+type guardrailStore struct {
+	mu       sync.RWMutex
+	policy   GuardrailPolicy
+	patterns []compiledGuardrailPattern
+	client   *http.Client
+}
+
+// guardrailResult 一次扫描的结果
+type guardrailResult struct {
+	action GuardrailAction
+	hits   []GuardrailHit
+	body   []byte // redact 时为替换后的请求体
+}
+
+// guardrailConfigPath 内容策略配置文件
+func guardrailConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "guardrails.json"), nil
+}
+
+// GetGuardrailPolicy 获取出站内容策略
+func (prs *ProviderRelayService) GetGuardrailPolicy() GuardrailPolicy {
+	prs.guardrails.mu.RLock()
+	defer prs.guardrails.mu.RUnlock()
+	return prs.guardrails.policy
+}
+
+// SetGuardrailPolicy 校验并更新出站内容策略，持久化到 guardrails.json
+func (prs *ProviderRelayService) SetGuardrailPolicy(policy GuardrailPolicy) error {
+	policy, patterns, err := compileGuardrailPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	path, err := guardrailConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// webhook 地址可能带有 Token，仅当前用户可读
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	prs.guardrails.mu.Lock()
+	prs.guardrails.policy = policy
+	prs.guardrails.patterns = patterns
+	prs.guardrails.mu.Unlock()
+	return nil
+}
+
+// loadGuardrailPolicy 启动时从 guardrails.json 恢复策略；规则无法编译时保持关闭
+func (prs *ProviderRelayService) loadGuardrailPolicy() {
+	path, err := guardrailConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var policy GuardrailPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return
+	}
+	policy, patterns, err := compileGuardrailPolicy(policy)
+	if err != nil {
+		fmt.Printf("[Guardrail] 加载内容策略失败: %v\n", err)
+		return
+	}
+	prs.guardrails.mu.Lock()
+	prs.guardrails.policy = policy
+	prs.guardrails.patterns = patterns
+	prs.guardrails.mu.Unlock()
+}
+
+// compileGuardrailPolicy 规范化动作与应用名并编译规则
+func compileGuardrailPolicy(policy GuardrailPolicy) (GuardrailPolicy, []compiledGuardrailPattern, error) {
+	if policy.DefaultAction == "" {
+		policy.DefaultAction = GuardrailActionWarn
+	}
+	if !validGuardrailAction(policy.DefaultAction) {
+		return policy, nil, fmt.Errorf("invalid default_action %q", policy.DefaultAction)
+	}
+	actions := make(map[string]GuardrailAction, len(policy.AppActions))
+	for app, action := range policy.AppActions {
+		if !validGuardrailAction(action) {
+			return policy, nil, fmt.Errorf("invalid action %q for app %s", action, app)
+		}
+		actions[normalizeAppName(app)] = action
+	}
+	policy.AppActions = actions
+	policy.WebhookURL = strings.TrimSpace(policy.WebhookURL)
+
+	var patterns []compiledGuardrailPattern
+	sources := policy.Patterns
+	if policy.BuiltinSecrets {
+		sources = append(append([]GuardrailPattern{}, builtinGuardrailPatterns...), sources...)
+	}
+	for i, p := range sources {
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("pattern_%d", i+1)
+		}
+		if p.Regex == "" {
+			return policy, nil, fmt.Errorf("pattern %s: regex is empty", p.Name)
+		}
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return policy, nil, fmt.Errorf("pattern %s: %w", p.Name, err)
+		}
+		apps := make([]string, 0, len(p.Apps))
+		for _, app := range p.Apps {
+			apps = append(apps, normalizeAppName(app))
+		}
+		patterns = append(patterns, compiledGuardrailPattern{name: p.Name, re: re, apps: apps})
+	}
+	return policy, patterns, nil
+}
+
+func validGuardrailAction(action GuardrailAction) bool {
+	switch action {
+	case GuardrailActionOff, GuardrailActionWarn, GuardrailActionRedact, GuardrailActionBlock:
+		return true
+	}
+	return false
+}
+
+// scanGuardrails 按应用的动作扫描请求体；未命中时 hits 为空
+func (prs *ProviderRelayService) scanGuardrails(app string, body []byte) guardrailResult {
+	prs.guardrails.mu.RLock()
+	policy := prs.guardrails.policy
+	patterns := prs.guardrails.patterns
+	prs.guardrails.mu.RUnlock()
+
+	if !policy.Enabled || len(patterns) == 0 || len(body) == 0 {
+		return guardrailResult{}
+	}
+	app = normalizeAppName(app)
+	action := policy.DefaultAction
+	if override, ok := policy.AppActions[app]; ok {
+		action = override
+	}
+	if action == GuardrailActionOff {
+		return guardrailResult{}
+	}
+
+	scanned := body
+	if len(scanned) > guardrailScanLimit {
+		scanned = scanned[:guardrailScanLimit]
+	}
+	result := guardrailResult{action: action, body: body}
+	var applicable []compiledGuardrailPattern
+	for _, p := range patterns {
+		if len(p.apps) > 0 && !slices.Contains(p.apps, app) {
+			continue
+		}
+		if matches := len(p.re.FindAllIndex(scanned, -1)); matches > 0 {
+			result.hits = append(result.hits, GuardrailHit{Pattern: p.name, Matches: matches})
+			applicable = append(applicable, p)
+		}
+	}
+	if len(result.hits) == 0 || action != GuardrailActionRedact {
+		return result
+	}
+
+	// 替换只在 JSON 字符串内部进行：跨越引号或转义符的命中无法安全替换，升级为拦截
+	redacted := body
+	for _, p := range applicable {
+		placeholder := []byte("[REDACTED:" + p.name + "]")
+		redacted = p.re.ReplaceAllFunc(redacted, func(match []byte) []byte {
+			if bytes.ContainsAny(match, "\"\\") {
+				return match
+			}
+			return placeholder
+		})
+	}
+	if json.Valid(body) && !json.Valid(redacted) {
+		result.action = GuardrailActionBlock
+		return result
+	}
+	for _, p := range applicable {
+		if p.re.Match(redacted) {
+			result.action = GuardrailActionBlock
+			return result
+		}
+	}
+	result.body = redacted
+	return result
+}
+
+// applyGuardrails 扫描出站请求体并执行策略：拦截时写入响应并返回 true；
+// redact 时返回替换后的请求体（同时重置 c.Request.Body）
+func (prs *ProviderRelayService) applyGuardrails(c *gin.Context, platform, model string, body []byte) ([]byte, bool) {
+	app := clientFingerprintFor(c, body).App
+	result := prs.scanGuardrails(app, body)
+	if len(result.hits) == 0 {
+		return body, false
+	}
+
+	names := make([]string, 0, len(result.hits))
+	matches := 0
+	for _, hit := range result.hits {
+		names = append(names, hit.Pattern)
+		matches += hit.Matches
+	}
+	sort.Strings(names)
+	violation := GuardrailViolation{
+		AppName:     app,
+		Platform:    platform,
+		Model:       model,
+		RequestPath: c.Request.URL.Path,
+		ClientIP:    getClientIP(c),
+		Action:      result.action,
+		Patterns:    strings.Join(names, ","),
+		Matches:     matches,
+	}
+	fmt.Printf("[Guardrail] %s 请求命中内容规则 %s (%d 处)，动作: %s\n", app, violation.Patterns, matches, result.action)
+	go prs.recordGuardrailViolation(violation, result.hits)
+
+	switch result.action {
+	case GuardrailActionBlock:
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":    "request blocked by content policy",
+			"type":     "guardrail_blocked",
+			"app":      app,
+			"patterns": names,
+		})
+		return nil, true
+	case GuardrailActionRedact:
+		c.Header("X-CS-Guardrail", "redacted")
+		c.Request.Body = io.NopCloser(bytes.NewReader(result.body))
+		c.Request.ContentLength = int64(len(result.body))
+		return result.body, false
+	default:
+		c.Header("X-CS-Guardrail", "warned")
+		return body, false
+	}
+}
+
+// recordGuardrailViolation 写入违规表并推送 webhook
+func (prs *ProviderRelayService) recordGuardrailViolation(violation GuardrailViolation, hits []GuardrailHit) {
+	if db, err := xdb.DB("default"); err == nil {
+		_, err := db.Exec(`INSERT INTO guardrail_violations
+			(app_name, platform, model, request_path, client_ip, action, patterns, matches)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			violation.AppName, violation.Platform, violation.Model, violation.RequestPath,
+			violation.ClientIP, string(violation.Action), violation.Patterns, violation.Matches)
+		if err != nil {
+			fmt.Printf("[Guardrail] 记录违规失败: %v\n", err)
+		}
+	}
+
+	prs.guardrails.mu.RLock()
+	url := prs.guardrails.policy.WebhookURL
+	client := prs.guardrails.client
+	prs.guardrails.mu.RUnlock()
+	if url == "" {
+		return
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	data, err := json.Marshal(GuardrailAlert{
+		Type:      GuardrailEventViolation,
+		App:       violation.AppName,
+		Platform:  violation.Platform,
+		Model:     violation.Model,
+		Action:    violation.Action,
+		Hits:      hits,
+		ClientIP:  violation.ClientIP,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		fmt.Printf("[Guardrail] webhook 推送失败: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// ListGuardrailViolations 返回最近的违规记录，可按应用过滤
+func (prs *ProviderRelayService) ListGuardrailViolations(app string, limit int) ([]GuardrailViolation, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT id, COALESCE(app_name, ''), COALESCE(platform, ''), COALESCE(model, ''),
+		COALESCE(request_path, ''), COALESCE(client_ip, ''), COALESCE(action, ''),
+		COALESCE(patterns, ''), COALESCE(matches, 0), COALESCE(created_at, '')
+		FROM guardrail_violations`
+	args := []any{}
+	if app != "" {
+		query += " WHERE app_name = ?"
+		args = append(args, normalizeAppName(app))
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []GuardrailViolation{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	violations := make([]GuardrailViolation, 0)
+	for rows.Next() {
+		var v GuardrailViolation
+		var action string
+		if err := rows.Scan(&v.ID, &v.AppName, &v.Platform, &v.Model, &v.RequestPath, &v.ClientIP,
+			&action, &v.Patterns, &v.Matches, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		v.Action = GuardrailAction(action)
+		violations = append(violations, v)
+	}
+	return violations, rows.Err()
+}
+
+// ensureGuardrailTable 创建违规记录表
+func ensureGuardrailTable(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS guardrail_violations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT,
+		platform TEXT,
+		model TEXT,
+		request_path TEXT,
+		client_ip TEXT,
+		action TEXT,
+		patterns TEXT,
+		matches INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_guardrail_violations_app ON guardrail_violations(app_name, created_at)")
+	return err
+}
+
+func (prs *ProviderRelayService) adminGetGuardrailsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.GetGuardrailPolicy())
+}
+
+func (prs *ProviderRelayService) adminUpdateGuardrailsHandler(c *gin.Context) {
+	var policy GuardrailPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := prs.SetGuardrailPolicy(policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prs.GetGuardrailPolicy())
+}
+
+func (prs *ProviderRelayService) adminGuardrailViolationsHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	violations, err := prs.ListGuardrailViolations(c.Query("app"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"violations": violations})
+}
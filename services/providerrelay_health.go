@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// 健康检查状态
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthFail     = "fail"
+	healthDisabled = "disabled"
+)
+
+const (
+	// healthQueueDegraded 日志队列占用超过该比例视为 degraded，占满视为 fail
+	healthQueueDegraded = 0.8
+	// healthProbeTimeout 依赖探测超时
+	healthProbeTimeout = 3 * time.Second
+	// healthNewAPICacheTTL NEW-API 可达性结果缓存时间，避免探针频繁请求上游
+	healthNewAPICacheTTL = 30 * time.Second
+)
+
+// HealthCheck 单项依赖检查结果
+type HealthCheck struct {
+	Status    string                 `json:"status"`
+	Message   string                 `json:"message,omitempty"`
+	LatencyMs int64                  `json:"latency_ms,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// healthCache 缓存 NEW-API 探测结果
+type healthCache struct {
+	mu        sync.Mutex
+	newAPIURL string
+	newAPIAt  time.Time
+	newAPI    HealthCheck
+}
+
+// livezHandler 存活探针：只要进程能处理请求即返回 200，不受上游 / 依赖故障影响，避免 Pod 被误重启
+func (prs *ProviderRelayService) livezHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": healthOK})
+}
+
+// healthHandler 综合健康状态：数据库不可用时返回 503，其余依赖异常仅标记为 degraded
+func (prs *ProviderRelayService) healthHandler(c *gin.Context) {
+	checks := map[string]HealthCheck{
+		"database":  prs.checkDatabase(c.Request.Context()),
+		"log_queue": prs.checkLogQueue(),
+		"new_api":   prs.checkNewAPI(c.Request.Context()),
+		"sync":      prs.checkSync(),
+	}
+
+	status, code := "healthy", http.StatusOK
+	if checks["database"].Status == healthFail {
+		status, code = "unhealthy", http.StatusServiceUnavailable
+	} else {
+		for _, check := range checks {
+			if check.Status == healthFail || check.Status == healthDegraded {
+				status = "degraded"
+				break
+			}
+		}
+	}
+
+	resp := gin.H{
+		"status":    status,
+		"service":   "Ailurus PaaS Gateway",
+		"version":   AppVersion,
+		"timestamp": time.Now().Unix(),
+	}
+	if isVerbose(c) {
+		resp["checks"] = checks
+	}
+	c.JSON(code, resp)
+}
+
+// readinessHandler 就绪探针：有可用 provider、数据库可用且日志队列未占满时才接收流量
+func (prs *ProviderRelayService) readinessHandler(c *gin.Context) {
+	ready := make(map[string]int, len(adminPlatforms))
+	total := 0
+	for _, kind := range adminPlatforms {
+		ready[kind] = prs.countEnabledProviders(kind)
+		total += ready[kind]
+	}
+	checks := map[string]HealthCheck{
+		"providers": {Status: healthOK, Details: map[string]interface{}{"ready": total}},
+		"database":  prs.checkDatabase(c.Request.Context()),
+		"log_queue": prs.checkLogQueue(),
+	}
+	if total == 0 {
+		checks["providers"] = HealthCheck{Status: healthFail, Message: "no enabled provider with credentials"}
+	}
+
+	isReady := true
+	for _, check := range checks {
+		if check.Status == healthFail {
+			isReady = false
+		}
+	}
+	code := http.StatusOK
+	if !isReady {
+		code = http.StatusServiceUnavailable
+	}
+
+	resp := gin.H{
+		"ready":              isReady,
+		"claude_providers":   ready["claude"],
+		"codex_providers":    ready["codex"],
+		"gemini_providers":   ready["gemini-cli"],
+		"picoclaw_providers": ready["picoclaw"],
+		"timestamp":          time.Now().Unix(),
+	}
+	if isVerbose(c) {
+		resp["checks"] = checks
+	}
+	c.JSON(code, resp)
+}
+
+func isVerbose(c *gin.Context) bool {
+	verbose, _ := strconv.ParseBool(c.Query("verbose"))
+	return verbose
+}
+
+// checkDatabase 检查 SQLite 连接
+func (prs *ProviderRelayService) checkDatabase(ctx context.Context) HealthCheck {
+	db, err := xdb.DB("default")
+	if err != nil || db == nil {
+		return HealthCheck{Status: healthFail, Message: "database not initialized"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		return HealthCheck{Status: healthFail, Message: err.Error()}
+	}
+	return HealthCheck{Status: healthOK, LatencyMs: time.Since(start).Milliseconds()}
+}
+
+// checkLogQueue 检查日志写入队列占用
+func (prs *ProviderRelayService) checkLogQueue() HealthCheck {
+	check := HealthCheck{Status: healthOK, Details: map[string]interface{}{}}
+	queues := []struct {
+		name           string
+		size, capacity int
+	}{
+		{"request_log", len(prs.logWriteQueue), cap(prs.logWriteQueue)},
+		{"body_log", len(prs.bodyLogQueue), cap(prs.bodyLogQueue)},
+	}
+	for _, q := range queues {
+		check.Details[q.name] = map[string]int{"len": q.size, "cap": q.capacity}
+		if q.capacity == 0 {
+			continue
+		}
+		usage := float64(q.size) / float64(q.capacity)
+		switch {
+		case q.size >= q.capacity:
+			check.Status = healthFail
+			check.Message = q.name + " queue is full"
+		case usage >= healthQueueDegraded && check.Status == healthOK:
+			check.Status = healthDegraded
+			check.Message = q.name + " queue is nearly full"
+		}
+	}
+	return check
+}
+
+// checkNewAPI 检查 NEW-API 网关可达性（任何 HTTP 响应都视为可达），结果缓存 healthNewAPICacheTTL
+func (prs *ProviderRelayService) checkNewAPI(ctx context.Context) HealthCheck {
+	url, _, enabled := prs.GetNewAPIConfig()
+	if !enabled || url == "" {
+		return HealthCheck{Status: healthDisabled}
+	}
+
+	prs.health.mu.Lock()
+	if prs.health.newAPIURL == url && time.Since(prs.health.newAPIAt) < healthNewAPICacheTTL {
+		cached := prs.health.newAPI
+		prs.health.mu.Unlock()
+		return cached
+	}
+	prs.health.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	check := HealthCheck{Status: healthOK}
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+"/", nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+			check.Details = map[string]interface{}{"http_code": resp.StatusCode}
+		}
+	}
+	check.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Status = healthDegraded
+		check.Message = err.Error()
+	}
+
+	prs.health.mu.Lock()
+	prs.health.newAPIURL = url
+	prs.health.newAPIAt = time.Now()
+	prs.health.newAPI = check
+	prs.health.mu.Unlock()
+	return check
+}
+
+// checkSync 检查多端同步（NATS）连接状态
+func (prs *ProviderRelayService) checkSync() HealthCheck {
+	si := prs.syncIntegration
+	if si == nil || !si.enabled {
+		return HealthCheck{Status: healthDisabled}
+	}
+	if !si.IsEnabled() {
+		return HealthCheck{Status: healthDegraded, Message: "sync service not connected"}
+	}
+	return HealthCheck{Status: healthOK}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func healthRequest(t *testing.T, prs *ProviderRelayService, target string) (int, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/livez", prs.livezHandler)
+	router.GET("/health", prs.healthHandler)
+	router.GET("/readiness", prs.readinessHandler)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json %q", rec.Body.String())
+	}
+	return rec.Code, body
+}
+
+func TestLivezIgnoresProviderOutage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	if code, _ := healthRequest(t, prs, "/readiness"); code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness should fail without providers, got %d", code)
+	}
+	if code, body := healthRequest(t, prs, "/livez"); code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("livez should stay green, got %d %v", code, body)
+	}
+}
+
+func TestHealthVerboseChecks(t *testing.T) {
+	setupUsageTestDB(t)
+	t.Setenv("HOME", t.TempDir())
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	prs := &ProviderRelayService{
+		providerService: NewProviderService(),
+		logWriteQueue:   make(chan *ReqeustLog, 2),
+		bodyLogQueue:    make(chan *RequestLogBody, 10),
+	}
+	prs.SetNewAPIConfig(upstream.URL, "token")
+	prs.SetNewAPIEnabled(true)
+
+	code, body := healthRequest(t, prs, "/health")
+	if code != http.StatusOK || body["status"] != "healthy" || body["checks"] != nil {
+		t.Fatalf("unexpected health %d %v", code, body)
+	}
+
+	prs.logWriteQueue <- &ReqeustLog{}
+	prs.logWriteQueue <- &ReqeustLog{}
+	code, body = healthRequest(t, prs, "/health?verbose=1")
+	checks := body["checks"].(map[string]any)
+	if code != http.StatusOK || body["status"] != "degraded" {
+		t.Fatalf("full log queue should degrade health, got %d %v", code, body)
+	}
+	if checks["log_queue"].(map[string]any)["status"] != healthFail ||
+		checks["database"].(map[string]any)["status"] != healthOK ||
+		checks["new_api"].(map[string]any)["status"] != healthOK ||
+		checks["sync"].(map[string]any)["status"] != healthDisabled {
+		t.Fatalf("unexpected checks %v", checks)
+	}
+
+	code, body = healthRequest(t, prs, "/readiness?verbose=true")
+	if code != http.StatusServiceUnavailable || body["ready"] != false {
+		t.Fatalf("full log queue should fail readiness, got %d %v", code, body)
+	}
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 幂等键：客户端携带 Idempotency-Key 重试时，同一 Key（按客户端 API Key、平台与接口隔离）
+// 直接返回上次成功的响应；原请求仍在进行中时等待其完成后返回同一响应，不会再次调用上游、重复计费。
+// 只缓存 2xx 响应，失败的请求可以用同一 Key 重试；同一 Key 对应不同请求体时返回 422。
+// 原请求为流式响应时，等待的重试先收到已输出的部分，再实时接收后续数据（见 providerrelay_resume.go）
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyTTL            = 24 * time.Hour
+	idempotencyWaitTimeout    = 10 * time.Minute
+	idempotencySweepInterval  = time.Minute
+	maxIdempotencyEntries     = 1000
+	maxIdempotencyBodyBytes   = 8 << 20
+	maxSharedIdempotencyBytes = 1 << 20
+)
+
+// IdempotencyStats 幂等缓存状态与命中次数
+type IdempotencyStats struct {
+	Cached    int    `json:"cached"`
+	InFlight  int    `json:"inFlight"`
+	Replayed  uint64 `json:"replayed"`  // 直接返回缓存响应的重试
+	Attached  uint64 `json:"attached"`  // 等待进行中的原请求后返回的重试
+	Conflicts uint64 `json:"conflicts"` // 同一 Key 不同请求体
+}
+
+// idempotentResponse 缓存的响应
+type idempotentResponse struct {
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	Fingerprint string      `json:"fingerprint"`
+}
+
+// idempotencyEntry 单个幂等键：done 关闭前为进行中，response 为 nil 表示原请求失败
+type idempotencyEntry struct {
+	fingerprint string
+	done        chan struct{}
+	response    *idempotentResponse
+	expiresAt   time.Time
+
+	// 进行中的请求已输出的响应；live 在 2xx 流式响应开始输出后设置，updated 在每次追加后关闭并替换
+	body     []byte
+	overflow bool
+	live     *idempotentResponse
+	updated  chan struct{}
+}
+
+// idempotencyStore 进程内的幂等键；配置了共享存储时完成的响应同时写入共享存储
+type idempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+	// 客户端断开后继续接收流式响应的时长（纳秒），0 表示关闭
+	resumeWindow int64
+	replayed     uint64
+	attached     uint64
+	conflicts    uint64
+}
+
+// idempotencyScope 幂等键的作用域：客户端 API Key + 平台 + 接口 + Key
+func idempotencyScope(c *gin.Context, kind, endpoint, key string) string {
+	sum := sha256.Sum256([]byte(clientAPIKey(c) + "\x00" + kind + "\x00" + endpoint + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func sharedIdempotencyKey(scope string) string { return "idempotency:" + scope }
+
+// sweepLocked 清理过期条目，条目过多时优先淘汰最早过期的
+func (s *idempotencyStore) sweepLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < idempotencySweepInterval && len(s.entries) < maxIdempotencyEntries {
+		return
+	}
+	s.lastSweep = now
+	for scope, entry := range s.entries {
+		if entry.response != nil && now.After(entry.expiresAt) {
+			delete(s.entries, scope)
+		}
+	}
+	for len(s.entries) >= maxIdempotencyEntries {
+		oldest := ""
+		for scope, entry := range s.entries {
+			if entry.response == nil {
+				continue
+			}
+			if oldest == "" || entry.expiresAt.Before(s.entries[oldest].expiresAt) {
+				oldest = scope
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		delete(s.entries, oldest)
+	}
+}
+
+// beginIdempotentRequest 处理 Idempotency-Key：已响应（重放、冲突或等待超时）时返回 handled=true；
+// 否则返回的 finish 必须在请求结束时调用，用于缓存本次响应
+func (prs *ProviderRelayService) beginIdempotentRequest(c *gin.Context, kind, endpoint string, body []byte) (finish func(), handled bool) {
+	key := strings.TrimSpace(c.GetHeader(headerIdempotencyKey))
+	if key == "" {
+		return func() {}, false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return nil, true
+	}
+	scope := idempotencyScope(c, kind, endpoint, key)
+	sum := sha256.Sum256(body)
+	fingerprint := hex.EncodeToString(sum[:])
+	store := &prs.idempotency
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), idempotencyWaitTimeout)
+	defer cancel()
+	for {
+		now := time.Now()
+		store.mu.Lock()
+		store.sweepLocked(now)
+		if store.entries == nil {
+			store.entries = make(map[string]*idempotencyEntry)
+		}
+		entry := store.entries[scope]
+		if entry == nil {
+			// 其他副本已完成的响应（读取共享存储时不持有锁）
+			store.mu.Unlock()
+			var shared idempotentResponse
+			found := prs.sharedGetJSON(sharedIdempotencyKey(scope), &shared)
+			store.mu.Lock()
+			if entry = store.entries[scope]; entry == nil && found {
+				entry = &idempotencyEntry{fingerprint: shared.Fingerprint, done: closedChan(), response: &shared, expiresAt: now.Add(idempotencyTTL)}
+				store.entries[scope] = entry
+			}
+		}
+		if entry != nil && entry.fingerprint != fingerprint {
+			atomic.AddUint64(&store.conflicts, 1)
+			store.mu.Unlock()
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request body"})
+			return nil, true
+		}
+		if entry == nil {
+			entry = &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{}), updated: make(chan struct{})}
+			store.entries[scope] = entry
+			store.mu.Unlock()
+			return prs.recordIdempotentResponse(c, scope, entry), false
+		}
+		store.mu.Unlock()
+
+		inFlight := false
+		select {
+		case <-entry.done:
+		default:
+			inFlight = true
+		}
+		if inFlight {
+			// 流式响应：从断点继续输出
+			if prs.followIdempotentStream(c, ctx, entry, resumeOffset(c)) {
+				atomic.AddUint64(&store.attached, 1)
+				return nil, true
+			}
+			select {
+			case <-entry.done:
+			case <-ctx.Done():
+				c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+				return nil, true
+			}
+		}
+		if entry.response == nil {
+			// 原请求失败且已移除，本次作为新请求重试
+			continue
+		}
+		if inFlight {
+			atomic.AddUint64(&store.attached, 1)
+		} else {
+			atomic.AddUint64(&store.replayed, 1)
+		}
+		replayIdempotentResponse(c, entry.response, resumeOffset(c))
+		return nil, true
+	}
+}
+
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// replayIdempotentResponse 返回缓存的响应，offset 为客户端已收到的字节数
+func replayIdempotentResponse(c *gin.Context, response *idempotentResponse, offset int) {
+	writeIdempotentHeader(c, response)
+	c.Writer.Write(response.Body[min(offset, len(response.Body)):])
+}
+
+func writeIdempotentHeader(c *gin.Context, response *idempotentResponse) {
+	header := c.Writer.Header()
+	for name, values := range response.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set(headerIdempotentReplayed, "true")
+	c.Status(response.Status)
+}
+
+// replayableHeader 去掉逐跳与长度相关的响应头
+func replayableHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range []string{"Content-Length", "Date", "Connection", "Transfer-Encoding"} {
+		header.Del(name)
+	}
+	return header
+}
+
+// idempotencyRecorder 转发给客户端的同时记录响应；resumable 时客户端断开后继续记录，不再写给客户端
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	store     *idempotencyStore
+	entry     *idempotencyEntry
+	client    context.Context
+	resumable bool
+	detached  bool
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.record(data)
+	if !w.detached && w.resumable && w.client.Err() != nil {
+		w.detached = true
+	}
+	if w.detached {
+		return len(data), nil
+	}
+	n, err := w.ResponseWriter.Write(data)
+	if err != nil && w.resumable {
+		w.detached = true
+		return len(data), nil
+	}
+	return n, err
+}
+
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *idempotencyRecorder) Flush() {
+	if !w.detached {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *idempotencyRecorder) record(data []byte) {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	entry := w.entry
+	if entry.overflow {
+		return
+	}
+	if len(entry.body)+len(data) > maxIdempotencyBodyBytes {
+		entry.overflow = true
+		entry.body = nil
+		return
+	}
+	status := w.ResponseWriter.Status()
+	if entry.live == nil && status >= http.StatusOK && status < http.StatusMultipleChoices && isEventStream(w.ResponseWriter.Header()) {
+		entry.live = &idempotentResponse{Status: status, Header: replayableHeader(w.ResponseWriter.Header())}
+	}
+	entry.body = append(entry.body, data...)
+	close(entry.updated)
+	entry.updated = make(chan struct{})
+}
+
+// recordIdempotentResponse 记录本次响应，请求结束时缓存完整的 2xx 响应并唤醒等待的重试
+func (prs *ProviderRelayService) recordIdempotentResponse(c *gin.Context, scope string, entry *idempotencyEntry) func() {
+	original := c.Writer
+	store := &prs.idempotency
+	recorder := &idempotencyRecorder{ResponseWriter: original, store: store, entry: entry, client: c.Request.Context()}
+	recorder.resumable = prs.StreamResumeWindow() > 0
+	c.Set(ctxKeyStreamResumable, recorder.resumable)
+	c.Writer = recorder
+	return func() {
+		c.Writer = original
+		status := original.Status()
+		store.mu.Lock()
+		complete := !c.GetBool(ctxKeyStreamIncomplete) && !entry.overflow && original.Written()
+		if status >= http.StatusOK && status < http.StatusMultipleChoices && complete {
+			entry.response = &idempotentResponse{Status: status, Header: replayableHeader(original.Header()), Body: entry.body, Fingerprint: entry.fingerprint}
+			entry.expiresAt = time.Now().Add(idempotencyTTL)
+		} else if store.entries[scope] == entry {
+			delete(store.entries, scope)
+		}
+		response := entry.response
+		close(entry.done)
+		store.mu.Unlock()
+
+		if response != nil && len(response.Body) <= maxSharedIdempotencyBytes {
+			prs.sharedSetJSON(sharedIdempotencyKey(scope), response, idempotencyTTL)
+		}
+	}
+}
+
+// GetIdempotencyStats 返回幂等缓存状态
+func (prs *ProviderRelayService) GetIdempotencyStats() IdempotencyStats {
+	store := &prs.idempotency
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	stats := IdempotencyStats{
+		Replayed:  atomic.LoadUint64(&store.replayed),
+		Attached:  atomic.LoadUint64(&store.attached),
+		Conflicts: atomic.LoadUint64(&store.conflicts),
+	}
+	now := time.Now()
+	for _, entry := range store.entries {
+		switch {
+		case entry.response != nil && now.Before(entry.expiresAt):
+			stats.Cached++
+		case entry.response == nil:
+			stats.InFlight++
+		}
+	}
+	return stats
+}
+
+// idempotencyMetrics 以 Prometheus 文本格式输出幂等键命中次数
+func (prs *ProviderRelayService) idempotencyMetrics() string {
+	stats := prs.GetIdempotencyStats()
+	return fmt.Sprintf(`
+# HELP ailurus_paas_idempotent_replays_total Retries answered from a cached response without calling the upstream again
+# TYPE ailurus_paas_idempotent_replays_total counter
+ailurus_paas_idempotent_replays_total{mode="cached"} %d
+ailurus_paas_idempotent_replays_total{mode="attached"} %d
+
+# HELP ailurus_paas_idempotency_conflicts_total Idempotency keys reused with a different request body
+# TYPE ailurus_paas_idempotency_conflicts_total counter
+ailurus_paas_idempotency_conflicts_total %d
+
+# HELP ailurus_paas_idempotency_entries Idempotency keys currently cached or in flight
+# TYPE ailurus_paas_idempotency_entries gauge
+ailurus_paas_idempotency_entries{state="cached"} %d
+ailurus_paas_idempotency_entries{state="in_flight"} %d
+`, stats.Replayed, stats.Attached, stats.Conflicts, stats.Cached, stats.InFlight)
+}
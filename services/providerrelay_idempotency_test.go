@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyKeyReplaysResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	var calls int64
+	release := make(chan struct{})
+	router := gin.New()
+	router.POST("/v1/messages", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		finish, handled := prs.beginIdempotentRequest(c, "claude", "/v1/messages", body)
+		if handled {
+			return
+		}
+		defer finish()
+		n := atomic.AddInt64(&calls, 1)
+		if string(body) == "slow" {
+			<-release
+		}
+		if string(body) == "fail" && n == 3 {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "upstream down"})
+			return
+		}
+		c.Header("X-Upstream-Call", string(rune('0'+n)))
+		c.JSON(http.StatusOK, gin.H{"call": n})
+	})
+	send := func(key, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(headerIdempotencyKey, key)
+		}
+		req.Header.Set("x-api-key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 重试返回缓存的响应，不再调用上游
+	first := send("k1", "a", "hello")
+	retry := send("k1", "a", "hello")
+	if calls != 1 || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() ||
+		retry.Header().Get(headerIdempotentReplayed) != "true" || retry.Header().Get("X-Upstream-Call") != "1" {
+		t.Fatalf("replay: calls=%d code=%d body=%s header=%v", calls, retry.Code, retry.Body, retry.Header())
+	}
+	// 不同客户端 Key 互不影响；同一 Key 不同请求体返回 422
+	if send("k1", "b", "hello"); calls != 2 {
+		t.Fatalf("scoped key calls = %d", calls)
+	}
+	if w := send("k1", "a", "other"); w.Code != http.StatusUnprocessableEntity || calls != 2 {
+		t.Fatalf("conflict: code=%d calls=%d", w.Code, calls)
+	}
+
+	// 失败的响应不缓存，重试会再次调用上游
+	if w := send("k2", "a", "fail"); w.Code != http.StatusBadGateway {
+		t.Fatalf("failed request code = %d", w.Code)
+	}
+	if w := send("k2", "a", "fail"); w.Code != http.StatusOK || calls != 4 {
+		t.Fatalf("retry after failure: code=%d calls=%d", w.Code, calls)
+	}
+
+	// 原请求进行中时等待并返回同一响应
+	done := make(chan *httptest.ResponseRecorder, 2)
+	go func() { done <- send("k3", "a", "slow") }()
+	deadline := time.Now().Add(2 * time.Second)
+	for prs.GetIdempotencyStats().InFlight == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	go func() { done <- send("k3", "a", "slow") }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	a, b := <-done, <-done
+	if calls != 5 || a.Body.String() != b.Body.String() {
+		t.Fatalf("attach: calls=%d bodies %s / %s", calls, a.Body, b.Body)
+	}
+
+	// 未携带幂等键的请求不受影响
+	send("", "a", "hello")
+	send("", "a", "hello")
+	stats := prs.GetIdempotencyStats()
+	if calls != 7 || stats.Replayed != 1 || stats.Attached != 1 || stats.Conflicts != 1 || stats.Cached != 4 || stats.InFlight != 0 {
+		t.Fatalf("calls=%d stats=%+v", calls, stats)
+	}
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// Provider 故障记录：熔断器打开、provider 被挂起、平台所有 provider 均失败时开启一条故障，
+// 熔断器关闭、解除挂起、平台再次请求成功时结束。结束时按 request_log 统计期间失败的请求数，
+// 并补充错误样本。故障记录用于统计图表标注与公开状态页
+
+// 故障原因
+const (
+	IncidentCauseCircuitOpen = "circuit_open"
+	IncidentCauseSuspended   = "suspended"
+	IncidentCauseAllFailed   = "all_failed"
+)
+
+const (
+	// incidentMaxSamples 每条故障最多保存的错误样本数
+	incidentMaxSamples = 5
+	// incidentSampleMaxLen 单条错误样本的最大长度
+	incidentSampleMaxLen = 300
+	// incidentMaxDays 查询故障记录的最大天数
+	incidentMaxDays = 365
+	// incidentMaxList 单次查询返回的最大故障数
+	incidentMaxList = 500
+)
+
+// ProviderIncident 一次 provider 故障
+type ProviderIncident struct {
+	ID               int64    `json:"id"`
+	Platform         string   `json:"platform"`
+	Provider         string   `json:"provider"` // 平台级故障（所有 provider 均失败）为空
+	Cause            string   `json:"cause"`
+	StartedAt        int64    `json:"started_at"`
+	EndedAt          int64    `json:"ended_at,omitempty"` // 0 表示故障仍在进行
+	DurationSec      int64    `json:"duration_sec"`
+	AffectedRequests int64    `json:"affected_requests"` // 故障期间失败的请求数
+	ErrorSamples     []string `json:"error_samples,omitempty"`
+}
+
+// Ongoing 故障是否仍在进行
+func (inc ProviderIncident) Ongoing() bool {
+	return inc.EndedAt == 0
+}
+
+// IncidentMarker 统计图表中某一天的故障标注
+type IncidentMarker struct {
+	Day       string   `json:"day"`
+	Count     int      `json:"count"`
+	Providers []string `json:"providers"` // platform/provider，平台级故障为 platform/*
+}
+
+// openIncident 进行中的故障
+type openIncident struct {
+	id      int64
+	samples []string
+}
+
+// incidentTracker 进行中故障的内存索引，避免每次请求成功都查询数据库
+type incidentTracker struct {
+	mu     sync.Mutex
+	loaded bool
+	open   map[string]*openIncident
+}
+
+// incidentKey 进行中故障的索引键
+func incidentKey(platform, provider, cause string) string {
+	return platform + "/" + provider + "#" + cause
+}
+
+// trackProviderIncident 根据 provider 事件开启 / 结束故障
+func (prs *ProviderRelayService) trackProviderIncident(event ProviderEvent) {
+	switch event.Type {
+	case ProviderEventSuspended:
+		prs.openProviderIncident(event.Platform, event.Provider, IncidentCauseSuspended, event.Reason)
+	case ProviderEventResumed:
+		prs.closeProviderIncident(event.Platform, event.Provider, IncidentCauseSuspended)
+	case ProviderEventAllFailed:
+		prs.openProviderIncident(event.Platform, "", IncidentCauseAllFailed, event.Reason)
+	}
+}
+
+// trackCircuitTransition 熔断器打开时开启故障，关闭时结束；半开状态不影响故障
+func (prs *ProviderRelayService) trackCircuitTransition(platform, provider, from, to string) {
+	switch to {
+	case StateOpen:
+		prs.openProviderIncident(platform, provider, IncidentCauseCircuitOpen, fmt.Sprintf("circuit breaker %s -> open", from))
+	case StateClosed:
+		prs.closeProviderIncident(platform, provider, IncidentCauseCircuitOpen)
+	}
+}
+
+// resolvePlatformIncident 平台请求成功后结束“所有 provider 均失败”的故障
+func (prs *ProviderRelayService) resolvePlatformIncident(platform string) {
+	prs.closeProviderIncident(platform, "", IncidentCauseAllFailed)
+}
+
+// loadOpenIncidentsLocked 首次使用时从数据库加载未结束的故障（进程重启后继续跟踪）
+func (prs *ProviderRelayService) loadOpenIncidentsLocked(db *sql.DB) {
+	if prs.incidents.loaded {
+		return
+	}
+	if prs.incidents.open == nil {
+		prs.incidents.open = make(map[string]*openIncident)
+	}
+	rows, err := db.Query(`SELECT id, platform, provider, cause, COALESCE(error_samples, '') FROM provider_incident WHERE ended_at IS NULL`)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			prs.incidents.loaded = true
+		}
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var platform, provider, cause, samples string
+		inc := &openIncident{}
+		if err := rows.Scan(&inc.id, &platform, &provider, &cause, &samples); err != nil {
+			return
+		}
+		_ = json.Unmarshal([]byte(samples), &inc.samples)
+		prs.incidents.open[incidentKey(platform, provider, cause)] = inc
+	}
+	prs.incidents.loaded = rows.Err() == nil
+}
+
+// openProviderIncident 开启故障；同一故障仍在进行时只追加错误样本
+func (prs *ProviderRelayService) openProviderIncident(platform, provider, cause, sample string) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return
+	}
+	prs.incidents.mu.Lock()
+	defer prs.incidents.mu.Unlock()
+	prs.loadOpenIncidentsLocked(db)
+
+	key := incidentKey(platform, provider, cause)
+	if inc, ok := prs.incidents.open[key]; ok {
+		if samples, added := appendIncidentSample(inc.samples, sample); added {
+			inc.samples = samples
+			data, _ := json.Marshal(samples)
+			if _, err := db.Exec(`UPDATE provider_incident SET error_samples = ? WHERE id = ?`, string(data), inc.id); err != nil {
+				fmt.Printf("[Incident] 更新故障样本失败: %v\n", err)
+			}
+		}
+		return
+	}
+
+	samples, _ := appendIncidentSample(nil, sample)
+	data, _ := json.Marshal(samples)
+	result, err := db.Exec(`INSERT INTO provider_incident (platform, provider, cause, started_at, error_samples) VALUES (?, ?, ?, ?, ?)`,
+		platform, provider, cause, time.Now().UTC().Format(timeLayout), string(data))
+	if err != nil {
+		fmt.Printf("[Incident] 记录故障失败: %v\n", err)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return
+	}
+	prs.incidents.open[key] = &openIncident{id: id, samples: samples}
+	fmt.Printf("[Incident] %s/%s 故障开始 (%s)\n", platform, provider, cause)
+}
+
+// closeProviderIncident 结束进行中的故障，统计期间失败的请求数并补充错误样本
+func (prs *ProviderRelayService) closeProviderIncident(platform, provider, cause string) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return
+	}
+	prs.incidents.mu.Lock()
+	defer prs.incidents.mu.Unlock()
+	prs.loadOpenIncidentsLocked(db)
+
+	key := incidentKey(platform, provider, cause)
+	inc, ok := prs.incidents.open[key]
+	if !ok {
+		return
+	}
+	delete(prs.incidents.open, key)
+
+	var startedAt string
+	if err := db.QueryRow(`SELECT started_at FROM provider_incident WHERE id = ?`, inc.id).Scan(&startedAt); err != nil {
+		fmt.Printf("[Incident] 读取故障失败: %v\n", err)
+		return
+	}
+	endedAt := time.Now().UTC().Format(timeLayout)
+	affected, samples := incidentRequestImpact(db, platform, provider, startedAt, endedAt, inc.samples)
+	data, _ := json.Marshal(samples)
+	if _, err := db.Exec(`UPDATE provider_incident SET ended_at = ?, affected_requests = ?, error_samples = ? WHERE id = ?`,
+		endedAt, affected, string(data), inc.id); err != nil {
+		fmt.Printf("[Incident] 结束故障失败: %v\n", err)
+		return
+	}
+	fmt.Printf("[Incident] %s/%s 故障结束 (%s)，期间失败请求 %d 次\n", platform, provider, cause, affected)
+}
+
+// appendIncidentSample 追加去重、截断后的错误样本，返回是否有变化
+func appendIncidentSample(samples []string, sample string) ([]string, bool) {
+	if sample == "" || len(samples) >= incidentMaxSamples {
+		return samples, false
+	}
+	if runes := []rune(sample); len(runes) > incidentSampleMaxLen {
+		sample = string(runes[:incidentSampleMaxLen]) + "..."
+	}
+	for _, existing := range samples {
+		if existing == sample {
+			return samples, false
+		}
+	}
+	return append(samples, sample), true
+}
+
+// incidentFailureWhere 故障期间失败请求的过滤条件
+func incidentFailureWhere(platform, provider, startedAt, endedAt string) (string, []any) {
+	where := `platform = ? AND created_at >= ? AND created_at <= ? AND (COALESCE(http_code, 0) < 200 OR COALESCE(http_code, 0) >= 300)`
+	args := []any{platform, startedAt, endedAt}
+	if provider != "" {
+		where += " AND provider = ?"
+		args = append(args, provider)
+	}
+	return where, args
+}
+
+// countIncidentRequests 统计故障期间失败的请求数
+func countIncidentRequests(db *sql.DB, platform, provider, startedAt, endedAt string) int64 {
+	where, args := incidentFailureWhere(platform, provider, startedAt, endedAt)
+	var affected int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM request_log WHERE `+where, args...).Scan(&affected); err != nil {
+		return 0
+	}
+	return affected
+}
+
+// incidentRequestImpact 统计故障期间失败的请求数，并用请求日志中的错误信息补齐样本
+func incidentRequestImpact(db *sql.DB, platform, provider, startedAt, endedAt string, samples []string) (int64, []string) {
+	affected := countIncidentRequests(db, platform, provider, startedAt, endedAt)
+	if len(samples) >= incidentMaxSamples || affected == 0 {
+		return affected, samples
+	}
+	where, args := incidentFailureWhere(platform, provider, startedAt, endedAt)
+	rows, err := db.Query(`SELECT DISTINCT error_message FROM request_log WHERE `+where+` AND COALESCE(error_message, '') != '' LIMIT ?`,
+		append(args, incidentMaxSamples)...)
+	if err != nil {
+		return affected, samples
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var message string
+		if rows.Scan(&message) == nil {
+			samples, _ = appendIncidentSample(samples, message)
+		}
+	}
+	return affected, samples
+}
+
+// queryProviderIncidents 查询与 since 之后时间段重叠的故障，按开始时间倒序
+func queryProviderIncidents(platform string, since time.Time, limit int) ([]ProviderIncident, error) {
+	if limit <= 0 || limit > incidentMaxList {
+		limit = incidentMaxList
+	}
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT id, platform, provider, cause, started_at, COALESCE(ended_at, ''), COALESCE(affected_requests, 0), COALESCE(error_samples, '')
+		FROM provider_incident WHERE (ended_at IS NULL OR ended_at >= ?)`
+	args := []any{since.UTC().Format(timeLayout)}
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query += " ORDER BY started_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []ProviderIncident{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	incidents := make([]ProviderIncident, 0)
+	var startedRaw []string
+	for rows.Next() {
+		var inc ProviderIncident
+		var startedAt, endedAt, samples string
+		if err := rows.Scan(&inc.ID, &inc.Platform, &inc.Provider, &inc.Cause, &startedAt, &endedAt, &inc.AffectedRequests, &samples); err != nil {
+			return nil, err
+		}
+		if t, ok := parseRollupTime(startedAt); ok {
+			inc.StartedAt = t.Unix()
+		}
+		end := now
+		if t, ok := parseRollupTime(endedAt); ok {
+			inc.EndedAt = t.Unix()
+			end = t
+		}
+		inc.DurationSec = max(end.Unix()-inc.StartedAt, 0)
+		_ = json.Unmarshal([]byte(samples), &inc.ErrorSamples)
+		incidents = append(incidents, inc)
+		startedRaw = append(startedRaw, startedAt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// 进行中的故障实时统计受影响的请求数
+	nowText := now.UTC().Format(timeLayout)
+	for i := range incidents {
+		if incidents[i].Ongoing() {
+			incidents[i].AffectedRequests = countIncidentRequests(db, incidents[i].Platform, incidents[i].Provider, startedRaw[i], nowText)
+		}
+	}
+	return incidents, nil
+}
+
+// incidentDays 故障覆盖的自然日（统计时区），限制在 [from, to] 内
+func incidentDays(inc ProviderIncident, from, to time.Time) []string {
+	loc := statsLocation()
+	start := time.Unix(inc.StartedAt, 0).In(loc)
+	end := to
+	if !inc.Ongoing() {
+		end = time.Unix(inc.EndedAt, 0).In(loc)
+	}
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	var days []string
+	for day := startOfDay(start); !day.After(end); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format("2006-01-02"))
+	}
+	return days
+}
+
+// incidentLabel 故障在图表标注中的名称
+func incidentLabel(inc ProviderIncident) string {
+	if inc.Provider == "" {
+		return inc.Platform + "/*"
+	}
+	return inc.Platform + "/" + inc.Provider
+}
+
+// buildIncidentMarkers 按天汇总故障标注，按日期正序
+func buildIncidentMarkers(incidents []ProviderIncident, from, to time.Time) []IncidentMarker {
+	byDay := make(map[string]*IncidentMarker)
+	for _, inc := range incidents {
+		label := incidentLabel(inc)
+		for _, day := range incidentDays(inc, from, to) {
+			marker := byDay[day]
+			if marker == nil {
+				marker = &IncidentMarker{Day: day, Providers: []string{}}
+				byDay[day] = marker
+			}
+			marker.Count++
+			if !slices.Contains(marker.Providers, label) {
+				marker.Providers = append(marker.Providers, label)
+			}
+		}
+	}
+	markers := make([]IncidentMarker, 0, len(byDay))
+	for _, marker := range byDay {
+		sort.Strings(marker.Providers)
+		markers = append(markers, *marker)
+	}
+	sort.Slice(markers, func(i, j int) bool { return markers[i].Day < markers[j].Day })
+	return markers
+}
+
+// incidentWindow 最近 days 天（含今天）的起止时间
+func incidentWindow(days int) (time.Time, time.Time) {
+	if days <= 0 {
+		days = 7
+	}
+	if days > incidentMaxDays {
+		days = incidentMaxDays
+	}
+	now := statsNow()
+	return startOfDay(now).AddDate(0, 0, -(days - 1)), now
+}
+
+// ListProviderIncidents 返回最近 days 天内的 provider 故障（含进行中的故障），platform 为空时不过滤
+func (ls *LogService) ListProviderIncidents(platform string, days int) ([]ProviderIncident, error) {
+	from, _ := incidentWindow(days)
+	return queryProviderIncidents(platform, from, incidentMaxList)
+}
+
+// GetIncidentMarkers 返回统计图表使用的按天故障标注
+func (ls *LogService) GetIncidentMarkers(platform string, days int) ([]IncidentMarker, error) {
+	from, to := incidentWindow(days)
+	incidents, err := queryProviderIncidents(platform, from, incidentMaxList)
+	if err != nil {
+		return nil, err
+	}
+	return buildIncidentMarkers(incidents, from, to), nil
+}
+
+// ensureIncidentTable 创建故障记录表
+func ensureIncidentTable(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS provider_incident (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		platform TEXT NOT NULL DEFAULT '',
+		provider TEXT NOT NULL DEFAULT '',
+		cause TEXT NOT NULL DEFAULT '',
+		started_at TEXT NOT NULL,
+		ended_at TEXT,
+		affected_requests INTEGER DEFAULT 0,
+		error_samples TEXT
+	)`); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_provider_incident_started ON provider_incident(started_at)")
+	return err
+}
+
+func (prs *ProviderRelayService) adminIncidentsHandler(c *gin.Context) {
+	days, _ := strconv.Atoi(c.Query("days"))
+	from, _ := incidentWindow(days)
+	incidents, err := queryProviderIncidents(c.Query("platform"), from, incidentMaxList)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"incidents": incidents})
+}
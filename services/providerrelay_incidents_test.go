@@ -0,0 +1,138 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func insertIncidentLog(t *testing.T, provider string, code int, message string) {
+	t.Helper()
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO request_log (platform, model, provider, http_code, error_message, created_at) VALUES ('claude', 'm', ?, ?, ?, ?)`,
+		provider, code, message, time.Now().UTC().Format(timeLayout)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProviderIncidentLifecycle(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	prs := &ProviderRelayService{}
+	ls := &LogService{}
+
+	prs.trackProviderIncident(ProviderEvent{Type: ProviderEventSuspended, Platform: "claude", Provider: "relay-a", Reason: "invalid api key"})
+	prs.trackProviderIncident(ProviderEvent{Type: ProviderEventSuspended, Platform: "claude", Provider: "relay-a", Reason: "invalid api key"})
+	insertIncidentLog(t, "relay-a", 401, "unauthorized")
+	insertIncidentLog(t, "relay-a", 401, "unauthorized")
+	insertIncidentLog(t, "relay-a", 200, "")
+	insertIncidentLog(t, "relay-b", 500, "other provider")
+
+	incidents, err := ls.ListProviderIncidents("claude", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 1 || !incidents[0].Ongoing() || incidents[0].Cause != IncidentCauseSuspended {
+		t.Fatalf("expected one ongoing suspension, got %+v", incidents)
+	}
+	if incidents[0].AffectedRequests != 2 {
+		t.Fatalf("expected live affected count 2, got %d", incidents[0].AffectedRequests)
+	}
+
+	prs.trackProviderIncident(ProviderEvent{Type: ProviderEventResumed, Platform: "claude", Provider: "relay-a"})
+	incidents, err = ls.ListProviderIncidents("", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc := incidents[0]
+	if inc.Ongoing() || inc.AffectedRequests != 2 {
+		t.Fatalf("expected closed incident with 2 affected requests, got %+v", inc)
+	}
+	if len(inc.ErrorSamples) != 2 || inc.ErrorSamples[0] != "invalid api key" || inc.ErrorSamples[1] != "unauthorized" {
+		t.Fatalf("unexpected error samples %v", inc.ErrorSamples)
+	}
+
+	if other, _ := ls.ListProviderIncidents("codex", 7); len(other) != 0 {
+		t.Fatalf("platform filter should exclude claude incidents, got %+v", other)
+	}
+}
+
+func TestPlatformIncidentSurvivesRestart(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	prs := &ProviderRelayService{}
+	prs.trackProviderIncident(ProviderEvent{Type: ProviderEventAllFailed, Platform: "claude", Reason: "all 2 providers failed"})
+	prs.trackProviderIncident(ProviderEvent{Type: ProviderEventAllFailed, Platform: "claude", Reason: strings.Repeat("x", 1000)})
+
+	// 新进程从数据库恢复进行中的故障，平台请求成功后结束
+	restarted := &ProviderRelayService{}
+	restarted.resolvePlatformIncident("codex")
+	restarted.resolvePlatformIncident("claude")
+
+	incidents, err := queryProviderIncidents("", time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 1 || incidents[0].Ongoing() || incidents[0].Provider != "" {
+		t.Fatalf("expected one resolved platform incident, got %+v", incidents)
+	}
+	if samples := incidents[0].ErrorSamples; len(samples) != 2 || len([]rune(samples[1])) != incidentSampleMaxLen+3 {
+		t.Fatalf("expected truncated second sample, got %v", samples)
+	}
+}
+
+func TestCircuitTransitionsRecordIncidents(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	prs := &ProviderRelayService{}
+	manager := NewCircuitBreakerManager(nil, CircuitBreakerConfig{FailureThreshold: 2, RecoveryTimeout: time.Hour, SuccessThreshold: 1})
+	manager.OnStateChange(func(providerName, oldState, newState string) {
+		prs.trackCircuitTransition("codex", providerName, oldState, newState)
+	})
+
+	cb := manager.GetCircuitBreaker(1, "relay-a")
+	cb.OnFailure()
+	cb.OnFailure()
+	if cb.GetState() != StateOpen {
+		t.Fatalf("expected circuit to open, got %s", cb.GetState())
+	}
+	incidents, err := queryProviderIncidents("codex", time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 1 || incidents[0].Cause != IncidentCauseCircuitOpen || !incidents[0].Ongoing() {
+		t.Fatalf("expected ongoing circuit incident, got %+v", incidents)
+	}
+
+	cb.Reset()
+	incidents, _ = queryProviderIncidents("codex", time.Now().Add(-time.Hour), 10)
+	if len(incidents) != 1 || incidents[0].Ongoing() {
+		t.Fatalf("expected circuit incident to end on reset, got %+v", incidents)
+	}
+}
+
+func TestBuildIncidentMarkers(t *testing.T) {
+	loc := statsLocation()
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 3, 7, 12, 0, 0, 0, loc)
+	incidents := []ProviderIncident{
+		{Platform: "claude", Provider: "a", StartedAt: time.Date(2026, 3, 2, 23, 0, 0, 0, loc).Unix(), EndedAt: time.Date(2026, 3, 3, 1, 0, 0, 0, loc).Unix()},
+		{Platform: "claude", StartedAt: time.Date(2026, 3, 3, 10, 0, 0, 0, loc).Unix(), EndedAt: time.Date(2026, 3, 3, 11, 0, 0, 0, loc).Unix()},
+		{Platform: "codex", Provider: "b", StartedAt: time.Date(2026, 2, 20, 0, 0, 0, 0, loc).Unix(), EndedAt: time.Date(2026, 3, 1, 5, 0, 0, 0, loc).Unix()},
+		{Platform: "codex", Provider: "c", StartedAt: time.Date(2026, 3, 7, 8, 0, 0, 0, loc).Unix()},
+	}
+
+	markers := buildIncidentMarkers(incidents, from, to)
+	days := make([]string, len(markers))
+	for i, marker := range markers {
+		days[i] = marker.Day
+	}
+	if got := strings.Join(days, ","); got != "2026-03-01,2026-03-02,2026-03-03,2026-03-07" {
+		t.Fatalf("unexpected marker days %s", got)
+	}
+	if markers[2].Count != 2 || strings.Join(markers[2].Providers, ",") != "claude/*,claude/a" {
+		t.Fatalf("unexpected marker %+v", markers[2])
+	}
+}
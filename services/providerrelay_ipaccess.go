@@ -0,0 +1,331 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// 入站访问控制：局域网 / 服务器部署时按 CIDR 允许或拒绝来源 IP，作用于所有路由。
+// 拒绝名单优先；允许名单非空时只放行其中的地址。回环地址始终放行，避免把本机客户端和桌面端挡在外面
+
+// SecurityEventIPDenied 来源 IP 被拒绝的安全事件类型
+const SecurityEventIPDenied = "ip_denied"
+
+// securityEventThrottle 同一 IP + 路径在该时间内只记录一次，避免扫描流量写满事件表
+const securityEventThrottle = 10 * time.Second
+
+// IPAccessConfig 入站 IP 访问控制配置；CIDR 或单个 IP
+type IPAccessConfig struct {
+	AllowList []string `json:"allowList,omitempty"`
+	DenyList  []string `json:"denyList,omitempty"`
+	// 可信反向代理：直连地址属于这些网段时，按 X-Forwarded-For 取真实来源
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+}
+
+// SecurityEvent 安全事件（被拒绝的访问等）
+type SecurityEvent struct {
+	ID        int64  `json:"id"`
+	Type      string `json:"type"`
+	ClientIP  string `json:"client_ip"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	UserAgent string `json:"user_agent"`
+	Detail    string `json:"detail"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ipAccessStore 解析后的访问控制配置与事件记录节流状态
+type ipAccessStore struct {
+	mu      sync.RWMutex
+	config  IPAccessConfig
+	allow   []*net.IPNet
+	deny    []*net.IPNet
+	proxies []*net.IPNet
+
+	logMu     sync.Mutex
+	lastEvent map[string]time.Time
+}
+
+// parseCIDRList 解析 CIDR 列表，单个 IP 视为 /32 或 /128
+func parseCIDRList(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 检查所有条目都是合法的 IP 或 CIDR
+func (cfg IPAccessConfig) Validate() error {
+	for _, list := range [][]string{cfg.AllowList, cfg.DenyList, cfg.TrustedProxies} {
+		if _, err := parseCIDRList(list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetIPAccessConfig 更新入站 IP 访问控制配置，立即生效
+func (prs *ProviderRelayService) SetIPAccessConfig(cfg IPAccessConfig) error {
+	allow, err := parseCIDRList(cfg.AllowList)
+	if err != nil {
+		return err
+	}
+	deny, err := parseCIDRList(cfg.DenyList)
+	if err != nil {
+		return err
+	}
+	proxies, err := parseCIDRList(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	prs.ipAccess.mu.Lock()
+	prs.ipAccess.config = cfg
+	prs.ipAccess.allow = allow
+	prs.ipAccess.deny = deny
+	prs.ipAccess.proxies = proxies
+	prs.ipAccess.mu.Unlock()
+	return nil
+}
+
+// GetIPAccessConfig 获取入站 IP 访问控制配置
+func (prs *ProviderRelayService) GetIPAccessConfig() IPAccessConfig {
+	prs.ipAccess.mu.RLock()
+	defer prs.ipAccess.mu.RUnlock()
+	return prs.ipAccess.config
+}
+
+// ipAccessClientIP 判断访问控制使用的来源地址：直连地址属于可信代理时，
+// 从 X-Forwarded-For 右侧开始取第一个不属于可信代理的地址（左侧的值可由客户端伪造）
+func ipAccessClientIP(r *http.Request, proxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ipInNets(ip, proxies) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !ipInNets(hop, proxies) {
+			break
+		}
+	}
+	return ip
+}
+
+// accessClientIP 按当前可信代理配置取访问控制使用的来源地址
+func (prs *ProviderRelayService) accessClientIP(r *http.Request) net.IP {
+	prs.ipAccess.mu.RLock()
+	proxies := prs.ipAccess.proxies
+	prs.ipAccess.mu.RUnlock()
+	return ipAccessClientIP(r, proxies)
+}
+
+// checkIPAccess 返回是否放行与拒绝原因
+func (prs *ProviderRelayService) checkIPAccess(ip net.IP) (bool, string) {
+	prs.ipAccess.mu.RLock()
+	defer prs.ipAccess.mu.RUnlock()
+	if len(prs.ipAccess.allow) == 0 && len(prs.ipAccess.deny) == 0 {
+		return true, ""
+	}
+	if ip == nil {
+		return false, "unknown client address"
+	}
+	if ip.IsLoopback() {
+		return true, ""
+	}
+	if ipInNets(ip, prs.ipAccess.deny) {
+		return false, "deny list"
+	}
+	if len(prs.ipAccess.allow) > 0 && !ipInNets(ip, prs.ipAccess.allow) {
+		return false, "not in allow list"
+	}
+	return true, ""
+}
+
+// ipAccessMiddleware 拒绝不在允许范围内的来源，并记录安全事件
+func (prs *ProviderRelayService) ipAccessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := prs.accessClientIP(c.Request)
+		allowed, reason := prs.checkIPAccess(ip)
+		if allowed {
+			c.Next()
+			return
+		}
+		clientIP := ""
+		if ip != nil {
+			clientIP = ip.String()
+		}
+		event := SecurityEvent{
+			Type:      SecurityEventIPDenied,
+			ClientIP:  clientIP,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			UserAgent: c.Request.UserAgent(),
+			Detail:    reason,
+		}
+		if prs.shouldRecordSecurityEvent(event) {
+			fmt.Printf("[IPAccess] 拒绝 %s %s %s (%s, UA=%s)\n", event.ClientIP, event.Method, event.Path, reason, event.UserAgent)
+			go recordSecurityEvent(event)
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
+	}
+}
+
+// shouldRecordSecurityEvent 节流：同一 IP + 路径短时间内只记录一次
+func (prs *ProviderRelayService) shouldRecordSecurityEvent(event SecurityEvent) bool {
+	key := event.ClientIP + " " + event.Path
+	now := time.Now()
+	prs.ipAccess.logMu.Lock()
+	defer prs.ipAccess.logMu.Unlock()
+	if prs.ipAccess.lastEvent == nil {
+		prs.ipAccess.lastEvent = make(map[string]time.Time)
+	}
+	if last, ok := prs.ipAccess.lastEvent[key]; ok && now.Sub(last) < securityEventThrottle {
+		return false
+	}
+	// 清理过期条目，防止大范围扫描时无限增长
+	if len(prs.ipAccess.lastEvent) > 10000 {
+		for k, t := range prs.ipAccess.lastEvent {
+			if now.Sub(t) >= securityEventThrottle {
+				delete(prs.ipAccess.lastEvent, k)
+			}
+		}
+	}
+	prs.ipAccess.lastEvent[key] = now
+	return true
+}
+
+// recordSecurityEvent 写入安全事件表
+func recordSecurityEvent(event SecurityEvent) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return
+	}
+	_, err = db.Exec(`INSERT INTO security_events (event_type, client_ip, method, path, user_agent, detail)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		event.Type, event.ClientIP, event.Method, event.Path, event.UserAgent, event.Detail)
+	if err != nil {
+		fmt.Printf("[IPAccess] 记录安全事件失败: %v\n", err)
+	}
+}
+
+// ListSecurityEvents 返回最近的安全事件，可按类型过滤
+func (prs *ProviderRelayService) ListSecurityEvents(eventType string, limit int) ([]SecurityEvent, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT id, COALESCE(event_type, ''), COALESCE(client_ip, ''), COALESCE(method, ''),
+		COALESCE(path, ''), COALESCE(user_agent, ''), COALESCE(detail, ''), COALESCE(created_at, '')
+		FROM security_events`
+	args := []any{}
+	if eventType != "" {
+		query += " WHERE event_type = ?"
+		args = append(args, eventType)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []SecurityEvent{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]SecurityEvent, 0)
+	for rows.Next() {
+		var e SecurityEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.ClientIP, &e.Method, &e.Path, &e.UserAgent, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ensureSecurityEventsTable 创建安全事件表
+func ensureSecurityEventsTable(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS security_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_type TEXT,
+		client_ip TEXT,
+		method TEXT,
+		path TEXT,
+		user_agent TEXT,
+		detail TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_security_events_type ON security_events(event_type, created_at)")
+	return err
+}
+
+// ===== 管理接口 =====
+
+func (prs *ProviderRelayService) adminGetIPAccessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.GetIPAccessConfig())
+}
+
+func (prs *ProviderRelayService) adminSecurityEventsHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	events, err := prs.ListSecurityEvents(c.Query("type"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
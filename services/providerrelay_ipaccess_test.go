@@ -0,0 +1,129 @@
+package services
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIPAccessConfigValidate(t *testing.T) {
+	if err := (IPAccessConfig{AllowList: []string{"10.0.0.0/8", "192.168.1.7", "fd00::/8", " 2001:db8::1 "}}).Validate(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	for _, bad := range []IPAccessConfig{
+		{AllowList: []string{"10.0.0.0/33"}},
+		{DenyList: []string{"example.com"}},
+		{TrustedProxies: []string{"10.0.0"}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%+v should be rejected", bad)
+		}
+	}
+}
+
+func TestCheckIPAccess(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  IPAccessConfig
+		ip   string
+		want bool
+	}{
+		{"not configured", IPAccessConfig{}, "203.0.113.5", true},
+		{"allow list hit", IPAccessConfig{AllowList: []string{"192.168.0.0/16"}}, "192.168.3.4", true},
+		{"allow list miss", IPAccessConfig{AllowList: []string{"192.168.0.0/16"}}, "10.1.2.3", false},
+		{"single ip", IPAccessConfig{AllowList: []string{"10.1.2.3"}}, "10.1.2.3", true},
+		{"deny wins over allow", IPAccessConfig{AllowList: []string{"10.0.0.0/8"}, DenyList: []string{"10.9.0.0/16"}}, "10.9.1.1", false},
+		{"deny only", IPAccessConfig{DenyList: []string{"203.0.113.0/24"}}, "198.51.100.1", true},
+		{"loopback always allowed", IPAccessConfig{AllowList: []string{"10.0.0.0/8"}, DenyList: []string{"127.0.0.0/8"}}, "127.0.0.1", true},
+		{"ipv6", IPAccessConfig{AllowList: []string{"fd00::/8"}}, "fd12::1", true},
+		{"ipv4-mapped ipv6", IPAccessConfig{AllowList: []string{"192.168.1.0/24"}}, "::ffff:192.168.1.9", true},
+	}
+	for _, tc := range cases {
+		prs := &ProviderRelayService{}
+		if err := prs.SetIPAccessConfig(tc.cfg); err != nil {
+			t.Fatal(err)
+		}
+		if got, reason := prs.checkIPAccess(net.ParseIP(tc.ip)); got != tc.want {
+			t.Errorf("%s: checkIPAccess(%s) = %v (%s), want %v", tc.name, tc.ip, got, reason, tc.want)
+		}
+	}
+}
+
+func TestIPAccessClientIP(t *testing.T) {
+	proxies, _ := parseCIDRList([]string{"10.0.0.0/8"})
+	cases := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "203.0.113.5:5000", "1.2.3.4", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.7", "198.51.100.7"},
+		{"spoofed left hop ignored", "10.0.0.2:5000", "1.2.3.4, 198.51.100.7, 10.0.0.3", "198.51.100.7"},
+		{"only proxies", "10.0.0.2:5000", "10.0.0.9", "10.0.0.9"},
+		{"no header", "10.0.0.2:5000", "", "10.0.0.2"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if got := ipAccessClientIP(r, proxies); got.String() != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIPAccessMiddlewareRecordsEvents(t *testing.T) {
+	openAnalyticsDB(t, "ipaccess.db")
+
+	prs := &ProviderRelayService{}
+	if err := prs.SetIPAccessConfig(IPAccessConfig{AllowList: []string{"192.168.0.0/16"}}); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(prs.ipAccessMiddleware())
+	router.POST("/v1/messages", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	send := func(remote string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("User-Agent", "scanner/1.0")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := send("192.168.1.2:4000"); code != http.StatusOK {
+		t.Fatalf("allowed client got %d", code)
+	}
+	// 同一来源的重复拒绝只记录一次
+	for i := 0; i < 3; i++ {
+		if code := send("203.0.113.9:4000"); code != http.StatusForbidden {
+			t.Fatalf("denied client got %d", code)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events, err := prs.ListSecurityEvents(SecurityEventIPDenied, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) == 1 {
+			e := events[0]
+			if e.ClientIP != "203.0.113.9" || e.Path != "/v1/messages" || e.UserAgent != "scanner/1.0" || e.Detail != "not in allow list" {
+				t.Fatalf("event = %+v", e)
+			}
+			break
+		}
+		if len(events) > 1 || time.Now().After(deadline) {
+			t.Fatalf("events = %+v", events)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
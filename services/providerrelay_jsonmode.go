@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// JSON 模式保证：客户端要求 response_format json_object / json_schema 或使用工具调用时，
+// 按 provider 配置注入指令、校验输出是否为合法 JSON，并在返回前本地修复或重新请求
+
+// provider 的 JSON 模式处理方式
+const (
+	JSONModeNative   = ""         // 原样转发，不做校验（默认）
+	JSONModeValidate = "validate" // 保留 response_format，校验输出并修复 / 重试
+	JSONModeEnforce  = "enforce"  // provider 不支持 response_format：移除该参数，注入指令并校验
+)
+
+const (
+	// defaultJSONModeRetries 未配置时输出无法修复后的最大重试次数
+	defaultJSONModeRetries = 2
+	// maxJSONModeRetries 允许配置的最大重试次数
+	maxJSONModeRetries = 5
+)
+
+// request_log.json_repair 的取值（为空表示未处理或输出本身合法）
+const (
+	jsonRepairRepaired = "repaired" // 本地修复后合法
+	jsonRepairFailed   = "failed"   // 重试用尽仍不合法，原样返回
+)
+
+const jsonModeInstruction = "Respond with a single valid JSON value only. Do not wrap it in markdown code fences and do not add any text before or after it."
+
+// jsonModeRequest 需要保证 JSON 输出的请求
+type jsonModeRequest struct {
+	mode      string
+	retries   int
+	format    bool   // 要求 JSON 输出（response_format / text.format）
+	schema    string // json_schema 的 schema 原文
+	tools     bool   // 声明了工具，校验工具调用参数
+	responses bool   // OpenAI Responses API 请求（否则为 Chat Completions）
+}
+
+// detectJSONMode 判断 OpenAI Chat Completions / Responses 请求是否需要 JSON 模式保证；
+// provider 未配置、其他端点或请求不涉及 JSON 输出时返回 nil
+func detectJSONMode(provider Provider, endpoint string, body []byte) *jsonModeRequest {
+	if provider.JSONMode == JSONModeNative || !gjson.ValidBytes(body) {
+		return nil
+	}
+	jm := &jsonModeRequest{mode: provider.JSONMode, retries: provider.JSONModeRetries}
+	switch {
+	case strings.Contains(endpoint, "chat/completions"):
+	case strings.Contains(endpoint, "responses"):
+		jm.responses = true
+	default:
+		return nil
+	}
+	if jm.retries <= 0 {
+		jm.retries = defaultJSONModeRetries
+	}
+
+	req := gjson.ParseBytes(body)
+	format := req.Get("response_format")
+	if jm.responses {
+		format = req.Get("text.format")
+	}
+	switch format.Get("type").String() {
+	case "json_object":
+		jm.format = true
+	case "json_schema":
+		jm.format = true
+		jm.schema = format.Get("json_schema.schema").Raw
+		if jm.responses {
+			jm.schema = format.Get("schema").Raw
+		}
+	}
+	jm.tools = len(req.Get("tools").Array()) > 0
+	if !jm.format && !jm.tools {
+		return nil
+	}
+	return jm
+}
+
+// instruction 要求输出 JSON 的系统指令，json_schema 请求附带 schema
+func (jm *jsonModeRequest) instruction() string {
+	if jm.schema == "" {
+		return jsonModeInstruction
+	}
+	return jsonModeInstruction + " The JSON must conform to this JSON Schema:\n" + jm.schema
+}
+
+// prepareJSONModeBody enforce 模式下移除 provider 不支持的 response_format，并以系统指令要求输出 JSON
+func prepareJSONModeBody(jm *jsonModeRequest, body []byte) ([]byte, error) {
+	if jm == nil || jm.mode != JSONModeEnforce || !jm.format {
+		return body, nil
+	}
+	var err error
+	if jm.responses {
+		if body, err = sjson.DeleteBytes(body, "text.format"); err != nil {
+			return nil, err
+		}
+		instructions := strings.TrimSpace(gjson.GetBytes(body, "instructions").String())
+		if instructions != "" {
+			instructions += "\n\n"
+		}
+		return sjson.SetBytes(body, "instructions", instructions+jm.instruction())
+	}
+
+	if body, err = sjson.DeleteBytes(body, "response_format"); err != nil {
+		return nil, err
+	}
+	messages := []interface{}{map[string]string{"role": "system", "content": jm.instruction()}}
+	for _, msg := range gjson.GetBytes(body, "messages").Array() {
+		messages = append(messages, msg.Value())
+	}
+	return sjson.SetBytes(body, "messages", messages)
+}
+
+// disableUpstreamStream 改为非流式请求（stream_options 仅在流式请求中有效，一并移除）
+func disableUpstreamStream(body []byte) ([]byte, error) {
+	body, err := sjson.SetBytes(body, "stream", false)
+	if err != nil {
+		return nil, err
+	}
+	return sjson.DeleteBytes(body, "stream_options")
+}
+
+// jsonOutputPaths 响应中需要是合法 JSON 的字符串字段路径
+func jsonOutputPaths(jm *jsonModeRequest, resp gjson.Result) []string {
+	paths := make([]string, 0)
+	if jm.responses {
+		resp.Get("output").ForEach(func(i, item gjson.Result) bool {
+			switch item.Get("type").String() {
+			case "message":
+				if jm.format {
+					item.Get("content").ForEach(func(j, part gjson.Result) bool {
+						if part.Get("type").String() == "output_text" {
+							paths = append(paths, fmt.Sprintf("output.%d.content.%d.text", i.Int(), j.Int()))
+						}
+						return true
+					})
+				}
+			case "function_call":
+				paths = append(paths, fmt.Sprintf("output.%d.arguments", i.Int()))
+			}
+			return true
+		})
+		return paths
+	}
+	resp.Get("choices").ForEach(func(i, choice gjson.Result) bool {
+		content := choice.Get("message.content")
+		if jm.format && content.Type == gjson.String && !choice.Get("message.tool_calls").Exists() {
+			paths = append(paths, fmt.Sprintf("choices.%d.message.content", i.Int()))
+		}
+		choice.Get("message.tool_calls").ForEach(func(j, _ gjson.Result) bool {
+			paths = append(paths, fmt.Sprintf("choices.%d.message.tool_calls.%d.function.arguments", i.Int(), j.Int()))
+			return true
+		})
+		return true
+	})
+	return paths
+}
+
+// checkJSONResponse 校验响应中的 JSON 输出，可修复的字段就地改写。
+// 返回（改写后的响应，是否全部合法，是否发生修复）
+func checkJSONResponse(jm *jsonModeRequest, data []byte) ([]byte, bool, bool) {
+	if !gjson.ValidBytes(data) {
+		return data, false, false
+	}
+	repaired := false
+	for _, path := range jsonOutputPaths(jm, gjson.ParseBytes(data)) {
+		value := gjson.GetBytes(data, path).String()
+		if strings.TrimSpace(value) == "" && strings.Contains(path, "arguments") {
+			continue // 无参数的工具调用
+		}
+		if gjson.Valid(value) {
+			continue
+		}
+		fixed, ok := repairJSON(value)
+		if !ok {
+			return data, false, false
+		}
+		updated, err := sjson.SetBytes(data, path, fixed)
+		if err != nil {
+			return data, false, false
+		}
+		data = updated
+		repaired = true
+	}
+	return data, true, repaired
+}
+
+var (
+	jsonFencePattern    = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+	jsonTrailingComma   = regexp.MustCompile(`,\s*([}\]])`)
+	jsonSmartQuoteFixer = strings.NewReplacer("“", `"`, "”", `"`)
+)
+
+// repairJSON 修复常见的非法 JSON 输出：markdown 代码块、前后多余文字、结尾多余逗号、中文引号
+func repairJSON(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if m := jsonFencePattern.FindStringSubmatch(s); m != nil {
+		s = m[1]
+	}
+	if start := strings.IndexAny(s, "{["); start >= 0 {
+		closing := "}"
+		if s[start] == '[' {
+			closing = "]"
+		}
+		if end := strings.LastIndex(s, closing); end > start {
+			s = s[start : end+1]
+		}
+	}
+	candidates := []string{s, jsonTrailingComma.ReplaceAllString(s, "$1")}
+	candidates = append(candidates, jsonSmartQuoteFixer.Replace(candidates[1]))
+	for _, candidate := range candidates {
+		if gjson.Valid(candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// readDecodedBody 读取完整响应体，gzip 压缩时解压
+func readDecodedBody(resp *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return data, err
+	}
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return data, err
+		}
+		defer gz.Close()
+		return io.ReadAll(gz)
+	}
+	return data, nil
+}
+
+// replaceResponseBody 用已读取的数据替换响应体，去掉不再准确的长度与编码头
+func replaceResponseBody(resp *http.Response, data []byte) *http.Response {
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Content-Encoding")
+	return resp
+}
+
+// enforceJSONResponse 校验成功的非流式响应：合法或修复后直接返回，否则重新请求上游，最多 retries 次。
+// 返回最终响应与写入 request_log.json_repair 的结果
+func enforceJSONResponse(jm *jsonModeRequest, resp *http.Response, resend func() (*http.Response, error)) (*http.Response, string) {
+	for attempt := 0; ; attempt++ {
+		data, err := readDecodedBody(resp)
+		if err != nil {
+			// 读取失败交给后续流程按原样处理
+			return replaceResponseBody(resp, data), ""
+		}
+		fixed, valid, repaired := checkJSONResponse(jm, data)
+		if valid {
+			outcome := ""
+			switch {
+			case attempt > 0:
+				outcome = fmt.Sprintf("retried:%d", attempt)
+			case repaired:
+				outcome = jsonRepairRepaired
+			}
+			return replaceResponseBody(resp, fixed), outcome
+		}
+		if attempt >= jm.retries {
+			return replaceResponseBody(resp, data), jsonRepairFailed
+		}
+		fmt.Printf("[JSONMode] 输出不是合法 JSON，重新请求上游（第 %d/%d 次）\n", attempt+1, jm.retries)
+		next, err := resend()
+		if err != nil {
+			return replaceResponseBody(resp, data), jsonRepairFailed
+		}
+		if next.StatusCode < http.StatusOK || next.StatusCode >= http.StatusMultipleChoices {
+			next.Body.Close()
+			return replaceResponseBody(resp, data), jsonRepairFailed
+		}
+		resp = next
+	}
+}
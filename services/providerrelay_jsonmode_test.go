@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestDetectAndPrepareJSONMode(t *testing.T) {
+	provider := Provider{JSONMode: JSONModeEnforce}
+	body := []byte(`{"model":"m","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_schema","json_schema":{"schema":{"type":"object"}}}}`)
+
+	if detectJSONMode(Provider{}, "/v1/chat/completions", body) != nil {
+		t.Fatal("native providers should not be enforced")
+	}
+	if detectJSONMode(provider, "/v1/messages", body) != nil {
+		t.Fatal("anthropic endpoint should not be enforced")
+	}
+	if detectJSONMode(provider, "/v1/chat/completions", []byte(`{"messages":[]}`)) != nil {
+		t.Fatal("plain requests should not be enforced")
+	}
+
+	jm := detectJSONMode(provider, "/v1/chat/completions", body)
+	if jm == nil || !jm.format || jm.schema != `{"type":"object"}` || jm.retries != defaultJSONModeRetries {
+		t.Fatalf("detected = %+v", jm)
+	}
+	prepared, err := prepareJSONModeBody(jm, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gjson.GetBytes(prepared, "response_format").Exists() {
+		t.Fatal("response_format should be removed in enforce mode")
+	}
+	if gjson.GetBytes(prepared, "messages.0.role").String() != "system" ||
+		!strings.Contains(gjson.GetBytes(prepared, "messages.0.content").String(), `{"type":"object"}`) ||
+		gjson.GetBytes(prepared, "messages.1.content").String() != "hi" {
+		t.Fatalf("prepared body = %s", prepared)
+	}
+
+	responses := []byte(`{"model":"m","input":"hi","instructions":"be brief","text":{"format":{"type":"json_object"}}}`)
+	jm = detectJSONMode(provider, "/responses", responses)
+	if jm == nil || !jm.responses {
+		t.Fatalf("responses request = %+v", jm)
+	}
+	prepared, _ = prepareJSONModeBody(jm, responses)
+	if gjson.GetBytes(prepared, "text.format").Exists() || !strings.HasPrefix(gjson.GetBytes(prepared, "instructions").String(), "be brief\n\n") {
+		t.Fatalf("prepared responses body = %s", prepared)
+	}
+
+	// validate mode keeps the native parameter
+	jm = detectJSONMode(Provider{JSONMode: JSONModeValidate}, "/v1/chat/completions", body)
+	if prepared, _ := prepareJSONModeBody(jm, body); string(prepared) != string(body) {
+		t.Fatalf("validate mode changed the body: %s", prepared)
+	}
+}
+
+func TestRepairJSON(t *testing.T) {
+	cases := map[string]string{
+		"```json\n{\"a\": 1}\n```":           `{"a": 1}`,
+		"Sure! Here it is: {\"a\": [1, 2,]}": `{"a": [1, 2]}`,
+		"{“a”: 1}":                           `{"a": 1}`,
+	}
+	for input, want := range cases {
+		got, ok := repairJSON(input)
+		if !ok || got != want {
+			t.Fatalf("repairJSON(%q) = %q, %v", input, got, ok)
+		}
+	}
+	if _, ok := repairJSON("no json here"); ok {
+		t.Fatal("text without JSON should not be repaired")
+	}
+}
+
+func chatResponse(content string) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"id":      "chatcmpl-1",
+		"model":   "m",
+		"choices": []interface{}{map[string]interface{}{"index": 0, "finish_reason": "stop", "message": map[string]interface{}{"role": "assistant", "content": content}}},
+		"usage":   map[string]int{"prompt_tokens": 3, "completion_tokens": 2},
+	})
+	return string(data)
+}
+
+func runJSONModeRequest(t *testing.T, provider Provider, body string, replies []string) (*httptest.ResponseRecorder, *ReqeustLog, int) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody, _ := io.ReadAll(r.Body)
+		if gjson.GetBytes(reqBody, "stream").Bool() {
+			t.Errorf("upstream request should not stream: %s", reqBody)
+		}
+		reply := replies[len(replies)-1]
+		if calls < len(replies) {
+			reply = replies[calls]
+		}
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(upstream.Close)
+
+	provider.APIURL = upstream.URL
+	provider.APIKey = "k"
+	prs := &ProviderRelayService{logWriteQueue: make(chan *ReqeustLog, 1)}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	isStream := gjson.Get(body, "stream").Bool()
+	ok, err := prs.forwardRequest(c, "codex", provider, "/v1/chat/completions", nil, map[string]string{}, []byte(body), isStream, "m")
+	if !ok || err != nil {
+		t.Fatalf("forwardRequest = %v, %v", ok, err)
+	}
+	return w, <-prs.logWriteQueue, calls
+}
+
+func TestForwardRequestJSONModeRepairAndRetry(t *testing.T) {
+	body := `{"model":"m","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_object"}}`
+
+	// Fenced output is repaired locally without another upstream call
+	w, log, calls := runJSONModeRequest(t, Provider{Name: "p", JSONMode: JSONModeEnforce}, body, []string{chatResponse("```json\n{\"ok\": true}\n```")})
+	if calls != 1 || log.JSONRepair != jsonRepairRepaired || gjson.Get(w.Body.String(), "choices.0.message.content").String() != `{"ok": true}` {
+		t.Fatalf("repair: calls=%d flag=%q body=%s", calls, log.JSONRepair, w.Body.String())
+	}
+
+	// Unrepairable output is retried
+	_, log, calls = runJSONModeRequest(t, Provider{Name: "p", JSONMode: JSONModeValidate}, body, []string{chatResponse("I cannot do that"), chatResponse(`{"ok":1}`)})
+	if calls != 2 || log.JSONRepair != "retried:1" {
+		t.Fatalf("retry: calls=%d flag=%q", calls, log.JSONRepair)
+	}
+
+	// Retries are bounded and the last output is returned as-is
+	w, log, calls = runJSONModeRequest(t, Provider{Name: "p", JSONMode: JSONModeValidate, JSONModeRetries: 1}, body, []string{chatResponse("nope")})
+	if calls != 2 || log.JSONRepair != jsonRepairFailed || w.Code != http.StatusOK {
+		t.Fatalf("exhausted: calls=%d flag=%q code=%d", calls, log.JSONRepair, w.Code)
+	}
+
+	// Streaming chat requests are validated upstream without streaming and simulated back as SSE
+	streamBody := `{"model":"m","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_object"}}`
+	w, log, _ = runJSONModeRequest(t, Provider{Name: "p", JSONMode: JSONModeEnforce}, streamBody, []string{chatResponse("{\"a\": 1,}")})
+	if log.JSONRepair != jsonRepairRepaired || !strings.Contains(w.Body.String(), "data: ") || !strings.Contains(w.Body.String(), `{\"a\": 1}`) {
+		t.Fatalf("stream: flag=%q body=%s", log.JSONRepair, w.Body.String())
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// ctxKeyUpstreamStart 本次上游请求的开始时间，流式钩子据此计算首 token 时间（fallback 重试时覆盖）
+const ctxKeyUpstreamStart = "codeswitch.upstream_start"
+
+var (
+	// latencyBuckets 首字节 / 首 token 时间直方图桶（秒）
+	latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30, 60}
+	// throughputBuckets 流式输出吞吐直方图桶（tokens/sec）
+	throughputBuckets = []float64{5, 10, 20, 40, 60, 80, 100, 150, 200, 400}
+)
+
+// hasOutputToken SSE 数据中是否已出现输出内容（Anthropic / OpenAI Chat / Responses / Gemini）
+func hasOutputToken(payload string) bool {
+	for _, line := range strings.Split(payload, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" || !gjson.Valid(data) {
+			continue
+		}
+		event := gjson.Parse(data)
+		eventType := event.Get("type").String()
+		switch {
+		case eventType == "content_block_delta":
+			return true
+		case strings.HasPrefix(eventType, "response.") && strings.HasSuffix(eventType, ".delta"):
+			return true
+		case event.Get("choices.0.delta.content").String() != "",
+			event.Get("choices.0.delta.reasoning_content").String() != "",
+			event.Get("choices.0.delta.tool_calls").Exists():
+			return true
+		case event.Get("candidates.0.content.parts").Exists():
+			return true
+		}
+	}
+	return false
+}
+
+// markFirstToken 记录首个输出 token 的到达时间
+func markFirstToken(c *gin.Context, log *ReqeustLog, payload string) {
+	if c == nil || log.TTFTSec > 0 {
+		return
+	}
+	start := c.GetTime(ctxKeyUpstreamStart)
+	if start.IsZero() || !hasOutputToken(payload) {
+		return
+	}
+	log.TTFTSec = time.Since(start).Seconds()
+}
+
+// finalizeThroughput 流式吞吐：首 token 之后的输出速度
+func finalizeThroughput(log *ReqeustLog) {
+	if log.TTFTSec > 0 && log.OutputTokens > 0 && log.DurationSec > log.TTFTSec {
+		log.TokensPerSec = float64(log.OutputTokens) / (log.DurationSec - log.TTFTSec)
+	}
+}
+
+// histogram Prometheus 直方图（counts 为各桶非累计计数，最后一个为 +Inf）
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, value float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets)+1)
+	}
+	h.counts[sort.SearchFloat64s(buckets, value)]++
+	h.sum += value
+	h.count++
+}
+
+type latencySeriesKey struct {
+	platform string
+	provider string
+}
+
+type latencySeries struct {
+	ttfb histogram
+	ttft histogram
+	tps  histogram
+}
+
+// latencyHistograms 按 platform / provider 聚合的 TTFB、TTFT、tokens/sec 直方图
+type latencyHistograms struct {
+	mu     sync.Mutex
+	series map[latencySeriesKey]*latencySeries
+}
+
+// observeLatency 记录一条请求的延迟指标，未产生的指标（非流式无 TTFT）不计入
+func (prs *ProviderRelayService) observeLatency(log *ReqeustLog) {
+	if log.TTFBSec <= 0 && log.TTFTSec <= 0 {
+		return
+	}
+	prs.latency.mu.Lock()
+	defer prs.latency.mu.Unlock()
+	if prs.latency.series == nil {
+		prs.latency.series = make(map[latencySeriesKey]*latencySeries)
+	}
+	key := latencySeriesKey{platform: log.Platform, provider: log.Provider}
+	series := prs.latency.series[key]
+	if series == nil {
+		series = &latencySeries{}
+		prs.latency.series[key] = series
+	}
+	if log.TTFBSec > 0 {
+		series.ttfb.observe(latencyBuckets, log.TTFBSec)
+	}
+	if log.TTFTSec > 0 {
+		series.ttft.observe(latencyBuckets, log.TTFTSec)
+	}
+	if log.TokensPerSec > 0 {
+		series.tps.observe(throughputBuckets, log.TokensPerSec)
+	}
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// latencyMetrics 以 Prometheus 文本格式输出延迟直方图
+func (prs *ProviderRelayService) latencyMetrics() string {
+	prs.latency.mu.Lock()
+	defer prs.latency.mu.Unlock()
+
+	keys := make([]latencySeriesKey, 0, len(prs.latency.series))
+	for key := range prs.latency.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].platform != keys[j].platform {
+			return keys[i].platform < keys[j].platform
+		}
+		return keys[i].provider < keys[j].provider
+	})
+
+	families := []struct {
+		name, help string
+		buckets    []float64
+		pick       func(*latencySeries) *histogram
+	}{
+		{"ailurus_paas_upstream_ttfb_seconds", "Time until upstream response headers arrive", latencyBuckets, func(s *latencySeries) *histogram { return &s.ttfb }},
+		{"ailurus_paas_upstream_ttft_seconds", "Time until the first output token of streaming responses", latencyBuckets, func(s *latencySeries) *histogram { return &s.ttft }},
+		{"ailurus_paas_stream_tokens_per_second", "Output tokens per second after the first token of streaming responses", throughputBuckets, func(s *latencySeries) *histogram { return &s.tps }},
+	}
+
+	var b strings.Builder
+	for _, family := range families {
+		fmt.Fprintf(&b, "\n# HELP %s %s\n# TYPE %s histogram\n", family.name, family.help, family.name)
+		for _, key := range keys {
+			h := family.pick(prs.latency.series[key])
+			if h.count == 0 {
+				continue
+			}
+			labels := fmt.Sprintf(`platform="%s",provider="%s"`, promLabelEscaper.Replace(key.platform), promLabelEscaper.Replace(key.provider))
+			var cumulative uint64
+			for i, le := range family.buckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(&b, "%s_bucket{%s,le=\"%g\"} %d\n", family.name, labels, le, cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", family.name, labels, h.count)
+			fmt.Fprintf(&b, "%s_sum{%s} %g\n", family.name, labels, h.sum)
+			fmt.Fprintf(&b, "%s_count{%s} %d\n", family.name, labels, h.count)
+		}
+	}
+	return b.String()
+}
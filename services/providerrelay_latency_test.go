@@ -0,0 +1,66 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestLatencyTracking(t *testing.T) {
+	for payload, want := range map[string]bool{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":10}}}": false,
+		"data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}":                                   true,
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}":                                       true,
+		"data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}":                            false,
+		"data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}":                                                 true,
+		"data: [DONE]": false,
+	} {
+		if got := hasOutputToken(payload); got != want {
+			t.Fatalf("hasOutputToken(%q) = %v, want %v", payload, got, want)
+		}
+	}
+
+	log := &ReqeustLog{OutputTokens: 100, TTFTSec: 1, DurationSec: 3}
+	finalizeThroughput(log)
+	if log.TokensPerSec != 50 {
+		t.Fatalf("expected 50 tokens/sec, got %v", log.TokensPerSec)
+	}
+
+	prs := &ProviderRelayService{}
+	prs.observeLatency(&ReqeustLog{Platform: "claude", Provider: `a"b`, TTFBSec: 0.3, TTFTSec: 0.8, TokensPerSec: 50})
+	prs.observeLatency(&ReqeustLog{Platform: "claude", Provider: `a"b`, TTFBSec: 5})
+	metrics := prs.latencyMetrics()
+	for _, want := range []string{
+		`ailurus_paas_upstream_ttfb_seconds_bucket{platform="claude",provider="a\"b",le="0.5"} 1`,
+		`ailurus_paas_upstream_ttfb_seconds_bucket{platform="claude",provider="a\"b",le="+Inf"} 2`,
+		`ailurus_paas_upstream_ttft_seconds_count{platform="claude",provider="a\"b"} 1`,
+		`ailurus_paas_stream_tokens_per_second_bucket{platform="claude",provider="a\"b",le="40"} 0`,
+		`ailurus_paas_stream_tokens_per_second_bucket{platform="claude",provider="a\"b",le="60"} 1`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Fatalf("missing %q in metrics:\n%s", want, metrics)
+		}
+	}
+
+	openAnalyticsDB(t, "latency.db")
+	db, _ := xdb.DB("default")
+	now := time.Now().UTC().Format(timeLayout)
+	for i, row := range []struct{ ttft, tps float64 }{{0.5, 40}, {1.5, 60}, {0, 0}} {
+		if _, err := db.Exec("INSERT INTO request_log (provider, http_code, duration_sec, ttfb_sec, ttft_sec, tokens_per_sec, created_at) VALUES ('p', 200, 5, 0.2, ?, ?, ?)",
+			row.ttft, row.tps, now); err != nil {
+			t.Fatalf("insert %d: %v", i, err)
+		}
+	}
+	perf, err := NewLogService().PerformanceAnalysis("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perf.TTFTP50 != 1 || perf.TTFTAvg != 1 || perf.TokensPerSecAvg != 50 || perf.TTFBP99 != 0.2 {
+		t.Fatalf("unexpected latency percentiles: %+v", perf)
+	}
+	if stat := perf.ProviderReliability[0]; stat.AvgTTFT != 1 || stat.AvgTokensPerSec != 50 {
+		t.Fatalf("non-streaming requests must not dilute provider averages: %+v", stat)
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// logBatchMin / logBatchMax 自适应批量大小的上下限：队列积压时加倍，空闲时减半
+	logBatchMin = 10
+	logBatchMax = 500
+	// logBatchTimeout 未凑满一批时的最长等待时间
+	logBatchTimeout = 100 * time.Millisecond
+)
+
+// requestLogInsertColumns request_log 写入列，顺序与 requestLogValues 一致
+var requestLogInsertColumns = []string{
+	"trace_id", "request_id", "conversation_id", "project", "tags", "api_key_id", "app_name",
+	"platform", "model", "provider", "http_code",
+	"input_tokens", "output_tokens", "cache_create_tokens", "cache_read_tokens", "reasoning_tokens",
+	"is_stream", "duration_sec", "ttfb_sec", "ttft_sec", "tokens_per_sec", "user_agent", "client_ip", "user_id", "request_method", "request_path",
+	"error_type", "error_message", "provider_error_code", "json_repair", "prompt_compression",
+	"request_bytes", "response_bytes",
+	"input_cost", "output_cost", "cache_create_cost", "cache_read_cost", "ephemeral_5m_cost", "ephemeral_1h_cost", "total_cost",
+	"created_at",
+}
+
+// insertRequestLogSQL 未指定 created_at 时（非回放日志）使用写入时间
+var insertRequestLogSQL = fmt.Sprintf("INSERT INTO request_log (%s) VALUES (%sCOALESCE(NULLIF(?, ''), CURRENT_TIMESTAMP))",
+	strings.Join(requestLogInsertColumns, ", "), strings.Repeat("?, ", len(requestLogInsertColumns)-1))
+
+func requestLogValues(log *ReqeustLog) []any {
+	return []any{
+		log.TraceID, log.RequestID, log.ConversationID, log.Project, log.Tags, log.APIKeyID, log.AppName,
+		log.Platform, log.Model, log.Provider, log.HttpCode,
+		log.InputTokens, log.OutputTokens, log.CacheCreateTokens, log.CacheReadTokens, log.ReasoningTokens,
+		boolToInt(log.IsStream), log.DurationSec, log.TTFBSec, log.TTFTSec, log.TokensPerSec, log.UserAgent, log.ClientIP, log.UserID, log.RequestMethod, log.RequestPath,
+		log.ErrorType, log.ErrorMessage, log.ProviderErrorCode, log.JSONRepair, log.PromptCompression,
+		log.RequestBytes, atomic.LoadInt64(&log.ResponseBytes),
+		log.InputCost, log.OutputCost, log.CacheCreateCost, log.CacheReadCost, log.Ephemeral5mCost, log.Ephemeral1hCost, log.TotalCost,
+		log.CreatedAt,
+	}
+}
+
+// logQueueCounters 日志写入队列计数，原子操作
+type logQueueCounters struct {
+	enqueued    uint64
+	dropped     uint64
+	written     uint64
+	failed      uint64
+	flushes     uint64
+	batchSize   int64
+	lastFlushUs int64
+	// 溢出策略计数：等待后入队 / 暂存到磁盘 / 从磁盘回放
+	blocked     uint64
+	spooled     uint64
+	replayed    uint64
+	bodyDropped uint64
+	bodySpooled uint64
+}
+
+// LogQueueStats 日志写入队列状态
+type LogQueueStats struct {
+	Depth       int     `json:"depth"`
+	Capacity    int     `json:"capacity"`
+	BatchSize   int     `json:"batch_size"`
+	Enqueued    uint64  `json:"enqueued"`
+	Dropped     uint64  `json:"dropped"`
+	Written     uint64  `json:"written"`
+	Failed      uint64  `json:"failed"`
+	Flushes     uint64  `json:"flushes"`
+	LastFlushMs float64 `json:"last_flush_ms"`
+	// 溢出策略与计数，Dropped / BodyDropped 大于 0 时使用量数据不完整
+	Policy       string `json:"policy"`
+	Blocked      uint64 `json:"blocked"`
+	Spooled      uint64 `json:"spooled"`
+	Replayed     uint64 `json:"replayed"`
+	SpoolBytes   int64  `json:"spool_bytes"`
+	BodyDepth    int    `json:"body_depth"`
+	BodyCapacity int    `json:"body_capacity"`
+	BodyDropped  uint64 `json:"body_dropped"`
+	BodySpooled  uint64 `json:"body_spooled"`
+}
+
+// GetLogQueueStats 返回日志写入队列深度、批量大小、溢出策略与丢弃 / 暂存 / 失败计数
+func (prs *ProviderRelayService) GetLogQueueStats() LogQueueStats {
+	return LogQueueStats{
+		Depth:        len(prs.logWriteQueue),
+		Capacity:     cap(prs.logWriteQueue),
+		BatchSize:    int(atomic.LoadInt64(&prs.logQueue.batchSize)),
+		Enqueued:     atomic.LoadUint64(&prs.logQueue.enqueued),
+		Dropped:      atomic.LoadUint64(&prs.logQueue.dropped),
+		Written:      atomic.LoadUint64(&prs.logQueue.written),
+		Failed:       atomic.LoadUint64(&prs.logQueue.failed),
+		Flushes:      atomic.LoadUint64(&prs.logQueue.flushes),
+		LastFlushMs:  float64(atomic.LoadInt64(&prs.logQueue.lastFlushUs)) / 1000,
+		Policy:       prs.GetLogOverflowPolicy().Mode,
+		Blocked:      atomic.LoadUint64(&prs.logQueue.blocked),
+		Spooled:      atomic.LoadUint64(&prs.logQueue.spooled),
+		Replayed:     atomic.LoadUint64(&prs.logQueue.replayed),
+		SpoolBytes:   logSpoolBytes(),
+		BodyDepth:    len(prs.bodyLogQueue),
+		BodyCapacity: cap(prs.bodyLogQueue),
+		BodyDropped:  atomic.LoadUint64(&prs.logQueue.bodyDropped),
+		BodySpooled:  atomic.LoadUint64(&prs.logQueue.bodySpooled),
+	}
+}
+
+// enqueueRequestLog 入队；队列满时按溢出策略等待、暂存到磁盘或丢弃
+func (prs *ProviderRelayService) enqueueRequestLog(log *ReqeustLog) bool {
+	finalizeThroughput(log)
+	prs.observeLatency(log)
+	prs.observeTransfer(log)
+	if prs.proxyController != nil {
+		prs.proxyController.RecordCost(log.AppName, log.TotalCost)
+	}
+	GetSyncIntegration().OnScopedChange(syncScopeRequestLogs, log)
+	select {
+	case prs.logWriteQueue <- log:
+		atomic.AddUint64(&prs.logQueue.enqueued, 1)
+		return true
+	default:
+		return prs.overflowRequestLog(log)
+	}
+}
+
+// processLogWriteQueue 处理日志写入队列：每批在一个事务中用预编译语句写入，批量大小随积压自适应
+func (prs *ProviderRelayService) processLogWriteQueue() {
+	batchSize := logBatchMin
+	atomic.StoreInt64(&prs.logQueue.batchSize, int64(batchSize))
+	fmt.Printf("[Ailurus PaaS] 日志写入队列已启动 (batch_size=%d-%d, timeout=%v)\n", logBatchMin, logBatchMax, logBatchTimeout)
+
+	batch := make([]*ReqeustLog, 0, logBatchMax)
+	ticker := time.NewTicker(logBatchTimeout)
+	defer ticker.Stop()
+
+	flushBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+		prs.writeRequestLogs(batch)
+		batch = batch[:0]
+
+		// 积压超过当前批量时加倍，几乎空闲时减半
+		switch depth := len(prs.logWriteQueue); {
+		case depth >= batchSize && batchSize < logBatchMax:
+			batchSize = min(batchSize*2, logBatchMax)
+		case depth < batchSize/4 && batchSize > logBatchMin:
+			batchSize = max(batchSize/2, logBatchMin)
+		}
+		atomic.StoreInt64(&prs.logQueue.batchSize, int64(batchSize))
+	}
+
+	for {
+		select {
+		case log, ok := <-prs.logWriteQueue:
+			if !ok {
+				// 队列关闭，刷新剩余批次
+				fmt.Printf("[Ailurus PaaS] 日志写入队列关闭，刷新剩余 %d 条日志\n", len(batch))
+				flushBatch()
+				fmt.Printf("[Ailurus PaaS] 日志写入队列已停止\n")
+				return
+			}
+			batch = append(batch, log)
+			if len(batch) >= batchSize {
+				flushBatch()
+			}
+		case <-ticker.C:
+			// 定时刷新，避免日志积压
+			flushBatch()
+		}
+	}
+}
+
+// writeRequestLogs 在单个事务中写入一批日志，提交后再推送给 live tail 订阅者；整批失败时返回错误
+func (prs *ProviderRelayService) writeRequestLogs(batch []*ReqeustLog) error {
+	start := time.Now()
+	defer func() {
+		atomic.AddUint64(&prs.logQueue.flushes, 1)
+		atomic.StoreInt64(&prs.logQueue.lastFlushUs, time.Since(start).Microseconds())
+	}()
+
+	fail := func(err error) {
+		atomic.AddUint64(&prs.logQueue.failed, uint64(len(batch)))
+		fmt.Printf("[Ailurus PaaS] 批量写入 %d 条 request_log 失败: %v\n", len(batch), err)
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		fail(err)
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		fail(err)
+		return err
+	}
+	stmt, err := tx.Prepare(insertRequestLogSQL)
+	if err != nil {
+		tx.Rollback()
+		fail(err)
+		return err
+	}
+
+	written := make([]*ReqeustLog, 0, len(batch))
+	earliest := ""
+	for _, log := range batch {
+		res, err := stmt.Exec(requestLogValues(log)...)
+		if err != nil {
+			atomic.AddUint64(&prs.logQueue.failed, 1)
+			fmt.Printf("[Ailurus PaaS] 写入 request_log 失败 (trace_id=%s): %v\n", log.TraceID, err)
+			continue
+		}
+		log.ID, _ = res.LastInsertId()
+		written = append(written, log)
+		if log.CreatedAt != "" && (earliest == "" || log.CreatedAt < earliest) {
+			earliest = log.CreatedAt
+		}
+	}
+	stmt.Close()
+	// 回放的日志可能落在已汇总的小时内，在同一事务中回退汇总水位线
+	if earliest != "" {
+		if err := rewindRollups(tx, earliest); err != nil && !isNoSuchTableErr(err) {
+			fmt.Printf("[Ailurus PaaS] 回退用量汇总水位线失败: %v\n", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		batch = written
+		fail(err)
+		return err
+	}
+
+	atomic.AddUint64(&prs.logQueue.written, uint64(len(written)))
+	for _, log := range written {
+		prs.publishRequestLog(log)
+	}
+	fmt.Printf("[Ailurus PaaS] 批量写入完成：%d/%d 成功 (%v)\n", len(written), len(batch), time.Since(start).Round(time.Millisecond))
+	return nil
+}
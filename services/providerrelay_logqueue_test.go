@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestLogWriteQueueBatching(t *testing.T) {
+	openAnalyticsDB(t, "queue.db")
+
+	prs := &ProviderRelayService{logWriteQueue: make(chan *ReqeustLog, 1000)}
+	logs := make([]*ReqeustLog, 1001)
+	for i := range logs {
+		logs[i] = &ReqeustLog{TraceID: fmt.Sprintf("t-%d", i), Platform: "claude", Model: "m", HttpCode: 200, IsStream: i%2 == 0, TotalCost: 0.01}
+	}
+	// 写入协程启动前填满队列，多出的一条被丢弃
+	for _, log := range logs {
+		prs.enqueueRequestLog(log)
+	}
+	stats := prs.GetLogQueueStats()
+	if stats.Depth != 1000 || stats.Enqueued != 1000 || stats.Dropped != 1 {
+		t.Fatalf("unexpected stats before flush: %+v", stats)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		prs.processLogWriteQueue()
+		close(done)
+	}()
+	close(prs.logWriteQueue)
+	<-done
+
+	stats = prs.GetLogQueueStats()
+	if stats.Written != 1000 || stats.Failed != 0 || stats.Depth != 0 {
+		t.Fatalf("unexpected stats after flush: %+v", stats)
+	}
+	// 积压时批量大小自适应增大，刷新次数远少于逐条写入
+	if stats.Flushes >= 100 {
+		t.Fatalf("expected adaptive batches, got %d flushes", stats.Flushes)
+	}
+	if logs[999].ID == 0 || logs[1000].ID != 0 {
+		t.Fatalf("expected IDs for written logs only, got %d / %d", logs[999].ID, logs[1000].ID)
+	}
+
+	db, _ := xdb.DB("default")
+	var count, streams int
+	var cost float64
+	db.QueryRow("SELECT count(*), sum(is_stream), sum(total_cost) FROM request_log").Scan(&count, &streams, &cost)
+	if count != 1000 || streams != 500 || cost < 9.99 {
+		t.Fatalf("unexpected rows: count=%d streams=%d cost=%f", count, streams, cost)
+	}
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 多媒体端点类型
+const (
+	mediaKindImage         = "image"
+	mediaKindSpeech        = "speech"
+	mediaKindTranscription = "transcription"
+)
+
+// 多媒体请求超时：图片生成与音频处理远慢于普通对话
+const (
+	mediaImageTimeout = 180 * time.Second
+	mediaAudioTimeout = 300 * time.Second
+)
+
+// registerMediaRoutes 注册图片生成、语音合成与语音转写代理路由（走 codex 平台的 provider）
+func (prs *ProviderRelayService) registerMediaRoutes(router gin.IRouter) {
+	router.POST("/v1/images/generations", prs.mediaHandler("codex", "/v1/images/generations", mediaKindImage))
+	router.POST("/v1/images/edits", prs.mediaHandler("codex", "/v1/images/edits", mediaKindImage))
+	router.POST("/v1/audio/speech", prs.mediaHandler("codex", "/v1/audio/speech", mediaKindSpeech))
+	router.POST("/v1/audio/transcriptions", prs.mediaHandler("codex", "/v1/audio/transcriptions", mediaKindTranscription))
+	router.POST("/v1/audio/translations", prs.mediaHandler("codex", "/v1/audio/translations", mediaKindTranscription))
+}
+
+// mediaRequest 从 JSON 或 multipart 请求体中提取的参数
+type mediaRequest struct {
+	model       string
+	contentType string
+	images      int
+	size        string
+	quality     string
+	characters  int
+}
+
+// parseMediaRequest 解析请求参数；multipart（音频上传 / 图片编辑）只读取表单字段，不解码文件
+func parseMediaRequest(contentType string, body []byte) mediaRequest {
+	req := mediaRequest{contentType: contentType}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FileName() != "" {
+				part.Close()
+				continue
+			}
+			value, _ := io.ReadAll(io.LimitReader(part, 4096))
+			part.Close()
+			switch part.FormName() {
+			case "model":
+				req.model = string(value)
+			case "n":
+				fmt.Sscanf(string(value), "%d", &req.images)
+			case "size":
+				req.size = string(value)
+			case "quality":
+				req.quality = string(value)
+			}
+		}
+	} else {
+		req.model = gjson.GetBytes(body, "model").String()
+		req.images = int(gjson.GetBytes(body, "n").Int())
+		req.size = gjson.GetBytes(body, "size").String()
+		req.quality = gjson.GetBytes(body, "quality").String()
+		req.characters = len([]rune(gjson.GetBytes(body, "input").String()))
+	}
+	return req
+}
+
+// replaceMultipartField 替换 multipart 请求体中的表单字段值；其余分段（含上传的文件）按原始字节复制，
+// 并沿用原 boundary，因此 Content-Type 无需改变
+func replaceMultipartField(contentType string, body []byte, name, value string) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("multipart boundary missing")
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		dst, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name && part.FileName() == "" {
+			_, err = io.WriteString(dst, value)
+		} else {
+			_, err = io.Copy(dst, part)
+		}
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mediaHandler 透传多媒体请求，按 provider 优先级依次尝试
+func (prs *ProviderRelayService) mediaHandler(kind, endpoint, mediaKind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		req := parseMediaRequest(c.GetHeader("Content-Type"), bodyBytes)
+		if mediaKind == mediaKindImage && req.images == 0 {
+			req.images = 1
+		}
+
+		providers, err := prs.providerService.LoadProviders(kind)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
+			return
+		}
+		active := make([]Provider, 0, len(providers))
+		for _, p := range providers {
+			if !p.Enabled || p.Suspended || p.APIURL == "" || !p.HasCredentials() {
+				continue
+			}
+			if req.model != "" && !p.IsModelSupported(req.model) {
+				continue
+			}
+			active = append(active, p)
+		}
+		if len(active) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'", req.model)})
+			return
+		}
+		sort.SliceStable(active, func(i, j int) bool {
+			return max(active[i].Level, 1) < max(active[j].Level, 1)
+		})
+		active = prs.applyCooldowns(kind, active)
+
+		var lastErr error
+		for _, provider := range active {
+			ok, err := prs.forwardMediaRequest(c, kind, provider, endpoint, mediaKind, req, bodyBytes)
+			if ok {
+				return
+			}
+			fmt.Printf("[Media] ✗ Provider %s 失败: %v\n", provider.Name, err)
+			lastErr = err
+		}
+
+		writeRelayError(c, errorSchemaOpenAI, fmt.Sprintf("所有 %d 个 provider 均失败", len(active)), lastErr)
+	}
+}
+
+// forwardMediaRequest 向单个 provider 转发多媒体请求，并记录用量与费用
+func (prs *ProviderRelayService) forwardMediaRequest(
+	c *gin.Context,
+	kind string,
+	provider Provider,
+	endpoint string,
+	mediaKind string,
+	req mediaRequest,
+	bodyBytes []byte,
+) (bool, error) {
+	model := provider.GetEffectiveModel(req.model)
+	if model != req.model && req.model != "" {
+		replace := ReplaceModelInRequestBody
+		if strings.HasPrefix(req.contentType, "multipart/") {
+			replace = func(body []byte, model string) ([]byte, error) {
+				return replaceMultipartField(req.contentType, body, "model", model)
+			}
+		}
+		if modified, err := replace(bodyBytes, model); err == nil {
+			bodyBytes = modified
+		} else {
+			fmt.Printf("[Media] 替换模型失败，按原请求转发: %v\n", err)
+		}
+	}
+
+	targetURL := joinURL(provider.APIURL, endpoint)
+	query := map[string]string{}
+	if provider.IsAzure() {
+		azureURL, azureBody, err := buildAzureRequest(provider, endpoint, model, bodyBytes)
+		if err != nil {
+			return false, err
+		}
+		targetURL, bodyBytes = azureURL, azureBody
+		query["api-version"] = provider.azureAPIVersion(endpoint)
+	}
+
+	headers := map[string]string{"Content-Type": req.contentType}
+	if err := prs.applyProviderAuth(kind, provider, headers); err != nil {
+		return false, err
+	}
+	applyExtraHeaders(provider, model, headers)
+
+	traceID := generateTraceID()
+	c.Header("X-Trace-ID", traceID)
+	requestLog := &ReqeustLog{
+		TraceID:       traceID,
+		RequestID:     c.GetHeader("X-Request-ID"),
+		Platform:      kind,
+		Provider:      provider.Name,
+		Model:         model,
+		UserAgent:     c.GetHeader("User-Agent"),
+		ClientIP:      getClientIP(c),
+		UserID:        requestUserID(c),
+		RequestMethod: c.Request.Method,
+		RequestPath:   c.Request.URL.Path,
+	}
+	requestLog.Project, requestLog.Tags = prs.resolveAttribution(c)
+	requestLog.APIKeyID = clientKeyID(c)
+	requestLog.AppName = clientFingerprintFor(c, bodyBytes).App
+	usage := modelpricing.MediaUsage{Characters: req.characters}
+	if mediaKind == mediaKindImage {
+		usage.Images = req.images
+		usage.Size = req.size
+		usage.Quality = req.quality
+	}
+
+	start := time.Now()
+	defer func() {
+		requestLog.DurationSec = time.Since(start).Seconds()
+		if requestLog.HttpCode >= 400 {
+			requestLog.ErrorType = classifyHTTPError(requestLog.HttpCode)
+		}
+		prs.trackAuthResult(kind, provider, requestLog.HttpCode)
+		if prs.pricingService != nil && !provider.IsLocal() {
+			// gpt-image-1 等按 token 计费的模型返回 usage，优先使用 token 价格
+			var cost modelpricing.CostBreakdown
+			if requestLog.InputTokens > 0 || requestLog.OutputTokens > 0 {
+				cost = prs.pricingService.CalculateCost(model, modelpricing.UsageSnapshot{
+					InputTokens:  requestLog.InputTokens,
+					OutputTokens: requestLog.OutputTokens,
+				})
+			} else {
+				cost = prs.pricingService.CalculateMediaCost(model, usage)
+			}
+			requestLog.InputCost = cost.InputCost
+			requestLog.OutputCost = cost.OutputCost
+			requestLog.TotalCost = cost.TotalCost
+		}
+		prs.enqueueRequestLog(requestLog)
+	}()
+
+	// 图片 / 音频生成耗时较长，总超时不低于对应默认值
+	timeouts := prs.resolveTimeouts(provider, false, c.Request.Header)
+	minTotal := mediaAudioTimeout
+	if mediaKind == mediaKindImage {
+		minTotal = mediaImageTimeout
+	}
+	if timeouts.total < minTotal {
+		timeouts.total = minTotal
+	}
+	upstreamCtx, cancelUpstream := withUpstreamDeadline(c.Request.Context(), timeouts)
+	defer cancelUpstream(nil)
+	requestLog.RequestBytes = int64(len(bodyBytes))
+	httpReq, err := http.NewRequestWithContext(upstreamCtx, "POST", targetURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		requestLog.ErrorType = "network_error"
+		requestLog.ErrorMessage = err.Error()
+		return false, err
+	}
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+	if len(query) > 0 {
+		q := httpReq.URL.Query()
+		for k, v := range query {
+			q.Set(k, v)
+		}
+		httpReq.URL.RawQuery = q.Encode()
+	}
+
+	fmt.Printf("[Media] 发送 %s 请求 (trace_id=%s, provider=%s, model=%s, timeout=%v)\n",
+		mediaKind, traceID, provider.Name, model, timeouts.total)
+	resp, err := newUpstreamClient(timeouts).Do(httpReq)
+	if err != nil {
+		requestLog.ErrorType = classifyRequestError(upstreamCtx, err)
+		requestLog.ErrorMessage = err.Error()
+		return false, err
+	}
+	countResponseBytes(resp, requestLog)
+	defer resp.Body.Close()
+
+	requestLog.HttpCode = resp.StatusCode
+	rateLimit, hasRateLimit := prs.recordRateLimit(kind, provider.Name, resp.StatusCode, resp.Header)
+	prs.updateCooldown(kind, provider.Name, resp.StatusCode, resp.Header)
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		requestLog.ErrorType = classifyRequestError(upstreamCtx, err)
+		requestLog.ErrorMessage = err.Error()
+		return false, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		requestLog.ErrorMessage = string(respData)
+		requestLog.ProviderErrorCode = gjson.GetBytes(respData, "error.code").String()
+		return false, &upstreamStatusError{Status: resp.StatusCode, Body: respData}
+	}
+
+	switch mediaKind {
+	case mediaKindTranscription:
+		// verbose_json 返回 duration；gpt-4o-transcribe 返回 usage.seconds 或 token 用量
+		usage.Seconds = gjson.GetBytes(respData, "duration").Float()
+		if usage.Seconds == 0 {
+			usage.Seconds = gjson.GetBytes(respData, "usage.seconds").Float()
+		}
+		CodexParseTokenUsageFromResponse(string(respData), requestLog)
+	case mediaKindImage:
+		CodexParseTokenUsageFromResponse(string(respData), requestLog)
+		if n := len(gjson.GetBytes(respData, "data").Array()); n > 0 {
+			usage.Images = n
+		}
+	}
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+	if hasRateLimit {
+		writeRateLimitHeaders(c.Writer.Header(), rateLimit)
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+	if _, err := c.Writer.Write(respData); err != nil {
+		return false, err
+	}
+	fmt.Printf("[Media] ✓ 完成 (trace_id=%s, provider=%s, bytes=%d)\n", traceID, provider.Name, len(respData))
+	return true, nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// runMediaForward 通过 forwardMediaRequest 转发一次请求，返回上游收到的 Content-Type 与请求体
+func runMediaForward(t *testing.T, endpoint, mediaKind, contentType string, body []byte, reply string) (string, []byte, *ReqeustLog) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	var gotType string
+	var gotBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(upstream.Close)
+
+	prs := &ProviderRelayService{logWriteQueue: make(chan *ReqeustLog, 1)}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	provider := Provider{
+		Name:         "p",
+		APIURL:       upstream.URL,
+		APIKey:       "k",
+		ModelMapping: map[string]string{"whisper-1": "whisper-large-v3", "dall-e-3": "gpt-image-1"},
+	}
+	req := parseMediaRequest(contentType, body)
+	ok, err := prs.forwardMediaRequest(c, "codex", provider, endpoint, mediaKind, req, body)
+	if !ok || err != nil {
+		t.Fatalf("forwardMediaRequest = %v, %v", ok, err)
+	}
+	if w.Body.String() != reply {
+		t.Fatalf("client got %s", w.Body.String())
+	}
+	return gotType, gotBody, <-prs.logWriteQueue
+}
+
+func TestForwardMediaRequestMapsJSONModel(t *testing.T) {
+	body := `{"model":"dall-e-3","prompt":"a cat","n":2,"size":"1024x1024"}`
+	_, got, log := runMediaForward(t, "/v1/images/generations", mediaKindImage, "application/json", []byte(body), `{"data":[{"url":"a"},{"url":"b"}]}`)
+	if gjson.GetBytes(got, "model").String() != "gpt-image-1" || gjson.GetBytes(got, "prompt").String() != "a cat" {
+		t.Fatalf("upstream body = %s", got)
+	}
+	if log.Model != "gpt-image-1" {
+		t.Fatalf("logged model = %s", log.Model)
+	}
+}
+
+func TestForwardMediaRequestMapsMultipartModel(t *testing.T) {
+	audio := []byte("RIFF\x00\x01binary--audio\r\n--not-a-boundary")
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("model", "whisper-1")
+	file, _ := writer.CreateFormFile("file", "speech.wav")
+	file.Write(audio)
+	writer.WriteField("response_format", "verbose_json")
+	writer.Close()
+
+	gotType, got, log := runMediaForward(t, "/v1/audio/transcriptions", mediaKindTranscription,
+		writer.FormDataContentType(), body.Bytes(), `{"text":"hi","duration":3.5}`)
+	if gotType != writer.FormDataContentType() {
+		t.Fatalf("upstream content type = %s", gotType)
+	}
+	if log.Model != "whisper-large-v3" {
+		t.Fatalf("logged model = %s", log.Model)
+	}
+
+	_, params, _ := mime.ParseMediaType(gotType)
+	reader := multipart.NewReader(bytes.NewReader(got), params["boundary"])
+	fields := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("upstream multipart: %v", err)
+		}
+		data, _ := io.ReadAll(part)
+		fields[part.FormName()] = string(data)
+		if part.FormName() == "file" && part.FileName() != "speech.wav" {
+			t.Fatalf("file name = %s", part.FileName())
+		}
+	}
+	if fields["model"] != "whisper-large-v3" || fields["file"] != string(audio) || fields["response_format"] != "verbose_json" {
+		t.Fatalf("upstream fields = %q", fields)
+	}
+}
+
+func TestReplaceMultipartFieldErrors(t *testing.T) {
+	if _, err := replaceMultipartField("multipart/form-data", []byte("x"), "model", "m"); err == nil {
+		t.Fatal("expected error for missing boundary")
+	}
+	if _, err := replaceMultipartField("multipart/form-data; boundary=b", []byte("--b\r\nbroken"), "model", "m"); err == nil || strings.Contains(err.Error(), "boundary missing") {
+		t.Fatalf("truncated body err = %v", err)
+	}
+}
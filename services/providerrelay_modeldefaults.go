@@ -0,0 +1,288 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 模型默认参数：客户端未指定 temperature / top_p / max_tokens / reasoning effort 时按规则注入，
+// 让要求 max_tokens 的严格 provider 不再拒绝 Claude Code 等客户端的请求，也便于团队统一生成参数。
+// 规则按平台 / 模型（支持 * 通配，匹配客户端请求的模型或映射后的模型）/ provider 匹配，
+// 每个参数取匹配规则中最具体的一条（provider > 精确模型 > 通配模型 > 平台），同样具体时取靠前的规则。
+// 注入发生在模型映射之后、token 上限检查之前；客户端已指定的字段保持不变
+
+// 推理强度
+const (
+	ReasoningEffortLow    = "low"
+	ReasoningEffortMedium = "medium"
+	ReasoningEffortHigh   = "high"
+)
+
+// ModelDefaultParams 注入的参数，未设置的项不注入
+type ModelDefaultParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	// low / medium / high，仅 Chat Completions（reasoning_effort）与 Responses（reasoning.effort）
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+}
+
+// ModelDefaultRule 一条默认参数规则，匹配条件为空表示不限制
+type ModelDefaultRule struct {
+	Platform string `json:"platform,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	ModelDefaultParams
+}
+
+// ModelDefaultsConfig 模型默认参数表
+type ModelDefaultsConfig struct {
+	Rules []ModelDefaultRule `json:"rules"`
+}
+
+// modelDefaultsStore 模型默认参数表
+type modelDefaultsStore struct {
+	mu     sync.RWMutex
+	config ModelDefaultsConfig
+}
+
+// Validate 检查参数取值
+func (cfg ModelDefaultsConfig) Validate() error {
+	for i, rule := range cfg.Rules {
+		if rule.Temperature != nil && (*rule.Temperature < 0 || *rule.Temperature > 2) {
+			return fmt.Errorf("rule %d: temperature must be between 0 and 2", i+1)
+		}
+		if rule.TopP != nil && (*rule.TopP <= 0 || *rule.TopP > 1) {
+			return fmt.Errorf("rule %d: top_p must be in (0, 1]", i+1)
+		}
+		if rule.MaxTokens < 0 {
+			return fmt.Errorf("rule %d: max_tokens must not be negative", i+1)
+		}
+		switch rule.ReasoningEffort {
+		case "", ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+		default:
+			return fmt.Errorf("rule %d: invalid reasoning effort %q, want low, medium or high", i+1, rule.ReasoningEffort)
+		}
+	}
+	return nil
+}
+
+// modelDefaultsConfigPath 模型默认参数配置文件
+func modelDefaultsConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "model-defaults.json"), nil
+}
+
+// GetModelDefaults 获取模型默认参数表
+func (prs *ProviderRelayService) GetModelDefaults() ModelDefaultsConfig {
+	prs.modelDefaults.mu.RLock()
+	defer prs.modelDefaults.mu.RUnlock()
+	cfg := prs.modelDefaults.config
+	if cfg.Rules == nil {
+		cfg.Rules = []ModelDefaultRule{}
+	}
+	return cfg
+}
+
+// SetModelDefaults 更新模型默认参数表，持久化到 model-defaults.json
+func (prs *ProviderRelayService) SetModelDefaults(cfg ModelDefaultsConfig) error {
+	for i := range cfg.Rules {
+		cfg.Rules[i].Platform = strings.ToLower(strings.TrimSpace(cfg.Rules[i].Platform))
+		cfg.Rules[i].Model = strings.TrimSpace(cfg.Rules[i].Model)
+		cfg.Rules[i].Provider = strings.TrimSpace(cfg.Rules[i].Provider)
+		cfg.Rules[i].ReasoningEffort = strings.ToLower(strings.TrimSpace(cfg.Rules[i].ReasoningEffort))
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	path, err := modelDefaultsConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.modelDefaults.mu.Lock()
+	prs.modelDefaults.config = cfg
+	prs.modelDefaults.mu.Unlock()
+	return nil
+}
+
+// loadModelDefaults 启动时从 model-defaults.json 恢复
+func (prs *ProviderRelayService) loadModelDefaults() {
+	path, err := modelDefaultsConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cfg ModelDefaultsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("[ModelDefaults] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("[ModelDefaults] 配置无效，已停用: %v\n", err)
+		return
+	}
+	prs.modelDefaults.mu.Lock()
+	prs.modelDefaults.config = cfg
+	prs.modelDefaults.mu.Unlock()
+}
+
+// specificity 规则匹配本次请求时的具体程度，不匹配时返回 -1
+func (rule ModelDefaultRule) specificity(kind, provider string, models ...string) int {
+	score := 0
+	if rule.Platform != "" {
+		if rule.Platform != kind {
+			return -1
+		}
+		score++
+	}
+	if rule.Model != "" {
+		matched := -1
+		for _, model := range models {
+			switch {
+			case model == "":
+			case rule.Model == model:
+				matched = 4
+			case strings.Contains(rule.Model, "*") && matchWildcard(rule.Model, model) && matched < 2:
+				matched = 2
+			}
+		}
+		if matched < 0 {
+			return -1
+		}
+		score += matched
+	}
+	if rule.Provider != "" {
+		if rule.Provider != provider {
+			return -1
+		}
+		score += 8
+	}
+	return score
+}
+
+// resolve 合并匹配规则：每个参数取最具体的规则
+func (cfg ModelDefaultsConfig) resolve(kind, provider string, models ...string) ModelDefaultParams {
+	var params ModelDefaultParams
+	best := [4]int{-1, -1, -1, -1}
+	for _, rule := range cfg.Rules {
+		score := rule.specificity(kind, provider, models...)
+		if score < 0 {
+			continue
+		}
+		if rule.Temperature != nil && score > best[0] {
+			params.Temperature, best[0] = rule.Temperature, score
+		}
+		if rule.TopP != nil && score > best[1] {
+			params.TopP, best[1] = rule.TopP, score
+		}
+		if rule.MaxTokens > 0 && score > best[2] {
+			params.MaxTokens, best[2] = rule.MaxTokens, score
+		}
+		if rule.ReasoningEffort != "" && score > best[3] {
+			params.ReasoningEffort, best[3] = rule.ReasoningEffort, score
+		}
+	}
+	return params
+}
+
+// applyModelDefaults 为本次尝试的请求体补上客户端未指定的默认参数
+func (prs *ProviderRelayService) applyModelDefaults(kind string, provider Provider, requestedModel, effectiveModel string, body []byte) []byte {
+	prs.modelDefaults.mu.RLock()
+	cfg := prs.modelDefaults.config
+	prs.modelDefaults.mu.RUnlock()
+	if len(cfg.Rules) == 0 || len(body) == 0 || !gjson.ValidBytes(body) {
+		return body
+	}
+	params := cfg.resolve(kind, provider.Name, requestedModel, effectiveModel)
+	return injectDefaultParams(kind, body, params)
+}
+
+// injectDefaultParams 按请求格式写入缺失的参数
+func injectDefaultParams(kind string, body []byte, params ModelDefaultParams) []byte {
+	field, _ := conversationItems(body)
+	gemini := field == "contents"
+	responses := field == "input" || (field == "" && gjson.GetBytes(body, "input").Exists())
+	anthropic := kind == "claude" && !gemini && !responses
+
+	setMissing := func(path string, value any) {
+		if gjson.GetBytes(body, path).Exists() {
+			return
+		}
+		if updated, err := sjson.SetBytes(body, path, value); err == nil {
+			body = updated
+		}
+	}
+
+	// Anthropic extended thinking 不允许修改 temperature / top_p
+	samplingAllowed := !(anthropic && gjson.GetBytes(body, "thinking.type").String() == "enabled")
+	if params.Temperature != nil && samplingAllowed {
+		if gemini {
+			setMissing("generationConfig.temperature", *params.Temperature)
+		} else {
+			setMissing("temperature", *params.Temperature)
+		}
+	}
+	if params.TopP != nil && samplingAllowed {
+		if gemini {
+			setMissing("generationConfig.topP", *params.TopP)
+		} else {
+			setMissing("top_p", *params.TopP)
+		}
+	}
+	if params.MaxTokens > 0 {
+		path, _ := requestedOutputTokens(body)
+		setMissing(path, params.MaxTokens)
+	}
+	if params.ReasoningEffort != "" && !anthropic && !gemini {
+		if responses {
+			setMissing("reasoning.effort", params.ReasoningEffort)
+		} else {
+			setMissing("reasoning_effort", params.ReasoningEffort)
+		}
+	}
+	return body
+}
+
+// ===== 管理接口 =====
+
+func (prs *ProviderRelayService) adminGetModelDefaultsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.GetModelDefaults())
+}
+
+func (prs *ProviderRelayService) adminUpdateModelDefaultsHandler(c *gin.Context) {
+	var cfg ModelDefaultsConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := prs.SetModelDefaults(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prs.GetModelDefaults())
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestModelDefaultsInjection(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	low, high := 0.2, 0.7
+	topP := 0.9
+	prs := &ProviderRelayService{}
+	err := prs.SetModelDefaults(ModelDefaultsConfig{Rules: []ModelDefaultRule{
+		{Platform: "claude", ModelDefaultParams: ModelDefaultParams{Temperature: &high, MaxTokens: 4096}},
+		{Model: "deepseek-*", ModelDefaultParams: ModelDefaultParams{Temperature: &low, TopP: &topP}},
+		{Provider: "strict", ModelDefaultParams: ModelDefaultParams{MaxTokens: 8192}},
+		{Platform: "codex", ModelDefaultParams: ModelDefaultParams{ReasoningEffort: "HIGH"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 平台规则注入缺失字段，客户端已指定的字段保持不变
+	body := prs.applyModelDefaults("claude", Provider{Name: "p"}, "claude-sonnet-4", "claude-sonnet-4",
+		[]byte(`{"model":"claude-sonnet-4","temperature":1,"messages":[{"role":"user","content":"hi"}]}`))
+	if gjson.GetBytes(body, "temperature").Float() != 1 || gjson.GetBytes(body, "max_tokens").Int() != 4096 {
+		t.Fatalf("platform defaults: %s", body)
+	}
+
+	// 映射后的模型匹配通配规则，模型规则优先于平台规则；provider 规则最优先
+	body = prs.applyModelDefaults("claude", Provider{Name: "strict"}, "claude-sonnet-4", "deepseek-chat",
+		[]byte(`{"model":"deepseek-chat","messages":[]}`))
+	if gjson.GetBytes(body, "temperature").Float() != low || gjson.GetBytes(body, "top_p").Float() != topP || gjson.GetBytes(body, "max_tokens").Int() != 8192 {
+		t.Fatalf("specific defaults: %s", body)
+	}
+
+	// extended thinking 时不注入采样参数
+	body = prs.applyModelDefaults("claude", Provider{Name: "p"}, "claude-sonnet-4", "claude-sonnet-4",
+		[]byte(`{"thinking":{"type":"enabled","budget_tokens":1024},"messages":[]}`))
+	if gjson.GetBytes(body, "temperature").Exists() || gjson.GetBytes(body, "max_tokens").Int() != 4096 {
+		t.Fatalf("thinking defaults: %s", body)
+	}
+
+	// Responses 与 Chat Completions 的推理强度字段
+	body = prs.applyModelDefaults("codex", Provider{Name: "p"}, "gpt-5", "gpt-5", []byte(`{"input":[{"role":"user","content":"hi"}]}`))
+	if gjson.GetBytes(body, "reasoning.effort").String() != "high" || gjson.GetBytes(body, "max_tokens").Exists() {
+		t.Fatalf("responses defaults: %s", body)
+	}
+	body = prs.applyModelDefaults("codex", Provider{Name: "p"}, "gpt-5", "gpt-5", []byte(`{"messages":[],"reasoning_effort":"low"}`))
+	if gjson.GetBytes(body, "reasoning_effort").String() != "low" {
+		t.Fatalf("chat defaults: %s", body)
+	}
+
+	// Gemini 写入 generationConfig
+	body = prs.applyModelDefaults("gemini-cli", Provider{Name: "strict"}, "gemini-2.5-pro", "", []byte(`{"contents":[]}`))
+	if gjson.GetBytes(body, "generationConfig.maxOutputTokens").Int() != 8192 || gjson.GetBytes(body, "max_tokens").Exists() {
+		t.Fatalf("gemini defaults: %s", body)
+	}
+
+	// 持久化后可恢复；非法取值被拒绝
+	restored := &ProviderRelayService{}
+	restored.loadModelDefaults()
+	if rules := restored.GetModelDefaults().Rules; len(rules) != 4 || rules[3].ReasoningEffort != "high" {
+		t.Fatalf("restored rules = %+v", rules)
+	}
+	bad := 3.0
+	if err := prs.SetModelDefaults(ModelDefaultsConfig{Rules: []ModelDefaultRule{{ModelDefaultParams: ModelDefaultParams{Temperature: &bad}}}}); err == nil {
+		t.Fatal("expected invalid temperature to be rejected")
+	}
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 双向 TLS：零信任环境下转发服务以 HTTPS 监听并校验客户端证书，
+// 证书的 CN / SAN 映射为用户标识，用于请求日志归属、按身份限流与管理 API 授权。
+// 证书文件在转发服务启动时加载，身份映射与限额修改后立即生效
+
+const (
+	MTLSClientAuthOff      = "off"      // 不要求客户端证书
+	MTLSClientAuthOptional = "optional" // 客户端提供证书时校验，未提供也放行
+	MTLSClientAuthRequire  = "require"  // 握手时必须提供受信任的客户端证书
+
+	// ctxKeyClientIdentity 客户端证书映射出的用户标识
+	ctxKeyClientIdentity = "codeswitch.client_identity"
+)
+
+// MTLSConfig 转发服务的 TLS 与客户端证书认证配置；未设置证书时仍以 HTTP 监听
+type MTLSConfig struct {
+	CertFile     string `json:"certFile,omitempty"`
+	KeyFile      string `json:"keyFile,omitempty"`
+	ClientCAFile string `json:"clientCAFile,omitempty"` // 签发客户端证书的 CA（PEM，可包含多个）
+	ClientAuth   string `json:"clientAuth,omitempty"`   // off / optional / require
+	// 证书 CN 或 SAN（邮箱 / 域名 / URI）到用户标识的映射；未命中时使用 CN，其次第一个 SAN
+	IdentityMap map[string]string `json:"identityMap,omitempty"`
+	// 这些用户标识无需管理令牌即可访问管理 API
+	AdminIdentities []string `json:"adminIdentities,omitempty"`
+	// 每个证书身份每分钟请求数上限，0 不限制
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+}
+
+// identityWindow 单个证书身份当前分钟窗口的请求数
+type identityWindow struct {
+	start    time.Time
+	requests int
+}
+
+// mtlsStore TLS 配置与各证书身份的请求计数
+type mtlsStore struct {
+	mu        sync.RWMutex
+	config    MTLSConfig
+	tlsConfig *tls.Config
+
+	windowMu sync.Mutex
+	windows  map[string]*identityWindow
+}
+
+// Validate 检查配置取值，不读取证书文件
+func (cfg MTLSConfig) Validate() error {
+	switch cfg.clientAuth() {
+	case MTLSClientAuthOff, MTLSClientAuthOptional, MTLSClientAuthRequire:
+	default:
+		return fmt.Errorf("invalid TLS client auth mode %q (want off, optional or require)", cfg.ClientAuth)
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("TLS certificate and key must be set together")
+	}
+	if cfg.clientAuth() != MTLSClientAuthOff {
+		if cfg.CertFile == "" {
+			return fmt.Errorf("client certificate auth requires a TLS certificate and key")
+		}
+		if cfg.ClientCAFile == "" {
+			return fmt.Errorf("client certificate auth requires a client CA file")
+		}
+	}
+	if cfg.RequestsPerMinute < 0 {
+		return fmt.Errorf("per-identity request limit must not be negative")
+	}
+	return nil
+}
+
+func (cfg MTLSConfig) clientAuth() string {
+	mode := strings.ToLower(strings.TrimSpace(cfg.ClientAuth))
+	if mode == "" {
+		return MTLSClientAuthOff
+	}
+	return mode
+}
+
+// buildTLSConfig 加载服务端证书与客户端 CA；未设置证书时返回 nil
+func (cfg MTLSConfig) buildTLSConfig() (*tls.Config, error) {
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.clientAuth() == MTLSClientAuthOff {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA file %s contains no PEM certificates", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.clientAuth() == MTLSClientAuthRequire {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// SetMTLSConfig 更新 TLS 与客户端证书认证配置；证书与监听方式在转发服务下次启动时生效
+func (prs *ProviderRelayService) SetMTLSConfig(cfg MTLSConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	tlsConfig, err := cfg.buildTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg.ClientAuth = cfg.clientAuth()
+	prs.mtls.mu.Lock()
+	prs.mtls.config = cfg
+	prs.mtls.tlsConfig = tlsConfig
+	prs.mtls.mu.Unlock()
+	return nil
+}
+
+// GetMTLSConfig 获取 TLS 与客户端证书认证配置
+func (prs *ProviderRelayService) GetMTLSConfig() MTLSConfig {
+	prs.mtls.mu.RLock()
+	defer prs.mtls.mu.RUnlock()
+	return prs.mtls.config
+}
+
+// serverTLSConfig 返回监听使用的 TLS 配置，未启用 TLS 时为 nil
+func (prs *ProviderRelayService) serverTLSConfig() *tls.Config {
+	prs.mtls.mu.RLock()
+	defer prs.mtls.mu.RUnlock()
+	if prs.mtls.tlsConfig == nil {
+		return nil
+	}
+	return prs.mtls.tlsConfig.Clone()
+}
+
+// certIdentityCandidates 证书中可用于识别身份的名称：CN、邮箱、域名、URI
+func certIdentityCandidates(cert *x509.Certificate) []string {
+	names := make([]string, 0, 1+len(cert.EmailAddresses)+len(cert.DNSNames)+len(cert.URIs))
+	if cn := strings.TrimSpace(cert.Subject.CommonName); cn != "" {
+		names = append(names, cn)
+	}
+	names = append(names, cert.EmailAddresses...)
+	names = append(names, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+// certIdentity 按映射表把证书名称转换为用户标识；未命中时使用第一个名称
+func certIdentity(cert *x509.Certificate, mapping map[string]string) string {
+	names := certIdentityCandidates(cert)
+	for _, name := range names {
+		if identity := strings.TrimSpace(mapping[name]); identity != "" {
+			return identity
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// clientIdentity 返回经过校验的客户端证书对应的用户标识，没有时为空
+func clientIdentity(c *gin.Context) string {
+	return c.GetString(ctxKeyClientIdentity)
+}
+
+// requestUserID 请求日志归属的用户标识：优先客户端证书，其次 X-User-ID 请求头
+func requestUserID(c *gin.Context) string {
+	if identity := clientIdentity(c); identity != "" {
+		return identity
+	}
+	return c.GetHeader("X-User-ID")
+}
+
+// isAdminIdentity 客户端证书身份是否被授权访问管理 API
+func (prs *ProviderRelayService) isAdminIdentity(c *gin.Context) bool {
+	identity := clientIdentity(c)
+	if identity == "" {
+		return false
+	}
+	prs.mtls.mu.RLock()
+	defer prs.mtls.mu.RUnlock()
+	for _, admin := range prs.mtls.config.AdminIdentities {
+		if admin == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// allowIdentityRequest 按证书身份的每分钟请求数限制，返回是否放行与需要等待的时间
+func (prs *ProviderRelayService) allowIdentityRequest(identity string, limit int, now time.Time) (bool, time.Duration) {
+	store := &prs.mtls
+	store.windowMu.Lock()
+	defer store.windowMu.Unlock()
+	if store.windows == nil {
+		store.windows = make(map[string]*identityWindow)
+	}
+	window := store.windows[identity]
+	if window == nil || now.Sub(window.start) >= time.Minute {
+		// 顺带清理过期窗口，身份数量有限但仍避免无限增长
+		if window == nil && len(store.windows) > 10000 {
+			for key, w := range store.windows {
+				if now.Sub(w.start) >= time.Minute {
+					delete(store.windows, key)
+				}
+			}
+		}
+		window = &identityWindow{start: now}
+		store.windows[identity] = window
+	}
+	if window.requests >= limit {
+		return false, window.start.Add(time.Minute).Sub(now)
+	}
+	window.requests++
+	return true, 0
+}
+
+// mtlsMiddleware 从已校验的客户端证书识别用户标识，并执行按身份的请求数限制
+func (prs *ProviderRelayService) mtlsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tlsState := c.Request.TLS
+		if tlsState == nil || len(tlsState.VerifiedChains) == 0 || len(tlsState.PeerCertificates) == 0 {
+			c.Next()
+			return
+		}
+		prs.mtls.mu.RLock()
+		mapping := prs.mtls.config.IdentityMap
+		limit := prs.mtls.config.RequestsPerMinute
+		prs.mtls.mu.RUnlock()
+
+		identity := certIdentity(tlsState.PeerCertificates[0], mapping)
+		if identity == "" {
+			c.Next()
+			return
+		}
+		c.Set(ctxKeyClientIdentity, identity)
+		if limit > 0 {
+			if ok, wait := prs.allowIdentityRequest(identity, limit, time.Now()); !ok {
+				abortWithRetryAfter(c, http.StatusTooManyRequests, wait, "request rate limit exceeded for client certificate "+identity)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// ===== 管理接口 =====
+
+func (prs *ProviderRelayService) adminGetMTLSHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"config": prs.GetMTLSConfig(), "identity": clientIdentity(c)})
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testCert 测试用证书与私钥
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (tc *testCert) writePEM(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	keyDER, err := x509.MarshalECPrivateKey(tc.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (tc *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.der}, PrivateKey: tc.key}
+}
+
+func TestMTLSConfigValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  MTLSConfig
+		ok   bool
+	}{
+		{"disabled", MTLSConfig{}, true},
+		{"tls only", MTLSConfig{CertFile: "a.crt", KeyFile: "a.key"}, true},
+		{"require", MTLSConfig{CertFile: "a.crt", KeyFile: "a.key", ClientCAFile: "ca.crt", ClientAuth: "Require"}, true},
+		{"cert without key", MTLSConfig{CertFile: "a.crt"}, false},
+		{"client auth without cert", MTLSConfig{ClientCAFile: "ca.crt", ClientAuth: MTLSClientAuthOptional}, false},
+		{"client auth without CA", MTLSConfig{CertFile: "a.crt", KeyFile: "a.key", ClientAuth: MTLSClientAuthRequire}, false},
+		{"unknown mode", MTLSConfig{CertFile: "a.crt", KeyFile: "a.key", ClientCAFile: "ca.crt", ClientAuth: "always"}, false},
+		{"negative limit", MTLSConfig{RequestsPerMinute: -1}, false},
+	}
+	for _, tc := range cases {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestCertIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://corp/ci")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice"},
+		EmailAddresses: []string{"alice@example.com"},
+		DNSNames:       []string{"build-01.example.com"},
+		URIs:           []*url.URL{spiffe},
+	}
+	cases := []struct {
+		name    string
+		cert    *x509.Certificate
+		mapping map[string]string
+		want    string
+	}{
+		{"common name", cert, nil, "alice"},
+		{"mapped SAN", cert, map[string]string{"spiffe://corp/ci": "ci-bot"}, "ci-bot"},
+		{"mapped CN wins", cert, map[string]string{"alice": "user-1", "alice@example.com": "user-2"}, "user-1"},
+		{"unmapped falls back to CN", cert, map[string]string{"bob": "user-3"}, "alice"},
+		{"SAN only", &x509.Certificate{DNSNames: []string{"svc.internal"}}, nil, "svc.internal"},
+		{"no names", &x509.Certificate{}, nil, ""},
+	}
+	for _, tc := range cases {
+		if got := certIdentity(tc.cert, tc.mapping); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMTLSClientIdentity(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	server := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "relay"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	client := newTestCert(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice"},
+		EmailAddresses: []string{"alice@example.com"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	caFile, _ := ca.writePEM(t, dir, "ca")
+	certFile, keyFile := server.writePEM(t, dir, "server")
+
+	prs := &ProviderRelayService{}
+	err := prs.SetMTLSConfig(MTLSConfig{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		ClientCAFile:      caFile,
+		ClientAuth:        MTLSClientAuthOptional,
+		IdentityMap:       map[string]string{"alice@example.com": "user-alice"},
+		AdminIdentities:   []string{"user-alice"},
+		RequestsPerMinute: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(prs.mtlsMiddleware())
+	router.GET("/whoami", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user": requestUserID(c), "admin": prs.isAdminIdentity(c)})
+	})
+	ts := httptest.NewUnstartedServer(router)
+	ts.TLS = prs.serverTLSConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs []tls.Certificate, header string) (int, string) {
+		t.Helper()
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/whoami", nil)
+		if header != "" {
+			req.Header.Set("X-User-ID", header)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		buf := make([]byte, 256)
+		n, _ := resp.Body.Read(buf)
+		return resp.StatusCode, string(buf[:n])
+	}
+
+	// 证书身份优先于请求头，且被授权访问管理 API
+	if code, body := get([]tls.Certificate{client.tlsCertificate()}, "spoofed"); code != http.StatusOK || body != `{"admin":true,"user":"user-alice"}` {
+		t.Fatalf("with certificate: %d %s", code, body)
+	}
+	// optional 模式下未提供证书时使用请求头
+	if code, body := get(nil, "bob"); code != http.StatusOK || body != `{"admin":false,"user":"bob"}` {
+		t.Fatalf("without certificate: %d %s", code, body)
+	}
+	// 按证书身份限流，不影响无证书的请求
+	get([]tls.Certificate{client.tlsCertificate()}, "")
+	if code, _ := get([]tls.Certificate{client.tlsCertificate()}, ""); code != http.StatusTooManyRequests {
+		t.Fatalf("over identity limit: %d", code)
+	}
+	if code, _ := get(nil, ""); code != http.StatusOK {
+		t.Fatalf("anonymous after identity limit: %d", code)
+	}
+}
+
+func TestMTLSRequireRejectsMissingCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	server := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "relay"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	caFile, _ := ca.writePEM(t, dir, "ca")
+	certFile, keyFile := server.writePEM(t, dir, "server")
+
+	prs := &ProviderRelayService{}
+	if err := prs.SetMTLSConfig(MTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: MTLSClientAuthRequire}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = prs.serverTLSConfig()
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if resp, err := httpClient.Get(ts.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("request without client certificate succeeded")
+	}
+
+	if err := prs.SetMTLSConfig(MTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile + ".missing", ClientAuth: MTLSClientAuthRequire}); err == nil {
+		t.Fatal("missing client CA accepted")
+	}
+}
@@ -0,0 +1,541 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 响应规范化：不同上游的 finish_reason 取值与错误体结构各不相同（Gemini 的 STOP / SAFETY、
+// 智谱的 sensitive、各家网关的 {"msg": ...} 等），故障转移到另一家后客户端可能无法解析。
+// 这里把结束原因与错误体统一映射为客户端所用协议（Anthropic / OpenAI / Gemini）的标准值
+
+// 错误体格式
+const (
+	errorSchemaAnthropic = "anthropic"
+	errorSchemaOpenAI    = "openai"
+	errorSchemaGoogle    = "google"
+)
+
+// errorSchemaFor 客户端期望的错误体格式
+func errorSchemaFor(kind, endpoint string) string {
+	switch {
+	case kind == "gemini-cli":
+		return errorSchemaGoogle
+	case strings.Contains(endpoint, "/messages"):
+		return errorSchemaAnthropic
+	}
+	return errorSchemaOpenAI
+}
+
+// upstreamStatusError 上游返回的非 2xx 响应；保留状态码与原始错误体供规范化使用
+type upstreamStatusError struct {
+	Status int
+	Body   []byte
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream status %d: %s", e.Status, string(e.Body))
+}
+
+// ===== finish_reason =====
+
+// chatFinishReasons 各家结束原因（小写）→ Chat Completions 标准值
+var chatFinishReasons = map[string]string{
+	// 正常结束
+	"stop":          "stop",
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"pause_turn":    "stop",
+	"eos":           "stop",
+	"eos_token":     "stop",
+	"complete":      "stop",
+	"completed":     "stop",
+	"finish":        "stop",
+	"finished":      "stop",
+	// 达到长度上限或生成被中断
+	"length":                        "length",
+	"max_tokens":                    "length",
+	"max_output_tokens":             "length",
+	"model_length":                  "length",
+	"model_context_window_exceeded": "length",
+	"insufficient_system_resource":  "length",
+	"network_error":                 "length",
+	// 工具调用
+	"tool_calls":    "tool_calls",
+	"tool_call":     "tool_calls",
+	"tool_use":      "tool_calls",
+	"function_call": "function_call",
+	// 内容过滤
+	"content_filter":     "content_filter",
+	"content_filtered":   "content_filter",
+	"refusal":            "content_filter",
+	"sensitive":          "content_filter",
+	"safety":             "content_filter",
+	"recitation":         "content_filter",
+	"blocklist":          "content_filter",
+	"prohibited_content": "content_filter",
+	"spii":               "content_filter",
+	"image_safety":       "content_filter",
+}
+
+// anthropicStopReasons Anthropic 标准 stop_reason，原样保留
+var anthropicStopReasons = map[string]bool{
+	"end_turn":                      true,
+	"stop_sequence":                 true,
+	"max_tokens":                    true,
+	"tool_use":                      true,
+	"pause_turn":                    true,
+	"refusal":                       true,
+	"model_context_window_exceeded": true,
+}
+
+// chatToAnthropicStopReasons Chat Completions 标准值 → Anthropic stop_reason
+var chatToAnthropicStopReasons = map[string]string{
+	"stop":           "end_turn",
+	"length":         "max_tokens",
+	"tool_calls":     "tool_use",
+	"function_call":  "tool_use",
+	"content_filter": "refusal",
+}
+
+// normalizeChatFinishReason 未知取值按正常结束处理
+func normalizeChatFinishReason(reason string) string {
+	if mapped, ok := chatFinishReasons[strings.ToLower(reason)]; ok {
+		return mapped
+	}
+	return "stop"
+}
+
+// normalizeAnthropicStopReason 未知取值按 end_turn 处理
+func normalizeAnthropicStopReason(reason string) string {
+	if anthropicStopReasons[reason] {
+		return reason
+	}
+	return chatToAnthropicStopReasons[normalizeChatFinishReason(reason)]
+}
+
+// ===== 错误体 =====
+
+// upstreamErrorInfo 从上游错误体中提取的信息
+type upstreamErrorInfo struct {
+	Status  int    // HTTP 状态码；流式响应中的错误按错误类型推断
+	Message string // 错误描述
+	Type    string // 上游的错误类型（error.type 或 Google 的 error.status）
+	Code    string // 上游的错误码
+}
+
+// anthropicErrorTypes HTTP 状态码 → Anthropic 错误类型
+var anthropicErrorTypes = map[int]string{
+	http.StatusBadRequest:            "invalid_request_error",
+	http.StatusUnauthorized:          "authentication_error",
+	http.StatusPaymentRequired:       "billing_error",
+	http.StatusForbidden:             "permission_error",
+	http.StatusNotFound:              "not_found_error",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusTooManyRequests:       "rate_limit_error",
+	http.StatusInternalServerError:   "api_error",
+	http.StatusServiceUnavailable:    "overloaded_error",
+	http.StatusGatewayTimeout:        "timeout_error",
+	529:                              "overloaded_error",
+}
+
+// openAIErrorTypes HTTP 状态码 → OpenAI 错误类型
+var openAIErrorTypes = map[int]string{
+	http.StatusBadRequest:            "invalid_request_error",
+	http.StatusUnauthorized:          "authentication_error",
+	http.StatusPaymentRequired:       "insufficient_quota",
+	http.StatusForbidden:             "permission_error",
+	http.StatusNotFound:              "invalid_request_error",
+	http.StatusRequestEntityTooLarge: "invalid_request_error",
+	http.StatusUnprocessableEntity:   "invalid_request_error",
+	http.StatusTooManyRequests:       "rate_limit_error",
+	http.StatusInternalServerError:   "server_error",
+	http.StatusServiceUnavailable:    "server_error",
+	http.StatusGatewayTimeout:        "timeout_error",
+}
+
+// googleErrorStatuses HTTP 状态码 → Google API 错误状态
+var googleErrorStatuses = map[int]string{
+	http.StatusBadRequest:          "INVALID_ARGUMENT",
+	http.StatusUnauthorized:        "UNAUTHENTICATED",
+	http.StatusForbidden:           "PERMISSION_DENIED",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusConflict:            "ABORTED",
+	http.StatusTooManyRequests:     "RESOURCE_EXHAUSTED",
+	499:                            "CANCELLED",
+	http.StatusInternalServerError: "INTERNAL",
+	http.StatusNotImplemented:      "UNIMPLEMENTED",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+	http.StatusGatewayTimeout:      "DEADLINE_EXCEEDED",
+}
+
+// errorTypeStatuses 上游错误类型（小写）→ HTTP 状态码，用于没有状态码的流式错误
+var errorTypeStatuses = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"invalid_argument":      http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"unauthenticated":       http.StatusUnauthorized,
+	"billing_error":         http.StatusPaymentRequired,
+	"insufficient_quota":    http.StatusPaymentRequired,
+	"permission_error":      http.StatusForbidden,
+	"permission_denied":     http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"not_found":             http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"rate_limit_exceeded":   http.StatusTooManyRequests,
+	"resource_exhausted":    http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"server_error":          http.StatusInternalServerError,
+	"internal":              http.StatusInternalServerError,
+	"overloaded_error":      529,
+	"unavailable":           http.StatusServiceUnavailable,
+	"timeout_error":         http.StatusGatewayTimeout,
+	"deadline_exceeded":     http.StatusGatewayTimeout,
+}
+
+// maxErrorMessageLength 非 JSON 错误体（HTML 错误页等）截取的最大长度
+const maxErrorMessageLength = 500
+
+// parseUpstreamError 解析各家的错误体：OpenAI / Anthropic / Google 的 error 对象、
+// {"error": "..."}、{"message" / "msg" / "detail": ...}、MiniMax 的 base_resp、
+// {"errors": [...]} 以及纯文本；status 为 0 时按错误类型推断
+func parseUpstreamError(status int, body []byte) upstreamErrorInfo {
+	info := upstreamErrorInfo{Status: status}
+	text := strings.TrimSpace(string(body))
+	root := gjson.Parse(text)
+	if root.IsArray() {
+		// Gemini 部分接口以数组返回错误
+		root = root.Get("0")
+	}
+
+	if gjson.Valid(text) && root.IsObject() {
+		errField := root.Get("error")
+		switch {
+		case errField.IsObject():
+			info.Message = firstErrorString(errField, "message", "msg", "detail")
+			info.Type = firstErrorString(errField, "type", "status")
+			info.Code = errorCodeString(errField.Get("code"))
+			if info.Status == 0 && errField.Get("code").Type == gjson.Number {
+				// Google 的 error.code 为 HTTP 状态码
+				info.Status = int(errField.Get("code").Int())
+			}
+		case errField.Type == gjson.String:
+			info.Message = errField.String()
+		}
+		if info.Message == "" {
+			info.Message = firstErrorString(root, "message", "msg", "error_msg", "errorMessage",
+				"detail", "detail.0.msg", "errors.0.message", "base_resp.status_msg")
+		}
+		if info.Type == "" && root.Get("type").String() != "error" {
+			info.Type = root.Get("type").String()
+		}
+		if info.Code == "" {
+			for _, path := range []string{"code", "error_code", "errorCode", "base_resp.status_code"} {
+				if code := errorCodeString(root.Get(path)); code != "" {
+					info.Code = code
+					break
+				}
+			}
+		}
+	} else if text != "" && !strings.HasPrefix(text, "<") {
+		// 纯文本错误；HTML 错误页只保留状态码描述
+		info.Message = truncateErrorMessage(text)
+	}
+
+	if info.Status < http.StatusBadRequest {
+		info.Status = errorTypeStatuses[strings.ToLower(info.Type)]
+	}
+	if info.Status == 0 {
+		info.Status = http.StatusInternalServerError
+	}
+	if info.Message == "" {
+		info.Message = http.StatusText(info.Status)
+	}
+	if info.Message == "" {
+		info.Message = "upstream error"
+	}
+	return info
+}
+
+func firstErrorString(value gjson.Result, paths ...string) string {
+	for _, path := range paths {
+		if v := value.Get(path); v.Type == gjson.String && v.String() != "" {
+			return v.String()
+		}
+	}
+	return ""
+}
+
+// errorCodeString 错误码：字符串原样返回，数字 0 视为成功码忽略
+func errorCodeString(code gjson.Result) string {
+	switch code.Type {
+	case gjson.String:
+		return code.String()
+	case gjson.Number:
+		if code.Int() != 0 {
+			return code.Raw
+		}
+	}
+	return ""
+}
+
+func truncateErrorMessage(s string) string {
+	if len(s) <= maxErrorMessageLength {
+		return s
+	}
+	s = s[:maxErrorMessageLength]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + "..."
+}
+
+// errorTypeFor 按状态码取错误类型，未列出的 4xx / 5xx 分别归入请求错误 / 服务端错误
+func errorTypeFor(types map[int]string, status int, clientError, serverError string) string {
+	if t, ok := types[status]; ok {
+		return t
+	}
+	if status >= http.StatusInternalServerError {
+		return serverError
+	}
+	return clientError
+}
+
+// normalizedErrorBody 按客户端协议构造标准错误体
+func normalizedErrorBody(schema string, info upstreamErrorInfo) gin.H {
+	switch schema {
+	case errorSchemaAnthropic:
+		return gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    errorTypeFor(anthropicErrorTypes, info.Status, "invalid_request_error", "api_error"),
+				"message": info.Message,
+			},
+		}
+	case errorSchemaGoogle:
+		return gin.H{
+			"error": gin.H{
+				"code":    info.Status,
+				"message": info.Message,
+				"status":  errorTypeFor(googleErrorStatuses, info.Status, "FAILED_PRECONDITION", "INTERNAL"),
+			},
+		}
+	}
+	// OpenAI 客户端按 code 区分 insufficient_quota 等情况，没有错误码时沿用上游的错误类型
+	var code interface{}
+	if info.Code != "" {
+		code = info.Code
+	} else if info.Type != "" {
+		code = info.Type
+	}
+	return gin.H{
+		"error": gin.H{
+			"message": info.Message,
+			"type":    errorTypeFor(openAIErrorTypes, info.Status, "invalid_request_error", "server_error"),
+			"param":   nil,
+			"code":    code,
+		},
+	}
+}
+
+// clientErrorStatus 所有 provider 失败时返回给客户端的状态码：限流、过载、请求错误原样返回，
+// 便于客户端退避或提示用户；上游鉴权 / 计费失败属于中转配置问题，与其他上游错误一样返回 502，
+// 避免客户端误以为自己的密钥无效
+func clientErrorStatus(upstream int) int {
+	switch upstream {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge,
+		http.StatusUnprocessableEntity, http.StatusTooManyRequests,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+		return upstream
+	}
+	return http.StatusBadGateway
+}
+
+// writeRelayError 以客户端协议的标准错误体返回失败；err 为上游错误时使用其状态码与错误描述，
+// 否则（网络错误等）返回 502
+func writeRelayError(c *gin.Context, schema string, summary string, err error) {
+	info := upstreamErrorInfo{Status: http.StatusBadGateway, Message: summary}
+	var upstreamErr *upstreamStatusError
+	if errors.As(err, &upstreamErr) {
+		info = parseUpstreamError(upstreamErr.Status, upstreamErr.Body)
+		info.Status = clientErrorStatus(upstreamErr.Status)
+		if summary != "" {
+			info.Message = summary + ": " + info.Message
+		}
+	} else if err != nil {
+		info.Message = summary + ": " + err.Error()
+	}
+	c.JSON(info.Status, normalizedErrorBody(schema, info))
+}
+
+// ===== 响应改写 =====
+
+// applyResponseNormalization 规范化 Anthropic Messages / Chat Completions 的 2xx 响应；
+// 返回的 restore 在本次尝试结束后调用
+func applyResponseNormalization(c *gin.Context, endpoint string, stream bool) func() {
+	format := reasoningFormatFor(endpoint)
+	if format == "" {
+		return func() {}
+	}
+	return installResponseRewriter(c, stream, &normalizeRewriter{format: format})
+}
+
+// normalizeRewriter 规范化结束原因与错误体
+type normalizeRewriter struct {
+	format string
+}
+
+func (r *normalizeRewriter) schema() string {
+	if r.format == reasoningFormatAnthropic {
+		return errorSchemaAnthropic
+	}
+	return errorSchemaOpenAI
+}
+
+// errorPayload 2xx 响应中的错误（部分上游以 200 返回错误或在流中途发送错误）
+func errorPayload(data gjson.Result) bool {
+	if data.Get("type").String() == "error" {
+		return true
+	}
+	if data.Get("choices").Exists() || data.Get("content").Exists() {
+		return false
+	}
+	if e := data.Get("error"); e.Exists() && e.Type != gjson.Null {
+		return true
+	}
+	if data.Get("base_resp.status_code").Int() != 0 {
+		return true
+	}
+	// 国内网关常见的 {"code": 非 0, "msg": "..."}
+	return errorCodeString(data.Get("code")) != "" && firstErrorString(data, "msg", "message") != ""
+}
+
+// canonicalError 已是客户端协议的标准错误体，原样保留（不丢弃 request_id 等字段）
+func (r *normalizeRewriter) canonicalError(data gjson.Result) bool {
+	if data.Get("error.message").Type != gjson.String || data.Get("error.type").Type != gjson.String {
+		return false
+	}
+	if r.format == reasoningFormatAnthropic {
+		return data.Get("type").String() == "error"
+	}
+	return !data.Get("type").Exists()
+}
+
+func (r *normalizeRewriter) errorJSON(payload string) []byte {
+	info := parseUpstreamError(0, []byte(payload))
+	data, _ := marshalUnescapedJSON(normalizedErrorBody(r.schema(), info))
+	return data
+}
+
+// event 改写一个 SSE 事件
+func (r *normalizeRewriter) event(raw []byte) []byte {
+	name, payload := parseSSEEvent(raw)
+	if !gjson.Valid(payload) {
+		return raw
+	}
+	data := gjson.Parse(payload)
+	if errorPayload(data) {
+		if r.canonicalError(data) {
+			return raw
+		}
+		if r.format == reasoningFormatAnthropic {
+			name = "error"
+		}
+		return encodeSSEEvents([]sseEvent{{name: name, data: r.errorJSON(payload)}})
+	}
+	var rewritten []byte
+	if r.format == reasoningFormatAnthropic {
+		rewritten = r.anthropicStopReason([]byte(payload), "delta.stop_reason")
+	} else {
+		rewritten = r.chatFinishReasons([]byte(payload), "choices")
+	}
+	if rewritten == nil {
+		return raw
+	}
+	return encodeSSEEvents([]sseEvent{{name: name, data: rewritten}})
+}
+
+// body 改写非流式响应
+func (r *normalizeRewriter) body(data []byte) []byte {
+	if !gjson.ValidBytes(data) {
+		return data
+	}
+	if parsed := gjson.ParseBytes(data); errorPayload(parsed) {
+		if r.canonicalError(parsed) {
+			return data
+		}
+		return r.errorJSON(string(data))
+	}
+	var rewritten []byte
+	if r.format == reasoningFormatAnthropic {
+		rewritten = r.anthropicStopReason(data, "stop_reason")
+	} else {
+		rewritten = r.chatFinishReasons(data, "choices")
+	}
+	if rewritten == nil {
+		return data
+	}
+	return rewritten
+}
+
+// anthropicStopReason 规范化 stop_reason；未改动时返回 nil
+func (r *normalizeRewriter) anthropicStopReason(data []byte, path string) []byte {
+	reason := gjson.GetBytes(data, path)
+	if reason.Type != gjson.String {
+		return nil
+	}
+	var (
+		out []byte
+		err error
+	)
+	if reason.String() == "" {
+		out, err = sjson.SetRawBytes(data, path, []byte("null"))
+	} else {
+		normalized := normalizeAnthropicStopReason(reason.String())
+		if normalized == reason.String() {
+			return nil
+		}
+		out, err = sjson.SetBytes(data, path, normalized)
+	}
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// chatFinishReasons 规范化各候选的 finish_reason；部分上游在未结束时发送空字符串，改为 null。
+// 未改动时返回 nil
+func (r *normalizeRewriter) chatFinishReasons(data []byte, path string) []byte {
+	changed := false
+	for i, choice := range gjson.GetBytes(data, path).Array() {
+		reason := choice.Get("finish_reason")
+		if reason.Type != gjson.String {
+			continue
+		}
+		field := fmt.Sprintf("%s.%d.finish_reason", path, i)
+		var err error
+		if reason.String() == "" {
+			data, err = sjson.SetRawBytes(data, field, []byte("null"))
+		} else if normalized := normalizeChatFinishReason(reason.String()); normalized != reason.String() {
+			data, err = sjson.SetBytes(data, field, normalized)
+		} else {
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return data
+}
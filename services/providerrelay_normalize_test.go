@@ -0,0 +1,305 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestNormalizeFinishReasonTables(t *testing.T) {
+	cases := []struct {
+		upstream  string
+		chat      string
+		anthropic string
+	}{
+		{"stop", "stop", "end_turn"},
+		{"STOP", "stop", "end_turn"}, // Gemini
+		{"end_turn", "stop", "end_turn"},
+		{"stop_sequence", "stop", "stop_sequence"},
+		{"eos", "stop", "end_turn"},
+		{"COMPLETE", "stop", "end_turn"}, // Cohere
+		{"pause_turn", "stop", "pause_turn"},
+		{"length", "length", "max_tokens"},
+		{"MAX_TOKENS", "length", "max_tokens"},
+		{"max_tokens", "length", "max_tokens"},
+		{"model_length", "length", "max_tokens"},
+		{"insufficient_system_resource", "length", "max_tokens"}, // DeepSeek
+		{"model_context_window_exceeded", "length", "model_context_window_exceeded"},
+		{"tool_calls", "tool_calls", "tool_use"},
+		{"tool_use", "tool_calls", "tool_use"},
+		{"function_call", "function_call", "tool_use"},
+		{"content_filter", "content_filter", "refusal"},
+		{"SAFETY", "content_filter", "refusal"},
+		{"RECITATION", "content_filter", "refusal"},
+		{"sensitive", "content_filter", "refusal"}, // 智谱
+		{"refusal", "content_filter", "refusal"},
+		{"something_new", "stop", "end_turn"},
+	}
+	for _, tc := range cases {
+		if got := normalizeChatFinishReason(tc.upstream); got != tc.chat {
+			t.Errorf("chat(%q) = %q, want %q", tc.upstream, got, tc.chat)
+		}
+		if got := normalizeAnthropicStopReason(tc.upstream); got != tc.anthropic {
+			t.Errorf("anthropic(%q) = %q, want %q", tc.upstream, got, tc.anthropic)
+		}
+	}
+}
+
+func TestParseUpstreamError(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		want   upstreamErrorInfo
+	}{
+		{
+			name:   "openai",
+			status: 429,
+			body:   `{"error":{"message":"quota","type":"insufficient_quota","param":null,"code":"insufficient_quota"}}`,
+			want:   upstreamErrorInfo{Status: 429, Message: "quota", Type: "insufficient_quota", Code: "insufficient_quota"},
+		},
+		{
+			name:   "anthropic",
+			status: 529,
+			body:   `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			want:   upstreamErrorInfo{Status: 529, Message: "Overloaded", Type: "overloaded_error"},
+		},
+		{
+			name:   "google array",
+			status: 400,
+			body:   `[{"error":{"code":400,"message":"bad key","status":"INVALID_ARGUMENT"}}]`,
+			want:   upstreamErrorInfo{Status: 400, Message: "bad key", Type: "INVALID_ARGUMENT", Code: "400"},
+		},
+		{
+			name:   "error string",
+			status: 500,
+			body:   `{"error":"boom"}`,
+			want:   upstreamErrorInfo{Status: 500, Message: "boom"},
+		},
+		{
+			name:   "msg and code",
+			status: 403,
+			body:   `{"code":10003,"msg":"令牌已过期"}`,
+			want:   upstreamErrorInfo{Status: 403, Message: "令牌已过期", Code: "10003"},
+		},
+		{
+			name:   "fastapi detail",
+			status: 422,
+			body:   `{"detail":[{"loc":["body"],"msg":"field required"}]}`,
+			want:   upstreamErrorInfo{Status: 422, Message: "field required"},
+		},
+		{
+			name:   "minimax base_resp",
+			status: 400,
+			body:   `{"base_resp":{"status_code":1004,"status_msg":"login fail"}}`,
+			want:   upstreamErrorInfo{Status: 400, Message: "login fail", Code: "1004"},
+		},
+		{
+			name:   "errors array",
+			status: 400,
+			body:   `{"errors":[{"message":"first"},{"message":"second"}]}`,
+			want:   upstreamErrorInfo{Status: 400, Message: "first"},
+		},
+		{
+			name:   "plain text",
+			status: 502,
+			body:   "upstream connect error\n",
+			want:   upstreamErrorInfo{Status: 502, Message: "upstream connect error"},
+		},
+		{
+			name:   "html page",
+			status: 503,
+			body:   "<html><body>503</body></html>",
+			want:   upstreamErrorInfo{Status: 503, Message: "Service Unavailable"},
+		},
+		{
+			name: "stream error infers status from type",
+			body: `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`,
+			want: upstreamErrorInfo{Status: 429, Message: "slow down", Type: "rate_limit_error"},
+		},
+		{
+			name: "stream error without type",
+			body: `{"error":{"message":"oops"}}`,
+			want: upstreamErrorInfo{Status: 500, Message: "oops"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseUpstreamError(tc.status, []byte(tc.body)); got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	long := strings.Repeat("错", 300)
+	if got := parseUpstreamError(500, []byte(long)).Message; !strings.HasSuffix(got, "...") || len(got) > maxErrorMessageLength+3 {
+		t.Errorf("long message not truncated: %d bytes", len(got))
+	}
+}
+
+func TestNormalizedErrorBody(t *testing.T) {
+	cases := []struct {
+		schema string
+		info   upstreamErrorInfo
+		want   string
+	}{
+		{errorSchemaAnthropic, upstreamErrorInfo{Status: 429, Message: "m"}, `{"error":{"message":"m","type":"rate_limit_error"},"type":"error"}`},
+		{errorSchemaAnthropic, upstreamErrorInfo{Status: 529, Message: "m"}, `{"error":{"message":"m","type":"overloaded_error"},"type":"error"}`},
+		{errorSchemaAnthropic, upstreamErrorInfo{Status: 502, Message: "m"}, `{"error":{"message":"m","type":"api_error"},"type":"error"}`},
+		{errorSchemaAnthropic, upstreamErrorInfo{Status: 422, Message: "m"}, `{"error":{"message":"m","type":"invalid_request_error"},"type":"error"}`},
+		{errorSchemaOpenAI, upstreamErrorInfo{Status: 429, Message: "m", Type: "insufficient_quota", Code: "insufficient_quota"}, `{"error":{"code":"insufficient_quota","message":"m","param":null,"type":"rate_limit_error"}}`},
+		{errorSchemaOpenAI, upstreamErrorInfo{Status: 529, Message: "m", Type: "overloaded_error"}, `{"error":{"code":"overloaded_error","message":"m","param":null,"type":"server_error"}}`},
+		{errorSchemaOpenAI, upstreamErrorInfo{Status: 400, Message: "m"}, `{"error":{"code":null,"message":"m","param":null,"type":"invalid_request_error"}}`},
+		{errorSchemaGoogle, upstreamErrorInfo{Status: 429, Message: "m"}, `{"error":{"code":429,"message":"m","status":"RESOURCE_EXHAUSTED"}}`},
+		{errorSchemaGoogle, upstreamErrorInfo{Status: 502, Message: "m"}, `{"error":{"code":502,"message":"m","status":"INTERNAL"}}`},
+	}
+	for _, tc := range cases {
+		data, err := marshalUnescapedJSON(normalizedErrorBody(tc.schema, tc.info))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tc.want {
+			t.Errorf("%s %d: got %s, want %s", tc.schema, tc.info.Status, data, tc.want)
+		}
+	}
+}
+
+func TestErrorSchemaFor(t *testing.T) {
+	cases := []struct{ kind, endpoint, want string }{
+		{"claude", "/v1/messages", errorSchemaAnthropic},
+		{"codex", "/responses", errorSchemaOpenAI},
+		{"others", "/v1/chat/completions", errorSchemaOpenAI},
+		{"gemini-cli", "/v1beta/models", errorSchemaGoogle},
+	}
+	for _, tc := range cases {
+		if got := errorSchemaFor(tc.kind, tc.endpoint); got != tc.want {
+			t.Errorf("errorSchemaFor(%s, %s) = %s, want %s", tc.kind, tc.endpoint, got, tc.want)
+		}
+	}
+}
+
+func TestWriteRelayError(t *testing.T) {
+	cases := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantType   string
+		wantMsg    string
+	}{
+		{"rate limited", &upstreamStatusError{Status: 429, Body: []byte(`{"error":{"message":"slow"}}`)}, 429, "rate_limit_error", "all failed: slow"},
+		{"upstream key rejected", &upstreamStatusError{Status: 401, Body: []byte(`{"msg":"bad key"}`)}, 502, "api_error", "all failed: bad key"},
+		// 529 没有标准状态描述，退回 "upstream error"
+		{"overloaded", &upstreamStatusError{Status: 529, Body: nil}, 529, "overloaded_error", "all failed: upstream error"},
+		{"network", errors.New("dial tcp: refused"), 502, "api_error", "all failed: dial tcp: refused"},
+		{"no error", nil, 502, "api_error", "all failed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			writeRelayError(c, errorSchemaAnthropic, "all failed", tc.err)
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			body := w.Body.Bytes()
+			if got := gjson.GetBytes(body, "error.type").String(); got != tc.wantType {
+				t.Errorf("type = %s, want %s", got, tc.wantType)
+			}
+			if got := gjson.GetBytes(body, "error.message").String(); !strings.HasPrefix(got, tc.wantMsg) {
+				t.Errorf("message = %q, want prefix %q", got, tc.wantMsg)
+			}
+		})
+	}
+
+	// 错误信息保持原有格式，日志与冷却判断依赖它
+	err := &upstreamStatusError{Status: 500, Body: []byte("x")}
+	if err.Error() != "upstream status 500: x" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+// runNormalizeWriter 规范化一段 2xx 响应，data 按 chunk 字节分片写入
+func runNormalizeWriter(t *testing.T, endpoint string, stream bool, data string, chunk int) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, endpoint, nil)
+	restore := applyResponseNormalization(c, endpoint, stream)
+	c.Writer.WriteHeader(http.StatusOK)
+	for len(data) > 0 {
+		n := chunk
+		if n <= 0 || n > len(data) {
+			n = len(data)
+		}
+		c.Writer.Write([]byte(data[:n]))
+		data = data[n:]
+	}
+	restore()
+	return w.Body.String()
+}
+
+func TestNormalizeChatStream(t *testing.T) {
+	stream := "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"\"}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"STOP\"}]}\n\n" +
+		"data: {\"error\":\"upstream timeout\"}\n\n" +
+		"data: [DONE]\n\n"
+	want := "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"},\"finish_reason\":null}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+		"data: {\"error\":{\"code\":null,\"message\":\"upstream timeout\",\"param\":null,\"type\":\"server_error\"}}\n\n" +
+		"data: [DONE]\n\n"
+	for _, chunk := range []int{0, 1, 11} {
+		if got := runNormalizeWriter(t, "/v1/chat/completions", true, stream, chunk); got != want {
+			t.Errorf("chunk=%d:\ngot  %q\nwant %q", chunk, got, want)
+		}
+	}
+}
+
+func TestNormalizeAnthropicStream(t *testing.T) {
+	stream := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"m\",\"stop_reason\":null}}\n\n" +
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_calls\"},\"usage\":{\"output_tokens\":3}}\n\n" +
+		"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"busy\"},\"request_id\":\"r\"}\n\n" +
+		"data: {\"error\":{\"code\":429,\"message\":\"quota\",\"status\":\"RESOURCE_EXHAUSTED\"}}\n\n"
+	want := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"m\",\"stop_reason\":null}}\n\n" +
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"},\"usage\":{\"output_tokens\":3}}\n\n" +
+		"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"busy\"},\"request_id\":\"r\"}\n\n" +
+		"event: error\ndata: {\"error\":{\"message\":\"quota\",\"type\":\"rate_limit_error\"},\"type\":\"error\"}\n\n"
+	for _, chunk := range []int{0, 1, 7} {
+		if got := runNormalizeWriter(t, "/v1/messages", true, stream, chunk); got != want {
+			t.Errorf("chunk=%d:\ngot  %q\nwant %q", chunk, got, want)
+		}
+	}
+}
+
+func TestNormalizeNonStream(t *testing.T) {
+	cases := []struct {
+		name     string
+		endpoint string
+		body     string
+		path     string
+		want     string
+	}{
+		{"chat finish_reason", "/v1/chat/completions", `{"choices":[{"index":0,"message":{"content":"x"},"finish_reason":"end_turn"},{"index":1,"finish_reason":"length"}]}`, "choices.#.finish_reason", `["stop","length"]`},
+		{"anthropic stop_reason", "/v1/messages", `{"type":"message","content":[],"stop_reason":"MAX_TOKENS"}`, "stop_reason", `"max_tokens"`},
+		{"anthropic error in 200", "/v1/messages", `{"code":1,"msg":"余额不足"}`, "@this", `{"error":{"message":"余额不足","type":"api_error"},"type":"error"}`},
+		{"chat base_resp error", "/v1/chat/completions", `{"base_resp":{"status_code":1008,"status_msg":"insufficient balance"}}`, "error.message", `"insufficient balance"`},
+		{"canonical untouched", "/v1/chat/completions", `{"choices":[{"finish_reason":"stop"}],"id":"x"}`, "@this", `{"choices":[{"finish_reason":"stop"}],"id":"x"}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := runNormalizeWriter(t, tc.endpoint, false, tc.body, 5)
+			if got := gjson.Get(out, tc.path).Raw; got != tc.want {
+				t.Errorf("%s = %s, want %s\n%s", tc.path, got, tc.want, out)
+			}
+		})
+	}
+
+	// 其他端点不改写
+	if got := runNormalizeWriter(t, "/responses", false, `{"error":"x"}`, 0); got != `{"error":"x"}` {
+		t.Errorf("responses body rewritten: %s", got)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Provider 固定事件类型
+const (
+	ProviderEventPinned   = "provider.pinned"
+	ProviderEventUnpinned = "provider.unpinned"
+)
+
+// pinStore 各平台固定使用的 provider（平台 -> provider 名称），空表示自动路由
+type pinStore struct {
+	mu   sync.RWMutex
+	pins map[string]string
+}
+
+// pinConfigPath 固定 provider 配置文件
+func pinConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "pinned-providers.json"), nil
+}
+
+// GetPinnedProviders 获取所有平台当前固定的 provider
+func (prs *ProviderRelayService) GetPinnedProviders() map[string]string {
+	prs.pins.mu.RLock()
+	defer prs.pins.mu.RUnlock()
+	pins := make(map[string]string, len(prs.pins.pins))
+	for kind, name := range prs.pins.pins {
+		pins[kind] = name
+	}
+	return pins
+}
+
+// GetPinnedProvider 获取平台当前固定的 provider，未固定返回空字符串
+func (prs *ProviderRelayService) GetPinnedProvider(kind string) string {
+	prs.pins.mu.RLock()
+	defer prs.pins.mu.RUnlock()
+	return prs.pins.pins[kind]
+}
+
+// PinProvider 将平台的请求固定到指定 provider；name 为空时恢复自动路由
+func (prs *ProviderRelayService) PinProvider(kind, name string) error {
+	kind = strings.TrimSpace(kind)
+	name = strings.TrimSpace(name)
+	if kind == "" {
+		return fmt.Errorf("platform is required")
+	}
+	if name != "" {
+		providers, err := prs.providerService.LoadProviders(kind)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, p := range providers {
+			if p.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("provider %s not found on platform %s", name, kind)
+		}
+	}
+
+	prs.pins.mu.Lock()
+	previous := prs.pins.pins[kind]
+	if previous == name {
+		prs.pins.mu.Unlock()
+		return nil
+	}
+	pins := make(map[string]string, len(prs.pins.pins)+1)
+	for k, v := range prs.pins.pins {
+		pins[k] = v
+	}
+	if name == "" {
+		delete(pins, kind)
+	} else {
+		pins[kind] = name
+	}
+	if err := savePinnedProviders(pins); err != nil {
+		prs.pins.mu.Unlock()
+		return err
+	}
+	prs.pins.pins = pins
+	prs.pins.mu.Unlock()
+
+	if name == "" {
+		prs.emitProviderEvent(ProviderEvent{Type: ProviderEventUnpinned, Platform: kind, Provider: previous})
+	} else {
+		prs.emitProviderEvent(ProviderEvent{Type: ProviderEventPinned, Platform: kind, Provider: name})
+	}
+	return nil
+}
+
+// CyclePinnedProvider 依次固定到下一个已启用的 provider：自动 -> 第一个 -> ... -> 最后一个 -> 自动；返回新的固定 provider（空表示自动）
+func (prs *ProviderRelayService) CyclePinnedProvider(kind string) (string, error) {
+	providers, err := prs.providerService.LoadProviders(kind)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		if p.Enabled {
+			names = append(names, p.Name)
+		}
+	}
+
+	next := ""
+	current := prs.GetPinnedProvider(kind)
+	if current == "" {
+		if len(names) > 0 {
+			next = names[0]
+		}
+	} else {
+		for i, name := range names {
+			if name == current && i+1 < len(names) {
+				next = names[i+1]
+				break
+			}
+		}
+	}
+	if err := prs.PinProvider(kind, next); err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// savePinnedProviders 持久化固定配置，重启后保持
+func savePinnedProviders(pins map[string]string) error {
+	path, err := pinConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadPinnedProviders 启动时从 pinned-providers.json 恢复固定配置
+func (prs *ProviderRelayService) loadPinnedProviders() {
+	path, err := pinConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var pins map[string]string
+	if err := json.Unmarshal(data, &pins); err == nil {
+		prs.pins.mu.Lock()
+		prs.pins.pins = pins
+		prs.pins.mu.Unlock()
+	}
+}
+
+// applyPinnedProvider 平台已固定 provider 且其可用时只保留该 provider；不可用时回退到正常路由
+func (prs *ProviderRelayService) applyPinnedProvider(kind string, active []Provider) []Provider {
+	pinned := prs.GetPinnedProvider(kind)
+	if pinned == "" {
+		return active
+	}
+	for _, p := range active {
+		if p.Name == pinned {
+			fmt.Printf("[INFO] 平台 %s 已固定 provider：%s\n", kind, pinned)
+			return []Provider{p}
+		}
+	}
+	fmt.Printf("[WARN] 固定的 provider %s 当前不可用，按正常规则路由\n", pinned)
+	return active
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPinProviderRoutingAndPersistence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{providerService: NewProviderService(), startTime: time.Now()}
+	providers := []Provider{
+		{ID: 1, Name: "primary", APIURL: "https://a.example.com", APIKey: "k", Enabled: true, Level: 1},
+		{ID: 2, Name: "backup", APIURL: "https://b.example.com", APIKey: "k", Enabled: true, Level: 2},
+	}
+	if err := prs.providerService.SaveProviders("claude", providers); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := prs.PinProvider("claude", "missing"); err == nil {
+		t.Fatal("expected error when pinning an unknown provider")
+	}
+	if err := prs.PinProvider("claude", "backup"); err != nil {
+		t.Fatal(err)
+	}
+	routed := prs.applyPinnedProvider("claude", providers)
+	if len(routed) != 1 || routed[0].Name != "backup" {
+		t.Fatalf("expected only the pinned provider, got %+v", routed)
+	}
+	// 固定的 provider 不可用时按正常规则路由
+	if routed := prs.applyPinnedProvider("claude", providers[:1]); len(routed) != 1 || routed[0].Name != "primary" {
+		t.Fatalf("expected normal routing when the pinned provider is unavailable, got %+v", routed)
+	}
+
+	explain, err := prs.ExplainRoute("claude", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explain.Pinned != "backup" || len(explain.Candidates) != 1 || explain.Candidates[0].Name != "backup" ||
+		len(explain.Skipped) != 1 || explain.Skipped[0].Reason != routeSkipPinned {
+		t.Fatalf("unexpected explanation: %+v", explain)
+	}
+
+	// 重启后固定配置仍然生效
+	restarted := &ProviderRelayService{providerService: prs.providerService}
+	restarted.loadPinnedProviders()
+	if got := restarted.GetPinnedProvider("claude"); got != "backup" {
+		t.Fatalf("expected pin to survive restart, got %q", got)
+	}
+
+	if err := restarted.PinProvider("claude", ""); err != nil {
+		t.Fatal(err)
+	}
+	if pins := restarted.GetPinnedProviders(); len(pins) != 0 {
+		t.Fatalf("expected no pins after restoring auto routing, got %v", pins)
+	}
+	again := &ProviderRelayService{}
+	again.loadPinnedProviders()
+	if got := again.GetPinnedProvider("claude"); got != "" {
+		t.Fatalf("expected auto routing to persist, got %q", got)
+	}
+}
+
+func TestCyclePinnedProvider(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	providers := []Provider{
+		{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "k", Enabled: true},
+		{ID: 2, Name: "off", APIURL: "https://b.example.com", APIKey: "k", Enabled: false},
+		{ID: 3, Name: "c", APIURL: "https://c.example.com", APIKey: "k", Enabled: true},
+	}
+	if err := prs.providerService.SaveProviders("codex", providers); err != nil {
+		t.Fatal(err)
+	}
+	// 自动 -> a -> c -> 自动，跳过未启用的 provider
+	for _, want := range []string{"a", "c", "", "a"} {
+		got, err := prs.CyclePinnedProvider("codex")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want || prs.GetPinnedProvider("codex") != want {
+			t.Fatalf("expected pin %q, got %q", want, got)
+		}
+	}
+}
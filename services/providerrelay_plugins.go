@@ -0,0 +1,609 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeswitch/services/relayplugin"
+	"github.com/gin-gonic/gin"
+)
+
+// 中继插件：~/.code-switch/plugins 目录下的 go-plugin 可执行文件（见 relayplugin）在启动时被拉起，
+// 在转发前拦截请求、在返回客户端前拦截成功的非流式响应。
+// 进程内的 Go 拦截器可通过 RegisterRequestInterceptor / RegisterResponseInterceptor 注册，先于外部插件执行
+
+const (
+	// defaultPluginTimeout 单次拦截调用的默认超时
+	defaultPluginTimeout = 3 * time.Second
+	// pluginStartTimeout 插件完成握手与返回描述信息的超时
+	pluginStartTimeout = 5 * time.Second
+	// pluginRestartInterval 插件退出后重新拉起的最短间隔，避免反复崩溃的插件拖慢请求
+	pluginRestartInterval = 30 * time.Second
+)
+
+// PluginConfig 插件配置
+type PluginConfig struct {
+	Disabled   []string `json:"disabled,omitempty"`    // 停用的插件（文件名）
+	TimeoutMs  int      `json:"timeout_ms,omitempty"`  // 单次调用超时，默认 3000
+	FailClosed bool     `json:"fail_closed,omitempty"` // 插件出错时拒绝请求；默认跳过出错的插件继续转发
+}
+
+// PluginStatus 插件状态
+type PluginStatus struct {
+	File      string   `json:"file"`
+	Path      string   `json:"path"`
+	Name      string   `json:"name,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	Hooks     []string `json:"hooks,omitempty"`
+	Platforms []string `json:"platforms,omitempty"`
+	Enabled   bool     `json:"enabled"`
+	Running   bool     `json:"running"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// relayPlugin 一个外部插件进程
+type relayPlugin struct {
+	mu        sync.Mutex
+	path      string
+	enabled   bool
+	info      relayplugin.Info
+	client    *relayplugin.Client
+	err       string
+	startedAt time.Time
+}
+
+// pluginStore 插件配置、外部插件与进程内拦截器
+type pluginStore struct {
+	mu                   sync.RWMutex
+	config               PluginConfig
+	plugins              []*relayPlugin
+	requestInterceptors  []relayplugin.RequestInterceptor
+	responseInterceptors []relayplugin.ResponseInterceptor
+}
+
+// Validate 检查插件配置
+func (cfg PluginConfig) Validate() error {
+	if cfg.TimeoutMs < 0 {
+		return fmt.Errorf("timeout_ms 不能为负数")
+	}
+	return nil
+}
+
+// timeout 单次调用超时
+func (cfg PluginConfig) timeout() time.Duration {
+	if cfg.TimeoutMs > 0 {
+		return time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	return defaultPluginTimeout
+}
+
+// pluginsDir 插件目录
+func pluginsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "plugins"), nil
+}
+
+// pluginConfigPath 插件配置文件
+func pluginConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "plugins.json"), nil
+}
+
+// GetPluginConfig 获取插件配置
+func (prs *ProviderRelayService) GetPluginConfig() PluginConfig {
+	prs.plugins.mu.RLock()
+	defer prs.plugins.mu.RUnlock()
+	return prs.plugins.config
+}
+
+// SetPluginConfig 更新插件配置，持久化到 plugins.json 并重新加载插件
+func (prs *ProviderRelayService) SetPluginConfig(cfg PluginConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	path, err := pluginConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.plugins.mu.Lock()
+	prs.plugins.config = cfg
+	prs.plugins.mu.Unlock()
+	_, err = prs.ReloadPlugins()
+	return err
+}
+
+// SetPluginEnabled 启用或停用单个插件
+func (prs *ProviderRelayService) SetPluginEnabled(file string, enabled bool) error {
+	cfg := prs.GetPluginConfig()
+	disabled := make([]string, 0, len(cfg.Disabled)+1)
+	for _, name := range cfg.Disabled {
+		if !strings.EqualFold(name, file) {
+			disabled = append(disabled, name)
+		}
+	}
+	if !enabled {
+		disabled = append(disabled, file)
+	}
+	cfg.Disabled = disabled
+	return prs.SetPluginConfig(cfg)
+}
+
+// loadPluginConfig 启动时从 plugins.json 恢复
+func (prs *ProviderRelayService) loadPluginConfig() {
+	path, err := pluginConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cfg PluginConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("[Plugin] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("[Plugin] 配置无效，已忽略: %v\n", err)
+		return
+	}
+	prs.plugins.mu.Lock()
+	prs.plugins.config = cfg
+	prs.plugins.mu.Unlock()
+}
+
+// startPlugins 启动时加载插件目录
+func (prs *ProviderRelayService) startPlugins() {
+	statuses, err := prs.ReloadPlugins()
+	if err != nil {
+		fmt.Printf("[Plugin] 加载插件失败: %v\n", err)
+		return
+	}
+	for _, status := range statuses {
+		switch {
+		case !status.Enabled:
+			fmt.Printf("[Plugin] %s 已停用\n", status.File)
+		case status.Error != "":
+			fmt.Printf("[Plugin] %s 启动失败: %s\n", status.File, status.Error)
+		default:
+			fmt.Printf("[Plugin] 已加载 %s (%s, hooks=%s)\n", status.File, status.Name, strings.Join(status.Hooks, ","))
+		}
+	}
+}
+
+// ReloadPlugins 关闭已启动的插件，重新扫描插件目录并启动启用的插件
+func (prs *ProviderRelayService) ReloadPlugins() ([]PluginStatus, error) {
+	dir, err := pluginsDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := discoverPlugins(dir)
+	if err != nil {
+		return nil, err
+	}
+	cfg := prs.GetPluginConfig()
+	loaded := make([]*relayPlugin, 0, len(paths))
+	for _, path := range paths {
+		plugin := &relayPlugin{path: path, enabled: !containsFold(cfg.Disabled, filepath.Base(path))}
+		if plugin.enabled {
+			plugin.start()
+		}
+		loaded = append(loaded, plugin)
+	}
+
+	prs.plugins.mu.Lock()
+	previous := prs.plugins.plugins
+	prs.plugins.plugins = loaded
+	prs.plugins.mu.Unlock()
+	for _, plugin := range previous {
+		plugin.stop()
+	}
+	return prs.GetPlugins(), nil
+}
+
+// GetPlugins 列出插件目录中的插件及其状态
+func (prs *ProviderRelayService) GetPlugins() []PluginStatus {
+	prs.plugins.mu.RLock()
+	plugins := prs.plugins.plugins
+	prs.plugins.mu.RUnlock()
+	statuses := make([]PluginStatus, 0, len(plugins))
+	for _, plugin := range plugins {
+		statuses = append(statuses, plugin.status())
+	}
+	return statuses
+}
+
+// stopPlugins 关闭所有插件进程
+func (prs *ProviderRelayService) stopPlugins() {
+	prs.plugins.mu.Lock()
+	plugins := prs.plugins.plugins
+	prs.plugins.plugins = nil
+	prs.plugins.mu.Unlock()
+	for _, plugin := range plugins {
+		plugin.stop()
+	}
+}
+
+// RegisterRequestInterceptor 注册进程内请求拦截器，先于外部插件执行
+func (prs *ProviderRelayService) RegisterRequestInterceptor(interceptor relayplugin.RequestInterceptor) {
+	prs.plugins.mu.Lock()
+	prs.plugins.requestInterceptors = append(prs.plugins.requestInterceptors, interceptor)
+	prs.plugins.mu.Unlock()
+}
+
+// RegisterResponseInterceptor 注册进程内响应拦截器，先于外部插件执行
+func (prs *ProviderRelayService) RegisterResponseInterceptor(interceptor relayplugin.ResponseInterceptor) {
+	prs.plugins.mu.Lock()
+	prs.plugins.responseInterceptors = append(prs.plugins.responseInterceptors, interceptor)
+	prs.plugins.mu.Unlock()
+}
+
+// discoverPlugins 插件目录中的可执行文件，按文件名排序（即执行顺序）；目录不存在时返回空
+func discoverPlugins(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if runtime.GOOS == "windows" {
+			if !strings.EqualFold(filepath.Ext(entry.Name()), ".exe") {
+				continue
+			}
+		} else if info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// start 拉起插件进程并获取描述信息，调用方需持有锁或独占插件
+func (p *relayPlugin) start() {
+	p.startedAt = time.Now()
+	p.client = nil
+	cmd := exec.Command(p.path)
+	cmd.Dir = filepath.Dir(p.path)
+	client, err := relayplugin.Start(cmd, &pluginLogWriter{name: filepath.Base(p.path)}, pluginStartTimeout)
+	if err != nil {
+		p.err = err.Error()
+		return
+	}
+	info, err := client.Describe(pluginStartTimeout)
+	if err != nil {
+		client.Close()
+		p.err = fmt.Sprintf("获取插件信息失败: %v", err)
+		return
+	}
+	if info.Name == "" {
+		info.Name = filepath.Base(p.path)
+	}
+	p.info = info
+	p.client = client
+	p.err = ""
+}
+
+// stop 关闭插件进程
+func (p *relayPlugin) stop() {
+	p.mu.Lock()
+	client := p.client
+	p.client = nil
+	p.mu.Unlock()
+	if client != nil {
+		client.Close()
+	}
+}
+
+// running 返回可用的连接；插件退出后按最短间隔重新拉起
+func (p *relayPlugin) running() (*relayplugin.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil && !p.client.Exited() {
+		return p.client, nil
+	}
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+		p.err = "插件进程已退出"
+	}
+	if time.Since(p.startedAt) < pluginRestartInterval {
+		return nil, fmt.Errorf("%s", p.err)
+	}
+	fmt.Printf("[Plugin] 重新启动 %s\n", filepath.Base(p.path))
+	p.start()
+	if p.client == nil {
+		return nil, fmt.Errorf("%s", p.err)
+	}
+	return p.client, nil
+}
+
+// handles 插件是否处理该平台的指定拦截点
+func (p *relayPlugin) handles(kind, hook string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.enabled || p.info.Name == "" {
+		return false
+	}
+	if len(p.info.Platforms) > 0 && !containsFold(p.info.Platforms, kind) {
+		return false
+	}
+	return containsFold(p.info.Hooks, hook)
+}
+
+// status 插件状态快照
+func (p *relayPlugin) status() PluginStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PluginStatus{
+		File:      filepath.Base(p.path),
+		Path:      p.path,
+		Name:      p.info.Name,
+		Version:   p.info.Version,
+		Hooks:     p.info.Hooks,
+		Platforms: p.info.Platforms,
+		Enabled:   p.enabled,
+		Running:   p.client != nil && !p.client.Exited(),
+		Error:     p.err,
+	}
+}
+
+// pluginLogWriter 把插件的日志与 stdout / stderr 输出按行写入日志；go-plugin 从多个 goroutine 写入
+type pluginLogWriter struct {
+	mu   sync.Mutex
+	name string
+	buf  []byte
+}
+
+func (w *pluginLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Printf("[Plugin:%s] %s\n", w.name, strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// pluginVisibleHeaders 发送给插件的请求头，不包含 provider 凭据
+func pluginVisibleHeaders(headers map[string]string) map[string]string {
+	visible := make(map[string]string, len(headers))
+	for key, value := range headers {
+		switch strings.ToLower(key) {
+		case "authorization", "x-api-key", "x-goog-api-key", "api-key":
+			continue
+		}
+		visible[key] = value
+	}
+	return visible
+}
+
+// applyHeaderPatch 按插件结果设置请求头，值为空表示删除（不区分大小写）
+func applyHeaderPatch(headers map[string]string, patch map[string]string) {
+	for key, value := range patch {
+		for existing := range headers {
+			if strings.EqualFold(existing, key) {
+				delete(headers, existing)
+			}
+		}
+		if value != "" {
+			headers[key] = value
+		}
+	}
+}
+
+// pluginRejection 规范化拒绝结果
+func pluginRejection(source string, rejection *relayplugin.Rejection) *relayplugin.Rejection {
+	normalized := *rejection
+	if normalized.Status < 400 || normalized.Status > 599 {
+		normalized.Status = http.StatusBadRequest
+	}
+	if normalized.Message == "" {
+		normalized.Message = fmt.Sprintf("request rejected by plugin %s", source)
+	}
+	return &normalized
+}
+
+// pluginsFor 处理该平台指定拦截点的外部插件与当前配置
+func (prs *ProviderRelayService) pluginsFor(kind, hook string) ([]*relayPlugin, PluginConfig) {
+	prs.plugins.mu.RLock()
+	defer prs.plugins.mu.RUnlock()
+	matched := make([]*relayPlugin, 0, len(prs.plugins.plugins))
+	for _, plugin := range prs.plugins.plugins {
+		if plugin.handles(kind, hook) {
+			matched = append(matched, plugin)
+		}
+	}
+	return matched, prs.plugins.config
+}
+
+// runRequestInterceptors 依次执行请求拦截器，返回改写后的请求体（headers 原地修改）；
+// 被拒绝时返回拒绝结果。插件出错时默认跳过，fail_closed 时拒绝请求
+func (prs *ProviderRelayService) runRequestInterceptors(kind, provider, model, endpoint string, body []byte, headers map[string]string) ([]byte, *relayplugin.Rejection) {
+	prs.plugins.mu.RLock()
+	inProcess := prs.plugins.requestInterceptors
+	prs.plugins.mu.RUnlock()
+	external, cfg := prs.pluginsFor(kind, relayplugin.HookRequest)
+	if len(inProcess) == 0 && len(external) == 0 {
+		return body, nil
+	}
+
+	request := func() *relayplugin.Request {
+		return &relayplugin.Request{
+			Platform: kind,
+			Provider: provider,
+			Model:    model,
+			Endpoint: endpoint,
+			Headers:  pluginVisibleHeaders(headers),
+			Body:     string(body),
+		}
+	}
+	apply := func(source string, result *relayplugin.RequestResult, err error) *relayplugin.Rejection {
+		if err != nil {
+			fmt.Printf("[Plugin] %s 拦截请求失败: %v\n", source, err)
+			if cfg.FailClosed {
+				return &relayplugin.Rejection{Status: http.StatusBadGateway, Message: fmt.Sprintf("plugin %s failed: %v", source, err)}
+			}
+			return nil
+		}
+		if result == nil {
+			return nil
+		}
+		if result.Reject != nil {
+			return pluginRejection(source, result.Reject)
+		}
+		if result.Body != nil {
+			body = []byte(*result.Body)
+		}
+		applyHeaderPatch(headers, result.Headers)
+		return nil
+	}
+
+	for i, interceptor := range inProcess {
+		result, err := interceptor.InterceptRequest(request())
+		if rejection := apply(fmt.Sprintf("in-process #%d", i+1), result, err); rejection != nil {
+			return body, rejection
+		}
+	}
+	for _, plugin := range external {
+		source := filepath.Base(plugin.path)
+		client, err := plugin.running()
+		var result *relayplugin.RequestResult
+		if err == nil {
+			result, err = client.InterceptRequest(request(), cfg.timeout())
+		}
+		if rejection := apply(source, result, err); rejection != nil {
+			return body, rejection
+		}
+	}
+	return body, nil
+}
+
+// runResponseInterceptors 依次执行响应拦截器改写成功的非流式响应；
+// 插件出错时默认跳过，fail_closed 时把响应改为 502，按该 provider 失败处理
+func (prs *ProviderRelayService) runResponseInterceptors(kind, provider, model string, resp *http.Response) *http.Response {
+	prs.plugins.mu.RLock()
+	inProcess := prs.plugins.responseInterceptors
+	prs.plugins.mu.RUnlock()
+	external, cfg := prs.pluginsFor(kind, relayplugin.HookResponse)
+	if len(inProcess) == 0 && len(external) == 0 {
+		return resp
+	}
+
+	data, err := readDecodedBody(resp)
+	if err != nil {
+		return replaceResponseBody(resp, data)
+	}
+	response := func() *relayplugin.Response {
+		headers := make(map[string]string, len(resp.Header))
+		for key := range resp.Header {
+			headers[key] = resp.Header.Get(key)
+		}
+		return &relayplugin.Response{Platform: kind, Provider: provider, Model: model, Status: resp.StatusCode, Headers: headers, Body: string(data)}
+	}
+	failed := false
+	apply := func(source string, result *relayplugin.ResponseResult, err error) {
+		if err != nil {
+			fmt.Printf("[Plugin] %s 拦截响应失败: %v\n", source, err)
+			if cfg.FailClosed {
+				failed = true
+				data, _ = json.Marshal(gin.H{"error": fmt.Sprintf("plugin %s failed: %v", source, err)})
+			}
+			return
+		}
+		if result == nil {
+			return
+		}
+		if result.Body != nil {
+			data = []byte(*result.Body)
+		}
+		for key, value := range result.Headers {
+			if value == "" {
+				resp.Header.Del(key)
+			} else {
+				resp.Header.Set(key, value)
+			}
+		}
+	}
+
+	for i, interceptor := range inProcess {
+		if failed {
+			break
+		}
+		result, err := interceptor.InterceptResponse(response())
+		apply(fmt.Sprintf("in-process #%d", i+1), result, err)
+	}
+	for _, plugin := range external {
+		if failed {
+			break
+		}
+		source := filepath.Base(plugin.path)
+		client, err := plugin.running()
+		var result *relayplugin.ResponseResult
+		if err == nil {
+			result, err = client.InterceptResponse(response(), cfg.timeout())
+		}
+		apply(source, result, err)
+	}
+	if failed {
+		resp.StatusCode = http.StatusBadGateway
+		resp.Status = fmt.Sprintf("%d %s", http.StatusBadGateway, http.StatusText(http.StatusBadGateway))
+	}
+	return replaceResponseBody(resp, data)
+}
+
+// adminGetPluginsHandler 列出插件
+func (prs *ProviderRelayService) adminGetPluginsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"config": prs.GetPluginConfig(), "plugins": prs.GetPlugins()})
+}
+
+// adminReloadPluginsHandler 重新加载插件目录
+func (prs *ProviderRelayService) adminReloadPluginsHandler(c *gin.Context) {
+	statuses, err := prs.ReloadPlugins()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plugins": statuses})
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"codeswitch/services/relayplugin"
+	"github.com/gin-gonic/gin"
+)
+
+type redactInterceptor struct {
+	seen *relayplugin.Request
+}
+
+func (r *redactInterceptor) InterceptRequest(req *relayplugin.Request) (*relayplugin.RequestResult, error) {
+	r.seen = req
+	if strings.Contains(req.Body, "forbidden") {
+		return &relayplugin.RequestResult{Reject: &relayplugin.Rejection{Status: http.StatusForbidden, Message: "nope"}}, nil
+	}
+	body := strings.ReplaceAll(req.Body, "secret", "[redacted]")
+	return &relayplugin.RequestResult{Body: &body, Headers: map[string]string{"X-Redacted": "1", "X-Drop": ""}}, nil
+}
+
+type suffixInterceptor struct{ err error }
+
+func (s suffixInterceptor) InterceptResponse(resp *relayplugin.Response) (*relayplugin.ResponseResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	body := strings.TrimSuffix(resp.Body, "}") + `,"checked":true}`
+	return &relayplugin.ResponseResult{Body: &body, Headers: map[string]string{"X-Checked": resp.Provider}}, nil
+}
+
+func runPluginRequest(t *testing.T, prs *ProviderRelayService, body string) (*httptest.ResponseRecorder, *http.Request, string) {
+	t.Helper()
+	var upstreamReq *http.Request
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamReq, upstreamBody = r, string(data)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"x"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	prs.logWriteQueue = make(chan *ReqeustLog, 1)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	provider := Provider{Name: "p1", APIURL: upstream.URL, APIKey: "k"}
+	ok, err := prs.forwardRequest(c, "codex", provider, "/v1/chat/completions", nil, map[string]string{"X-Drop": "a"}, []byte(body), false, "m")
+	if !ok || err != nil {
+		t.Fatalf("forwardRequest = %v, %v", ok, err)
+	}
+	return w, upstreamReq, upstreamBody
+}
+
+func TestForwardRequestRunsInterceptors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{}
+	redact := &redactInterceptor{}
+	prs.RegisterRequestInterceptor(redact)
+	prs.RegisterResponseInterceptor(suffixInterceptor{})
+
+	w, upstreamReq, upstreamBody := runPluginRequest(t, prs, `{"model":"m","messages":[{"role":"user","content":"my secret"}]}`)
+	if !strings.Contains(upstreamBody, "[redacted]") || upstreamReq.Header.Get("X-Redacted") != "1" || upstreamReq.Header.Get("X-Drop") != "" {
+		t.Fatalf("upstream got %s %v", upstreamBody, upstreamReq.Header)
+	}
+	if _, ok := redact.seen.Headers["Authorization"]; ok || redact.seen.Provider != "p1" || redact.seen.Platform != "codex" {
+		t.Fatalf("interceptor saw %+v", redact.seen)
+	}
+	if w.Body.String() != `{"id":"x","checked":true}` || w.Header().Get("X-Checked") != "p1" {
+		t.Fatalf("client got %s %v", w.Body.String(), w.Header())
+	}
+
+	// 拒绝时直接返回客户端，不再请求上游
+	w, upstreamReq, _ = runPluginRequest(t, prs, `{"model":"m","messages":[{"role":"user","content":"forbidden"}]}`)
+	if w.Code != http.StatusForbidden || upstreamReq != nil || !strings.Contains(w.Body.String(), "plugin_rejected") {
+		t.Fatalf("rejection: code=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestResponseInterceptorFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{}
+	prs.RegisterResponseInterceptor(suffixInterceptor{err: errors.New("boom")})
+
+	// 默认跳过出错的拦截器
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"a":1}`))}
+	resp = prs.runResponseInterceptors("codex", "p1", "m", resp)
+	if data, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(data) != `{"a":1}` {
+		t.Fatalf("fail-open: %d %s", resp.StatusCode, data)
+	}
+
+	// fail_closed 时按 provider 失败处理
+	prs.plugins.config.FailClosed = true
+	resp = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"a":1}`))}
+	resp = prs.runResponseInterceptors("codex", "p1", "m", resp)
+	if data, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(data), "boom") {
+		t.Fatalf("fail-closed: %d %s", resp.StatusCode, data)
+	}
+}
+
+func TestReloadPluginsDiscovery(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are discovered by .exe extension on Windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".code-switch", "plugins")
+	if err := os.MkdirAll(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]os.FileMode{"20-broken": 0755, "10-disabled": 0755, "README.md": 0644, ".hidden": 0755}
+	for name, mode := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\nexit 1\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prs := &ProviderRelayService{}
+	if err := prs.SetPluginConfig(PluginConfig{Disabled: []string{"10-disabled"}}); err != nil {
+		t.Fatal(err)
+	}
+	statuses := prs.GetPlugins()
+	if len(statuses) != 2 || statuses[0].File != "10-disabled" || statuses[1].File != "20-broken" {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+	if statuses[0].Enabled || statuses[0].Error != "" {
+		t.Fatalf("disabled plugin should not start: %+v", statuses[0])
+	}
+	if !statuses[1].Enabled || statuses[1].Running || statuses[1].Error == "" {
+		t.Fatalf("broken plugin should report an error: %+v", statuses[1])
+	}
+
+	// 未加载成功的插件不参与拦截
+	body, rejection := prs.runRequestInterceptors("codex", "p1", "m", "/v1/chat/completions", []byte("{}"), map[string]string{})
+	if rejection != nil || string(body) != "{}" {
+		t.Fatalf("body=%s rejection=%+v", body, rejection)
+	}
+
+	if err := prs.SetPluginEnabled("10-disabled", true); err != nil {
+		t.Fatal(err)
+	}
+	if statuses := prs.GetPlugins(); !statuses[0].Enabled {
+		t.Fatalf("plugin should be enabled: %+v", statuses[0])
+	}
+	prs.stopPlugins()
+}
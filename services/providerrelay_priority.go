@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求优先级：客户端通过 X-CS-Priority 请求头（或按 API Key 的归属规则默认值）把请求标记为 interactive / batch。
+// provider 设置了 maxConcurrent 时，超出并发上限的请求排队：interactive 总是先于 batch 获得空闲名额，
+// batch 最多占用 batchShare% 的名额且有 interactive 排队时不再放行，后台 agent 不会拖慢编辑器补全。
+// 排队超过 maxWaitMs 时放弃该 provider，尝试下一个候选
+
+// headerPriority 请求优先级请求头
+const headerPriority = "X-CS-Priority"
+
+// 请求优先级
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+const (
+	// defaultBatchShare batch 请求默认最多占用的并发名额比例（%）
+	defaultBatchShare = 50
+	// defaultPriorityMaxWait 默认最长排队时间
+	defaultPriorityMaxWait = 30 * time.Second
+)
+
+var errPriorityQueueTimeout = errors.New("provider concurrency limit reached")
+
+// PriorityConfig 请求优先级配置
+type PriorityConfig struct {
+	DefaultClass string `json:"defaultClass"` // 未标记的请求，默认 interactive
+	BatchShare   int    `json:"batchShare"`   // batch 最多占用的并发名额比例（%），0 表示默认 50
+	MaxWaitMs    int    `json:"maxWaitMs"`    // 最长排队毫秒数，0 表示默认 30s
+}
+
+// PriorityClassStats 单个优先级的请求数、排队与端到端延迟
+type PriorityClassStats struct {
+	Class         string  `json:"class"`
+	Requests      uint64  `json:"requests"`
+	Queued        uint64  `json:"queued"`   // 因并发上限排队过的请求
+	Timeouts      uint64  `json:"timeouts"` // 排队超时放弃 provider 的次数
+	Waiting       int     `json:"waiting"`  // 当前排队中的请求
+	Active        int     `json:"active"`   // 当前占用并发名额的请求
+	AvgWaitMs     float64 `json:"avgWaitMs"`
+	MaxWaitMs     float64 `json:"maxWaitMs"`
+	AvgDurationMs float64 `json:"avgDurationMs"`
+	P95DurationMs float64 `json:"p95DurationMs"` // 按直方图桶上界估算
+}
+
+// priorityWaiter 排队中的请求，获得名额时由释放方关闭 ready
+type priorityWaiter struct {
+	class   string
+	ready   chan struct{}
+	granted bool
+}
+
+// priorityGate 单个 provider 的并发名额与排队队列
+type priorityGate struct {
+	limit       int
+	batchLimit  int
+	active      int
+	activeBatch int
+	interactive []*priorityWaiter
+	batch       []*priorityWaiter
+}
+
+type priorityClassCounters struct {
+	requests uint64
+	queued   uint64
+	timeouts uint64
+	maxWait  float64
+	wait     histogram
+	duration histogram
+}
+
+// priorityStore 优先级配置、各 provider 的并发闸门与按优先级的统计
+type priorityStore struct {
+	mu     sync.Mutex
+	config PriorityConfig
+	gates  map[string]*priorityGate
+	stats  map[string]*priorityClassCounters
+}
+
+// normalizePriorityClass 未知取值返回空字符串
+func normalizePriorityClass(class string) string {
+	switch strings.ToLower(strings.TrimSpace(class)) {
+	case PriorityInteractive:
+		return PriorityInteractive
+	case PriorityBatch:
+		return PriorityBatch
+	}
+	return ""
+}
+
+// Validate 检查配置取值
+func (cfg PriorityConfig) Validate() error {
+	if cfg.DefaultClass != "" && normalizePriorityClass(cfg.DefaultClass) == "" {
+		return fmt.Errorf("invalid default class %q, want interactive or batch", cfg.DefaultClass)
+	}
+	if cfg.BatchShare < 0 || cfg.BatchShare > 100 {
+		return fmt.Errorf("batchShare must be between 0 and 100")
+	}
+	if cfg.MaxWaitMs < 0 {
+		return fmt.Errorf("maxWaitMs must not be negative")
+	}
+	return nil
+}
+
+// priorityConfigPath 优先级配置文件
+func priorityConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "priority.json"), nil
+}
+
+// GetPriorityConfig 获取请求优先级配置
+func (prs *ProviderRelayService) GetPriorityConfig() PriorityConfig {
+	prs.priority.mu.Lock()
+	defer prs.priority.mu.Unlock()
+	cfg := prs.priority.config
+	if cfg.DefaultClass == "" {
+		cfg.DefaultClass = PriorityInteractive
+	}
+	return cfg
+}
+
+// SetPriorityConfig 更新请求优先级配置并持久化
+func (prs *ProviderRelayService) SetPriorityConfig(cfg PriorityConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cfg.DefaultClass = normalizePriorityClass(cfg.DefaultClass)
+	path, err := priorityConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.priority.mu.Lock()
+	prs.priority.config = cfg
+	prs.priority.mu.Unlock()
+	return nil
+}
+
+// loadPriorityConfig 启动时从 priority.json 恢复
+func (prs *ProviderRelayService) loadPriorityConfig() {
+	path, err := priorityConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cfg PriorityConfig
+	if err := json.Unmarshal(data, &cfg); err != nil || cfg.Validate() != nil {
+		fmt.Printf("[Priority] 配置文件 %s 无效，使用默认配置\n", path)
+		return
+	}
+	cfg.DefaultClass = normalizePriorityClass(cfg.DefaultClass)
+	prs.priority.mu.Lock()
+	prs.priority.config = cfg
+	prs.priority.mu.Unlock()
+}
+
+// requestPriority 请求的优先级：请求头优先，其次 API Key 归属规则的默认值，最后是全局默认值
+func (prs *ProviderRelayService) requestPriority(c *gin.Context) string {
+	if class := normalizePriorityClass(c.GetHeader(headerPriority)); class != "" {
+		return class
+	}
+	if rule, ok := prs.matchAttributionRule(clientAPIKey(c)); ok {
+		if class := normalizePriorityClass(rule.Priority); class != "" {
+			return class
+		}
+	}
+	return prs.GetPriorityConfig().DefaultClass
+}
+
+// classCountersLocked 调用方需持有 prs.priority.mu
+func (prs *ProviderRelayService) classCountersLocked(class string) *priorityClassCounters {
+	if prs.priority.stats == nil {
+		prs.priority.stats = make(map[string]*priorityClassCounters)
+	}
+	counters := prs.priority.stats[class]
+	if counters == nil {
+		counters = &priorityClassCounters{}
+		prs.priority.stats[class] = counters
+	}
+	return counters
+}
+
+// admitLocked 按优先级规则判断能否立即占用名额，能则占用
+func (g *priorityGate) admitLocked(class string) bool {
+	if g.active >= g.limit {
+		return false
+	}
+	if class == PriorityBatch {
+		if len(g.interactive) > 0 || g.activeBatch >= g.batchLimit {
+			return false
+		}
+		g.activeBatch++
+	}
+	g.active++
+	return true
+}
+
+// dispatchLocked 把空闲名额依次分配给排队的 interactive、batch 请求
+func (g *priorityGate) dispatchLocked() {
+	for len(g.interactive) > 0 && g.admitLocked(PriorityInteractive) {
+		waiter := g.interactive[0]
+		g.interactive = g.interactive[1:]
+		waiter.granted = true
+		close(waiter.ready)
+	}
+	for len(g.batch) > 0 && g.admitLocked(PriorityBatch) {
+		waiter := g.batch[0]
+		g.batch = g.batch[1:]
+		waiter.granted = true
+		close(waiter.ready)
+	}
+}
+
+// removeWaiterLocked 排队超时或取消时移出队列
+func (g *priorityGate) removeWaiterLocked(waiter *priorityWaiter) {
+	queue := &g.interactive
+	if waiter.class == PriorityBatch {
+		queue = &g.batch
+	}
+	for i, w := range *queue {
+		if w == waiter {
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+			return
+		}
+	}
+}
+
+// acquirePrioritySlot 占用 provider 的并发名额，未设置 maxConcurrent 时直接放行；
+// 返回的 release 必须在上游请求结束后调用
+func (prs *ProviderRelayService) acquirePrioritySlot(ctx context.Context, kind string, provider Provider, class string) (func(), error) {
+	if provider.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	store := &prs.priority
+	key := providerKey(kind, provider.Name)
+
+	store.mu.Lock()
+	share := store.config.BatchShare
+	if share == 0 {
+		share = defaultBatchShare
+	}
+	maxWait := time.Duration(store.config.MaxWaitMs) * time.Millisecond
+	if maxWait == 0 {
+		maxWait = defaultPriorityMaxWait
+	}
+	if store.gates == nil {
+		store.gates = make(map[string]*priorityGate)
+	}
+	gate := store.gates[key]
+	if gate == nil {
+		gate = &priorityGate{}
+		store.gates[key] = gate
+	}
+	gate.limit = provider.MaxConcurrent
+	gate.batchLimit = max(provider.MaxConcurrent*share/100, 1)
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			gate.active--
+			if class == PriorityBatch {
+				gate.activeBatch--
+			}
+			gate.dispatchLocked()
+		})
+	}
+
+	// 同一优先级内先到先得：已有同级请求排队时不插队
+	queue := gate.interactive
+	if class == PriorityBatch {
+		queue = gate.batch
+	}
+	counters := prs.classCountersLocked(class)
+	if len(queue) == 0 && gate.admitLocked(class) {
+		counters.wait.observe(latencyBuckets, 0)
+		store.mu.Unlock()
+		return release, nil
+	}
+	waiter := &priorityWaiter{class: class, ready: make(chan struct{})}
+	if class == PriorityBatch {
+		gate.batch = append(gate.batch, waiter)
+	} else {
+		gate.interactive = append(gate.interactive, waiter)
+	}
+	counters.queued++
+	store.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-waiter.ready:
+	case <-timer.C:
+		err = errPriorityQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	waited := time.Since(start).Seconds()
+	if err != nil && !waiter.granted {
+		gate.removeWaiterLocked(waiter)
+		// interactive 请求离开队列后 batch 可能可以放行
+		gate.dispatchLocked()
+		if errors.Is(err, errPriorityQueueTimeout) {
+			counters.timeouts++
+		}
+		return nil, fmt.Errorf("%w: %s (max %d, waited %.1fs)", err, provider.Name, provider.MaxConcurrent, waited)
+	}
+	counters.wait.observe(latencyBuckets, waited)
+	counters.maxWait = max(counters.maxWait, waited)
+	return release, nil
+}
+
+// observePriorityRequest 记录一次请求在网关内的端到端耗时（含排队与重试）
+func (prs *ProviderRelayService) observePriorityRequest(class string, start time.Time) {
+	prs.priority.mu.Lock()
+	defer prs.priority.mu.Unlock()
+	counters := prs.classCountersLocked(class)
+	counters.requests++
+	counters.duration.observe(latencyBuckets, time.Since(start).Seconds())
+}
+
+// histogramQuantile 按桶上界估算分位数，落在 +Inf 桶时返回最大的有限上界
+func histogramQuantile(h *histogram, buckets []float64, q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	target := uint64(float64(h.count)*q + 0.5)
+	var cumulative uint64
+	for i, le := range buckets {
+		cumulative += h.counts[i]
+		if cumulative >= target {
+			return le
+		}
+	}
+	return buckets[len(buckets)-1]
+}
+
+// GetPriorityStats 按优先级返回请求数、排队情况与延迟
+func (prs *ProviderRelayService) GetPriorityStats() []PriorityClassStats {
+	prs.priority.mu.Lock()
+	defer prs.priority.mu.Unlock()
+	result := make([]PriorityClassStats, 0, 2)
+	for _, class := range []string{PriorityInteractive, PriorityBatch} {
+		stats := PriorityClassStats{Class: class}
+		for _, gate := range prs.priority.gates {
+			if class == PriorityBatch {
+				stats.Waiting += len(gate.batch)
+				stats.Active += gate.activeBatch
+			} else {
+				stats.Waiting += len(gate.interactive)
+				stats.Active += gate.active - gate.activeBatch
+			}
+		}
+		if counters := prs.priority.stats[class]; counters != nil {
+			stats.Requests = counters.requests
+			stats.Queued = counters.queued
+			stats.Timeouts = counters.timeouts
+			stats.MaxWaitMs = counters.maxWait * 1000
+			if counters.wait.count > 0 {
+				stats.AvgWaitMs = counters.wait.sum / float64(counters.wait.count) * 1000
+			}
+			if counters.duration.count > 0 {
+				stats.AvgDurationMs = counters.duration.sum / float64(counters.duration.count) * 1000
+				stats.P95DurationMs = histogramQuantile(&counters.duration, latencyBuckets, 0.95) * 1000
+			}
+		}
+		result = append(result, stats)
+	}
+	return result
+}
+
+// priorityMetrics 以 Prometheus 文本格式输出按优先级的排队与延迟指标
+func (prs *ProviderRelayService) priorityMetrics() string {
+	prs.priority.mu.Lock()
+	defer prs.priority.mu.Unlock()
+
+	var b strings.Builder
+	counters := []struct {
+		name, help string
+		pick       func(*priorityClassCounters) uint64
+	}{
+		{"ailurus_paas_priority_queued_total", "Requests that waited for a provider concurrency slot", func(c *priorityClassCounters) uint64 { return c.queued }},
+		{"ailurus_paas_priority_queue_timeouts_total", "Requests that gave up on a provider after waiting too long for a slot", func(c *priorityClassCounters) uint64 { return c.timeouts }},
+	}
+	for _, family := range counters {
+		fmt.Fprintf(&b, "\n# HELP %s %s\n# TYPE %s counter\n", family.name, family.help, family.name)
+		for _, class := range []string{PriorityInteractive, PriorityBatch} {
+			if c := prs.priority.stats[class]; c != nil {
+				fmt.Fprintf(&b, "%s{class=\"%s\"} %d\n", family.name, class, family.pick(c))
+			}
+		}
+	}
+
+	histograms := []struct {
+		name, help string
+		pick       func(*priorityClassCounters) *histogram
+	}{
+		{"ailurus_paas_priority_queue_wait_seconds", "Time spent waiting for a provider concurrency slot", func(c *priorityClassCounters) *histogram { return &c.wait }},
+		{"ailurus_paas_priority_request_duration_seconds", "End-to-end relay duration including queueing and retries", func(c *priorityClassCounters) *histogram { return &c.duration }},
+	}
+	for _, family := range histograms {
+		fmt.Fprintf(&b, "\n# HELP %s %s\n# TYPE %s histogram\n", family.name, family.help, family.name)
+		for _, class := range []string{PriorityInteractive, PriorityBatch} {
+			c := prs.priority.stats[class]
+			if c == nil || family.pick(c).count == 0 {
+				continue
+			}
+			h := family.pick(c)
+			var cumulative uint64
+			for i, le := range latencyBuckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(&b, "%s_bucket{class=\"%s\",le=\"%g\"} %d\n", family.name, class, le, cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket{class=\"%s\",le=\"+Inf\"} %d\n", family.name, class, h.count)
+			fmt.Fprintf(&b, "%s_sum{class=\"%s\"} %g\n", family.name, class, h.sum)
+			fmt.Fprintf(&b, "%s_count{class=\"%s\"} %d\n", family.name, class, h.count)
+		}
+	}
+	return b.String()
+}
+
+// ===== 管理接口 =====
+
+func (prs *ProviderRelayService) adminGetPriorityConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.GetPriorityConfig())
+}
+
+func (prs *ProviderRelayService) adminUpdatePriorityConfigHandler(c *gin.Context) {
+	var cfg PriorityConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := prs.SetPriorityConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prs.GetPriorityConfig())
+}
+
+func (prs *ProviderRelayService) adminPriorityStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"classes": prs.GetPriorityStats()})
+}
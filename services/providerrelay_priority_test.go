@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPrioritySlotsPreferInteractive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{}
+	provider := Provider{Name: "p", MaxConcurrent: 2}
+	ctx := context.Background()
+
+	acquire := func(class string) func() {
+		t.Helper()
+		release, err := prs.acquirePrioritySlot(ctx, "claude", provider, class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return release
+	}
+	// 排队中的请求获得名额时把 class 写入 order
+	order := make(chan string, 4)
+	releases := make(chan func(), 4)
+	enqueue := func(class string) {
+		go func() {
+			release, err := prs.acquirePrioritySlot(ctx, "claude", provider, class)
+			if err != nil {
+				order <- "error: " + err.Error()
+				return
+			}
+			releases <- release
+			order <- class
+		}()
+	}
+	waitQueued := func(class string, n int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			for _, stats := range prs.GetPriorityStats() {
+				if stats.Class == class && stats.Waiting == n {
+					return
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("%s waiting never reached %d", class, n)
+	}
+
+	// batch 最多占用 50% 的名额
+	releaseBatch := acquire(PriorityBatch)
+	enqueue(PriorityBatch)
+	waitQueued(PriorityBatch, 1)
+	releaseInteractive := acquire(PriorityInteractive)
+	enqueue(PriorityInteractive)
+	waitQueued(PriorityInteractive, 1)
+
+	// 名额释放后先给排队的 interactive
+	releaseBatch()
+	if got := <-order; got != PriorityInteractive {
+		t.Fatalf("first dispatched = %s", got)
+	}
+	releaseInteractive()
+	if got := <-order; got != PriorityBatch {
+		t.Fatalf("second dispatched = %s", got)
+	}
+	(<-releases)()
+	(<-releases)()
+
+	stats := prs.GetPriorityStats()
+	if stats[0].Queued != 1 || stats[1].Queued != 1 || stats[0].Active != 0 || stats[1].Active != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// 排队超时后放弃该 provider
+	if err := prs.SetPriorityConfig(PriorityConfig{MaxWaitMs: 20}); err != nil {
+		t.Fatal(err)
+	}
+	first, second := acquire(PriorityInteractive), acquire(PriorityInteractive)
+	if _, err := prs.acquirePrioritySlot(ctx, "claude", provider, PriorityInteractive); !errors.Is(err, errPriorityQueueTimeout) {
+		t.Fatalf("expected queue timeout, got %v", err)
+	}
+	first()
+	second()
+	if stats := prs.GetPriorityStats(); stats[0].Timeouts != 1 || stats[0].Waiting != 0 {
+		t.Fatalf("stats after timeout = %+v", stats)
+	}
+
+	// 未设置并发上限时不排队
+	unlimited, err := prs.acquirePrioritySlot(ctx, "claude", Provider{Name: "free"}, PriorityBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlimited()
+
+	prs.observePriorityRequest(PriorityBatch, time.Now().Add(-3*time.Second))
+	metrics := prs.priorityMetrics()
+	for _, want := range []string{
+		`ailurus_paas_priority_queue_timeouts_total{class="interactive"} 1`,
+		`ailurus_paas_priority_request_duration_seconds_bucket{class="batch",le="4"} 1`,
+		`ailurus_paas_priority_queue_wait_seconds_count{class="batch"}`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestRequestPriorityResolution(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{}
+	if err := prs.SetAttributionRules([]AttributionRule{{APIKey: "agent-key", Priority: "Batch"}}); err != nil {
+		t.Fatal(err)
+	}
+	resolve := func(header, key string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		if header != "" {
+			c.Request.Header.Set(headerPriority, header)
+		}
+		if key != "" {
+			c.Request.Header.Set("x-api-key", key)
+		}
+		return prs.requestPriority(c)
+	}
+	if got := resolve("", ""); got != PriorityInteractive {
+		t.Fatalf("default = %s", got)
+	}
+	if got := resolve("", "agent-key"); got != PriorityBatch {
+		t.Fatalf("key default = %s", got)
+	}
+	if got := resolve("interactive", "agent-key"); got != PriorityInteractive {
+		t.Fatalf("header override = %s", got)
+	}
+	if err := prs.SetPriorityConfig(PriorityConfig{DefaultClass: "batch"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolve("bogus", ""); got != PriorityBatch {
+		t.Fatalf("configured default = %s", got)
+	}
+	if err := prs.SetPriorityConfig(PriorityConfig{BatchShare: 150}); err == nil {
+		t.Fatal("expected invalid batch share to be rejected")
+	}
+}
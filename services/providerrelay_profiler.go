@@ -0,0 +1,247 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// 慢请求剖析：开启后，总耗时超过阈值的请求会记录各阶段耗时（排队、provider 选择、
+// 上游首字节、流式传输、日志入队）到 slow_request 表，便于把“网关很慢”定位到具体环节。
+// 默认关闭；只有超过阈值的请求才会写库
+
+// ctxKeyRequestProfile 当前请求的耗时剖析
+const ctxKeyRequestProfile = "codeswitch.request_profile"
+
+const (
+	// slowRequestMaxRows slow_request 表保留的最多记录数
+	slowRequestMaxRows = 1000
+	// slowRequestDefaultLimit / slowRequestMaxLimit 查询最慢请求的默认 / 最大条数
+	slowRequestDefaultLimit = 20
+	slowRequestMaxLimit     = 200
+)
+
+// SlowRequest 一次慢请求及其各阶段耗时（秒）
+type SlowRequest struct {
+	ID            int64   `json:"id"`
+	TraceID       string  `json:"trace_id"`
+	Platform      string  `json:"platform"`
+	Provider      string  `json:"provider"`
+	Model         string  `json:"model"`
+	HttpCode      int     `json:"http_code"`
+	IsStream      bool    `json:"is_stream"`
+	Attempts      int     `json:"attempts"`        // 上游请求次数（含 fallback 重试）
+	TotalSec      float64 `json:"total_sec"`       // 收到请求到日志入队完成
+	QueueWaitSec  float64 `json:"queue_wait_sec"`  // 等待优先级并发槽位
+	SelectionSec  float64 `json:"selection_sec"`   // 读取请求体、脚本与内容策略、provider 选择
+	FailoverSec   float64 `json:"failover_sec"`    // 之前失败的上游请求
+	TTFBSec       float64 `json:"ttfb_sec"`        // 最后一次上游请求的首字节时间
+	StreamingSec  float64 `json:"streaming_sec"`   // 首字节之后接收响应
+	LogEnqueueSec float64 `json:"log_enqueue_sec"` // 计价与日志入队
+	CreatedAt     string  `json:"created_at"`
+}
+
+// requestProfile 单个请求的耗时累计，只在处理请求的 goroutine 中读写
+type requestProfile struct {
+	start     time.Time
+	queueWait time.Duration
+	failover  time.Duration
+	attempts  int
+
+	// 最后一次上游请求
+	log           *ReqeustLog
+	upstreamStart time.Time
+	enqueue       time.Duration
+}
+
+// SetSlowRequestThreshold 设置慢请求剖析阈值，0 表示关闭
+func (prs *ProviderRelayService) SetSlowRequestThreshold(threshold time.Duration) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	atomic.StoreInt64(&prs.slowRequestThreshold, int64(threshold))
+}
+
+// SlowRequestThreshold 当前慢请求剖析阈值，0 表示关闭
+func (prs *ProviderRelayService) SlowRequestThreshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&prs.slowRequestThreshold))
+}
+
+// beginRequestProfile 在请求入口开始剖析，返回的函数需在请求结束时调用
+func (prs *ProviderRelayService) beginRequestProfile(c *gin.Context) func() {
+	if prs.SlowRequestThreshold() <= 0 {
+		return func() {}
+	}
+	profile := &requestProfile{start: time.Now()}
+	c.Set(ctxKeyRequestProfile, profile)
+	return func() { prs.finishRequestProfile(profile) }
+}
+
+func requestProfileFrom(c *gin.Context) *requestProfile {
+	if c == nil {
+		return nil
+	}
+	if v, ok := c.Get(ctxKeyRequestProfile); ok {
+		if profile, ok := v.(*requestProfile); ok {
+			return profile
+		}
+	}
+	return nil
+}
+
+// profileQueueWait 记录等待并发槽位的时间
+func profileQueueWait(c *gin.Context, since time.Time) {
+	if profile := requestProfileFrom(c); profile != nil {
+		profile.queueWait += time.Since(since)
+	}
+}
+
+// profileUpstreamAttempt 记录一次上游请求（在日志入队之后调用），之前的尝试计入 failover
+func profileUpstreamAttempt(c *gin.Context, log *ReqeustLog, upstreamStart time.Time, enqueue time.Duration) {
+	profile := requestProfileFrom(c)
+	if profile == nil {
+		return
+	}
+	if profile.log != nil {
+		profile.failover += time.Duration(profile.log.DurationSec*float64(time.Second)) + profile.enqueue
+	}
+	profile.attempts++
+	profile.log = log
+	profile.upstreamStart = upstreamStart
+	profile.enqueue = enqueue
+}
+
+// buildSlowRequest 按阶段拆分请求耗时；未到达上游的请求只有排队与选择阶段
+func (p *requestProfile) buildSlowRequest(end time.Time) SlowRequest {
+	entry := SlowRequest{
+		Attempts:      p.attempts,
+		TotalSec:      end.Sub(p.start).Seconds(),
+		QueueWaitSec:  p.queueWait.Seconds(),
+		FailoverSec:   p.failover.Seconds(),
+		LogEnqueueSec: p.enqueue.Seconds(),
+	}
+	selection := end.Sub(p.start) - p.queueWait
+	if p.log != nil {
+		entry.TraceID = p.log.TraceID
+		entry.Platform = p.log.Platform
+		entry.Provider = p.log.Provider
+		entry.Model = p.log.Model
+		entry.HttpCode = p.log.HttpCode
+		entry.IsStream = p.log.IsStream
+		entry.TTFBSec = p.log.TTFBSec
+		entry.StreamingSec = max(p.log.DurationSec-p.log.TTFBSec, 0)
+		selection = p.upstreamStart.Sub(p.start) - p.queueWait - p.failover
+	}
+	entry.SelectionSec = max(selection.Seconds(), 0)
+	return entry
+}
+
+// finishRequestProfile 请求结束时，超过阈值则写入 slow_request。
+// 此时响应已写完且慢请求很少，直接同步写入
+func (prs *ProviderRelayService) finishRequestProfile(profile *requestProfile) {
+	threshold := prs.SlowRequestThreshold()
+	end := time.Now()
+	if threshold <= 0 || end.Sub(profile.start) < threshold {
+		return
+	}
+	if err := insertSlowRequest(profile.buildSlowRequest(end)); err != nil {
+		fmt.Printf("[Profiler] 记录慢请求失败: %v\n", err)
+	}
+}
+
+func insertSlowRequest(entry SlowRequest) error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`INSERT INTO slow_request (trace_id, platform, provider, model, http_code, is_stream, attempts,
+		total_sec, queue_wait_sec, selection_sec, failover_sec, ttfb_sec, streaming_sec, log_enqueue_sec, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.TraceID, entry.Platform, entry.Provider, entry.Model, entry.HttpCode, entry.IsStream, entry.Attempts,
+		entry.TotalSec, entry.QueueWaitSec, entry.SelectionSec, entry.FailoverSec, entry.TTFBSec, entry.StreamingSec,
+		entry.LogEnqueueSec, time.Now().UTC().Format(timeLayout)); err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM slow_request WHERE id <= (SELECT MAX(id) FROM slow_request) - ?`, slowRequestMaxRows)
+	return err
+}
+
+// querySlowRequests 按总耗时倒序返回最慢的请求
+func querySlowRequests(limit int) ([]SlowRequest, error) {
+	if limit <= 0 {
+		limit = slowRequestDefaultLimit
+	}
+	limit = min(limit, slowRequestMaxLimit)
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT id, trace_id, platform, provider, model, http_code, is_stream, attempts,
+		total_sec, queue_wait_sec, selection_sec, failover_sec, ttfb_sec, streaming_sec, log_enqueue_sec, created_at
+		FROM slow_request ORDER BY total_sec DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]SlowRequest, 0)
+	for rows.Next() {
+		var entry SlowRequest
+		if err := rows.Scan(&entry.ID, &entry.TraceID, &entry.Platform, &entry.Provider, &entry.Model, &entry.HttpCode,
+			&entry.IsStream, &entry.Attempts, &entry.TotalSec, &entry.QueueWaitSec, &entry.SelectionSec, &entry.FailoverSec,
+			&entry.TTFBSec, &entry.StreamingSec, &entry.LogEnqueueSec, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, rows.Err()
+}
+
+// ListSlowRequests 返回最慢的 limit 个请求及其各阶段耗时
+func (ls *LogService) ListSlowRequests(limit int) ([]SlowRequest, error) {
+	return querySlowRequests(limit)
+}
+
+func ensureSlowRequestTable(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS slow_request (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trace_id TEXT NOT NULL DEFAULT '',
+		platform TEXT NOT NULL DEFAULT '',
+		provider TEXT NOT NULL DEFAULT '',
+		model TEXT NOT NULL DEFAULT '',
+		http_code INTEGER DEFAULT 0,
+		is_stream INTEGER DEFAULT 0,
+		attempts INTEGER DEFAULT 0,
+		total_sec REAL DEFAULT 0,
+		queue_wait_sec REAL DEFAULT 0,
+		selection_sec REAL DEFAULT 0,
+		failover_sec REAL DEFAULT 0,
+		ttfb_sec REAL DEFAULT 0,
+		streaming_sec REAL DEFAULT 0,
+		log_enqueue_sec REAL DEFAULT 0,
+		created_at TEXT NOT NULL
+	)`); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_slow_request_total ON slow_request(total_sec)")
+	return err
+}
+
+func (prs *ProviderRelayService) adminSlowRequestsHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	requests, err := querySlowRequests(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"threshold_ms": prs.SlowRequestThreshold().Milliseconds(),
+		"requests":     requests,
+	})
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestProfileBreakdown(t *testing.T) {
+	start := time.Now()
+	profile := &requestProfile{start: start, queueWait: time.Second}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(ctxKeyRequestProfile, profile)
+
+	// 第一次上游请求失败耗时 2s，第二次在 4s 时开始
+	profileUpstreamAttempt(c, &ReqeustLog{Provider: "a", DurationSec: 2, HttpCode: 502}, start.Add(2*time.Second), 0)
+	profileUpstreamAttempt(c, &ReqeustLog{TraceID: "t", Platform: "claude", Provider: "b", HttpCode: 200, IsStream: true, TTFBSec: 0.5, DurationSec: 3},
+		start.Add(4*time.Second), 100*time.Millisecond)
+
+	entry := profile.buildSlowRequest(start.Add(7100 * time.Millisecond))
+	if entry.Provider != "b" || entry.Attempts != 2 || !entry.IsStream {
+		t.Fatalf("expected last attempt details, got %+v", entry)
+	}
+	want := map[string][2]float64{
+		"total":     {entry.TotalSec, 7.1},
+		"queue":     {entry.QueueWaitSec, 1},
+		"failover":  {entry.FailoverSec, 2},
+		"selection": {entry.SelectionSec, 1},
+		"ttfb":      {entry.TTFBSec, 0.5},
+		"streaming": {entry.StreamingSec, 2.5},
+		"enqueue":   {entry.LogEnqueueSec, 0.1},
+	}
+	for name, v := range want {
+		if v[0] < v[1]-0.001 || v[0] > v[1]+0.001 {
+			t.Errorf("%s: expected %.3f, got %.3f", name, v[1], v[0])
+		}
+	}
+
+	// 未到达上游（如被策略拦截）时除排队外都计入选择阶段
+	blocked := &requestProfile{start: start}
+	if entry := blocked.buildSlowRequest(start.Add(time.Second)); entry.SelectionSec != 1 || entry.Attempts != 0 {
+		t.Fatalf("unexpected blocked breakdown %+v", entry)
+	}
+}
+
+func TestSlowRequestProfiler(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	router := gin.New()
+	router.GET("/v1/messages", func(c *gin.Context) {
+		defer prs.beginRequestProfile(c)()
+		queueStart := time.Now()
+		time.Sleep(20 * time.Millisecond)
+		profileQueueWait(c, queueStart)
+		delay, _ := time.ParseDuration(c.Query("delay"))
+		time.Sleep(delay)
+		profileUpstreamAttempt(c, &ReqeustLog{TraceID: c.Query("trace"), Platform: "claude", Provider: "p", HttpCode: 200}, time.Now(), 0)
+		c.Status(http.StatusOK)
+	})
+	call := func(trace, delay string) {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/messages?trace="+trace+"&delay="+delay, nil))
+	}
+
+	call("off", "0s")
+	prs.SetSlowRequestThreshold(10 * time.Millisecond)
+	call("slow", "10ms")
+	call("slower", "40ms")
+	prs.SetSlowRequestThreshold(time.Hour)
+	call("fast", "0s")
+
+	requests, err := (&LogService{}).ListSlowRequests(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[0].TraceID != "slower" || requests[1].TraceID != "slow" {
+		t.Fatalf("expected the two profiled requests slowest first, got %+v", requests)
+	}
+	if got := requests[0]; got.QueueWaitSec < 0.02 || got.SelectionSec < 0.04 || got.Attempts != 1 || got.CreatedAt == "" {
+		t.Fatalf("unexpected breakdown %+v", got)
+	}
+}
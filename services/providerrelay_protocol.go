@@ -0,0 +1,192 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"codeswitch/services/toolconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 协议转换：provider 声明的接口格式（apiFormat）与客户端协议不同时，在 Anthropic Messages 与
+// OpenAI Chat Completions 之间转换本次尝试的请求，并把响应（含流式响应中的并行工具调用与参数分片）
+// 转换回客户端协议。转换细节见 toolconv 包；用量按上游格式解析后正常记录
+
+const (
+	// APIFormatAnthropic provider 只提供 Anthropic Messages 接口（/v1/messages）
+	APIFormatAnthropic = "anthropic"
+	// APIFormatOpenAI provider 只提供 OpenAI Chat Completions 接口（/v1/chat/completions）
+	APIFormatOpenAI = "openai"
+
+	messagesEndpoint        = "/v1/messages"
+	chatCompletionsEndpoint = "/v1/chat/completions"
+
+	// anthropicAPIVersion 转换为 Anthropic 请求时使用的 anthropic-version
+	anthropicAPIVersion = "2023-06-01"
+
+	// ctxKeyUpstreamFormat 本次尝试转换后的上游接口格式，未转换时为空
+	ctxKeyUpstreamFormat = "codeswitch.upstream_format"
+)
+
+// validAPIFormat 空值表示与平台协议一致，不转换
+func validAPIFormat(format string) bool {
+	switch format {
+	case "", APIFormatAnthropic, APIFormatOpenAI:
+		return true
+	}
+	return false
+}
+
+// upstreamFormat 本次尝试的上游接口格式（已转换时）
+func upstreamFormat(c *gin.Context) string {
+	if c == nil {
+		return ""
+	}
+	return c.GetString(ctxKeyUpstreamFormat)
+}
+
+// usageParserFor 按上游实际返回的格式选择用量解析函数
+func usageParserFor(c *gin.Context, kind string) func(string, *ReqeustLog) {
+	switch upstreamFormat(c) {
+	case APIFormatOpenAI:
+		return CodexParseTokenUsageFromResponse
+	case APIFormatAnthropic:
+		return ClaudeCodeParseTokenUsageFromResponse
+	}
+	if kind == "codex" {
+		return CodexParseTokenUsageFromResponse
+	}
+	return ClaudeCodeParseTokenUsageFromResponse
+}
+
+// applyUpstreamFormatHeaders 转换后按上游协议调整请求头：
+// 发往 Anthropic 接口时补充 x-api-key 与 anthropic-version，发往 OpenAI 接口时去掉 Anthropic 专有请求头
+func applyUpstreamFormatHeaders(c *gin.Context, provider Provider, headers map[string]string) {
+	switch upstreamFormat(c) {
+	case APIFormatAnthropic:
+		if provider.AuthType != AuthTypeOAuth && provider.APIKey != "" {
+			deleteHeader(headers, "x-api-key")
+			headers["x-api-key"] = provider.APIKey
+		}
+		if getHeader(headers, "anthropic-version") == "" {
+			headers["anthropic-version"] = anthropicAPIVersion
+		}
+	case APIFormatOpenAI:
+		for _, name := range []string{"x-api-key", "anthropic-version", "anthropic-beta"} {
+			deleteHeader(headers, name)
+		}
+	}
+}
+
+// streamConverter 流式响应转换器（toolconv 的两个方向）
+type streamConverter interface {
+	Write(p []byte) []byte
+	Finish() []byte
+}
+
+// protocolResponseWriter 把写给客户端的上游响应转换为客户端协议；非 2xx 响应原样透传
+type protocolResponseWriter struct {
+	gin.ResponseWriter
+	stream    streamConverter              // 流式响应
+	convert   func([]byte) ([]byte, error) // 非流式响应
+	buffered  bytes.Buffer                 // 非流式：完整响应
+	converted bool                         // 已有内容经过转换，需要在结束时补齐
+}
+
+func (w *protocolResponseWriter) converting() bool {
+	status := w.ResponseWriter.Status()
+	return status >= http.StatusOK && status < http.StatusMultipleChoices
+}
+
+func (w *protocolResponseWriter) WriteHeader(code int) {
+	if code >= http.StatusOK && code < http.StatusMultipleChoices {
+		// 转换后长度变化，去掉上游的 Content-Length
+		w.ResponseWriter.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *protocolResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *protocolResponseWriter) Write(data []byte) (int, error) {
+	if !w.converting() {
+		return w.ResponseWriter.Write(data)
+	}
+	w.converted = true
+	if w.stream == nil {
+		w.buffered.Write(data)
+		return len(data), nil
+	}
+	if out := w.stream.Write(data); len(out) > 0 {
+		if _, err := w.ResponseWriter.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// finish 流式响应补齐结束事件；非流式响应整体转换，无法转换时原样返回
+func (w *protocolResponseWriter) finish() {
+	if !w.converted {
+		return
+	}
+	if w.stream != nil {
+		if out := w.stream.Finish(); len(out) > 0 {
+			w.ResponseWriter.Write(out)
+		}
+		return
+	}
+	data := w.buffered.Bytes()
+	if converted, err := w.convert(data); err == nil {
+		data = converted
+	} else {
+		fmt.Printf("[Protocol] 响应转换失败，原样返回: %v\n", err)
+	}
+	w.ResponseWriter.Write(data)
+	w.buffered.Reset()
+}
+
+// adaptProviderProtocol 按 provider 的 apiFormat 转换本次尝试的请求，并临时替换 c.Writer 转换响应；
+// 返回的 restore 在本次尝试结束后调用
+func adaptProviderProtocol(c *gin.Context, provider Provider, endpoint string, body []byte, stream bool, model string) (string, []byte, func(), error) {
+	var (
+		target    string
+		convert   func([]byte) ([]byte, error)
+		converter streamConverter
+		respond   func([]byte) ([]byte, error)
+	)
+	switch {
+	case endpoint == messagesEndpoint && provider.APIFormat == APIFormatOpenAI:
+		target, convert, respond = chatCompletionsEndpoint, toolconv.AnthropicToOpenAIRequest, toolconv.OpenAIToAnthropicResponse
+		if stream {
+			converter = toolconv.NewOpenAIToAnthropicStream(model)
+		}
+	case endpoint == chatCompletionsEndpoint && provider.APIFormat == APIFormatAnthropic:
+		target, convert, respond = messagesEndpoint, toolconv.OpenAIToAnthropicRequest, toolconv.AnthropicToOpenAIResponse
+		if stream {
+			converter = toolconv.NewAnthropicToOpenAIStream(gjson.GetBytes(body, "stream_options.include_usage").Bool())
+		}
+	default:
+		return endpoint, body, func() {}, nil
+	}
+
+	converted, err := convert(body)
+	if err != nil {
+		return endpoint, body, func() {}, fmt.Errorf("转换为 %s 格式失败: %w", provider.APIFormat, err)
+	}
+	c.Set(ctxKeyUpstreamFormat, provider.APIFormat)
+	original := c.Writer
+	writer := &protocolResponseWriter{ResponseWriter: original, stream: converter, convert: respond}
+	c.Writer = writer
+	restore := func() {
+		writer.finish()
+		c.Writer = original
+		c.Set(ctxKeyUpstreamFormat, "")
+	}
+	return target, converted, restore, nil
+}
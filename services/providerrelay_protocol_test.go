@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+type protocolUpstream struct {
+	path   string
+	body   string
+	header http.Header
+}
+
+func runProtocolConversion(t *testing.T, kind string, provider Provider, endpoint, body, reply, contentType string, clientHeaders map[string]string) (*httptest.ResponseRecorder, *protocolUpstream, *ReqeustLog) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	got := &protocolUpstream{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got.path, got.body, got.header = r.URL.Path, string(data), r.Header.Clone()
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(upstream.Close)
+
+	prs := &ProviderRelayService{logWriteQueue: make(chan *ReqeustLog, 1)}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(body))
+	provider.APIURL, provider.APIKey = upstream.URL, "k"
+	stream := gjson.Get(body, "stream").Bool()
+	ok, err := prs.forwardRequest(c, kind, provider, endpoint, nil, clientHeaders, []byte(body), stream, "m")
+	if !ok || err != nil {
+		t.Fatalf("forwardRequest = %v, %v", ok, err)
+	}
+	if c.GetString(ctxKeyUpstreamFormat) != "" {
+		t.Fatal("upstream format must be reset after the attempt")
+	}
+	return w, got, <-prs.logWriteQueue
+}
+
+// Claude Code 的流式工具调用请求经 OpenAI 格式的 provider 转发，并行工具调用的 ID 与分片参数完整还原
+func TestProtocolConversionClaudeToOpenAIStream(t *testing.T) {
+	reply, err := os.ReadFile("toolconv/testdata/openai_parallel_tools.sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"model":"m","max_tokens":100,"stream":true,"system":"be brief",
+		"tools":[{"name":"get_weather","description":"weather","input_schema":{"type":"object","properties":{"location":{"type":"string"}}}}],
+		"messages":[{"role":"user","content":"weather in Paris and Bogotá?"},
+			{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"location":"Lima"}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"sunny"},{"type":"text","text":"and now?"}]}]}`
+	w, upstream, log := runProtocolConversion(t, "claude", Provider{Name: "p", APIFormat: APIFormatOpenAI}, messagesEndpoint, body,
+		string(reply), "text/event-stream", map[string]string{"x-api-key": "client-key", "anthropic-version": "2023-06-01"})
+
+	if upstream.path != chatCompletionsEndpoint {
+		t.Fatalf("upstream path = %s", upstream.path)
+	}
+	req := gjson.Parse(upstream.body)
+	if req.Get("messages.0.role").String() != "system" || req.Get("tools.0.function.name").String() != "get_weather" ||
+		req.Get("messages.2.tool_calls.0.id").String() != "toolu_1" || req.Get("messages.3.tool_call_id").String() != "toolu_1" ||
+		!req.Get("stream_options.include_usage").Bool() {
+		t.Fatalf("upstream body = %s", upstream.body)
+	}
+	if upstream.header.Get("x-api-key") != "" || upstream.header.Get("anthropic-version") != "" || upstream.header.Get("Authorization") != "Bearer k" {
+		t.Fatalf("upstream headers = %v", upstream.header)
+	}
+
+	// 解析客户端收到的 Anthropic 事件，按内容块拼接工具参数
+	ids := map[int64]string{}
+	inputs := map[int64]string{}
+	var stopReason string
+	var events []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := gjson.Parse(strings.TrimPrefix(line, "data: "))
+		events = append(events, data.Get("type").String())
+		switch data.Get("type").String() {
+		case "content_block_start":
+			ids[data.Get("index").Int()] = data.Get("content_block.id").String()
+		case "content_block_delta":
+			inputs[data.Get("index").Int()] += data.Get("delta.partial_json").String()
+		case "message_delta":
+			stopReason = data.Get("delta.stop_reason").String()
+		}
+	}
+	if events[0] != "message_start" || events[len(events)-1] != "message_stop" || stopReason != "tool_use" {
+		t.Fatalf("client events = %v (stop_reason=%s)", events, stopReason)
+	}
+	if ids[0] != "call_XQVX1zLtWbHq" || ids[1] != "call_bRb0PnVf7nQK" ||
+		gjson.Get(inputs[0], "location").String() != "Paris, France" || gjson.Get(inputs[1], "location").String() != "Bogotá, Colombia" {
+		t.Fatalf("tool calls = %v %v", ids, inputs)
+	}
+	if log.InputTokens != 81 || log.OutputTokens != 46 {
+		t.Fatalf("usage = %d/%d", log.InputTokens, log.OutputTokens)
+	}
+}
+
+// Chat Completions 请求经 Anthropic 格式的 provider 转发，tool_use 还原为 tool_calls
+func TestProtocolConversionOpenAIToAnthropic(t *testing.T) {
+	body := `{"model":"m","messages":[{"role":"user","content":"weather?"}],
+		"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}],"tool_choice":"required"}`
+	reply := `{"id":"msg_1","type":"message","role":"assistant","model":"m","stop_reason":"tool_use",
+		"content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_9","name":"get_weather","input":{"location":"Paris"}}],
+		"usage":{"input_tokens":12,"output_tokens":7}}`
+	w, upstream, log := runProtocolConversion(t, "codex", Provider{Name: "p", APIFormat: APIFormatAnthropic}, chatCompletionsEndpoint, body,
+		reply, "application/json", map[string]string{"Authorization": "Bearer client"})
+
+	req := gjson.Parse(upstream.body)
+	if upstream.path != messagesEndpoint || req.Get("max_tokens").Int() == 0 || req.Get("tool_choice.type").String() != "any" ||
+		req.Get("tools.0.input_schema.type").String() != "object" {
+		t.Fatalf("upstream %s body = %s", upstream.path, upstream.body)
+	}
+	if upstream.header.Get("x-api-key") != "k" || upstream.header.Get("anthropic-version") != anthropicAPIVersion {
+		t.Fatalf("upstream headers = %v", upstream.header)
+	}
+
+	resp := gjson.Parse(w.Body.String())
+	call := resp.Get("choices.0.message.tool_calls.0")
+	if resp.Get("object").String() != "chat.completion" || resp.Get("choices.0.finish_reason").String() != "tool_calls" ||
+		call.Get("id").String() != "toolu_9" || gjson.Get(call.Get("function.arguments").String(), "location").String() != "Paris" {
+		t.Fatalf("client got %s", w.Body.String())
+	}
+	if log.InputTokens != 12 || log.OutputTokens != 7 {
+		t.Fatalf("usage = %d/%d", log.InputTokens, log.OutputTokens)
+	}
+}
+
+func TestProtocolConversionSkippedForMatchingFormat(t *testing.T) {
+	reply := `{"id":"msg_1","type":"message","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":1,"output_tokens":1}}`
+	w, upstream, _ := runProtocolConversion(t, "claude", Provider{Name: "p", APIFormat: APIFormatAnthropic}, messagesEndpoint,
+		`{"model":"m","max_tokens":5,"messages":[{"role":"user","content":"hi"}]}`, reply, "application/json", map[string]string{})
+	if upstream.path != messagesEndpoint || w.Body.String() != reply {
+		t.Fatalf("passthrough: path=%s client=%s", upstream.path, w.Body.String())
+	}
+	if !validAPIFormat("") || validAPIFormat("gemini") {
+		t.Fatal("unexpected apiFormat validation")
+	}
+}
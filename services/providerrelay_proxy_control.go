@@ -4,25 +4,19 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// ProxyControlMiddleware returns middleware that checks if proxy is enabled for the app
+// ProxyControlMiddleware returns middleware that checks the proxy switch and request rules of the app.
+// The model is not known before the body is read, so model rules are left to proxyHandler.
 func (prs *ProviderRelayService) ProxyControlMiddleware(proxyController *ProxyController) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Detect app from request path
-		appName := detectAppFromPath(c.Request.URL.Path)
-
-		// Check if proxy is enabled for this app
-		if !proxyController.IsProxyEnabled(appName) {
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error":   fmt.Sprintf("%s proxy is currently disabled", appName),
-				"type":    "proxy_disabled",
-				"app":     appName,
-				"message": "Please enable proxy for this application in settings",
-			})
-			c.Abort()
+		appName := fingerprintClient(c.Request.Header, c.Request.URL.Path, nil).App
+
+		if violation := proxyController.Evaluate(appName, c.Request.URL.Path, "", time.Now()); violation != nil {
+			abortWithProxyViolation(c, appName, violation)
 			return
 		}
 
@@ -34,6 +28,31 @@ func (prs *ProviderRelayService) ProxyControlMiddleware(proxyController *ProxyCo
 	}
 }
 
+// rejectByProxyRules evaluates the proxy switch and rules for a relayed request and
+// writes the rejection when one applies. It returns true if the request was rejected.
+func (prs *ProviderRelayService) rejectByProxyRules(c *gin.Context, body []byte, model string) bool {
+	if prs.proxyController == nil {
+		return false
+	}
+	appName := clientFingerprintFor(c, body).App
+	if violation := prs.proxyController.Evaluate(appName, c.Request.URL.Path, model, time.Now()); violation != nil {
+		fmt.Printf("[ProxyControl] %s request to %s rejected by %s\n", appName, c.Request.URL.Path, violation.Rule)
+		abortWithProxyViolation(c, appName, violation)
+		return true
+	}
+	go prs.proxyController.RecordRequest(appName)
+	return false
+}
+
+func abortWithProxyViolation(c *gin.Context, appName string, violation *ProxyRuleViolation) {
+	c.AbortWithStatusJSON(violation.Status, gin.H{
+		"error":   violation.Message,
+		"type":    violation.Rule,
+		"app":     appName,
+		"message": "Adjust the proxy rules for this application in settings",
+	})
+}
+
 // detectAppFromPath detects application name from request path
 func detectAppFromPath(path string) string {
 	path = strings.ToLower(path)
@@ -185,6 +204,44 @@ func (pce *ProxyControlExtension) HandleUpdateProxyConfig(c *gin.Context) {
 	})
 }
 
+// HandleUpdateProxyRules replaces the request rules of an app
+func (pce *ProxyControlExtension) HandleUpdateProxyRules(c *gin.Context) {
+	appName := c.Param("app")
+	if appName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "app name is required",
+		})
+		return
+	}
+
+	var rules ProxyRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+	if err := rules.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := pce.proxyController.SetRules(appName, &rules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("failed to update proxy rules: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"app":     appName,
+		"rules":   rules,
+	})
+}
+
 // RegisterProxyControlRoutes registers proxy control API routes
 func (pce *ProxyControlExtension) RegisterProxyControlRoutes(router gin.IRouter) {
 	// Get all proxy configurations
@@ -198,4 +255,7 @@ func (pce *ProxyControlExtension) RegisterProxyControlRoutes(router gin.IRouter)
 
 	// Update proxy configuration
 	router.PUT("/api/proxy-control/:app", pce.HandleUpdateProxyConfig)
+
+	// Replace request rules for an app
+	router.PUT("/api/proxy-control/:app/rules", pce.HandleUpdateProxyRules)
 }
@@ -0,0 +1,876 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 响应质量评分：请求成功后对响应做后置检查（正则、工具调用 JSON 合法性、LLM 评审），
+// 按 provider / 模型记录 0-1 分到 response_quality 表，用于对比看板与自适应路由
+
+// 内置评分规则类型
+const (
+	QualityRuleRegex         = "regex"           // 响应文本需匹配（或不得匹配）正则
+	QualityRuleJSONToolCalls = "json_tool_calls" // 工具调用参数必须是合法 JSON
+	QualityRuleLLMJudge      = "llm_judge"       // 由指定的廉价模型打分
+)
+
+const (
+	// defaultQualityMaxResponseBytes 用于评分的响应最多缓存的字节数
+	defaultQualityMaxResponseBytes = 256 * 1024
+	// defaultQualityMinSamples 自适应路由判定所需的最少评分次数
+	defaultQualityMinSamples = 20
+	// qualityWorkers 同时进行的评分数，超出时丢弃样本，避免评审请求堆积
+	qualityWorkers = 4
+	// qualityEWMAAlpha 内存中滚动平均分的平滑系数
+	qualityEWMAAlpha = 0.1
+	// qualityJudgeInputLimit 发给评审模型的请求 / 响应最大字符数
+	qualityJudgeInputLimit = 4000
+)
+
+const defaultJudgePrompt = `You are grading an AI assistant's answer. Rate the quality of the response from 1 to 10, considering correctness, relevance to the request and completeness. Reply with only the number.
+
+[Request]
+%s
+
+[Response]
+%s`
+
+// QualityRule 可配置的内置评分规则
+type QualityRule struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Pattern      string   `json:"pattern,omitempty"`        // regex 规则的正则
+	MustNotMatch bool     `json:"must_not_match,omitempty"` // regex 规则：命中即 0 分（如拒答话术）
+	Platforms    []string `json:"platforms,omitempty"`      // 为空时适用所有平台
+	Models       []string `json:"models,omitempty"`         // 为空时适用所有模型，支持 * 通配符
+	SampleRate   float64  `json:"sample_rate,omitempty"`    // 0-1，未设置为 1；llm_judge 建议使用较低比例
+	Disabled     bool     `json:"disabled,omitempty"`
+
+	// llm_judge 规则：评审使用的 provider（平台默认与请求相同）、模型与提示词（含两个 %s：请求、响应）
+	JudgePlatform string `json:"judge_platform,omitempty"`
+	JudgeProvider string `json:"judge_provider,omitempty"`
+	JudgeModel    string `json:"judge_model,omitempty"`
+	JudgePrompt   string `json:"judge_prompt,omitempty"`
+}
+
+// QualityConfig 响应质量评分配置
+type QualityConfig struct {
+	Enabled          bool          `json:"enabled"`
+	SampleRate       float64       `json:"sample_rate,omitempty"`        // 参与评分的请求比例，未设置为 1
+	MaxResponseBytes int           `json:"max_response_bytes,omitempty"` // 超过时只评分开头部分
+	MinScore         float64       `json:"min_score,omitempty"`          // 自适应路由：滚动平均分低于该值的 provider 移到最后，0 为关闭
+	MinSamples       int           `json:"min_samples,omitempty"`        // 自适应路由判定所需的最少评分次数，默认 20
+	Rules            []QualityRule `json:"rules"`
+}
+
+// QualitySample 待评分的一次成功请求
+type QualitySample struct {
+	TraceID       string
+	Platform      string
+	Provider      string
+	Model         string
+	Request       []byte
+	Response      []byte   // 原始响应（JSON 或 SSE）
+	Text          string   // 提取出的输出文本
+	ToolArguments []string // 提取出的工具调用参数
+	Truncated     bool
+}
+
+// QualityHook 响应评分钩子；ok 为 false 表示不适用于该样本（不记录）
+type QualityHook interface {
+	Name() string
+	Evaluate(sample *QualitySample) (score float64, detail string, ok bool)
+}
+
+// QualityScore 单个钩子的评分结果
+type QualityScore struct {
+	Hook   string  `json:"hook"`
+	Score  float64 `json:"score"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// QualitySummary 按 provider / 模型 / 钩子聚合的评分
+type QualitySummary struct {
+	Provider string  `json:"provider"`
+	Model    string  `json:"model"`
+	Hook     string  `json:"hook"`
+	Samples  int64   `json:"samples"`
+	AvgScore float64 `json:"avg_score"`
+}
+
+// qualityAverage provider 的滚动平均分
+type qualityAverage struct {
+	score   float64
+	samples int
+}
+
+// qualityState 评分配置、已编译的规则、代码注册的钩子与滚动平均分
+type qualityState struct {
+	mu       sync.RWMutex
+	config   QualityConfig
+	rules    []QualityHook
+	custom   []QualityHook
+	averages map[string]*qualityAverage // 平台/provider -> 滚动平均分
+	once     sync.Once
+	workers  chan struct{}
+}
+
+// qualityConfigPath 评分配置文件
+func qualityConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "quality-scoring.json"), nil
+}
+
+// GetQualityConfig 获取响应质量评分配置
+func (prs *ProviderRelayService) GetQualityConfig() QualityConfig {
+	prs.quality.mu.RLock()
+	defer prs.quality.mu.RUnlock()
+	cfg := prs.quality.config
+	cfg.Rules = append([]QualityRule{}, cfg.Rules...)
+	return cfg
+}
+
+// SetQualityConfig 更新评分配置，持久化到 quality-scoring.json
+func (prs *ProviderRelayService) SetQualityConfig(cfg QualityConfig) error {
+	hooks, err := compileQualityRules(prs, cfg)
+	if err != nil {
+		return err
+	}
+	path, err := qualityConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.quality.mu.Lock()
+	prs.quality.config = cfg
+	prs.quality.rules = hooks
+	prs.quality.mu.Unlock()
+	return nil
+}
+
+// loadQualityConfig 启动时从 quality-scoring.json 恢复
+func (prs *ProviderRelayService) loadQualityConfig() {
+	path, err := qualityConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cfg QualityConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("[Quality] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	hooks, err := compileQualityRules(prs, cfg)
+	if err != nil {
+		fmt.Printf("[Quality] 评分规则无效，已停用: %v\n", err)
+		return
+	}
+	prs.quality.mu.Lock()
+	prs.quality.config = cfg
+	prs.quality.rules = hooks
+	prs.quality.mu.Unlock()
+}
+
+// RegisterQualityHook 注册自定义评分钩子，评分开启后对所有采样请求生效
+func (prs *ProviderRelayService) RegisterQualityHook(hook QualityHook) {
+	prs.quality.mu.Lock()
+	prs.quality.custom = append(prs.quality.custom, hook)
+	prs.quality.mu.Unlock()
+}
+
+// Validate 检查规则类型与参数
+func (r QualityRule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("评分规则名称不能为空")
+	}
+	if r.SampleRate < 0 || r.SampleRate > 1 {
+		return fmt.Errorf("评分规则 %s 的 sample_rate 必须在 0-1 之间", r.Name)
+	}
+	switch r.Type {
+	case QualityRuleRegex:
+		if r.Pattern == "" {
+			return fmt.Errorf("评分规则 %s 缺少 pattern", r.Name)
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("评分规则 %s 的正则无效: %v", r.Name, err)
+		}
+	case QualityRuleJSONToolCalls:
+	case QualityRuleLLMJudge:
+		if r.JudgeProvider == "" || r.JudgeModel == "" {
+			return fmt.Errorf("评分规则 %s 需要 judge_provider 与 judge_model", r.Name)
+		}
+	default:
+		return fmt.Errorf("评分规则 %s 的类型 %q 无效", r.Name, r.Type)
+	}
+	return nil
+}
+
+// compileQualityRules 校验配置并生成内置规则的钩子
+func compileQualityRules(prs *ProviderRelayService, cfg QualityConfig) ([]QualityHook, error) {
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("sample_rate 必须在 0-1 之间")
+	}
+	if cfg.MinScore < 0 || cfg.MinScore > 1 {
+		return nil, fmt.Errorf("min_score 必须在 0-1 之间")
+	}
+	seen := make(map[string]bool, len(cfg.Rules))
+	hooks := make([]QualityHook, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("评分规则 %s 重复", rule.Name)
+		}
+		seen[rule.Name] = true
+		if rule.Disabled {
+			continue
+		}
+		hook := &ruleQualityHook{rule: rule, prs: prs}
+		if rule.Type == QualityRuleRegex {
+			hook.re = regexp.MustCompile(rule.Pattern)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// ruleQualityHook 内置规则的评分实现
+type ruleQualityHook struct {
+	rule QualityRule
+	re   *regexp.Regexp
+	prs  *ProviderRelayService
+}
+
+func (h *ruleQualityHook) Name() string { return h.rule.Name }
+
+// applies 按平台、模型与采样比例判断规则是否适用
+func (h *ruleQualityHook) applies(sample *QualitySample) bool {
+	if len(h.rule.Platforms) > 0 && !containsFold(h.rule.Platforms, sample.Platform) {
+		return false
+	}
+	if len(h.rule.Models) > 0 {
+		matched := false
+		for _, pattern := range h.rule.Models {
+			if matchWildcard(pattern, sample.Model) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return h.rule.SampleRate == 0 || rand.Float64() < h.rule.SampleRate
+}
+
+func (h *ruleQualityHook) Evaluate(sample *QualitySample) (float64, string, bool) {
+	if !h.applies(sample) {
+		return 0, "", false
+	}
+	switch h.rule.Type {
+	case QualityRuleRegex:
+		matched := h.re.MatchString(sample.Text)
+		if matched == h.rule.MustNotMatch {
+			if matched {
+				return 0, "响应命中禁止的内容", true
+			}
+			return 0, "响应未匹配期望的内容", true
+		}
+		return 1, "", true
+	case QualityRuleJSONToolCalls:
+		return scoreToolCallJSON(sample)
+	case QualityRuleLLMJudge:
+		score, detail, err := h.prs.judgeResponse(h.rule, sample)
+		if err != nil {
+			fmt.Printf("[Quality] LLM 评审失败 (trace_id=%s, rule=%s): %v\n", sample.TraceID, h.rule.Name, err)
+			return 0, "", false
+		}
+		return score, detail, true
+	}
+	return 0, "", false
+}
+
+// scoreToolCallJSON 合法 JSON 参数所占比例；没有工具调用（或响应被截断）时不评分
+func scoreToolCallJSON(sample *QualitySample) (float64, string, bool) {
+	if len(sample.ToolArguments) == 0 || sample.Truncated {
+		return 0, "", false
+	}
+	invalid := 0
+	for _, args := range sample.ToolArguments {
+		if strings.TrimSpace(args) != "" && !json.Valid([]byte(args)) {
+			invalid++
+		}
+	}
+	total := len(sample.ToolArguments)
+	detail := ""
+	if invalid > 0 {
+		detail = fmt.Sprintf("%d/%d 个工具调用参数不是合法 JSON", invalid, total)
+	}
+	return float64(total-invalid) / float64(total), detail, true
+}
+
+// judgeResponse 请求评审模型为响应打分（1-10），换算为 0-1
+func (prs *ProviderRelayService) judgeResponse(rule QualityRule, sample *QualitySample) (float64, string, error) {
+	platform := rule.JudgePlatform
+	if platform == "" {
+		platform = sample.Platform
+	}
+	template := rule.JudgePrompt
+	if template == "" {
+		template = defaultJudgePrompt
+	}
+	prompt := fmt.Sprintf(template, truncateRunes(string(sample.Request), qualityJudgeInputLimit), truncateRunes(sample.Text, qualityJudgeInputLimit))
+
+	answer, err := prs.completeWithProvider(platform, rule.JudgeProvider, rule.JudgeModel, prompt, 16, 30*time.Second)
+	if err != nil {
+		return 0, "", err
+	}
+	score, ok := parseJudgeScore(answer)
+	if !ok {
+		return 0, "", fmt.Errorf("无法解析评审结果 %q", truncateRunes(answer, 100))
+	}
+	return score, fmt.Sprintf("%s: %s", rule.JudgeModel, answer), nil
+}
+
+// completeWithProvider 向指定 provider 发送单轮非流式请求并返回回复文本；
+// claude 平台使用 Messages API，其余平台使用 Chat Completions
+func (prs *ProviderRelayService) completeWithProvider(platform, providerName, model, prompt string, maxTokens int, timeout time.Duration) (string, error) {
+	providers, err := prs.providerService.LoadProviders(platform)
+	if err != nil {
+		return "", err
+	}
+	var target *Provider
+	for i := range providers {
+		if providers[i].Name == providerName {
+			target = &providers[i]
+			break
+		}
+	}
+	if target == nil {
+		return "", fmt.Errorf("provider %s/%s 不存在", platform, providerName)
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	if err := prs.applyProviderAuth(platform, *target, headers); err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(target.APIURL, "/")
+	endpoint, answerPath := "/chat/completions", "choices.0.message.content"
+	payload := map[string]interface{}{
+		"model":      model,
+		"max_tokens": maxTokens,
+		"messages":   []map[string]string{{"role": "user", "content": prompt}},
+	}
+	if platform == "claude" {
+		endpoint, answerPath = "/messages", "content.0.text"
+		if target.AuthType != AuthTypeOAuth && target.APIKey != "" {
+			headers["x-api-key"] = target.APIKey
+		}
+		headers["anthropic-version"] = "2023-06-01"
+	}
+	if !strings.HasSuffix(base, "/v1") {
+		base += "/v1"
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, base+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s/%s 请求返回 HTTP %d", platform, providerName, resp.StatusCode)
+	}
+	return strings.TrimSpace(gjson.GetBytes(respBody, answerPath).String()), nil
+}
+
+var judgeScorePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// parseJudgeScore 取评审回复中的第一个数字（1-10）并换算为 0-1
+func parseJudgeScore(answer string) (float64, bool) {
+	match := judgeScorePattern.FindString(answer)
+	if match == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(match, 64)
+	if err != nil || value < 0 || value > 10 {
+		return 0, false
+	}
+	return value / 10, true
+}
+
+// truncateRunes 按字符截断
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
+
+// ResponseToolCall 响应中的一次工具调用
+type ResponseToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// extractResponseContent 从 JSON 或 SSE 响应中提取输出文本与工具调用参数
+// （Anthropic Messages / OpenAI Chat / Responses / Gemini）
+func extractResponseContent(raw []byte) (string, []string) {
+	text, calls := parseResponseOutput(raw)
+	args := make([]string, 0, len(calls))
+	for _, call := range calls {
+		args = append(args, call.Arguments)
+	}
+	return text, args
+}
+
+// parseResponseOutput 从 JSON 或 SSE 响应中提取输出文本与工具调用（含名称与 ID）
+func parseResponseOutput(raw []byte) (string, []ResponseToolCall) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '{' && gjson.ValidBytes(trimmed) {
+		return parseJSONResponse(gjson.ParseBytes(trimmed))
+	}
+
+	var text strings.Builder
+	tools := make(map[string]*ResponseToolCall)
+	args := make(map[string]*strings.Builder)
+	tool := func(key string) *ResponseToolCall {
+		if tools[key] == nil {
+			tools[key] = &ResponseToolCall{}
+			args[key] = &strings.Builder{}
+		}
+		return tools[key]
+	}
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if line == "" || line == "[DONE]" || !gjson.Valid(line) {
+			continue
+		}
+		event := gjson.Parse(line)
+		switch eventType := event.Get("type").String(); {
+		case eventType == "content_block_start" && event.Get("content_block.type").String() == "tool_use":
+			call := tool("anthropic:" + event.Get("index").String())
+			call.ID, call.Name = event.Get("content_block.id").String(), event.Get("content_block.name").String()
+		case eventType == "content_block_delta":
+			if partial := event.Get("delta.partial_json"); partial.Exists() {
+				key := "anthropic:" + event.Get("index").String()
+				tool(key)
+				args[key].WriteString(partial.String())
+			} else {
+				text.WriteString(event.Get("delta.text").String())
+			}
+		case eventType == "response.output_text.delta":
+			text.WriteString(event.Get("delta").String())
+		case eventType == "response.output_item.added" && event.Get("item.type").String() == "function_call":
+			call := tool("responses:" + event.Get("item.id").String())
+			call.ID, call.Name = event.Get("item.call_id").String(), event.Get("item.name").String()
+		case eventType == "response.function_call_arguments.done":
+			key := "responses:" + event.Get("item_id").String()
+			tool(key)
+			args[key].WriteString(event.Get("arguments").String())
+		case event.Get("choices").Exists():
+			text.WriteString(event.Get("choices.0.delta.content").String())
+			event.Get("choices.0.delta.tool_calls").ForEach(func(_, delta gjson.Result) bool {
+				key := "openai:" + delta.Get("index").String()
+				call := tool(key)
+				if id := delta.Get("id").String(); id != "" {
+					call.ID = id
+				}
+				if name := delta.Get("function.name").String(); name != "" {
+					call.Name = name
+				}
+				args[key].WriteString(delta.Get("function.arguments").String())
+				return true
+			})
+		case event.Get("candidates").Exists():
+			partText, partCalls := parseJSONResponse(event)
+			text.WriteString(partText)
+			for i, partCall := range partCalls {
+				key := fmt.Sprintf("gemini:%d:%d", len(tools), i)
+				*tool(key) = partCall
+				args[key].WriteString(partCall.Arguments)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(tools))
+	for key := range tools {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	calls := make([]ResponseToolCall, 0, len(keys))
+	for _, key := range keys {
+		call := *tools[key]
+		call.Arguments = args[key].String()
+		calls = append(calls, call)
+	}
+	return text.String(), calls
+}
+
+// parseJSONResponse 解析非流式响应（Gemini 流式分块也使用该结构）
+func parseJSONResponse(resp gjson.Result) (string, []ResponseToolCall) {
+	var text strings.Builder
+	calls := make([]ResponseToolCall, 0)
+	resp.Get("content").ForEach(func(_, block gjson.Result) bool {
+		switch block.Get("type").String() {
+		case "text":
+			text.WriteString(block.Get("text").String())
+		case "tool_use":
+			calls = append(calls, ResponseToolCall{ID: block.Get("id").String(), Name: block.Get("name").String(), Arguments: block.Get("input").Raw})
+		}
+		return true
+	})
+	resp.Get("choices").ForEach(func(_, choice gjson.Result) bool {
+		text.WriteString(choice.Get("message.content").String())
+		choice.Get("message.tool_calls").ForEach(func(_, call gjson.Result) bool {
+			calls = append(calls, ResponseToolCall{ID: call.Get("id").String(), Name: call.Get("function.name").String(), Arguments: call.Get("function.arguments").String()})
+			return true
+		})
+		return true
+	})
+	resp.Get("output").ForEach(func(_, item gjson.Result) bool {
+		switch item.Get("type").String() {
+		case "message":
+			item.Get("content").ForEach(func(_, part gjson.Result) bool {
+				text.WriteString(part.Get("text").String())
+				return true
+			})
+		case "function_call":
+			calls = append(calls, ResponseToolCall{ID: item.Get("call_id").String(), Name: item.Get("name").String(), Arguments: item.Get("arguments").String()})
+		}
+		return true
+	})
+	resp.Get("candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+		text.WriteString(part.Get("text").String())
+		if call := part.Get("functionCall"); call.Exists() {
+			calls = append(calls, ResponseToolCall{Name: call.Get("name").String(), Arguments: call.Get("args").Raw})
+		}
+		return true
+	})
+	return text.String(), calls
+}
+
+// qualityCapture 评分用的响应缓存，超过上限后只保留开头部分；nil 表示本次请求不评分
+type qualityCapture struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (q *qualityCapture) write(data []byte) {
+	if q == nil {
+		return
+	}
+	remaining := q.limit - q.buf.Len()
+	if remaining <= 0 {
+		q.truncated = q.truncated || len(data) > 0
+		return
+	}
+	if len(data) > remaining {
+		data = data[:remaining]
+		q.truncated = true
+	}
+	q.buf.Write(data)
+}
+
+// newQualityCapture 评分开启、有可用钩子且命中采样时返回响应缓存
+func (prs *ProviderRelayService) newQualityCapture() *qualityCapture {
+	prs.quality.mu.RLock()
+	defer prs.quality.mu.RUnlock()
+	cfg := prs.quality.config
+	if !cfg.Enabled || len(prs.quality.rules)+len(prs.quality.custom) == 0 {
+		return nil
+	}
+	if cfg.SampleRate > 0 && rand.Float64() >= cfg.SampleRate {
+		return nil
+	}
+	limit := cfg.MaxResponseBytes
+	if limit <= 0 {
+		limit = defaultQualityMaxResponseBytes
+	}
+	return &qualityCapture{limit: limit}
+}
+
+// submitQualitySample 成功的请求异步评分；评分任务已满时丢弃样本
+func (prs *ProviderRelayService) submitQualitySample(capture *qualityCapture, requestBody []byte, log *ReqeustLog) {
+	if capture == nil || log.HttpCode < http.StatusOK || log.HttpCode >= http.StatusMultipleChoices || capture.buf.Len() == 0 {
+		return
+	}
+	prs.quality.once.Do(func() { prs.quality.workers = make(chan struct{}, qualityWorkers) })
+	select {
+	case prs.quality.workers <- struct{}{}:
+	default:
+		fmt.Printf("[Quality] 评分任务已满，跳过 trace_id=%s\n", log.TraceID)
+		return
+	}
+	sample := &QualitySample{
+		TraceID:   log.TraceID,
+		Platform:  log.Platform,
+		Provider:  log.Provider,
+		Model:     log.Model,
+		Request:   append([]byte(nil), requestBody...),
+		Response:  capture.buf.Bytes(),
+		Truncated: capture.truncated,
+	}
+	go func() {
+		defer func() { <-prs.quality.workers }()
+		prs.scoreSample(sample)
+	}()
+}
+
+// scoreSample 执行所有钩子并保存评分
+func (prs *ProviderRelayService) scoreSample(sample *QualitySample) []QualityScore {
+	sample.Text, sample.ToolArguments = extractResponseContent(sample.Response)
+
+	prs.quality.mu.RLock()
+	hooks := append(append([]QualityHook{}, prs.quality.rules...), prs.quality.custom...)
+	prs.quality.mu.RUnlock()
+
+	scores := make([]QualityScore, 0, len(hooks))
+	for _, hook := range hooks {
+		score, detail, ok := hook.Evaluate(sample)
+		if !ok {
+			continue
+		}
+		if score < 0 {
+			score = 0
+		} else if score > 1 {
+			score = 1
+		}
+		scores = append(scores, QualityScore{Hook: hook.Name(), Score: score, Detail: detail})
+	}
+	if len(scores) == 0 {
+		return scores
+	}
+
+	var total float64
+	for _, s := range scores {
+		total += s.Score
+	}
+	prs.observeQualityScore(sample.Platform, sample.Provider, total/float64(len(scores)))
+	if err := saveQualityScores(sample, scores); err != nil {
+		fmt.Printf("[Quality] 保存评分失败 (trace_id=%s): %v\n", sample.TraceID, err)
+	}
+	return scores
+}
+
+// observeQualityScore 更新 provider 的滚动平均分
+func (prs *ProviderRelayService) observeQualityScore(kind, provider string, score float64) {
+	key := providerKey(kind, provider)
+	prs.quality.mu.Lock()
+	defer prs.quality.mu.Unlock()
+	if prs.quality.averages == nil {
+		prs.quality.averages = make(map[string]*qualityAverage)
+	}
+	avg := prs.quality.averages[key]
+	if avg == nil {
+		prs.quality.averages[key] = &qualityAverage{score: score, samples: 1}
+		return
+	}
+	avg.score += qualityEWMAAlpha * (score - avg.score)
+	avg.samples++
+}
+
+// deprioritizeLowQuality 自适应路由：评分样本足够且滚动平均分低于 min_score 的 provider 移到最后
+func (prs *ProviderRelayService) deprioritizeLowQuality(kind string, active []Provider) []Provider {
+	prs.quality.mu.RLock()
+	defer prs.quality.mu.RUnlock()
+	cfg := prs.quality.config
+	if !cfg.Enabled || cfg.MinScore <= 0 || len(prs.quality.averages) == 0 {
+		return active
+	}
+	minSamples := cfg.MinSamples
+	if minSamples <= 0 {
+		minSamples = defaultQualityMinSamples
+	}
+	good := make([]Provider, 0, len(active))
+	poor := make([]Provider, 0)
+	for _, p := range active {
+		if avg := prs.quality.averages[providerKey(kind, p.Name)]; avg != nil && avg.samples >= minSamples && avg.score < cfg.MinScore {
+			poor = append(poor, p)
+			continue
+		}
+		good = append(good, p)
+	}
+	if len(poor) == 0 || len(good) == 0 {
+		return active
+	}
+	return append(good, poor...)
+}
+
+// ensureQualityTable 创建响应评分表
+func ensureQualityTable(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS response_quality (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trace_id TEXT,
+		platform TEXT,
+		provider TEXT,
+		model TEXT,
+		hook TEXT,
+		score REAL,
+		detail TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_response_quality_provider ON response_quality(platform, provider, created_at)")
+	return err
+}
+
+// saveQualityScores 写入评分记录
+func saveQualityScores(sample *QualitySample, scores []QualityScore) error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(timeLayout)
+	for _, s := range scores {
+		if _, err := db.Exec(`INSERT INTO response_quality (trace_id, platform, provider, model, hook, score, detail, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			sample.TraceID, sample.Platform, sample.Provider, sample.Model, s.Hook, s.Score, s.Detail, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetQualitySummary 最近 days 天按 provider / 模型 / 钩子聚合的平均分，platform 为空时统计所有平台
+func (prs *ProviderRelayService) GetQualitySummary(platform string, days int) ([]QualitySummary, error) {
+	if days <= 0 {
+		days = 7
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT provider, model, hook, COUNT(*), AVG(score) FROM response_quality WHERE created_at >= ?`
+	args := []interface{}{time.Now().AddDate(0, 0, -days).UTC().Format(timeLayout)}
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	rows, err := db.Query(query+" GROUP BY provider, model, hook ORDER BY provider, model, hook", args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []QualitySummary{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]QualitySummary, 0)
+	for rows.Next() {
+		var s QualitySummary
+		if err := rows.Scan(&s.Provider, &s.Model, &s.Hook, &s.Samples, &s.AvgScore); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// providerQualityAverages 自 since 起各 provider 的平均分与评分次数，供性能分析看板使用
+func providerQualityAverages(platform string, since time.Time) map[string]qualityAverage {
+	result := make(map[string]qualityAverage)
+	db, err := xdb.DB("default")
+	if err != nil {
+		return result
+	}
+	query := `SELECT provider, COUNT(*), AVG(score) FROM response_quality WHERE created_at >= ?`
+	args := []interface{}{since.UTC().Format(timeLayout)}
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	rows, err := db.Query(query+" GROUP BY provider", args...)
+	if err != nil {
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			provider string
+			avg      qualityAverage
+		)
+		if err := rows.Scan(&provider, &avg.samples, &avg.score); err == nil {
+			result[provider] = avg
+		}
+	}
+	return result
+}
+
+func (prs *ProviderRelayService) adminGetQualityConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.GetQualityConfig())
+}
+
+func (prs *ProviderRelayService) adminUpdateQualityConfigHandler(c *gin.Context) {
+	var cfg QualityConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := prs.SetQualityConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prs.GetQualityConfig())
+}
+
+func (prs *ProviderRelayService) adminQualitySummaryHandler(c *gin.Context) {
+	days, _ := strconv.Atoi(c.Query("days"))
+	summary, err := prs.GetQualitySummary(c.Query("platform"), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"summary": summary})
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExtractResponseContent(t *testing.T) {
+	cases := []struct {
+		name  string
+		raw   string
+		text  string
+		tools []string
+	}{
+		{
+			name:  "anthropic json",
+			raw:   `{"content":[{"type":"text","text":"hello"},{"type":"tool_use","input":{"path":"a.go"}}]}`,
+			text:  "hello",
+			tools: []string{`{"path":"a.go"}`},
+		},
+		{
+			name:  "openai json",
+			raw:   `{"choices":[{"message":{"content":"hi","tool_calls":[{"function":{"arguments":"{\"q\":1}"}}]}}]}`,
+			text:  "hi",
+			tools: []string{`{"q":1}`},
+		},
+		{
+			name: "anthropic sse",
+			raw: "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"he\"}}\n\n" +
+				"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"llo\"}}\n\n" +
+				"data: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"tool_use\"}}\n\n" +
+				"data: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"a\\\":\"}}\n\n" +
+				"data: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"1}\"}}\n\n",
+			text:  "hello",
+			tools: []string{`{"a":1}`},
+		},
+		{
+			name: "openai sse",
+			raw: "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"x\\\"\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\":2\"}}]}}]}\n\ndata: [DONE]\n",
+			text:  "ok",
+			tools: []string{`{"x":2`},
+		},
+		{
+			name:  "gemini stream",
+			raw:   "{\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"a\"}]}}]}\n{\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"b\"}]}}]}\n",
+			text:  "ab",
+			tools: []string{},
+		},
+	}
+	for _, tc := range cases {
+		text, tools := extractResponseContent([]byte(tc.raw))
+		if text != tc.text || len(tools) != len(tc.tools) {
+			t.Fatalf("%s: text=%q tools=%v", tc.name, text, tools)
+		}
+		for i := range tools {
+			if tools[i] != tc.tools[i] {
+				t.Fatalf("%s: tool %d = %q, want %q", tc.name, i, tools[i], tc.tools[i])
+			}
+		}
+	}
+}
+
+func TestQualityConfigValidateAndPersist(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{}
+
+	invalid := []QualityConfig{
+		{Rules: []QualityRule{{Name: "", Type: QualityRuleRegex, Pattern: "x"}}},
+		{Rules: []QualityRule{{Name: "r", Type: QualityRuleRegex, Pattern: "("}}},
+		{Rules: []QualityRule{{Name: "j", Type: QualityRuleLLMJudge}}},
+		{Rules: []QualityRule{{Name: "u", Type: "unknown"}}},
+		{Rules: []QualityRule{{Name: "d", Type: QualityRuleJSONToolCalls}, {Name: "d", Type: QualityRuleJSONToolCalls}}},
+		{SampleRate: 2},
+	}
+	for i, cfg := range invalid {
+		if err := prs.SetQualityConfig(cfg); err == nil {
+			t.Fatalf("case %d: expected validation error", i)
+		}
+	}
+
+	cfg := QualityConfig{Enabled: true, Rules: []QualityRule{{Name: "tools", Type: QualityRuleJSONToolCalls}}}
+	if err := prs.SetQualityConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	restarted := &ProviderRelayService{}
+	restarted.loadQualityConfig()
+	if got := restarted.GetQualityConfig(); !got.Enabled || len(got.Rules) != 1 || len(restarted.quality.rules) != 1 {
+		t.Fatalf("reloaded config = %+v", got)
+	}
+	if restarted.newQualityCapture() == nil {
+		t.Fatal("capture should be created when scoring is enabled")
+	}
+}
+
+// lengthHook 自定义钩子：响应越长分数越高
+type lengthHook struct{}
+
+func (lengthHook) Name() string { return "length" }
+
+func (lengthHook) Evaluate(sample *QualitySample) (float64, string, bool) {
+	return float64(len(sample.Text)) / 10, "", true
+}
+
+func TestScoreSampleStoresScoresAndDeprioritizes(t *testing.T) {
+	openAnalyticsDB(t, "quality.db")
+
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	if err := prs.SetQualityConfig(QualityConfig{
+		Enabled:    true,
+		MinScore:   0.7,
+		MinSamples: 2,
+		Rules: []QualityRule{
+			{Name: "no-refusal", Type: QualityRuleRegex, Pattern: `(?i)i can't help`, MustNotMatch: true},
+			{Name: "tools", Type: QualityRuleJSONToolCalls},
+			{Name: "codex-only", Type: QualityRuleRegex, Pattern: "x", Platforms: []string{"codex"}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	prs.RegisterQualityHook(lengthHook{})
+
+	bad := &QualitySample{TraceID: "t1", Platform: "claude", Provider: "flaky", Model: "claude-sonnet-4",
+		Response: []byte(`{"content":[{"type":"text","text":"I can't help"},{"type":"tool_use","input":{}}]}`)}
+	scores := prs.scoreSample(bad)
+	if len(scores) != 3 || scores[0].Hook != "no-refusal" || scores[0].Score != 0 || scores[1].Score != 1 || scores[2].Score != 1 {
+		t.Fatalf("scores = %+v", scores)
+	}
+
+	broken := &QualitySample{TraceID: "t2", Platform: "claude", Provider: "flaky", Model: "claude-sonnet-4",
+		Response: []byte(`{"choices":[{"message":{"content":"","tool_calls":[{"function":{"arguments":"{bad"}}]}}]}`)}
+	scores = prs.scoreSample(broken)
+	if len(scores) != 3 || scores[1].Score != 0 || scores[1].Detail == "" {
+		t.Fatalf("broken tool call scores = %+v", scores)
+	}
+
+	summary, err := prs.GetQualitySummary("claude", 1)
+	if err != nil || len(summary) != 3 {
+		t.Fatalf("summary = %+v, err = %v", summary, err)
+	}
+	byProvider := providerQualityAverages("claude", time.Now().Add(-time.Hour))
+	if byProvider["flaky"].samples != 6 {
+		t.Fatalf("provider averages = %+v", byProvider)
+	}
+
+	active := []Provider{{Name: "flaky"}, {Name: "steady"}}
+	routed := prs.deprioritizeLowQuality("claude", active)
+	if routed[0].Name != "steady" || routed[1].Name != "flaky" {
+		t.Fatalf("low quality provider should move last: %+v", routed)
+	}
+}
+
+func TestLLMJudgeRule(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var gotModel string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer judge-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.Unmarshal(body, &req)
+		gotModel = req.Model
+		w.Write([]byte(`{"choices":[{"message":{"content":"8"}}]}`))
+	}))
+	defer server.Close()
+
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	if err := prs.providerService.SaveProviders("codex", []Provider{
+		{ID: 1, Name: "judge", APIURL: server.URL, APIKey: "judge-key", Enabled: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rule := QualityRule{Name: "judge", Type: QualityRuleLLMJudge, JudgeProvider: "judge", JudgeModel: "gpt-4o-mini"}
+	score, detail, err := prs.judgeResponse(rule, &QualitySample{Platform: "codex", Request: []byte(`{"input":"2+2"}`), Text: "4"})
+	if err != nil || score != 0.8 || detail == "" || gotModel != "gpt-4o-mini" {
+		t.Fatalf("judge score = %v (%s), model = %s, err = %v", score, detail, gotModel, err)
+	}
+	if _, ok := parseJudgeScore("no score"); ok {
+		t.Fatal("answer without a number should not parse")
+	}
+}
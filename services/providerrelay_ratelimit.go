@@ -0,0 +1,206 @@
+package services
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitLowWatermark 剩余 token / 请求数低于上限的该比例时视为即将耗尽
+const rateLimitLowWatermark = 0.05
+
+// RateLimitState 上游返回的限流额度快照（-1 表示上游未提供）
+type RateLimitState struct {
+	RequestsLimit     int64     `json:"requestsLimit"`
+	RequestsRemaining int64     `json:"requestsRemaining"`
+	RequestsReset     time.Time `json:"requestsReset"`
+	TokensLimit       int64     `json:"tokensLimit"`
+	TokensRemaining   int64     `json:"tokensRemaining"`
+	TokensReset       time.Time `json:"tokensReset"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// rateLimitTracker 按 provider 记录最近一次的限流额度
+type rateLimitTracker struct {
+	mu     sync.RWMutex
+	states map[string]RateLimitState
+}
+
+// parseRateLimitHeaders 解析 Anthropic (anthropic-ratelimit-*) 与 OpenAI (x-ratelimit-*) 限流响应头
+func parseRateLimitHeaders(header http.Header, now time.Time) (RateLimitState, bool) {
+	state := RateLimitState{
+		RequestsLimit:     -1,
+		RequestsRemaining: -1,
+		TokensLimit:       -1,
+		TokensRemaining:   -1,
+		UpdatedAt:         now,
+	}
+	found := false
+	readInt := func(dst *int64, names ...string) {
+		for _, name := range names {
+			if v := header.Get(name); v != "" {
+				if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+					*dst = n
+					found = true
+					return
+				}
+			}
+		}
+	}
+	readReset := func(dst *time.Time, names ...string) {
+		for _, name := range names {
+			if v := header.Get(name); v != "" {
+				if t, ok := parseRateLimitReset(v, now); ok {
+					*dst = t
+					found = true
+					return
+				}
+			}
+		}
+	}
+
+	readInt(&state.RequestsLimit, "anthropic-ratelimit-requests-limit", "x-ratelimit-limit-requests")
+	readInt(&state.RequestsRemaining, "anthropic-ratelimit-requests-remaining", "x-ratelimit-remaining-requests")
+	readReset(&state.RequestsReset, "anthropic-ratelimit-requests-reset", "x-ratelimit-reset-requests")
+	readInt(&state.TokensLimit, "anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-input-tokens-limit", "x-ratelimit-limit-tokens")
+	readInt(&state.TokensRemaining, "anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-input-tokens-remaining", "x-ratelimit-remaining-tokens")
+	readReset(&state.TokensReset, "anthropic-ratelimit-tokens-reset", "anthropic-ratelimit-input-tokens-reset", "x-ratelimit-reset-tokens")
+	return state, found
+}
+
+// parseRateLimitReset 解析重置时间：Anthropic 为 RFC 3339 时间戳，OpenAI 为 "6m0s"、"20ms" 等时长，也兼容纯秒数
+func parseRateLimitReset(value string, now time.Time) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), true
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return now.Add(time.Duration(secs * float64(time.Second))), true
+	}
+	return time.Time{}, false
+}
+
+// recordRateLimit 根据响应头与状态码更新 provider 的限流额度
+func (prs *ProviderRelayService) recordRateLimit(kind, providerName string, status int, header http.Header) (RateLimitState, bool) {
+	now := time.Now()
+	state, ok := parseRateLimitHeaders(header, now)
+	if status == http.StatusTooManyRequests {
+		// 429：即使没有额度头也视为请求额度耗尽，直到 Retry-After 之后
+		ok = true
+		state.RequestsRemaining = 0
+		if state.RequestsReset.IsZero() {
+			reset, parsed := parseRateLimitReset(header.Get("Retry-After"), now)
+			if !parsed {
+				reset = now.Add(time.Minute)
+			}
+			state.RequestsReset = reset
+		}
+	}
+	if !ok {
+		return state, false
+	}
+
+	prs.rateLimits.mu.Lock()
+	if prs.rateLimits.states == nil {
+		prs.rateLimits.states = make(map[string]RateLimitState)
+	}
+	prs.rateLimits.states[providerKey(kind, providerName)] = state
+	prs.rateLimits.mu.Unlock()
+
+	// 共享给其他副本，保留到较晚的重置时间
+	reset := state.RequestsReset
+	if state.TokensReset.After(reset) {
+		reset = state.TokensReset
+	}
+	if ttl := time.Until(reset); ttl > 0 {
+		prs.sharedSetJSON(sharedRateLimitKey(providerKey(kind, providerName)), state, ttl)
+	}
+	return state, true
+}
+
+// isRateLimitExhausted 判断 provider 的额度是否即将耗尽（在重置时间之前）
+func (prs *ProviderRelayService) isRateLimitExhausted(kind, providerName string) bool {
+	key := providerKey(kind, providerName)
+	prs.rateLimits.mu.RLock()
+	state, ok := prs.rateLimits.states[key]
+	prs.rateLimits.mu.RUnlock()
+	// 多副本时采用最近更新的额度
+	var shared RateLimitState
+	if prs.sharedGetJSON(sharedRateLimitKey(key), &shared) && shared.UpdatedAt.After(state.UpdatedAt) {
+		state, ok = shared, true
+	}
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if state.RequestsRemaining >= 0 && now.Before(state.RequestsReset) {
+		if state.RequestsRemaining == 0 ||
+			(state.RequestsLimit > 0 && float64(state.RequestsRemaining) < float64(state.RequestsLimit)*rateLimitLowWatermark) {
+			return true
+		}
+	}
+	if state.TokensRemaining >= 0 && now.Before(state.TokensReset) {
+		if state.TokensRemaining == 0 ||
+			(state.TokensLimit > 0 && float64(state.TokensRemaining) < float64(state.TokensLimit)*rateLimitLowWatermark) {
+			return true
+		}
+	}
+	return false
+}
+
+// deprioritizeRateLimited 将额度即将耗尽的 provider 移到候选列表末尾，保持其余顺序不变
+func (prs *ProviderRelayService) deprioritizeRateLimited(kind string, providers []Provider) []Provider {
+	exhausted := make(map[string]bool)
+	for _, p := range providers {
+		if prs.isRateLimitExhausted(kind, p.Name) {
+			exhausted[p.Name] = true
+		}
+	}
+	if len(exhausted) == 0 {
+		return providers
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		return !exhausted[providers[i].Name] && exhausted[providers[j].Name]
+	})
+	return providers
+}
+
+// GetRateLimitStatus 返回所有 provider 最近一次的限流额度，key 为 "平台/名称"
+func (prs *ProviderRelayService) GetRateLimitStatus() map[string]RateLimitState {
+	prs.rateLimits.mu.RLock()
+	defer prs.rateLimits.mu.RUnlock()
+	result := make(map[string]RateLimitState, len(prs.rateLimits.states))
+	for key, state := range prs.rateLimits.states {
+		result[key] = state
+	}
+	return result
+}
+
+// writeRateLimitHeaders 向客户端输出统一格式的限流头（x-ratelimit-*，重置时间为秒数），
+// 便于不同上游下的 CLI 统一自我限速
+func writeRateLimitHeaders(header http.Header, state RateLimitState) {
+	now := time.Now()
+	setInt := func(name string, value int64) {
+		if value >= 0 {
+			header.Set(name, strconv.FormatInt(value, 10))
+		}
+	}
+	setReset := func(name string, reset time.Time) {
+		if !reset.IsZero() {
+			secs := max(reset.Sub(now).Seconds(), 0)
+			header.Set(name, strconv.FormatFloat(secs, 'f', 0, 64)+"s")
+		}
+	}
+	setInt("x-ratelimit-limit-requests", state.RequestsLimit)
+	setInt("x-ratelimit-remaining-requests", state.RequestsRemaining)
+	setReset("x-ratelimit-reset-requests", state.RequestsReset)
+	setInt("x-ratelimit-limit-tokens", state.TokensLimit)
+	setInt("x-ratelimit-remaining-tokens", state.TokensRemaining)
+	setReset("x-ratelimit-reset-tokens", state.TokensReset)
+}
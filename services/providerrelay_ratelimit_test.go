@@ -0,0 +1,65 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	anthropic := http.Header{}
+	anthropic.Set("anthropic-ratelimit-requests-limit", "50")
+	anthropic.Set("anthropic-ratelimit-requests-remaining", "49")
+	anthropic.Set("anthropic-ratelimit-requests-reset", "2025-01-01T00:00:30Z")
+	anthropic.Set("anthropic-ratelimit-input-tokens-limit", "40000")
+	anthropic.Set("anthropic-ratelimit-input-tokens-remaining", "1000")
+	state, ok := parseRateLimitHeaders(anthropic, now)
+	if !ok || state.RequestsRemaining != 49 || state.TokensLimit != 40000 || state.TokensRemaining != 1000 {
+		t.Fatalf("unexpected anthropic state: %+v", state)
+	}
+	if !state.RequestsReset.Equal(now.Add(30 * time.Second)) {
+		t.Errorf("requests reset = %v", state.RequestsReset)
+	}
+
+	openai := http.Header{}
+	openai.Set("x-ratelimit-remaining-tokens", "0")
+	openai.Set("x-ratelimit-reset-tokens", "6m0s")
+	state, ok = parseRateLimitHeaders(openai, now)
+	if !ok || state.TokensRemaining != 0 || state.RequestsRemaining != -1 {
+		t.Fatalf("unexpected openai state: %+v", state)
+	}
+	if !state.TokensReset.Equal(now.Add(6 * time.Minute)) {
+		t.Errorf("tokens reset = %v", state.TokensReset)
+	}
+
+	if _, ok := parseRateLimitHeaders(http.Header{}, now); ok {
+		t.Error("no headers should report not found")
+	}
+}
+
+func TestDeprioritizeRateLimited(t *testing.T) {
+	prs := &ProviderRelayService{}
+	low := http.Header{}
+	low.Set("x-ratelimit-limit-tokens", "100000")
+	low.Set("x-ratelimit-remaining-tokens", "1000")
+	low.Set("x-ratelimit-reset-tokens", "1m")
+	prs.recordRateLimit("codex", "a", http.StatusOK, low)
+	prs.recordRateLimit("codex", "b", http.StatusTooManyRequests, http.Header{"Retry-After": []string{"30"}})
+
+	ok := http.Header{}
+	ok.Set("x-ratelimit-limit-tokens", "100000")
+	ok.Set("x-ratelimit-remaining-tokens", "90000")
+	ok.Set("x-ratelimit-reset-tokens", "1m")
+	prs.recordRateLimit("codex", "c", http.StatusOK, ok)
+
+	providers := prs.deprioritizeRateLimited("codex", []Provider{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}})
+	got := []string{providers[0].Name, providers[1].Name, providers[2].Name, providers[3].Name}
+	want := []string{"c", "d", "a", "b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("order = %v, want %v", got, want)
+		}
+	}
+}
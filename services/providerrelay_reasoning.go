@@ -0,0 +1,597 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 推理内容处理：DeepSeek-R1、o 系列、Claude extended thinking 等模型输出的推理内容
+// 会让无法解析的客户端出错。按客户端 / provider / 平台配置的策略，在返回客户端前
+// 移除推理内容、转换为正文中的 <thinking> 标签，或原样透传。
+// 仅处理 Anthropic Messages 与 Chat Completions 格式；Responses API 的 reasoning 条目
+// 由 Codex 等客户端原生解析，保持原样
+
+// 推理内容处理策略
+const (
+	ReasoningPassthrough = "passthrough" // 原样返回（默认）
+	ReasoningStrip       = "strip"       // 移除推理内容（含正文开头内联的 <think>…</think>）
+	ReasoningTags        = "tags"        // 转换为正文中的 <thinking>…</thinking>
+)
+
+const (
+	reasoningTagOpen  = "<thinking>\n"
+	reasoningTagClose = "\n</thinking>\n\n"
+)
+
+// 响应格式
+const (
+	reasoningFormatAnthropic = "anthropic"
+	reasoningFormatChat      = "chat"
+)
+
+// ReasoningConfig 推理内容处理配置：客户端规则优先（客户端能否解析决定输出格式），
+// 其次 provider 的 reasoningPolicy，最后是平台默认值
+type ReasoningConfig struct {
+	Platforms map[string]string `json:"platforms,omitempty"` // 平台 → 策略
+	Clients   map[string]string `json:"clients,omitempty"`   // 客户端应用（request_log.app_name）→ 策略
+}
+
+// reasoningStore 推理内容处理配置
+type reasoningStore struct {
+	mu     sync.RWMutex
+	config ReasoningConfig
+}
+
+// validReasoningPolicy 空值表示未配置
+func validReasoningPolicy(policy string) bool {
+	switch policy {
+	case "", ReasoningPassthrough, ReasoningStrip, ReasoningTags:
+		return true
+	}
+	return false
+}
+
+// Validate 检查推理内容处理配置
+func (cfg ReasoningConfig) Validate() error {
+	for platform, policy := range cfg.Platforms {
+		if !validReasoningPolicy(policy) {
+			return fmt.Errorf("invalid policy %q for platform %s, want passthrough, strip or tags", policy, platform)
+		}
+	}
+	for client, policy := range cfg.Clients {
+		if !validReasoningPolicy(policy) {
+			return fmt.Errorf("invalid policy %q for client %s, want passthrough, strip or tags", policy, client)
+		}
+	}
+	return nil
+}
+
+// reasoningConfigPath 推理内容处理配置文件
+func reasoningConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "reasoning.json"), nil
+}
+
+// GetReasoningConfig 获取推理内容处理配置
+func (prs *ProviderRelayService) GetReasoningConfig() ReasoningConfig {
+	prs.reasoning.mu.RLock()
+	defer prs.reasoning.mu.RUnlock()
+	return prs.reasoning.config
+}
+
+// SetReasoningConfig 更新推理内容处理配置，持久化到 reasoning.json
+func (prs *ProviderRelayService) SetReasoningConfig(cfg ReasoningConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	path, err := reasoningConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.reasoning.mu.Lock()
+	prs.reasoning.config = cfg
+	prs.reasoning.mu.Unlock()
+	return nil
+}
+
+// loadReasoningConfig 启动时从 reasoning.json 恢复
+func (prs *ProviderRelayService) loadReasoningConfig() {
+	path, err := reasoningConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cfg ReasoningConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("[Reasoning] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("[Reasoning] 配置无效，已停用: %v\n", err)
+		return
+	}
+	prs.reasoning.mu.Lock()
+	prs.reasoning.config = cfg
+	prs.reasoning.mu.Unlock()
+}
+
+// reasoningPolicyFor 本次请求的策略：客户端规则 > provider 配置 > 平台默认值 > 透传
+func (prs *ProviderRelayService) reasoningPolicyFor(c *gin.Context, kind string, provider Provider, body []byte) string {
+	cfg := prs.GetReasoningConfig()
+	if policy := cfg.Clients[clientFingerprintFor(c, body).App]; policy != "" {
+		return policy
+	}
+	if provider.ReasoningPolicy != "" {
+		return provider.ReasoningPolicy
+	}
+	if policy := cfg.Platforms[kind]; policy != "" {
+		return policy
+	}
+	return ReasoningPassthrough
+}
+
+// reasoningFormatFor 客户端看到的响应格式；其他端点不处理
+func reasoningFormatFor(endpoint string) string {
+	switch {
+	case strings.Contains(endpoint, "count_tokens"):
+		return ""
+	case strings.Contains(endpoint, "/messages"):
+		return reasoningFormatAnthropic
+	case strings.Contains(endpoint, "chat/completions"):
+		return reasoningFormatChat
+	}
+	return ""
+}
+
+// applyReasoningPolicy 策略不是透传时改写响应；返回的 restore 在本次尝试结束后调用
+func (prs *ProviderRelayService) applyReasoningPolicy(c *gin.Context, kind string, provider Provider, endpoint string, body []byte, stream bool) func() {
+	format := reasoningFormatFor(endpoint)
+	if format == "" {
+		return func() {}
+	}
+	policy := prs.reasoningPolicyFor(c, kind, provider, body)
+	if policy == ReasoningPassthrough {
+		return func() {}
+	}
+	return installResponseRewriter(c, stream, newReasoningRewriter(policy, format))
+}
+
+// reasoningRewriter 一次响应的改写状态
+type reasoningRewriter struct {
+	policy string
+	format string
+
+	// Anthropic：被移除 / 转换为文本的上游内容块，以及已移除的块数（后续块的 index 前移）
+	stripped map[int64]bool
+	tagged   map[int64]bool
+	dropped  int64
+
+	// Chat Completions：各候选的 <thinking> 是否打开，以及内联 <think> 过滤器
+	open    map[int64]bool
+	filters map[int64]*thinkTagFilter
+}
+
+func newReasoningRewriter(policy, format string) *reasoningRewriter {
+	return &reasoningRewriter{
+		policy:   policy,
+		format:   format,
+		stripped: make(map[int64]bool),
+		tagged:   make(map[int64]bool),
+		open:     make(map[int64]bool),
+		filters:  make(map[int64]*thinkTagFilter),
+	}
+}
+
+// event 改写一个原始 SSE 事件；未改动的事件原样返回（保留注释行等）
+func (r *reasoningRewriter) event(raw []byte) []byte {
+	name, payload := parseSSEEvent(raw)
+	if !gjson.Valid(payload) {
+		return raw
+	}
+
+	var events []sseEvent
+	var changed bool
+	if r.format == reasoningFormatAnthropic {
+		events, changed = r.anthropicEvent(name, gjson.Parse(payload))
+	} else {
+		events, changed = r.chatChunk([]byte(payload))
+	}
+	if !changed {
+		return raw
+	}
+	return encodeSSEEvents(events)
+}
+
+// body 改写非流式响应
+func (r *reasoningRewriter) body(data []byte) []byte {
+	if !gjson.ValidBytes(data) {
+		return data
+	}
+	var out []byte
+	var err error
+	if r.format == reasoningFormatAnthropic {
+		out, err = r.anthropicMessage(data)
+	} else {
+		out, err = r.chatCompletion(data)
+	}
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// ===== Anthropic Messages =====
+
+// setReasoningContent 设置 message / delta 的 content
+func setReasoningContent(data []byte, path, text string) ([]byte, error) {
+	raw, err := marshalUnescapedJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	return sjson.SetRawBytes(data, path+".content", raw)
+}
+
+func anthropicEventJSON(name string, payload map[string]interface{}) sseEvent {
+	data, _ := marshalUnescapedJSON(payload)
+	return sseEvent{name: name, data: data}
+}
+
+func anthropicTextDelta(index int64, text string) sseEvent {
+	return anthropicEventJSON("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]string{"type": "text_delta", "text": text},
+	})
+}
+
+// anthropicEvent 改写一个 Anthropic 流式事件
+func (r *reasoningRewriter) anthropicEvent(name string, data gjson.Result) ([]sseEvent, bool) {
+	kind := data.Get("type").String()
+	if name == "" {
+		name = kind
+	}
+	index := data.Get("index").Int()
+	target := index - r.dropped
+
+	switch kind {
+	case "content_block_start":
+		blockType := data.Get("content_block.type").String()
+		if blockType == "redacted_thinking" || blockType == "thinking" && r.policy == ReasoningStrip {
+			// 加密的推理内容无法展示，tags 策略下同样移除
+			r.stripped[index] = true
+			r.dropped++
+			return nil, true
+		}
+		if blockType == "thinking" {
+			r.tagged[index] = true
+			return []sseEvent{
+				anthropicEventJSON(name, map[string]interface{}{
+					"type":          "content_block_start",
+					"index":         target,
+					"content_block": map[string]string{"type": "text", "text": ""},
+				}),
+				anthropicTextDelta(target, reasoningTagOpen),
+			}, true
+		}
+	case "content_block_delta":
+		if r.stripped[index] {
+			return nil, true
+		}
+		if r.tagged[index] {
+			if data.Get("delta.type").String() != "thinking_delta" {
+				// signature_delta 只对 thinking 块有意义
+				return nil, true
+			}
+			return []sseEvent{anthropicTextDelta(target, data.Get("delta.thinking").String())}, true
+		}
+	case "content_block_stop":
+		if r.stripped[index] {
+			return nil, true
+		}
+		if r.tagged[index] {
+			return []sseEvent{
+				anthropicTextDelta(target, reasoningTagClose),
+				anthropicEventJSON(name, map[string]interface{}{"type": "content_block_stop", "index": target}),
+			}, true
+		}
+	default:
+		return nil, false
+	}
+
+	if r.dropped == 0 {
+		return nil, false
+	}
+	rewritten, err := sjson.SetBytes([]byte(data.Raw), "index", target)
+	if err != nil {
+		return nil, false
+	}
+	return []sseEvent{{name: name, data: rewritten}}, true
+}
+
+// anthropicMessage 改写非流式 Anthropic 响应的 content
+func (r *reasoningRewriter) anthropicMessage(data []byte) ([]byte, error) {
+	content := gjson.GetBytes(data, "content")
+	if !content.IsArray() {
+		return data, nil
+	}
+	blocks := make([]json.RawMessage, 0, len(content.Array()))
+	changed := false
+	for _, block := range content.Array() {
+		switch block.Get("type").String() {
+		case "redacted_thinking":
+			changed = true
+		case "thinking":
+			changed = true
+			if r.policy == ReasoningTags {
+				text, _ := marshalUnescapedJSON(map[string]string{
+					"type": "text",
+					"text": reasoningTagOpen + block.Get("thinking").String() + reasoningTagClose,
+				})
+				blocks = append(blocks, text)
+			}
+		default:
+			blocks = append(blocks, json.RawMessage(block.Raw))
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+	raw, err := marshalUnescapedJSON(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return sjson.SetRawBytes(data, "content", raw)
+}
+
+// ===== Chat Completions =====
+
+// chatReasoningFields 各家在 Chat Completions 中输出推理内容的字段
+// （DeepSeek / Qwen 的 reasoning_content，OpenRouter 的 reasoning 与 reasoning_details）
+var chatReasoningFields = []string{"reasoning_content", "reasoning", "reasoning_details"}
+
+// chatReasoning 取出并删除 message / delta 中的推理内容
+func chatReasoning(data []byte, path string) ([]byte, string, bool, error) {
+	var text strings.Builder
+	found := false
+	for _, field := range chatReasoningFields {
+		value := gjson.GetBytes(data, path+"."+field)
+		if !value.Exists() {
+			continue
+		}
+		found = true
+		if value.Type == gjson.String {
+			text.WriteString(value.String())
+		}
+		var err error
+		if data, err = sjson.DeleteBytes(data, path+"."+field); err != nil {
+			return nil, "", false, err
+		}
+	}
+	return data, text.String(), found, nil
+}
+
+func (r *reasoningRewriter) filter(choice int64) *thinkTagFilter {
+	f := r.filters[choice]
+	if f == nil {
+		f = &thinkTagFilter{}
+		r.filters[choice] = f
+	}
+	return f
+}
+
+// chatChunk 改写一个 Chat Completions 流式块；只剩空增量的块整体丢弃
+func (r *reasoningRewriter) chatChunk(data []byte) ([]sseEvent, bool) {
+	changed := false
+	meaningful := gjson.GetBytes(data, "usage").Exists() && gjson.GetBytes(data, "usage").Type != gjson.Null
+	for i, choice := range gjson.GetBytes(data, "choices").Array() {
+		path := fmt.Sprintf("choices.%d.delta", i)
+		index := choice.Get("index").Int()
+		updated, reasoning, found, err := chatReasoning(data, path)
+		if err != nil {
+			return nil, false
+		}
+		data = updated
+		choiceChanged := found
+
+		content := choice.Get("delta.content")
+		text := content.String()
+		finished := choice.Get("finish_reason").Type == gjson.String
+		switch r.policy {
+		case ReasoningStrip:
+			if content.Type == gjson.String {
+				filtered := r.filter(index).feed(text)
+				if finished {
+					filtered += r.filter(index).flush()
+				}
+				if filtered != text {
+					choiceChanged = true
+					text = filtered
+				}
+			}
+		case ReasoningTags:
+			prefix := ""
+			if reasoning != "" {
+				if !r.open[index] {
+					prefix = reasoningTagOpen
+					r.open[index] = true
+				}
+				prefix += reasoning
+			}
+			if r.open[index] && (text != "" || choice.Get("delta.tool_calls").Exists() || finished) {
+				prefix += reasoningTagClose
+				r.open[index] = false
+			}
+			if prefix != "" {
+				choiceChanged = true
+				text = prefix + text
+			}
+		}
+		if choiceChanged && (content.Exists() || text != "") {
+			if data, err = setReasoningContent(data, path, text); err != nil {
+				return nil, false
+			}
+		}
+		changed = changed || choiceChanged
+
+		delta := gjson.GetBytes(data, path)
+		if text != "" || finished || delta.Get("role").Exists() || delta.Get("tool_calls").Exists() ||
+			delta.Get("function_call").Exists() || delta.Get("refusal").String() != "" {
+			meaningful = true
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	if !meaningful {
+		return nil, true
+	}
+	return []sseEvent{{data: data}}, true
+}
+
+// chatCompletion 改写非流式 Chat Completions 响应的 message
+func (r *reasoningRewriter) chatCompletion(data []byte) ([]byte, error) {
+	for i := range gjson.GetBytes(data, "choices").Array() {
+		path := fmt.Sprintf("choices.%d.message", i)
+		updated, reasoning, found, err := chatReasoning(data, path)
+		if err != nil {
+			return nil, err
+		}
+		data = updated
+		content := gjson.GetBytes(data, path+".content")
+		text := content.String()
+		switch r.policy {
+		case ReasoningStrip:
+			if content.Type != gjson.String {
+				continue
+			}
+			f := &thinkTagFilter{}
+			filtered := f.feed(text) + f.flush()
+			if filtered == text && !found {
+				continue
+			}
+			text = filtered
+		case ReasoningTags:
+			if reasoning == "" {
+				continue
+			}
+			text = reasoningTagOpen + reasoning + reasoningTagClose + text
+		}
+		if data, err = setReasoningContent(data, path, text); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// thinkTagFilter 移除正文开头内联的 <think>…</think>（部分部署把 R1 类模型的推理直接写在正文中）；
+// 只处理正文开头的标签，避免误删正文中出现的字面量
+type thinkTagFilter struct {
+	state   int    // 0 尚未确定，1 推理中，2 推理结束后跳过空白，3 正文
+	pending string // 可能是被截断的标签，等待下一个片段
+}
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// feed 输入一段正文增量，返回应当发给客户端的部分
+func (f *thinkTagFilter) feed(s string) string {
+	if f.state == 3 {
+		return s
+	}
+	s = f.pending + s
+	f.pending = ""
+	if f.state == 0 {
+		trimmed := strings.TrimLeft(s, " \t\r\n")
+		switch {
+		case strings.HasPrefix(trimmed, thinkOpenTag):
+			f.state = 1
+			s = trimmed[len(thinkOpenTag):]
+		case strings.HasPrefix(thinkOpenTag, trimmed):
+			f.pending = s
+			return ""
+		default:
+			f.state = 3
+			return s
+		}
+	}
+	if f.state == 1 {
+		end := strings.Index(s, thinkCloseTag)
+		if end < 0 {
+			f.pending = s[len(s)-partialTagSuffix(s, thinkCloseTag):]
+			return ""
+		}
+		f.state = 2
+		s = s[end+len(thinkCloseTag):]
+	}
+	s = strings.TrimLeft(s, " \t\r\n")
+	if s != "" {
+		f.state = 3
+	}
+	return s
+}
+
+// flush 正文结束时返回仍在等待的内容（未闭合的推理内容丢弃）
+func (f *thinkTagFilter) flush() string {
+	pending := f.pending
+	f.pending = ""
+	if f.state == 0 {
+		return pending
+	}
+	return ""
+}
+
+// partialTagSuffix s 结尾与 tag 前缀重合的最大长度
+func partialTagSuffix(s, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// ===== 管理接口 =====
+
+func (prs *ProviderRelayService) adminGetReasoningConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, prs.GetReasoningConfig())
+}
+
+func (prs *ProviderRelayService) adminUpdateReasoningConfigHandler(c *gin.Context) {
+	var cfg ReasoningConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := prs.SetReasoningConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prs.GetReasoningConfig())
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// runReasoningWriter 按 provider / 配置改写一段响应，data 按 chunk 字节分片写入
+func runReasoningWriter(t *testing.T, prs *ProviderRelayService, provider Provider, endpoint string, stream bool, data string, chunk int) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, endpoint, nil)
+	restore := prs.applyReasoningPolicy(c, "claude", provider, endpoint, nil, stream)
+	c.Writer.WriteHeader(http.StatusOK)
+	for len(data) > 0 {
+		n := chunk
+		if n <= 0 || n > len(data) {
+			n = len(data)
+		}
+		c.Writer.Write([]byte(data[:n]))
+		data = data[n:]
+	}
+	restore()
+	return w.Body.String()
+}
+
+const anthropicThinkingStream = "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"content\":[]}}\n\n" +
+	"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"thinking\",\"thinking\":\"\"}}\n\n" +
+	"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"thinking_delta\",\"thinking\":\"hmm\"}}\n\n" +
+	"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"signature_delta\",\"signature\":\"sig\"}}\n\n" +
+	"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+	": keep-alive\n\n" +
+	"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+	"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"text_delta\",\"text\":\"answer\"}}\n\n" +
+	"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":1}\n\n" +
+	"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+
+func TestReasoningStripAnthropicStream(t *testing.T) {
+	prs := &ProviderRelayService{}
+	for _, chunk := range []int{0, 1, 13} {
+		out := runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningStrip}, "/v1/messages", true, anthropicThinkingStream, chunk)
+		if strings.Contains(out, "thinking") || strings.Contains(out, "sig") {
+			t.Fatalf("chunk=%d: thinking leaked: %s", chunk, out)
+		}
+		// 后续块的 index 前移
+		if !strings.Contains(out, `"index":0,"content_block":{"type":"text"`) || !strings.Contains(out, `"index":0,"delta":{"type":"text_delta","text":"answer"}`) {
+			t.Fatalf("chunk=%d: text block not renumbered: %s", chunk, out)
+		}
+		if !strings.Contains(out, ": keep-alive") || !strings.Contains(out, "event: message_stop") {
+			t.Fatalf("chunk=%d: unrelated events dropped: %s", chunk, out)
+		}
+	}
+}
+
+func TestReasoningTagsAnthropicStream(t *testing.T) {
+	prs := &ProviderRelayService{}
+	out := runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningTags}, "/v1/messages", true, anthropicThinkingStream, 7)
+	var text strings.Builder
+	for _, line := range strings.Split(out, "\n") {
+		if data := strings.TrimPrefix(line, "data: "); data != line {
+			if gjson.Get(data, "content_block.type").String() == "thinking" || gjson.Get(data, "delta.type").String() == "signature_delta" {
+				t.Fatalf("thinking event leaked: %s", data)
+			}
+			text.WriteString(gjson.Get(data, "delta.text").String())
+		}
+	}
+	if text.String() != "<thinking>\nhmm\n</thinking>\n\nanswer" {
+		t.Fatalf("text = %q", text.String())
+	}
+	if !strings.Contains(out, `"index":1,"delta":{"type":"text_delta","text":"answer"}`) {
+		t.Fatalf("text block index changed: %s", out)
+	}
+}
+
+func TestReasoningAnthropicMessage(t *testing.T) {
+	prs := &ProviderRelayService{}
+	body := `{"id":"msg_1","content":[{"type":"thinking","thinking":"hmm","signature":"s"},{"type":"redacted_thinking","data":"x"},{"type":"text","text":"answer"}]}`
+	out := runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningStrip}, "/v1/messages", false, body, 0)
+	if got := gjson.Get(out, "content").Raw; got != `[{"type":"text","text":"answer"}]` {
+		t.Fatalf("strip content = %s", got)
+	}
+	out = runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningTags}, "/v1/messages", false, body, 0)
+	if got := gjson.Get(out, "content.#.text").Raw; got != `["<thinking>\nhmm\n</thinking>\n\n","answer"]` {
+		t.Fatalf("tags content = %s", got)
+	}
+}
+
+const chatReasoningStream = "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n" +
+	"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"step 1\"}}]}\n\n" +
+	"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\", step 2\"}}]}\n\n" +
+	"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"done\"}}]}\n\n" +
+	"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"completion_tokens\":9,\"completion_tokens_details\":{\"reasoning_tokens\":5}}}\n\n" +
+	"data: [DONE]\n\n"
+
+func chatStreamContent(t *testing.T, out string) (string, int) {
+	t.Helper()
+	var content strings.Builder
+	chunks := 0
+	for _, line := range strings.Split(out, "\n") {
+		data := strings.TrimPrefix(line, "data: ")
+		if data == line || data == "[DONE]" {
+			continue
+		}
+		chunks++
+		if gjson.Get(data, "choices.0.delta.reasoning_content").Exists() {
+			t.Fatalf("reasoning leaked: %s", data)
+		}
+		content.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+	}
+	return content.String(), chunks
+}
+
+func TestReasoningChatStream(t *testing.T) {
+	prs := &ProviderRelayService{}
+	for _, chunk := range []int{0, 1, 9} {
+		out := runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningStrip}, "/v1/chat/completions", true, chatReasoningStream, chunk)
+		content, chunks := chatStreamContent(t, out)
+		// 只含推理内容的块整体丢弃
+		if content != "done" || chunks != 3 || !strings.HasSuffix(out, "data: [DONE]\n\n") {
+			t.Fatalf("strip chunk=%d: content=%q chunks=%d\n%s", chunk, content, chunks, out)
+		}
+
+		out = runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningTags}, "/v1/chat/completions", true, chatReasoningStream, chunk)
+		content, _ = chatStreamContent(t, out)
+		if content != "<thinking>\nstep 1, step 2\n</thinking>\n\ndone" {
+			t.Fatalf("tags chunk=%d: content=%q", chunk, content)
+		}
+	}
+}
+
+func TestReasoningChatInlineThinkTags(t *testing.T) {
+	prs := &ProviderRelayService{}
+	stream := "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"<thi\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"nk>plan</th\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ink>\\n\\n\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a <think> b\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"
+	out := runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningStrip}, "/v1/chat/completions", true, stream, 0)
+	if content, _ := chatStreamContent(t, out); content != "a <think> b" {
+		t.Fatalf("content = %q\n%s", content, out)
+	}
+
+	body := `{"choices":[{"index":0,"message":{"role":"assistant","content":"<think>\nplan\n</think>\n\nanswer","reasoning":"r"}}]}`
+	out = runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningStrip}, "/v1/chat/completions", false, body, 0)
+	if got := gjson.Get(out, "choices.0.message").Raw; got != `{"role":"assistant","content":"answer"}` {
+		t.Fatalf("message = %s", got)
+	}
+}
+
+func TestReasoningChatCompletionTags(t *testing.T) {
+	prs := &ProviderRelayService{}
+	body := `{"choices":[{"index":0,"message":{"role":"assistant","content":null,"reasoning_content":"why","tool_calls":[{"id":"t"}]}}]}`
+	out := runReasoningWriter(t, prs, Provider{ReasoningPolicy: ReasoningTags}, "/v1/chat/completions", false, body, 0)
+	msg := gjson.Get(out, "choices.0.message")
+	if msg.Get("content").String() != "<thinking>\nwhy\n</thinking>\n\n" || msg.Get("reasoning_content").Exists() || !msg.Get("tool_calls").Exists() {
+		t.Fatalf("message = %s", msg.Raw)
+	}
+}
+
+func TestReasoningPolicyResolution(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.reasoning.config = ReasoningConfig{
+		Platforms: map[string]string{"claude": ReasoningTags},
+		Clients:   map[string]string{ClientAppCursor: ReasoningStrip},
+	}
+	newContext := func(ua string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		c.Request.Header.Set("User-Agent", ua)
+		return c
+	}
+	cases := []struct {
+		ua       string
+		kind     string
+		provider Provider
+		want     string
+	}{
+		{"Cursor/1.0", "claude", Provider{ReasoningPolicy: ReasoningPassthrough}, ReasoningStrip},
+		{"claude-cli/1.0", "claude", Provider{ReasoningPolicy: ReasoningPassthrough}, ReasoningPassthrough},
+		{"claude-cli/1.0", "claude", Provider{}, ReasoningTags},
+		{"claude-cli/1.0", "codex", Provider{}, ReasoningPassthrough},
+	}
+	for _, tc := range cases {
+		if got := prs.reasoningPolicyFor(newContext(tc.ua), tc.kind, tc.provider, nil); got != tc.want {
+			t.Errorf("%s/%s/%q = %s, want %s", tc.ua, tc.kind, tc.provider.ReasoningPolicy, got, tc.want)
+		}
+	}
+}
+
+func TestReasoningConfigPersisted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prs := &ProviderRelayService{}
+	if err := prs.SetReasoningConfig(ReasoningConfig{Platforms: map[string]string{"codex": "hide"}}); err == nil {
+		t.Fatal("expected invalid policy error")
+	}
+	cfg := ReasoningConfig{Clients: map[string]string{ClientAppCline: ReasoningTags}}
+	if err := prs.SetReasoningConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &ProviderRelayService{}
+	loaded.loadReasoningConfig()
+	if loaded.GetReasoningConfig().Clients[ClientAppCline] != ReasoningTags {
+		t.Fatalf("loaded = %+v", loaded.GetReasoningConfig())
+	}
+}
+
+func TestReasoningTokenCounting(t *testing.T) {
+	log := &ReqeustLog{}
+	ClaudeCodeParseTokenUsageFromResponse(`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"abcdefgh"}}`, log)
+	if log.ReasoningTokens != 2 {
+		t.Fatalf("claude thinking tokens = %d", log.ReasoningTokens)
+	}
+
+	log = &ReqeustLog{}
+	CodexParseTokenUsageFromResponse(`{"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4,"thoughtsTokenCount":6}}`, log)
+	if log.OutputTokens != 10 || log.ReasoningTokens != 6 {
+		t.Fatalf("gemini usage = out %d reasoning %d", log.OutputTokens, log.ReasoningTokens)
+	}
+
+	resp := (&GeminiConverter{}).ConvertGeminiToOpenAI(&GeminiResponse{
+		Candidates: []GeminiCandidate{{Content: GeminiContent{Parts: []GeminiPart{
+			{Text: "thinking...", Thought: true},
+			{Text: "answer"},
+		}}, FinishReason: "STOP"}},
+		UsageMetadata: GeminiUsageMetadata{PromptTokenCount: 3, CandidatesTokenCount: 2, ThoughtsTokenCount: 5, TotalTokenCount: 10},
+	}, "gemini-2.5-pro")
+	message := resp["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})
+	usage := resp["usage"].(map[string]interface{})
+	if message["content"] != "answer" || message["reasoning_content"] != "thinking..." || usage["completion_tokens"] != 7 {
+		t.Fatalf("converted = %+v", resp)
+	}
+}
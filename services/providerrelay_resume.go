@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 流式响应断点续传：开启后，携带 Idempotency-Key 的流式请求在客户端断开时不取消上游请求，
+// 继续接收并缓存剩余响应（最长为设置的时长，避免白白计费却丢失输出）。客户端用同一 Key 重连时
+// 先收到已输出的部分，再实时接收后续数据；通过 X-CS-Resume-Offset 声明已收到的字节数时从断点继续。
+// 超过时长仍未结束的响应被取消且不缓存
+
+const (
+	// headerResumeOffset 客户端已收到的响应字节数
+	headerResumeOffset = "X-CS-Resume-Offset"
+	// ctxKeyStreamResumable 本次请求的流式响应在客户端断开后可继续接收
+	ctxKeyStreamResumable = "codeswitch.stream_resumable"
+	// ctxKeyStreamIncomplete 响应未完整输出（中途失败或断开），不能作为幂等结果缓存
+	ctxKeyStreamIncomplete = "codeswitch.stream_incomplete"
+)
+
+var errStreamResumeExpired = errors.New("client disconnected and the stream resume window expired")
+
+// SetStreamResumeWindow 设置客户端断开后继续接收流式响应的最长时间，<=0 关闭
+func (prs *ProviderRelayService) SetStreamResumeWindow(window time.Duration) {
+	if window < 0 {
+		window = 0
+	}
+	atomic.StoreInt64(&prs.idempotency.resumeWindow, int64(window))
+}
+
+// StreamResumeWindow 获取客户端断开后继续接收流式响应的最长时间
+func (prs *ProviderRelayService) StreamResumeWindow() time.Duration {
+	return time.Duration(atomic.LoadInt64(&prs.idempotency.resumeWindow))
+}
+
+// resumeOffset 客户端声明的已收到字节数，未声明或无效时为 0
+func resumeOffset(c *gin.Context) int {
+	offset, err := strconv.Atoi(strings.TrimSpace(c.GetHeader(headerResumeOffset)))
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+func isEventStream(header http.Header) bool {
+	return strings.Contains(strings.ToLower(header.Get("Content-Type")), "text/event-stream")
+}
+
+// upstreamParentContext 可续传的流式请求不随客户端断开而取消上游请求
+func upstreamParentContext(c *gin.Context, stream bool) context.Context {
+	if stream && c.GetBool(ctxKeyStreamResumable) {
+		return context.WithoutCancel(c.Request.Context())
+	}
+	return c.Request.Context()
+}
+
+// watchClientDisconnect 客户端断开后最多继续接收 resume window 时长，超时取消上游请求；返回的函数停止监听
+func (prs *ProviderRelayService) watchClientDisconnect(c *gin.Context, stream bool, traceID string, cancel context.CancelCauseFunc) func() {
+	window := prs.StreamResumeWindow()
+	if !stream || !c.GetBool(ctxKeyStreamResumable) || window <= 0 {
+		return func() {}
+	}
+	var timer atomic.Pointer[time.Timer]
+	stop := context.AfterFunc(c.Request.Context(), func() {
+		fmt.Printf("[Resume] 客户端已断开，继续接收响应最多 %s (trace_id=%s)\n", window, traceID)
+		timer.Store(time.AfterFunc(window, func() { cancel(errStreamResumeExpired) }))
+	})
+	return func() {
+		stop()
+		if t := timer.Load(); t != nil {
+			t.Stop()
+		}
+	}
+}
+
+// followIdempotentStream 重连的请求从 offset 开始输出进行中的流式响应，并实时跟随后续数据；
+// 原请求尚未开始输出流式响应（或不是流式响应）时返回 false
+func (prs *ProviderRelayService) followIdempotentStream(c *gin.Context, ctx context.Context, entry *idempotencyEntry, offset int) bool {
+	store := &prs.idempotency
+	started := false
+	for {
+		// 先检查是否结束，再读取数据：结束后追加的数据不会遗漏
+		finished := false
+		select {
+		case <-entry.done:
+			finished = true
+		default:
+		}
+		store.mu.Lock()
+		live, overflow, body, updated := entry.live, entry.overflow, entry.body, entry.updated
+		store.mu.Unlock()
+
+		if live == nil || overflow {
+			if finished || started {
+				return started
+			}
+		} else {
+			if !started {
+				writeIdempotentHeader(c, live)
+				c.Writer.Flush()
+				started = true
+			}
+			if offset < len(body) {
+				if _, err := c.Writer.Write(body[offset:]); err != nil {
+					return true
+				}
+				c.Writer.Flush()
+				offset = len(body)
+			}
+			if finished {
+				return true
+			}
+		}
+
+		select {
+		case <-updated:
+		case <-entry.done:
+		case <-ctx.Done():
+			if !started {
+				return false
+			}
+			return true
+		}
+	}
+}
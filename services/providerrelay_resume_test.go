@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamResumeAfterClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	prs.SetStreamResumeWindow(5 * time.Second)
+
+	var calls int64
+	upstream := make(chan string)
+	disconnected := make(chan struct{}, 4)
+	router := gin.New()
+	router.POST("/v1/messages", func(c *gin.Context) {
+		finish, handled := prs.beginIdempotentRequest(c, "claude", "/v1/messages", nil)
+		if handled {
+			return
+		}
+		defer finish()
+		atomic.AddInt64(&calls, 1)
+		go func() {
+			<-c.Request.Context().Done()
+			disconnected <- struct{}{}
+		}()
+		// 与 forwardRequest 相同：上游请求不随客户端断开而取消，超过续传时长后取消
+		upstreamCtx, cancel := context.WithCancelCause(upstreamParentContext(c, true))
+		defer cancel(nil)
+		defer prs.watchClientDisconnect(c, true, "trace", cancel)()
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+		for {
+			select {
+			case chunk, ok := <-upstream:
+				if !ok {
+					return
+				}
+				c.Writer.Write([]byte(chunk))
+				c.Writer.Flush()
+			case <-upstreamCtx.Done():
+				c.Set(ctxKeyStreamIncomplete, true)
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	send := func(key string, offset int) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/messages", nil)
+		req.Header.Set(headerIdempotencyKey, key)
+		if offset > 0 {
+			req.Header.Set(headerResumeOffset, strconv.Itoa(offset))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 收到第一段后断开
+	first := send("s1", 0)
+	upstream <- "data: 1\n\n"
+	line, _ := bufio.NewReader(first.Body).ReadString('\n')
+	if line != "data: 1\n" {
+		t.Fatalf("first chunk = %q", line)
+	}
+	first.Body.Close()
+	<-disconnected
+
+	// 断开期间的输出被继续接收；重连后从断点继续并实时跟随
+	upstream <- "data: 2\n\n"
+	resumed := send("s1", len("data: 1\n\n"))
+	if resumed.Header.Get(headerIdempotentReplayed) != "true" {
+		t.Fatalf("resumed headers = %v", resumed.Header)
+	}
+	upstream <- "data: 3\n\n"
+	close(upstream)
+	body, _ := io.ReadAll(resumed.Body)
+	resumed.Body.Close()
+	if string(body) != "data: 2\n\ndata: 3\n\n" {
+		t.Fatalf("resumed body = %q", body)
+	}
+
+	// 完整响应已缓存
+	replay := send("s1", 0)
+	body, _ = io.ReadAll(replay.Body)
+	replay.Body.Close()
+	if string(body) != "data: 1\n\ndata: 2\n\ndata: 3\n\n" || calls != 1 {
+		t.Fatalf("replay body = %q, calls = %d", body, calls)
+	}
+
+	// 超过续传时长后取消上游请求，不完整的响应不缓存
+	prs.SetStreamResumeWindow(50 * time.Millisecond)
+	upstream = make(chan string)
+	abandoned := send("s2", 0)
+	upstream <- "data: partial\n\n"
+	bufio.NewReader(abandoned.Body).ReadString('\n')
+	abandoned.Body.Close()
+	<-disconnected
+	deadline := time.Now().Add(2 * time.Second)
+	for prs.GetIdempotencyStats().InFlight != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := prs.GetIdempotencyStats(); stats.InFlight != 0 || stats.Cached != 1 {
+		t.Fatalf("stats after expiry = %+v", stats)
+	}
+	retry := send("s2", 0)
+	close(upstream)
+	body, _ = io.ReadAll(retry.Body)
+	retry.Body.Close()
+	if calls != 3 || strings.Contains(string(body), "partial") {
+		t.Fatalf("retry after expiry: calls = %d, body = %q", calls, body)
+	}
+}
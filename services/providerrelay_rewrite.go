@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应改写：推理内容处理、响应规范化等在返回客户端前改写上游的 2xx 响应。
+// 非流式响应整体缓冲后改写，流式响应按完整的 SSE 事件逐个改写
+
+// responseRewriter 一次响应的改写逻辑
+type responseRewriter interface {
+	// event 改写一个原始 SSE 事件（含结尾的空行），返回写给客户端的内容
+	event(raw []byte) []byte
+	// body 改写完整的非流式响应
+	body(data []byte) []byte
+}
+
+// installResponseRewriter 临时替换 c.Writer；返回的 restore 写出缓冲的内容并还原 c.Writer
+func installResponseRewriter(c *gin.Context, stream bool, rewriter responseRewriter) func() {
+	original := c.Writer
+	writer := &rewriteResponseWriter{ResponseWriter: original, stream: stream, rewriter: rewriter}
+	c.Writer = writer
+	return func() {
+		writer.finish()
+		c.Writer = original
+	}
+}
+
+// rewriteResponseWriter 改写写给客户端的 2xx 响应；非 2xx 响应原样透传
+type rewriteResponseWriter struct {
+	gin.ResponseWriter
+	stream   bool
+	rewriter responseRewriter
+	buffered bytes.Buffer // 非流式：完整响应；流式：未结束的 SSE 事件
+}
+
+func (w *rewriteResponseWriter) rewriting() bool {
+	status := w.ResponseWriter.Status()
+	return status >= http.StatusOK && status < http.StatusMultipleChoices
+}
+
+func (w *rewriteResponseWriter) WriteHeader(code int) {
+	if code >= http.StatusOK && code < http.StatusMultipleChoices {
+		// 改写后长度变化，去掉上游的 Content-Length
+		w.ResponseWriter.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *rewriteResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *rewriteResponseWriter) Write(data []byte) (int, error) {
+	if !w.rewriting() {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buffered.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	// 流式：按完整的 SSE 事件改写，未结束的事件留到下次写入
+	var out bytes.Buffer
+	pending := w.buffered.Bytes()
+	for {
+		event, rest, ok := nextSSEEvent(pending)
+		if !ok {
+			break
+		}
+		out.Write(w.rewriter.event(event))
+		pending = rest
+	}
+	rest := append([]byte(nil), pending...)
+	w.buffered.Reset()
+	w.buffered.Write(rest)
+	if out.Len() > 0 {
+		if _, err := w.ResponseWriter.Write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// finish 写出缓冲的内容：非流式响应整体改写，流式响应写出最后一个事件
+func (w *rewriteResponseWriter) finish() {
+	if w.buffered.Len() == 0 {
+		return
+	}
+	data := w.buffered.Bytes()
+	if w.stream {
+		w.ResponseWriter.Write(w.rewriter.event(data))
+	} else {
+		w.ResponseWriter.Write(w.rewriter.body(data))
+	}
+	w.buffered.Reset()
+}
+
+// nextSSEEvent 返回缓冲中第一个以空行结束的事件（含结尾的空行）
+func nextSSEEvent(buf []byte) ([]byte, []byte, bool) {
+	for i := 0; i < len(buf); i++ {
+		if buf[i] != '\n' {
+			continue
+		}
+		j := i + 1
+		if j < len(buf) && buf[j] == '\r' {
+			j++
+		}
+		if j < len(buf) && buf[j] == '\n' {
+			return buf[:j+1], buf[j+1:], true
+		}
+	}
+	return nil, buf, false
+}
+
+// sseEvent 改写后输出的事件；name 为空时只写 data 行（Chat Completions 格式）
+type sseEvent struct {
+	name string
+	data []byte
+}
+
+// parseSSEEvent 取出事件名与 data 行（多行 data 以换行拼接）
+func parseSSEEvent(raw []byte) (string, string) {
+	var name string
+	var data []string
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return name, strings.Join(data, "\n")
+}
+
+// encodeSSEEvents 序列化改写后的事件
+func encodeSSEEvents(events []sseEvent) []byte {
+	var out bytes.Buffer
+	for _, ev := range events {
+		if ev.name != "" {
+			out.WriteString("event: " + ev.name + "\n")
+		}
+		out.WriteString("data: ")
+		out.Write(ev.data)
+		out.WriteString("\n\n")
+	}
+	return out.Bytes()
+}
+
+// marshalUnescapedJSON 序列化改写后的内容，不转义尖括号等 HTML 字符
+func marshalUnescapedJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,687 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeswitch/services/luascript"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// 请求脚本：~/.code-switch/scripts/<平台>.lua 中定义的 on_request(req) 在路由前执行，
+// 可以读取并修改请求体（req.body）与请求头（req.headers），返回 provider 名称以优先使用该 provider，
+// 或调用 reject(message, status) 直接拒绝请求。脚本运行在基于 gopher-lua（Lua 5.1）的沙箱中（见 luascript），
+// 受步数、时间与内存限制；文件修改后自动重新加载，脚本出错时跳过脚本按原请求继续转发
+
+const (
+	// scriptEntry 脚本的入口函数
+	scriptEntry = "on_request"
+	// defaultScriptTimeout 单次执行的默认时间上限
+	defaultScriptTimeout = 50 * time.Millisecond
+	// defaultScriptMaxSteps 单次执行的默认步数上限
+	defaultScriptMaxSteps = 1000000
+	// defaultScriptMaxMemoryMB 单次执行的默认内存上限
+	defaultScriptMaxMemoryMB = 16
+	// scriptReloadInterval 检查脚本文件是否修改的最短间隔
+	scriptReloadInterval = time.Second
+)
+
+// ScriptConfig 请求脚本配置
+type ScriptConfig struct {
+	Disabled    []string `json:"disabled,omitempty"`      // 停用脚本的平台
+	TimeoutMs   int      `json:"timeout_ms,omitempty"`    // 单次执行时间上限，默认 50
+	MaxSteps    int      `json:"max_steps,omitempty"`     // 单次执行步数上限，默认 1000000
+	MaxMemoryMB int      `json:"max_memory_mb,omitempty"` // 单次执行内存上限（估算），默认 16
+}
+
+// ScriptStatus 平台脚本状态
+type ScriptStatus struct {
+	Platform  string `json:"platform"`
+	Path      string `json:"path"`
+	Enabled   bool   `json:"enabled"`
+	UpdatedAt int64  `json:"updated_at"`
+	Error     string `json:"error,omitempty"` // 编译错误
+}
+
+// ScriptTestRequest 试运行脚本的输入
+type ScriptTestRequest struct {
+	Source  string            `json:"source,omitempty"` // 为空时使用已保存的脚本
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Path    string            `json:"path,omitempty"`
+}
+
+// ScriptTestResult 试运行结果
+type ScriptTestResult struct {
+	Body          string            `json:"body"`
+	BodyChanged   bool              `json:"body_changed"`
+	Headers       map[string]string `json:"headers"`
+	Provider      string            `json:"provider,omitempty"`
+	Rejected      bool              `json:"rejected"`
+	RejectStatus  int               `json:"reject_status,omitempty"`
+	RejectMessage string            `json:"reject_message,omitempty"`
+	Logs          []string          `json:"logs"`
+	Steps         int               `json:"steps"`
+	DurationMs    float64           `json:"duration_ms"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// scriptStore 脚本配置与已编译脚本的缓存
+type scriptStore struct {
+	mu       sync.RWMutex
+	config   ScriptConfig
+	cacheMu  sync.Mutex
+	compiled map[string]*cachedScript
+}
+
+// cachedScript 按修改时间缓存的编译结果；script 为 nil 且 err 为 nil 表示没有脚本文件
+type cachedScript struct {
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+	script    *luascript.Script
+	err       error
+}
+
+// scriptRejection 脚本调用 reject() 拒绝请求；宿主函数返回的错误会终止脚本，脚本中的 pcall 无法捕获
+type scriptRejection struct {
+	Status  int
+	Message string
+}
+
+func (r *scriptRejection) Error() string {
+	return fmt.Sprintf("request rejected by script: %s", r.Message)
+}
+
+// scriptOutcome 一次脚本执行的结果
+type scriptOutcome struct {
+	body        []byte
+	bodyChanged bool
+	headerPatch map[string]string // 值为空表示删除
+	provider    string
+	rejection   *scriptRejection
+	logs        []string
+	steps       int
+	duration    time.Duration
+}
+
+// Validate 检查脚本配置
+func (cfg ScriptConfig) Validate() error {
+	if cfg.TimeoutMs < 0 || cfg.MaxSteps < 0 || cfg.MaxMemoryMB < 0 {
+		return fmt.Errorf("timeout_ms、max_steps 与 max_memory_mb 不能为负数")
+	}
+	return nil
+}
+
+// limits 单次执行的资源限制
+func (cfg ScriptConfig) limits() luascript.Limits {
+	limits := luascript.Limits{
+		Timeout:   defaultScriptTimeout,
+		MaxSteps:  defaultScriptMaxSteps,
+		MaxMemory: defaultScriptMaxMemoryMB << 20,
+	}
+	if cfg.TimeoutMs > 0 {
+		limits.Timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	if cfg.MaxSteps > 0 {
+		limits.MaxSteps = cfg.MaxSteps
+	}
+	if cfg.MaxMemoryMB > 0 {
+		limits.MaxMemory = cfg.MaxMemoryMB << 20
+	}
+	return limits
+}
+
+// enabled 平台的脚本是否启用
+func (cfg ScriptConfig) enabled(platform string) bool {
+	for _, disabled := range cfg.Disabled {
+		if disabled == platform {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptsDir 脚本目录
+func scriptsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "scripts"), nil
+}
+
+// scriptPath 平台脚本文件，平台名不能包含路径分隔符
+func scriptPath(platform string) (string, error) {
+	if platform == "" || platform == "." || platform == ".." || strings.ContainsAny(platform, `/\`) {
+		return "", fmt.Errorf("invalid platform %q", platform)
+	}
+	dir, err := scriptsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, platform+".lua"), nil
+}
+
+// scriptConfigPath 脚本配置文件
+func scriptConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "scripts.json"), nil
+}
+
+// GetScriptConfig 获取请求脚本配置
+func (prs *ProviderRelayService) GetScriptConfig() ScriptConfig {
+	prs.scripts.mu.RLock()
+	defer prs.scripts.mu.RUnlock()
+	return prs.scripts.config
+}
+
+// SetScriptConfig 更新请求脚本配置，持久化到 scripts.json
+func (prs *ProviderRelayService) SetScriptConfig(cfg ScriptConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	path, err := scriptConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	prs.scripts.mu.Lock()
+	prs.scripts.config = cfg
+	prs.scripts.mu.Unlock()
+	return nil
+}
+
+// SetScriptEnabled 启用或停用平台的请求脚本
+func (prs *ProviderRelayService) SetScriptEnabled(platform string, enabled bool) error {
+	cfg := prs.GetScriptConfig()
+	disabled := make([]string, 0, len(cfg.Disabled)+1)
+	for _, p := range cfg.Disabled {
+		if p != platform {
+			disabled = append(disabled, p)
+		}
+	}
+	if !enabled {
+		disabled = append(disabled, platform)
+	}
+	cfg.Disabled = disabled
+	return prs.SetScriptConfig(cfg)
+}
+
+// loadScriptConfig 启动时从 scripts.json 恢复
+func (prs *ProviderRelayService) loadScriptConfig() {
+	path, err := scriptConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cfg ScriptConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("[Script] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("[Script] 配置无效，使用默认值: %v\n", err)
+		return
+	}
+	prs.scripts.mu.Lock()
+	prs.scripts.config = cfg
+	prs.scripts.mu.Unlock()
+}
+
+// GetRequestScript 读取平台脚本源码，没有脚本时返回空字符串
+func (prs *ProviderRelayService) GetRequestScript(platform string) (string, error) {
+	path, err := scriptPath(platform)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SaveRequestScript 编译检查后保存平台脚本；源码为空时删除脚本
+func (prs *ProviderRelayService) SaveRequestScript(platform, source string) error {
+	path, err := scriptPath(platform)
+	if err != nil {
+		return err
+	}
+	defer prs.invalidateScript(platform)
+	if strings.TrimSpace(source) == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if _, err := luascript.Compile(platform+".lua", source); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(source), 0644)
+}
+
+// GetRequestScripts 列出脚本目录中的平台脚本
+func (prs *ProviderRelayService) GetRequestScripts() ([]ScriptStatus, error) {
+	dir, err := scriptsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []ScriptStatus{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg := prs.GetScriptConfig()
+	statuses := make([]ScriptStatus, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".lua" {
+			continue
+		}
+		platform := strings.TrimSuffix(entry.Name(), ".lua")
+		status := ScriptStatus{
+			Platform: platform,
+			Path:     filepath.Join(dir, entry.Name()),
+			Enabled:  cfg.enabled(platform),
+		}
+		if info, err := entry.Info(); err == nil {
+			status.UpdatedAt = info.ModTime().Unix()
+		}
+		if _, err := prs.scriptFor(platform); err != nil {
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Platform < statuses[j].Platform })
+	return statuses, nil
+}
+
+// invalidateScript 清除平台脚本的缓存，下次使用时重新读取
+func (prs *ProviderRelayService) invalidateScript(platform string) {
+	prs.scripts.cacheMu.Lock()
+	delete(prs.scripts.compiled, platform)
+	prs.scripts.cacheMu.Unlock()
+}
+
+// scriptFor 平台脚本的编译结果：每秒最多检查一次文件，修改时间或大小变化时重新编译；没有脚本时返回 nil
+func (prs *ProviderRelayService) scriptFor(platform string) (*luascript.Script, error) {
+	path, err := scriptPath(platform)
+	if err != nil {
+		return nil, err
+	}
+	prs.scripts.cacheMu.Lock()
+	defer prs.scripts.cacheMu.Unlock()
+	if prs.scripts.compiled == nil {
+		prs.scripts.compiled = make(map[string]*cachedScript)
+	}
+	cached := prs.scripts.compiled[platform]
+	now := time.Now()
+	if cached != nil && now.Sub(cached.checkedAt) < scriptReloadInterval {
+		return cached.script, cached.err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("[Script] 读取 %s 失败: %v\n", path, err)
+		}
+		prs.scripts.compiled[platform] = &cachedScript{checkedAt: now}
+		return nil, nil
+	}
+	if cached != nil && (cached.script != nil || cached.err != nil) && info.ModTime().Equal(cached.modTime) && info.Size() == cached.size {
+		cached.checkedAt = now
+		return cached.script, cached.err
+	}
+
+	entry := &cachedScript{modTime: info.ModTime(), size: info.Size(), checkedAt: now}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		entry.script, err = luascript.Compile(filepath.Base(path), string(data))
+	}
+	if err != nil {
+		fmt.Printf("[Script] %s 加载失败: %v\n", path, err)
+		entry.err = err
+	} else if cached != nil {
+		fmt.Printf("[Script] 已重新加载 %s\n", path)
+	}
+	prs.scripts.compiled[platform] = entry
+	return entry.script, entry.err
+}
+
+// scriptVisibleHeaders 传给脚本的请求头：名称小写，不包含凭据
+func scriptVisibleHeaders(headers map[string]string) map[string]string {
+	visible := make(map[string]string, len(headers))
+	for key, value := range pluginVisibleHeaders(headers) {
+		visible[strings.ToLower(key)] = value
+	}
+	return visible
+}
+
+// executeRequestScript 执行脚本的 on_request(req)。
+// req 包含 platform、path、model、stream、headers（小写名称）与 body（解码后的 JSON）；
+// 返回值为字符串时作为优先使用的 provider
+func executeRequestScript(platform string, script *luascript.Script, cfg ScriptConfig, path string, headers map[string]string, body []byte) (scriptOutcome, error) {
+	start := time.Now()
+	outcome := scriptOutcome{body: body}
+	state := luascript.NewState(cfg.limits())
+	defer state.Close()
+	root, err := state.DecodeJSON(body)
+	if err != nil {
+		return outcome, fmt.Errorf("request body is not valid JSON: %w", err)
+	}
+
+	visible := scriptVisibleHeaders(headers)
+	headerTable := state.NewTable()
+	names := make([]string, 0, len(visible))
+	for name := range visible {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		headerTable.RawSetString(name, lua.LString(visible[name]))
+	}
+
+	req := state.NewTable()
+	req.RawSetString("platform", lua.LString(platform))
+	req.RawSetString("path", lua.LString(path))
+	req.RawSetString("model", lua.LString(gjson.GetBytes(body, "model").String()))
+	req.RawSetString("stream", lua.LBool(gjson.GetBytes(body, "stream").Bool()))
+	req.RawSetString("headers", headerTable)
+	req.RawSetString("body", root)
+
+	state.Register("reject", func(args []lua.LValue) ([]lua.LValue, error) {
+		rejection := &scriptRejection{Status: http.StatusForbidden, Message: "request rejected by script"}
+		if len(args) > 0 && args[0] != lua.LNil {
+			rejection.Message = luascript.ToString(args[0])
+		}
+		if len(args) > 1 {
+			if status, ok := args[1].(lua.LNumber); ok && status >= 400 && status <= 599 {
+				rejection.Status = int(status)
+			}
+		}
+		return nil, rejection
+	})
+
+	finish := func(err error) (scriptOutcome, error) {
+		outcome.logs = state.Output()
+		outcome.steps = state.Steps()
+		outcome.duration = time.Since(start)
+		var rejection *scriptRejection
+		if errors.As(err, &rejection) {
+			outcome.rejection = rejection
+			return outcome, nil
+		}
+		return outcome, err
+	}
+
+	if _, err := state.Run(script); err != nil {
+		return finish(err)
+	}
+	rets, found, err := state.Call(scriptEntry, req)
+	if !found {
+		return finish(fmt.Errorf("script does not define %s(req)", scriptEntry))
+	}
+	if err != nil {
+		return finish(err)
+	}
+	if len(rets) > 0 {
+		if provider, ok := rets[0].(lua.LString); ok {
+			outcome.provider = string(provider)
+		}
+	}
+
+	// 请求体：重新编码后与原请求体语义不同时才替换，未修改时保持原始字节
+	newBody, ok := req.RawGetString("body").(*lua.LTable)
+	if !ok {
+		return finish(fmt.Errorf("req.body must be a table, got %s", luascript.TypeName(req.RawGetString("body"))))
+	}
+	encoded, err := state.EncodeJSON(newBody)
+	if err != nil {
+		return finish(err)
+	}
+	if !jsonEquivalent(body, encoded) {
+		outcome.body = encoded
+		outcome.bodyChanged = true
+	}
+
+	// 请求头：与执行前对比，得到新增、修改与删除的请求头
+	patch := make(map[string]string)
+	if newHeaders, ok := req.RawGetString("headers").(*lua.LTable); ok {
+		var headerErr error
+		newHeaders.ForEach(func(k, v lua.LValue) {
+			name, ok := k.(lua.LString)
+			if !ok || headerErr != nil {
+				return
+			}
+			var value string
+			switch x := v.(type) {
+			case lua.LString, lua.LNumber:
+				value = x.String()
+			default:
+				headerErr = fmt.Errorf("header %q must be a string, got %s", string(name), luascript.TypeName(v))
+				return
+			}
+			if old, exists := visible[strings.ToLower(string(name))]; !exists || old != value {
+				patch[string(name)] = value
+			}
+		})
+		if headerErr != nil {
+			return finish(headerErr)
+		}
+		for _, name := range names {
+			if newHeaders.RawGetString(name) == lua.LNil {
+				patch[name] = ""
+			}
+		}
+	} else {
+		for _, name := range names {
+			patch[name] = ""
+		}
+	}
+	if len(patch) > 0 {
+		outcome.headerPatch = patch
+	}
+	return finish(nil)
+}
+
+// jsonEquivalent 两段 JSON 解码后是否相同（忽略空白与键顺序）
+func jsonEquivalent(a, b []byte) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// applyRequestScript 在路由前执行平台脚本，改写 c.Request 的请求头并返回新的请求体与脚本指定的 provider；
+// 脚本拒绝请求时已向客户端返回错误，blocked 为 true
+func (prs *ProviderRelayService) applyRequestScript(c *gin.Context, platform string, body []byte) ([]byte, string, bool) {
+	cfg := prs.GetScriptConfig()
+	if !cfg.enabled(platform) || len(body) == 0 {
+		return body, "", false
+	}
+	script, err := prs.scriptFor(platform)
+	if script == nil || err != nil {
+		return body, "", false
+	}
+	outcome, err := executeRequestScript(platform, script, cfg, c.Request.URL.Path, cloneHeaders(c.Request.Header), body)
+	for _, line := range outcome.logs {
+		fmt.Printf("[Script] %s: %s\n", platform, line)
+	}
+	if err != nil {
+		fmt.Printf("[Script] %s 脚本执行失败，按原请求继续: %v\n", platform, err)
+		return body, "", false
+	}
+	if outcome.rejection != nil {
+		fmt.Printf("[Script] %s 脚本拒绝了请求: %s\n", platform, outcome.rejection.Message)
+		c.AbortWithStatusJSON(outcome.rejection.Status, gin.H{"error": outcome.rejection.Message, "type": "script_rejected"})
+		return nil, "", true
+	}
+	for name, value := range outcome.headerPatch {
+		if value == "" {
+			c.Request.Header.Del(name)
+		} else {
+			c.Request.Header.Set(name, value)
+		}
+	}
+	if outcome.bodyChanged {
+		c.Request.Body = io.NopCloser(bytes.NewReader(outcome.body))
+		c.Request.ContentLength = int64(len(outcome.body))
+	}
+	return outcome.body, outcome.provider, false
+}
+
+// preferScriptProvider 把脚本指定的 provider 移到最前；不在可用列表中时保持原顺序
+func preferScriptProvider(kind string, active []Provider, name string) ([]Provider, bool) {
+	if name == "" {
+		return active, false
+	}
+	for i, p := range active {
+		if p.Name == name {
+			ordered := make([]Provider, 0, len(active))
+			ordered = append(ordered, p)
+			ordered = append(ordered, active[:i]...)
+			ordered = append(ordered, active[i+1:]...)
+			fmt.Printf("[Script] %s 脚本指定 provider：%s\n", kind, name)
+			return ordered, true
+		}
+	}
+	fmt.Printf("[Script] %s 脚本指定的 provider %s 当前不可用，按正常规则路由\n", kind, name)
+	return active, false
+}
+
+// TestRequestScript 用示例请求试运行脚本，不影响实际流量；源码为空时使用已保存的脚本
+func (prs *ProviderRelayService) TestRequestScript(platform string, req ScriptTestRequest) (ScriptTestResult, error) {
+	source := req.Source
+	if strings.TrimSpace(source) == "" {
+		saved, err := prs.GetRequestScript(platform)
+		if err != nil {
+			return ScriptTestResult{}, err
+		}
+		if saved == "" {
+			return ScriptTestResult{}, fmt.Errorf("no script saved for %s", platform)
+		}
+		source = saved
+	}
+	script, err := luascript.Compile(platform+".lua", source)
+	if err != nil {
+		return ScriptTestResult{}, err
+	}
+	headers := req.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	path := req.Path
+	if path == "" {
+		path = "/v1/messages"
+	}
+
+	outcome, runErr := executeRequestScript(platform, script, prs.GetScriptConfig(), path, headers, []byte(req.Body))
+	result := ScriptTestResult{
+		Body:        string(outcome.body),
+		BodyChanged: outcome.bodyChanged,
+		Headers:     scriptVisibleHeaders(headers),
+		Provider:    outcome.provider,
+		Logs:        outcome.logs,
+		Steps:       outcome.steps,
+		DurationMs:  float64(outcome.duration.Microseconds()) / 1000,
+	}
+	if result.Logs == nil {
+		result.Logs = []string{}
+	}
+	applyHeaderPatch(result.Headers, outcome.headerPatch)
+	if outcome.rejection != nil {
+		result.Rejected = true
+		result.RejectStatus = outcome.rejection.Status
+		result.RejectMessage = outcome.rejection.Message
+	}
+	if runErr != nil {
+		result.Error = runErr.Error()
+	}
+	return result, nil
+}
+
+// 管理 API
+
+func (prs *ProviderRelayService) adminGetScriptsHandler(c *gin.Context) {
+	scripts, err := prs.GetRequestScripts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"config": prs.GetScriptConfig(), "scripts": scripts})
+}
+
+func (prs *ProviderRelayService) adminGetScriptHandler(c *gin.Context) {
+	source, err := prs.GetRequestScript(c.Param("kind"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"platform": c.Param("kind"), "source": source})
+}
+
+func (prs *ProviderRelayService) adminSaveScriptHandler(c *gin.Context) {
+	var req struct {
+		Source string `json:"source"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := prs.SaveRequestScript(c.Param("kind"), req.Source); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"platform": c.Param("kind"), "source": req.Source})
+}
+
+func (prs *ProviderRelayService) adminTestScriptHandler(c *gin.Context) {
+	var req ScriptTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	result, err := prs.TestRequestScript(c.Param("kind"), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testRequestScript = `
+function on_request(req)
+	if req.body.model == "blocked" then
+		reject("model not allowed", 429)
+	end
+	print("model=" .. req.model)
+	req.body.model = string.gsub(req.body.model, "^gpt%-", "claude-")
+	req.body.temperature = 0
+	req.headers["x-script"] = "1"
+	req.headers["x-drop"] = nil
+	if req.stream then
+		return "fast"
+	end
+end
+`
+
+func TestExecuteRequestScript(t *testing.T) {
+	prs := &ProviderRelayService{}
+	result, err := prs.TestRequestScript("claude", ScriptTestRequest{
+		Source:  testRequestScript,
+		Body:    `{"model":"gpt-4o","stream":true,"messages":[]}`,
+		Headers: map[string]string{"X-Drop": "a", "Authorization": "Bearer secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Error != "" {
+		t.Fatalf("script error: %s", result.Error)
+	}
+	if !result.BodyChanged || result.Body != `{"model":"claude-4o","stream":true,"messages":[],"temperature":0}` {
+		t.Fatalf("body = %s", result.Body)
+	}
+	if result.Provider != "fast" {
+		t.Fatalf("provider = %q", result.Provider)
+	}
+	if result.Headers["x-script"] != "1" || result.Headers["x-drop"] != "" {
+		t.Fatalf("headers = %v", result.Headers)
+	}
+	if _, ok := result.Headers["authorization"]; ok {
+		t.Fatal("credentials must not be visible to scripts")
+	}
+	if len(result.Logs) != 1 || result.Logs[0] != "model=gpt-4o" {
+		t.Fatalf("logs = %v", result.Logs)
+	}
+
+	rejected, err := prs.TestRequestScript("claude", ScriptTestRequest{Source: testRequestScript, Body: `{"model":"blocked"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rejected.Rejected || rejected.RejectStatus != 429 || rejected.RejectMessage != "model not allowed" {
+		t.Fatalf("rejection = %+v", rejected)
+	}
+
+	// 未修改时保持原始字节
+	untouched, err := prs.TestRequestScript("claude", ScriptTestRequest{Source: "function on_request(req) end", Body: `{"b":1,  "a":2}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if untouched.BodyChanged || untouched.Body != `{"b":1,  "a":2}` {
+		t.Fatalf("untouched = %+v", untouched)
+	}
+
+	if _, err := prs.TestRequestScript("claude", ScriptTestRequest{Source: "function on_request(req"}); err == nil {
+		t.Fatal("expected compile error")
+	}
+}
+
+func TestRequestScriptLimitsFailOpen(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.scripts.config = ScriptConfig{TimeoutMs: 10}
+	start := time.Now()
+	result, err := prs.TestRequestScript("codex", ScriptTestRequest{
+		Source: "function on_request(req) req.body.x = 1 while true do end end",
+		Body:   `{"model":"m"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Error == "" || !strings.Contains(result.Error, "time limit") {
+		t.Fatalf("error = %q", result.Error)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("time limit not enforced")
+	}
+}
+
+func TestApplyRequestScriptHotReload(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	prs := &ProviderRelayService{}
+
+	newContext := func(body string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		return c
+	}
+
+	body := []byte(`{"model":"a"}`)
+	if out, provider, blocked := prs.applyRequestScript(newContext(string(body)), "claude", body); blocked || provider != "" || string(out) != string(body) {
+		t.Fatalf("no script: %s %q %v", out, provider, blocked)
+	}
+
+	if err := prs.SaveRequestScript("claude", `function on_request(req) req.body.model = "b" return "p1" end`); err != nil {
+		t.Fatal(err)
+	}
+	out, provider, blocked := prs.applyRequestScript(newContext(string(body)), "claude", body)
+	if blocked || provider != "p1" || string(out) != `{"model":"b"}` {
+		t.Fatalf("saved script: %s %q %v", out, provider, blocked)
+	}
+
+	// 直接修改文件：超过检查间隔后重新编译
+	path, _ := scriptPath("claude")
+	if err := os.WriteFile(path, []byte(`function on_request(req) reject("no") end`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	prs.scripts.compiled["claude"].checkedAt = time.Time{}
+	c := newContext(string(body))
+	if _, _, blocked := prs.applyRequestScript(c, "claude", body); !blocked {
+		t.Fatal("expected reloaded script to reject")
+	}
+	if c.Writer.Status() != http.StatusForbidden {
+		t.Fatalf("status = %d", c.Writer.Status())
+	}
+
+	// 停用后不再执行
+	if err := prs.SetScriptEnabled("claude", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, blocked := prs.applyRequestScript(newContext(string(body)), "claude", body); blocked {
+		t.Fatal("disabled script should not run")
+	}
+
+	if err := prs.SaveRequestScript("claude", "function on_request(req"); err == nil {
+		t.Fatal("expected invalid script to be rejected")
+	}
+	if err := prs.SaveRequestScript("../evil", "return 1"); err == nil {
+		t.Fatal("expected invalid platform to be rejected")
+	}
+	if err := prs.SaveRequestScript("claude", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("empty source should delete the script")
+	}
+}
+
+func TestPreferScriptProvider(t *testing.T) {
+	active := []Provider{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	ordered, hit := preferScriptProvider("claude", active, "c")
+	if !hit || ordered[0].Name != "c" || ordered[1].Name != "a" || ordered[2].Name != "b" {
+		t.Fatalf("ordered = %v", ordered)
+	}
+	if _, hit := preferScriptProvider("claude", active, "missing"); hit {
+		t.Fatal("unknown provider should not hit")
+	}
+}
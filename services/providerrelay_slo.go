@@ -0,0 +1,351 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Provider SLO：为 provider 设置延迟目标（如 p95 < 3s）与错误率上限（如 < 1%），
+// 按滚动窗口从 request_log 计算达标情况与剩余错误预算；最近 1 小时的预算消耗速度过快时推送事件
+
+// SLO 默认值
+const (
+	defaultSLOLatencyPercentile = 95
+	defaultSLOWindowDays        = 30
+	// defaultSLOBurnRateAlert 1 小时内消耗 30 天预算的 2%（多窗口告警中的快速消耗阈值）
+	defaultSLOBurnRateAlert = 14.4
+	maxSLOWindowDays        = 90
+	// sloBurnWindow 计算消耗速度的短窗口
+	sloBurnWindow = time.Hour
+	// sloMinBurnRequests 短窗口内请求数不足时不计算消耗速度，避免少量失败触发告警
+	sloMinBurnRequests = 10
+	// sloEvalInterval SLO 告警评估间隔
+	sloEvalInterval = 5 * time.Minute
+)
+
+// ProviderEventSLOBurn provider 错误预算消耗过快
+const ProviderEventSLOBurn = "provider.slo_burn"
+
+// SLO 目标类型
+const (
+	SLOObjectiveErrorRate = "error_rate"
+	SLOObjectiveLatency   = "latency"
+)
+
+var sloPlatforms = []string{"claude", "codex", "gemini-cli", "picoclaw"}
+
+// ProviderSLO provider 的服务等级目标，未设置的目标不参与计算
+type ProviderSLO struct {
+	LatencySec        float64 `json:"latencySec,omitempty"`        // 延迟目标（秒，按成功请求的总耗时）
+	LatencyPercentile float64 `json:"latencyPercentile,omitempty"` // 延迟分位数，默认 95
+	MaxErrorRate      float64 `json:"maxErrorRate,omitempty"`      // 错误率上限（0.01 = 1%）
+	WindowDays        int     `json:"windowDays,omitempty"`        // 滚动窗口，默认 30 天
+	BurnRateAlert     float64 `json:"burnRateAlert,omitempty"`     // 最近 1 小时预算消耗速度达到该倍数时告警，默认 14.4
+}
+
+// Validate 检查目标与阈值
+func (s ProviderSLO) Validate() error {
+	if s.LatencySec <= 0 && s.MaxErrorRate <= 0 {
+		return fmt.Errorf("at least one of latencySec and maxErrorRate is required")
+	}
+	if s.LatencySec < 0 || s.MaxErrorRate < 0 || s.MaxErrorRate >= 1 {
+		return fmt.Errorf("latencySec must not be negative and maxErrorRate must be between 0 and 1")
+	}
+	if s.LatencyPercentile != 0 && (s.LatencyPercentile < 50 || s.LatencyPercentile >= 100) {
+		return fmt.Errorf("latencyPercentile must be between 50 and 100")
+	}
+	if s.WindowDays < 0 || s.WindowDays > maxSLOWindowDays {
+		return fmt.Errorf("windowDays must be between 1 and %d", maxSLOWindowDays)
+	}
+	if s.BurnRateAlert != 0 && s.BurnRateAlert < 1 {
+		return fmt.Errorf("burnRateAlert must be at least 1")
+	}
+	return nil
+}
+
+// withDefaults 填充未设置的参数
+func (s ProviderSLO) withDefaults() ProviderSLO {
+	if s.LatencyPercentile == 0 {
+		s.LatencyPercentile = defaultSLOLatencyPercentile
+	}
+	if s.WindowDays == 0 {
+		s.WindowDays = defaultSLOWindowDays
+	}
+	if s.BurnRateAlert == 0 {
+		s.BurnRateAlert = defaultSLOBurnRateAlert
+	}
+	return s
+}
+
+// SLOObjective 单个目标的达标情况
+type SLOObjective struct {
+	Kind            string  `json:"kind"`             // error_rate / latency
+	Target          float64 `json:"target"`           // 错误率上限 / 延迟目标（秒）
+	Observed        float64 `json:"observed"`         // 窗口内的错误率 / 延迟分位数（秒）
+	Met             bool    `json:"met"`              // 窗口内是否达标
+	BudgetRemaining float64 `json:"budget_remaining"` // 剩余错误预算比例，小于 0 表示已超支
+	BurnRate        float64 `json:"burn_rate"`        // 最近 1 小时的预算消耗速度，1 表示恰好在窗口结束时用完
+}
+
+// ProviderSLOStatus provider 的 SLO 计算结果
+type ProviderSLOStatus struct {
+	Platform   string         `json:"platform"`
+	Provider   string         `json:"provider"`
+	SLO        ProviderSLO    `json:"slo"`
+	Requests   int64          `json:"requests"` // 窗口内的请求数
+	Compliant  bool           `json:"compliant"`
+	FastBurn   bool           `json:"fast_burn"` // 任一目标的消耗速度超过告警阈值
+	Objectives []SLOObjective `json:"objectives"`
+}
+
+// sloSamples 窗口内的请求样本
+type sloSamples struct {
+	requests, errors int64
+	durations        []float64 // 成功请求的耗时（秒）
+
+	recentRequests, recentErrors, recentSlow int64
+	recentSuccesses                          int64
+}
+
+// sloAlertStore 正在快速消耗预算的 provider，只在进入快速消耗状态时推送一次
+type sloAlertStore struct {
+	mu      sync.Mutex
+	burning map[string]bool
+}
+
+// isSLOFailure 与灰度评估一致：5xx、网络错误与 401/403/429 计为 provider 失败，其余 4xx 视为客户端问题
+func isSLOFailure(code int) bool {
+	return code < 200 || code >= 500 || code == http.StatusUnauthorized || code == http.StatusForbidden || code == http.StatusTooManyRequests
+}
+
+// querySLOSamples 读取 provider 在窗口内的请求结果与耗时
+func querySLOSamples(platform, provider string, since, recentSince time.Time, latencySec float64) (*sloSamples, error) {
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT COALESCE(http_code, 0), COALESCE(duration_sec, 0), CASE WHEN created_at >= ? THEN 1 ELSE 0 END
+		FROM request_log WHERE platform = ? AND provider = ? AND created_at >= ?`,
+		recentSince.UTC().Format(timeLayout), platform, provider, since.UTC().Format(timeLayout))
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return &sloSamples{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := &sloSamples{}
+	for rows.Next() {
+		var (
+			code     int
+			duration float64
+			recent   bool
+		)
+		if err := rows.Scan(&code, &duration, &recent); err != nil {
+			return nil, err
+		}
+		samples.requests++
+		failed := isSLOFailure(code)
+		if failed {
+			samples.errors++
+		} else {
+			samples.durations = append(samples.durations, duration)
+		}
+		if !recent {
+			continue
+		}
+		samples.recentRequests++
+		switch {
+		case failed:
+			samples.recentErrors++
+		default:
+			samples.recentSuccesses++
+			if latencySec > 0 && duration > latencySec {
+				samples.recentSlow++
+			}
+		}
+	}
+	return samples, rows.Err()
+}
+
+// sloBudget 预算消耗：bad / total 与允许的比例 allowed 比较
+func sloBudget(bad, total int64, allowed float64) float64 {
+	if total == 0 || allowed <= 0 {
+		return 1
+	}
+	return 1 - float64(bad)/float64(total)/allowed
+}
+
+// sloBurnRate 短窗口内不达标比例相对允许比例的倍数
+func sloBurnRate(bad, total int64, allowed float64) float64 {
+	if total < sloMinBurnRequests || allowed <= 0 {
+		return 0
+	}
+	return float64(bad) / float64(total) / allowed
+}
+
+// evaluateSLO 按样本计算每个目标的达标情况、剩余预算与消耗速度
+func evaluateSLO(platform, provider string, slo ProviderSLO, samples *sloSamples) ProviderSLOStatus {
+	slo = slo.withDefaults()
+	status := ProviderSLOStatus{
+		Platform:   platform,
+		Provider:   provider,
+		SLO:        slo,
+		Requests:   samples.requests,
+		Compliant:  true,
+		Objectives: make([]SLOObjective, 0, 2),
+	}
+
+	if slo.MaxErrorRate > 0 {
+		objective := SLOObjective{Kind: SLOObjectiveErrorRate, Target: slo.MaxErrorRate}
+		if samples.requests > 0 {
+			objective.Observed = float64(samples.errors) / float64(samples.requests)
+		}
+		objective.Met = objective.Observed <= slo.MaxErrorRate
+		objective.BudgetRemaining = sloBudget(samples.errors, samples.requests, slo.MaxErrorRate)
+		objective.BurnRate = sloBurnRate(samples.recentErrors, samples.recentRequests, slo.MaxErrorRate)
+		status.Objectives = append(status.Objectives, objective)
+	}
+
+	if slo.LatencySec > 0 {
+		// 延迟预算：允许 (100 - 分位数)% 的成功请求超过目标
+		allowed := 1 - slo.LatencyPercentile/100
+		objective := SLOObjective{Kind: SLOObjectiveLatency, Target: slo.LatencySec}
+		var slow int64
+		if len(samples.durations) > 0 {
+			sorted := append([]float64(nil), samples.durations...)
+			sort.Float64s(sorted)
+			objective.Observed = percentile(sorted, slo.LatencyPercentile/100)
+			for _, d := range sorted {
+				if d > slo.LatencySec {
+					slow++
+				}
+			}
+		}
+		objective.Met = objective.Observed <= slo.LatencySec
+		objective.BudgetRemaining = sloBudget(slow, int64(len(samples.durations)), allowed)
+		objective.BurnRate = sloBurnRate(samples.recentSlow, samples.recentSuccesses, allowed)
+		status.Objectives = append(status.Objectives, objective)
+	}
+
+	for _, objective := range status.Objectives {
+		if !objective.Met {
+			status.Compliant = false
+		}
+		if objective.BurnRate >= slo.BurnRateAlert {
+			status.FastBurn = true
+		}
+	}
+	return status
+}
+
+// computeProviderSLOStatuses 计算平台上所有设置了 SLO 的 provider；kind 为空时计算全部平台
+func computeProviderSLOStatuses(ps *ProviderService, kind string) ([]ProviderSLOStatus, error) {
+	platforms := sloPlatforms
+	if kind != "" {
+		platforms = []string{kind}
+	}
+	now := time.Now()
+	statuses := make([]ProviderSLOStatus, 0)
+	for _, platform := range platforms {
+		providers, err := ps.LoadProviders(platform)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range providers {
+			if p.SLO == nil {
+				continue
+			}
+			slo := p.SLO.withDefaults()
+			since := now.AddDate(0, 0, -slo.WindowDays)
+			samples, err := querySLOSamples(platform, p.Name, since, now.Add(-sloBurnWindow), slo.LatencySec)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, evaluateSLO(platform, p.Name, slo, samples))
+		}
+	}
+	return statuses, nil
+}
+
+// GetSLOStatuses 返回 provider 的 SLO 达标情况与错误预算；kind 为空时返回全部平台
+func (prs *ProviderRelayService) GetSLOStatuses(kind string) ([]ProviderSLOStatus, error) {
+	return computeProviderSLOStatuses(prs.providerService, kind)
+}
+
+// EvaluateSLOAlerts 检查预算消耗速度，provider 进入快速消耗状态时推送事件，返回本次新告警的 provider
+func (prs *ProviderRelayService) EvaluateSLOAlerts() []ProviderSLOStatus {
+	statuses, err := prs.GetSLOStatuses("")
+	if err != nil {
+		fmt.Printf("[SLO] 评估失败: %v\n", err)
+		return nil
+	}
+	alerted := make([]ProviderSLOStatus, 0)
+	prs.sloAlerts.mu.Lock()
+	if prs.sloAlerts.burning == nil {
+		prs.sloAlerts.burning = make(map[string]bool)
+	}
+	for _, status := range statuses {
+		key := providerKey(status.Platform, status.Provider)
+		wasBurning := prs.sloAlerts.burning[key]
+		prs.sloAlerts.burning[key] = status.FastBurn
+		if status.FastBurn && !wasBurning {
+			alerted = append(alerted, status)
+		}
+	}
+	prs.sloAlerts.mu.Unlock()
+
+	for _, status := range alerted {
+		reason := describeSLOBurn(status)
+		fmt.Printf("[SLO] %s/%s 错误预算消耗过快: %s\n", status.Platform, status.Provider, reason)
+		prs.emitProviderEvent(ProviderEvent{Type: ProviderEventSLOBurn, Platform: status.Platform, Provider: status.Provider, Reason: reason})
+	}
+	return alerted
+}
+
+// describeSLOBurn 消耗过快的目标说明
+func describeSLOBurn(status ProviderSLOStatus) string {
+	for _, objective := range status.Objectives {
+		if objective.BurnRate < status.SLO.BurnRateAlert {
+			continue
+		}
+		remaining := math.Max(objective.BudgetRemaining, 0) * 100
+		if objective.Kind == SLOObjectiveLatency {
+			return fmt.Sprintf("p%.0f 延迟目标 %.1fs，最近 1 小时消耗速度 %.1fx，剩余预算 %.0f%%",
+				status.SLO.LatencyPercentile, objective.Target, objective.BurnRate, remaining)
+		}
+		return fmt.Sprintf("错误率目标 %.2f%%，最近 1 小时消耗速度 %.1fx，剩余预算 %.0f%%",
+			objective.Target*100, objective.BurnRate, remaining)
+	}
+	return ""
+}
+
+// startSLOEvalTask 定期检查 SLO 预算消耗
+func (prs *ProviderRelayService) startSLOEvalTask() {
+	ticker := time.NewTicker(sloEvalInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		prs.EvaluateSLOAlerts()
+	}
+}
+
+// GetProviderSLOs 返回设置了 SLO 的 provider 的达标情况，platform 为空时返回全部平台
+func (ls *LogService) GetProviderSLOs(platform string) ([]ProviderSLOStatus, error) {
+	return computeProviderSLOStatuses(NewProviderService(), platform)
+}
+
+func (prs *ProviderRelayService) adminSLOHandler(c *gin.Context) {
+	statuses, err := prs.GetSLOStatuses(c.Query("platform"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"slos": statuses})
+}
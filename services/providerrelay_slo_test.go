@@ -0,0 +1,121 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestProviderSLOValidate(t *testing.T) {
+	invalid := []ProviderSLO{
+		{},
+		{MaxErrorRate: 1.5},
+		{LatencySec: -1, MaxErrorRate: 0.01},
+		{LatencySec: 3, LatencyPercentile: 100},
+		{MaxErrorRate: 0.01, WindowDays: 365},
+		{MaxErrorRate: 0.01, BurnRateAlert: 0.5},
+	}
+	for i, slo := range invalid {
+		if err := slo.Validate(); err == nil {
+			t.Fatalf("case %d: expected validation error", i)
+		}
+	}
+	if err := (ProviderSLO{LatencySec: 3, MaxErrorRate: 0.01}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvaluateSLO(t *testing.T) {
+	samples := &sloSamples{requests: 200, errors: 1, recentRequests: 20, recentErrors: 4, recentSuccesses: 16}
+	for i := 0; i < 199; i++ {
+		samples.durations = append(samples.durations, 1)
+	}
+	status := evaluateSLO("claude", "a", ProviderSLO{LatencySec: 3, MaxErrorRate: 0.01}, samples)
+	if !status.Compliant || len(status.Objectives) != 2 {
+		t.Fatalf("expected compliant status with two objectives, got %+v", status)
+	}
+	errRate := status.Objectives[0]
+	if errRate.Kind != SLOObjectiveErrorRate || errRate.BudgetRemaining < 0.49 || errRate.BudgetRemaining > 0.51 {
+		t.Fatalf("expected half of the error budget left, got %+v", errRate)
+	}
+	// 最近 1 小时 20% 失败，是 1% 目标的 20 倍
+	if errRate.BurnRate < 19.9 || !status.FastBurn {
+		t.Fatalf("expected fast burn, got %+v", errRate)
+	}
+	if latency := status.Objectives[1]; latency.Observed != 1 || !latency.Met || latency.BudgetRemaining != 1 || latency.BurnRate != 0 {
+		t.Fatalf("unexpected latency objective %+v", latency)
+	}
+
+	slow := &sloSamples{requests: 20, durations: make([]float64, 20), recentRequests: 5, recentSuccesses: 5, recentSlow: 5}
+	for i := range slow.durations {
+		slow.durations[i] = float64(i)
+	}
+	status = evaluateSLO("claude", "a", ProviderSLO{LatencySec: 3}, slow)
+	if status.Compliant || len(status.Objectives) != 1 || status.Objectives[0].Met {
+		t.Fatalf("expected latency objective to be missed, got %+v", status)
+	}
+	if status.FastBurn {
+		t.Fatal("too few recent requests should not compute a burn rate")
+	}
+}
+
+func TestEvaluateSLOAlertsOnce(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	prs := &ProviderRelayService{providerService: NewProviderService()}
+	events := make(chan ProviderEvent, 4)
+	prs.OnProviderEvent(func(e ProviderEvent) {
+		if e.Type == ProviderEventSLOBurn {
+			events <- e
+		}
+	})
+	if err := prs.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "flaky", APIURL: "https://a.example.com", APIKey: "k", Enabled: true, SLO: &ProviderSLO{MaxErrorRate: 0.01}},
+		{ID: 2, Name: "plain", APIURL: "https://b.example.com", APIKey: "k", Enabled: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db, _ := xdb.DB("default")
+	now := time.Now().UTC().Format(timeLayout)
+	for i := 0; i < 20; i++ {
+		code := 200
+		if i%4 == 0 {
+			code = 503
+		} else if i%4 == 1 {
+			code = 400 // 客户端错误不消耗预算
+		}
+		if _, err := db.Exec(`INSERT INTO request_log (platform, provider, model, http_code, duration_sec, created_at) VALUES ('claude', 'flaky', 'm', ?, 1, ?)`, code, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses, err := prs.GetSLOStatuses("claude")
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("statuses = %+v, err = %v", statuses, err)
+	}
+	if got := statuses[0].Objectives[0].Observed; got != 0.25 {
+		t.Fatalf("expected 25%% error rate, got %v", got)
+	}
+	if alerted := prs.EvaluateSLOAlerts(); len(alerted) != 1 {
+		t.Fatalf("expected one alert, got %+v", alerted)
+	}
+	select {
+	case e := <-events:
+		if e.Provider != "flaky" || e.Reason == "" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected slo burn event")
+	}
+	if alerted := prs.EvaluateSLOAlerts(); len(alerted) != 0 {
+		t.Fatalf("still burning provider should not alert again, got %+v", alerted)
+	}
+
+	analysis, err := (&LogService{}).PerformanceAnalysis("claude", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.ProviderReliability) != 1 || analysis.ProviderReliability[0].SLO == nil || analysis.ProviderReliability[0].SLO.Compliant {
+		t.Fatalf("expected SLO summary in reliability stats, got %+v", analysis.ProviderReliability)
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 转发服务整体状态，用于托盘图标角标
+const (
+	RelayHealthHealthy  = "healthy"
+	RelayHealthDegraded = "degraded"
+	RelayHealthFailing  = "failing"
+	RelayHealthPaused   = "paused"
+	RelayHealthStopped  = "stopped"
+)
+
+const (
+	// relayStatusWindow 请求速率与错误率的统计窗口
+	relayStatusWindow = 5 * time.Minute
+	// relayStatusMinRequests 窗口内请求数不足时不判定为异常，避免单个失败请求触发告警
+	relayStatusMinRequests = 5
+	relayDegradedErrorRate = 0.2
+	relayFailingErrorRate  = 0.5
+)
+
+// relayStatusTracker 最近请求的结果，按时间顺序排列
+type relayStatusTracker struct {
+	running uint32
+
+	mu             sync.Mutex
+	recent         []relayRequestSample
+	lastProvider   string
+	lastPlatform   string
+	todayCache     relayTodayTotals
+	todayCheckedAt time.Time
+}
+
+type relayRequestSample struct {
+	at     time.Time
+	failed bool
+}
+
+type relayTodayTotals struct {
+	requests int
+	cost     float64
+}
+
+// RelayStatus 转发服务实时状态
+type RelayStatus struct {
+	Health         string  `json:"health"`
+	Running        bool    `json:"running"`
+	Paused         bool    `json:"paused"`
+	RequestsPerMin float64 `json:"requests_per_min"`
+	ErrorRate      float64 `json:"error_rate"` // 0-1，统计最近 5 分钟
+	ActivePlatform string  `json:"active_platform,omitempty"`
+	ActiveProvider string  `json:"active_provider,omitempty"` // 最近一次成功请求使用的 provider
+	TodayRequests  int     `json:"today_requests"`
+	TodayCost      float64 `json:"today_cost"`
+}
+
+// setRelayRunning 记录 HTTP 服务是否在监听
+func (prs *ProviderRelayService) setRelayRunning(running bool) {
+	var val uint32 = 0
+	if running {
+		val = 1
+	}
+	atomic.StoreUint32(&prs.status.running, val)
+}
+
+// recordRequestStatus 记录请求结果，用于计算请求速率与错误率
+func (prs *ProviderRelayService) recordRequestStatus(log *ReqeustLog) {
+	now := time.Now()
+	failed := log.HttpCode == 0 || log.HttpCode >= 400 || log.ErrorType != ""
+
+	prs.status.mu.Lock()
+	defer prs.status.mu.Unlock()
+	prs.status.recent = append(pruneRelaySamples(prs.status.recent, now), relayRequestSample{at: now, failed: failed})
+	if !failed && log.Provider != "" {
+		prs.status.lastProvider = log.Provider
+		prs.status.lastPlatform = log.Platform
+	}
+	// 今日统计缓存失效，下次读取时重新查询
+	prs.status.todayCheckedAt = time.Time{}
+}
+
+// pruneRelaySamples 丢弃统计窗口之外的样本
+func pruneRelaySamples(samples []relayRequestSample, now time.Time) []relayRequestSample {
+	cutoff := now.Add(-relayStatusWindow)
+	i := 0
+	for i < len(samples) && samples[i].at.Before(cutoff) {
+		i++
+	}
+	return samples[i:]
+}
+
+// GetRelayStatus 获取转发服务实时状态：运行状态、请求速率、错误率、今日请求数与花费
+func (prs *ProviderRelayService) GetRelayStatus() RelayStatus {
+	now := time.Now()
+	status := RelayStatus{
+		Running: atomic.LoadUint32(&prs.status.running) == 1,
+		Paused:  prs.IsRelayPaused(),
+	}
+
+	prs.status.mu.Lock()
+	prs.status.recent = pruneRelaySamples(prs.status.recent, now)
+	var recentMinute, failures int
+	for _, sample := range prs.status.recent {
+		if sample.failed {
+			failures++
+		}
+		if now.Sub(sample.at) <= time.Minute {
+			recentMinute++
+		}
+	}
+	total := len(prs.status.recent)
+	status.RequestsPerMin = float64(recentMinute)
+	if total > 0 {
+		status.ErrorRate = float64(failures) / float64(total)
+	}
+	status.ActivePlatform = prs.status.lastPlatform
+	status.ActiveProvider = prs.status.lastProvider
+	cached := prs.status.todayCache
+	fresh := !prs.status.todayCheckedAt.IsZero() && now.Sub(prs.status.todayCheckedAt) < time.Minute &&
+		prs.status.todayCheckedAt.YearDay() == now.YearDay()
+	prs.status.mu.Unlock()
+
+	if !fresh {
+		if totals, err := queryTodayTotals(now); err == nil {
+			cached = totals
+			prs.status.mu.Lock()
+			prs.status.todayCache = totals
+			prs.status.todayCheckedAt = now
+			prs.status.mu.Unlock()
+		}
+	}
+	status.TodayRequests = cached.requests
+	status.TodayCost = cached.cost
+
+	switch {
+	case !status.Running:
+		status.Health = RelayHealthStopped
+	case status.Paused:
+		status.Health = RelayHealthPaused
+	case total >= relayStatusMinRequests && status.ErrorRate >= relayFailingErrorRate:
+		status.Health = RelayHealthFailing
+	case total >= relayStatusMinRequests && status.ErrorRate >= relayDegradedErrorRate:
+		status.Health = RelayHealthDegraded
+	default:
+		status.Health = RelayHealthHealthy
+	}
+	return status
+}
+
+// queryTodayTotals 统计本地时间今日的请求数与花费
+func queryTodayTotals(now time.Time) (relayTodayTotals, error) {
+	var totals relayTodayTotals
+	db, err := xdb.DB("default")
+	if err != nil {
+		return totals, err
+	}
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(total_cost), 0) FROM request_log WHERE created_at >= ?`,
+		dayStart.UTC().Format(timeLayout)).Scan(&totals.requests, &totals.cost)
+	if err != nil && isNoSuchTableErr(err) {
+		return relayTodayTotals{}, nil
+	}
+	return totals, err
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelayStatusHealth(t *testing.T) {
+	db := openAnalyticsDB(t, "status.db")
+	now := time.Now()
+	yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(-time.Hour)
+	for _, createdAt := range []time.Time{now, now, yesterday} {
+		if _, err := db.Exec(`INSERT INTO request_log (platform, model, provider, http_code, total_cost, created_at) VALUES ('claude', 'm', 'p1', 200, 0.5, ?)`,
+			createdAt.UTC().Format(timeLayout)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prs := &ProviderRelayService{}
+	if status := prs.GetRelayStatus(); status.Health != RelayHealthStopped {
+		t.Fatalf("expected stopped relay, got %+v", status)
+	}
+	prs.setRelayRunning(true)
+
+	status := prs.GetRelayStatus()
+	if status.Health != RelayHealthHealthy || status.TodayRequests != 2 || status.TodayCost != 1 {
+		t.Fatalf("unexpected idle status: %+v", status)
+	}
+
+	for i := 0; i < 4; i++ {
+		prs.recordRequestStatus(&ReqeustLog{Platform: "claude", Provider: "primary", HttpCode: 200})
+	}
+	prs.recordRequestStatus(&ReqeustLog{Platform: "claude", Provider: "backup", HttpCode: 502})
+	status = prs.GetRelayStatus()
+	if status.ActiveProvider != "primary" || status.RequestsPerMin != 5 || status.ErrorRate != 0.2 {
+		t.Fatalf("unexpected counters: %+v", status)
+	}
+	if status.Health != RelayHealthDegraded {
+		t.Fatalf("expected degraded at 20%% errors, got %+v", status)
+	}
+
+	for i := 0; i < 5; i++ {
+		prs.recordRequestStatus(&ReqeustLog{Platform: "claude", Provider: "backup", ErrorType: "timeout"})
+	}
+	if status := prs.GetRelayStatus(); status.Health != RelayHealthFailing {
+		t.Fatalf("expected failing relay, got %+v", status)
+	}
+
+	prs.SetRelayPaused(true)
+	if status := prs.GetRelayStatus(); status.Health != RelayHealthPaused {
+		t.Fatalf("expected paused relay, got %+v", status)
+	}
+	prs.SetRelayPaused(false)
+
+	// 超出统计窗口的样本不再计入
+	prs.status.mu.Lock()
+	for i := range prs.status.recent {
+		prs.status.recent[i].at = now.Add(-relayStatusWindow - time.Second)
+	}
+	prs.status.mu.Unlock()
+	if status := prs.GetRelayStatus(); status.Health != RelayHealthHealthy || status.RequestsPerMin != 0 || status.ErrorRate != 0 {
+		t.Fatalf("expected old samples to expire, got %+v", status)
+	}
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// 公开状态页：开启后 /status（HTML）与 /status.json 无需管理员权限即可访问，
+// 只展示网关运行时长、当前错误率、各 provider 最近 90 天的可用性与故障记录，不包含花费、模型、
+// 客户端信息、错误详情或请求内容，便于共用网关的团队判断“是自己的问题还是网关的问题”。
+// 历史数据每分钟最多查询一次数据库
+
+const (
+	// statusPageDays 可用性历史天数
+	statusPageDays = 90
+	// statusPageCacheTTL 历史统计缓存时间，避免公开页面频繁扫描日志
+	statusPageCacheTTL = time.Minute
+	// statusPageMaxIncidents 状态页展示的最近故障数
+	statusPageMaxIncidents = 20
+	// 每日可用性（成功请求占比）判定阈值
+	statusPageUpRatio       = 0.98
+	statusPageDegradedRatio = 0.9
+)
+
+// 每日可用性状态
+const (
+	StatusTickUp       = "up"
+	StatusTickDegraded = "degraded"
+	StatusTickDown     = "down"
+	StatusTickNoData   = "no_data"
+)
+
+// StatusTick 某一天的可用性
+type StatusTick struct {
+	Day          string  `json:"day"`
+	Status       string  `json:"status"`
+	Availability float64 `json:"availability"` // 0-1，无请求时为 0
+	Requests     int64   `json:"requests"`
+	Incidents    int     `json:"incidents,omitempty"` // 当天发生（或持续）的故障数
+}
+
+// ProviderStatusHistory 单个 provider 的可用性历史
+type ProviderStatusHistory struct {
+	Platform     string       `json:"platform"`
+	Provider     string       `json:"provider"`
+	Availability float64      `json:"availability"` // 90 天整体可用性
+	Ticks        []StatusTick `json:"ticks"`        // 按日期正序，最后一个为今天
+}
+
+// PublicStatus 公开状态页数据
+type PublicStatus struct {
+	Health         string                  `json:"health"`
+	StartedAt      int64                   `json:"started_at"`
+	UptimeSec      int64                   `json:"uptime_sec"`
+	ErrorRate      float64                 `json:"error_rate"` // 最近 5 分钟
+	RequestsPerMin float64                 `json:"requests_per_min"`
+	Providers      []ProviderStatusHistory `json:"providers"`
+	Incidents      []ProviderIncident      `json:"incidents"` // 最近的故障，不含错误样本
+	GeneratedAt    int64                   `json:"generated_at"`
+}
+
+// publicStatusStore 状态页开关与历史统计缓存
+type publicStatusStore struct {
+	enabled uint32
+
+	mu        sync.Mutex
+	history   []ProviderStatusHistory
+	incidents []ProviderIncident
+	fetchedAt time.Time
+}
+
+// SetPublicStatusPage 开启 / 关闭公开状态页
+func (prs *ProviderRelayService) SetPublicStatusPage(enabled bool) {
+	var val uint32
+	if enabled {
+		val = 1
+	}
+	atomic.StoreUint32(&prs.publicStatus.enabled, val)
+}
+
+// IsPublicStatusPageEnabled 公开状态页是否开启
+func (prs *ProviderRelayService) IsPublicStatusPageEnabled() bool {
+	return atomic.LoadUint32(&prs.publicStatus.enabled) == 1
+}
+
+// GetPublicStatus 汇总公开状态页数据
+func (prs *ProviderRelayService) GetPublicStatus() (PublicStatus, error) {
+	now := time.Now()
+	relay := prs.GetRelayStatus()
+	status := PublicStatus{
+		Health:         relay.Health,
+		StartedAt:      prs.startTime.Unix(),
+		UptimeSec:      int64(now.Sub(prs.startTime).Seconds()),
+		ErrorRate:      relay.ErrorRate,
+		RequestsPerMin: relay.RequestsPerMin,
+		GeneratedAt:    now.Unix(),
+	}
+
+	prs.publicStatus.mu.Lock()
+	defer prs.publicStatus.mu.Unlock()
+	if prs.publicStatus.history == nil || now.Sub(prs.publicStatus.fetchedAt) >= statusPageCacheTTL {
+		history, err := queryProviderStatusHistory(statsNow(), statusPageDays)
+		if err != nil {
+			return status, err
+		}
+		incidents, err := queryPublicIncidents(history)
+		if err != nil {
+			return status, err
+		}
+		prs.publicStatus.history = history
+		prs.publicStatus.incidents = incidents
+		prs.publicStatus.fetchedAt = now
+	}
+	status.Providers = prs.publicStatus.history
+	status.Incidents = prs.publicStatus.incidents
+	return status, nil
+}
+
+// queryPublicIncidents 查询状态页窗口内的故障，在对应日期上标注故障数，
+// 平台级故障标注到该平台的所有 provider；返回去掉错误样本的最近故障
+func queryPublicIncidents(history []ProviderStatusHistory) ([]ProviderIncident, error) {
+	from, to := incidentWindow(statusPageDays)
+	incidents, err := queryProviderIncidents("", from, incidentMaxList)
+	if err != nil {
+		return nil, err
+	}
+	for i := range history {
+		dayIndex := make(map[string]int, len(history[i].Ticks))
+		for j, tick := range history[i].Ticks {
+			dayIndex[tick.Day] = j
+		}
+		for _, inc := range incidents {
+			if inc.Platform != history[i].Platform || (inc.Provider != "" && inc.Provider != history[i].Provider) {
+				continue
+			}
+			for _, day := range incidentDays(inc, from, to) {
+				if j, ok := dayIndex[day]; ok {
+					history[i].Ticks[j].Incidents++
+				}
+			}
+		}
+	}
+
+	public := make([]ProviderIncident, 0, min(len(incidents), statusPageMaxIncidents))
+	for _, inc := range incidents {
+		if len(public) >= statusPageMaxIncidents {
+			break
+		}
+		inc.ErrorSamples = nil
+		public = append(public, inc)
+	}
+	return public, nil
+}
+
+// statusTickFor 按成功请求占比判定当天状态
+func statusTickFor(day string, requests, successes int64) StatusTick {
+	tick := StatusTick{Day: day, Status: StatusTickNoData, Requests: requests}
+	if requests <= 0 {
+		return tick
+	}
+	tick.Availability = float64(successes) / float64(requests)
+	switch {
+	case tick.Availability >= statusPageUpRatio:
+		tick.Status = StatusTickUp
+	case tick.Availability >= statusPageDegradedRatio:
+		tick.Status = StatusTickDegraded
+	default:
+		tick.Status = StatusTickDown
+	}
+	return tick
+}
+
+// queryProviderStatusHistory 按统计时区的自然日汇总各 provider 的请求数与成功数
+func queryProviderStatusHistory(now time.Time, days int) ([]ProviderStatusHistory, error) {
+	loc := statsLocation()
+	start := startOfDay(now).AddDate(0, 0, -(days - 1))
+	dayKeys := make([]string, days)
+	dayIndex := make(map[string]int, days)
+	for i := range dayKeys {
+		dayKeys[i] = start.AddDate(0, 0, i).Format("2006-01-02")
+		dayIndex[dayKeys[i]] = i
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	source, args := statsUsageSource(db, start, rollupOpenEnd)
+	rows, err := db.Query(`
+		SELECT bucket, platform, provider, COALESCE(SUM(requests), 0), COALESCE(SUM(success_requests), 0)
+		FROM `+source+`
+		WHERE bucket IS NOT NULL AND provider != ''
+		GROUP BY bucket, platform, provider`, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []ProviderStatusHistory{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	type dayCounts struct{ requests, successes []int64 }
+	counts := make(map[[2]string]*dayCounts)
+	for rows.Next() {
+		var bucket, platform, provider string
+		var requests, successes int64
+		if err := rows.Scan(&bucket, &platform, &provider, &requests, &successes); err != nil {
+			return nil, err
+		}
+		bucketTime, ok := parseRollupTime(bucket)
+		if !ok {
+			continue
+		}
+		i, ok := dayIndex[bucketTime.In(loc).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		key := [2]string{platform, provider}
+		entry := counts[key]
+		if entry == nil {
+			entry = &dayCounts{requests: make([]int64, days), successes: make([]int64, days)}
+			counts[key] = entry
+		}
+		entry.requests[i] += requests
+		entry.successes[i] += successes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	history := make([]ProviderStatusHistory, 0, len(counts))
+	for key, entry := range counts {
+		item := ProviderStatusHistory{Platform: key[0], Provider: key[1], Ticks: make([]StatusTick, days)}
+		var requests, successes int64
+		for i, day := range dayKeys {
+			item.Ticks[i] = statusTickFor(day, entry.requests[i], entry.successes[i])
+			requests += entry.requests[i]
+			successes += entry.successes[i]
+		}
+		if requests > 0 {
+			item.Availability = float64(successes) / float64(requests)
+		}
+		history = append(history, item)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].Platform != history[j].Platform {
+			return history[i].Platform < history[j].Platform
+		}
+		return history[i].Provider < history[j].Provider
+	})
+	return history, nil
+}
+
+// publicStatusJSONHandler GET /status.json
+func (prs *ProviderRelayService) publicStatusJSONHandler(c *gin.Context) {
+	if !prs.IsPublicStatusPageEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "status page is disabled"})
+		return
+	}
+	status, err := prs.GetPublicStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load status history"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=30")
+	c.JSON(http.StatusOK, status)
+}
+
+// publicStatusHTMLHandler GET /status
+func (prs *ProviderRelayService) publicStatusHTMLHandler(c *gin.Context) {
+	if !prs.IsPublicStatusPageEnabled() {
+		c.String(http.StatusNotFound, "status page is disabled")
+		return
+	}
+	status, err := prs.GetPublicStatus()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to load status history")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=30")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := statusPageTemplate.Execute(c.Writer, status); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"percent": formatStatusPercent,
+	"uptime":  func(sec int64) string { return (time.Duration(sec) * time.Second).String() },
+	"since":   func(unix int64) string { return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04 UTC") },
+	"cause":   formatIncidentCause,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>Gateway status</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",sans-serif;margin:0;background:#f8fafc;color:#0f172a}
+main{max-width:880px;margin:0 auto;padding:32px 20px}
+.banner{padding:16px 20px;border-radius:10px;color:#fff;font-size:18px;font-weight:600;margin-bottom:16px}
+.healthy{background:#16a34a}.degraded,.paused{background:#d97706}.failing,.stopped{background:#dc2626}
+.meta{display:flex;gap:24px;flex-wrap:wrap;color:#475569;margin-bottom:28px}
+.provider{background:#fff;border:1px solid #e2e8f0;border-radius:10px;padding:14px 16px;margin-bottom:12px}
+.head{display:flex;justify-content:space-between;margin-bottom:8px}
+.ticks{display:flex;gap:2px;height:28px}
+.ticks span{flex:1;border-radius:2px}
+.up{background:#22c55e}.tick-degraded{background:#f59e0b}.down{background:#ef4444}.no_data{background:#e2e8f0}
+.ticks span.incident{box-shadow:inset 0 -4px 0 #7f1d1d}
+.scale{display:flex;justify-content:space-between;color:#94a3b8;font-size:12px;margin-top:4px}
+h2{font-size:16px;margin:28px 0 12px}
+.incidents{list-style:none;padding:0;margin:0}
+.incidents li{background:#fff;border:1px solid #e2e8f0;border-radius:10px;padding:10px 16px;margin-bottom:8px;display:flex;justify-content:space-between;gap:16px}
+.ongoing{color:#dc2626;font-weight:600}
+footer{color:#94a3b8;font-size:12px;margin-top:24px}
+</style>
+</head>
+<body>
+<main>
+<div class="banner {{.Health}}">Gateway is {{.Health}}</div>
+<div class="meta">
+<span>Up for {{uptime .UptimeSec}} (since {{since .StartedAt}})</span>
+<span>Error rate (5 min): {{percent .ErrorRate}}</span>
+<span>Requests/min: {{printf "%.0f" .RequestsPerMin}}</span>
+</div>
+{{range .Providers}}
+<div class="provider">
+<div class="head"><strong>{{.Platform}} / {{.Provider}}</strong><span>{{percent .Availability}} available</span></div>
+<div class="ticks">{{range .Ticks}}<span class="{{if eq .Status "degraded"}}tick-degraded{{else}}{{.Status}}{{end}}{{if .Incidents}} incident{{end}}" title="{{.Day}}: {{if .Requests}}{{percent .Availability}}{{else}}no requests{{end}}{{if .Incidents}} · {{.Incidents}} incident(s){{end}}"></span>{{end}}</div>
+<div class="scale"><span>90 days ago</span><span>Today</span></div>
+</div>
+{{else}}
+<p>No provider traffic in the last 90 days.</p>
+{{end}}
+<h2>Recent incidents</h2>
+<ul class="incidents">
+{{range .Incidents}}
+<li><span><strong>{{.Platform}} / {{if .Provider}}{{.Provider}}{{else}}all providers{{end}}</strong> · {{cause .Cause}}</span><span>{{since .StartedAt}} · {{if .Ongoing}}<span class="ongoing">ongoing</span>{{else}}{{uptime .DurationSec}}{{end}}</span></li>
+{{else}}
+<li>No incidents in the last 90 days.</li>
+{{end}}
+</ul>
+<footer>Updated {{since .GeneratedAt}} · JSON: <a href="status.json">status.json</a></footer>
+</main>
+</body>
+</html>
+`))
+
+// formatIncidentCause 故障原因的英文描述
+func formatIncidentCause(cause string) string {
+	switch cause {
+	case IncidentCauseCircuitOpen:
+		return "circuit breaker open"
+	case IncidentCauseSuspended:
+		return "provider suspended"
+	case IncidentCauseAllFailed:
+		return "all providers failing"
+	}
+	return cause
+}
+
+// formatStatusPercent 保留两位小数的百分比，100% 不显示小数
+func formatStatusPercent(v float64) string {
+	if v >= 1 {
+		return "100%"
+	}
+	return fmt.Sprintf("%.2f%%", v*100)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+func TestStatusTickFor(t *testing.T) {
+	cases := []struct {
+		requests, successes int64
+		want                string
+	}{
+		{0, 0, StatusTickNoData},
+		{100, 100, StatusTickUp},
+		{100, 98, StatusTickUp},
+		{100, 95, StatusTickDegraded},
+		{100, 50, StatusTickDown},
+	}
+	for _, tc := range cases {
+		if got := statusTickFor("2026-01-01", tc.requests, tc.successes).Status; got != tc.want {
+			t.Errorf("%d/%d: expected %s, got %s", tc.successes, tc.requests, tc.want, got)
+		}
+	}
+}
+
+func TestPublicStatusPage(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, row := range []struct {
+		provider string
+		code     int
+		at       time.Time
+	}{
+		{"anthropic", 200, now}, {"anthropic", 500, now}, {"anthropic", 200, now.AddDate(0, 0, -3)},
+		{"relay-b", 200, now}, {"old", 200, now.AddDate(0, 0, -120)},
+	} {
+		if _, err := db.Exec(`INSERT INTO request_log (platform, model, provider, http_code, total_cost, created_at) VALUES ('claude', 'secret-model', ?, ?, 12.5, ?)`,
+			row.provider, row.code, row.at.UTC().Format(timeLayout)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{startTime: now.Add(-time.Hour)}
+	prs.setRelayRunning(true)
+	router := gin.New()
+	router.GET("/status", prs.publicStatusHTMLHandler)
+	router.GET("/status.json", prs.publicStatusJSONHandler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status page should be disabled by default, got %d", rec.Code)
+	}
+
+	prs.SetPublicStatusPage(true)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); strings.Contains(body, "secret-model") || strings.Contains(body, "cost") {
+		t.Fatalf("status page must not expose models or costs: %s", body)
+	}
+	var status PublicStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Health != RelayHealthHealthy || status.UptimeSec < 3500 {
+		t.Fatalf("unexpected gateway status %+v", status)
+	}
+	if len(status.Providers) != 2 || status.Providers[0].Provider != "anthropic" {
+		t.Fatalf("unexpected providers %+v", status.Providers)
+	}
+	ticks := status.Providers[0].Ticks
+	if len(ticks) != statusPageDays {
+		t.Fatalf("expected %d ticks, got %d", statusPageDays, len(ticks))
+	}
+	if today := ticks[len(ticks)-1]; today.Status != StatusTickDown || today.Requests != 2 {
+		t.Fatalf("expected today's tick to be down, got %+v", today)
+	}
+	if ticks[len(ticks)-4].Status != StatusTickUp || ticks[0].Status != StatusTickNoData {
+		t.Fatalf("unexpected history ticks %+v / %+v", ticks[len(ticks)-4], ticks[0])
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected html response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "claude / relay-b") || !strings.Contains(body, "Gateway is healthy") {
+		t.Fatalf("unexpected html body: %s", body)
+	}
+}
+
+func TestPublicStatusIncidents(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO request_log (platform, model, provider, http_code, created_at) VALUES ('claude', 'm', 'relay-a', 200, ?)`,
+		time.Now().UTC().Format(timeLayout)); err != nil {
+		t.Fatal(err)
+	}
+	prs := &ProviderRelayService{startTime: time.Now()}
+	prs.trackProviderIncident(ProviderEvent{Type: ProviderEventAllFailed, Platform: "claude", Reason: "upstream said: secret detail"})
+
+	status, err := prs.GetPublicStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Incidents) != 1 || status.Incidents[0].ErrorSamples != nil {
+		t.Fatalf("expected one incident without error samples, got %+v", status.Incidents)
+	}
+	ticks := status.Providers[0].Ticks
+	if ticks[len(ticks)-1].Incidents != 1 {
+		t.Fatalf("expected platform incident on today's tick, got %+v", ticks[len(ticks)-1])
+	}
+
+	prs.SetPublicStatusPage(true)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/status", prs.publicStatusHTMLHandler)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "all providers failing") || !strings.Contains(body, "ongoing") || strings.Contains(body, "secret detail") {
+		t.Fatalf("unexpected incident html: %s", body)
+	}
+}
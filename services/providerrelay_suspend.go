@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// authFailureThreshold 连续认证失败达到该次数后自动挂起 provider
+	authFailureThreshold = 3
+	// suspendProbeInterval 挂起 provider 的重新验证间隔
+	suspendProbeInterval = 10 * time.Minute
+)
+
+// Provider 事件类型
+const (
+	ProviderEventSuspended = "provider.suspended"
+	ProviderEventResumed   = "provider.resumed"
+	// 平台所有 provider 均请求失败
+	ProviderEventAllFailed = "provider.all_failed"
+)
+
+// ProviderEvent provider 状态变化事件，推送给桌面端与 webhook
+type ProviderEvent struct {
+	Type      string `json:"type"`
+	Platform  string `json:"platform"`
+	Provider  string `json:"provider"`
+	Reason    string `json:"reason,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"` // 相关请求（全部失败时为最后一次尝试）
+	Timestamp int64  `json:"timestamp"`
+}
+
+// providerEventBus 事件订阅者列表
+type providerEventBus struct {
+	mu       sync.RWMutex
+	handlers []func(ProviderEvent)
+}
+
+// authFailureTracker 记录每个 provider 的连续认证失败次数
+type authFailureTracker struct {
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// OnProviderEvent 订阅 provider 状态变化事件
+func (prs *ProviderRelayService) OnProviderEvent(handler func(ProviderEvent)) {
+	prs.providerEvents.mu.Lock()
+	prs.providerEvents.handlers = append(prs.providerEvents.handlers, handler)
+	prs.providerEvents.mu.Unlock()
+}
+
+// emitProviderEvent 异步分发事件，避免订阅者阻塞请求路径
+func (prs *ProviderRelayService) emitProviderEvent(event ProviderEvent) {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+	// 故障记录需要保证开始 / 结束的顺序，同步写入
+	prs.trackProviderIncident(event)
+	prs.providerEvents.mu.RLock()
+	handlers := append([]func(ProviderEvent){}, prs.providerEvents.handlers...)
+	prs.providerEvents.mu.RUnlock()
+	for _, handler := range handlers {
+		go handler(event)
+	}
+}
+
+// SetProviderEventWebhook 将 provider 事件以 JSON POST 推送到指定 URL
+func (prs *ProviderRelayService) SetProviderEventWebhook(url string) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	prs.OnProviderEvent(func(event ProviderEvent) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			fmt.Printf("[ProviderEvent] webhook 推送失败: %v\n", err)
+			return
+		}
+		resp.Body.Close()
+	})
+}
+
+// trackAuthResult 根据上游状态码更新连续认证失败计数，达到阈值后挂起 provider
+func (prs *ProviderRelayService) trackAuthResult(kind string, provider Provider, httpCode int) {
+	if httpCode == 0 || provider.IsLocal() {
+		return
+	}
+	key := providerKey(kind, provider.Name)
+
+	prs.authFailures.mu.Lock()
+	if prs.authFailures.failures == nil {
+		prs.authFailures.failures = make(map[string]int)
+	}
+	if httpCode != http.StatusUnauthorized && httpCode != http.StatusForbidden {
+		// 其他状态码说明认证已通过（或与认证无关），重置计数
+		delete(prs.authFailures.failures, key)
+		prs.authFailures.mu.Unlock()
+		return
+	}
+	prs.authFailures.failures[key]++
+	count := prs.authFailures.failures[key]
+	if count >= authFailureThreshold {
+		delete(prs.authFailures.failures, key)
+	}
+	prs.authFailures.mu.Unlock()
+
+	if count >= authFailureThreshold {
+		reason := fmt.Sprintf("连续 %d 次认证失败 (HTTP %d)", count, httpCode)
+		if err := prs.SuspendProvider(kind, provider.Name, reason); err != nil {
+			fmt.Printf("[Suspend] 挂起 provider %s 失败: %v\n", key, err)
+		}
+	}
+}
+
+// SuspendProvider 挂起 provider：不再参与路由，等待重新验证
+func (prs *ProviderRelayService) SuspendProvider(kind, providerName, reason string) error {
+	changed, err := prs.providerService.setProviderSuspended(kind, providerName, true, reason)
+	if err != nil || !changed {
+		return err
+	}
+	fmt.Printf("[Suspend] Provider %s/%s 已挂起: %s\n", kind, providerName, reason)
+	prs.emitProviderEvent(ProviderEvent{
+		Type:     ProviderEventSuspended,
+		Platform: kind,
+		Provider: providerName,
+		Reason:   reason,
+	})
+	return nil
+}
+
+// ResumeProvider 手动解除挂起（如用户更换了 API Key）
+func (prs *ProviderRelayService) ResumeProvider(kind, providerName string) error {
+	changed, err := prs.providerService.setProviderSuspended(kind, providerName, false, "")
+	if err != nil || !changed {
+		return err
+	}
+	fmt.Printf("[Suspend] Provider %s/%s 已恢复\n", kind, providerName)
+	prs.emitProviderEvent(ProviderEvent{
+		Type:     ProviderEventResumed,
+		Platform: kind,
+		Provider: providerName,
+	})
+	return nil
+}
+
+// setProviderSuspended 更新挂起状态，返回状态是否发生变化
+func (ps *ProviderService) setProviderSuspended(kind, providerName string, suspended bool, reason string) (bool, error) {
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return false, err
+	}
+	for i := range providers {
+		if providers[i].Name != providerName {
+			continue
+		}
+		if providers[i].Suspended == suspended {
+			return false, nil
+		}
+		providers[i].Suspended = suspended
+		providers[i].SuspendedReason = reason
+		providers[i].SuspendedAt = 0
+		if suspended {
+			providers[i].SuspendedAt = time.Now().Unix()
+		}
+		return true, ps.SaveProviders(kind, providers)
+	}
+	return false, fmt.Errorf("provider %s 不存在", providerName)
+}
+
+// startSuspendProbeTask 定期重新验证被挂起的 provider
+func (prs *ProviderRelayService) startSuspendProbeTask() {
+	ticker := time.NewTicker(suspendProbeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		prs.ProbeSuspendedProviders()
+	}
+}
+
+// ProbeSuspendedProviders 立即重新验证所有挂起的 provider，返回已恢复的 provider
+func (prs *ProviderRelayService) ProbeSuspendedProviders() []string {
+	resumed := make([]string, 0)
+	for _, kind := range []string{"claude", "codex", "gemini-cli", "picoclaw"} {
+		providers, err := prs.providerService.LoadProviders(kind)
+		if err != nil {
+			continue
+		}
+		for _, p := range providers {
+			if !p.Suspended || !p.Enabled {
+				continue
+			}
+			status, err := prs.probeProviderAuth(kind, p)
+			if err != nil {
+				fmt.Printf("[Suspend] 重新验证 %s/%s 失败: %v\n", kind, p.Name, err)
+				continue
+			}
+			// 仅在明确通过认证时恢复；其他状态码无法判断，保持挂起等待下次验证
+			if status >= http.StatusOK && status < http.StatusMultipleChoices {
+				if err := prs.ResumeProvider(kind, p.Name); err == nil {
+					resumed = append(resumed, providerKey(kind, p.Name))
+				}
+			}
+		}
+	}
+	return resumed
+}
+
+// probeProviderAuth 请求 provider 的 /models 端点验证凭据
+func (prs *ProviderRelayService) probeProviderAuth(kind string, provider Provider) (int, error) {
+	base := strings.TrimSuffix(provider.APIURL, "/")
+	modelsURL := base + "/v1/models"
+	if strings.HasSuffix(base, "/v1") {
+		modelsURL = base + "/models"
+	}
+
+	headers := map[string]string{}
+	if err := prs.applyProviderAuth(kind, provider, headers); err != nil {
+		return 0, err
+	}
+	if kind == "claude" && provider.AuthType != AuthTypeOAuth && provider.APIKey != "" {
+		headers["x-api-key"] = provider.APIKey
+		headers["anthropic-version"] = "2023-06-01"
+	}
+
+	req, err := http.NewRequest("GET", modelsURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
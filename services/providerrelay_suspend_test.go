@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackAuthResultSuspendsAfterRepeatedFailures(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ps := NewProviderService()
+	provider := Provider{ID: 1, Name: "flaky", APIURL: "https://example.com", APIKey: "sk-test", Enabled: true}
+	if err := ps.SaveProviders("claude", []Provider{provider}); err != nil {
+		t.Fatalf("SaveProviders: %v", err)
+	}
+
+	prs := &ProviderRelayService{providerService: ps}
+	events := make(chan ProviderEvent, 1)
+	prs.OnProviderEvent(func(e ProviderEvent) { events <- e })
+
+	prs.trackAuthResult("claude", provider, 401)
+	prs.trackAuthResult("claude", provider, 200) // 成功请求重置计数
+	for i := 0; i < authFailureThreshold-1; i++ {
+		prs.trackAuthResult("claude", provider, 403)
+	}
+	if loaded, _ := ps.LoadProviders("claude"); loaded[0].Suspended {
+		t.Fatal("provider suspended before reaching threshold")
+	}
+
+	prs.trackAuthResult("claude", provider, 401)
+	loaded, _ := ps.LoadProviders("claude")
+	if !loaded[0].Suspended || !loaded[0].Enabled {
+		t.Fatalf("expected suspended but still enabled provider, got %+v", loaded[0])
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != ProviderEventSuspended || e.Provider != "flaky" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("suspend event not emitted")
+	}
+
+	if err := prs.ResumeProvider("claude", "flaky"); err != nil {
+		t.Fatalf("ResumeProvider: %v", err)
+	}
+	if loaded, _ := ps.LoadProviders("claude"); loaded[0].Suspended {
+		t.Error("provider should be resumed")
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认超时：与原硬编码行为保持一致（非流式 60s，流式 5 分钟），读取间隔默认不限制
+const (
+	defaultConnectTimeout     = 10 * time.Second
+	defaultTotalTimeout       = 60 * time.Second
+	defaultStreamTotalTimeout = 300 * time.Second
+	defaultMaxClientTimeout   = 30 * time.Minute
+)
+
+// 客户端可通过以下请求头申请更长（或更短）的总超时（秒），受 MaxClientSec 上限约束
+// X-Stainless-Timeout 由 Anthropic / OpenAI 官方 SDK 自动发送
+const (
+	headerRequestTimeout   = "X-Request-Timeout"
+	headerStainlessTimeout = "X-Stainless-Timeout"
+)
+
+// 超时错误类型（写入 request_log.error_type）
+const (
+	errorTypeConnectTimeout = "connect_timeout"
+	errorTypeReadTimeout    = "read_timeout"
+	errorTypeTotalTimeout   = "total_timeout"
+)
+
+var (
+	errReadTimeout  = errors.New("upstream read timeout")
+	errTotalTimeout = errors.New("upstream total timeout")
+)
+
+// TimeoutSettings 上游请求超时（秒），0 表示使用上一级配置或默认值
+type TimeoutSettings struct {
+	ConnectSec     int `json:"connectSec,omitempty"`     // 建立连接（含 TLS 握手）
+	ReadSec        int `json:"readSec,omitempty"`        // 等待响应头、以及流式响应两次数据之间的最长间隔
+	TotalSec       int `json:"totalSec,omitempty"`       // 非流式请求总超时
+	StreamTotalSec int `json:"streamTotalSec,omitempty"` // 流式请求总超时
+	MaxClientSec   int `json:"maxClientSec,omitempty"`   // 客户端通过请求头申请的超时上限（仅全局配置生效）
+}
+
+// requestTimeouts 单个请求最终生效的超时
+type requestTimeouts struct {
+	connect time.Duration
+	read    time.Duration
+	total   time.Duration
+}
+
+// timeoutSettingsStore 当前生效的全局超时配置
+type timeoutSettingsStore struct {
+	mu       sync.RWMutex
+	settings TimeoutSettings
+}
+
+// SetTimeoutSettings 更新全局上游超时配置
+func (prs *ProviderRelayService) SetTimeoutSettings(settings TimeoutSettings) {
+	prs.timeoutSettings.mu.Lock()
+	prs.timeoutSettings.settings = settings
+	prs.timeoutSettings.mu.Unlock()
+}
+
+// GetTimeoutSettings 获取全局上游超时配置
+func (prs *ProviderRelayService) GetTimeoutSettings() TimeoutSettings {
+	prs.timeoutSettings.mu.RLock()
+	defer prs.timeoutSettings.mu.RUnlock()
+	return prs.timeoutSettings.settings
+}
+
+// resolveTimeouts 计算请求生效的超时：provider 配置 > 全局配置 > 默认值，
+// 客户端请求头申请的总超时会覆盖结果，但不超过 MaxClientSec
+func (prs *ProviderRelayService) resolveTimeouts(provider Provider, isStream bool, header http.Header) requestTimeouts {
+	global := prs.GetTimeoutSettings()
+	var own TimeoutSettings
+	if provider.Timeouts != nil {
+		own = *provider.Timeouts
+	}
+	pick := func(values ...int) time.Duration {
+		for _, v := range values {
+			if v > 0 {
+				return time.Duration(v) * time.Second
+			}
+		}
+		return 0
+	}
+
+	t := requestTimeouts{
+		connect: pick(own.ConnectSec, global.ConnectSec),
+		read:    pick(own.ReadSec, global.ReadSec),
+	}
+	if t.connect == 0 {
+		t.connect = defaultConnectTimeout
+	}
+	if isStream {
+		t.total = pick(own.StreamTotalSec, global.StreamTotalSec)
+		if t.total == 0 {
+			t.total = defaultStreamTotalTimeout
+		}
+	} else {
+		t.total = pick(own.TotalSec, global.TotalSec)
+		if t.total == 0 {
+			t.total = defaultTotalTimeout
+		}
+	}
+
+	if requested, ok := clientRequestedTimeout(header); ok {
+		limit := pick(global.MaxClientSec)
+		if limit == 0 {
+			limit = defaultMaxClientTimeout
+		}
+		if requested > limit {
+			requested = limit
+		}
+		t.total = requested
+	}
+	return t
+}
+
+// clientRequestedTimeout 解析客户端申请的超时（秒，允许小数）
+func clientRequestedTimeout(header http.Header) (time.Duration, bool) {
+	for _, name := range []string{headerRequestTimeout, headerStainlessTimeout} {
+		value := strings.TrimSpace(header.Get(name))
+		if value == "" {
+			continue
+		}
+		if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+	}
+	return 0, false
+}
+
+// newUpstreamClient 按超时配置创建 HTTP 客户端；总超时由请求 context 控制，以便区分超时类型
+func newUpstreamClient(t requestTimeouts) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: t.connect, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   t.connect,
+			ResponseHeaderTimeout: t.read,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   100,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
+
+// withUpstreamDeadline 为上游请求创建带总超时的 context，返回的 cancel 必须在响应读取完成后调用
+func withUpstreamDeadline(parent context.Context, t requestTimeouts) (context.Context, context.CancelCauseFunc) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	if t.total <= 0 {
+		return ctx, cancelCause
+	}
+	timer := time.AfterFunc(t.total, func() { cancelCause(errTotalTimeout) })
+	return ctx, func(cause error) {
+		timer.Stop()
+		cancelCause(cause)
+	}
+}
+
+// idleTimeoutReader 流式响应两次数据之间超过 timeout 时取消请求
+type idleTimeoutReader struct {
+	body    io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+// newIdleTimeoutReader 包装响应体；timeout <= 0 时原样返回
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration, cancel context.CancelCauseFunc) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	return &idleTimeoutReader{
+		body:    body,
+		timeout: timeout,
+		timer:   time.AfterFunc(timeout, func() { cancel(errReadTimeout) }),
+	}
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
+
+// classifyRequestError 区分连接超时、读取超时、总超时与其他网络错误
+func classifyRequestError(ctx context.Context, err error) string {
+	if err == nil {
+		return ""
+	}
+	if ctx != nil {
+		switch context.Cause(ctx) {
+		case errTotalTimeout:
+			return errorTypeTotalTimeout
+		case errReadTimeout:
+			return errorTypeReadTimeout
+		}
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return errorTypeConnectTimeout
+	}
+	if strings.Contains(err.Error(), "TLS handshake timeout") {
+		return errorTypeConnectTimeout
+	}
+	if strings.Contains(err.Error(), "timeout awaiting response headers") {
+		return errorTypeReadTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorTypeTotalTimeout
+	}
+	return "network_error"
+}
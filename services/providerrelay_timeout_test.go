@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolveTimeouts(t *testing.T) {
+	prs := &ProviderRelayService{}
+	provider := Provider{Name: "slow"}
+
+	got := prs.resolveTimeouts(provider, false, nil)
+	if got.total != defaultTotalTimeout || got.connect != defaultConnectTimeout || got.read != 0 {
+		t.Fatalf("defaults = %+v", got)
+	}
+	if got := prs.resolveTimeouts(provider, true, nil); got.total != defaultStreamTotalTimeout {
+		t.Errorf("stream default = %v", got.total)
+	}
+
+	prs.SetTimeoutSettings(TimeoutSettings{ConnectSec: 5, ReadSec: 30, TotalSec: 90, MaxClientSec: 600})
+	provider.Timeouts = &TimeoutSettings{TotalSec: 120}
+	got = prs.resolveTimeouts(provider, false, nil)
+	if got.connect != 5*time.Second || got.read != 30*time.Second || got.total != 120*time.Second {
+		t.Errorf("provider override = %+v", got)
+	}
+
+	header := http.Header{}
+	header.Set(headerRequestTimeout, "300")
+	if got := prs.resolveTimeouts(provider, false, header); got.total != 300*time.Second {
+		t.Errorf("client timeout = %v", got.total)
+	}
+	header.Set(headerRequestTimeout, "3600")
+	if got := prs.resolveTimeouts(provider, false, header); got.total != 600*time.Second {
+		t.Errorf("client timeout should be capped, got %v", got.total)
+	}
+}
+
+func TestClassifyRequestErrorTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stall-body" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	do := func(path string, timeouts requestTimeouts) string {
+		ctx, cancel := withUpstreamDeadline(context.Background(), timeouts)
+		defer cancel(nil)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		resp, err := newUpstreamClient(timeouts).Do(req)
+		if err == nil {
+			resp.Body = newIdleTimeoutReader(resp.Body, timeouts.read, cancel)
+			defer resp.Body.Close()
+			_, err = io.ReadAll(resp.Body)
+		}
+		return classifyRequestError(ctx, err)
+	}
+
+	if got := do("/stall-headers", requestTimeouts{connect: time.Second, read: 50 * time.Millisecond, total: time.Second}); got != errorTypeReadTimeout {
+		t.Errorf("header stall = %q", got)
+	}
+	if got := do("/stall-body", requestTimeouts{connect: time.Second, read: 50 * time.Millisecond, total: time.Second}); got != errorTypeReadTimeout {
+		t.Errorf("body stall = %q", got)
+	}
+	if got := do("/stall-headers", requestTimeouts{connect: time.Second, total: 50 * time.Millisecond}); got != errorTypeTotalTimeout {
+		t.Errorf("total timeout = %q", got)
+	}
+}
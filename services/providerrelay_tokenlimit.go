@@ -0,0 +1,318 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 超出 token 上限时的处理方式
+const (
+	TokenLimitReject   = "reject"   // 跳过该 provider，全部超限时拒绝请求（默认）
+	TokenLimitTruncate = "truncate" // 丢弃最早的对话轮次、下调 max_tokens 后转发
+)
+
+// TokenLimits 单次请求的 token 硬上限，0 表示不限制（使用上一级配置）
+type TokenLimits struct {
+	MaxInputTokens  int    `json:"maxInputTokens,omitempty"`  // 输入 token（本地估算）
+	MaxOutputTokens int    `json:"maxOutputTokens,omitempty"` // max_tokens / max_output_tokens 上限，未指定时自动补上
+	OnExceed        string `json:"onExceed,omitempty"`        // reject / truncate
+}
+
+// tokenLimitStore 各平台的默认上限，provider 未设置的项使用平台默认值
+type tokenLimitStore struct {
+	mu       sync.RWMutex
+	defaults map[string]TokenLimits
+}
+
+// tokenLimitError 请求超出 provider 的 token 上限
+type tokenLimitError struct {
+	provider string
+	field    string // input / output
+	actual   int
+	limit    int
+}
+
+func (e *tokenLimitError) Error() string {
+	if e.field == "input" {
+		return fmt.Sprintf("请求输入约 %d tokens，超过 provider %s 的上限 %d", e.actual, e.provider, e.limit)
+	}
+	return fmt.Sprintf("请求的最大输出 %d tokens 超过 provider %s 的上限 %d", e.actual, e.provider, e.limit)
+}
+
+// writeTokenLimitError 所有候选 provider 均因 token 上限被跳过时返回给客户端
+func writeTokenLimitError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	var limitErr *tokenLimitError
+	if errors.As(err, &limitErr) && limitErr.field == "input" {
+		status = http.StatusRequestEntityTooLarge
+	}
+	c.JSON(status, gin.H{"error": err.Error(), "type": "token_limit_exceeded"})
+}
+
+// tokenLimitConfigPath 平台默认上限配置文件
+func tokenLimitConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "token-limits.json"), nil
+}
+
+// GetTokenLimitDefaults 获取各平台的默认 token 上限
+func (prs *ProviderRelayService) GetTokenLimitDefaults() map[string]TokenLimits {
+	prs.tokenLimits.mu.RLock()
+	defer prs.tokenLimits.mu.RUnlock()
+	defaults := make(map[string]TokenLimits, len(prs.tokenLimits.defaults))
+	for platform, limits := range prs.tokenLimits.defaults {
+		defaults[platform] = limits
+	}
+	return defaults
+}
+
+// SetTokenLimitDefaults 更新各平台的默认 token 上限，持久化到 token-limits.json
+func (prs *ProviderRelayService) SetTokenLimitDefaults(defaults map[string]TokenLimits) error {
+	normalized := make(map[string]TokenLimits, len(defaults))
+	for platform, limits := range defaults {
+		platform = strings.ToLower(strings.TrimSpace(platform))
+		if platform == "" {
+			continue
+		}
+		if err := limits.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", platform, err)
+		}
+		normalized[platform] = limits
+	}
+
+	path, err := tokenLimitConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(normalized, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	prs.tokenLimits.mu.Lock()
+	prs.tokenLimits.defaults = normalized
+	prs.tokenLimits.mu.Unlock()
+	return nil
+}
+
+// loadTokenLimitDefaults 启动时从 token-limits.json 恢复平台默认上限
+func (prs *ProviderRelayService) loadTokenLimitDefaults() {
+	path, err := tokenLimitConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var defaults map[string]TokenLimits
+	if err := json.Unmarshal(data, &defaults); err != nil {
+		fmt.Printf("[TokenLimit] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	prs.tokenLimits.mu.Lock()
+	prs.tokenLimits.defaults = defaults
+	prs.tokenLimits.mu.Unlock()
+}
+
+// Validate 检查上限与处理方式
+func (l TokenLimits) Validate() error {
+	if l.MaxInputTokens < 0 || l.MaxOutputTokens < 0 {
+		return fmt.Errorf("token limits must not be negative")
+	}
+	switch l.OnExceed {
+	case "", TokenLimitReject, TokenLimitTruncate:
+		return nil
+	}
+	return fmt.Errorf("invalid onExceed %q, want reject or truncate", l.OnExceed)
+}
+
+// resolveTokenLimits 计算 provider 生效的上限：provider 配置 > 平台默认值
+func (prs *ProviderRelayService) resolveTokenLimits(kind string, provider Provider) TokenLimits {
+	prs.tokenLimits.mu.RLock()
+	limits := prs.tokenLimits.defaults[kind]
+	prs.tokenLimits.mu.RUnlock()
+
+	if own := provider.TokenLimits; own != nil {
+		if own.MaxInputTokens > 0 {
+			limits.MaxInputTokens = own.MaxInputTokens
+		}
+		if own.MaxOutputTokens > 0 {
+			limits.MaxOutputTokens = own.MaxOutputTokens
+		}
+		if own.OnExceed != "" {
+			limits.OnExceed = own.OnExceed
+		}
+	}
+	if limits.OnExceed == "" {
+		limits.OnExceed = TokenLimitReject
+	}
+	return limits
+}
+
+// enforceTokenLimits 按 provider 的上限检查请求体：reject 模式超限时返回 tokenLimitError，
+// truncate 模式丢弃最早的对话轮次并下调最大输出；未指定最大输出时补上上限
+func (prs *ProviderRelayService) enforceTokenLimits(kind string, provider Provider, body []byte) ([]byte, error) {
+	limits := prs.resolveTokenLimits(kind, provider)
+	if (limits.MaxInputTokens <= 0 && limits.MaxOutputTokens <= 0) || len(body) == 0 || !gjson.ValidBytes(body) {
+		return body, nil
+	}
+	truncate := limits.OnExceed == TokenLimitTruncate
+
+	if limits.MaxInputTokens > 0 {
+		if input := EstimateRequestTokens(body); input > limits.MaxInputTokens {
+			if !truncate {
+				return nil, &tokenLimitError{provider: provider.Name, field: "input", actual: input, limit: limits.MaxInputTokens}
+			}
+			trimmed, remaining := truncateConversation(body, limits.MaxInputTokens)
+			if remaining > limits.MaxInputTokens {
+				return nil, &tokenLimitError{provider: provider.Name, field: "input", actual: remaining, limit: limits.MaxInputTokens}
+			}
+			fmt.Printf("[TokenLimit] Provider %s: 输入约 %d tokens，截断最早的对话后约 %d tokens\n", provider.Name, input, remaining)
+			body = trimmed
+		}
+	}
+
+	if limits.MaxOutputTokens > 0 {
+		path, requested := requestedOutputTokens(body)
+		if requested > limits.MaxOutputTokens && !truncate {
+			return nil, &tokenLimitError{provider: provider.Name, field: "output", actual: requested, limit: limits.MaxOutputTokens}
+		}
+		if requested == 0 || requested > limits.MaxOutputTokens {
+			if updated, err := sjson.SetBytes(body, path, limits.MaxOutputTokens); err == nil {
+				body = updated
+			}
+		}
+	}
+	return body, nil
+}
+
+// outputTokenFields 各协议的最大输出字段，按优先级排列
+var outputTokenFields = []string{"max_tokens", "max_completion_tokens", "max_output_tokens", "generationConfig.maxOutputTokens"}
+
+// requestedOutputTokens 返回请求中的最大输出字段与取值；未指定时按请求格式返回应写入的字段
+func requestedOutputTokens(body []byte) (string, int) {
+	for _, field := range outputTokenFields {
+		if v := gjson.GetBytes(body, field); v.Exists() {
+			return field, int(v.Int())
+		}
+	}
+	switch {
+	case gjson.GetBytes(body, "contents").Exists():
+		return "generationConfig.maxOutputTokens", 0
+	case gjson.GetBytes(body, "input").Exists():
+		return "max_output_tokens", 0
+	}
+	return "max_tokens", 0
+}
+
+// EstimateRequestTokens 在本地估算任意协议（Anthropic / OpenAI Chat / Responses / Gemini）请求的输入 token 数
+func EstimateRequestTokens(body []byte) int {
+	total := 0
+	for _, field := range []string{"system", "instructions", "tools", "systemInstruction", "system_instruction"} {
+		total += estimateValueTokens(gjson.GetBytes(body, field))
+	}
+	_, items := conversationItems(body)
+	for _, item := range items {
+		total += estimateValueTokens(item) + 4
+	}
+	if input := gjson.GetBytes(body, "input"); input.Type == gjson.String {
+		total += estimateTextTokens(input.String())
+	}
+	return total
+}
+
+// conversationItems 返回请求中的对话数组字段与内容
+func conversationItems(body []byte) (string, []gjson.Result) {
+	for _, field := range []string{"messages", "input", "contents"} {
+		if v := gjson.GetBytes(body, field); v.IsArray() {
+			return field, v.Array()
+		}
+	}
+	return "", nil
+}
+
+// truncateConversation 从最早的对话开始丢弃，直到估算值不超过 limit；
+// 保留 system 消息与最后一条消息，并保证剩余对话以用户消息开头
+func truncateConversation(body []byte, limit int) ([]byte, int) {
+	field, items := conversationItems(body)
+	if len(items) <= 1 {
+		return body, EstimateRequestTokens(body)
+	}
+
+	kept := items
+	result := body
+	estimate := EstimateRequestTokens(body)
+	for estimate > limit {
+		// 找到最早可丢弃的对话（不含最后一条）
+		drop := -1
+		for i := 0; i < len(kept)-1; i++ {
+			if !isPinnedMessage(kept[i]) {
+				drop = i
+				break
+			}
+		}
+		if drop < 0 {
+			break
+		}
+		kept = append(append([]gjson.Result{}, kept[:drop]...), kept[drop+1:]...)
+		// 丢弃后紧跟的助手回复 / 工具结果失去上下文，一并丢弃
+		for drop < len(kept)-1 && isOrphanMessage(kept[drop]) {
+			kept = append(append([]gjson.Result{}, kept[:drop]...), kept[drop+1:]...)
+		}
+
+		updated, err := setConversationItems(body, field, kept)
+		if err != nil {
+			break
+		}
+		result = updated
+		estimate = EstimateRequestTokens(result)
+	}
+	return result, estimate
+}
+
+// isPinnedMessage system / developer 消息始终保留
+func isPinnedMessage(item gjson.Result) bool {
+	role := item.Get("role").String()
+	return role == "system" || role == "developer"
+}
+
+// isOrphanMessage 不能作为对话开头的消息：助手回复与工具结果
+func isOrphanMessage(item gjson.Result) bool {
+	switch item.Get("role").String() {
+	case "assistant", "model", "tool", "function":
+		return true
+	}
+	if t := item.Get("type").String(); t == "function_call_output" || t == "function_call" {
+		return true
+	}
+	return item.Get(`content.#(type=="tool_result")`).Exists() || item.Get("parts.#.functionResponse").Exists()
+}
+
+// setConversationItems 用 items 替换请求体中的对话数组
+func setConversationItems(body []byte, field string, items []gjson.Result) ([]byte, error) {
+	raw := make([]string, len(items))
+	for i, item := range items {
+		raw[i] = item.Raw
+	}
+	return sjson.SetRawBytes(body, field, []byte("["+strings.Join(raw, ",")+"]"))
+}
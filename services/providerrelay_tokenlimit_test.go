@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestResolveTokenLimits(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.tokenLimits.defaults = map[string]TokenLimits{
+		"claude": {MaxInputTokens: 100000, MaxOutputTokens: 8192},
+	}
+
+	got := prs.resolveTokenLimits("claude", Provider{TokenLimits: &TokenLimits{MaxOutputTokens: 4096, OnExceed: TokenLimitTruncate}})
+	want := TokenLimits{MaxInputTokens: 100000, MaxOutputTokens: 4096, OnExceed: TokenLimitTruncate}
+	if got != want {
+		t.Fatalf("limits = %+v, want %+v", got, want)
+	}
+	if got := prs.resolveTokenLimits("codex", Provider{}); got != (TokenLimits{OnExceed: TokenLimitReject}) {
+		t.Fatalf("codex limits = %+v", got)
+	}
+}
+
+func TestEnforceTokenLimitsReject(t *testing.T) {
+	prs := &ProviderRelayService{}
+	provider := Provider{Name: "reseller", TokenLimits: &TokenLimits{MaxInputTokens: 50, MaxOutputTokens: 4096}}
+
+	small := []byte(`{"model":"claude-sonnet-4-5","messages":[{"role":"user","content":"hi"}]}`)
+	body, err := prs.enforceTokenLimits("claude", provider, small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A missing max_tokens gets the provider limit
+	if got := gjson.GetBytes(body, "max_tokens").Int(); got != 4096 {
+		t.Fatalf("max_tokens = %d, want 4096", got)
+	}
+
+	large := []byte(`{"model":"claude-sonnet-4-5","max_tokens":1024,"messages":[{"role":"user","content":"` + strings.Repeat("word ", 100) + `"}]}`)
+	_, err = prs.enforceTokenLimits("claude", provider, large)
+	var limitErr *tokenLimitError
+	if !errors.As(err, &limitErr) || limitErr.field != "input" || limitErr.limit != 50 {
+		t.Fatalf("err = %v, want input limit error", err)
+	}
+
+	greedy := []byte(`{"model":"gpt-5","max_completion_tokens":32000,"messages":[{"role":"user","content":"hi"}]}`)
+	_, err = prs.enforceTokenLimits("codex", provider, greedy)
+	if !errors.As(err, &limitErr) || limitErr.field != "output" || limitErr.actual != 32000 {
+		t.Fatalf("err = %v, want output limit error", err)
+	}
+}
+
+func TestEnforceTokenLimitsTruncate(t *testing.T) {
+	prs := &ProviderRelayService{}
+	provider := Provider{Name: "reseller", TokenLimits: &TokenLimits{MaxInputTokens: 120, MaxOutputTokens: 2048, OnExceed: TokenLimitTruncate}}
+
+	filler := strings.Repeat("x", 200)
+	body := []byte(`{"model":"gpt-5","max_tokens":8000,"messages":[
+		{"role":"system","content":"be brief"},
+		{"role":"user","content":"` + filler + `"},
+		{"role":"assistant","content":"` + filler + `"},
+		{"role":"user","content":"` + filler + `"},
+		{"role":"assistant","content":"ok"},
+		{"role":"user","content":"latest question"}]}`)
+
+	limited, err := prs.enforceTokenLimits("codex", provider, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := EstimateRequestTokens(limited); got > 120 {
+		t.Fatalf("estimate after truncation = %d", got)
+	}
+	messages := gjson.GetBytes(limited, "messages").Array()
+	if len(messages) < 2 || messages[0].Get("role").String() != "system" || messages[1].Get("role").String() != "user" {
+		t.Fatalf("messages = %s", gjson.GetBytes(limited, "messages").Raw)
+	}
+	if messages[len(messages)-1].Get("content").String() != "latest question" {
+		t.Fatalf("latest message dropped: %s", gjson.GetBytes(limited, "messages").Raw)
+	}
+	if got := gjson.GetBytes(limited, "max_tokens").Int(); got != 2048 {
+		t.Fatalf("max_tokens = %d, want 2048", got)
+	}
+
+	// The last message alone is still too large
+	huge := []byte(`{"messages":[{"role":"user","content":"` + strings.Repeat("word ", 200) + `"}]}`)
+	if _, err := prs.enforceTokenLimits("codex", provider, huge); err == nil {
+		t.Fatal("expected error when truncation cannot fit the last message")
+	}
+}
+
+func TestEnforceTokenLimitsGemini(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.tokenLimits.defaults = map[string]TokenLimits{"gemini-cli": {MaxOutputTokens: 1000}}
+
+	body := []byte(`{"contents":[{"role":"user","parts":[{"text":"hi"},{"inlineData":{"mimeType":"image/png","data":"` + strings.Repeat("A", 5000) + `"}}]}]}`)
+	if got := EstimateRequestTokens(body); got > 2000 {
+		t.Fatalf("inline image counted as text: %d tokens", got)
+	}
+	limited, err := prs.enforceTokenLimits("gemini-cli", Provider{Name: "g"}, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gjson.GetBytes(limited, "generationConfig.maxOutputTokens").Int(); got != 1000 {
+		t.Fatalf("maxOutputTokens = %d, want 1000", got)
+	}
+}
+
+func TestTokenLimitDefaultsPersist(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	prs := &ProviderRelayService{}
+	if err := prs.SetTokenLimitDefaults(map[string]TokenLimits{"claude": {OnExceed: "drop"}}); err == nil {
+		t.Fatal("invalid onExceed should be rejected")
+	}
+	if err := prs.SetTokenLimitDefaults(map[string]TokenLimits{" Claude ": {MaxInputTokens: 200000}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".code-switch", "token-limits.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := &ProviderRelayService{}
+	reloaded.loadTokenLimitDefaults()
+	if got := reloaded.GetTokenLimitDefaults()["claude"].MaxInputTokens; got != 200000 {
+		t.Fatalf("reloaded claude limit = %d", got)
+	}
+}
+
+func TestWriteTokenLimitError(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	writeTokenLimitError(c, &tokenLimitError{provider: "p", field: "input", actual: 900, limit: 500})
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "token_limit_exceeded") {
+		t.Fatalf("response = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 传输字节统计：每次上游请求记录发送的请求体与收到的响应体字节数（request_log.request_bytes / response_bytes），
+// 与 Body 日志开关无关；按流量计费的网络与容量规划可据此统计。请求体为实际发送的字节（含上游压缩），
+// 响应体为网关读取到的字节
+
+// transferTotals 单个平台累计的传输字节数
+type transferTotals struct {
+	requestBytes  uint64
+	responseBytes uint64
+}
+
+// transferCounters 进程内按平台的传输字节计数，用于 /metrics
+type transferCounters struct {
+	mu         sync.Mutex
+	byPlatform map[string]*transferTotals
+}
+
+// countingReadCloser 统计读取的字节数
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+// countResponseBytes 把响应体的读取字节数累加到请求日志
+func countResponseBytes(resp *http.Response, log *ReqeustLog) {
+	if resp == nil || resp.Body == nil || log == nil {
+		return
+	}
+	resp.Body = &countingReadCloser{ReadCloser: resp.Body, n: &log.ResponseBytes}
+}
+
+// observeTransfer 累加请求日志的传输字节数
+func (prs *ProviderRelayService) observeTransfer(log *ReqeustLog) {
+	requestBytes := log.RequestBytes
+	responseBytes := atomic.LoadInt64(&log.ResponseBytes)
+	if requestBytes <= 0 && responseBytes <= 0 {
+		return
+	}
+	platform := log.Platform
+	if platform == "" {
+		platform = "unknown"
+	}
+	prs.transfer.mu.Lock()
+	defer prs.transfer.mu.Unlock()
+	if prs.transfer.byPlatform == nil {
+		prs.transfer.byPlatform = make(map[string]*transferTotals)
+	}
+	totals := prs.transfer.byPlatform[platform]
+	if totals == nil {
+		totals = &transferTotals{}
+		prs.transfer.byPlatform[platform] = totals
+	}
+	if requestBytes > 0 {
+		totals.requestBytes += uint64(requestBytes)
+	}
+	if responseBytes > 0 {
+		totals.responseBytes += uint64(responseBytes)
+	}
+}
+
+// transferMetrics 以 Prometheus 文本格式输出各平台的传输字节数
+func (prs *ProviderRelayService) transferMetrics() string {
+	prs.transfer.mu.Lock()
+	platforms := make([]string, 0, len(prs.transfer.byPlatform))
+	totals := make(map[string]transferTotals, len(prs.transfer.byPlatform))
+	for platform, t := range prs.transfer.byPlatform {
+		platforms = append(platforms, platform)
+		totals[platform] = *t
+	}
+	prs.transfer.mu.Unlock()
+	sort.Strings(platforms)
+
+	var b strings.Builder
+	b.WriteString("\n# HELP ailurus_paas_transfer_bytes_total Request and response body bytes exchanged with upstream providers\n")
+	b.WriteString("# TYPE ailurus_paas_transfer_bytes_total counter\n")
+	for _, platform := range platforms {
+		fmt.Fprintf(&b, "ailurus_paas_transfer_bytes_total{platform=%q,direction=\"request\"} %d\n", platform, totals[platform].requestBytes)
+		fmt.Fprintf(&b, "ailurus_paas_transfer_bytes_total{platform=%q,direction=\"response\"} %d\n", platform, totals[platform].responseBytes)
+	}
+	return b.String()
+}
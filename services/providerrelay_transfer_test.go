@@ -0,0 +1,88 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountResponseBytes(t *testing.T) {
+	log := &ReqeustLog{Platform: "claude", RequestBytes: 120}
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader("event: ping\n\ndata: {}\n\n"))}
+	countResponseBytes(resp, log)
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if log.ResponseBytes != 23 {
+		t.Fatalf("response bytes = %d", log.ResponseBytes)
+	}
+
+	// JSON 模式重新请求时同一条日志继续累加
+	retry := &http.Response{Body: io.NopCloser(strings.NewReader("{}"))}
+	countResponseBytes(retry, log)
+	io.Copy(io.Discard, retry.Body)
+	if log.ResponseBytes != 25 {
+		t.Fatalf("response bytes after retry = %d", log.ResponseBytes)
+	}
+	countResponseBytes(nil, log)
+
+	prs := &ProviderRelayService{}
+	prs.observeTransfer(log)
+	prs.observeTransfer(&ReqeustLog{Platform: "claude", RequestBytes: 30, ResponseBytes: 5})
+	prs.observeTransfer(&ReqeustLog{RequestBytes: 7})
+	prs.observeTransfer(&ReqeustLog{Platform: "codex"})
+	metrics := prs.transferMetrics()
+	for _, want := range []string{
+		`ailurus_paas_transfer_bytes_total{platform="claude",direction="request"} 150`,
+		`ailurus_paas_transfer_bytes_total{platform="claude",direction="response"} 30`,
+		`ailurus_paas_transfer_bytes_total{platform="unknown",direction="request"} 7`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics missing %q:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(metrics, "codex") {
+		t.Errorf("platform without traffic exported:\n%s", metrics)
+	}
+}
+
+func TestTransferBytesStatistics(t *testing.T) {
+	db := openAnalyticsDB(t, "transfer.db")
+
+	prs := &ProviderRelayService{}
+	now := time.Now().UTC()
+	logs := []*ReqeustLog{
+		{Platform: "claude", Provider: "a", HttpCode: 200, RequestBytes: 1000, ResponseBytes: 4000, CreatedAt: now.Add(-3 * time.Hour).Format(timeLayout)},
+		{Platform: "claude", Provider: "b", HttpCode: 500, RequestBytes: 1000, ResponseBytes: 200, CreatedAt: now.Add(-3 * time.Hour).Format(timeLayout)},
+		{Platform: "codex", Provider: "a", HttpCode: 200, RequestBytes: 300, ResponseBytes: 50, CreatedAt: now.Format(timeLayout)},
+	}
+	if err := prs.writeRequestLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	detail, err := scanRequestLog(db.QueryRow("SELECT " + requestLogColumns + " FROM request_log ORDER BY id LIMIT 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.RequestBytes != 1000 || detail.ResponseBytes != 4000 {
+		t.Fatalf("stored bytes = %d / %d", detail.RequestBytes, detail.ResponseBytes)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		stats, err := prs.GetLogStatistics("all")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.RequestBytes != 2300 || stats.ResponseBytes != 4250 {
+			t.Fatalf("%s: statistics bytes = %d / %d", stage, stats.RequestBytes, stats.ResponseBytes)
+		}
+	}
+	check("raw")
+	if err := refreshRequestLogRollups(db, now); err != nil {
+		t.Fatal(err)
+	}
+	check("rollup")
+}
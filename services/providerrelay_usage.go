@@ -0,0 +1,492 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// usageBucketDay / usageBucketHour 聚合粒度（与 OpenAI Usage API 的 bucket_width 一致）
+const (
+	usageBucketDay  = "1d"
+	usageBucketHour = "1h"
+)
+
+// usageMaxRange 单次查询的最大时间跨度，防止误传参数导致全表聚合
+const usageMaxRange = 366 * 24 * time.Hour
+
+// clientKeyID 客户端 Key 的不可逆标识（仅保存哈希前缀，不落盘原始 Key）
+func clientKeyID(c *gin.Context) string {
+	key := clientAPIKey(c)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:8])
+}
+
+// usageRow 按时间桶 / 模型 / Key / 项目聚合的用量
+type usageRow struct {
+	Bucket      time.Time
+	Model       string
+	APIKeyID    string
+	Project     string
+	Requests    int64
+	Input       int64
+	Output      int64
+	CacheRead   int64
+	CacheCreate int64
+	Cost        float64
+}
+
+// queryUsage 聚合 [start, end) 内的用量，时间均为 UTC
+func queryUsage(start, end time.Time, bucket string) ([]usageRow, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	bucketExpr := "strftime('%Y-%m-%d 00:00:00', created_at)"
+	if bucket == usageBucketHour {
+		bucketExpr = "strftime('%Y-%m-%d %H:00:00', created_at)"
+	}
+	rows, err := db.Query(`
+		SELECT `+bucketExpr+` AS bucket,
+		       COALESCE(model, ''), COALESCE(api_key_id, ''), COALESCE(project, ''),
+		       COUNT(*),
+		       COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+		       COALESCE(SUM(cache_read_tokens), 0), COALESCE(SUM(cache_create_tokens), 0),
+		       COALESCE(SUM(total_cost), 0)
+		FROM request_log
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY 1, 2, 3, 4
+		ORDER BY 1 ASC`,
+		start.UTC().Format(timeLayout), end.UTC().Format(timeLayout))
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []usageRow{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]usageRow, 0)
+	for rows.Next() {
+		var row usageRow
+		var bucketStr string
+		if err := rows.Scan(&bucketStr, &row.Model, &row.APIKeyID, &row.Project, &row.Requests,
+			&row.Input, &row.Output, &row.CacheRead, &row.CacheCreate, &row.Cost); err != nil {
+			return nil, err
+		}
+		row.Bucket, _ = time.ParseInLocation(timeLayout, bucketStr, time.UTC)
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// registerUsageRoutes 注册 OpenAI 兼容的用量查询接口，便于现有用量看板 / 预算工具直接对接网关
+func (prs *ProviderRelayService) registerUsageRoutes(router gin.IRouter) {
+	router.GET("/v1/usage", prs.usageAuth(legacyUsageHandler))
+	router.GET("/v1/dashboard/billing/usage", prs.usageAuth(billingUsageHandler))
+	router.GET("/v1/organization/usage/completions", prs.usageAuth(completionsUsageHandler))
+	router.GET("/v1/organization/costs", prs.usageAuth(costsHandler))
+}
+
+// usageAuth 用量数据与 live tail 共用访问控制：默认仅本机，配置令牌后凭令牌访问
+func (prs *ProviderRelayService) usageAuth(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !prs.authorizeLogTail(c) {
+			markAuthFailure(c)
+			c.JSON(http.StatusForbidden, openAIError("usage API is only available from localhost or with a valid token"))
+			return
+		}
+		handler(c)
+	}
+}
+
+func openAIError(message string) gin.H {
+	return gin.H{"error": gin.H{"message": message, "type": "invalid_request_error"}}
+}
+
+// parseUsageDate 解析 YYYY-MM-DD（UTC）
+func parseUsageDate(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", strings.TrimSpace(value), time.UTC)
+}
+
+// legacyUsageHandler GET /v1/usage?date=YYYY-MM-DD：旧版 OpenAI 用量格式，按模型汇总当天用量
+func legacyUsageHandler(c *gin.Context) {
+	date := c.Query("date")
+	if date == "" {
+		date = time.Now().UTC().Format("2006-01-02")
+	}
+	day, err := parseUsageDate(date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openAIError("invalid date, expected YYYY-MM-DD"))
+		return
+	}
+	rows, err := queryUsage(day, day.Add(24*time.Hour), usageBucketDay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openAIError(err.Error()))
+		return
+	}
+
+	byModel := make(map[string]*usageRow)
+	var totalCost float64
+	for i := range rows {
+		row := rows[i]
+		totalCost += row.Cost
+		agg := byModel[row.Model]
+		if agg == nil {
+			agg = &usageRow{Bucket: row.Bucket, Model: row.Model}
+			byModel[row.Model] = agg
+		}
+		agg.Requests += row.Requests
+		agg.Input += row.Input + row.CacheRead + row.CacheCreate
+		agg.Output += row.Output
+	}
+	data := make([]gin.H, 0, len(byModel))
+	for _, model := range sortedUsageKeys(byModel) {
+		agg := byModel[model]
+		data = append(data, gin.H{
+			"aggregation_timestamp":    agg.Bucket.Unix(),
+			"n_requests":               agg.Requests,
+			"operation":                "completion",
+			"snapshot_id":              agg.Model,
+			"n_context_tokens_total":   agg.Input,
+			"n_generated_tokens_total": agg.Output,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":            "list",
+		"data":              data,
+		"ft_data":           []gin.H{},
+		"dalle_api_data":    []gin.H{},
+		"whisper_api_data":  []gin.H{},
+		"current_usage_usd": totalCost,
+	})
+}
+
+// billingUsageHandler GET /v1/dashboard/billing/usage?start_date=&end_date=：金额单位为美分，end_date 不含
+func billingUsageHandler(c *gin.Context) {
+	now := time.Now().UTC()
+	start, end := now.AddDate(0, 0, -30), now
+	var err error
+	if v := c.Query("start_date"); v != "" {
+		if start, err = parseUsageDate(v); err != nil {
+			c.JSON(http.StatusBadRequest, openAIError("invalid start_date, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if v := c.Query("end_date"); v != "" {
+		if end, err = parseUsageDate(v); err != nil {
+			c.JSON(http.StatusBadRequest, openAIError("invalid end_date, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if !end.After(start) || end.Sub(start) > usageMaxRange {
+		c.JSON(http.StatusBadRequest, openAIError("invalid date range"))
+		return
+	}
+	rows, err := queryUsage(start, end, usageBucketDay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openAIError(err.Error()))
+		return
+	}
+
+	type dayCosts struct {
+		timestamp time.Time
+		models    map[string]float64
+	}
+	days := make(map[int64]*dayCosts)
+	var total float64
+	for _, row := range rows {
+		day := days[row.Bucket.Unix()]
+		if day == nil {
+			day = &dayCosts{timestamp: row.Bucket, models: make(map[string]float64)}
+			days[row.Bucket.Unix()] = day
+		}
+		day.models[row.Model] += row.Cost * 100
+		total += row.Cost * 100
+	}
+	keys := make([]int64, 0, len(days))
+	for k := range days {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	dailyCosts := make([]gin.H, 0, len(keys))
+	for _, k := range keys {
+		day := days[k]
+		models := make([]string, 0, len(day.models))
+		for model := range day.models {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		items := make([]gin.H, 0, len(models))
+		for _, model := range models {
+			items = append(items, gin.H{"name": model, "cost": day.models[model]})
+		}
+		dailyCosts = append(dailyCosts, gin.H{"timestamp": float64(day.timestamp.Unix()), "line_items": items})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":      "list",
+		"daily_costs": dailyCosts,
+		"total_usage": total,
+	})
+}
+
+// orgUsageQuery Organization Usage / Costs API 的公共查询参数
+type orgUsageQuery struct {
+	start   time.Time
+	end     time.Time
+	bucket  string
+	groupBy map[string]bool
+	models  map[string]bool
+	keys    map[string]bool
+}
+
+// parseOrgUsageQuery 解析 start_time / end_time（Unix 秒）、bucket_width、group_by、models、api_key_ids
+func parseOrgUsageQuery(c *gin.Context) (orgUsageQuery, error) {
+	q := orgUsageQuery{bucket: usageBucketDay}
+	startSec, err := strconv.ParseInt(c.Query("start_time"), 10, 64)
+	if err != nil {
+		return q, fmt.Errorf("start_time is required (unix seconds)")
+	}
+	q.start = time.Unix(startSec, 0).UTC()
+	q.end = time.Now().UTC()
+	if v := c.Query("end_time"); v != "" {
+		endSec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid end_time")
+		}
+		q.end = time.Unix(endSec, 0).UTC()
+	}
+	if !q.end.After(q.start) || q.end.Sub(q.start) > usageMaxRange {
+		return q, fmt.Errorf("invalid time range")
+	}
+	if v := c.Query("bucket_width"); v != "" {
+		if v != usageBucketDay && v != usageBucketHour {
+			return q, fmt.Errorf("bucket_width must be 1d or 1h")
+		}
+		q.bucket = v
+	}
+	// 对齐到桶边界，与 OpenAI 行为一致
+	if q.bucket == usageBucketHour {
+		q.start = q.start.Truncate(time.Hour)
+	} else {
+		q.start = time.Date(q.start.Year(), q.start.Month(), q.start.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	q.groupBy = queryValueSet(c, "group_by")
+	q.models = queryValueSet(c, "models")
+	q.keys = queryValueSet(c, "api_key_ids")
+	return q, nil
+}
+
+// queryValueSet 同时支持 a=x&a=y、a[]=x 与逗号分隔
+func queryValueSet(c *gin.Context, name string) map[string]bool {
+	set := make(map[string]bool)
+	for _, raw := range append(c.QueryArray(name), c.QueryArray(name+"[]")...) {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				set[v] = true
+			}
+		}
+	}
+	return set
+}
+
+// filterRow 按 models / api_key_ids 过滤
+func (q orgUsageQuery) filterRow(row usageRow) bool {
+	if len(q.models) > 0 && !q.models[row.Model] {
+		return false
+	}
+	if len(q.keys) > 0 && !q.keys[row.APIKeyID] {
+		return false
+	}
+	return true
+}
+
+// bucketStarts 返回 [start, end) 内的全部桶起点（无数据的桶也需要返回）
+func (q orgUsageQuery) bucketStarts() []time.Time {
+	step := 24 * time.Hour
+	if q.bucket == usageBucketHour {
+		step = time.Hour
+	}
+	starts := make([]time.Time, 0)
+	for t := q.start; t.Before(q.end); t = t.Add(step) {
+		starts = append(starts, t)
+	}
+	return starts
+}
+
+func (q orgUsageQuery) bucketEnd(start time.Time) time.Time {
+	if q.bucket == usageBucketHour {
+		return start.Add(time.Hour)
+	}
+	return start.Add(24 * time.Hour)
+}
+
+// completionsUsageHandler GET /v1/organization/usage/completions
+func completionsUsageHandler(c *gin.Context) {
+	q, err := parseOrgUsageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openAIError(err.Error()))
+		return
+	}
+	rows, err := queryUsage(q.start, q.end, q.bucket)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openAIError(err.Error()))
+		return
+	}
+
+	type groupKey struct{ model, key, project string }
+	buckets := make(map[int64]map[groupKey]*usageRow)
+	for _, row := range rows {
+		if !q.filterRow(row) {
+			continue
+		}
+		var gk groupKey
+		if q.groupBy["model"] {
+			gk.model = row.Model
+		}
+		if q.groupBy["api_key_id"] {
+			gk.key = row.APIKeyID
+		}
+		if q.groupBy["project_id"] {
+			gk.project = row.Project
+		}
+		groups := buckets[row.Bucket.Unix()]
+		if groups == nil {
+			groups = make(map[groupKey]*usageRow)
+			buckets[row.Bucket.Unix()] = groups
+		}
+		agg := groups[gk]
+		if agg == nil {
+			agg = &usageRow{Model: gk.model, APIKeyID: gk.key, Project: gk.project}
+			groups[gk] = agg
+		}
+		agg.Requests += row.Requests
+		agg.Input += row.Input
+		agg.Output += row.Output
+		agg.CacheRead += row.CacheRead
+	}
+
+	data := make([]gin.H, 0)
+	for _, start := range q.bucketStarts() {
+		results := make([]gin.H, 0)
+		groups := buckets[start.Unix()]
+		for _, gk := range sortedGroupKeys(groups, func(k groupKey) string { return k.model + "\x00" + k.key + "\x00" + k.project }) {
+			agg := groups[gk]
+			results = append(results, gin.H{
+				"object":              "organization.usage.completions.result",
+				"input_tokens":        agg.Input,
+				"output_tokens":       agg.Output,
+				"input_cached_tokens": agg.CacheRead,
+				"num_model_requests":  agg.Requests,
+				"model":               nullableGroup(q.groupBy["model"], agg.Model),
+				"api_key_id":          nullableGroup(q.groupBy["api_key_id"], agg.APIKeyID),
+				"project_id":          nullableGroup(q.groupBy["project_id"], agg.Project),
+				"user_id":             nil,
+				"batch":               nil,
+			})
+		}
+		data = append(data, gin.H{
+			"object":     "bucket",
+			"start_time": start.Unix(),
+			"end_time":   q.bucketEnd(start).Unix(),
+			"results":    results,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "page", "data": data, "has_more": false, "next_page": nil})
+}
+
+// costsHandler GET /v1/organization/costs：按天返回美元金额，可按 line_item（模型）/ project_id 分组
+func costsHandler(c *gin.Context) {
+	q, err := parseOrgUsageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openAIError(err.Error()))
+		return
+	}
+	if q.bucket != usageBucketDay {
+		c.JSON(http.StatusBadRequest, openAIError("costs only support bucket_width=1d"))
+		return
+	}
+	rows, err := queryUsage(q.start, q.end, usageBucketDay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openAIError(err.Error()))
+		return
+	}
+
+	type groupKey struct{ lineItem, project string }
+	buckets := make(map[int64]map[groupKey]float64)
+	for _, row := range rows {
+		if !q.filterRow(row) {
+			continue
+		}
+		var gk groupKey
+		if q.groupBy["line_item"] {
+			gk.lineItem = row.Model
+		}
+		if q.groupBy["project_id"] {
+			gk.project = row.Project
+		}
+		if buckets[row.Bucket.Unix()] == nil {
+			buckets[row.Bucket.Unix()] = make(map[groupKey]float64)
+		}
+		buckets[row.Bucket.Unix()][gk] += row.Cost
+	}
+
+	data := make([]gin.H, 0)
+	for _, start := range q.bucketStarts() {
+		results := make([]gin.H, 0)
+		groups := buckets[start.Unix()]
+		for _, gk := range sortedGroupKeys(groups, func(k groupKey) string { return k.lineItem + "\x00" + k.project }) {
+			results = append(results, gin.H{
+				"object":     "organization.costs.result",
+				"amount":     gin.H{"value": groups[gk], "currency": "usd"},
+				"line_item":  nullableGroup(q.groupBy["line_item"], gk.lineItem),
+				"project_id": nullableGroup(q.groupBy["project_id"], gk.project),
+			})
+		}
+		data = append(data, gin.H{
+			"object":     "bucket",
+			"start_time": start.Unix(),
+			"end_time":   q.bucketEnd(start).Unix(),
+			"results":    results,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "page", "data": data, "has_more": false, "next_page": nil})
+}
+
+// nullableGroup 未参与分组的维度按 OpenAI 约定返回 null
+func nullableGroup(grouped bool, value string) any {
+	if !grouped {
+		return nil
+	}
+	return value
+}
+
+func sortedUsageKeys(m map[string]*usageRow) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedGroupKeys[K comparable, V any](m map[K]V, sortKey func(K) string) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return sortKey(keys[i]) < sortKey(keys[j]) })
+	return keys
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupUsageTestDB(t *testing.T) {
+	t.Helper()
+	db := openAnalyticsDB(t, "usage.db")
+	rows := []struct {
+		createdAt, model, key, project string
+		input, output, cached          int
+		cost                           float64
+	}{
+		{"2026-03-01 10:00:00", "gpt-5", "key_a", "acme", 100, 10, 20, 0.10},
+		{"2026-03-01 11:30:00", "gpt-5", "key_b", "", 50, 5, 0, 0.05},
+		{"2026-03-01 11:45:00", "claude-sonnet", "key_a", "acme", 10, 1, 0, 0.01},
+		{"2026-03-02 09:00:00", "gpt-5", "key_a", "acme", 200, 20, 0, 0.20},
+		{"2026-03-05 09:00:00", "gpt-5", "key_a", "acme", 999, 999, 0, 9.99},
+	}
+	for _, r := range rows {
+		if _, err := db.Exec(`INSERT INTO request_log (platform, model, provider, http_code, input_tokens, output_tokens, cache_read_tokens, total_cost, api_key_id, project, created_at)
+			VALUES ('codex', ?, 'p1', 200, ?, ?, ?, ?, ?, ?, ?)`,
+			r.model, r.input, r.output, r.cached, r.cost, r.key, r.project, r.createdAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func usageRequest(t *testing.T, prs *ProviderRelayService, remote, target string) (int, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	prs.registerUsageRoutes(router)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = remote
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestUsageEndpointsRequireLocalAccess(t *testing.T) {
+	prs := &ProviderRelayService{}
+	if code, _ := usageRequest(t, prs, "203.0.113.5:1234", "/v1/usage?date=2026-03-01"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for remote client, got %d", code)
+	}
+}
+
+func TestBillingAndLegacyUsage(t *testing.T) {
+	setupUsageTestDB(t)
+	prs := &ProviderRelayService{}
+
+	code, body := usageRequest(t, prs, "127.0.0.1:1234", "/v1/dashboard/billing/usage?start_date=2026-03-01&end_date=2026-03-03")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %v", code, body)
+	}
+	if total := body["total_usage"].(float64); total < 35.99 || total > 36.01 {
+		t.Fatalf("expected 36 cents, got %v", total)
+	}
+	days := body["daily_costs"].([]any)
+	if len(days) != 2 || len(days[0].(map[string]any)["line_items"].([]any)) != 2 {
+		t.Fatalf("unexpected daily costs %v", days)
+	}
+
+	code, body = usageRequest(t, prs, "127.0.0.1:1234", "/v1/usage?date=2026-03-01")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	data := body["data"].([]any)
+	if len(data) != 2 {
+		t.Fatalf("expected 2 models, got %v", data)
+	}
+	gpt := data[1].(map[string]any)
+	if gpt["snapshot_id"] != "gpt-5" || gpt["n_requests"].(float64) != 2 || gpt["n_context_tokens_total"].(float64) != 170 {
+		t.Fatalf("unexpected legacy row %v", gpt)
+	}
+
+	if code, _ := usageRequest(t, prs, "127.0.0.1:1234", "/v1/dashboard/billing/usage?start_date=bad"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+}
+
+func TestOrganizationUsageBuckets(t *testing.T) {
+	setupUsageTestDB(t)
+	prs := &ProviderRelayService{}
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC).Unix()
+	end := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC).Unix()
+
+	code, body := usageRequest(t, prs, "127.0.0.1:1234",
+		"/v1/organization/usage/completions?start_time="+strconv.FormatInt(start, 10)+"&end_time="+strconv.FormatInt(end, 10)+"&group_by=model&group_by=api_key_id")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %v", code, body)
+	}
+	buckets := body["data"].([]any)
+	if len(buckets) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(buckets))
+	}
+	results := buckets[0].(map[string]any)["results"].([]any)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 groups on day 1, got %v", results)
+	}
+	first := results[0].(map[string]any)
+	if first["model"] != "claude-sonnet" || first["api_key_id"] != "key_a" || first["project_id"] != nil {
+		t.Fatalf("unexpected group %v", first)
+	}
+
+	code, body = usageRequest(t, prs, "127.0.0.1:1234",
+		"/v1/organization/costs?start_time="+strconv.FormatInt(start, 10)+"&end_time="+strconv.FormatInt(end, 10)+"&group_by=project_id")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %v", code, body)
+	}
+	day2 := body["data"].([]any)[1].(map[string]any)["results"].([]any)
+	amount := day2[0].(map[string]any)["amount"].(map[string]any)
+	if amount["value"].(float64) != 0.20 || amount["currency"] != "usd" {
+		t.Fatalf("unexpected cost %v", amount)
+	}
+
+	if code, _ := usageRequest(t, prs, "127.0.0.1:1234", "/v1/organization/costs"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without start_time, got %d", code)
+	}
+}
@@ -20,6 +20,9 @@ type Provider struct {
 	Accent  string `json:"accent"`
 	Enabled bool   `json:"enabled"`
 
+	// 保险库条目 ID - 设置后 API Key 从 SuiStore 保险库解析，配置文件中不保存明文
+	APIKeyRef string `json:"apiKeyRef,omitempty"`
+
 	// 模型白名单 - Provider 原生支持的模型名
 	// 使用 map 实现 O(1) 查找，向后兼容（omitempty）
 	SupportedModels map[string]bool `json:"supportedModels,omitempty"`
@@ -32,6 +35,64 @@ type Provider struct {
 	// 使用 omitempty 确保零值不序列化，向后兼容
 	Level int `json:"level,omitempty"`
 
+	// 认证方式 - "api_key"（默认，空值等价）或 "oauth"
+	// oauth 模式下不需要 APIKey，由 OAuthService 提供并自动刷新访问令牌
+	AuthType string `json:"authType,omitempty"`
+
+	// Provider 类型 - 空值为 OpenAI/Anthropic 兼容接口，"azure" 为 Azure OpenAI，
+	// "local" 为 Ollama / LM Studio 等本地模型服务（无需 API Key，不计费）
+	ProviderType string `json:"providerType,omitempty"`
+
+	// 接口格式 - 空值与平台协议一致；"openai" 表示只提供 Chat Completions（Claude 请求转换后转发），
+	// "anthropic" 表示只提供 Messages 接口（Chat Completions 请求转换后转发），工具调用双向保持一致
+	APIFormat string `json:"apiFormat,omitempty"`
+
+	// 兜底 provider - 不参与常规轮询，仅在其他 provider 全部失败时使用
+	FallbackOnly bool `json:"fallbackOnly,omitempty"`
+
+	// 聚合平台模型目录同步 - 定期拉取 /models 自动维护 supportedModels 与上游价格
+	CatalogSync bool `json:"catalogSync,omitempty"`
+
+	// 自定义请求头模板与固定请求体参数（JSON Merge Patch）
+	// 值中可使用 {{apiKey}}、{{model}}、{{provider}} 变量
+	ExtraHeaders map[string]string      `json:"extraHeaders,omitempty"`
+	ExtraBody    map[string]interface{} `json:"extraBody,omitempty"`
+
+	// 上游超时（秒），未设置的项使用全局配置
+	Timeouts *TimeoutSettings `json:"timeouts,omitempty"`
+
+	// 单次请求的 token 上限，未设置的项使用平台默认值
+	TokenLimits *TokenLimits `json:"tokenLimits,omitempty"`
+
+	// 灰度发布：新 provider 试用期内只接收部分流量，按错误率 / 延迟自动转正或停用
+	Canary *CanaryConfig `json:"canary,omitempty"`
+
+	// 服务等级目标：延迟分位数与错误率上限，按滚动窗口计算错误预算并在消耗过快时告警
+	SLO *ProviderSLO `json:"slo,omitempty"`
+
+	// JSON 模式保证：validate 校验输出并修复 / 重试，enforce 用于不支持 response_format 的 provider
+	JSONMode        string `json:"jsonMode,omitempty"`
+	JSONModeRetries int    `json:"jsonModeRetries,omitempty"` // 无法修复时的最大重试次数，默认 2
+
+	// 推理内容处理策略：passthrough / strip / tags，未设置时使用平台默认值（客户端规则优先）
+	ReasoningPolicy string `json:"reasoningPolicy,omitempty"`
+
+	// 并发上限 - 同时转发到该 provider 的请求数，超出时排队（interactive 优先于 batch），0 表示不限制
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+
+	// 能力声明（vision / tools / json_mode / reasoning）与图片限制，未声明的能力视为支持
+	Capabilities *ProviderCapabilities `json:"capabilities,omitempty"`
+
+	// 自动挂起 - 连续认证失败（401/403）后由网关设置，重新验证通过后自动清除
+	// 与用户手动禁用（enabled=false）相互独立
+	Suspended       bool   `json:"suspended,omitempty"`
+	SuspendedReason string `json:"suspendedReason,omitempty"`
+	SuspendedAt     int64  `json:"suspendedAt,omitempty"`
+
+	// Azure OpenAI 专用配置：api-version 与 模型名 -> 部署名 映射（支持通配符）
+	AzureAPIVersion  string            `json:"azureApiVersion,omitempty"`
+	AzureDeployments map[string]string `json:"azureDeployments,omitempty"`
+
 	// 内部字段：配置验证错误（不持久化）
 	configErrors []string `json:"-"`
 }
@@ -42,6 +103,14 @@ type providerEnvelope struct {
 
 type ProviderService struct {
 	mu sync.Mutex
+
+	// 声明式配置（GATEWAY_CONFIG）加载的 provider，非 nil 时不读写 provider 文件
+	staticMu sync.RWMutex
+	static   map[string][]Provider
+
+	// 解析 apiKeyRef 的保险库，未设置时引用的 Key 为空
+	vaultMu sync.RWMutex
+	vault   SecretVault
 }
 
 func NewProviderService() *ProviderService {
@@ -80,11 +149,6 @@ func (ps *ProviderService) SaveProviders(kind string, providers []Provider) erro
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	path, err := providerFilePath(kind)
-	if err != nil {
-		return err
-	}
-
 	existingProviders, err := ps.LoadProviders(kind)
 	if err != nil {
 		return err
@@ -108,6 +172,11 @@ func (ps *ProviderService) SaveProviders(kind string, providers []Provider) erro
 				validationErrors = append(validationErrors, fmt.Sprintf("[%s] %s", p.Name, errMsg))
 			}
 		}
+
+		// 规则 3：模型名结构（空模型名、首尾空白、多个通配符等）
+		for _, issue := range schemaErrors(p.modelSchemaIssues("")) {
+			validationErrors = append(validationErrors, fmt.Sprintf("[%s] %s", p.Name, issue))
+		}
 	}
 
 	// 如果有验证错误，返回汇总错误
@@ -115,6 +184,18 @@ func (ps *ProviderService) SaveProviders(kind string, providers []Provider) erro
 		return fmt.Errorf("配置验证失败：\n  - %s", strings.Join(validationErrors, "\n  - "))
 	}
 
+	providers = stampCanaryStart(providers)
+
+	if ps.saveStaticProviders(kind, providers) {
+		return nil
+	}
+
+	path, err := providerFilePath(kind)
+	if err != nil {
+		return err
+	}
+
+	providers = stripVaultKeys(providers)
 	data, err := json.MarshalIndent(providerEnvelope{Providers: providers}, "", "  ")
 	if err != nil {
 		return err
@@ -124,10 +205,99 @@ func (ps *ProviderService) SaveProviders(kind string, providers []Provider) erro
 	if err := os.WriteFile(tmp, data, 0o644); err != nil {
 		return err
 	}
-	return os.Rename(tmp, path)
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	GetSyncIntegration().OnScopedDocs(syncScopeProviders, providerSyncDocs(kind, providers))
+	return nil
+}
+
+// providerSyncDocs 按 "平台/名称" 拆分同步文档，去掉各设备独立的 ID 与挂起状态
+func providerSyncDocs(kind string, providers []Provider) map[string]interface{} {
+	docs := make(map[string]interface{}, len(providers))
+	for _, p := range providers {
+		raw, err := json.Marshal(p)
+		if err != nil {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			continue
+		}
+		for _, field := range providerLocalFields {
+			delete(doc, field)
+		}
+		docs[providerKey(kind, p.Name)] = doc
+	}
+	return docs
+}
+
+// providerLocalFields 不参与同步的字段
+var providerLocalFields = []string{"id", "suspended", "suspendedReason"}
+
+// applySyncedProvider 写回其他设备同步来的 provider，key 为 "平台/名称"。
+// 远端没有的字段（如未同步的 API Key）保留本地值
+func (ps *ProviderService) applySyncedProvider(key string, data map[string]interface{}) error {
+	kind, name, ok := strings.Cut(key, "/")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid provider key: %s", key)
+	}
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return err
+	}
+
+	idx, maxID := -1, 0
+	for i, p := range providers {
+		if p.Name == name {
+			idx = i
+		}
+		if p.ID > maxID {
+			maxID = p.ID
+		}
+	}
+
+	doc := make(map[string]interface{})
+	if idx >= 0 {
+		raw, err := json.Marshal(providers[idx])
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+	}
+	for field, v := range data {
+		doc[field] = v
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var provider Provider
+	if err := json.Unmarshal(raw, &provider); err != nil {
+		return err
+	}
+	provider.Name = name
+
+	if idx >= 0 {
+		provider.ID = providers[idx].ID
+		provider.Suspended = providers[idx].Suspended
+		provider.SuspendedReason = providers[idx].SuspendedReason
+		providers[idx] = provider
+	} else {
+		provider.ID = maxID + 1
+		providers = append(providers, provider)
+	}
+	return ps.SaveProviders(kind, providers)
 }
 
 func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
+	if providers, ok := ps.staticProviders(kind); ok {
+		ps.resolveVaultKeys(kind, providers)
+		return providers, nil
+	}
+
 	path, err := providerFilePath(kind)
 	if err != nil {
 		return nil, err
@@ -147,11 +317,25 @@ func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
 	}
 
 	if err := json.Unmarshal(data, &envelope); err != nil {
-		return nil, err
+		return nil, providerSchemaError(filepath.Base(path), data, err)
 	}
+	ps.resolveVaultKeys(kind, envelope.Providers)
 	return envelope.Providers, nil
 }
 
+// providerKey 跨平台唯一标识一个 provider："平台/名称"
+func providerKey(kind, providerName string) string {
+	return kind + "/" + providerName
+}
+
+// HasCredentials 判断 provider 是否具备可用的认证信息
+func (p *Provider) HasCredentials() bool {
+	if p.AuthType == AuthTypeOAuth || p.IsLocal() {
+		return true
+	}
+	return p.APIKey != ""
+}
+
 // IsModelSupported 检查 provider 是否支持指定的模型
 // 支持条件：1) 模型在 SupportedModels 中（精确或通配符匹配）
 //          2) 模型在 ModelMapping 的 key 中（精确或通配符匹配）
@@ -274,6 +458,48 @@ func (p *Provider) ValidateConfiguration() []string {
 		}
 	}
 
+	// 规则 4：token 上限配置
+	if p.TokenLimits != nil {
+		if err := p.TokenLimits.Validate(); err != nil {
+			errors = append(errors, fmt.Sprintf("tokenLimits 配置无效: %v", err))
+		}
+	}
+
+	// 规则 5：灰度与 SLO 配置
+	if p.Canary != nil {
+		if err := p.Canary.Validate(); err != nil {
+			errors = append(errors, fmt.Sprintf("canary 配置无效: %v", err))
+		}
+	}
+	if p.SLO != nil {
+		if err := p.SLO.Validate(); err != nil {
+			errors = append(errors, fmt.Sprintf("slo 配置无效: %v", err))
+		}
+	}
+
+	// 规则 6：JSON 模式
+	switch p.JSONMode {
+	case JSONModeNative, JSONModeValidate, JSONModeEnforce:
+	default:
+		errors = append(errors, fmt.Sprintf("jsonMode %q 无效，可选 validate / enforce", p.JSONMode))
+	}
+	if p.JSONModeRetries < 0 || p.JSONModeRetries > maxJSONModeRetries {
+		errors = append(errors, fmt.Sprintf("jsonModeRetries 必须在 0-%d 之间", maxJSONModeRetries))
+	}
+	if !validReasoningPolicy(p.ReasoningPolicy) {
+		errors = append(errors, fmt.Sprintf("reasoningPolicy %q 无效，可选 passthrough / strip / tags", p.ReasoningPolicy))
+	}
+	if !validAPIFormat(p.APIFormat) {
+		errors = append(errors, fmt.Sprintf("apiFormat %q 无效，可选 anthropic / openai", p.APIFormat))
+	}
+
+	// 规则 7：能力声明中的图片限制
+	if p.Capabilities != nil {
+		if err := p.Capabilities.Validate(); err != nil {
+			errors = append(errors, fmt.Sprintf("capabilities 配置无效: %v", err))
+		}
+	}
+
 	p.configErrors = errors
 	return errors
 }
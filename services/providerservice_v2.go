@@ -227,6 +227,11 @@ func (ps *ProviderServiceV2) SaveProviders(kind string, providers []Provider) er
 				validationErrors = append(validationErrors, fmt.Sprintf("[%s] %s", p.Name, errMsg))
 			}
 		}
+
+		// Rule 3: model name structure (empty names, stray whitespace, multiple wildcards)
+		for _, issue := range schemaErrors(p.modelSchemaIssues("")) {
+			validationErrors = append(validationErrors, fmt.Sprintf("[%s] %s", p.Name, issue))
+		}
 	}
 
 	if len(validationErrors) > 0 {
@@ -457,11 +462,15 @@ func (ps *ProviderServiceV2) GetAvailableProviders(kind string) ([]Provider, err
 		p.Enabled = (enabled == 1)
 
 		if supportedModelsJSON.Valid && supportedModelsJSON.String != "" {
-			json.Unmarshal([]byte(supportedModelsJSON.String), &p.SupportedModels)
+			if err := json.Unmarshal([]byte(supportedModelsJSON.String), &p.SupportedModels); err != nil {
+				fmt.Printf("[WARN] provider %s: supported_models is not a {\"model\": true} object, ignored: %v\n", p.Name, err)
+			}
 		}
 
 		if modelMappingJSON.Valid && modelMappingJSON.String != "" {
-			json.Unmarshal([]byte(modelMappingJSON.String), &p.ModelMapping)
+			if err := json.Unmarshal([]byte(modelMappingJSON.String), &p.ModelMapping); err != nil {
+				fmt.Printf("[WARN] provider %s: model_mapping is not a {\"from\": \"to\"} object, ignored: %v\n", p.Name, err)
+			}
 		}
 
 		providers = append(providers, p)
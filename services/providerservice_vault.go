@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SecretVault 保存 provider API Key 的保险库（由 SuiStore 实现）
+type SecretVault interface {
+	ResolveSecret(id string) (string, error)
+	StoreSecret(name, secret string, tags []string) (string, error)
+}
+
+// SetSecretVault 设置解析 apiKeyRef 使用的保险库
+func (ps *ProviderService) SetSecretVault(vault SecretVault) {
+	ps.vaultMu.Lock()
+	ps.vault = vault
+	ps.vaultMu.Unlock()
+}
+
+func (ps *ProviderService) secretVault() SecretVault {
+	ps.vaultMu.RLock()
+	defer ps.vaultMu.RUnlock()
+	return ps.vault
+}
+
+// resolveVaultKeys 为引用保险库的 provider 填充内存中的 APIKey；解析失败时 APIKey 为空，
+// provider 会因缺少认证信息被跳过
+func (ps *ProviderService) resolveVaultKeys(kind string, providers []Provider) {
+	vault := ps.secretVault()
+	for i := range providers {
+		ref := strings.TrimSpace(providers[i].APIKeyRef)
+		if ref == "" {
+			continue
+		}
+		providers[i].APIKey = ""
+		if vault == nil {
+			fmt.Printf("[Vault] Provider %s/%s 引用保险库条目 %s，但保险库不可用\n", kind, providers[i].Name, ref)
+			continue
+		}
+		secret, err := vault.ResolveSecret(ref)
+		if err != nil {
+			fmt.Printf("[Vault] Provider %s/%s 解析保险库条目 %s 失败: %v\n", kind, providers[i].Name, ref, err)
+			continue
+		}
+		providers[i].APIKey = secret
+	}
+}
+
+// stripVaultKeys 返回去掉已引用保险库的明文 Key 的副本，用于写入配置文件与同步
+func stripVaultKeys(providers []Provider) []Provider {
+	result := make([]Provider, len(providers))
+	copy(result, providers)
+	for i := range result {
+		if strings.TrimSpace(result[i].APIKeyRef) != "" {
+			result[i].APIKey = ""
+		}
+	}
+	return result
+}
+
+// MoveAPIKeysToVault 将平台下明文保存的 API Key 迁移到保险库，provider 改为引用条目 ID。
+// 返回迁移的数量
+func (ps *ProviderService) MoveAPIKeysToVault(kind string) (int, error) {
+	vault := ps.secretVault()
+	if vault == nil {
+		return 0, fmt.Errorf("保险库不可用")
+	}
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for i := range providers {
+		p := &providers[i]
+		if p.APIKeyRef != "" || p.APIKey == "" || p.AuthType == AuthTypeOAuth {
+			continue
+		}
+		id, err := vault.StoreSecret(providerKey(kind, p.Name), p.APIKey, []string{"provider", kind})
+		if err != nil {
+			return moved, fmt.Errorf("保存 %s 的 API Key 失败: %w", p.Name, err)
+		}
+		p.APIKeyRef = id
+		moved++
+	}
+	if moved == 0 {
+		return 0, nil
+	}
+	return moved, ps.SaveProviders(kind, providers)
+}
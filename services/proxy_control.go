@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +25,7 @@ type ProxyControlConfig struct {
 	ProxyMode        ProxyControlMode `json:"proxy_mode"`
 	ProxyPort        int              `json:"proxy_port,omitempty"`
 	InterceptDomains []string         `json:"intercept_domains,omitempty"`
+	Rules            *ProxyRules      `json:"rules,omitempty"` // nil keeps the current rules on update
 	TotalRequests    int64            `json:"total_requests"`
 	LastRequestAt    *time.Time       `json:"last_request_at,omitempty"`
 	LastToggledAt    *time.Time       `json:"last_toggled_at,omitempty"`
@@ -33,15 +35,29 @@ type ProxyControlConfig struct {
 // ProxyController manages per-application proxy control
 type ProxyController struct {
 	db    *sql.DB
-	cache map[string]bool // appName -> enabled cache
+	cache map[string]bool        // appName -> enabled cache
+	rules map[string]*ProxyRules // appName -> request rules
 	mu    sync.RWMutex
+
+	// Cost relayed per app on the current local day, for max_daily_cost
+	costMu    sync.Mutex
+	costDay   string
+	dailyCost map[string]float64
+
+	hitMu sync.Mutex // Serializes rule hit upserts from concurrent rejections
 }
 
 // NewProxyController creates a new proxy controller
 func NewProxyController(db *sql.DB) (*ProxyController, error) {
 	pc := &ProxyController{
-		db:    db,
-		cache: make(map[string]bool),
+		db:        db,
+		cache:     make(map[string]bool),
+		rules:     make(map[string]*ProxyRules),
+		dailyCost: make(map[string]float64),
+	}
+
+	if err := pc.ensureSchema(); err != nil {
+		return nil, fmt.Errorf("failed to migrate proxy control schema: %w", err)
 	}
 
 	// Initialize cache
@@ -49,6 +65,9 @@ func NewProxyController(db *sql.DB) (*ProxyController, error) {
 		return nil, fmt.Errorf("failed to load proxy control cache: %w", err)
 	}
 
+	// Daily cost limits must survive restarts, so today's spend is read back from the request log
+	pc.seedDailyCost(time.Now())
+
 	return pc, nil
 }
 
@@ -58,7 +77,7 @@ func (pc *ProxyController) loadCache() error {
 		return nil
 	}
 
-	rows, err := pc.db.Query("SELECT app_name, proxy_enabled FROM proxy_control")
+	rows, err := pc.db.Query("SELECT app_name, proxy_enabled, rules FROM proxy_control")
 	if err != nil {
 		return err
 	}
@@ -70,10 +89,12 @@ func (pc *ProxyController) loadCache() error {
 	for rows.Next() {
 		var appName string
 		var enabled int
-		if err := rows.Scan(&appName, &enabled); err != nil {
+		var rules sql.NullString
+		if err := rows.Scan(&appName, &enabled, &rules); err != nil {
 			return err
 		}
 		pc.cache[appName] = (enabled == 1)
+		pc.rules[appName] = parseProxyRules(rules)
 	}
 
 	return rows.Err()
@@ -139,18 +160,18 @@ func (pc *ProxyController) GetConfig(appName string) (*ProxyControlConfig, error
 	var enabled int
 	var proxyMode string
 	var proxyPort sql.NullInt64
-	var interceptDomains sql.NullString
+	var interceptDomains, rules sql.NullString
 	var lastRequestAt, lastToggledAt sql.NullTime
 
 	err := pc.db.QueryRow(`
 		SELECT app_name, proxy_enabled, proxy_mode, proxy_port,
-		       intercept_domains, total_requests, last_request_at,
+		       intercept_domains, rules, total_requests, last_request_at,
 		       last_toggled_at, created_at
 		FROM proxy_control
 		WHERE app_name = ?
 	`, appName).Scan(
 		&config.AppName, &enabled, &proxyMode, &proxyPort,
-		&interceptDomains, &config.TotalRequests, &lastRequestAt,
+		&interceptDomains, &rules, &config.TotalRequests, &lastRequestAt,
 		&lastToggledAt, &config.CreatedAt,
 	)
 
@@ -173,6 +194,7 @@ func (pc *ProxyController) GetConfig(appName string) (*ProxyControlConfig, error
 			return nil, fmt.Errorf("failed to parse intercept domains: %w", err)
 		}
 	}
+	config.Rules = parseProxyRules(rules)
 
 	if lastRequestAt.Valid {
 		config.LastRequestAt = &lastRequestAt.Time
@@ -193,7 +215,7 @@ func (pc *ProxyController) GetAllConfigs() ([]ProxyControlConfig, error) {
 
 	rows, err := pc.db.Query(`
 		SELECT app_name, proxy_enabled, proxy_mode, proxy_port,
-		       intercept_domains, total_requests, last_request_at,
+		       intercept_domains, rules, total_requests, last_request_at,
 		       last_toggled_at, created_at
 		FROM proxy_control
 		ORDER BY app_name
@@ -210,12 +232,12 @@ func (pc *ProxyController) GetAllConfigs() ([]ProxyControlConfig, error) {
 		var enabled int
 		var proxyMode string
 		var proxyPort sql.NullInt64
-		var interceptDomains sql.NullString
+		var interceptDomains, rules sql.NullString
 		var lastRequestAt, lastToggledAt sql.NullTime
 
 		err := rows.Scan(
 			&config.AppName, &enabled, &proxyMode, &proxyPort,
-			&interceptDomains, &config.TotalRequests, &lastRequestAt,
+			&interceptDomains, &rules, &config.TotalRequests, &lastRequestAt,
 			&lastToggledAt, &config.CreatedAt,
 		)
 		if err != nil {
@@ -232,6 +254,7 @@ func (pc *ProxyController) GetAllConfigs() ([]ProxyControlConfig, error) {
 		if interceptDomains.Valid && interceptDomains.String != "" {
 			json.Unmarshal([]byte(interceptDomains.String), &config.InterceptDomains)
 		}
+		config.Rules = parseProxyRules(rules)
 
 		if lastRequestAt.Valid {
 			config.LastRequestAt = &lastRequestAt.Time
@@ -247,19 +270,21 @@ func (pc *ProxyController) GetAllConfigs() ([]ProxyControlConfig, error) {
 	return configs, rows.Err()
 }
 
-// RecordRequest records a proxy request for an app
+// RecordRequest records a proxy request for an app.
+// Newly fingerprinted apps get a row so they show up in the per-app stats.
 func (pc *ProxyController) RecordRequest(appName string) error {
 	appName = normalizeAppName(appName)
 
-	if pc.db == nil {
+	if pc.db == nil || appName == "" || appName == ClientAppUnknown {
 		return nil // Silently fail if DB not initialized
 	}
 
 	_, err := pc.db.Exec(`
-		UPDATE proxy_control
-		SET total_requests = total_requests + 1,
+		INSERT INTO proxy_control (app_name, proxy_enabled, total_requests, last_request_at)
+		VALUES (?, 1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT(app_name) DO UPDATE SET
+		    total_requests = total_requests + 1,
 		    last_request_at = CURRENT_TIMESTAMP
-		WHERE app_name = ?
 	`, appName)
 
 	return err
@@ -275,6 +300,9 @@ func (pc *ProxyController) UpdateConfig(config ProxyControlConfig) error {
 	if pc.db == nil {
 		return fmt.Errorf("database not initialized")
 	}
+	if err := config.Rules.Validate(); err != nil {
+		return fmt.Errorf("invalid proxy rules: %w", err)
+	}
 
 	// Serialize intercept domains
 	var interceptDomainsJSON string
@@ -305,6 +333,9 @@ func (pc *ProxyController) UpdateConfig(config ProxyControlConfig) error {
 	// Update cache
 	pc.cache[appName] = config.ProxyEnabled
 
+	if config.Rules != nil {
+		return pc.saveRules(appName, config.Rules)
+	}
 	return nil
 }
 
@@ -320,6 +351,11 @@ func (pc *ProxyController) GetStats() (map[string]ProxyControlStats, error) {
 		return nil, err
 	}
 
+	hits, err := pc.ruleHits()
+	if err != nil {
+		return nil, err
+	}
+
 	stats := make(map[string]ProxyControlStats)
 	for _, config := range configs {
 		stats[config.AppName] = ProxyControlStats{
@@ -327,6 +363,8 @@ func (pc *ProxyController) GetStats() (map[string]ProxyControlStats, error) {
 			Enabled:       config.ProxyEnabled,
 			TotalRequests: config.TotalRequests,
 			LastRequestAt: config.LastRequestAt,
+			RuleHits:      hits[config.AppName],
+			DailyCost:     pc.DailyCost(config.AppName),
 		}
 	}
 
@@ -335,10 +373,260 @@ func (pc *ProxyController) GetStats() (map[string]ProxyControlStats, error) {
 
 // ProxyControlStats holds statistics for an app
 type ProxyControlStats struct {
-	AppName       string     `json:"app_name"`
-	Enabled       bool       `json:"enabled"`
-	TotalRequests int64      `json:"total_requests"`
-	LastRequestAt *time.Time `json:"last_request_at,omitempty"`
+	AppName       string           `json:"app_name"`
+	Enabled       bool             `json:"enabled"`
+	TotalRequests int64            `json:"total_requests"`
+	LastRequestAt *time.Time       `json:"last_request_at,omitempty"`
+	RuleHits      map[string]int64 `json:"rule_hits,omitempty"` // Rejected requests per rule
+	DailyCost     float64          `json:"daily_cost"`          // USD relayed today
+}
+
+// ensureSchema adds the rules column and the rule hit table to databases created before request rules
+func (pc *ProxyController) ensureSchema() error {
+	if pc.db == nil {
+		return nil
+	}
+
+	var count int
+	if err := pc.db.QueryRow(
+		"SELECT COUNT(*) FROM pragma_table_info('proxy_control') WHERE name = 'rules'",
+	).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		if _, err := pc.db.Exec("ALTER TABLE proxy_control ADD COLUMN rules TEXT"); err != nil {
+			return err
+		}
+	}
+	_, err := pc.db.Exec(`
+		CREATE TABLE IF NOT EXISTS proxy_rule_hits (
+			app_name TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			hits INTEGER DEFAULT 0,
+			last_hit_at DATETIME,
+			PRIMARY KEY (app_name, rule)
+		)
+	`)
+	return err
+}
+
+// GetRules returns the request rules of an app, nil when none are set
+func (pc *ProxyController) GetRules(appName string) *ProxyRules {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.rules[normalizeAppName(appName)]
+}
+
+// SetRules validates and stores the request rules of an app; nil or empty rules remove all restrictions
+func (pc *ProxyController) SetRules(appName string, rules *ProxyRules) error {
+	appName = normalizeAppName(appName)
+	if err := rules.Validate(); err != nil {
+		return fmt.Errorf("invalid proxy rules: %w", err)
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	// Make sure the app has a row, as ToggleProxy does
+	if _, err := pc.db.Exec(`
+		INSERT OR IGNORE INTO proxy_control (app_name, proxy_enabled)
+		VALUES (?, 1)
+	`, appName); err != nil {
+		return fmt.Errorf("failed to create proxy control: %w", err)
+	}
+	return pc.saveRules(appName, rules)
+}
+
+// saveRules writes rules to the database and the cache; the caller holds pc.mu
+func (pc *ProxyController) saveRules(appName string, rules *ProxyRules) error {
+	var value sql.NullString
+	if !rules.IsEmpty() {
+		data, err := json.Marshal(rules)
+		if err != nil {
+			return fmt.Errorf("failed to marshal proxy rules: %w", err)
+		}
+		value = sql.NullString{String: string(data), Valid: true}
+	}
+
+	if _, err := pc.db.Exec("UPDATE proxy_control SET rules = ? WHERE app_name = ?", value, appName); err != nil {
+		return fmt.Errorf("failed to update proxy rules: %w", err)
+	}
+	if rules.IsEmpty() {
+		delete(pc.rules, appName)
+	} else {
+		pc.rules[appName] = rules
+	}
+	return nil
+}
+
+// Evaluate checks a request of an app against its proxy switch and rules.
+// It returns nil when the request may be relayed; rejections are counted per rule.
+func (pc *ProxyController) Evaluate(appName, path, model string, now time.Time) *ProxyRuleViolation {
+	appName = normalizeAppName(appName)
+
+	pc.mu.RLock()
+	enabled, known := pc.cache[appName]
+	rules := pc.rules[appName]
+	pc.mu.RUnlock()
+
+	// Unknown apps are enabled, as in IsProxyEnabled
+	var violation *ProxyRuleViolation
+	if known && !enabled {
+		violation = &ProxyRuleViolation{Rule: ProxyRuleDisabled, Status: http.StatusServiceUnavailable,
+			Message: fmt.Sprintf("proxy is disabled for %s", appName)}
+	} else {
+		violation = rules.check(path, model, now)
+	}
+	if violation == nil && rules != nil && rules.MaxDailyCost > 0 {
+		if spent := pc.dailyCostAt(appName, now); spent >= rules.MaxDailyCost {
+			violation = &ProxyRuleViolation{Rule: ProxyRuleDailyCost, Status: http.StatusTooManyRequests,
+				Message: fmt.Sprintf("daily cost limit $%.2f reached ($%.2f spent today)", rules.MaxDailyCost, spent)}
+		}
+	}
+
+	if violation != nil {
+		go pc.recordRuleHit(appName, violation.Rule)
+	}
+	return violation
+}
+
+// RecordCost adds the cost of a relayed request to the app's spend of the current day
+func (pc *ProxyController) RecordCost(appName string, cost float64) {
+	if cost <= 0 {
+		return
+	}
+	appName = normalizeAppName(appName)
+
+	pc.costMu.Lock()
+	defer pc.costMu.Unlock()
+	pc.rollCostDay(time.Now())
+	pc.dailyCost[appName] += cost
+}
+
+// DailyCost returns the app's spend of the current day in USD
+func (pc *ProxyController) DailyCost(appName string) float64 {
+	return pc.dailyCostAt(normalizeAppName(appName), time.Now())
+}
+
+func (pc *ProxyController) dailyCostAt(appName string, now time.Time) float64 {
+	pc.costMu.Lock()
+	defer pc.costMu.Unlock()
+	pc.rollCostDay(now)
+	return pc.dailyCost[appName]
+}
+
+// rollCostDay resets the totals when the local day changes; the caller holds pc.costMu
+func (pc *ProxyController) rollCostDay(now time.Time) {
+	day := now.Format("2006-01-02")
+	if pc.costDay != day {
+		pc.costDay = day
+		pc.dailyCost = make(map[string]float64)
+	}
+}
+
+// seedDailyCost restores today's per-app spend from request_log. Best effort: the log
+// table may not exist yet.
+func (pc *ProxyController) seedDailyCost(now time.Time) {
+	if pc.db == nil {
+		return
+	}
+
+	year, month, day := now.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+
+	rows, err := pc.db.Query(`
+		SELECT COALESCE(app_name, ''), COALESCE(user_agent, ''), COALESCE(request_path, ''), COALESCE(total_cost, 0)
+		FROM request_log
+		WHERE created_at >= ?
+	`, midnight.UTC().Format(timeLayout))
+	if err != nil {
+		if !isNoSuchTableErr(err) {
+			fmt.Printf("[ProxyControl] Failed to load today's cost: %v\n", err)
+		}
+		return
+	}
+	defer rows.Close()
+
+	pc.costMu.Lock()
+	defer pc.costMu.Unlock()
+	pc.rollCostDay(now)
+	for rows.Next() {
+		var app, userAgent, path string
+		var cost float64
+		if err := rows.Scan(&app, &userAgent, &path, &cost); err != nil {
+			return
+		}
+		// Rows logged before fingerprinting have no app_name
+		if app == "" {
+			app = detectApp(userAgent, path)
+		}
+		if cost > 0 {
+			pc.dailyCost[normalizeAppName(app)] += cost
+		}
+	}
+}
+
+// recordRuleHit counts a rejection of an app by a rule
+func (pc *ProxyController) recordRuleHit(appName, rule string) {
+	if pc.db == nil {
+		return
+	}
+
+	pc.hitMu.Lock()
+	defer pc.hitMu.Unlock()
+	_, err := pc.db.Exec(`
+		INSERT INTO proxy_rule_hits (app_name, rule, hits, last_hit_at)
+		VALUES (?, ?, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT(app_name, rule) DO UPDATE SET
+			hits = hits + 1,
+			last_hit_at = CURRENT_TIMESTAMP
+	`, appName, rule)
+	if err != nil {
+		fmt.Printf("[ProxyControl] Failed to record rule hit: %v\n", err)
+	}
+}
+
+// ruleHits returns the rejection counts per app and rule
+func (pc *ProxyController) ruleHits() (map[string]map[string]int64, error) {
+	hits := make(map[string]map[string]int64)
+	if pc.db == nil {
+		return hits, nil
+	}
+
+	rows, err := pc.db.Query("SELECT app_name, rule, hits FROM proxy_rule_hits")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rule hits: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var appName, rule string
+		var count int64
+		if err := rows.Scan(&appName, &rule, &count); err != nil {
+			return nil, err
+		}
+		if hits[appName] == nil {
+			hits[appName] = make(map[string]int64)
+		}
+		hits[appName][rule] = count
+	}
+	return hits, rows.Err()
+}
+
+// parseProxyRules decodes the rules column; unreadable rules are treated as none
+func parseProxyRules(value sql.NullString) *ProxyRules {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var rules ProxyRules
+	if err := json.Unmarshal([]byte(value.String), &rules); err != nil || rules.IsEmpty() {
+		return nil
+	}
+	return &rules
 }
 
 // Helper functions
@@ -355,6 +643,10 @@ func normalizeAppName(name string) string {
 		return "gemini"
 	case "picoclaw", "pico-claw", "pico_claw", "pico":
 		return "picoclaw"
+	case "opencode", "open-code", "open_code":
+		return "opencode"
+	case "cline", "roo-cline":
+		return "cline"
 	default:
 		return name
 	}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Proxy rule names, used as rejection types and as keys of the per-rule hit statistics
+const (
+	ProxyRuleDisabled        = "proxy_disabled"
+	ProxyRulePathBlocked     = "path_blocked"
+	ProxyRulePathNotAllowed  = "path_not_allowed"
+	ProxyRuleOutsideWindow   = "outside_time_window"
+	ProxyRuleModelNotAllowed = "model_not_allowed"
+	ProxyRuleDailyCost       = "daily_cost_exceeded"
+)
+
+// ProxyRules per-application request rules, evaluated before a request is relayed.
+// Empty fields do not restrict anything.
+type ProxyRules struct {
+	AllowedModels []string          `json:"allowed_models,omitempty"` // Model names, * wildcard allowed
+	TimeWindows   []ProxyTimeWindow `json:"time_windows,omitempty"`   // Requests only inside one of the windows (local time)
+	MaxDailyCost  float64           `json:"max_daily_cost,omitempty"` // USD per local day, 0 = unlimited
+	BlockedPaths  []string          `json:"blocked_paths,omitempty"`  // Path prefixes, or patterns with *
+	AllowedPaths  []string          `json:"allowed_paths,omitempty"`  // When set, only matching paths are relayed
+	ProviderGroup string            `json:"provider_group,omitempty"` // Route the app's requests to this provider group
+}
+
+// ProxyTimeWindow a daily working-hours window, e.g. 09:00-18:00 on weekdays.
+// End before Start wraps past midnight (22:00-06:00).
+type ProxyTimeWindow struct {
+	Days  []int  `json:"days,omitempty"` // 0=Sunday ... 6=Saturday, empty = every day
+	Start string `json:"start"`          // HH:MM
+	End   string `json:"end"`            // HH:MM
+}
+
+// ProxyRuleViolation describes why a request was rejected
+type ProxyRuleViolation struct {
+	Rule    string `json:"rule"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// IsEmpty reports whether the rules restrict nothing
+func (r *ProxyRules) IsEmpty() bool {
+	return r == nil || (len(r.AllowedModels) == 0 && len(r.TimeWindows) == 0 &&
+		r.MaxDailyCost <= 0 && len(r.BlockedPaths) == 0 && len(r.AllowedPaths) == 0 && r.ProviderGroup == "")
+}
+
+// Validate checks time formats, weekdays and limits
+func (r *ProxyRules) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxDailyCost < 0 {
+		return fmt.Errorf("max_daily_cost must not be negative")
+	}
+	for i, w := range r.TimeWindows {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return fmt.Errorf("time_windows[%d].start: %w", i, err)
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return fmt.Errorf("time_windows[%d].end: %w", i, err)
+		}
+		if start == end {
+			return fmt.Errorf("time_windows[%d]: start and end must differ", i)
+		}
+		for _, day := range w.Days {
+			if day < 0 || day > 6 {
+				return fmt.Errorf("time_windows[%d]: day %d out of range 0-6", i, day)
+			}
+		}
+	}
+	for _, pattern := range append(append([]string{}, r.BlockedPaths...), r.AllowedPaths...) {
+		if !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("path pattern %q must start with /", pattern)
+		}
+	}
+	return nil
+}
+
+// check evaluates the stateless rules in order: paths, time windows, models.
+// The daily cost limit needs the running total and is checked by ProxyController.
+func (r *ProxyRules) check(path, model string, now time.Time) *ProxyRuleViolation {
+	if r == nil {
+		return nil
+	}
+	for _, pattern := range r.BlockedPaths {
+		if matchProxyPath(pattern, path) {
+			return &ProxyRuleViolation{Rule: ProxyRulePathBlocked, Status: http.StatusForbidden,
+				Message: fmt.Sprintf("path %s is blocked for this application", path)}
+		}
+	}
+	if len(r.AllowedPaths) > 0 && !matchAnyProxyPath(r.AllowedPaths, path) {
+		return &ProxyRuleViolation{Rule: ProxyRulePathNotAllowed, Status: http.StatusForbidden,
+			Message: fmt.Sprintf("path %s is not allowed for this application", path)}
+	}
+	if len(r.TimeWindows) > 0 && !inAnyTimeWindow(r.TimeWindows, now) {
+		return &ProxyRuleViolation{Rule: ProxyRuleOutsideWindow, Status: http.StatusForbidden,
+			Message: "requests are only allowed during the configured working hours"}
+	}
+	// Requests without a model cannot be matched against the list and are let through
+	if len(r.AllowedModels) > 0 && model != "" && !matchAnyModel(r.AllowedModels, model) {
+		return &ProxyRuleViolation{Rule: ProxyRuleModelNotAllowed, Status: http.StatusForbidden,
+			Message: fmt.Sprintf("model %s is not allowed for this application", model)}
+	}
+	return nil
+}
+
+// matchProxyPath patterns without * match as prefixes, /v1/messages also matches /v1/messages/count_tokens
+func matchProxyPath(pattern, path string) bool {
+	if strings.Contains(pattern, "*") {
+		return matchWildcard(pattern, path)
+	}
+	return strings.HasPrefix(path, pattern)
+}
+
+func matchAnyProxyPath(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matchProxyPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyModel(patterns []string, model string) bool {
+	model = strings.ToLower(model)
+	for _, pattern := range patterns {
+		if matchWildcard(strings.ToLower(strings.TrimSpace(pattern)), model) {
+			return true
+		}
+	}
+	return false
+}
+
+// inAnyTimeWindow reports whether now falls inside one of the windows.
+// A window wrapping past midnight belongs to the day it starts on.
+func inAnyTimeWindow(windows []ProxyTimeWindow, now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	today := int(now.Weekday())
+	yesterday := (today + 6) % 7
+	for _, w := range windows {
+		start, err1 := parseClock(w.Start)
+		end, err2 := parseClock(w.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if start < end {
+			if minute >= start && minute < end && windowOnDay(w.Days, today) {
+				return true
+			}
+			continue
+		}
+		// Overnight: the evening part belongs to today, the early morning part to yesterday
+		if (minute >= start && windowOnDay(w.Days, today)) || (minute < end && windowOnDay(w.Days, yesterday)) {
+			return true
+		}
+	}
+	return false
+}
+
+func windowOnDay(days []int, day int) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses HH:MM into minutes after midnight; 24:00 is accepted as the end of the day
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInAnyTimeWindow(t *testing.T) {
+	weekdays := []ProxyTimeWindow{{Days: []int{1, 2, 3, 4, 5}, Start: "09:00", End: "18:00"}}
+	overnight := []ProxyTimeWindow{{Days: []int{5}, Start: "22:00", End: "06:00"}}
+
+	// 2026-10-16 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local)
+	}
+
+	cases := []struct {
+		name    string
+		windows []ProxyTimeWindow
+		now     time.Time
+		want    bool
+	}{
+		{"weekday inside", weekdays, at(16, 9, 0), true},
+		{"weekday end is exclusive", weekdays, at(16, 18, 0), false},
+		{"weekday before start", weekdays, at(16, 8, 59), false},
+		{"saturday", weekdays, at(17, 10, 0), false},
+		{"friday evening", overnight, at(16, 23, 30), true},
+		{"saturday early morning belongs to friday", overnight, at(17, 5, 59), true},
+		{"friday early morning belongs to thursday", overnight, at(16, 5, 0), false},
+		{"saturday evening", overnight, at(17, 23, 0), false},
+	}
+	for _, tc := range cases {
+		if got := inAnyTimeWindow(tc.windows, tc.now); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProxyRulesCheck(t *testing.T) {
+	rules := &ProxyRules{
+		AllowedModels: []string{"claude-sonnet-*", "claude-haiku-4-5"},
+		BlockedPaths:  []string{"/v1/messages/count_tokens"},
+		AllowedPaths:  []string{"/v1/messages", "/v1/*/completions"},
+	}
+	now := time.Now()
+
+	cases := []struct {
+		path, model string
+		want        string
+	}{
+		{"/v1/messages", "claude-sonnet-4-5", ""},
+		{"/v1/messages", "Claude-Haiku-4-5", ""},
+		{"/v1/messages", "", ""},
+		{"/v1/chat/completions", "claude-sonnet-4", ""},
+		{"/v1/messages", "claude-opus-4-1", ProxyRuleModelNotAllowed},
+		{"/v1/messages/count_tokens", "claude-sonnet-4-5", ProxyRulePathBlocked},
+		{"/responses", "claude-sonnet-4-5", ProxyRulePathNotAllowed},
+	}
+	for _, tc := range cases {
+		violation := rules.check(tc.path, tc.model, now)
+		got := ""
+		if violation != nil {
+			got = violation.Rule
+			if violation.Status != http.StatusForbidden {
+				t.Errorf("%s %s: status %d", tc.path, tc.model, violation.Status)
+			}
+		}
+		if got != tc.want {
+			t.Errorf("%s %s: rule %q, want %q", tc.path, tc.model, got, tc.want)
+		}
+	}
+
+	var none *ProxyRules
+	if none.check("/v1/messages", "any", now) != nil || !none.IsEmpty() {
+		t.Error("nil rules should not restrict anything")
+	}
+}
+
+func TestProxyRulesValidate(t *testing.T) {
+	valid := &ProxyRules{
+		TimeWindows:  []ProxyTimeWindow{{Start: "22:00", End: "06:00"}, {Days: []int{0, 6}, Start: "00:00", End: "24:00"}},
+		MaxDailyCost: 5,
+		BlockedPaths: []string{"/v1/messages/count_tokens"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid rules rejected: %v", err)
+	}
+
+	invalid := map[string]*ProxyRules{
+		"negative cost": {MaxDailyCost: -1},
+		"bad clock":     {TimeWindows: []ProxyTimeWindow{{Start: "9:00", End: "18:00"}}},
+		"hour overflow": {TimeWindows: []ProxyTimeWindow{{Start: "09:00", End: "25:00"}}},
+		"empty window":  {TimeWindows: []ProxyTimeWindow{{Start: "09:00", End: "09:00"}}},
+		"bad day":       {TimeWindows: []ProxyTimeWindow{{Days: []int{7}, Start: "09:00", End: "18:00"}}},
+		"relative path": {AllowedPaths: []string{"v1/messages"}},
+	}
+	for name, rules := range invalid {
+		if err := rules.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestProxyController_Rules(t *testing.T) {
+	db, cleanup := setupTestDBForProxyControl(t)
+	defer cleanup()
+	// Rule hits are written in the background; one connection avoids SQLITE_BUSY without a busy timeout
+	db.SetMaxOpenConns(1)
+
+	pc, err := NewProxyController(db)
+	if err != nil {
+		t.Fatalf("Failed to create ProxyController: %v", err)
+	}
+
+	rules := &ProxyRules{AllowedModels: []string{"claude-sonnet-*"}, MaxDailyCost: 1}
+	if err := pc.SetRules("claude-code", rules); err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+	if err := pc.SetRules("claude", &ProxyRules{MaxDailyCost: -1}); err == nil {
+		t.Fatal("invalid rules should be rejected")
+	}
+
+	// Rules survive a reload and show up in the config
+	reloaded, err := NewProxyController(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := reloaded.GetConfig("claude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Rules == nil || config.Rules.MaxDailyCost != 1 || len(config.Rules.AllowedModels) != 1 {
+		t.Fatalf("rules = %+v", config.Rules)
+	}
+
+	now := time.Now()
+	if v := pc.Evaluate("claude", "/v1/messages", "claude-sonnet-4-5", now); v != nil {
+		t.Fatalf("allowed request rejected: %+v", v)
+	}
+	if v := pc.Evaluate("claude", "/v1/messages", "claude-opus-4-1", now); v == nil || v.Rule != ProxyRuleModelNotAllowed {
+		t.Fatalf("violation = %+v, want model_not_allowed", v)
+	}
+
+	// Spend reaches the limit
+	pc.RecordCost("claude", 0.6)
+	pc.RecordCost("claude", 0.4)
+	pc.RecordCost("codex", 3)
+	v := pc.Evaluate("claude", "/v1/messages", "claude-sonnet-4-5", now)
+	if v == nil || v.Rule != ProxyRuleDailyCost || v.Status != http.StatusTooManyRequests {
+		t.Fatalf("violation = %+v, want daily_cost_exceeded", v)
+	}
+	if v := pc.Evaluate("codex", "/responses", "gpt-5", now); v != nil {
+		t.Fatalf("codex has no rules, got %+v", v)
+	}
+	// The limit resets on the next day
+	if v := pc.Evaluate("claude", "/v1/messages", "claude-sonnet-4-5", now.AddDate(0, 0, 1)); v != nil {
+		t.Fatalf("next day rejected: %+v", v)
+	}
+
+	if err := pc.ToggleProxy("gemini", false); err != nil {
+		t.Fatal(err)
+	}
+	if v := pc.Evaluate("gemini", "/v1beta/models/x", "", now); v == nil || v.Status != http.StatusServiceUnavailable {
+		t.Fatalf("violation = %+v, want proxy_disabled", v)
+	}
+
+	// Rule hits are recorded in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats, err := pc.GetStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits := stats["claude"].RuleHits
+		if hits[ProxyRuleModelNotAllowed] == 1 && hits[ProxyRuleDailyCost] == 1 && stats["gemini"].RuleHits[ProxyRuleDisabled] == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rule hits = %v / %v", hits, stats["gemini"].RuleHits)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Empty rules clear the restrictions
+	if err := pc.SetRules("claude", &ProxyRules{}); err != nil {
+		t.Fatal(err)
+	}
+	if pc.GetRules("claude") != nil {
+		t.Error("empty rules should be removed")
+	}
+}
+
+func TestProxyController_SeedDailyCost(t *testing.T) {
+	db, cleanup := setupTestDBForProxyControl(t)
+	defer cleanup()
+
+	if _, err := db.Exec(`CREATE TABLE request_log (
+		app_name TEXT, user_agent TEXT, request_path TEXT, total_cost REAL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	yesterday := time.Now().AddDate(0, 0, -1).UTC().Format(timeLayout)
+	// Rows without app_name predate fingerprinting and are detected from the User-Agent and path
+	if _, err := db.Exec(`INSERT INTO request_log (app_name, user_agent, request_path, total_cost, created_at) VALUES
+		('claude', 'claude-cli/2.0', '/v1/messages', 0.25, CURRENT_TIMESTAMP),
+		(NULL, '', '/responses', 0.5, CURRENT_TIMESTAMP),
+		('cursor', 'Mozilla/5.0', '/v1/chat/completions', 1.5, CURRENT_TIMESTAMP),
+		('claude', 'claude-cli/2.0', '/v1/messages', 9, ?)`, yesterday); err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := NewProxyController(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pc.DailyCost("claude"); got != 0.25 {
+		t.Errorf("claude daily cost = %v, want 0.25", got)
+	}
+	if got := pc.DailyCost("codex"); got != 0.5 {
+		t.Errorf("codex daily cost = %v, want 0.5", got)
+	}
+	if got := pc.DailyCost("cursor"); got != 1.5 {
+		t.Errorf("cursor daily cost = %v, want 1.5", got)
+	}
+}
@@ -0,0 +1,103 @@
+package relayplugin
+
+import (
+	"errors"
+	"io"
+	"net/rpc"
+	"os/exec"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+)
+
+// ErrTimeout 插件在超时时间内没有响应
+var ErrTimeout = errors.New("relay plugin call timed out")
+
+// Client 宿主侧的插件连接
+type Client struct {
+	plugin *plugin.Client
+	rpc    *rpc.Client
+}
+
+// Start 通过 go-plugin 启动插件进程并完成握手；插件的日志与 stdout / stderr 输出写入 logs。
+// startTimeout 内没有完成握手时结束插件进程
+func Start(cmd *exec.Cmd, logs io.Writer, startTimeout time.Duration) (*Client, error) {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          plugin.PluginSet{pluginName: &relayPlugin{}},
+		Cmd:              cmd,
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolNetRPC},
+		StartTimeout:     startTimeout,
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:        "plugin",
+			Output:      logs,
+			Level:       hclog.Info,
+			DisableTime: true,
+		}),
+		Stderr:     logs,
+		SyncStdout: logs,
+		SyncStderr: logs,
+	})
+	protocol, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	raw, err := protocol.Dispense(pluginName)
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	return &Client{plugin: client, rpc: raw.(*rpc.Client)}, nil
+}
+
+// Describe 获取插件描述
+func (c *Client) Describe(timeout time.Duration) (Info, error) {
+	var info Info
+	if err := c.call("Describe", new(interface{}), &info, timeout); err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// InterceptRequest 调用插件的请求拦截器
+func (c *Client) InterceptRequest(req *Request, timeout time.Duration) (*RequestResult, error) {
+	result := &RequestResult{}
+	if err := c.call("InterceptRequest", req, result, timeout); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// InterceptResponse 调用插件的响应拦截器
+func (c *Client) InterceptResponse(resp *Response, timeout time.Duration) (*ResponseResult, error) {
+	result := &ResponseResult{}
+	if err := c.call("InterceptResponse", resp, result, timeout); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Exited 插件进程是否已退出
+func (c *Client) Exited() bool {
+	return c.plugin.Exited()
+}
+
+// Close 结束插件进程：先正常关闭连接，插件未及时退出时由 go-plugin 强制结束
+func (c *Client) Close() {
+	c.plugin.Kill()
+}
+
+// call 发起带超时的 RPC 调用；超时后迟到的结果写入已丢弃的 reply，不影响调用方
+func (c *Client) call(method string, args, reply interface{}, timeout time.Duration) error {
+	call := c.rpc.Go("Plugin."+method, args, reply, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
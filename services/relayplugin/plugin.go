@@ -0,0 +1,180 @@
+// Package relayplugin 定义中继插件：插件是基于 HashiCorp go-plugin 的独立 Go 可执行文件，
+// 放在 ~/.code-switch/plugins 目录下，启动时由 CodeSwitch 拉起，经 go-plugin 的握手与 net/rpc 传输
+// 在转发管线中拦截请求与响应。解释执行的改写逻辑请使用请求脚本（~/.code-switch/scripts，见 luascript）。
+//
+// 插件只需实现 RequestInterceptor 和/或 ResponseInterceptor 并在 main 中调用 Serve：
+//
+//	func main() {
+//		relayplugin.Serve(relayplugin.Info{Name: "redact"}, redactor{})
+//	}
+package relayplugin
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"os"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+// Handshake go-plugin 握手配置：宿主通过环境变量传入 magic cookie，防止插件被直接运行；
+// 协议版本不一致时插件无法加载
+var Handshake = plugin.HandshakeConfig{
+	ProtocolVersion:  2,
+	MagicCookieKey:   "CODESWITCH_PLUGIN_MAGIC_COOKIE",
+	MagicCookieValue: "b7f1c0d4-relay-plugin",
+}
+
+// 插件支持的拦截点
+const (
+	HookRequest  = "request"
+	HookResponse = "response"
+)
+
+// pluginName 插件在 go-plugin 插件集中的名称
+const pluginName = "relay"
+
+// ErrNotLaunchedByHost 插件没有由 CodeSwitch 拉起
+var ErrNotLaunchedByHost = errors.New("relay plugin must be started by CodeSwitch")
+
+// Info 插件描述，Describe 时返回给宿主
+type Info struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version,omitempty"`
+	Platforms []string `json:"platforms,omitempty"` // 为空时拦截所有平台
+	Hooks     []string `json:"hooks,omitempty"`     // 由 Serve 按实现的接口填充
+}
+
+// Request 发往上游之前的请求；Headers 不包含 provider 凭据
+type Request struct {
+	Platform string            `json:"platform"`
+	Provider string            `json:"provider"`
+	Model    string            `json:"model"`
+	Endpoint string            `json:"endpoint"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     string            `json:"body"`
+}
+
+// Rejection 拦截器拒绝请求时返回给客户端的状态码与错误信息
+type Rejection struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// RequestResult 请求拦截结果：Body 为 nil 时不改写；Headers 中值为空表示删除该请求头
+type RequestResult struct {
+	Body    *string           `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Reject  *Rejection        `json:"reject,omitempty"`
+}
+
+// Response 上游返回的成功非流式响应
+type Response struct {
+	Platform string            `json:"platform"`
+	Provider string            `json:"provider"`
+	Model    string            `json:"model"`
+	Status   int               `json:"status"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     string            `json:"body"`
+}
+
+// ResponseResult 响应拦截结果：Body 为 nil 时不改写；Headers 中值为空表示删除该响应头
+type ResponseResult struct {
+	Body    *string           `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// RequestInterceptor 请求拦截器；返回 nil 表示不做修改
+type RequestInterceptor interface {
+	InterceptRequest(req *Request) (*RequestResult, error)
+}
+
+// ResponseInterceptor 响应拦截器；返回 nil 表示不做修改
+type ResponseInterceptor interface {
+	InterceptResponse(resp *Response) (*ResponseResult, error)
+}
+
+// Describe 按 impl 实现的接口补全 Info
+func Describe(info Info, impl interface{}) Info {
+	info.Hooks = nil
+	if _, ok := impl.(RequestInterceptor); ok {
+		info.Hooks = append(info.Hooks, HookRequest)
+	}
+	if _, ok := impl.(ResponseInterceptor); ok {
+		info.Hooks = append(info.Hooks, HookResponse)
+	}
+	return info
+}
+
+// Serve 通过 go-plugin 提供插件服务，直到宿主结束插件进程。
+// 插件中写到 os.Stdout / os.Stderr 的内容由 go-plugin 转发给宿主记录到日志，不会破坏协议
+func Serve(info Info, impl interface{}) error {
+	if os.Getenv(Handshake.MagicCookieKey) != Handshake.MagicCookieValue {
+		fmt.Fprintln(os.Stderr, "This binary is a CodeSwitch relay plugin. Copy it to ~/.code-switch/plugins instead of running it directly.")
+		return ErrNotLaunchedByHost
+	}
+	info = Describe(info, impl)
+	if len(info.Hooks) == 0 {
+		return fmt.Errorf("plugin %s implements neither RequestInterceptor nor ResponseInterceptor", info.Name)
+	}
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         plugin.PluginSet{pluginName: &relayPlugin{info: info, impl: impl}},
+	})
+	return nil
+}
+
+// relayPlugin go-plugin 的 net/rpc 插件定义：插件进程中提供 rpcServer，宿主进程中得到 rpcClient
+type relayPlugin struct {
+	info Info
+	impl interface{}
+}
+
+func (p *relayPlugin) Server(*plugin.MuxBroker) (interface{}, error) {
+	return &rpcServer{info: p.info, impl: p.impl}, nil
+}
+
+func (p *relayPlugin) Client(_ *plugin.MuxBroker, client *rpc.Client) (interface{}, error) {
+	return client, nil
+}
+
+// rpcServer 把 RPC 调用分发给插件实现
+type rpcServer struct {
+	info Info
+	impl interface{}
+}
+
+// Describe 返回插件描述
+func (s *rpcServer) Describe(_ interface{}, info *Info) error {
+	*info = s.info
+	return nil
+}
+
+// InterceptRequest 调用请求拦截器
+func (s *rpcServer) InterceptRequest(req Request, result *RequestResult) error {
+	interceptor, ok := s.impl.(RequestInterceptor)
+	if !ok {
+		return nil
+	}
+	out, err := interceptor.InterceptRequest(&req)
+	if err != nil || out == nil {
+		return err
+	}
+	*result = *out
+	return nil
+}
+
+// InterceptResponse 调用响应拦截器
+func (s *rpcServer) InterceptResponse(resp Response, result *ResponseResult) error {
+	interceptor, ok := s.impl.(ResponseInterceptor)
+	if !ok {
+		return nil
+	}
+	out, err := interceptor.InterceptResponse(&resp)
+	if err != nil || out == nil {
+		return err
+	}
+	*result = *out
+	return nil
+}
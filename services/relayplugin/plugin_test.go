@@ -0,0 +1,150 @@
+package relayplugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServeEnv 设置后测试二进制作为插件运行
+const testServeEnv = "RELAYPLUGIN_TEST_SERVE"
+
+type upperPlugin struct{}
+
+func (upperPlugin) InterceptRequest(req *Request) (*RequestResult, error) {
+	// 插件打印到 stdout 的内容不能破坏协议
+	fmt.Println("intercepting", req.Provider)
+	if strings.Contains(req.Body, "forbidden") {
+		return &RequestResult{Reject: &Rejection{Status: 403, Message: "blocked by test"}}, nil
+	}
+	if req.Headers["X-Sleep"] != "" {
+		time.Sleep(time.Second)
+	}
+	body := strings.ToUpper(req.Body)
+	return &RequestResult{Body: &body, Headers: map[string]string{"X-Plugin": req.Provider, "X-Drop": ""}}, nil
+}
+
+func (upperPlugin) InterceptResponse(resp *Response) (*ResponseResult, error) {
+	if resp.Status != 200 {
+		return nil, errors.New("unexpected status")
+	}
+	return nil, nil
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testServeEnv) == "1" {
+		if err := Serve(Info{Name: "upper", Platforms: []string{"claude"}}, upperPlugin{}); err != nil {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// syncBuffer 并发安全的日志缓冲
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func startTestPlugin(t *testing.T, logs io.Writer) *Client {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), testServeEnv+"=1")
+	client, err := Start(cmd, logs, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestPluginRoundTrip(t *testing.T) {
+	logs := &syncBuffer{}
+	client := startTestPlugin(t, logs)
+
+	info, err := client.Describe(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "upper" || strings.Join(info.Hooks, ",") != "request,response" || info.Platforms[0] != "claude" {
+		t.Fatalf("info = %+v", info)
+	}
+
+	result, err := client.InterceptRequest(&Request{Provider: "p1", Body: `{"a":"b"}`}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Body == nil || *result.Body != `{"A":"B"}` || result.Headers["X-Plugin"] != "p1" || result.Reject != nil {
+		t.Fatalf("result = %+v", result)
+	}
+	// 值为空的请求头表示删除，编码时不能丢失
+	if value, ok := result.Headers["X-Drop"]; !ok || value != "" {
+		t.Fatalf("result = %+v", result)
+	}
+
+	rejected, err := client.InterceptRequest(&Request{Body: "forbidden"}, 5*time.Second)
+	if err != nil || rejected.Reject == nil || rejected.Reject.Status != 403 {
+		t.Fatalf("rejected = %+v, %v", rejected, err)
+	}
+
+	unchanged, err := client.InterceptResponse(&Response{Status: 200, Body: "{}"}, 5*time.Second)
+	if err != nil || unchanged.Body != nil {
+		t.Fatalf("unchanged = %+v, %v", unchanged, err)
+	}
+	if _, err := client.InterceptResponse(&Response{Status: 500}, 5*time.Second); err == nil || !strings.Contains(err.Error(), "unexpected status") {
+		t.Fatalf("plugin error = %v", err)
+	}
+
+	// 插件写到 stdout 的内容经 go-plugin 转发到宿主日志
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "intercepting p1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin stdout not forwarded, logs = %q", logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPluginTimeoutAndExit(t *testing.T) {
+	client := startTestPlugin(t, io.Discard)
+
+	if _, err := client.InterceptRequest(&Request{Headers: map[string]string{"X-Sleep": "1"}}, 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	// 超时不影响后续调用
+	if _, err := client.Describe(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Close()
+	if !client.Exited() {
+		t.Fatal("plugin should exit once the host closes it")
+	}
+}
+
+func TestServeRequiresHost(t *testing.T) {
+	t.Setenv(Handshake.MagicCookieKey, "")
+	if err := Serve(Info{Name: "x"}, upperPlugin{}); !errors.Is(err, ErrNotLaunchedByHost) {
+		t.Fatalf("err = %v", err)
+	}
+}
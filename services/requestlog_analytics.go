@@ -0,0 +1,105 @@
+package services
+
+import (
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// analyticsConn 日志查询 / 统计专用的只读连接池。
+// 看板的大范围聚合查询走这个连接池，不再占用写入队列所在的 default 连接池；
+// WAL 模式下读事务不阻塞写入，日志入库不会因为看板刷新而排队。
+const analyticsConn = "analytics"
+
+// analyticsWriter 只读连接池打开时对应的 default 连接池；default 被重新初始化（指向别的数据库）后只读连接池随之失效
+var analyticsWriter atomic.Pointer[sql.DB]
+
+// analyticsDBConfig 只读连接池配置：
+//   - query_only 拒绝任何写入，误用时直接报错而不是与写入队列争锁
+//   - busy_timeout 在 checkpoint 等短暂持锁期间等待而不是立即失败
+//   - 不使用 immutable=1：数据库仍在被写入，immutable 会跳过锁与 WAL，读到不完整的数据
+func analyticsDBConfig(dbPath string) xdb.Config {
+	return xdb.Config{
+		Name:            analyticsConn,
+		Driver:          "sqlite",
+		DSN:             dbPath + "?_pragma=busy_timeout(5000)&_pragma=query_only(1)",
+		MaxOpenConn:     4,
+		MaxIdleConn:     2,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+}
+
+// initAnalyticsDB 打开只读连接池，须在表结构迁移完成后调用（只读连接无法建表）
+func initAnalyticsDB(dbPath string) error {
+	writer, err := xdb.DB("default")
+	if err != nil {
+		return err
+	}
+	if err := xdb.Inits([]xdb.Config{analyticsDBConfig(dbPath)}); err != nil {
+		return err
+	}
+	db, err := xdb.DB(analyticsConn)
+	if err != nil {
+		return err
+	}
+	if err := db.Ping(); err != nil {
+		return err
+	}
+	analyticsWriter.Store(writer)
+	return nil
+}
+
+// analyticsPoolActive 只读连接池是否可用（未初始化：只读模式、测试）
+func analyticsPoolActive() bool {
+	writer, err := xdb.DB("default")
+	return err == nil && writer == analyticsWriter.Load()
+}
+
+// analyticsDB 返回只读查询使用的连接池；不可用时回退到 default
+func analyticsDB() (*sql.DB, error) {
+	if analyticsPoolActive() {
+		if db, err := xdb.DB(analyticsConn); err == nil {
+			return db, nil
+		}
+	}
+	return xdb.DB("default")
+}
+
+// analyticsModel 只读查询使用的 xdb 模型，连接池选择同 analyticsDB
+func analyticsModel(table string) xdb.Model {
+	if analyticsPoolActive() {
+		return xdb.New(table, xdb.WithConn(analyticsConn))
+	}
+	return xdb.New(table)
+}
+
+// DBPoolStats 连接池状态；WaitCount 持续增长说明查询在排队等待连接
+type DBPoolStats struct {
+	OpenConnections int     `json:"open_connections"`
+	InUse           int     `json:"in_use"`
+	Idle            int     `json:"idle"`
+	WaitCount       int64   `json:"wait_count"`
+	WaitMs          float64 `json:"wait_ms"`
+}
+
+// dbPoolStats 写入（default）与只读查询（analytics）连接池的状态
+func dbPoolStats() map[string]DBPoolStats {
+	pools := map[string]DBPoolStats{}
+	for _, name := range []string{"default", analyticsConn} {
+		db, err := xdb.DB(name)
+		if err != nil || (name == analyticsConn && !analyticsPoolActive()) {
+			continue
+		}
+		s := db.Stats()
+		pools[name] = DBPoolStats{
+			OpenConnections: s.OpenConnections,
+			InUse:           s.InUse,
+			Idle:            s.Idle,
+			WaitCount:       s.WaitCount,
+			WaitMs:          float64(s.WaitDuration) / float64(time.Millisecond),
+		}
+	}
+	return pools
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestAnalyticsDBReadOnlyPool(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	insertTranscriptLog(t, "trace-1", 200, 0.01, "", "")
+	if err := initAnalyticsDB(filepath.Join(os.Getenv("HOME"), "transcript.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { analyticsWriter.Store(nil) })
+
+	reader, err := analyticsDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := xdb.DB("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader == writer {
+		t.Fatal("expected a dedicated analytics pool")
+	}
+	if _, err := reader.Exec("DELETE FROM request_log"); err == nil {
+		t.Fatal("analytics pool must reject writes")
+	}
+
+	// 写事务未提交期间，统计查询仍能立即读到已提交的数据
+	tx, err := writer.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO request_log (trace_id, platform, provider, http_code) VALUES ('pending', 'claude', 'anthropic', 200)`); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	logs, err := (&LogService{}).ListRequestLogs("claude", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].ConversationID != "conv-1" {
+		t.Fatalf("expected only the committed log, got %+v", logs)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("read blocked behind the open write transaction for %v", elapsed)
+	}
+	if pools := dbPoolStats(); pools[analyticsConn].OpenConnections == 0 {
+		t.Fatalf("expected analytics pool stats, got %+v", pools)
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 成本归属请求头：客户端可按请求声明所属项目与标签
+const (
+	headerProject = "X-CS-Project"
+	headerTags    = "X-CS-Tags"
+)
+
+var errUnknownAttributionDimension = errors.New("dimension must be project, tag or app")
+
+const (
+	maxAttributionTags   = 16
+	maxAttributionLength = 64
+)
+
+// AttributionRule 按客户端 API Key 设置默认项目、标签与请求优先级（请求头未声明时生效）
+type AttributionRule struct {
+	Name     string   `json:"name"`
+	APIKey   string   `json:"api_key"` // 客户端访问网关时使用的 Key（Authorization / x-api-key / x-goog-api-key）
+	Project  string   `json:"project"`
+	Tags     []string `json:"tags"`
+	Priority string   `json:"priority,omitempty"` // interactive / batch
+}
+
+// attributionStore 当前生效的归属规则
+type attributionStore struct {
+	mu    sync.RWMutex
+	rules []AttributionRule
+}
+
+// attributionConfigPath 归属规则配置文件
+func attributionConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "attribution.json"), nil
+}
+
+// GetAttributionRules 获取按 API Key 的默认归属规则
+func (prs *ProviderRelayService) GetAttributionRules() []AttributionRule {
+	prs.attribution.mu.RLock()
+	defer prs.attribution.mu.RUnlock()
+	rules := make([]AttributionRule, len(prs.attribution.rules))
+	copy(rules, prs.attribution.rules)
+	return rules
+}
+
+// SetAttributionRules 更新归属规则并持久化
+func (prs *ProviderRelayService) SetAttributionRules(rules []AttributionRule) error {
+	cleaned := make([]AttributionRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.APIKey = strings.TrimSpace(rule.APIKey)
+		if rule.APIKey == "" {
+			continue
+		}
+		rule.Project = normalizeAttributionValue(rule.Project)
+		rule.Tags = parseAttributionTags(strings.Join(rule.Tags, ","))
+		rule.Priority = normalizePriorityClass(rule.Priority)
+		cleaned = append(cleaned, rule)
+	}
+
+	path, err := attributionConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cleaned, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// 文件包含客户端 Key，仅当前用户可读
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	prs.attribution.mu.Lock()
+	prs.attribution.rules = cleaned
+	prs.attribution.mu.Unlock()
+	return nil
+}
+
+// loadAttributionRules 启动时从 attribution.json 恢复规则
+func (prs *ProviderRelayService) loadAttributionRules() {
+	path, err := attributionConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var rules []AttributionRule
+	if err := json.Unmarshal(data, &rules); err == nil {
+		prs.attribution.mu.Lock()
+		prs.attribution.rules = rules
+		prs.attribution.mu.Unlock()
+	}
+}
+
+// resolveAttribution 计算请求的项目与标签：请求头优先，标签与 Key 默认标签合并
+func (prs *ProviderRelayService) resolveAttribution(c *gin.Context) (string, string) {
+	project := normalizeAttributionValue(c.GetHeader(headerProject))
+	tags := parseAttributionTags(c.GetHeader(headerTags))
+
+	if rule, ok := prs.matchAttributionRule(clientAPIKey(c)); ok {
+		if project == "" {
+			project = rule.Project
+		}
+		tags = parseAttributionTags(strings.Join(append(tags, rule.Tags...), ","))
+	}
+	return project, strings.Join(tags, ",")
+}
+
+// matchAttributionRule 查找客户端 Key 对应的规则
+func (prs *ProviderRelayService) matchAttributionRule(key string) (AttributionRule, bool) {
+	if key == "" {
+		return AttributionRule{}, false
+	}
+	prs.attribution.mu.RLock()
+	defer prs.attribution.mu.RUnlock()
+	for _, rule := range prs.attribution.rules {
+		if rule.APIKey == key {
+			return rule, true
+		}
+	}
+	return AttributionRule{}, false
+}
+
+// clientAPIKey 提取客户端访问网关时携带的 Key
+func clientAPIKey(c *gin.Context) string {
+	if auth := strings.TrimSpace(c.GetHeader("Authorization")); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return auth
+	}
+	if key := strings.TrimSpace(c.GetHeader("x-api-key")); key != "" {
+		return key
+	}
+	return strings.TrimSpace(c.GetHeader("x-goog-api-key"))
+}
+
+// normalizeAttributionValue 去除首尾空白与逗号并限制长度
+func normalizeAttributionValue(value string) string {
+	value = strings.TrimSpace(strings.ReplaceAll(value, ",", " "))
+	if len(value) > maxAttributionLength {
+		value = value[:maxAttributionLength]
+	}
+	return value
+}
+
+// parseAttributionTags 解析逗号分隔的标签：小写、去重、排序
+func parseAttributionTags(raw string) []string {
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for _, part := range strings.Split(raw, ",") {
+		tag := strings.ToLower(normalizeAttributionValue(part))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	if len(tags) > maxAttributionTags {
+		tags = tags[:maxAttributionTags]
+	}
+	return tags
+}
+
+// AttributionStat 按项目或标签聚合的用量
+type AttributionStat struct {
+	Key           string  `json:"key"`
+	TotalRequests int64   `json:"total_requests"`
+	InputTokens   int64   `json:"input_tokens"`
+	OutputTokens  int64   `json:"output_tokens"`
+	CacheTokens   int64   `json:"cache_tokens"`
+	CostTotal     float64 `json:"cost_total"`
+}
+
+// AttributionStats 按项目（dimension=project）、标签（dimension=tag）或客户端应用（dimension=app）统计最近 days 天的用量
+// 未声明项目的请求归入 (none)；一个请求带多个标签时计入每个标签
+func (ls *LogService) AttributionStats(dimension string, platform string, days int) ([]AttributionStat, error) {
+	if days <= 0 {
+		days = 30
+	}
+	var column string
+	switch dimension {
+	case "", "project":
+		column = "project"
+	case "tag":
+		column = "tags"
+	case "app":
+		column = "app_name"
+	default:
+		return nil, errUnknownAttributionDimension
+	}
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT COALESCE(` + column + `, ''),
+		       COUNT(*),
+		       COALESCE(SUM(input_tokens), 0),
+		       COALESCE(SUM(output_tokens), 0),
+		       COALESCE(SUM(cache_create_tokens + cache_read_tokens), 0),
+		       COALESCE(SUM(total_cost), 0)
+		FROM request_log
+		WHERE created_at >= datetime('now', ?)
+	`
+	args := []interface{}{"-" + strconv.Itoa(days) + " days"}
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query += " GROUP BY COALESCE(" + column + ", '')"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []AttributionStat{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := make(map[string]*AttributionStat)
+	for rows.Next() {
+		var raw string
+		var row AttributionStat
+		if err := rows.Scan(&raw, &row.TotalRequests, &row.InputTokens, &row.OutputTokens, &row.CacheTokens, &row.CostTotal); err != nil {
+			return nil, err
+		}
+		keys := []string{raw}
+		if column == "tags" {
+			keys = strings.Split(raw, ",")
+		}
+		for _, key := range keys {
+			if key = strings.TrimSpace(key); key == "" {
+				key = "(none)"
+			}
+			bucket := buckets[key]
+			if bucket == nil {
+				bucket = &AttributionStat{Key: key}
+				buckets[key] = bucket
+			}
+			bucket.TotalRequests += row.TotalRequests
+			bucket.InputTokens += row.InputTokens
+			bucket.OutputTokens += row.OutputTokens
+			bucket.CacheTokens += row.CacheTokens
+			bucket.CostTotal += row.CostTotal
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := make([]AttributionStat, 0, len(buckets))
+	for _, bucket := range buckets {
+		stats = append(stats, *bucket)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].CostTotal != stats[j].CostTotal {
+			return stats[i].CostTotal > stats[j].CostTotal
+		}
+		return stats[i].Key < stats[j].Key
+	})
+	return stats, nil
+}
+
+// tagMatchClause 匹配逗号分隔 tags 列中的单个标签
+func tagMatchClause() string {
+	return "(',' || COALESCE(tags, '') || ',') LIKE ?"
+}
+
+// tagMatchArg tagMatchClause 对应的参数
+func tagMatchArg(tag string) string {
+	return "%," + strings.ToLower(strings.TrimSpace(tag)) + ",%"
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAttributionTags(t *testing.T) {
+	got := parseAttributionTags(" Billing, acme ,billing,, ops ")
+	want := []string{"acme", "billing", "ops"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if tags := parseAttributionTags(""); len(tags) != 0 {
+		t.Fatalf("expected no tags, got %v", tags)
+	}
+}
+
+func TestResolveAttribution(t *testing.T) {
+	prs := &ProviderRelayService{}
+	prs.attribution.rules = []AttributionRule{
+		{Name: "acme", APIKey: "sk-acme", Project: "acme-site", Tags: []string{"client"}},
+	}
+
+	newCtx := func(headers map[string]string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+		for k, v := range headers {
+			c.Request.Header.Set(k, v)
+		}
+		return c
+	}
+
+	project, tags := prs.resolveAttribution(newCtx(map[string]string{"x-api-key": "sk-acme"}))
+	if project != "acme-site" || tags != "client" {
+		t.Fatalf("expected key defaults, got %q %q", project, tags)
+	}
+
+	project, tags = prs.resolveAttribution(newCtx(map[string]string{
+		"Authorization": "Bearer sk-acme",
+		headerProject:   "landing-page",
+		headerTags:      "Urgent",
+	}))
+	if project != "landing-page" || tags != "client,urgent" {
+		t.Fatalf("expected header override with merged tags, got %q %q", project, tags)
+	}
+
+	project, tags = prs.resolveAttribution(newCtx(map[string]string{"x-api-key": "other"}))
+	if project != "" || tags != "" {
+		t.Fatalf("expected no attribution, got %q %q", project, tags)
+	}
+}
+
+func TestTagMatchArg(t *testing.T) {
+	if got := tagMatchArg(" Client "); got != "%,client,%" {
+		t.Fatalf("unexpected pattern %q", got)
+	}
+}
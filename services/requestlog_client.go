@@ -0,0 +1,186 @@
+package services
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 归一化后的客户端应用名，写入 request_log.app_name，并作为 ProxyController 的应用键
+const (
+	ClientAppClaude   = "claude"
+	ClientAppCodex    = "codex"
+	ClientAppGemini   = "gemini"
+	ClientAppCursor   = "cursor"
+	ClientAppCline    = "cline"
+	ClientAppOpenCode = "opencode"
+	ClientAppPicoClaw = "picoclaw"
+	ClientAppScript   = "script" // SDK / curl 等自定义脚本
+	ClientAppUnknown  = "unknown"
+)
+
+// headerClientApp 客户端显式声明自身应用名（自定义脚本可借此单独统计）
+const headerClientApp = "X-CS-App"
+
+// ctxKeyClientFingerprint 缓存本次请求的识别结果，代理规则与请求日志共用
+const ctxKeyClientFingerprint = "codeswitch.client_fingerprint"
+
+// ClientFingerprint 客户端识别结果
+type ClientFingerprint struct {
+	App    string `json:"app"`    // 归一化应用名
+	Source string `json:"source"` // 命中依据：header / user_agent / shape / path
+}
+
+// clientMarker 按子串匹配的识别规则（均为小写）
+type clientMarker struct {
+	marker string
+	app    string
+}
+
+// clientUserAgentMarkers 工具自身的 User-Agent，优先于请求结构判断
+var clientUserAgentMarkers = []clientMarker{
+	{"picoclaw", ClientAppPicoClaw},
+	{"claude-cli", ClientAppClaude},
+	{"claude-code", ClientAppClaude},
+	{"codex", ClientAppCodex},
+	{"geminicli", ClientAppGemini},
+	{"gemini-cli", ClientAppGemini},
+	{"cursor", ClientAppCursor},
+	{"opencode", ClientAppOpenCode},
+	{"cline", ClientAppCline},
+}
+
+// clientTitleMarkers OpenRouter 风格的 X-Title / HTTP-Referer 请求头（Cline、OpenCode 会发送）
+var clientTitleMarkers = []clientMarker{
+	{"cline", ClientAppCline},
+	{"opencode", ClientAppOpenCode},
+	{"cursor", ClientAppCursor},
+}
+
+// clientPromptMarkers 各工具系统提示词中的固定开头
+var clientPromptMarkers = []clientMarker{
+	{"you are claude code", ClientAppClaude},
+	{"codex cli", ClientAppCodex},
+	{"you are cline", ClientAppCline},
+	{"you are opencode", ClientAppOpenCode},
+	{"gemini cli", ClientAppGemini},
+}
+
+// clientScriptMarkers 通用 HTTP 库与官方 SDK 的 User-Agent；工具常基于 SDK 实现，因此最后判断
+var clientScriptMarkers = []string{
+	"curl/", "wget/", "python-requests", "python-httpx", "python-urllib", "aiohttp", "httpie",
+	"go-http-client", "node-fetch", "axios/", "undici", "okhttp", "postman",
+	"openai/python", "openai/js", "anthropic/python", "anthropic/js",
+}
+
+// claudeUserIDPattern Claude Code 的 metadata.user_id：user_<hash>_account_<uuid>_session_<uuid>
+var claudeUserIDPattern = regexp.MustCompile(`^user_[0-9a-f]+_account_.*_session_[0-9a-fA-F-]{36}$`)
+
+// clientAppNamePattern X-CS-App 允许的取值
+var clientAppNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// clientFingerprintFor 返回请求的客户端识别结果，结果缓存在 gin context 中
+func clientFingerprintFor(c *gin.Context, body []byte) ClientFingerprint {
+	if cached, ok := c.Get(ctxKeyClientFingerprint); ok {
+		if fp, ok := cached.(ClientFingerprint); ok {
+			return fp
+		}
+	}
+	fp := fingerprintClient(c.Request.Header, c.Request.URL.Path, body)
+	c.Set(ctxKeyClientFingerprint, fp)
+	return fp
+}
+
+// fingerprintClient 依次根据显式声明、专用路由、工具请求头、User-Agent、请求结构、
+// 通用库 User-Agent、请求路径识别调用方
+func fingerprintClient(header http.Header, path string, body []byte) ClientFingerprint {
+	if header == nil {
+		header = http.Header{}
+	}
+	if app := strings.ToLower(strings.TrimSpace(header.Get(headerClientApp))); clientAppNamePattern.MatchString(app) {
+		return ClientFingerprint{App: normalizeAppName(app), Source: "header"}
+	}
+	// /pc/ 路由专供 PicoClaw
+	if strings.HasPrefix(strings.ToLower(path), "/pc/") {
+		return ClientFingerprint{App: ClientAppPicoClaw, Source: "path"}
+	}
+	if app := appFromToolHeaders(header); app != "" {
+		return ClientFingerprint{App: app, Source: "header"}
+	}
+
+	ua := strings.ToLower(header.Get("User-Agent"))
+	if app := matchClientMarker(clientUserAgentMarkers, ua); app != "" {
+		return ClientFingerprint{App: app, Source: "user_agent"}
+	}
+	if app := appFromRequestShape(body); app != "" {
+		return ClientFingerprint{App: app, Source: "shape"}
+	}
+	for _, marker := range clientScriptMarkers {
+		if strings.Contains(ua, marker) {
+			return ClientFingerprint{App: ClientAppScript, Source: "user_agent"}
+		}
+	}
+	return ClientFingerprint{App: detectAppFromPath(path), Source: "path"}
+}
+
+// appFromToolHeaders 识别工具特有的请求头
+func appFromToolHeaders(header http.Header) string {
+	// Claude Code 发送 x-app: cli
+	if strings.EqualFold(header.Get("X-App"), "cli") && header.Get("Anthropic-Version") != "" {
+		return ClientAppClaude
+	}
+	// Codex CLI 发送 originator: codex_cli_rs / codex_vscode
+	if strings.HasPrefix(strings.ToLower(header.Get("Originator")), "codex") {
+		return ClientAppCodex
+	}
+	if strings.Contains(strings.ToLower(header.Get("X-Goog-Api-Client")), "gemini-cli") {
+		return ClientAppGemini
+	}
+	title := strings.ToLower(header.Get("X-Title") + " " + header.Get("HTTP-Referer"))
+	return matchClientMarker(clientTitleMarkers, title)
+}
+
+// appFromRequestShape 根据请求体识别：Claude Code 的 metadata.user_id 格式与各工具的系统提示词
+func appFromRequestShape(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	parsed := gjson.ParseBytes(body)
+	if claudeUserIDPattern.MatchString(parsed.Get("metadata.user_id").String()) {
+		return ClientAppClaude
+	}
+
+	// Anthropic: system；Responses: instructions；Gemini: systemInstruction；Chat Completions: system 消息
+	prompt := firstExisting(parsed, "system", "instructions", "systemInstruction", "system_instruction")
+	if prompt == "" {
+		prompt = parsed.Get(`messages.#(role=="system").content`).String()
+	}
+	if len(prompt) > 4096 {
+		prompt = prompt[:4096]
+	}
+	return matchClientMarker(clientPromptMarkers, strings.ToLower(prompt))
+}
+
+func matchClientMarker(markers []clientMarker, text string) string {
+	if text == "" {
+		return ""
+	}
+	for _, m := range markers {
+		if strings.Contains(text, m.marker) {
+			return m.app
+		}
+	}
+	return ""
+}
+
+// detectApp 仅凭 User-Agent 与路径识别应用，用于没有请求头与请求体的历史日志
+func detectApp(userAgent, path string) string {
+	header := http.Header{}
+	if userAgent != "" {
+		header.Set("User-Agent", userAgent)
+	}
+	return fingerprintClient(header, path, nil).App
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFingerprintClient(t *testing.T) {
+	cases := []struct {
+		name       string
+		headers    map[string]string
+		path       string
+		body       string
+		app        string
+		wantSource string
+	}{
+		{"explicit header", map[string]string{"X-CS-App": "Nightly-Eval", "User-Agent": "claude-cli/2.0"}, "/v1/messages", "", "nightly-eval", "header"},
+		{"explicit alias", map[string]string{"X-CS-App": "claude-code"}, "/responses", "", ClientAppClaude, "header"},
+		{"invalid explicit header ignored", map[string]string{"X-CS-App": "has space", "User-Agent": "codex_cli_rs/0.46.0"}, "/responses", "", ClientAppCodex, "user_agent"},
+		{"picoclaw route", map[string]string{"User-Agent": "claude-cli/2.0"}, "/pc/v1/chat/completions", "", ClientAppPicoClaw, "path"},
+		{"claude x-app header", map[string]string{"X-App": "cli", "Anthropic-Version": "2023-06-01", "User-Agent": "Anthropic/JS 0.60.0"}, "/v1/messages", "", ClientAppClaude, "header"},
+		{"codex originator", map[string]string{"Originator": "codex_cli_rs"}, "/responses", "", ClientAppCodex, "header"},
+		{"cline title", map[string]string{"X-Title": "Cline", "HTTP-Referer": "https://cline.bot", "User-Agent": "OpenAI/JS 4.96.0"}, "/v1/chat/completions", "", ClientAppCline, "header"},
+		{"opencode referer", map[string]string{"HTTP-Referer": "https://opencode.ai/", "User-Agent": "ai-sdk/openai"}, "/v1/chat/completions", "", ClientAppOpenCode, "header"},
+		{"claude user agent", map[string]string{"User-Agent": "claude-cli/2.0.14 (external, cli)"}, "/v1/chat/completions", "", ClientAppClaude, "user_agent"},
+		{"gemini user agent", map[string]string{"User-Agent": "GeminiCLI/0.9.0 (darwin; arm64)"}, "/v1/chat/completions", "", ClientAppGemini, "user_agent"},
+		{"cursor user agent", map[string]string{"User-Agent": "Cursor/1.7.44"}, "/v1/chat/completions", "", ClientAppCursor, "user_agent"},
+		{"claude metadata shape", map[string]string{"User-Agent": "Anthropic/JS 0.60.0"}, "/v1/messages",
+			`{"metadata":{"user_id":"user_0a1b2c_account__session_AAAAAAAA-BBBB-CCCC-DDDD-EEEEEEEEEEEE"}}`, ClientAppClaude, "shape"},
+		{"opencode prompt shape", map[string]string{"User-Agent": "OpenAI/JS 4.96.0"}, "/v1/chat/completions",
+			`{"messages":[{"role":"system","content":"You are opencode, an interactive CLI tool"},{"role":"user","content":"hi"}]}`, ClientAppOpenCode, "shape"},
+		{"codex instructions shape", nil, "/v1/chat/completions",
+			`{"instructions":"You are a coding agent running in the Codex CLI"}`, ClientAppCodex, "shape"},
+		{"python sdk script", map[string]string{"User-Agent": "Anthropic/Python 0.69.0"}, "/v1/messages", `{"system":"be helpful"}`, ClientAppScript, "user_agent"},
+		{"curl script", map[string]string{"User-Agent": "curl/8.7.1"}, "/v1/messages", "", ClientAppScript, "user_agent"},
+		{"path fallback", nil, "/v1/messages", "", ClientAppClaude, "path"},
+		{"unknown", map[string]string{"User-Agent": "Mozilla/5.0"}, "/health", "", ClientAppUnknown, "path"},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		for k, v := range tc.headers {
+			header.Set(k, v)
+		}
+		got := fingerprintClient(header, tc.path, []byte(tc.body))
+		if got.App != tc.app || got.Source != tc.wantSource {
+			t.Errorf("%s: got %+v, want %s via %s", tc.name, got, tc.app, tc.wantSource)
+		}
+	}
+}
+
+func TestClientFingerprintForCachesResult(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	c.Request.Header.Set("User-Agent", "OpenAI/Python 1.99.0")
+
+	body := []byte(`{"messages":[{"role":"system","content":"You are Cline, a highly skilled software engineer"}]}`)
+	if got := clientFingerprintFor(c, body).App; got != ClientAppCline {
+		t.Fatalf("app = %q, want cline", got)
+	}
+	// Fallback retries reuse the first result even if the body was rewritten
+	if got := clientFingerprintFor(c, nil).App; got != ClientAppCline {
+		t.Fatalf("cached app = %q, want cline", got)
+	}
+}
+
+func TestDetectApp(t *testing.T) {
+	cases := []struct {
+		userAgent, path, want string
+	}{
+		{"claude-cli/2.0.14 (external, cli)", "/v1/chat/completions", "claude"},
+		{"codex_cli_rs/0.46.0", "/v1/messages", "codex"},
+		{"PicoClaw/1.0", "/v1/messages", "picoclaw"},
+		{"claude-cli/2.0.14", "/pc/v1/chat/completions", "picoclaw"},
+		{"curl/8.0", "/v1/messages", "script"},
+		{"", "/responses", "codex"},
+		{"", "/health", "unknown"},
+	}
+	for _, tc := range cases {
+		if got := detectApp(tc.userAgent, tc.path); got != tc.want {
+			t.Errorf("detectApp(%q, %q) = %q, want %q", tc.userAgent, tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// ctxKeyConversationID 缓存本次请求推导出的会话 ID，fallback 重试时不必重复计算
+const ctxKeyConversationID = "codeswitch.conversation_id"
+
+// conversationHeaders 客户端显式传入会话标识的请求头（按优先级）
+// Codex CLI 会发送 session_id / conversation_id
+var conversationHeaders = []string{
+	"X-Conversation-ID",
+	"X-Session-ID",
+	"Session_id",
+	"Conversation_id",
+}
+
+// claudeSessionPattern Claude Code 在 metadata.user_id 末尾附带会话 UUID：user_<hash>_account_<uuid>_session_<uuid>
+var claudeSessionPattern = regexp.MustCompile(`_session_([0-9a-fA-F-]{36})$`)
+
+// conversationIDFor 返回请求所属的会话 ID，结果缓存在 gin context 中
+func conversationIDFor(c *gin.Context, body []byte) string {
+	if c == nil {
+		return deriveConversationID(nil, body)
+	}
+	if id := c.GetString(ctxKeyConversationID); id != "" {
+		return id
+	}
+	id := deriveConversationID(c, body)
+	if id != "" {
+		c.Set(ctxKeyConversationID, id)
+	}
+	return id
+}
+
+// deriveConversationID 依次使用请求头、Claude Code 会话 UUID、内容指纹推导会话 ID
+func deriveConversationID(c *gin.Context, body []byte) string {
+	if c != nil {
+		for _, name := range conversationHeaders {
+			if value := strings.TrimSpace(c.GetHeader(name)); value != "" {
+				return truncateConversationID(value)
+			}
+		}
+	}
+	if m := claudeSessionPattern.FindStringSubmatch(gjson.GetBytes(body, "metadata.user_id").String()); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return conversationFingerprint(body)
+}
+
+// truncateConversationID 限制外部传入 ID 的长度，避免异常值撑大索引
+func truncateConversationID(id string) string {
+	if len(id) > 128 {
+		return id[:128]
+	}
+	return id
+}
+
+// conversationFingerprint 同一会话的后续请求会重复携带系统提示词与首条用户消息，
+// 以二者的哈希作为会话指纹；两者都缺失时返回空
+func conversationFingerprint(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	parsed := gjson.ParseBytes(body)
+
+	// Anthropic: system；OpenAI Responses: instructions；Gemini: systemInstruction
+	system := firstExisting(parsed, "system", "instructions", "systemInstruction", "system_instruction")
+	// Anthropic / Chat Completions: messages；Responses: input；Gemini: contents
+	first := firstUserMessage(parsed)
+	if system == "" && first == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(system + "\x00" + first))
+	return "fp-" + hex.EncodeToString(sum[:8])
+}
+
+// firstExisting 返回第一个存在的字段原始值
+func firstExisting(parsed gjson.Result, paths ...string) string {
+	for _, path := range paths {
+		if v := parsed.Get(path); v.Exists() {
+			return v.Raw
+		}
+	}
+	return ""
+}
+
+// firstUserMessage 返回首条用户消息内容的原始 JSON
+func firstUserMessage(parsed gjson.Result) string {
+	for _, path := range []string{"messages", "contents"} {
+		var content string
+		parsed.Get(path).ForEach(func(_, msg gjson.Result) bool {
+			if msg.Get("role").String() == "user" {
+				content = firstExisting(msg, "content", "parts")
+				return false
+			}
+			return true
+		})
+		if content != "" {
+			return content
+		}
+	}
+	input := parsed.Get("input")
+	if input.Type == gjson.String {
+		return input.Raw
+	}
+	var content string
+	input.ForEach(func(_, item gjson.Result) bool {
+		if item.Get("role").String() == "user" {
+			content = item.Get("content").Raw
+			return false
+		}
+		return true
+	})
+	return content
+}
+
+// ConversationSummary 会话聚合信息
+type ConversationSummary struct {
+	ConversationID string   `json:"conversation_id"`
+	Platform       string   `json:"platform"`
+	FirstAt        string   `json:"first_at"`
+	LastAt         string   `json:"last_at"`
+	Requests       int      `json:"requests"`
+	InputTokens    int64    `json:"input_tokens"`
+	OutputTokens   int64    `json:"output_tokens"`
+	CacheTokens    int64    `json:"cache_tokens"`
+	TotalCost      float64  `json:"total_cost"`
+	Errors         int      `json:"errors"`
+	Models         []string `json:"models"`
+	Providers      []string `json:"providers"`
+}
+
+// ListConversations 按会话聚合请求日志，按最近活动时间倒序
+func (ls *LogService) ListConversations(platform string, limit int) ([]ConversationSummary, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+
+	where := "conversation_id IS NOT NULL AND conversation_id != ''"
+	args := make([]interface{}, 0, 2)
+	if platform != "" {
+		where += " AND platform = ?"
+		args = append(args, platform)
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(`
+		SELECT conversation_id, MAX(platform), MIN(created_at), MAX(created_at), COUNT(*),
+		       COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+		       COALESCE(SUM(cache_create_tokens + cache_read_tokens), 0),
+		       COALESCE(SUM(total_cost), 0),
+		       SUM(CASE WHEN http_code >= 400 THEN 1 ELSE 0 END),
+		       GROUP_CONCAT(DISTINCT model), GROUP_CONCAT(DISTINCT provider)
+		FROM request_log
+		WHERE `+where+`
+		GROUP BY conversation_id
+		ORDER BY MAX(created_at) DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []ConversationSummary{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]ConversationSummary, 0)
+	for rows.Next() {
+		var item ConversationSummary
+		var models, providers *string
+		if err := rows.Scan(
+			&item.ConversationID, &item.Platform, &item.FirstAt, &item.LastAt, &item.Requests,
+			&item.InputTokens, &item.OutputTokens, &item.CacheTokens, &item.TotalCost,
+			&item.Errors, &models, &providers,
+		); err != nil {
+			return nil, err
+		}
+		item.Models = splitConcat(models)
+		item.Providers = splitConcat(providers)
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+// splitConcat 拆分 GROUP_CONCAT 结果
+func splitConcat(value *string) []string {
+	if value == nil || *value == "" {
+		return []string{}
+	}
+	parts := strings.Split(*value, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// GetConversationLogs 返回会话内的全部请求，按时间正序（用于时间线展示）
+func (ls *LogService) GetConversationLogs(conversationID string) ([]ReqeustLog, error) {
+	if strings.TrimSpace(conversationID) == "" {
+		return []ReqeustLog{}, nil
+	}
+	records, err := analyticsModel("request_log").Selects(
+		xdb.WhereEq("conversation_id", conversationID),
+		xdb.OrderByAsc("id"),
+		xdb.Limit(1000),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return []ReqeustLog{}, nil
+		}
+		return nil, err
+	}
+	logs := make([]ReqeustLog, 0, len(records))
+	for _, record := range records {
+		logEntry := ReqeustLog{
+			ID:                record.GetInt64("id"),
+			TraceID:           record.GetString("trace_id"),
+			ConversationID:    record.GetString("conversation_id"),
+			Platform:          record.GetString("platform"),
+			Model:             record.GetString("model"),
+			Provider:          record.GetString("provider"),
+			HttpCode:          record.GetInt("http_code"),
+			InputTokens:       record.GetInt("input_tokens"),
+			OutputTokens:      record.GetInt("output_tokens"),
+			CacheCreateTokens: record.GetInt("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt("cache_read_tokens"),
+			ReasoningTokens:   record.GetInt("reasoning_tokens"),
+			ErrorType:         record.GetString("error_type"),
+			CreatedAt:         record.GetString("created_at"),
+			IsStream:          record.GetBool("is_stream"),
+			DurationSec:       record.GetFloat64("duration_sec"),
+			TTFBSec:           record.GetFloat64("ttfb_sec"),
+			TTFTSec:           record.GetFloat64("ttft_sec"),
+			TokensPerSec:      record.GetFloat64("tokens_per_sec"),
+		}
+		ls.decorateCost(&logEntry)
+		logs = append(logs, logEntry)
+	}
+	return logs, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newConversationContext(headers map[string]string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	return c
+}
+
+func TestDeriveConversationIDFromHeader(t *testing.T) {
+	c := newConversationContext(map[string]string{"session_id": "codex-session-1"})
+	if got := deriveConversationID(c, []byte(`{"model":"gpt-5"}`)); got != "codex-session-1" {
+		t.Fatalf("expected header session id, got %q", got)
+	}
+
+	c = newConversationContext(map[string]string{"X-Conversation-ID": strings.Repeat("a", 200)})
+	if got := deriveConversationID(c, nil); len(got) != 128 {
+		t.Fatalf("expected truncated id, got len %d", len(got))
+	}
+}
+
+func TestDeriveConversationIDFromClaudeMetadata(t *testing.T) {
+	body := []byte(`{"metadata":{"user_id":"user_abc_account_11111111-2222-3333-4444-555555555555_session_AAAAAAAA-BBBB-CCCC-DDDD-EEEEEEEEEEEE"},"messages":[]}`)
+	got := deriveConversationID(newConversationContext(nil), body)
+	if got != "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee" {
+		t.Fatalf("expected session uuid, got %q", got)
+	}
+}
+
+func TestConversationFingerprint(t *testing.T) {
+	first := []byte(`{"system":"be helpful","messages":[{"role":"user","content":"hello"}]}`)
+	followUp := []byte(`{"system":"be helpful","messages":[{"role":"user","content":"hello"},{"role":"assistant","content":"hi"},{"role":"user","content":"more"}]}`)
+	other := []byte(`{"system":"be helpful","messages":[{"role":"user","content":"different"}]}`)
+
+	a := conversationFingerprint(first)
+	if !strings.HasPrefix(a, "fp-") {
+		t.Fatalf("expected fingerprint id, got %q", a)
+	}
+	if b := conversationFingerprint(followUp); b != a {
+		t.Fatalf("follow-up should share fingerprint: %q vs %q", a, b)
+	}
+	if c := conversationFingerprint(other); c == a {
+		t.Fatal("different first message should produce different fingerprint")
+	}
+
+	responses := []byte(`{"instructions":"sys","input":[{"role":"user","content":[{"type":"input_text","text":"hi"}]}]}`)
+	if conversationFingerprint(responses) == "" {
+		t.Fatal("responses api body should produce fingerprint")
+	}
+	if got := conversationFingerprint([]byte(`{"model":"x"}`)); got != "" {
+		t.Fatalf("expected empty fingerprint, got %q", got)
+	}
+}
+
+func TestConversationIDForCachesResult(t *testing.T) {
+	c := newConversationContext(nil)
+	body := []byte(`{"system":"s","messages":[{"role":"user","content":"q"}]}`)
+	id := conversationIDFor(c, body)
+	if id == "" {
+		t.Fatal("expected conversation id")
+	}
+	if again := conversationIDFor(c, []byte(`{}`)); again != id {
+		t.Fatalf("expected cached id %q, got %q", id, again)
+	}
+}
@@ -0,0 +1,511 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"codeswitch/services/parquet"
+)
+
+// 支持的导出格式
+const (
+	LogExportJSON    = "json"
+	LogExportCSV     = "csv"
+	LogExportParquet = "parquet"
+	LogExportSQLite  = "sqlite"
+)
+
+// logExportChunkSize 每次从数据库读取的行数，导出内存占用与总行数无关
+const logExportChunkSize = 2000
+
+// LogExportOptions 导出选项
+type LogExportOptions struct {
+	Format string `json:"format"` // json / csv / parquet / sqlite
+	// Gzip 压缩输出：json / csv / sqlite 生成 .gz 文件；parquet 使用内部 GZIP 编码，文件仍可直接读取
+	Gzip bool `json:"gzip"`
+}
+
+// LogExportProgress 导出进度
+type LogExportProgress struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Rows   int64  `json:"rows"`
+	Total  int64  `json:"total"`
+	Done   bool   `json:"done"`
+	Error  string `json:"error,omitempty"`
+}
+
+// logExportHub 导出进度回调
+type logExportHub struct {
+	mu       sync.Mutex
+	handlers []func(LogExportProgress)
+}
+
+// OnLogExportProgress 注册导出进度回调（桌面端用于推送 Wails 事件）
+func (prs *ProviderRelayService) OnLogExportProgress(handler func(LogExportProgress)) {
+	prs.logExport.mu.Lock()
+	prs.logExport.handlers = append(prs.logExport.handlers, handler)
+	prs.logExport.mu.Unlock()
+}
+
+func (prs *ProviderRelayService) emitLogExportProgress(progress LogExportProgress) {
+	prs.logExport.mu.Lock()
+	handlers := append([]func(LogExportProgress){}, prs.logExport.handlers...)
+	prs.logExport.mu.Unlock()
+	for _, handler := range handlers {
+		handler(progress)
+	}
+}
+
+// logExportColumn 导出列定义，CSV 表头、Parquet schema 与 SQLite 表结构共用
+type logExportColumn struct {
+	name  string
+	kind  parquet.ColumnType
+	value func(*ReqeustLog) any
+}
+
+var logExportColumns = []logExportColumn{
+	{"id", parquet.Int64, func(l *ReqeustLog) any { return l.ID }},
+	{"trace_id", parquet.String, func(l *ReqeustLog) any { return l.TraceID }},
+	{"request_id", parquet.String, func(l *ReqeustLog) any { return l.RequestID }},
+	{"conversation_id", parquet.String, func(l *ReqeustLog) any { return l.ConversationID }},
+	{"project", parquet.String, func(l *ReqeustLog) any { return l.Project }},
+	{"tags", parquet.String, func(l *ReqeustLog) any { return l.Tags }},
+	{"api_key_id", parquet.String, func(l *ReqeustLog) any { return l.APIKeyID }},
+	{"app_name", parquet.String, func(l *ReqeustLog) any { return l.AppName }},
+	{"platform", parquet.String, func(l *ReqeustLog) any { return l.Platform }},
+	{"model", parquet.String, func(l *ReqeustLog) any { return l.Model }},
+	{"provider", parquet.String, func(l *ReqeustLog) any { return l.Provider }},
+	{"http_code", parquet.Int64, func(l *ReqeustLog) any { return l.HttpCode }},
+	{"input_tokens", parquet.Int64, func(l *ReqeustLog) any { return l.InputTokens }},
+	{"output_tokens", parquet.Int64, func(l *ReqeustLog) any { return l.OutputTokens }},
+	{"cache_create_tokens", parquet.Int64, func(l *ReqeustLog) any { return l.CacheCreateTokens }},
+	{"cache_read_tokens", parquet.Int64, func(l *ReqeustLog) any { return l.CacheReadTokens }},
+	{"reasoning_tokens", parquet.Int64, func(l *ReqeustLog) any { return l.ReasoningTokens }},
+	{"is_stream", parquet.Bool, func(l *ReqeustLog) any { return l.IsStream }},
+	{"duration_sec", parquet.Double, func(l *ReqeustLog) any { return l.DurationSec }},
+	{"ttfb_sec", parquet.Double, func(l *ReqeustLog) any { return l.TTFBSec }},
+	{"ttft_sec", parquet.Double, func(l *ReqeustLog) any { return l.TTFTSec }},
+	{"tokens_per_sec", parquet.Double, func(l *ReqeustLog) any { return l.TokensPerSec }},
+	{"user_agent", parquet.String, func(l *ReqeustLog) any { return l.UserAgent }},
+	{"client_ip", parquet.String, func(l *ReqeustLog) any { return l.ClientIP }},
+	{"user_id", parquet.String, func(l *ReqeustLog) any { return l.UserID }},
+	{"request_method", parquet.String, func(l *ReqeustLog) any { return l.RequestMethod }},
+	{"request_path", parquet.String, func(l *ReqeustLog) any { return l.RequestPath }},
+	{"error_type", parquet.String, func(l *ReqeustLog) any { return l.ErrorType }},
+	{"error_message", parquet.String, func(l *ReqeustLog) any { return l.ErrorMessage }},
+	{"provider_error_code", parquet.String, func(l *ReqeustLog) any { return l.ProviderErrorCode }},
+	{"json_repair", parquet.String, func(l *ReqeustLog) any { return l.JSONRepair }},
+	{"prompt_compression", parquet.String, func(l *ReqeustLog) any { return l.PromptCompression }},
+	{"request_bytes", parquet.Int64, func(l *ReqeustLog) any { return l.RequestBytes }},
+	{"response_bytes", parquet.Int64, func(l *ReqeustLog) any { return l.ResponseBytes }},
+	{"input_cost", parquet.Double, func(l *ReqeustLog) any { return l.InputCost }},
+	{"output_cost", parquet.Double, func(l *ReqeustLog) any { return l.OutputCost }},
+	{"cache_create_cost", parquet.Double, func(l *ReqeustLog) any { return l.CacheCreateCost }},
+	{"cache_read_cost", parquet.Double, func(l *ReqeustLog) any { return l.CacheReadCost }},
+	{"ephemeral_5m_cost", parquet.Double, func(l *ReqeustLog) any { return l.Ephemeral5mCost }},
+	{"ephemeral_1h_cost", parquet.Double, func(l *ReqeustLog) any { return l.Ephemeral1hCost }},
+	{"total_cost", parquet.Double, func(l *ReqeustLog) any { return l.TotalCost }},
+	{"created_at", parquet.String, func(l *ReqeustLog) any { return l.CreatedAt }},
+}
+
+// logRowSink 按块接收导出行
+type logRowSink interface {
+	writeLogs(logs []ReqeustLog) error
+	close() error
+}
+
+// ExportLogsWithOptions 流式导出匹配过滤条件的全部日志（无行数上限），返回导出文件路径
+func (prs *ProviderRelayService) ExportLogsWithOptions(filter LogFilter, options LogExportOptions) (string, error) {
+	db, err := analyticsDB()
+	if err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	exportDir := filepath.Join(home, ".code-switch", "exports")
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return "", err
+	}
+	return prs.exportLogs(db, filter, options, exportDir)
+}
+
+// exportLogs 先写入 .partial 临时文件，完成后重命名，失败时清理
+func (prs *ProviderRelayService) exportLogs(db *sql.DB, filter LogFilter, options LogExportOptions, exportDir string) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(options.Format))
+	if format == "" {
+		format = LogExportJSON
+	}
+	ext := format
+	switch format {
+	case LogExportJSON, LogExportCSV, LogExportParquet:
+	case LogExportSQLite:
+		ext = "db"
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", options.Format)
+	}
+
+	name := fmt.Sprintf("llm_logs_%s.%s", time.Now().Format("20060102_150405"), ext)
+	if options.Gzip && format != LogExportParquet {
+		name += ".gz"
+	}
+	exportPath := filepath.Join(exportDir, name)
+	partial := exportPath + ".partial"
+
+	where, args := buildLogFilterWhere(filter)
+	progress := LogExportProgress{Path: exportPath, Format: format}
+	if err := db.QueryRow("SELECT COUNT(*) FROM request_log WHERE "+where, args...).Scan(&progress.Total); err != nil {
+		return "", err
+	}
+	prs.emitLogExportProgress(progress)
+
+	fail := func(err error) (string, error) {
+		os.Remove(partial)
+		progress.Error = err.Error()
+		progress.Done = true
+		prs.emitLogExportProgress(progress)
+		return "", err
+	}
+
+	sink, err := newLogRowSink(format, partial, options.Gzip)
+	if err != nil {
+		return fail(err)
+	}
+	err = iterateLogs(db, where, args, logExportChunkSize, func(logs []ReqeustLog) error {
+		if err := sink.writeLogs(logs); err != nil {
+			return err
+		}
+		progress.Rows += int64(len(logs))
+		prs.emitLogExportProgress(progress)
+		return nil
+	})
+	if closeErr := sink.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(partial, exportPath); err != nil {
+		return fail(err)
+	}
+
+	progress.Done = true
+	prs.emitLogExportProgress(progress)
+	return exportPath, nil
+}
+
+// iterateLogs 按 id 分块遍历匹配的日志（keyset 分页，避免大 OFFSET）
+func iterateLogs(db *sql.DB, where string, args []interface{}, chunk int, fn func([]ReqeustLog) error) error {
+	query := "SELECT " + requestLogColumns + " FROM request_log WHERE " + where + " AND id > ? ORDER BY id ASC LIMIT ?"
+	var lastID int64
+	for {
+		rows, err := db.Query(query, append(append([]interface{}{}, args...), lastID, chunk)...)
+		if err != nil {
+			return err
+		}
+		logs := make([]ReqeustLog, 0, chunk)
+		for rows.Next() {
+			log, err := scanRequestLog(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			logs = append(logs, log)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < chunk {
+			return nil
+		}
+		lastID = logs[len(logs)-1].ID
+	}
+}
+
+func newLogRowSink(format, path string, gz bool) (logRowSink, error) {
+	if format == LogExportSQLite {
+		return newSQLiteLogSink(path, gz)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	out := &exportFile{file: file}
+	if gz && format != LogExportParquet {
+		out.gzip = gzip.NewWriter(file)
+		out.buf = bufio.NewWriter(out.gzip)
+	} else {
+		out.buf = bufio.NewWriter(file)
+	}
+
+	switch format {
+	case LogExportCSV:
+		w := csv.NewWriter(out.buf)
+		header := make([]string, len(logExportColumns))
+		for i, col := range logExportColumns {
+			header[i] = col.name
+		}
+		if err := w.Write(header); err != nil {
+			out.close()
+			return nil, err
+		}
+		return &csvLogSink{out: out, w: w}, nil
+	case LogExportParquet:
+		schema := make([]parquet.Column, len(logExportColumns))
+		for i, col := range logExportColumns {
+			schema[i] = parquet.Column{Name: col.name, Type: col.kind}
+		}
+		w, err := parquet.NewWriter(out.buf, schema, parquet.Options{Gzip: gz, CreatedBy: "code-switch log export"})
+		if err != nil {
+			out.close()
+			return nil, err
+		}
+		return &parquetLogSink{out: out, w: w}, nil
+	default:
+		if _, err := out.buf.WriteString("["); err != nil {
+			out.close()
+			return nil, err
+		}
+		return &jsonLogSink{out: out}, nil
+	}
+}
+
+// exportFile 带缓冲（可选 gzip）的导出文件
+type exportFile struct {
+	file *os.File
+	gzip *gzip.Writer
+	buf  *bufio.Writer
+}
+
+func (f *exportFile) close() error {
+	err := f.buf.Flush()
+	if f.gzip != nil {
+		if gzErr := f.gzip.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type jsonLogSink struct {
+	out   *exportFile
+	count int
+}
+
+func (s *jsonLogSink) writeLogs(logs []ReqeustLog) error {
+	for i := range logs {
+		data, err := json.Marshal(logs[i])
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if s.count == 0 {
+			sep = "\n  "
+		}
+		s.out.buf.WriteString(sep)
+		if _, err := s.out.buf.Write(data); err != nil {
+			return err
+		}
+		s.count++
+	}
+	return nil
+}
+
+func (s *jsonLogSink) close() error {
+	s.out.buf.WriteString("\n]\n")
+	return s.out.close()
+}
+
+type csvLogSink struct {
+	out *exportFile
+	w   *csv.Writer
+}
+
+func (s *csvLogSink) writeLogs(logs []ReqeustLog) error {
+	record := make([]string, len(logExportColumns))
+	for i := range logs {
+		for j, col := range logExportColumns {
+			record[j] = formatExportValue(col.value(&logs[i]))
+		}
+		if err := s.w.Write(record); err != nil {
+			return err
+		}
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvLogSink) close() error {
+	s.w.Flush()
+	if err := s.w.Error(); err != nil {
+		s.out.close()
+		return err
+	}
+	return s.out.close()
+}
+
+// formatExportValue CSV 单元格格式
+func formatExportValue(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return fmt.Sprint(v)
+}
+
+type parquetLogSink struct {
+	out *exportFile
+	w   *parquet.Writer
+}
+
+func (s *parquetLogSink) writeLogs(logs []ReqeustLog) error {
+	for i := range logs {
+		row := make([]any, len(logExportColumns))
+		for j, col := range logExportColumns {
+			row[j] = col.value(&logs[i])
+		}
+		if err := s.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *parquetLogSink) close() error {
+	if err := s.w.Close(); err != nil {
+		s.out.close()
+		return err
+	}
+	return s.out.close()
+}
+
+// sqliteLogSink 导出为独立的 SQLite 文件（表名 request_log），可直接用 DuckDB / pandas 读取
+type sqliteLogSink struct {
+	path   string
+	dbPath string
+	gzip   bool
+	db     *sql.DB
+}
+
+func newSQLiteLogSink(path string, gz bool) (*sqliteLogSink, error) {
+	dbPath := path
+	if gz {
+		// 先写未压缩的数据库文件，关闭时再压缩到目标路径
+		dbPath = path + ".db"
+	}
+	os.Remove(dbPath)
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]string, len(logExportColumns))
+	for i, col := range logExportColumns {
+		defs[i] = col.name + " " + sqliteColumnType(col.kind)
+	}
+	if _, err := db.Exec("CREATE TABLE request_log (" + strings.Join(defs, ", ") + ")"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteLogSink{path: path, dbPath: dbPath, gzip: gz, db: db}, nil
+}
+
+func sqliteColumnType(kind parquet.ColumnType) string {
+	switch kind {
+	case parquet.Int64, parquet.Bool:
+		return "INTEGER"
+	case parquet.Double:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+func (s *sqliteLogSink) writeLogs(logs []ReqeustLog) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(logExportColumns)), ", ")
+	stmt, err := tx.Prepare("INSERT INTO request_log VALUES (" + placeholders + ")")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	values := make([]interface{}, len(logExportColumns))
+	for i := range logs {
+		for j, col := range logExportColumns {
+			v := col.value(&logs[i])
+			if b, ok := v.(bool); ok {
+				v = boolToInt(b)
+			}
+			values[j] = v
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteLogSink) close() error {
+	s.db.Exec("CREATE INDEX IF NOT EXISTS idx_created_at ON request_log(created_at)")
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	if !s.gzip {
+		return nil
+	}
+	defer os.Remove(s.dbPath)
+	src, err := os.Open(s.dbPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func newExportTestDB(t *testing.T, rows int) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := ensureRequestLogTableWithDB(db); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		platform := "claude"
+		if i%2 == 1 {
+			platform = "codex"
+		}
+		if _, err := db.Exec(
+			`INSERT INTO request_log (trace_id, platform, model, provider, http_code, input_tokens, output_tokens, total_cost, project)
+			 VALUES (?, ?, 'model-a', 'p1', 200, ?, 1, 0.5, 'acme')`,
+			"trace-"+string(rune('a'+i%26)), platform, i,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func readExport(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ = io.ReadAll(zr)
+	}
+	return data
+}
+
+func TestExportLogsJSONAndCSV(t *testing.T) {
+	db := newExportTestDB(t, 5)
+	prs := &ProviderRelayService{}
+	var last LogExportProgress
+	prs.OnLogExportProgress(func(p LogExportProgress) { last = p })
+
+	path, err := prs.exportLogs(db, LogFilter{Platform: "claude"}, LogExportOptions{Format: "json", Gzip: true}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []ReqeustLog
+	if err := json.Unmarshal(readExport(t, path), &logs); err != nil {
+		t.Fatalf("invalid json export: %v", err)
+	}
+	if len(logs) != 3 || logs[0].Project != "acme" {
+		t.Fatalf("unexpected export %+v", logs)
+	}
+	if !last.Done || last.Rows != 3 || last.Total != 3 {
+		t.Fatalf("unexpected progress %+v", last)
+	}
+
+	path, err = prs.exportLogs(db, LogFilter{}, LogExportOptions{Format: "csv"}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(readExport(t, path))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || records[0][0] != "id" {
+		t.Fatalf("unexpected csv export %v", records)
+	}
+}
+
+func TestExportLogsChunksWithoutRowCap(t *testing.T) {
+	db := newExportTestDB(t, 7)
+	where, args := buildLogFilterWhere(LogFilter{})
+	chunks, total := 0, 0
+	err := iterateLogs(db, where, args, 3, func(logs []ReqeustLog) error {
+		chunks++
+		total += len(logs)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks != 3 || total != 7 {
+		t.Fatalf("expected 3 chunks / 7 rows, got %d / %d", chunks, total)
+	}
+}
+
+func TestExportLogsSQLiteAndParquet(t *testing.T) {
+	db := newExportTestDB(t, 4)
+	prs := &ProviderRelayService{}
+
+	path, err := prs.exportLogs(db, LogFilter{}, LogExportOptions{Format: "sqlite"}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	var count int
+	var tokens int64
+	if err := out.QueryRow("SELECT COUNT(*), SUM(input_tokens) FROM request_log").Scan(&count, &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 || tokens != 6 {
+		t.Fatalf("unexpected sqlite export: %d rows, %d tokens", count, tokens)
+	}
+
+	path, err = prs.exportLogs(db, LogFilter{}, LogExportOptions{Format: "parquet", Gzip: true}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, ".parquet") {
+		t.Fatalf("parquet export should not get a .gz suffix: %s", path)
+	}
+	data := readExport(t, path)
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("invalid parquet file")
+	}
+
+	if _, err := prs.exportLogs(db, LogFilter{}, LogExportOptions{Format: "xml"}, t.TempDir()); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	rollupHourlyTable = "request_log_hourly"
+	rollupDailyTable  = "request_log_daily"
+	rollupStateTable  = "request_log_rollup_state"
+	// rollupWatermarkKey 小时汇总已覆盖到的时间点（UTC 整点，不含），之后的数据只在原始表中
+	rollupWatermarkKey = "hourly_watermark"
+	// rollupInterval 汇总任务间隔；rollupLag 留给仍在写入队列中的日志落库
+	rollupInterval = time.Minute
+	rollupLag      = time.Minute
+	// rollupChunk 每个事务最多汇总的时间跨度，避免首次回填时长时间占用写锁
+	rollupChunk = 24 * time.Hour
+)
+
+// rollupOpenEnd 作为 requestLogUsageSource 的终点时表示不限终点
+var rollupOpenEnd = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// rollupMetricColumns 汇总表的计数列，原始行与汇总行的查询列顺序一致
+var rollupMetricColumns = []string{
+	"requests", "success_requests",
+	"input_tokens", "output_tokens", "reasoning_tokens", "cache_create_tokens", "cache_read_tokens",
+	"input_cost", "output_cost", "cache_create_cost", "cache_read_cost", "total_cost",
+	"duration_sum", "duration_count",
+	"request_bytes", "response_bytes",
+}
+
+// rollupColumns 汇总表全部列：小时桶 + 维度 + 计数
+var rollupColumns = append([]string{"bucket", "platform", "provider", "model", "project", "app_name"}, rollupMetricColumns...)
+
+// rollupSums 汇总计数列的 SUM 表达式
+var rollupSums = "SUM(" + strings.Join(rollupMetricColumns, "), SUM(") + ")"
+
+// rawUsageRowsSQL 把原始日志逐行转换为汇总表的列结构（每行计 1 次请求）；
+// bucket 精确到分钟，便于按非整小时偏移的时区分桶
+const rawUsageRowsSQL = `SELECT strftime('%Y-%m-%d %H:%M:00', created_at) AS bucket,
+		COALESCE(platform, '') AS platform, COALESCE(provider, '') AS provider,
+		COALESCE(model, '') AS model, COALESCE(project, '') AS project, COALESCE(app_name, '') AS app_name,
+		1 AS requests, CASE WHEN http_code < 400 THEN 1 ELSE 0 END AS success_requests,
+		COALESCE(input_tokens, 0) AS input_tokens, COALESCE(output_tokens, 0) AS output_tokens,
+		COALESCE(reasoning_tokens, 0) AS reasoning_tokens, COALESCE(cache_create_tokens, 0) AS cache_create_tokens,
+		COALESCE(cache_read_tokens, 0) AS cache_read_tokens,
+		COALESCE(input_cost, 0) AS input_cost, COALESCE(output_cost, 0) AS output_cost,
+		COALESCE(cache_create_cost, 0) AS cache_create_cost, COALESCE(cache_read_cost, 0) AS cache_read_cost,
+		COALESCE(total_cost, 0) AS total_cost,
+		COALESCE(duration_sec, 0) AS duration_sum, CASE WHEN duration_sec IS NULL THEN 0 ELSE 1 END AS duration_count,
+		COALESCE(request_bytes, 0) AS request_bytes, COALESCE(response_bytes, 0) AS response_bytes
+	FROM request_log WHERE created_at >= ? AND created_at < ?`
+
+func ensureRollupTables(db *sql.DB) error {
+	if err := dropOutdatedRollups(db); err != nil {
+		return err
+	}
+	for _, table := range []string{rollupHourlyTable, rollupDailyTable} {
+		createSQL := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			bucket TEXT NOT NULL,
+			platform TEXT NOT NULL DEFAULT '',
+			provider TEXT NOT NULL DEFAULT '',
+			model TEXT NOT NULL DEFAULT '',
+			project TEXT NOT NULL DEFAULT '',
+			app_name TEXT NOT NULL DEFAULT '',
+			requests INTEGER NOT NULL DEFAULT 0,
+			success_requests INTEGER NOT NULL DEFAULT 0,
+			input_tokens INTEGER NOT NULL DEFAULT 0,
+			output_tokens INTEGER NOT NULL DEFAULT 0,
+			reasoning_tokens INTEGER NOT NULL DEFAULT 0,
+			cache_create_tokens INTEGER NOT NULL DEFAULT 0,
+			cache_read_tokens INTEGER NOT NULL DEFAULT 0,
+			input_cost REAL NOT NULL DEFAULT 0,
+			output_cost REAL NOT NULL DEFAULT 0,
+			cache_create_cost REAL NOT NULL DEFAULT 0,
+			cache_read_cost REAL NOT NULL DEFAULT 0,
+			total_cost REAL NOT NULL DEFAULT 0,
+			duration_sum REAL NOT NULL DEFAULT 0,
+			duration_count INTEGER NOT NULL DEFAULT 0,
+			request_bytes INTEGER NOT NULL DEFAULT 0,
+			response_bytes INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (bucket, platform, provider, model, project, app_name)
+		)`, table)
+		if _, err := db.Exec(createSQL); err != nil {
+			return err
+		}
+		// 后来新增的计数列：补列即可，补列前已汇总的小时计为 0
+		for _, column := range []string{"request_bytes", "response_bytes"} {
+			if err := ensureRollupColumn(db, table, column); err != nil {
+				return err
+			}
+		}
+		// 按平台过滤的统计查询（StatsSince / CostAnalysis）
+		if _, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_platform ON %s(platform, bucket)", table, table)); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + rollupStateTable + " (name TEXT PRIMARY KEY, value TEXT NOT NULL DEFAULT '')")
+	return err
+}
+
+// ensureRollupColumn 为已有的汇总表补充整数计数列
+func ensureRollupColumn(db *sql.DB, table, column string) error {
+	var count int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name = ?", table), column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER NOT NULL DEFAULT 0", table, column))
+	return err
+}
+
+// dropOutdatedRollups 汇总表缺少新增维度（app_name）时整体删除并清空水位线，由汇总任务从原始日志重建
+func dropOutdatedRollups(db *sql.DB) error {
+	var tables, columns int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", rollupHourlyTable).Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name = 'app_name'", rollupHourlyTable)).Scan(&columns); err != nil {
+		return err
+	}
+	if columns > 0 {
+		return nil
+	}
+	for _, stmt := range []string{
+		"DROP TABLE IF EXISTS " + rollupHourlyTable,
+		"DROP TABLE IF EXISTS " + rollupDailyTable,
+		"DELETE FROM " + rollupStateTable + " WHERE name = '" + rollupWatermarkKey + "'",
+	} {
+		if _, err := db.Exec(stmt); err != nil && !isNoSuchTableErr(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// startRollupTask 定期把已结束的小时汇总到 request_log_hourly / request_log_daily
+func (prs *ProviderRelayService) startRollupTask() {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if db, err := xdb.DB("default"); err == nil {
+			if err := refreshRequestLogRollups(db, time.Now()); err != nil && !isNoSuchTableErr(err) {
+				fmt.Printf("[Rollup] 汇总 request_log 失败: %v\n", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// refreshRequestLogRollups 把水位线推进到 now 之前最后一个完整小时；首次运行从最早的日志开始回填
+func refreshRequestLogRollups(db *sql.DB, now time.Time) error {
+	target := now.UTC().Add(-rollupLag).Truncate(time.Hour)
+	for {
+		done, err := refreshRollupChunk(db, target)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// refreshRollupChunk 在一个事务中汇总最多 rollupChunk 的数据；写锁保证与日志回放的水位线回退串行
+func refreshRollupChunk(db *sql.DB, target time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// 第一条语句即为写操作：立刻拿到写锁，之后读到的水位线不会被并发写入改动
+	if _, err := tx.Exec("INSERT OR IGNORE INTO "+rollupStateTable+" (name, value) VALUES (?, '')", rollupWatermarkKey); err != nil {
+		return false, err
+	}
+	var value string
+	if err := tx.QueryRow("SELECT value FROM "+rollupStateTable+" WHERE name = ?", rollupWatermarkKey).Scan(&value); err != nil {
+		return false, err
+	}
+	from, ok := parseRollupTime(value)
+	if !ok {
+		var first sql.NullString
+		if err := tx.QueryRow("SELECT MIN(created_at) FROM request_log").Scan(&first); err != nil {
+			return false, err
+		}
+		if from, ok = parseRollupTime(first.String); !ok {
+			from = target
+		}
+		from = from.Truncate(time.Hour)
+	}
+	if !from.Before(target) {
+		if value == "" {
+			if err := setRollupWatermark(tx, target); err != nil {
+				return false, err
+			}
+			return true, tx.Commit()
+		}
+		return true, nil
+	}
+
+	to := from.Add(rollupChunk)
+	if to.After(target) {
+		to = target
+	}
+	if err := rebuildRollupHours(tx, from, to); err != nil {
+		return false, err
+	}
+	// 重建结束于本段内的自然日（UTC）
+	for day := from.Truncate(24 * time.Hour); !day.Add(24 * time.Hour).After(to); day = day.Add(24 * time.Hour) {
+		if err := rebuildRollupDay(tx, day); err != nil {
+			return false, err
+		}
+	}
+	if err := setRollupWatermark(tx, to); err != nil {
+		return false, err
+	}
+	return !to.Before(target), tx.Commit()
+}
+
+func rebuildRollupHours(tx *sql.Tx, from, to time.Time) error {
+	if _, err := tx.Exec("DELETE FROM "+rollupHourlyTable+" WHERE bucket >= ? AND bucket < ?", from.Format(timeLayout), to.Format(timeLayout)); err != nil {
+		return err
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) SELECT strftime('%%Y-%%m-%%d %%H:00:00', bucket), platform, provider, model, project, app_name, %s FROM (%s) WHERE bucket IS NOT NULL GROUP BY 1, 2, 3, 4, 5, 6",
+		rollupHourlyTable, strings.Join(rollupColumns, ", "), rollupSums, rawUsageRowsSQL)
+	_, err := tx.Exec(insertSQL, from.Format(timeLayout), to.Format(timeLayout))
+	return err
+}
+
+func rebuildRollupDay(tx *sql.Tx, day time.Time) error {
+	if _, err := tx.Exec("DELETE FROM "+rollupDailyTable+" WHERE bucket = ?", day.Format(timeLayout)); err != nil {
+		return err
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) SELECT ?, platform, provider, model, project, app_name, %s FROM %s WHERE bucket >= ? AND bucket < ? GROUP BY 2, 3, 4, 5, 6",
+		rollupDailyTable, strings.Join(rollupColumns, ", "), rollupSums, rollupHourlyTable)
+	_, err := tx.Exec(insertSQL, day.Format(timeLayout), day.Format(timeLayout), day.Add(24*time.Hour).Format(timeLayout))
+	return err
+}
+
+func setRollupWatermark(tx *sql.Tx, t time.Time) error {
+	_, err := tx.Exec("UPDATE "+rollupStateTable+" SET value = ? WHERE name = ?", t.Format(timeLayout), rollupWatermarkKey)
+	return err
+}
+
+// rewindRollups 写入早于水位线的日志（磁盘回放）后，把水位线退回到该小时，下次汇总时重算
+func rewindRollups(tx *sql.Tx, createdAt string) error {
+	t, ok := parseRollupTime(createdAt)
+	if !ok {
+		return nil
+	}
+	hour := t.Truncate(time.Hour).Format(timeLayout)
+	_, err := tx.Exec("UPDATE "+rollupStateTable+" SET value = ? WHERE name = ? AND value > ?", hour, rollupWatermarkKey, hour)
+	return err
+}
+
+// pruneRollups 清理早于 cutoff 的汇总行，并重算 cutoff 所在的小时与自然日
+func pruneRollups(db *sql.DB, cutoff time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT OR IGNORE INTO "+rollupStateTable+" (name, value) VALUES (?, '')", rollupWatermarkKey); err != nil {
+		return err
+	}
+	var value string
+	if err := tx.QueryRow("SELECT value FROM "+rollupStateTable+" WHERE name = ?", rollupWatermarkKey).Scan(&value); err != nil {
+		return err
+	}
+	hour := cutoff.UTC().Truncate(time.Hour)
+	day := hour.Truncate(24 * time.Hour)
+	if _, err := tx.Exec("DELETE FROM "+rollupHourlyTable+" WHERE bucket < ?", hour.Format(timeLayout)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+rollupDailyTable+" WHERE bucket < ?", day.Format(timeLayout)); err != nil {
+		return err
+	}
+	if watermark, ok := parseRollupTime(value); ok && hour.Before(watermark) {
+		if err := rebuildRollupHours(tx, hour, hour.Add(time.Hour)); err != nil {
+			return err
+		}
+		if !day.Add(24 * time.Hour).After(watermark) {
+			if err := rebuildRollupDay(tx, day); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// requestLogUsageSource 返回覆盖 [start, end) 的用量子查询（列同 rollupColumns）：
+// 完整小时读小时表（useDaily 时完整的 UTC 自然日读日表，只适合不按时间分桶的合计），
+// 首尾不足一小时及水位线之后的部分回退到原始日志。
+// start 为零值表示不限起点；db 为 nil 或汇总表不可用时整体回退到原始日志
+func requestLogUsageSource(db *sql.DB, start, end time.Time, useDaily bool) (string, []any) {
+	start, end = start.UTC(), end.UTC()
+	raw := func(from, to time.Time) (string, []any) {
+		lower := ""
+		if !from.IsZero() {
+			lower = from.Format(timeLayout)
+		}
+		return rawUsageRowsSQL, []any{lower, to.Format(timeLayout)}
+	}
+	rollup := func(table string, from, to time.Time) (string, []any) {
+		return fmt.Sprintf("SELECT %s FROM %s WHERE bucket >= ? AND bucket < ?", strings.Join(rollupColumns, ", "), table),
+			[]any{from.Format(timeLayout), to.Format(timeLayout)}
+	}
+
+	var value string
+	if db == nil {
+		query, args := raw(start, end)
+		return "(" + query + ")", args
+	}
+	if err := db.QueryRow("SELECT value FROM "+rollupStateTable+" WHERE name = ?", rollupWatermarkKey).Scan(&value); err != nil {
+		query, args := raw(start, end)
+		return "(" + query + ")", args
+	}
+	watermark, ok := parseRollupTime(value)
+	lo := start.Truncate(time.Hour)
+	if lo.Before(start) {
+		lo = lo.Add(time.Hour)
+	}
+	hi := end.Truncate(time.Hour)
+	if ok && watermark.Before(hi) {
+		hi = watermark
+	}
+	if !ok || !lo.Before(hi) {
+		query, args := raw(start, end)
+		return "(" + query + ")", args
+	}
+
+	var parts []string
+	var args []any
+	add := func(query string, partArgs []any) {
+		parts = append(parts, query)
+		args = append(args, partArgs...)
+	}
+	if start.Before(lo) {
+		add(raw(start, lo))
+	}
+	dayLo := lo.Truncate(24 * time.Hour)
+	if dayLo.Before(lo) {
+		dayLo = dayLo.Add(24 * time.Hour)
+	}
+	dayHi := hi.Truncate(24 * time.Hour)
+	if useDaily && dayLo.Before(dayHi) {
+		if lo.Before(dayLo) {
+			add(rollup(rollupHourlyTable, lo, dayLo))
+		}
+		add(rollup(rollupDailyTable, dayLo, dayHi))
+		if dayHi.Before(hi) {
+			add(rollup(rollupHourlyTable, dayHi, hi))
+		}
+	} else {
+		add(rollup(rollupHourlyTable, lo, hi))
+	}
+	if hi.Before(end) {
+		add(raw(hi, end))
+	}
+	return "(" + strings.Join(parts, " UNION ALL ") + ")", args
+}
+
+// parseRollupTime 解析 UTC 时间字符串（timeLayout 或 RFC3339）
+func parseRollupTime(value string) (time.Time, bool) {
+	for _, layout := range []string{timeLayout, time.RFC3339} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
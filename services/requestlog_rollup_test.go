@@ -0,0 +1,146 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestLogRollups(t *testing.T) {
+	db := openAnalyticsDB(t, "rollup.db")
+
+	now := time.Now().UTC()
+	insert := func(at time.Time, platform string, code int, cost float64) {
+		t.Helper()
+		if _, err := db.Exec("INSERT INTO request_log (platform, provider, model, http_code, input_tokens, output_tokens, duration_sec, total_cost, created_at) VALUES (?, 'p', 'm', ?, 10, 5, 2, ?, ?)",
+			platform, code, cost, at.Format(timeLayout)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert(now.AddDate(0, 0, -3), "claude", 200, 1)
+	insert(now.AddDate(0, 0, -3).Add(time.Minute), "codex", 500, 2)
+	insert(now.AddDate(0, 0, -1), "claude", 200, 4)
+	insert(now.Add(-2*time.Hour), "claude", 200, 8)
+	insert(now, "codex", 200, 16)
+
+	prs := &ProviderRelayService{}
+	check := func(stage string, requests int, cost float64) {
+		t.Helper()
+		stats, err := prs.GetLogStatistics("all")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalRequests != requests || stats.TotalCost != cost || stats.AvgDuration != 2 {
+			t.Fatalf("%s: unexpected stats %+v", stage, stats)
+		}
+		heatmap, err := NewLogService().HeatmapStats(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var heatmapRequests int64
+		for _, stat := range heatmap {
+			heatmapRequests += stat.TotalRequests
+		}
+		if heatmapRequests != int64(requests) {
+			t.Fatalf("%s: heatmap covers %d requests, want %d", stage, heatmapRequests, requests)
+		}
+	}
+
+	// 汇总前全部读原始表
+	check("raw", 5, 31)
+	if err := refreshRequestLogRollups(db, now); err != nil {
+		t.Fatal(err)
+	}
+	var hourly, daily int
+	db.QueryRow("SELECT COALESCE(SUM(requests), 0) FROM request_log_hourly").Scan(&hourly)
+	db.QueryRow("SELECT COALESCE(SUM(requests), 0) FROM request_log_daily").Scan(&daily)
+	if hourly < 3 || daily < 2 {
+		t.Fatalf("expected completed hours and days to be rolled up, got hourly=%d daily=%d", hourly, daily)
+	}
+	// 汇总表 + 当前小时原始表与原始结果一致
+	check("rollup", 5, 31)
+	week, _ := prs.GetLogStatistics("week")
+	if week.TotalRequests != 5 || week.SuccessRate != 80 || week.ByPlatform["claude"] != 3 {
+		t.Fatalf("unexpected week stats: %+v", week)
+	}
+
+	// 回放早于水位线的日志会回退水位线，重新汇总后计入
+	replayed := now.AddDate(0, 0, -2).Add(-time.Hour).Format(timeLayout)
+	if err := prs.writeRequestLogs([]*ReqeustLog{{Platform: "claude", HttpCode: 200, DurationSec: 2, TotalCost: 32, CreatedAt: replayed}}); err != nil {
+		t.Fatal(err)
+	}
+	check("rewound", 6, 63)
+	if err := refreshRequestLogRollups(db, now); err != nil {
+		t.Fatal(err)
+	}
+	check("replayed", 6, 63)
+
+	// 清理旧日志时同步清理汇总行
+	if deleted, err := prs.CleanupOldLogs(2); err != nil || deleted != 3 {
+		t.Fatalf("expected 3 logs to be cleaned up, got %d (%v)", deleted, err)
+	}
+	check("pruned", 3, 28)
+	var stale int
+	db.QueryRow("SELECT count(*) FROM request_log_hourly WHERE bucket < ?", now.AddDate(0, 0, -2).Format(timeLayout)).Scan(&stale)
+	if stale != 0 {
+		t.Fatalf("expected old hourly rollups to be pruned, got %d", stale)
+	}
+
+	stats, err := NewLogService().StatsSince("claude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seriesRequests int64
+	for _, s := range stats.Series {
+		seriesRequests += s.TotalRequests
+	}
+	if len(stats.Series) != 24 || seriesRequests != stats.TotalRequests {
+		t.Fatalf("unexpected today stats: %+v", stats)
+	}
+}
+
+func TestRequestLogRollupsByApp(t *testing.T) {
+	db := openTestRelayDB(t, "rollup-app.db")
+
+	// 旧版汇总表没有 app_name 维度：初始化时删除并清空水位线，重新从原始日志汇总
+	for _, stmt := range []string{
+		"CREATE TABLE request_log_hourly (bucket TEXT NOT NULL, platform TEXT NOT NULL DEFAULT '', provider TEXT NOT NULL DEFAULT '', model TEXT NOT NULL DEFAULT '', project TEXT NOT NULL DEFAULT '', requests INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (bucket, platform, provider, model, project))",
+		"CREATE TABLE request_log_rollup_state (name TEXT PRIMARY KEY, value TEXT NOT NULL DEFAULT '')",
+		"INSERT INTO request_log_rollup_state (name, value) VALUES ('hourly_watermark', '2020-01-01 00:00:00')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ensureRequestLogTable(); err != nil {
+		t.Fatal(err)
+	}
+	var watermarks int
+	db.QueryRow("SELECT COUNT(*) FROM request_log_rollup_state").Scan(&watermarks)
+	if watermarks != 0 {
+		t.Fatal("outdated rollups should reset the watermark")
+	}
+
+	now := time.Now().UTC()
+	insert := func(at time.Time, app string, cost float64) {
+		t.Helper()
+		if _, err := db.Exec("INSERT INTO request_log (platform, provider, model, app_name, http_code, total_cost, created_at) VALUES ('codex', 'p', 'm', ?, 200, ?, ?)",
+			app, cost, at.Format(timeLayout)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert(now.AddDate(0, 0, -2), ClientAppCursor, 1)
+	insert(now.AddDate(0, 0, -2), ClientAppCodex, 2)
+	insert(now.Add(-3*time.Hour), ClientAppCursor, 4)
+	insert(now, "", 8)
+	if err := refreshRequestLogRollups(db, now); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := (&ProviderRelayService{}).GetLogStatistics("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ByApp[ClientAppCursor] != 2 || stats.CostByApp[ClientAppCursor] != 5 || stats.ByApp[ClientAppCodex] != 1 || stats.ByApp[ClientAppUnknown] != 1 {
+		t.Fatalf("unexpected per-app stats: %v / %v", stats.ByApp, stats.CostByApp)
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// logTailBuffer 每个订阅者的缓冲条数，消费过慢时丢弃新日志而不是阻塞写入队列
+	logTailBuffer = 256
+	// logTailHeartbeat 空闲时的心跳间隔，防止代理 / 客户端因超时断开
+	logTailHeartbeat = 15 * time.Second
+)
+
+// LogTailFilter live tail 过滤条件，空值表示不过滤
+type LogTailFilter struct {
+	Platform   string `json:"platform"`
+	Provider   string `json:"provider"`
+	Model      string `json:"model"` // 支持通配符，如 claude-*
+	ErrorsOnly bool   `json:"errors_only"`
+}
+
+// match 判断日志是否命中过滤条件
+func (f LogTailFilter) match(log *ReqeustLog) bool {
+	if f.Platform != "" && !strings.EqualFold(f.Platform, log.Platform) {
+		return false
+	}
+	if f.Provider != "" && !strings.EqualFold(f.Provider, log.Provider) {
+		return false
+	}
+	if f.Model != "" && !matchWildcard(f.Model, log.Model) {
+		return false
+	}
+	if f.ErrorsOnly && log.HttpCode < 400 && log.ErrorType == "" {
+		return false
+	}
+	return true
+}
+
+// logTailSubscriber 单个 live tail 订阅
+type logTailSubscriber struct {
+	filter LogTailFilter
+	ch     chan ReqeustLog
+}
+
+// logTailHub 新写入的 request_log 广播
+type logTailHub struct {
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]*logTailSubscriber
+	handlers    []func(ReqeustLog)
+	token       string
+}
+
+// SubscribeRequestLogs 订阅新写入的请求日志，返回日志通道与取消函数
+func (prs *ProviderRelayService) SubscribeRequestLogs(filter LogTailFilter) (<-chan ReqeustLog, func()) {
+	sub := &logTailSubscriber{filter: filter, ch: make(chan ReqeustLog, logTailBuffer)}
+
+	prs.logTail.mu.Lock()
+	if prs.logTail.subscribers == nil {
+		prs.logTail.subscribers = make(map[int]*logTailSubscriber)
+	}
+	id := prs.logTail.nextID
+	prs.logTail.nextID++
+	prs.logTail.subscribers[id] = sub
+	prs.logTail.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			prs.logTail.mu.Lock()
+			delete(prs.logTail.subscribers, id)
+			prs.logTail.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+	return sub.ch, cancel
+}
+
+// OnRequestLog 注册新日志回调（桌面端用于推送 Wails 事件）
+func (prs *ProviderRelayService) OnRequestLog(handler func(ReqeustLog)) {
+	prs.logTail.mu.Lock()
+	prs.logTail.handlers = append(prs.logTail.handlers, handler)
+	prs.logTail.mu.Unlock()
+}
+
+// publishRequestLog 日志写入数据库后广播给订阅者，不阻塞写入队列
+func (prs *ProviderRelayService) publishRequestLog(log *ReqeustLog) {
+	if log.CreatedAt == "" {
+		// 与 SQLite CURRENT_TIMESTAMP 格式一致（UTC）
+		log.CreatedAt = time.Now().UTC().Format("2006-01-02 15:04:05")
+	}
+	prs.recordRequestStatus(log)
+
+	prs.logTail.mu.Lock()
+	defer prs.logTail.mu.Unlock()
+	for _, sub := range prs.logTail.subscribers {
+		if !sub.filter.match(log) {
+			continue
+		}
+		select {
+		case sub.ch <- *log:
+		default:
+			// 订阅者消费过慢，丢弃本条
+		}
+	}
+	for _, handler := range prs.logTail.handlers {
+		go handler(*log)
+	}
+}
+
+// SetLogTailToken 设置 live tail 接口的访问令牌；为空时仅允许本机访问
+func (prs *ProviderRelayService) SetLogTailToken(token string) {
+	prs.logTail.mu.Lock()
+	prs.logTail.token = strings.TrimSpace(token)
+	prs.logTail.mu.Unlock()
+}
+
+// authorizeLogTail 日志包含客户端 IP、用户标识等信息，默认只对本机开放
+func (prs *ProviderRelayService) authorizeLogTail(c *gin.Context) bool {
+	prs.logTail.mu.Lock()
+	token := prs.logTail.token
+	prs.logTail.mu.Unlock()
+	if token != "" {
+		return c.GetHeader("Authorization") == "Bearer "+token
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	return ip != nil && ip.IsLoopback()
+}
+
+// logTailFilterFromQuery 从查询参数解析过滤条件
+func logTailFilterFromQuery(c *gin.Context) LogTailFilter {
+	errorsOnly, _ := strconv.ParseBool(c.Query("errors_only"))
+	return LogTailFilter{
+		Platform:   c.Query("platform"),
+		Provider:   c.Query("provider"),
+		Model:      c.Query("model"),
+		ErrorsOnly: errorsOnly,
+	}
+}
+
+// logTailHandler GET /v1/logs/tail：以分块传输持续输出新日志
+// 默认每行一个 JSON（NDJSON，适合 curl --no-buffer）；Accept: text/event-stream 时输出 SSE
+func (prs *ProviderRelayService) logTailHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !prs.authorizeLogTail(c) {
+			markAuthFailure(c)
+			c.JSON(http.StatusForbidden, gin.H{"error": "log tail is only available from localhost or with a valid token"})
+			return
+		}
+		prs.streamLogTail(c)
+	}
+}
+
+// streamLogTail 按查询参数过滤并持续推送新日志（Accept: text/event-stream 时为 SSE，否则为 NDJSON）
+func (prs *ProviderRelayService) streamLogTail(c *gin.Context) {
+	filter := logTailFilterFromQuery(c)
+	sse := strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+
+	logs, cancel := prs.SubscribeRequestLogs(filter)
+	defer cancel()
+
+	if sse {
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(logTailHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case log, ok := <-logs:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(log)
+			if err != nil {
+				continue
+			}
+			if sse {
+				fmt.Fprintf(c.Writer, "event: request_log\ndata: %s\n\n", data)
+			} else {
+				c.Writer.Write(append(data, '\n'))
+			}
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			if sse {
+				fmt.Fprint(c.Writer, ": ping\n\n")
+			} else {
+				fmt.Fprint(c.Writer, "\n")
+			}
+			c.Writer.Flush()
+		}
+	}
+}
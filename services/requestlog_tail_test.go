@@ -0,0 +1,83 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSubscribeRequestLogsFilter(t *testing.T) {
+	prs := &ProviderRelayService{}
+	logs, cancel := prs.SubscribeRequestLogs(LogTailFilter{Platform: "claude", ErrorsOnly: true})
+	defer cancel()
+
+	prs.publishRequestLog(&ReqeustLog{TraceID: "ok", Platform: "claude", HttpCode: 200})
+	prs.publishRequestLog(&ReqeustLog{TraceID: "codex-err", Platform: "codex", HttpCode: 500})
+	prs.publishRequestLog(&ReqeustLog{TraceID: "timeout", Platform: "claude", ErrorType: errorTypeReadTimeout})
+
+	select {
+	case log := <-logs:
+		if log.TraceID != "timeout" || log.CreatedAt == "" {
+			t.Fatalf("unexpected log %+v", log)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a matching log")
+	}
+	select {
+	case log := <-logs:
+		t.Fatalf("unexpected extra log %+v", log)
+	default:
+	}
+
+	cancel()
+	prs.publishRequestLog(&ReqeustLog{TraceID: "after-cancel", Platform: "claude", HttpCode: 500})
+}
+
+func TestLogTailHandlerStreamsNDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	router := gin.New()
+	router.GET("/v1/logs/tail", prs.logTailHandler())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/logs/tail?provider=chaos")
+	if err != nil {
+		t.Fatalf("tail request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	// 等待订阅建立后再发布
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		prs.publishRequestLog(&ReqeustLog{TraceID: "skip", Provider: "other"})
+		prs.publishRequestLog(&ReqeustLog{TraceID: "want", Provider: "chaos"})
+	}()
+
+	line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("read line: %v", err)
+	}
+	var log ReqeustLog
+	if err := json.Unmarshal(line, &log); err != nil || log.TraceID != "want" {
+		t.Fatalf("unexpected line %q (%v)", line, err)
+	}
+
+	prs.SetLogTailToken("secret")
+	denied, err := http.Get(server.URL + "/v1/logs/tail")
+	if err != nil {
+		t.Fatalf("tail request: %v", err)
+	}
+	denied.Body.Close()
+	if denied.StatusCode != http.StatusForbidden {
+		t.Errorf("missing token should be rejected, got %d", denied.StatusCode)
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 日志窗口：独立窗口中可选择显示的列、保存常用过滤条件（LogFilter），并通过深链接直接定位某个 trace
+// （如从系统通知打开）。新日志通过 request-log:new 事件推送，窗口重新获得焦点或事件丢失时
+// 用 QueryLogsSince 按 id 增量补齐
+
+const (
+	// logViewerMaxPresets 最多保存的过滤预设数
+	logViewerMaxPresets = 50
+	// logViewerMaxLimit 单次查询最多返回的日志条数
+	logViewerMaxLimit = 1000
+)
+
+// defaultLogViewerColumns 未设置时显示的列，与日志表格默认列一致
+var defaultLogViewerColumns = []string{
+	"created_at", "trace_id", "platform", "provider", "model", "http_code", "error_type", "duration_sec",
+}
+
+// LogViewerLink 日志窗口深链接，空值表示不过滤
+type LogViewerLink struct {
+	TraceID        string `json:"trace_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Platform       string `json:"platform,omitempty"`
+	Provider       string `json:"provider,omitempty"`
+	ErrorsOnly     bool   `json:"errors_only,omitempty"`
+}
+
+// LogViewerPreset 命名的过滤预设
+type LogViewerPreset struct {
+	Name   string    `json:"name"`
+	Filter LogFilter `json:"filter"`
+}
+
+// LogViewerSettings 日志窗口偏好
+type LogViewerSettings struct {
+	Columns []string          `json:"columns"`
+	Presets []LogViewerPreset `json:"presets"`
+}
+
+// logViewerMu 保护 log-viewer.json 的读改写，多个日志窗口可能同时保存
+var logViewerMu sync.Mutex
+
+// logViewerSettingsPath 日志窗口偏好文件
+func logViewerSettingsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "log-viewer.json"), nil
+}
+
+// requestLogFields ReqeustLog 的 JSON 字段名，即可选的列
+func requestLogFields() map[string]bool {
+	columns := make(map[string]bool)
+	t := reflect.TypeOf(ReqeustLog{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			columns[name] = true
+		}
+	}
+	return columns
+}
+
+// URL 日志窗口路由，前端按查询参数设置过滤条件并定位 trace
+func (link LogViewerLink) URL() string {
+	values := url.Values{}
+	for key, value := range map[string]string{
+		"trace":        link.TraceID,
+		"conversation": link.ConversationID,
+		"platform":     link.Platform,
+		"provider":     link.Provider,
+	} {
+		if value = strings.TrimSpace(value); value != "" {
+			values.Set(key, value)
+		}
+	}
+	if link.ErrorsOnly {
+		values.Set("errors_only", "1")
+	}
+	if len(values) == 0 {
+		return "/#/logs"
+	}
+	return "/#/logs?" + values.Encode()
+}
+
+// loadLogViewerSettings 读取偏好，文件不存在时返回默认列
+func loadLogViewerSettings() (LogViewerSettings, error) {
+	settings := LogViewerSettings{}
+	path, err := logViewerSettingsPath()
+	if err != nil {
+		return settings, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return settings, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			fmt.Printf("[LogViewer] 解析 %s 失败: %v\n", path, err)
+			settings = LogViewerSettings{}
+		}
+	}
+	if len(settings.Columns) == 0 {
+		settings.Columns = append([]string(nil), defaultLogViewerColumns...)
+	}
+	if settings.Presets == nil {
+		settings.Presets = []LogViewerPreset{}
+	}
+	return settings, nil
+}
+
+// saveLogViewerSettings 持久化偏好到 log-viewer.json
+func saveLogViewerSettings(settings LogViewerSettings) error {
+	path, err := logViewerSettingsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// GetLogViewerSettings 获取日志窗口的列与过滤预设
+func (ls *LogService) GetLogViewerSettings() (LogViewerSettings, error) {
+	logViewerMu.Lock()
+	defer logViewerMu.Unlock()
+	return loadLogViewerSettings()
+}
+
+// SetLogViewerColumns 设置日志窗口显示的列（按顺序），为空时恢复默认列
+func (ls *LogService) SetLogViewerColumns(columns []string) (LogViewerSettings, error) {
+	known := requestLogFields()
+	seen := make(map[string]bool, len(columns))
+	cleaned := make([]string, 0, len(columns))
+	for _, column := range columns {
+		column = strings.TrimSpace(column)
+		if column == "" || seen[column] {
+			continue
+		}
+		if !known[column] {
+			return LogViewerSettings{}, fmt.Errorf("unknown log column %q", column)
+		}
+		seen[column] = true
+		cleaned = append(cleaned, column)
+	}
+
+	logViewerMu.Lock()
+	defer logViewerMu.Unlock()
+	settings, err := loadLogViewerSettings()
+	if err != nil {
+		return settings, err
+	}
+	settings.Columns = cleaned
+	if len(cleaned) == 0 {
+		settings.Columns = append([]string(nil), defaultLogViewerColumns...)
+	}
+	return settings, saveLogViewerSettings(settings)
+}
+
+// SaveLogViewerPreset 保存过滤预设，同名预设被覆盖
+func (ls *LogService) SaveLogViewerPreset(preset LogViewerPreset) (LogViewerSettings, error) {
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" {
+		return LogViewerSettings{}, fmt.Errorf("preset name is required")
+	}
+	// 预设只保存过滤条件，不保存分页与排序
+	preset.Filter.Page, preset.Filter.PageSize = 0, 0
+	preset.Filter.SortBy, preset.Filter.SortOrder = "", ""
+
+	logViewerMu.Lock()
+	defer logViewerMu.Unlock()
+	settings, err := loadLogViewerSettings()
+	if err != nil {
+		return settings, err
+	}
+	replaced := false
+	for i := range settings.Presets {
+		if settings.Presets[i].Name == preset.Name {
+			settings.Presets[i] = preset
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		if len(settings.Presets) >= logViewerMaxPresets {
+			return settings, fmt.Errorf("at most %d presets can be saved", logViewerMaxPresets)
+		}
+		settings.Presets = append(settings.Presets, preset)
+	}
+	return settings, saveLogViewerSettings(settings)
+}
+
+// DeleteLogViewerPreset 删除过滤预设
+func (ls *LogService) DeleteLogViewerPreset(name string) (LogViewerSettings, error) {
+	name = strings.TrimSpace(name)
+
+	logViewerMu.Lock()
+	defer logViewerMu.Unlock()
+	settings, err := loadLogViewerSettings()
+	if err != nil {
+		return settings, err
+	}
+	presets := settings.Presets[:0]
+	for _, preset := range settings.Presets {
+		if preset.Name != name {
+			presets = append(presets, preset)
+		}
+	}
+	settings.Presets = presets
+	return settings, saveLogViewerSettings(settings)
+}
+
+// QueryLogsSince 返回 id 大于 afterID 且命中过滤条件的日志，按 id 正序，用于日志窗口增量刷新
+func (prs *ProviderRelayService) QueryLogsSince(filter LogFilter, afterID int64, limit int) ([]ReqeustLog, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > logViewerMaxLimit {
+		limit = logViewerMaxLimit
+	}
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+	where, args := buildLogFilterWhere(filter)
+	args = append(args, afterID, limit)
+	rows, err := db.Query("SELECT "+requestLogColumns+" FROM request_log WHERE "+where+" AND id > ? ORDER BY id ASC LIMIT ?", args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []ReqeustLog{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := make([]ReqeustLog, 0)
+	for rows.Next() {
+		log, err := scanRequestLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+	return logs, rows.Err()
+}
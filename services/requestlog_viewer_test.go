@@ -0,0 +1,140 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestLogViewerSettingsColumnsAndPresets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ls := &LogService{}
+
+	settings, err := ls.GetLogViewerSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.Columns) != len(defaultLogViewerColumns) || len(settings.Presets) != 0 {
+		t.Fatalf("expected default settings, got %+v", settings)
+	}
+
+	if _, err := ls.SetLogViewerColumns([]string{"trace_id", "no_such_column"}); err == nil {
+		t.Fatal("expected unknown column to be rejected")
+	}
+	settings, err = ls.SetLogViewerColumns([]string{" total_cost ", "trace_id", "total_cost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(settings.Columns, ",") != "total_cost,trace_id" {
+		t.Fatalf("unexpected columns %v", settings.Columns)
+	}
+
+	hasError := true
+	if _, err := ls.SaveLogViewerPreset(LogViewerPreset{Name: "errors", Filter: LogFilter{Platform: "claude", HasError: &hasError, Page: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.SaveLogViewerPreset(LogViewerPreset{Name: "codex", Filter: LogFilter{Platform: "codex"}}); err != nil {
+		t.Fatal(err)
+	}
+	// 同名预设覆盖
+	if _, err := ls.SaveLogViewerPreset(LogViewerPreset{Name: "codex", Filter: LogFilter{Platform: "codex", Provider: "openai"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.SaveLogViewerPreset(LogViewerPreset{Name: "  "}); err == nil {
+		t.Fatal("expected empty preset name to be rejected")
+	}
+
+	settings, err = ls.GetLogViewerSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.Presets) != 2 || settings.Presets[1].Filter.Provider != "openai" {
+		t.Fatalf("unexpected presets %+v", settings.Presets)
+	}
+	if settings.Presets[0].Filter.Page != 0 || settings.Presets[0].Filter.HasError == nil || !*settings.Presets[0].Filter.HasError {
+		t.Fatalf("preset should keep filters but drop paging: %+v", settings.Presets[0].Filter)
+	}
+
+	settings, err = ls.DeleteLogViewerPreset("errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.Presets) != 1 || settings.Presets[0].Name != "codex" {
+		t.Fatalf("unexpected presets after delete %+v", settings.Presets)
+	}
+}
+
+func TestLogViewerLinkURL(t *testing.T) {
+	if got := (LogViewerLink{}).URL(); got != "/#/logs" {
+		t.Fatalf("unexpected empty link %q", got)
+	}
+	got := LogViewerLink{TraceID: "trace 1", Platform: "claude", ErrorsOnly: true}.URL()
+	route, query, ok := strings.Cut(got, "?")
+	if !ok || route != "/#/logs" {
+		t.Fatalf("unexpected link %q", got)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values.Get("trace") != "trace 1" || values.Get("platform") != "claude" || values.Get("errors_only") != "1" || values.Has("provider") {
+		t.Fatalf("unexpected link query %v", values)
+	}
+}
+
+func TestQueryLogsSince(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []struct {
+		trace    string
+		platform string
+		code     int
+	}{
+		{"a", "claude", 200}, {"b", "codex", 200}, {"c", "claude", 500}, {"d", "claude", 200},
+	} {
+		if _, err := db.Exec(`INSERT INTO request_log (trace_id, platform, model, provider, http_code) VALUES (?, ?, 'm', 'p', ?)`,
+			row.trace, row.platform, row.code); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prs := &ProviderRelayService{}
+	logs, err := prs.QueryLogsSince(LogFilter{Platform: "claude"}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].TraceID != "c" || logs[1].TraceID != "d" {
+		t.Fatalf("expected newer claude logs in id order, got %+v", logs)
+	}
+
+	hasError := true
+	logs, err = prs.QueryLogsSince(LogFilter{HasError: &hasError}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].TraceID != "c" {
+		t.Fatalf("expected only the failed request, got %+v", logs)
+	}
+}
+
+func TestAllFailedNotificationLinksToTrace(t *testing.T) {
+	ns, _ := newTestNotificationService(t, AppSettings{})
+	recorder := &notificationRecorder{}
+	ns.SetSender(recorder.send)
+
+	ns.handleProviderEvent(ProviderEvent{Type: ProviderEventAllFailed, Platform: "claude", Reason: "boom", TraceID: "trace-9"})
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.sent) != 1 || recorder.sent[0].Link == nil {
+		t.Fatalf("expected a linked notification, got %+v", recorder.sent)
+	}
+	if link := recorder.sent[0].Link; link.TraceID != "trace-9" || link.Platform != "claude" || !link.ErrorsOnly {
+		t.Fatalf("unexpected link %+v", link)
+	}
+}
@@ -0,0 +1,385 @@
+package services
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 表结构迁移：按版本号顺序执行，已执行的版本记录在 schema_migrations 表中。
+//
+// 新的表结构变更请新增迁移，而不是修改已发布的迁移：
+//   - 纯 SQL 变更放在 schema_migrations/NNNN_name.up.sql（可选配套 NNNN_name.down.sql），在事务中执行
+//   - SQLite 无法用纯 SQL 幂等表达的变更（如缺列时补列）注册到 goSchemaMigrations
+//
+// schema_version 表归 SSOT 迁移（services/migration）所有，两者的版本号互不相关。
+// 版本 1-4 是引入迁移框架时的基线，旧库中这些表可能早已存在并有数据，因此只能前进、不可回滚；
+// 只有新增迁移才应提供 down，且 down 只能撤销对应 up 实际创建的对象。
+
+//go:embed schema_migrations/*.sql
+var schemaMigrationFS embed.FS
+
+// SchemaMigration 一个带版本号的表结构迁移
+type SchemaMigration struct {
+	Version int
+	Name    string
+	UpSQL   string
+	DownSQL string
+	// Go 迁移（与 UpSQL 二选一），不在事务中执行，必须可重复执行
+	Up   func(db *sql.DB) error
+	Down func(db *sql.DB) error
+}
+
+// Reversible 是否提供回滚
+func (m SchemaMigration) Reversible() bool {
+	return m.DownSQL != "" || m.Down != nil
+}
+
+func (m SchemaMigration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// SchemaMigrationStatus 单个迁移的执行状态
+type SchemaMigrationStatus struct {
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Applied    bool   `json:"applied"`
+	AppliedAt  string `json:"applied_at,omitempty"`
+	Reversible bool   `json:"reversible"`
+	Unknown    bool   `json:"unknown,omitempty"` // 数据库中存在、当前程序不认识的版本（通常由更新版本写入）
+}
+
+// MigrateOptions 迁移选项
+type MigrateOptions struct {
+	DryRun bool // 只列出将要执行的迁移，不修改数据库
+	Target int  // 迁移到的版本，0 表示最新
+}
+
+// MigrationStep 已执行（或 dry-run 时将要执行）的一步
+type MigrationStep struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"` // "up" / "down"
+	SQL       string `json:"sql,omitempty"`
+}
+
+// MigrationReport 一次迁移 / 回滚的结果
+type MigrationReport struct {
+	DryRun  bool            `json:"dry_run"`
+	Version int             `json:"version"` // 执行后（dry-run 时为预计）的最高已执行版本
+	Steps   []MigrationStep `json:"steps"`
+}
+
+// goSchemaMigrations 以 Go 实现的迁移，版本号不能与 schema_migrations/*.sql 重复
+var goSchemaMigrations = []SchemaMigration{
+	{Version: 1, Name: "request_log", Up: migrateRequestLogBaseline},
+	{Version: 2, Name: "feature_tables", Up: migrateFeatureTables},
+}
+
+// migrateFeatureTables 迁移 2：引入迁移框架前按功能零散创建的表
+func migrateFeatureTables(db *sql.DB) error {
+	for _, ensure := range []func(*sql.DB) error{
+		ensureGuardrailTable,
+		ensureSecurityEventsTable,
+		ensureTranscriptTable,
+		ensureQualityTable,
+		ensureIncidentTable,
+		ensureSlowRequestTable,
+		// 按小时 / 自然日汇总的用量表，供统计查询使用
+		ensureRollupTables,
+	} {
+		if err := ensure(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var schemaMigrations = sync.OnceValues(func() ([]SchemaMigration, error) {
+	return loadSchemaMigrations(schemaMigrationFS, "schema_migrations", goSchemaMigrations)
+})
+
+// loadSchemaMigrations 合并 SQL 文件与 Go 迁移，按版本号排序
+func loadSchemaMigrations(fsys fs.FS, dir string, goMigrations []SchemaMigration) ([]SchemaMigration, error) {
+	byVersion := map[int]*SchemaMigration{}
+	for _, m := range goMigrations {
+		if byVersion[m.Version] != nil {
+			return nil, fmt.Errorf("迁移版本 %d 重复", m.Version)
+		}
+		byVersion[m.Version] = &m
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	sqlVersions := map[int]bool{}
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		number, name, hasName := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || !hasName || err != nil || version <= 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("迁移文件名无效: %s（应为 NNNN_name.up.sql / NNNN_name.down.sql）", file)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &SchemaMigration{Version: version, Name: name}
+			byVersion[version] = m
+			sqlVersions[version] = true
+		} else if !sqlVersions[version] || m.Name != name {
+			return nil, fmt.Errorf("迁移版本 %d 重复: %s", version, file)
+		}
+		if direction == "up" {
+			m.UpSQL = string(data)
+		} else {
+			m.DownSQL = string(data)
+		}
+	}
+
+	migrations := make([]SchemaMigration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil && m.UpSQL == "" {
+			return nil, fmt.Errorf("迁移 %s 缺少 up", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b SchemaMigration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+type appliedSchemaVersion struct {
+	name      string
+	appliedAt string
+}
+
+// ensureSchemaMigrationsTable 创建记录已执行迁移的 schema_migrations 表
+func ensureSchemaMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// readSchemaVersions 读取已执行的版本；表不存在时返回空（dry-run 不建表）
+func readSchemaVersions(db *sql.DB) (map[int]appliedSchemaVersion, error) {
+	applied := map[int]appliedSchemaVersion{}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&count); err != nil || count == 0 {
+		return applied, err
+	}
+
+	rows, err := db.Query("SELECT version, name, COALESCE(CAST(applied_at AS TEXT), '') FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var row appliedSchemaVersion
+		if err := rows.Scan(&version, &row.name, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+func (m SchemaMigration) isApplied(applied map[int]appliedSchemaVersion) bool {
+	_, ok := applied[m.Version]
+	return ok
+}
+
+// MigrateSchema 按顺序执行所有未执行的迁移（桌面端与 Gateway 启动时各执行一次）
+func MigrateSchema(db *sql.DB, opts MigrateOptions) (MigrationReport, error) {
+	migrations, err := schemaMigrations()
+	if err != nil {
+		return MigrationReport{DryRun: opts.DryRun}, err
+	}
+	return migrateSchema(db, migrations, opts)
+}
+
+func migrateSchema(db *sql.DB, migrations []SchemaMigration, opts MigrateOptions) (MigrationReport, error) {
+	report := MigrationReport{DryRun: opts.DryRun}
+	if !opts.DryRun {
+		if err := ensureSchemaMigrationsTable(db); err != nil {
+			return report, fmt.Errorf("初始化 schema_migrations 失败: %w", err)
+		}
+	}
+	applied, err := readSchemaVersions(db)
+	if err != nil {
+		return report, err
+	}
+	for version := range applied {
+		if !slices.ContainsFunc(migrations, func(m SchemaMigration) bool { return m.Version == version }) {
+			fmt.Printf("[Migration] 数据库包含未知的表结构版本 %d（可能由更新版本的程序写入），已忽略\n", version)
+		}
+	}
+
+	for _, m := range migrations {
+		if opts.Target > 0 && m.Version > opts.Target {
+			break
+		}
+		if m.isApplied(applied) {
+			continue
+		}
+		report.Steps = append(report.Steps, MigrationStep{Version: m.Version, Name: m.Name, Direction: "up", SQL: m.UpSQL})
+		if opts.DryRun {
+			applied[m.Version] = appliedSchemaVersion{name: m.Name}
+			continue
+		}
+		if err := runSchemaMigration(db, m, true); err != nil {
+			return report, fmt.Errorf("执行迁移 %s 失败: %w", m, err)
+		}
+		applied[m.Version] = appliedSchemaVersion{name: m.Name}
+	}
+	report.Version = currentSchemaVersion(migrations, applied)
+	return report, nil
+}
+
+// RollbackSchema 回滚最近执行的 steps 个迁移；任一迁移不可回滚时不做任何修改
+func RollbackSchema(db *sql.DB, steps int, dryRun bool) (MigrationReport, error) {
+	migrations, err := schemaMigrations()
+	if err != nil {
+		return MigrationReport{DryRun: dryRun}, err
+	}
+	return rollbackSchema(db, migrations, steps, dryRun)
+}
+
+func rollbackSchema(db *sql.DB, migrations []SchemaMigration, steps int, dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{DryRun: dryRun}
+	applied, err := readSchemaVersions(db)
+	if err != nil {
+		return report, err
+	}
+
+	var targets []SchemaMigration
+	for i := len(migrations) - 1; i >= 0 && len(targets) < steps; i-- {
+		if m := migrations[i]; m.isApplied(applied) {
+			if !m.Reversible() {
+				return report, fmt.Errorf("迁移 %s 不可回滚", m)
+			}
+			targets = append(targets, m)
+		}
+	}
+
+	for _, m := range targets {
+		report.Steps = append(report.Steps, MigrationStep{Version: m.Version, Name: m.Name, Direction: "down", SQL: m.DownSQL})
+		if !dryRun {
+			if err := runSchemaMigration(db, m, false); err != nil {
+				return report, fmt.Errorf("回滚迁移 %s 失败: %w", m, err)
+			}
+		}
+		delete(applied, m.Version)
+	}
+	report.Version = currentSchemaVersion(migrations, applied)
+	return report, nil
+}
+
+// SchemaMigrationStatuses 列出所有迁移及其执行状态
+func SchemaMigrationStatuses(db *sql.DB) ([]SchemaMigrationStatus, error) {
+	migrations, err := schemaMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := readSchemaVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]SchemaMigrationStatus, 0, len(migrations))
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+		status := SchemaMigrationStatus{Version: m.Version, Name: m.Name, Applied: m.isApplied(applied), Reversible: m.Reversible()}
+		if status.Applied {
+			status.AppliedAt = applied[m.Version].appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		if !known[version] {
+			statuses = append(statuses, SchemaMigrationStatus{Version: version, Name: row.name, Applied: true, AppliedAt: row.appliedAt, Unknown: true})
+		}
+	}
+	slices.SortFunc(statuses, func(a, b SchemaMigrationStatus) int { return a.Version - b.Version })
+	return statuses, nil
+}
+
+func currentSchemaVersion(migrations []SchemaMigration, applied map[int]appliedSchemaVersion) int {
+	version := 0
+	for _, m := range migrations {
+		if m.isApplied(applied) {
+			version = m.Version
+		}
+	}
+	return version
+}
+
+// runSchemaMigration 执行一个迁移并更新 schema_migrations；SQL 迁移与版本记录在同一事务中
+func runSchemaMigration(db *sql.DB, m SchemaMigration, up bool) error {
+	record := func(exec func(string, ...any) (sql.Result, error)) error {
+		if !up {
+			_, err := exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		}
+		_, err := exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+		return err
+	}
+
+	goFn, script := m.Up, m.UpSQL
+	if !up {
+		goFn, script = m.Down, m.DownSQL
+	}
+	if goFn != nil {
+		if err := goFn(db); err != nil {
+			return err
+		}
+		return record(db.Exec)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+	if err := record(tx.Exec); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// OpenAppDatabase 直接打开 ~/.code-switch/app.db（供命令行迁移工具使用，不经过 xdb）
+func OpenAppDatabase() (*sql.DB, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", filepath.Join(home, ".code-switch", "app.db")+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("PRAGMA busy_timeout=5000"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,27 @@
+-- 按应用的代理开关与请求规则（此前只存在于 deploy/sqlite/schema_v2.sql，新安装缺表）
+CREATE TABLE IF NOT EXISTS proxy_control (
+    app_name TEXT PRIMARY KEY,
+    proxy_enabled INTEGER DEFAULT 1,
+    proxy_mode TEXT DEFAULT 'shared',
+    proxy_port INTEGER,
+    intercept_domains TEXT,
+    rules TEXT,
+    total_requests INTEGER DEFAULT 0,
+    last_request_at DATETIME,
+    last_toggled_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO proxy_control (app_name, proxy_enabled) VALUES
+    ('claude', 1),
+    ('codex', 1),
+    ('gemini', 1),
+    ('picoclaw', 1);
+
+CREATE TABLE IF NOT EXISTS proxy_rule_hits (
+    app_name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    hits INTEGER DEFAULT 0,
+    last_hit_at DATETIME,
+    PRIMARY KEY (app_name, rule)
+);
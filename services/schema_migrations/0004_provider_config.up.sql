@@ -0,0 +1,53 @@
+-- SSOT 供应商配置表（与 deploy/sqlite/schema_v2.sql 一致，数据迁移见 services/migration）
+CREATE TABLE IF NOT EXISTS provider_config (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    platform TEXT NOT NULL,
+    name TEXT NOT NULL,
+    api_url TEXT NOT NULL,
+    api_key TEXT NOT NULL,
+    official_site TEXT,
+    icon TEXT,
+    tint TEXT DEFAULT '#f0f0f0',
+    accent TEXT DEFAULT '#0a84ff',
+    enabled INTEGER DEFAULT 1,
+    supported_models TEXT,
+    model_mapping TEXT,
+    priority_level INTEGER DEFAULT 1,
+    weight INTEGER DEFAULT 100,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(platform, name)
+);
+CREATE INDEX IF NOT EXISTS idx_provider_platform ON provider_config(platform, enabled);
+CREATE INDEX IF NOT EXISTS idx_provider_priority ON provider_config(priority_level, enabled);
+CREATE INDEX IF NOT EXISTS idx_provider_updated ON provider_config(updated_at DESC);
+
+CREATE TABLE IF NOT EXISTS provider_health (
+    provider_id INTEGER PRIMARY KEY REFERENCES provider_config(id) ON DELETE CASCADE,
+    circuit_state TEXT DEFAULT 'closed',
+    consecutive_fails INTEGER DEFAULT 0,
+    fail_threshold INTEGER DEFAULT 5,
+    recovery_timeout_sec INTEGER DEFAULT 30,
+    total_requests INTEGER DEFAULT 0,
+    total_failures INTEGER DEFAULT 0,
+    success_rate REAL DEFAULT 1.0,
+    avg_latency_ms REAL DEFAULT 0,
+    last_success_at DATETIME,
+    last_failure_at DATETIME,
+    circuit_opened_at DATETIME,
+    last_checked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_health_state ON provider_health(circuit_state);
+CREATE INDEX IF NOT EXISTS idx_health_updated ON provider_health(updated_at DESC);
+
+CREATE TABLE IF NOT EXISTS proxy_live_backup (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    backup_type TEXT NOT NULL,
+    backup_data TEXT NOT NULL,
+    trigger_event TEXT,
+    backup_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+    restored INTEGER DEFAULT 0,
+    restored_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_backup_type_time ON proxy_live_backup(backup_type, backup_time DESC);
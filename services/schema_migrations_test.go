@@ -0,0 +1,188 @@
+package services
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func openMigrationTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func TestMigrateSchema(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	// dry-run 只列出计划，不建表
+	plan, err := MigrateSchema(db, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Steps) != 4 || plan.Version != 4 || !strings.Contains(plan.Steps[2].SQL, "proxy_control") {
+		t.Fatalf("unexpected dry-run plan %+v", plan)
+	}
+	if tableExists(t, db, "schema_migrations") || tableExists(t, db, "request_log") {
+		t.Fatal("dry-run must not touch the database")
+	}
+
+	if report, err := MigrateSchema(db, MigrateOptions{Target: 3}); err != nil || len(report.Steps) != 3 || report.Version != 3 {
+		t.Fatalf("expected migrating to version 3 only, got %+v (%v)", report, err)
+	}
+	report, err := MigrateSchema(db, MigrateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Steps) != 1 || report.Steps[0].Version != 4 || report.Version != 4 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for _, table := range []string{"request_log", "request_log_body", "provider_incident", "proxy_control", "proxy_rule_hits", "provider_config"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("expected table %s", table)
+		}
+	}
+	// SSOT 迁移据 schema_version 判断是否已迁移，迁移框架不能写入该表
+	if tableExists(t, db, "schema_version") {
+		t.Fatal("schema migrations must not create schema_version")
+	}
+	if again, err := MigrateSchema(db, MigrateOptions{}); err != nil || len(again.Steps) != 0 {
+		t.Fatalf("second run should be a no-op, got %+v (%v)", again, err)
+	}
+
+	// 基线迁移不可回滚：旧库中这些表由 SSOT 迁移创建并保存着用户数据
+	if _, err := RollbackSchema(db, 1, true); err == nil || !strings.Contains(err.Error(), "0004_provider_config") {
+		t.Fatalf("expected irreversible migration error, got %v", err)
+	}
+	if !tableExists(t, db, "provider_config") {
+		t.Fatal("failed rollback must not drop tables")
+	}
+
+	statuses, err := SchemaMigrationStatuses(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 4 || !statuses[3].Applied || statuses[3].AppliedAt == "" || statuses[3].Reversible {
+		t.Fatalf("unexpected statuses %+v", statuses)
+	}
+}
+
+func TestMigrateSchemaKeepsSSOTTables(t *testing.T) {
+	db := openMigrationTestDB(t)
+	if _, err := db.Exec(`CREATE TABLE schema_version (version INTEGER PRIMARY KEY, description TEXT, applied_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_version (version, description) VALUES (1, 'Initial schema'), (2, 'SSOT architecture migration - Phase 1');
+		CREATE TABLE provider_config (id INTEGER PRIMARY KEY AUTOINCREMENT, platform TEXT NOT NULL, name TEXT NOT NULL,
+			api_url TEXT NOT NULL, api_key TEXT NOT NULL, enabled INTEGER DEFAULT 1, priority_level INTEGER DEFAULT 1,
+			updated_at DATETIME, UNIQUE(platform, name));
+		INSERT INTO provider_config (platform, name, api_url, api_key) VALUES ('claude', 'main', 'https://api.example.com', 'sk-test')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// 版本号与 SSOT 的 schema_version 互不相关：全部迁移都会执行，已有表和数据保持不变
+	report, err := MigrateSchema(db, MigrateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Steps) != 4 || !tableExists(t, db, "request_log") {
+		t.Fatalf("expected all migrations to run, got %+v", report)
+	}
+	var versions, providers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&versions); err != nil || versions != 2 {
+		t.Fatalf("schema_version changed: %d rows (%v)", versions, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM provider_config").Scan(&providers); err != nil || providers != 1 {
+		t.Fatalf("provider_config changed: %d rows (%v)", providers, err)
+	}
+
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name) VALUES (7, 'from_newer_release')"); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := SchemaMigrationStatuses(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; last.Version != 7 || !last.Unknown || last.Name != "from_newer_release" {
+		t.Fatalf("expected unknown version to be listed, got %+v", statuses)
+	}
+}
+
+func TestRollbackSchema(t *testing.T) {
+	migrations, err := loadSchemaMigrations(fstest.MapFS{
+		"m/0002_users.up.sql":    {Data: []byte("CREATE TABLE users (id INTEGER)")},
+		"m/0002_users.down.sql":  {Data: []byte("DROP TABLE users")},
+		"m/0003_groups.up.sql":   {Data: []byte("CREATE TABLE groups_ (id INTEGER)")},
+		"m/0003_groups.down.sql": {Data: []byte("DROP TABLE groups_")},
+	}, "m", []SchemaMigration{{Version: 1, Name: "base", Up: func(*sql.DB) error { return nil }}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := openMigrationTestDB(t)
+	if _, err := migrateSchema(db, migrations, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := rollbackSchema(db, migrations, 2, true)
+	if err != nil || len(plan.Steps) != 2 || plan.Steps[0].Version != 3 || plan.Version != 1 || !tableExists(t, db, "groups_") {
+		t.Fatalf("unexpected dry-run rollback %+v (%v)", plan, err)
+	}
+	rollback, err := rollbackSchema(db, migrations, 1, false)
+	if err != nil || len(rollback.Steps) != 1 || rollback.Version != 2 {
+		t.Fatalf("unexpected rollback %+v (%v)", rollback, err)
+	}
+	if tableExists(t, db, "groups_") || !tableExists(t, db, "users") {
+		t.Fatal("expected only the rolled back table to be dropped")
+	}
+
+	// 任一迁移不可回滚时不做任何修改
+	if _, err := rollbackSchema(db, migrations, 2, false); err == nil || !strings.Contains(err.Error(), "0001_base") {
+		t.Fatalf("expected irreversible migration error, got %v", err)
+	}
+	if !tableExists(t, db, "users") {
+		t.Fatal("failed rollback must not drop tables")
+	}
+	if report, err := migrateSchema(db, migrations, MigrateOptions{}); err != nil || len(report.Steps) != 1 || report.Version != 3 {
+		t.Fatalf("expected re-applying the rolled back migration, got %+v (%v)", report, err)
+	}
+}
+
+func TestLoadSchemaMigrations(t *testing.T) {
+	goMigrations := []SchemaMigration{{Version: 1, Name: "base", Up: func(*sql.DB) error { return nil }}}
+	valid := fstest.MapFS{
+		"m/0002_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER)")},
+		"m/0002_users.down.sql": {Data: []byte("DROP TABLE users")},
+	}
+	migrations, err := loadSchemaMigrations(valid, "m", goMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[1].String() != "0002_users" || !migrations[1].Reversible() || migrations[0].Reversible() {
+		t.Fatalf("unexpected migrations %+v", migrations)
+	}
+
+	for name, files := range map[string]fstest.MapFS{
+		"bad name":      {"m/users.up.sql": {}},
+		"go conflict":   {"m/0001_base.up.sql": {}},
+		"name mismatch": {"m/0002_a.up.sql": {}, "m/0002_b.down.sql": {}},
+		"missing up":    {"m/0002_a.down.sql": {}},
+	} {
+		if _, err := loadSchemaMigrations(files, "m", goMigrations); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
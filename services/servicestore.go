@@ -1,16 +1,22 @@
 package services
 
 import (
+	"crypto/cipher"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	_ "modernc.org/sqlite"
 )
 
 type SuiStore struct {
 	db *sql.DB
+
+	// 保险库主密钥，首次使用时加载
+	vaultMu   sync.Mutex
+	vaultAEAD cipher.AEAD
 }
 
 func getSafeDBPath() (string, error) {
@@ -48,6 +54,9 @@ func NewSuiStore() (*SuiStore, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := ensureVaultTable(db); err != nil {
+		return nil, err
+	}
 	// 检查是否已存在数据
 	row := db.QueryRow(`SELECT COUNT(*) FROM hotkeys`)
 	var count int
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 保险库条目类型
+const (
+	VaultKindAPIKey = "api_key"
+	VaultKindNote   = "note"
+)
+
+const (
+	vaultKeyFileName     = "vault.key"
+	vaultExportVersion   = 1
+	vaultExportIteration = 600000
+)
+
+var errVaultEntryNotFound = errors.New("vault entry not found")
+
+// VaultEntry 保险库中的一条 API Key 或笔记。名称、标签与描述明文保存用于搜索，
+// Secret 使用 AES-GCM 加密，只在 GetVaultEntry 中返回
+type VaultEntry struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
+	Preview     string   `json:"preview,omitempty"` // 列表中展示的掩码
+	CreatedAt   int64    `json:"created_at"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+// vaultExport 导出文件：条目密文使用口令派生的密钥重新加密，可在其他设备导入
+type vaultExport struct {
+	Version    int                 `json:"version"`
+	Salt       []byte              `json:"salt"`
+	Iterations int                 `json:"iterations"`
+	Entries    []vaultExportRecord `json:"entries"`
+}
+
+type vaultExportRecord struct {
+	VaultEntry
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func ensureVaultTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS vault_entries (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		tags TEXT NOT NULL DEFAULT '[]',
+		description TEXT NOT NULL DEFAULT '',
+		nonce BLOB NOT NULL,
+		ciphertext BLOB NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	`)
+	return err
+}
+
+// vaultCipher 加载本机主密钥（首次使用时生成，保存在数据库旁的 vault.key，权限 0600）。
+// 主密钥防止 provider 配置、备份与同步数据中出现明文 Key，不防御能读取本机文件的攻击者
+func (cs *SuiStore) vaultCipher() (cipher.AEAD, error) {
+	cs.vaultMu.Lock()
+	defer cs.vaultMu.Unlock()
+	if cs.vaultAEAD != nil {
+		return cs.vaultAEAD, nil
+	}
+	dbPath, err := getSafeDBPath()
+	if err != nil {
+		return nil, err
+	}
+	keyPath := filepath.Join(filepath.Dir(dbPath), vaultKeyFileName)
+	key, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s 已损坏", keyPath)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	cs.vaultAEAD = aead
+	return aead, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealVaultSecret 以条目 ID 作为附加数据，防止密文被挪到其他条目
+func sealVaultSecret(aead cipher.AEAD, id, secret string) ([]byte, []byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, []byte(secret), []byte(id)), nil
+}
+
+func openVaultSecret(aead cipher.AEAD, id string, nonce, ciphertext []byte) (string, error) {
+	if len(nonce) != aead.NonceSize() {
+		return "", fmt.Errorf("条目 %s 的 nonce 无效", id)
+	}
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("条目 %s 解密失败: %w", id, err)
+	}
+	return string(plain), nil
+}
+
+// normalizeVaultTags 去重、去空白并排序
+func normalizeVaultTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func vaultPreview(kind, secret string) string {
+	if kind == VaultKindAPIKey {
+		return maskAPIKey(secret)
+	}
+	runes := []rune(strings.TrimSpace(secret))
+	if len(runes) > 40 {
+		return string(runes[:40]) + "…"
+	}
+	return string(runes)
+}
+
+// SaveVaultEntry 新建（ID 为空）或更新条目；更新时 Secret 为空表示保留原值
+func (cs *SuiStore) SaveVaultEntry(entry VaultEntry) (VaultEntry, error) {
+	entry.Name = strings.TrimSpace(entry.Name)
+	if entry.Name == "" {
+		return VaultEntry{}, errors.New("名称不能为空")
+	}
+	if entry.Kind == "" {
+		entry.Kind = VaultKindAPIKey
+	}
+	if entry.Kind != VaultKindAPIKey && entry.Kind != VaultKindNote {
+		return VaultEntry{}, fmt.Errorf("不支持的条目类型 %q", entry.Kind)
+	}
+	entry.Tags = normalizeVaultTags(entry.Tags)
+	aead, err := cs.vaultCipher()
+	if err != nil {
+		return VaultEntry{}, err
+	}
+	tags, _ := json.Marshal(entry.Tags)
+	now := time.Now().Unix()
+	entry.UpdatedAt = now
+
+	if entry.ID == "" {
+		if entry.Secret == "" {
+			return VaultEntry{}, errors.New("内容不能为空")
+		}
+		entry.ID = uuid.NewString()
+		entry.CreatedAt = now
+		nonce, ciphertext, err := sealVaultSecret(aead, entry.ID, entry.Secret)
+		if err != nil {
+			return VaultEntry{}, err
+		}
+		_, err = cs.db.Exec(`INSERT INTO vault_entries (id, name, kind, tags, description, nonce, ciphertext, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.ID, entry.Name, entry.Kind, string(tags), entry.Description, nonce, ciphertext, entry.CreatedAt, entry.UpdatedAt)
+		if err != nil {
+			return VaultEntry{}, err
+		}
+	} else {
+		existing, err := cs.GetVaultEntry(entry.ID)
+		if err != nil {
+			return VaultEntry{}, err
+		}
+		entry.CreatedAt = existing.CreatedAt
+		if entry.Secret == "" {
+			entry.Secret = existing.Secret
+		}
+		nonce, ciphertext, err := sealVaultSecret(aead, entry.ID, entry.Secret)
+		if err != nil {
+			return VaultEntry{}, err
+		}
+		_, err = cs.db.Exec(`UPDATE vault_entries SET name = ?, kind = ?, tags = ?, description = ?, nonce = ?, ciphertext = ?, updated_at = ?
+			WHERE id = ?`,
+			entry.Name, entry.Kind, string(tags), entry.Description, nonce, ciphertext, entry.UpdatedAt, entry.ID)
+		if err != nil {
+			return VaultEntry{}, err
+		}
+	}
+	entry.Preview = vaultPreview(entry.Kind, entry.Secret)
+	entry.Secret = ""
+	return entry, nil
+}
+
+// GetVaultEntry 返回包含明文内容的条目
+func (cs *SuiStore) GetVaultEntry(id string) (VaultEntry, error) {
+	records, err := cs.queryVault(`WHERE id = ?`, id)
+	if err != nil {
+		return VaultEntry{}, err
+	}
+	if len(records) == 0 {
+		return VaultEntry{}, errVaultEntryNotFound
+	}
+	aead, err := cs.vaultCipher()
+	if err != nil {
+		return VaultEntry{}, err
+	}
+	entry := records[0].VaultEntry
+	entry.Secret, err = openVaultSecret(aead, entry.ID, records[0].Nonce, records[0].Ciphertext)
+	if err != nil {
+		return VaultEntry{}, err
+	}
+	entry.Preview = vaultPreview(entry.Kind, entry.Secret)
+	return entry, nil
+}
+
+// ListVaultEntries 按关键字（匹配名称、描述与标签）和标签筛选，不返回明文内容
+func (cs *SuiStore) ListVaultEntries(query, tag string) ([]VaultEntry, error) {
+	records, err := cs.queryVault(`ORDER BY name COLLATE NOCASE`)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cs.vaultCipher()
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(strings.TrimSpace(query))
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	entries := make([]VaultEntry, 0, len(records))
+	for _, record := range records {
+		entry := record.VaultEntry
+		if tag != "" && !containsFold(entry.Tags, tag) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(entry.Name), query) &&
+			!strings.Contains(strings.ToLower(entry.Description), query) &&
+			!strings.Contains(strings.Join(entry.Tags, " "), query) {
+			continue
+		}
+		if secret, err := openVaultSecret(aead, entry.ID, record.Nonce, record.Ciphertext); err == nil {
+			entry.Preview = vaultPreview(entry.Kind, secret)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ListVaultTags 返回所有已使用的标签
+func (cs *SuiStore) ListVaultTags() ([]string, error) {
+	records, err := cs.queryVault("")
+	if err != nil {
+		return nil, err
+	}
+	var all []string
+	for _, record := range records {
+		all = append(all, record.Tags...)
+	}
+	return normalizeVaultTags(all), nil
+}
+
+// DeleteVaultEntry 删除条目；仍引用该条目的 provider 将无法解析 API Key
+func (cs *SuiStore) DeleteVaultEntry(id string) error {
+	result, err := cs.db.Exec(`DELETE FROM vault_entries WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errVaultEntryNotFound
+	}
+	return nil
+}
+
+// ResolveSecret 返回条目明文，供 ProviderService 解析 apiKeyRef
+func (cs *SuiStore) ResolveSecret(id string) (string, error) {
+	entry, err := cs.GetVaultEntry(id)
+	if err != nil {
+		return "", err
+	}
+	return entry.Secret, nil
+}
+
+// StoreSecret 新建 API Key 条目并返回 ID
+func (cs *SuiStore) StoreSecret(name, secret string, tags []string) (string, error) {
+	entry, err := cs.SaveVaultEntry(VaultEntry{Name: name, Kind: VaultKindAPIKey, Tags: tags, Secret: secret})
+	if err != nil {
+		return "", err
+	}
+	return entry.ID, nil
+}
+
+// ExportVault 使用口令加密导出全部条目
+func (cs *SuiStore) ExportVault(passphrase string) (string, error) {
+	if len(passphrase) < 8 {
+		return "", errors.New("导出口令至少 8 个字符")
+	}
+	records, err := cs.queryVault(`ORDER BY created_at`)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cs.vaultCipher()
+	if err != nil {
+		return "", err
+	}
+	export := vaultExport{Version: vaultExportVersion, Salt: make([]byte, 16), Iterations: vaultExportIteration}
+	if _, err := rand.Read(export.Salt); err != nil {
+		return "", err
+	}
+	exportAEAD, err := vaultExportCipher(passphrase, export.Salt, export.Iterations)
+	if err != nil {
+		return "", err
+	}
+	export.Entries = make([]vaultExportRecord, 0, len(records))
+	for _, record := range records {
+		secret, err := openVaultSecret(aead, record.ID, record.Nonce, record.Ciphertext)
+		if err != nil {
+			return "", err
+		}
+		nonce, ciphertext, err := sealVaultSecret(exportAEAD, record.ID, secret)
+		if err != nil {
+			return "", err
+		}
+		export.Entries = append(export.Entries, vaultExportRecord{VaultEntry: record.VaultEntry, Nonce: nonce, Ciphertext: ciphertext})
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ImportVault 导入 ExportVault 的结果；ID 已存在的条目仅在 overwrite 时覆盖。返回导入数量
+func (cs *SuiStore) ImportVault(data, passphrase string, overwrite bool) (int, error) {
+	var export vaultExport
+	if err := json.Unmarshal([]byte(data), &export); err != nil {
+		return 0, fmt.Errorf("解析导出文件失败: %w", err)
+	}
+	if export.Version != vaultExportVersion {
+		return 0, fmt.Errorf("不支持的导出版本 %d", export.Version)
+	}
+	exportAEAD, err := vaultExportCipher(passphrase, export.Salt, export.Iterations)
+	if err != nil {
+		return 0, err
+	}
+	aead, err := cs.vaultCipher()
+	if err != nil {
+		return 0, err
+	}
+
+	// 先全部解密，口令错误时不写入任何条目
+	secrets := make([]string, len(export.Entries))
+	for i, record := range export.Entries {
+		if record.ID == "" {
+			return 0, errors.New("导出文件中存在缺少 ID 的条目")
+		}
+		secrets[i], err = openVaultSecret(exportAEAD, record.ID, record.Nonce, record.Ciphertext)
+		if err != nil {
+			return 0, errors.New("口令错误或导出文件已损坏")
+		}
+	}
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	imported := 0
+	for i, record := range export.Entries {
+		nonce, ciphertext, err := sealVaultSecret(aead, record.ID, secrets[i])
+		if err != nil {
+			return 0, err
+		}
+		tags, _ := json.Marshal(normalizeVaultTags(record.Tags))
+		verb := "INSERT OR IGNORE"
+		if overwrite {
+			verb = "INSERT OR REPLACE"
+		}
+		result, err := tx.Exec(verb+` INTO vault_entries (id, name, kind, tags, description, nonce, ciphertext, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			record.ID, record.Name, record.Kind, string(tags), record.Description, nonce, ciphertext, record.CreatedAt, record.UpdatedAt)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			imported++
+		}
+	}
+	return imported, tx.Commit()
+}
+
+func vaultExportCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if passphrase == "" || len(salt) == 0 || iterations <= 0 {
+		return nil, errors.New("导出口令或参数无效")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// queryVault 读取条目元数据与密文，suffix 为 WHERE / ORDER BY 子句
+func (cs *SuiStore) queryVault(suffix string, args ...any) ([]vaultExportRecord, error) {
+	rows, err := cs.db.Query(`SELECT id, name, kind, tags, description, nonce, ciphertext, created_at, updated_at
+		FROM vault_entries `+suffix, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []vaultExportRecord
+	for rows.Next() {
+		var record vaultExportRecord
+		var tags string
+		if err := rows.Scan(&record.ID, &record.Name, &record.Kind, &tags, &record.Description,
+			&record.Nonce, &record.Ciphertext, &record.CreatedAt, &record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(tags), &record.Tags); err != nil || record.Tags == nil {
+			record.Tags = []string{}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestSuiStore(t *testing.T) *SuiStore {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	store, err := NewSuiStore()
+	if err != nil {
+		t.Fatalf("NewSuiStore failed: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestVault_SaveSearchAndEncrypt(t *testing.T) {
+	store := newTestSuiStore(t)
+
+	key, err := store.SaveVaultEntry(VaultEntry{Name: "OpenRouter", Tags: []string{"Provider", " codex ", "provider"}, Secret: "sk-or-1234567890abcdef"})
+	if err != nil {
+		t.Fatalf("SaveVaultEntry failed: %v", err)
+	}
+	if key.Secret != "" || key.Preview != "sk-o****cdef" || strings.Join(key.Tags, ",") != "codex,provider" {
+		t.Fatalf("saved entry = %+v", key)
+	}
+	if _, err := store.SaveVaultEntry(VaultEntry{Name: "note", Kind: VaultKindNote, Description: "billing contact", Secret: "ask finance"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SaveVaultEntry(VaultEntry{Name: "empty"}); err == nil {
+		t.Fatal("entry without secret should be rejected")
+	}
+
+	// The secret is not stored in plaintext
+	var ciphertext []byte
+	if err := store.db.QueryRow(`SELECT ciphertext FROM vault_entries WHERE id = ?`, key.ID).Scan(&ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("sk-or-")) {
+		t.Fatal("secret stored in plaintext")
+	}
+
+	if entries, _ := store.ListVaultEntries("BILLING", ""); len(entries) != 1 || entries[0].Kind != VaultKindNote || entries[0].Secret != "" {
+		t.Fatalf("search by description = %+v", entries)
+	}
+	if entries, _ := store.ListVaultEntries("", "codex"); len(entries) != 1 || entries[0].ID != key.ID {
+		t.Fatalf("filter by tag = %+v", entries)
+	}
+	if tags, _ := store.ListVaultTags(); strings.Join(tags, ",") != "codex,provider" {
+		t.Fatalf("tags = %v", tags)
+	}
+
+	// Updating without a secret keeps the stored value
+	key.Name = "OpenRouter main"
+	if _, err := store.SaveVaultEntry(key); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := store.ResolveSecret(key.ID); err != nil || secret != "sk-or-1234567890abcdef" {
+		t.Fatalf("secret after update = %q, %v", secret, err)
+	}
+
+	if err := store.DeleteVaultEntry(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ResolveSecret(key.ID); err == nil {
+		t.Fatal("deleted entry should not resolve")
+	}
+}
+
+func TestVault_ExportImport(t *testing.T) {
+	store := newTestSuiStore(t)
+	id, err := store.StoreSecret("claude/relay", "sk-ant-secret-value", []string{"provider"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ExportVault("short"); err == nil {
+		t.Fatal("short passphrase should be rejected")
+	}
+	data, err := store.ExportVault("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(data, "sk-ant-secret-value") {
+		t.Fatal("export contains plaintext secret")
+	}
+
+	// Import into a second store with a different master key
+	other := newTestSuiStore(t)
+	if _, err := other.ImportVault(data, "wrong passphrase", false); err == nil {
+		t.Fatal("wrong passphrase should fail")
+	}
+	if entries, _ := other.ListVaultEntries("", ""); len(entries) != 0 {
+		t.Fatal("failed import wrote entries")
+	}
+	n, err := other.ImportVault(data, "correct horse battery", false)
+	if err != nil || n != 1 {
+		t.Fatalf("import = %d, %v", n, err)
+	}
+	if secret, err := other.ResolveSecret(id); err != nil || secret != "sk-ant-secret-value" {
+		t.Fatalf("imported secret = %q, %v", secret, err)
+	}
+	if n, _ := other.ImportVault(data, "correct horse battery", false); n != 0 {
+		t.Fatalf("existing entries should be skipped, imported %d", n)
+	}
+	if n, _ := other.ImportVault(data, "correct horse battery", true); n != 1 {
+		t.Fatalf("overwrite imported %d", n)
+	}
+}
+
+func TestProviderService_VaultReferences(t *testing.T) {
+	store := newTestSuiStore(t)
+	ps := NewProviderService()
+	ps.SetSecretVault(store)
+
+	providers := []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://relay.example.com", APIKey: "sk-plain-123456789", Enabled: true},
+		{ID: 2, Name: "oauth", APIURL: "https://api.anthropic.com", AuthType: AuthTypeOAuth, Enabled: true},
+	}
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := ps.MoveAPIKeysToVault("claude")
+	if err != nil || moved != 1 {
+		t.Fatalf("moved = %d, %v", moved, err)
+	}
+
+	home, _ := os.UserHomeDir()
+	data, err := os.ReadFile(filepath.Join(home, ".code-switch", "claude-code.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-plain-123456789") {
+		t.Fatalf("plaintext key still in provider file: %s", data)
+	}
+	var envelope providerEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Providers[0].APIKeyRef == "" {
+		t.Fatalf("provider file = %s", data)
+	}
+
+	loaded, err := ps.LoadProviders("claude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].APIKey != "sk-plain-123456789" {
+		t.Fatalf("resolved key = %q", loaded[0].APIKey)
+	}
+
+	// Without a vault the reference cannot be resolved
+	detached := NewProviderService()
+	loaded, _ = detached.LoadProviders("claude")
+	if loaded[0].APIKey != "" || loaded[0].HasCredentials() {
+		t.Fatalf("unresolved provider = %+v", loaded[0])
+	}
+}
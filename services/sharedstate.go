@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 多副本部署时共享的运行时状态：轮询计数、429/529 冷却、上游限流额度、熔断状态与会话粘滞路由。
+// 未配置共享存储时各副本仍使用进程内状态；共享存储出错时同样退回进程内状态，不影响请求转发
+
+const (
+	// sharedStateTimeout 单次共享存储操作的超时，避免 Redis 故障拖慢请求
+	sharedStateTimeout = 250 * time.Millisecond
+	// sharedStateErrorLogInterval 共享存储错误日志的最小间隔
+	sharedStateErrorLogInterval = 30 * time.Second
+	// stickyRouteTTL 会话粘滞路由的保留时间
+	stickyRouteTTL = 30 * time.Minute
+	// memoryStateSweepInterval 进程内存储清理过期键的最小间隔
+	memoryStateSweepInterval = time.Minute
+	// memoryStateMaxEntries 进程内存储的键数上限
+	memoryStateMaxEntries = 100000
+	// DefaultSharedStatePrefix Redis 键前缀
+	DefaultSharedStatePrefix = "codeswitch:"
+)
+
+// SharedStateStore 共享状态存储
+type SharedStateStore interface {
+	Incr(ctx context.Context, key string) (int64, error)
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+// sharedStateHolder 当前使用的共享存储
+type sharedStateHolder struct {
+	mu         sync.RWMutex
+	store      SharedStateStore
+	lastErrLog int64
+}
+
+// SetSharedStateStore 设置多副本共享状态存储，nil 表示仅使用进程内状态
+func (prs *ProviderRelayService) SetSharedStateStore(store SharedStateStore) {
+	prs.shared.mu.Lock()
+	prs.shared.store = store
+	prs.shared.mu.Unlock()
+}
+
+// sharedState 返回共享存储，未配置时为 nil
+func (prs *ProviderRelayService) sharedState() SharedStateStore {
+	prs.shared.mu.RLock()
+	defer prs.shared.mu.RUnlock()
+	return prs.shared.store
+}
+
+// logSharedStateError 节流输出共享存储错误
+func (prs *ProviderRelayService) logSharedStateError(op string, err error) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&prs.shared.lastErrLog)
+	if now-last < int64(sharedStateErrorLogInterval) || !atomic.CompareAndSwapInt64(&prs.shared.lastErrLog, last, now) {
+		return
+	}
+	fmt.Printf("[SharedState] %s 失败，退回进程内状态: %v\n", op, err)
+}
+
+// nextRoundRobin 返回轮询计数（从 0 开始），共享存储可用时所有副本共用同一计数器
+func (prs *ProviderRelayService) nextRoundRobin(kind string) uint64 {
+	if store := prs.sharedState(); store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+		n, err := store.Incr(ctx, "rr:"+kind)
+		cancel()
+		if err == nil {
+			return uint64(n - 1)
+		}
+		prs.logSharedStateError("轮询计数", err)
+	}
+	return atomic.AddUint64(&prs.rrCounter, 1) - 1
+}
+
+// sharedGetJSON 从共享存储读取 JSON 值
+func (prs *ProviderRelayService) sharedGetJSON(key string, dst interface{}) bool {
+	store := prs.sharedState()
+	if store == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+	defer cancel()
+	value, ok, err := store.Get(ctx, key)
+	if err != nil {
+		prs.logSharedStateError("读取 "+key, err)
+		return false
+	}
+	return ok && json.Unmarshal([]byte(value), dst) == nil
+}
+
+// sharedSetJSON 写入 JSON 值到共享存储
+func (prs *ProviderRelayService) sharedSetJSON(key string, value interface{}, ttl time.Duration) {
+	store := prs.sharedState()
+	if store == nil {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+	defer cancel()
+	if err := store.Set(ctx, key, string(data), ttl); err != nil {
+		prs.logSharedStateError("写入 "+key, err)
+	}
+}
+
+// sharedDelete 从共享存储删除
+func (prs *ProviderRelayService) sharedDelete(key string) {
+	store := prs.sharedState()
+	if store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+	defer cancel()
+	if err := store.Delete(ctx, key); err != nil {
+		prs.logSharedStateError("删除 "+key, err)
+	}
+}
+
+// sharedCooldown 共享存储中的冷却状态
+type sharedCooldown struct {
+	UntilMs int64 `json:"until_ms"`
+	Strikes int   `json:"strikes"`
+}
+
+func sharedCooldownKey(key string) string  { return "cooldown:" + key }
+func sharedRateLimitKey(key string) string { return "ratelimit:" + key }
+
+// stickyRouteKey 会话粘滞路由键
+func stickyRouteKey(kind, conversationID string) string {
+	return "sticky:" + kind + ":" + conversationID
+}
+
+// stickyProvider 返回会话上次成功使用的 provider；仅在配置共享存储时启用，单机轮询不受影响
+func (prs *ProviderRelayService) stickyProvider(kind, conversationID string) string {
+	store := prs.sharedState()
+	if store == nil || conversationID == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+	defer cancel()
+	name, ok, err := store.Get(ctx, stickyRouteKey(kind, conversationID))
+	if err != nil {
+		prs.logSharedStateError("读取粘滞路由", err)
+		return ""
+	}
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// rememberStickyProvider 记录会话成功使用的 provider，后续请求优先路由到同一 provider 以复用 prompt cache
+func (prs *ProviderRelayService) rememberStickyProvider(kind, conversationID, providerName string) {
+	store := prs.sharedState()
+	if store == nil || conversationID == "" || providerName == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStateTimeout)
+	defer cancel()
+	if err := store.Set(ctx, stickyRouteKey(kind, conversationID), providerName, stickyRouteTTL); err != nil {
+		prs.logSharedStateError("写入粘滞路由", err)
+	}
+}
+
+// stickyIndex 返回粘滞 provider 在候选列表中的位置，不存在时返回 -1
+func stickyIndex(providers []Provider, name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, p := range providers {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ============================================================
+// Redis 实现
+// ============================================================
+
+// RedisSharedState 基于 Redis 的共享状态存储
+type RedisSharedState struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisSharedState 连接 Redis（redis://[:password@]host:port/db），prefix 为空时使用 DefaultSharedStatePrefix
+func NewRedisSharedState(url, prefix string) (*RedisSharedState, error) {
+	opts, err := redis.ParseURL(strings.TrimSpace(url))
+	if err != nil {
+		return nil, fmt.Errorf("解析 Redis 地址失败: %w", err)
+	}
+	if prefix == "" {
+		prefix = DefaultSharedStatePrefix
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+	return &RedisSharedState{client: client, prefix: prefix}, nil
+}
+
+func (r *RedisSharedState) Incr(ctx context.Context, key string) (int64, error) {
+	return r.client.Incr(ctx, r.prefix+key).Result()
+}
+
+func (r *RedisSharedState) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (r *RedisSharedState) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+func (r *RedisSharedState) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.prefix+key).Err()
+}
+
+func (r *RedisSharedState) Close() error {
+	return r.client.Close()
+}
+
+// ============================================================
+// 进程内实现
+// ============================================================
+
+type memoryEntry struct {
+	value   string
+	expires time.Time
+}
+
+// memorySharedState 进程内存储，用于测试与同一进程中的多个中继实例；
+// 写入时定期清理过期键，键数达到上限时淘汰已有的键，避免只写不读的键无限增长
+type memorySharedState struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+func newMemorySharedState() *memorySharedState {
+	return &memorySharedState{entries: make(map[string]memoryEntry)}
+}
+
+// get 读取未过期的值，调用方需持有锁；顺带清理过期键
+func (m *memorySharedState) get(key string) (string, bool) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(m.entries, key)
+		return "", false
+	}
+	return entry.value, true
+}
+
+// sweep 清理过期键，必要时淘汰一个键给新键腾出位置，调用方需持有锁
+func (m *memorySharedState) sweep(key string) {
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= memoryStateSweepInterval {
+		m.lastSweep = now
+		for k, entry := range m.entries {
+			if !entry.expires.IsZero() && now.After(entry.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	if _, exists := m.entries[key]; exists || len(m.entries) < memoryStateMaxEntries {
+		return
+	}
+	// 优先淘汰带过期时间的键（粘滞路由、冷却等），保留轮询计数
+	victim := ""
+	for k, entry := range m.entries {
+		victim = k
+		if !entry.expires.IsZero() {
+			break
+		}
+	}
+	delete(m.entries, victim)
+}
+
+func (m *memorySharedState) Incr(_ context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(key)
+	value, _ := m.get(key)
+	n, _ := strconv.ParseInt(value, 10, 64)
+	n++
+	entry := m.entries[key]
+	entry.value = strconv.FormatInt(n, 10)
+	m.entries[key] = entry
+	return n, nil
+}
+
+func (m *memorySharedState) Get(_ context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.get(key)
+	return value, ok, nil
+}
+
+func (m *memorySharedState) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(key)
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	m.entries[key] = entry
+	return nil
+}
+
+func (m *memorySharedState) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *memorySharedState) Close() error { return nil }
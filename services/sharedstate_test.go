@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failingSharedState 模拟 Redis 不可用
+type failingSharedState struct{}
+
+var errSharedDown = errors.New("redis down")
+
+func (failingSharedState) Incr(context.Context, string) (int64, error) { return 0, errSharedDown }
+func (failingSharedState) Get(context.Context, string) (string, bool, error) {
+	return "", false, errSharedDown
+}
+func (failingSharedState) Set(context.Context, string, string, time.Duration) error {
+	return errSharedDown
+}
+func (failingSharedState) Delete(context.Context, string) error { return errSharedDown }
+func (failingSharedState) Close() error                         { return nil }
+
+// newReplicas 创建共享同一存储的两个网关副本
+func newReplicas() (*ProviderRelayService, *ProviderRelayService) {
+	store := newMemorySharedState()
+	a, b := &ProviderRelayService{}, &ProviderRelayService{}
+	a.SetSharedStateStore(store)
+	b.SetSharedStateStore(store)
+	return a, b
+}
+
+func TestSharedRoundRobinCounter(t *testing.T) {
+	a, b := newReplicas()
+	got := []uint64{a.nextRoundRobin("claude"), b.nextRoundRobin("claude"), a.nextRoundRobin("claude")}
+	for i, n := range got {
+		if n != uint64(i) {
+			t.Fatalf("shared counter = %v, want 0,1,2", got)
+		}
+	}
+	if n := b.nextRoundRobin("codex"); n != 0 {
+		t.Errorf("counters should be per platform, got %d", n)
+	}
+
+	// 共享存储故障时退回进程内计数
+	local := &ProviderRelayService{}
+	local.SetSharedStateStore(failingSharedState{})
+	if n0, n1 := local.nextRoundRobin("claude"), local.nextRoundRobin("claude"); n0 != 0 || n1 != 1 {
+		t.Errorf("fallback counter = %d,%d", n0, n1)
+	}
+}
+
+func TestSharedCooldownAndRateLimit(t *testing.T) {
+	a, b := newReplicas()
+	a.updateCooldown("claude", "p", http.StatusTooManyRequests, http.Header{"Retry-After": []string{"5"}})
+	if wait := b.cooldownRemaining("claude", "p"); wait < 4*time.Second {
+		t.Fatalf("replica b should see cooldown, got %v", wait)
+	}
+	// b 再次失败时累加 a 的退避次数
+	b.updateCooldown("claude", "p", StatusOverloaded, http.Header{})
+	if strikes := b.cooldowns.entries[providerKey("claude", "p")].strikes; strikes != 2 {
+		t.Errorf("strikes = %d, want 2", strikes)
+	}
+	a.updateCooldown("claude", "p", http.StatusOK, nil)
+	if wait := a.cooldownRemaining("claude", "p"); wait != 0 {
+		t.Errorf("success should clear shared cooldown on a, got %v", wait)
+	}
+
+	if b.isRateLimitExhausted("claude", "p") {
+		t.Fatal("no rate limit recorded yet")
+	}
+	a.recordRateLimit("claude", "p", http.StatusTooManyRequests, http.Header{"Retry-After": []string{"30"}})
+	if !b.isRateLimitExhausted("claude", "p") {
+		t.Error("replica b should see exhausted rate limit")
+	}
+}
+
+func TestStickyRouting(t *testing.T) {
+	a, b := newReplicas()
+	providers := []Provider{{Name: "x"}, {Name: "y"}, {Name: "z"}}
+	a.rememberStickyProvider("claude", "conv-1", "y")
+	if idx := stickyIndex(providers, b.stickyProvider("claude", "conv-1")); idx != 1 {
+		t.Errorf("sticky index = %d, want 1", idx)
+	}
+	if name := b.stickyProvider("codex", "conv-1"); name != "" {
+		t.Errorf("sticky routes should be per platform, got %q", name)
+	}
+	if idx := stickyIndex(providers, "gone"); idx != -1 {
+		t.Errorf("missing provider index = %d", idx)
+	}
+
+	// 未配置共享存储时不启用粘滞路由，单机轮询保持原有行为
+	local := &ProviderRelayService{}
+	local.rememberStickyProvider("claude", "conv-2", "z")
+	if name := local.stickyProvider("claude", "conv-2"); name != "" {
+		t.Errorf("sticky routing without a shared store = %q", name)
+	}
+}
+
+func TestSharedCircuitBreaker(t *testing.T) {
+	store := newMemorySharedState()
+	config := CircuitBreakerConfig{FailureThreshold: 1, RecoveryTimeout: time.Minute, SuccessThreshold: 1}
+	a, b := NewCircuitBreakerManager(nil, config), NewCircuitBreakerManager(nil, config)
+	a.SetSharedState(store)
+	b.SetSharedState(store)
+
+	cbA, cbB := a.GetCircuitBreaker(1, "p"), b.GetCircuitBreaker(1, "p")
+	cbA.OnFailure()
+	if cbA.GetState() != StateOpen {
+		t.Fatalf("circuit a state = %s", cbA.GetState())
+	}
+	if cbB.AllowRequest() || cbB.GetState() != StateOpen {
+		t.Errorf("replica b should adopt the open circuit, state = %s", cbB.GetState())
+	}
+
+	cbA.Reset()
+	c := NewCircuitBreakerManager(nil, config)
+	c.SetSharedState(store)
+	if !c.GetCircuitBreaker(1, "p").AllowRequest() {
+		t.Error("closed circuit should be cleared from shared state")
+	}
+}
+
+func TestMemorySharedStateExpiry(t *testing.T) {
+	store := newMemorySharedState()
+	ctx := context.Background()
+	_ = store.Set(ctx, "k", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := store.Get(ctx, "k"); ok {
+		t.Error("expired key should be gone")
+	}
+
+	// 只写不读的过期键在下次清理时删除
+	_ = store.Set(ctx, "unread", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	store.lastSweep = time.Time{}
+	_ = store.Set(ctx, "fresh", "v", time.Minute)
+	if _, ok := store.entries["unread"]; ok {
+		t.Error("sweep should drop expired keys that are never read")
+	}
+}
+
+func TestMemorySharedStateCap(t *testing.T) {
+	store := newMemorySharedState()
+	ctx := context.Background()
+	store.Incr(ctx, "rr:claude")
+	for i := 0; i < memoryStateMaxEntries+10; i++ {
+		_ = store.Set(ctx, fmt.Sprintf("sticky:claude:%d", i), "p", time.Hour)
+	}
+	if n := len(store.entries); n > memoryStateMaxEntries {
+		t.Fatalf("entries = %d, want at most %d", n, memoryStateMaxEntries)
+	}
+	if n, _ := store.Incr(ctx, "rr:claude"); n != 2 {
+		t.Errorf("round-robin counter should survive eviction, got %d", n)
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInstanceRunning 已有实例在运行
+var ErrInstanceRunning = errors.New("another instance is already running")
+
+// errInstanceLocked 锁文件被其他进程持有（由各平台实现返回）
+var errInstanceLocked = errors.New("instance lock is held by another process")
+
+const (
+	// instanceNotifyTimeout 第二个实例唤起已运行实例的总超时，覆盖首个实例刚拿到锁、尚未写入地址的窗口期
+	instanceNotifyTimeout = 3 * time.Second
+	instanceConnTimeout   = 2 * time.Second
+)
+
+// InstanceLock 单实例锁：持有 ~/.code-switch/instance.lock 的进程为主实例，
+// 并在本机回环地址监听，接收后续启动的实例发来的唤起请求
+type InstanceLock struct {
+	lockFile *os.File
+	listener net.Listener
+	token    string
+	infoPath string
+
+	mu        sync.Mutex
+	onActive  func(args []string)
+	pending   [][]string
+	closeOnce sync.Once
+}
+
+// instanceInfo 主实例的唤起地址，写入 instance.json 供第二个实例读取
+type instanceInfo struct {
+	PID   int    `json:"pid"`
+	Port  int    `json:"port"`
+	Token string `json:"token"`
+}
+
+type instanceRequest struct {
+	Token string   `json:"token"`
+	Args  []string `json:"args"`
+}
+
+func instanceLockPaths() (lockPath, infoPath string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, "instance.lock"), filepath.Join(dir, "instance.json"), nil
+}
+
+// AcquireInstanceLock 获取单实例锁；已有实例运行时返回 ErrInstanceRunning。
+// 锁由操作系统在进程退出（包括崩溃）时自动释放，不会残留
+func AcquireInstanceLock() (*InstanceLock, error) {
+	lockPath, infoPath, err := instanceLockPaths()
+	if err != nil {
+		return nil, err
+	}
+	lockFile, err := lockInstanceFile(lockPath)
+	if err != nil {
+		if errors.Is(err, errInstanceLocked) {
+			return nil, ErrInstanceRunning
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", lockPath, err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("failed to listen for second instance: %w", err)
+	}
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		listener.Close()
+		lockFile.Close()
+		return nil, err
+	}
+
+	l := &InstanceLock{
+		lockFile: lockFile,
+		listener: listener,
+		token:    hex.EncodeToString(tokenBytes),
+		infoPath: infoPath,
+	}
+	data, _ := json.Marshal(instanceInfo{
+		PID:   os.Getpid(),
+		Port:  listener.Addr().(*net.TCPAddr).Port,
+		Token: l.token,
+	})
+	if err := os.WriteFile(infoPath, data, 0600); err != nil {
+		l.Release()
+		return nil, fmt.Errorf("failed to write %s: %w", infoPath, err)
+	}
+
+	go l.serve()
+	return l, nil
+}
+
+// OnActivate 设置收到唤起请求时的处理函数；设置前收到的请求会立即补发
+func (l *InstanceLock) OnActivate(handler func(args []string)) {
+	l.mu.Lock()
+	l.onActive = handler
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for _, args := range pending {
+		handler(args)
+	}
+}
+
+// Release 释放单实例锁
+func (l *InstanceLock) Release() {
+	l.closeOnce.Do(func() {
+		l.listener.Close()
+		_ = os.Remove(l.infoPath)
+		l.lockFile.Close()
+	})
+}
+
+func (l *InstanceLock) serve() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		go l.handleConn(conn)
+	}
+}
+
+func (l *InstanceLock) handleConn(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(instanceConnTimeout))
+
+	var req instanceRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(l.token)) != 1 {
+		fmt.Fprintln(conn, "denied")
+		return
+	}
+	fmt.Fprintln(conn, "ok")
+
+	l.mu.Lock()
+	handler := l.onActive
+	if handler == nil {
+		l.pending = append(l.pending, req.Args)
+	}
+	l.mu.Unlock()
+	if handler != nil {
+		handler(req.Args)
+	}
+}
+
+// NotifyRunningInstance 通知已运行的实例显示并聚焦主窗口
+func NotifyRunningInstance(args []string) error {
+	_, infoPath, err := instanceLockPaths()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(instanceNotifyTimeout)
+	for {
+		err = notifyInstance(infoPath, args)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func notifyInstance(infoPath string, args []string) error {
+	data, err := os.ReadFile(infoPath)
+	if err != nil {
+		return err
+	}
+	var info instanceInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return fmt.Errorf("invalid %s: %w", infoPath, err)
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", info.Port), instanceConnTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(instanceConnTimeout))
+
+	if err := json.NewEncoder(conn).Encode(instanceRequest{Token: info.Token, Args: args}); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(reply) != "ok" {
+		return fmt.Errorf("running instance rejected activation: %s", strings.TrimSpace(reply))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInstanceLockActivation(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	lock, err := AcquireInstanceLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+
+	if _, err := AcquireInstanceLock(); !errors.Is(err, ErrInstanceRunning) {
+		t.Fatalf("expected ErrInstanceRunning, got %v", err)
+	}
+
+	// 设置处理函数前收到的唤起请求会补发
+	if err := NotifyRunningInstance([]string{"--first"}); err != nil {
+		t.Fatal(err)
+	}
+	activated := make(chan []string, 2)
+	lock.OnActivate(func(args []string) { activated <- args })
+	if err := NotifyRunningInstance([]string{"--second"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--first", "--second"} {
+		select {
+		case args := <-activated:
+			if len(args) != 1 || args[0] != want {
+				t.Fatalf("expected %s, got %v", want, args)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	// token 不匹配的请求被拒绝
+	infoPath := filepath.Join(home, ".code-switch", "instance.json")
+	data, err := os.ReadFile(infoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info instanceInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	info.Token = "forged"
+	forged, _ := json.Marshal(info)
+	forgedPath := filepath.Join(t.TempDir(), "instance.json")
+	if err := os.WriteFile(forgedPath, forged, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := notifyInstance(forgedPath, nil); err == nil {
+		t.Fatal("expected forged token to be rejected")
+	}
+
+	// 释放后可重新获取
+	lock.Release()
+	if _, err := os.Stat(infoPath); !os.IsNotExist(err) {
+		t.Fatalf("expected instance.json to be removed, got %v", err)
+	}
+	again, err := AcquireInstanceLock()
+	if err != nil {
+		t.Fatalf("expected lock to be available after release: %v", err)
+	}
+	again.Release()
+}
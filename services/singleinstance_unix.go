@@ -0,0 +1,25 @@
+//go:build !windows
+
+package services
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockInstanceFile 以 flock 独占锁定文件，进程退出时由内核释放
+func lockInstanceFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errInstanceLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
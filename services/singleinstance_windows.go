@@ -0,0 +1,28 @@
+//go:build windows
+
+package services
+
+import (
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation ERROR_SHARING_VIOLATION：文件已被其他进程以独占方式打开
+const errorSharingViolation syscall.Errno = 32
+
+// lockInstanceFile 以不共享方式打开文件，句柄关闭（包括进程退出）后释放
+func lockInstanceFile(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, errInstanceLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
@@ -445,7 +445,11 @@ func (ss *SkillService) saveStoreLocked(store skillStore) error {
 	if err := os.WriteFile(tmp, data, 0o644); err != nil {
 		return err
 	}
-	return os.Rename(tmp, ss.storePath)
+	if err := os.Rename(tmp, ss.storePath); err != nil {
+		return err
+	}
+	GetSyncIntegration().OnScopedChange(syncScopeSkills, store)
+	return nil
 }
 
 func (ss *SkillService) prepareRepoSnapshot(repo skillRepoConfig) (string, string, func(), error) {
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 统计快照：把每日花费（标注 provider 故障日期）、各 provider 花费与按星期 / 小时的请求热力图
+// 渲染为 PNG 或单页 PDF，便于直接放进团队报告而不必截图。图表在后端绘制，不依赖前端或外部渲染服务
+
+// 快照格式
+const (
+	SnapshotFormatPNG = "png"
+	SnapshotFormatPDF = "pdf"
+)
+
+const (
+	// snapshotMaxDays 快照最长统计天数
+	snapshotMaxDays = 90
+	// snapshotTopProviders provider 分布最多显示的条数，其余合并为 OTHERS
+	snapshotTopProviders = 8
+	snapshotWidth        = 1200
+	snapshotHeight       = 860
+)
+
+var (
+	snapshotBackground = color.RGBA{248, 250, 252, 255}
+	snapshotPanel      = color.RGBA{255, 255, 255, 255}
+	snapshotBorder     = color.RGBA{226, 232, 240, 255}
+	snapshotText       = color.RGBA{15, 23, 42, 255}
+	snapshotMuted      = color.RGBA{100, 116, 139, 255}
+	snapshotAccent     = color.RGBA{37, 99, 235, 255}
+	snapshotHeatEmpty  = color.RGBA{241, 245, 249, 255}
+	snapshotIncident   = color.RGBA{220, 38, 38, 255}
+	snapshotIncidentBg = color.RGBA{254, 226, 226, 255}
+)
+
+var snapshotWeekdays = []string{"MON", "TUE", "WED", "THU", "FRI", "SAT", "SUN"}
+
+// DashboardSnapshotOptions 快照参数
+type DashboardSnapshotOptions struct {
+	Format   string `json:"format"`   // png / pdf，默认 png
+	Days     int    `json:"days"`     // 统计最近天数（含今天），默认 30
+	Platform string `json:"platform"` // 为空时统计全部平台
+}
+
+// snapshotProviderCost provider 花费分布的一行
+type snapshotProviderCost struct {
+	Provider string
+	Requests int64
+	Cost     float64
+}
+
+// dashboardSnapshotData 快照中绘制的统计数据
+type dashboardSnapshotData struct {
+	From          time.Time
+	To            time.Time
+	Platform      string
+	Daily         []DailyCostPoint
+	Incidents     map[string]int // 日期 -> 当天的 provider 故障数
+	Providers     []snapshotProviderCost
+	Heatmap       [7][24]int64 // 周一为第 0 行，统计时区的小时
+	TotalRequests int64
+	TotalCost     float64
+}
+
+// normalize 补齐默认值并检查格式
+func (opts DashboardSnapshotOptions) normalize() (DashboardSnapshotOptions, error) {
+	opts.Format = strings.ToLower(strings.TrimSpace(opts.Format))
+	if opts.Format == "" {
+		opts.Format = SnapshotFormatPNG
+	}
+	if opts.Format != SnapshotFormatPNG && opts.Format != SnapshotFormatPDF {
+		return opts, fmt.Errorf("unsupported snapshot format: %s", opts.Format)
+	}
+	if opts.Days <= 0 {
+		opts.Days = 30
+	}
+	if opts.Days > snapshotMaxDays {
+		opts.Days = snapshotMaxDays
+	}
+	opts.Platform = strings.TrimSpace(opts.Platform)
+	return opts, nil
+}
+
+// RenderDashboardSnapshot 渲染统计快照，返回 PNG 或 PDF 内容
+func (ls *LogService) RenderDashboardSnapshot(opts DashboardSnapshotOptions) ([]byte, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+	data, err := collectDashboardSnapshot(opts.Platform, opts.Days)
+	if err != nil {
+		return nil, err
+	}
+	img := renderDashboardSnapshot(data)
+	if opts.Format == SnapshotFormatPDF {
+		return encodeSnapshotPDF(img)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportDashboardSnapshot 渲染统计快照并保存到 ~/.code-switch/exports，返回文件路径
+func (ls *LogService) ExportDashboardSnapshot(opts DashboardSnapshotOptions) (string, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return "", err
+	}
+	data, err := ls.RenderDashboardSnapshot(opts)
+	if err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	exportDir := filepath.Join(home, ".code-switch", "exports")
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("dashboard_%s.%s", time.Now().Format("20060102_150405"), opts.Format)
+	path := filepath.Join(exportDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// collectDashboardSnapshot 一次扫描用量来源，按统计时区汇总每日花费、provider 分布与星期 / 小时热力图
+func collectDashboardSnapshot(platform string, days int) (*dashboardSnapshotData, error) {
+	loc := statsLocation()
+	now := statsNow()
+	start := startOfDay(now).AddDate(0, 0, -(days - 1))
+	data := &dashboardSnapshotData{From: start, To: now, Platform: platform}
+
+	daily := make(map[string]*DailyCostPoint, days)
+	for i := 0; i < days; i++ {
+		day := start.AddDate(0, 0, i).Format("2006-01-02")
+		data.Daily = append(data.Daily, DailyCostPoint{Day: day})
+		daily[day] = &data.Daily[i]
+	}
+
+	incidents, err := queryProviderIncidents(platform, start, incidentMaxList)
+	if err != nil {
+		return nil, err
+	}
+	data.Incidents = make(map[string]int)
+	for _, marker := range buildIncidentMarkers(incidents, start, now) {
+		data.Incidents[marker.Day] = marker.Count
+	}
+
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+	source, args := statsUsageSource(db, start, rollupOpenEnd)
+	query := `
+		SELECT bucket, COALESCE(NULLIF(TRIM(provider), ''), '(unknown)'),
+		       COALESCE(SUM(requests), 0), COALESCE(SUM(total_cost), 0)
+		FROM ` + source + `
+		WHERE bucket IS NOT NULL`
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query += " GROUP BY bucket, 2"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return data, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := make(map[string]*snapshotProviderCost)
+	for rows.Next() {
+		var bucket, provider string
+		var requests int64
+		var cost float64
+		if err := rows.Scan(&bucket, &provider, &requests, &cost); err != nil {
+			return nil, err
+		}
+		bucketTime, ok := parseRollupTime(bucket)
+		if !ok {
+			continue
+		}
+		local := bucketTime.In(loc)
+		if point := daily[local.Format("2006-01-02")]; point != nil {
+			point.TotalCost += cost
+			point.Requests += requests
+		}
+		entry := providers[provider]
+		if entry == nil {
+			entry = &snapshotProviderCost{Provider: provider}
+			providers[provider] = entry
+		}
+		entry.Requests += requests
+		entry.Cost += cost
+		// time.Weekday 以周日为 0，热力图以周一为第一行
+		data.Heatmap[(int(local.Weekday())+6)%7][local.Hour()] += requests
+		data.TotalRequests += requests
+		data.TotalCost += cost
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range providers {
+		data.Providers = append(data.Providers, *entry)
+	}
+	sort.Slice(data.Providers, func(i, j int) bool {
+		if data.Providers[i].Cost != data.Providers[j].Cost {
+			return data.Providers[i].Cost > data.Providers[j].Cost
+		}
+		if data.Providers[i].Requests != data.Providers[j].Requests {
+			return data.Providers[i].Requests > data.Providers[j].Requests
+		}
+		return data.Providers[i].Provider < data.Providers[j].Provider
+	})
+	if len(data.Providers) > snapshotTopProviders {
+		others := snapshotProviderCost{Provider: "others"}
+		for _, entry := range data.Providers[snapshotTopProviders-1:] {
+			others.Requests += entry.Requests
+			others.Cost += entry.Cost
+		}
+		data.Providers = append(data.Providers[:snapshotTopProviders-1], others)
+	}
+	return data, nil
+}
+
+// renderDashboardSnapshot 绘制快照：标题与合计、每日花费柱状图、provider 分布条形图、请求热力图
+func renderDashboardSnapshot(data *dashboardSnapshotData) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, snapshotWidth, snapshotHeight))
+	fillSnapshotRect(img, 0, 0, snapshotWidth, snapshotHeight, snapshotBackground)
+
+	platform := "all platforms"
+	if data.Platform != "" {
+		platform = data.Platform
+	}
+	drawSnapshotText(img, 40, 30, "Usage snapshot", 4, snapshotText)
+	drawSnapshotText(img, 40, 72, fmt.Sprintf("%s - %s   %s", data.From.Format("2006-01-02"), data.To.Format("2006-01-02 15:04"), platform), 2, snapshotMuted)
+	summary := fmt.Sprintf("Requests %d   Cost %s", data.TotalRequests, formatSnapshotCost(data.TotalCost))
+	drawSnapshotText(img, snapshotWidth-40-snapshotTextWidth(summary, 3), 36, summary, 3, snapshotText)
+
+	drawSnapshotDailyCost(img, image.Rect(40, 110, 1160, 440), data.Daily, data.Incidents)
+	drawSnapshotProviders(img, image.Rect(40, 460, 590, 820), data.Providers)
+	drawSnapshotHeatmap(img, image.Rect(610, 460, 1160, 820), data.Heatmap)
+	return img
+}
+
+// drawSnapshotPanel 绘制带标题的面板，返回内容区域
+func drawSnapshotPanel(img *image.RGBA, rect image.Rectangle, title string) image.Rectangle {
+	fillSnapshotRect(img, rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy(), snapshotBorder)
+	fillSnapshotRect(img, rect.Min.X+1, rect.Min.Y+1, rect.Dx()-2, rect.Dy()-2, snapshotPanel)
+	drawSnapshotText(img, rect.Min.X+20, rect.Min.Y+18, title, 2, snapshotText)
+	return image.Rect(rect.Min.X+20, rect.Min.Y+50, rect.Max.X-20, rect.Max.Y-20)
+}
+
+func drawSnapshotDailyCost(img *image.RGBA, rect image.Rectangle, daily []DailyCostPoint, incidents map[string]int) {
+	area := drawSnapshotPanel(img, rect, "Daily cost (USD)")
+	if len(incidents) > 0 {
+		legend := "Provider incident"
+		x := rect.Max.X - 20 - snapshotTextWidth(legend, 2)
+		drawSnapshotText(img, x, rect.Min.Y+18, legend, 2, snapshotMuted)
+		fillSnapshotRect(img, x-20, rect.Min.Y+19, 12, 12, snapshotIncident)
+	}
+	maxCost := 0.0
+	for _, point := range daily {
+		maxCost = math.Max(maxCost, point.TotalCost)
+	}
+	if len(daily) == 0 {
+		return
+	}
+
+	// 左侧留出 Y 轴刻度，底部留出日期
+	axisWidth := snapshotTextWidth(formatSnapshotCost(maxCost), 2) + 12
+	chart := image.Rect(area.Min.X+axisWidth, area.Min.Y, area.Max.X, area.Max.Y-24)
+	fillSnapshotRect(img, chart.Min.X, chart.Max.Y, chart.Dx(), 1, snapshotBorder)
+	drawSnapshotText(img, area.Min.X, chart.Min.Y, formatSnapshotCost(maxCost), 2, snapshotMuted)
+	drawSnapshotText(img, area.Min.X, chart.Max.Y-14, formatSnapshotCost(0), 2, snapshotMuted)
+
+	slot := float64(chart.Dx()) / float64(len(daily))
+	barWidth := max(int(slot*0.7), 1)
+	for i, point := range daily {
+		x := chart.Min.X + int(float64(i)*slot+(slot-float64(barWidth))/2)
+		// 故障日期：浅红背景 + 顶部红色标记
+		if incidents[point.Day] > 0 {
+			fillSnapshotRect(img, x, chart.Min.Y, barWidth, chart.Dy(), snapshotIncidentBg)
+			fillSnapshotRect(img, x, chart.Min.Y, barWidth, 4, snapshotIncident)
+		}
+		if maxCost > 0 && point.TotalCost > 0 {
+			height := max(int(point.TotalCost/maxCost*float64(chart.Dy())), 1)
+			fillSnapshotRect(img, x, chart.Max.Y-height, barWidth, height, snapshotAccent)
+		}
+	}
+	// 日期标签最多约 10 个，避免重叠
+	labelWidth := snapshotTextWidth("00-00", 2)
+	step := max(int(math.Ceil(float64(labelWidth+16)/slot)), 1)
+	for i := 0; i < len(daily); i += step {
+		label := daily[i].Day
+		if len(label) == len("2006-01-02") {
+			label = label[5:]
+		}
+		x := chart.Min.X + int(float64(i)*slot+slot/2) - labelWidth/2
+		drawSnapshotText(img, x, chart.Max.Y+8, label, 2, snapshotMuted)
+	}
+}
+
+func drawSnapshotProviders(img *image.RGBA, rect image.Rectangle, providers []snapshotProviderCost) {
+	area := drawSnapshotPanel(img, rect, "Cost by provider")
+	if len(providers) == 0 {
+		drawSnapshotText(img, area.Min.X, area.Min.Y, "No requests", 2, snapshotMuted)
+		return
+	}
+	maxCost := 0.0
+	for _, entry := range providers {
+		maxCost = math.Max(maxCost, entry.Cost)
+	}
+	nameWidth := snapshotTextWidth(strings.Repeat("M", 14), 2) + 12
+	valueWidth := snapshotTextWidth("$00000.00", 2) + 12
+	rowHeight := min(area.Dy()/len(providers), 40)
+	barMax := area.Dx() - nameWidth - valueWidth
+	for i, entry := range providers {
+		y := area.Min.Y + i*rowHeight
+		name := entry.Provider
+		if runes := []rune(name); len(runes) > 14 {
+			name = string(runes[:13]) + "."
+		}
+		drawSnapshotText(img, area.Min.X, y+6, name, 2, snapshotText)
+		if maxCost > 0 && entry.Cost > 0 {
+			width := max(int(entry.Cost/maxCost*float64(barMax)), 1)
+			fillSnapshotRect(img, area.Min.X+nameWidth, y+4, width, rowHeight-12, snapshotAccent)
+		}
+		drawSnapshotText(img, area.Max.X-valueWidth+12, y+6, formatSnapshotCost(entry.Cost), 2, snapshotMuted)
+	}
+}
+
+func drawSnapshotHeatmap(img *image.RGBA, rect image.Rectangle, heatmap [7][24]int64) {
+	area := drawSnapshotPanel(img, rect, "Requests by hour")
+	var peak int64
+	for _, row := range heatmap {
+		for _, v := range row {
+			peak = max(peak, v)
+		}
+	}
+	labelWidth := snapshotTextWidth("MON", 2) + 10
+	cellWidth := (area.Dx() - labelWidth) / 24
+	cellHeight := (area.Dy() - 24) / 7
+	for day, row := range heatmap {
+		y := area.Min.Y + day*cellHeight
+		drawSnapshotText(img, area.Min.X, y+(cellHeight-14)/2, snapshotWeekdays[day], 2, snapshotMuted)
+		for hour, v := range row {
+			x := area.Min.X + labelWidth + hour*cellWidth
+			c := snapshotHeatEmpty
+			if peak > 0 && v > 0 {
+				c = blendSnapshotColor(snapshotHeatEmpty, snapshotAccent, 0.15+0.85*float64(v)/float64(peak))
+			}
+			fillSnapshotRect(img, x, y, cellWidth-2, cellHeight-2, c)
+		}
+	}
+	for hour := 0; hour < 24; hour += 6 {
+		x := area.Min.X + labelWidth + hour*cellWidth
+		drawSnapshotText(img, x, area.Min.Y+7*cellHeight+6, strconv.Itoa(hour), 2, snapshotMuted)
+	}
+}
+
+// blendSnapshotColor 在两种颜色之间线性插值，t 取 [0, 1]
+func blendSnapshotColor(from, to color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+	return color.RGBA{mix(from.R, to.R), mix(from.G, to.G), mix(from.B, to.B), 255}
+}
+
+func formatSnapshotCost(cost float64) string {
+	if cost >= 1000 {
+		return fmt.Sprintf("$%.0f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+// encodeSnapshotPDF 生成 A4 横向单页 PDF，快照以 Flate 压缩的 RGB 图像嵌入并等比缩放居中
+func encodeSnapshotPDF(img *image.RGBA) ([]byte, error) {
+	bounds := img.Bounds()
+	raw := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			raw = append(raw, c.R, c.G, c.B)
+		}
+	}
+	var pixels bytes.Buffer
+	zw := zlib.NewWriter(&pixels)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	const pageWidth, pageHeight, margin = 842.0, 595.0, 20.0
+	scale := math.Min((pageWidth-2*margin)/float64(bounds.Dx()), (pageHeight-2*margin)/float64(bounds.Dy()))
+	drawWidth, drawHeight := float64(bounds.Dx())*scale, float64(bounds.Dy())*scale
+	content := fmt.Sprintf("q %.2f 0 0 %.2f %.2f %.2f cm /Im0 Do Q\n",
+		drawWidth, drawHeight, (pageWidth-drawWidth)/2, (pageHeight-drawHeight)/2)
+
+	var out bytes.Buffer
+	offsets := make([]int, 0, 5)
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			out.WriteString("stream\n")
+			out.Write(stream)
+			out.WriteString("\nendstream\n")
+		}
+		out.WriteString("endobj\n")
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>", nil)
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /XObject << /Im0 5 0 R >> >> /Contents 4 0 R >>",
+		pageWidth, pageHeight), nil)
+	object(fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+	object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+		bounds.Dx(), bounds.Dy(), pixels.Len()), pixels.Bytes())
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// ===== 管理接口 =====
+
+// adminStatsSnapshotHandler GET /stats/snapshot?format=png|pdf&days=30&platform=claude
+func (prs *ProviderRelayService) adminStatsSnapshotHandler(c *gin.Context) {
+	days, _ := strconv.Atoi(c.Query("days"))
+	opts, err := DashboardSnapshotOptions{
+		Format:   c.Query("format"),
+		Days:     days,
+		Platform: c.Query("platform"),
+	}.normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	data, err := (&LogService{}).RenderDashboardSnapshot(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	contentType := "image/png"
+	if opts.Format == SnapshotFormatPDF {
+		contentType = "application/pdf"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="dashboard_%s.%s"`, time.Now().Format("20060102_150405"), opts.Format))
+	c.Data(http.StatusOK, contentType, data)
+}
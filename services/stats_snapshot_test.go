@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+func insertSnapshotLog(t *testing.T, provider string, cost float64, createdAt time.Time) {
+	t.Helper()
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO request_log (platform, model, provider, http_code, total_cost, created_at) VALUES ('claude', 'm', ?, 200, ?, ?)`,
+		provider, cost, createdAt.UTC().Format(timeLayout)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectDashboardSnapshot(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	now := time.Now()
+	insertSnapshotLog(t, "anthropic", 1.5, now)
+	insertSnapshotLog(t, "anthropic", 0.5, now.Add(-24*time.Hour))
+	insertSnapshotLog(t, "openrouter", 0.25, now)
+	insertSnapshotLog(t, "old", 9, now.AddDate(0, 0, -30))
+
+	data, err := collectDashboardSnapshot("", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Daily) != 7 || data.TotalRequests != 3 {
+		t.Fatalf("unexpected snapshot window: %d days, %d requests", len(data.Daily), data.TotalRequests)
+	}
+	if got := data.Daily[6].TotalCost; got < 1.74 || got > 1.76 {
+		t.Fatalf("expected today's cost 1.75, got %v", got)
+	}
+	if len(data.Providers) != 2 || data.Providers[0].Provider != "anthropic" || data.Providers[0].Requests != 2 {
+		t.Fatalf("unexpected provider breakdown %+v", data.Providers)
+	}
+	local := now.In(statsLocation())
+	if data.Heatmap[(int(local.Weekday())+6)%7][local.Hour()] < 2 {
+		t.Fatalf("expected current hour in heatmap, got %v", data.Heatmap)
+	}
+
+	other, err := collectDashboardSnapshot("codex", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.TotalRequests != 0 || len(other.Providers) != 0 {
+		t.Fatalf("platform filter should exclude claude logs, got %+v", other)
+	}
+}
+
+func TestRenderDashboardSnapshotFormats(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	insertSnapshotLog(t, "anthropic", 2, time.Now())
+	ls := &LogService{}
+
+	data, err := ls.RenderDashboardSnapshot(DashboardSnapshotOptions{Days: 14})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != snapshotWidth || img.Bounds().Dy() != snapshotHeight {
+		t.Fatalf("unexpected image size %v", img.Bounds())
+	}
+
+	pdf, err := ls.RenderDashboardSnapshot(DashboardSnapshotOptions{Format: "PDF"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) || !bytes.Contains(pdf, []byte("/Subtype /Image")) {
+		t.Fatal("expected a single-page pdf with an embedded image")
+	}
+
+	if _, err := ls.RenderDashboardSnapshot(DashboardSnapshotOptions{Format: "svg"}); err == nil {
+		t.Fatal("expected unsupported format to be rejected")
+	}
+
+	path, err := ls.ExportDashboardSnapshot(DashboardSnapshotOptions{Format: "pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, ".pdf") {
+		t.Fatalf("unexpected export path %q", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminStatsSnapshotHandler(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{}
+	router := gin.New()
+	router.GET("/stats/snapshot", prs.adminStatsSnapshotHandler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/snapshot?format=pdf&days=3", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), ".pdf") {
+		t.Fatalf("expected attachment filename, got %q", rec.Header().Get("Content-Disposition"))
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/snapshot?format=gif", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unsupported format, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	// 内置 IANA 时区数据库，Windows 等没有系统时区数据的环境也能解析时区名
+	_ "time/tzdata"
+)
+
+// statsZone 统计分桶（今日 / 按小时 / 按天）使用的时区，nil 表示本机时区
+var statsZone atomic.Pointer[time.Location]
+
+// SetStatsTimezone 设置统计分桶时区：IANA 名称（如 Asia/Shanghai、UTC），空或 "Local" 表示本机时区。
+// request_log.created_at 始终按 UTC 存储，只有分桶边界随时区变化
+func SetStatsTimezone(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "local") {
+		statsZone.Store(nil)
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("无效的统计时区 %q: %w", name, err)
+	}
+	statsZone.Store(loc)
+	return nil
+}
+
+// GetStatsTimezone 返回当前统计时区名称
+func (ls *LogService) GetStatsTimezone() string {
+	return statsLocation().String()
+}
+
+func statsLocation() *time.Location {
+	if loc := statsZone.Load(); loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
+// statsNow 统计时区下的当前时间
+func statsNow() time.Time {
+	return time.Now().In(statsLocation())
+}
+
+// nextStartOfDay 下一个自然日零点；按日期而非 24 小时推算，夏令时切换日同样准确
+func nextStartOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+}
+
+// hourAlignedZone 时区在 [start, end] 两端的 UTC 偏移是否为整小时；
+// 否则（如 +05:30）UTC 小时汇总桶跨越本地小时边界，只能按原始日志分桶
+func hourAlignedZone(start, end time.Time, loc *time.Location) bool {
+	for _, t := range []time.Time{start, end} {
+		if _, offset := t.In(loc).Zone(); offset%3600 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// statsUsageSource 按统计时区分桶时使用的用量来源：整小时偏移读小时汇总表，否则全部读原始日志
+func statsUsageSource(db *sql.DB, start, end time.Time) (string, []any) {
+	if !hourAlignedZone(start, end, statsLocation()) {
+		db = nil
+	}
+	return requestLogUsageSource(db, start, end, false)
+}
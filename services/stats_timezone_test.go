@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func TestStatsTimezone(t *testing.T) {
+	defer SetStatsTimezone("")
+	if err := SetStatsTimezone("Mars/Olympus"); err == nil {
+		t.Fatal("expected invalid time zone to be rejected")
+	}
+
+	// 夏令时切换日按日期推算下一个零点
+	ny, _ := time.LoadLocation("America/New_York")
+	springForward := time.Date(2026, 3, 8, 0, 0, 0, 0, ny)
+	if hours := nextStartOfDay(springForward).Sub(springForward); hours != 23*time.Hour {
+		t.Fatalf("expected a 23-hour day, got %v", hours)
+	}
+
+	openAnalyticsDB(t, "timezone.db")
+	db, _ := xdb.DB("default")
+	ls := NewLogService()
+	for _, zone := range []string{"Asia/Shanghai", "Asia/Kolkata", "UTC"} {
+		if err := SetStatsTimezone(zone); err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"request_log", rollupHourlyTable, rollupDailyTable, rollupStateTable} {
+			db.Exec("DELETE FROM " + table)
+		}
+
+		// 统计时区的今天 00:10 与昨天 23:50（created_at 按 UTC 存储）
+		midnight := startOfDay(statsNow())
+		for _, at := range []time.Time{midnight.Add(10 * time.Minute), midnight.Add(-10 * time.Minute)} {
+			if _, err := db.Exec("INSERT INTO request_log (platform, http_code, total_cost, created_at) VALUES ('claude', 200, 1, ?)", at.UTC().Format(timeLayout)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		refreshRequestLogRollups(db, time.Now())
+
+		stats, err := ls.StatsSince("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalRequests != 1 || stats.Series[0].TotalRequests != 1 || stats.Series[0].Day != midnight.Format(timeLayout) {
+			t.Fatalf("%s: expected only the 00:10 request in today's first hour, got %+v", zone, stats)
+		}
+		today, _ := (&ProviderRelayService{}).GetLogStatistics("today")
+		if today.TotalRequests != 1 {
+			t.Fatalf("%s: expected 1 request today, got %d", zone, today.TotalRequests)
+		}
+		cost, _ := ls.CostAnalysis("", 2)
+		if cost.CostTrend[0].Requests != 1 || cost.CostTrend[1].Requests != 1 || cost.CostTrend[1].Day != midnight.Format("2006-01-02") {
+			t.Fatalf("%s: expected one request per day, got %+v", zone, cost.CostTrend)
+		}
+		heatmap, _ := ls.HeatmapStats(2)
+		if len(heatmap) != 2 || heatmap[0].Day != midnight.Format("01-02 15") {
+			t.Fatalf("%s: expected heatmap hours in the stats time zone, got %+v", zone, heatmap)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// VectorClock 向量时钟：设备 ID -> 该设备对文档的修改次数
+type VectorClock map[string]uint64
+
+type clockOrder int
+
+const (
+	clockEqual      clockOrder = iota
+	clockBefore                // 本时钟早于对方（对方包含本方全部修改）
+	clockAfter                 // 本时钟晚于对方
+	clockConcurrent            // 双方各有对方没有的修改
+)
+
+// compare 比较两个向量时钟
+func (c VectorClock) compare(other VectorClock) clockOrder {
+	less, greater := false, false
+	for device, n := range c {
+		if n > other[device] {
+			greater = true
+		} else if n < other[device] {
+			less = true
+		}
+	}
+	for device, n := range other {
+		if _, ok := c[device]; !ok && n > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && greater:
+		return clockConcurrent
+	case less:
+		return clockBefore
+	case greater:
+		return clockAfter
+	default:
+		return clockEqual
+	}
+}
+
+func (c VectorClock) clone() VectorClock {
+	out := make(VectorClock, len(c))
+	for device, n := range c {
+		out[device] = n
+	}
+	return out
+}
+
+// merged 逐设备取较大值
+func (c VectorClock) merged(other VectorClock) VectorClock {
+	out := c.clone()
+	for device, n := range other {
+		if n > out[device] {
+			out[device] = n
+		}
+	}
+	return out
+}
+
+// SyncDoc 带版本的同步文档，Data 为 JSON 对象，按顶层字段合并
+type SyncDoc struct {
+	Key   string                 `json:"key"`
+	Clock VectorClock            `json:"clock"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// Conflict 两台设备并发修改了同一文档的同一字段，等待人工处理
+type Conflict struct {
+	ID           string                 `json:"id"`
+	Scope        Scope                  `json:"scope"`
+	Key          string                 `json:"key"`
+	Fields       []string               `json:"fields"` // 双方都修改且取值不同的字段
+	Base         map[string]interface{} `json:"base,omitempty"`
+	Local        map[string]interface{} `json:"local"`
+	Remote       map[string]interface{} `json:"remote"`
+	RemoteDevice string                 `json:"remote_device"`
+	RemoteClock  VectorClock            `json:"remote_clock"`
+	DetectedAt   time.Time              `json:"detected_at"`
+}
+
+// ConflictResolution 冲突处理方式
+type ConflictResolution struct {
+	// Keep 未在 Fields 中指定的冲突字段取哪一方：local / remote
+	Keep string `json:"keep"`
+	// Fields 按字段指定取值方
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// MergeAction 收到远端文档后的处理结果
+type MergeAction int
+
+const (
+	MergeIgnore   MergeAction = iota // 远端版本不比本地新
+	MergeApply                       // 远端版本包含本地全部修改，直接采用
+	MergeMerged                      // 并发修改了不同字段，已自动合并，需要写入本地并回传
+	MergeConflict                    // 并发修改了同一字段，等待人工处理
+)
+
+// MergeResult 远端文档的处理结果
+type MergeResult struct {
+	Action   MergeAction
+	Doc      SyncDoc // Apply / Merged 时需要写入本地的内容
+	Conflict *Conflict
+}
+
+// maxDocHistory 每个文档保留的历史版本数，用于查找三方合并的共同祖先
+const maxDocHistory = 16
+
+type docVersion struct {
+	Clock VectorClock            `json:"clock"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+type docState struct {
+	Scope   Scope                  `json:"scope"`
+	Key     string                 `json:"key"`
+	Clock   VectorClock            `json:"clock"`
+	Data    map[string]interface{} `json:"data"`
+	History []docVersion           `json:"history"`
+	Pending bool                   `json:"pending"` // 本地版本尚未发布
+}
+
+// record 写入新版本并追加历史
+func (st *docState) record(clock VectorClock, data map[string]interface{}) {
+	st.Clock = clock
+	st.Data = data
+	st.History = append(st.History, docVersion{Clock: clock.clone(), Data: data})
+	if len(st.History) > maxDocHistory {
+		st.History = st.History[len(st.History)-maxDocHistory:]
+	}
+}
+
+// ancestor 返回本地历史中被远端时钟包含的最新版本，即双方的共同祖先
+func (st *docState) ancestor(remote VectorClock) map[string]interface{} {
+	for i := len(st.History) - 1; i >= 0; i-- {
+		if order := st.History[i].Clock.compare(remote); order == clockBefore || order == clockEqual {
+			return st.History[i].Data
+		}
+	}
+	return nil
+}
+
+// ConflictEngine 基于向量时钟的多设备配置冲突检测：
+// 顺序修改直接采用新版本，并发修改按字段三方合并，同一字段冲突时留给用户处理
+type ConflictEngine struct {
+	mu        sync.Mutex
+	path      string // 状态文件，为空时只保存在内存
+	deviceID  string
+	docs      map[string]*docState
+	conflicts map[string]*Conflict
+}
+
+type engineState struct {
+	Docs      map[string]*docState `json:"docs"`
+	Conflicts []*Conflict          `json:"conflicts"`
+}
+
+// NewConflictEngine 创建冲突引擎并加载已保存的状态
+func NewConflictEngine(path, deviceID string) *ConflictEngine {
+	e := &ConflictEngine{
+		path:      path,
+		deviceID:  deviceID,
+		docs:      make(map[string]*docState),
+		conflicts: make(map[string]*Conflict),
+	}
+	if err := e.load(); err != nil {
+		fmt.Printf("[Sync] Failed to load sync state: %v\n", err)
+	}
+	return e
+}
+
+func docKey(scope Scope, key string) string {
+	return string(scope) + "/" + key
+}
+
+// LocalUpdate 记录本地修改，内容有变化时递增本设备时钟并标记为待发布
+func (e *ConflictEngine) LocalUpdate(scope Scope, key string, data map[string]interface{}) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := e.docs[docKey(scope, key)]
+	if st == nil {
+		st = &docState{Scope: scope, Key: key, Clock: VectorClock{}}
+		e.docs[docKey(scope, key)] = st
+	} else if reflect.DeepEqual(st.Data, data) {
+		return false
+	}
+
+	clock := st.Clock.clone()
+	clock[e.deviceID]++
+	st.record(clock, data)
+	st.Pending = true
+	e.saveLocked()
+	return true
+}
+
+// Pending 返回指定类别尚未发布的本地版本
+func (e *ConflictEngine) Pending(scope Scope) []SyncDoc {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var docs []SyncDoc
+	for _, st := range e.docs {
+		if st.Scope == scope && st.Pending {
+			docs = append(docs, SyncDoc{Key: st.Key, Clock: st.Clock.clone(), Data: st.Data})
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Key < docs[j].Key })
+	return docs
+}
+
+// MarkPublished 标记版本已发布，发布期间再次修改的文档保持待发布
+func (e *ConflictEngine) MarkPublished(scope Scope, docs []SyncDoc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, doc := range docs {
+		if st := e.docs[docKey(scope, doc.Key)]; st != nil && st.Clock.compare(doc.Clock) == clockEqual {
+			st.Pending = false
+		}
+	}
+	e.saveLocked()
+}
+
+// Receive 处理其他设备发布的文档
+func (e *ConflictEngine) Receive(scope Scope, fromDevice string, remote SyncDoc) MergeResult {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := docKey(scope, remote.Key)
+	st := e.docs[k]
+	if st == nil {
+		st = &docState{Scope: scope, Key: remote.Key}
+		st.record(remote.Clock.clone(), remote.Data)
+		e.docs[k] = st
+		e.saveLocked()
+		return MergeResult{Action: MergeApply, Doc: remote}
+	}
+
+	switch st.Clock.compare(remote.Clock) {
+	case clockEqual, clockAfter:
+		return MergeResult{Action: MergeIgnore}
+	case clockBefore:
+		st.record(remote.Clock.clone(), remote.Data)
+		st.Pending = false
+		e.dropConflictsLocked(scope, remote.Key)
+		e.saveLocked()
+		return MergeResult{Action: MergeApply, Doc: remote}
+	}
+
+	base := st.ancestor(remote.Clock)
+	merged, fields := threeWayMerge(base, st.Data, remote.Data)
+	if len(fields) == 0 {
+		clock := st.Clock.merged(remote.Clock)
+		clock[e.deviceID]++
+		st.record(clock, merged)
+		st.Pending = true
+		e.dropConflictsLocked(scope, remote.Key)
+		e.saveLocked()
+		return MergeResult{Action: MergeMerged, Doc: SyncDoc{Key: remote.Key, Clock: clock.clone(), Data: merged}}
+	}
+
+	// 同一文档只保留最新的一条冲突
+	e.dropConflictsLocked(scope, remote.Key)
+	conflict := &Conflict{
+		ID:           generateID(),
+		Scope:        scope,
+		Key:          remote.Key,
+		Fields:       fields,
+		Base:         base,
+		Local:        st.Data,
+		Remote:       remote.Data,
+		RemoteDevice: fromDevice,
+		RemoteClock:  remote.Clock.clone(),
+		DetectedAt:   time.Now(),
+	}
+	e.conflicts[conflict.ID] = conflict
+	e.saveLocked()
+	return MergeResult{Action: MergeConflict, Conflict: conflict}
+}
+
+// Conflicts 返回待处理的冲突，按检测时间排序
+func (e *ConflictEngine) Conflicts() []Conflict {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := make([]Conflict, 0, len(e.conflicts))
+	for _, c := range e.conflicts {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DetectedAt.Before(list[j].DetectedAt) })
+	return list
+}
+
+// Resolve 按用户选择解决冲突：不冲突的字段照常合并，冲突字段按 resolution 取值。
+// 返回需要写入本地并发布的文档
+func (e *ConflictEngine) Resolve(id string, resolution ConflictResolution) (Scope, SyncDoc, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c, ok := e.conflicts[id]
+	if !ok {
+		return "", SyncDoc{}, fmt.Errorf("conflict not found: %s", id)
+	}
+	if err := validateSide(resolution.Keep); err != nil {
+		return "", SyncDoc{}, err
+	}
+	for field, side := range resolution.Fields {
+		if err := validateSide(side); err != nil {
+			return "", SyncDoc{}, fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+
+	k := docKey(c.Scope, c.Key)
+	st := e.docs[k]
+	if st == nil {
+		st = &docState{Scope: c.Scope, Key: c.Key, Clock: VectorClock{}}
+		e.docs[k] = st
+	}
+
+	// 以当前本地内容为准，冲突检测后本地可能又有修改
+	merged, fields := threeWayMerge(st.ancestor(c.RemoteClock), st.Data, c.Remote)
+	for _, field := range fields {
+		side := resolution.Keep
+		if s, ok := resolution.Fields[field]; ok {
+			side = s
+		}
+		if side != "remote" {
+			continue
+		}
+		if v, ok := c.Remote[field]; ok {
+			merged[field] = v
+		} else {
+			delete(merged, field)
+		}
+	}
+
+	clock := st.Clock.merged(c.RemoteClock)
+	clock[e.deviceID]++
+	st.record(clock, merged)
+	st.Pending = true
+	delete(e.conflicts, id)
+	e.saveLocked()
+	return c.Scope, SyncDoc{Key: c.Key, Clock: clock.clone(), Data: merged}, nil
+}
+
+func validateSide(side string) error {
+	if side != "local" && side != "remote" {
+		return fmt.Errorf("invalid resolution %q, expected local or remote", side)
+	}
+	return nil
+}
+
+func (e *ConflictEngine) dropConflictsLocked(scope Scope, key string) {
+	for id, c := range e.conflicts {
+		if c.Scope == scope && c.Key == key {
+			delete(e.conflicts, id)
+		}
+	}
+}
+
+// threeWayMerge 按顶层字段合并：只有一方修改的字段取修改方，双方改成不同值的字段记为冲突（暂取本地值）
+func threeWayMerge(base, local, remote map[string]interface{}) (map[string]interface{}, []string) {
+	merged := make(map[string]interface{}, len(local))
+	keys := make(map[string]struct{}, len(local)+len(remote))
+	for k := range base {
+		keys[k] = struct{}{}
+	}
+	for k := range local {
+		keys[k] = struct{}{}
+	}
+	for k := range remote {
+		keys[k] = struct{}{}
+	}
+
+	var conflicts []string
+	for k := range keys {
+		b, bOK := base[k]
+		l, lOK := local[k]
+		r, rOK := remote[k]
+
+		var v interface{}
+		var present bool
+		switch {
+		case sameValue(l, lOK, r, rOK):
+			v, present = l, lOK
+		case sameValue(l, lOK, b, bOK):
+			v, present = r, rOK
+		case sameValue(r, rOK, b, bOK):
+			v, present = l, lOK
+		default:
+			v, present = l, lOK
+			conflicts = append(conflicts, k)
+		}
+		if present {
+			merged[k] = v
+		}
+	}
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+func sameValue(a interface{}, aOK bool, b interface{}, bOK bool) bool {
+	if aOK != bOK {
+		return false
+	}
+	return !aOK || reflect.DeepEqual(a, b)
+}
+
+// toDocData 将任意值规整为 JSON 对象，保证与从网络解码的文档可直接比较
+func toDocData(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("sync document must be a JSON object: %w", err)
+	}
+	return data, nil
+}
+
+func (e *ConflictEngine) load() error {
+	if e.path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(e.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var state engineState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return err
+	}
+	for k, st := range state.Docs {
+		if st.Clock == nil {
+			st.Clock = VectorClock{}
+		}
+		e.docs[k] = st
+	}
+	for _, c := range state.Conflicts {
+		e.conflicts[c.ID] = c
+	}
+	return nil
+}
+
+// saveLocked 持久化状态（可能包含 API Key，仅当前用户可读）
+func (e *ConflictEngine) saveLocked() {
+	if e.path == "" {
+		return
+	}
+	state := engineState{Docs: e.docs, Conflicts: make([]*Conflict, 0, len(e.conflicts))}
+	for _, c := range e.conflicts {
+		state.Conflicts = append(state.Conflicts, c)
+	}
+	raw, err := json.Marshal(state)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(e.path), 0755)
+	}
+	if err == nil {
+		tmp := e.path + ".tmp"
+		if err = os.WriteFile(tmp, raw, 0600); err == nil {
+			err = os.Rename(tmp, e.path)
+		}
+	}
+	if err != nil {
+		fmt.Printf("[Sync] Failed to save sync state: %v\n", err)
+	}
+}
@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// publishTo 模拟 from 发布的待同步文档被 to 接收
+func publishTo(t *testing.T, from, to *ConflictEngine, fromDevice string) []MergeResult {
+	t.Helper()
+	docs := from.Pending(ScopeProviders)
+	from.MarkPublished(ScopeProviders, docs)
+	results := make([]MergeResult, 0, len(docs))
+	for _, doc := range docs {
+		results = append(results, to.Receive(ScopeProviders, fromDevice, doc))
+	}
+	return results
+}
+
+func TestConflictEngineSequentialEdits(t *testing.T) {
+	a := NewConflictEngine("", "a")
+	b := NewConflictEngine("", "b")
+
+	a.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://x", "level": float64(1)})
+	if r := publishTo(t, a, b, "a"); len(r) != 1 || r[0].Action != MergeApply {
+		t.Fatalf("first sync should apply, got %+v", r)
+	}
+
+	b.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://y", "level": float64(1)})
+	r := publishTo(t, b, a, "b")
+	if r[0].Action != MergeApply || r[0].Doc.Data["apiUrl"] != "https://y" {
+		t.Fatalf("newer remote version should fast-forward, got %+v", r[0])
+	}
+
+	// 重复投递不会再次写回
+	doc := SyncDoc{Key: "claude/p1", Clock: r[0].Doc.Clock, Data: r[0].Doc.Data}
+	if again := a.Receive(ScopeProviders, "b", doc); again.Action != MergeIgnore {
+		t.Fatalf("duplicate delivery should be ignored, got %v", again.Action)
+	}
+	if a.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://y", "level": float64(1)}) {
+		t.Fatal("writing back the applied content must not create a new version")
+	}
+}
+
+func TestConflictEngineMergesDisjointFields(t *testing.T) {
+	a := NewConflictEngine("", "a")
+	b := NewConflictEngine("", "b")
+	base := map[string]interface{}{"apiUrl": "https://x", "level": float64(1), "enabled": true}
+	a.LocalUpdate(ScopeProviders, "claude/p1", base)
+	publishTo(t, a, b, "a")
+
+	// 两台设备离线修改不同字段
+	a.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://a", "level": float64(1), "enabled": true})
+	b.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://x", "level": float64(3), "enabled": true})
+
+	r := publishTo(t, b, a, "b")[0]
+	if r.Action != MergeMerged {
+		t.Fatalf("disjoint edits should merge automatically, got %v", r.Action)
+	}
+	if r.Doc.Data["apiUrl"] != "https://a" || r.Doc.Data["level"] != float64(3) {
+		t.Fatalf("merged data = %+v", r.Doc.Data)
+	}
+
+	// 合并结果回传后对方直接采用
+	back := publishTo(t, a, b, "a")[0]
+	if back.Action != MergeApply || back.Doc.Data["apiUrl"] != "https://a" {
+		t.Fatalf("merged version should fast-forward on the other device, got %+v", back)
+	}
+	if len(a.Conflicts()) != 0 || len(b.Conflicts()) != 0 {
+		t.Fatal("no conflicts expected")
+	}
+}
+
+func TestConflictEngineDetectsAndResolvesConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync-state.json")
+	a := NewConflictEngine(path, "a")
+	b := NewConflictEngine("", "b")
+	a.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://x", "level": float64(1)})
+	publishTo(t, a, b, "a")
+
+	a.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://a", "level": float64(1)})
+	b.LocalUpdate(ScopeProviders, "claude/p1", map[string]interface{}{"apiUrl": "https://b", "level": float64(2)})
+
+	r := publishTo(t, b, a, "b")[0]
+	if r.Action != MergeConflict || len(r.Conflict.Fields) != 1 || r.Conflict.Fields[0] != "apiUrl" {
+		t.Fatalf("expected conflict on apiUrl, got %+v", r)
+	}
+
+	// 冲突持久化，重启后仍可处理
+	a = NewConflictEngine(path, "a")
+	conflicts := a.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].RemoteDevice != "b" {
+		t.Fatalf("conflict not persisted: %+v", conflicts)
+	}
+
+	if _, _, err := a.Resolve(conflicts[0].ID, ConflictResolution{Keep: "theirs"}); err == nil {
+		t.Fatal("invalid resolution should be rejected")
+	}
+	scope, doc, err := a.Resolve(conflicts[0].ID, ConflictResolution{Keep: "remote"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scope != ScopeProviders || doc.Data["apiUrl"] != "https://b" || doc.Data["level"] != float64(2) {
+		t.Fatalf("resolved doc = %+v", doc)
+	}
+	if len(a.Conflicts()) != 0 {
+		t.Fatal("conflict should be removed after resolve")
+	}
+
+	// 处理结果包含双方修改，对方直接采用
+	back := publishTo(t, a, b, "a")[0]
+	if back.Action != MergeApply {
+		t.Fatalf("resolved version should fast-forward on the other device, got %v", back.Action)
+	}
+}
+
+func TestThreeWayMergeFieldRemoval(t *testing.T) {
+	base := map[string]interface{}{"a": float64(1), "b": "x"}
+	local := map[string]interface{}{"a": float64(1)}
+	remote := map[string]interface{}{"a": float64(2), "b": "x"}
+
+	merged, conflicts := threeWayMerge(base, local, remote)
+	if len(conflicts) != 0 {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+	if _, ok := merged["b"]; ok || merged["a"] != float64(2) {
+		t.Fatalf("merged = %+v", merged)
+	}
+}
@@ -2,7 +2,9 @@ package sync
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -16,12 +18,18 @@ type NATSClient struct {
 	config *NATSConfig
 	mu     sync.RWMutex
 	subs   map[string]*nats.Subscription
+
+	onReconnect func()
 }
 
+// ErrNotConnected NATS 当前不可达
+var ErrNotConnected = errors.New("nats not connected")
+
 // NATSConfig NATS 配置
 type NATSConfig struct {
 	URL                 string
-	ReconnectWait       time.Duration
+	ReconnectWait       time.Duration // 重连初始间隔，之后指数增长
+	MaxReconnectWait    time.Duration // 重连间隔上限
 	MaxReconnects       int
 	ReconnectBufferSize int
 	Enabled             bool
@@ -32,6 +40,7 @@ func DefaultNATSConfig() *NATSConfig {
 	return &NATSConfig{
 		URL:                 "nats://localhost:4222",
 		ReconnectWait:       2 * time.Second,
+		MaxReconnectWait:    time.Minute,
 		MaxReconnects:       -1, // 无限重连
 		ReconnectBufferSize: 8 * 1024 * 1024,
 		Enabled:             false, // 默认禁用
@@ -58,13 +67,20 @@ func (c *NATSClient) Connect() error {
 
 	opts := []nats.Option{
 		nats.MaxReconnects(c.config.MaxReconnects),
-		nats.ReconnectWait(c.config.ReconnectWait),
+		nats.CustomReconnectDelay(c.reconnectDelay),
 		nats.ReconnectBufSize(c.config.ReconnectBufferSize),
+		// 启动时服务不可达也在后台持续重试，事件先进入发件箱
+		nats.RetryOnFailedConnect(true),
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			fmt.Printf("[Sync] NATS connected to %s\n", nc.ConnectedUrl())
+			c.notifyReconnect()
+		}),
 		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
 			fmt.Printf("[Sync] NATS disconnected: %v\n", err)
 		}),
 		nats.ReconnectHandler(func(nc *nats.Conn) {
 			fmt.Printf("[Sync] NATS reconnected to %s\n", nc.ConnectedUrl())
+			c.notifyReconnect()
 		}),
 		nats.ClosedHandler(func(nc *nats.Conn) {
 			fmt.Println("[Sync] NATS connection closed")
@@ -77,7 +93,11 @@ func (c *NATSClient) Connect() error {
 	}
 
 	c.nc = nc
-	fmt.Printf("[Sync] Connected to NATS at %s\n", nc.ConnectedUrl())
+	if nc.IsConnected() {
+		fmt.Printf("[Sync] Connected to NATS at %s\n", nc.ConnectedUrl())
+	} else {
+		fmt.Printf("[Sync] NATS at %s unreachable, retrying in background\n", c.config.URL)
+	}
 
 	// 初始化 JetStream
 	js, err := nc.JetStream()
@@ -107,6 +127,42 @@ func (c *NATSClient) Close() error {
 	return nil
 }
 
+// reconnectDelay 指数退避（带 ±20% 抖动），避免网络恢复时大量客户端同时重连
+func (c *NATSClient) reconnectDelay(attempts int) time.Duration {
+	base := c.config.ReconnectWait
+	if base <= 0 {
+		base = 2 * time.Second
+	}
+	maxWait := c.config.MaxReconnectWait
+	if maxWait <= 0 {
+		maxWait = time.Minute
+	}
+	delay := maxWait
+	if attempts < 16 {
+		if d := base << attempts; d > 0 && d < maxWait {
+			delay = d
+		}
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5*2+1)) - delay/5
+	return delay + jitter
+}
+
+func (c *NATSClient) notifyReconnect() {
+	c.mu.RLock()
+	onReconnect := c.onReconnect
+	c.mu.RUnlock()
+	if onReconnect != nil {
+		go onReconnect()
+	}
+}
+
+// SetReconnectHandler 设置连接建立及断线重连后的回调
+func (c *NATSClient) SetReconnectHandler(fn func()) {
+	c.mu.Lock()
+	c.onReconnect = fn
+	c.mu.Unlock()
+}
+
 // IsConnected 检查连接状态
 func (c *NATSClient) IsConnected() bool {
 	return c.nc != nil && c.nc.IsConnected()
@@ -131,6 +187,27 @@ func (c *NATSClient) Publish(subject string, data interface{}) error {
 	return c.nc.Publish(subject, payload)
 }
 
+// PublishRaw 发布已序列化的消息，未连接时返回 ErrNotConnected；
+// ack 为 true 且 JetStream 可用时等待确认
+func (c *NATSClient) PublishRaw(subject string, payload []byte, ack bool) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	if ack && c.js != nil {
+		_, err := c.js.Publish(subject, payload)
+		return err
+	}
+	return c.nc.Publish(subject, payload)
+}
+
+// Flush 等待服务端确认已收到此前发布的全部消息
+func (c *NATSClient) Flush(timeout time.Duration) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	return c.nc.FlushTimeout(timeout)
+}
+
 // PublishWithAck 发布消息并等待确认 (JetStream)
 func (c *NATSClient) PublishWithAck(subject string, data interface{}) error {
 	if !c.IsConnected() {
@@ -236,6 +313,11 @@ func UserSubject(userID, event string) string {
 	return fmt.Sprintf("user.%s.%s", userID, event)
 }
 
+// ScopeSubject 同步类别主题
+func ScopeSubject(userID string, scope Scope) string {
+	return fmt.Sprintf("user.%s.sync_%s", userID, scope)
+}
+
 // SessionSubject 会话主题
 func SessionSubject(userID, sessionID, event string) string {
 	return fmt.Sprintf("chat.%s.%s.%s", userID, sessionID, event)
@@ -0,0 +1,207 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// outboxMaxRows 发件箱上限，长时间离线时丢弃最旧的事件，避免无限增长
+	outboxMaxRows = 100000
+	// outboxMaxAttempts 连接正常但持续发布失败的事件（如超过服务端大小限制）重试上限
+	outboxMaxAttempts = 20
+	outboxBatchSize   = 100
+	outboxTimeLayout  = "2006-01-02 15:04:05"
+)
+
+// Outbox 同步事件的持久化发件箱（SQLite 表 sync_outbox）：
+// NATS 不可达时事件先落盘，连接恢复后按写入顺序重放，确认送达后删除
+type Outbox struct {
+	db      *sql.DB
+	pending atomic.Int64
+	drainMu sync.Mutex // 同一时间只有一个重放过程，保证顺序
+}
+
+// outboxEvent 待发布的事件
+type outboxEvent struct {
+	Seq      int64
+	EventID  string
+	Subject  string
+	Payload  []byte
+	Ack      bool
+	Attempts int
+}
+
+// NewOutbox 创建发件箱并统计积压
+func NewOutbox(db *sql.DB) (*Outbox, error) {
+	if db == nil {
+		return nil, fmt.Errorf("outbox database is nil")
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS sync_outbox (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id TEXT NOT NULL UNIQUE,
+		subject TEXT NOT NULL,
+		payload BLOB NOT NULL,
+		ack INTEGER NOT NULL DEFAULT 0,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create sync_outbox: %w", err)
+	}
+
+	o := &Outbox{db: db}
+	var count int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM sync_outbox").Scan(&count); err != nil {
+		return nil, err
+	}
+	o.pending.Store(count)
+	return o, nil
+}
+
+// Len 积压的事件数
+func (o *Outbox) Len() int64 {
+	return o.pending.Load()
+}
+
+// Enqueue 写入事件，相同 eventID 只保留一条
+func (o *Outbox) Enqueue(eventID, subject string, payload []byte, ack bool) error {
+	ackFlag := 0
+	if ack {
+		ackFlag = 1
+	}
+	res, err := o.db.Exec(
+		"INSERT OR IGNORE INTO sync_outbox (event_id, subject, payload, ack, created_at) VALUES (?, ?, ?, ?, ?)",
+		eventID, subject, payload, ackFlag, time.Now().UTC().Format(outboxTimeLayout),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if o.pending.Add(n) > outboxMaxRows {
+			o.trim()
+		}
+	}
+	return nil
+}
+
+// trim 超过上限时丢弃最旧的事件
+func (o *Outbox) trim() {
+	res, err := o.db.Exec(
+		"DELETE FROM sync_outbox WHERE seq <= (SELECT seq FROM sync_outbox ORDER BY seq DESC LIMIT 1 OFFSET ?)",
+		outboxMaxRows,
+	)
+	if err != nil {
+		fmt.Printf("[Sync] Failed to trim outbox: %v\n", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		o.pending.Add(-n)
+		fmt.Printf("[Sync] Outbox full, dropped %d oldest events\n", n)
+	}
+}
+
+// peek 按写入顺序读取最多 limit 条事件
+func (o *Outbox) peek(limit int) ([]outboxEvent, error) {
+	rows, err := o.db.Query(
+		"SELECT seq, event_id, subject, payload, ack, attempts FROM sync_outbox ORDER BY seq LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []outboxEvent
+	for rows.Next() {
+		var ev outboxEvent
+		var ack int
+		if err := rows.Scan(&ev.Seq, &ev.EventID, &ev.Subject, &ev.Payload, &ack, &ev.Attempts); err != nil {
+			return nil, err
+		}
+		ev.Ack = ack == 1
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// remove 删除已送达的事件
+func (o *Outbox) remove(seqs []int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(seqs)), ",")
+	args := make([]interface{}, len(seqs))
+	for i, seq := range seqs {
+		args[i] = seq
+	}
+	res, err := o.db.Exec("DELETE FROM sync_outbox WHERE seq IN ("+placeholders+")", args...)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	o.pending.Add(-n)
+	return nil
+}
+
+// recordFailure 记录发布失败，超过重试上限的事件被丢弃，返回是否已丢弃
+func (o *Outbox) recordFailure(ev outboxEvent, cause error) bool {
+	if ev.Attempts+1 >= outboxMaxAttempts {
+		fmt.Printf("[Sync] Dropping outbox event %s after %d attempts: %v\n", ev.EventID, ev.Attempts+1, cause)
+		if err := o.remove([]int64{ev.Seq}); err != nil {
+			fmt.Printf("[Sync] Failed to drop outbox event: %v\n", err)
+		}
+		return true
+	}
+	if _, err := o.db.Exec("UPDATE sync_outbox SET attempts = attempts + 1, last_error = ? WHERE seq = ?",
+		cause.Error(), ev.Seq); err != nil {
+		fmt.Printf("[Sync] Failed to record outbox failure: %v\n", err)
+	}
+	return false
+}
+
+// Drain 按顺序重放积压事件：publish 逐条发布，confirm 确认整批已送达后才删除。
+// 遇到失败即停止，保留剩余事件等待下次重放；返回本次送达的事件数
+func (o *Outbox) Drain(publish func(ev outboxEvent) error, confirm func() error) (int, error) {
+	o.drainMu.Lock()
+	defer o.drainMu.Unlock()
+
+	sent := 0
+	for o.pending.Load() > 0 {
+		events, err := o.peek(outboxBatchSize)
+		if err != nil || len(events) == 0 {
+			return sent, err
+		}
+
+		delivered := make([]int64, 0, len(events))
+		var publishErr error
+		for _, ev := range events {
+			if err := publish(ev); err != nil {
+				// 断线不计入重试次数
+				if errors.Is(err, ErrNotConnected) || !o.recordFailure(ev, err) {
+					publishErr = err
+					break
+				}
+				continue
+			}
+			delivered = append(delivered, ev.Seq)
+		}
+
+		if len(delivered) > 0 {
+			if err := confirm(); err != nil {
+				return sent, err
+			}
+			if err := o.remove(delivered); err != nil {
+				return sent, err
+			}
+			sent += len(delivered)
+		}
+		if publishErr != nil {
+			return sent, publishErr
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestOutbox(t *testing.T) (*Outbox, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	outbox, err := NewOutbox(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outbox, db
+}
+
+func TestOutboxReplaysInOrderAndDeduplicates(t *testing.T) {
+	outbox, db := newTestOutbox(t)
+	for _, id := range []string{"e1", "e2", "e1", "e3"} {
+		if err := outbox.Enqueue(id, "user.u1.sync_mcp", []byte(id), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if outbox.Len() != 3 {
+		t.Fatalf("duplicate event id should be ignored, pending = %d", outbox.Len())
+	}
+
+	// 重新打开后积压仍在
+	reopened, err := NewOutbox(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 3 {
+		t.Fatalf("pending after reopen = %d", reopened.Len())
+	}
+
+	var got []string
+	sent, err := reopened.Drain(func(ev outboxEvent) error {
+		got = append(got, ev.EventID)
+		return nil
+	}, func() error { return nil })
+	if err != nil || sent != 3 {
+		t.Fatalf("drain sent %d, err %v", sent, err)
+	}
+	if len(got) != 3 || got[0] != "e1" || got[1] != "e2" || got[2] != "e3" {
+		t.Fatalf("replay order = %v", got)
+	}
+	if reopened.Len() != 0 {
+		t.Fatalf("outbox should be empty, pending = %d", reopened.Len())
+	}
+}
+
+func TestOutboxKeepsEventsUntilDelivered(t *testing.T) {
+	outbox, _ := newTestOutbox(t)
+	for _, id := range []string{"e1", "e2", "e3"} {
+		outbox.Enqueue(id, "s", []byte(id), true)
+	}
+
+	// 第二条发布时断线：第一条送达，其余保留且不计入重试次数
+	sent, err := outbox.Drain(func(ev outboxEvent) error {
+		if ev.EventID == "e2" {
+			return ErrNotConnected
+		}
+		return nil
+	}, func() error { return nil })
+	if !errors.Is(err, ErrNotConnected) || sent != 1 || outbox.Len() != 2 {
+		t.Fatalf("sent %d, pending %d, err %v", sent, outbox.Len(), err)
+	}
+
+	// 确认失败时整批保留
+	if _, err := outbox.Drain(func(outboxEvent) error { return nil }, func() error {
+		return errors.New("flush timeout")
+	}); err == nil || outbox.Len() != 2 {
+		t.Fatalf("unconfirmed events must stay queued, pending %d, err %v", outbox.Len(), err)
+	}
+
+	events, _ := outbox.peek(10)
+	if events[0].EventID != "e2" || events[0].Attempts != 0 || !events[0].Ack {
+		t.Fatalf("head event = %+v", events[0])
+	}
+}
+
+func TestOutboxDropsPoisonEvent(t *testing.T) {
+	outbox, _ := newTestOutbox(t)
+	outbox.Enqueue("bad", "s", []byte("x"), false)
+	outbox.Enqueue("good", "s", []byte("y"), false)
+
+	publish := func(ev outboxEvent) error {
+		if ev.EventID == "bad" {
+			return errors.New("maximum payload exceeded")
+		}
+		return nil
+	}
+	for i := 0; i < outboxMaxAttempts-1; i++ {
+		outbox.Drain(publish, func() error { return nil })
+	}
+	if outbox.Len() != 2 {
+		t.Fatalf("event dropped too early, pending = %d", outbox.Len())
+	}
+	sent, err := outbox.Drain(publish, func() error { return nil })
+	if err != nil || sent != 1 || outbox.Len() != 0 {
+		t.Fatalf("sent %d, pending %d, err %v", sent, outbox.Len(), err)
+	}
+}
+
+func TestReconnectDelayBackoff(t *testing.T) {
+	c := NewNATSClient(&NATSConfig{ReconnectWait: time.Second, MaxReconnectWait: 10 * time.Second})
+	prev := time.Duration(0)
+	for attempt := 0; attempt < 3; attempt++ {
+		d := c.reconnectDelay(attempt)
+		if d <= prev {
+			t.Fatalf("delay should grow, attempt %d = %v (prev %v)", attempt, d, prev)
+		}
+		prev = d
+	}
+	if d := c.reconnectDelay(50); d > 12*time.Second || d < 8*time.Second {
+		t.Fatalf("delay should be capped near max, got %v", d)
+	}
+}
@@ -0,0 +1,161 @@
+package sync
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Scope 同步类别
+type Scope string
+
+const (
+	ScopeProviders   Scope = "providers"    // 供应商配置
+	ScopeAppSettings Scope = "app_settings" // 应用设置
+	ScopeUsageStats  Scope = "usage_stats"  // 用量统计（LLM 请求 / 响应、配额）
+	ScopeRequestLogs Scope = "request_logs" // 请求日志
+	ScopeSkills      Scope = "skills"       // Skill 列表
+	ScopeMCP         Scope = "mcp"          // MCP 服务器列表
+)
+
+// AllScopes 全部同步类别，顺序即界面展示顺序
+var AllScopes = []Scope{ScopeProviders, ScopeAppSettings, ScopeUsageStats, ScopeRequestLogs, ScopeSkills, ScopeMCP}
+
+// Scopes 各类别的同步开关
+type Scopes struct {
+	Providers bool `json:"providers"`
+	// ProviderAPIKeys 同步供应商配置时是否携带 API Key，仅在 Providers 开启时生效
+	ProviderAPIKeys bool `json:"provider_api_keys"`
+	AppSettings     bool `json:"app_settings"`
+	UsageStats      bool `json:"usage_stats"`
+	RequestLogs     bool `json:"request_logs"`
+	Skills          bool `json:"skills"`
+	MCP             bool `json:"mcp"`
+}
+
+// DefaultScopes 默认同步配置：API Key 和请求日志默认不出本机
+func DefaultScopes() Scopes {
+	return Scopes{
+		Providers:   true,
+		AppSettings: true,
+		UsageStats:  true,
+		Skills:      true,
+		MCP:         true,
+	}
+}
+
+// Allows 检查类别是否开启
+func (s Scopes) Allows(scope Scope) bool {
+	switch scope {
+	case ScopeProviders:
+		return s.Providers
+	case ScopeAppSettings:
+		return s.AppSettings
+	case ScopeUsageStats:
+		return s.UsageStats
+	case ScopeRequestLogs:
+		return s.RequestLogs
+	case ScopeSkills:
+		return s.Skills
+	case ScopeMCP:
+		return s.MCP
+	default:
+		return false
+	}
+}
+
+// IncludeAPIKeys 供应商配置是否携带 API Key
+func (s Scopes) IncludeAPIKeys() bool {
+	return s.Providers && s.ProviderAPIKeys
+}
+
+// Enabled 返回开启的类别
+func (s Scopes) Enabled() []Scope {
+	enabled := make([]Scope, 0, len(AllScopes))
+	for _, scope := range AllScopes {
+		if s.Allows(scope) {
+			enabled = append(enabled, scope)
+		}
+	}
+	return enabled
+}
+
+// ScopeOverrides 单个设备的覆盖项，nil 字段沿用全局设置
+type ScopeOverrides struct {
+	Providers       *bool `json:"providers,omitempty"`
+	ProviderAPIKeys *bool `json:"provider_api_keys,omitempty"`
+	AppSettings     *bool `json:"app_settings,omitempty"`
+	UsageStats      *bool `json:"usage_stats,omitempty"`
+	RequestLogs     *bool `json:"request_logs,omitempty"`
+	Skills          *bool `json:"skills,omitempty"`
+	MCP             *bool `json:"mcp,omitempty"`
+}
+
+// Apply 在全局设置上叠加覆盖项
+func (o ScopeOverrides) Apply(base Scopes) Scopes {
+	apply := func(dst *bool, v *bool) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	apply(&base.Providers, o.Providers)
+	apply(&base.ProviderAPIKeys, o.ProviderAPIKeys)
+	apply(&base.AppSettings, o.AppSettings)
+	apply(&base.UsageStats, o.UsageStats)
+	apply(&base.RequestLogs, o.RequestLogs)
+	apply(&base.Skills, o.Skills)
+	apply(&base.MCP, o.MCP)
+	return base
+}
+
+// IsEmpty 没有任何覆盖项
+func (o ScopeOverrides) IsEmpty() bool {
+	return o == ScopeOverrides{}
+}
+
+// secretSuffixes 视为密钥的字段名后缀（小写、去掉 _ 和 - 后比较），
+// 覆盖 apiKey、OPENAI_API_KEY、GITHUB_TOKEN 等写法
+var secretSuffixes = []string{"apikey", "token", "secret", "password"}
+
+func isSecretKey(name string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(normalized, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets 递归删除 JSON 中的密钥字段，非 JSON 对象 / 数组原样返回
+func redactSecrets(data json.RawMessage) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	redacted, err := json.Marshal(stripSecrets(v))
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+func stripSecrets(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if isSecretKey(k) {
+				delete(val, k)
+				continue
+			}
+			val[k] = stripSecrets(child)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = stripSecrets(child)
+		}
+		return val
+	default:
+		return v
+	}
+}
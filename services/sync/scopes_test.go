@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEffectiveScopesWithDeviceOverride(t *testing.T) {
+	on, off := true, false
+	settings := &Settings{
+		DeviceID: "laptop",
+		Scopes:   DefaultScopes(),
+		DeviceOverrides: map[string]ScopeOverrides{
+			"laptop": {RequestLogs: &on, MCP: &off},
+		},
+	}
+
+	laptop := settings.EffectiveScopes("laptop")
+	if !laptop.RequestLogs || laptop.MCP {
+		t.Fatalf("override not applied: %+v", laptop)
+	}
+	if !laptop.Providers || !laptop.Skills {
+		t.Fatalf("unset override fields should keep global values: %+v", laptop)
+	}
+
+	desktop := settings.EffectiveScopes("desktop")
+	if desktop != DefaultScopes() {
+		t.Fatalf("device without override should use global scopes: %+v", desktop)
+	}
+}
+
+func TestScopesAPIKeysRequireProviders(t *testing.T) {
+	scopes := Scopes{ProviderAPIKeys: true}
+	if scopes.IncludeAPIKeys() {
+		t.Fatal("api keys must not sync when providers scope is off")
+	}
+	scopes.Providers = true
+	if !scopes.IncludeAPIKeys() {
+		t.Fatal("api keys should sync when both flags are on")
+	}
+	if got := DefaultScopes().Enabled(); len(got) != 5 {
+		t.Fatalf("default enabled scopes = %v", got)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	in := json.RawMessage(`{"kind":"claude","providers":[{"name":"a","apiKey":"sk-1","maxTokens":10,
+		"env":{"GITHUB_TOKEN":"ghp","REGION":"us"}}]}`)
+
+	var out struct {
+		Kind      string                   `json:"kind"`
+		Providers []map[string]interface{} `json:"providers"`
+	}
+	if err := json.Unmarshal(redactSecrets(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	p := out.Providers[0]
+	if _, ok := p["apiKey"]; ok {
+		t.Fatal("apiKey should be removed")
+	}
+	if p["maxTokens"] != float64(10) || p["name"] != "a" || out.Kind != "claude" {
+		t.Fatalf("non-secret fields changed: %+v", out)
+	}
+	env := p["env"].(map[string]interface{})
+	if _, ok := env["GITHUB_TOKEN"]; ok || env["REGION"] != "us" {
+		t.Fatalf("env not redacted correctly: %+v", env)
+	}
+}
@@ -17,6 +17,19 @@ type Settings struct {
 	DeviceID      string `json:"device_id"`
 	DeviceName    string `json:"device_name"`
 	AccessToken   string `json:"access_token,omitempty"`
+
+	// Scopes 全局同步类别开关
+	Scopes Scopes `json:"scopes"`
+	// DeviceOverrides 按设备 ID 覆盖同步类别
+	DeviceOverrides map[string]ScopeOverrides `json:"device_overrides,omitempty"`
+}
+
+// EffectiveScopes 返回指定设备实际生效的同步类别
+func (s *Settings) EffectiveScopes(deviceID string) Scopes {
+	if override, ok := s.DeviceOverrides[deviceID]; ok {
+		return override.Apply(s.Scopes)
+	}
+	return s.Scopes
 }
 
 // DefaultSettings 默认设置
@@ -28,6 +41,7 @@ func DefaultSettings() *Settings {
 		SyncServerURL: "http://localhost:8081",
 		DeviceID:      generateDeviceID(),
 		DeviceName:    hostname,
+		Scopes:        DefaultScopes(),
 	}
 }
 
@@ -93,6 +107,33 @@ func (s *SettingsService) Update(settings *Settings) error {
 	return s.Save()
 }
 
+// Scopes 返回本设备实际生效的同步类别
+func (s *SettingsService) Scopes() Scopes {
+	return s.settings.EffectiveScopes(s.settings.DeviceID)
+}
+
+// UpdateScopes 更新全局同步类别
+func (s *SettingsService) UpdateScopes(scopes Scopes) error {
+	s.settings.Scopes = scopes
+	return s.Save()
+}
+
+// SetDeviceOverride 设置设备的同步类别覆盖项，空覆盖项等同于清除
+func (s *SettingsService) SetDeviceOverride(deviceID string, override ScopeOverrides) error {
+	if deviceID == "" {
+		return fmt.Errorf("device id is required")
+	}
+	if override.IsEmpty() {
+		delete(s.settings.DeviceOverrides, deviceID)
+		return s.Save()
+	}
+	if s.settings.DeviceOverrides == nil {
+		s.settings.DeviceOverrides = make(map[string]ScopeOverrides)
+	}
+	s.settings.DeviceOverrides[deviceID] = override
+	return s.Save()
+}
+
 // IsEnabled 检查是否启用
 func (s *SettingsService) IsEnabled() bool {
 	return s.settings.Enabled
@@ -114,6 +155,9 @@ func (s *SettingsService) GetSyncConfig() *SyncConfig {
 	return &SyncConfig{
 		NATSConfig:    s.GetNATSConfig(),
 		SyncServerURL: s.settings.SyncServerURL,
+		DeviceID:      s.settings.DeviceID,
+		Scopes:        s.Scopes(),
+		StatePath:     filepath.Join(filepath.Dir(s.filePath), "sync-state.json"),
 	}
 }
 
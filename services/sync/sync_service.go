@@ -1,10 +1,14 @@
 package sync
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/nats-io/nats.go"
 )
 
 // publishedTraceCache stores trace IDs to prevent duplicate publishing
@@ -48,12 +52,28 @@ type SyncService struct {
 	nats         *NATSClient
 	config       *SyncConfig
 	publishCache *publishedTraceCache // Deduplication cache
+
+	scopesMu sync.RWMutex
+	scopes   Scopes // 本设备生效的同步类别，可在运行时更新
+
+	engine     *ConflictEngine
+	outbox     *Outbox // 为空时离线事件直接丢弃
+	appliersMu sync.RWMutex
+	appliers   map[Scope]DocApplier
 }
 
+// DocApplier 将其他设备同步来的文档写回本地配置
+type DocApplier func(key string, data map[string]interface{}) error
+
 // SyncConfig 同步配置
 type SyncConfig struct {
 	NATSConfig    *NATSConfig
 	SyncServerURL string // Sync Service API URL
+	UserID        string // 同步账号，用于发布配置类事件
+	DeviceID      string
+	Scopes        Scopes // 本设备生效的同步类别
+	StatePath     string // 冲突检测状态文件，为空时只保存在内存
+	OutboxDB      *sql.DB // 离线发件箱所在的数据库，为空时不启用
 }
 
 // NewSyncService 创建同步服务
@@ -61,21 +81,110 @@ func NewSyncService(cfg *SyncConfig) *SyncService {
 	if cfg == nil {
 		cfg = &SyncConfig{
 			NATSConfig: DefaultNATSConfig(),
+			Scopes:     DefaultScopes(),
+		}
+	}
+
+	var outbox *Outbox
+	if cfg.OutboxDB != nil {
+		var err error
+		if outbox, err = NewOutbox(cfg.OutboxDB); err != nil {
+			fmt.Printf("[Sync] Offline outbox disabled: %v\n", err)
 		}
 	}
 
 	return &SyncService{
+		outbox:       outbox,
 		nats:         NewNATSClient(cfg.NATSConfig),
 		config:       cfg,
 		publishCache: &publishedTraceCache{},
+		scopes:       cfg.Scopes,
+		engine:       NewConflictEngine(cfg.StatePath, cfg.DeviceID),
+		appliers:     make(map[Scope]DocApplier),
+	}
+}
+
+// Scopes 返回当前生效的同步类别
+func (s *SyncService) Scopes() Scopes {
+	s.scopesMu.RLock()
+	defer s.scopesMu.RUnlock()
+	return s.scopes
+}
+
+// SetScopes 更新同步类别，立即作用于后续发布
+func (s *SyncService) SetScopes(scopes Scopes) {
+	s.scopesMu.Lock()
+	s.scopes = scopes
+	s.scopesMu.Unlock()
+}
+
+// allows 同步已启用且类别开启（不要求已连接，离线事件进入发件箱）
+func (s *SyncService) allows(scope Scope) bool {
+	return s.nats.IsEnabled() && s.Scopes().Allows(scope)
+}
+
+// OutboxPending 发件箱中等待重放的事件数
+func (s *SyncService) OutboxPending() int64 {
+	if s.outbox == nil {
+		return 0
+	}
+	return s.outbox.Len()
+}
+
+// publishDurable 发布需要可靠送达的事件。NATS 不可达、发布失败或发件箱仍有积压时
+// 写入发件箱（按 eventID 去重），保证离线期间产生的事件在恢复后按顺序送达
+func (s *SyncService) publishDurable(eventID, subject string, event interface{}, ack bool) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+	if s.outbox == nil {
+		if err := s.nats.PublishRaw(subject, payload, ack); err != nil && !errors.Is(err, ErrNotConnected) {
+			return err
+		}
+		return nil
+	}
+
+	if s.nats.IsConnected() && s.outbox.Len() == 0 {
+		if err := s.nats.PublishRaw(subject, payload, ack); err == nil {
+			return nil
+		}
+	}
+	if err := s.outbox.Enqueue(eventID, subject, payload, ack); err != nil {
+		return err
+	}
+	if s.nats.IsConnected() {
+		go s.drainOutbox()
+	}
+	return nil
+}
+
+// drainOutbox 按顺序重放发件箱
+func (s *SyncService) drainOutbox() {
+	if s.outbox == nil || s.outbox.Len() == 0 {
+		return
+	}
+	sent, err := s.outbox.Drain(func(ev outboxEvent) error {
+		return s.nats.PublishRaw(ev.Subject, ev.Payload, ev.Ack)
+	}, func() error {
+		return s.nats.Flush(5 * time.Second)
+	})
+	if sent > 0 {
+		fmt.Printf("[Sync] Replayed %d offline events (%d pending)\n", sent, s.outbox.Len())
+	}
+	if err != nil && !errors.Is(err, ErrNotConnected) {
+		fmt.Printf("[Sync] Outbox replay stopped: %v\n", err)
 	}
 }
 
 // Start 启动同步服务
 func (s *SyncService) Start() error {
+	// 连接（及断线重连）后订阅其他设备的文档，并重放离线期间的事件
+	s.nats.SetReconnectHandler(s.onConnected)
 	if err := s.nats.Connect(); err != nil {
 		return err
 	}
+	s.onConnected()
 
 	// Start cache cleanup goroutine (clean entries older than 5 minutes)
 	go func() {
@@ -188,11 +297,228 @@ type QuotaChangeEvent struct {
 	Timestamp   time.Time `json:"timestamp"`
 }
 
+// ScopedEvent 按同步类别发布的配置 / 数据快照
+type ScopedEvent struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"` // sync.<scope>
+	Scope    Scope  `json:"scope"`
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	// IncludesSecrets 负载中保留了 API Key 等密钥
+	IncludesSecrets bool            `json:"includes_secrets"`
+	Data            json.RawMessage `json:"data,omitempty"` // 整体快照（Skill、MCP、请求日志）
+	Docs            []SyncDoc       `json:"docs,omitempty"` // 带版本的文档（供应商、应用设置）
+	Timestamp       time.Time       `json:"timestamp"`
+}
+
+// --- 版本化文档同步 ---
+
+// RegisterApplier 注册某个类别的写回方法，注册后才会接收该类别的远端文档
+func (s *SyncService) RegisterApplier(scope Scope, apply DocApplier) {
+	s.appliersMu.Lock()
+	s.appliers[scope] = apply
+	s.appliersMu.Unlock()
+
+	if s.IsEnabled() {
+		s.subscribeScope(scope)
+	}
+}
+
+func (s *SyncService) applier(scope Scope) DocApplier {
+	s.appliersMu.RLock()
+	defer s.appliersMu.RUnlock()
+	return s.appliers[scope]
+}
+
+func (s *SyncService) onConnected() {
+	if !s.IsEnabled() {
+		return
+	}
+	s.appliersMu.RLock()
+	scopes := make([]Scope, 0, len(s.appliers))
+	for scope := range s.appliers {
+		scopes = append(scopes, scope)
+	}
+	s.appliersMu.RUnlock()
+
+	for _, scope := range scopes {
+		s.subscribeScope(scope)
+	}
+	s.drainOutbox()
+	for _, scope := range AllScopes {
+		if err := s.flushDocs(scope); err != nil {
+			fmt.Printf("[Sync] Failed to publish pending %s: %v\n", scope, err)
+		}
+	}
+}
+
+func (s *SyncService) subscribeScope(scope Scope) {
+	if s.config.UserID == "" {
+		return
+	}
+	subject := ScopeSubject(s.config.UserID, scope)
+	if err := s.nats.Subscribe(subject, func(msg *nats.Msg) {
+		s.handleScopedEvent(scope, msg.Data)
+	}); err != nil {
+		fmt.Printf("[Sync] Failed to subscribe %s: %v\n", subject, err)
+	}
+}
+
+// PublishDocs 记录并发布按 key 划分的文档（如 "claude/供应商名"）。
+// 未连接时只记录版本，连接后再发布；内容未变化的文档不会重复发布
+func (s *SyncService) PublishDocs(scope Scope, docs map[string]interface{}) error {
+	if !s.nats.IsEnabled() || s.config.UserID == "" || !s.Scopes().Allows(scope) {
+		return nil
+	}
+
+	for key, doc := range docs {
+		data, err := s.docData(scope, doc)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", scope, key, err)
+		}
+		s.engine.LocalUpdate(scope, key, data)
+	}
+	return s.flushDocs(scope)
+}
+
+// docData 规整文档内容，未开启同步 API Key 时移除密钥字段
+func (s *SyncService) docData(scope Scope, v interface{}) (map[string]interface{}, error) {
+	data, err := toDocData(v)
+	if err != nil {
+		return nil, err
+	}
+	if scope == ScopeProviders && s.Scopes().IncludeAPIKeys() {
+		return data, nil
+	}
+	stripSecrets(data)
+	return data, nil
+}
+
+// flushDocs 发布该类别尚未发布的本地版本
+func (s *SyncService) flushDocs(scope Scope) error {
+	if !s.allows(scope) || s.config.UserID == "" {
+		return nil
+	}
+	docs := s.engine.Pending(scope)
+	if len(docs) == 0 {
+		return nil
+	}
+
+	event := &ScopedEvent{
+		ID:              generateID(),
+		Type:            "sync." + string(scope),
+		Scope:           scope,
+		UserID:          s.config.UserID,
+		DeviceID:        s.config.DeviceID,
+		IncludesSecrets: scope == ScopeProviders && s.Scopes().IncludeAPIKeys(),
+		Docs:            docs,
+		Timestamp:       time.Now(),
+	}
+	if err := s.publishDurable(event.ID, ScopeSubject(s.config.UserID, scope), event, false); err != nil {
+		return err
+	}
+	s.engine.MarkPublished(scope, docs)
+	return nil
+}
+
+// handleScopedEvent 处理其他设备发布的文档：顺序修改直接写回，
+// 并发修改自动合并后写回并回传，字段冲突记录下来等待用户处理
+func (s *SyncService) handleScopedEvent(scope Scope, raw []byte) {
+	var event ScopedEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		fmt.Printf("[Sync] Invalid %s event: %v\n", scope, err)
+		return
+	}
+	apply := s.applier(scope)
+	if event.DeviceID == s.config.DeviceID || apply == nil || !s.Scopes().Allows(scope) {
+		return
+	}
+	// 发件箱重放可能重复投递，按事件 ID 去重
+	if s.publishCache.hasPublished(event.ID, "scoped_received") {
+		return
+	}
+	s.publishCache.markPublished(event.ID, "scoped_received")
+
+	merged := false
+	for _, doc := range event.Docs {
+		if doc.Data == nil {
+			continue
+		}
+		if !(scope == ScopeProviders && s.Scopes().IncludeAPIKeys()) {
+			stripSecrets(doc.Data)
+		}
+		result := s.engine.Receive(scope, event.DeviceID, doc)
+		switch result.Action {
+		case MergeApply, MergeMerged:
+			if err := apply(result.Doc.Key, result.Doc.Data); err != nil {
+				fmt.Printf("[Sync] Failed to apply %s/%s: %v\n", scope, doc.Key, err)
+			}
+			merged = merged || result.Action == MergeMerged
+		case MergeConflict:
+			fmt.Printf("[Sync] Conflict on %s/%s (fields: %v) with device %s\n",
+				scope, doc.Key, result.Conflict.Fields, event.DeviceID)
+		}
+	}
+	if merged {
+		if err := s.flushDocs(scope); err != nil {
+			fmt.Printf("[Sync] Failed to publish merged %s: %v\n", scope, err)
+		}
+	}
+}
+
+// Conflicts 返回待处理的同步冲突
+func (s *SyncService) Conflicts() []Conflict {
+	return s.engine.Conflicts()
+}
+
+// ResolveConflict 按用户选择解决冲突，写回本地并发布结果
+func (s *SyncService) ResolveConflict(id string, resolution ConflictResolution) error {
+	scope, doc, err := s.engine.Resolve(id, resolution)
+	if err != nil {
+		return err
+	}
+	if apply := s.applier(scope); apply != nil {
+		if err := apply(doc.Key, doc.Data); err != nil {
+			return err
+		}
+	}
+	return s.flushDocs(scope)
+}
+
 // --- 发布方法 ---
 
+// PublishScoped 发布某个同步类别的数据，类别关闭时忽略
+// 除非开启了同步 API Key，否则负载中的密钥字段会被移除
+func (s *SyncService) PublishScoped(scope Scope, data interface{}) error {
+	if !s.allows(scope) || s.config.UserID == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	includeSecrets := scope == ScopeProviders && s.Scopes().IncludeAPIKeys()
+	if !includeSecrets {
+		payload = redactSecrets(payload)
+	}
+
+	event := &ScopedEvent{
+		ID:              generateID(),
+		Type:            "sync." + string(scope),
+		Scope:           scope,
+		UserID:          s.config.UserID,
+		DeviceID:        s.config.DeviceID,
+		IncludesSecrets: includeSecrets,
+		Data:            payload,
+		Timestamp:       time.Now(),
+	}
+	return s.publishDurable(event.ID, ScopeSubject(s.config.UserID, scope), event, false)
+}
+
 // PublishUserMessage 发布用户消息 (idempotent - only publishes once per message ID)
 func (s *SyncService) PublishUserMessage(userID, sessionID string, msg *ChatMessage) error {
-	if !s.IsEnabled() {
+	if !s.nats.IsEnabled() {
 		return nil
 	}
 
@@ -212,7 +538,7 @@ func (s *SyncService) PublishUserMessage(userID, sessionID string, msg *ChatMess
 	}
 
 	subject := SessionSubject(userID, sessionID, "msg")
-	if err := s.nats.PublishWithAck(subject, event); err != nil {
+	if err := s.publishDurable("user_msg:"+msg.ID, subject, event, true); err != nil {
 		return err
 	}
 
@@ -223,7 +549,7 @@ func (s *SyncService) PublishUserMessage(userID, sessionID string, msg *ChatMess
 
 // PublishAssistantMessage 发布助手消息 (idempotent - only publishes once per message ID)
 func (s *SyncService) PublishAssistantMessage(userID, sessionID string, msg *ChatMessage) error {
-	if !s.IsEnabled() {
+	if !s.nats.IsEnabled() {
 		return nil
 	}
 
@@ -243,7 +569,7 @@ func (s *SyncService) PublishAssistantMessage(userID, sessionID string, msg *Cha
 	}
 
 	subject := SessionSubject(userID, sessionID, "msg")
-	if err := s.nats.PublishWithAck(subject, event); err != nil {
+	if err := s.publishDurable("assistant_msg:"+msg.ID, subject, event, true); err != nil {
 		return err
 	}
 
@@ -291,7 +617,7 @@ func (s *SyncService) PublishSessionStatus(userID, sessionID, status, model, pro
 
 // PublishLLMRequest 发布 LLM 请求事件 (idempotent - only publishes once per traceID)
 func (s *SyncService) PublishLLMRequest(req *LLMRequestEvent) error {
-	if !s.IsEnabled() {
+	if !s.allows(ScopeUsageStats) {
 		return nil
 	}
 
@@ -304,7 +630,7 @@ func (s *SyncService) PublishLLMRequest(req *LLMRequestEvent) error {
 	req.Timestamp = time.Now()
 
 	subject := LLMRequestSubject(req.Platform)
-	if err := s.nats.Publish(subject, req); err != nil {
+	if err := s.publishDurable("llm_request:"+req.TraceID, subject, req, false); err != nil {
 		return err
 	}
 
@@ -315,7 +641,7 @@ func (s *SyncService) PublishLLMRequest(req *LLMRequestEvent) error {
 
 // PublishLLMResponse 发布 LLM 响应事件 (idempotent - only publishes once per traceID)
 func (s *SyncService) PublishLLMResponse(resp *LLMResponseEvent) error {
-	if !s.IsEnabled() {
+	if !s.allows(ScopeUsageStats) {
 		return nil
 	}
 
@@ -329,7 +655,7 @@ func (s *SyncService) PublishLLMResponse(resp *LLMResponseEvent) error {
 	resp.Timestamp = time.Now()
 
 	subject := LLMResponseSubject(resp.TraceID)
-	if err := s.nats.Publish(subject, resp); err != nil {
+	if err := s.publishDurable("llm_response:"+resp.TraceID, subject, resp, false); err != nil {
 		fmt.Printf("[Sync] Failed to publish LLMResponse (trace_id=%s): %v\n", resp.TraceID, err)
 		return err
 	}
@@ -342,7 +668,7 @@ func (s *SyncService) PublishLLMResponse(resp *LLMResponseEvent) error {
 
 // PublishQuotaChange 发布配额变更事件 (idempotent - only publishes once per traceID)
 func (s *SyncService) PublishQuotaChange(event *QuotaChangeEvent) error {
-	if !s.IsEnabled() {
+	if !s.allows(ScopeUsageStats) {
 		return nil
 	}
 
@@ -353,8 +679,12 @@ func (s *SyncService) PublishQuotaChange(event *QuotaChangeEvent) error {
 
 	event.Timestamp = time.Now()
 
+	eventID := "quota:" + event.TraceID
+	if event.TraceID == "" {
+		eventID = "quota:" + generateID()
+	}
 	subject := QuotaSubject(event.UserID)
-	if err := s.nats.Publish(subject, event); err != nil {
+	if err := s.publishDurable(eventID, subject, event, false); err != nil {
 		return err
 	}
 
@@ -2,6 +2,7 @@ package services
 
 import (
 	"codeswitch/services/sync"
+	"fmt"
 	"strings"
 	"time"
 
@@ -15,6 +16,15 @@ type SyncIntegration struct {
 	enabled     bool
 }
 
+// 可同步的数据类别，其他服务调用 OnScopedChange 时使用（这些文件已导入标准库 sync）
+const (
+	syncScopeProviders   = sync.ScopeProviders
+	syncScopeAppSettings = sync.ScopeAppSettings
+	syncScopeRequestLogs = sync.ScopeRequestLogs
+	syncScopeSkills      = sync.ScopeSkills
+	syncScopeMCP         = sync.ScopeMCP
+)
+
 // 全局同步集成实例
 var globalSyncIntegration *SyncIntegration
 
@@ -40,6 +50,11 @@ func (si *SyncIntegration) IsEnabled() bool {
 	return si != nil && si.enabled && si.syncService != nil && si.syncService.IsEnabled()
 }
 
+// canQueue 同步已启用即可发布需要可靠送达的事件，未连接时进入离线发件箱
+func (si *SyncIntegration) canQueue() bool {
+	return si != nil && si.enabled && si.syncService != nil
+}
+
 // StartLLMConsumer 启动 LLM 请求消费者
 func (si *SyncIntegration) StartLLMConsumer(handler sync.LLMRequestHandler) error {
 	if !si.IsEnabled() {
@@ -52,7 +67,7 @@ func (si *SyncIntegration) StartLLMConsumer(handler sync.LLMRequestHandler) erro
 
 // OnRequestStart 请求开始时调用
 func (si *SyncIntegration) OnRequestStart(c *gin.Context, kind, model, provider string, isStream bool, traceID string) {
-	if !si.IsEnabled() {
+	if !si.canQueue() {
 		return
 	}
 
@@ -106,7 +121,7 @@ func (si *SyncIntegration) OnRequestComplete(
 	cost float64,
 	durationMs int,
 ) {
-	if !si.IsEnabled() {
+	if !si.canQueue() {
 		return
 	}
 
@@ -161,7 +176,7 @@ func (si *SyncIntegration) OnRequestComplete(
 
 // OnUserMessage 用户发送消息时调用
 func (si *SyncIntegration) OnUserMessage(c *gin.Context, bodyBytes []byte) {
-	if !si.IsEnabled() {
+	if !si.canQueue() {
 		return
 	}
 
@@ -186,6 +201,41 @@ func (si *SyncIntegration) OnUserMessage(c *gin.Context, bodyBytes []byte) {
 	})
 }
 
+// OnScopedChange 可同步的本地数据变更时调用（供应商、应用设置、Skill、MCP、请求日志）
+// 是否发布由本设备的同步类别决定
+func (si *SyncIntegration) OnScopedChange(scope sync.Scope, data interface{}) {
+	if !si.canQueue() {
+		return
+	}
+	if err := si.syncService.PublishScoped(scope, data); err != nil {
+		fmt.Printf("[Sync] Failed to publish %s: %v\n", scope, err)
+	}
+}
+
+// OnScopedDocs 带版本的配置变更时调用（供应商、应用设置），用于冲突检测；
+// 离线时也会记录版本，连接后再发布
+func (si *SyncIntegration) OnScopedDocs(scope sync.Scope, docs map[string]interface{}) {
+	if !si.canQueue() {
+		return
+	}
+	if err := si.syncService.PublishDocs(scope, docs); err != nil {
+		fmt.Printf("[Sync] Failed to publish %s: %v\n", scope, err)
+	}
+}
+
+// RegisterSyncAppliers 注册其他设备同步来的配置的写回方法
+func RegisterSyncAppliers(syncSettings *SyncSettingsService, providers *ProviderService, appSettings *AppSettingsService) {
+	if syncSettings == nil {
+		return
+	}
+	if providers != nil {
+		syncSettings.registerApplier(sync.ScopeProviders, providers.applySyncedProvider)
+	}
+	if appSettings != nil {
+		syncSettings.registerApplier(sync.ScopeAppSettings, appSettings.applySyncedSettings)
+	}
+}
+
 // OnQuotaChange 配额变更时调用
 // quotaTotal, quotaUsed: NEW-API 配额（1 配额 = 0.0001 USD）
 func (si *SyncIntegration) OnQuotaChange(
@@ -196,7 +246,7 @@ func (si *SyncIntegration) OnQuotaChange(
 	model string,
 	traceID string,
 ) {
-	if !si.IsEnabled() {
+	if !si.canQueue() {
 		return
 	}
 
@@ -219,8 +269,8 @@ func (si *SyncIntegration) OnQuotaChange(
 
 // extractUserSession 从请求头中提取用户和会话信息
 func extractUserSession(c *gin.Context) (userID, sessionID string) {
-	// 支持多种头格式
-	userID = c.GetHeader("X-User-ID")
+	// 客户端证书身份优先，其次支持多种头格式
+	userID = requestUserID(c)
 	if userID == "" {
 		userID = c.GetHeader("X-Codeswitch-User-ID")
 	}
@@ -4,12 +4,15 @@ import (
 	"codeswitch/services/sync"
 	"context"
 	"fmt"
+
+	"github.com/daodao97/xgo/xdb"
 )
 
 // SyncSettingsService 同步设置服务 (Wails 绑定)
 type SyncSettingsService struct {
 	settings    *sync.SettingsService
 	syncService *sync.SyncService
+	appliers    map[sync.Scope]sync.DocApplier // 重建同步服务时重新注册
 }
 
 // NewSyncSettingsService 创建同步设置服务
@@ -18,6 +21,7 @@ func NewSyncSettingsService() *SyncSettingsService {
 
 	svc := &SyncSettingsService{
 		settings: settings,
+		appliers: make(map[sync.Scope]sync.DocApplier),
 	}
 
 	// 如果启用，初始化同步服务
@@ -30,7 +34,13 @@ func NewSyncSettingsService() *SyncSettingsService {
 
 func (s *SyncSettingsService) initSyncService() {
 	cfg := s.settings.GetSyncConfig()
+	if db, err := xdb.DB("default"); err == nil {
+		cfg.OutboxDB = db
+	}
 	s.syncService = sync.NewSyncService(cfg)
+	for scope, apply := range s.appliers {
+		s.syncService.RegisterApplier(scope, apply)
+	}
 	if err := s.syncService.Start(); err != nil {
 		fmt.Printf("[SyncSettings] Failed to start sync service: %v\n", err)
 	}
@@ -84,17 +94,82 @@ func (s *SyncSettingsService) UpdateSettings(settings *sync.Settings) error {
 // GetStatus 获取同步状态
 func (s *SyncSettingsService) GetStatus() map[string]interface{} {
 	status := map[string]interface{}{
-		"enabled":   s.settings.IsEnabled(),
-		"connected": false,
+		"enabled":        s.settings.IsEnabled(),
+		"connected":      false,
+		"outbox_pending": int64(0),
 	}
 
 	if s.syncService != nil {
 		status["connected"] = s.syncService.IsEnabled()
+		status["outbox_pending"] = s.syncService.OutboxPending()
 	}
+	status["scopes"] = s.settings.Scopes().Enabled()
 
 	return status
 }
 
+// GetScopes 获取本设备实际生效的同步类别（全局设置叠加本设备覆盖项）
+func (s *SyncSettingsService) GetScopes() sync.Scopes {
+	return s.settings.Scopes()
+}
+
+// UpdateScopes 更新全局同步类别，无需重连即可生效
+func (s *SyncSettingsService) UpdateScopes(scopes sync.Scopes) error {
+	if err := s.settings.UpdateScopes(scopes); err != nil {
+		return err
+	}
+	s.applyScopes()
+	return nil
+}
+
+// SetDeviceOverride 设置设备的同步类别覆盖项，deviceID 为空表示本设备
+func (s *SyncSettingsService) SetDeviceOverride(deviceID string, override sync.ScopeOverrides) error {
+	if deviceID == "" {
+		deviceID = s.settings.Get().DeviceID
+	}
+	if err := s.settings.SetDeviceOverride(deviceID, override); err != nil {
+		return err
+	}
+	s.applyScopes()
+	return nil
+}
+
+// ClearDeviceOverride 清除设备的同步类别覆盖项，恢复使用全局设置
+func (s *SyncSettingsService) ClearDeviceOverride(deviceID string) error {
+	return s.SetDeviceOverride(deviceID, sync.ScopeOverrides{})
+}
+
+// GetConflicts 获取等待处理的多设备配置冲突
+func (s *SyncSettingsService) GetConflicts() []sync.Conflict {
+	if s.syncService == nil {
+		return []sync.Conflict{}
+	}
+	return s.syncService.Conflicts()
+}
+
+// ResolveConflict 处理冲突：resolution.Keep 指定默认保留本地（local）或远端（remote），
+// resolution.Fields 可按字段单独指定
+func (s *SyncSettingsService) ResolveConflict(id string, resolution sync.ConflictResolution) error {
+	if s.syncService == nil {
+		return fmt.Errorf("sync is not enabled")
+	}
+	return s.syncService.ResolveConflict(id, resolution)
+}
+
+// registerApplier 注册远端文档的写回方法（不导出，避免暴露为前端 API）
+func (s *SyncSettingsService) registerApplier(scope sync.Scope, apply sync.DocApplier) {
+	s.appliers[scope] = apply
+	if s.syncService != nil {
+		s.syncService.RegisterApplier(scope, apply)
+	}
+}
+
+func (s *SyncSettingsService) applyScopes() {
+	if s.syncService != nil {
+		s.syncService.SetScopes(s.settings.Scopes())
+	}
+}
+
 // TestConnection 测试连接
 func (s *SyncSettingsService) TestConnection(natsURL string) (bool, string) {
 	cfg := &sync.NATSConfig{
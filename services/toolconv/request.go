@@ -0,0 +1,554 @@
+// Package toolconv 在 Anthropic Messages 与 OpenAI Chat Completions 之间转换请求、响应与流式事件，
+// 重点保证工具调用的正确性：工具调用 ID 在两个方向上保持一致，并行工具调用与分片的参数增量不丢失，
+// 后续请求中的工具结果能对应回原来的调用
+package toolconv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// DefaultMaxTokens OpenAI 请求未指定最大输出时 Anthropic 请求使用的 max_tokens（Anthropic 要求必填）
+const DefaultMaxTokens = 4096
+
+// SanitizeToolID 把工具调用 ID 转换为 Anthropic 接受的字符集（字母、数字、_ 与 -），
+// 同一 ID 总是得到相同结果，保证 tool_use 与 tool_result 仍能对应
+func SanitizeToolID(id string) string {
+	var sb strings.Builder
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// generatedToolID 上游没有给出 ID 时按位置生成稳定的 ID
+func generatedToolID(scope string, index int) string {
+	scope = SanitizeToolID(scope)
+	if scope == "" {
+		scope = "call"
+	}
+	return fmt.Sprintf("toolu_%s_%d", scope, index)
+}
+
+// toolInput 把 OpenAI 的参数字符串转换为 Anthropic 的 input 对象：
+// 空参数为 {}，不是 JSON 对象时放在 raw_arguments 中，避免丢失内容
+func toolInput(arguments string) json.RawMessage {
+	trimmed := strings.TrimSpace(arguments)
+	if trimmed == "" {
+		return json.RawMessage(`{}`)
+	}
+	if parsed := gjson.Parse(trimmed); gjson.Valid(trimmed) && parsed.IsObject() {
+		return json.RawMessage(trimmed)
+	}
+	raw, _ := json.Marshal(map[string]string{"raw_arguments": arguments})
+	return raw
+}
+
+// toolArguments 把 Anthropic 的 input 对象转换为 OpenAI 的参数字符串
+func toolArguments(input gjson.Result) string {
+	if !input.Exists() || input.Type == gjson.Null {
+		return "{}"
+	}
+	if raw := input.Get("raw_arguments"); raw.Exists() && len(input.Map()) == 1 {
+		return raw.String()
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(input.Raw)); err != nil {
+		return input.Raw
+	}
+	return compact.String()
+}
+
+// ===== Anthropic → OpenAI =====
+
+// AnthropicToOpenAIRequest 把 Anthropic Messages 请求转换为 OpenAI Chat Completions 请求。
+// assistant 中的 tool_use 转换为 tool_calls；user 中的 tool_result 转换为紧随其后的 tool 消息，
+// 同一条消息中的其他内容（以及工具结果中的图片）放在这些 tool 消息之后的 user 消息中
+func AnthropicToOpenAIRequest(body []byte) ([]byte, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("invalid JSON request body")
+	}
+	req := gjson.ParseBytes(body)
+	out := map[string]interface{}{}
+	if model := req.Get("model"); model.Exists() {
+		out["model"] = model.String()
+	}
+	copyNumber(req, out, "max_tokens", "max_tokens")
+	copyNumber(req, out, "temperature", "temperature")
+	copyNumber(req, out, "top_p", "top_p")
+	if stops := req.Get("stop_sequences"); stops.IsArray() && len(stops.Array()) > 0 {
+		out["stop"] = stringArray(stops)
+	}
+	if req.Get("stream").Bool() {
+		out["stream"] = true
+		out["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if user := req.Get("metadata.user_id").String(); user != "" {
+		out["user"] = user
+	}
+
+	messages := make([]map[string]interface{}, 0, len(req.Get("messages").Array())+1)
+	if system := anthropicText(req.Get("system"), "\n\n"); system != "" {
+		messages = append(messages, map[string]interface{}{"role": "system", "content": system})
+	}
+	for _, msg := range req.Get("messages").Array() {
+		converted, err := anthropicMessageToOpenAI(msg)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, converted...)
+	}
+	out["messages"] = messages
+
+	if tools := anthropicToolsToOpenAI(req.Get("tools")); len(tools) > 0 {
+		out["tools"] = tools
+		if choice := req.Get("tool_choice"); choice.Exists() {
+			switch choice.Get("type").String() {
+			case "auto":
+				out["tool_choice"] = "auto"
+			case "any":
+				out["tool_choice"] = "required"
+			case "none":
+				out["tool_choice"] = "none"
+			case "tool":
+				out["tool_choice"] = map[string]interface{}{
+					"type":     "function",
+					"function": map[string]string{"name": choice.Get("name").String()},
+				}
+			}
+			if choice.Get("disable_parallel_tool_use").Bool() {
+				out["parallel_tool_calls"] = false
+			}
+		}
+	}
+	return json.Marshal(out)
+}
+
+// anthropicMessageToOpenAI 转换一条 Anthropic 消息，可能得到多条 OpenAI 消息
+func anthropicMessageToOpenAI(msg gjson.Result) ([]map[string]interface{}, error) {
+	role := msg.Get("role").String()
+	content := msg.Get("content")
+	if content.Type == gjson.String {
+		return []map[string]interface{}{{"role": role, "content": content.String()}}, nil
+	}
+
+	switch role {
+	case "assistant":
+		var text []string
+		toolCalls := make([]map[string]interface{}, 0)
+		for _, block := range content.Array() {
+			switch block.Get("type").String() {
+			case "text":
+				text = append(text, block.Get("text").String())
+			case "tool_use", "server_tool_use":
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   block.Get("id").String(),
+					"type": "function",
+					"function": map[string]string{
+						"name":      block.Get("name").String(),
+						"arguments": toolArguments(block.Get("input")),
+					},
+				})
+			}
+		}
+		message := map[string]interface{}{"role": "assistant"}
+		if joined := strings.Join(text, ""); joined != "" || len(toolCalls) == 0 {
+			message["content"] = joined
+		} else {
+			message["content"] = nil
+		}
+		if len(toolCalls) > 0 {
+			message["tool_calls"] = toolCalls
+		}
+		return []map[string]interface{}{message}, nil
+
+	case "user":
+		var messages []map[string]interface{}
+		var parts []map[string]interface{}
+		for _, block := range content.Array() {
+			switch block.Get("type").String() {
+			case "tool_result":
+				text, images := toolResultContent(block.Get("content"))
+				if block.Get("is_error").Bool() {
+					text = "Error: " + text
+				}
+				messages = append(messages, map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": block.Get("tool_use_id").String(),
+					"content":      text,
+				})
+				parts = append(parts, images...)
+			case "text":
+				parts = append(parts, map[string]interface{}{"type": "text", "text": block.Get("text").String()})
+			case "image":
+				if part := anthropicImageToOpenAI(block); part != nil {
+					parts = append(parts, part)
+				}
+			}
+		}
+		if len(parts) > 0 {
+			messages = append(messages, map[string]interface{}{"role": "user", "content": simplifyParts(parts)})
+		}
+		return messages, nil
+	}
+	return nil, fmt.Errorf("unsupported message role %q", role)
+}
+
+// toolResultContent 工具结果的文本与其中的图片（OpenAI 的 tool 消息只支持文本）
+func toolResultContent(content gjson.Result) (string, []map[string]interface{}) {
+	if content.Type == gjson.String {
+		return content.String(), nil
+	}
+	var text []string
+	var images []map[string]interface{}
+	for _, block := range content.Array() {
+		switch block.Get("type").String() {
+		case "text":
+			text = append(text, block.Get("text").String())
+		case "image":
+			if part := anthropicImageToOpenAI(block); part != nil {
+				images = append(images, part)
+			}
+		}
+	}
+	return strings.Join(text, "\n"), images
+}
+
+// anthropicImageToOpenAI 图片块转换为 image_url（base64 转为 data URL）
+func anthropicImageToOpenAI(block gjson.Result) map[string]interface{} {
+	source := block.Get("source")
+	var url string
+	switch source.Get("type").String() {
+	case "base64":
+		url = fmt.Sprintf("data:%s;base64,%s", source.Get("media_type").String(), source.Get("data").String())
+	case "url":
+		url = source.Get("url").String()
+	default:
+		return nil
+	}
+	return map[string]interface{}{"type": "image_url", "image_url": map[string]string{"url": url}}
+}
+
+// simplifyParts 只有文本时合并为字符串，兼容不支持多段内容的上游
+func simplifyParts(parts []map[string]interface{}) interface{} {
+	var text []string
+	for _, part := range parts {
+		if part["type"] != "text" {
+			return parts
+		}
+		text = append(text, part["text"].(string))
+	}
+	return strings.Join(text, "\n")
+}
+
+// anthropicToolsToOpenAI 转换工具定义；没有 input_schema 的服务端工具无法转换，跳过
+func anthropicToolsToOpenAI(tools gjson.Result) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, tool := range tools.Array() {
+		schema := tool.Get("input_schema")
+		if !schema.Exists() {
+			continue
+		}
+		function := map[string]interface{}{
+			"name":       tool.Get("name").String(),
+			"parameters": json.RawMessage(schema.Raw),
+		}
+		if desc := tool.Get("description"); desc.Exists() {
+			function["description"] = desc.String()
+		}
+		out = append(out, map[string]interface{}{"type": "function", "function": function})
+	}
+	return out
+}
+
+// anthropicText 字符串或文本块数组拼接为文本
+func anthropicText(v gjson.Result, sep string) string {
+	if v.Type == gjson.String {
+		return v.String()
+	}
+	var parts []string
+	for _, block := range v.Array() {
+		if block.Get("type").String() == "text" {
+			parts = append(parts, block.Get("text").String())
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// ===== OpenAI → Anthropic =====
+
+// OpenAIToAnthropicRequest 把 OpenAI Chat Completions 请求转换为 Anthropic Messages 请求。
+// tool_calls（以及旧版 function_call）转换为 tool_use；tool / function 消息转换为 tool_result，
+// 连续的同角色消息合并为一条（Anthropic 要求工具结果全部位于紧随其后的 user 消息中）
+func OpenAIToAnthropicRequest(body []byte) ([]byte, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("invalid JSON request body")
+	}
+	req := gjson.ParseBytes(body)
+	out := map[string]interface{}{}
+	if model := req.Get("model"); model.Exists() {
+		out["model"] = model.String()
+	}
+	maxTokens := req.Get("max_completion_tokens").Int()
+	if maxTokens == 0 {
+		maxTokens = req.Get("max_tokens").Int()
+	}
+	if maxTokens == 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	out["max_tokens"] = maxTokens
+	copyNumber(req, out, "temperature", "temperature")
+	copyNumber(req, out, "top_p", "top_p")
+	if stop := req.Get("stop"); stop.Type == gjson.String {
+		out["stop_sequences"] = []string{stop.String()}
+	} else if stop.IsArray() && len(stop.Array()) > 0 {
+		out["stop_sequences"] = stringArray(stop)
+	}
+	if req.Get("stream").Bool() {
+		out["stream"] = true
+	}
+	if user := req.Get("user").String(); user != "" {
+		out["metadata"] = map[string]string{"user_id": user}
+	}
+
+	conv := &requestConverter{}
+	var system []string
+	for i, msg := range req.Get("messages").Array() {
+		switch role := msg.Get("role").String(); role {
+		case "system", "developer":
+			if text := openAIText(msg.Get("content")); text != "" {
+				system = append(system, text)
+			}
+		case "user":
+			conv.add("user", openAIContentBlocks(msg.Get("content")))
+		case "assistant":
+			conv.add("assistant", conv.assistantBlocks(msg, i))
+		case "tool", "function":
+			conv.add("user", []map[string]interface{}{conv.toolResult(msg)})
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", role)
+		}
+	}
+	if len(system) > 0 {
+		out["system"] = strings.Join(system, "\n\n")
+	}
+	out["messages"] = conv.messages
+
+	if tools := openAIToolsToAnthropic(req); len(tools) > 0 {
+		out["tools"] = tools
+		var choice map[string]interface{}
+		switch tc := req.Get("tool_choice"); {
+		case tc.Type == gjson.String && tc.String() == "required":
+			choice = map[string]interface{}{"type": "any"}
+		case tc.Type == gjson.String && tc.String() == "none":
+			choice = map[string]interface{}{"type": "none"}
+		case tc.Type == gjson.String && tc.String() == "auto":
+			choice = map[string]interface{}{"type": "auto"}
+		case tc.IsObject():
+			name := tc.Get("function.name").String()
+			if name == "" {
+				name = tc.Get("name").String()
+			}
+			choice = map[string]interface{}{"type": "tool", "name": name}
+		}
+		if parallel := req.Get("parallel_tool_calls"); parallel.Exists() && !parallel.Bool() {
+			if choice == nil {
+				choice = map[string]interface{}{"type": "auto"}
+			}
+			if choice["type"] != "none" {
+				choice["disable_parallel_tool_use"] = true
+			}
+		}
+		if choice != nil {
+			out["tool_choice"] = choice
+		}
+	}
+	return json.Marshal(out)
+}
+
+// requestConverter 转换消息列表，记录尚未收到结果的工具调用以便匹配缺少 ID 的工具结果
+type requestConverter struct {
+	messages []map[string]interface{}
+	pending  []string
+}
+
+// add 追加消息，与上一条同角色时合并内容块
+func (rc *requestConverter) add(role string, blocks []map[string]interface{}) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(rc.messages); n > 0 && rc.messages[n-1]["role"] == role {
+		prev := rc.messages[n-1]["content"].([]map[string]interface{})
+		rc.messages[n-1]["content"] = append(prev, blocks...)
+		return
+	}
+	rc.messages = append(rc.messages, map[string]interface{}{"role": role, "content": blocks})
+}
+
+// assistantBlocks assistant 消息的文本与工具调用
+func (rc *requestConverter) assistantBlocks(msg gjson.Result, position int) []map[string]interface{} {
+	blocks := openAIContentBlocks(msg.Get("content"))
+	rc.pending = rc.pending[:0]
+	for i, call := range msg.Get("tool_calls").Array() {
+		id := SanitizeToolID(call.Get("id").String())
+		if id == "" {
+			id = generatedToolID(fmt.Sprintf("m%d", position), i)
+		}
+		rc.pending = append(rc.pending, id)
+		blocks = append(blocks, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    id,
+			"name":  call.Get("function.name").String(),
+			"input": toolInput(call.Get("function.arguments").String()),
+		})
+	}
+	// 旧版 function_call 没有 ID，按位置生成，后续的 function 消息按顺序对应
+	if fc := msg.Get("function_call"); fc.Exists() {
+		id := generatedToolID(fmt.Sprintf("m%d", position), len(rc.pending))
+		rc.pending = append(rc.pending, id)
+		blocks = append(blocks, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    id,
+			"name":  fc.Get("name").String(),
+			"input": toolInput(fc.Get("arguments").String()),
+		})
+	}
+	return blocks
+}
+
+// toolResult tool / function 消息转换为 tool_result；缺少或无法识别 ID 时对应下一个未完成的调用
+func (rc *requestConverter) toolResult(msg gjson.Result) map[string]interface{} {
+	id := SanitizeToolID(msg.Get("tool_call_id").String())
+	matched := -1
+	for i, pending := range rc.pending {
+		if pending == id {
+			matched = i
+			break
+		}
+	}
+	if matched < 0 && len(rc.pending) > 0 && (id == "" || msg.Get("role").String() == "function") {
+		matched = 0
+		id = rc.pending[0]
+	}
+	if matched >= 0 {
+		rc.pending = append(rc.pending[:matched], rc.pending[matched+1:]...)
+	}
+	result := map[string]interface{}{"type": "tool_result", "tool_use_id": id}
+	content := msg.Get("content")
+	if blocks := openAIContentBlocks(content); content.IsArray() && len(blocks) > 0 {
+		result["content"] = blocks
+	} else {
+		result["content"] = openAIText(content)
+	}
+	return result
+}
+
+// openAIContentBlocks OpenAI 消息内容转换为 Anthropic 内容块；空文本跳过
+func openAIContentBlocks(content gjson.Result) []map[string]interface{} {
+	var blocks []map[string]interface{}
+	if content.Type == gjson.String {
+		if text := content.String(); text != "" {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": text})
+		}
+		return blocks
+	}
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "text":
+			if text := part.Get("text").String(); text != "" {
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": text})
+			}
+		case "image_url":
+			if block := openAIImageToAnthropic(part.Get("image_url.url").String()); block != nil {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+	return blocks
+}
+
+// openAIImageToAnthropic data URL 转换为 base64 图片块，其他 URL 使用 url 来源
+func openAIImageToAnthropic(url string) map[string]interface{} {
+	if url == "" {
+		return nil
+	}
+	if strings.HasPrefix(url, "data:") {
+		meta, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil
+		}
+		return map[string]interface{}{
+			"type": "image",
+			"source": map[string]string{
+				"type":       "base64",
+				"media_type": strings.TrimSuffix(meta, ";base64"),
+				"data":       data,
+			},
+		}
+	}
+	return map[string]interface{}{"type": "image", "source": map[string]string{"type": "url", "url": url}}
+}
+
+// openAIToolsToAnthropic 转换 tools 与旧版 functions 定义
+func openAIToolsToAnthropic(req gjson.Result) []map[string]interface{} {
+	var out []map[string]interface{}
+	convert := func(function gjson.Result) {
+		tool := map[string]interface{}{"name": function.Get("name").String()}
+		if desc := function.Get("description"); desc.Exists() {
+			tool["description"] = desc.String()
+		}
+		if params := function.Get("parameters"); params.Exists() {
+			tool["input_schema"] = json.RawMessage(params.Raw)
+		} else {
+			tool["input_schema"] = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out = append(out, tool)
+	}
+	for _, tool := range req.Get("tools").Array() {
+		if tool.Get("type").String() == "function" {
+			convert(tool.Get("function"))
+		}
+	}
+	for _, function := range req.Get("functions").Array() {
+		convert(function)
+	}
+	return out
+}
+
+// openAIText 字符串或文本段拼接为文本
+func openAIText(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	var parts []string
+	for _, part := range content.Array() {
+		if part.Get("type").String() == "text" {
+			parts = append(parts, part.Get("text").String())
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func copyNumber(req gjson.Result, out map[string]interface{}, from, to string) {
+	if v := req.Get(from); v.Type == gjson.Number {
+		out[to] = json.RawMessage(v.Raw)
+	}
+}
+
+func stringArray(v gjson.Result) []string {
+	items := v.Array()
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.String())
+	}
+	return out
+}
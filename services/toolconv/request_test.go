@@ -0,0 +1,180 @@
+package toolconv
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestAnthropicToOpenAIRequest(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		check map[string]string // gjson 路径 → 期望的原始 JSON
+	}{
+		{
+			name: "tool round with parallel results and image",
+			body: `{"model":"claude","max_tokens":100,"stream":true,"system":[{"type":"text","text":"be brief"}],
+				"messages":[
+					{"role":"user","content":"weather?"},
+					{"role":"assistant","content":[{"type":"text","text":"checking"},
+						{"type":"tool_use","id":"toolu_a","name":"get_weather","input":{"city":"Paris"}},
+						{"type":"tool_use","id":"toolu_b","name":"screenshot","input":{}}]},
+					{"role":"user","content":[
+						{"type":"tool_result","tool_use_id":"toolu_a","content":"sunny"},
+						{"type":"tool_result","tool_use_id":"toolu_b","is_error":true,"content":[{"type":"text","text":"partial"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]},
+						{"type":"text","text":"and tomorrow?"}]}],
+				"tools":[{"name":"get_weather","description":"d","input_schema":{"type":"object"}},{"type":"web_search_20250305","name":"web_search"}],
+				"tool_choice":{"type":"any","disable_parallel_tool_use":true}}`,
+			check: map[string]string{
+				"stream_options":                     `{"include_usage":true}`,
+				"messages.#":                         `6`,
+				"messages.0":                         `{"content":"be brief","role":"system"}`,
+				"messages.2.content":                 `"checking"`,
+				"messages.2.tool_calls.0":            `{"function":{"arguments":"{\"city\":\"Paris\"}","name":"get_weather"},"id":"toolu_a","type":"function"}`,
+				"messages.2.tool_calls.1.function":   `{"arguments":"{}","name":"screenshot"}`,
+				"messages.3":                         `{"content":"sunny","role":"tool","tool_call_id":"toolu_a"}`,
+				"messages.4":                         `{"content":"Error: partial","role":"tool","tool_call_id":"toolu_b"}`,
+				"messages.5.content.0.image_url.url": `"data:image/png;base64,AAA"`,
+				"messages.5.content.1":               `{"text":"and tomorrow?","type":"text"}`,
+				"tools.#":                            `1`,
+				"tools.0.function.parameters":        `{"type":"object"}`,
+				"tool_choice":                        `"required"`,
+				"parallel_tool_calls":                `false`,
+			},
+		},
+		{
+			name: "tool_use only assistant has null content",
+			body: `{"messages":[{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"n","input":{"raw_arguments":"x y"}}]}],
+				"tools":[{"name":"n","input_schema":{}}],"tool_choice":{"type":"tool","name":"n"}}`,
+			check: map[string]string{
+				"messages.0.content":                         `null`,
+				"messages.0.tool_calls.0.function.arguments": `"x y"`,
+				"tool_choice":                                `{"function":{"name":"n"},"type":"function"}`,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := AnthropicToOpenAIRequest([]byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range tc.check {
+				if got := gjson.GetBytes(out, path).Raw; got != want {
+					t.Errorf("%s = %s, want %s\n%s", path, got, want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIToAnthropicRequest(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		check map[string]string
+	}{
+		{
+			name: "parallel tool calls and results out of order",
+			body: `{"model":"gpt","max_completion_tokens":50,"stop":"END","user":"u1","parallel_tool_calls":false,
+				"messages":[
+					{"role":"system","content":"sys"},{"role":"developer","content":[{"type":"text","text":"dev"}]},
+					{"role":"user","content":"hi"},
+					{"role":"assistant","content":null,"tool_calls":[
+						{"id":"call.a/1","type":"function","function":{"name":"read","arguments":"{\"p\":1}"}},
+						{"id":"call_b","type":"function","function":{"name":"read","arguments":""}}]},
+					{"role":"tool","tool_call_id":"call_b","content":"B"},
+					{"role":"tool","tool_call_id":"call.a/1","content":[{"type":"text","text":"A"}]},
+					{"role":"user","content":[{"type":"text","text":"next"},{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,/9j"}}]}],
+				"tools":[{"type":"function","function":{"name":"read","parameters":{"type":"object"}}}]}`,
+			check: map[string]string{
+				"max_tokens":                       `50`,
+				"stop_sequences":                   `["END"]`,
+				"metadata":                         `{"user_id":"u1"}`,
+				"system":                           `"sys\n\ndev"`,
+				"messages.#":                       `3`,
+				"messages.1.content.0":             `{"id":"call_a_1","input":{"p":1},"name":"read","type":"tool_use"}`,
+				"messages.1.content.1.input":       `{}`,
+				"messages.2.role":                  `"user"`,
+				"messages.2.content.0":             `{"content":"B","tool_use_id":"call_b","type":"tool_result"}`,
+				"messages.2.content.1.tool_use_id": `"call_a_1"`,
+				"messages.2.content.1.content":     `[{"text":"A","type":"text"}]`,
+				"messages.2.content.2.text":        `"next"`,
+				"messages.2.content.3.source":      `{"data":"/9j","media_type":"image/jpeg","type":"base64"}`,
+				"tool_choice":                      `{"disable_parallel_tool_use":true,"type":"auto"}`,
+			},
+		},
+		{
+			name: "missing ids and legacy function_call",
+			body: `{"max_tokens":9,"messages":[
+					{"role":"user","content":"go"},
+					{"role":"assistant","tool_calls":[{"type":"function","function":{"name":"a","arguments":"oops"}}]},
+					{"role":"tool","content":"ra"},
+					{"role":"assistant","content":"","function_call":{"name":"f","arguments":"{}"}},
+					{"role":"function","name":"f","content":"rf"}],
+				"functions":[{"name":"f"}],"tool_choice":"none"}`,
+			check: map[string]string{
+				"max_tokens":                       `9`,
+				"messages.1.content.0.id":          `"toolu_m1_0"`,
+				"messages.1.content.0.input":       `{"raw_arguments":"oops"}`,
+				"messages.2.content.0.tool_use_id": `"toolu_m1_0"`,
+				"messages.3.content.0.id":          `"toolu_m3_0"`,
+				"messages.4.content.0.tool_use_id": `"toolu_m3_0"`,
+				"tools.0.input_schema":             `{"type":"object","properties":{}}`,
+				"tool_choice":                      `{"type":"none"}`,
+			},
+		},
+		{
+			name:  "default max_tokens",
+			body:  `{"messages":[{"role":"user","content":"x"}]}`,
+			check: map[string]string{"max_tokens": `4096`, "tools": ``},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := OpenAIToAnthropicRequest([]byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range tc.check {
+				if got := gjson.GetBytes(out, path).Raw; got != want {
+					t.Errorf("%s = %s, want %s\n%s", path, got, want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestRoundTripKeepsToolPairs(t *testing.T) {
+	body := `{"model":"m","max_tokens":10,"messages":[
+		{"role":"user","content":"q"},
+		{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"a","input":{"x":[1,2]}},{"type":"tool_use","id":"toolu_2","name":"b","input":{}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_2","content":"2"},{"type":"tool_result","tool_use_id":"toolu_1","content":"1"}]}]}`
+	openai, err := AnthropicToOpenAIRequest([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := OpenAIToAnthropicRequest(openai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"messages.1.content.#.id":          `["toolu_1","toolu_2"]`,
+		"messages.1.content.0.input":       `{"x":[1,2]}`,
+		"messages.2.content.#.tool_use_id": `["toolu_2","toolu_1"]`,
+	} {
+		if got := gjson.GetBytes(back, path).Raw; got != want {
+			t.Errorf("%s = %s, want %s\n%s", path, got, want, back)
+		}
+	}
+}
+
+func TestRequestRejectsInvalid(t *testing.T) {
+	if _, err := AnthropicToOpenAIRequest([]byte(`{`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+	if _, err := OpenAIToAnthropicRequest([]byte(`{"messages":[{"role":"robot","content":"x"}]}`)); err == nil {
+		t.Error("expected error for unknown role")
+	}
+}
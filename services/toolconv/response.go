@@ -0,0 +1,184 @@
+package toolconv
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// anthropicStopReason OpenAI finish_reason 转换为 Anthropic stop_reason；有工具调用时总是 tool_use
+func anthropicStopReason(finishReason string, hasToolCalls bool) string {
+	if hasToolCalls {
+		return "tool_use"
+	}
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	}
+	return "end_turn"
+}
+
+// openAIFinishReason Anthropic stop_reason 转换为 OpenAI finish_reason
+func openAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	case "":
+		return ""
+	}
+	return "stop"
+}
+
+// anthropicUsage OpenAI usage 转换为 Anthropic usage：缓存命中的 token 单独计入 cache_read_input_tokens
+func anthropicUsage(usage gjson.Result) map[string]int64 {
+	cached := usage.Get("prompt_tokens_details.cached_tokens").Int()
+	return map[string]int64{
+		"input_tokens":            usage.Get("prompt_tokens").Int() - cached,
+		"output_tokens":           usage.Get("completion_tokens").Int(),
+		"cache_read_input_tokens": cached,
+	}
+}
+
+// openAIUsage Anthropic usage 转换为 OpenAI usage：prompt_tokens 包含缓存读写的 token
+func openAIUsage(input, cacheRead, cacheCreation, output int64) map[string]interface{} {
+	prompt := input + cacheRead + cacheCreation
+	return map[string]interface{}{
+		"prompt_tokens":         prompt,
+		"completion_tokens":     output,
+		"total_tokens":          prompt + output,
+		"prompt_tokens_details": map[string]int64{"cached_tokens": cacheRead},
+	}
+}
+
+// OpenAIToAnthropicResponse 把非流式 Chat Completions 响应转换为 Anthropic Message
+func OpenAIToAnthropicResponse(body []byte) ([]byte, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("invalid JSON response body")
+	}
+	resp := gjson.ParseBytes(body)
+	if errObj := resp.Get("error"); errObj.Exists() {
+		return nil, fmt.Errorf("upstream error: %s", errObj.Get("message").String())
+	}
+	choice := resp.Get("choices.0")
+	message := choice.Get("message")
+
+	content := make([]map[string]interface{}, 0, 2)
+	if text := openAIText(message.Get("content")); text != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": text})
+	}
+	for i, call := range message.Get("tool_calls").Array() {
+		id := SanitizeToolID(call.Get("id").String())
+		if id == "" {
+			id = generatedToolID(resp.Get("id").String(), i)
+		}
+		content = append(content, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    id,
+			"name":  call.Get("function.name").String(),
+			"input": toolInput(call.Get("function.arguments").String()),
+		})
+	}
+	if fc := message.Get("function_call"); fc.Exists() {
+		content = append(content, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    generatedToolID(resp.Get("id").String(), len(content)),
+			"name":  fc.Get("name").String(),
+			"input": toolInput(fc.Get("arguments").String()),
+		})
+	}
+	hasToolCalls := len(message.Get("tool_calls").Array()) > 0 || message.Get("function_call").Exists()
+
+	return json.Marshal(map[string]interface{}{
+		"id":            anthropicMessageID(resp.Get("id").String()),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         resp.Get("model").String(),
+		"content":       content,
+		"stop_reason":   anthropicStopReason(choice.Get("finish_reason").String(), hasToolCalls),
+		"stop_sequence": nil,
+		"usage":         anthropicUsage(resp.Get("usage")),
+	})
+}
+
+// AnthropicToOpenAIResponse 把非流式 Anthropic Message 转换为 Chat Completions 响应
+func AnthropicToOpenAIResponse(body []byte) ([]byte, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("invalid JSON response body")
+	}
+	resp := gjson.ParseBytes(body)
+	if resp.Get("type").String() == "error" {
+		return nil, fmt.Errorf("upstream error: %s", resp.Get("error.message").String())
+	}
+
+	var text, reasoning []string
+	toolCalls := make([]map[string]interface{}, 0)
+	for _, block := range resp.Get("content").Array() {
+		switch block.Get("type").String() {
+		case "text":
+			text = append(text, block.Get("text").String())
+		case "thinking":
+			reasoning = append(reasoning, block.Get("thinking").String())
+		case "tool_use":
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   block.Get("id").String(),
+				"type": "function",
+				"function": map[string]string{
+					"name":      block.Get("name").String(),
+					"arguments": toolArguments(block.Get("input")),
+				},
+			})
+		}
+	}
+	message := map[string]interface{}{"role": "assistant", "content": nil}
+	if len(text) > 0 || len(toolCalls) == 0 {
+		message["content"] = strings.Join(text, "")
+	}
+	if len(reasoning) > 0 {
+		message["reasoning_content"] = strings.Join(reasoning, "")
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+
+	usage := resp.Get("usage")
+	return json.Marshal(map[string]interface{}{
+		"id":      openAICompletionID(resp.Get("id").String()),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   resp.Get("model").String(),
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": openAIFinishReason(resp.Get("stop_reason").String()),
+		}},
+		"usage": openAIUsage(usage.Get("input_tokens").Int(), usage.Get("cache_read_input_tokens").Int(),
+			usage.Get("cache_creation_input_tokens").Int(), usage.Get("output_tokens").Int()),
+	})
+}
+
+// anthropicMessageID Chat Completions ID 转换为 msg_ 前缀的消息 ID
+func anthropicMessageID(id string) string {
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + SanitizeToolID(strings.TrimPrefix(id, "chatcmpl-"))
+}
+
+// openAICompletionID 消息 ID 转换为 chatcmpl- 前缀的 ID
+func openAICompletionID(id string) string {
+	if strings.HasPrefix(id, "chatcmpl-") {
+		return id
+	}
+	return "chatcmpl-" + strings.TrimPrefix(id, "msg_")
+}
@@ -0,0 +1,112 @@
+package toolconv
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestOpenAIToAnthropicResponse(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		check map[string]string
+	}{
+		{
+			name: "parallel tool calls",
+			body: `{"id":"chatcmpl-X1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok",
+				"tool_calls":[{"id":"call_1","type":"function","function":{"name":"a","arguments":"{\"k\":1}"}},
+					{"type":"function","function":{"name":"b","arguments":""}}]},"finish_reason":"tool_calls"}],
+				"usage":{"prompt_tokens":100,"completion_tokens":7,"prompt_tokens_details":{"cached_tokens":60}}}`,
+			check: map[string]string{
+				"id":          `"msg_X1"`,
+				"content.0":   `{"text":"ok","type":"text"}`,
+				"content.1":   `{"id":"call_1","input":{"k":1},"name":"a","type":"tool_use"}`,
+				"content.2":   `{"id":"toolu_chatcmpl-X1_1","input":{},"name":"b","type":"tool_use"}`,
+				"stop_reason": `"tool_use"`,
+				"usage":       `{"cache_read_input_tokens":60,"input_tokens":40,"output_tokens":7}`,
+			},
+		},
+		{
+			name: "legacy function_call with stop",
+			body: `{"id":"c","choices":[{"message":{"content":null,"function_call":{"name":"f","arguments":"[1]"}},"finish_reason":"stop"}]}`,
+			check: map[string]string{
+				"content.#":       `1`,
+				"content.0.input": `{"raw_arguments":"[1]"}`,
+				"stop_reason":     `"tool_use"`,
+			},
+		},
+		{
+			name:  "length",
+			body:  `{"choices":[{"message":{"content":"abc"},"finish_reason":"length"}]}`,
+			check: map[string]string{"stop_reason": `"max_tokens"`, "content.0.text": `"abc"`},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := OpenAIToAnthropicResponse([]byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range tc.check {
+				if got := gjson.GetBytes(out, path).Raw; got != want {
+					t.Errorf("%s = %s, want %s\n%s", path, got, want, out)
+				}
+			}
+		})
+	}
+	if _, err := OpenAIToAnthropicResponse([]byte(`{"error":{"message":"bad"}}`)); err == nil {
+		t.Error("expected upstream error")
+	}
+}
+
+func TestAnthropicToOpenAIResponse(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		check map[string]string
+	}{
+		{
+			name: "thinking, text and tools",
+			body: `{"id":"msg_01","model":"claude","content":[{"type":"thinking","thinking":"hmm","signature":"s"},
+				{"type":"text","text":"a"},{"type":"tool_use","id":"toolu_1","name":"x","input":{"q": "v"}},
+				{"type":"tool_use","id":"toolu_2","name":"y","input":{}}],
+				"stop_reason":"tool_use","usage":{"input_tokens":5,"cache_read_input_tokens":10,"cache_creation_input_tokens":2,"output_tokens":3}}`,
+			check: map[string]string{
+				"id":                                  `"chatcmpl-01"`,
+				"object":                              `"chat.completion"`,
+				"choices.0.message.content":           `"a"`,
+				"choices.0.message.reasoning_content": `"hmm"`,
+				"choices.0.message.tool_calls.0":      `{"function":{"arguments":"{\"q\":\"v\"}","name":"x"},"id":"toolu_1","type":"function"}`,
+				"choices.0.message.tool_calls.1.function.arguments": `"{}"`,
+				"choices.0.finish_reason":                           `"tool_calls"`,
+				"usage":                                             `{"completion_tokens":3,"prompt_tokens":17,"prompt_tokens_details":{"cached_tokens":10},"total_tokens":20}`,
+			},
+		},
+		{
+			name: "tool only has null content",
+			body: `{"id":"msg_2","content":[{"type":"tool_use","id":"t","name":"n","input":{}}],"stop_reason":"tool_use"}`,
+			check: map[string]string{
+				"choices.0.message.content": `null`,
+			},
+		},
+		{
+			name:  "refusal",
+			body:  `{"id":"msg_3","content":[],"stop_reason":"refusal"}`,
+			check: map[string]string{"choices.0.finish_reason": `"content_filter"`, "choices.0.message.content": `""`},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := AnthropicToOpenAIResponse([]byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range tc.check {
+				if got := gjson.GetBytes(out, path).Raw; got != want {
+					t.Errorf("%s = %s, want %s\n%s", path, got, want, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package toolconv
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Event 一个 SSE 事件
+type Event struct {
+	Name string
+	Data string
+}
+
+// Decoder 把任意切分的字节流解析为 SSE 事件，可以逐字节喂入
+type Decoder struct {
+	buf  []byte
+	name string
+	data []string
+}
+
+// Feed 追加数据，返回其中完整的事件
+func (d *Decoder) Feed(p []byte) []Event {
+	d.buf = append(d.buf, p...)
+	var events []Event
+	for {
+		idx := bytes.IndexByte(d.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimRight(string(d.buf[:idx]), "\r")
+		d.buf = d.buf[idx+1:]
+		events = d.line(line, events)
+	}
+	return events
+}
+
+// Flush 流结束时返回缓冲中未以空行结束的事件
+func (d *Decoder) Flush() []Event {
+	var events []Event
+	if len(d.buf) > 0 {
+		line := strings.TrimRight(string(d.buf), "\r")
+		d.buf = nil
+		events = d.line(line, events)
+	}
+	return d.dispatch(events)
+}
+
+func (d *Decoder) line(line string, events []Event) []Event {
+	switch {
+	case line == "":
+		return d.dispatch(events)
+	case strings.HasPrefix(line, ":"):
+		return events
+	case strings.HasPrefix(line, "event:"):
+		// 部分上游省略事件之间的空行：新事件开始时先发出上一个
+		if len(d.data) > 0 {
+			events = d.dispatch(events)
+		}
+		d.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+	case strings.HasPrefix(line, "data:"):
+		value := strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		if len(d.data) > 0 && gjson.Valid(strings.Join(d.data, "\n")) {
+			events = d.dispatch(events)
+		}
+		d.data = append(d.data, value)
+	}
+	return events
+}
+
+func (d *Decoder) dispatch(events []Event) []Event {
+	if len(d.data) == 0 && d.name == "" {
+		return events
+	}
+	events = append(events, Event{Name: d.name, Data: strings.Join(d.data, "\n")})
+	d.name = ""
+	d.data = nil
+	return events
+}
+
+// writeEvent 写入一个 SSE 事件；name 为空时只写 data 行（OpenAI 格式）
+func writeEvent(buf *bytes.Buffer, name string, data []byte) {
+	if name != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+}
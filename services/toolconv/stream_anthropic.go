@@ -0,0 +1,188 @@
+package toolconv
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// AnthropicToOpenAIStream 把 Anthropic Messages 流式事件转换为 Chat Completions 流式块。
+//
+// 每个 tool_use 内容块对应一个 tool_calls 条目，按出现顺序分配 index；
+// input_json_delta 原样作为 arguments 片段转发，客户端按 index 拼接即可得到完整参数
+type AnthropicToOpenAIStream struct {
+	decoder      Decoder
+	includeUsage bool
+
+	id      string
+	model   string
+	created int64
+
+	toolIndex map[int64]int // Anthropic 内容块 index → OpenAI tool_calls index
+	nextTool  int
+	finishing bool // 已经输出带 finish_reason 的块
+	finished  bool
+
+	inputTokens, cacheRead, cacheCreation, outputTokens int64
+}
+
+// NewAnthropicToOpenAIStream 创建转换器；includeUsage 对应请求中的 stream_options.include_usage
+func NewAnthropicToOpenAIStream(includeUsage bool) *AnthropicToOpenAIStream {
+	return &AnthropicToOpenAIStream{includeUsage: includeUsage, toolIndex: make(map[int64]int), created: time.Now().Unix()}
+}
+
+// Write 输入上游的字节（可任意切分），返回可以立即发给客户端的 Chat Completions 块
+func (s *AnthropicToOpenAIStream) Write(p []byte) []byte {
+	var out bytes.Buffer
+	for _, event := range s.decoder.Feed(p) {
+		s.handle(&out, event)
+	}
+	return out.Bytes()
+}
+
+// Finish 上游连接关闭时调用；没有收到 message_stop 时补齐结束块与 [DONE]
+func (s *AnthropicToOpenAIStream) Finish() []byte {
+	var out bytes.Buffer
+	for _, event := range s.decoder.Flush() {
+		s.handle(&out, event)
+	}
+	s.stop(&out)
+	return out.Bytes()
+}
+
+func (s *AnthropicToOpenAIStream) handle(out *bytes.Buffer, event Event) {
+	if s.finished || !gjson.Valid(event.Data) {
+		return
+	}
+	data := gjson.Parse(event.Data)
+	kind := data.Get("type").String()
+	if kind == "" {
+		kind = event.Name
+	}
+
+	switch kind {
+	case "message_start":
+		message := data.Get("message")
+		s.id = openAICompletionID(message.Get("id").String())
+		s.model = message.Get("model").String()
+		s.recordUsage(message.Get("usage"))
+		s.chunk(out, map[string]interface{}{"role": "assistant", "content": ""}, nil)
+	case "content_block_start":
+		block := data.Get("content_block")
+		if block.Get("type").String() != "tool_use" {
+			return
+		}
+		index := s.nextTool
+		s.nextTool++
+		s.toolIndex[data.Get("index").Int()] = index
+		s.chunk(out, map[string]interface{}{"tool_calls": []map[string]interface{}{{
+			"index": index,
+			"id":    block.Get("id").String(),
+			"type":  "function",
+			"function": map[string]string{
+				"name":      block.Get("name").String(),
+				"arguments": "",
+			},
+		}}}, nil)
+	case "content_block_delta":
+		delta := data.Get("delta")
+		switch delta.Get("type").String() {
+		case "text_delta":
+			s.chunk(out, map[string]interface{}{"content": delta.Get("text").String()}, nil)
+		case "thinking_delta":
+			s.chunk(out, map[string]interface{}{"reasoning_content": delta.Get("thinking").String()}, nil)
+		case "input_json_delta":
+			index, ok := s.toolIndex[data.Get("index").Int()]
+			fragment := delta.Get("partial_json").String()
+			if !ok || fragment == "" {
+				return
+			}
+			s.chunk(out, map[string]interface{}{"tool_calls": []map[string]interface{}{{
+				"index":    index,
+				"function": map[string]string{"arguments": fragment},
+			}}}, nil)
+		}
+	case "message_delta":
+		s.recordUsage(data.Get("usage"))
+		reason := openAIFinishReason(data.Get("delta.stop_reason").String())
+		if reason == "" {
+			return
+		}
+		s.finishing = true
+		s.chunk(out, map[string]interface{}{}, reason)
+	case "message_stop":
+		s.stop(out)
+	case "error":
+		payload, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]string{
+				"type":    data.Get("error.type").String(),
+				"message": data.Get("error.message").String(),
+			},
+		})
+		writeEvent(out, "", payload)
+		s.finished = true
+	}
+}
+
+// recordUsage 累积用量；message_delta 中的字段覆盖 message_start 中的同名字段
+func (s *AnthropicToOpenAIStream) recordUsage(usage gjson.Result) {
+	if v := usage.Get("input_tokens"); v.Exists() {
+		s.inputTokens = v.Int()
+	}
+	if v := usage.Get("cache_read_input_tokens"); v.Exists() {
+		s.cacheRead = v.Int()
+	}
+	if v := usage.Get("cache_creation_input_tokens"); v.Exists() {
+		s.cacheCreation = v.Int()
+	}
+	if v := usage.Get("output_tokens"); v.Exists() {
+		s.outputTokens = v.Int()
+	}
+}
+
+// stop 输出用量块（如果请求了）与 [DONE]；上游没有发送 stop_reason 时补一个结束块
+func (s *AnthropicToOpenAIStream) stop(out *bytes.Buffer) {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	if !s.finishing {
+		reason := "stop"
+		if s.nextTool > 0 {
+			reason = "tool_calls"
+		}
+		s.chunk(out, map[string]interface{}{}, reason)
+	}
+	if s.includeUsage {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"id":      s.id,
+			"object":  "chat.completion.chunk",
+			"created": s.created,
+			"model":   s.model,
+			"choices": []interface{}{},
+			"usage":   openAIUsage(s.inputTokens, s.cacheRead, s.cacheCreation, s.outputTokens),
+		})
+		writeEvent(out, "", payload)
+	}
+	out.WriteString("data: [DONE]\n\n")
+}
+
+func (s *AnthropicToOpenAIStream) chunk(out *bytes.Buffer, delta map[string]interface{}, finishReason interface{}) {
+	if finishReason == "" {
+		finishReason = nil
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	})
+	writeEvent(out, "", payload)
+}
@@ -0,0 +1,327 @@
+package toolconv
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// OpenAIToAnthropicStream 把 Chat Completions 流式响应转换为 Anthropic Messages 流式事件。
+//
+// Anthropic 的内容块必须依次打开与关闭，而 OpenAI 的并行工具调用可能交错发送参数片段。
+// 转换器只实时转发第一个开始的工具调用，其余工具调用的 ID、名称与参数片段完整缓冲，
+// 在流结束时按 index 顺序依次输出，保证任何交错方式下参数都不会丢失或错位。
+// 工具调用开始后到达的文本同样缓冲，关闭实时工具块后、输出其余工具调用前作为单独的文本块输出
+type OpenAIToAnthropicStream struct {
+	decoder Decoder
+	model   string
+
+	started  bool
+	finished bool
+	id       string
+
+	nextBlock int
+	open      string // 当前打开的块："text"、"tool" 或空
+	liveTool  int    // 实时转发的工具调用 index（open 为 tool 时有效）
+
+	tools       map[int]*streamToolCall
+	lastTool    int
+	pendingText strings.Builder
+
+	finishReason string
+	usage        gjson.Result
+}
+
+// streamToolCall 一个工具调用的累积状态
+type streamToolCall struct {
+	index     int
+	id        string
+	name      string
+	arguments strings.Builder
+	emitted   bool // 已经作为内容块输出（实时或缓冲后）
+}
+
+// NewOpenAIToAnthropicStream 创建转换器；model 在上游块中没有模型名时使用
+func NewOpenAIToAnthropicStream(model string) *OpenAIToAnthropicStream {
+	return &OpenAIToAnthropicStream{model: model, tools: make(map[int]*streamToolCall), lastTool: -1}
+}
+
+// Write 输入上游的字节（可任意切分），返回可以立即发给客户端的 Anthropic 事件
+func (s *OpenAIToAnthropicStream) Write(p []byte) []byte {
+	var out bytes.Buffer
+	for _, event := range s.decoder.Feed(p) {
+		s.handle(&out, event)
+	}
+	return out.Bytes()
+}
+
+// Finish 上游流结束（收到 [DONE] 或连接关闭）时调用，输出剩余的内容块与 message_stop
+func (s *OpenAIToAnthropicStream) Finish() []byte {
+	var out bytes.Buffer
+	for _, event := range s.decoder.Flush() {
+		s.handle(&out, event)
+	}
+	s.finish(&out)
+	return out.Bytes()
+}
+
+func (s *OpenAIToAnthropicStream) handle(out *bytes.Buffer, event Event) {
+	data := strings.TrimSpace(event.Data)
+	if s.finished || data == "" {
+		return
+	}
+	if data == "[DONE]" {
+		s.finish(out)
+		return
+	}
+	if !gjson.Valid(data) {
+		return
+	}
+	chunk := gjson.Parse(data)
+	if errObj := chunk.Get("error"); errObj.Exists() {
+		s.emit(out, "error", map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": "api_error", "message": errObj.Get("message").String()},
+		})
+		s.finished = true
+		return
+	}
+	s.start(out, chunk)
+
+	for _, choice := range chunk.Get("choices").Array() {
+		// 只转换第一个候选；n > 1 无法对应到 Anthropic 的单条消息
+		if choice.Get("index").Int() != 0 {
+			continue
+		}
+		delta := choice.Get("delta")
+		if text := delta.Get("content").String(); text != "" {
+			s.text(out, text)
+		}
+		for _, call := range delta.Get("tool_calls").Array() {
+			s.toolDelta(out, call)
+		}
+		if fc := delta.Get("function_call"); fc.Exists() {
+			s.toolFragment(out, 0, "", fc.Get("name").String(), fc.Get("arguments").String())
+		}
+		if reason := choice.Get("finish_reason").String(); reason != "" {
+			s.finishReason = reason
+		}
+	}
+	// 用量可能在 finish_reason 之后的单独块中到达，结束时统一输出
+	if usage := chunk.Get("usage"); usage.Exists() && usage.Type != gjson.Null {
+		s.usage = usage
+	}
+}
+
+// start 第一个块到达时输出 message_start
+func (s *OpenAIToAnthropicStream) start(out *bytes.Buffer, chunk gjson.Result) {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.id = chunk.Get("id").String()
+	model := chunk.Get("model").String()
+	if model == "" {
+		model = s.model
+	}
+	s.emit(out, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            anthropicMessageID(s.id),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]int{"input_tokens": 0, "output_tokens": 0},
+		},
+	})
+}
+
+// text 文本增量：没有打开工具块时实时转发，否则缓冲
+func (s *OpenAIToAnthropicStream) text(out *bytes.Buffer, text string) {
+	switch s.open {
+	case "tool":
+		s.pendingText.WriteString(text)
+		return
+	case "":
+		if s.hasEmittedTools() {
+			s.pendingText.WriteString(text)
+			return
+		}
+		s.openBlock(out, "text", map[string]interface{}{"type": "text", "text": ""})
+	}
+	s.emit(out, "content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": s.nextBlock - 1,
+		"delta": map[string]string{"type": "text_delta", "text": text},
+	})
+}
+
+// toolDelta 一个 tool_calls 增量；缺少 index 的上游按 ID 区分不同的调用
+func (s *OpenAIToAnthropicStream) toolDelta(out *bytes.Buffer, call gjson.Result) {
+	id := call.Get("id").String()
+	index := s.lastTool
+	if idx := call.Get("index"); idx.Exists() {
+		index = int(idx.Int())
+	} else if id != "" || index < 0 {
+		index = s.toolIndexForID(id)
+	}
+	s.toolFragment(out, index, id, call.Get("function.name").String(), call.Get("function.arguments").String())
+}
+
+// toolIndexForID 按 ID 查找已有的调用，没有时分配新的 index
+func (s *OpenAIToAnthropicStream) toolIndexForID(id string) int {
+	if id != "" {
+		for index, tool := range s.tools {
+			if tool.id == id {
+				return index
+			}
+		}
+	}
+	return s.lastTool + 1
+}
+
+// toolFragment 累积工具调用的 ID、名称与参数片段；实时转发的调用直接输出增量
+func (s *OpenAIToAnthropicStream) toolFragment(out *bytes.Buffer, index int, id, name, arguments string) {
+	tool := s.tools[index]
+	if tool == nil {
+		tool = &streamToolCall{index: index}
+		s.tools[index] = tool
+	}
+	if index > s.lastTool {
+		s.lastTool = index
+	}
+	if tool.id == "" && id != "" {
+		tool.id = id
+	}
+	if tool.name == "" && name != "" {
+		tool.name = name
+	}
+
+	if s.open == "tool" && s.liveTool == index {
+		s.inputDelta(out, arguments)
+		return
+	}
+	tool.arguments.WriteString(arguments)
+
+	// 没有其他工具调用在实时转发、名称已知时开始实时转发这个调用
+	if s.open != "tool" && !s.hasEmittedTools() && !tool.emitted && tool.name != "" {
+		s.closeBlock(out)
+		s.openTool(out, tool)
+		s.liveTool = index
+		s.inputDelta(out, tool.arguments.String())
+		tool.arguments.Reset()
+	}
+}
+
+// hasEmittedTools 是否已经输出过工具块（之后的内容全部缓冲到结束时按顺序输出）
+func (s *OpenAIToAnthropicStream) hasEmittedTools() bool {
+	for _, tool := range s.tools {
+		if tool.emitted {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OpenAIToAnthropicStream) openTool(out *bytes.Buffer, tool *streamToolCall) {
+	tool.emitted = true
+	id := SanitizeToolID(tool.id)
+	if id == "" {
+		id = generatedToolID(s.id, tool.index)
+	}
+	s.openBlock(out, "tool", map[string]interface{}{
+		"type":  "tool_use",
+		"id":    id,
+		"name":  tool.name,
+		"input": map[string]interface{}{},
+	})
+}
+
+func (s *OpenAIToAnthropicStream) inputDelta(out *bytes.Buffer, fragment string) {
+	if fragment == "" {
+		return
+	}
+	s.emit(out, "content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": s.nextBlock - 1,
+		"delta": map[string]string{"type": "input_json_delta", "partial_json": fragment},
+	})
+}
+
+func (s *OpenAIToAnthropicStream) openBlock(out *bytes.Buffer, kind string, block map[string]interface{}) {
+	s.closeBlock(out)
+	s.emit(out, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         s.nextBlock,
+		"content_block": block,
+	})
+	s.nextBlock++
+	s.open = kind
+}
+
+func (s *OpenAIToAnthropicStream) closeBlock(out *bytes.Buffer) {
+	if s.open == "" {
+		return
+	}
+	s.emit(out, "content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": s.nextBlock - 1})
+	s.open = ""
+}
+
+// finish 关闭实时块，按顺序输出缓冲的文本与工具调用，然后输出 message_delta 与 message_stop
+func (s *OpenAIToAnthropicStream) finish(out *bytes.Buffer) {
+	if s.finished {
+		return
+	}
+	if !s.started {
+		s.start(out, gjson.Result{})
+	}
+	s.closeBlock(out)
+
+	if s.pendingText.Len() > 0 {
+		s.openBlock(out, "text", map[string]interface{}{"type": "text", "text": ""})
+		s.emit(out, "content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": s.nextBlock - 1,
+			"delta": map[string]string{"type": "text_delta", "text": s.pendingText.String()},
+		})
+		s.closeBlock(out)
+	}
+
+	indices := make([]int, 0, len(s.tools))
+	for index, tool := range s.tools {
+		if !tool.emitted {
+			indices = append(indices, index)
+		}
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		tool := s.tools[index]
+		s.openTool(out, tool)
+		// 缓冲的参数已经完整，可以像非流式响应一样处理空参数与非 JSON 参数
+		s.inputDelta(out, string(toolInput(tool.arguments.String())))
+		s.closeBlock(out)
+	}
+
+	usage := anthropicUsage(s.usage)
+	s.emit(out, "message_delta", map[string]interface{}{
+		"type": "message_delta",
+		"delta": map[string]interface{}{
+			"stop_reason":   anthropicStopReason(s.finishReason, len(s.tools) > 0),
+			"stop_sequence": nil,
+		},
+		"usage": usage,
+	})
+	s.emit(out, "message_stop", map[string]string{"type": "message_stop"})
+	s.finished = true
+}
+
+func (s *OpenAIToAnthropicStream) emit(out *bytes.Buffer, name string, payload interface{}) {
+	data, _ := json.Marshal(payload)
+	writeEvent(out, name, data)
+}
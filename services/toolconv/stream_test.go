@@ -0,0 +1,448 @@
+package toolconv
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// splits 每个流按整体、逐字节与 7 字节分片三种方式喂入，结果必须一致
+var splits = map[string]int{"whole": 0, "bytewise": 1, "chunk7": 7}
+
+type streamConverter interface {
+	Write(p []byte) []byte
+	Finish() []byte
+}
+
+func runStream(t *testing.T, conv streamConverter, raw []byte, size int) []Event {
+	t.Helper()
+	var out []byte
+	if size <= 0 {
+		size = len(raw)
+	}
+	for len(raw) > 0 {
+		n := size
+		if n > len(raw) {
+			n = len(raw)
+		}
+		out = append(out, conv.Write(raw[:n])...)
+		raw = raw[n:]
+	}
+	out = append(out, conv.Finish()...)
+	var dec Decoder
+	return append(dec.Feed(out), dec.Flush()...)
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// anthropicMessage 由 Anthropic 事件流重建的消息
+type anthropicMessage struct {
+	ID         string
+	Blocks     []string // "text:..." 或 "tool:<id>:<name>:<紧凑 JSON>"
+	StopReason string
+	Input      int64
+	Output     int64
+	CacheRead  int64
+}
+
+// assembleAnthropic 按客户端 SDK 的方式拼接事件，同时检查协议约束：
+// message_start 最先、内容块依次打开关闭、增量只发给打开的块、message_stop 最后
+func assembleAnthropic(t *testing.T, events []Event) anthropicMessage {
+	t.Helper()
+	var msg anthropicMessage
+	var blocks []map[string]string
+	open := -1
+	for i, ev := range events {
+		data := gjson.Parse(ev.Data)
+		if data.Get("type").String() != ev.Name {
+			t.Fatalf("event %d: name %q does not match type %q", i, ev.Name, data.Get("type").String())
+		}
+		if i == 0 && ev.Name != "message_start" {
+			t.Fatalf("first event = %s", ev.Name)
+		}
+		switch ev.Name {
+		case "message_start":
+			if i != 0 {
+				t.Fatalf("message_start at %d", i)
+			}
+			msg.ID = data.Get("message.id").String()
+		case "content_block_start":
+			index := int(data.Get("index").Int())
+			if open != -1 || index != len(blocks) {
+				t.Fatalf("block %d started while %d open (have %d)", index, open, len(blocks))
+			}
+			block := data.Get("content_block")
+			blocks = append(blocks, map[string]string{
+				"type": block.Get("type").String(), "id": block.Get("id").String(), "name": block.Get("name").String(),
+			})
+			open = index
+		case "content_block_delta":
+			index := int(data.Get("index").Int())
+			if index != open {
+				t.Fatalf("delta for block %d while %d open", index, open)
+			}
+			delta := data.Get("delta")
+			switch delta.Get("type").String() {
+			case "text_delta":
+				blocks[index]["text"] += delta.Get("text").String()
+			case "input_json_delta":
+				blocks[index]["json"] += delta.Get("partial_json").String()
+			default:
+				t.Fatalf("unexpected delta %s", delta.Raw)
+			}
+		case "content_block_stop":
+			if int(data.Get("index").Int()) != open {
+				t.Fatalf("stop for block %s while %d open", data.Get("index").Raw, open)
+			}
+			open = -1
+		case "message_delta":
+			if open != -1 {
+				t.Fatalf("message_delta while block %d open", open)
+			}
+			msg.StopReason = data.Get("delta.stop_reason").String()
+			msg.Input = data.Get("usage.input_tokens").Int()
+			msg.Output = data.Get("usage.output_tokens").Int()
+			msg.CacheRead = data.Get("usage.cache_read_input_tokens").Int()
+		case "message_stop":
+			if i != len(events)-1 {
+				t.Fatalf("message_stop at %d of %d", i, len(events))
+			}
+		default:
+			t.Fatalf("unexpected event %s", ev.Name)
+		}
+	}
+	if len(events) == 0 || events[len(events)-1].Name != "message_stop" {
+		t.Fatalf("stream not terminated with message_stop")
+	}
+	for _, b := range blocks {
+		switch b["type"] {
+		case "text":
+			msg.Blocks = append(msg.Blocks, "text:"+b["text"])
+		case "tool_use":
+			input := b["json"]
+			if input == "" {
+				input = "{}"
+			}
+			if !gjson.Valid(input) {
+				t.Fatalf("tool %s input is not valid JSON: %s", b["id"], input)
+			}
+			msg.Blocks = append(msg.Blocks, fmt.Sprintf("tool:%s:%s:%s", b["id"], b["name"], gjson.Parse(input).Get("@ugly").Raw))
+		}
+	}
+	return msg
+}
+
+func TestOpenAIToAnthropicStreamCorpus(t *testing.T) {
+	cases := []struct {
+		fixture string
+		want    anthropicMessage
+	}{
+		{
+			fixture: "openai_parallel_tools.sse",
+			want: anthropicMessage{
+				ID: "msg_B9x1",
+				Blocks: []string{
+					`tool:call_XQVX1zLtWbHq:get_weather:{"location":"Paris, France"}`,
+					`tool:call_bRb0PnVf7nQK:get_weather:{"location":"Bogotá, Colombia"}`,
+				},
+				StopReason: "tool_use", Input: 81, Output: 46,
+			},
+		},
+		{
+			// 两个调用交错发送参数片段，第三个调用与 finish_reason 在同一块中
+			fixture: "openai_interleaved_tools.sse",
+			want: anthropicMessage{
+				ID: "msg_a1f0",
+				Blocks: []string{
+					`tool:call_read_a:read_file:{"path":"src/main.go"}`,
+					`tool:call_read_b:read_file:{"path":"README.md"}`,
+					`tool:call_ls:list_dir:{}`,
+				},
+				StopReason: "tool_use", Input: 120, Output: 30,
+			},
+		},
+		{
+			// 工具调用开始后到达的文本在工具块之后单独输出；用量在 finish_reason 之后的块中
+			fixture: "openai_text_then_tool.sse",
+			want: anthropicMessage{
+				ID: "msg_9f2c",
+				Blocks: []string{
+					"text:Let me check the tests.",
+					`tool:call_0_5a7e3c1d-2b4f-4e8a-9c6d-1f2e3a4b5c6d:bash:{"command":"go test ./..."}`,
+					"text: (running)",
+				},
+				StopReason: "tool_use", Input: 260, Output: 25, CacheRead: 640,
+			},
+		},
+		{
+			// 缺少 index 的上游按 ID 区分调用；事件之间缺少空行
+			fixture: "openai_missing_index.sse",
+			want: anthropicMessage{
+				ID: "msg_legacy7",
+				Blocks: []string{
+					`tool:call_glob:glob:{"pattern":"**/*.go"}`,
+					`tool:call_grep:grep:{"pattern":"TODO"}`,
+				},
+				StopReason: "tool_use", Input: 50, Output: 20,
+			},
+		},
+		{
+			// CRLF 行尾、没有参数、非 JSON 参数、缺少 ID、没有 [DONE]，finish_reason 为 stop 但有工具调用
+			fixture: "openai_empty_args.sse",
+			want: anthropicMessage{
+				ID: "msg_noargs",
+				Blocks: []string{
+					`tool:call_time_1:current_time:{}`,
+					`tool:toolu_chatcmpl-noargs_1:list_tasks:{"raw_arguments":"not json"}`,
+				},
+				StopReason: "tool_use",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		raw := readFixture(t, tc.fixture)
+		for split, size := range splits {
+			t.Run(tc.fixture+"/"+split, func(t *testing.T) {
+				got := assembleAnthropic(t, runStream(t, NewOpenAIToAnthropicStream("fallback"), raw, size))
+				if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+					t.Fatalf("got  %+v\nwant %+v", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+func TestOpenAIToAnthropicStreamLiveToolDeltas(t *testing.T) {
+	// 第一个工具调用的参数片段必须实时转发，而不是缓冲到结束
+	raw := readFixture(t, "openai_parallel_tools.sse")
+	conv := NewOpenAIToAnthropicStream("")
+	var beforeFinish []byte
+	for _, line := range strings.SplitAfter(string(raw), "\n\n") {
+		if strings.Contains(line, `"finish_reason":"tool_calls"`) {
+			break
+		}
+		beforeFinish = append(beforeFinish, conv.Write([]byte(line))...)
+	}
+	if !strings.Contains(string(beforeFinish), `is, France\"}`) {
+		t.Fatalf("first tool arguments not streamed live: %s", beforeFinish)
+	}
+	if strings.Contains(string(beforeFinish), "call_bRb0PnVf7nQK") {
+		t.Fatalf("second tool started before the first was closed")
+	}
+}
+
+func TestOpenAIToAnthropicStreamError(t *testing.T) {
+	conv := NewOpenAIToAnthropicStream("m")
+	out := conv.Write([]byte("data: {\"error\":{\"message\":\"rate limited\",\"type\":\"requests\"}}\n\n"))
+	out = append(out, conv.Finish()...)
+	var dec Decoder
+	events := append(dec.Feed(out), dec.Flush()...)
+	if len(events) != 1 || events[0].Name != "error" || gjson.Get(events[0].Data, "error.message").String() != "rate limited" {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+// openAIMessage 由 Chat Completions 流重建的消息
+type openAIMessage struct {
+	Content   string
+	Reasoning string
+	ToolCalls []string // "<id>:<name>:<arguments>"
+	Finish    string
+	Usage     string
+}
+
+// assembleOpenAI 按客户端 SDK 的方式按 index 拼接 tool_calls，同时检查：
+// 每个调用的第一个片段带 id、type 与名称，后续片段不重复，finish_reason 只出现一次，[DONE] 最后
+func assembleOpenAI(t *testing.T, events []Event) openAIMessage {
+	t.Helper()
+	var msg openAIMessage
+	type call struct{ id, name, args string }
+	calls := map[int64]*call{}
+	for i, ev := range events {
+		if ev.Data == "[DONE]" {
+			if i != len(events)-1 {
+				t.Fatalf("[DONE] at %d of %d", i, len(events))
+			}
+			continue
+		}
+		chunk := gjson.Parse(ev.Data)
+		if chunk.Get("object").String() != "chat.completion.chunk" || !strings.HasPrefix(chunk.Get("id").String(), "chatcmpl-") {
+			t.Fatalf("bad chunk %s", ev.Data)
+		}
+		if usage := chunk.Get("usage"); usage.Exists() {
+			msg.Usage = usage.Get("prompt_tokens").String() + "/" + usage.Get("completion_tokens").String() + "/" +
+				usage.Get("prompt_tokens_details.cached_tokens").String()
+		}
+		for _, choice := range chunk.Get("choices").Array() {
+			if msg.Finish != "" {
+				t.Fatalf("chunk after finish_reason: %s", ev.Data)
+			}
+			delta := choice.Get("delta")
+			msg.Content += delta.Get("content").String()
+			msg.Reasoning += delta.Get("reasoning_content").String()
+			for _, tc := range delta.Get("tool_calls").Array() {
+				index := tc.Get("index").Int()
+				c := calls[index]
+				if c == nil {
+					if tc.Get("id").String() == "" || tc.Get("type").String() != "function" || tc.Get("function.name").String() == "" {
+						t.Fatalf("first fragment of tool %d incomplete: %s", index, tc.Raw)
+					}
+					c = &call{id: tc.Get("id").String(), name: tc.Get("function.name").String()}
+					calls[index] = c
+				} else if tc.Get("id").Exists() || tc.Get("function.name").Exists() {
+					t.Fatalf("tool %d repeats id or name: %s", index, tc.Raw)
+				}
+				c.args += tc.Get("function.arguments").String()
+			}
+			msg.Finish = choice.Get("finish_reason").String()
+		}
+	}
+	if len(events) == 0 || events[len(events)-1].Data != "[DONE]" {
+		t.Fatalf("stream not terminated with [DONE]")
+	}
+	indices := make([]int, 0, len(calls))
+	for index := range calls {
+		indices = append(indices, int(index))
+	}
+	sort.Ints(indices)
+	for i, index := range indices {
+		if index != i {
+			t.Fatalf("tool indices not contiguous: %v", indices)
+		}
+		c := calls[int64(index)]
+		if !gjson.Valid(c.args) {
+			t.Fatalf("tool %d arguments not valid JSON: %s", index, c.args)
+		}
+		msg.ToolCalls = append(msg.ToolCalls, c.id+":"+c.name+":"+gjson.Parse(c.args).Get("@ugly").Raw)
+	}
+	return msg
+}
+
+func TestAnthropicToOpenAIStreamCorpus(t *testing.T) {
+	cases := []struct {
+		fixture string
+		usage   bool
+		want    openAIMessage
+	}{
+		{
+			fixture: "anthropic_parallel_tools.sse",
+			usage:   true,
+			want: openAIMessage{
+				Content: "I'll check both cities at once.",
+				ToolCalls: []string{
+					`toolu_01T1x1fJ34qAmk2tNTrN7Up6:get_weather:{"location":"San Francisco, CA","unit":"fahrenheit"}`,
+					`toolu_01DrNmgv8wXyZ3kq5NvsmPGb:get_weather:{"location":"Tokyo"}`,
+				},
+				Finish: "tool_calls",
+				Usage:  "2520/89/2048",
+			},
+		},
+		{
+			fixture: "anthropic_text_only.sse",
+			want:    openAIMessage{Content: "Hello! 你好，有什么可以帮你？", Finish: "length"},
+		},
+		{
+			fixture: "anthropic_thinking_tool.sse",
+			usage:   true,
+			want: openAIMessage{
+				Reasoning: "The user wants the file list.",
+				ToolCalls: []string{`toolu_01Ls9:list_dir:{"path":".","depth":2}`},
+				Finish:    "tool_calls",
+				Usage:     "1510/57/0",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		raw := readFixture(t, tc.fixture)
+		for split, size := range splits {
+			t.Run(tc.fixture+"/"+split, func(t *testing.T) {
+				got := assembleOpenAI(t, runStream(t, NewAnthropicToOpenAIStream(tc.usage), raw, size))
+				if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+					t.Fatalf("got  %+v\nwant %+v", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+func TestAnthropicToOpenAIStreamTruncated(t *testing.T) {
+	// 上游在 message_delta 之前断开：仍然补齐 finish_reason 与 [DONE]
+	raw := readFixture(t, "anthropic_thinking_tool.sse")
+	raw = raw[:strings.Index(string(raw), "event: message_delta")]
+	got := assembleOpenAI(t, runStream(t, NewAnthropicToOpenAIStream(false), raw, 0))
+	if got.Finish != "tool_calls" || len(got.ToolCalls) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	// Anthropic → OpenAI → Anthropic 后工具调用的 ID、名称与参数保持不变
+	for _, fixture := range []string{"anthropic_parallel_tools.sse", "anthropic_thinking_tool.sse"} {
+		raw := readFixture(t, fixture)
+		openai := runStream(t, NewAnthropicToOpenAIStream(true), raw, 0)
+		var replay []byte
+		for _, ev := range openai {
+			replay = append(replay, "data: "+ev.Data+"\n\n"...)
+		}
+		back := assembleAnthropic(t, runStream(t, NewOpenAIToAnthropicStream(""), replay, 5))
+
+		var original []string
+		var dec Decoder
+		for _, ev := range append(dec.Feed(raw), dec.Flush()...) {
+			block := gjson.Get(ev.Data, "content_block")
+			if block.Get("type").String() == "tool_use" {
+				original = append(original, block.Get("id").String())
+			}
+		}
+		var ids []string
+		for _, b := range back.Blocks {
+			if strings.HasPrefix(b, "tool:") {
+				ids = append(ids, strings.SplitN(b, ":", 3)[1])
+			}
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(original) || back.StopReason != "tool_use" {
+			t.Fatalf("%s: round trip ids %v, want %v (%+v)", fixture, ids, original, back)
+		}
+	}
+}
+
+func TestDecoderSplitsAndComments(t *testing.T) {
+	raw := ": comment\r\nevent: a\r\ndata: {\"x\":\r\ndata: 1}\r\n\r\ndata: {\"y\":2}\ndata: {\"z\":3}\n"
+	for split, size := range splits {
+		var dec Decoder
+		var events []Event
+		data := []byte(raw)
+		if size == 0 {
+			size = len(data)
+		}
+		for len(data) > 0 {
+			n := size
+			if n > len(data) {
+				n = len(data)
+			}
+			events = append(events, dec.Feed(data[:n])...)
+			data = data[n:]
+		}
+		events = append(events, dec.Flush()...)
+		got, _ := json.Marshal(events)
+		want := `[{"Name":"a","Data":"{\"x\":\n1}"},{"Name":"","Data":"{\"y\":2}"},{"Name":"","Data":"{\"z\":3}"}]`
+		if string(got) != want {
+			t.Fatalf("%s: got %s", split, got)
+		}
+	}
+}
@@ -0,0 +1,558 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 会话记录：从 request_log_body 中的请求 / 响应体还原可读的对话（用户 / 助手轮次、工具调用、每轮成本），
+// 增量保存到 conversation_transcript 表（gzip 压缩），body 日志过期清理后已还原的内容仍然保留
+
+// 导出格式
+const (
+	TranscriptExportMarkdown = "markdown"
+	TranscriptExportJSON     = "json"
+)
+
+// 对话轮次的角色
+const (
+	TranscriptRoleSystem    = "system"
+	TranscriptRoleUser      = "user"
+	TranscriptRoleAssistant = "assistant"
+	TranscriptRoleTool      = "tool"
+)
+
+// transcriptMaxResponseBytes 读取落盘响应体的上限
+const transcriptMaxResponseBytes = 16 << 20
+
+// TranscriptTurn 对话中的一个轮次
+type TranscriptTurn struct {
+	Role       string             `json:"role"`
+	Text       string             `json:"text,omitempty"`
+	ToolCalls  []ResponseToolCall `json:"tool_calls,omitempty"`   // 助手发起的工具调用
+	ToolCallID string             `json:"tool_call_id,omitempty"` // 工具结果对应的调用 ID（或函数名）
+
+	// 助手轮次对应的请求
+	TraceID      string  `json:"trace_id,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Provider     string  `json:"provider,omitempty"`
+	CreatedAt    string  `json:"created_at,omitempty"`
+	InputTokens  int     `json:"input_tokens,omitempty"`
+	OutputTokens int     `json:"output_tokens,omitempty"`
+	Cost         float64 `json:"cost,omitempty"`
+	Error        string  `json:"error,omitempty"` // 请求失败时的 HTTP 状态与错误信息
+}
+
+// Transcript 还原后的会话记录
+type Transcript struct {
+	ConversationID string           `json:"conversation_id"`
+	Platform       string           `json:"platform"`
+	FirstAt        string           `json:"first_at"`
+	LastAt         string           `json:"last_at"`
+	Requests       int              `json:"requests"`
+	MissingBodies  int              `json:"missing_bodies"` // 未记录 body 日志、无法还原内容的请求数
+	InputTokens    int64            `json:"input_tokens"`
+	OutputTokens   int64            `json:"output_tokens"`
+	TotalCost      float64          `json:"total_cost"`
+	Turns          []TranscriptTurn `json:"turns"`
+}
+
+// TranscriptService 会话记录的还原、保存与导出
+type TranscriptService struct {
+	logs *LogService
+}
+
+// NewTranscriptService 创建会话记录服务，logs 用于计算每轮成本
+func NewTranscriptService(logs *LogService) *TranscriptService {
+	return &TranscriptService{logs: logs}
+}
+
+// ensureTranscriptTable 创建会话记录表
+func ensureTranscriptTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS conversation_transcript (
+		conversation_id TEXT PRIMARY KEY,
+		platform TEXT,
+		last_log_id INTEGER DEFAULT 0,
+		last_input_hash TEXT DEFAULT '',
+		data BLOB,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// transcriptState 增量还原的进度：已处理的最后一条日志与最近一次新增输入的哈希（用于跳过重试请求）
+type transcriptState struct {
+	lastLogID     int64
+	lastInputHash string
+}
+
+// GetTranscript 返回会话记录，先把上次保存之后的新请求增量还原并保存
+func (ts *TranscriptService) GetTranscript(conversationID string) (*Transcript, error) {
+	conversationID = strings.TrimSpace(conversationID)
+	if conversationID == "" {
+		return nil, fmt.Errorf("conversation id is required")
+	}
+	db, err := analyticsDB()
+	if err != nil {
+		return nil, err
+	}
+	transcript, state, err := loadTranscript(db, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	added, err := ts.appendNewRequests(db, transcript, &state)
+	if err != nil {
+		return nil, err
+	}
+	if added > 0 {
+		if err := saveTranscript(db, transcript, state); err != nil {
+			return nil, err
+		}
+	}
+	return transcript, nil
+}
+
+// loadTranscript 读取已保存的会话记录，不存在时返回空记录
+func loadTranscript(db *sql.DB, conversationID string) (*Transcript, transcriptState, error) {
+	transcript := &Transcript{ConversationID: conversationID, Turns: []TranscriptTurn{}}
+	var state transcriptState
+	var data []byte
+	err := db.QueryRow(
+		"SELECT last_log_id, last_input_hash, data FROM conversation_transcript WHERE conversation_id = ?",
+		conversationID,
+	).Scan(&state.lastLogID, &state.lastInputHash, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return transcript, state, nil
+	}
+	if err != nil {
+		return nil, state, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, state, err
+	}
+	defer gz.Close()
+	if err := json.NewDecoder(gz).Decode(transcript); err != nil {
+		return nil, state, err
+	}
+	return transcript, state, nil
+}
+
+// saveTranscript 以 gzip 压缩的 JSON 保存会话记录
+func saveTranscript(db *sql.DB, transcript *Transcript, state transcriptState) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(transcript); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO conversation_transcript (conversation_id, platform, last_log_id, last_input_hash, data, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(conversation_id) DO UPDATE SET platform = excluded.platform, last_log_id = excluded.last_log_id,
+			last_input_hash = excluded.last_input_hash, data = excluded.data, updated_at = CURRENT_TIMESTAMP`,
+		transcript.ConversationID, transcript.Platform, state.lastLogID, state.lastInputHash, buf.Bytes())
+	return err
+}
+
+// appendNewRequests 按时间顺序处理会话中尚未还原的请求，返回处理的请求数
+func (ts *TranscriptService) appendNewRequests(db *sql.DB, transcript *Transcript, state *transcriptState) (int, error) {
+	rows, err := db.Query(`
+		SELECT l.id, COALESCE(l.trace_id, ''), COALESCE(l.platform, ''), COALESCE(l.model, ''), COALESCE(l.provider, ''),
+		       COALESCE(l.http_code, 0), COALESCE(l.input_tokens, 0), COALESCE(l.output_tokens, 0),
+		       COALESCE(l.cache_create_tokens, 0), COALESCE(l.cache_read_tokens, 0), COALESCE(l.reasoning_tokens, 0),
+		       COALESCE(l.total_cost, 0), COALESCE(l.error_message, ''), COALESCE(l.created_at, ''),
+		       b.request_body, b.response_body, COALESCE(b.response_body_path, ''), COALESCE(b.blob_refs, '')
+		FROM request_log l
+		LEFT JOIN request_log_body b ON b.id = (SELECT MAX(id) FROM request_log_body WHERE trace_id = l.trace_id)
+		WHERE l.conversation_id = ? AND l.id > ?
+		ORDER BY l.id`, transcript.ConversationID, state.lastLogID)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	// 先读完结果集再还原去重的请求体，避免遍历结果集时占用连接再查询 blob
+	var records []transcriptRecord
+	for rows.Next() {
+		var r transcriptRecord
+		if err := rows.Scan(
+			&r.entry.ID, &r.entry.TraceID, &r.entry.Platform, &r.entry.Model, &r.entry.Provider,
+			&r.entry.HttpCode, &r.entry.InputTokens, &r.entry.OutputTokens,
+			&r.entry.CacheCreateTokens, &r.entry.CacheReadTokens, &r.entry.ReasoningTokens,
+			&r.entry.TotalCost, &r.entry.ErrorMessage, &r.entry.CreatedAt,
+			&r.requestBody, &r.responseBody, &r.responsePath, &r.blobRefs,
+		); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	blobs := newBodyBlobResolver(db)
+	added := 0
+	for i := range records {
+		entry, requestBody, responseBody, responsePath := records[i].entry, records[i].requestBody, records[i].responseBody, records[i].responsePath
+		requestBody.String = blobs.expand(requestBody.String, records[i].blobRefs)
+		// 写入时已计算成本的日志直接使用，旧日志按当前价格表补算
+		if entry.TotalCost == 0 {
+			ts.logs.decorateCost(&entry)
+		}
+
+		response := []byte(responseBody.String)
+		if responsePath != "" {
+			if data, err := readSpilledBody(responsePath); err == nil {
+				response = data
+			}
+		}
+		appendRequest(transcript, state, &entry, requestBody.Valid, []byte(requestBody.String), response)
+		state.lastLogID = entry.ID
+		added++
+	}
+	return added, nil
+}
+
+// transcriptRecord 会话中的一条请求及其 Body 日志
+type transcriptRecord struct {
+	entry                     ReqeustLog
+	requestBody, responseBody sql.NullString
+	responsePath, blobRefs    string
+}
+
+// readSpilledBody 读取落盘的响应体
+func readSpilledBody(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, transcriptMaxResponseBytes))
+}
+
+// appendRequest 把一次请求还原为对话轮次：新增的输入（首个请求为完整历史）与助手回复
+func appendRequest(transcript *Transcript, state *transcriptState, entry *ReqeustLog, hasBody bool, requestBody, responseBody []byte) {
+	if transcript.FirstAt == "" {
+		transcript.FirstAt = entry.CreatedAt
+	}
+	if transcript.Platform == "" {
+		transcript.Platform = entry.Platform
+	}
+	transcript.LastAt = entry.CreatedAt
+	transcript.Requests++
+	transcript.InputTokens += int64(entry.InputTokens)
+	transcript.OutputTokens += int64(entry.OutputTokens)
+	transcript.TotalCost += entry.TotalCost
+
+	if !hasBody || !gjson.ValidBytes(requestBody) {
+		transcript.MissingBodies++
+		return
+	}
+
+	history := parseRequestTurns(requestBody)
+	inputs := history
+	if len(transcript.Turns) > 0 {
+		// 后续请求携带完整历史，只取最后一条助手回复之后新增的用户消息 / 工具结果
+		inputs = trailingInputs(history)
+	}
+	hash := inputHash(len(history), inputs)
+	if hash != state.lastInputHash {
+		transcript.Turns = append(transcript.Turns, inputs...)
+		state.lastInputHash = hash
+	}
+
+	reply := TranscriptTurn{
+		Role:         TranscriptRoleAssistant,
+		TraceID:      entry.TraceID,
+		Model:        entry.Model,
+		Provider:     entry.Provider,
+		CreatedAt:    entry.CreatedAt,
+		InputTokens:  entry.InputTokens,
+		OutputTokens: entry.OutputTokens,
+		Cost:         entry.TotalCost,
+	}
+	if entry.HttpCode < 200 || entry.HttpCode >= 300 {
+		reply.Error = fmt.Sprintf("HTTP %d", entry.HttpCode)
+		if entry.ErrorMessage != "" {
+			reply.Error += ": " + entry.ErrorMessage
+		}
+	} else {
+		reply.Text, reply.ToolCalls = parseResponseOutput(responseBody)
+	}
+	transcript.Turns = append(transcript.Turns, reply)
+}
+
+// trailingInputs 最后一条助手消息之后的轮次
+func trailingInputs(history []TranscriptTurn) []TranscriptTurn {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == TranscriptRoleAssistant {
+			return history[i+1:]
+		}
+	}
+	inputs := make([]TranscriptTurn, 0, len(history))
+	for _, turn := range history {
+		if turn.Role != TranscriptRoleSystem {
+			inputs = append(inputs, turn)
+		}
+	}
+	return inputs
+}
+
+// inputHash 新增输入的哈希，包含历史长度，避免把相同内容的新一轮误判为重试
+func inputHash(historyLen int, inputs []TranscriptTurn) string {
+	data, _ := json.Marshal(inputs)
+	sum := sha256.Sum256(append([]byte(fmt.Sprintf("%d:", historyLen)), data...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseRequestTurns 解析请求体中的系统提示词与对话（Anthropic Messages / OpenAI Chat / Responses / Gemini）
+func parseRequestTurns(body []byte) []TranscriptTurn {
+	req := gjson.ParseBytes(body)
+	turns := make([]TranscriptTurn, 0)
+	for _, field := range []string{"system", "instructions", "systemInstruction", "system_instruction"} {
+		if text := contentText(req.Get(field)); text != "" {
+			turns = append(turns, TranscriptTurn{Role: TranscriptRoleSystem, Text: text})
+		}
+	}
+
+	if input := req.Get("input"); input.Type == gjson.String {
+		return append(turns, TranscriptTurn{Role: TranscriptRoleUser, Text: input.String()})
+	}
+	_, items := conversationItems(body)
+	for _, item := range items {
+		turns = append(turns, parseMessageTurns(item)...)
+	}
+	return turns
+}
+
+// parseMessageTurns 把一条消息拆分为轮次：工具结果单独成为 tool 轮次
+func parseMessageTurns(msg gjson.Result) []TranscriptTurn {
+	role := msg.Get("role").String()
+	switch role {
+	case "model":
+		role = TranscriptRoleAssistant
+	case "developer":
+		role = TranscriptRoleSystem
+	case "function":
+		role = TranscriptRoleTool
+	case "":
+		role = TranscriptRoleUser
+	}
+
+	// OpenAI Responses 的工具调用条目
+	switch msg.Get("type").String() {
+	case "function_call":
+		return []TranscriptTurn{{Role: TranscriptRoleAssistant, ToolCalls: []ResponseToolCall{{
+			ID: msg.Get("call_id").String(), Name: msg.Get("name").String(), Arguments: msg.Get("arguments").String(),
+		}}}}
+	case "function_call_output":
+		return []TranscriptTurn{{Role: TranscriptRoleTool, ToolCallID: msg.Get("call_id").String(), Text: contentText(msg.Get("output"))}}
+	}
+	if role == "tool" {
+		return []TranscriptTurn{{Role: TranscriptRoleTool, ToolCallID: msg.Get("tool_call_id").String(), Text: contentText(msg.Get("content"))}}
+	}
+
+	turn := TranscriptTurn{Role: role}
+	var text []string
+	var results []TranscriptTurn
+	blocks := msg.Get("content")
+	if !blocks.IsArray() {
+		blocks = msg.Get("parts")
+	}
+	if content := msg.Get("content"); content.Type == gjson.String {
+		text = append(text, content.String())
+	}
+	blocks.ForEach(func(_, block gjson.Result) bool {
+		switch {
+		case block.Get("type").String() == "tool_use":
+			turn.ToolCalls = append(turn.ToolCalls, ResponseToolCall{ID: block.Get("id").String(), Name: block.Get("name").String(), Arguments: block.Get("input").Raw})
+		case block.Get("type").String() == "tool_result":
+			results = append(results, TranscriptTurn{Role: TranscriptRoleTool, ToolCallID: block.Get("tool_use_id").String(), Text: contentText(block.Get("content"))})
+		case block.Get("functionCall").Exists():
+			call := block.Get("functionCall")
+			turn.ToolCalls = append(turn.ToolCalls, ResponseToolCall{Name: call.Get("name").String(), Arguments: call.Get("args").Raw})
+		case block.Get("functionResponse").Exists():
+			response := block.Get("functionResponse")
+			results = append(results, TranscriptTurn{Role: TranscriptRoleTool, ToolCallID: response.Get("name").String(), Text: response.Get("response").Raw})
+		default:
+			if part := contentText(block); part != "" {
+				text = append(text, part)
+			}
+		}
+		return true
+	})
+	msg.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+		turn.ToolCalls = append(turn.ToolCalls, ResponseToolCall{ID: call.Get("id").String(), Name: call.Get("function.name").String(), Arguments: call.Get("function.arguments").String()})
+		return true
+	})
+	turn.Text = strings.Join(text, "\n")
+
+	turns := results
+	if turn.Text != "" || len(turn.ToolCalls) > 0 {
+		turns = append([]TranscriptTurn{turn}, results...)
+	}
+	return turns
+}
+
+// contentText 提取文本内容：字符串、文本块数组或 Gemini parts，图片等非文本内容以占位符表示
+func contentText(value gjson.Result) string {
+	switch {
+	case !value.Exists():
+		return ""
+	case value.Type == gjson.String:
+		return value.String()
+	case value.IsArray():
+		parts := make([]string, 0)
+		value.ForEach(func(_, part gjson.Result) bool {
+			if text := contentText(part); text != "" {
+				parts = append(parts, text)
+			}
+			return true
+		})
+		return strings.Join(parts, "\n")
+	case value.Get("parts").Exists():
+		return contentText(value.Get("parts"))
+	case value.Get("text").Exists():
+		return value.Get("text").String()
+	}
+	switch value.Get("type").String() {
+	case "image", "image_url", "input_image":
+		return "[image]"
+	case "document", "input_file":
+		return "[file]"
+	}
+	if value.Get("inlineData").Exists() || value.Get("inline_data").Exists() {
+		return "[image]"
+	}
+	return ""
+}
+
+// ExportTranscript 导出会话记录到 ~/.code-switch/exports，返回文件路径
+func (ts *TranscriptService) ExportTranscript(conversationID string, format string) (string, error) {
+	transcript, err := ts.GetTranscript(conversationID)
+	if err != nil {
+		return "", err
+	}
+	var data []byte
+	ext := "md"
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", TranscriptExportMarkdown:
+		data = []byte(RenderTranscriptMarkdown(transcript))
+	case TranscriptExportJSON:
+		ext = "json"
+		if data, err = json.MarshalIndent(transcript, "", "  "); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported transcript format: %s", format)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	exportDir := filepath.Join(home, ".code-switch", "exports")
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("transcript_%s_%s.%s", transcriptFileName(conversationID), time.Now().Format("20060102_150405"), ext)
+	path := filepath.Join(exportDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+var transcriptFileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// transcriptFileName 会话 ID 中可用于文件名的部分
+func transcriptFileName(conversationID string) string {
+	name := transcriptFileNameUnsafe.ReplaceAllString(conversationID, "_")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return name
+}
+
+// RenderTranscriptMarkdown 把会话记录渲染为 Markdown
+func RenderTranscriptMarkdown(transcript *Transcript) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation %s\n\n", transcript.ConversationID)
+	fmt.Fprintf(&b, "- Platform: %s\n", transcript.Platform)
+	fmt.Fprintf(&b, "- Time: %s – %s\n", transcript.FirstAt, transcript.LastAt)
+	fmt.Fprintf(&b, "- Requests: %d, tokens: %d in / %d out, cost: $%.4f\n", transcript.Requests, transcript.InputTokens, transcript.OutputTokens, transcript.TotalCost)
+	if transcript.MissingBodies > 0 {
+		fmt.Fprintf(&b, "- %d request(s) had no body log and are not included\n", transcript.MissingBodies)
+	}
+
+	for _, turn := range transcript.Turns {
+		switch turn.Role {
+		case TranscriptRoleAssistant:
+			heading := "Assistant"
+			if turn.Model != "" {
+				heading += fmt.Sprintf(" · %s", turn.Model)
+				if turn.Provider != "" {
+					heading += fmt.Sprintf(" (%s)", turn.Provider)
+				}
+				heading += fmt.Sprintf(" · %d / %d tokens · $%.4f", turn.InputTokens, turn.OutputTokens, turn.Cost)
+			}
+			fmt.Fprintf(&b, "\n## %s\n\n", heading)
+		case TranscriptRoleTool:
+			fmt.Fprintf(&b, "\n## Tool result")
+			if turn.ToolCallID != "" {
+				fmt.Fprintf(&b, " (%s)", turn.ToolCallID)
+			}
+			b.WriteString("\n\n")
+			writeMarkdownFence(&b, "", turn.Text)
+			continue
+		case TranscriptRoleSystem:
+			b.WriteString("\n## System\n\n")
+		default:
+			b.WriteString("\n## User\n\n")
+		}
+		if turn.Error != "" {
+			fmt.Fprintf(&b, "> ⚠ %s\n\n", turn.Error)
+		}
+		if turn.Text != "" {
+			b.WriteString(turn.Text)
+			b.WriteString("\n\n")
+		}
+		for _, call := range turn.ToolCalls {
+			fmt.Fprintf(&b, "**Tool call** `%s`", call.Name)
+			if call.ID != "" {
+				fmt.Fprintf(&b, " (%s)", call.ID)
+			}
+			b.WriteString("\n\n")
+			writeMarkdownFence(&b, "json", call.Arguments)
+		}
+	}
+	return b.String()
+}
+
+// writeMarkdownFence 写入代码块，围栏长度超过内容中最长的反引号序列
+func writeMarkdownFence(b *strings.Builder, lang, content string) {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n\n", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+func insertTranscriptLog(t *testing.T, traceID string, httpCode int, cost float64, request, response string) {
+	t.Helper()
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO request_log (trace_id, conversation_id, platform, model, provider, http_code, input_tokens, output_tokens, total_cost)
+		VALUES (?, 'conv-1', 'claude', 'claude-sonnet-4', 'anthropic', ?, 100, 20, ?)`, traceID, httpCode, cost); err != nil {
+		t.Fatal(err)
+	}
+	if request != "" {
+		if _, err := db.Exec("INSERT INTO request_log_body (trace_id, request_body, response_body) VALUES (?, ?, ?)", traceID, request, response); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTranscriptReconstruction(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	ts := NewTranscriptService(nil)
+
+	insertTranscriptLog(t, "t1", 200, 0.01,
+		`{"system":"be brief","messages":[{"role":"user","content":"list files"}]}`,
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"ls\"}}\n\n"+
+			"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"path\\\":\\\".\\\"}\"}}\n\n")
+	// 第二次请求先失败后重试，重试时的相同输入不重复记录
+	secondRequest := `{"system":"be brief","messages":[{"role":"user","content":"list files"},` +
+		`{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"ls","input":{"path":"."}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"a.go\nb.go"}]}]}`
+	insertTranscriptLog(t, "t2", 529, 0, secondRequest, `{"error":"overloaded"}`)
+	insertTranscriptLog(t, "t3", 200, 0.02, secondRequest, `{"content":[{"type":"text","text":"Two Go files."}]}`)
+
+	transcript, err := ts.GetTranscript("conv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := make([]string, 0, len(transcript.Turns))
+	for _, turn := range transcript.Turns {
+		roles = append(roles, turn.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool,assistant,assistant" {
+		t.Fatalf("roles = %s", got)
+	}
+	if call := transcript.Turns[2].ToolCalls; len(call) != 1 || call[0].Name != "ls" || call[0].Arguments != `{"path":"."}` {
+		t.Fatalf("tool call = %+v", call)
+	}
+	if turn := transcript.Turns[3]; turn.ToolCallID != "toolu_1" || turn.Text != "a.go\nb.go" {
+		t.Fatalf("tool result = %+v", turn)
+	}
+	if transcript.Turns[4].Error == "" || transcript.Turns[5].Text != "Two Go files." || transcript.Turns[5].Cost != 0.02 {
+		t.Fatalf("replies = %+v / %+v", transcript.Turns[4], transcript.Turns[5])
+	}
+	if transcript.Requests != 3 || transcript.TotalCost != 0.03 {
+		t.Fatalf("totals = %d requests, $%v", transcript.Requests, transcript.TotalCost)
+	}
+
+	// body 日志清理后已保存的记录仍然可用，新请求增量追加
+	db, _ := xdb.DB("default")
+	if _, err := db.Exec("DELETE FROM request_log_body"); err != nil {
+		t.Fatal(err)
+	}
+	insertTranscriptLog(t, "t4", 200, 0.01, "", "")
+	transcript, err = ts.GetTranscript("conv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Turns) != 6 || transcript.Requests != 4 || transcript.MissingBodies != 1 {
+		t.Fatalf("after cleanup: %d turns, %d requests, %d missing", len(transcript.Turns), transcript.Requests, transcript.MissingBodies)
+	}
+}
+
+func TestParseRequestTurnsFormats(t *testing.T) {
+	responses := parseRequestTurns([]byte(`{"instructions":"sys","input":[
+		{"role":"user","content":[{"type":"input_text","text":"hi"},{"type":"input_image","image_url":"data:image/png;base64,AA"}]},
+		{"type":"function_call","call_id":"c1","name":"shell","arguments":"{\"cmd\":\"ls\"}"},
+		{"type":"function_call_output","call_id":"c1","output":"ok"}]}`))
+	if len(responses) != 4 || responses[1].Text != "hi\n[image]" || responses[2].ToolCalls[0].ID != "c1" || responses[3].Text != "ok" {
+		t.Fatalf("responses turns = %+v", responses)
+	}
+
+	gemini := parseRequestTurns([]byte(`{"contents":[
+		{"role":"user","parts":[{"text":"weather?"}]},
+		{"role":"model","parts":[{"functionCall":{"name":"weather","args":{"city":"x"}}}]},
+		{"role":"user","parts":[{"functionResponse":{"name":"weather","response":{"temp":20}}}]}]}`))
+	if len(gemini) != 3 || gemini[1].Role != TranscriptRoleAssistant || gemini[2].Role != TranscriptRoleTool || gemini[2].ToolCallID != "weather" {
+		t.Fatalf("gemini turns = %+v", gemini)
+	}
+}
+
+func TestExportTranscriptMarkdown(t *testing.T) {
+	openAnalyticsDB(t, "transcript.db")
+	insertTranscriptLog(t, "t1", 200, 0.5,
+		`{"messages":[{"role":"user","content":"show code"}]}`,
+		`{"content":[{"type":"text","text":"Here:\n`+"```go\\nfunc main() {}\\n```"+`"},{"type":"tool_use","id":"toolu_9","name":"write","input":{"path":"main.go"}}]}`)
+
+	path, err := NewTranscriptService(nil).ExportTranscript("conv-1", TranscriptExportMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown := string(data)
+	for _, want := range []string{"# Conversation conv-1", "## User", "show code", "## Assistant · claude-sonnet-4 (anthropic)", "$0.5000", "**Tool call** `write` (toolu_9)", `{"path":"main.go"}`} {
+		if !strings.Contains(markdown, want) {
+			t.Fatalf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+	if _, err := NewTranscriptService(nil).ExportTranscript("conv-1", "pdf"); err == nil {
+		t.Fatal("unsupported format should fail")
+	}
+}
@@ -0,0 +1,469 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 更新通道：stable 只包含正式版本，beta 同时包含预发布版本
+const (
+	UpdateChannelStable = "stable"
+	UpdateChannelBeta   = "beta"
+)
+
+// 更新进度阶段
+const (
+	UpdateStageDownloading = "downloading"
+	UpdateStageVerifying   = "verifying"
+	UpdateStageStaged      = "staged"
+	UpdateStageFailed      = "failed"
+)
+
+const (
+	updateRepo          = "hanmahong5-arch/acest-switch"
+	updateAPIBase       = "https://api.github.com"
+	updateCheckInterval = 12 * time.Hour
+	// updateFirstCheckDelay 启动后延迟检查，避免与启动流程争抢网络
+	updateFirstCheckDelay = 30 * time.Second
+	updateChecksumAsset   = "SHA256SUMS"
+	updateSignatureAsset  = "SHA256SUMS.sig"
+	// UpdateRelaunchArg 安装更新后重新启动的新进程带有该参数，用于等待旧进程退出并释放单实例锁
+	UpdateRelaunchArg = "--after-update"
+)
+
+// UpdateSigningKey 发布签名公钥（base64 编码的 ed25519 公钥），构建时通过
+// -ldflags "-X codeswitch/services.UpdateSigningKey=..." 注入；为空时只校验 SHA256SUMS 中的校验和
+var UpdateSigningKey = ""
+
+var errNoUpdateStaged = errors.New("no update has been downloaded")
+
+// UpdateSettings 自动更新设置，保存在 ~/.code-switch/update.json
+type UpdateSettings struct {
+	Channel        string `json:"channel"`
+	AutoCheck      bool   `json:"auto_check"`
+	SkippedVersion string `json:"skipped_version,omitempty"`
+}
+
+// UpdateInfo 更新检查结果
+type UpdateInfo struct {
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version"`
+	Channel        string `json:"channel"`
+	Available      bool   `json:"available"`
+	Skipped        bool   `json:"skipped"` // 用户选择跳过该版本
+	Prerelease     bool   `json:"prerelease"`
+	Notes          string `json:"notes,omitempty"`
+	URL            string `json:"url,omitempty"`
+	PublishedAt    string `json:"published_at,omitempty"`
+	AssetName      string `json:"asset_name,omitempty"` // 当前平台的安装包，为空表示该版本未提供当前平台的安装包
+	AssetSize      int64  `json:"asset_size,omitempty"`
+	Staged         bool   `json:"staged"` // 已下载并校验，退出时安装
+}
+
+// UpdateProgress 下载 / 校验进度
+type UpdateProgress struct {
+	Version    string `json:"version"`
+	Stage      string `json:"stage"`
+	Downloaded int64  `json:"downloaded"`
+	Total      int64  `json:"total"`
+	Error      string `json:"error,omitempty"`
+}
+
+type githubRelease struct {
+	TagName     string        `json:"tag_name"`
+	Body        string        `json:"body"`
+	HTMLURL     string        `json:"html_url"`
+	Draft       bool          `json:"draft"`
+	Prerelease  bool          `json:"prerelease"`
+	PublishedAt string        `json:"published_at"`
+	Assets      []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// asset 按名称查找发布附件（忽略大小写，发布脚本与 CI 的命名大小写不一致）
+func (r *githubRelease) asset(name string) *githubAsset {
+	for i := range r.Assets {
+		if strings.EqualFold(r.Assets[i].Name, name) {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// stagedUpdate 已下载并校验、等待安装的版本
+type stagedUpdate struct {
+	Version string `json:"version"`
+	Path    string `json:"path"` // macOS 为解压后的 .app 目录，Windows 为 exe
+}
+
+// UpdateService 检查 GitHub Releases、下载并校验当前平台的安装包，退出时安装
+type UpdateService struct {
+	currentVersion string
+	apiBase        string
+	repo           string
+	client         *http.Client
+	goos           string
+	goarch         string
+	dir            string
+
+	mu          sync.Mutex
+	settings    UpdateSettings
+	latest      *githubRelease
+	staged      *stagedUpdate
+	downloading bool
+	restart     bool
+	stopCh      chan struct{}
+
+	handlersMu        sync.Mutex
+	progressHandlers  []func(UpdateProgress)
+	availableHandlers []func(UpdateInfo)
+}
+
+func NewUpdateService(currentVersion string) *UpdateService {
+	home, _ := os.UserHomeDir()
+	us := &UpdateService{
+		currentVersion: currentVersion,
+		apiBase:        updateAPIBase,
+		repo:           updateRepo,
+		client:         &http.Client{Timeout: 30 * time.Minute},
+		goos:           runtime.GOOS,
+		goarch:         runtime.GOARCH,
+		dir:            filepath.Join(home, ".code-switch", "updates"),
+		settings:       defaultUpdateSettings(),
+	}
+	us.loadUpdateSettings()
+	us.loadStagedUpdate()
+	cleanupPreviousInstall()
+	return us
+}
+
+func defaultUpdateSettings() UpdateSettings {
+	return UpdateSettings{Channel: UpdateChannelStable, AutoCheck: true}
+}
+
+func updateConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "update.json"), nil
+}
+
+func (us *UpdateService) loadUpdateSettings() {
+	path, err := updateConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	settings := defaultUpdateSettings()
+	if err := json.Unmarshal(data, &settings); err != nil {
+		fmt.Printf("[Update] 解析 %s 失败: %v\n", path, err)
+		return
+	}
+	if settings.Channel != UpdateChannelBeta {
+		settings.Channel = UpdateChannelStable
+	}
+	us.settings = settings
+}
+
+// GetUpdateSettings 获取自动更新设置
+func (us *UpdateService) GetUpdateSettings() UpdateSettings {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return us.settings
+}
+
+// SaveUpdateSettings 保存自动更新设置
+func (us *UpdateService) SaveUpdateSettings(settings UpdateSettings) (UpdateSettings, error) {
+	if settings.Channel == "" {
+		settings.Channel = UpdateChannelStable
+	}
+	if settings.Channel != UpdateChannelStable && settings.Channel != UpdateChannelBeta {
+		return UpdateSettings{}, fmt.Errorf("unknown update channel %q", settings.Channel)
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if err := saveUpdateSettings(settings); err != nil {
+		return UpdateSettings{}, err
+	}
+	if settings.Channel != us.settings.Channel {
+		// 切换通道后需重新检查
+		us.latest = nil
+	}
+	us.settings = settings
+	return settings, nil
+}
+
+// SkipVersion 跳过指定版本，自动检查不再提示；传空字符串取消跳过
+func (us *UpdateService) SkipVersion(version string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	settings := us.settings
+	settings.SkippedVersion = version
+	if err := saveUpdateSettings(settings); err != nil {
+		return err
+	}
+	us.settings = settings
+	return nil
+}
+
+func saveUpdateSettings(settings UpdateSettings) error {
+	path, err := updateConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// OnProgress 注册下载进度回调（桌面端用于推送 Wails 事件）
+func (us *UpdateService) OnProgress(handler func(UpdateProgress)) {
+	us.handlersMu.Lock()
+	us.progressHandlers = append(us.progressHandlers, handler)
+	us.handlersMu.Unlock()
+}
+
+// OnUpdateAvailable 注册自动检查发现新版本时的回调，已跳过的版本不会触发
+func (us *UpdateService) OnUpdateAvailable(handler func(UpdateInfo)) {
+	us.handlersMu.Lock()
+	us.availableHandlers = append(us.availableHandlers, handler)
+	us.handlersMu.Unlock()
+}
+
+func (us *UpdateService) emitProgress(progress UpdateProgress) {
+	us.handlersMu.Lock()
+	handlers := append([]func(UpdateProgress){}, us.progressHandlers...)
+	us.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(progress)
+	}
+}
+
+func (us *UpdateService) emitAvailable(info UpdateInfo) {
+	us.handlersMu.Lock()
+	handlers := append([]func(UpdateInfo){}, us.availableHandlers...)
+	us.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(info)
+	}
+}
+
+// StartAutoCheck 启动后台定时检查
+func (us *UpdateService) StartAutoCheck() {
+	us.mu.Lock()
+	if us.stopCh != nil {
+		us.mu.Unlock()
+		return
+	}
+	stopCh := make(chan struct{})
+	us.stopCh = stopCh
+	us.mu.Unlock()
+
+	go func() {
+		timer := time.NewTimer(updateFirstCheckDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-timer.C:
+			}
+			if us.GetUpdateSettings().AutoCheck {
+				info, err := us.CheckForUpdate()
+				if err != nil {
+					fmt.Printf("[Update] 检查更新失败: %v\n", err)
+				} else if info.Available && !info.Skipped {
+					us.emitAvailable(info)
+				}
+			}
+			timer.Reset(updateCheckInterval)
+		}
+	}()
+}
+
+// StopAutoCheck 停止后台定时检查
+func (us *UpdateService) StopAutoCheck() {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.stopCh != nil {
+		close(us.stopCh)
+		us.stopCh = nil
+	}
+}
+
+// CheckForUpdate 查询当前通道的最新版本
+func (us *UpdateService) CheckForUpdate() (UpdateInfo, error) {
+	channel := us.GetUpdateSettings().Channel
+	releases, err := us.fetchReleases()
+	if err != nil {
+		return UpdateInfo{}, err
+	}
+
+	var latest *githubRelease
+	for i := range releases {
+		release := &releases[i]
+		if release.Draft || (release.Prerelease && channel != UpdateChannelBeta) {
+			continue
+		}
+		if latest == nil || compareReleaseVersion(release.TagName, latest.TagName) > 0 {
+			latest = release
+		}
+	}
+
+	us.mu.Lock()
+	us.latest = latest
+	us.mu.Unlock()
+	return us.updateInfo(channel, latest), nil
+}
+
+// updateInfo 根据最近一次检查结果生成更新信息
+func (us *UpdateService) updateInfo(channel string, latest *githubRelease) UpdateInfo {
+	info := UpdateInfo{CurrentVersion: us.currentVersion, Channel: channel}
+	if latest == nil {
+		return info
+	}
+	info.LatestVersion = latest.TagName
+	info.Available = compareReleaseVersion(latest.TagName, us.currentVersion) > 0
+	info.Prerelease = latest.Prerelease
+	info.Notes = latest.Body
+	info.URL = latest.HTMLURL
+	info.PublishedAt = latest.PublishedAt
+	if asset := latest.asset(updateAssetName(us.goos, us.goarch)); asset != nil {
+		info.AssetName = asset.Name
+		info.AssetSize = asset.Size
+	}
+
+	us.mu.Lock()
+	info.Skipped = us.settings.SkippedVersion == latest.TagName
+	info.Staged = us.staged != nil && us.staged.Version == latest.TagName
+	us.mu.Unlock()
+	return info
+}
+
+func (us *UpdateService) fetchReleases() ([]githubRelease, error) {
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=30", strings.TrimRight(us.apiBase, "/"), us.repo)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "Ailurus-PaaS/"+us.currentVersion)
+
+	client := &http.Client{Timeout: 15 * time.Second, Transport: us.client.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query releases: HTTP %d", resp.StatusCode)
+	}
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("invalid releases response: %w", err)
+	}
+	return releases, nil
+}
+
+// updateAssetName 当前平台对应的发布附件名（与 .github/workflows/release.yml 一致）
+func updateAssetName(goos, goarch string) string {
+	switch goos {
+	case "darwin":
+		return fmt.Sprintf("codeswitch-macos-%s.zip", goarch)
+	case "windows":
+		if goarch == "amd64" {
+			return "CodeSwitch.exe"
+		}
+	}
+	return ""
+}
+
+// compareReleaseVersion 比较版本号，支持预发布后缀：v1.2.0-beta.1 < v1.2.0
+func compareReleaseVersion(a, b string) int {
+	if c := compareVersion(releaseCore(a), releaseCore(b)); c != 0 {
+		return c
+	}
+	preA, preB := releasePrerelease(a), releasePrerelease(b)
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+
+	partsA, partsB := strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		case errA == nil:
+			// 数字标识符低于字母标识符
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(partsA[i], partsB[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	}
+	return 0
+}
+
+// releaseCore 去掉预发布与构建后缀的版本号
+func releaseCore(version string) string {
+	if idx := strings.IndexAny(version, "-+"); idx >= 0 {
+		return version[:idx]
+	}
+	return version
+}
+
+func releasePrerelease(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if idx := strings.IndexByte(version, '+'); idx >= 0 {
+		version = version[:idx]
+	}
+	if idx := strings.IndexByte(version, '-'); idx >= 0 {
+		return version[idx+1:]
+	}
+	return ""
+}
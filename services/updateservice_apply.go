@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// RequestRestart 退出时安装更新后重新启动应用；调用方随后退出应用
+func (us *UpdateService) RequestRestart() error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.staged == nil {
+		return errNoUpdateStaged
+	}
+	us.restart = true
+	return nil
+}
+
+// ApplyStagedUpdate 安装已下载的更新，在应用退出时调用（转发服务已停止、单实例锁已释放）；
+// 运行中的程序先重命名为 .old，下次启动时清理
+func (us *UpdateService) ApplyStagedUpdate() error {
+	us.mu.Lock()
+	staged, restart := us.staged, us.restart
+	us.mu.Unlock()
+	if staged == nil {
+		return nil
+	}
+
+	target, err := installTarget(us.goos)
+	if err != nil {
+		return err
+	}
+	if err := swapInstall(target, staged.Path); err != nil {
+		return err
+	}
+	fmt.Printf("[Update] 已安装 %s: %s\n", staged.Version, target)
+
+	us.mu.Lock()
+	us.staged = nil
+	us.mu.Unlock()
+	_ = os.RemoveAll(us.dir)
+
+	if restart {
+		return relaunchInstalled(us.goos, target)
+	}
+	return nil
+}
+
+// IsUpdateRelaunch 当前进程是否由安装更新后的重启拉起
+func IsUpdateRelaunch() bool {
+	for _, arg := range os.Args[1:] {
+		if arg == UpdateRelaunchArg {
+			return true
+		}
+	}
+	return false
+}
+
+// installTarget 需要替换的安装路径：macOS 为 .app 目录，其他平台为可执行文件
+func installTarget(goos string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	if goos != "darwin" {
+		return exe, nil
+	}
+	// xxx.app/Contents/MacOS/<binary>
+	bundle := filepath.Dir(filepath.Dir(filepath.Dir(exe)))
+	if !strings.HasSuffix(bundle, ".app") {
+		return "", fmt.Errorf("not running from an app bundle: %s", exe)
+	}
+	return bundle, nil
+}
+
+// cleanupPreviousInstall 删除上次安装更新时保留的旧版本
+func cleanupPreviousInstall() {
+	if target, err := installTarget(runtime.GOOS); err == nil {
+		_ = os.RemoveAll(target + ".old")
+	}
+}
+
+// swapInstall 用新版本替换 target，失败时恢复原文件
+func swapInstall(target, staged string) error {
+	backup := target + ".old"
+	_ = os.RemoveAll(backup)
+	if err := os.Rename(target, backup); err != nil {
+		return fmt.Errorf("failed to move %s aside: %w", target, err)
+	}
+	if err := os.Rename(staged, target); err != nil {
+		// 暂存目录与安装目录不在同一卷时无法重命名，改为复制
+		if err := copyInstallPath(staged, target); err != nil {
+			_ = os.RemoveAll(target)
+			_ = os.Rename(backup, target)
+			return fmt.Errorf("failed to install update: %w", err)
+		}
+	}
+	return nil
+}
+
+// copyInstallPath 复制文件或目录，保留权限与符号链接
+func copyInstallPath(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// relaunchInstalled 启动新安装的版本，带上 UpdateRelaunchArg 使其等待当前进程退出
+func relaunchInstalled(goos, target string) error {
+	var cmd *exec.Cmd
+	if goos == "darwin" {
+		cmd = exec.Command("open", "-n", target, "--args", UpdateRelaunchArg)
+	} else {
+		cmd = exec.Command(target, UpdateRelaunchArg)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to relaunch %s: %w", target, err)
+	}
+	return cmd.Process.Release()
+}
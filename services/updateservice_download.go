@@ -0,0 +1,334 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// updateProgressInterval 下载进度事件的最短间隔
+const updateProgressInterval = 200 * time.Millisecond
+
+func (us *UpdateService) stagedConfigPath() string {
+	return filepath.Join(us.dir, "staged.json")
+}
+
+// loadStagedUpdate 读取上次已下载的更新；版本不高于当前版本（已安装或已回退）时清理
+func (us *UpdateService) loadStagedUpdate() {
+	data, err := os.ReadFile(us.stagedConfigPath())
+	if err != nil {
+		return
+	}
+	var staged stagedUpdate
+	if err := json.Unmarshal(data, &staged); err == nil && staged.Path != "" &&
+		compareReleaseVersion(staged.Version, us.currentVersion) > 0 {
+		if _, err := os.Stat(staged.Path); err == nil {
+			us.staged = &staged
+			return
+		}
+	}
+	_ = os.RemoveAll(us.dir)
+}
+
+// GetStagedVersion 已下载并等待安装的版本，没有时返回空字符串
+func (us *UpdateService) GetStagedVersion() string {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.staged == nil {
+		return ""
+	}
+	return us.staged.Version
+}
+
+// DownloadUpdate 下载最新版本的安装包，校验后暂存，退出应用时安装
+func (us *UpdateService) DownloadUpdate() (UpdateInfo, error) {
+	us.mu.Lock()
+	if us.downloading {
+		us.mu.Unlock()
+		return UpdateInfo{}, fmt.Errorf("an update is already downloading")
+	}
+	latest := us.latest
+	us.mu.Unlock()
+
+	if latest == nil {
+		if _, err := us.CheckForUpdate(); err != nil {
+			return UpdateInfo{}, err
+		}
+		us.mu.Lock()
+		latest = us.latest
+		us.mu.Unlock()
+	}
+	channel := us.GetUpdateSettings().Channel
+	info := us.updateInfo(channel, latest)
+	if !info.Available {
+		return info, fmt.Errorf("already up to date")
+	}
+	if info.Staged {
+		return info, nil
+	}
+	if info.AssetName == "" {
+		return info, fmt.Errorf("release %s has no package for %s/%s", info.LatestVersion, us.goos, us.goarch)
+	}
+
+	us.mu.Lock()
+	if us.downloading {
+		us.mu.Unlock()
+		return info, fmt.Errorf("an update is already downloading")
+	}
+	us.downloading = true
+	us.mu.Unlock()
+	defer func() {
+		us.mu.Lock()
+		us.downloading = false
+		us.mu.Unlock()
+	}()
+
+	staged, err := us.downloadAndStage(latest)
+	if err != nil {
+		us.emitProgress(UpdateProgress{Version: latest.TagName, Stage: UpdateStageFailed, Error: err.Error()})
+		return info, err
+	}
+
+	us.mu.Lock()
+	us.staged = staged
+	us.mu.Unlock()
+	us.emitProgress(UpdateProgress{Version: latest.TagName, Stage: UpdateStageStaged, Downloaded: info.AssetSize, Total: info.AssetSize})
+	info.Staged = true
+	return info, nil
+}
+
+func (us *UpdateService) downloadAndStage(release *githubRelease) (*stagedUpdate, error) {
+	asset := release.asset(updateAssetName(us.goos, us.goarch))
+	sumsAsset := release.asset(updateChecksumAsset)
+	if sumsAsset == nil {
+		return nil, fmt.Errorf("release %s has no %s, refusing to install an unverified package", release.TagName, updateChecksumAsset)
+	}
+	sums, err := us.fetchSmallAsset(sumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	if UpdateSigningKey != "" {
+		sigAsset := release.asset(updateSignatureAsset)
+		if sigAsset == nil {
+			return nil, fmt.Errorf("release %s has no %s", release.TagName, updateSignatureAsset)
+		}
+		sig, err := us.fetchSmallAsset(sigAsset)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyUpdateSignature(UpdateSigningKey, sums, sig); err != nil {
+			return nil, err
+		}
+	}
+	expected, err := checksumFor(sums, asset.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个版本独立目录，重新下载前清理上次未完成的文件
+	if err := os.RemoveAll(us.dir); err != nil {
+		return nil, err
+	}
+	versionDir := filepath.Join(us.dir, release.TagName)
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return nil, err
+	}
+	packagePath := filepath.Join(versionDir, asset.Name)
+	actual, err := us.downloadAsset(release.TagName, asset, packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	us.emitProgress(UpdateProgress{Version: release.TagName, Stage: UpdateStageVerifying, Downloaded: asset.Size, Total: asset.Size})
+	if !strings.EqualFold(actual, expected) {
+		_ = os.Remove(packagePath)
+		return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset.Name, expected, actual)
+	}
+
+	staged := &stagedUpdate{Version: release.TagName, Path: packagePath}
+	if strings.HasSuffix(strings.ToLower(asset.Name), ".zip") {
+		appPath, err := extractAppBundle(packagePath, filepath.Join(versionDir, "app"))
+		if err != nil {
+			return nil, err
+		}
+		_ = os.Remove(packagePath)
+		staged.Path = appPath
+	}
+
+	data, _ := json.MarshalIndent(staged, "", "  ")
+	if err := os.WriteFile(us.stagedConfigPath(), data, 0644); err != nil {
+		return nil, err
+	}
+	return staged, nil
+}
+
+func (us *UpdateService) fetchSmallAsset(asset *githubAsset) ([]byte, error) {
+	resp, err := us.client.Get(asset.BrowserDownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: HTTP %d", asset.Name, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// downloadAsset 下载安装包并返回 SHA-256
+func (us *UpdateService) downloadAsset(version string, asset *githubAsset, path string) (string, error) {
+	resp, err := us.client.Get(asset.BrowserDownloadURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: HTTP %d", asset.Name, resp.StatusCode)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	total := asset.Size
+	if resp.ContentLength > 0 {
+		total = resp.ContentLength
+	}
+	hash := sha256.New()
+	progress := &updateProgressWriter{
+		report: func(downloaded int64) {
+			us.emitProgress(UpdateProgress{Version: version, Stage: UpdateStageDownloading, Downloaded: downloaded, Total: total})
+		},
+	}
+	if _, err := io.Copy(io.MultiWriter(f, hash, progress), resp.Body); err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	progress.flush()
+	return hex.EncodeToString(hash.Sum(nil)), f.Sync()
+}
+
+// updateProgressWriter 统计已下载字节数，按间隔上报
+type updateProgressWriter struct {
+	written    int64
+	lastReport time.Time
+	report     func(int64)
+}
+
+func (w *updateProgressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	if now := time.Now(); now.Sub(w.lastReport) >= updateProgressInterval {
+		w.lastReport = now
+		w.report(w.written)
+	}
+	return len(p), nil
+}
+
+func (w *updateProgressWriter) flush() {
+	w.report(w.written)
+}
+
+// checksumFor 从 SHA256SUMS（sha256sum 输出格式）中查找文件的校验和
+func checksumFor(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum 二进制模式在文件名前加 *
+		if strings.EqualFold(strings.TrimPrefix(fields[1], "*"), name) {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", updateChecksumAsset, name)
+}
+
+// verifyUpdateSignature 校验 SHA256SUMS 的 ed25519 签名
+func verifyUpdateSignature(publicKey string, sums, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid update signing key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", updateSignatureAsset, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) {
+		return fmt.Errorf("signature verification failed for %s", updateChecksumAsset)
+	}
+	return nil
+}
+
+// extractAppBundle 解压 macOS 安装包，返回其中的 .app 目录
+func extractAppBundle(zipPath, dest string) (string, error) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	root := filepath.Clean(dest) + string(os.PathSeparator)
+	appPath := ""
+	for _, file := range reader.File {
+		target := filepath.Join(dest, file.Name)
+		if !strings.HasPrefix(target, root) {
+			return "", fmt.Errorf("invalid path in update package: %s", file.Name)
+		}
+		if top := strings.SplitN(filepath.ToSlash(file.Name), "/", 2)[0]; strings.HasSuffix(top, ".app") {
+			appPath = filepath.Join(dest, top)
+		}
+		if err := extractZipFile(file, target); err != nil {
+			return "", err
+		}
+	}
+	if appPath == "" {
+		return "", errors.New("update package contains no .app bundle")
+	}
+	return appPath, nil
+}
+
+func extractZipFile(file *zip.File, target string) error {
+	mode := file.Mode()
+	if mode.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		link, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(string(link), target)
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
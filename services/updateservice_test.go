@@ -0,0 +1,225 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newFakeReleaseServer 模拟 GitHub Releases API，assets 为附件名到内容的映射
+func newFakeReleaseServer(t *testing.T, assets map[string][]byte) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/download/") {
+			data, ok := assets[strings.TrimPrefix(r.URL.Path, "/download/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+			return
+		}
+		if r.URL.Path != "/repos/"+updateRepo+"/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		var stableAssets []githubAsset
+		for name, data := range assets {
+			stableAssets = append(stableAssets, githubAsset{Name: name, Size: int64(len(data)), BrowserDownloadURL: server.URL + "/download/" + name})
+		}
+		json.NewEncoder(w).Encode([]githubRelease{
+			{TagName: "v0.3.0", Draft: true},
+			{TagName: "v0.2.0-beta.1", Prerelease: true},
+			{TagName: "v0.1.9", Body: "notes", Assets: stableAssets},
+			{TagName: "v0.1.7"},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func checksums(assets map[string][]byte) []byte {
+	var buf bytes.Buffer
+	for name, data := range assets {
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&buf, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	return buf.Bytes()
+}
+
+func TestCompareReleaseVersion(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"v0.2.0", "v0.1.9", 1},
+		{"v0.2.0-beta.1", "v0.2.0", -1},
+		{"v0.2.0-beta.2", "v0.2.0-beta.10", -1},
+		{"v0.2.0-alpha", "v0.2.0-beta", -1},
+		{"v0.2.0-beta.1", "v0.1.9", 1},
+		{"v1.0.0", "1.0.0", 0},
+	}
+	for _, tc := range cases {
+		if got := compareReleaseVersion(tc.a, tc.b); got != tc.want {
+			t.Fatalf("compareReleaseVersion(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestUpdateCheckChannelsAndSkip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := newFakeReleaseServer(t, map[string][]byte{"CodeSwitch.exe": []byte("exe")})
+	us := NewUpdateService("v0.1.8")
+	us.apiBase = server.URL
+	us.goos, us.goarch = "windows", "amd64"
+
+	info, err := us.CheckForUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Available || info.LatestVersion != "v0.1.9" || info.AssetName != "CodeSwitch.exe" || info.Skipped {
+		t.Fatalf("unexpected stable update info: %+v", info)
+	}
+
+	if _, err := us.SaveUpdateSettings(UpdateSettings{Channel: "nightly"}); err == nil {
+		t.Fatal("expected unknown channel to be rejected")
+	}
+	if _, err := us.SaveUpdateSettings(UpdateSettings{Channel: UpdateChannelBeta, AutoCheck: true}); err != nil {
+		t.Fatal(err)
+	}
+	info, err = us.CheckForUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.LatestVersion != "v0.2.0-beta.1" || !info.Prerelease || info.AssetName != "" {
+		t.Fatalf("unexpected beta update info: %+v", info)
+	}
+
+	if err := us.SkipVersion("v0.2.0-beta.1"); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewUpdateService("v0.1.8")
+	restored.apiBase = server.URL
+	if settings := restored.GetUpdateSettings(); settings.Channel != UpdateChannelBeta || settings.SkippedVersion != "v0.2.0-beta.1" {
+		t.Fatalf("expected saved settings, got %+v", settings)
+	}
+	if info, err := restored.CheckForUpdate(); err != nil || !info.Skipped {
+		t.Fatalf("expected skipped beta, got %+v (%v)", info, err)
+	}
+
+	upToDate := NewUpdateService("v0.2.0")
+	upToDate.apiBase = server.URL
+	if info, err := upToDate.CheckForUpdate(); err != nil || info.Available {
+		t.Fatalf("expected no update for a newer version, got %+v (%v)", info, err)
+	}
+}
+
+func TestUpdateDownloadVerifyAndInstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	header := &zip.FileHeader{Name: "CodeSwitch.app/Contents/MacOS/codeswitch", Method: zip.Deflate}
+	header.SetMode(0755)
+	fw, _ := zw.CreateHeader(header)
+	fw.Write([]byte("new binary"))
+	zw.Close()
+
+	assets := map[string][]byte{"CodeSwitch-macos-arm64.zip": zipBuf.Bytes()}
+	assets[updateChecksumAsset] = checksums(assets)
+	server := newFakeReleaseServer(t, assets)
+
+	us := NewUpdateService("v0.1.8")
+	us.apiBase = server.URL
+	us.goos, us.goarch = "darwin", "arm64"
+	var mu sync.Mutex
+	stages := map[string]bool{}
+	us.OnProgress(func(p UpdateProgress) {
+		mu.Lock()
+		stages[p.Stage] = true
+		mu.Unlock()
+	})
+
+	if err := us.RequestRestart(); err == nil {
+		t.Fatal("expected restart to require a downloaded update")
+	}
+	info, err := us.DownloadUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Staged || us.GetStagedVersion() != "v0.1.9" {
+		t.Fatalf("expected staged update, got %+v", info)
+	}
+	if !stages[UpdateStageDownloading] || !stages[UpdateStageVerifying] || !stages[UpdateStageStaged] {
+		t.Fatalf("missing progress stages: %v", stages)
+	}
+	stagedApp := us.staged.Path
+	if fi, err := os.Stat(filepath.Join(stagedApp, "Contents", "MacOS", "codeswitch")); err != nil || fi.Mode().Perm()&0100 == 0 {
+		t.Fatalf("expected executable in staged bundle: %v %v", fi, err)
+	}
+
+	// 重启后仍能找到已下载的更新；安装后旧版本保留为 .old
+	restored := NewUpdateService("v0.1.8")
+	if restored.GetStagedVersion() != "v0.1.9" {
+		t.Fatal("expected staged update to survive restart")
+	}
+	installed := filepath.Join(t.TempDir(), "CodeSwitch.app")
+	if err := os.MkdirAll(installed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(installed, "old"), []byte("old"), 0644)
+	if err := swapInstall(installed, stagedApp); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(installed, "Contents", "MacOS", "codeswitch")); err != nil || string(data) != "new binary" {
+		t.Fatalf("expected new bundle installed, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(installed+".old", "old")); err != nil {
+		t.Fatalf("expected previous bundle kept as .old: %v", err)
+	}
+
+	// 已安装的版本不再视为待安装
+	if NewUpdateService("v0.1.9").GetStagedVersion() != "" {
+		t.Fatal("expected staged update to be discarded once installed")
+	}
+}
+
+func TestUpdateChecksumMismatch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	assets := map[string][]byte{
+		"CodeSwitch.exe":    []byte("tampered"),
+		updateChecksumAsset: checksums(map[string][]byte{"CodeSwitch.exe": []byte("original")}),
+	}
+	server := newFakeReleaseServer(t, assets)
+	us := NewUpdateService("v0.1.8")
+	us.apiBase = server.URL
+	us.goos, us.goarch = "windows", "amd64"
+
+	if _, err := us.DownloadUpdate(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if us.GetStagedVersion() != "" {
+		t.Fatal("tampered package must not be staged")
+	}
+
+	// 缺少 SHA256SUMS 时拒绝安装
+	delete(assets, updateChecksumAsset)
+	noSums := newFakeReleaseServer(t, assets)
+	us.apiBase = noSums.URL
+	us.latest = nil
+	if _, err := us.DownloadUpdate(); err == nil || !strings.Contains(err.Error(), updateChecksumAsset) {
+		t.Fatalf("expected missing checksum error, got %v", err)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/aspect-code/codeswitch/sync-service/internal/nats"
 	"github.com/aspect-code/codeswitch/sync-service/internal/presence"
 	"github.com/aspect-code/codeswitch/sync-service/internal/session"
+	"github.com/aspect-code/codeswitch/sync-service/internal/storage"
 	"gopkg.in/yaml.v3"
 )
 
@@ -32,6 +33,8 @@ type Config struct {
 	NewAPI  auth.NewAPIConfig  `yaml:"newapi"`
 	JWT     auth.JWTConfig     `yaml:"jwt"`
 	Presence presence.Config  `yaml:"presence"`
+	Storage  storage.Config   `yaml:"storage"`
+	Metrics  api.MetricsConfig `yaml:"metrics"`
 }
 
 func main() {
@@ -50,8 +53,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 系统监控需在连接 NATS 前创建，以记录连接状态与消息流量
+	monitorService := admin.NewMonitorService()
+
 	// 创建 NATS 客户端
 	natsClient := nats.NewClient(&cfg.NATS, logger)
+	natsClient.SetObserver(monitorService)
 	ctx := context.Background()
 
 	if err := natsClient.Connect(ctx); err != nil {
@@ -64,18 +71,32 @@ func main() {
 	authService := auth.NewService(&cfg.JWT, &cfg.NewAPI, logger)
 	sessionManager := session.NewManager(natsClient, logger)
 	messageHandler := message.NewHandler(natsClient, logger)
+	if err := messageHandler.EnableHistory(cfg.NATS.Stream); err != nil {
+		logger.Warn("Message history disabled, offline devices will miss events", "error", err)
+	}
 	presenceTracker := presence.NewTracker(natsClient, &cfg.Presence, logger)
 
-	// 创建管理后台服务
-	statsService := admin.NewStatsService()
-	monitorService := admin.NewMonitorService()
-	userManager := admin.NewUserManager()
-	auditService := admin.NewAuditService()
-	alertService := admin.NewAlertService(statsService)
-	billingService := admin.NewBillingService("")
+	// 打开管理后台持久化存储并执行迁移
+	db, err := storage.Open(cfg.Storage)
+	if err != nil {
+		logger.Error("Failed to open storage", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
 
-	// 设置 NATS 连接状态
-	monitorService.SetNATSStatus(true, "")
+	adminStore, err := admin.NewSQLStore(ctx, db)
+	if err != nil {
+		logger.Error("Failed to migrate storage", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Storage ready", "driver", db.Dialect().Name())
+
+	// 创建管理后台服务
+	statsService := admin.NewStatsService(adminStore)
+	userManager := admin.NewUserManager(adminStore)
+	auditService := admin.NewAuditService(adminStore)
+	alertService := admin.NewAlertService(statsService, adminStore)
+	billingService := admin.NewBillingService("", adminStore)
 
 	logger.Info("Admin services initialized",
 		"stats", "enabled",
@@ -86,6 +107,10 @@ func main() {
 		"billing", "enabled",
 	)
 
+	// 创建 WebSocket 推送中心
+	wsHub := api.NewWSHub(natsClient.Conn(), presenceTracker, messageHandler, monitorService, logger)
+	go wsHub.Run()
+
 	// 启动 API 服务器
 	server := api.NewServer(
 		authService,
@@ -98,6 +123,8 @@ func main() {
 		auditService,
 		alertService,
 		billingService,
+		wsHub,
+		cfg.Metrics,
 		logger,
 		cfg.Server.Mode,
 		Version,
@@ -111,6 +138,7 @@ func main() {
 
 		logger.Info("Shutting down...")
 		natsClient.Close()
+		db.Close()
 		os.Exit(0)
 	}()
 
@@ -129,7 +157,8 @@ func loadConfig(path string) (*Config, error) {
 		return defaultConfig(), nil
 	}
 
-	var cfg Config
+	cfg := Config{Metrics: api.DefaultMetricsConfig()}
+	cfg.NATS.Stream = nats.DefaultStreamConfig()
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
@@ -171,6 +200,7 @@ func defaultConfig() *Config {
 			ReconnectWait:       2 * time.Second,
 			MaxReconnects:       -1,
 			ReconnectBufferSize: 8 * 1024 * 1024,
+			Stream:              nats.DefaultStreamConfig(),
 		},
 		JWT: auth.JWTConfig{
 			Secret:          "codeswitch-sync-service-jwt-secret-key",
@@ -182,5 +212,6 @@ func defaultConfig() *Config {
 			HeartbeatInterval: 30 * time.Second,
 			Timeout:           90 * time.Second,
 		},
+		Metrics: api.DefaultMetricsConfig(),
 	}
 }
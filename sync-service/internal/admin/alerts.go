@@ -47,15 +47,17 @@ type AlertRuleListResponse struct {
 
 // AlertHistoryListResponse represents paginated alert history response
 type AlertHistoryListResponse struct {
-	History []AlertHistory `json:"history"`
-	Total   int            `json:"total"`
+	History    []AlertHistory `json:"history"`
+	Total      int            `json:"total"`
+	Page       int            `json:"page"`
+	PageSize   int            `json:"page_size"`
+	TotalPages int            `json:"total_pages"`
 }
 
 // AlertService handles alert rules and notifications
 type AlertService struct {
 	mu           sync.RWMutex
-	rules        map[string]*AlertRule
-	history      []AlertHistory
+	store        AlertStore // rules and alert history
 	statsService *StatsService
 	stopCh       chan struct{}
 	// Deduplication: track last fire time per rule to avoid alert flooding
@@ -65,10 +67,9 @@ type AlertService struct {
 }
 
 // NewAlertService creates a new alert service
-func NewAlertService(statsService *StatsService) *AlertService {
+func NewAlertService(statsService *StatsService, store AlertStore) *AlertService {
 	s := &AlertService{
-		rules:         make(map[string]*AlertRule),
-		history:       make([]AlertHistory, 0),
+		store:         store,
 		statsService:  statsService,
 		stopCh:        make(chan struct{}),
 		lastFired:     make(map[string]time.Time),
@@ -117,16 +118,17 @@ func (s *AlertService) GetFiringStatus() map[string]time.Time {
 
 // CreateRule creates a new alert rule
 func (s *AlertService) CreateRule(rule AlertRule) (*AlertRule, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if rule.ID == "" {
 		rule.ID = generateAlertID()
 	}
 	rule.CreatedAt = time.Now()
 	rule.UpdatedAt = time.Now()
 
-	s.rules[rule.ID] = &rule
+	ctx, cancel := storeContext()
+	defer cancel()
+	if err := s.store.SaveAlertRule(ctx, rule); err != nil {
+		return nil, err
+	}
 	return &rule, nil
 }
 
@@ -135,8 +137,14 @@ func (s *AlertService) UpdateRule(id string, updates AlertRule) (*AlertRule, err
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	rule, ok := s.rules[id]
-	if !ok {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	rule, err := s.store.GetAlertRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
 		return nil, fmt.Errorf("rule not found: %s", id)
 	}
 
@@ -163,41 +171,46 @@ func (s *AlertService) UpdateRule(id string, updates AlertRule) (*AlertRule, err
 	rule.WebhookURL = updates.WebhookURL
 	rule.UpdatedAt = time.Now()
 
+	if err := s.store.SaveAlertRule(ctx, *rule); err != nil {
+		return nil, err
+	}
 	return rule, nil
 }
 
 // DeleteRule deletes an alert rule
 func (s *AlertService) DeleteRule(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	if _, ok := s.rules[id]; !ok {
+	found, err := s.store.DeleteAlertRule(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
 		return fmt.Errorf("rule not found: %s", id)
 	}
-
-	delete(s.rules, id)
 	return nil
 }
 
 // GetRule gets a single rule by ID
 func (s *AlertService) GetRule(id string) *AlertRule {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	if rule, ok := s.rules[id]; ok {
-		return rule
-	}
-	return nil
+	rule, err := s.store.GetAlertRule(ctx, id)
+	logStoreError("get alert rule", err)
+	return rule
 }
 
 // ListRules returns all alert rules
 func (s *AlertService) ListRules() AlertRuleListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	rules := make([]AlertRule, 0, len(s.rules))
-	for _, rule := range s.rules {
-		rules = append(rules, *rule)
+	rules, err := s.store.ListAlertRules(ctx)
+	logStoreError("list alert rules", err)
+	if rules == nil {
+		rules = []AlertRule{}
 	}
 
 	return AlertRuleListResponse{
@@ -206,32 +219,25 @@ func (s *AlertService) ListRules() AlertRuleListResponse {
 	}
 }
 
-// ListHistory returns alert history
-func (s *AlertService) ListHistory(severity, status string, limit int) AlertHistoryListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// ListHistory returns paginated alert history
+func (s *AlertService) ListHistory(query AlertHistoryQuery) AlertHistoryListResponse {
+	query.ListParams = query.ListParams.Normalize()
 
-	if limit <= 0 || limit > 100 {
-		limit = 50
-	}
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	var filtered []AlertHistory
-	for _, h := range s.history {
-		if severity != "" && h.Severity != severity {
-			continue
-		}
-		if status != "" && h.Status != status {
-			continue
-		}
-		filtered = append(filtered, h)
-		if len(filtered) >= limit {
-			break
-		}
+	history, total, err := s.store.ListAlertHistory(ctx, query)
+	logStoreError("list alert history", err)
+	if history == nil {
+		history = []AlertHistory{}
 	}
 
 	return AlertHistoryListResponse{
-		History: filtered,
-		Total:   len(s.history),
+		History:    history,
+		Total:      total,
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+		TotalPages: query.TotalPages(total),
 	}
 }
 
@@ -252,18 +258,16 @@ func (s *AlertService) evaluationLoop() {
 
 // evaluateRules evaluates all enabled rules
 func (s *AlertService) evaluateRules() {
-	s.mu.RLock()
-	rules := make([]*AlertRule, 0)
-	for _, rule := range s.rules {
-		if rule.Enabled {
-			rules = append(rules, rule)
+	ctx, cancel := storeContext()
+	rules, err := s.store.ListAlertRules(ctx)
+	cancel()
+	logStoreError("load alert rules", err)
+
+	for i := range rules {
+		if rules[i].Enabled {
+			s.evaluateRule(&rules[i])
 		}
 	}
-	s.mu.RUnlock()
-
-	for _, rule := range rules {
-		s.evaluateRule(rule)
-	}
 }
 
 // evaluateRule evaluates a single rule
@@ -367,13 +371,9 @@ func (s *AlertService) fireAlert(rule *AlertRule, value float64) {
 		TriggeredAt: time.Now(),
 	}
 
-	// Prepend to history (most recent first)
-	s.history = append([]AlertHistory{alert}, s.history...)
-
-	// Keep only last 1000 entries
-	if len(s.history) > 1000 {
-		s.history = s.history[:1000]
-	}
+	ctx, cancel := storeContext()
+	defer cancel()
+	logStoreError("insert alert history", s.store.InsertAlertHistory(ctx, alert))
 
 	// Send notifications
 	go s.sendNotifications(rule, alert)
@@ -1,9 +1,6 @@
 package admin
 
-import (
-	"sync"
-	"time"
-)
+import "time"
 
 // AuditLog represents an audit log entry
 type AuditLog struct {
@@ -22,41 +19,36 @@ type AuditLog struct {
 
 // AuditLogQuery represents query parameters for audit logs
 type AuditLogQuery struct {
-	UserID    string
-	Action    string
-	Result    string
-	StartTime *time.Time
-	EndTime   *time.Time
-	Page      int
-	PageSize  int
+	UserID       string
+	Action       string
+	ResourceType string
+	Result       string
+	StartTime    *time.Time
+	EndTime      *time.Time
+	ListParams
 }
 
 // AuditLogListResponse represents paginated audit logs response
 type AuditLogListResponse struct {
-	Logs  []AuditLog `json:"logs"`
-	Total int        `json:"total"`
-	Page  int        `json:"page"`
-	Size  int        `json:"page_size"`
+	Logs       []AuditLog `json:"logs"`
+	Total      int        `json:"total"`
+	Page       int        `json:"page"`
+	Size       int        `json:"page_size"`
+	TotalPages int        `json:"total_pages"`
 }
 
-// AuditService handles audit logging
+// AuditService handles audit logging, entries are persisted in an AuditStore
 type AuditService struct {
-	mu   sync.RWMutex
-	logs []AuditLog
+	store AuditStore
 }
 
 // NewAuditService creates a new audit service
-func NewAuditService() *AuditService {
-	return &AuditService{
-		logs: make([]AuditLog, 0),
-	}
+func NewAuditService(store AuditStore) *AuditService {
+	return &AuditService{store: store}
 }
 
 // Log records an audit log entry
 func (s *AuditService) Log(log AuditLog) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if log.ID == "" {
 		log.ID = generateID()
 	}
@@ -64,13 +56,9 @@ func (s *AuditService) Log(log AuditLog) {
 		log.CreatedAt = time.Now()
 	}
 
-	// Prepend to keep most recent first
-	s.logs = append([]AuditLog{log}, s.logs...)
-
-	// Keep only the last 10000 logs in memory
-	if len(s.logs) > 10000 {
-		s.logs = s.logs[:10000]
-	}
+	ctx, cancel := storeContext()
+	defer cancel()
+	logStoreError("insert audit log", s.store.InsertAuditLog(ctx, log))
 }
 
 // LogAction is a convenience method for logging actions
@@ -90,79 +78,41 @@ func (s *AuditService) LogAction(userID, username, action, resourceType, resourc
 
 // Query returns audit logs based on query parameters
 func (s *AuditService) Query(q AuditLogQuery) AuditLogListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// Filter logs
-	var filtered []AuditLog
-	for _, log := range s.logs {
-		if q.UserID != "" && log.UserID != q.UserID {
-			continue
-		}
-		if q.Action != "" && log.Action != q.Action {
-			continue
-		}
-		if q.Result != "" && log.Result != q.Result {
-			continue
-		}
-		if q.StartTime != nil && log.CreatedAt.Before(*q.StartTime) {
-			continue
-		}
-		if q.EndTime != nil && log.CreatedAt.After(*q.EndTime) {
-			continue
-		}
-		filtered = append(filtered, log)
-	}
+	q.ListParams = q.ListParams.Normalize()
 
-	total := len(filtered)
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	// Pagination
-	if q.Page < 1 {
-		q.Page = 1
-	}
-	if q.PageSize < 1 || q.PageSize > 100 {
-		q.PageSize = 20
-	}
-
-	start := (q.Page - 1) * q.PageSize
-	end := start + q.PageSize
-
-	if start >= len(filtered) {
-		return AuditLogListResponse{
-			Logs:  []AuditLog{},
-			Total: total,
-			Page:  q.Page,
-			Size:  q.PageSize,
-		}
-	}
-
-	if end > len(filtered) {
-		end = len(filtered)
+	logs, total, err := s.store.QueryAuditLogs(ctx, q)
+	logStoreError("query audit logs", err)
+	if logs == nil {
+		logs = []AuditLog{}
 	}
 
 	return AuditLogListResponse{
-		Logs:  filtered[start:end],
-		Total: total,
-		Page:  q.Page,
-		Size:  q.PageSize,
+		Logs:       logs,
+		Total:      total,
+		Page:       q.Page,
+		Size:       q.PageSize,
+		TotalPages: q.TotalPages(total),
 	}
 }
 
 // GetRecent returns the most recent N audit logs
 func (s *AuditService) GetRecent(n int) []AuditLog {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	if n > len(s.logs) {
-		n = len(s.logs)
-	}
 	if n <= 0 {
 		return []AuditLog{}
 	}
 
-	result := make([]AuditLog, n)
-	copy(result, s.logs[:n])
-	return result
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	logs, _, err := s.store.QueryAuditLogs(ctx, AuditLogQuery{ListParams: ListParams{Page: 1, PageSize: n}})
+	logStoreError("query recent audit logs", err)
+	if logs == nil {
+		logs = []AuditLog{}
+	}
+	return logs
 }
 
 // generateID generates a unique ID for audit logs
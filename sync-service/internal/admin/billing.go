@@ -1,11 +1,12 @@
 package admin
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"sync"
 	"time"
 
@@ -21,17 +22,9 @@ type BillingService struct {
 	config     models.BillingConfig
 	configPath string
 
-	// In-memory storage (for demo; production should use database)
-	subscriptions map[string]*models.Subscription
-	wallets       map[string]*models.Wallet
-	transactions  map[string][]models.WalletTransaction // walletID -> transactions
-	payments      map[string]*models.Payment
-	plans         map[string]*models.Plan
-
-	// Indices
-	subscriptionsByUser map[string][]string // userID -> []subscriptionID
-	walletsByUser       map[string][]string // userID -> []walletID
-	paymentsByUser      map[string][]string // userID -> []paymentID
+	// Subscriptions, wallets, transactions and payments are persisted in the store
+	store BillingStore
+	plans map[string]*models.Plan
 
 	// External service clients
 	lagoClient    *LagoClient
@@ -41,17 +34,11 @@ type BillingService struct {
 }
 
 // NewBillingService creates a new billing service
-func NewBillingService(configPath string) *BillingService {
+func NewBillingService(configPath string, store BillingStore) *BillingService {
 	s := &BillingService{
-		configPath:          configPath,
-		subscriptions:       make(map[string]*models.Subscription),
-		wallets:             make(map[string]*models.Wallet),
-		transactions:        make(map[string][]models.WalletTransaction),
-		payments:            make(map[string]*models.Payment),
-		plans:               make(map[string]*models.Plan),
-		subscriptionsByUser: make(map[string][]string),
-		walletsByUser:       make(map[string][]string),
-		paymentsByUser:      make(map[string][]string),
+		configPath: configPath,
+		store:      store,
+		plans:      make(map[string]*models.Plan),
 	}
 
 	// Load configuration
@@ -353,52 +340,23 @@ func (s *BillingService) ListPlans() models.PlanListResponse {
 
 // ListSubscriptions returns paginated subscriptions
 func (s *BillingService) ListSubscriptions(page, pageSize int, userID, status, planCode string) models.SubscriptionListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var filtered []*models.Subscription
-	for _, sub := range s.subscriptions {
-		if userID != "" && sub.UserID != userID {
-			continue
-		}
-		if status != "" && string(sub.Status) != status {
-			continue
-		}
-		if planCode != "" && sub.PlanCode != planCode {
-			continue
-		}
-		filtered = append(filtered, sub)
-	}
-
-	// Sort by created_at descending
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].CreatedAt.After(filtered[j].CreatedAt)
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	subs, total, err := s.store.ListSubscriptions(ctx, BillingQuery{
+		UserID:   userID,
+		Status:   status,
+		PlanCode: planCode,
+		Offset:   pageOffset(page, pageSize),
+		Limit:    pageSize,
 	})
-
-	total := len(filtered)
-
-	// Pagination
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start >= len(filtered) {
-		return models.SubscriptionListResponse{
-			Subscriptions: []models.Subscription{},
-			Total:         total,
-			Page:          page,
-			PageSize:      pageSize,
-		}
-	}
-	if end > len(filtered) {
-		end = len(filtered)
-	}
-
-	result := make([]models.Subscription, 0, end-start)
-	for i := start; i < end; i++ {
-		result = append(result, *filtered[i])
+	logStoreError("list subscriptions", err)
+	if subs == nil {
+		subs = []models.Subscription{}
 	}
 
 	return models.SubscriptionListResponse{
-		Subscriptions: result,
+		Subscriptions: subs,
 		Total:         total,
 		Page:          page,
 		PageSize:      pageSize,
@@ -407,11 +365,14 @@ func (s *BillingService) ListSubscriptions(page, pageSize int, userID, status, p
 
 // GetSubscription returns a subscription by ID
 func (s *BillingService) GetSubscription(id string) (*models.Subscription, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	sub, ok := s.subscriptions[id]
-	if !ok {
+	sub, err := s.store.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
 		return nil, fmt.Errorf("subscription not found")
 	}
 	return sub, nil
@@ -463,8 +424,11 @@ func (s *BillingService) CreateSubscription(req models.CreateSubscriptionRequest
 		sub.ExternalID = externalID
 	}
 
-	s.subscriptions[sub.ID] = sub
-	s.subscriptionsByUser[req.UserID] = append(s.subscriptionsByUser[req.UserID], sub.ID)
+	ctx, cancel := storeContext()
+	defer cancel()
+	if err := s.store.SaveSubscription(ctx, sub); err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %w", err)
+	}
 
 	return sub, nil
 }
@@ -474,8 +438,14 @@ func (s *BillingService) CancelSubscription(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	sub, ok := s.subscriptions[id]
-	if !ok {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	sub, err := s.store.GetSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
 		return fmt.Errorf("subscription not found")
 	}
 
@@ -494,7 +464,7 @@ func (s *BillingService) CancelSubscription(id string) error {
 	sub.Status = models.SubscriptionCanceled
 	sub.CanceledAt = &now
 
-	return nil
+	return s.store.SaveSubscription(ctx, sub)
 }
 
 // ReactivateSubscription reactivates a canceled subscription
@@ -502,8 +472,14 @@ func (s *BillingService) ReactivateSubscription(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	sub, ok := s.subscriptions[id]
-	if !ok {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	sub, err := s.store.GetSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
 		return fmt.Errorf("subscription not found")
 	}
 
@@ -514,56 +490,29 @@ func (s *BillingService) ReactivateSubscription(id string) error {
 	sub.Status = models.SubscriptionActive
 	sub.CanceledAt = nil
 
-	return nil
+	return s.store.SaveSubscription(ctx, sub)
 }
 
 // ===== Wallets =====
 
 // ListWallets returns paginated wallets
 func (s *BillingService) ListWallets(page, pageSize int, userID, status string) models.WalletListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var filtered []*models.Wallet
-	for _, wallet := range s.wallets {
-		if userID != "" && wallet.UserID != userID {
-			continue
-		}
-		if status != "" && string(wallet.Status) != status {
-			continue
-		}
-		filtered = append(filtered, wallet)
-	}
-
-	// Sort by created_at descending
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].CreatedAt.After(filtered[j].CreatedAt)
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	wallets, total, err := s.store.ListWallets(ctx, BillingQuery{
+		UserID: userID,
+		Status: status,
+		Offset: pageOffset(page, pageSize),
+		Limit:  pageSize,
 	})
-
-	total := len(filtered)
-
-	// Pagination
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start >= len(filtered) {
-		return models.WalletListResponse{
-			Wallets:  []models.Wallet{},
-			Total:    total,
-			Page:     page,
-			PageSize: pageSize,
-		}
-	}
-	if end > len(filtered) {
-		end = len(filtered)
-	}
-
-	result := make([]models.Wallet, 0, end-start)
-	for i := start; i < end; i++ {
-		result = append(result, *filtered[i])
+	logStoreError("list wallets", err)
+	if wallets == nil {
+		wallets = []models.Wallet{}
 	}
 
 	return models.WalletListResponse{
-		Wallets:  result,
+		Wallets:  wallets,
 		Total:    total,
 		Page:     page,
 		PageSize: pageSize,
@@ -572,11 +521,14 @@ func (s *BillingService) ListWallets(page, pageSize int, userID, status string)
 
 // GetWallet returns a wallet by ID
 func (s *BillingService) GetWallet(id string) (*models.Wallet, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	wallet, ok := s.wallets[id]
-	if !ok {
+	wallet, err := s.store.GetWallet(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil {
 		return nil, fmt.Errorf("wallet not found")
 	}
 	return wallet, nil
@@ -627,8 +579,11 @@ func (s *BillingService) CreateWallet(req models.CreateWalletRequest) (*models.W
 		wallet.LagoID = lagoID
 	}
 
-	s.wallets[wallet.ID] = wallet
-	s.walletsByUser[req.UserID] = append(s.walletsByUser[req.UserID], wallet.ID)
+	ctx, cancel := storeContext()
+	defer cancel()
+	if err := s.store.SaveWallet(ctx, wallet); err != nil {
+		return nil, fmt.Errorf("failed to save wallet: %w", err)
+	}
 
 	return wallet, nil
 }
@@ -638,92 +593,90 @@ func (s *BillingService) TopUpWallet(walletID string, req models.TopUpWalletRequ
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	wallet, ok := s.wallets[walletID]
-	if !ok {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	wallet, err := s.store.GetWallet(ctx, walletID)
+	if err != nil {
+		return err
+	}
+	if wallet == nil {
 		return fmt.Errorf("wallet not found")
 	}
 
+	return s.topUpWallet(ctx, wallet, req.PaidCredits, req.GrantedCredits)
+}
+
+// errTopUpNotRecorded a wallet was credited in Lago but its transactions could not be recorded locally
+var errTopUpNotRecorded = errors.New("wallet credited in Lago but its transactions were not recorded")
+
+// topUpWallet credits a wallet in Lago and records the transactions. Callers must hold s.mu.
+func (s *BillingService) topUpWallet(ctx context.Context, wallet *models.Wallet, paidCredits, grantedCredits string) error {
 	// If Lago is configured, top up there
+	creditedInLago := false
 	if s.lagoClient != nil && wallet.LagoID != "" {
-		if err := s.lagoClient.TopUpWallet(wallet.LagoID, req.PaidCredits, req.GrantedCredits); err != nil {
+		if err := s.lagoClient.TopUpWallet(wallet.LagoID, paidCredits, grantedCredits); err != nil {
 			return fmt.Errorf("failed to top up wallet in Lago: %w", err)
 		}
+		creditedInLago = true
 	}
 
 	// Record transaction
 	now := time.Now()
 	tx := models.WalletTransaction{
 		ID:              uuid.New().String(),
-		WalletID:        walletID,
+		WalletID:        wallet.ID,
 		UserID:          wallet.UserID,
 		Type:            models.WalletTransactionInbound,
 		TransactionType: models.WalletTransactionPaidCredits,
 		Status:          models.WalletTransactionSettled,
-		Amount:          req.PaidCredits,
-		CreditAmount:    req.PaidCredits,
+		Amount:          paidCredits,
+		CreditAmount:    paidCredits,
 		SettledAt:       &now,
 		CreatedAt:       now,
 	}
-	s.transactions[walletID] = append(s.transactions[walletID], tx)
+	txs := []models.WalletTransaction{tx}
 
-	if req.GrantedCredits != "" {
+	if grantedCredits != "" {
 		grantTx := models.WalletTransaction{
 			ID:              uuid.New().String(),
-			WalletID:        walletID,
+			WalletID:        wallet.ID,
 			UserID:          wallet.UserID,
 			Type:            models.WalletTransactionInbound,
 			TransactionType: models.WalletTransactionGranted,
 			Status:          models.WalletTransactionSettled,
-			Amount:          req.GrantedCredits,
-			CreditAmount:    req.GrantedCredits,
+			Amount:          grantedCredits,
+			CreditAmount:    grantedCredits,
 			SettledAt:       &now,
 			CreatedAt:       now,
 		}
-		s.transactions[walletID] = append(s.transactions[walletID], grantTx)
+		txs = append(txs, grantTx)
 	}
 
 	wallet.LastTransactionAt = &now
 
+	if err := s.store.AddWalletTransactions(ctx, wallet, txs...); err != nil {
+		if creditedInLago {
+			return fmt.Errorf("%w: %v", errTopUpNotRecorded, err)
+		}
+		return err
+	}
 	return nil
 }
 
 // GetWalletTransactions returns wallet transactions
 func (s *BillingService) GetWalletTransactions(walletID string, page, pageSize int) models.WalletTransactionListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	txs, ok := s.transactions[walletID]
-	if !ok {
-		return models.WalletTransactionListResponse{
-			Transactions: []models.WalletTransaction{},
-			Total:        0,
-		}
-	}
-
-	// Sort by created_at descending
-	sorted := make([]models.WalletTransaction, len(txs))
-	copy(sorted, txs)
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
-	})
-
-	total := len(sorted)
-
-	// Pagination
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start >= len(sorted) {
-		return models.WalletTransactionListResponse{
-			Transactions: []models.WalletTransaction{},
-			Total:        total,
-		}
-	}
-	if end > len(sorted) {
-		end = len(sorted)
+	txs, total, err := s.store.ListWalletTransactions(ctx, walletID, pageOffset(page, pageSize), pageSize)
+	logStoreError("list wallet transactions", err)
+	if txs == nil {
+		txs = []models.WalletTransaction{}
 	}
 
 	return models.WalletTransactionListResponse{
-		Transactions: sorted[start:end],
+		Transactions: txs,
 		Total:        total,
 	}
 }
@@ -732,58 +685,25 @@ func (s *BillingService) GetWalletTransactions(walletID string, page, pageSize i
 
 // ListPayments returns paginated payments
 func (s *BillingService) ListPayments(page, pageSize int, userID, status, method string, startTime, endTime *time.Time) models.PaymentListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var filtered []*models.Payment
-	for _, payment := range s.payments {
-		if userID != "" && payment.UserID != userID {
-			continue
-		}
-		if status != "" && string(payment.Status) != status {
-			continue
-		}
-		if method != "" && string(payment.Method) != method {
-			continue
-		}
-		if startTime != nil && payment.CreatedAt.Before(*startTime) {
-			continue
-		}
-		if endTime != nil && payment.CreatedAt.After(*endTime) {
-			continue
-		}
-		filtered = append(filtered, payment)
-	}
-
-	// Sort by created_at descending
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].CreatedAt.After(filtered[j].CreatedAt)
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	payments, total, err := s.store.ListPayments(ctx, BillingQuery{
+		UserID:    userID,
+		Status:    status,
+		Method:    method,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Offset:    pageOffset(page, pageSize),
+		Limit:     pageSize,
 	})
-
-	total := len(filtered)
-
-	// Pagination
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start >= len(filtered) {
-		return models.PaymentListResponse{
-			Payments: []models.Payment{},
-			Total:    total,
-			Page:     page,
-			PageSize: pageSize,
-		}
-	}
-	if end > len(filtered) {
-		end = len(filtered)
-	}
-
-	result := make([]models.Payment, 0, end-start)
-	for i := start; i < end; i++ {
-		result = append(result, *filtered[i])
+	logStoreError("list payments", err)
+	if payments == nil {
+		payments = []models.Payment{}
 	}
 
 	return models.PaymentListResponse{
-		Payments: result,
+		Payments: payments,
 		Total:    total,
 		Page:     page,
 		PageSize: pageSize,
@@ -792,11 +712,14 @@ func (s *BillingService) ListPayments(page, pageSize int, userID, status, method
 
 // GetPayment returns a payment by ID
 func (s *BillingService) GetPayment(id string) (*models.Payment, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	payment, ok := s.payments[id]
-	if !ok {
+	payment, err := s.store.GetPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil {
 		return nil, fmt.Errorf("payment not found")
 	}
 	return payment, nil
@@ -846,8 +769,11 @@ func (s *BillingService) CreatePayment(req models.CreatePaymentRequest) (*models
 	}
 
 	payment.PayURL = payURL
-	s.payments[payment.ID] = payment
-	s.paymentsByUser[req.UserID] = append(s.paymentsByUser[req.UserID], payment.ID)
+	ctx, cancel := storeContext()
+	defer cancel()
+	if err := s.store.SavePayment(ctx, payment); err != nil {
+		return nil, fmt.Errorf("failed to save payment: %w", err)
+	}
 
 	return payment, nil
 }
@@ -857,8 +783,14 @@ func (s *BillingService) RefundPayment(id string, req models.RefundPaymentReques
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	payment, ok := s.payments[id]
-	if !ok {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	payment, err := s.store.GetPayment(ctx, id)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
 		return fmt.Errorf("payment not found")
 	}
 
@@ -890,16 +822,22 @@ func (s *BillingService) RefundPayment(id string, req models.RefundPaymentReques
 	payment.Status = models.PaymentRefunded
 	payment.UpdatedAt = time.Now()
 
-	return nil
+	return s.store.SavePayment(ctx, payment)
 }
 
-// ConfirmPayment manually confirms a payment
+// ConfirmPayment manually confirms a payment that was settled outside the provider webhooks
 func (s *BillingService) ConfirmPayment(id string, req models.ConfirmPaymentRequest) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	payment, ok := s.payments[id]
-	if !ok {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	payment, err := s.store.GetPayment(ctx, id)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
 		return fmt.Errorf("payment not found")
 	}
 
@@ -907,12 +845,7 @@ func (s *BillingService) ConfirmPayment(id string, req models.ConfirmPaymentRequ
 		return fmt.Errorf("payment is not pending")
 	}
 
-	now := time.Now()
-	payment.Status = models.PaymentPaid
-	payment.PaidAt = &now
-	payment.UpdatedAt = now
-
-	return nil
+	return s.settlePayment(ctx, payment, time.Now())
 }
 
 // ===== User Quick Queries =====
@@ -920,20 +853,21 @@ func (s *BillingService) ConfirmPayment(id string, req models.ConfirmPaymentRequ
 // GetUserSubscriptionStatus returns user's subscription status
 func (s *BillingService) GetUserSubscriptionStatus(userID string) models.UserSubscriptionStatus {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	gracePeriod := time.Duration(s.config.GracePeriodHours) * time.Hour
+	s.mu.RUnlock()
+
+	ctx, cancel := storeContext()
+	defer cancel()
+	subs, _, err := s.store.ListSubscriptions(ctx, BillingQuery{UserID: userID})
+	logStoreError("list user subscriptions", err)
 
-	subIDs := s.subscriptionsByUser[userID]
 	var activeSub *models.Subscription
 	var inGracePeriod bool
 
 	now := time.Now()
-	gracePeriod := time.Duration(s.config.GracePeriodHours) * time.Hour
 
-	for _, subID := range subIDs {
-		sub := s.subscriptions[subID]
-		if sub == nil {
-			continue
-		}
+	for i := range subs {
+		sub := &subs[i]
 
 		if sub.Status == models.SubscriptionActive {
 			activeSub = sub
@@ -965,22 +899,19 @@ func (s *BillingService) GetUserSubscriptionStatus(userID string) models.UserSub
 
 // GetUserBalance returns user's balance summary
 func (s *BillingService) GetUserBalance(userID string) models.UserBalance {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
+	userWallets, _, err := s.store.ListWallets(ctx, BillingQuery{UserID: userID, Status: string(models.WalletActive)})
+	logStoreError("list user wallets", err)
 
-	walletIDs := s.walletsByUser[userID]
 	var totalBalance int64
 	var currency string
 	var wallets []models.Wallet
 
-	for _, walletID := range walletIDs {
-		wallet := s.wallets[walletID]
-		if wallet == nil || wallet.Status != models.WalletActive {
-			continue
-		}
+	for _, wallet := range userWallets {
 		totalBalance += wallet.BalanceCents
 		currency = wallet.Currency
-		wallets = append(wallets, *wallet)
+		wallets = append(wallets, wallet)
 	}
 
 	if currency == "" {
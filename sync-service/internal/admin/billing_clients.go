@@ -2,10 +2,21 @@ package admin
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
@@ -386,6 +397,84 @@ func (c *AlipayClient) Refund(orderNo string, amountCents int64) error {
 	return nil
 }
 
+// VerifyNotification verifies the RSA2 signature of an asynchronous payment notification
+func (c *AlipayClient) VerifyNotification(params url.Values) (*paymentNotification, error) {
+	if c.publicKey == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+	publicKey, err := parseRSAPublicKey(c.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Alipay public key: %w", err)
+	}
+	if params.Get("app_id") != c.appID {
+		return nil, ErrWebhookSignature
+	}
+
+	// Signed content: all non-empty parameters except sign and sign_type, sorted by key
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key != "sign" && key != "sign_type" && params.Get(key) != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+params.Get(key))
+	}
+	signature, err := base64.StdEncoding.DecodeString(params.Get("sign"))
+	if err != nil {
+		return nil, ErrWebhookSignature
+	}
+	digest := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrWebhookSignature
+	}
+
+	amountCents, err := parseAmountCents(params.Get("total_amount"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid total_amount: %w", err)
+	}
+	notification := &paymentNotification{
+		EventID:     webhookEventID(params.Get("notify_id")),
+		EventType:   params.Get("trade_status"),
+		OrderNo:     params.Get("out_trade_no"),
+		AmountCents: amountCents,
+	}
+	switch params.Get("trade_status") {
+	case "TRADE_SUCCESS", "TRADE_FINISHED":
+		notification.Status = models.PaymentPaid
+		// gmt_payment is reported in China Standard Time
+		if paidAt, err := time.ParseInLocation("2006-01-02 15:04:05", params.Get("gmt_payment"), time.FixedZone("CST", 8*3600)); err == nil {
+			notification.PaidAt = paidAt
+		}
+	case "TRADE_CLOSED":
+		notification.Status = models.PaymentCanceled
+	}
+	return notification, nil
+}
+
+// parseRSAPublicKey accepts a PEM block or bare base64 DER in PKIX or PKCS#1 form
+func parseRSAPublicKey(key string) (*rsa.PublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, err
+		}
+		der = decoded
+	}
+	if parsed, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if publicKey, ok := parsed.(*rsa.PublicKey); ok {
+			return publicKey, nil
+		}
+		return nil, fmt.Errorf("not an RSA public key")
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
+
 // ===== WeChat Pay Client =====
 
 // WechatClient is a client for WeChat Pay
@@ -455,3 +544,83 @@ func (c *WechatClient) Refund(orderNo string, amountCents int64) error {
 	// For demo purposes, just return success
 	return nil
 }
+
+// DecryptNotification decrypts a WeChat Pay v3 payment notification with the APIv3 key.
+// AES-GCM authenticates the resource, so only notifications encrypted for this merchant are accepted.
+func (c *WechatClient) DecryptNotification(body []byte) (*paymentNotification, error) {
+	if len(c.apiKeyV3) != 32 {
+		return nil, ErrWebhookNotConfigured
+	}
+
+	var envelope struct {
+		ID        string `json:"id"`
+		EventType string `json:"event_type"`
+		Resource  struct {
+			Algorithm      string `json:"algorithm"`
+			Ciphertext     string `json:"ciphertext"`
+			AssociatedData string `json:"associated_data"`
+			Nonce          string `json:"nonce"`
+		} `json:"resource"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid WeChat Pay notification: %w", err)
+	}
+	if envelope.Resource.Algorithm != "AEAD_AES_256_GCM" {
+		return nil, fmt.Errorf("unsupported algorithm: %s", envelope.Resource.Algorithm)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Resource.Ciphertext)
+	if err != nil {
+		return nil, ErrWebhookSignature
+	}
+	block, err := aes.NewCipher([]byte(c.apiKeyV3))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Resource.Nonce) != gcm.NonceSize() {
+		return nil, ErrWebhookSignature
+	}
+	plaintext, err := gcm.Open(nil, []byte(envelope.Resource.Nonce), ciphertext, []byte(envelope.Resource.AssociatedData))
+	if err != nil {
+		return nil, ErrWebhookSignature
+	}
+
+	var transaction struct {
+		MchID       string     `json:"mchid"`
+		OutTradeNo  string     `json:"out_trade_no"`
+		TradeState  string     `json:"trade_state"`
+		SuccessTime *time.Time `json:"success_time"`
+		Amount      struct {
+			Total int64 `json:"total"`
+		} `json:"amount"`
+	}
+	if err := json.Unmarshal(plaintext, &transaction); err != nil {
+		return nil, fmt.Errorf("invalid WeChat Pay transaction: %w", err)
+	}
+	if transaction.MchID != c.mchID {
+		return nil, ErrWebhookSignature
+	}
+
+	notification := &paymentNotification{
+		EventID:     webhookEventID(envelope.ID),
+		EventType:   envelope.EventType,
+		OrderNo:     transaction.OutTradeNo,
+		AmountCents: transaction.Amount.Total,
+	}
+	switch transaction.TradeState {
+	case "SUCCESS":
+		notification.Status = models.PaymentPaid
+		if transaction.SuccessTime != nil {
+			notification.PaidAt = *transaction.SuccessTime
+		}
+	case "CLOSED", "REVOKED":
+		notification.Status = models.PaymentCanceled
+	case "PAYERROR":
+		notification.Status = models.PaymentFailed
+	}
+	return notification, nil
+}
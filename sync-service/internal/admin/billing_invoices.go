@@ -0,0 +1,279 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aspect-code/codeswitch/pkg/invoicepdf"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+	"github.com/google/uuid"
+)
+
+// defaultInvoicePrefix is used when no invoice prefix is configured
+const defaultInvoicePrefix = "INV"
+
+// ===== Invoices =====
+
+// IssuePaymentInvoice issues the invoice of a paid payment.
+// Issuing again returns the invoice that already exists.
+func (s *BillingService) IssuePaymentInvoice(paymentID string) (*models.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	payment, err := s.store.GetPayment(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil {
+		return nil, fmt.Errorf("payment not found")
+	}
+	if payment.Status != models.PaymentPaid && payment.Status != models.PaymentRefunded {
+		return nil, fmt.Errorf("payment is not paid")
+	}
+	return s.issuePaymentInvoice(ctx, payment)
+}
+
+// issuePaymentInvoice issues the invoice of a settled payment. Callers must hold s.mu.
+func (s *BillingService) issuePaymentInvoice(ctx context.Context, payment *models.Payment) (*models.Invoice, error) {
+	description := payment.Description
+	if description == "" {
+		description = "Wallet top-up"
+		if payment.SubscriptionID != "" {
+			description = "Subscription payment"
+		}
+	}
+
+	invoice := s.newInvoice(models.InvoiceKindPayment, payment.UserID, payment.Currency, payment.AmountCents, description)
+	invoice.Username = payment.Username
+	invoice.PaymentID = payment.ID
+	invoice.SubscriptionID = payment.SubscriptionID
+	invoice.PaymentMethod = string(payment.Method)
+	invoice.Reference = payment.OrderNo
+	invoice.PaidAt = payment.PaidAt
+
+	if payment.SubscriptionID != "" {
+		sub, err := s.store.GetSubscription(ctx, payment.SubscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		if sub != nil {
+			invoice.Kind = models.InvoiceKindSubscription
+			if payment.Description == "" && sub.PlanName != "" {
+				invoice.Lines[0].Description = "Subscription: " + sub.PlanName
+			}
+		}
+	}
+
+	return s.store.CreateInvoice(ctx, invoice, "payment:"+payment.ID, s.invoiceScope(invoice.IssuedAt), renderInvoicePDF)
+}
+
+// issueLagoInvoice issues the invoice of a subscription renewal that Lago reported as paid.
+// Lago already computed the taxes, so its amounts are used as they are. Callers must hold s.mu.
+func (s *BillingService) issueLagoInvoice(ctx context.Context, lago lagoInvoice) (*models.Invoice, error) {
+	var sub *models.Subscription
+	var period *lagoSubscription
+	for i := range lago.Subscriptions {
+		found, err := s.store.GetSubscriptionByExternalID(ctx, lago.Subscriptions[i].LagoID)
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			sub, period = found, &lago.Subscriptions[i]
+			break
+		}
+	}
+	if sub == nil {
+		return nil, nil
+	}
+
+	description := "Subscription renewal"
+	if sub.PlanName != "" {
+		description = "Subscription renewal: " + sub.PlanName
+	}
+	currency := lago.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+
+	invoice := s.newInvoice(models.InvoiceKindSubscription, sub.UserID, currency, lago.TotalAmountCents, description)
+	invoice.Username = sub.Username
+	invoice.SubscriptionID = sub.ID
+	invoice.Reference = lago.Number
+	invoice.PeriodStart = period.CurrentBillingPeriodStartedAt
+	invoice.PeriodEnd = period.CurrentBillingPeriodEndingAt
+	paidAt := time.Now()
+	invoice.PaidAt = &paidAt
+
+	if lago.TaxesAmountCents > 0 && lago.TaxesAmountCents < lago.TotalAmountCents {
+		invoice.TaxCents = lago.TaxesAmountCents
+		invoice.SubtotalCents = lago.TotalAmountCents - lago.TaxesAmountCents
+		invoice.TaxRate = math.Round(float64(invoice.TaxCents)/float64(invoice.SubtotalCents)*10000) / 100
+	}
+
+	return s.store.CreateInvoice(ctx, invoice, "lago:"+lago.LagoID, s.invoiceScope(invoice.IssuedAt), renderInvoicePDF)
+}
+
+// newInvoice builds a single line invoice with the configured seller and tax rate.
+// Prices include tax, so the tax is split out of the total. Callers must hold s.mu.
+func (s *BillingService) newInvoice(kind models.InvoiceKind, userID, currency string, totalCents int64, description string) *models.Invoice {
+	taxRate := s.config.InvoiceTaxRate
+	if taxRate < 0 {
+		taxRate = 0
+	}
+	taxCents := int64(math.Round(float64(totalCents) * taxRate / (100 + taxRate)))
+
+	seller := models.InvoiceSeller{
+		Name:    s.config.InvoiceCompanyName,
+		Address: s.config.InvoiceCompanyAddress,
+		TaxID:   s.config.InvoiceTaxID,
+	}
+	if seller.Name == "" {
+		seller.Name = "CodeSwitch"
+	}
+
+	return &models.Invoice{
+		ID:       uuid.New().String(),
+		Kind:     kind,
+		UserID:   userID,
+		Seller:   seller,
+		Currency: strings.ToUpper(currency),
+		Lines: []models.InvoiceLine{{
+			Description: description,
+			Quantity:    1,
+			UnitCents:   totalCents,
+			AmountCents: totalCents,
+		}},
+		SubtotalCents: totalCents - taxCents,
+		TaxRate:       taxRate,
+		TaxCents:      taxCents,
+		TotalCents:    totalCents,
+		IssuedAt:      time.Now(),
+	}
+}
+
+// invoiceScope numbers invoices per prefix and year, e.g. INV-2026-000001
+func (s *BillingService) invoiceScope(issuedAt time.Time) string {
+	prefix := strings.TrimSpace(s.config.InvoicePrefix)
+	if prefix == "" {
+		prefix = defaultInvoicePrefix
+	}
+	return fmt.Sprintf("%s-%d", prefix, issuedAt.Year())
+}
+
+// ListInvoices returns paginated invoices
+func (s *BillingService) ListInvoices(page, pageSize int, userID string, startTime, endTime *time.Time) models.InvoiceListResponse {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	invoices, total, err := s.store.ListInvoices(ctx, BillingQuery{
+		UserID:    userID,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Offset:    pageOffset(page, pageSize),
+		Limit:     pageSize,
+	})
+	logStoreError("list invoices", err)
+	if invoices == nil {
+		invoices = []models.Invoice{}
+	}
+
+	return models.InvoiceListResponse{
+		Invoices: invoices,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}
+}
+
+// GetInvoice returns an invoice by ID
+func (s *BillingService) GetInvoice(id string) (*models.Invoice, error) {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	invoice, err := s.store.GetInvoice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if invoice == nil {
+		return nil, fmt.Errorf("invoice not found")
+	}
+	return invoice, nil
+}
+
+// GetInvoicePDF returns an invoice together with its PDF document
+func (s *BillingService) GetInvoicePDF(id string) (*models.Invoice, []byte, error) {
+	invoice, err := s.GetInvoice(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := storeContext()
+	defer cancel()
+	pdf, err := s.store.GetInvoicePDF(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pdf) == 0 {
+		// Documents are rendered at issue time; re-render if one was lost
+		if pdf, err = renderInvoicePDF(invoice); err != nil {
+			return nil, nil, err
+		}
+	}
+	return invoice, pdf, nil
+}
+
+// ===== Rendering =====
+
+var invoicePaymentMethods = map[string]string{
+	string(models.PaymentMethodAlipay): "Alipay",
+	string(models.PaymentMethodWechat): "WeChat Pay",
+	string(models.PaymentMethodStripe): "Stripe",
+	string(models.PaymentMethodManual): "Manual",
+}
+
+// renderInvoicePDF renders an invoice with the layout shared with the desktop billing service
+func renderInvoicePDF(invoice *models.Invoice) ([]byte, error) {
+	date := func(t time.Time) string { return t.Format("2006-01-02") }
+	doc := &invoicepdf.Invoice{
+		Number:        invoice.Number,
+		SellerName:    invoice.Seller.Name,
+		SellerAddress: invoice.Seller.Address,
+		SellerTaxID:   invoice.Seller.TaxID,
+		Currency:      invoice.Currency,
+		Lines:         make([]invoicepdf.Line, len(invoice.Lines)),
+		SubtotalCents: invoice.SubtotalCents,
+		TaxRate:       invoice.TaxRate,
+		TaxCents:      invoice.TaxCents,
+		TotalCents:    invoice.TotalCents,
+		PaidAt:        invoice.PaidAt,
+		IssuedAt:      invoice.IssuedAt,
+	}
+	if invoice.Username != "" {
+		doc.BillTo = append(doc.BillTo, invoice.Username)
+	}
+	doc.BillTo = append(doc.BillTo, "User ID: "+invoice.UserID)
+	if method := invoicePaymentMethods[invoice.PaymentMethod]; method != "" {
+		doc.Details = append(doc.Details, "Payment method: "+method)
+	}
+	if invoice.Reference != "" {
+		doc.Details = append(doc.Details, "Reference: "+invoice.Reference)
+	}
+	if invoice.PeriodStart != nil && invoice.PeriodEnd != nil {
+		doc.Details = append(doc.Details, "Period: "+date(*invoice.PeriodStart)+" to "+date(*invoice.PeriodEnd))
+	}
+	for i, line := range invoice.Lines {
+		doc.Lines[i] = invoicepdf.Line{
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			UnitCents:   line.UnitCents,
+			AmountCents: line.AmountCents,
+		}
+	}
+	return invoicepdf.Render(doc), nil
+}
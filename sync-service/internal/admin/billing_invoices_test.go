@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+)
+
+func TestRenderInvoicePDF(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	invoice := &models.Invoice{
+		Number:        "INV-2026-000007",
+		UserID:        "u1",
+		Username:      "alice",
+		Seller:        models.InvoiceSeller{Name: "CodeSwitch", TaxID: "91330100MA2XXXXX"},
+		Currency:      "CNY",
+		Lines:         []models.InvoiceLine{{Description: "Pro plan", Quantity: 1, UnitCents: 9900, AmountCents: 9900}},
+		TotalCents:    9900,
+		PaymentMethod: string(models.PaymentMethodManual),
+		PeriodStart:   &start,
+		PeriodEnd:     &end,
+		IssuedAt:      start,
+	}
+	data, err := renderInvoicePDF(invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"(No. INV-2026-000007)",
+		"(alice)",
+		"(User ID: u1)",
+		"(Payment method: Manual)",
+		"(Period: 2026-10-01 to 2026-11-01)",
+		"(Tax ID: 91330100MA2XXXXX)",
+		"(CNY 99.00)",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("pdf does not contain %s", want)
+		}
+	}
+}
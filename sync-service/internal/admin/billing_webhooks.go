@@ -0,0 +1,393 @@
+package admin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Webhook providers
+const (
+	WebhookProviderLago   = "lago"
+	WebhookProviderAlipay = "alipay"
+	WebhookProviderWechat = "wechat"
+)
+
+var (
+	// ErrWebhookNotConfigured the key needed to verify the webhook is not configured
+	ErrWebhookNotConfigured = errors.New("webhook verification not configured")
+	// ErrWebhookSignature the webhook signature or ciphertext did not verify
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// WebhookResult describes how a webhook was reconciled
+type WebhookResult struct {
+	Provider  string `json:"provider"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Duplicate the event was already processed and has been ignored
+	Duplicate bool `json:"duplicate"`
+	// Resource the record that was updated, e.g. "payment:<id>"; empty when nothing matched
+	Resource string `json:"resource,omitempty"`
+}
+
+// processWebhook records the event before applying it so provider retries are applied once.
+// If apply fails the record is removed so the next retry is processed again.
+func (s *BillingService) processWebhook(provider, eventID, eventType string, apply func(ctx context.Context) (string, error)) (*WebhookResult, error) {
+	result := &WebhookResult{Provider: provider, EventID: eventID, EventType: eventType}
+
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	fresh, err := s.store.RecordWebhookEvent(ctx, provider, eventID, eventType, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to record webhook event: %w", err)
+	}
+	if !fresh {
+		result.Duplicate = true
+		return result, nil
+	}
+
+	resource, err := apply(ctx)
+	if err != nil {
+		logStoreError("forget webhook event", s.store.ForgetWebhookEvent(ctx, provider, eventID))
+		return nil, err
+	}
+	result.Resource = resource
+	return result, nil
+}
+
+// ===== Lago =====
+
+type lagoWebhook struct {
+	WebhookType  string            `json:"webhook_type"`
+	ObjectType   string            `json:"object_type"`
+	Subscription *lagoSubscription `json:"subscription"`
+	Invoice      *lagoInvoice      `json:"invoice"`
+}
+
+type lagoSubscription struct {
+	LagoID                        string     `json:"lago_id"`
+	Status                        string     `json:"status"`
+	StartedAt                     *time.Time `json:"started_at"`
+	CanceledAt                    *time.Time `json:"canceled_at"`
+	TerminatedAt                  *time.Time `json:"terminated_at"`
+	CurrentBillingPeriodStartedAt *time.Time `json:"current_billing_period_started_at"`
+	CurrentBillingPeriodEndingAt  *time.Time `json:"current_billing_period_ending_at"`
+}
+
+type lagoInvoice struct {
+	LagoID           string             `json:"lago_id"`
+	Number           string             `json:"number"`
+	InvoiceType      string             `json:"invoice_type"`
+	Status           string             `json:"status"`         // draft, finalized, voided
+	PaymentStatus    string             `json:"payment_status"` // pending, succeeded, failed
+	Currency         string             `json:"currency"`
+	TotalAmountCents int64              `json:"total_amount_cents"`
+	TaxesAmountCents int64              `json:"taxes_amount_cents"`
+	Subscriptions    []lagoSubscription `json:"subscriptions"`
+}
+
+// HandleLagoWebhook verifies a Lago webhook and reconciles subscription state.
+// signature is the X-Lago-Signature header (base64 HMAC-SHA256 of the body),
+// uniqueKey the X-Lago-Unique-Key header used for deduplication.
+func (s *BillingService) HandleLagoWebhook(payload []byte, signature, uniqueKey string) (*WebhookResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret := s.config.LagoWebhookSecret
+	if secret == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, ErrWebhookSignature
+	}
+
+	var event lagoWebhook
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid Lago webhook payload: %w", err)
+	}
+	eventID := uniqueKey
+	if eventID == "" {
+		sum := sha256.Sum256(payload)
+		eventID = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	return s.processWebhook(WebhookProviderLago, eventID, event.WebhookType, func(ctx context.Context) (string, error) {
+		switch {
+		case event.Subscription != nil:
+			// subscription.started, subscription.terminated, subscription.updated ...
+			return s.reconcileLagoSubscription(ctx, *event.Subscription, "")
+		case event.Invoice != nil:
+			return s.reconcileLagoInvoice(ctx, event.WebhookType, *event.Invoice)
+		default:
+			return "", nil
+		}
+	})
+}
+
+// reconcileLagoInvoice renews subscriptions on finalized invoices and tracks their payment status
+func (s *BillingService) reconcileLagoInvoice(ctx context.Context, webhookType string, invoice lagoInvoice) (string, error) {
+	var status models.SubscriptionStatus
+	switch {
+	case webhookType == "invoice.payment_status_updated" && invoice.PaymentStatus == "succeeded":
+		status = models.SubscriptionActive
+	case webhookType == "invoice.payment_status_updated" && invoice.PaymentStatus == "failed":
+		status = models.SubscriptionPastDue
+	case invoice.Status == "finalized":
+		// Renewal: the new billing period comes with the subscription entries
+	default:
+		return "", nil
+	}
+
+	resource := ""
+	for _, ls := range invoice.Subscriptions {
+		// Invoice entries only carry the billing period; status comes from the payment result
+		ls.Status = ""
+		id, err := s.reconcileLagoSubscription(ctx, ls, status)
+		if err != nil {
+			return "", err
+		}
+		if id != "" && resource == "" {
+			resource = id
+		}
+	}
+
+	// A paid renewal gets its invoice; failing to issue it must not fail the webhook
+	if status == models.SubscriptionActive && invoice.TotalAmountCents > 0 {
+		if _, err := s.issueLagoInvoice(ctx, invoice); err != nil {
+			slog.Warn("Failed to issue subscription invoice", "lago_invoice", invoice.LagoID, "error", err)
+		}
+	}
+	return resource, nil
+}
+
+// reconcileLagoSubscription applies Lago's view of a subscription; override replaces the reported status when set
+func (s *BillingService) reconcileLagoSubscription(ctx context.Context, ls lagoSubscription, override models.SubscriptionStatus) (string, error) {
+	if ls.LagoID == "" {
+		return "", nil
+	}
+	sub, err := s.store.GetSubscriptionByExternalID(ctx, ls.LagoID)
+	if err != nil {
+		return "", err
+	}
+	if sub == nil {
+		slog.Warn("Lago webhook for unknown subscription", "lago_id", ls.LagoID)
+		return "", nil
+	}
+
+	status := override
+	if status == "" {
+		status = lagoSubscriptionStatus(ls.Status)
+	}
+	if status != "" {
+		sub.Status = status
+	}
+	if ls.CurrentBillingPeriodEndingAt != nil {
+		sub.EndingAt = ls.CurrentBillingPeriodEndingAt
+	}
+	switch sub.Status {
+	case models.SubscriptionActive:
+		sub.CanceledAt = nil
+	case models.SubscriptionCanceled, models.SubscriptionTerminated:
+		if ls.TerminatedAt != nil {
+			sub.EndingAt = ls.TerminatedAt
+		}
+		if sub.CanceledAt == nil {
+			canceledAt := time.Now()
+			if ls.CanceledAt != nil {
+				canceledAt = *ls.CanceledAt
+			} else if ls.TerminatedAt != nil {
+				canceledAt = *ls.TerminatedAt
+			}
+			sub.CanceledAt = &canceledAt
+		}
+	}
+
+	if err := s.store.SaveSubscription(ctx, sub); err != nil {
+		return "", err
+	}
+	return "subscription:" + sub.ID, nil
+}
+
+func lagoSubscriptionStatus(status string) models.SubscriptionStatus {
+	switch status {
+	case "active":
+		return models.SubscriptionActive
+	case "pending":
+		return models.SubscriptionPending
+	case "canceled":
+		return models.SubscriptionCanceled
+	case "terminated":
+		return models.SubscriptionTerminated
+	default:
+		return ""
+	}
+}
+
+// ===== Payment providers =====
+
+// paymentNotification a verified payment result reported by a provider
+type paymentNotification struct {
+	EventID     string
+	EventType   string
+	OrderNo     string
+	Status      models.PaymentStatus // paid, failed or canceled; empty when still in progress
+	AmountCents int64
+	PaidAt      time.Time
+}
+
+// HandlePaymentNotification verifies an asynchronous payment notification and settles the order
+func (s *BillingService) HandlePaymentNotification(method models.PaymentMethod, body []byte) (*WebhookResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notification *paymentNotification
+	var err error
+	switch method {
+	case models.PaymentMethodAlipay:
+		if s.alipayClient == nil {
+			return nil, ErrWebhookNotConfigured
+		}
+		params, parseErr := url.ParseQuery(string(body))
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid Alipay notification: %w", parseErr)
+		}
+		notification, err = s.alipayClient.VerifyNotification(params)
+	case models.PaymentMethodWechat:
+		if s.wechatClient == nil {
+			return nil, ErrWebhookNotConfigured
+		}
+		notification, err = s.wechatClient.DecryptNotification(body)
+	default:
+		return nil, fmt.Errorf("unsupported payment method: %s", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.processWebhook(string(method), notification.EventID, notification.EventType, func(ctx context.Context) (string, error) {
+		payment, err := s.store.GetPaymentByOrderNo(ctx, notification.OrderNo)
+		if err != nil {
+			return "", err
+		}
+		if payment == nil {
+			return "", fmt.Errorf("payment not found for order %s", notification.OrderNo)
+		}
+		resource := "payment:" + payment.ID
+		if payment.Status != models.PaymentPending || notification.Status == "" {
+			return resource, nil
+		}
+
+		if notification.Status != models.PaymentPaid {
+			payment.Status = notification.Status
+			payment.UpdatedAt = time.Now()
+			return resource, s.store.SavePayment(ctx, payment)
+		}
+		if notification.AmountCents != payment.AmountCents {
+			return "", fmt.Errorf("amount mismatch for order %s: paid %d, expected %d",
+				payment.OrderNo, notification.AmountCents, payment.AmountCents)
+		}
+		return resource, s.settlePayment(ctx, payment, notification.PaidAt)
+	})
+}
+
+// settlePayment marks a pending payment as paid, credits its wallet, activates its subscription and issues its invoice.
+// The payment is recorded as paid before the wallet is credited, so a retried notification never credits it twice.
+// Callers must hold s.mu.
+func (s *BillingService) settlePayment(ctx context.Context, payment *models.Payment, paidAt time.Time) error {
+	if paidAt.IsZero() {
+		paidAt = time.Now()
+	}
+
+	if payment.SubscriptionID != "" {
+		sub, err := s.store.GetSubscription(ctx, payment.SubscriptionID)
+		if err != nil {
+			return err
+		}
+		if sub != nil && (sub.Status == models.SubscriptionPending || sub.Status == models.SubscriptionPastDue) {
+			sub.Status = models.SubscriptionActive
+			if err := s.store.SaveSubscription(ctx, sub); err != nil {
+				return err
+			}
+		}
+	}
+
+	var wallet *models.Wallet
+	if payment.WalletID != "" {
+		var err error
+		if wallet, err = s.store.GetWallet(ctx, payment.WalletID); err != nil {
+			return err
+		}
+	}
+
+	payment.Status = models.PaymentPaid
+	payment.PaidAt = &paidAt
+	payment.UpdatedAt = time.Now()
+	if err := s.store.SavePayment(ctx, payment); err != nil {
+		return err
+	}
+
+	if wallet != nil {
+		if err := s.topUpWallet(ctx, wallet, paymentCredits(payment.AmountCents, wallet.RateAmount), ""); err != nil {
+			if errors.Is(err, errTopUpNotRecorded) {
+				// Lago already holds the credits; reopening the payment would let a retry credit them again
+				slog.Error("Wallet credited without a local transaction", "payment_id", payment.ID, "error", err)
+			} else {
+				// Nothing was credited, so reopen the payment for the provider's retry
+				payment.Status = models.PaymentPending
+				payment.PaidAt = nil
+				payment.UpdatedAt = time.Now()
+				logStoreError("reopen payment", s.store.SavePayment(ctx, payment))
+				return err
+			}
+		}
+	}
+
+	// The payment is settled even if its invoice fails; it can be issued again from the admin API
+	if _, err := s.issuePaymentInvoice(ctx, payment); err != nil {
+		slog.Warn("Failed to issue payment invoice", "payment_id", payment.ID, "error", err)
+	}
+	return nil
+}
+
+// paymentCredits converts a paid amount into wallet credits at the wallet's rate
+func paymentCredits(amountCents int64, rateAmount string) string {
+	rate, err := strconv.ParseFloat(rateAmount, 64)
+	if err != nil || rate <= 0 {
+		rate = 1
+	}
+	return strconv.FormatFloat(float64(amountCents)/100/rate, 'f', 2, 64)
+}
+
+// parseAmountCents parses a decimal currency amount such as "29.90"
+func parseAmountCents(amount string) (int64, error) {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(value * 100)), nil
+}
+
+// webhookEventID falls back to a random ID when a provider omits one; such events are not deduplicated
+func webhookEventID(id string) string {
+	if id != "" {
+		return id
+	}
+	return uuid.New().String()
+}
@@ -0,0 +1,544 @@
+package admin
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+)
+
+const (
+	testLagoSecret  = "lago-webhook-secret"
+	testAlipayAppID = "2021000000000001"
+	testWechatMchID = "1900000001"
+	testWechatKeyV3 = "0123456789abcdef0123456789abcdef"
+)
+
+// newTestBillingService creates a billing service on a temporary SQLite store with no providers configured
+func newTestBillingService(t *testing.T) (*BillingService, *SQLStore) {
+	t.Helper()
+	dir := t.TempDir()
+	store := openTestStore(t, filepath.Join(dir, "billing.db"))
+	return NewBillingService(filepath.Join(dir, "billing-config.json"), store), store
+}
+
+func signLago(payload string) string {
+	mac := hmac.New(sha256.New, []byte(testLagoSecret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signAlipay signs the non-empty params the way Alipay does and returns the form-encoded notification body
+func signAlipay(t *testing.T, key *rsa.PrivateKey, params url.Values) []byte {
+	t.Helper()
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if params.Get(k) != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+params.Get(k))
+	}
+	digest := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := url.Values{"sign": {base64.StdEncoding.EncodeToString(signature)}, "sign_type": {"RSA2"}}
+	for k := range params {
+		signed[k] = params[k]
+	}
+	return []byte(signed.Encode())
+}
+
+// encryptWechat wraps a transaction in a WeChat Pay v3 notification envelope
+func encryptWechat(t *testing.T, key, eventID string, transaction map[string]interface{}) []byte {
+	t.Helper()
+	plaintext, err := json.Marshal(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := "0123456789ab"
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         eventID,
+		"event_type": "TRANSACTION.SUCCESS",
+		"resource": map[string]string{
+			"algorithm":       "AEAD_AES_256_GCM",
+			"ciphertext":      base64.StdEncoding.EncodeToString(gcm.Seal(nil, []byte(nonce), plaintext, []byte("transaction"))),
+			"associated_data": "transaction",
+			"nonce":           nonce,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func seedPayment(t *testing.T, store *SQLStore, payment models.Payment) *models.Payment {
+	t.Helper()
+	payment.Currency = "CNY"
+	payment.Status = models.PaymentPending
+	payment.CreatedAt = time.Now()
+	payment.UpdatedAt = payment.CreatedAt
+	if err := store.SavePayment(context.Background(), &payment); err != nil {
+		t.Fatal(err)
+	}
+	return &payment
+}
+
+func getPayment(t *testing.T, store *SQLStore, id string) *models.Payment {
+	t.Helper()
+	payment, err := store.GetPayment(context.Background(), id)
+	if err != nil || payment == nil {
+		t.Fatalf("payment %s = %v, %v", id, payment, err)
+	}
+	return payment
+}
+
+func getSubscription(t *testing.T, store *SQLStore, id string) *models.Subscription {
+	t.Helper()
+	sub, err := store.GetSubscription(context.Background(), id)
+	if err != nil || sub == nil {
+		t.Fatalf("subscription %s = %v, %v", id, sub, err)
+	}
+	return sub
+}
+
+func TestLagoWebhookVerification(t *testing.T) {
+	s, _ := newTestBillingService(t)
+	payload := `{"webhook_type":"subscription.started","subscription":{"lago_id":"ls1","status":"active"}}`
+
+	if _, err := s.HandleLagoWebhook([]byte(payload), signLago(payload), "k1"); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Fatalf("without secret err = %v", err)
+	}
+
+	s.config.LagoWebhookSecret = testLagoSecret
+	for name, signature := range map[string]string{
+		"missing":      "",
+		"not base64":   "!!!",
+		"wrong secret": base64.StdEncoding.EncodeToString([]byte("forged")),
+		"other body":   signLago(payload + " "),
+	} {
+		if _, err := s.HandleLagoWebhook([]byte(payload), signature, "k1"); !errors.Is(err, ErrWebhookSignature) {
+			t.Errorf("%s signature err = %v", name, err)
+		}
+	}
+
+	// Events for unknown subscriptions are accepted so Lago does not retry them
+	result, err := s.HandleLagoWebhook([]byte(payload), signLago(payload), "")
+	if err != nil || result.Duplicate || result.Resource != "" || result.EventType != "subscription.started" || result.EventID == "" {
+		t.Fatalf("result = %+v, %v", result, err)
+	}
+	// Without a unique key the payload hash identifies the event
+	result, err = s.HandleLagoWebhook([]byte(payload), signLago(payload), "")
+	if err != nil || !result.Duplicate {
+		t.Fatalf("redelivery = %+v, %v", result, err)
+	}
+}
+
+func TestLagoSubscriptionWebhooks(t *testing.T) {
+	s, store := newTestBillingService(t)
+	s.config.LagoWebhookSecret = testLagoSecret
+	sub := &models.Subscription{
+		ID: "sub1", ExternalID: "ls1", UserID: "u1", PlanCode: "pro", PlanName: "Pro",
+		Status: models.SubscriptionPending, StartedAt: time.Now(), CreatedAt: time.Now(),
+	}
+	if err := store.SaveSubscription(context.Background(), sub); err != nil {
+		t.Fatal(err)
+	}
+	deliver := func(key, payload string) *WebhookResult {
+		t.Helper()
+		result, err := s.HandleLagoWebhook([]byte(payload), signLago(payload), key)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		return result
+	}
+
+	result := deliver("started", `{"webhook_type":"subscription.started","subscription":{"lago_id":"ls1","status":"active",
+		"current_billing_period_ending_at":"2026-11-01T00:00:00Z"}}`)
+	got := getSubscription(t, store, "sub1")
+	if result.Resource != "subscription:sub1" || got.Status != models.SubscriptionActive ||
+		got.EndingAt == nil || !got.EndingAt.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("started: result = %+v, subscription = %+v", result, got)
+	}
+
+	// A failed renewal payment marks the subscription past due, a later success reactivates it
+	failed := `{"webhook_type":"invoice.payment_status_updated","invoice":{"lago_id":"li1","status":"finalized",
+		"payment_status":"failed","total_amount_cents":9900,"subscriptions":[{"lago_id":"ls1","status":"terminated",
+		"current_billing_period_ending_at":"2026-12-01T00:00:00Z"}]}}`
+	deliver("failed", failed)
+	got = getSubscription(t, store, "sub1")
+	if got.Status != models.SubscriptionPastDue || !got.EndingAt.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("payment failed: subscription = %+v", got)
+	}
+	if n := s.ListInvoices(1, 10, "", nil, nil).Total; n != 0 {
+		t.Fatalf("invoices after failed payment = %d", n)
+	}
+
+	deliver("succeeded", strings.Replace(failed, `"payment_status":"failed"`, `"payment_status":"succeeded"`, 1))
+	if got = getSubscription(t, store, "sub1"); got.Status != models.SubscriptionActive {
+		t.Fatalf("payment succeeded: subscription = %+v", got)
+	}
+	invoices := s.ListInvoices(1, 10, "", nil, nil)
+	if invoices.Total != 1 || invoices.Invoices[0].SubscriptionID != "sub1" || invoices.Invoices[0].TotalCents != 9900 {
+		t.Fatalf("invoices = %+v", invoices)
+	}
+
+	// Redelivery with the same unique key is ignored
+	terminated := `{"webhook_type":"subscription.terminated","subscription":{"lago_id":"ls1","status":"terminated",
+		"terminated_at":"2026-11-15T08:00:00Z"}}`
+	if result := deliver("succeeded", terminated); !result.Duplicate {
+		t.Fatalf("duplicate key result = %+v", result)
+	}
+	if got = getSubscription(t, store, "sub1"); got.Status != models.SubscriptionActive {
+		t.Fatalf("duplicate applied: subscription = %+v", got)
+	}
+
+	deliver("terminated", terminated)
+	got = getSubscription(t, store, "sub1")
+	terminatedAt := time.Date(2026, 11, 15, 8, 0, 0, 0, time.UTC)
+	if got.Status != models.SubscriptionTerminated || got.CanceledAt == nil || !got.CanceledAt.Equal(terminatedAt) ||
+		!got.EndingAt.Equal(terminatedAt) {
+		t.Fatalf("terminated: subscription = %+v", got)
+	}
+}
+
+func TestAlipayNotification(t *testing.T) {
+	s, store := newTestBillingService(t)
+	if _, err := s.HandlePaymentNotification(models.PaymentMethodAlipay, nil); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Fatalf("unconfigured err = %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Alipay console hands out the public key as bare base64
+	s.alipayClient = NewAlipayClient(testAlipayAppID, "", base64.StdEncoding.EncodeToString(der), true, "", "")
+
+	wallet := &models.Wallet{ID: "w1", UserID: "u1", Name: "Default Wallet", Status: models.WalletActive, Currency: "CNY", RateAmount: "0.5", CreatedAt: time.Now()}
+	if err := store.SaveWallet(context.Background(), wallet); err != nil {
+		t.Fatal(err)
+	}
+	sub := &models.Subscription{ID: "sub1", UserID: "u1", PlanCode: "pro", Status: models.SubscriptionPending, StartedAt: time.Now(), CreatedAt: time.Now()}
+	if err := store.SaveSubscription(context.Background(), sub); err != nil {
+		t.Fatal(err)
+	}
+	payment := seedPayment(t, store, models.Payment{
+		ID: "p1", OrderNo: "PAY1", UserID: "u1", AmountCents: 2990, Method: models.PaymentMethodAlipay,
+		WalletID: "w1", SubscriptionID: "sub1",
+	})
+
+	params := url.Values{
+		"app_id":       {testAlipayAppID},
+		"notify_id":    {"n1"},
+		"out_trade_no": {"PAY1"},
+		"trade_status": {"TRADE_SUCCESS"},
+		"total_amount": {"1.00"},
+		"gmt_payment":  {"2026-10-18 12:30:00"},
+	}
+	notify := func(params url.Values) (*WebhookResult, error) {
+		return s.HandlePaymentNotification(models.PaymentMethodAlipay, signAlipay(t, key, params))
+	}
+
+	// An amount mismatch fails and is not recorded, so the retry with the right amount is applied
+	if _, err := notify(params); err == nil || !strings.Contains(err.Error(), "amount mismatch") {
+		t.Fatalf("mismatch err = %v", err)
+	}
+	if got := getPayment(t, store, "p1"); got.Status != models.PaymentPending {
+		t.Fatalf("payment after mismatch = %+v", got)
+	}
+
+	params.Set("total_amount", "29.90")
+	result, err := notify(params)
+	if err != nil || result.Duplicate || result.Resource != "payment:p1" || result.EventID != "n1" || result.EventType != "TRADE_SUCCESS" {
+		t.Fatalf("result = %+v, %v", result, err)
+	}
+	got := getPayment(t, store, "p1")
+	paidAt := time.Date(2026, 10, 18, 4, 30, 0, 0, time.UTC)
+	if got.Status != models.PaymentPaid || got.PaidAt == nil || !got.PaidAt.Equal(paidAt) {
+		t.Fatalf("payment = %+v", got)
+	}
+	if sub := getSubscription(t, store, "sub1"); sub.Status != models.SubscriptionActive {
+		t.Fatalf("subscription = %+v", sub)
+	}
+	txs := s.GetWalletTransactions("w1", 1, 10).Transactions
+	if len(txs) != 1 || txs[0].Amount != "59.80" {
+		t.Fatalf("wallet transactions = %+v", txs)
+	}
+	invoices := s.ListInvoices(1, 10, "u1", nil, nil)
+	if invoices.Total != 1 || invoices.Invoices[0].PaymentID != payment.ID || invoices.Invoices[0].TotalCents != 2990 {
+		t.Fatalf("invoices = %+v", invoices)
+	}
+
+	// Alipay retries until it gets "success"; the retry must not credit the wallet twice
+	if result, err := notify(params); err != nil || !result.Duplicate {
+		t.Fatalf("retry = %+v, %v", result, err)
+	}
+	if txs := s.GetWalletTransactions("w1", 1, 10).Transactions; len(txs) != 1 {
+		t.Fatalf("wallet transactions after retry = %+v", txs)
+	}
+
+	closed := seedPayment(t, store, models.Payment{ID: "p2", OrderNo: "PAY2", UserID: "u1", AmountCents: 100, Method: models.PaymentMethodAlipay})
+	if _, err := notify(url.Values{
+		"app_id": {testAlipayAppID}, "notify_id": {"n2"}, "out_trade_no": {"PAY2"},
+		"trade_status": {"TRADE_CLOSED"}, "total_amount": {"1.00"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getPayment(t, store, closed.ID); got.Status != models.PaymentCanceled || got.PaidAt != nil {
+		t.Fatalf("closed payment = %+v", got)
+	}
+
+	if _, err := notify(url.Values{
+		"app_id": {testAlipayAppID}, "notify_id": {"n3"}, "out_trade_no": {"PAY404"},
+		"trade_status": {"TRADE_SUCCESS"}, "total_amount": {"1.00"},
+	}); err == nil || !strings.Contains(err.Error(), "payment not found") {
+		t.Fatalf("unknown order err = %v", err)
+	}
+}
+
+func TestAlipayNotificationSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PEM encoded PKCS#1 keys are accepted as well
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}))
+	client := NewAlipayClient(testAlipayAppID, "", publicKey, true, "", "")
+	params := url.Values{
+		"app_id": {testAlipayAppID}, "notify_id": {"n1"}, "out_trade_no": {"PAY1"},
+		"trade_status": {"WAIT_BUYER_PAY"}, "total_amount": {"29.90"}, "buyer_logon_id": {""},
+	}
+	verify := func(body []byte) (*paymentNotification, error) {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client.VerifyNotification(values)
+	}
+
+	// Empty parameters are not part of the signed content
+	notification, err := verify(signAlipay(t, key, params))
+	if err != nil || notification.Status != "" || notification.OrderNo != "PAY1" || notification.AmountCents != 2990 {
+		t.Fatalf("notification = %+v, %v", notification, err)
+	}
+
+	if _, err := verify(signAlipay(t, other, params)); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("foreign key err = %v", err)
+	}
+	tampered, _ := url.ParseQuery(string(signAlipay(t, key, params)))
+	tampered.Set("total_amount", "0.01")
+	if _, err := client.VerifyNotification(tampered); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("tampered err = %v", err)
+	}
+	otherApp := url.Values{}
+	for k, v := range params {
+		otherApp[k] = v
+	}
+	otherApp.Set("app_id", "2021000000000002")
+	if _, err := verify(signAlipay(t, key, otherApp)); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("other app err = %v", err)
+	}
+
+	client = NewAlipayClient(testAlipayAppID, "", "", true, "", "")
+	if _, err := verify(signAlipay(t, key, params)); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Errorf("without public key err = %v", err)
+	}
+}
+
+func TestWechatNotification(t *testing.T) {
+	s, store := newTestBillingService(t)
+	if _, err := s.HandlePaymentNotification(models.PaymentMethodWechat, nil); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Fatalf("unconfigured err = %v", err)
+	}
+	s.wechatClient = NewWechatClient("wx1", testWechatMchID, "", testWechatKeyV3, "", "", "")
+
+	paid := seedPayment(t, store, models.Payment{ID: "p1", OrderNo: "PAY1", UserID: "u1", AmountCents: 9900, Method: models.PaymentMethodWechat})
+	failed := seedPayment(t, store, models.Payment{ID: "p2", OrderNo: "PAY2", UserID: "u1", AmountCents: 9900, Method: models.PaymentMethodWechat})
+	transaction := func(orderNo, state string) map[string]interface{} {
+		return map[string]interface{}{
+			"mchid": testWechatMchID, "out_trade_no": orderNo, "trade_state": state,
+			"success_time": "2026-10-18T12:30:00+08:00", "amount": map[string]int64{"total": 9900},
+		}
+	}
+	notify := func(body []byte) (*WebhookResult, error) {
+		return s.HandlePaymentNotification(models.PaymentMethodWechat, body)
+	}
+
+	result, err := notify(encryptWechat(t, testWechatKeyV3, "e1", transaction("PAY1", "SUCCESS")))
+	if err != nil || result.Resource != "payment:p1" || result.EventType != "TRANSACTION.SUCCESS" {
+		t.Fatalf("result = %+v, %v", result, err)
+	}
+	got := getPayment(t, store, paid.ID)
+	if got.Status != models.PaymentPaid || got.PaidAt == nil || !got.PaidAt.Equal(time.Date(2026, 10, 18, 4, 30, 0, 0, time.UTC)) {
+		t.Fatalf("paid payment = %+v", got)
+	}
+
+	if _, err := notify(encryptWechat(t, testWechatKeyV3, "e2", transaction("PAY2", "PAYERROR"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := getPayment(t, store, failed.ID); got.Status != models.PaymentFailed {
+		t.Fatalf("failed payment = %+v", got)
+	}
+	// A late success does not revive a payment that already left pending
+	if _, err := notify(encryptWechat(t, testWechatKeyV3, "e3", transaction("PAY2", "SUCCESS"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := getPayment(t, store, failed.ID); got.Status != models.PaymentFailed {
+		t.Fatalf("failed payment after late success = %+v", got)
+	}
+
+	other := transaction("PAY1", "SUCCESS")
+	other["mchid"] = "1900000002"
+	wrongKey := strings.Repeat("k", 32)
+	for name, body := range map[string][]byte{
+		"other merchant": encryptWechat(t, testWechatKeyV3, "e4", other),
+		"wrong key":      encryptWechat(t, wrongKey, "e5", transaction("PAY1", "SUCCESS")),
+		"tampered":       []byte(strings.Replace(string(encryptWechat(t, testWechatKeyV3, "e6", transaction("PAY1", "SUCCESS"))), `"nonce":"0123456789ab"`, `"nonce":"ba9876543210"`, 1)),
+	} {
+		if _, err := notify(body); !errors.Is(err, ErrWebhookSignature) {
+			t.Errorf("%s err = %v", name, err)
+		}
+	}
+
+	s.wechatClient = NewWechatClient("wx1", testWechatMchID, "", "short", "", "", "")
+	if _, err := notify(encryptWechat(t, testWechatKeyV3, "e7", transaction("PAY1", "SUCCESS"))); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Fatalf("short APIv3 key err = %v", err)
+	}
+}
+
+func TestSettlePaymentFailures(t *testing.T) {
+	var topUps atomic.Int32
+	lago := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first top-up fails in Lago, later ones succeed
+		if topUps.Add(1) == 1 {
+			http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer lago.Close()
+
+	s, store := newTestBillingService(t)
+	s.lagoClient = NewLagoClient(lago.URL, "key")
+	wallet := &models.Wallet{ID: "w1", LagoID: "lw1", UserID: "u1", Status: models.WalletActive, Currency: "CNY", RateAmount: "1", CreatedAt: time.Now()}
+	if err := store.SaveWallet(context.Background(), wallet); err != nil {
+		t.Fatal(err)
+	}
+	seedPayment(t, store, models.Payment{ID: "p1", OrderNo: "PAY1", UserID: "u1", AmountCents: 2990, Method: models.PaymentMethodAlipay, WalletID: "w1"})
+
+	// A payment that cannot be recorded as paid is not credited
+	ctx := context.Background()
+	if _, err := store.db.ExecContext(ctx, `CREATE TRIGGER reject_payment BEFORE UPDATE ON billing_payments
+		BEGIN SELECT RAISE(FAIL, 'payments are read-only'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ConfirmPayment("p1", models.ConfirmPaymentRequest{}); err == nil {
+		t.Fatal("expected save error")
+	}
+	if n := topUps.Load(); n != 0 {
+		t.Fatalf("Lago top-ups after failed save = %d", n)
+	}
+	if _, err := store.db.ExecContext(ctx, "DROP TRIGGER reject_payment"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed top-up reopens the payment so the retry can settle it
+	if err := s.ConfirmPayment("p1", models.ConfirmPaymentRequest{}); err == nil {
+		t.Fatal("expected top-up error")
+	}
+	if got := getPayment(t, store, "p1"); got.Status != models.PaymentPending || got.PaidAt != nil {
+		t.Fatalf("payment after failed top-up = %+v", got)
+	}
+	if txs := s.GetWalletTransactions("w1", 1, 10).Transactions; len(txs) != 0 {
+		t.Fatalf("wallet transactions after failed top-up = %+v", txs)
+	}
+
+	if err := s.ConfirmPayment("p1", models.ConfirmPaymentRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getPayment(t, store, "p1"); got.Status != models.PaymentPaid {
+		t.Fatalf("payment = %+v", got)
+	}
+	if err := s.ConfirmPayment("p1", models.ConfirmPaymentRequest{}); err == nil {
+		t.Fatal("expected settled payment to be rejected")
+	}
+	if n := topUps.Load(); n != 2 {
+		t.Fatalf("Lago top-ups = %d, want 2", n)
+	}
+	if txs := s.GetWalletTransactions("w1", 1, 10).Transactions; len(txs) != 1 || txs[0].Amount != "29.90" {
+		t.Fatalf("wallet transactions = %+v", txs)
+	}
+}
+
+func TestPaymentAmounts(t *testing.T) {
+	credits := []struct {
+		cents int64
+		rate  string
+		want  string
+	}{
+		{2990, "1.0", "29.90"},
+		{2990, "0.5", "59.80"},
+		{1000, "3", "3.33"},
+		{1000, "", "10.00"},
+		{1000, "0", "10.00"},
+		{1000, "abc", "10.00"},
+	}
+	for _, tc := range credits {
+		if got := paymentCredits(tc.cents, tc.rate); got != tc.want {
+			t.Errorf("paymentCredits(%d, %q) = %s, want %s", tc.cents, tc.rate, got, tc.want)
+		}
+	}
+
+	amounts := map[string]int64{"29.90": 2990, "0.01": 1, "100": 10000, "19.999": 2000, "0.29": 29}
+	for amount, want := range amounts {
+		if got, err := parseAmountCents(amount); err != nil || got != want {
+			t.Errorf("parseAmountCents(%q) = %d, %v, want %d", amount, got, err, want)
+		}
+	}
+	if _, err := parseAmountCents(""); err == nil {
+		t.Error("expected error for empty amount")
+	}
+}
@@ -161,6 +161,8 @@ func (m *MetricsExporter) Export() string {
 		sb.WriteString("# HELP codeswitch_sync_requests_peak Peak concurrent requests\n")
 		sb.WriteString("# TYPE codeswitch_sync_requests_peak gauge\n")
 		sb.WriteString(fmt.Sprintf("codeswitch_sync_requests_peak %d\n", status.Requests.Peak))
+
+		m.monitorService.writeTrafficMetrics(&sb)
 	}
 
 	return sb.String()
@@ -23,6 +23,9 @@ type MonitorService struct {
 
 	// 健康检查
 	healthChecks map[string]*HealthCheck
+
+	// 流量指标（NATS 消息、认证失败、API 延迟、在线设备）
+	traffic trafficStats
 }
 
 // HealthCheck 健康检查结果
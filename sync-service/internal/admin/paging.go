@@ -0,0 +1,101 @@
+package admin
+
+import "sort"
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ListParams 列表接口统一的分页与排序参数
+type ListParams struct {
+	Page     int
+	PageSize int
+	Sort     string // 排序字段，空值使用各列表的默认排序
+	Desc     bool
+}
+
+// Normalize 修正越界的页码与每页条数
+func (p ListParams) Normalize() ListParams {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 || p.PageSize > MaxPageSize {
+		p.PageSize = DefaultPageSize
+	}
+	return p
+}
+
+// Offset 当前页的偏移量
+func (p ListParams) Offset() int {
+	return pageOffset(p.Page, p.PageSize)
+}
+
+// TotalPages 按每页条数计算总页数
+func (p ListParams) TotalPages(total int) int {
+	if p.PageSize <= 0 {
+		return 0
+	}
+	return (total + p.PageSize - 1) / p.PageSize
+}
+
+// SortFields 列表支持的排序字段：参数名 -> 列名
+type SortFields map[string]string
+
+// Allows 检查排序字段是否受支持，空值表示默认排序
+func (f SortFields) Allows(field string) bool {
+	_, ok := f[field]
+	return field == "" || ok
+}
+
+// Names 排序字段名（按字母序），用于错误提示
+func (f SortFields) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// orderBy 生成 ORDER BY 子句，未指定或未知字段时使用 fallback；tiebreak 保证分页稳定
+func (f SortFields) orderBy(p ListParams, fallback, tiebreak string) string {
+	column, ok := f[p.Sort]
+	if !ok {
+		return fallback
+	}
+	if p.Desc {
+		return column + " DESC, " + tiebreak
+	}
+	return column + " ASC, " + tiebreak
+}
+
+// 各列表的排序字段
+var (
+	UserSortFields = SortFields{
+		"created_at":     "u.created_at",
+		"last_active_at": "u.last_active_at",
+		"last_login_at":  "u.last_login_at",
+		"username":       "u.username",
+		"message_count":  "u.message_count",
+		"total_tokens":   "u.total_tokens",
+		"total_cost":     "u.total_cost",
+	}
+	SessionSortFields = SortFields{
+		"created_at":    "created_at",
+		"updated_at":    "updated_at",
+		"message_count": "message_count",
+		"token_count":   "token_count",
+		"cost":          "cost",
+	}
+	AuditLogSortFields = SortFields{
+		"created_at": "created_at",
+		"action":     "action",
+		"user_id":    "user_id",
+	}
+	AlertHistorySortFields = SortFields{
+		"triggered_at": "triggered_at",
+		"severity":     "severity",
+		"status":       "status",
+	}
+)
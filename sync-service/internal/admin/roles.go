@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Role 管理后台角色，权限依次递增：viewer 只读，operator 可执行日常运维操作，admin 可管理角色与配置
+type Role string
+
+const (
+	RoleNone     Role = ""
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("user not found")
+
+// ParseRole 解析角色名，空字符串表示取消后台权限
+func ParseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case RoleNone, RoleViewer, RoleOperator, RoleAdmin:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown role %q", name)
+	}
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Satisfies 检查角色是否具备 required 要求的权限
+func (r Role) Satisfies(required Role) bool {
+	return r.rank() > 0 && r.rank() >= required.rank()
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRoleSatisfies(t *testing.T) {
+	roles := []Role{RoleNone, RoleViewer, RoleOperator, RoleAdmin}
+	for i, role := range roles {
+		for j, required := range roles {
+			// 没有角色时任何权限都不满足，包括 RoleNone
+			want := i > 0 && i >= j
+			if got := role.Satisfies(required); got != want {
+				t.Errorf("%q.Satisfies(%q) = %v, want %v", role, required, got, want)
+			}
+		}
+	}
+	if Role("root").Satisfies(RoleViewer) {
+		t.Error("unknown role satisfied viewer")
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, name := range []string{"", "viewer", "operator", "admin"} {
+		if role, err := ParseRole(name); err != nil || string(role) != name {
+			t.Errorf("ParseRole(%q) = %q, %v", name, role, err)
+		}
+	}
+	for _, name := range []string{"Admin", "root", " viewer"} {
+		if _, err := ParseRole(name); err == nil {
+			t.Errorf("ParseRole(%q) succeeded", name)
+		}
+	}
+}
+
+func TestUserManagerRoles(t *testing.T) {
+	users := NewUserManager(openTestStore(t, filepath.Join(t.TempDir(), "admin.db")))
+	users.RegisterUser("u1", "u1", "", false)
+	users.RegisterUser("legacy", "legacy", "", true)
+
+	if role := users.RoleOf("legacy"); role != RoleAdmin {
+		t.Fatalf("legacy admin role = %q", role)
+	}
+	if role := users.RoleOf("missing"); role != RoleNone {
+		t.Fatalf("missing user role = %q", role)
+	}
+	if err := users.SetUserRole("missing", RoleViewer); err != ErrUserNotFound {
+		t.Fatalf("SetUserRole(missing) = %v", err)
+	}
+
+	if err := users.SetUserRole("u1", RoleOperator); err != nil {
+		t.Fatal(err)
+	}
+	if user := users.GetUser("u1"); user.Role != RoleOperator || user.IsAdmin {
+		t.Fatalf("operator = %+v", user)
+	}
+	// is_admin 与 admin 角色保持一致
+	if err := users.SetUserAdmin("u1", true); err != nil {
+		t.Fatal(err)
+	}
+	if user := users.GetUser("u1"); user.Role != RoleAdmin || !user.IsAdmin {
+		t.Fatalf("admin = %+v", user)
+	}
+	if err := users.SetUserAdmin("u1", false); err != nil {
+		t.Fatal(err)
+	}
+	if role := users.RoleOf("u1"); role != RoleNone {
+		t.Fatalf("revoked role = %q", role)
+	}
+}
+
+func TestListParams(t *testing.T) {
+	cases := []struct {
+		in   ListParams
+		want ListParams
+	}{
+		{ListParams{}, ListParams{Page: 1, PageSize: DefaultPageSize}},
+		{ListParams{Page: -3, PageSize: MaxPageSize + 1}, ListParams{Page: 1, PageSize: DefaultPageSize}},
+		{ListParams{Page: 3, PageSize: 10, Sort: "x", Desc: true}, ListParams{Page: 3, PageSize: 10, Sort: "x", Desc: true}},
+	}
+	for _, tc := range cases {
+		if got := tc.in.Normalize(); got != tc.want {
+			t.Errorf("Normalize(%+v) = %+v", tc.in, got)
+		}
+	}
+
+	p := ListParams{Page: 3, PageSize: 10}
+	if p.Offset() != 20 || p.TotalPages(0) != 0 || p.TotalPages(10) != 1 || p.TotalPages(21) != 3 {
+		t.Errorf("offset = %d, pages = %d/%d/%d", p.Offset(), p.TotalPages(0), p.TotalPages(10), p.TotalPages(21))
+	}
+	if (ListParams{}).TotalPages(5) != 0 {
+		t.Error("zero page size should give zero pages")
+	}
+}
+
+func TestSortFields(t *testing.T) {
+	fields := SortFields{"name": "u.username", "created_at": "u.created_at"}
+	if !fields.Allows("") || !fields.Allows("name") || fields.Allows("password") {
+		t.Error("Allows mismatch")
+	}
+	if names := fields.Names(); !reflect.DeepEqual(names, []string{"created_at", "name"}) {
+		t.Errorf("Names = %v", names)
+	}
+
+	cases := []struct {
+		params ListParams
+		want   string
+	}{
+		{ListParams{}, "u.created_at DESC"},
+		{ListParams{Sort: "unknown", Desc: true}, "u.created_at DESC"},
+		{ListParams{Sort: "name"}, "u.username ASC, u.user_id"},
+		{ListParams{Sort: "name", Desc: true}, "u.username DESC, u.user_id"},
+	}
+	for _, tc := range cases {
+		if got := fields.orderBy(tc.params, "u.created_at DESC", "u.user_id"); got != tc.want {
+			t.Errorf("orderBy(%+v) = %q, want %q", tc.params, got, tc.want)
+		}
+	}
+}
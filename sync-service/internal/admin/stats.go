@@ -1,7 +1,6 @@
 package admin
 
 import (
-	"sort"
 	"sync"
 	"time"
 )
@@ -33,10 +32,11 @@ type AdminMessage struct {
 
 // SessionListResponse represents paginated sessions response
 type SessionListResponse struct {
-	Sessions []AdminSession `json:"sessions"`
-	Total    int            `json:"total"`
-	Page     int            `json:"page"`
-	PageSize int            `json:"page_size"`
+	Sessions   []AdminSession `json:"sessions"`
+	Total      int            `json:"total"`
+	Page       int            `json:"page"`
+	PageSize   int            `json:"page_size"`
+	TotalPages int            `json:"total_pages"`
 }
 
 // SessionDetailResponse represents session detail with messages
@@ -45,32 +45,12 @@ type SessionDetailResponse struct {
 	Messages []AdminMessage `json:"messages"`
 }
 
-// StatsService 统计分析服务
+// StatsService 统计分析服务，计数与会话保存在 StatsStore 中
 type StatsService struct {
-	mu sync.RWMutex
-
-	// 实时计数器
-	totalRequests   int64
-	totalTokensIn   int64
-	totalTokensOut  int64
-	totalCost       float64
-	totalErrors     int64
-
-	// 按时间窗口统计
-	hourlyStats  map[string]*TimeWindowStats
-	dailyStats   map[string]*TimeWindowStats
-
-	// 按维度统计
-	providerStats map[string]*ProviderStats
-	modelStats    map[string]*ModelStats
-	userStats     map[string]*UserStats
-
-	// 会话管理
-	sessions       map[string]*AdminSession
-	sessionsByUser map[string][]string // userID -> []sessionID
-	messages       map[string][]AdminMessage // sessionID -> messages
+	store StatsStore
 
 	// Cache for GetOverview (performance optimization)
+	mu                sync.RWMutex
 	overviewCache     map[string]interface{}
 	overviewCacheTime time.Time
 	overviewCacheTTL  time.Duration
@@ -125,16 +105,9 @@ type UserStats struct {
 }
 
 // NewStatsService 创建统计服务
-func NewStatsService() *StatsService {
+func NewStatsService(store StatsStore) *StatsService {
 	s := &StatsService{
-		hourlyStats:      make(map[string]*TimeWindowStats),
-		dailyStats:       make(map[string]*TimeWindowStats),
-		providerStats:    make(map[string]*ProviderStats),
-		modelStats:       make(map[string]*ModelStats),
-		userStats:        make(map[string]*UserStats),
-		sessions:         make(map[string]*AdminSession),
-		sessionsByUser:   make(map[string][]string),
-		messages:         make(map[string][]AdminMessage),
+		store:            store,
 		overviewCache:    nil,
 		overviewCacheTTL: 5 * time.Second, // Cache overview for 5 seconds
 	}
@@ -153,122 +126,50 @@ func (s *StatsService) RecordRequest(
 	latencyMs int,
 	isError bool,
 ) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	err := s.store.RecordUsage(ctx, UsageRecord{
+		UserID:    userID,
+		Provider:  provider,
+		Model:     model,
+		TokensIn:  int64(tokensIn),
+		TokensOut: int64(tokensOut),
+		Cost:      cost,
+		LatencyMs: int64(latencyMs),
+		IsError:   isError,
+		At:        time.Now(),
+	})
+	logStoreError("record request", err)
 
 	// Invalidate overview cache on new data
-	s.overviewCache = nil
-
-	now := time.Now()
-	hourKey := now.Format("2006-01-02-15")
-	dayKey := now.Format("2006-01-02")
-
-	// 更新总计
-	s.totalRequests++
-	s.totalTokensIn += int64(tokensIn)
-	s.totalTokensOut += int64(tokensOut)
-	s.totalCost += cost
-	if isError {
-		s.totalErrors++
-	}
-
-	// 更新小时统计
-	if _, ok := s.hourlyStats[hourKey]; !ok {
-		s.hourlyStats[hourKey] = &TimeWindowStats{Timestamp: now.Truncate(time.Hour)}
-	}
-	hs := s.hourlyStats[hourKey]
-	hs.Requests++
-	hs.TokensIn += int64(tokensIn)
-	hs.TokensOut += int64(tokensOut)
-	hs.Cost += cost
-	if isError {
-		hs.Errors++
-	}
-	hs.AvgLatencyMs = (hs.AvgLatencyMs*float64(hs.Requests-1) + float64(latencyMs)) / float64(hs.Requests)
-
-	// 更新日统计
-	if _, ok := s.dailyStats[dayKey]; !ok {
-		s.dailyStats[dayKey] = &TimeWindowStats{Timestamp: now.Truncate(24 * time.Hour)}
-	}
-	ds := s.dailyStats[dayKey]
-	ds.Requests++
-	ds.TokensIn += int64(tokensIn)
-	ds.TokensOut += int64(tokensOut)
-	ds.Cost += cost
-	if isError {
-		ds.Errors++
-	}
-	ds.AvgLatencyMs = (ds.AvgLatencyMs*float64(ds.Requests-1) + float64(latencyMs)) / float64(ds.Requests)
-
-	// 更新供应商统计
-	if _, ok := s.providerStats[provider]; !ok {
-		s.providerStats[provider] = &ProviderStats{Provider: provider}
-	}
-	ps := s.providerStats[provider]
-	ps.Requests++
-	ps.TokensIn += int64(tokensIn)
-	ps.TokensOut += int64(tokensOut)
-	ps.Cost += cost
-	if isError {
-		ps.Errors++
-	}
-	ps.SuccessRate = float64(ps.Requests-ps.Errors) / float64(ps.Requests) * 100
-	ps.AvgLatencyMs = (ps.AvgLatencyMs*float64(ps.Requests-1) + float64(latencyMs)) / float64(ps.Requests)
-	ps.LastUsed = now
-
-	// 更新模型统计
-	modelKey := provider + "/" + model
-	if _, ok := s.modelStats[modelKey]; !ok {
-		s.modelStats[modelKey] = &ModelStats{Model: model, Provider: provider}
-	}
-	ms := s.modelStats[modelKey]
-	ms.Requests++
-	ms.TokensIn += int64(tokensIn)
-	ms.TokensOut += int64(tokensOut)
-	ms.Cost += cost
-	ms.AvgLatencyMs = (ms.AvgLatencyMs*float64(ms.Requests-1) + float64(latencyMs)) / float64(ms.Requests)
-	ms.LastUsed = now
-
-	// 更新用户统计
-	if userID != "" {
-		if _, ok := s.userStats[userID]; !ok {
-			s.userStats[userID] = &UserStats{UserID: userID}
-		}
-		us := s.userStats[userID]
-		us.Requests++
-		us.TokensIn += int64(tokensIn)
-		us.TokensOut += int64(tokensOut)
-		us.Cost += cost
-		us.LastActive = now
-	}
+	s.invalidateOverview()
 }
 
 // RecordSession 记录会话创建
 func (s *StatsService) RecordSession(userID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if userID != "" {
-		if _, ok := s.userStats[userID]; !ok {
-			s.userStats[userID] = &UserStats{UserID: userID}
-		}
-		s.userStats[userID].Sessions++
-		s.userStats[userID].LastActive = time.Now()
-	}
+	s.addUserActivity("record session", userID, 1, 0)
 }
 
 // RecordMessage 记录消息创建
 func (s *StatsService) RecordMessage(userID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.addUserActivity("record message", userID, 0, 1)
+}
 
-	if userID != "" {
-		if _, ok := s.userStats[userID]; !ok {
-			s.userStats[userID] = &UserStats{UserID: userID}
-		}
-		s.userStats[userID].Messages++
-		s.userStats[userID].LastActive = time.Now()
+func (s *StatsService) addUserActivity(op, userID string, sessions, messages int64) {
+	if userID == "" {
+		return
 	}
+	ctx, cancel := storeContext()
+	defer cancel()
+	logStoreError(op, s.store.AddUserActivity(ctx, userID, sessions, messages, time.Now()))
+	s.invalidateOverview()
+}
+
+func (s *StatsService) invalidateOverview() {
+	s.mu.Lock()
+	s.overviewCache = nil
+	s.mu.Unlock()
 }
 
 // GetOverview 获取总览统计 (with caching for performance)
@@ -291,64 +192,77 @@ func (s *StatsService) GetOverview() map[string]interface{} {
 		return s.overviewCache
 	}
 
-	s.overviewCache = map[string]interface{}{
-		"total_requests":   s.totalRequests,
-		"total_tokens_in":  s.totalTokensIn,
-		"total_tokens_out": s.totalTokensOut,
-		"total_cost":       s.totalCost,
-		"total_errors":     s.totalErrors,
-		"success_rate":     s.calculateSuccessRate(),
-		"active_users":     len(s.userStats),
-		"active_providers": len(s.providerStats),
-		"active_models":    len(s.modelStats),
+	ctx, cancel := storeContext()
+	defer cancel()
+	totals, err := s.store.UsageTotals(ctx)
+	logStoreError("load usage totals", err)
+
+	overview := map[string]interface{}{
+		"total_requests":   totals.Requests,
+		"total_tokens_in":  totals.TokensIn,
+		"total_tokens_out": totals.TokensOut,
+		"total_cost":       totals.Cost,
+		"total_errors":     totals.Errors,
+		"success_rate":     calculateSuccessRate(totals.Requests, totals.Errors),
+		"active_users":     totals.Users,
+		"active_providers": totals.Providers,
+		"active_models":    totals.Models,
+	}
+	// 读取失败时不缓存，下次请求重试
+	if err == nil {
+		s.overviewCache = overview
+		s.overviewCacheTime = time.Now()
 	}
-	s.overviewCacheTime = time.Now()
 
-	return s.overviewCache
+	return overview
 }
 
-func (s *StatsService) calculateSuccessRate() float64 {
-	if s.totalRequests == 0 {
+func calculateSuccessRate(requests, errors int64) float64 {
+	if requests == 0 {
 		return 100.0
 	}
-	return float64(s.totalRequests-s.totalErrors) / float64(s.totalRequests) * 100
+	return float64(requests-errors) / float64(requests) * 100
 }
 
 // GetHourlyStats 获取小时统计（最近24小时）
 func (s *StatsService) GetHourlyStats() []*TimeWindowStats {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	result := make([]*TimeWindowStats, 0, 24)
 	now := time.Now()
+	slots := make([]time.Time, 0, 24)
 	for i := 23; i >= 0; i-- {
-		key := now.Add(-time.Duration(i) * time.Hour).Format("2006-01-02-15")
-		if stat, ok := s.hourlyStats[key]; ok {
-			result = append(result, stat)
-		} else {
-			result = append(result, &TimeWindowStats{
-				Timestamp: now.Add(-time.Duration(i) * time.Hour).Truncate(time.Hour),
-			})
-		}
+		slots = append(slots, now.Add(-time.Duration(i)*time.Hour).Truncate(time.Hour))
 	}
-	return result
+	return s.timeWindows("hour", slots)
 }
 
 // GetDailyStats 获取日统计（最近30天）
 func (s *StatsService) GetDailyStats() []*TimeWindowStats {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	result := make([]*TimeWindowStats, 0, 30)
 	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	slots := make([]time.Time, 0, 30)
 	for i := 29; i >= 0; i-- {
-		key := now.AddDate(0, 0, -i).Format("2006-01-02")
-		if stat, ok := s.dailyStats[key]; ok {
+		slots = append(slots, today.AddDate(0, 0, -i))
+	}
+	return s.timeWindows("day", slots)
+}
+
+// timeWindows 按时间槽返回统计，没有数据的槽补零
+func (s *StatsService) timeWindows(granularity string, slots []time.Time) []*TimeWindowStats {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	stats, err := s.store.TimeWindows(ctx, granularity, slots[0])
+	logStoreError("load "+granularity+" stats", err)
+	byBucket := make(map[int64]*TimeWindowStats, len(stats))
+	for _, stat := range stats {
+		byBucket[stat.Timestamp.UnixMilli()] = stat
+	}
+
+	result := make([]*TimeWindowStats, 0, len(slots))
+	for _, slot := range slots {
+		if stat, ok := byBucket[slot.UnixMilli()]; ok {
 			result = append(result, stat)
 		} else {
-			result = append(result, &TimeWindowStats{
-				Timestamp: now.AddDate(0, 0, -i).Truncate(24 * time.Hour),
-			})
+			result = append(result, &TimeWindowStats{Timestamp: slot})
 		}
 	}
 	return result
@@ -356,49 +270,57 @@ func (s *StatsService) GetDailyStats() []*TimeWindowStats {
 
 // GetProviderStats 获取供应商统计
 func (s *StatsService) GetProviderStats() []*ProviderStats {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	result := make([]*ProviderStats, 0, len(s.providerStats))
-	for _, stat := range s.providerStats {
-		result = append(result, stat)
+	stats, err := s.store.ListProviderStats(ctx)
+	logStoreError("list provider stats", err)
+	if stats == nil {
+		stats = []*ProviderStats{}
 	}
-	return result
+	return stats
 }
 
 // GetModelStats 获取模型统计
 func (s *StatsService) GetModelStats() []*ModelStats {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	result := make([]*ModelStats, 0, len(s.modelStats))
-	for _, stat := range s.modelStats {
-		result = append(result, stat)
+	stats, err := s.store.ListModelStats(ctx)
+	logStoreError("list model stats", err)
+	if stats == nil {
+		stats = []*ModelStats{}
 	}
-	return result
+	return stats
 }
 
 // GetUserStats 获取用户统计
 func (s *StatsService) GetUserStats() []*UserStats {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	result := make([]*UserStats, 0, len(s.userStats))
-	for _, stat := range s.userStats {
-		result = append(result, stat)
+	stats, err := s.store.ListUserStats(ctx, "")
+	logStoreError("list user stats", err)
+	if stats == nil {
+		stats = []*UserStats{}
 	}
-	return result
+	return stats
 }
 
 // GetUserStatsDetail 获取单个用户统计
 func (s *StatsService) GetUserStatsDetail(userID string) *UserStats {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	if userID == "" {
+		return nil
+	}
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	if stat, ok := s.userStats[userID]; ok {
-		return stat
+	stats, err := s.store.ListUserStats(ctx, userID)
+	logStoreError("get user stats", err)
+	if len(stats) == 0 {
+		return nil
 	}
-	return nil
+	return stats[0]
 }
 
 // cleanupLoop 清理过期统计数据
@@ -412,141 +334,67 @@ func (s *StatsService) cleanupLoop() {
 }
 
 func (s *StatsService) cleanup() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
 	now := time.Now()
 
 	// 清理超过48小时的小时统计
-	for key, stat := range s.hourlyStats {
-		if now.Sub(stat.Timestamp) > 48*time.Hour {
-			delete(s.hourlyStats, key)
-		}
-	}
+	logStoreError("prune hourly stats", s.store.PruneTimeWindows(ctx, "hour", now.Add(-48*time.Hour)))
 
 	// 清理超过90天的日统计
-	for key, stat := range s.dailyStats {
-		if now.Sub(stat.Timestamp) > 90*24*time.Hour {
-			delete(s.dailyStats, key)
-		}
-	}
+	logStoreError("prune daily stats", s.store.PruneTimeWindows(ctx, "day", now.AddDate(0, 0, -90)))
 }
 
 // --- Session Management ---
 
 // TrackSession tracks a session for admin monitoring
 func (s *StatsService) TrackSession(session AdminSession) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.sessions[session.ID] = &session
-
-	// Update user's session list
-	userSessions := s.sessionsByUser[session.UserID]
-	found := false
-	for _, id := range userSessions {
-		if id == session.ID {
-			found = true
-			break
-		}
-	}
-	if !found {
-		s.sessionsByUser[session.UserID] = append(userSessions, session.ID)
-	}
+	ctx, cancel := storeContext()
+	defer cancel()
+	logStoreError("track session", s.store.SaveSession(ctx, session))
 }
 
 // TrackMessage tracks a message for admin monitoring
 func (s *StatsService) TrackMessage(msg AdminMessage) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Add message to session
-	s.messages[msg.SessionID] = append(s.messages[msg.SessionID], msg)
-
-	// Update session stats
-	if session, ok := s.sessions[msg.SessionID]; ok {
-		session.MessageCount++
-		session.TokenCount += msg.TokensInput + msg.TokensOutput
-		session.Cost += msg.Cost
-		session.UpdatedAt = time.Now()
-	}
+	ctx, cancel := storeContext()
+	defer cancel()
+	logStoreError("track message", s.store.AppendMessage(ctx, msg))
 }
 
 // GetAllSessions returns paginated list of all sessions
-func (s *StatsService) GetAllSessions(page, pageSize int, userIDFilter string) SessionListResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *StatsService) GetAllSessions(query SessionQuery) SessionListResponse {
+	query.ListParams = query.ListParams.Normalize()
 
-	var filtered []*AdminSession
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	if userIDFilter != "" {
-		// Filter by user
-		sessionIDs := s.sessionsByUser[userIDFilter]
-		for _, id := range sessionIDs {
-			if session, ok := s.sessions[id]; ok {
-				filtered = append(filtered, session)
-			}
-		}
-	} else {
-		// Get all sessions
-		for _, session := range s.sessions {
-			filtered = append(filtered, session)
-		}
-	}
-
-	total := len(filtered)
-
-	// Sort by UpdatedAt descending (most recent first) - O(n log n) instead of O(n²)
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].UpdatedAt.After(filtered[j].UpdatedAt)
-	})
-
-	// Pagination
-	start := (page - 1) * pageSize
-	end := start + pageSize
-
-	if start >= len(filtered) {
-		return SessionListResponse{
-			Sessions: []AdminSession{},
-			Total:    total,
-			Page:     page,
-			PageSize: pageSize,
-		}
-	}
-
-	if end > len(filtered) {
-		end = len(filtered)
-	}
-
-	// Convert to value slice
-	result := make([]AdminSession, 0, end-start)
-	for i := start; i < end; i++ {
-		result = append(result, *filtered[i])
+	sessions, total, err := s.store.ListSessions(ctx, query)
+	logStoreError("list sessions", err)
+	if sessions == nil {
+		sessions = []AdminSession{}
 	}
 
 	return SessionListResponse{
-		Sessions: result,
-		Total:    total,
-		Page:     page,
-		PageSize: pageSize,
+		Sessions:   sessions,
+		Total:      total,
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+		TotalPages: query.TotalPages(total),
 	}
 }
 
 // GetSessionDetail returns session with its messages
 func (s *StatsService) GetSessionDetail(sessionID string) *SessionDetailResponse {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	session, ok := s.sessions[sessionID]
-	if !ok {
+	session, messages, err := s.store.GetSession(ctx, sessionID)
+	logStoreError("get session", err)
+	if session == nil {
 		return nil
 	}
 
-	messages := s.messages[sessionID]
-	if messages == nil {
-		messages = []AdminMessage{}
-	}
-
 	return &SessionDetailResponse{
 		Session:  *session,
 		Messages: messages,
@@ -555,30 +403,7 @@ func (s *StatsService) GetSessionDetail(sessionID string) *SessionDetailResponse
 
 // DeleteSession removes a session and its messages
 func (s *StatsService) DeleteSession(sessionID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	session, ok := s.sessions[sessionID]
-	if !ok {
-		return nil // Already deleted or doesn't exist
-	}
-
-	// Remove from user's session list
-	userID := session.UserID
-	userSessions := s.sessionsByUser[userID]
-	newSessions := make([]string, 0, len(userSessions))
-	for _, id := range userSessions {
-		if id != sessionID {
-			newSessions = append(newSessions, id)
-		}
-	}
-	s.sessionsByUser[userID] = newSessions
-
-	// Delete messages
-	delete(s.messages, sessionID)
-
-	// Delete session
-	delete(s.sessions, sessionID)
-
-	return nil
+	ctx, cancel := storeContext()
+	defer cancel()
+	return s.store.DeleteSession(ctx, sessionID)
 }
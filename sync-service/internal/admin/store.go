@@ -0,0 +1,212 @@
+package admin
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+)
+
+// Store 管理后台持久化存储，各服务只依赖自己需要的子接口
+type Store interface {
+	UserStore
+	AuditStore
+	StatsStore
+	BillingStore
+	AlertStore
+}
+
+// UserStore 用户信息与禁用状态
+type UserStore interface {
+	// UpsertUser 注册或更新用户名 / 邮箱（email 为空时保留原值）
+	UpsertUser(ctx context.Context, userID, username, email string, isAdmin bool, now time.Time) (*UserInfo, error)
+	// UpdateUser 按增量更新计数与时间字段，用户不存在时忽略
+	UpdateUser(ctx context.Context, userID string, update UserUpdate) error
+	// GetUser 用户不存在时返回 nil
+	GetUser(ctx context.Context, userID string) (*UserInfo, error)
+	ListUsers(ctx context.Context, query UserQuery) ([]*UserInfo, int, error)
+	SetUserDisabled(ctx context.Context, userID string, disabled bool) error
+	IsUserDisabled(ctx context.Context, userID string) (bool, error)
+	// CountUsersActiveSince 统计 since 之后有活动的用户数
+	CountUsersActiveSince(ctx context.Context, since time.Time) (int, error)
+}
+
+// UserUpdate 用户字段增量，零值字段不更新
+type UserUpdate struct {
+	Logins       int64
+	Messages     int64
+	Tokens       int64
+	Cost         float64
+	DeviceCount  *int
+	SessionCount *int
+	IsAdmin      *bool
+	Role         *Role // 同时更新 is_admin
+	LastLoginAt  time.Time
+	LastActiveAt time.Time
+}
+
+// UserQuery 用户列表查询
+type UserQuery struct {
+	ListParams
+	Search       string
+	OnlyDisabled bool
+	Role         string // 为空时不过滤
+}
+
+// SessionQuery 会话列表查询
+type SessionQuery struct {
+	ListParams
+	UserID string // 为空时返回全部用户
+}
+
+// AlertHistoryQuery 告警历史查询，空字段不过滤
+type AlertHistoryQuery struct {
+	ListParams
+	RuleID   string
+	Severity string
+	Status   string
+}
+
+// AuditStore 审计日志
+type AuditStore interface {
+	InsertAuditLog(ctx context.Context, log AuditLog) error
+	// QueryAuditLogs 按时间倒序分页返回，并返回过滤后的总数
+	QueryAuditLogs(ctx context.Context, query AuditLogQuery) ([]AuditLog, int, error)
+}
+
+// StatsStore 请求统计与会话
+type StatsStore interface {
+	// RecordUsage 在一个事务内累加时间窗口、供应商、模型和用户统计
+	RecordUsage(ctx context.Context, usage UsageRecord) error
+	// AddUserActivity 累加用户的会话 / 消息数
+	AddUserActivity(ctx context.Context, userID string, sessions, messages int64, now time.Time) error
+	UsageTotals(ctx context.Context) (UsageTotals, error)
+	// TimeWindows 返回 since 之后的小时（hour）或日（day）统计
+	TimeWindows(ctx context.Context, granularity string, since time.Time) ([]*TimeWindowStats, error)
+	ListProviderStats(ctx context.Context) ([]*ProviderStats, error)
+	ListModelStats(ctx context.Context) ([]*ModelStats, error)
+	// ListUserStats userID 为空时返回全部用户
+	ListUserStats(ctx context.Context, userID string) ([]*UserStats, error)
+	PruneTimeWindows(ctx context.Context, granularity string, before time.Time) error
+
+	SaveSession(ctx context.Context, session AdminSession) error
+	// AppendMessage 保存消息并累加所属会话的计数
+	AppendMessage(ctx context.Context, msg AdminMessage) error
+	// ListSessions 默认按更新时间倒序分页，并返回过滤后的总数
+	ListSessions(ctx context.Context, query SessionQuery) ([]AdminSession, int, error)
+	// GetSession 会话不存在时返回 nil
+	GetSession(ctx context.Context, sessionID string) (*AdminSession, []AdminMessage, error)
+	DeleteSession(ctx context.Context, sessionID string) error
+}
+
+// UsageRecord 单次请求的用量
+type UsageRecord struct {
+	UserID    string
+	Provider  string
+	Model     string
+	TokensIn  int64
+	TokensOut int64
+	Cost      float64
+	LatencyMs int64
+	IsError   bool
+	At        time.Time
+}
+
+// UsageTotals 全部请求的累计值
+type UsageTotals struct {
+	Requests  int64
+	TokensIn  int64
+	TokensOut int64
+	Cost      float64
+	Errors    int64
+	Users     int
+	Providers int
+	Models    int
+}
+
+// BillingStore 订阅、钱包、交易与支付记录
+type BillingStore interface {
+	SaveSubscription(ctx context.Context, sub *models.Subscription) error
+	// GetSubscription 不存在时返回 nil
+	GetSubscription(ctx context.Context, id string) (*models.Subscription, error)
+	// GetSubscriptionByExternalID 按 Lago 订阅 ID 查找，不存在时返回 nil
+	GetSubscriptionByExternalID(ctx context.Context, externalID string) (*models.Subscription, error)
+	ListSubscriptions(ctx context.Context, query BillingQuery) ([]models.Subscription, int, error)
+
+	SaveWallet(ctx context.Context, wallet *models.Wallet) error
+	// GetWallet 不存在时返回 nil
+	GetWallet(ctx context.Context, id string) (*models.Wallet, error)
+	ListWallets(ctx context.Context, query BillingQuery) ([]models.Wallet, int, error)
+	// AddWalletTransactions 在一个事务内写入交易并保存钱包
+	AddWalletTransactions(ctx context.Context, wallet *models.Wallet, txs ...models.WalletTransaction) error
+	ListWalletTransactions(ctx context.Context, walletID string, offset, limit int) ([]models.WalletTransaction, int, error)
+
+	SavePayment(ctx context.Context, payment *models.Payment) error
+	// GetPayment 不存在时返回 nil
+	GetPayment(ctx context.Context, id string) (*models.Payment, error)
+	// GetPaymentByOrderNo 按商户订单号查找，不存在时返回 nil
+	GetPaymentByOrderNo(ctx context.Context, orderNo string) (*models.Payment, error)
+	ListPayments(ctx context.Context, query BillingQuery) ([]models.Payment, int, error)
+
+	// RecordWebhookEvent 登记已处理的 webhook 事件，事件已登记过时返回 false
+	RecordWebhookEvent(ctx context.Context, provider, eventID, eventType string, at time.Time) (bool, error)
+	// ForgetWebhookEvent 处理失败时撤销登记，使服务方重试时能再次处理
+	ForgetWebhookEvent(ctx context.Context, provider, eventID string) error
+
+	// CreateInvoice 在一个事务内为 source 开具发票：source 已开过票时返回已有发票；
+	// 否则按 scope 取下一个序号生成编号（scope-000001），调用 render 生成 PDF 后一并保存
+	CreateInvoice(ctx context.Context, invoice *models.Invoice, source, scope string, render func(*models.Invoice) ([]byte, error)) (*models.Invoice, error)
+	// GetInvoice 不存在时返回 nil
+	GetInvoice(ctx context.Context, id string) (*models.Invoice, error)
+	// GetInvoicePDF 不存在时返回 nil
+	GetInvoicePDF(ctx context.Context, id string) ([]byte, error)
+	ListInvoices(ctx context.Context, query BillingQuery) ([]models.Invoice, int, error)
+}
+
+// BillingQuery 计费记录列表查询，空字段不过滤
+type BillingQuery struct {
+	UserID    string
+	Status    string
+	PlanCode  string
+	Method    string
+	StartTime *time.Time
+	EndTime   *time.Time
+	Offset    int
+	Limit     int
+}
+
+// AlertStore 告警规则与历史
+type AlertStore interface {
+	SaveAlertRule(ctx context.Context, rule AlertRule) error
+	// GetAlertRule 不存在时返回 nil
+	GetAlertRule(ctx context.Context, id string) (*AlertRule, error)
+	ListAlertRules(ctx context.Context) ([]AlertRule, error)
+	// DeleteAlertRule 返回规则是否存在
+	DeleteAlertRule(ctx context.Context, id string) (bool, error)
+	InsertAlertHistory(ctx context.Context, alert AlertHistory) error
+	// ListAlertHistory 默认按触发时间倒序分页，并返回过滤后的总数
+	ListAlertHistory(ctx context.Context, query AlertHistoryQuery) ([]AlertHistory, int, error)
+}
+
+// storeTimeout 单次存储操作的超时
+const storeTimeout = 10 * time.Second
+
+func storeContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), storeTimeout)
+}
+
+// logStoreError 记录无法返回给调用方的存储错误
+func logStoreError(op string, err error) {
+	if err != nil {
+		slog.Error("admin store operation failed", "op", op, "error", err)
+	}
+}
+
+// pageOffset 页码（从 1 开始）转换为偏移量
+func pageOffset(page, pageSize int) int {
+	if page < 1 {
+		page = 1
+	}
+	return (page - 1) * pageSize
+}
@@ -0,0 +1,1088 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/storage"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+)
+
+// SQLStore 基于 SQLite / Postgres 的 Store 实现
+// 需要按条件查询的字段存为独立列，其余字段以 JSON 存在 data 列中
+type SQLStore struct {
+	db *storage.DB
+}
+
+// NewSQLStore 执行管理后台的表结构迁移并返回存储
+func NewSQLStore(ctx context.Context, db *storage.DB) (*SQLStore, error) {
+	if err := db.Migrate(ctx, "admin", adminMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// adminMigrations 管理后台表结构，已发布的版本不可修改，只能追加
+var adminMigrations = []storage.Migration{
+	{
+		Version: 1,
+		Name:    "create admin tables",
+		Statements: []string{
+			`CREATE TABLE admin_users (
+				user_id TEXT PRIMARY KEY,
+				username TEXT NOT NULL DEFAULT '',
+				email TEXT NOT NULL DEFAULT '',
+				is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at BIGINT NOT NULL DEFAULT 0,
+				last_login_at BIGINT NOT NULL DEFAULT 0,
+				last_active_at BIGINT NOT NULL DEFAULT 0,
+				login_count BIGINT NOT NULL DEFAULT 0,
+				device_count INTEGER NOT NULL DEFAULT 0,
+				session_count INTEGER NOT NULL DEFAULT 0,
+				message_count BIGINT NOT NULL DEFAULT 0,
+				total_tokens BIGINT NOT NULL DEFAULT 0,
+				total_cost DOUBLE PRECISION NOT NULL DEFAULT 0
+			)`,
+			`CREATE INDEX idx_admin_users_last_active ON admin_users (last_active_at)`,
+			`CREATE TABLE admin_disabled_users (
+				user_id TEXT PRIMARY KEY,
+				disabled_at BIGINT NOT NULL
+			)`,
+			`CREATE TABLE admin_audit_logs (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL DEFAULT '',
+				result TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_admin_audit_logs_created ON admin_audit_logs (created_at)`,
+			`CREATE INDEX idx_admin_audit_logs_user ON admin_audit_logs (user_id, created_at)`,
+			`CREATE TABLE admin_stats_windows (
+				granularity TEXT NOT NULL,
+				bucket BIGINT NOT NULL,
+				requests BIGINT NOT NULL DEFAULT 0,
+				tokens_in BIGINT NOT NULL DEFAULT 0,
+				tokens_out BIGINT NOT NULL DEFAULT 0,
+				cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+				errors BIGINT NOT NULL DEFAULT 0,
+				latency_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+				PRIMARY KEY (granularity, bucket)
+			)`,
+			`CREATE TABLE admin_stats_providers (
+				provider TEXT PRIMARY KEY,
+				requests BIGINT NOT NULL DEFAULT 0,
+				tokens_in BIGINT NOT NULL DEFAULT 0,
+				tokens_out BIGINT NOT NULL DEFAULT 0,
+				cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+				errors BIGINT NOT NULL DEFAULT 0,
+				latency_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+				last_used BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE admin_stats_models (
+				provider TEXT NOT NULL,
+				model TEXT NOT NULL,
+				requests BIGINT NOT NULL DEFAULT 0,
+				tokens_in BIGINT NOT NULL DEFAULT 0,
+				tokens_out BIGINT NOT NULL DEFAULT 0,
+				cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+				latency_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+				last_used BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (provider, model)
+			)`,
+			`CREATE TABLE admin_stats_users (
+				user_id TEXT PRIMARY KEY,
+				requests BIGINT NOT NULL DEFAULT 0,
+				tokens_in BIGINT NOT NULL DEFAULT 0,
+				tokens_out BIGINT NOT NULL DEFAULT 0,
+				cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+				sessions BIGINT NOT NULL DEFAULT 0,
+				messages BIGINT NOT NULL DEFAULT 0,
+				last_active BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE admin_sessions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL DEFAULT '',
+				title TEXT NOT NULL DEFAULT '',
+				message_count INTEGER NOT NULL DEFAULT 0,
+				token_count BIGINT NOT NULL DEFAULT 0,
+				cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+				created_at BIGINT NOT NULL DEFAULT 0,
+				updated_at BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE INDEX idx_admin_sessions_updated ON admin_sessions (updated_at)`,
+			`CREATE INDEX idx_admin_sessions_user ON admin_sessions (user_id, updated_at)`,
+			`CREATE TABLE admin_messages (
+				session_id TEXT NOT NULL,
+				seq BIGINT NOT NULL,
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_admin_messages_session ON admin_messages (session_id, created_at, seq)`,
+			`CREATE TABLE billing_subscriptions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL DEFAULT '',
+				status TEXT NOT NULL DEFAULT '',
+				plan_code TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_billing_subscriptions_user ON billing_subscriptions (user_id, created_at)`,
+			`CREATE INDEX idx_billing_subscriptions_created ON billing_subscriptions (created_at)`,
+			`CREATE TABLE billing_wallets (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL DEFAULT '',
+				status TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_billing_wallets_user ON billing_wallets (user_id, created_at)`,
+			`CREATE TABLE billing_wallet_transactions (
+				id TEXT PRIMARY KEY,
+				wallet_id TEXT NOT NULL,
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_billing_wallet_transactions_wallet ON billing_wallet_transactions (wallet_id, created_at)`,
+			`CREATE TABLE billing_payments (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL DEFAULT '',
+				status TEXT NOT NULL DEFAULT '',
+				method TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_billing_payments_user ON billing_payments (user_id, created_at)`,
+			`CREATE INDEX idx_billing_payments_created ON billing_payments (created_at)`,
+			`CREATE TABLE alert_rules (
+				id TEXT PRIMARY KEY,
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE TABLE alert_history (
+				id TEXT PRIMARY KEY,
+				severity TEXT NOT NULL DEFAULT '',
+				status TEXT NOT NULL DEFAULT '',
+				triggered_at BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_alert_history_triggered ON alert_history (triggered_at)`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add admin roles and list filters",
+		Statements: []string{
+			`ALTER TABLE admin_users ADD COLUMN role TEXT NOT NULL DEFAULT ''`,
+			`UPDATE admin_users SET role = 'admin' WHERE is_admin`,
+			`ALTER TABLE admin_audit_logs ADD COLUMN resource_type TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE alert_history ADD COLUMN rule_id TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX idx_alert_history_rule ON alert_history (rule_id, triggered_at)`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add billing webhook reconciliation",
+		Statements: []string{
+			`ALTER TABLE billing_subscriptions ADD COLUMN external_id TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX idx_billing_subscriptions_external ON billing_subscriptions (external_id)`,
+			`ALTER TABLE billing_payments ADD COLUMN order_no TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX idx_billing_payments_order_no ON billing_payments (order_no)`,
+			`CREATE TABLE billing_webhook_events (
+				provider TEXT NOT NULL,
+				event_id TEXT NOT NULL,
+				event_type TEXT NOT NULL DEFAULT '',
+				received_at BIGINT NOT NULL,
+				PRIMARY KEY (provider, event_id)
+			)`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add billing invoices",
+		Statements: []string{
+			`CREATE TABLE billing_invoices (
+				id TEXT PRIMARY KEY,
+				number TEXT NOT NULL UNIQUE,
+				source TEXT NOT NULL UNIQUE,
+				user_id TEXT NOT NULL DEFAULT '',
+				kind TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				data TEXT NOT NULL,
+				pdf TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_billing_invoices_user ON billing_invoices (user_id, created_at)`,
+			`CREATE TABLE billing_invoice_sequences (
+				scope TEXT PRIMARY KEY,
+				last_value BIGINT NOT NULL
+			)`,
+		},
+	},
+}
+
+// ===== Users =====
+
+const userColumns = `u.user_id, u.username, u.email, u.is_admin, u.role, u.created_at, u.last_login_at, u.last_active_at,
+	u.login_count, u.device_count, u.session_count, u.message_count, u.total_tokens, u.total_cost,
+	d.user_id IS NOT NULL`
+
+const userFrom = ` FROM admin_users u LEFT JOIN admin_disabled_users d ON d.user_id = u.user_id`
+
+func scanUser(row interface{ Scan(...any) error }) (*UserInfo, error) {
+	var user UserInfo
+	var createdAt, lastLoginAt, lastActiveAt int64
+	err := row.Scan(&user.UserID, &user.Username, &user.Email, &user.IsAdmin, &user.Role, &createdAt, &lastLoginAt, &lastActiveAt,
+		&user.LoginCount, &user.DeviceCount, &user.SessionCount, &user.MessageCount, &user.TotalTokens, &user.TotalCost,
+		&user.IsDisabled)
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = fromUnixMilli(createdAt)
+	user.LastLoginAt = fromUnixMilli(lastLoginAt)
+	user.LastActiveAt = fromUnixMilli(lastActiveAt)
+	return &user, nil
+}
+
+func (s *SQLStore) UpsertUser(ctx context.Context, userID, username, email string, isAdmin bool, now time.Time) (*UserInfo, error) {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO admin_users (user_id, username, email, is_admin, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET username = excluded.username,
+			email = CASE WHEN excluded.email = '' THEN admin_users.email ELSE excluded.email END`,
+		userID, username, email, isAdmin, unixMilli(now))
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, userID)
+}
+
+func (s *SQLStore) UpdateUser(ctx context.Context, userID string, update UserUpdate) error {
+	var sets []string
+	var args []any
+	add := func(clause string, value any) {
+		sets = append(sets, clause)
+		args = append(args, value)
+	}
+	if update.Logins != 0 {
+		add("login_count = login_count + ?", update.Logins)
+	}
+	if update.Messages != 0 {
+		add("message_count = message_count + ?", update.Messages)
+	}
+	if update.Tokens != 0 {
+		add("total_tokens = total_tokens + ?", update.Tokens)
+	}
+	if update.Cost != 0 {
+		add("total_cost = total_cost + ?", update.Cost)
+	}
+	if update.DeviceCount != nil {
+		add("device_count = ?", *update.DeviceCount)
+	}
+	if update.SessionCount != nil {
+		add("session_count = ?", *update.SessionCount)
+	}
+	if update.IsAdmin != nil {
+		add("is_admin = ?", *update.IsAdmin)
+	}
+	if update.Role != nil {
+		add("role = ?", string(*update.Role))
+		if update.IsAdmin == nil {
+			add("is_admin = ?", *update.Role == RoleAdmin)
+		}
+	}
+	if !update.LastLoginAt.IsZero() {
+		add("last_login_at = ?", unixMilli(update.LastLoginAt))
+	}
+	if !update.LastActiveAt.IsZero() {
+		add("last_active_at = ?", unixMilli(update.LastActiveAt))
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	args = append(args, userID)
+	_, err := s.db.ExecContext(ctx, "UPDATE admin_users SET "+strings.Join(sets, ", ")+" WHERE user_id = ?", args...)
+	return err
+}
+
+func (s *SQLStore) GetUser(ctx context.Context, userID string) (*UserInfo, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+userFrom+" WHERE u.user_id = ?", userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (s *SQLStore) ListUsers(ctx context.Context, query UserQuery) ([]*UserInfo, int, error) {
+	var filter sqlFilter
+	if query.Search != "" {
+		pattern := "%" + query.Search + "%"
+		filter.add("(u.user_id LIKE ? OR u.username LIKE ? OR u.email LIKE ?)", pattern, pattern, pattern)
+	}
+	if query.OnlyDisabled {
+		filter.add("d.user_id IS NOT NULL")
+	}
+	if query.Role == string(RoleAdmin) {
+		// 只设置了 is_admin 的用户同样视为 admin，与 RoleOf 一致
+		filter.add("(u.role = ? OR (u.role = '' AND u.is_admin))", query.Role)
+	} else {
+		filter.eq("u.role", query.Role)
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*)"+userFrom+filter.where(), filter.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+userFrom+filter.where()+
+		" ORDER BY "+UserSortFields.orderBy(query.ListParams, "u.created_at DESC, u.user_id", "u.user_id")+
+		limitClause(query.Offset(), query.PageSize), filter.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]*UserInfo, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+func (s *SQLStore) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	if !disabled {
+		_, err := s.db.ExecContext(ctx, "DELETE FROM admin_disabled_users WHERE user_id = ?", userID)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "INSERT INTO admin_disabled_users (user_id, disabled_at) VALUES (?, ?) ON CONFLICT (user_id) DO NOTHING",
+		userID, time.Now().UnixMilli())
+	return err
+}
+
+func (s *SQLStore) IsUserDisabled(ctx context.Context, userID string) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_disabled_users WHERE user_id = ?", userID).Scan(&count)
+	return count > 0, err
+}
+
+func (s *SQLStore) CountUsersActiveSince(ctx context.Context, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_users WHERE last_active_at > ?", unixMilli(since)).Scan(&count)
+	return count, err
+}
+
+// ===== Audit =====
+
+func (s *SQLStore) InsertAuditLog(ctx context.Context, log AuditLog) error {
+	return upsertDoc(ctx, s.db, "admin_audit_logs", log.ID, []docColumn{
+		{"user_id", log.UserID},
+		{"action", log.Action},
+		{"resource_type", log.ResourceType},
+		{"result", log.Result},
+		{"created_at", unixMilli(log.CreatedAt)},
+	}, log)
+}
+
+func (s *SQLStore) QueryAuditLogs(ctx context.Context, query AuditLogQuery) ([]AuditLog, int, error) {
+	var filter sqlFilter
+	filter.eq("user_id", query.UserID)
+	filter.eq("action", query.Action)
+	filter.eq("resource_type", query.ResourceType)
+	filter.eq("result", query.Result)
+	if query.StartTime != nil {
+		filter.add("created_at >= ?", unixMilli(*query.StartTime))
+	}
+	if query.EndTime != nil {
+		filter.add("created_at <= ?", unixMilli(*query.EndTime))
+	}
+	return listDocs[AuditLog](ctx, s.db, "admin_audit_logs", filter,
+		AuditLogSortFields.orderBy(query.ListParams, "created_at DESC, id DESC", "id DESC"), query.Offset(), query.PageSize)
+}
+
+// ===== Stats =====
+
+func (s *SQLStore) RecordUsage(ctx context.Context, usage UsageRecord) error {
+	var errCount int64
+	if usage.IsError {
+		errCount = 1
+	}
+	at := usage.At
+	hour := at.Truncate(time.Hour)
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	latency := float64(usage.LatencyMs)
+
+	return s.db.WithTx(ctx, func(tx *storage.Tx) error {
+		for _, window := range []struct {
+			granularity string
+			bucket      time.Time
+		}{{"hour", hour}, {"day", day}} {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO admin_stats_windows (granularity, bucket, requests, tokens_in, tokens_out, cost, errors, latency_sum)
+				VALUES (?, ?, 1, ?, ?, ?, ?, ?)
+				ON CONFLICT (granularity, bucket) DO UPDATE SET
+					requests = admin_stats_windows.requests + 1,
+					tokens_in = admin_stats_windows.tokens_in + excluded.tokens_in,
+					tokens_out = admin_stats_windows.tokens_out + excluded.tokens_out,
+					cost = admin_stats_windows.cost + excluded.cost,
+					errors = admin_stats_windows.errors + excluded.errors,
+					latency_sum = admin_stats_windows.latency_sum + excluded.latency_sum`,
+				window.granularity, window.bucket.UnixMilli(), usage.TokensIn, usage.TokensOut, usage.Cost, errCount, latency); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO admin_stats_providers (provider, requests, tokens_in, tokens_out, cost, errors, latency_sum, last_used)
+			VALUES (?, 1, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (provider) DO UPDATE SET
+				requests = admin_stats_providers.requests + 1,
+				tokens_in = admin_stats_providers.tokens_in + excluded.tokens_in,
+				tokens_out = admin_stats_providers.tokens_out + excluded.tokens_out,
+				cost = admin_stats_providers.cost + excluded.cost,
+				errors = admin_stats_providers.errors + excluded.errors,
+				latency_sum = admin_stats_providers.latency_sum + excluded.latency_sum,
+				last_used = excluded.last_used`,
+			usage.Provider, usage.TokensIn, usage.TokensOut, usage.Cost, errCount, latency, unixMilli(at)); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO admin_stats_models (provider, model, requests, tokens_in, tokens_out, cost, latency_sum, last_used)
+			VALUES (?, ?, 1, ?, ?, ?, ?, ?)
+			ON CONFLICT (provider, model) DO UPDATE SET
+				requests = admin_stats_models.requests + 1,
+				tokens_in = admin_stats_models.tokens_in + excluded.tokens_in,
+				tokens_out = admin_stats_models.tokens_out + excluded.tokens_out,
+				cost = admin_stats_models.cost + excluded.cost,
+				latency_sum = admin_stats_models.latency_sum + excluded.latency_sum,
+				last_used = excluded.last_used`,
+			usage.Provider, usage.Model, usage.TokensIn, usage.TokensOut, usage.Cost, latency, unixMilli(at)); err != nil {
+			return err
+		}
+
+		if usage.UserID == "" {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO admin_stats_users (user_id, requests, tokens_in, tokens_out, cost, last_active)
+			VALUES (?, 1, ?, ?, ?, ?)
+			ON CONFLICT (user_id) DO UPDATE SET
+				requests = admin_stats_users.requests + 1,
+				tokens_in = admin_stats_users.tokens_in + excluded.tokens_in,
+				tokens_out = admin_stats_users.tokens_out + excluded.tokens_out,
+				cost = admin_stats_users.cost + excluded.cost,
+				last_active = excluded.last_active`,
+			usage.UserID, usage.TokensIn, usage.TokensOut, usage.Cost, unixMilli(at))
+		return err
+	})
+}
+
+func (s *SQLStore) AddUserActivity(ctx context.Context, userID string, sessions, messages int64, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO admin_stats_users (user_id, sessions, messages, last_active) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			sessions = admin_stats_users.sessions + excluded.sessions,
+			messages = admin_stats_users.messages + excluded.messages,
+			last_active = excluded.last_active`,
+		userID, sessions, messages, unixMilli(now))
+	return err
+}
+
+func (s *SQLStore) UsageTotals(ctx context.Context) (UsageTotals, error) {
+	var totals UsageTotals
+	// 每个请求都计入且只计入一个供应商，按供应商汇总即为全局总计
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(tokens_in), 0), COALESCE(SUM(tokens_out), 0),
+		COALESCE(SUM(cost), 0), COALESCE(SUM(errors), 0), COUNT(*) FROM admin_stats_providers`).
+		Scan(&totals.Requests, &totals.TokensIn, &totals.TokensOut, &totals.Cost, &totals.Errors, &totals.Providers)
+	if err != nil {
+		return totals, err
+	}
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_stats_models").Scan(&totals.Models); err != nil {
+		return totals, err
+	}
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_stats_users").Scan(&totals.Users)
+	return totals, err
+}
+
+func (s *SQLStore) TimeWindows(ctx context.Context, granularity string, since time.Time) ([]*TimeWindowStats, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT bucket, requests, tokens_in, tokens_out, cost, errors, latency_sum
+		FROM admin_stats_windows WHERE granularity = ? AND bucket >= ? ORDER BY bucket`, granularity, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*TimeWindowStats, 0)
+	for rows.Next() {
+		var stat TimeWindowStats
+		var bucket int64
+		var latencySum float64
+		if err := rows.Scan(&bucket, &stat.Requests, &stat.TokensIn, &stat.TokensOut, &stat.Cost, &stat.Errors, &latencySum); err != nil {
+			return nil, err
+		}
+		stat.Timestamp = time.UnixMilli(bucket)
+		stat.AvgLatencyMs = average(latencySum, stat.Requests)
+		result = append(result, &stat)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) ListProviderStats(ctx context.Context) ([]*ProviderStats, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT provider, requests, tokens_in, tokens_out, cost, errors, latency_sum, last_used
+		FROM admin_stats_providers ORDER BY requests DESC, provider`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*ProviderStats, 0)
+	for rows.Next() {
+		var stat ProviderStats
+		var latencySum float64
+		var lastUsed int64
+		if err := rows.Scan(&stat.Provider, &stat.Requests, &stat.TokensIn, &stat.TokensOut, &stat.Cost, &stat.Errors, &latencySum, &lastUsed); err != nil {
+			return nil, err
+		}
+		if stat.Requests > 0 {
+			stat.SuccessRate = float64(stat.Requests-stat.Errors) / float64(stat.Requests) * 100
+		}
+		stat.AvgLatencyMs = average(latencySum, stat.Requests)
+		stat.LastUsed = fromUnixMilli(lastUsed)
+		result = append(result, &stat)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) ListModelStats(ctx context.Context) ([]*ModelStats, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT provider, model, requests, tokens_in, tokens_out, cost, latency_sum, last_used
+		FROM admin_stats_models ORDER BY requests DESC, provider, model`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*ModelStats, 0)
+	for rows.Next() {
+		var stat ModelStats
+		var latencySum float64
+		var lastUsed int64
+		if err := rows.Scan(&stat.Provider, &stat.Model, &stat.Requests, &stat.TokensIn, &stat.TokensOut, &stat.Cost, &latencySum, &lastUsed); err != nil {
+			return nil, err
+		}
+		stat.AvgLatencyMs = average(latencySum, stat.Requests)
+		stat.LastUsed = fromUnixMilli(lastUsed)
+		result = append(result, &stat)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) ListUserStats(ctx context.Context, userID string) ([]*UserStats, error) {
+	var filter sqlFilter
+	filter.eq("user_id", userID)
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, requests, tokens_in, tokens_out, cost, sessions, messages, last_active
+		FROM admin_stats_users`+filter.where()+" ORDER BY requests DESC, user_id", filter.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*UserStats, 0)
+	for rows.Next() {
+		var stat UserStats
+		var lastActive int64
+		if err := rows.Scan(&stat.UserID, &stat.Requests, &stat.TokensIn, &stat.TokensOut, &stat.Cost, &stat.Sessions, &stat.Messages, &lastActive); err != nil {
+			return nil, err
+		}
+		stat.LastActive = fromUnixMilli(lastActive)
+		result = append(result, &stat)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) PruneTimeWindows(ctx context.Context, granularity string, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM admin_stats_windows WHERE granularity = ? AND bucket < ?", granularity, before.UnixMilli())
+	return err
+}
+
+// ===== Sessions =====
+
+const sessionColumns = "id, user_id, title, message_count, token_count, cost, created_at, updated_at"
+
+func scanSession(row interface{ Scan(...any) error }) (*AdminSession, error) {
+	var session AdminSession
+	var createdAt, updatedAt int64
+	if err := row.Scan(&session.ID, &session.UserID, &session.Title, &session.MessageCount, &session.TokenCount, &session.Cost, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	session.CreatedAt = fromUnixMilli(createdAt)
+	session.UpdatedAt = fromUnixMilli(updatedAt)
+	return &session, nil
+}
+
+func (s *SQLStore) SaveSession(ctx context.Context, session AdminSession) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO admin_sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, title = excluded.title,
+			message_count = excluded.message_count, token_count = excluded.token_count, cost = excluded.cost,
+			created_at = excluded.created_at, updated_at = excluded.updated_at`,
+		session.ID, session.UserID, session.Title, session.MessageCount, session.TokenCount, session.Cost,
+		unixMilli(session.CreatedAt), unixMilli(session.UpdatedAt))
+	return err
+}
+
+func (s *SQLStore) AppendMessage(ctx context.Context, msg AdminMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.db.WithTx(ctx, func(tx *storage.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO admin_messages (session_id, seq, created_at, data) VALUES (?, ?, ?, ?)",
+			msg.SessionID, now.UnixNano(), unixMilli(msg.CreatedAt), string(data)); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE admin_sessions SET message_count = message_count + 1,
+			token_count = token_count + ?, cost = cost + ?, updated_at = ? WHERE id = ?`,
+			msg.TokensInput+msg.TokensOutput, msg.Cost, now.UnixMilli(), msg.SessionID)
+		return err
+	})
+}
+
+func (s *SQLStore) ListSessions(ctx context.Context, query SessionQuery) ([]AdminSession, int, error) {
+	var filter sqlFilter
+	filter.eq("user_id", query.UserID)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_sessions"+filter.where(), filter.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT "+sessionColumns+" FROM admin_sessions"+filter.where()+
+		" ORDER BY "+SessionSortFields.orderBy(query.ListParams, "updated_at DESC, id", "id")+
+		limitClause(query.Offset(), query.PageSize), filter.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	sessions := make([]AdminSession, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, total, rows.Err()
+}
+
+func (s *SQLStore) GetSession(ctx context.Context, sessionID string) (*AdminSession, []AdminMessage, error) {
+	session, err := scanSession(s.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM admin_sessions WHERE id = ?", sessionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT data FROM admin_messages WHERE session_id = ? ORDER BY created_at, seq", sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]AdminMessage, 0)
+	for rows.Next() {
+		var data string
+		var msg AdminMessage
+		if err := rows.Scan(&data); err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return session, messages, rows.Err()
+}
+
+func (s *SQLStore) DeleteSession(ctx context.Context, sessionID string) error {
+	return s.db.WithTx(ctx, func(tx *storage.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM admin_messages WHERE session_id = ?", sessionID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM admin_sessions WHERE id = ?", sessionID)
+		return err
+	})
+}
+
+// ===== Billing =====
+
+func (s *SQLStore) SaveSubscription(ctx context.Context, sub *models.Subscription) error {
+	return upsertDoc(ctx, s.db, "billing_subscriptions", sub.ID, []docColumn{
+		{"user_id", sub.UserID},
+		{"status", string(sub.Status)},
+		{"plan_code", sub.PlanCode},
+		{"external_id", sub.ExternalID},
+		{"created_at", unixMilli(sub.CreatedAt)},
+	}, sub)
+}
+
+func (s *SQLStore) GetSubscription(ctx context.Context, id string) (*models.Subscription, error) {
+	return getDoc[models.Subscription](ctx, s.db, "billing_subscriptions", id)
+}
+
+func (s *SQLStore) GetSubscriptionByExternalID(ctx context.Context, externalID string) (*models.Subscription, error) {
+	return findDoc[models.Subscription](ctx, s.db, "billing_subscriptions", "external_id", externalID)
+}
+
+func (s *SQLStore) ListSubscriptions(ctx context.Context, query BillingQuery) ([]models.Subscription, int, error) {
+	var filter sqlFilter
+	filter.eq("user_id", query.UserID)
+	filter.eq("status", query.Status)
+	filter.eq("plan_code", query.PlanCode)
+	return listDocs[models.Subscription](ctx, s.db, "billing_subscriptions", filter, "created_at DESC, id", query.Offset, query.Limit)
+}
+
+func (s *SQLStore) SaveWallet(ctx context.Context, wallet *models.Wallet) error {
+	return saveWallet(ctx, s.db, wallet)
+}
+
+func saveWallet(ctx context.Context, q storage.Execer, wallet *models.Wallet) error {
+	return upsertDoc(ctx, q, "billing_wallets", wallet.ID, []docColumn{
+		{"user_id", wallet.UserID},
+		{"status", string(wallet.Status)},
+		{"created_at", unixMilli(wallet.CreatedAt)},
+	}, wallet)
+}
+
+func (s *SQLStore) GetWallet(ctx context.Context, id string) (*models.Wallet, error) {
+	return getDoc[models.Wallet](ctx, s.db, "billing_wallets", id)
+}
+
+func (s *SQLStore) ListWallets(ctx context.Context, query BillingQuery) ([]models.Wallet, int, error) {
+	var filter sqlFilter
+	filter.eq("user_id", query.UserID)
+	filter.eq("status", query.Status)
+	return listDocs[models.Wallet](ctx, s.db, "billing_wallets", filter, "created_at DESC, id", query.Offset, query.Limit)
+}
+
+func (s *SQLStore) AddWalletTransactions(ctx context.Context, wallet *models.Wallet, txs ...models.WalletTransaction) error {
+	return s.db.WithTx(ctx, func(tx *storage.Tx) error {
+		for _, walletTx := range txs {
+			if err := upsertDoc(ctx, tx, "billing_wallet_transactions", walletTx.ID, []docColumn{
+				{"wallet_id", walletTx.WalletID},
+				{"created_at", unixMilli(walletTx.CreatedAt)},
+			}, walletTx); err != nil {
+				return err
+			}
+		}
+		return saveWallet(ctx, tx, wallet)
+	})
+}
+
+func (s *SQLStore) ListWalletTransactions(ctx context.Context, walletID string, offset, limit int) ([]models.WalletTransaction, int, error) {
+	var filter sqlFilter
+	filter.add("wallet_id = ?", walletID)
+	return listDocs[models.WalletTransaction](ctx, s.db, "billing_wallet_transactions", filter, "created_at DESC, id", offset, limit)
+}
+
+func (s *SQLStore) SavePayment(ctx context.Context, payment *models.Payment) error {
+	return upsertDoc(ctx, s.db, "billing_payments", payment.ID, []docColumn{
+		{"user_id", payment.UserID},
+		{"status", string(payment.Status)},
+		{"method", string(payment.Method)},
+		{"order_no", payment.OrderNo},
+		{"created_at", unixMilli(payment.CreatedAt)},
+	}, payment)
+}
+
+func (s *SQLStore) GetPayment(ctx context.Context, id string) (*models.Payment, error) {
+	return getDoc[models.Payment](ctx, s.db, "billing_payments", id)
+}
+
+func (s *SQLStore) GetPaymentByOrderNo(ctx context.Context, orderNo string) (*models.Payment, error) {
+	return findDoc[models.Payment](ctx, s.db, "billing_payments", "order_no", orderNo)
+}
+
+func (s *SQLStore) RecordWebhookEvent(ctx context.Context, provider, eventID, eventType string, at time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `INSERT INTO billing_webhook_events (provider, event_id, event_type, received_at)
+		VALUES (?, ?, ?, ?) ON CONFLICT (provider, event_id) DO NOTHING`, provider, eventID, eventType, unixMilli(at))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *SQLStore) ForgetWebhookEvent(ctx context.Context, provider, eventID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM billing_webhook_events WHERE provider = ? AND event_id = ?", provider, eventID)
+	return err
+}
+
+func (s *SQLStore) ListPayments(ctx context.Context, query BillingQuery) ([]models.Payment, int, error) {
+	var filter sqlFilter
+	filter.eq("user_id", query.UserID)
+	filter.eq("status", query.Status)
+	filter.eq("method", query.Method)
+	if query.StartTime != nil {
+		filter.add("created_at >= ?", unixMilli(*query.StartTime))
+	}
+	if query.EndTime != nil {
+		filter.add("created_at <= ?", unixMilli(*query.EndTime))
+	}
+	return listDocs[models.Payment](ctx, s.db, "billing_payments", filter, "created_at DESC, id", query.Offset, query.Limit)
+}
+
+func (s *SQLStore) CreateInvoice(ctx context.Context, invoice *models.Invoice, source, scope string, render func(*models.Invoice) ([]byte, error)) (*models.Invoice, error) {
+	var issued *models.Invoice
+	err := s.db.WithTx(ctx, func(tx *storage.Tx) error {
+		existing, err := findDoc[models.Invoice](ctx, tx, "billing_invoices", "source", source)
+		if err != nil || existing != nil {
+			issued = existing
+			return err
+		}
+
+		// 序号与发票同事务提交，开票失败时序号一并回滚，编号保持连续
+		if _, err := tx.ExecContext(ctx, `INSERT INTO billing_invoice_sequences (scope, last_value) VALUES (?, 1)
+			ON CONFLICT (scope) DO UPDATE SET last_value = billing_invoice_sequences.last_value + 1`, scope); err != nil {
+			return err
+		}
+		var seq int64
+		if err := tx.QueryRowContext(ctx, "SELECT last_value FROM billing_invoice_sequences WHERE scope = ?", scope).Scan(&seq); err != nil {
+			return err
+		}
+		invoice.Number = fmt.Sprintf("%s-%06d", scope, seq)
+
+		pdf, err := render(invoice)
+		if err != nil {
+			return err
+		}
+		if err := upsertDoc(ctx, tx, "billing_invoices", invoice.ID, []docColumn{
+			{"number", invoice.Number},
+			{"source", source},
+			{"user_id", invoice.UserID},
+			{"kind", string(invoice.Kind)},
+			{"created_at", unixMilli(invoice.IssuedAt)},
+			{"pdf", base64.StdEncoding.EncodeToString(pdf)},
+		}, invoice); err != nil {
+			return err
+		}
+		issued = invoice
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+func (s *SQLStore) GetInvoice(ctx context.Context, id string) (*models.Invoice, error) {
+	return getDoc[models.Invoice](ctx, s.db, "billing_invoices", id)
+}
+
+func (s *SQLStore) GetInvoicePDF(ctx context.Context, id string) ([]byte, error) {
+	var encoded string
+	err := s.db.QueryRowContext(ctx, "SELECT pdf FROM billing_invoices WHERE id = ?", id).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func (s *SQLStore) ListInvoices(ctx context.Context, query BillingQuery) ([]models.Invoice, int, error) {
+	var filter sqlFilter
+	filter.eq("user_id", query.UserID)
+	if query.StartTime != nil {
+		filter.add("created_at >= ?", unixMilli(*query.StartTime))
+	}
+	if query.EndTime != nil {
+		filter.add("created_at <= ?", unixMilli(*query.EndTime))
+	}
+	return listDocs[models.Invoice](ctx, s.db, "billing_invoices", filter, "created_at DESC, id", query.Offset, query.Limit)
+}
+
+// ===== Alerts =====
+
+func (s *SQLStore) SaveAlertRule(ctx context.Context, rule AlertRule) error {
+	return upsertDoc(ctx, s.db, "alert_rules", rule.ID, []docColumn{
+		{"created_at", unixMilli(rule.CreatedAt)},
+	}, rule)
+}
+
+func (s *SQLStore) GetAlertRule(ctx context.Context, id string) (*AlertRule, error) {
+	return getDoc[AlertRule](ctx, s.db, "alert_rules", id)
+}
+
+func (s *SQLStore) ListAlertRules(ctx context.Context) ([]AlertRule, error) {
+	rules, _, err := listDocs[AlertRule](ctx, s.db, "alert_rules", sqlFilter{}, "created_at, id", 0, 0)
+	return rules, err
+}
+
+func (s *SQLStore) DeleteAlertRule(ctx context.Context, id string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM alert_rules WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *SQLStore) InsertAlertHistory(ctx context.Context, alert AlertHistory) error {
+	return upsertDoc(ctx, s.db, "alert_history", alert.ID, []docColumn{
+		{"rule_id", alert.RuleID},
+		{"severity", alert.Severity},
+		{"status", alert.Status},
+		{"triggered_at", unixMilli(alert.TriggeredAt)},
+	}, alert)
+}
+
+func (s *SQLStore) ListAlertHistory(ctx context.Context, query AlertHistoryQuery) ([]AlertHistory, int, error) {
+	var filter sqlFilter
+	filter.eq("rule_id", query.RuleID)
+	filter.eq("severity", query.Severity)
+	filter.eq("status", query.Status)
+	return listDocs[AlertHistory](ctx, s.db, "alert_history", filter,
+		AlertHistorySortFields.orderBy(query.ListParams, "triggered_at DESC, id DESC", "id DESC"), query.Offset(), query.PageSize)
+}
+
+// ===== helpers =====
+
+// sqlFilter 拼接 WHERE 条件
+type sqlFilter struct {
+	conds []string
+	args  []any
+}
+
+func (f *sqlFilter) add(cond string, args ...any) {
+	f.conds = append(f.conds, cond)
+	f.args = append(f.args, args...)
+}
+
+// eq value 为空时不过滤
+func (f *sqlFilter) eq(column, value string) {
+	if value != "" {
+		f.add(column+" = ?", value)
+	}
+}
+
+func (f *sqlFilter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// limitClause limit <= 0 时不分页
+func limitClause(offset, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, max(offset, 0))
+}
+
+type docColumn struct {
+	name  string
+	value any
+}
+
+// upsertDoc 以 id 为主键写入索引列与 JSON 文档
+func upsertDoc(ctx context.Context, q storage.Execer, table, id string, columns []docColumn, doc any) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(columns)+2)
+	values := make([]any, 0, len(columns)+2)
+	updates := make([]string, 0, len(columns)+1)
+	names = append(names, "id")
+	values = append(values, id)
+	for _, column := range columns {
+		names = append(names, column.name)
+		values = append(values, column.value)
+		updates = append(updates, column.name+" = excluded."+column.name)
+	}
+	names = append(names, "data")
+	values = append(values, string(data))
+	updates = append(updates, "data = excluded.data")
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (id) DO UPDATE SET %s",
+		table, strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "), strings.Join(updates, ", "))
+	_, err = q.ExecContext(ctx, query, values...)
+	return err
+}
+
+// getDoc 不存在时返回 nil
+func getDoc[T any](ctx context.Context, q storage.Execer, table, id string) (*T, error) {
+	return findDoc[T](ctx, q, table, "id", id)
+}
+
+// findDoc 按索引列查找最新的一条文档，不存在时返回 nil
+func findDoc[T any](ctx context.Context, q storage.Execer, table, column string, value any) (*T, error) {
+	var data string
+	err := q.QueryRowContext(ctx, "SELECT data FROM "+table+" WHERE "+column+" = ? ORDER BY created_at DESC LIMIT 1", value).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc T
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// listDocs 返回一页文档与过滤后的总数
+func listDocs[T any](ctx context.Context, q storage.Execer, table string, filter sqlFilter, orderBy string, offset, limit int) ([]T, int, error) {
+	var total int
+	if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+filter.where(), filter.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := q.QueryContext(ctx, "SELECT data FROM "+table+filter.where()+" ORDER BY "+orderBy+limitClause(offset, limit), filter.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	docs := make([]T, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, 0, err
+		}
+		var doc T
+		if err := json.Unmarshal([]byte(data), &doc); err != nil {
+			return nil, 0, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, total, rows.Err()
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func average(sum float64, count int64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
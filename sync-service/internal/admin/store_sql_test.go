@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/storage"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+)
+
+// openTestStore 打开临时 SQLite 数据库上的 SQLStore
+func openTestStore(t *testing.T, path string) *SQLStore {
+	t.Helper()
+	db, err := storage.Open(storage.Config{DSN: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := NewSQLStore(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSQLStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "admin.db")
+	store := openTestStore(t, path)
+	now := time.UnixMilli(time.Now().UnixMilli())
+
+	// 用户：插入、空邮箱不覆盖已有邮箱、累加计数、禁用
+	if _, err := store.UpsertUser(ctx, "u1", "alice", "alice@example.com", false, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.UpsertUser(ctx, "u1", "alice2", "", false, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	role := RoleAdmin
+	if err := store.UpdateUser(ctx, "u1", UserUpdate{Logins: 2, Tokens: 100, Cost: 0.5, Role: &role, LastLoginAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUserDisabled(ctx, "u1", true); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetUser(ctx, "u1")
+	if err != nil || user == nil {
+		t.Fatalf("GetUser = %+v, %v", user, err)
+	}
+	if user.Username != "alice2" || user.Email != "alice@example.com" || user.LoginCount != 2 || user.TotalTokens != 100 ||
+		user.TotalCost != 0.5 || user.Role != RoleAdmin || !user.IsAdmin || !user.IsDisabled || !user.CreatedAt.Equal(now) || !user.LastLoginAt.Equal(now) {
+		t.Fatalf("user = %+v", user)
+	}
+	if missing, err := store.GetUser(ctx, "nobody"); missing != nil || err != nil {
+		t.Fatalf("missing user = %+v, %v", missing, err)
+	}
+
+	// 审计日志：文档字段原样读回
+	entry := AuditLog{ID: "a1", UserID: "u1", Action: "user.disable", ResourceType: "user", Result: "success",
+		Details: map[string]interface{}{"reason": "it's ?"}, CreatedAt: now}
+	if err := store.InsertAuditLog(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	logs, total, err := store.QueryAuditLogs(ctx, AuditLogQuery{Action: "user.disable", ListParams: ListParams{Page: 1, PageSize: 10}})
+	if err != nil || total != 1 || len(logs) != 1 || logs[0].Details["reason"] != "it's ?" || !logs[0].CreatedAt.Equal(now) {
+		t.Fatalf("audit logs = %+v (%d), %v", logs, total, err)
+	}
+
+	// Webhook 去重
+	if first, err := store.RecordWebhookEvent(ctx, "stripe", "evt_1", "paid", now); !first || err != nil {
+		t.Fatalf("first webhook = %v, %v", first, err)
+	}
+	if again, err := store.RecordWebhookEvent(ctx, "stripe", "evt_1", "paid", now); again || err != nil {
+		t.Fatalf("duplicate webhook = %v, %v", again, err)
+	}
+
+	// 发票：编号连续，渲染失败时序号与发票一并回滚，同一来源只开一次
+	render := func(*models.Invoice) ([]byte, error) { return []byte("%PDF"), nil }
+	errRender := errors.New("render failed")
+	if _, err := store.CreateInvoice(ctx, &models.Invoice{ID: "i0", UserID: "u1", IssuedAt: now}, "payment:p0", "INV-2026",
+		func(*models.Invoice) ([]byte, error) { return nil, errRender }); !errors.Is(err, errRender) {
+		t.Fatalf("failed invoice err = %v", err)
+	}
+	first, err := store.CreateInvoice(ctx, &models.Invoice{ID: "i1", UserID: "u1", IssuedAt: now}, "payment:p1", "INV-2026", render)
+	if err != nil || first.Number != "INV-2026-000001" {
+		t.Fatalf("first invoice = %+v, %v", first, err)
+	}
+	again, err := store.CreateInvoice(ctx, &models.Invoice{ID: "i2", UserID: "u1", IssuedAt: now}, "payment:p1", "INV-2026", render)
+	if err != nil || again.ID != "i1" {
+		t.Fatalf("reissued invoice = %+v, %v", again, err)
+	}
+	if pdf, err := store.GetInvoicePDF(ctx, "i1"); err != nil || string(pdf) != "%PDF" {
+		t.Fatalf("invoice pdf = %q, %v", pdf, err)
+	}
+
+	// 重新打开数据库：迁移不会重复执行，数据仍在
+	reopened := openTestStore(t, path)
+	if user, err := reopened.GetUser(ctx, "u1"); err != nil || user == nil || user.Username != "alice2" {
+		t.Fatalf("user after reopen = %+v, %v", user, err)
+	}
+	second, err := reopened.CreateInvoice(ctx, &models.Invoice{ID: "i3", UserID: "u1", IssuedAt: now}, "payment:p3", "INV-2026", render)
+	if err != nil || second.Number != "INV-2026-000002" {
+		t.Fatalf("invoice after reopen = %+v, %v", second, err)
+	}
+}
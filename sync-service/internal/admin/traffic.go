@@ -0,0 +1,192 @@
+package admin
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets API 延迟直方图的桶上限（秒）
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// trafficStats 实时流量指标：NATS 消息、认证失败、API 延迟与在线设备
+type trafficStats struct {
+	mu               sync.Mutex
+	natsMessages     map[natsMessageKey]uint64
+	authFailures     map[string]uint64
+	apiLatency       map[apiRouteKey]*histogram
+	connectedDevices int64
+}
+
+type natsMessageKey struct {
+	subject   string // 去掉用户 / 会话 ID 后的主题模式
+	direction string // in, out, push
+}
+
+type apiRouteKey struct {
+	method string
+	route  string
+	status string
+}
+
+// histogram 累积直方图，counts[i] 为落入 latencyBuckets[i] 的次数
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range latencyBuckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// subjectPattern 把主题中的用户、会话 ID 替换为 *，控制指标基数：
+// user.<id>.presence -> user.*.presence，chat.<uid>.<sid>.msg -> chat.*.*.msg，billing.<id> -> billing.*
+func subjectPattern(subject string) string {
+	parts := strings.Split(subject, ".")
+	switch len(parts) {
+	case 1:
+		return subject
+	case 2:
+		return parts[0] + ".*"
+	}
+	for i := 1; i < len(parts)-1; i++ {
+		parts[i] = "*"
+	}
+	return strings.Join(parts, ".")
+}
+
+// RecordNATSMessage 记录一条 NATS 消息，direction 为 in（订阅收到）、out（发布）或 push（推送给 WebSocket 客户端）
+func (m *MonitorService) RecordNATSMessage(subject, direction string) {
+	t := &m.traffic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.natsMessages == nil {
+		t.natsMessages = make(map[natsMessageKey]uint64)
+	}
+	t.natsMessages[natsMessageKey{subject: subjectPattern(subject), direction: direction}]++
+}
+
+// RecordAuthFailure 记录认证失败，reason 如 missing_token、invalid_token、login
+func (m *MonitorService) RecordAuthFailure(reason string) {
+	t := &m.traffic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.authFailures == nil {
+		t.authFailures = make(map[string]uint64)
+	}
+	t.authFailures[reason]++
+}
+
+// ObserveAPIRequest 记录一次 API 请求的耗时，route 为路由模板（如 /api/v1/sessions/:id）
+func (m *MonitorService) ObserveAPIRequest(method, route string, status int, latency time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	key := apiRouteKey{method: method, route: route, status: strconv.Itoa(status)}
+
+	t := &m.traffic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.apiLatency == nil {
+		t.apiLatency = make(map[apiRouteKey]*histogram)
+	}
+	h, ok := t.apiLatency[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		t.apiLatency[key] = h
+	}
+	h.observe(latency.Seconds())
+}
+
+// SetConnectedDevices 设置当前通过 WebSocket 连接的设备数
+func (m *MonitorService) SetConnectedDevices(n int) {
+	t := &m.traffic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connectedDevices = int64(n)
+}
+
+// writeTrafficMetrics 以 Prometheus 文本格式写出流量指标
+func (m *MonitorService) writeTrafficMetrics(sb *strings.Builder) {
+	t := &m.traffic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sb.WriteString("# HELP codeswitch_sync_connected_devices Devices connected over WebSocket\n")
+	sb.WriteString("# TYPE codeswitch_sync_connected_devices gauge\n")
+	fmt.Fprintf(sb, "codeswitch_sync_connected_devices %d\n", t.connectedDevices)
+
+	sb.WriteString("# HELP codeswitch_sync_nats_messages_total NATS messages by subject pattern and direction\n")
+	sb.WriteString("# TYPE codeswitch_sync_nats_messages_total counter\n")
+	msgKeys := make([]natsMessageKey, 0, len(t.natsMessages))
+	for key := range t.natsMessages {
+		msgKeys = append(msgKeys, key)
+	}
+	sort.Slice(msgKeys, func(i, j int) bool {
+		if msgKeys[i].subject != msgKeys[j].subject {
+			return msgKeys[i].subject < msgKeys[j].subject
+		}
+		return msgKeys[i].direction < msgKeys[j].direction
+	})
+	for _, key := range msgKeys {
+		fmt.Fprintf(sb, "codeswitch_sync_nats_messages_total{subject=\"%s\",direction=\"%s\"} %d\n",
+			escapeLabel(key.subject), key.direction, t.natsMessages[key])
+	}
+
+	sb.WriteString("# HELP codeswitch_sync_auth_failures_total Authentication failures by reason\n")
+	sb.WriteString("# TYPE codeswitch_sync_auth_failures_total counter\n")
+	reasons := make([]string, 0, len(t.authFailures))
+	for reason := range t.authFailures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(sb, "codeswitch_sync_auth_failures_total{reason=\"%s\"} %d\n", escapeLabel(reason), t.authFailures[reason])
+	}
+
+	sb.WriteString("# HELP codeswitch_sync_http_request_duration_seconds API request latency\n")
+	sb.WriteString("# TYPE codeswitch_sync_http_request_duration_seconds histogram\n")
+	routeKeys := make([]apiRouteKey, 0, len(t.apiLatency))
+	for key := range t.apiLatency {
+		routeKeys = append(routeKeys, key)
+	}
+	sort.Slice(routeKeys, func(i, j int) bool {
+		a, b := routeKeys[i], routeKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, key := range routeKeys {
+		h := t.apiLatency[key]
+		labels := fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%s\"", key.method, escapeLabel(key.route), key.status)
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(sb, "codeswitch_sync_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(sb, "codeswitch_sync_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(sb, "codeswitch_sync_http_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(sb, "codeswitch_sync_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+}
+
+// escapeLabel 转义 Prometheus 标签值中的反斜杠、引号和换行
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubjectPattern(t *testing.T) {
+	cases := map[string]string{
+		"admin":                  "admin",
+		"billing.u1":             "billing.*",
+		"user.u1.presence":       "user.*.presence",
+		"user.u1.sync_providers": "user.*.sync_providers",
+		"chat.u1.s1.msg":         "chat.*.*.msg",
+	}
+	for subject, want := range cases {
+		if got := subjectPattern(subject); got != want {
+			t.Errorf("subjectPattern(%q) = %q, want %q", subject, got, want)
+		}
+	}
+}
+
+func TestTrafficMetrics(t *testing.T) {
+	m := NewMonitorService()
+	m.SetConnectedDevices(3)
+	m.RecordNATSMessage("user.u1.presence", "in")
+	m.RecordNATSMessage("user.u2.presence", "in")
+	m.RecordNATSMessage("chat.u1.s1.msg", "push")
+	m.RecordAuthFailure("invalid_token")
+	m.RecordAuthFailure("invalid_token")
+	m.RecordAuthFailure(`bad "reason"`)
+	m.ObserveAPIRequest("GET", "/api/v1/sessions/:id", 200, 20*time.Millisecond)
+	m.ObserveAPIRequest("GET", "/api/v1/sessions/:id", 200, 3*time.Second)
+	m.ObserveAPIRequest("GET", "/api/v1/sessions/:id", 200, time.Minute)
+	m.ObserveAPIRequest("GET", "", 404, time.Millisecond)
+
+	var sb strings.Builder
+	m.writeTrafficMetrics(&sb)
+	out := sb.String()
+
+	route := `method="GET",route="/api/v1/sessions/:id",status="200"`
+	for _, line := range []string{
+		"codeswitch_sync_connected_devices 3",
+		`codeswitch_sync_nats_messages_total{subject="chat.*.*.msg",direction="push"} 1`,
+		`codeswitch_sync_nats_messages_total{subject="user.*.presence",direction="in"} 2`,
+		`codeswitch_sync_auth_failures_total{reason="bad \"reason\""} 1`,
+		`codeswitch_sync_auth_failures_total{reason="invalid_token"} 2`,
+		// 直方图的桶是累积的，超过最大桶的请求只计入 +Inf
+		`codeswitch_sync_http_request_duration_seconds_bucket{` + route + `,le="0.01"} 0`,
+		`codeswitch_sync_http_request_duration_seconds_bucket{` + route + `,le="0.025"} 1`,
+		`codeswitch_sync_http_request_duration_seconds_bucket{` + route + `,le="2.5"} 1`,
+		`codeswitch_sync_http_request_duration_seconds_bucket{` + route + `,le="5"} 2`,
+		`codeswitch_sync_http_request_duration_seconds_bucket{` + route + `,le="10"} 2`,
+		`codeswitch_sync_http_request_duration_seconds_bucket{` + route + `,le="+Inf"} 3`,
+		`codeswitch_sync_http_request_duration_seconds_sum{` + route + `} 63.02`,
+		`codeswitch_sync_http_request_duration_seconds_count{` + route + `} 3`,
+		`codeswitch_sync_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+	// 输出顺序稳定，便于比对
+	if strings.Index(out, `subject="chat.*.*.msg"`) > strings.Index(out, `subject="user.*.presence"`) {
+		t.Error("nats metrics not sorted by subject")
+	}
+	if t.Failed() {
+		t.Log(out)
+	}
+}
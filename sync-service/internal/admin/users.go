@@ -1,17 +1,10 @@
 package admin
 
-import (
-	"sync"
-	"time"
-)
+import "time"
 
-// UserManager 用户管理服务
+// UserManager 用户管理服务，用户信息与禁用状态保存在 UserStore 中
 type UserManager struct {
-	mu sync.RWMutex
-
-	// 用户状态
-	users       map[string]*UserInfo
-	disabledUsers map[string]bool
+	store UserStore
 }
 
 // UserInfo 用户信息
@@ -20,6 +13,7 @@ type UserInfo struct {
 	Username     string    `json:"username"`
 	Email        string    `json:"email,omitempty"`
 	IsAdmin      bool      `json:"is_admin"`
+	Role         Role      `json:"role,omitempty"` // 管理后台角色，为空表示无后台权限
 	IsDisabled   bool      `json:"is_disabled"`
 	CreatedAt    time.Time `json:"created_at"`
 	LastLoginAt  time.Time `json:"last_login_at,omitempty"`
@@ -42,255 +36,167 @@ type UserListResponse struct {
 }
 
 // NewUserManager 创建用户管理器
-func NewUserManager() *UserManager {
-	return &UserManager{
-		users:        make(map[string]*UserInfo),
-		disabledUsers: make(map[string]bool),
-	}
+func NewUserManager(store UserStore) *UserManager {
+	return &UserManager{store: store}
 }
 
 // RegisterUser 注册用户（内部调用）
 func (m *UserManager) RegisterUser(userID, username, email string, isAdmin bool) *UserInfo {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if user, ok := m.users[userID]; ok {
-		// 更新现有用户
-		user.Username = username
-		if email != "" {
-			user.Email = email
-		}
-		return user
-	}
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	user := &UserInfo{
-		UserID:    userID,
-		Username:  username,
-		Email:     email,
-		IsAdmin:   isAdmin,
-		CreatedAt: time.Now(),
-	}
-	m.users[userID] = user
+	user, err := m.store.UpsertUser(ctx, userID, username, email, isAdmin, time.Now())
+	logStoreError("register user", err)
 	return user
 }
 
 // RecordLogin 记录用户登录
 func (m *UserManager) RecordLogin(userID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if user, ok := m.users[userID]; ok {
-		user.LoginCount++
-		user.LastLoginAt = time.Now()
-		user.LastActiveAt = time.Now()
-	}
+	now := time.Now()
+	m.update("record login", userID, UserUpdate{Logins: 1, LastLoginAt: now, LastActiveAt: now})
 }
 
 // RecordActivity 记录用户活动
 func (m *UserManager) RecordActivity(userID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if user, ok := m.users[userID]; ok {
-		user.LastActiveAt = time.Now()
-	}
+	m.update("record activity", userID, UserUpdate{LastActiveAt: time.Now()})
 }
 
 // UpdateUserStats 更新用户统计
 func (m *UserManager) UpdateUserStats(userID string, tokens int64, cost float64) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if user, ok := m.users[userID]; ok {
-		user.TotalTokens += tokens
-		user.TotalCost += cost
-		user.LastActiveAt = time.Now()
-	}
+	m.update("update user stats", userID, UserUpdate{Tokens: tokens, Cost: cost, LastActiveAt: time.Now()})
 }
 
 // UpdateDeviceCount 更新设备数量
 func (m *UserManager) UpdateDeviceCount(userID string, count int) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if user, ok := m.users[userID]; ok {
-		user.DeviceCount = count
-	}
+	m.update("update device count", userID, UserUpdate{DeviceCount: &count})
 }
 
 // UpdateSessionCount 更新会话数量
 func (m *UserManager) UpdateSessionCount(userID string, count int) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if user, ok := m.users[userID]; ok {
-		user.SessionCount = count
-	}
+	m.update("update session count", userID, UserUpdate{SessionCount: &count})
 }
 
 // IncrementMessageCount 增加消息数量
 func (m *UserManager) IncrementMessageCount(userID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.update("increment message count", userID, UserUpdate{Messages: 1, LastActiveAt: time.Now()})
+}
 
-	if user, ok := m.users[userID]; ok {
-		user.MessageCount++
-		user.LastActiveAt = time.Now()
-	}
+func (m *UserManager) update(op, userID string, update UserUpdate) {
+	ctx, cancel := storeContext()
+	defer cancel()
+	logStoreError(op, m.store.UpdateUser(ctx, userID, update))
 }
 
 // GetUser 获取用户信息
 func (m *UserManager) GetUser(userID string) *UserInfo {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	if user, ok := m.users[userID]; ok {
-		// 返回副本
-		info := *user
-		info.IsDisabled = m.disabledUsers[userID]
-		return &info
-	}
-	return nil
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	user, err := m.store.GetUser(ctx, userID)
+	logStoreError("get user", err)
+	return user
 }
 
 // ListUsers 获取用户列表
-func (m *UserManager) ListUsers(page, pageSize int, search string, onlyDisabled bool) *UserListResponse {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	// 收集符合条件的用户
-	var filtered []*UserInfo
-	for _, user := range m.users {
-		// 搜索过滤
-		if search != "" {
-			if !contains(user.UserID, search) && !contains(user.Username, search) && !contains(user.Email, search) {
-				continue
-			}
-		}
-
-		// 禁用状态过滤
-		isDisabled := m.disabledUsers[user.UserID]
-		if onlyDisabled && !isDisabled {
-			continue
-		}
-
-		info := *user
-		info.IsDisabled = isDisabled
-		filtered = append(filtered, &info)
-	}
+func (m *UserManager) ListUsers(query UserQuery) *UserListResponse {
+	query.ListParams = query.ListParams.Normalize()
 
-	total := len(filtered)
-	totalPages := (total + pageSize - 1) / pageSize
-
-	// 分页
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start >= total {
-		return &UserListResponse{
-			Users:      []*UserInfo{},
-			Total:      total,
-			Page:       page,
-			PageSize:   pageSize,
-			TotalPages: totalPages,
-		}
-	}
-	if end > total {
-		end = total
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	users, total, err := m.store.ListUsers(ctx, query)
+	logStoreError("list users", err)
+	if users == nil {
+		users = []*UserInfo{}
 	}
 
 	return &UserListResponse{
-		Users:      filtered[start:end],
+		Users:      users,
 		Total:      total,
-		Page:       page,
-		PageSize:   pageSize,
-		TotalPages: totalPages,
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+		TotalPages: query.TotalPages(total),
 	}
 }
 
 // DisableUser 禁用用户
 func (m *UserManager) DisableUser(userID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	m.disabledUsers[userID] = true
-	if user, ok := m.users[userID]; ok {
-		user.IsDisabled = true
-	}
-	return nil
+	ctx, cancel := storeContext()
+	defer cancel()
+	return m.store.SetUserDisabled(ctx, userID, true)
 }
 
 // EnableUser 启用用户
 func (m *UserManager) EnableUser(userID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	delete(m.disabledUsers, userID)
-	if user, ok := m.users[userID]; ok {
-		user.IsDisabled = false
-	}
-	return nil
+	ctx, cancel := storeContext()
+	defer cancel()
+	return m.store.SetUserDisabled(ctx, userID, false)
 }
 
 // IsUserDisabled 检查用户是否被禁用
 func (m *UserManager) IsUserDisabled(userID string) bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	ctx, cancel := storeContext()
+	defer cancel()
 
-	return m.disabledUsers[userID]
+	disabled, err := m.store.IsUserDisabled(ctx, userID)
+	logStoreError("check user disabled", err)
+	return disabled
 }
 
-// SetUserAdmin 设置管理员权限
+// SetUserAdmin 设置管理员权限，取消时同时移除后台角色
 func (m *UserManager) SetUserAdmin(userID string, isAdmin bool) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	role := RoleNone
+	if isAdmin {
+		role = RoleAdmin
+	}
+	return m.SetUserRole(userID, role)
+}
+
+// SetUserRole 设置管理后台角色
+func (m *UserManager) SetUserRole(userID string, role Role) error {
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	user, err := m.store.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return m.store.UpdateUser(ctx, userID, UserUpdate{Role: &role})
+}
 
-	if user, ok := m.users[userID]; ok {
-		user.IsAdmin = isAdmin
-		return nil
+// RoleOf 返回用户的管理后台角色，兼容只设置了 is_admin 的用户
+func (m *UserManager) RoleOf(userID string) Role {
+	user := m.GetUser(userID)
+	switch {
+	case user == nil:
+		return RoleNone
+	case user.Role != RoleNone:
+		return user.Role
+	case user.IsAdmin:
+		return RoleAdmin
+	default:
+		return RoleNone
 	}
-	return nil
 }
 
 // GetActiveUsersCount 获取活跃用户数（最近24小时）
 func (m *UserManager) GetActiveUsersCount() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	threshold := time.Now().Add(-24 * time.Hour)
-	count := 0
-	for _, user := range m.users {
-		if user.LastActiveAt.After(threshold) {
-			count++
-		}
-	}
-	return count
+	return m.countActiveSince("count active users", time.Now().Add(-24*time.Hour))
 }
 
 // GetOnlineUsersCount 获取在线用户数（最近5分钟）
 func (m *UserManager) GetOnlineUsersCount() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	threshold := time.Now().Add(-5 * time.Minute)
-	count := 0
-	for _, user := range m.users {
-		if user.LastActiveAt.After(threshold) {
-			count++
-		}
-	}
-	return count
+	return m.countActiveSince("count online users", time.Now().Add(-5*time.Minute))
 }
 
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
-		(len(s) > 0 && len(substr) > 0 && findSubstring(s, substr)))
-}
+func (m *UserManager) countActiveSince(op string, since time.Time) int {
+	ctx, cancel := storeContext()
+	defer cancel()
 
-func findSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
+	count, err := m.store.CountUsersActiveSince(ctx, since)
+	logStoreError(op, err)
+	return count
 }
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aspect-code/codeswitch/sync-service/internal/admin"
@@ -41,11 +44,13 @@ func NewAdminHandlers(
 }
 
 // RegisterAdminRoutes 注册管理后台路由
+// 所有路由至少需要 viewer 角色；运维操作需要 operator，角色管理需要 admin
 func (h *AdminHandlers) RegisterAdminRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
-	// 管理后台路由组（需要管理员权限）
 	adminGroup := router.Group("/admin")
 	adminGroup.Use(authMiddleware)
-	adminGroup.Use(h.adminOnlyMiddleware())
+	adminGroup.Use(h.requireRole(admin.RoleViewer))
+	operator := h.requireRole(admin.RoleOperator)
+	adminOnly := h.requireRole(admin.RoleAdmin)
 	{
 		// 系统监控
 		adminGroup.GET("/system/status", h.getSystemStatus)
@@ -62,14 +67,15 @@ func (h *AdminHandlers) RegisterAdminRoutes(router *gin.RouterGroup, authMiddlew
 		// 用户管理
 		adminGroup.GET("/users", h.listUsers)
 		adminGroup.GET("/users/:id", h.getUser)
-		adminGroup.POST("/users/:id/disable", h.disableUser)
-		adminGroup.POST("/users/:id/enable", h.enableUser)
-		adminGroup.POST("/users/:id/admin", h.setUserAdmin)
+		adminGroup.POST("/users/:id/disable", operator, h.disableUser)
+		adminGroup.POST("/users/:id/enable", operator, h.enableUser)
+		adminGroup.POST("/users/:id/admin", adminOnly, h.setUserAdmin)
+		adminGroup.POST("/users/:id/role", adminOnly, h.setUserRole)
 
 		// 会话管理
 		adminGroup.GET("/sessions", h.listAllSessions)
 		adminGroup.GET("/sessions/:id", h.getSessionDetail)
-		adminGroup.DELETE("/sessions/:id", h.deleteSessionAdmin)
+		adminGroup.DELETE("/sessions/:id", operator, h.deleteSessionAdmin)
 
 		// 在线用户
 		adminGroup.GET("/online", h.getOnlineUsers)
@@ -79,19 +85,27 @@ func (h *AdminHandlers) RegisterAdminRoutes(router *gin.RouterGroup, authMiddlew
 
 		// 告警管理
 		adminGroup.GET("/alert-rules", h.listAlertRules)
-		adminGroup.POST("/alert-rules", h.createAlertRule)
-		adminGroup.PUT("/alert-rules/:id", h.updateAlertRule)
-		adminGroup.DELETE("/alert-rules/:id", h.deleteAlertRule)
+		adminGroup.POST("/alert-rules", operator, h.createAlertRule)
+		adminGroup.PUT("/alert-rules/:id", operator, h.updateAlertRule)
+		adminGroup.DELETE("/alert-rules/:id", operator, h.deleteAlertRule)
 		adminGroup.GET("/alert-history", h.listAlertHistory)
 	}
 }
 
-// adminOnlyMiddleware 管理员权限中间件
-func (h *AdminHandlers) adminOnlyMiddleware() gin.HandlerFunc {
+// requireRole 角色权限中间件：Token 中标记为管理员的用户视为 admin，其余按 UserManager 中的角色判断。
+// 被拒绝的写操作记录为 blocked 审计日志
+func (h *AdminHandlers) requireRole(required admin.Role) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		isAdmin, exists := c.Get("is_admin")
-		if !exists || !isAdmin.(bool) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		role := h.roleOf(c)
+		if !role.Satisfies(required) {
+			if c.Request.Method != http.MethodGet {
+				h.audit(c, "admin.access", "route", c.FullPath(), "blocked", map[string]interface{}{
+					"method":        c.Request.Method,
+					"role":          role,
+					"required_role": required,
+				})
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s role required", required)})
 			c.Abort()
 			return
 		}
@@ -99,6 +113,77 @@ func (h *AdminHandlers) adminOnlyMiddleware() gin.HandlerFunc {
 	}
 }
 
+// roleOf 解析并缓存当前用户的后台角色，被禁用的用户没有任何权限
+func (h *AdminHandlers) roleOf(c *gin.Context) admin.Role {
+	if role, ok := c.Get("admin_role"); ok {
+		return role.(admin.Role)
+	}
+	userID := c.GetString("user_id")
+	role := admin.RoleNone
+	switch {
+	case h.userManager != nil && h.userManager.IsUserDisabled(userID):
+	case c.GetBool("is_admin"):
+		role = admin.RoleAdmin
+	case h.userManager != nil:
+		role = h.userManager.RoleOf(userID)
+	}
+	c.Set("admin_role", role)
+	return role
+}
+
+// audit 记录后台操作，result 为 success / failure / blocked
+func (h *AdminHandlers) audit(c *gin.Context, action, resourceType, resourceID, result string, details map[string]interface{}) {
+	if h.auditService == nil {
+		return
+	}
+	h.auditService.LogAction(
+		c.GetString("user_id"),
+		c.GetString("username"),
+		action,
+		resourceType,
+		resourceID,
+		result,
+		c.ClientIP(),
+		details,
+	)
+}
+
+// auditResult 按操作结果记录审计日志，失败时附带错误信息
+func (h *AdminHandlers) auditResult(c *gin.Context, action, resourceType, resourceID string, err error, details map[string]interface{}) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		details["error"] = err.Error()
+	}
+	h.audit(c, action, resourceType, resourceID, result, details)
+}
+
+// parseListParams 解析统一的分页与排序参数：page、page_size、sort、order（asc / desc，默认 desc）
+func parseListParams(c *gin.Context, fields admin.SortFields) (admin.ListParams, error) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(admin.DefaultPageSize)))
+	params := admin.ListParams{
+		Page:     page,
+		PageSize: pageSize,
+		Sort:     c.Query("sort"),
+	}.Normalize()
+
+	if !fields.Allows(params.Sort) {
+		return params, fmt.Errorf("unsupported sort field %q, expected one of: %s", params.Sort, strings.Join(fields.Names(), ", "))
+	}
+	switch strings.ToLower(c.DefaultQuery("order", "desc")) {
+	case "desc":
+		params.Desc = true
+	case "asc":
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
+	return params, nil
+}
+
 // --- 系统监控 ---
 
 func (h *AdminHandlers) getSystemStatus(c *gin.Context) {
@@ -155,19 +240,18 @@ func (h *AdminHandlers) getUserStats(c *gin.Context) {
 // --- 用户管理 ---
 
 func (h *AdminHandlers) listUsers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	search := c.Query("search")
-	onlyDisabled := c.Query("disabled") == "true"
-
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	params, err := parseListParams(c, admin.UserSortFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	result := h.userManager.ListUsers(page, pageSize, search, onlyDisabled)
+	result := h.userManager.ListUsers(admin.UserQuery{
+		ListParams:   params,
+		Search:       c.Query("search"),
+		OnlyDisabled: c.Query("disabled") == "true",
+		Role:         c.Query("role"),
+	})
 	c.JSON(http.StatusOK, result)
 }
 
@@ -190,7 +274,9 @@ func (h *AdminHandlers) getUser(c *gin.Context) {
 
 func (h *AdminHandlers) disableUser(c *gin.Context) {
 	userID := c.Param("id")
-	if err := h.userManager.DisableUser(userID); err != nil {
+	err := h.userManager.DisableUser(userID)
+	h.auditResult(c, "user.disable", "user", userID, err, nil)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -199,7 +285,9 @@ func (h *AdminHandlers) disableUser(c *gin.Context) {
 
 func (h *AdminHandlers) enableUser(c *gin.Context) {
 	userID := c.Param("id")
-	if err := h.userManager.EnableUser(userID); err != nil {
+	err := h.userManager.EnableUser(userID)
+	h.auditResult(c, "user.enable", "user", userID, err, nil)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -216,30 +304,68 @@ func (h *AdminHandlers) setUserAdmin(c *gin.Context) {
 		return
 	}
 
-	if err := h.userManager.SetUserAdmin(userID, req.IsAdmin); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := h.userManager.SetUserAdmin(userID, req.IsAdmin)
+	h.auditResult(c, "user.set_admin", "user", userID, err, map[string]interface{}{"is_admin": req.IsAdmin})
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "admin status updated"})
 }
 
-// --- 会话管理 ---
+func (h *AdminHandlers) setUserRole(c *gin.Context) {
+	userID := c.Param("id")
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := admin.ParseRole(req.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 避免管理员误操作后无人可管理角色
+	if userID == c.GetString("user_id") && role != admin.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot change your own admin role"})
+		return
+	}
 
-func (h *AdminHandlers) listAllSessions(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	userIDFilter := c.Query("user_id")
+	err = h.userManager.SetUserRole(userID, role)
+	h.auditResult(c, "user.set_role", "user", userID, err, map[string]interface{}{"role": role})
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
-	if page < 1 {
-		page = 1
+	c.JSON(http.StatusOK, gin.H{"message": "role updated", "role": role})
+}
+
+// userErrorStatus 用户不存在返回 404，其余为 500
+func userErrorStatus(err error) int {
+	if errors.Is(err, admin.ErrUserNotFound) {
+		return http.StatusNotFound
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	return http.StatusInternalServerError
+}
+
+// --- 会话管理 ---
+
+func (h *AdminHandlers) listAllSessions(c *gin.Context) {
+	params, err := parseListParams(c, admin.SessionSortFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	// Get sessions from stats service (which tracks all sessions)
-	result := h.statsService.GetAllSessions(page, pageSize, userIDFilter)
+	result := h.statsService.GetAllSessions(admin.SessionQuery{
+		ListParams: params,
+		UserID:     c.Query("user_id"),
+	})
 	c.JSON(http.StatusOK, result)
 }
 
@@ -258,29 +384,15 @@ func (h *AdminHandlers) getSessionDetail(c *gin.Context) {
 
 func (h *AdminHandlers) deleteSessionAdmin(c *gin.Context) {
 	sessionID := c.Param("id")
-	adminUserID := c.GetString("user_id")
-	adminUsername := c.GetString("username")
 
 	// Delete session via stats service
-	if err := h.statsService.DeleteSession(sessionID); err != nil {
+	err := h.statsService.DeleteSession(sessionID)
+	h.auditResult(c, "session.delete", "session", sessionID, err, nil)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Log the admin action
-	if h.auditService != nil {
-		h.auditService.LogAction(
-			adminUserID,
-			adminUsername,
-			"session.delete",
-			"session",
-			sessionID,
-			"success",
-			c.ClientIP(),
-			nil,
-		)
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "session deleted"})
 }
 
@@ -299,40 +411,47 @@ func (h *AdminHandlers) getOnlineUsers(c *gin.Context) {
 // --- 操作日志 ---
 
 func (h *AdminHandlers) getAuditLogs(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	userID := c.Query("user_id")
-	action := c.Query("action")
-	result := c.Query("result")
+	params, err := parseListParams(c, admin.AuditLogSortFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if h.auditService == nil {
 		c.JSON(http.StatusOK, gin.H{
-			"logs":      []interface{}{},
-			"total":     0,
-			"page":      page,
-			"page_size": pageSize,
+			"logs":        []interface{}{},
+			"total":       0,
+			"page":        params.Page,
+			"page_size":   params.PageSize,
+			"total_pages": 0,
 		})
 		return
 	}
 
 	query := admin.AuditLogQuery{
-		UserID:   userID,
-		Action:   action,
-		Result:   result,
-		Page:     page,
-		PageSize: pageSize,
+		UserID:       c.Query("user_id"),
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		Result:       c.Query("result"),
+		ListParams:   params,
 	}
 
 	// Parse time filters if provided
 	if startTime := c.Query("start_time"); startTime != "" {
-		if t, err := parseTime(startTime); err == nil {
-			query.StartTime = &t
+		t, err := parseTime(startTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_time, expected RFC3339"})
+			return
 		}
+		query.StartTime = &t
 	}
 	if endTime := c.Query("end_time"); endTime != "" {
-		if t, err := parseTime(endTime); err == nil {
-			query.EndTime = &t
+		t, err := parseTime(endTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_time, expected RFC3339"})
+			return
 		}
+		query.EndTime = &t
 	}
 
 	response := h.auditService.Query(query)
@@ -373,25 +492,11 @@ func (h *AdminHandlers) createAlertRule(c *gin.Context) {
 
 	created, err := h.alertService.CreateRule(rule)
 	if err != nil {
+		h.auditResult(c, "alert.rule.create", "alert_rule", "", err, map[string]interface{}{"name": rule.Name})
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Log the admin action
-	if h.auditService != nil {
-		adminUserID := c.GetString("user_id")
-		adminUsername := c.GetString("username")
-		h.auditService.LogAction(
-			adminUserID,
-			adminUsername,
-			"alert.rule.create",
-			"alert_rule",
-			created.ID,
-			"success",
-			c.ClientIP(),
-			map[string]interface{}{"name": rule.Name},
-		)
-	}
+	h.auditResult(c, "alert.rule.create", "alert_rule", created.ID, nil, map[string]interface{}{"name": rule.Name})
 
 	c.JSON(http.StatusCreated, created)
 }
@@ -411,27 +516,12 @@ func (h *AdminHandlers) updateAlertRule(c *gin.Context) {
 	}
 
 	updated, err := h.alertService.UpdateRule(ruleID, updates)
+	h.auditResult(c, "alert.rule.update", "alert_rule", ruleID, err, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Log the admin action
-	if h.auditService != nil {
-		adminUserID := c.GetString("user_id")
-		adminUsername := c.GetString("username")
-		h.auditService.LogAction(
-			adminUserID,
-			adminUsername,
-			"alert.rule.update",
-			"alert_rule",
-			ruleID,
-			"success",
-			c.ClientIP(),
-			nil,
-		)
-	}
-
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -443,43 +533,39 @@ func (h *AdminHandlers) deleteAlertRule(c *gin.Context) {
 
 	ruleID := c.Param("id")
 
-	if err := h.alertService.DeleteRule(ruleID); err != nil {
+	err := h.alertService.DeleteRule(ruleID)
+	h.auditResult(c, "alert.rule.delete", "alert_rule", ruleID, err, nil)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Log the admin action
-	if h.auditService != nil {
-		adminUserID := c.GetString("user_id")
-		adminUsername := c.GetString("username")
-		h.auditService.LogAction(
-			adminUserID,
-			adminUsername,
-			"alert.rule.delete",
-			"alert_rule",
-			ruleID,
-			"success",
-			c.ClientIP(),
-			nil,
-		)
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "rule deleted"})
 }
 
 func (h *AdminHandlers) listAlertHistory(c *gin.Context) {
+	params, err := parseListParams(c, admin.AlertHistorySortFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if h.alertService == nil {
 		c.JSON(http.StatusOK, gin.H{
-			"history": []interface{}{},
-			"total":   0,
+			"history":     []interface{}{},
+			"total":       0,
+			"page":        params.Page,
+			"page_size":   params.PageSize,
+			"total_pages": 0,
 		})
 		return
 	}
 
-	severity := c.Query("severity")
-	status := c.Query("status")
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-
-	response := h.alertService.ListHistory(severity, status, limit)
+	response := h.alertService.ListHistory(admin.AlertHistoryQuery{
+		ListParams: params,
+		RuleID:     c.Query("rule_id"),
+		Severity:   c.Query("severity"),
+		Status:     c.Query("status"),
+	})
 	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/admin"
+	"github.com/aspect-code/codeswitch/sync-service/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// openTestAdminStore 在临时 SQLite 数据库上创建管理后台存储
+func openTestAdminStore(t *testing.T) *admin.SQLStore {
+	t.Helper()
+	db, err := storage.Open(storage.Config{DSN: filepath.Join(t.TempDir(), "admin.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := admin.NewSQLStore(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// newTestAdminRouter 注册管理后台路由，认证中间件从 X-User / X-Admin 请求头读取用户，
+// 用户与审计日志保存在临时 SQLite 数据库中
+func newTestAdminRouter(t *testing.T) (*gin.Engine, *admin.UserManager, *admin.AuditService) {
+	t.Helper()
+	store := openTestAdminStore(t)
+	users := admin.NewUserManager(store)
+	audit := admin.NewAuditService(store)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auth := func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+		c.Set("is_admin", c.GetHeader("X-Admin") == "true")
+	}
+	handlers := NewAdminHandlers(nil, nil, users, audit, nil, "test")
+	handlers.RegisterAdminRoutes(router.Group("/api/v1"), auth)
+	return router, users, audit
+}
+
+func doAdmin(router *gin.Engine, method, path, user, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/v1/admin"+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRoutesEnforceRoles(t *testing.T) {
+	router, users, _ := newTestAdminRouter(t)
+	for id, role := range map[string]admin.Role{
+		"viewer":   admin.RoleViewer,
+		"operator": admin.RoleOperator,
+		"admin":    admin.RoleAdmin,
+		"target":   admin.RoleNone,
+		"plain":    admin.RoleNone,
+	} {
+		users.RegisterUser(id, id, "", false)
+		if err := users.SetUserRole(id, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 只设置了 is_admin 的旧数据视为 admin
+	users.RegisterUser("legacy", "legacy", "", true)
+
+	cases := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"no role cannot read", "plain", http.MethodGet, "/users", "", http.StatusForbidden},
+		{"unknown user cannot read", "ghost", http.MethodGet, "/users", "", http.StatusForbidden},
+		{"viewer reads users", "viewer", http.MethodGet, "/users", "", http.StatusOK},
+		{"viewer reads audit logs", "viewer", http.MethodGet, "/audit-logs", "", http.StatusOK},
+		{"viewer cannot disable", "viewer", http.MethodPost, "/users/target/disable", "", http.StatusForbidden},
+		{"operator disables", "operator", http.MethodPost, "/users/target/disable", "", http.StatusOK},
+		{"operator enables", "operator", http.MethodPost, "/users/target/enable", "", http.StatusOK},
+		{"operator cannot set roles", "operator", http.MethodPost, "/users/target/role", `{"role":"viewer"}`, http.StatusForbidden},
+		{"operator cannot grant admin", "operator", http.MethodPost, "/users/target/admin", `{"is_admin":true}`, http.StatusForbidden},
+		{"admin sets role", "admin", http.MethodPost, "/users/target/role", `{"role":"viewer"}`, http.StatusOK},
+		{"legacy admin sets role", "legacy", http.MethodPost, "/users/target/role", `{"role":"operator"}`, http.StatusOK},
+		{"admin rejects unknown role", "admin", http.MethodPost, "/users/target/role", `{"role":"root"}`, http.StatusBadRequest},
+		{"admin cannot demote self", "admin", http.MethodPost, "/users/admin/role", `{"role":"viewer"}`, http.StatusBadRequest},
+		{"admin role for missing user", "admin", http.MethodPost, "/users/ghost/role", `{"role":"viewer"}`, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := doAdmin(router, tc.method, tc.path, tc.user, tc.body); w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+	if role := users.RoleOf("target"); role != admin.RoleOperator {
+		t.Fatalf("target role = %q", role)
+	}
+}
+
+func TestAdminTokenAndDisabledUsers(t *testing.T) {
+	router, users, _ := newTestAdminRouter(t)
+	users.RegisterUser("u1", "u1", "", false)
+	users.RegisterUser("target", "target", "", false)
+
+	// Token 中标记为管理员的用户无需在后台设置角色
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/target/role", strings.NewReader(`{"role":"operator"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", "u1")
+	req.Header.Set("X-Admin", "true")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("token admin status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// 被禁用的用户失去全部权限
+	if err := users.DisableUser("target"); err != nil {
+		t.Fatal(err)
+	}
+	if w := doAdmin(router, http.MethodGet, "/users", "target", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("disabled operator status = %d", w.Code)
+	}
+}
+
+func TestAdminAuditsMutations(t *testing.T) {
+	router, users, audit := newTestAdminRouter(t)
+	users.RegisterUser("viewer", "viewer", "", false)
+	users.RegisterUser("operator", "operator", "", false)
+	users.SetUserRole("viewer", admin.RoleViewer)
+	users.SetUserRole("operator", admin.RoleOperator)
+
+	doAdmin(router, http.MethodGet, "/users/operator", "plain", "") // 被拒绝的读操作不记录
+	doAdmin(router, http.MethodPost, "/users/operator/disable", "viewer", "")
+	doAdmin(router, http.MethodPost, "/users/viewer/disable", "operator", "")
+
+	logs := audit.Query(admin.AuditLogQuery{ListParams: admin.ListParams{Sort: "created_at"}}).Logs
+	if len(logs) != 2 {
+		t.Fatalf("audit logs = %+v", logs)
+	}
+	byResult := map[string]admin.AuditLog{}
+	for _, log := range logs {
+		byResult[log.Result] = log
+	}
+	blocked := byResult["blocked"]
+	if blocked.UserID != "viewer" || blocked.Action != "admin.access" || blocked.ResourceID != "/api/v1/admin/users/:id/disable" ||
+		blocked.Details["required_role"] != string(admin.RoleOperator) {
+		t.Fatalf("blocked entry = %+v", blocked)
+	}
+	if success := byResult["success"]; success.UserID != "operator" || success.Action != "user.disable" || success.ResourceID != "viewer" {
+		t.Fatalf("success entry = %+v", success)
+	}
+}
+
+func TestAdminListParams(t *testing.T) {
+	router, users, _ := newTestAdminRouter(t)
+	users.RegisterUser("admin", "admin", "", true)
+	for _, id := range []string{"carol", "bob", "alice"} {
+		users.RegisterUser(id, id, "", false)
+	}
+
+	cases := []struct {
+		query     string
+		want      int
+		wantUsers []string
+		wantPages int
+	}{
+		{"?sort=username&order=asc&page_size=2", http.StatusOK, []string{"admin", "alice"}, 2},
+		{"?sort=username&order=asc&page=2&page_size=2", http.StatusOK, []string{"bob", "carol"}, 2},
+		{"?sort=username&page_size=1000", http.StatusOK, []string{"carol", "bob", "alice", "admin"}, 1},
+		{"?role=admin", http.StatusOK, []string{"admin"}, 1},
+		{"?sort=password", http.StatusBadRequest, nil, 0},
+		{"?order=sideways", http.StatusBadRequest, nil, 0},
+	}
+	for _, tc := range cases {
+		w := doAdmin(router, http.MethodGet, "/users"+tc.query, "admin", "")
+		if w.Code != tc.want {
+			t.Fatalf("%s: status = %d: %s", tc.query, w.Code, w.Body.String())
+		}
+		if tc.want != http.StatusOK {
+			continue
+		}
+		var resp admin.UserListResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, u := range resp.Users {
+			got = append(got, u.UserID)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.wantUsers, ",") || resp.TotalPages != tc.wantPages {
+			t.Errorf("%s: users = %v, pages = %d", tc.query, got, resp.TotalPages)
+		}
+	}
+}
@@ -26,6 +26,9 @@ func NewBillingHandlers(billingService *admin.BillingService, auditService *admi
 
 // RegisterBillingRoutes registers billing routes
 func (h *BillingHandlers) RegisterBillingRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	// Provider webhooks (verified by signature)
+	h.registerWebhookRoutes(router)
+
 	// Billing routes (require authentication)
 	billingGroup := router.Group("/billing")
 	billingGroup.Use(authMiddleware)
@@ -54,6 +57,9 @@ func (h *BillingHandlers) RegisterBillingRoutes(router *gin.RouterGroup, authMid
 		billingGroup.POST("/payments/:id/refund", h.refundPayment)
 		billingGroup.POST("/payments/:id/confirm", h.confirmPayment)
 
+		// Invoices
+		h.registerInvoiceRoutes(billingGroup)
+
 		// Configuration (admin only)
 		billingGroup.GET("/config", h.adminOnly(), h.getConfig)
 		billingGroup.PUT("/config", h.adminOnly(), h.updateConfig)
@@ -362,6 +368,9 @@ func (h *BillingHandlers) getConfig(c *gin.Context) {
 	if maskedConfig.LagoAPIKey != "" {
 		maskedConfig.LagoAPIKey = "***"
 	}
+	if maskedConfig.LagoWebhookSecret != "" {
+		maskedConfig.LagoWebhookSecret = "***"
+	}
 	if maskedConfig.AlipayPrivateKey != "" {
 		maskedConfig.AlipayPrivateKey = "***"
 	}
@@ -392,6 +401,9 @@ func (h *BillingHandlers) updateConfig(c *gin.Context) {
 	if config.LagoAPIKey == "" || config.LagoAPIKey == "***" {
 		config.LagoAPIKey = existingConfig.LagoAPIKey
 	}
+	if config.LagoWebhookSecret == "" || config.LagoWebhookSecret == "***" {
+		config.LagoWebhookSecret = existingConfig.LagoWebhookSecret
+	}
 	if config.AlipayPrivateKey == "" || config.AlipayPrivateKey == "***" {
 		config.AlipayPrivateKey = existingConfig.AlipayPrivateKey
 	}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// registerInvoiceRoutes registers invoice routes. Non-admin users only see their own invoices.
+func (h *BillingHandlers) registerInvoiceRoutes(billingGroup *gin.RouterGroup) {
+	billingGroup.GET("/invoices", h.listInvoices)
+	billingGroup.GET("/invoices/:id", h.getInvoice)
+	billingGroup.GET("/invoices/:id/pdf", h.downloadInvoice)
+	billingGroup.POST("/payments/:id/invoice", h.adminOnly(), h.issueInvoice)
+}
+
+func (h *BillingHandlers) listInvoices(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	userID := c.Query("user_id")
+	if !c.GetBool("is_admin") {
+		userID = c.GetString("user_id")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var startTime, endTime *time.Time
+	if st := c.Query("start_time"); st != "" {
+		if t, err := time.Parse(time.RFC3339, st); err == nil {
+			startTime = &t
+		}
+	}
+	if et := c.Query("end_time"); et != "" {
+		if t, err := time.Parse(time.RFC3339, et); err == nil {
+			endTime = &t
+		}
+	}
+
+	result := h.billingService.ListInvoices(page, pageSize, userID, startTime, endTime)
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *BillingHandlers) getInvoice(c *gin.Context) {
+	invoice, err := h.billingService.GetInvoice(c.Param("id"))
+	if err != nil || !canViewInvoice(c, invoice) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+		return
+	}
+	c.JSON(http.StatusOK, invoice)
+}
+
+func (h *BillingHandlers) downloadInvoice(c *gin.Context) {
+	invoice, pdf, err := h.billingService.GetInvoicePDF(c.Param("id"))
+	if err != nil || !canViewInvoice(c, invoice) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+func (h *BillingHandlers) issueInvoice(c *gin.Context) {
+	id := c.Param("id")
+	invoice, err := h.billingService.IssuePaymentInvoice(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logAction(c, "invoice.issue", "payment", id, "success", map[string]interface{}{
+		"invoice_id": invoice.ID,
+		"number":     invoice.Number,
+	})
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// canViewInvoice reports whether the caller is an admin or the invoice owner
+func canViewInvoice(c *gin.Context, invoice *models.Invoice) bool {
+	return c.GetBool("is_admin") || invoice.UserID == c.GetString("user_id")
+}
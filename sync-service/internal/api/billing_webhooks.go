@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/admin"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBody limits webhook payloads read into memory
+const maxWebhookBody = 1 << 20
+
+// registerWebhookRoutes registers provider callbacks. They are authenticated by
+// signature instead of a user token, so they sit outside the authenticated group.
+func (h *BillingHandlers) registerWebhookRoutes(router *gin.RouterGroup) {
+	webhooks := router.Group("/billing/webhooks")
+	{
+		webhooks.POST("/lago", h.lagoWebhook)
+		webhooks.POST("/alipay", h.alipayNotify)
+		webhooks.POST("/wechat", h.wechatNotify)
+	}
+}
+
+func (h *BillingHandlers) lagoWebhook(c *gin.Context) {
+	body, err := readWebhookBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.billingService.HandleLagoWebhook(body, c.GetHeader("X-Lago-Signature"), c.GetHeader("X-Lago-Unique-Key"))
+	h.logWebhook(c, admin.WebhookProviderLago, result, err)
+	if err != nil {
+		// Non-2xx responses make Lago retry the delivery
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// alipayNotify handles Alipay asynchronous notifications; Alipay retries until the body is "success"
+func (h *BillingHandlers) alipayNotify(c *gin.Context) {
+	body, err := readWebhookBody(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, "fail")
+		return
+	}
+
+	result, err := h.billingService.HandlePaymentNotification(models.PaymentMethodAlipay, body)
+	h.logWebhook(c, admin.WebhookProviderAlipay, result, err)
+	if err != nil {
+		c.String(webhookErrorStatus(err), "fail")
+		return
+	}
+	c.String(http.StatusOK, "success")
+}
+
+// wechatNotify handles WeChat Pay v3 notifications; WeChat retries on non-2xx responses
+func (h *BillingHandlers) wechatNotify(c *gin.Context) {
+	body, err := readWebhookBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "FAIL", "message": err.Error()})
+		return
+	}
+
+	result, err := h.billingService.HandlePaymentNotification(models.PaymentMethodWechat, body)
+	h.logWebhook(c, admin.WebhookProviderWechat, result, err)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"code": "FAIL", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "SUCCESS", "message": "OK"})
+}
+
+func readWebhookBody(c *gin.Context) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, admin.ErrWebhookSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, admin.ErrWebhookNotConfigured):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// logWebhook records reconciled and rejected webhooks in the audit log; duplicates are skipped
+func (h *BillingHandlers) logWebhook(c *gin.Context, provider string, result *admin.WebhookResult, err error) {
+	if err != nil {
+		h.logAction(c, "billing.webhook."+provider, "webhook", "", "failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if result.Duplicate {
+		return
+	}
+	h.logAction(c, "billing.webhook."+provider, "webhook", result.EventID, "success", map[string]interface{}{
+		"event_type": result.EventType,
+		"resource":   result.Resource,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/admin"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestWebhookRouter 注册计费 webhook 路由，计费配置与审计日志保存在临时目录中
+func newTestWebhookRouter(t *testing.T, config models.BillingConfig) (*gin.Engine, *admin.AuditService) {
+	t.Helper()
+	store := openTestAdminStore(t)
+	billing := admin.NewBillingService(filepath.Join(t.TempDir(), "billing-config.json"), store)
+	if err := billing.UpdateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	audit := admin.NewAuditService(store)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewBillingHandlers(billing, audit).registerWebhookRoutes(router.Group("/api/v1"))
+	return router, audit
+}
+
+func postWebhook(router *gin.Engine, provider, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/billing/webhooks/"+provider, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLagoWebhookEndpoint(t *testing.T) {
+	router, audit := newTestWebhookRouter(t, models.BillingConfig{LagoWebhookSecret: "whsec"})
+	payload := `{"webhook_type":"subscription.started","subscription":{"lago_id":"ls1","status":"active"}}`
+	mac := hmac.New(sha256.New, []byte("whsec"))
+	mac.Write([]byte(payload))
+	signed := map[string]string{
+		"X-Lago-Signature":  base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		"X-Lago-Unique-Key": "evt-1",
+	}
+
+	if w := postWebhook(router, "lago", payload, map[string]string{"X-Lago-Signature": "forged"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("forged status = %d", w.Code)
+	}
+	w := postWebhook(router, "lago", payload, signed)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"event_id":"evt-1"`) {
+		t.Fatalf("signed status = %d: %s", w.Code, w.Body.String())
+	}
+	// 重复投递同样返回 200，避免 Lago 继续重试
+	w = postWebhook(router, "lago", payload, signed)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duplicate":true`) {
+		t.Fatalf("redelivery status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// 伪造的请求与首次处理记入审计日志，重复投递不记录
+	logs := audit.Query(admin.AuditLogQuery{Action: "billing.webhook.lago", ListParams: admin.ListParams{Sort: "created_at"}}).Logs
+	byResult := map[string][]admin.AuditLog{}
+	for _, log := range logs {
+		byResult[log.Result] = append(byResult[log.Result], log)
+	}
+	if len(logs) != 2 || len(byResult["failed"]) != 1 || len(byResult["success"]) != 1 {
+		t.Fatalf("audit logs = %+v", logs)
+	}
+	if success := byResult["success"][0]; success.ResourceID != "evt-1" || success.Details["event_type"] != "subscription.started" {
+		t.Fatalf("success entry = %+v", success)
+	}
+}
+
+func TestPaymentNotifyEndpoints(t *testing.T) {
+	router, _ := newTestWebhookRouter(t, models.BillingConfig{})
+	if w := postWebhook(router, "lago", "{}", nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unconfigured lago status = %d", w.Code)
+	}
+	// 支付宝以响应体是否为 success 判断，微信支付以状态码与 code 判断
+	if w := postWebhook(router, "alipay", "out_trade_no=PAY1", nil); w.Code != http.StatusServiceUnavailable || w.Body.String() != "fail" {
+		t.Fatalf("unconfigured alipay = %d %s", w.Code, w.Body.String())
+	}
+	if w := postWebhook(router, "wechat", "{}", nil); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"code":"FAIL"`) {
+		t.Fatalf("unconfigured wechat = %d %s", w.Code, w.Body.String())
+	}
+
+	router, _ = newTestWebhookRouter(t, models.BillingConfig{
+		WechatAppID:    "wx1",
+		WechatMchID:    "1900000001",
+		WechatAPIKeyV3: "0123456789abcdef0123456789abcdef",
+	})
+	body := `{"id":"e1","event_type":"TRANSACTION.SUCCESS","resource":{"algorithm":"AEAD_AES_256_GCM",
+		"ciphertext":"Zm9yZ2Vk","associated_data":"transaction","nonce":"0123456789ab"}}`
+	if w := postWebhook(router, "wechat", body, nil); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"code":"FAIL"`) {
+		t.Fatalf("forged wechat = %d %s", w.Code, w.Body.String())
+	}
+	if w := postWebhook(router, "wechat", "not json", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("malformed wechat = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/admin"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsConfig 监控端点配置
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"` // 是否暴露 Prometheus 指标
+	Path    string `yaml:"path"`    // 指标路径，默认 /metrics
+	Pprof   bool   `yaml:"pprof"`   // 是否开启 /debug/pprof（需管理员 Token）
+}
+
+// DefaultMetricsConfig 默认开启指标，关闭 pprof
+func DefaultMetricsConfig() MetricsConfig {
+	return MetricsConfig{
+		Enabled: true,
+		Path:    "/metrics",
+	}
+}
+
+// 认证失败原因，用于 codeswitch_sync_auth_failures_total 的 reason 标签
+const (
+	authFailureMissingToken = "missing_token"
+	authFailureInvalidToken = "invalid_token"
+	authFailureLogin        = "login"
+	authFailureRefresh      = "refresh"
+)
+
+// setupObservability 注册指标与 pprof 路由
+func (s *Server) setupObservability() {
+	if s.metricsConfig.Enabled {
+		path := s.metricsConfig.Path
+		if path == "" {
+			path = "/metrics"
+		}
+		// Prometheus metrics（公开访问）
+		s.router.GET(path, s.metricsHandler)
+	}
+
+	if s.metricsConfig.Pprof {
+		// 性能分析会暴露内部状态，仅限管理员
+		debug := s.router.Group("/debug/pprof", s.authMiddleware(), s.adminHandlers.requireRole(admin.RoleAdmin))
+		debug.GET("/", gin.WrapF(pprof.Index))
+		debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		debug.GET("/profile", gin.WrapF(pprof.Profile))
+		debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+		debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+		debug.GET("/trace", gin.WrapF(pprof.Trace))
+		// heap、goroutine、allocs 等命名 profile 由 Index 按路径分发
+		debug.GET("/:profile", gin.WrapF(pprof.Index))
+		s.logger.Warn("pprof endpoints enabled", "path", "/debug/pprof")
+	}
+}
+
+func (s *Server) metricsHandler(c *gin.Context) {
+	metrics := s.adminHandlers.metricsExporter.Export()
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(metrics))
+}
+
+// recordAuthFailure 统计认证失败
+func (s *Server) recordAuthFailure(reason string) {
+	if s.monitorService != nil {
+		s.monitorService.RecordAuthFailure(reason)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/admin"
+	"github.com/aspect-code/codeswitch/sync-service/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+var testJWTConfig = &auth.JWTConfig{
+	Secret:          "test-secret",
+	Issuer:          "codeswitch-sync-test",
+	AccessTokenTTL:  time.Hour,
+	RefreshTokenTTL: time.Hour,
+}
+
+// newTestServer 创建使用临时存储的 API 服务器，不依赖 NATS 与 NEW-API
+func newTestServer(t *testing.T, metrics MetricsConfig) (*Server, *admin.UserManager) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store := openTestAdminStore(t)
+	users := admin.NewUserManager(store)
+	authService := auth.NewService(testJWTConfig, &auth.NewAPIConfig{}, discardLogger())
+	s := NewServer(authService, nil, nil, nil, nil, admin.NewMonitorService(), users, admin.NewAuditService(store),
+		nil, nil, nil, metrics, discardLogger(), "test", "v-test")
+	return s, users
+}
+
+func testToken(t *testing.T, userID string, isAdmin bool) string {
+	t.Helper()
+	token, err := auth.NewJWTManager(testJWTConfig).GenerateAccessToken(userID, userID, "d1", isAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func serve(s *Server, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	s, _ := newTestServer(t, DefaultMetricsConfig())
+
+	serve(s, http.MethodGet, "/health", "")
+	serve(s, http.MethodGet, "/api/v1/user/me", "")
+	serve(s, http.MethodGet, "/api/v1/user/me", "not-a-jwt")
+	serve(s, http.MethodGet, "/missing", "")
+
+	w := serve(s, http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("metrics status = %d, content type = %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	out := w.Body.String()
+	for _, line := range []string{
+		`codeswitch_sync_info{version="v-test"`,
+		"codeswitch_sync_connected_devices 0\n",
+		`codeswitch_sync_auth_failures_total{reason="missing_token"} 1` + "\n",
+		`codeswitch_sync_auth_failures_total{reason="invalid_token"} 1` + "\n",
+		`codeswitch_sync_http_request_duration_seconds_count{method="GET",route="/health",status="200"} 1` + "\n",
+		`codeswitch_sync_http_request_duration_seconds_count{method="GET",route="/api/v1/user/me",status="401"} 2` + "\n",
+		`codeswitch_sync_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("metrics missing %q", line)
+		}
+	}
+
+	// 默认不开启 pprof
+	if w := serve(s, http.MethodGet, "/debug/pprof/", testToken(t, "root", true)); w.Code != http.StatusNotFound {
+		t.Fatalf("pprof without config status = %d", w.Code)
+	}
+}
+
+func TestMetricsConfig(t *testing.T) {
+	s, _ := newTestServer(t, MetricsConfig{Enabled: true, Path: "/internal/metrics"})
+	if w := serve(s, http.MethodGet, "/internal/metrics", ""); w.Code != http.StatusOK {
+		t.Fatalf("custom path status = %d", w.Code)
+	}
+	if w := serve(s, http.MethodGet, "/metrics", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("default path status = %d", w.Code)
+	}
+
+	s, _ = newTestServer(t, MetricsConfig{})
+	if w := serve(s, http.MethodGet, "/metrics", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("disabled metrics status = %d", w.Code)
+	}
+}
+
+func TestPprofRequiresAdmin(t *testing.T) {
+	s, users := newTestServer(t, MetricsConfig{Pprof: true})
+	users.RegisterUser("operator", "operator", "", false)
+	users.SetUserRole("operator", admin.RoleOperator)
+	users.RegisterUser("granted", "granted", "", false)
+	users.SetUserRole("granted", admin.RoleAdmin)
+
+	cases := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"no token", "/debug/pprof/", "", http.StatusUnauthorized},
+		{"invalid token", "/debug/pprof/", "bogus", http.StatusUnauthorized},
+		{"operator", "/debug/pprof/", testToken(t, "operator", false), http.StatusForbidden},
+		{"token admin", "/debug/pprof/", testToken(t, "root", true), http.StatusOK},
+		{"role admin", "/debug/pprof/cmdline", testToken(t, "granted", false), http.StatusOK},
+		{"named profile", "/debug/pprof/goroutine?debug=1", testToken(t, "root", true), http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := serve(s, http.MethodGet, tc.path, tc.token); w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+
+	w := serve(s, http.MethodGet, "/debug/pprof/goroutine?debug=1", testToken(t, "root", true))
+	if !strings.Contains(w.Body.String(), "goroutine profile:") {
+		t.Fatalf("goroutine profile = %.200s", w.Body.String())
+	}
+}
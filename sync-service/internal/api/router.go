@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +35,8 @@ type Server struct {
 	billingService  *admin.BillingService
 	adminHandlers   *AdminHandlers
 	billingHandlers *BillingHandlers
+	wsHandler       *WSHandler
+	metricsConfig   MetricsConfig
 	version         string
 }
 
@@ -47,6 +52,8 @@ func NewServer(
 	auditService *admin.AuditService,
 	alertService *admin.AlertService,
 	billingService *admin.BillingService,
+	wsHub *WSHub,
+	metricsConfig MetricsConfig,
 	logger *slog.Logger,
 	mode string,
 	version string,
@@ -67,6 +74,7 @@ func NewServer(
 		auditService:    auditService,
 		alertService:    alertService,
 		billingService:  billingService,
+		metricsConfig:   metricsConfig,
 		logger:          logger,
 		version:         version,
 	}
@@ -77,6 +85,9 @@ func NewServer(
 	// 创建计费处理器
 	s.billingHandlers = NewBillingHandlers(billingService, auditService)
 
+	// 创建实时推送处理器
+	s.wsHandler = NewWSHandler(wsHub, logger)
+
 	s.setupMiddleware()
 	s.setupRoutes()
 
@@ -94,8 +105,8 @@ func (s *Server) setupRoutes() {
 	s.router.GET("/health", s.healthCheck)
 	s.router.GET("/ready", s.readyCheck)
 
-	// Prometheus metrics（公开访问）
-	s.router.GET("/metrics", s.metricsHandler)
+	// Prometheus metrics 与 pprof
+	s.setupObservability()
 
 	// API v1
 	v1 := s.router.Group("/api/v1")
@@ -104,6 +115,9 @@ func (s *Server) setupRoutes() {
 		v1.POST("/auth/login", s.login)
 		v1.POST("/auth/refresh", s.refreshToken)
 
+		// 实时推送（配置变更、在线状态），浏览器无法设置请求头时可用 ?token= 传递 Token
+		v1.GET("/ws", s.wsAuthMiddleware(), s.wsHandler.HandleWebSocket)
+
 		// 需要认证的路由
 		authorized := v1.Group("")
 		authorized.Use(s.authMiddleware())
@@ -131,6 +145,7 @@ func (s *Server) setupRoutes() {
 
 			// 同步
 			authorized.POST("/sync", s.syncData)
+			authorized.GET("/sync/history", s.getHistory)
 
 			// 在线状态
 			authorized.GET("/presence", s.getMyPresence)
@@ -158,13 +173,25 @@ func (s *Server) loggerMiddleware() gin.HandlerFunc {
 		start := time.Now()
 		path := c.Request.URL.Path
 
+		// WebSocket 连接时长不计入请求指标，在线设备数单独统计
+		observe := s.monitorService != nil && !c.IsWebsocket()
+		if observe {
+			s.monitorService.IncrementActiveRequests()
+		}
+
 		c.Next()
 
+		latency := time.Since(start)
+		if observe {
+			s.monitorService.DecrementActiveRequests()
+			s.monitorService.ObserveAPIRequest(c.Request.Method, c.FullPath(), c.Writer.Status(), latency)
+		}
+
 		s.logger.Info("HTTP Request",
 			"method", c.Request.Method,
 			"path", path,
 			"status", c.Writer.Status(),
-			"latency", time.Since(start),
+			"latency", latency,
 			"ip", c.ClientIP(),
 		)
 	}
@@ -189,25 +216,48 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
+			s.recordAuthFailure(authFailureMissingToken)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
 			c.Abort()
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := s.authService.ValidateToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		s.authenticate(c, strings.TrimPrefix(authHeader, "Bearer "))
+	}
+}
+
+// wsAuthMiddleware WebSocket 认证，Token 取自 Authorization 头或 token 查询参数
+func (s *Server) wsAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = c.Query("token")
+		}
+		if tokenString == "" {
+			s.recordAuthFailure(authFailureMissingToken)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
 			c.Abort()
 			return
 		}
+		s.authenticate(c, tokenString)
+	}
+}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("device_id", claims.DeviceID)
-		c.Set("is_admin", claims.IsAdmin)
-		c.Next()
+// authenticate 校验 JWT 并写入用户信息
+func (s *Server) authenticate(c *gin.Context, tokenString string) {
+	claims, err := s.authService.ValidateToken(tokenString)
+	if err != nil {
+		s.recordAuthFailure(authFailureInvalidToken)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return
 	}
+
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("device_id", claims.DeviceID)
+	c.Set("is_admin", claims.IsAdmin)
+	c.Next()
 }
 
 // --- Handlers ---
@@ -220,11 +270,6 @@ func (s *Server) readyCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ready"})
 }
 
-func (s *Server) metricsHandler(c *gin.Context) {
-	metrics := s.adminHandlers.metricsExporter.Export()
-	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(metrics))
-}
-
 func (s *Server) login(c *gin.Context) {
 	var req models.AuthRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -234,10 +279,17 @@ func (s *Server) login(c *gin.Context) {
 
 	resp, err := s.authService.Login(c.Request.Context(), &req)
 	if err != nil {
+		s.recordAuthFailure(authFailureLogin)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 登记到管理后台，管理员可据此分配后台角色
+	if s.userManager != nil && resp.User != nil {
+		s.userManager.RegisterUser(resp.User.ID, resp.User.Username, resp.User.Email, resp.User.IsAdmin)
+		s.userManager.RecordLogin(resp.User.ID)
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -252,6 +304,7 @@ func (s *Server) refreshToken(c *gin.Context) {
 
 	resp, err := s.authService.RefreshToken(c.Request.Context(), req.RefreshToken)
 	if err != nil {
+		s.recordAuthFailure(authFailureRefresh)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
@@ -474,6 +527,10 @@ func (s *Server) syncData(c *gin.Context) {
 		return
 	}
 	req.UserID = userID
+	scopes := models.DefaultSyncScopes()
+	if req.Scopes != nil {
+		scopes = *req.Scopes
+	}
 
 	sessions := s.sessionManager.GetUserSessions(userID)
 
@@ -497,8 +554,39 @@ func (s *Server) syncData(c *gin.Context) {
 		Messages:   allMessages,
 		ServerTime: time.Now().Unix(),
 		HasMore:    false,
+		Scopes:     scopes,
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// getHistory 回放离线期间错过的会话事件。
+// since_seq 为设备已处理的最后序号；省略时从该设备上次回放确认的位置继续
+func (s *Server) getHistory(c *gin.Context) {
+	var sinceSeq uint64
+	if v := c.Query("since_seq"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since_seq"})
+			return
+		}
+		sinceSeq = seq
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > message.MaxReplayBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", message.MaxReplayBatch)})
+		return
 	}
 
+	resp, err := s.messageHandler.Replay(c.GetString("user_id"), c.GetString("device_id"), sinceSeq, limit)
+	if errors.Is(err, message.ErrHistoryDisabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
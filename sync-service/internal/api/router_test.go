@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/message"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+)
+
+func TestHistoryEndpoint(t *testing.T) {
+	history, _ := newTestHistory(t)
+	for _, session := range []string{"s1", "s2", "s3"} {
+		createTestMessage(t, history, "u1", session)
+	}
+	s, _ := newTestServer(t, DefaultMetricsConfig())
+	s.messageHandler = history
+	token := testToken(t, "u1", false)
+
+	cases := []struct {
+		query    string
+		want     int
+		wantSeqs []uint64
+		hasMore  bool
+	}{
+		{"?since_seq=1", http.StatusOK, []uint64{2, 3}, false},
+		{"?since_seq=1&limit=1", http.StatusOK, []uint64{2}, true},
+		// 省略 since_seq 时从设备上次确认的位置继续
+		{"", http.StatusOK, []uint64{1, 2, 3}, false},
+		{"", http.StatusOK, []uint64{}, false},
+		{"?since_seq=-1", http.StatusBadRequest, nil, false},
+		{"?limit=0", http.StatusBadRequest, nil, false},
+		{"?limit=501", http.StatusBadRequest, nil, false},
+	}
+	for _, tc := range cases {
+		w := serve(s, http.MethodGet, "/api/v1/sync/history"+tc.query, token)
+		if w.Code != tc.want {
+			t.Fatalf("%q: status = %d: %s", tc.query, w.Code, w.Body.String())
+		}
+		if tc.want != http.StatusOK {
+			continue
+		}
+		var resp models.HistoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		seqs := []uint64{}
+		for _, event := range resp.Events {
+			seqs = append(seqs, event.Seq)
+		}
+		if len(seqs) != len(tc.wantSeqs) || resp.HasMore != tc.hasMore {
+			t.Fatalf("%q: seqs = %v, has_more = %v", tc.query, seqs, resp.HasMore)
+		}
+		for i := range seqs {
+			if seqs[i] != tc.wantSeqs[i] {
+				t.Fatalf("%q: seqs = %v", tc.query, seqs)
+			}
+		}
+	}
+
+	// 未启用消息历史
+	s.messageHandler = message.NewHandler(nil, discardLogger())
+	if w := serve(s, http.MethodGet, "/api/v1/sync/history", token); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("history disabled status = %d", w.Code)
+	}
+}
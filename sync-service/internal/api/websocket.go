@@ -1,16 +1,31 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/aspect-code/codeswitch/sync-service/internal/admin"
+	"github.com/aspect-code/codeswitch/sync-service/internal/message"
+	"github.com/aspect-code/codeswitch/sync-service/internal/presence"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
-	"go.uber.org/zap"
+)
+
+const (
+	// wsPingInterval 服务端 ping 间隔，收到 pong 即视为一次在线心跳
+	wsPingInterval = 30 * time.Second
+	// wsReadTimeout 超过该时间没有任何消息（含 pong）则断开
+	wsReadTimeout  = 60 * time.Second
+	wsWriteTimeout = 10 * time.Second
 )
 
 var upgrader = websocket.Upgrader{
@@ -23,14 +38,18 @@ var upgrader = websocket.Upgrader{
 
 // WSClient represents a connected WebSocket client
 type WSClient struct {
-	conn      *websocket.Conn
-	userID    string
-	deviceID  string
-	send      chan []byte
-	hub       *WSHub
-	mu        sync.Mutex
-	closed    bool
-	natsSubs  []*nats.Subscription
+	conn          *websocket.Conn
+	userID        string
+	deviceID      string
+	deviceType    string
+	clientVersion string
+	send          chan []byte
+	hub           *WSHub
+	mu            sync.Mutex
+	closed        bool
+	natsSubs      []*nats.Subscription
+	scopes        models.SyncScopes // 本设备接收的同步类别，受 mu 保护
+	sinceSeq      uint64            // 设备已处理的最后一条会话事件序号，连接后从其后续传
 }
 
 // WSHub manages all WebSocket connections
@@ -40,27 +59,42 @@ type WSHub struct {
 	unregister chan *WSClient
 	broadcast  chan *WSMessage
 	natsConn   *nats.Conn
-	logger     *zap.Logger
+	presence   *presence.Tracker     // 连接期间的 pong 计入在线心跳，可为空
+	history    *message.Handler      // 会话事件经 JetStream 按序投递，可为空
+	monitor    *admin.MonitorService // 在线设备数与推送量指标，可为空
+	logger     *slog.Logger
 	mu         sync.RWMutex
 }
 
 // WSMessage represents a WebSocket message
 type WSMessage struct {
 	Type      string          `json:"type"`
+	Subject   string          `json:"subject,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"` // 会话事件的流序号，重连时作为 since_seq
 	UserID    string          `json:"user_id,omitempty"`
 	DeviceID  string          `json:"device_id,omitempty"`
 	Timestamp time.Time       `json:"timestamp"`
 	Data      json.RawMessage `json:"data"`
 }
 
+// 推送给客户端的消息类型
+const (
+	WSTypeConfigChange = "config_change" // 其他设备的配置变更（user.<id>.sync_<scope>）
+	WSTypePresence     = "presence"      // 设备上线/离线（user.<id>.presence）
+	WSTypeNATS         = "nats"          // 其他用户事件原样转发
+)
+
 // NewWSHub creates a new WebSocket hub
-func NewWSHub(natsConn *nats.Conn, logger *zap.Logger) *WSHub {
+func NewWSHub(natsConn *nats.Conn, presenceTracker *presence.Tracker, history *message.Handler, monitor *admin.MonitorService, logger *slog.Logger) *WSHub {
 	return &WSHub{
 		clients:    make(map[string]map[string]*WSClient),
 		register:   make(chan *WSClient),
 		unregister: make(chan *WSClient),
 		broadcast:  make(chan *WSMessage, 256),
 		natsConn:   natsConn,
+		presence:   presenceTracker,
+		history:    history,
+		monitor:    monitor,
 		logger:     logger,
 	}
 }
@@ -86,13 +120,20 @@ func (h *WSHub) registerClient(client *WSClient) {
 	if h.clients[client.userID] == nil {
 		h.clients[client.userID] = make(map[string]*WSClient)
 	}
+	// 同一设备重连时关闭旧连接，避免重复推送
+	if old, ok := h.clients[client.userID][client.deviceID]; ok {
+		h.detachClient(old)
+	}
 	h.clients[client.userID][client.deviceID] = client
+	h.reportConnectedDevices()
 
 	h.logger.Info("WebSocket client registered",
-		zap.String("user_id", client.userID),
-		zap.String("device_id", client.deviceID),
+		"user_id", client.userID,
+		"device_id", client.deviceID,
 	)
 
+	client.heartbeat()
+
 	// Subscribe to user's NATS subjects
 	h.subscribeClientToNATS(client)
 }
@@ -101,26 +142,47 @@ func (h *WSHub) unregisterClient(client *WSClient) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if devices, ok := h.clients[client.userID]; ok {
-		if _, exists := devices[client.deviceID]; exists {
-			delete(devices, client.deviceID)
-			close(client.send)
+	devices, ok := h.clients[client.userID]
+	// 已被同一设备的新连接替换时无需处理
+	if !ok || devices[client.deviceID] != client {
+		return
+	}
+	delete(devices, client.deviceID)
+	if len(devices) == 0 {
+		delete(h.clients, client.userID)
+	}
+	h.detachClient(client)
+	h.reportConnectedDevices()
 
-			// Unsubscribe from NATS
-			for _, sub := range client.natsSubs {
-				sub.Unsubscribe()
-			}
+	if h.presence != nil {
+		h.presence.SetOffline(client.userID, client.deviceID)
+	}
 
-			h.logger.Info("WebSocket client unregistered",
-				zap.String("user_id", client.userID),
-				zap.String("device_id", client.deviceID),
-			)
+	h.logger.Info("WebSocket client unregistered",
+		"user_id", client.userID,
+		"device_id", client.deviceID,
+	)
+}
 
-			if len(devices) == 0 {
-				delete(h.clients, client.userID)
-			}
-		}
+// reportConnectedDevices 更新在线设备数指标，调用方需持有 h.mu
+func (h *WSHub) reportConnectedDevices() {
+	if h.monitor == nil {
+		return
 	}
+	count := 0
+	for _, devices := range h.clients {
+		count += len(devices)
+	}
+	h.monitor.SetConnectedDevices(count)
+}
+
+// detachClient 取消客户端的 NATS 订阅并关闭发送队列
+func (h *WSHub) detachClient(client *WSClient) {
+	for _, sub := range client.natsSubs {
+		sub.Unsubscribe()
+	}
+	client.natsSubs = nil
+	client.Close()
 }
 
 func (h *WSHub) broadcastMessage(message *WSMessage) {
@@ -132,11 +194,7 @@ func (h *WSHub) broadcastMessage(message *WSMessage) {
 		if devices, ok := h.clients[message.UserID]; ok {
 			data, _ := json.Marshal(message)
 			for _, client := range devices {
-				select {
-				case client.send <- data:
-				default:
-					// Client buffer full, skip
-				}
+				client.push(data)
 			}
 		}
 	}
@@ -146,33 +204,35 @@ func (h *WSHub) subscribeClientToNATS(client *WSClient) {
 	subjects := []string{
 		fmt.Sprintf("billing.%s", client.userID),
 		fmt.Sprintf("user.%s.*", client.userID),
-		fmt.Sprintf("chat.%s.>", client.userID),
+	}
+	if !h.subscribeClientToHistory(client) {
+		subjects = append(subjects, fmt.Sprintf("chat.%s.>", client.userID))
 	}
 
 	for _, subject := range subjects {
 		sub, err := h.natsConn.Subscribe(subject, func(msg *nats.Msg) {
+			payload, ok := client.filterScoped(msg.Subject, msg.Data)
+			if !ok {
+				return
+			}
 			wsMsg := &WSMessage{
-				Type:      "nats",
+				Type:      pushType(msg.Subject),
+				Subject:   msg.Subject,
 				UserID:    client.userID,
 				Timestamp: time.Now(),
-				Data:      msg.Data,
+				Data:      payload,
 			}
 			data, _ := json.Marshal(wsMsg)
-
-			client.mu.Lock()
-			if !client.closed {
-				select {
-				case client.send <- data:
-				default:
-				}
+			client.push(data)
+			if h.monitor != nil {
+				h.monitor.RecordNATSMessage(msg.Subject, "push")
 			}
-			client.mu.Unlock()
 		})
 
 		if err != nil {
 			h.logger.Error("Failed to subscribe to NATS",
-				zap.Error(err),
-				zap.String("subject", subject),
+				"error", err,
+				"subject", subject,
 			)
 			continue
 		}
@@ -181,6 +241,59 @@ func (h *WSHub) subscribeClientToNATS(client *WSClient) {
 	}
 }
 
+// subscribeClientToHistory 通过 JetStream 有序投递会话事件：先补发 sinceSeq 之后错过的事件，再接续实时消息。
+// 发送队列溢出时断开连接，设备以最后收到的序号重连即可无遗漏地续传
+func (h *WSHub) subscribeClientToHistory(client *WSClient) bool {
+	if h.history == nil || !h.history.HistoryEnabled() {
+		return false
+	}
+	sub, err := h.history.SubscribeUser(client.userID, client.sinceSeq, func(event models.HistoryEvent) {
+		data, _ := json.Marshal(&WSMessage{
+			Type:      WSTypeNATS,
+			Subject:   event.Subject,
+			Seq:       event.Seq,
+			UserID:    client.userID,
+			Timestamp: event.Timestamp,
+			Data:      event.Data,
+		})
+		if !client.push(data) {
+			h.logger.Warn("WebSocket send queue full, closing to resume from last seq",
+				"user_id", client.userID,
+				"device_id", client.deviceID,
+				"seq", event.Seq,
+			)
+			client.conn.Close()
+			return
+		}
+		if h.monitor != nil {
+			h.monitor.RecordNATSMessage(event.Subject, "push")
+		}
+	})
+	if err != nil {
+		h.logger.Error("Failed to subscribe to message history, falling back to core NATS",
+			"error", err,
+			"user_id", client.userID,
+		)
+		return false
+	}
+	client.natsSubs = append(client.natsSubs, sub)
+	return true
+}
+
+// pushType 按 NATS 主题确定推送消息类型
+func pushType(subject string) string {
+	parts := strings.Split(subject, ".")
+	if len(parts) == 3 && parts[0] == "user" {
+		switch {
+		case strings.HasPrefix(parts[2], "sync_"):
+			return WSTypeConfigChange
+		case parts[2] == "presence":
+			return WSTypePresence
+		}
+	}
+	return WSTypeNATS
+}
+
 // SendToUser sends a message to all devices of a user
 func (h *WSHub) SendToUser(userID string, msgType string, data interface{}) {
 	dataBytes, _ := json.Marshal(data)
@@ -203,11 +316,11 @@ func (h *WSHub) GetOnlineDevices(userID string) int {
 // WSHandler handles WebSocket connections
 type WSHandler struct {
 	hub    *WSHub
-	logger *zap.Logger
+	logger *slog.Logger
 }
 
 // NewWSHandler creates a new WebSocket handler
-func NewWSHandler(hub *WSHub, logger *zap.Logger) *WSHandler {
+func NewWSHandler(hub *WSHub, logger *slog.Logger) *WSHandler {
 	return &WSHandler{
 		hub:    hub,
 		logger: logger,
@@ -217,29 +330,50 @@ func NewWSHandler(hub *WSHub, logger *zap.Logger) *WSHandler {
 // HandleWebSocket handles WebSocket upgrade and connection
 func (h *WSHandler) HandleWebSocket(c *gin.Context) {
 	// Get user info from context (set by auth middleware)
-	userID, exists := c.Get("user_id")
-	if !exists {
+	userID := c.GetString("user_id")
+	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	deviceID, _ := c.Get("device_id")
-	if deviceID == nil {
+	deviceID := c.GetString("device_id")
+	if deviceID == "" {
 		deviceID = "unknown"
 	}
 
+	// 设备可通过 ?since_seq= 提供已处理的最后一条会话事件序号，补发离线期间错过的事件
+	var sinceSeq uint64
+	if v := c.Query("since_seq"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since_seq"})
+			return
+		}
+		sinceSeq = seq
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		h.logger.Error("Failed to upgrade WebSocket", zap.Error(err))
+		h.logger.Error("Failed to upgrade WebSocket", "error", err)
 		return
 	}
 
+	// 设备可通过 ?scopes=providers,mcp 声明接收的同步类别，连接后也可发送 sync_scopes 更新
+	scopes := models.DefaultSyncScopes()
+	if list, ok := c.GetQuery("scopes"); ok {
+		scopes = models.ParseSyncScopes(list)
+	}
+
 	client := &WSClient{
-		conn:     conn,
-		userID:   userID.(string),
-		deviceID: deviceID.(string),
-		send:     make(chan []byte, 256),
-		hub:      h.hub,
+		conn:          conn,
+		userID:        userID,
+		deviceID:      deviceID,
+		deviceType:    c.Query("device_type"),
+		clientVersion: c.Query("client_version"),
+		send:          make(chan []byte, 256),
+		hub:           h.hub,
+		scopes:        scopes,
+		sinceSeq:      sinceSeq,
 	}
 
 	h.hub.register <- client
@@ -249,6 +383,34 @@ func (h *WSHandler) HandleWebSocket(c *gin.Context) {
 	go client.readPump()
 }
 
+// push 非阻塞地写入发送队列，队列已满或连接已关闭时丢弃并返回 false
+func (c *WSClient) push(data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// heartbeat 连接存活即刷新在线状态
+func (c *WSClient) heartbeat() {
+	if c.hub.presence == nil {
+		return
+	}
+	if err := c.hub.presence.Heartbeat(context.Background(), c.userID, c.deviceID, c.deviceType, c.clientVersion); err != nil {
+		c.hub.logger.Warn("Failed to record WebSocket heartbeat",
+			"user_id", c.userID,
+			"error", err,
+		)
+	}
+}
+
 func (c *WSClient) readPump() {
 	defer func() {
 		c.hub.unregister <- c
@@ -256,9 +418,10 @@ func (c *WSClient) readPump() {
 	}()
 
 	c.conn.SetReadLimit(512 * 1024) // 512KB max message size
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		c.heartbeat()
 		return nil
 	})
 
@@ -266,10 +429,11 @@ func (c *WSClient) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				c.hub.logger.Error("WebSocket read error", zap.Error(err))
+				c.hub.logger.Error("WebSocket read error", "error", err)
 			}
 			break
 		}
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
 
 		// Handle incoming message
 		c.handleMessage(message)
@@ -277,7 +441,7 @@ func (c *WSClient) readPump() {
 }
 
 func (c *WSClient) writePump() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(wsPingInterval)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -286,7 +450,7 @@ func (c *WSClient) writePump() {
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
@@ -297,7 +461,7 @@ func (c *WSClient) writePump() {
 			}
 
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -305,48 +469,120 @@ func (c *WSClient) writePump() {
 	}
 }
 
+// reply 向本客户端发送一条消息
+func (c *WSClient) reply(msgType string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	response, _ := json.Marshal(WSMessage{
+		Type:      msgType,
+		DeviceID:  c.deviceID,
+		Timestamp: time.Now(),
+		Data:      payload,
+	})
+	c.push(response)
+}
+
 func (c *WSClient) handleMessage(message []byte) {
 	var msg WSMessage
 	if err := json.Unmarshal(message, &msg); err != nil {
-		c.hub.logger.Error("Failed to unmarshal WebSocket message", zap.Error(err))
+		c.hub.logger.Error("Failed to unmarshal WebSocket message", "error", err)
 		return
 	}
 
 	switch msg.Type {
 	case "ping":
-		// Respond with pong
-		response := WSMessage{
-			Type:      "pong",
-			Timestamp: time.Now(),
+		// 应用层心跳（无法响应协议层 ping 的客户端使用）
+		c.heartbeat()
+		c.reply("pong", nil)
+
+	case "subscribe", "unsubscribe":
+		// 按类别增减订阅：{"type":"subscribe","data":{"scopes":["providers","mcp"]}}
+		var req struct {
+			Scopes []models.SyncScope `json:"scopes"`
 		}
-		data, _ := json.Marshal(response)
-		c.send <- data
-
-	case "subscribe":
-		// Handle additional subscription requests
-		c.hub.logger.Debug("Subscribe request",
-			zap.String("user_id", c.userID),
-			zap.ByteString("data", msg.Data),
-		)
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			c.hub.logger.Warn("Invalid subscribe request",
+				"user_id", c.userID,
+				"error", err,
+			)
+			return
+		}
+		c.mu.Lock()
+		for _, scope := range req.Scopes {
+			if !c.scopes.Set(scope, msg.Type == "subscribe") {
+				c.hub.logger.Debug("Unknown sync scope", "scope", scope)
+			}
+		}
+		scopes := c.scopes
+		c.mu.Unlock()
+		c.reply("sync_scopes", scopes)
+
+	case "sync_scopes":
+		// 设备更新接收的同步类别
+		var scopes models.SyncScopes
+		if err := json.Unmarshal(msg.Data, &scopes); err != nil {
+			c.hub.logger.Warn("Invalid sync scopes",
+				"user_id", c.userID,
+				"error", err,
+			)
+			return
+		}
+		c.mu.Lock()
+		c.scopes = scopes
+		c.mu.Unlock()
+		c.reply("sync_scopes", scopes)
 
 	case "sync_request":
 		// Handle sync request - client wants latest state
 		c.hub.logger.Debug("Sync request",
-			zap.String("user_id", c.userID),
+			"user_id", c.userID,
 		)
 		// TODO: Fetch and send latest state
 
 	default:
 		c.hub.logger.Debug("Unknown message type",
-			zap.String("type", msg.Type),
-			zap.String("user_id", c.userID),
+			"type", msg.Type,
+			"user_id", c.userID,
 		)
 	}
 }
 
-// Close marks the client as closed
-func (c *WSClient) Close() {
+// filterScoped 按设备的同步类别过滤 NATS 消息：类别关闭时丢弃，
+// 设备不接收 API Key 时移除供应商配置中的密钥
+func (c *WSClient) filterScoped(subject string, data []byte) ([]byte, bool) {
+	scope, ok := models.ScopeForSubject(subject)
+	if !ok {
+		return data, true
+	}
+
 	c.mu.Lock()
-	c.closed = true
+	scopes := c.scopes
 	c.mu.Unlock()
+
+	if !scopes.Allows(scope) {
+		return nil, false
+	}
+	if scope != models.ScopeProviders || scopes.IncludeAPIKeys() {
+		return data, true
+	}
+
+	var event models.ScopedEvent
+	if err := json.Unmarshal(data, &event); err != nil || !event.IncludesSecrets {
+		return data, true
+	}
+	event.Redact()
+	redacted, err := json.Marshal(event)
+	if err != nil {
+		return nil, false
+	}
+	return redacted, true
+}
+
+// Close marks the client as closed and stops the write pump
+func (c *WSClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
 }
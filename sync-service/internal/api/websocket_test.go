@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/message"
+	natsclient "github.com/aspect-code/codeswitch/sync-service/internal/nats"
+	"github.com/aspect-code/codeswitch/sync-service/internal/natstest"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// newTestWSServer 启动 WSHub 与 WebSocket 接口，用户和设备通过 ?user=&device= 模拟认证中间件。
+// 返回的 NATS 连接与 WSHub 共用，发布顺序与订阅一致
+func newTestWSServer(t *testing.T) (*WSHub, *nats.Conn, string) {
+	t.Helper()
+	return startTestWSServer(t, natstest.RunServer(t, false).ClientURL(), nil)
+}
+
+// startTestWSServer 连接指定的 NATS 服务器启动 WebSocket 接口，history 可为空
+func startTestWSServer(t *testing.T, natsURL string, history *message.Handler) (*WSHub, *nats.Conn, string) {
+	t.Helper()
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	hub := NewWSHub(nc, nil, history, nil, discardLogger())
+	go hub.Run()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		if user := c.Query("user"); user != "" {
+			c.Set("user_id", user)
+		}
+		c.Set("device_id", c.Query("device"))
+	}, NewWSHandler(hub, discardLogger()).HandleWebSocket)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return hub, nc, srv.URL + "/ws"
+}
+
+// newTestHistory 在开启 JetStream 的内嵌服务器上创建启用了消息历史的消息处理器
+func newTestHistory(t *testing.T) (*message.Handler, string) {
+	t.Helper()
+	ns := natstest.RunServer(t, true)
+	client := natsclient.NewClient(&natsclient.Config{URL: ns.ClientURL()}, discardLogger())
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	history := message.NewHandler(client, discardLogger())
+	cfg := natsclient.DefaultStreamConfig()
+	cfg.Storage = "memory"
+	if err := history.EnableHistory(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return history, ns.ClientURL()
+}
+
+func createTestMessage(t *testing.T, history *message.Handler, userID, sessionID string) uint64 {
+	t.Helper()
+	msg := &models.Message{UserID: userID, SessionID: sessionID, Role: "user", Content: "hi"}
+	if err := history.CreateMessage(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg.Seq
+}
+
+func dialWS(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readWS(t *testing.T, conn *websocket.Conn) WSMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg WSMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// waitDevices 等待用户的在线设备数达到 n。注册在持有锁时完成 NATS 订阅，因此返回后即可发布
+func waitDevices(t *testing.T, hub *WSHub, userID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.GetOnlineDevices(userID) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("online devices for %s = %d, want %d", userID, hub.GetOnlineDevices(userID), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWSHandlerRejectsBadRequests(t *testing.T) {
+	_, _, url := newTestWSServer(t)
+	cases := []struct {
+		query string
+		want  int
+	}{
+		{"?device=d1", http.StatusUnauthorized},
+		{"?user=u1&since_seq=abc", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		resp, err := http.Get(url + tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.query, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestWSPushesScopedEvents(t *testing.T) {
+	hub, nc, url := newTestWSServer(t)
+	conn := dialWS(t, url+"?user=u1&device=d1&scopes=providers,mcp")
+	waitDevices(t, hub, "u1", 1)
+
+	providers, _ := json.Marshal(models.ScopedEvent{
+		Scope:           models.ScopeProviders,
+		IncludesSecrets: true,
+		Docs:            []models.SyncDoc{{Key: "p1", Data: map[string]any{"name": "openai", "api_key": "sk-secret"}}},
+	})
+	nc.Publish("user.u1.sync_skills", []byte(`{}`)) // 未订阅的类别被丢弃
+	nc.Publish("user.u2.sync_providers", providers) // 其他用户的主题
+	nc.Publish("user.u1.sync_providers", providers)
+	nc.Publish("user.u1.presence", []byte(`{"device_id":"d2","online":true}`))
+	nc.Publish("chat.u1.s1.msg", []byte(`{"message_id":"m1"}`))
+	nc.Flush()
+
+	// 每个订阅独立投递，不同主题之间不保证顺序
+	got := map[string]WSMessage{}
+	for i := 0; i < 3; i++ {
+		msg := readWS(t, conn)
+		got[msg.Subject] = msg
+	}
+
+	msg := got["user.u1.sync_providers"]
+	if msg.Type != WSTypeConfigChange || msg.UserID != "u1" {
+		t.Fatalf("config change = %+v", got)
+	}
+	// 设备未开启 provider_api_keys，密钥被移除
+	var event models.ScopedEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.IncludesSecrets || len(event.Docs) != 1 || event.Docs[0].Data["name"] != "openai" || event.Docs[0].Data["api_key"] != nil {
+		t.Fatalf("redacted event = %s", msg.Data)
+	}
+
+	if msg := got["user.u1.presence"]; msg.Type != WSTypePresence {
+		t.Fatalf("presence = %+v", got)
+	}
+	// 未启用消息历史时会话事件经 core NATS 转发
+	if msg := got["chat.u1.s1.msg"]; msg.Type != WSTypeNATS || string(msg.Data) != `{"message_id":"m1"}` {
+		t.Fatalf("chat event = %+v", got)
+	}
+
+	// 被过滤与其他用户的消息不会送达
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, extra, err := conn.ReadMessage(); err == nil {
+		t.Fatalf("unexpected message %s", extra)
+	}
+}
+
+func TestWSResumesHistoryFromSinceSeq(t *testing.T) {
+	history, natsURL := newTestHistory(t)
+	for _, session := range []string{"s1", "s2", "s3"} {
+		createTestMessage(t, history, "u1", session)
+	}
+	createTestMessage(t, history, "u2", "s1")
+	hub, _, url := startTestWSServer(t, natsURL, history)
+
+	conn := dialWS(t, url+"?user=u1&device=d1&since_seq=1")
+	waitDevices(t, hub, "u1", 1)
+	live := createTestMessage(t, history, "u1", "s4")
+
+	// 先补发 since_seq 之后错过的事件，再按序衔接实时事件，其他用户的事件不会送达
+	for _, want := range []struct {
+		seq     uint64
+		subject string
+	}{{2, "chat.u1.s2.msg"}, {3, "chat.u1.s3.msg"}, {live, "chat.u1.s4.msg"}} {
+		msg := readWS(t, conn)
+		if msg.Type != WSTypeNATS || msg.Seq != want.seq || msg.Subject != want.subject {
+			t.Fatalf("event = %+v, want seq %d on %s", msg, want.seq, want.subject)
+		}
+	}
+}
+
+func TestWSClientMessages(t *testing.T) {
+	hub, _, url := newTestWSServer(t)
+	conn := dialWS(t, url+"?user=u1&device=d1")
+	waitDevices(t, hub, "u1", 1)
+
+	send := func(raw string) WSMessage {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+		return readWS(t, conn)
+	}
+	scopesOf := func(msg WSMessage) models.SyncScopes {
+		t.Helper()
+		if msg.Type != "sync_scopes" || msg.DeviceID != "d1" {
+			t.Fatalf("reply = %+v", msg)
+		}
+		var scopes models.SyncScopes
+		if err := json.Unmarshal(msg.Data, &scopes); err != nil {
+			t.Fatal(err)
+		}
+		return scopes
+	}
+
+	if msg := send(`{"type":"ping"}`); msg.Type != "pong" || msg.DeviceID != "d1" {
+		t.Fatalf("pong = %+v", msg)
+	}
+
+	// 默认类别上增减订阅
+	want := models.DefaultSyncScopes()
+	want.RequestLogs = true
+	if got := scopesOf(send(`{"type":"subscribe","data":{"scopes":["request_logs","unknown"]}}`)); got != want {
+		t.Fatalf("after subscribe = %+v", got)
+	}
+	want.Providers = false
+	if got := scopesOf(send(`{"type":"unsubscribe","data":{"scopes":["providers"]}}`)); got != want {
+		t.Fatalf("after unsubscribe = %+v", got)
+	}
+
+	// sync_scopes 整体替换
+	want = models.SyncScopes{MCP: true}
+	if got := scopesOf(send(`{"type":"sync_scopes","data":{"mcp":true}}`)); got != want {
+		t.Fatalf("after sync_scopes = %+v", got)
+	}
+}
+
+func TestWSHubReplacesReconnectedDevice(t *testing.T) {
+	hub, _, url := newTestWSServer(t)
+	old := dialWS(t, url+"?user=u1&device=d1")
+	waitDevices(t, hub, "u1", 1)
+	current := dialWS(t, url+"?user=u1&device=d1")
+
+	// 旧连接被服务端关闭，设备数不变
+	old.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := old.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNoStatusReceived) {
+		t.Fatalf("old connection err = %v", err)
+	}
+	waitDevices(t, hub, "u1", 1)
+
+	hub.SendToUser("u1", "notice", map[string]string{"text": "hi"})
+	if msg := readWS(t, current); msg.Type != "notice" || string(msg.Data) != `{"text":"hi"}` {
+		t.Fatalf("notice = %+v", msg)
+	}
+
+	current.Close()
+	waitDevices(t, hub, "u1", 0)
+}
+
+func TestPushType(t *testing.T) {
+	cases := map[string]string{
+		"user.u1.sync_providers": WSTypeConfigChange,
+		"user.u1.sync_mcp":       WSTypeConfigChange,
+		"user.u1.presence":       WSTypePresence,
+		"user.u1.quota":          WSTypeNATS,
+		"billing.u1":             WSTypeNATS,
+		"chat.u1.s1.msg":         WSTypeNATS,
+		"user.u1.sync_x.extra":   WSTypeNATS,
+	}
+	for subject, want := range cases {
+		if got := pushType(subject); got != want {
+			t.Errorf("pushType(%q) = %s, want %s", subject, got, want)
+		}
+	}
+}
@@ -20,6 +20,10 @@ type Handler struct {
 	// 内存存储 (生产环境应使用 PostgreSQL + Redis)
 	messages     sync.Map // map[sessionID][]*models.Message
 	messageIndex sync.Map // map[messageID]*models.Message
+
+	// 消息历史（JetStream），EnableHistory 成功后启用
+	stream         nats.StreamConfig
+	historyEnabled bool
 }
 
 // NewHandler 创建消息处理器
@@ -64,15 +68,18 @@ func (h *Handler) CreateMessage(ctx context.Context, msg *models.Message) error
 	}
 
 	subject := nats.SessionSubject(msg.UserID, msg.SessionID, "msg")
-	if err := h.natsClient.PublishWithAck(subject, event); err != nil {
+	seq, err := h.publish(subject, event)
+	if err != nil {
 		h.logger.Error("Failed to publish message event", "error", err)
 		return err
 	}
+	msg.Seq = seq
 
 	h.logger.Debug("Message created and published",
 		"message_id", msg.ID,
 		"session_id", msg.SessionID,
 		"role", msg.Role,
+		"seq", seq,
 	)
 
 	return nil
@@ -171,8 +178,10 @@ func (h *Handler) DeleteMessage(ctx context.Context, userID, sessionID, messageI
 		MessageID: messageID,
 	}
 
+	// 删除事件同样进入消息历史，离线设备回放时可据此删除本地副本
 	subject := nats.SessionSubject(userID, sessionID, "msg")
-	return h.natsClient.Publish(subject, event)
+	_, err := h.publish(subject, event)
+	return err
 }
 
 // 辅助方法
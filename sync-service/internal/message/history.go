@@ -0,0 +1,207 @@
+package message
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/nats"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+const (
+	// MaxReplayBatch 单次回放的最大条数
+	MaxReplayBatch = 500
+	// replayWait 拉取历史消息的最长等待时间
+	replayWait = 2 * time.Second
+)
+
+// ErrHistoryDisabled 消息历史未启用（JetStream 不可用）
+var ErrHistoryDisabled = errors.New("message history not enabled")
+
+// EnableHistory 创建会话消息流，之后消息通过 JetStream 持久化，离线设备可按序号回放。
+// 失败时保持 core NATS 模式
+func (h *Handler) EnableHistory(cfg nats.StreamConfig) error {
+	info, err := h.natsClient.EnsureStream(cfg)
+	if err != nil {
+		return err
+	}
+	h.stream = cfg
+	h.historyEnabled = true
+	h.logger.Info("Message history enabled",
+		"stream", cfg.Name,
+		"max_age", cfg.MaxAge,
+		"messages", info.State.Msgs,
+		"last_seq", info.State.LastSeq,
+	)
+	return nil
+}
+
+// HistoryEnabled 是否启用了消息历史
+func (h *Handler) HistoryEnabled() bool {
+	return h.historyEnabled
+}
+
+// publish 发布会话事件：启用消息历史时写入 JetStream 并返回流序号，
+// 否则使用 core NATS（序号为 0），未创建流时 JetStream 发布会因无人确认而失败
+func (h *Handler) publish(subject string, event interface{}) (uint64, error) {
+	if !h.historyEnabled {
+		return 0, h.natsClient.Publish(subject, event)
+	}
+	return h.natsClient.PublishSeq(subject, event)
+}
+
+// userFilter 用户全部会话事件的主题
+func userFilter(userID string) string {
+	return fmt.Sprintf("chat.%s.>", userID)
+}
+
+// deviceConsumer 设备的持久消费者名称，名称中不能包含 . * > 等字符，因此取哈希
+func deviceConsumer(userID, deviceID string) string {
+	sum := sha1.Sum([]byte(userID + "\x00" + deviceID))
+	return "dev_" + hex.EncodeToString(sum[:12])
+}
+
+// Replay 回放用户错过的会话事件，按流序号严格递增。
+// sinceSeq > 0 时从该序号之后回放（设备自行记录序号，结果可重复获取）；
+// sinceSeq 为 0 时使用设备的持久消费者，从上次确认的位置继续并确认本批
+func (h *Handler) Replay(userID, deviceID string, sinceSeq uint64, limit int) (*models.HistoryResponse, error) {
+	if !h.historyEnabled {
+		return nil, ErrHistoryDisabled
+	}
+	if limit <= 0 || limit > MaxReplayBatch {
+		limit = MaxReplayBatch
+	}
+	if sinceSeq > 0 {
+		return h.replayFrom(userID, sinceSeq, limit)
+	}
+	return h.replayDurable(userID, deviceID, limit)
+}
+
+func (h *Handler) replayFrom(userID string, sinceSeq uint64, limit int) (*models.HistoryResponse, error) {
+	// 临时拉取消费者，取消订阅时由客户端库删除
+	sub, err := h.natsClient.JetStream().PullSubscribe(userFilter(userID), "",
+		natsgo.BindStream(h.stream.Name),
+		natsgo.StartSequence(sinceSeq+1),
+		natsgo.AckNone(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replay consumer: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	resp, _, err := fetchHistory(sub, limit)
+	if err != nil {
+		return nil, err
+	}
+	if resp.LastSeq == 0 {
+		resp.LastSeq = sinceSeq
+	}
+	return resp, nil
+}
+
+func (h *Handler) replayDurable(userID, deviceID string, limit int) (*models.HistoryResponse, error) {
+	js := h.natsClient.JetStream()
+	name := deviceConsumer(userID, deviceID)
+
+	// 显式创建消费者并绑定，取消订阅时不会删除它，位置得以保留
+	if _, err := js.ConsumerInfo(h.stream.Name, name); errors.Is(err, natsgo.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(h.stream.Name, &natsgo.ConsumerConfig{
+			Durable:           name,
+			Description:       fmt.Sprintf("history for %s/%s", userID, deviceID),
+			FilterSubject:     userFilter(userID),
+			DeliverPolicy:     natsgo.DeliverAllPolicy,
+			AckPolicy:         natsgo.AckAllPolicy,
+			InactiveThreshold: h.stream.ConsumerInactiveThreshold,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create device consumer: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get device consumer: %w", err)
+	}
+
+	sub, err := js.PullSubscribe(userFilter(userID), name, natsgo.Bind(h.stream.Name, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind device consumer: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	resp, last, err := fetchHistory(sub, limit)
+	if err != nil {
+		return nil, err
+	}
+	// AckAll：确认最后一条即确认整批，确认失败时下次回放会重新投递
+	if last != nil {
+		if err := last.AckSync(); err != nil {
+			h.logger.Warn("Failed to ack replayed messages", "consumer", name, "error", err)
+		}
+	}
+	return resp, nil
+}
+
+// fetchHistory 按消费者的待投递数拉取一批消息，无待投递消息时立即返回
+func fetchHistory(sub *natsgo.Subscription, limit int) (*models.HistoryResponse, *natsgo.Msg, error) {
+	resp := &models.HistoryResponse{Events: []models.HistoryEvent{}}
+
+	info, err := sub.ConsumerInfo()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get consumer info: %w", err)
+	}
+	if info.NumPending == 0 {
+		return resp, nil, nil
+	}
+	batch := limit
+	if info.NumPending < uint64(limit) {
+		batch = int(info.NumPending)
+	}
+
+	msgs, err := sub.Fetch(batch, natsgo.MaxWait(replayWait))
+	if err != nil && !errors.Is(err, natsgo.ErrTimeout) {
+		return nil, nil, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+	var last *natsgo.Msg
+	for _, msg := range msgs {
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, nil, err
+		}
+		event := historyEvent(msg, meta)
+		resp.Events = append(resp.Events, event)
+		resp.LastSeq = event.Seq
+		resp.HasMore = meta.NumPending > 0
+		last = msg
+	}
+	return resp, last, nil
+}
+
+// SubscribeUser 以有序消费者订阅用户的会话事件：先投递 sinceSeq 之后的历史，再无缝衔接实时消息。
+// sinceSeq 为 0 时只接收新消息
+func (h *Handler) SubscribeUser(userID string, sinceSeq uint64, deliver func(models.HistoryEvent)) (*natsgo.Subscription, error) {
+	if !h.historyEnabled {
+		return nil, ErrHistoryDisabled
+	}
+	start := natsgo.DeliverNew()
+	if sinceSeq > 0 {
+		start = natsgo.StartSequence(sinceSeq + 1)
+	}
+	return h.natsClient.JetStream().Subscribe(userFilter(userID), func(msg *natsgo.Msg) {
+		meta, err := msg.Metadata()
+		if err != nil {
+			return
+		}
+		deliver(historyEvent(msg, meta))
+	}, natsgo.BindStream(h.stream.Name), natsgo.OrderedConsumer(), start)
+}
+
+func historyEvent(msg *natsgo.Msg, meta *natsgo.MsgMetadata) models.HistoryEvent {
+	return models.HistoryEvent{
+		Seq:       meta.Sequence.Stream,
+		Subject:   msg.Subject,
+		Timestamp: meta.Timestamp,
+		Data:      msg.Data,
+	}
+}
@@ -0,0 +1,192 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/nats"
+	"github.com/aspect-code/codeswitch/sync-service/internal/natstest"
+	"github.com/aspect-code/codeswitch/sync-service/pkg/models"
+)
+
+// newTestHandler 连接内嵌 NATS 服务器创建消息处理器，history 为 true 时在内存流上启用消息历史
+func newTestHandler(t *testing.T, jetstream, history bool) *Handler {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ns := natstest.RunServer(t, jetstream)
+	client := nats.NewClient(&nats.Config{URL: ns.ClientURL()}, logger)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	h := NewHandler(client, logger)
+	if history {
+		cfg := nats.DefaultStreamConfig()
+		cfg.Storage = "memory"
+		if err := h.EnableHistory(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h
+}
+
+// createMessages 依次创建消息，返回各自的流序号
+func createMessages(t *testing.T, h *Handler, specs ...[2]string) []uint64 {
+	t.Helper()
+	seqs := make([]uint64, 0, len(specs))
+	for _, spec := range specs {
+		msg := &models.Message{UserID: spec[0], SessionID: spec[1], Role: "user", Content: "hi"}
+		if err := h.CreateMessage(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, msg.Seq)
+	}
+	return seqs
+}
+
+// seqsOf 回放结果中的序号
+func seqsOf(resp *models.HistoryResponse) []uint64 {
+	seqs := make([]uint64, 0, len(resp.Events))
+	for _, event := range resp.Events {
+		seqs = append(seqs, event.Seq)
+	}
+	return seqs
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplayFromSeq(t *testing.T) {
+	h := newTestHandler(t, true, true)
+	seqs := createMessages(t, h, [2]string{"u1", "s1"}, [2]string{"u2", "s1"}, [2]string{"u1", "s2"}, [2]string{"u1", "s1"})
+	if !equalSeqs(seqs, []uint64{1, 2, 3, 4}) {
+		t.Fatalf("seqs = %v", seqs)
+	}
+
+	// 只返回该用户的事件，按序号递增
+	resp, err := h.Replay("u1", "d1", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalSeqs(seqsOf(resp), []uint64{3, 4}) || resp.LastSeq != 4 || resp.HasMore {
+		t.Fatalf("replay = %+v", resp)
+	}
+	event := resp.Events[0]
+	var payload models.MessageEvent
+	if err := json.Unmarshal(event.Data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if event.Subject != "chat.u1.s2.msg" || payload.SessionID != "s2" || payload.Message == nil || event.Timestamp.IsZero() {
+		t.Fatalf("event = %+v, payload = %+v", event, payload)
+	}
+
+	// 分批回放：HasMore 提示继续，结果可重复获取
+	for i := 0; i < 2; i++ {
+		resp, err = h.Replay("u1", "d1", 1, 1)
+		if err != nil || !equalSeqs(seqsOf(resp), []uint64{3}) || resp.LastSeq != 3 || !resp.HasMore {
+			t.Fatalf("batch %d = %+v, %v", i, resp, err)
+		}
+	}
+
+	// 已是最新时返回空列表，LastSeq 保持不变
+	resp, err = h.Replay("u1", "d1", 4, 10)
+	if err != nil || len(resp.Events) != 0 || resp.Events == nil || resp.LastSeq != 4 {
+		t.Fatalf("caught up = %+v, %v", resp, err)
+	}
+}
+
+func TestReplayDurableConsumer(t *testing.T) {
+	h := newTestHandler(t, true, true)
+	createMessages(t, h, [2]string{"u1", "s1"}, [2]string{"u1", "s1"}, [2]string{"u2", "s1"})
+
+	// 设备首次回放取得全部历史并确认，再次回放时没有新事件
+	resp, err := h.Replay("u1", "d1", 0, 0)
+	if err != nil || !equalSeqs(seqsOf(resp), []uint64{1, 2}) {
+		t.Fatalf("first replay = %+v, %v", resp, err)
+	}
+	resp, err = h.Replay("u1", "d1", 0, 0)
+	if err != nil || len(resp.Events) != 0 {
+		t.Fatalf("second replay = %+v, %v", resp, err)
+	}
+
+	createMessages(t, h, [2]string{"u1", "s2"})
+	resp, err = h.Replay("u1", "d1", 0, 0)
+	if err != nil || !equalSeqs(seqsOf(resp), []uint64{4}) {
+		t.Fatalf("replay after new message = %+v, %v", resp, err)
+	}
+
+	// 每个设备的位置独立
+	resp, err = h.Replay("u1", "d2", 0, 0)
+	if err != nil || !equalSeqs(seqsOf(resp), []uint64{1, 2, 4}) {
+		t.Fatalf("other device replay = %+v, %v", resp, err)
+	}
+	if deviceConsumer("u1", "d1") == deviceConsumer("u1", "d2") || deviceConsumer("u1", "d1") != deviceConsumer("u1", "d1") {
+		t.Fatal("device consumer names are not stable per device")
+	}
+}
+
+func TestSubscribeUser(t *testing.T) {
+	h := newTestHandler(t, true, true)
+	createMessages(t, h, [2]string{"u1", "s1"}, [2]string{"u1", "s1"}, [2]string{"u2", "s1"})
+
+	events := make(chan models.HistoryEvent, 10)
+	sub, err := h.SubscribeUser("u1", 1, func(event models.HistoryEvent) { events <- event })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	// 先补发 sinceSeq 之后的历史，再衔接实时消息
+	createMessages(t, h, [2]string{"u1", "s3"})
+	var got []uint64
+	for len(got) < 2 {
+		select {
+		case event := <-events:
+			got = append(got, event.Seq)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("events = %v", got)
+		}
+	}
+	if !equalSeqs(got, []uint64{2, 4}) {
+		t.Fatalf("events = %v", got)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	// 服务器未开启 JetStream：无法启用历史，消息仍经 core NATS 发布
+	h := newTestHandler(t, false, false)
+	if err := h.EnableHistory(nats.DefaultStreamConfig()); err == nil {
+		t.Fatal("expected EnableHistory to fail without JetStream")
+	}
+	if h.HistoryEnabled() {
+		t.Fatal("history enabled after failure")
+	}
+	if seqs := createMessages(t, h, [2]string{"u1", "s1"}); seqs[0] != 0 {
+		t.Fatalf("seq without history = %d", seqs[0])
+	}
+	if err := h.DeleteMessage(context.Background(), "u1", "s1", "m1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.Replay("u1", "d1", 0, 0); !errors.Is(err, ErrHistoryDisabled) {
+		t.Fatalf("Replay err = %v", err)
+	}
+	if _, err := h.SubscribeUser("u1", 0, func(models.HistoryEvent) {}); !errors.Is(err, ErrHistoryDisabled) {
+		t.Fatalf("SubscribeUser err = %v", err)
+	}
+}
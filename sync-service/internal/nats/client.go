@@ -19,6 +19,15 @@ type Client struct {
 	mu     sync.RWMutex
 	subs   map[string]*nats.Subscription
 	logger *slog.Logger
+
+	observer Observer
+}
+
+// Observer 接收连接状态变化与消息流量，用于监控指标
+type Observer interface {
+	SetNATSStatus(connected bool, lastError string)
+	IncrementNATSReconnects()
+	RecordNATSMessage(subject, direction string)
 }
 
 // Config NATS 配置
@@ -27,6 +36,7 @@ type Config struct {
 	ReconnectWait       time.Duration `yaml:"reconnect_wait"`
 	MaxReconnects       int           `yaml:"max_reconnects"`
 	ReconnectBufferSize int           `yaml:"reconnect_buffer_size"`
+	Stream              StreamConfig  `yaml:"stream"` // 会话消息历史（JetStream）
 }
 
 // NewClient 创建 NATS 客户端
@@ -38,6 +48,11 @@ func NewClient(cfg *Config, logger *slog.Logger) *Client {
 	}
 }
 
+// SetObserver 设置监控观察者，需在 Connect 之前调用
+func (c *Client) SetObserver(observer Observer) {
+	c.observer = observer
+}
+
 // Connect 连接 NATS 服务器
 func (c *Client) Connect(ctx context.Context) error {
 	opts := []nats.Option{
@@ -46,12 +61,26 @@ func (c *Client) Connect(ctx context.Context) error {
 		nats.ReconnectBufSize(c.config.ReconnectBufferSize),
 		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
 			c.logger.Warn("NATS disconnected", "error", err)
+			if c.observer != nil {
+				lastError := ""
+				if err != nil {
+					lastError = err.Error()
+				}
+				c.observer.SetNATSStatus(false, lastError)
+			}
 		}),
 		nats.ReconnectHandler(func(nc *nats.Conn) {
 			c.logger.Info("NATS reconnected", "url", nc.ConnectedUrl())
+			if c.observer != nil {
+				c.observer.IncrementNATSReconnects()
+				c.observer.SetNATSStatus(true, "")
+			}
 		}),
 		nats.ClosedHandler(func(nc *nats.Conn) {
 			c.logger.Info("NATS connection closed")
+			if c.observer != nil {
+				c.observer.SetNATSStatus(false, "connection closed")
+			}
 		}),
 		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
 			c.logger.Error("NATS error", "subject", sub.Subject, "error", err)
@@ -65,6 +94,9 @@ func (c *Client) Connect(ctx context.Context) error {
 
 	c.nc = nc
 	c.logger.Info("Connected to NATS", "url", nc.ConnectedUrl())
+	if c.observer != nil {
+		c.observer.SetNATSStatus(true, "")
+	}
 
 	// 初始化 JetStream (可选，用于持久化消息)
 	js, err := nc.JetStream()
@@ -100,6 +132,11 @@ func (c *Client) IsConnected() bool {
 	return c.nc != nil && c.nc.IsConnected()
 }
 
+// Conn 返回底层连接，供需要按连接管理订阅的组件（如 WebSocket 推送）使用
+func (c *Client) Conn() *nats.Conn {
+	return c.nc
+}
+
 // Publish 发布消息
 func (c *Client) Publish(subject string, data interface{}) error {
 	payload, err := json.Marshal(data)
@@ -111,6 +148,7 @@ func (c *Client) Publish(subject string, data interface{}) error {
 		return fmt.Errorf("failed to publish to %s: %w", subject, err)
 	}
 
+	c.recordMessage(subject, "out")
 	c.logger.Debug("Published message", "subject", subject, "size", len(payload))
 	return nil
 }
@@ -121,18 +159,8 @@ func (c *Client) PublishWithAck(subject string, data interface{}) error {
 		return c.Publish(subject, data)
 	}
 
-	payload, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal data: %w", err)
-	}
-
-	ack, err := c.js.Publish(subject, payload)
-	if err != nil {
-		return fmt.Errorf("failed to publish to %s: %w", subject, err)
-	}
-
-	c.logger.Debug("Published message with ack", "subject", subject, "seq", ack.Sequence)
-	return nil
+	_, err := c.PublishSeq(subject, data)
+	return err
 }
 
 // Subscribe 订阅消息
@@ -147,7 +175,7 @@ func (c *Client) Subscribe(subject string, handler func(msg *nats.Msg)) error {
 		c.logger.Debug("Unsubscribed existing subscription", "subject", subject)
 	}
 
-	sub, err := c.nc.Subscribe(subject, handler)
+	sub, err := c.nc.Subscribe(subject, c.observe(handler))
 	if err != nil {
 		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
 	}
@@ -171,7 +199,7 @@ func (c *Client) QueueSubscribe(subject, queue string, handler func(msg *nats.Ms
 		c.logger.Debug("Unsubscribed existing queue subscription", "subject", subject, "queue", queue)
 	}
 
-	sub, err := c.nc.QueueSubscribe(subject, queue, handler)
+	sub, err := c.nc.QueueSubscribe(subject, queue, c.observe(handler))
 	if err != nil {
 		return fmt.Errorf("failed to queue subscribe to %s: %w", subject, err)
 	}
@@ -195,6 +223,23 @@ func (c *Client) Unsubscribe(subject string) error {
 	return nil
 }
 
+// observe 包装订阅回调，统计收到的消息
+func (c *Client) observe(handler func(msg *nats.Msg)) nats.MsgHandler {
+	if c.observer == nil {
+		return handler
+	}
+	return func(msg *nats.Msg) {
+		c.observer.RecordNATSMessage(msg.Subject, "in")
+		handler(msg)
+	}
+}
+
+func (c *Client) recordMessage(subject, direction string) {
+	if c.observer != nil {
+		c.observer.RecordNATSMessage(subject, direction)
+	}
+}
+
 // Request 请求-响应模式
 func (c *Client) Request(subject string, data interface{}, timeout time.Duration) (*nats.Msg, error) {
 	payload, err := json.Marshal(data)
@@ -0,0 +1,115 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrJetStreamUnavailable 服务器未开启 JetStream
+var ErrJetStreamUnavailable = errors.New("jetstream not available")
+
+// StreamConfig 消息历史流配置
+type StreamConfig struct {
+	Name              string        `yaml:"name"`                 // 流名称，默认 CHAT
+	Subjects          []string      `yaml:"subjects"`             // 捕获的主题，默认 chat.>
+	Storage           string        `yaml:"storage"`              // file 或 memory
+	MaxAge            time.Duration `yaml:"max_age"`              // 消息保留时长，0 表示不限制
+	MaxBytes          int64         `yaml:"max_bytes"`            // 流总大小上限，0 表示不限制
+	MaxMsgsPerSubject int64         `yaml:"max_msgs_per_subject"` // 每个主题（会话事件类型）保留的条数，0 表示不限制
+	Replicas          int           `yaml:"replicas"`
+	// ConsumerInactiveThreshold 设备消费者闲置超过该时长后由服务器清理
+	ConsumerInactiveThreshold time.Duration `yaml:"consumer_inactive_threshold"`
+}
+
+// DefaultStreamConfig 默认保留 7 天的会话事件
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		Name:                      "CHAT",
+		Subjects:                  []string{"chat.>"},
+		Storage:                   "file",
+		MaxAge:                    7 * 24 * time.Hour,
+		MaxMsgsPerSubject:         10000,
+		Replicas:                  1,
+		ConsumerInactiveThreshold: 30 * 24 * time.Hour,
+	}
+}
+
+// JetStream 返回 JetStream 上下文，服务器未开启时为 nil
+func (c *Client) JetStream() nats.JetStreamContext {
+	return c.js
+}
+
+// EnsureStream 创建流，已存在时按配置更新保留策略
+func (c *Client) EnsureStream(cfg StreamConfig) (*nats.StreamInfo, error) {
+	if c.js == nil {
+		return nil, ErrJetStreamUnavailable
+	}
+
+	storage := nats.FileStorage
+	if cfg.Storage == "memory" {
+		storage = nats.MemoryStorage
+	}
+	streamCfg := &nats.StreamConfig{
+		Name:              cfg.Name,
+		Subjects:          cfg.Subjects,
+		Storage:           storage,
+		Retention:         nats.LimitsPolicy,
+		Discard:           nats.DiscardOld,
+		MaxAge:            cfg.MaxAge,
+		MaxBytes:          orUnlimited(cfg.MaxBytes),
+		MaxMsgsPerSubject: orUnlimited(cfg.MaxMsgsPerSubject),
+		Replicas:          cfg.Replicas,
+	}
+
+	info, err := c.js.StreamInfo(cfg.Name)
+	switch {
+	case errors.Is(err, nats.ErrStreamNotFound):
+		info, err = c.js.AddStream(streamCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+		}
+		c.logger.Info("JetStream stream created", "stream", cfg.Name, "subjects", cfg.Subjects)
+	case err != nil:
+		return nil, fmt.Errorf("failed to get stream %s: %w", cfg.Name, err)
+	default:
+		// 存储类型创建后不可修改
+		streamCfg.Storage = info.Config.Storage
+		info, err = c.js.UpdateStream(streamCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update stream %s: %w", cfg.Name, err)
+		}
+	}
+	return info, nil
+}
+
+// PublishSeq 发布到 JetStream 并返回流序号，未开启 JetStream 时退化为普通发布，序号为 0
+func (c *Client) PublishSeq(subject string, data interface{}) (uint64, error) {
+	if c.js == nil {
+		return 0, c.Publish(subject, data)
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	ack, err := c.js.Publish(subject, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+
+	c.recordMessage(subject, "out")
+	c.logger.Debug("Published message with ack", "subject", subject, "seq", ack.Sequence)
+	return ack.Sequence, nil
+}
+
+func orUnlimited(v int64) int64 {
+	if v <= 0 {
+		return -1
+	}
+	return v
+}
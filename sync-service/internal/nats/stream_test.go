@@ -0,0 +1,162 @@
+package nats
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aspect-code/codeswitch/sync-service/internal/natstest"
+	"github.com/nats-io/nats.go"
+)
+
+// connectTestClient 连接内嵌 NATS 服务器，jetstream 控制服务器是否开启 JetStream
+func connectTestClient(t *testing.T, jetstream bool, observer Observer) *Client {
+	t.Helper()
+	ns := natstest.RunServer(t, jetstream)
+	c := NewClient(&Config{URL: ns.ClientURL()}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if observer != nil {
+		c.SetObserver(observer)
+	}
+	if err := c.Connect(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// recordingObserver 记录 Observer 回调
+type recordingObserver struct {
+	mu        sync.Mutex
+	connected bool
+	messages  map[string]int // subject/direction -> 次数
+}
+
+func (o *recordingObserver) SetNATSStatus(connected bool, lastError string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.connected = connected
+}
+
+func (o *recordingObserver) IncrementNATSReconnects() {}
+
+func (o *recordingObserver) RecordNATSMessage(subject, direction string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.messages == nil {
+		o.messages = make(map[string]int)
+	}
+	o.messages[subject+"/"+direction]++
+}
+
+func (o *recordingObserver) count(key string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.messages[key]
+}
+
+func TestEnsureStreamCreatesAndUpdates(t *testing.T) {
+	c := connectTestClient(t, true, nil)
+	cfg := DefaultStreamConfig()
+	cfg.Name = "TEST"
+
+	info, err := c.EnsureStream(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.Storage != nats.FileStorage || info.Config.MaxAge != 7*24*time.Hour ||
+		info.Config.MaxMsgsPerSubject != 10000 || info.Config.MaxBytes != -1 || info.Config.Discard != nats.DiscardOld {
+		t.Fatalf("created stream config = %+v", info.Config)
+	}
+
+	// 再次调用时更新保留策略，存储类型保持创建时的值
+	cfg.Storage = "memory"
+	cfg.MaxAge = time.Hour
+	cfg.MaxMsgsPerSubject = 0
+	info, err = c.EnsureStream(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.Storage != nats.FileStorage || info.Config.MaxAge != time.Hour || info.Config.MaxMsgsPerSubject != -1 {
+		t.Fatalf("updated stream config = %+v", info.Config)
+	}
+}
+
+func TestPublishSeq(t *testing.T) {
+	observer := &recordingObserver{}
+	c := connectTestClient(t, true, observer)
+	cfg := DefaultStreamConfig()
+	cfg.Storage = "memory"
+	cfg.MaxMsgsPerSubject = 2
+	if _, err := c.EnsureStream(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	subject := SessionSubject("u1", "s1", "msg")
+	var last uint64
+	for i := 1; i <= 3; i++ {
+		seq, err := c.PublishSeq(subject, map[string]int{"n": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq != last+1 {
+			t.Fatalf("publish %d: seq = %d after %d", i, seq, last)
+		}
+		last = seq
+	}
+	if n := observer.count(subject + "/out"); n != 3 {
+		t.Fatalf("observed publishes = %d", n)
+	}
+
+	// 每个主题只保留最近 2 条
+	info, err := c.JetStream().StreamInfo(cfg.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 2 || info.State.FirstSeq != 2 || info.State.LastSeq != 3 {
+		t.Fatalf("stream state = %+v", info.State)
+	}
+
+	// 流未捕获的主题无法确认
+	if _, err := c.PublishSeq("user.u1.presence", "x"); err == nil {
+		t.Fatal("expected error for subject outside the stream")
+	}
+	if _, err := c.PublishSeq(subject, func() {}); err == nil {
+		t.Fatal("expected marshal error")
+	}
+}
+
+func TestStreamWithoutJetStream(t *testing.T) {
+	c := connectTestClient(t, false, nil)
+	if _, err := c.EnsureStream(DefaultStreamConfig()); err == nil {
+		t.Fatal("expected error when the server has no JetStream")
+	}
+
+	// 没有 JetStream 上下文时退化为普通发布，序号为 0
+	c.js = nil
+	if _, err := c.EnsureStream(DefaultStreamConfig()); !errors.Is(err, ErrJetStreamUnavailable) {
+		t.Fatalf("EnsureStream err = %v", err)
+	}
+	received := make(chan *nats.Msg, 1)
+	sub, err := c.Conn().ChanSubscribe("chat.u1.s1.msg", received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	c.Conn().Flush()
+
+	seq, err := c.PublishSeq("chat.u1.s1.msg", map[string]string{"id": "m1"})
+	if err != nil || seq != 0 {
+		t.Fatalf("PublishSeq = %d, %v", seq, err)
+	}
+	select {
+	case msg := <-received:
+		if string(msg.Data) != `{"id":"m1"}` {
+			t.Fatalf("data = %s", msg.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("core NATS message not received")
+	}
+}
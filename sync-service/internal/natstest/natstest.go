@@ -0,0 +1,39 @@
+// Package natstest 为测试启动内嵌的 NATS 服务器
+package natstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// RunServer 在随机端口启动 NATS 服务器，jetstream 为 true 时开启 JetStream（数据存放在临时目录），
+// 测试结束时自动关闭。通过 ClientURL() 获取连接地址
+func RunServer(t testing.TB, jetstream bool) *server.Server {
+	t.Helper()
+	opts := &server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: jetstream,
+	}
+	if jetstream {
+		opts.StoreDir = t.TempDir()
+	}
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		ns.Shutdown()
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+	return ns
+}
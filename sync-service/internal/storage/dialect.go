@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect SQL 方言差异
+type Dialect interface {
+	// Name 方言名称（sqlite / postgres）
+	Name() string
+	// DriverName database/sql 注册的驱动名
+	DriverName() string
+	// Rebind 将 ? 占位符改写为方言格式
+	Rebind(query string) string
+}
+
+func dialectFor(driver string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "sqlite", "sqlite3":
+		return sqliteDialect{}, nil
+	case "postgres", "postgresql", "pg":
+		return postgresDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage driver: %s", driver)
+	}
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string               { return "sqlite" }
+func (sqliteDialect) DriverName() string         { return "sqlite" }
+func (sqliteDialect) Rebind(query string) string { return query }
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string       { return "postgres" }
+func (postgresDialect) DriverName() string { return "postgres" }
+
+// Rebind 将 ? 依次改写为 $1, $2 ...（跳过字符串字面量）
+func (postgresDialect) Rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+			b.WriteByte(ch)
+		case ch == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
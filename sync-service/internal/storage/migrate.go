@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Migration 一次表结构变更，Version 在同一组件内递增且发布后不可修改
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+// Migrate 按版本顺序执行 component 尚未应用的迁移，每个版本在独立事务中完成
+func (d *DB) Migrate(ctx context.Context, component string, migrations []Migration) error {
+	if _, err := d.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		component TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL,
+		PRIMARY KEY (component, version)
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := d.QueryContext(ctx, "SELECT version FROM schema_migrations WHERE component = ?", component)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	pending := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+
+	for _, m := range pending {
+		err := d.WithTx(ctx, func(tx *Tx) error {
+			for _, stmt := range m.Statements {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (component, version, name, applied_at) VALUES (?, ?, ?, ?)",
+				component, m.Version, m.Name, time.Now().UnixMilli())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s/%d (%s) failed: %w", component, m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package storage 管理后台的持久化存储（SQLite / Postgres）
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// 默认 SQLite 数据库文件
+const DefaultSQLitePath = "data/sync-service.db"
+
+// Config 存储配置
+type Config struct {
+	Driver       string `yaml:"driver"`         // sqlite（默认）/ postgres
+	DSN          string `yaml:"dsn"`            // SQLite 文件路径或 Postgres 连接串
+	MaxOpenConns int    `yaml:"max_open_conns"` // 连接池上限，0 表示使用默认值
+}
+
+// DB 带方言的数据库连接，查询统一使用 ? 占位符，按方言改写
+type DB struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// Execer DB 与 Tx 共有的执行接口
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Open 打开数据库连接并验证可用
+func Open(cfg Config) (*DB, error) {
+	dialect, err := dialectFor(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn := cfg.DSN
+	if dialect.Name() == "sqlite" {
+		if dsn == "" {
+			dsn = DefaultSQLitePath
+		}
+		if dir := filepath.Dir(dsn); dir != "." && !strings.HasPrefix(dsn, "file:") {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create storage directory: %w", err)
+			}
+		}
+		if !strings.Contains(dsn, "?") {
+			dsn += "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+		}
+	} else if dsn == "" {
+		return nil, fmt.Errorf("storage dsn is required for driver %s", dialect.Name())
+	}
+
+	db, err := sql.Open(dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	db.SetConnMaxLifetime(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect storage: %w", err)
+	}
+	return &DB{db: db, dialect: dialect}, nil
+}
+
+// Dialect 返回当前方言
+func (d *DB) Dialect() Dialect {
+	return d.dialect
+}
+
+// Close 关闭连接
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// ExecContext 执行写语句
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.db.ExecContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+// QueryContext 执行查询
+func (d *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.db.QueryContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+// QueryRowContext 执行单行查询
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.db.QueryRowContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+// WithTx 在事务中执行 fn，fn 返回错误时回滚；回滚失败时一并返回回滚错误
+func (d *DB) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	sqlTx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&Tx{tx: sqlTx, dialect: d.dialect}); err != nil {
+		if rbErr := sqlTx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, fmt.Errorf("rollback failed: %w", rbErr))
+		}
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// Tx 带方言的事务
+type Tx struct {
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+// ExecContext 执行写语句
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, t.dialect.Rebind(query), args...)
+}
+
+// QueryContext 执行查询
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, t.dialect.Rebind(query), args...)
+}
+
+// QueryRowContext 执行单行查询
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, t.dialect.Rebind(query), args...)
+}
+
+var (
+	_ Execer = (*DB)(nil)
+	_ Execer = (*Tx)(nil)
+)
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(Config{DSN: filepath.Join(t.TempDir(), "nested", "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPostgresRebind(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"SELECT * FROM t WHERE a = '?' AND b = ?", "SELECT * FROM t WHERE a = '?' AND b = $1"},
+		{"UPDATE t SET note = 'it''s ?', v = ? WHERE id = ?", "UPDATE t SET note = 'it''s ?', v = $1 WHERE id = $2"},
+		{"INSERT INTO t VALUES (?, '', ?)", "INSERT INTO t VALUES ($1, '', $2)"},
+	}
+	for _, tc := range cases {
+		if got := (postgresDialect{}).Rebind(tc.query); got != tc.want {
+			t.Errorf("Rebind(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+		if got := (sqliteDialect{}).Rebind(tc.query); got != tc.query {
+			t.Errorf("sqlite Rebind(%q) = %q", tc.query, got)
+		}
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	for driver, want := range map[string]string{"": "sqlite", "SQLite3": "sqlite", "postgresql": "postgres", " pg ": "postgres"} {
+		d, err := dialectFor(driver)
+		if err != nil || d.Name() != want {
+			t.Errorf("dialectFor(%q) = %v, %v", driver, d, err)
+		}
+	}
+	if _, err := dialectFor("mysql"); err == nil {
+		t.Error("expected error for unsupported driver")
+	}
+	if _, err := Open(Config{Driver: "postgres"}); err == nil {
+		t.Error("expected error for postgres without dsn")
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	migrations := []Migration{
+		{Version: 2, Name: "add column", Statements: []string{"ALTER TABLE items ADD COLUMN note TEXT NOT NULL DEFAULT ''"}},
+		{Version: 1, Name: "create items", Statements: []string{"CREATE TABLE items (id TEXT PRIMARY KEY, qty INTEGER NOT NULL)"}},
+	}
+	// 重复执行时已应用的版本被跳过，否则 CREATE / ALTER 会失败
+	for i := 0; i < 2; i++ {
+		if err := db.Migrate(ctx, "test", migrations); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE component = ?", "test").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("applied migrations = %d, %v", count, err)
+	}
+
+	// 失败的迁移整体回滚，不记录版本
+	broken := append(migrations, Migration{Version: 3, Name: "broken", Statements: []string{
+		"CREATE TABLE extra (id TEXT)",
+		"INSERT INTO missing_table VALUES (1)",
+	}})
+	if err := db.Migrate(ctx, "test", broken); err == nil {
+		t.Fatal("expected migration error")
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE component = ?", "test").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("applied migrations after failure = %d, %v", count, err)
+	}
+	if _, err := db.ExecContext(ctx, "CREATE TABLE extra (id TEXT)"); err != nil {
+		t.Fatalf("table from failed migration was kept: %v", err)
+	}
+
+	// 其他组件的版本号互不影响
+	if err := db.Migrate(ctx, "other", []Migration{{Version: 1, Name: "create other", Statements: []string{"CREATE TABLE other (id TEXT)"}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	if db.Dialect().Name() != "sqlite" {
+		t.Fatalf("dialect = %s", db.Dialect().Name())
+	}
+	if _, err := db.ExecContext(ctx, "CREATE TABLE items (id TEXT PRIMARY KEY, qty INTEGER NOT NULL, note TEXT NOT NULL DEFAULT '?')"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO items (id, qty) VALUES (?, ?)", "a", 3)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fn 返回错误时事务回滚，错误原样返回
+	errAbort := errors.New("abort")
+	err = db.WithTx(ctx, func(tx *Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO items (id, qty) VALUES (?, ?)", "b", 5); err != nil {
+			return err
+		}
+		var qty int
+		if err := tx.QueryRowContext(ctx, "SELECT qty FROM items WHERE id = ?", "b").Scan(&qty); err != nil || qty != 5 {
+			t.Errorf("uncommitted read = %d, %v", qty, err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx err = %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, qty, note FROM items ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id, note string
+		var qty int
+		if err := rows.Scan(&id, &qty, &note); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id)
+		if id != "a" || qty != 3 || note != "?" {
+			t.Errorf("row = %s %d %q", id, qty, note)
+		}
+	}
+	if len(got) != 1 {
+		t.Fatalf("rows = %v", got)
+	}
+}
@@ -208,6 +208,63 @@ type PaymentListResponse struct {
 	PageSize int       `json:"page_size"`
 }
 
+// ===== Invoice Types =====
+
+// InvoiceKind represents what an invoice was issued for
+type InvoiceKind string
+
+const (
+	InvoiceKindPayment      InvoiceKind = "payment"
+	InvoiceKindSubscription InvoiceKind = "subscription"
+)
+
+// InvoiceSeller is the company header printed on an invoice
+type InvoiceSeller struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	TaxID   string `json:"tax_id,omitempty"`
+}
+
+// InvoiceLine represents an invoice line item, amounts include tax
+type InvoiceLine struct {
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitCents   int64  `json:"unit_cents"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// Invoice represents an issued invoice
+type Invoice struct {
+	ID             string        `json:"id"`
+	Number         string        `json:"number"`
+	Kind           InvoiceKind   `json:"kind"`
+	UserID         string        `json:"user_id"`
+	Username       string        `json:"username,omitempty"`
+	PaymentID      string        `json:"payment_id,omitempty"`
+	SubscriptionID string        `json:"subscription_id,omitempty"`
+	Seller         InvoiceSeller `json:"seller"`
+	Currency       string        `json:"currency"`
+	Lines          []InvoiceLine `json:"lines"`
+	SubtotalCents  int64         `json:"subtotal_cents"`
+	TaxRate        float64       `json:"tax_rate"`
+	TaxCents       int64         `json:"tax_cents"`
+	TotalCents     int64         `json:"total_cents"`
+	PaymentMethod  string        `json:"payment_method,omitempty"`
+	Reference      string        `json:"reference,omitempty"` // Order number or Lago invoice number
+	PeriodStart    *time.Time    `json:"period_start,omitempty"`
+	PeriodEnd      *time.Time    `json:"period_end,omitempty"`
+	PaidAt         *time.Time    `json:"paid_at,omitempty"`
+	IssuedAt       time.Time     `json:"issued_at"`
+}
+
+// InvoiceListResponse represents paginated invoices
+type InvoiceListResponse struct {
+	Invoices []Invoice `json:"invoices"`
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+}
+
 // ===== Configuration Types =====
 
 // BillingConfig represents billing configuration
@@ -225,6 +282,7 @@ type BillingConfig struct {
 	// Lago
 	LagoAPIURL string `json:"lago_api_url" yaml:"lago_api_url"`
 	LagoAPIKey string `json:"lago_api_key" yaml:"lago_api_key"`
+	LagoWebhookSecret string `json:"lago_webhook_secret" yaml:"lago_webhook_secret"` // HMAC key for webhook signatures
 
 	// Alipay
 	AlipayAppID      string `json:"alipay_app_id" yaml:"alipay_app_id"`
@@ -247,6 +305,13 @@ type BillingConfig struct {
 	// Subscription settings
 	GracePeriodHours    int  `json:"grace_period_hours" yaml:"grace_period_hours"`
 	RequireSubscription bool `json:"require_subscription" yaml:"require_subscription"`
+
+	// Invoices
+	InvoicePrefix         string  `json:"invoice_prefix" yaml:"invoice_prefix"`
+	InvoiceCompanyName    string  `json:"invoice_company_name" yaml:"invoice_company_name"`
+	InvoiceCompanyAddress string  `json:"invoice_company_address" yaml:"invoice_company_address"`
+	InvoiceTaxID          string  `json:"invoice_tax_id" yaml:"invoice_tax_id"`
+	InvoiceTaxRate        float64 `json:"invoice_tax_rate" yaml:"invoice_tax_rate"` // percent, included in prices
 }
 
 // BillingServiceStatus represents a billing service status
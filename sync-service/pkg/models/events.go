@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -82,6 +83,8 @@ type SyncRequest struct {
 	DeviceID     string `json:"device_id"`
 	LastSyncTime int64  `json:"last_sync_time"` // Unix timestamp
 	LastMsgID    string `json:"last_msg_id,omitempty"`
+	// Scopes 本设备的同步类别，为空时使用默认值
+	Scopes *SyncScopes `json:"scopes,omitempty"`
 }
 
 // SyncResponse 同步响应
@@ -92,6 +95,22 @@ type SyncResponse struct {
 	ServerTime    int64      `json:"server_time"`
 	HasMore       bool       `json:"has_more"`
 	NextCursor    string     `json:"next_cursor,omitempty"`
+	Scopes        SyncScopes `json:"scopes"` // 服务端采用的同步类别
+}
+
+// HistoryEvent 从消息历史回放的会话事件，Seq 为流序号，设备据此断点续传
+type HistoryEvent struct {
+	Seq       uint64          `json:"seq"`
+	Subject   string          `json:"subject"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// HistoryResponse 消息历史回放响应
+type HistoryResponse struct {
+	Events  []HistoryEvent `json:"events"`
+	LastSeq uint64         `json:"last_seq"` // 本批最后一条的序号，下次请求作为 since_seq
+	HasMore bool           `json:"has_more"`
 }
 
 // AuthRequest 认证请求
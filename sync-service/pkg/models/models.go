@@ -66,6 +66,7 @@ type Message struct {
 	FinishReason    string                 `json:"finish_reason,omitempty"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt       time.Time              `json:"created_at"`
+	Seq             uint64                 `json:"seq,omitempty"` // JetStream 流序号，未启用消息历史时为 0
 }
 
 // PresenceStatus 在线状态
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SyncScope 同步类别，与客户端 services/sync.Scope 取值一致
+type SyncScope string
+
+const (
+	ScopeProviders   SyncScope = "providers"    // 供应商配置
+	ScopeAppSettings SyncScope = "app_settings" // 应用设置
+	ScopeUsageStats  SyncScope = "usage_stats"  // 用量统计（配额变更等）
+	ScopeRequestLogs SyncScope = "request_logs" // 请求日志
+	ScopeSkills      SyncScope = "skills"       // Skill 列表
+	ScopeMCP         SyncScope = "mcp"          // MCP 服务器列表
+)
+
+// SyncScopes 设备的同步类别开关
+type SyncScopes struct {
+	Providers bool `json:"providers"`
+	// ProviderAPIKeys 是否接收带 API Key 的供应商配置，仅在 Providers 开启时生效
+	ProviderAPIKeys bool `json:"provider_api_keys"`
+	AppSettings     bool `json:"app_settings"`
+	UsageStats      bool `json:"usage_stats"`
+	RequestLogs     bool `json:"request_logs"`
+	Skills          bool `json:"skills"`
+	MCP             bool `json:"mcp"`
+}
+
+// DefaultSyncScopes 未声明同步类别的设备使用的默认值，与客户端默认一致
+func DefaultSyncScopes() SyncScopes {
+	return SyncScopes{
+		Providers:   true,
+		AppSettings: true,
+		UsageStats:  true,
+		Skills:      true,
+		MCP:         true,
+	}
+}
+
+// ParseSyncScopes 解析逗号分隔的类别列表（如 "providers,mcp"），未知类别忽略
+func ParseSyncScopes(list string) SyncScopes {
+	var scopes SyncScopes
+	for _, item := range strings.Split(list, ",") {
+		scopes.Set(SyncScope(strings.TrimSpace(item)), true)
+	}
+	return scopes
+}
+
+// Allows 检查类别是否开启
+func (s SyncScopes) Allows(scope SyncScope) bool {
+	switch scope {
+	case ScopeProviders:
+		return s.Providers
+	case ScopeAppSettings:
+		return s.AppSettings
+	case ScopeUsageStats:
+		return s.UsageStats
+	case ScopeRequestLogs:
+		return s.RequestLogs
+	case ScopeSkills:
+		return s.Skills
+	case ScopeMCP:
+		return s.MCP
+	default:
+		return false
+	}
+}
+
+// Set 开启或关闭类别，"provider_api_keys" 控制是否接收 API Key，未知类别返回 false
+func (s *SyncScopes) Set(scope SyncScope, on bool) bool {
+	switch scope {
+	case ScopeProviders:
+		s.Providers = on
+	case "provider_api_keys":
+		s.ProviderAPIKeys = on
+	case ScopeAppSettings:
+		s.AppSettings = on
+	case ScopeUsageStats:
+		s.UsageStats = on
+	case ScopeRequestLogs:
+		s.RequestLogs = on
+	case ScopeSkills:
+		s.Skills = on
+	case ScopeMCP:
+		s.MCP = on
+	default:
+		return false
+	}
+	return true
+}
+
+// IncludeAPIKeys 是否接收供应商 API Key
+func (s SyncScopes) IncludeAPIKeys() bool {
+	return s.Providers && s.ProviderAPIKeys
+}
+
+// ScopedEvent 客户端按同步类别发布的数据快照（主题 user.<user_id>.sync_<scope>）
+type ScopedEvent struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"` // sync.<scope>
+	Scope    SyncScope `json:"scope"`
+	UserID   string    `json:"user_id"`
+	DeviceID string    `json:"device_id"`
+	// IncludesSecrets 负载中保留了 API Key 等密钥
+	IncludesSecrets bool            `json:"includes_secrets"`
+	Data            json.RawMessage `json:"data,omitempty"` // 整体快照（Skill、MCP、请求日志）
+	Docs            []SyncDoc       `json:"docs,omitempty"` // 带版本的文档（供应商、应用设置）
+	Timestamp       time.Time       `json:"timestamp"`
+}
+
+// VectorClock 向量时钟：设备 ID -> 该设备对文档的修改次数，客户端据此检测并发修改
+type VectorClock map[string]uint64
+
+// SyncDoc 带版本的同步文档，Data 为 JSON 对象
+type SyncDoc struct {
+	Key   string         `json:"key"`
+	Clock VectorClock    `json:"clock"`
+	Data  map[string]any `json:"data"`
+}
+
+// ScopeForSubject 返回用户主题所属的同步类别，不受类别控制的主题返回 false
+func ScopeForSubject(subject string) (SyncScope, bool) {
+	parts := strings.Split(subject, ".")
+	if len(parts) != 3 || parts[0] != "user" {
+		return "", false
+	}
+	if parts[2] == "quota" {
+		return ScopeUsageStats, true
+	}
+	if scope, ok := strings.CutPrefix(parts[2], "sync_"); ok {
+		return SyncScope(scope), true
+	}
+	return "", false
+}
+
+// secretSuffixes 视为密钥的字段名后缀（小写、去掉 _ 和 - 后比较）
+var secretSuffixes = []string{"apikey", "token", "secret", "password"}
+
+func isSecretKey(name string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(normalized, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact 移除事件快照和文档中的密钥字段
+func (e *ScopedEvent) Redact() {
+	if len(e.Data) > 0 {
+		e.Data = RedactSecrets(e.Data)
+	}
+	for i := range e.Docs {
+		stripSecrets(e.Docs[i].Data)
+	}
+	e.IncludesSecrets = false
+}
+
+// RedactSecrets 递归删除 JSON 中的密钥字段，无法解析时原样返回
+func RedactSecrets(data json.RawMessage) json.RawMessage {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	redacted, err := json.Marshal(stripSecrets(v))
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+func stripSecrets(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			if isSecretKey(k) {
+				delete(val, k)
+				continue
+			}
+			val[k] = stripSecrets(child)
+		}
+		return val
+	case []any:
+		for i, child := range val {
+			val[i] = stripSecrets(child)
+		}
+		return val
+	default:
+		return v
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"codeswitch/services"
+	"log"
+
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// trayPlatforms 托盘中可快速切换 provider 的平台
+var trayPlatforms = []struct {
+	kind  string
+	label string
+}{
+	{"claude", "Claude Code"},
+	{"codex", "Codex"},
+	{"gemini-cli", "Gemini CLI"},
+}
+
+// addProviderMenus 为每个平台添加 provider 子菜单：勾选项为当前固定的 provider，"自动" 恢复正常路由
+func addProviderMenus(menu *application.Menu, providerService *services.ProviderService, providerRelay *services.ProviderRelayService, refresh func()) {
+	for _, platform := range trayPlatforms {
+		kind := platform.kind
+		pinned := providerRelay.GetPinnedProvider(kind)
+
+		label := platform.label
+		if pinned != "" {
+			label += "：" + pinned
+		}
+		submenu := menu.AddSubmenu(label)
+		submenu.AddCheckbox("自动", pinned == "").OnClick(func(*application.Context) {
+			pinTrayProvider(providerRelay, kind, "", refresh)
+		})
+		submenu.AddSeparator()
+
+		providers, err := providerService.LoadProviders(kind)
+		if err != nil {
+			log.Printf("[Tray] failed to load %s providers: %v", kind, err)
+		}
+		count := 0
+		for _, provider := range providers {
+			if !provider.Enabled {
+				continue
+			}
+			name := provider.Name
+			itemLabel := name
+			if provider.Suspended {
+				itemLabel += "（已挂起）"
+			}
+			submenu.AddCheckbox(itemLabel, name == pinned).OnClick(func(*application.Context) {
+				pinTrayProvider(providerRelay, kind, name, refresh)
+			})
+			count++
+		}
+		if count == 0 {
+			submenu.Add("暂无已启用的 provider").SetEnabled(false)
+		}
+	}
+}
+
+// pinTrayProvider 固定 / 取消固定 provider 后刷新菜单，使勾选状态与实际配置一致
+func pinTrayProvider(providerRelay *services.ProviderRelayService, kind, name string, refresh func()) {
+	if err := providerRelay.PinProvider(kind, name); err != nil {
+		log.Printf("[Tray] failed to pin %s provider %q: %v", kind, name, err)
+	}
+	refresh()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"codeswitch/services"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// trayStatusInterval 托盘图标与提示的刷新间隔
+const trayStatusInterval = 5 * time.Second
+
+// trayBadgeColors 各状态对应的角标颜色
+var trayBadgeColors = map[string]color.RGBA{
+	services.RelayHealthHealthy:  {R: 0x34, G: 0xc7, B: 0x59, A: 0xff},
+	services.RelayHealthDegraded: {R: 0xff, G: 0x9f, B: 0x0a, A: 0xff},
+	services.RelayHealthFailing:  {R: 0xff, G: 0x3b, B: 0x30, A: 0xff},
+	services.RelayHealthPaused:   {R: 0x8e, G: 0x8e, B: 0x93, A: 0xff},
+	services.RelayHealthStopped:  {R: 0x8e, G: 0x8e, B: 0x93, A: 0xff},
+}
+
+var trayHealthLabels = map[string]string{
+	services.RelayHealthHealthy:  "运行中",
+	services.RelayHealthDegraded: "部分请求失败",
+	services.RelayHealthFailing:  "大量请求失败",
+	services.RelayHealthPaused:   "已暂停",
+	services.RelayHealthStopped:  "未运行",
+}
+
+var (
+	trayBadgeMu    sync.Mutex
+	trayBadgeCache = map[string][]byte{}
+)
+
+// watchTrayStatus 定时刷新托盘图标角标与提示文字
+func watchTrayStatus(systray *application.SystemTray, providerRelay *services.ProviderRelayService) {
+	defer services.RecoverPanic("tray status")
+	lastHealth := ""
+	lastTooltip := ""
+	update := func() {
+		status := providerRelay.GetRelayStatus()
+		if status.Health != lastHealth {
+			if icon := badgeTrayIcon("assets/icon.png", status.Health); len(icon) > 0 {
+				systray.SetIcon(icon)
+			}
+			if icon := badgeTrayIcon("assets/icon-dark.png", status.Health); len(icon) > 0 {
+				systray.SetDarkModeIcon(icon)
+			}
+			lastHealth = status.Health
+		}
+		if tooltip := trayTooltip(status, providerRelay.GetPinnedProviders()); tooltip != lastTooltip {
+			systray.SetTooltip(tooltip)
+			lastTooltip = tooltip
+		}
+	}
+
+	update()
+	ticker := time.NewTicker(trayStatusInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		update()
+	}
+}
+
+// trayTooltip 托盘提示：运行状态、今日请求数与花费、请求速率、错误率与当前 provider
+func trayTooltip(status services.RelayStatus, pins map[string]string) string {
+	lines := []string{
+		"Ailurus PaaS · " + trayHealthLabels[status.Health],
+		fmt.Sprintf("今日 %d 次请求 · $%.2f", status.TodayRequests, status.TodayCost),
+	}
+	if status.Running && !status.Paused {
+		lines = append(lines, fmt.Sprintf("%.0f 次/分钟 · 错误率 %.0f%%", status.RequestsPerMin, status.ErrorRate*100))
+	}
+	// 固定的 provider 优先于最近一次成功请求使用的 provider
+	provider := status.ActiveProvider
+	if pinned := pins[status.ActivePlatform]; pinned != "" {
+		provider = pinned
+	}
+	if provider != "" {
+		lines = append(lines, fmt.Sprintf("当前 provider：%s", provider))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// badgeTrayIcon 在托盘图标右下角绘制状态角标，结果按图标与状态缓存
+func badgeTrayIcon(path, health string) []byte {
+	key := path + ":" + health
+	trayBadgeMu.Lock()
+	defer trayBadgeMu.Unlock()
+	if icon, ok := trayBadgeCache[key]; ok {
+		return icon
+	}
+
+	data := loadTrayIcon(path)
+	badgeColor, ok := trayBadgeColors[health]
+	if len(data) == 0 || !ok {
+		return data
+	}
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("failed to decode tray icon %s: %v", path, err)
+		return data
+	}
+
+	bounds := src.Bounds()
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, src, bounds.Min, draw.Src)
+
+	size := bounds.Dx()
+	if bounds.Dy() < size {
+		size = bounds.Dy()
+	}
+	radius := float64(size) * 0.2
+	border := radius * 0.25
+	cx := float64(bounds.Max.X) - radius - border
+	cy := float64(bounds.Max.Y) - radius - border
+	outer := radius + border
+	for y := int(cy - outer); y <= int(cy+outer); y++ {
+		for x := int(cx - outer); x <= int(cx+outer); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			dist := dx*dx + dy*dy
+			switch {
+			case dist <= radius*radius:
+				img.SetRGBA(x, y, badgeColor)
+			case dist <= outer*outer:
+				// 白色描边，使角标在深色与浅色背景上都清晰
+				img.SetRGBA(x, y, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		log.Printf("failed to encode tray icon %s: %v", path, err)
+		return data
+	}
+	trayBadgeCache[key] = buf.Bytes()
+	return buf.Bytes()
+}
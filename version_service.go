@@ -1,15 +1,61 @@
 package main
 
+import "codeswitch/services"
+
 const AppVersion = "v0.1.8"
 
 type VersionService struct {
 	version string
+	updater *services.UpdateService
+	quit    func()
 }
 
 func NewVersionService() *VersionService {
-	return &VersionService{version: AppVersion}
+	return &VersionService{
+		version: AppVersion,
+		updater: services.NewUpdateService(AppVersion),
+	}
 }
 
 func (vs *VersionService) CurrentVersion() string {
 	return vs.version
 }
+
+// CheckForUpdate 检查当前更新通道的最新版本
+func (vs *VersionService) CheckForUpdate() (services.UpdateInfo, error) {
+	return vs.updater.CheckForUpdate()
+}
+
+// DownloadUpdate 下载并校验最新版本，进度通过 update:progress 事件推送
+func (vs *VersionService) DownloadUpdate() (services.UpdateInfo, error) {
+	return vs.updater.DownloadUpdate()
+}
+
+// RestartToUpdate 退出并安装已下载的更新，完成后自动重新启动
+func (vs *VersionService) RestartToUpdate() error {
+	if err := vs.updater.RequestRestart(); err != nil {
+		return err
+	}
+	if vs.quit != nil {
+		go vs.quit()
+	}
+	return nil
+}
+
+// SkipVersion 跳过指定版本，不再提示更新
+func (vs *VersionService) SkipVersion(version string) error {
+	return vs.updater.SkipVersion(version)
+}
+
+// GetStagedVersion 已下载、将在退出时安装的版本
+func (vs *VersionService) GetStagedVersion() string {
+	return vs.updater.GetStagedVersion()
+}
+
+func (vs *VersionService) GetUpdateSettings() services.UpdateSettings {
+	return vs.updater.GetUpdateSettings()
+}
+
+func (vs *VersionService) SaveUpdateSettings(settings services.UpdateSettings) (services.UpdateSettings, error) {
+	return vs.updater.SaveUpdateSettings(settings)
+}